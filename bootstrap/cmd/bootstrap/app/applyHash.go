@@ -0,0 +1,208 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DeploymentNoChangeReason indicates a request wasn't applied because it matches the KfDef
+// and manifests which were last applied successfully.
+const DeploymentNoChangeReason = "NoChange"
+
+// ForceApplyAnnotation if set to true on a request applies it even if nothing changed e.g. to
+// restore resources which were changed by hand.
+const ForceApplyAnnotation = "kfctl.kubeflow.org/force-apply"
+
+// appliedHashFile is the name of the file in the apps directory storing the hash of the last
+// successful apply.
+const appliedHashFile = ".applied_hash"
+
+// hashKfDef returns a canonical hash of the name and spec of the request together with the
+// contents of the manifests the deployment was last applied with. repos is where each repo was
+// cached by the last apply. The access token, metadata and status aren't part of the hash.
+func hashKfDef(d kfdefs.KfDef, repos map[string]kfdefs.RepoCache) (string, error) {
+	spec := d.Spec.DeepCopy()
+	spec.AppDir = ""
+	secrets := []kfdefs.Secret{}
+	for _, s := range spec.Secrets {
+		if s.Name == gcp.GcpAccessTokenName {
+			continue
+		}
+		// The server moves literal values to the environment so secrets are compared by value.
+		if src := s.SecretSource; src != nil && src.LiteralSource == nil && src.EnvSource != nil {
+			s.SecretSource = &kfdefs.SecretSource{
+				LiteralSource: &kfdefs.LiteralSource{Value: os.Getenv(src.EnvSource.Name)},
+			}
+		}
+		secrets = append(secrets, s)
+	}
+	spec.Secrets = secrets
+
+	// Round trip the spec through a generic value so plugin specs are compared regardless of
+	// formatting and the keys of every object are sorted.
+	buf, err := json.Marshal(spec)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(buf, &normalized); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if buf, err = json.Marshal(normalized); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "name=%v\nspec=%s\n", d.Name, buf)
+
+	names := []string{}
+	for _, r := range spec.Repos {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		cache, ok := repos[n]
+		if !ok || cache.LocalPath == "" {
+			return "", fmt.Errorf("repo %v isn't cached", n)
+		}
+		digest, err := hashDir(cache.LocalPath)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "repo=%v %v\n", n, digest)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir returns a hash of the paths and contents of the regular files in dir.
+func hashDir(dir string) (string, error) {
+	h := sha256.New()
+	// Walk visits the files in lexical order so the hash doesn't depend on the file system.
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "%v %v\n", filepath.ToSlash(rel), info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadAppliedHash restores the hash of the last successful apply stored before the server restarted.
+func (s *kfctlServer) loadAppliedHash() {
+	buf, err := ioutil.ReadFile(path.Join(s.appsDir, appliedHashFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read the hash of the last apply; %v", err)
+		}
+		return
+	}
+	s.appliedHash = strings.TrimSpace(string(buf))
+}
+
+// setAppliedHash records the hash of the last successful apply; empty forgets it so the next
+// request is applied. Must be called with kfDefMux held.
+func (s *kfctlServer) setAppliedHash(hash string) {
+	s.appliedHash = hash
+	file := path.Join(s.appsDir, appliedHashFile)
+	if hash == "" {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Could not remove %v; %v", file, err)
+		}
+		return
+	}
+	if err := writeFileAtomic(file, []byte(hash+"\n")); err != nil {
+		log.Warnf("Could not record the hash of the apply; %v", err)
+	}
+}
+
+// recordApplied records the hash of the request which was just applied successfully.
+func (s *kfctlServer) recordApplied(r kfdefs.KfDef, applied *kfdefs.KfDef) {
+	if applied == nil {
+		return
+	}
+	hash, err := hashKfDef(r, applied.Status.ReposCache)
+	if err != nil {
+		log.Warnf("Could not hash deployment %v; the next request will be applied; %v", r.Name, err)
+		hash = ""
+	}
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.setAppliedHash(hash)
+}
+
+// noChange returns the status of the deployment if req matches the last successful apply and
+// nothing is in flight; otherwise it returns nil and req should be applied.
+func (s *kfctlServer) noChange(req kfdefs.KfDef) *kfdefs.KfDef {
+	if req.Annotations[ForceApplyAnnotation] == "true" {
+		return nil
+	}
+
+	s.kfDefMux.Lock()
+	applied := s.appliedHash
+	repos := s.latestKfDef.Status.ReposCache
+	s.kfDefMux.Unlock()
+	if applied == "" {
+		return nil
+	}
+
+	hash, err := hashKfDef(req, repos)
+	if err != nil {
+		log.Infof("Could not hash deployment %v; applying it; %v", req.Name, err)
+		return nil
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	if hash != s.appliedHash || s.busy || len(s.c) > 0 {
+		return nil
+	}
+	log.Infof("Deployment %v didn't change since it was last applied; skipping the apply", req.Name)
+	conditions := []kfdefs.KfDefCondition{}
+	for _, c := range s.latestKfDef.Status.Conditions {
+		if c.Reason != DeploymentNoChangeReason {
+			conditions = append(conditions, c)
+		}
+	}
+	s.latestKfDef.Status.Conditions = append(conditions, kfdefs.KfDefCondition{
+		Type:               kfdefs.KfSucceeded,
+		Status:             v1.ConditionTrue,
+		Reason:             DeploymentNoChangeReason,
+		Message:            fmt.Sprintf("The KfDef and manifests match the last successful apply; set the annotation %v to true to apply it anyway.", ForceApplyAnnotation),
+		LastUpdateTime:     metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	})
+	s.publishStatus()
+	return s.latestKfDef.DeepCopy()
+}
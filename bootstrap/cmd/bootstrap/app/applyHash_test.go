@@ -0,0 +1,118 @@
+package app
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// newHashTestKfDef returns a KfDef using a manifests repo cached in dir.
+func newHashTestKfDef(t *testing.T, dir string) (kfdefsv3.KfDef, map[string]kfdefsv3.RepoCache) {
+	repo := path.Join(dir, "manifests")
+	if err := os.MkdirAll(path.Join(repo, "jupyter"), os.ModePerm); err != nil {
+		t.Fatalf("Could not create the repo; %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(repo, "jupyter", "kustomization.yaml"), []byte("kind: Kustomization\n"), 0644); err != nil {
+		t.Fatalf("Could not create the repo; %v", err)
+	}
+	d := newPlanTestKfDef()
+	d.Spec.Repos = []kfdefsv3.Repo{{
+		Name: "manifests",
+		Uri:  "https://github.com/kubeflow/manifests/archive/master.tar.gz",
+	}}
+	return d, map[string]kfdefsv3.RepoCache{"manifests": {LocalPath: repo}}
+}
+
+func TestHashKfDef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hash")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, repos := newHashTestKfDef(t, dir)
+	base, err := hashKfDef(d, repos)
+	if err != nil {
+		t.Fatalf("hashKfDef: %v", err)
+	}
+
+	// A new access token, app dir and metadata don't change the hash.
+	same := *d.DeepCopy()
+	same.Spec.Secrets[0].SecretSource.LiteralSource.Value = "token2"
+	same.Spec.AppDir = "/apps/kf-app"
+	same.Annotations = map[string]string{DescriptionAnnotation: "Team A"}
+	if h, err := hashKfDef(same, repos); err != nil || h != base {
+		t.Errorf("Hash changed with the access token, app dir or metadata; got %v, %v; want %v", h, err, base)
+	}
+
+	changed := *d.DeepCopy()
+	changed.Spec.Zone = "us-central1-a"
+	if h, err := hashKfDef(changed, repos); err != nil || h == base {
+		t.Errorf("Hash didn't change with the spec; got %v, %v", h, err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(repos["manifests"].LocalPath, "jupyter", "kustomization.yaml"), []byte("kind: Kustomization\nnamespace: kubeflow\n"), 0644); err != nil {
+		t.Fatalf("Could not change the repo; %v", err)
+	}
+	if h, err := hashKfDef(d, repos); err != nil || h == base {
+		t.Errorf("Hash didn't change with the manifests; got %v, %v", h, err)
+	}
+
+	if _, err := hashKfDef(d, nil); err == nil {
+		t.Errorf("hashKfDef of a deployment whose repos aren't cached should fail")
+	}
+}
+
+func TestKfctlServer_NoChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nochange")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req, repos := newHashTestKfDef(t, dir)
+
+	if d := s.noChange(req); d != nil {
+		t.Errorf("A deployment that was never applied was skipped")
+	}
+
+	s.latestKfDef.Status.ReposCache = repos
+	s.recordApplied(req, &s.latestKfDef)
+
+	d := s.noChange(req)
+	if d == nil {
+		t.Fatalf("The unchanged deployment wasn't skipped")
+	}
+	found := false
+	for _, c := range d.Status.Conditions {
+		found = found || c.Reason == DeploymentNoChangeReason
+	}
+	if !found {
+		t.Errorf("Status doesn't report the deployment didn't change; %v", PrettyPrint(d.Status))
+	}
+
+	// The hash survives restarts.
+	if restarted := newPauseTestServer(t, dir); restarted.appliedHash != s.appliedHash {
+		t.Errorf("Applied hash after restart: got %v; want %v", restarted.appliedHash, s.appliedHash)
+	}
+
+	forced := *req.DeepCopy()
+	forced.Annotations = map[string]string{ForceApplyAnnotation: "true"}
+	if d := s.noChange(forced); d != nil {
+		t.Errorf("The forced apply was skipped")
+	}
+
+	changed := *req.DeepCopy()
+	changed.Spec.Zone = "us-central1-a"
+	if d := s.noChange(changed); d != nil {
+		t.Errorf("The changed deployment was skipped")
+	}
+
+	s.busy = true
+	if d := s.noChange(req); d != nil {
+		t.Errorf("The deployment was skipped while it is being applied")
+	}
+}
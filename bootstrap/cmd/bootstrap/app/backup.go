@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// KfctlBackupPath is the path on which to serve requests to back up the K8s resources of the deployment
+const KfctlBackupPath = "/kfctl/apps/v1alpha2/backup"
+
+// KfctlRestorePath is the path on which to serve requests to restore a backup into the deployment
+const KfctlRestorePath = "/kfctl/apps/v1alpha2/restore"
+
+// BackupRequest snapshots the K8s resources of a deployment.
+type BackupRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef   kfdefs.KfDef            `json:"kfDef"`
+	Options kustomize.BackupOptions `json:"options,omitempty"`
+}
+
+// RestoreRequest restores a backup into a deployment. The deployment is usually a new deployment
+// created from the KfDef of the deployment backed up e.g. in another cluster after a disaster.
+type RestoreRequest struct {
+	// KfDef identifies the deployment to restore into and provides the credentials.
+	KfDef  kfdefs.KfDef               `json:"kfDef"`
+	Backup kustomize.ResourceSnapshot `json:"backup"`
+}
+
+// resourceBackup returns the kustomize plugin of the deployment handled by the server configured
+// to access the cluster if it is the deployment in the request.
+func (s *kfctlServer) resourceBackup(ctx context.Context, req kfdefs.KfDef) (kustomize.ResourceBackup, error) {
+	p, _, err := s.clusterPlugin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := p.(kustomize.ResourceBackup)
+	if !ok {
+		log.Errorf("The kustomize plugin doesn't implement the ResourceBackup interface")
+		return nil, &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return b, nil
+}
+
+// Backup snapshots the K8s objects created for the deployment handled by the server and with
+// SnapshotVolumes the data of its persistent volume claims.
+func (s *kfctlServer) Backup(ctx context.Context, req BackupRequest) (*kustomize.ResourceSnapshot, error) {
+	// The inventory is recorded while the deployment is being applied.
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+
+	b, err := s.resourceBackup(ctx, req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := b.BackupResources(req.Options)
+	if err != nil {
+		log.Errorf("Could not back up deployment %v; error %v", req.KfDef.Name, err)
+		return nil, &httpError{
+			Message: fmt.Sprintf("Could not back up deployment %v: %v", req.KfDef.Name, err),
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	log.Infof("Backed up %v objects and %v volumes of deployment %v", len(snapshot.Objects), len(snapshot.Volumes), req.KfDef.Name)
+	return snapshot, nil
+}
+
+// Restore recreates the objects of a backup in the cluster of the deployment handled by the server.
+// The restored objects are added to the inventory so they are deleted with the deployment.
+func (s *kfctlServer) Restore(ctx context.Context, req RestoreRequest) (*kustomize.RestoreReport, error) {
+	if req.Backup.Deployment == "" || len(req.Backup.Objects) == 0 {
+		return nil, &httpError{
+			Message: "backup is required and must contain the objects to restore",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+	s.kfDefMux.Lock()
+	busy := s.busy
+	s.kfDefMux.Unlock()
+	if busy {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v is being applied; restore the backup once the run finishes", req.KfDef.Name),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	b, err := s.resourceBackup(ctx, req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	report, err := b.RestoreResources(&req.Backup)
+	if err != nil {
+		log.Errorf("Could not restore the backup of %v into deployment %v; error %v", req.Backup.Deployment, req.KfDef.Name, err)
+		return nil, &httpError{
+			Message: fmt.Sprintf("Could not restore the backup of %v into deployment %v: %v", req.Backup.Deployment, req.KfDef.Name, err),
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	s.setLatestKfDef(s.kfDefGetter.GetKfDef())
+	if len(report.Failed) > 0 {
+		log.Warnf("Could not restore %v objects of the backup of %v into deployment %v", len(report.Failed), req.Backup.Deployment, req.KfDef.Name)
+	}
+	return report, nil
+}
+
+// Backup forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) Backup(ctx context.Context, req BackupRequest) (*kustomize.ResourceSnapshot, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.Backup(ctx, req)
+}
+
+// Restore forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) Restore(ctx context.Context, req RestoreRequest) (*kustomize.RestoreReport, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.Restore(ctx, req)
+}
+
+// Backup snapshots the K8s resources of the deployment. The backup contains the secrets of the
+// deployment.
+func (c *KfctlClient) Backup(ctx context.Context, req BackupRequest) (*kustomize.ResourceSnapshot, error) {
+	var resp interface{}
+	err := c.retry("Backup", func() error {
+		var err error
+		resp, err = c.backupEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kustomize.ResourceSnapshot)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// Restore restores a backup into the deployment.
+func (c *KfctlClient) Restore(ctx context.Context, req RestoreRequest) (*kustomize.RestoreReport, error) {
+	resp, err := c.restoreEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kustomize.RestoreReport)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeBackupEndpoint creates an endpoint to handle requests to back up the deployment.
+func makeBackupEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BackupRequest)
+		return svc.Backup(ctx, req)
+	}
+}
+
+// makeRestoreEndpoint creates an endpoint to handle requests to restore a backup into the deployment.
+func makeRestoreEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RestoreRequest)
+		return svc.Restore(ctx, req)
+	}
+}
+
+// decodeHTTPBackupRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded BackupRequest from the HTTP request body.
+func decodeHTTPBackupRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request BackupRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding backup request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
+
+// decodeHTTPRestoreRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded RestoreRequest from the HTTP request body.
+func decodeHTTPRestoreRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request RestoreRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding restore request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestKfctlServer_Backup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	// The KfApp isn't loaded until the deployment is applied.
+	_, err = s.Backup(context.Background(), BackupRequest{KfDef: req})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("Backup before the deployment is applied: want 404; got %v", err)
+	}
+
+	other := newPlanTestKfDef()
+	other.Name = "other"
+	_, err = s.Backup(context.Background(), BackupRequest{KfDef: other})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("Backup of another deployment: want 404; got %v", err)
+	}
+}
+
+func TestKfctlServer_Restore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+	backup := kustomize.ResourceSnapshot{
+		Deployment: "kf-lost",
+		Objects: []map[string]interface{}{
+			{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name":      "jupyter-web-app-config",
+					"namespace": "kubeflow",
+				},
+			},
+		},
+	}
+
+	_, err = s.Restore(context.Background(), RestoreRequest{KfDef: req})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("Restore without a backup: want 400; got %v", err)
+	}
+
+	s.setBusy(true)
+	_, err = s.Restore(context.Background(), RestoreRequest{KfDef: req, Backup: backup})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("Restore while the deployment is being applied: want 409; got %v", err)
+	}
+	s.setBusy(false)
+
+	other := newPlanTestKfDef()
+	other.Name = "other"
+	_, err = s.Restore(context.Background(), RestoreRequest{KfDef: other, Backup: backup})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("Restore into another deployment: want 404; got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultBatchParallelism is the number of requests GetLatestKfdefs sends at once by default.
+	defaultBatchParallelism = 8
+	// maxBatchErrorsShown is the number of failures listed by the message of a BatchError.
+	maxBatchErrorsShown = 3
+)
+
+// BatchFailure is the error fetching one of the KfDefs of GetLatestKfdefs.
+type BatchFailure struct {
+	// Index is the index of the KfDef in the request.
+	Index   int
+	Name    string
+	Project string
+	Err     error
+}
+
+// BatchError is returned by GetLatestKfdefs if any of the KfDefs couldn't be fetched.
+type BatchError struct {
+	// Failures are ordered by Index.
+	Failures []BatchFailure
+	// Total is the number of KfDefs requested.
+	Total int
+}
+
+func (e *BatchError) Error() string {
+	msgs := []string{}
+	for i, f := range e.Failures {
+		if i == maxBatchErrorsShown {
+			msgs = append(msgs, fmt.Sprintf("and %v more", len(e.Failures)-maxBatchErrorsShown))
+			break
+		}
+		msgs = append(msgs, fmt.Sprintf("%v (project %v): %v", f.Name, f.Project, f.Err))
+	}
+	return fmt.Sprintf("Could not get %v of %v deployments; %v", len(e.Failures), e.Total, strings.Join(msgs, "; "))
+}
+
+// GetLatestKfdefs gets the latest KfDef of each of reqs with at most parallelism requests in
+// flight; parallelism defaults to 8 if it isn't positive. The KfDefs are returned in the order of
+// reqs. If any can't be fetched the others are still returned along with a *BatchError listing the
+// failures; their KfDefs are nil. Once ctx is done the requests not yet sent fail with its error.
+func (c *KfctlClient) GetLatestKfdefs(ctx context.Context, reqs []kfdefs.KfDef, parallelism int) ([]*kfdefs.KfDef, error) {
+	if parallelism <= 0 {
+		parallelism = defaultBatchParallelism
+	}
+
+	results := make([]*kfdefs.KfDef, len(reqs))
+	errs := make([]error, len(reqs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range reqs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = c.getLatestKfdef(ctx, reqs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	batchErr := &BatchError{Total: len(reqs)}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		batchErr.Failures = append(batchErr.Failures, BatchFailure{
+			Index:   i,
+			Name:    reqs[i].Name,
+			Project: reqs[i].Spec.Project,
+			Err:     err,
+		})
+	}
+	if len(batchErr.Failures) > 0 {
+		return results, batchErr
+	}
+	return results, nil
+}
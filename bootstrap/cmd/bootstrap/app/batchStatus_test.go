@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// batchKfctlService fails GetLatestKfdef for the deployments named bad-* and records the
+// largest number of concurrent calls.
+type batchKfctlService struct {
+	fakeKfctlService
+	inFlight    int
+	maxInFlight int
+}
+
+func (f *batchKfctlService) GetLatestKfdef(req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	f.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+	if strings.HasPrefix(req.Name, "bad-") {
+		return nil, &httpError{Message: "deployment not found", Code: http.StatusNotFound}
+	}
+	req.Spec.Version = "v0.7.0"
+	return &req, nil
+}
+
+func TestKfctlClient_GetLatestKfdefs(t *testing.T) {
+	svc := &batchKfctlService{}
+	mux := http.NewServeMux()
+	mux.Handle(KfctlGetpath, httptransport.NewServer(makeServerStatusRequestEndpoint(svc), decodeHTTPKfdefRequest, encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, err := NewKfctlClient(server.URL, WithRetryBackOff(func() backoff.BackOff { return &backoff.StopBackOff{} }))
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+
+	reqs := []kfdefsv3.KfDef{}
+	for i := 0; i < 20; i++ {
+		d := kfdefsv3.KfDef{}
+		d.Name = fmt.Sprintf("kf-app-%v", i)
+		if i%5 == 0 {
+			d.Name = fmt.Sprintf("bad-%v", i)
+		}
+		d.Spec.Project = "someproject"
+		reqs = append(reqs, d)
+	}
+
+	results, err := c.(*KfctlClient).GetLatestKfdefs(context.Background(), reqs, 3)
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("GetLatestKfdefs: got error %v; want a BatchError", err)
+	}
+	if batchErr.Total != 20 || len(batchErr.Failures) != 4 {
+		t.Errorf("BatchError: got %v failures of %v; want 4 of 20", len(batchErr.Failures), batchErr.Total)
+	}
+	for i, f := range batchErr.Failures {
+		if f.Index != i*5 || f.Name != reqs[i*5].Name || f.Project != "someproject" {
+			t.Errorf("Failure %v: got %+v", i, f)
+		}
+	}
+	if !strings.Contains(batchErr.Error(), "4 of 20") || !strings.Contains(batchErr.Error(), "and 1 more") {
+		t.Errorf("BatchError message: got %v", batchErr.Error())
+	}
+
+	for i, d := range results {
+		if i%5 == 0 {
+			if d != nil {
+				t.Errorf("Result %v: got %v; want nil for a failure", i, d.Name)
+			}
+			continue
+		}
+		if d == nil || d.Name != reqs[i].Name || d.Spec.Version != "v0.7.0" {
+			t.Errorf("Result %v: got %+v; want the KfDef of %v", i, d, reqs[i].Name)
+		}
+	}
+	if svc.maxInFlight > 3 || svc.maxInFlight < 2 {
+		t.Errorf("Concurrent requests: got %v; want at most 3 and more than 1", svc.maxInFlight)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.(*KfctlClient).GetLatestKfdefs(ctx, reqs[1:3], 1)
+	if batchErr, ok := err.(*BatchError); !ok || len(batchErr.Failures) != 2 {
+		t.Errorf("GetLatestKfdefs with a canceled context: got %v; want both to fail", err)
+	}
+}
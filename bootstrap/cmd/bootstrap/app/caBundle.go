@@ -0,0 +1,61 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+)
+
+// trustedBundle is the CA bundle http.DefaultTransport trusts in addition to the system roots.
+var trustedBundle struct {
+	mu     sync.Mutex
+	bundle string
+}
+
+// trustCABundle makes http.DefaultTransport trust the CA bundle of d in addition to the system
+// roots so the requests of the server to GitHub and the GCP APIs work behind the TLS intercepting
+// proxy of the deployment. A server handles a single deployment so the bundle replaces the one of
+// the previous request; the idle connections are closed so new ones are verified with it.
+func trustCABundle(d *kfdefs.KfDef) error {
+	trustedBundle.mu.Lock()
+	defer trustedBundle.mu.Unlock()
+	if d.Spec.CABundle == trustedBundle.bundle {
+		return nil
+	}
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return errors.Errorf("can't trust the CA bundle; the default transport is a %T", http.DefaultTransport)
+	}
+
+	config := &tls.Config{}
+	if t.TLSClientConfig != nil {
+		config = t.TLSClientConfig.Clone()
+	}
+	if d.Spec.CABundle == "" {
+		// The system roots are used if RootCAs is nil.
+		config.RootCAs = nil
+	} else {
+		certs, err := d.CABundleCertificates()
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			log.Warnf("Could not load the system roots; only the CA bundle is trusted; %v", err)
+			pool = x509.NewCertPool()
+		}
+		for _, c := range certs {
+			pool.AddCert(c)
+		}
+		config.RootCAs = pool
+	}
+	t.TLSClientConfig = config
+	t.CloseIdleConnections()
+	trustedBundle.bundle = d.Spec.CABundle
+	log.Infof("Outbound requests trust the system roots and the CA bundle of deployment %v if it has one", d.Name)
+	return nil
+}
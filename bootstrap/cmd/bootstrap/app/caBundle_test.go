@@ -0,0 +1,39 @@
+package app
+
+import (
+	"encoding/pem"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	d := &kfdefsv3.KfDef{}
+	d.Name = "kf-app"
+	defer trustCABundle(&kfdefsv3.KfDef{})
+
+	if _, err := http.Get(server.URL); err == nil {
+		t.Fatalf("The certificate of the test server is trusted before the bundle")
+	}
+
+	d.Spec.CABundle = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	if err := trustCABundle(d); err != nil {
+		t.Fatalf("trustCABundle: %v", err)
+	}
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request with the CA bundle failed; %v", err)
+	}
+	resp.Body.Close()
+
+	if err := trustCABundle(&kfdefsv3.KfDef{}); err != nil {
+		t.Fatalf("trustCABundle: %v", err)
+	}
+	if _, err := http.Get(server.URL); err == nil {
+		t.Errorf("The certificate of the test server is still trusted once the bundle is removed")
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// KfctlCancelPath is the path on which to serve requests to cancel the deployment
+const KfctlCancelPath = "/kfctl/apps/v1alpha2/cancel"
+
+// errCanceled is returned by handleDeployment when it stopped because the deployment was canceled.
+var errCanceled = errors.New("deployment canceled")
+
+// takeCanceled returns true if the in-flight deployment should stop and resets the request to cancel it.
+func (s *kfctlServer) takeCanceled() bool {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	canceled := s.canceled
+	s.canceled = false
+	return canceled
+}
+
+// Cancel stops the in-flight deployment at the next phase boundary and drops the queued requests.
+// Resources created by the phases that already ran aren't removed.
+func (s *kfctlServer) Cancel(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if err := s.checkDeploymentRequest(req); err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+
+	dropped := 0
+	for done := false; !done; {
+		select {
+		case r := <-s.c:
+			log.Infof("Canceling queued request for %v", r.Name)
+			dropped++
+		default:
+			done = true
+		}
+	}
+
+	if !s.busy && dropped == 0 {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v isn't being applied; there is nothing to cancel", req.Name),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	if s.busy {
+		log.Infof("Canceling deployment %v; it will stop at the next phase boundary", req.Name)
+		s.canceled = true
+		// A deployment held because it is paused stops now rather than when it is resumed.
+		s.wakePaused()
+	}
+	return s.latestKfDef.DeepCopy(), nil
+}
+
+// Cancel forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) Cancel(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Cancel(ctx, req)
+}
+
+// Cancel stops the in-flight deployment at the next phase boundary and drops the queued requests.
+func (c *KfctlClient) Cancel(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	return c.callKfDefEndpoint(ctx, "Cancel", c.cancelEndpoint, req)
+}
+
+// makeCancelEndpoint creates an endpoint to handle requests to cancel the deployment.
+func makeCancelEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.Cancel(ctx, req)
+	}
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKfctlServer_Cancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cancel")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	_, err = s.Cancel(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("Cancel of an idle deployment: want 409; got %v", err)
+	}
+
+	// Hold the deployment at a phase boundary so it can be canceled while it is in flight.
+	if _, err := s.Pause(context.Background(), req); err != nil {
+		t.Fatalf("Pause failed; %v", err)
+	}
+	s.setBusy(true)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.atPhaseBoundary(req, PhaseApplyK8s)
+	}()
+
+	if _, err := s.Cancel(context.Background(), req); err != nil {
+		t.Fatalf("Cancel failed; %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != errCanceled {
+			t.Errorf("atPhaseBoundary after cancel: want errCanceled; got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Cancel didn't stop the paused deployment")
+	}
+
+	s.kfDefMux.Lock()
+	paused := s.paused
+	s.kfDefMux.Unlock()
+	if !paused {
+		t.Errorf("Deployment should stay paused after the in-flight deployment was canceled")
+	}
+
+	// The request to cancel only stops the deployment that was in flight.
+	if _, err := s.Resume(context.Background(), req); err != nil {
+		t.Fatalf("Resume failed; %v", err)
+	}
+	if err := s.atPhaseBoundary(req, PhaseApplyK8s); err != nil {
+		t.Errorf("atPhaseBoundary of the next deployment: want nil; got %v", err)
+	}
+}
+
+func TestRunHistory_Canceled(t *testing.T) {
+	h := newRunHistory("", 10)
+	h.begin("kf-app")
+	h.finish(PhaseApplyPlatform, errCanceled)
+	h.begin("kf-app")
+	h.finish(PhaseApplyK8s, nil)
+
+	runs := h.list(time.Time{})
+	if len(runs) != 2 || runs[0].Status != RunCanceled || runs[0].Phase != PhaseApplyPlatform {
+		t.Fatalf("Got runs %v; want a canceled run followed by a successful run", PrettyPrint(runs))
+	}
+
+	stats := computeStats("acme", time.Time{}, runs)
+	if stats.SuccessRate != 1 {
+		t.Errorf("Got success rate %v; canceled runs shouldn't count", stats.SuccessRate)
+	}
+}
+
+func TestKfctlServer_ListAndDelete(t *testing.T) {
+	s := &kfctlServer{
+		c:             make(chan kfdefsv3.KfDef, 1),
+		latestKfDef:   newPlanTestKfDef(),
+		targetCluster: &rest.Config{},
+	}
+	req := newPlanTestKfDef()
+
+	list, err := s.ListDeployments(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ListDeployments failed; %v", err)
+	}
+	if len(list.Deployments) != 1 || list.Deployments[0].Name != req.Name {
+		t.Errorf("Got deployments %v; want %v", PrettyPrint(list.Deployments), req.Name)
+	}
+
+	other := newPlanTestKfDef()
+	other.Spec.Project = "other"
+	list, err = s.ListDeployments(context.Background(), other)
+	if err != nil {
+		t.Fatalf("ListDeployments failed; %v", err)
+	}
+	if len(list.Deployments) != 0 {
+		t.Errorf("Got deployments %v for another project; want none", PrettyPrint(list.Deployments))
+	}
+
+	s.setBusy(true)
+	_, err = s.DeleteDeployment(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("DeleteDeployment while busy: want 409; got %v", err)
+	}
+	s.setBusy(false)
+
+	plan, err := s.PrepareDelete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("PrepareDelete failed; %v", err)
+	}
+	req.Annotations = map[string]string{DeleteConfirmationAnnotation: plan.Token}
+	if _, err := s.DeleteDeployment(context.Background(), req); err != nil {
+		t.Fatalf("DeleteDeployment failed; %v", err)
+	}
+	queued := <-s.c
+	if _, ok := queued.Annotations[DeleteConfirmationAnnotation]; ok {
+		t.Errorf("Queued request holds the confirmation token")
+	}
+	if !takeDelete(&queued) {
+		t.Errorf("Queued request doesn't delete the deployment")
+	}
+	if takeDelete(&queued) {
+		t.Errorf("takeDelete didn't remove the annotation")
+	}
+}
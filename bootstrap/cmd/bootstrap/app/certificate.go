@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// certificatePollInterval is how often the server checks the managed certificate of the
+// deployment and WaitForEndpoint checks the status reported by the server.
+var certificatePollInterval = time.Minute
+
+// certificateWatchTimeout is how long the server keeps checking a managed certificate which
+// isn't Active after the deployment was applied.
+const certificateWatchTimeout = 3 * time.Hour
+
+// startCertificateWatch reports the provisioning of the managed certificate of the deployment d
+// in its status until the certificate is Active, failed or the watch times out.
+func (s *kfctlServer) startCertificateWatch(d kfdefs.KfDef) {
+	if s.simulate || !gcp.UsesManagedCertificate(&d) {
+		return
+	}
+	stop := make(chan struct{})
+	s.kfDefMux.Lock()
+	s.certStop = stop
+	s.kfDefMux.Unlock()
+	go s.watchCertificate(d, stop)
+}
+
+// stopCertificateWatch stops reporting the provisioning of the managed certificate; the next run
+// of the deployment starts a new watch.
+func (s *kfctlServer) stopCertificateWatch() {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	if s.certStop != nil {
+		close(s.certStop)
+		s.certStop = nil
+	}
+}
+
+func (s *kfctlServer) watchCertificate(d kfdefs.KfDef, stop chan struct{}) {
+	timeout := time.After(certificateWatchTimeout)
+	for {
+		done, err := s.pollCertificate(d, stop)
+		if err != nil {
+			log.Warnf("Could not check the managed certificate of %v; %v", d.Name, err)
+		} else if done {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-timeout:
+			log.Warnf("Managed certificate of %v isn't Active after %v; no longer reporting it", d.Name, certificateWatchTimeout)
+			return
+		case <-time.After(certificatePollInterval):
+		}
+	}
+}
+
+// pollCertificate records the state of the managed certificate of d in the status and returns true
+// once it won't change anymore. It holds opMux so the credentials of the deployment aren't
+// changed by a run while they are used.
+func (s *kfctlServer) pollCertificate(d kfdefs.KfDef, stop chan struct{}) (bool, error) {
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+	select {
+	case <-stop:
+		// A new run started while we waited; its status mustn't be overwritten.
+		return true, nil
+	default:
+	}
+
+	config, err := s.k8sRestConfig(context.Background(), d)
+	if err != nil {
+		return false, err
+	}
+	cert, err := gcp.GetManagedCertificate(config, &d)
+	if err != nil {
+		return false, err
+	}
+	condition := cert.Condition(time.Now())
+	s.recordCertificate(cert.CertificateStatus(), condition)
+	return condition.Type != kfdefs.KfDeploying, nil
+}
+
+// recordCertificate sets the state of the managed certificate in the latest KfDef.
+func (s *kfctlServer) recordCertificate(status *kfdefs.CertificateStatus, condition kfdefs.KfDefCondition) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	gcp.SetCertificateStatus(&s.latestKfDef, status, condition)
+	s.publishStatus()
+}
+
+// WaitForEndpoint waits until the endpoint of the deployment is served over HTTPS. Managed
+// certificates can take an hour to be issued so the expected time reported by the server is sent
+// to the ProgressFunc as ProgressCertificate events while waiting. It returns immediately if the
+// deployment doesn't use a managed certificate and an error if provisioning failed.
+func (c *KfctlClient) WaitForEndpoint(ctx context.Context, req kfdefs.KfDef) error {
+	for {
+		d, err := c.GetLatestKfdef(req)
+		if err != nil {
+			return err
+		}
+		if !gcp.UsesManagedCertificate(d) {
+			return nil
+		}
+		if condition, ok := gcp.CertificateCondition(d); ok {
+			switch condition.Type {
+			case kfdefs.KfSucceeded:
+				return nil
+			case kfdefs.KfFailed:
+				return errors.New(condition.Message)
+			}
+			if c.progress != nil {
+				e := ProgressEvent{
+					Type:    ProgressCertificate,
+					Method:  "WaitForEndpoint",
+					Time:    time.Now(),
+					Message: condition.Message,
+				}
+				if d.Status.Certificate != nil {
+					if eta := time.Until(d.Status.Certificate.ExpectedReadyTime.Time); eta > 0 {
+						e.ETA = eta
+					}
+				}
+				c.progress(e)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("endpoint of %v isn't served over HTTPS yet; %v", req.Name, ctx.Err())
+		case <-time.After(certificatePollInterval):
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// certificateKfctlService reports the given certificate states one GetLatestKfdef call after another.
+type certificateKfctlService struct {
+	fakeKfctlService
+	states []string
+}
+
+func (f *certificateKfctlService) GetLatestKfdef(req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state := f.states[f.calls]
+	if f.calls < len(f.states)-1 {
+		f.calls++
+	}
+	cert := &gcp.ManagedCertificate{}
+	cert.Name = gcp.MANAGED_CERT_NAME
+	cert.CreationTimestamp = metav1.Now()
+	cert.Status.CertificateStatus = state
+	gcp.SetCertificateStatus(&req, cert.CertificateStatus(), cert.Condition(time.Now()))
+	return &req, nil
+}
+
+func newCertificateTestKfDef() kfdefsv3.KfDef {
+	d := newPlanTestKfDef()
+	d.Spec.Applications[1].KustomizeConfig = &kfdefsv3.KustomizeConfig{Overlays: []string{gcp.MANAGED_CERT_OVERLAY}}
+	return d
+}
+
+func TestKfctlServer_recordCertificate(t *testing.T) {
+	s := &kfctlServer{latestKfDef: newCertificateTestKfDef()}
+	cert := &gcp.ManagedCertificate{}
+	cert.Name = gcp.MANAGED_CERT_NAME
+	cert.Status.CertificateStatus = gcp.ManagedCertificateActive
+
+	s.recordCertificate(cert.CertificateStatus(), cert.Condition(time.Now()))
+	if s.latestKfDef.Status.Certificate == nil || s.latestKfDef.Status.Certificate.State != gcp.ManagedCertificateActive {
+		t.Errorf("Certificate status: got %+v", s.latestKfDef.Status.Certificate)
+	}
+	if c, ok := gcp.CertificateCondition(&s.latestKfDef); !ok || c.Type != kfdefsv3.KfSucceeded {
+		t.Errorf("Certificate condition: got %+v", c)
+	}
+}
+
+func TestKfctlClient_WaitForEndpoint(t *testing.T) {
+	interval := certificatePollInterval
+	certificatePollInterval = time.Millisecond
+	defer func() { certificatePollInterval = interval }()
+
+	servers := []*httptest.Server{}
+	defer func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	}()
+	newClient := func(svc KfctlService, progress ProgressFunc) *KfctlClient {
+		handler := httptransport.NewServer(
+			makeServerStatusRequestEndpoint(svc),
+			func(_ context.Context, r *http.Request) (interface{}, error) {
+				var request kfdefsv3.KfDef
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					return nil, err
+				}
+				return request, nil
+			},
+			encodeResponse,
+		)
+		mux := http.NewServeMux()
+		mux.Handle(KfctlGetpath, handler)
+		server := httptest.NewServer(mux)
+		servers = append(servers, server)
+
+		c, err := NewKfctlClient(server.URL, WithProgressFunc(progress))
+		if err != nil {
+			t.Fatalf("Could not create client; %v", err)
+		}
+		return c.(*KfctlClient)
+	}
+
+	mu := sync.Mutex{}
+	events := []ProgressEvent{}
+	progress := func(e ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+
+	svc := &certificateKfctlService{states: []string{"", gcp.ManagedCertificateProvisioning, gcp.ManagedCertificateActive}}
+	if err := newClient(svc, progress).WaitForEndpoint(context.Background(), newCertificateTestKfDef()); err != nil {
+		t.Fatalf("WaitForEndpoint: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Got %v events; want 2:\n%v", len(events), PrettyPrint(events))
+	}
+	for _, e := range events {
+		if e.Type != ProgressCertificate || e.ETA <= 0 || !strings.Contains(e.Message, "expected by") {
+			t.Errorf("Want certificate event with an ETA; got %+v", e)
+		}
+	}
+
+	svc = &certificateKfctlService{states: []string{gcp.ManagedCertificateFailedPermanently}}
+	if err := newClient(svc, progress).WaitForEndpoint(context.Background(), newCertificateTestKfDef()); err == nil {
+		t.Errorf("WaitForEndpoint with a failed certificate: got nil; want error")
+	}
+
+	svc = &certificateKfctlService{states: []string{gcp.ManagedCertificateProvisioning}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := newClient(svc, progress).WaitForEndpoint(ctx, newCertificateTestKfDef()); err == nil {
+		t.Errorf("WaitForEndpoint past the deadline: got nil; want error")
+	}
+
+	// Deployments without a managed certificate don't wait.
+	svc = &certificateKfctlService{states: []string{gcp.ManagedCertificateProvisioning}}
+	if err := newClient(svc, progress).WaitForEndpoint(context.Background(), newPlanTestKfDef()); err != nil {
+		t.Errorf("WaitForEndpoint without a managed certificate: %v", err)
+	}
+}
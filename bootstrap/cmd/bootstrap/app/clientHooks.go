@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"net/http"
+	"time"
+)
+
+// ClientHooks are called by the KfctlClient around its requests so consumers can record metrics
+// or logs in their own backends e.g. statsd. Unset hooks are skipped. The hooks are called
+// synchronously, possibly from several goroutines at once, so they should return quickly.
+type ClientHooks struct {
+	// OnRequest is called before each attempt of a request is sent.
+	OnRequest func(RequestInfo)
+	// OnRetry is called when a failed request will be retried.
+	OnRetry func(RetryInfo)
+	// OnResponse is called when an attempt of a request completes or fails.
+	OnResponse func(ResponseInfo)
+}
+
+// RequestInfo describes an attempt of a request.
+type RequestInfo struct {
+	// Method is the client method sending the request e.g. CreateDeployment.
+	Method string
+	Time   time.Time
+}
+
+// RetryInfo describes a retry of a request.
+type RetryInfo struct {
+	Method string
+	// Attempt is the number of the attempt which failed.
+	Attempt int
+	// Err is the error which caused the retry.
+	Err error
+	// NextRetry is how long the client waits before retrying.
+	NextRetry time.Duration
+}
+
+// ResponseInfo describes the outcome of an attempt of a request.
+type ResponseInfo struct {
+	Method string
+	// URL is the URL the request was sent to; empty if it wasn't sent e.g. because the client
+	// was rate limited.
+	URL string
+	// StatusCode is the HTTP status of the response; 0 if no response was received.
+	StatusCode int
+	// Duration is the time from sending the request to decoding the response.
+	Duration time.Duration
+	// Err is the error returned for the attempt if any.
+	Err error
+}
+
+// WithClientHooks registers hooks called around the requests of the client.
+func WithClientHooks(h ClientHooks) KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.hooks = &h
+	}
+}
+
+// hookCallKey is the context key of the hookCall of an attempt.
+type hookCallKey struct{}
+
+// hookCall collects what the transport learns about an attempt for OnResponse.
+type hookCall struct {
+	url        string
+	statusCode int
+}
+
+// recordHookRequest is a transport/http.RequestFunc recording the URL of the attempt.
+func recordHookRequest(ctx context.Context, r *http.Request) context.Context {
+	if c, ok := ctx.Value(hookCallKey{}).(*hookCall); ok {
+		c.url = r.URL.String()
+	}
+	return ctx
+}
+
+// recordHookResponse is a transport/http.ClientResponseFunc recording the status of the attempt.
+func recordHookResponse(ctx context.Context, r *http.Response) context.Context {
+	if c, ok := ctx.Value(hookCallKey{}).(*hookCall); ok {
+		c.statusCode = r.StatusCode
+	}
+	return ctx
+}
+
+// hooksMiddleware returns a middleware calling the OnRequest and OnResponse hooks around each
+// call of an endpoint of method.
+func hooksMiddleware(method string, h *ClientHooks) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			start := time.Now()
+			if h.OnRequest != nil {
+				h.OnRequest(RequestInfo{Method: method, Time: start})
+			}
+			c := &hookCall{}
+			resp, err := next(context.WithValue(ctx, hookCallKey{}, c), request)
+			if h.OnResponse != nil {
+				h.OnResponse(ResponseInfo{
+					Method:     method,
+					URL:        c.url,
+					StatusCode: c.statusCode,
+					Duration:   time.Since(start),
+					Err:        err,
+				})
+			}
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"github.com/cenkalti/backoff"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestKfctlClient_Hooks(t *testing.T) {
+	svc := &fakeKfctlService{}
+	server := newFakeKfctlServer(svc)
+	defer server.Close()
+
+	faults := &FaultInjector{
+		Script: []FaultType{FaultServerError, FaultDrop},
+	}
+
+	mu := sync.Mutex{}
+	requests := []RequestInfo{}
+	retries := []RetryInfo{}
+	responses := []ResponseInfo{}
+
+	c, err := NewKfctlClient(server.URL,
+		WithHTTPClient(&http.Client{Transport: faults.Transport(nil)}),
+		WithRetryBackOff(func() backoff.BackOff {
+			return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+		}),
+		WithClientHooks(ClientHooks{
+			OnRequest: func(r RequestInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				requests = append(requests, r)
+			},
+			OnRetry: func(r RetryInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				retries = append(retries, r)
+			},
+			OnResponse: func(r ResponseInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				responses = append(responses, r)
+			},
+		}))
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+
+	if _, err := c.CreateDeployment(context.Background(), kfdefsv3.KfDef{}); err != nil {
+		t.Fatalf("CreateDeployment error; %v", err)
+	}
+
+	if len(requests) != 3 || len(retries) != 2 || len(responses) != 3 {
+		t.Fatalf("Got %v requests, %v retries and %v responses; want 3, 2 and 3", len(requests), len(retries), len(responses))
+	}
+	for i, r := range retries {
+		if r.Method != "CreateDeployment" || r.Attempt != i+1 || r.Err == nil {
+			t.Errorf("Retry %v: want a retry of attempt %v; got %+v", i, i+1, r)
+		}
+	}
+
+	// The server error, the dropped request and the success.
+	expected := []int{http.StatusServiceUnavailable, 0, http.StatusOK}
+	for i, r := range responses {
+		if r.Method != "CreateDeployment" || r.StatusCode != expected[i] || (r.Err == nil) != (i == 2) {
+			t.Errorf("Response %v: want status %v; got %+v", i, expected[i], r)
+		}
+		if !strings.HasPrefix(r.URL, server.URL+KfctlCreatePath) {
+			t.Errorf("Response %v: got URL %v; want %v", i, r.URL, server.URL+KfctlCreatePath)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+)
+
+// KfctlClonePath is the path on which to serve clone requests
+const KfctlClonePath = "/kfctl/apps/v1alpha2/clone"
+
+// CloneRequest is a request to create a new deployment from the KfDef of an existing one.
+type CloneRequest struct {
+	// Source identifies the deployment to clone. Its name and project are required and its
+	// secrets must include an access token for the source project.
+	Source kfdefs.KfDef `json:"source"`
+
+	// Name of the new deployment; required.
+	Name string `json:"name"`
+	// Project and Zone of the new deployment; default to those of the source.
+	Project string `json:"project,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	// Hostname of the new deployment. Required if the source uses a custom domain;
+	// otherwise a Cloud Endpoints hostname is generated.
+	Hostname string `json:"hostname,omitempty"`
+
+	// Secrets override the secrets of the source with the same name e.g. the access token
+	// for the new project.
+	Secrets []kfdefs.Secret `json:"secrets,omitempty"`
+}
+
+// cloneKfDef returns the KfDef for a new deployment created from source with req's overrides applied.
+//
+// Fields that identify resources of the source deployment are cleared so they are
+// generated for the new deployment.
+func cloneKfDef(source *kfdefs.KfDef, req CloneRequest) (*kfdefs.KfDef, error) {
+	if req.Name == "" {
+		return nil, &httpError{
+			Message: "name is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if req.Name == source.Name && (req.Project == "" || req.Project == source.Spec.Project) {
+		return nil, &httpError{
+			Message: fmt.Sprintf("The clone must have a different name or project than %v", source.Name),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if gcp.IsCustomDomain(source) && req.Hostname == "" {
+		return nil, &httpError{
+			Message: fmt.Sprintf("%v uses the custom domain %v; hostname is required", source.Name, source.Spec.Hostname),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	// Build the metadata from the deep copy so the clone doesn't share maps with the source.
+	d := source.DeepCopy()
+	d.ObjectMeta = metav1.ObjectMeta{
+		Name:        req.Name,
+		Namespace:   source.Namespace,
+		Labels:      d.Labels,
+		Annotations: d.Annotations,
+	}
+	if d.Annotations == nil {
+		d.Annotations = map[string]string{}
+	}
+	delete(d.Annotations, gcp.DeployerServiceAccountAnnotation)
+	d.Status = kfdefs.KfDefStatus{}
+
+	if req.Project != "" {
+		d.Spec.Project = req.Project
+	}
+	if req.Zone != "" {
+		d.Spec.Zone = req.Zone
+	}
+
+	d.Spec.AppDir = ""
+	d.Spec.Hostname = req.Hostname
+	if source.Spec.IpName == source.Name+"-ip" {
+		d.Spec.IpName = ""
+	}
+
+	for _, o := range req.Secrets {
+		replaced := false
+		for i, s := range d.Spec.Secrets {
+			if s.Name == o.Name {
+				d.Spec.Secrets[i] = o
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			d.Spec.Secrets = append(d.Spec.Secrets, o)
+		}
+	}
+
+	if err := newValidationError("The cloned KfDef is invalid", d.Validate()); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// makeCloneEndpoint creates an endpoint to handle clone requests.
+func makeCloneEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(CloneRequest)
+		return svc.Clone(ctx, req)
+	}
+}
+
+// decodeHTTPCloneRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded CloneRequest from the HTTP request body.
+func decodeHTTPCloneRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request CloneRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding clone request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"net/http"
+	"testing"
+)
+
+func newCloneSource() kfdefsv3.KfDef {
+	d := newPlanTestKfDef()
+	d.Spec.AppDir = "/apps/kf-app"
+	d.Spec.IpName = "kf-app-ip"
+	d.Spec.Hostname = "kf-app.endpoints.acme.cloud.goog"
+	d.Annotations = map[string]string{
+		gcp.DeployerServiceAccountAnnotation: "kf-app-deployer@acme.iam.gserviceaccount.com",
+		"team":                               "ml",
+	}
+	d.Labels = map[string]string{"env": "prod"}
+	d.Status.Conditions = []kfdefsv3.KfDefCondition{
+		{
+			Type: kfdefsv3.KfSucceeded,
+		},
+	}
+	return d
+}
+
+func TestCloneKfDef(t *testing.T) {
+	source := newCloneSource()
+	d, err := cloneKfDef(&source, CloneRequest{
+		Name:    "team-a",
+		Project: "acme-team-a",
+		Secrets: []kfdefsv3.Secret{
+			{
+				Name: gcp.GcpAccessTokenName,
+				SecretSource: &kfdefsv3.SecretSource{
+					LiteralSource: &kfdefsv3.LiteralSource{
+						Value: "token2",
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("cloneKfDef error; %v", err)
+	}
+
+	if d.Name != "team-a" || d.Spec.Project != "acme-team-a" || d.Spec.Zone != source.Spec.Zone {
+		t.Errorf("Got name %v project %v zone %v; want team-a acme-team-a %v", d.Name, d.Spec.Project, d.Spec.Zone, source.Spec.Zone)
+	}
+
+	if d.Spec.AppDir != "" || d.Spec.IpName != "" || d.Spec.Hostname != "" {
+		t.Errorf("Source resources weren't cleared; appDir %v ipName %v hostname %v", d.Spec.AppDir, d.Spec.IpName, d.Spec.Hostname)
+	}
+
+	if _, ok := d.Annotations[gcp.DeployerServiceAccountAnnotation]; ok {
+		t.Errorf("Deployer service account of the source was copied")
+	}
+	if d.Annotations["team"] != "ml" {
+		t.Errorf("Got annotations %v; want team=ml", d.Annotations)
+	}
+
+	d.Labels["env"] = "dev"
+	d.Annotations["team"] = "ops"
+	if source.Labels["env"] != "prod" || source.Annotations["team"] != "ml" {
+		t.Errorf("The clone shares metadata with the source; labels %v annotations %v", source.Labels, source.Annotations)
+	}
+
+	if len(d.Status.Conditions) != 0 {
+		t.Errorf("Status of the source was copied")
+	}
+
+	if token, _ := d.GetSecret(gcp.GcpAccessTokenName); token != "token2" {
+		t.Errorf("Got token %v; want token2", token)
+	}
+
+	if len(d.Spec.Applications) != len(source.Spec.Applications) {
+		t.Errorf("Got %v applications; want %v", len(d.Spec.Applications), len(source.Spec.Applications))
+	}
+
+	// The source shouldn't be modified.
+	if token, _ := source.GetSecret(gcp.GcpAccessTokenName); token != "token1" {
+		t.Errorf("Source token was modified; got %v", token)
+	}
+}
+
+func TestCloneKfDefErrors(t *testing.T) {
+	type testCase struct {
+		name string
+		req  CloneRequest
+		// field is the field reported by the ValidationError if the clone is invalid.
+		field string
+	}
+
+	source := newCloneSource()
+	custom := newCloneSource()
+	custom.Spec.Hostname = "kubeflow.acme.com"
+
+	cases := []testCase{
+		{
+			name: "no-name",
+			req:  CloneRequest{},
+		},
+		{
+			name: "same-deployment",
+			req: CloneRequest{
+				Name: source.Name,
+			},
+		},
+		{
+			name: "invalid-name",
+			req: CloneRequest{
+				Name: "Team_A",
+			},
+			field: "metadata.name",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := cloneKfDef(&source, c.req)
+		if c.field != "" {
+			if vErr, ok := err.(*ValidationError); !ok || len(vErr.Fields) == 0 || vErr.Fields[0].Field != c.field {
+				t.Errorf("Case %v: got error %v; want a validation error of %v", c.name, err, c.field)
+			}
+			continue
+		}
+		hErr, ok := err.(*httpError)
+		if !ok || hErr.Code != http.StatusBadRequest {
+			t.Errorf("Case %v: got error %v; want a bad request", c.name, err)
+		}
+	}
+
+	if _, err := cloneKfDef(&custom, CloneRequest{Name: "team-a"}); err == nil {
+		t.Errorf("Cloning a custom domain without a hostname; want error; got nil")
+	}
+
+	d, err := cloneKfDef(&custom, CloneRequest{Name: "team-a", Hostname: "team-a.acme.com"})
+	if err != nil {
+		t.Fatalf("cloneKfDef error; %v", err)
+	}
+	if d.Spec.Hostname != "team-a.acme.com" {
+		t.Errorf("Got hostname %v; want team-a.acme.com", d.Spec.Hostname)
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"net/http"
+)
+
+// KfctlConnectionInfoPath is the path on which to serve connection info requests
+const KfctlConnectionInfoPath = "/kfctl/apps/v1alpha2/connection"
+
+// ConnectionInfo describes how to connect to a deployment.
+type ConnectionInfo struct {
+	Name string `json:"name"`
+	// Endpoint is the URL of the Kubeflow central dashboard.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Server is the address of the K8s API server of the cluster.
+	Server string `json:"server"`
+	// Namespace is the namespace Kubeflow is deployed in.
+	Namespace string `json:"namespace"`
+	// Kubeconfig is a kubeconfig for the cluster. It doesn't contain any credentials;
+	// kubectl obtains the caller's credentials from gcloud so access is limited to the caller's IAM roles.
+	Kubeconfig string `json:"kubeconfig"`
+}
+
+// lookupClusterConfig returns the config of the cluster of a deployment.
+// Support injection for testing.
+var lookupClusterConfig = BuildClusterConfig
+
+// buildKubeconfig returns a kubeconfig for the cluster which uses gcloud to get credentials.
+func buildKubeconfig(d *kfdefs.KfDef, config *rest.Config) ([]byte, error) {
+	name := fmt.Sprintf("gke_%v_%v_%v", d.Spec.Project, gcp.ClusterLocation(d), d.Name)
+	namespace := d.Namespace
+	kubeconfig := &clientcmdapi.Config{
+		Kind:       "Config",
+		APIVersion: "v1",
+		Clusters: map[string]*clientcmdapi.Cluster{
+			name: {
+				CertificateAuthorityData: config.TLSClientConfig.CAData,
+				Server:                   config.Host,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			name: {
+				Cluster:   name,
+				AuthInfo:  name,
+				Namespace: namespace,
+			},
+		},
+		CurrentContext: name,
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			name: {
+				AuthProvider: &clientcmdapi.AuthProviderConfig{
+					Name: "gcp",
+					Config: map[string]string{
+						"cmd-path":   "gcloud",
+						"cmd-args":   "config config-helper --format=json",
+						"token-key":  "{.credential.access_token}",
+						"expiry-key": "{.credential.token_expiry}",
+					},
+				},
+			},
+		},
+	}
+	return clientcmd.Write(*kubeconfig)
+}
+
+// getConnectionInfo returns the ConnectionInfo for the deployment d.
+// token is used to look up the cluster; it isn't included in the result.
+func getConnectionInfo(ctx context.Context, d *kfdefs.KfDef, token string) (*ConnectionInfo, error) {
+	config, err := lookupClusterConfig(ctx, token, d.Spec.Project, gcp.ClusterLocation(d), d.Name)
+	if err != nil {
+		log.Errorf("Could not get cluster %v; error %v", d.Name, err)
+		return nil, &httpError{
+			Message: fmt.Sprintf("Could not get cluster %v in project %v; it may not have been created yet", d.Name, d.Spec.Project),
+			Code:    http.StatusNotFound,
+			cause:   err,
+		}
+	}
+
+	kubeconfig, err := buildKubeconfig(d, config)
+	if err != nil {
+		return nil, &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+
+	info := &ConnectionInfo{
+		Name:       d.Name,
+		Server:     config.Host,
+		Namespace:  d.Namespace,
+		Kubeconfig: string(kubeconfig),
+	}
+	if d.Spec.Hostname != "" {
+		info.Endpoint = "https://" + d.Spec.Hostname
+	}
+	return info, nil
+}
+
+// connectionToken returns the access token in req used to look up the cluster.
+func connectionToken(req kfdefs.KfDef) (string, error) {
+	token, err := req.GetSecret(gcp.GcpAccessTokenName)
+	if err != nil {
+		return "", &httpError{
+			Message: fmt.Sprintf("Could not obtain an access token from secret %v", gcp.GcpAccessTokenName),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return token, nil
+}
+
+// makeConnectionInfoEndpoint creates an endpoint to handle connection info requests.
+func makeConnectionInfoEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.GetConnectionInfo(ctx, req)
+	}
+}
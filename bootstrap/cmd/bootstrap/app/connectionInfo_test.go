@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetConnectionInfo(t *testing.T) {
+	defer func(f func(context.Context, string, string, string, string) (*rest.Config, error)) {
+		lookupClusterConfig = f
+	}(lookupClusterConfig)
+
+	var gotToken string
+	lookupClusterConfig = func(ctx context.Context, token string, project string, zone string, clusterID string) (*rest.Config, error) {
+		gotToken = token
+		if clusterID != "kf-app" {
+			return nil, fmt.Errorf("cluster %v not found", clusterID)
+		}
+		return &rest.Config{
+			Host:        "https://10.0.0.1",
+			BearerToken: token,
+			TLSClientConfig: rest.TLSClientConfig{
+				CAData: []byte("ca"),
+			},
+		}, nil
+	}
+
+	d := newPlanTestKfDef()
+	d.Namespace = "kubeflow"
+	d.Spec.Hostname = "kf-app.endpoints.acme.cloud.goog"
+
+	info, err := getConnectionInfo(context.Background(), &d, "token1")
+	if err != nil {
+		t.Fatalf("getConnectionInfo error; %v", err)
+	}
+
+	if gotToken != "token1" {
+		t.Errorf("Cluster was looked up with token %v; want token1", gotToken)
+	}
+
+	if info.Endpoint != "https://kf-app.endpoints.acme.cloud.goog" || info.Server != "https://10.0.0.1" || info.Namespace != "kubeflow" {
+		t.Errorf("Got %v", PrettyPrint(info))
+	}
+
+	// The kubeconfig must not leak the caller's token.
+	if strings.Contains(info.Kubeconfig, "token1") {
+		t.Errorf("Kubeconfig contains the access token:\n%v", info.Kubeconfig)
+	}
+
+	config, err := clientcmd.Load([]byte(info.Kubeconfig))
+	if err != nil {
+		t.Fatalf("Could not load kubeconfig; %v", err)
+	}
+
+	current := config.Contexts[config.CurrentContext]
+	if current == nil || current.Namespace != "kubeflow" {
+		t.Fatalf("Got context %v; want namespace kubeflow", current)
+	}
+	if cluster := config.Clusters[current.Cluster]; cluster == nil || cluster.Server != "https://10.0.0.1" {
+		t.Errorf("Got cluster %v; want server https://10.0.0.1", cluster)
+	}
+	if auth := config.AuthInfos[current.AuthInfo]; auth == nil || auth.AuthProvider == nil || auth.AuthProvider.Name != "gcp" {
+		t.Errorf("Got auth info %v; want the gcp auth provider", auth)
+	}
+
+	d.Name = "missing"
+	_, err = getConnectionInfo(context.Background(), &d, "token1")
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("Got error %v; want not found", err)
+	}
+}
+
+func TestKfctlServer_GetConnectionInfoNotFound(t *testing.T) {
+	s := &kfctlServer{
+		latestKfDef: newPlanTestKfDef(),
+	}
+
+	req := newPlanTestKfDef()
+	req.Name = "other"
+	_, err := s.GetConnectionInfo(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("Got error %v; want not found", err)
+	}
+
+	_, err = s.GetConnectionInfo(context.Background(), kfdefsv3.KfDef{})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("Got error %v; want bad request", err)
+	}
+}
@@ -0,0 +1,242 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ghodss/yaml"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ContentTypeYAML is the media type of YAML request and response bodies.
+// Requests with this Content-Type are decoded as YAML and responses are encoded as YAML
+// when it is preferred in the Accept header; otherwise JSON is used.
+const ContentTypeYAML = "application/yaml"
+
+// yamlMediaTypes are the media types accepted for YAML.
+var yamlMediaTypes = map[string]bool{
+	ContentTypeYAML:      true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+// ContentTypeProtobuf is the media type of protobuf request and response bodies.
+// Only KfDef payloads can be encoded as protobuf; see protobuf.go for the schema.
+// Other responses are encoded as JSON even if protobuf is preferred.
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// protobufMediaTypes are the media types accepted for protobuf.
+var protobufMediaTypes = map[string]bool{
+	ContentTypeProtobuf:    true,
+	"application/protobuf": true,
+}
+
+// protobufAccept is the Accept header sent by clients created with WithProtobuf.
+const protobufAccept = ContentTypeProtobuf + ", application/json"
+
+type acceptKey struct{}
+
+// withAccept stores the Accept header of the request in its context so encodeResponse can
+// negotiate the response encoding.
+func withAccept(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), acceptKey{}, r.Header.Get("Accept")))
+}
+
+// isYAML returns true if the Content-Type or media range is YAML.
+func isYAML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return yamlMediaTypes[mediaType]
+}
+
+// isProtobuf returns true if the Content-Type or media range is protobuf.
+func isProtobuf(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return protobufMediaTypes[mediaType]
+}
+
+// isNDJSON returns true if the Content-Type or media range is ND-JSON.
+func isNDJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == ContentTypeNDJSON
+}
+
+// preferredMediaType returns the first media range in accept that we can produce; either
+// ContentTypeYAML, ContentTypeProtobuf, ContentTypeNDJSON, ContentTypeTable or application/json
+// which is the default.
+// Quality values are ignored; clients list the type they want first.
+func preferredMediaType(accept string) string {
+	for _, r := range strings.Split(accept, ",") {
+		r = strings.TrimSpace(r)
+		if isTable(r) {
+			return ContentTypeTable
+		}
+		if isYAML(r) {
+			return ContentTypeYAML
+		}
+		if isProtobuf(r) {
+			return ContentTypeProtobuf
+		}
+		if isNDJSON(r) {
+			return ContentTypeNDJSON
+		}
+		mediaType, _, err := mime.ParseMediaType(r)
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" || mediaType == "application/*" || mediaType == "*/*" {
+			break
+		}
+	}
+	return "application/json"
+}
+
+// prefersYAML returns true if the first media range in accept that we can produce is YAML.
+func prefersYAML(accept string) bool {
+	return preferredMediaType(accept) == ContentTypeYAML
+}
+
+// decodeBody decodes the body of r into v as YAML or protobuf if its Content-Type says so and
+// as JSON otherwise. YAML is converted to JSON before decoding so the json tags of v apply to both.
+// A KfDef exceeding the request limits is rejected with a RequestLimitError.
+func decodeBody(r *http.Request, v interface{}) error {
+	if err := unmarshalBody(r, v); err != nil {
+		return err
+	}
+	return checkRequestLimits(r.Context(), v)
+}
+
+// unmarshalBody decodes the body of r into v in the encoding of its Content-Type.
+func unmarshalBody(r *http.Request, v interface{}) error {
+	contentType := r.Header.Get("Content-Type")
+	if isProtobuf(contentType) {
+		d, ok := v.(*kfdefs.KfDef)
+		if !ok {
+			return &httpError{
+				Message: "Only KfDef request bodies can be encoded as protobuf",
+				Code:    http.StatusUnsupportedMediaType,
+			}
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return unmarshalKfDefProto(b, d)
+	}
+	if !isYAML(contentType) {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, v)
+}
+
+// decodeResponseBody decodes the body of a successful response into v as protobuf if its
+// Content-Type is protobuf and v is a KfDef, and as JSON otherwise.
+func decodeResponseBody(r *http.Response, v interface{}) error {
+	if d, ok := v.(*kfdefs.KfDef); ok && isProtobuf(r.Header.Get("Content-Type")) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return unmarshalKfDefProto(b, d)
+	}
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// encodeBody writes response as YAML, protobuf, ND-JSON or a table if the client prefers it and
+// as JSON otherwise.
+func encodeBody(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	accept, _ := ctx.Value(acceptKey{}).(string)
+	switch preferredMediaType(accept) {
+	case ContentTypeYAML:
+		b, err := yaml.Marshal(response)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", ContentTypeYAML)
+		_, err = w.Write(b)
+		return err
+	case ContentTypeProtobuf:
+		d, ok := response.(*kfdefs.KfDef)
+		if !ok {
+			break
+		}
+		b, err := marshalKfDefProto(d)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", ContentTypeProtobuf)
+		_, err = w.Write(b)
+		return err
+	case ContentTypeNDJSON:
+		s, ok := response.(ndjsonStreamer)
+		if !ok {
+			break
+		}
+		return encodeNDJSON(ctx, w, s)
+	case ContentTypeTable:
+		t, ok := toTable(response, time.Now())
+		if !ok {
+			break
+		}
+		w.Header().Set("Content-Type", ContentTypeTable)
+		return json.NewEncoder(w).Encode(t)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// encodeHTTPYAMLRequest is a transport/http.EncodeRequestFunc that YAML-encodes any request
+// to the request body. Used by clients created with WithYAMLRequests.
+func encodeHTTPYAMLRequest(_ context.Context, r *http.Request, request interface{}) error {
+	b, err := yaml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", ContentTypeYAML)
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return nil
+}
+
+// encodeHTTPProtobufRequest is a transport/http.EncodeRequestFunc that encodes KfDef requests
+// as protobuf and any other request as JSON. Protobuf responses are requested for KfDefs.
+// Used by clients created with WithProtobuf.
+func encodeHTTPProtobufRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	r.Header.Set("Accept", protobufAccept)
+
+	var d *kfdefs.KfDef
+	switch v := request.(type) {
+	case kfdefs.KfDef:
+		d = &v
+	case *kfdefs.KfDef:
+		d = v
+	default:
+		r.Header.Set("Content-Type", "application/json")
+		return encodeHTTPGenericRequest(ctx, r, request)
+	}
+
+	b, err := marshalKfDefProto(d)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", ContentTypeProtobuf)
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return nil
+}
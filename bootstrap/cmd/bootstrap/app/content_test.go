@@ -0,0 +1,214 @@
+package app
+
+import (
+	"context"
+	"github.com/ghodss/yaml"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testKfDefYAML = `
+apiVersion: kfdef.apps.kubeflow.org/v1alpha1
+kind: KfDef
+metadata:
+  name: kf-app
+  namespace: kubeflow
+spec:
+  project: acme
+  zone: us-east1-d
+  useBasicAuth: false
+  applications:
+  - name: jupyter
+    kustomizeConfig:
+      parameters:
+      - name: clusterRbacConfig
+        value: "OFF"
+      repoRef:
+        name: manifests
+        path: jupyter/jupyter-web-app
+`
+
+func TestDecodeBody(t *testing.T) {
+	expected := kfdefs.KfDef{}
+	if err := yaml.Unmarshal([]byte(testKfDefYAML), &expected); err != nil {
+		t.Fatalf("Could not parse KfDef; %v", err)
+	}
+	asJSON, err := yaml.YAMLToJSON([]byte(testKfDefYAML))
+	if err != nil {
+		t.Fatalf("Could not convert KfDef to JSON; %v", err)
+	}
+
+	type testCase struct {
+		contentType string
+		body        string
+	}
+
+	cases := []testCase{
+		{
+			contentType: "application/yaml",
+			body:        testKfDefYAML,
+		},
+		{
+			contentType: "application/x-yaml; charset=utf-8",
+			body:        testKfDefYAML,
+		},
+		{
+			contentType: "application/json",
+			body:        string(asJSON),
+		},
+		{
+			contentType: "",
+			body:        string(asJSON),
+		},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", KfctlCreatePath, strings.NewReader(c.body))
+		if c.contentType != "" {
+			r.Header.Set("Content-Type", c.contentType)
+		}
+		actual := kfdefs.KfDef{}
+		if err := decodeBody(r, &actual); err != nil {
+			t.Errorf("Content-Type %v: decodeBody failed; %v", c.contentType, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Content-Type %v: got\n%v\nwant\n%v", c.contentType, PrettyPrint(actual), PrettyPrint(expected))
+		}
+	}
+}
+
+func TestPrefersYAML(t *testing.T) {
+	cases := map[string]bool{
+		"":                                    false,
+		"*/*":                                 false,
+		"application/json":                    false,
+		"application/yaml":                    true,
+		"text/yaml":                           true,
+		"application/json, application/yaml":  false,
+		"application/yaml, application/json":  true,
+		"text/html, application/x-yaml;q=0.9": true,
+		"text/html":                           false,
+		"application/x-protobuf":              false,
+	}
+
+	for accept, expected := range cases {
+		if actual := prefersYAML(accept); actual != expected {
+			t.Errorf("Accept %q: got %v; want %v", accept, actual, expected)
+		}
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	response := &ErrorHistory{
+		Name: "kf-app",
+		Errors: []DeploymentError{
+			{
+				Phase:   PhaseApplyK8s,
+				Message: "apply failed",
+				Code:    http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for _, accept := range []string{"application/yaml", "application/json"} {
+		r := httptest.NewRequest("POST", KfctlErrorsPath, nil)
+		r.Header.Set("Accept", accept)
+		r = withAccept(r)
+
+		w := httptest.NewRecorder()
+		if err := encodeResponse(r.Context(), w, response); err != nil {
+			t.Errorf("Accept %v: encodeResponse failed; %v", accept, err)
+			continue
+		}
+
+		contentType := w.Header().Get("Content-Type")
+		if isYAML(contentType) != (accept == "application/yaml") {
+			t.Errorf("Accept %v: got Content-Type %v", accept, contentType)
+		}
+
+		// YAML is a superset of JSON so both can be decoded with yaml.Unmarshal.
+		actual := &ErrorHistory{}
+		if err := yaml.Unmarshal(w.Body.Bytes(), actual); err != nil {
+			t.Errorf("Accept %v: could not decode response; %v", accept, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, response) {
+			t.Errorf("Accept %v: got %v; want %v", accept, PrettyPrint(actual), PrettyPrint(response))
+		}
+	}
+
+	// Requests encoded by clients created with WithYAMLRequests are decoded by the server.
+	r := httptest.NewRequest("POST", KfctlErrorsPath, nil)
+	if err := encodeHTTPYAMLRequest(context.Background(), r, response); err != nil {
+		t.Fatalf("encodeHTTPYAMLRequest failed; %v", err)
+	}
+	actual := &ErrorHistory{}
+	if err := decodeBody(r, actual); err != nil {
+		t.Fatalf("decodeBody failed; %v", err)
+	}
+	if !reflect.DeepEqual(actual, response) {
+		t.Errorf("Got %v; want %v", PrettyPrint(actual), PrettyPrint(response))
+	}
+}
+
+func TestProtobufTransport(t *testing.T) {
+	expected := newProtobufTestKfDef()
+
+	// A request encoded by a client created with WithProtobuf is decoded by the server.
+	r := httptest.NewRequest("POST", KfctlCreatePath, nil)
+	if err := encodeHTTPProtobufRequest(context.Background(), r, *expected); err != nil {
+		t.Fatalf("encodeHTTPProtobufRequest failed; %v", err)
+	}
+	if r.Header.Get("Content-Type") != ContentTypeProtobuf {
+		t.Errorf("Got Content-Type %v; want %v", r.Header.Get("Content-Type"), ContentTypeProtobuf)
+	}
+	actual := &kfdefs.KfDef{}
+	if err := decodeBody(r, actual); err != nil {
+		t.Fatalf("decodeBody failed; %v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Got %v; want %v", PrettyPrint(actual), PrettyPrint(expected))
+	}
+
+	// Only KfDefs can be decoded from protobuf.
+	r = httptest.NewRequest("POST", KfctlStatsPath, strings.NewReader("x"))
+	r.Header.Set("Content-Type", ContentTypeProtobuf)
+	err := decodeBody(r, &StatsRequest{})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("decodeBody of a protobuf StatsRequest: want 415; got %v", err)
+	}
+
+	// KfDef responses are encoded as protobuf and decoded by the client.
+	r = httptest.NewRequest("POST", KfctlGetpath, nil)
+	r.Header.Set("Accept", protobufAccept)
+	r = withAccept(r)
+	w := httptest.NewRecorder()
+	if err := encodeResponse(r.Context(), w, expected); err != nil {
+		t.Fatalf("encodeResponse failed; %v", err)
+	}
+	resp := w.Result()
+	if resp.Header.Get("Content-Type") != ContentTypeProtobuf {
+		t.Errorf("Got Content-Type %v; want %v", resp.Header.Get("Content-Type"), ContentTypeProtobuf)
+	}
+	decoded, err := decodeHTTPKfdefResponse(context.Background(), resp)
+	if err != nil {
+		t.Fatalf("decodeHTTPKfdefResponse failed; %v", err)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Got %v; want %v", PrettyPrint(decoded), PrettyPrint(expected))
+	}
+
+	// Other responses fall back to JSON.
+	w = httptest.NewRecorder()
+	if err := encodeResponse(r.Context(), w, &ErrorHistory{Name: "kf-app"}); err != nil {
+		t.Fatalf("encodeResponse failed; %v", err)
+	}
+	if isProtobuf(w.Header().Get("Content-Type")) {
+		t.Errorf("ErrorHistory shouldn't be encoded as protobuf")
+	}
+}
@@ -0,0 +1,22 @@
+package app
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+)
+
+// KfctlConvertPath is the path on which to serve requests to convert ksonnet KfDefs
+const KfctlConvertPath = "/kfctl/apps/v1alpha2/convert"
+
+// ConversionResult is the result of converting the app.yaml of the ksonnet based kfctl.
+type ConversionResult = lint.ConversionResult
+
+// makeConvertEndpoint creates an endpoint to handle convert requests.
+func makeConvertEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.Convert(ctx, req)
+	}
+}
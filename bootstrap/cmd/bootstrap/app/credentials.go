@@ -0,0 +1,213 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// WithTokenSource sets the source of the access token sent with each request. The token is set as
+// the gcp.GcpAccessTokenName secret of the KfDefs in the request replacing any token already set,
+// so callers don't need to manage the secret themselves.
+func WithTokenSource(ts oauth2.TokenSource) KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.tokenSource = ts
+	}
+}
+
+// NewDefaultTokenSource returns a token source using Google Application Default Credentials
+// e.g. the credentials from gcloud auth application-default login on a laptop or the service
+// account key in GOOGLE_APPLICATION_CREDENTIALS in CI.
+func NewDefaultTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	ts, err := google.DefaultTokenSource(ctx, cloudresourcemanager.CloudPlatformScope)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ts, nil
+}
+
+// NewMetadataTokenSource returns a token source for a service account from the GCE metadata
+// server e.g. when running in cluster on GKE. An empty account is the default service account.
+func NewMetadataTokenSource(account string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, google.ComputeTokenSource(account))
+}
+
+// NewStaticTokenSource returns a token source which always returns token; it is never refreshed.
+func NewStaticTokenSource(token string) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+}
+
+// NewFileTokenSource returns a token source which reads the token from path. The file is read
+// again whenever it changes so another process e.g. a sidecar or a CI step can refresh the token.
+// The file contains either the access token or an oauth2.Token as JSON.
+func NewFileTokenSource(path string) oauth2.TokenSource {
+	return &fileTokenSource{path: path}
+}
+
+// fileTokenSource is the token source returned by NewFileTokenSource.
+type fileTokenSource struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	t       *oauth2.Token
+}
+
+func (s *fileTokenSource) Token() (*oauth2.Token, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t == nil || !info.ModTime().Equal(s.modTime) {
+		b, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		t, err := parseToken(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read the token in %v", s.path)
+		}
+		s.t = t
+		s.modTime = info.ModTime()
+	}
+	if !s.t.Valid() {
+		return nil, fmt.Errorf("the token in %v expired at %v", s.path, s.t.Expiry)
+	}
+	return s.t, nil
+}
+
+// parseToken parses an oauth2.Token encoded as JSON or a bare access token.
+func parseToken(b []byte) (*oauth2.Token, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '{' {
+		t := &oauth2.Token{}
+		if err := json.Unmarshal(b, t); err != nil {
+			return nil, err
+		}
+		if t.AccessToken == "" {
+			return nil, fmt.Errorf("access_token isn't set")
+		}
+		return t, nil
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	return &oauth2.Token{AccessToken: string(b)}, nil
+}
+
+// setRequestToken returns a copy of request with the token of ts set on its KfDefs.
+// Requests without a KfDef are returned unchanged.
+func setRequestToken(ts oauth2.TokenSource, request interface{}) (interface{}, error) {
+	if ts == nil {
+		return request, nil
+	}
+	t, err := ts.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get an access token")
+	}
+
+	withToken := func(d kfdefs.KfDef) kfdefs.KfDef {
+		c := d.DeepCopy()
+		c.SetSecret(kfdefs.Secret{
+			Name: gcp.GcpAccessTokenName,
+			SecretSource: &kfdefs.SecretSource{
+				LiteralSource: &kfdefs.LiteralSource{
+					Value: t.AccessToken,
+				},
+			},
+		})
+		return *c
+	}
+
+	switch r := request.(type) {
+	case kfdefs.KfDef:
+		return withToken(r), nil
+	case *kfdefs.KfDef:
+		d := withToken(*r)
+		return &d, nil
+	case StatsRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case ExecuteRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case MaintenanceRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case MaintenanceRunRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case IamReportRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case MetadataRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case MigrationRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case ReencryptionRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case BackupRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case RestoreRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case CloneRequest:
+		r.Source = withToken(r.Source)
+		return r, nil
+	case GarbageCollectionRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case OAuthClientRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case LogsRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	case ShareRequest:
+		r.KfDef = withToken(r.KfDef)
+		return r, nil
+	}
+	return request, nil
+}
+
+// encodeWithToken returns an EncodeRequestFunc which sets the token of ts on the request before
+// encoding it with encode.
+func encodeWithToken(ts oauth2.TokenSource, encode httptransport.EncodeRequestFunc) httptransport.EncodeRequestFunc {
+	return func(ctx context.Context, r *http.Request, request interface{}) error {
+		request, err := setRequestToken(ts, request)
+		if err != nil {
+			return err
+		}
+		return encode(ctx, r, request)
+	}
+}
+
+// withToken returns a copy of req with the token of the client set; used by requests which
+// are made with httpClient rather than an endpoint.
+func (c *KfctlClient) withToken(req kfdefs.KfDef) (kfdefs.KfDef, error) {
+	r, err := setRequestToken(c.tokenSource, req)
+	if err != nil {
+		return req, err
+	}
+	return r.(kfdefs.KfDef), nil
+}
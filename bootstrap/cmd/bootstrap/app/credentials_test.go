@@ -0,0 +1,160 @@
+package app
+
+import (
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestFileTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileTokenSource")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "token")
+
+	ts := NewFileTokenSource(file)
+	if _, err := ts.Token(); err == nil {
+		t.Errorf("Token should fail if the file doesn't exist")
+	}
+
+	write := func(contents string, modTime time.Time) {
+		if err := ioutil.WriteFile(file, []byte(contents), 0600); err != nil {
+			t.Fatalf("Could not write %v; %v", file, err)
+		}
+		// Set the modification time explicitly; successive writes may have the same one.
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Could not set the modification time of %v; %v", file, err)
+		}
+	}
+
+	now := time.Now()
+	type testCase struct {
+		contents string
+		expected string
+	}
+	cases := []testCase{
+		{
+			contents: "token1\n",
+			expected: "token1",
+		},
+		{
+			contents: fmt.Sprintf(`{"access_token": "token2", "expiry": "%v"}`, now.Add(time.Hour).Format(time.RFC3339)),
+			expected: "token2",
+		},
+		{
+			// Expired tokens are rejected.
+			contents: fmt.Sprintf(`{"access_token": "token3", "expiry": "%v"}`, now.Add(-time.Hour).Format(time.RFC3339)),
+		},
+		{
+			contents: `{"token_type": "Bearer"}`,
+		},
+		{
+			contents: "",
+		},
+	}
+
+	for i, c := range cases {
+		write(c.contents, now.Add(time.Duration(i)*time.Second))
+		token, err := ts.Token()
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("Token of %q should fail; got %v", c.contents, token.AccessToken)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Token of %q failed; %v", c.contents, err)
+			continue
+		}
+		if token.AccessToken != c.expected {
+			t.Errorf("Token of %q got %v; want %v", c.contents, token.AccessToken, c.expected)
+		}
+	}
+}
+
+func TestSetRequestToken(t *testing.T) {
+	d := kfdefs.KfDef{}
+	d.Name = "kf-app"
+	d.SetSecret(kfdefs.Secret{
+		Name: gcp.GcpAccessTokenName,
+		SecretSource: &kfdefs.SecretSource{
+			LiteralSource: &kfdefs.LiteralSource{Value: "stale"},
+		},
+	})
+	ts := NewStaticTokenSource("fresh")
+
+	tokenOf := func(d kfdefs.KfDef) string {
+		token, _ := d.GetSecret(gcp.GcpAccessTokenName)
+		return token
+	}
+
+	type testCase struct {
+		request interface{}
+		token   func(r interface{}) string
+	}
+	cases := []testCase{
+		{
+			request: d,
+			token:   func(r interface{}) string { return tokenOf(r.(kfdefs.KfDef)) },
+		},
+		{
+			request: &d,
+			token:   func(r interface{}) string { return tokenOf(*r.(*kfdefs.KfDef)) },
+		},
+		{
+			request: StatsRequest{KfDef: d},
+			token:   func(r interface{}) string { return tokenOf(r.(StatsRequest).KfDef) },
+		},
+		{
+			request: ExecuteRequest{KfDef: d},
+			token:   func(r interface{}) string { return tokenOf(r.(ExecuteRequest).KfDef) },
+		},
+		{
+			request: MaintenanceRequest{KfDef: d},
+			token:   func(r interface{}) string { return tokenOf(r.(MaintenanceRequest).KfDef) },
+		},
+		{
+			request: MaintenanceRunRequest{KfDef: d},
+			token:   func(r interface{}) string { return tokenOf(r.(MaintenanceRunRequest).KfDef) },
+		},
+		{
+			request: CloneRequest{Source: d},
+			token:   func(r interface{}) string { return tokenOf(r.(CloneRequest).Source) },
+		},
+	}
+
+	for _, c := range cases {
+		r, err := setRequestToken(ts, c.request)
+		if err != nil {
+			t.Errorf("setRequestToken(%T) failed; %v", c.request, err)
+			continue
+		}
+		if token := c.token(r); token != "fresh" {
+			t.Errorf("setRequestToken(%T) set token %v; want fresh", c.request, token)
+		}
+	}
+
+	// The request isn't modified.
+	if token := tokenOf(d); token != "stale" {
+		t.Errorf("setRequestToken modified the request; got token %v", token)
+	}
+
+	// Without a token source the request is unchanged.
+	if r, err := setRequestToken(nil, d); err != nil || tokenOf(r.(kfdefs.KfDef)) != "stale" {
+		t.Errorf("setRequestToken without a token source changed the request")
+	}
+
+	// Errors getting a token are returned.
+	failing := oauth2.ReuseTokenSource(nil, NewFileTokenSource("/does/not/exist"))
+	if _, err := setRequestToken(failing, d); err == nil {
+		t.Errorf("setRequestToken should fail when the token source fails")
+	}
+}
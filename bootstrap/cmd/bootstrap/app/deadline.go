@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"time"
+)
+
+// DeadlineHeader is the header carrying the deadline of the client's context. Work queued by
+// the request is stopped at the next phase boundary once the deadline passes.
+const DeadlineHeader = "X-Kfctl-Deadline"
+
+// deadlineAnnotation is set on a queued request to the deadline of the client which sent it.
+const deadlineAnnotation = "kfctl.kubeflow.org/deadline"
+
+// DeploymentDeadlineExceededReason indicates the deployment was checkpointed because the
+// deadline of the client which requested it passed.
+const DeploymentDeadlineExceededReason = "DeadlineExceeded"
+
+// errDeadlineExceeded is returned by handleDeployment when it stopped because the deadline of
+// the request passed.
+var errDeadlineExceeded = errors.New("deployment stopped because the deadline of the request passed")
+
+// deadlineKey is the context key of the deadline read from DeadlineHeader.
+type deadlineKey struct{}
+
+// requestDeadline returns the earliest of the deadline of ctx and the deadline the request
+// carrying ctx was received with.
+func requestDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if d, found := ctx.Value(deadlineKey{}).(time.Time); found && (!ok || d.Before(deadline)) {
+		return d, true
+	}
+	return deadline, ok
+}
+
+// detachDeadline returns a context which isn't canceled with ctx but still carries its deadline
+// so it is propagated by work continuing after the request returns.
+func detachDeadline(ctx context.Context) context.Context {
+	deadline, ok := requestDeadline(ctx)
+	if !ok {
+		return context.Background()
+	}
+	return context.WithValue(context.Background(), deadlineKey{}, deadline)
+}
+
+// setDeadlineHeader is a transport/http.RequestFunc propagating the deadline of the context to
+// the server. A router forwards the deadline it received.
+func setDeadlineHeader(ctx context.Context, r *http.Request) context.Context {
+	if deadline, ok := requestDeadline(ctx); ok {
+		r.Header.Set(DeadlineHeader, deadline.UTC().Format(time.RFC3339Nano))
+	}
+	return ctx
+}
+
+// readDeadlineHeader is a transport/http.RequestFunc adding the deadline sent by the client to
+// the context. Invalid deadlines are ignored.
+func readDeadlineHeader(ctx context.Context, r *http.Request) context.Context {
+	v := r.Header.Get(DeadlineHeader)
+	if v == "" {
+		return ctx
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		log.Warnf("Ignoring invalid %v %v; %v", DeadlineHeader, v, err)
+		return ctx
+	}
+	return context.WithValue(ctx, deadlineKey{}, deadline)
+}
+
+// checkDeadline returns an error if the deadline of the request already passed so no work is
+// queued for it.
+func checkDeadline(ctx context.Context) error {
+	if deadline, ok := requestDeadline(ctx); ok && !time.Now().Before(deadline) {
+		return &httpError{
+			Message: fmt.Sprintf("The deadline of the request passed at %v", deadline.Format(time.RFC3339)),
+			Code:    http.StatusRequestTimeout,
+		}
+	}
+	return nil
+}
+
+// setDeadline records the deadline of the request in ctx on the request d queued for it.
+func setDeadline(ctx context.Context, d *kfdefs.KfDef) {
+	deadline, ok := requestDeadline(ctx)
+	if !ok {
+		return
+	}
+	if d.Annotations == nil {
+		d.Annotations = map[string]string{}
+	}
+	d.Annotations[deadlineAnnotation] = deadline.UTC().Format(time.RFC3339Nano)
+}
+
+// takeDeadline removes the deadline from a queued request and returns it; zero if there is none.
+func takeDeadline(r *kfdefs.KfDef) time.Time {
+	v, ok := r.Annotations[deadlineAnnotation]
+	if !ok {
+		return time.Time{}
+	}
+	delete(r.Annotations, deadlineAnnotation)
+	deadline, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		log.Warnf("Ignoring invalid deadline %v of %v; %v", v, r.Name, err)
+		return time.Time{}
+	}
+	return deadline
+}
+
+// deadlineExceeded returns true if the deadline of the deployment being handled passed.
+func (s *kfctlServer) deadlineExceeded() bool {
+	return !s.deadline.IsZero() && !time.Now().Before(s.deadline)
+}
+
+// setDeadlineCondition reports the deployment stopped before phase because its deadline passed.
+func (s *kfctlServer) setDeadlineCondition(phase DeploymentPhase) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.latestKfDef.Status.Conditions = append(s.latestKfDef.Status.Conditions, kfdefs.KfDefCondition{
+		Type:               kfdefs.KfDeploying,
+		Status:             v1.ConditionFalse,
+		Reason:             DeploymentDeadlineExceededReason,
+		Message:            fmt.Sprintf("The deadline of the request passed before phase %v; resubmit it to resume.", phase),
+		LastUpdateTime:     metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	})
+	s.publishStatus()
+}
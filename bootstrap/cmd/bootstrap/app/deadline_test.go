@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDeadlineHeader(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	r, err := http.NewRequest("POST", "http://localhost"+KfctlCreatePath, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	setDeadlineHeader(ctx, r)
+
+	// The server's context isn't canceled with the client's; only the deadline is propagated.
+	got, ok := requestDeadline(readDeadlineHeader(context.Background(), r))
+	if !ok || !got.Equal(deadline) {
+		t.Errorf("Deadline read from the header: got %v, %v; want %v", got, ok, deadline)
+	}
+
+	req := newPlanTestKfDef()
+	setDeadline(detachDeadline(readDeadlineHeader(context.Background(), r)), &req)
+	if got := takeDeadline(&req); !got.Equal(deadline) {
+		t.Errorf("Deadline of the queued request: got %v; want %v", got, deadline)
+	}
+	if _, ok := req.Annotations[deadlineAnnotation]; ok {
+		t.Errorf("takeDeadline didn't remove the annotation")
+	}
+}
+
+func TestKfctlServer_DeadlineExceeded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadline")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = s.CreateDeployment(ctx, req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusRequestTimeout {
+		t.Errorf("CreateDeployment after the deadline: want 408; got %v", err)
+	}
+
+	s.deadline = time.Now().Add(time.Minute)
+	if err := s.atPhaseBoundary(req, PhaseApplyPlatform); err != nil {
+		t.Errorf("atPhaseBoundary before the deadline: got %v", err)
+	}
+
+	s.deadline = time.Now().Add(-time.Second)
+	if err := s.atPhaseBoundary(req, PhaseApplyK8s); err != errDeadlineExceeded {
+		t.Errorf("atPhaseBoundary after the deadline: want errDeadlineExceeded; got %v", err)
+	}
+	if s.resumePhase != PhaseApplyK8s {
+		t.Errorf("Resume phase: got %v; want %v", s.resumePhase, PhaseApplyK8s)
+	}
+	if _, err := os.Stat(path.Join(dir, checkpointFile)); err != nil {
+		t.Errorf("Deployment wasn't checkpointed; %v", err)
+	}
+}
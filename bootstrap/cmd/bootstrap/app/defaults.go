@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KfctlDefaultsPath is the path on which to serve requests for the default KfDef of a platform
+const KfctlDefaultsPath = "/kfctl/apps/v1alpha2/defaults"
+
+// DefaultsRequest asks for the KfDef the server would use for a platform and Kubeflow version.
+type DefaultsRequest struct {
+	// Platform is the platform to deploy to e.g. gcp; empty to deploy to an existing cluster.
+	Platform string `json:"platform,omitempty"`
+	// Version is the Kubeflow version e.g. v0.6.2 or master.
+	Version string `json:"version"`
+}
+
+// defaultConfigURI is the URI of the config file of a platform; it is formatted with the
+// Kubeflow version and the name of the file in defaultConfigs.
+var defaultConfigURI = "https://raw.githubusercontent.com/kubeflow/kubeflow/%v/bootstrap/config/%v"
+
+// defaultConfigs are the config files of the supported platforms.
+var defaultConfigs = map[string]string{
+	"":                       "kfctl_k8s_istio.yaml",
+	kftypes.GCP:              "kfctl_gcp_iap.yaml",
+	kftypes.AWS:              "kfctl_aws.yaml",
+	kftypes.EXISTING_ARRIKTO: "kfctl_existing_arrikto.yaml",
+}
+
+// defaultsVersion matches the versions defaults are served for; master or a release e.g. v0.6.2.
+var defaultsVersion = regexp.MustCompile(`^(master|v\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?)$`)
+
+// defaultsCache holds the config files already loaded for a release. The config of master
+// changes so it is loaded on every request.
+var defaultsCache = struct {
+	mu      sync.Mutex
+	configs map[DefaultsRequest]*kfdefs.KfDef
+}{configs: map[DefaultsRequest]*kfdefs.KfDef{}}
+
+// makeDefaultsEndpoint creates an endpoint to handle requests for the default KfDef.
+func makeDefaultsEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(DefaultsRequest)
+		return svc.GetKfDefDefaults(ctx, req)
+	}
+}
+
+// decodeHTTPDefaultsRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded DefaultsRequest from the HTTP request body.
+func decodeHTTPDefaultsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request DefaultsRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding defaults request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
+
+// loadDefaultConfig returns the config file of the platform at the version in req.
+func loadDefaultConfig(req DefaultsRequest) (*kfdefs.KfDef, error) {
+	cacheable := req.Version != "master"
+	if cacheable {
+		defaultsCache.mu.Lock()
+		d, ok := defaultsCache.configs[req]
+		defaultsCache.mu.Unlock()
+		if ok {
+			return d.DeepCopy(), nil
+		}
+	}
+
+	uri := fmt.Sprintf(defaultConfigURI, req.Version, defaultConfigs[req.Platform])
+	d, err := kfdefs.LoadKFDefFromURI(uri)
+	if err != nil {
+		log.Errorf("Could not load the default config %v; error %v", uri, err)
+		return nil, &httpError{
+			Message: fmt.Sprintf("There is no default config of platform %q for Kubeflow %v", req.Platform, req.Version),
+			Code:    http.StatusNotFound,
+			cause:   err,
+		}
+	}
+
+	if cacheable {
+		defaultsCache.mu.Lock()
+		defaultsCache.configs[req] = d.DeepCopy()
+		defaultsCache.mu.Unlock()
+	}
+	return d, nil
+}
+
+// defaultKfDef returns the KfDef used for a deployment to the platform at the version in req
+// when the request doesn't override any options. The name and project are left for the caller.
+func defaultKfDef(c *ServerConfig, req DefaultsRequest) (*kfdefs.KfDef, error) {
+	if !defaultsVersion.MatchString(req.Version) {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Version %q isn't valid; it must be master or a release e.g. v0.6.2", req.Version),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if _, ok := defaultConfigs[req.Platform]; !ok {
+		platforms := []string{}
+		for p := range defaultConfigs {
+			if p != "" {
+				platforms = append(platforms, p)
+			}
+		}
+		sort.Strings(platforms)
+		return nil, &httpError{
+			Message: fmt.Sprintf("There are no defaults for platform %q; supported platforms are %v", req.Platform, strings.Join(platforms, ", ")),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if !c.allowsPlatform(req.Platform) {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Platform %q isn't supported by this service; supported platforms are %v",
+				req.Platform, strings.Join(c.AllowedPlatforms, ", ")),
+			Code: http.StatusBadRequest,
+		}
+	}
+
+	d, err := loadDefaultConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	// The server chooses the name of the example config and the app directory.
+	d.Name = ""
+	d.Spec.AppDir = ""
+	d.Spec.Platform = req.Platform
+	d.Spec.Version = req.Version
+
+	if err := lint.SetDefaults(d); err != nil {
+		return nil, &httpError{
+			Message: fmt.Sprintf("The default config of Kubeflow %v has an invalid gcp plugin", req.Version),
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	return d, nil
+}
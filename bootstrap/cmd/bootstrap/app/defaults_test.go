@@ -0,0 +1,98 @@
+package app
+
+import (
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+)
+
+const defaultsTestConfig = `apiVersion: kfdef.apps.kubeflow.org/v1alpha1
+kind: KfDef
+metadata:
+  name: myapp
+  namespace: kubeflow
+spec:
+  appdir: /tmp/myapp
+  platform: gcp
+  plugins:
+  - name: gcp
+    spec:
+      createPipelinePersistentStorage: false
+  applications:
+  - name: centraldashboard
+`
+
+func TestDefaultKfDef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(path.Join(dir, "v0.7.0"), os.ModePerm); err != nil {
+		t.Fatalf("Could not create the version directory; %v", err)
+	}
+	configFile := path.Join(dir, "v0.7.0", defaultConfigs[kftypes.GCP])
+	if err := ioutil.WriteFile(configFile, []byte(defaultsTestConfig), 0644); err != nil {
+		t.Fatalf("Could not write %v; %v", configFile, err)
+	}
+	oldURI := defaultConfigURI
+	defaultConfigURI = path.Join(dir, "%v", "%v")
+	defer func() { defaultConfigURI = oldURI }()
+
+	req := DefaultsRequest{Platform: kftypes.GCP, Version: "v0.7.0"}
+	d, err := defaultKfDef(DefaultServerConfig(), req)
+	if err != nil {
+		t.Fatalf("defaultKfDef: %v", err)
+	}
+	if d.Name != "" || d.Spec.AppDir != "" {
+		t.Errorf("Name %q and AppDir %q should be cleared", d.Name, d.Spec.AppDir)
+	}
+	if d.Spec.Version != "v0.7.0" || d.Namespace != "kubeflow" || len(d.Spec.Applications) != 1 {
+		t.Errorf("KfDef doesn't match the config; got version %v, namespace %v, %v applications",
+			d.Spec.Version, d.Namespace, len(d.Spec.Applications))
+	}
+	pluginSpec := &gcp.GcpPluginSpec{}
+	if err := d.GetPluginSpec(gcp.GcpPluginName, pluginSpec); err != nil {
+		t.Fatalf("GetPluginSpec: %v", err)
+	}
+	if pluginSpec.CreatePipelinePersistentStorage == nil || *pluginSpec.CreatePipelinePersistentStorage {
+		t.Errorf("CreatePipelinePersistentStorage: got %v; want the value of the config", pluginSpec.CreatePipelinePersistentStorage)
+	}
+	if pluginSpec.EnableWorkloadIdentity == nil || *pluginSpec.EnableWorkloadIdentity {
+		t.Errorf("EnableWorkloadIdentity: got %v; want false", pluginSpec.EnableWorkloadIdentity)
+	}
+
+	// Releases are served from the cache and callers get their own copy.
+	d.Spec.Applications = nil
+	if err := os.Remove(configFile); err != nil {
+		t.Fatalf("Could not remove %v; %v", configFile, err)
+	}
+	if d, err := defaultKfDef(DefaultServerConfig(), req); err != nil || len(d.Spec.Applications) != 1 {
+		t.Errorf("defaultKfDef from the cache: got %v; want the cached config", err)
+	}
+
+	errCases := []struct {
+		req  DefaultsRequest
+		code int
+	}{
+		{req: DefaultsRequest{Platform: kftypes.GCP, Version: "../v0.7.0"}, code: http.StatusBadRequest},
+		{req: DefaultsRequest{Platform: "openstack", Version: "v0.7.0"}, code: http.StatusBadRequest},
+		{req: DefaultsRequest{Platform: kftypes.AWS, Version: "v0.7.0"}, code: http.StatusNotFound},
+	}
+	for _, c := range errCases {
+		_, err := defaultKfDef(DefaultServerConfig(), c.req)
+		if hErr, ok := err.(*httpError); !ok || hErr.Code != c.code {
+			t.Errorf("defaultKfDef(%+v): got %v; want code %v", c.req, err, c.code)
+		}
+	}
+
+	config := DefaultServerConfig()
+	config.AllowedPlatforms = []string{kftypes.AWS}
+	if _, err := defaultKfDef(config, req); err == nil {
+		t.Errorf("defaultKfDef of a platform which isn't allowed: got nil; want error")
+	}
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"time"
+)
+
+// KfctlPrepareDeletePath is the path on which to serve requests for a token to delete a deployment
+const KfctlPrepareDeletePath = "/kfctl/apps/v1alpha2/delete/prepare"
+
+// DeleteConfirmationAnnotation is the annotation of a delete request holding the token returned
+// by PrepareDelete.
+const DeleteConfirmationAnnotation = "kfctl.kubeflow.org/delete-confirmation"
+
+// deleteConfirmationTTL is how long a token returned by PrepareDelete can be used.
+const deleteConfirmationTTL = 10 * time.Minute
+
+// DeletePlan lists what deleting a deployment destroys.
+type DeletePlan struct {
+	Name    string `json:"name"`
+	Project string `json:"project"`
+	// Resources are the cloud and K8s resources of the inventory which will be deleted.
+	Resources []kfdefs.InventoryResource `json:"resources"`
+	// K8sOnly is true if the deployment targets a cluster it doesn't own; only the K8s resources
+	// are deleted.
+	K8sOnly bool `json:"k8sOnly,omitempty"`
+	// Token confirms the deletion; set it in DeleteConfirmationAnnotation of the delete request.
+	// It can be used once and is void once it expires or the deployment is applied again.
+	Token   string      `json:"token"`
+	Expires metav1.Time `json:"expires"`
+}
+
+// deleteConfirmation is the token issued by the latest PrepareDelete.
+type deleteConfirmation struct {
+	token   string
+	expires time.Time
+	// appliedHash is the hash of the deployment the plan was made for.
+	appliedHash string
+}
+
+// deletionProtectedError is returned for requests to delete a deployment with deletion protection.
+func deletionProtectedError(name string) error {
+	return &httpError{
+		Message: fmt.Sprintf("Deployment %v has deletion protection; disable it with UpdateMetadata before deleting the deployment", name),
+		Code:    http.StatusConflict,
+	}
+}
+
+// newDeleteToken returns a random token confirming a deletion.
+func newDeleteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// PrepareDelete returns the resources deleting the deployment would destroy and a token which
+// must be set on the delete request. Tokens are kept in memory so they are void once the server
+// restarts. A new token replaces the previous one.
+func (s *kfctlServer) PrepareDelete(ctx context.Context, req kfdefs.KfDef) (*DeletePlan, error) {
+	if err := s.checkDeploymentRequest(req); err != nil {
+		return nil, err
+	}
+
+	token, err := newDeleteToken()
+	if err != nil {
+		log.Errorf("Could not generate a delete confirmation token; %v", err)
+		return nil, &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	if s.metadata.DeletionProtection {
+		return nil, deletionProtectedError(req.Name)
+	}
+
+	plan := &DeletePlan{
+		Name:      s.latestKfDef.Name,
+		Project:   s.latestKfDef.Spec.Project,
+		Resources: []kfdefs.InventoryResource{},
+		K8sOnly:   s.targetCluster != nil,
+		Token:     token,
+		Expires:   metav1.NewTime(time.Now().Add(deleteConfirmationTTL)),
+	}
+	for _, r := range s.latestKfDef.Status.Inventory {
+		// Cloud resources don't have an API version.
+		if plan.K8sOnly && r.APIVersion == "" {
+			continue
+		}
+		plan.Resources = append(plan.Resources, r)
+	}
+	s.deleteConfirmation = &deleteConfirmation{
+		token:       token,
+		expires:     plan.Expires.Time,
+		appliedHash: s.appliedHash,
+	}
+	log.Infof("Issued a token to delete deployment %v expiring at %v", req.Name, plan.Expires)
+	return plan, nil
+}
+
+// takeDeleteConfirmation returns an error if the deployment has deletion protection or req doesn't
+// hold a valid token; the token is consumed otherwise. Callers must hold kfDefMux.
+func (s *kfctlServer) takeDeleteConfirmation(req kfdefs.KfDef, now time.Time) error {
+	if s.metadata.DeletionProtection {
+		return deletionProtectedError(req.Name)
+	}
+	token, ok := req.Annotations[DeleteConfirmationAnnotation]
+	if !ok || token == "" {
+		return &httpError{
+			Message: fmt.Sprintf("Deleting deployment %v requires the token returned by PrepareDelete in the annotation %v", req.Name, DeleteConfirmationAnnotation),
+			Code:    http.StatusPreconditionFailed,
+		}
+	}
+	c := s.deleteConfirmation
+	if c == nil || subtle.ConstantTimeCompare([]byte(c.token), []byte(token)) != 1 || now.After(c.expires) || c.appliedHash != s.appliedHash {
+		return &httpError{
+			Message: fmt.Sprintf("The token to delete deployment %v is invalid, expired or was issued before the deployment changed; call PrepareDelete again", req.Name),
+			Code:    http.StatusPreconditionFailed,
+		}
+	}
+	s.deleteConfirmation = nil
+	return nil
+}
+
+// PrepareDelete forwards the request to the backend handling the deployment which issues the token.
+func (r *kfctlRouter) PrepareDelete(ctx context.Context, req kfdefs.KfDef) (*DeletePlan, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.PrepareDelete(ctx, req)
+}
+
+// PrepareDelete returns what deleting the deployment would destroy and the token confirming the deletion.
+func (c *KfctlClient) PrepareDelete(ctx context.Context, req kfdefs.KfDef) (*DeletePlan, error) {
+	var resp interface{}
+	err := c.retry("PrepareDelete", func() error {
+		var err error
+		resp, err = c.prepareDeleteEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*DeletePlan)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makePrepareDeleteEndpoint creates an endpoint to handle requests for a token to delete a deployment.
+func makePrepareDeleteEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.PrepareDelete(ctx, req)
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKfctlServer_DeleteConfirmation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newQueueTestServer(dir)
+	s.latestKfDef.Status.Inventory = []kfdefsv3.InventoryResource{
+		{Kind: "container.v1.cluster", Name: "kf-app", Project: "acme"},
+		{Kind: "Namespace", APIVersion: "v1", Name: "kubeflow"},
+	}
+	s.appliedHash = "applied"
+
+	withToken := func(token string) kfdefsv3.KfDef {
+		req := newPlanTestKfDef()
+		req.Annotations = map[string]string{DeleteConfirmationAnnotation: token}
+		return req
+	}
+	expectCode := func(name string, err error, code int) {
+		if hErr, ok := err.(*httpError); !ok || hErr.Code != code {
+			t.Errorf("%v: want %v; got %v", name, code, err)
+		}
+	}
+
+	_, err = s.DeleteDeployment(context.Background(), newPlanTestKfDef())
+	expectCode("Delete without a token", err, http.StatusPreconditionFailed)
+
+	plan, err := s.PrepareDelete(context.Background(), newPlanTestKfDef())
+	if err != nil {
+		t.Fatalf("PrepareDelete failed; %v", err)
+	}
+	// The cluster isn't owned by the deployment so only the K8s resources are deleted.
+	if !plan.K8sOnly || len(plan.Resources) != 1 || plan.Resources[0].Kind != "Namespace" {
+		t.Errorf("Plan: want only the namespace to be deleted; got %v", PrettyPrint(plan))
+	}
+
+	_, err = s.DeleteDeployment(context.Background(), withToken("wrong"))
+	expectCode("Delete with a wrong token", err, http.StatusPreconditionFailed)
+
+	// The token is void once the deployment is applied again.
+	s.appliedHash = "reapplied"
+	_, err = s.DeleteDeployment(context.Background(), withToken(plan.Token))
+	expectCode("Delete after the deployment changed", err, http.StatusPreconditionFailed)
+
+	plan, err = s.PrepareDelete(context.Background(), newPlanTestKfDef())
+	if err != nil {
+		t.Fatalf("PrepareDelete failed; %v", err)
+	}
+	s.kfDefMux.Lock()
+	err = s.takeDeleteConfirmation(withToken(plan.Token), plan.Expires.Add(time.Second))
+	s.kfDefMux.Unlock()
+	expectCode("Delete with an expired token", err, http.StatusPreconditionFailed)
+
+	if _, err := s.DeleteDeployment(context.Background(), withToken(plan.Token)); err != nil {
+		t.Fatalf("DeleteDeployment failed; %v", err)
+	}
+	if queued := <-s.c; !takeDelete(&queued) {
+		t.Errorf("Queued request doesn't delete the deployment")
+	}
+	_, err = s.DeleteDeployment(context.Background(), withToken(plan.Token))
+	expectCode("Delete reusing a token", err, http.StatusPreconditionFailed)
+}
+
+func TestKfctlServer_DeletionProtection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newQueueTestServer(dir)
+	plan, err := s.PrepareDelete(context.Background(), newPlanTestKfDef())
+	if err != nil {
+		t.Fatalf("PrepareDelete failed; %v", err)
+	}
+
+	protect := true
+	d, err := s.UpdateMetadata(context.Background(), MetadataRequest{
+		KfDef:              newPlanTestKfDef(),
+		DeletionProtection: &protect,
+	})
+	if err != nil {
+		t.Fatalf("UpdateMetadata failed; %v", err)
+	}
+	if d.Annotations[DeletionProtectionAnnotation] != "true" {
+		t.Errorf("KfDef doesn't report the deletion protection; got %v", d.Annotations)
+	}
+
+	req := newPlanTestKfDef()
+	req.Annotations = map[string]string{DeleteConfirmationAnnotation: plan.Token}
+	if _, err := s.DeleteDeployment(context.Background(), req); err == nil || err.(*httpError).Code != http.StatusConflict {
+		t.Errorf("Delete of a protected deployment: want 409; got %v", err)
+	}
+	if _, err := s.PrepareDelete(context.Background(), newPlanTestKfDef()); err == nil || err.(*httpError).Code != http.StatusConflict {
+		t.Errorf("PrepareDelete of a protected deployment: want 409; got %v", err)
+	}
+	list, err := s.ListDeployments(context.Background(), newPlanTestKfDef())
+	if err != nil {
+		t.Fatalf("ListDeployments failed; %v", err)
+	}
+	if len(list.Deployments) != 1 || !list.Deployments[0].DeletionProtection {
+		t.Errorf("Listed deployments don't report the deletion protection; got %v", PrettyPrint(list))
+	}
+
+	protect = false
+	d, err = s.UpdateMetadata(context.Background(), MetadataRequest{
+		KfDef:              newPlanTestKfDef(),
+		DeletionProtection: &protect,
+	})
+	if err != nil {
+		t.Fatalf("UpdateMetadata failed; %v", err)
+	}
+	if _, ok := d.Annotations[DeletionProtectionAnnotation]; ok {
+		t.Errorf("Deletion protection annotation wasn't removed; got %v", d.Annotations)
+	}
+	if _, err := s.DeleteDeployment(context.Background(), req); err != nil {
+		t.Errorf("Delete once the protection is disabled failed; %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// KfctlListPath is the path on which to serve requests to list the deployments in a project
+const KfctlListPath = "/kfctl/apps/v1alpha2/list"
+
+// KfctlDeletePath is the path on which to serve requests to delete a deployment
+const KfctlDeletePath = "/kfctl/apps/v1alpha2/delete"
+
+// deleteAnnotation is set on a queued request to delete the deployment rather than apply it.
+const deleteAnnotation = "kfctl.kubeflow.org/delete"
+
+// DeploymentSummary describes a deployment handled by a kfctl server.
+type DeploymentSummary struct {
+	Name    string          `json:"name"`
+	Project string          `json:"project"`
+	Phase   DeploymentPhase `json:"phase"`
+	// Platform and Version are those of the KfDef of the deployment.
+	Platform string `json:"platform,omitempty"`
+	Version  string `json:"version,omitempty"`
+	// Created is when the deployment was created; zero if created before it was recorded.
+	Created metav1.Time `json:"created,omitempty"`
+	// Busy is true while the deployment is being applied or deleted.
+	Busy   bool `json:"busy"`
+	Paused bool `json:"paused"`
+	// Description, OwnerContact and Labels are the metadata of the deployment.
+	Description  string            `json:"description,omitempty"`
+	OwnerContact string            `json:"ownerContact,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	// DeletionProtection is true if the deployment can't be deleted.
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+	// UpdateAvailable is true if the upstream release branch has changes the pinned manifests of
+	// the deployment don't have; see UpdateCheckConfig.
+	UpdateAvailable bool `json:"updateAvailable,omitempty"`
+	// Server is the name of the kfctl server handling the deployment; only set by the router.
+	Server string `json:"server,omitempty"`
+}
+
+// DeploymentList lists the deployments in a project.
+type DeploymentList struct {
+	// Project is empty if the deployments of every project are listed.
+	Project     string              `json:"project"`
+	Deployments []DeploymentSummary `json:"deployments"`
+	// Unavailable is the number of kfctl servers in the project that couldn't be queried.
+	Unavailable int `json:"unavailable,omitempty"`
+}
+
+// ListDeployments returns the deployment handled by the server if it is in the project of the request.
+func (s *kfctlServer) ListDeployments(ctx context.Context, req kfdefs.KfDef) (*DeploymentList, error) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+
+	list := &DeploymentList{
+		Project:     req.Spec.Project,
+		Deployments: []DeploymentSummary{},
+	}
+	if s.latestKfDef.Name == "" || (req.Spec.Project != "" && s.latestKfDef.Spec.Project != req.Spec.Project) {
+		return list, nil
+	}
+	list.Deployments = append(list.Deployments, DeploymentSummary{
+		Name:    s.latestKfDef.Name,
+		Project: s.latestKfDef.Spec.Project,
+		Phase:   s.reportedPhase(),
+		Busy:    s.busy,
+		Paused:  s.paused,
+
+		Platform: s.latestKfDef.Spec.Platform,
+		Version:  s.latestKfDef.Spec.Version,
+		Created:  s.latestKfDef.CreationTimestamp,
+
+		Description:  s.metadata.Description,
+		OwnerContact: s.metadata.OwnerContact,
+		Labels:       s.metadata.Labels,
+
+		DeletionProtection: s.metadata.DeletionProtection,
+		UpdateAvailable:    s.updateCondition != nil && s.updateCondition.Status == v1.ConditionTrue,
+	})
+	return list, nil
+}
+
+// setCreationTimestamp sets the creation timestamp of the request d; it's kept when the
+// deployment is updated.
+func (s *kfctlServer) setCreationTimestamp(d *kfdefs.KfDef) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	d.CreationTimestamp = s.latestKfDef.CreationTimestamp
+	if d.CreationTimestamp.IsZero() {
+		d.CreationTimestamp = metav1.Now()
+	}
+}
+
+// ListDeployments lists the deployments in the project handled by kfctl servers.
+// Servers are garbage collected once idle so only recently active deployments are included.
+func (r *kfctlRouter) ListDeployments(ctx context.Context, req kfdefs.KfDef) (*DeploymentList, error) {
+	backends, err := r.listBackends(req, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &DeploymentList{
+		Project:     req.Spec.Project,
+		Deployments: []DeploymentSummary{},
+	}
+	if allProjects(req) {
+		list.Project = ""
+	}
+	list.Unavailable, err = r.forEachDeployment(ctx, req, backends, func(d DeploymentSummary) error {
+		list.Deployments = append(list.Deployments, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// streamDeployments returns a stream listing the deployments in the project one kfctl server at a time.
+func (r *kfctlRouter) streamDeployments(ctx context.Context, req kfdefs.KfDef) (ndjsonStreamer, error) {
+	backends, err := r.listBackends(req, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	return &deploymentStream{
+		router:   r,
+		req:      req,
+		backends: backends,
+	}, nil
+}
+
+// listBackends checks the caller has role in the project of the request and returns the names of
+// its kfctl servers. Admins of the operator project may list the kfctl servers of every project
+// with AllProjectsAnnotation.
+func (r *kfctlRouter) listBackends(req kfdefs.KfDef, role Role) ([]string, error) {
+	project := req.Spec.Project
+	if project == "" {
+		return nil, &httpError{
+			Message: "project is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	selector := fmt.Sprintf("app=kfctl,%v=%v", ProjectKey, projectLabelValue(project))
+	if allProjects(req) {
+		if err := r.authorizeAllProjects(req); err != nil {
+			return nil, err
+		}
+		selector = "app=kfctl"
+	} else if err := r.authorize(req, role); err != nil {
+		return nil, err
+	}
+
+	backends, err := r.k8sclient.AppsV1().StatefulSets(r.namespace).List(metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		log.Errorf("Could not list kfctl servers for project %v; error %v", project, err)
+		return nil, &httpError{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Unable to process your Kubeflow request; please try again later",
+			cause:   err,
+		}
+	}
+
+	names := []string{}
+	for _, b := range backends.Items {
+		names = append(names, b.Name)
+	}
+	return names, nil
+}
+
+// forEachDeployment calls fn for each deployment of the kfctl servers and returns the number of
+// servers that couldn't be queried. It stops at the first error returned by fn.
+func (r *kfctlRouter) forEachDeployment(ctx context.Context, req kfdefs.KfDef, backends []string, fn func(DeploymentSummary) error) (int, error) {
+	if allProjects(req) {
+		// The servers return their deployment whatever its project.
+		req.Spec.Project = ""
+	}
+	unavailable := 0
+	for _, b := range backends {
+		if err := ctx.Err(); err != nil {
+			return unavailable, err
+		}
+		c, err := r.readServiceClient(b)
+		if err != nil {
+			unavailable++
+			continue
+		}
+		l, err := c.ListDeployments(ctx, req)
+		if err != nil {
+			log.Warnf("Could not list the deployments of kfctl server %v; error %v", b, err)
+			unavailable++
+			continue
+		}
+		for _, d := range l.Deployments {
+			d.Server = b
+			if err := fn(d); err != nil {
+				return unavailable, err
+			}
+		}
+	}
+	return unavailable, nil
+}
+
+// ListDeployments lists the deployments in the project of the request.
+func (c *KfctlClient) ListDeployments(ctx context.Context, req kfdefs.KfDef) (*DeploymentList, error) {
+	var resp interface{}
+	err := c.retry("ListDeployments", func() error {
+		var err error
+		resp, err = c.listEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*DeploymentList)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// takeDelete returns true if the request deletes the deployment and removes the annotation.
+func takeDelete(r *kfdefs.KfDef) bool {
+	if _, ok := r.Annotations[deleteAnnotation]; !ok {
+		return false
+	}
+	delete(r.Annotations, deleteAnnotation)
+	return true
+}
+
+// DeleteDeployment queues a request to delete the deployment. The resources are deleted in the
+// background; the status reports the progress. The request must hold the confirmation token
+// returned by PrepareDelete in DeleteConfirmationAnnotation.
+func (s *kfctlServer) DeleteDeployment(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if err := s.checkDeploymentRequest(req); err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	latest := s.latestKfDef.DeepCopy()
+	if s.busy {
+		s.kfDefMux.Unlock()
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v is being applied; cancel it before deleting it", req.Name),
+			Code:    http.StatusConflict,
+		}
+	}
+	err := s.takeDeleteConfirmation(req, time.Now())
+	s.kfDefMux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Deleting deployment %v", req.Name)
+	d := req.DeepCopy()
+	prepareSecrets(d)
+	if d.Annotations == nil {
+		d.Annotations = map[string]string{}
+	}
+	delete(d.Annotations, DeleteConfirmationAnnotation)
+	d.Annotations[deleteAnnotation] = "true"
+	s.c <- *d
+
+	return latest, nil
+}
+
+// deleteDeployment deletes the resources of the deployment. Only the K8s resources are deleted
+// from a target cluster since the cluster isn't owned by the deployment.
+func (s *kfctlServer) deleteDeployment(ctx context.Context, r kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if s.kfApp == nil {
+		cfgFile := path.Join(s.appsDir, r.Name, kftypes.KfConfigFile)
+		if _, err := os.Stat(cfgFile); err != nil {
+			log.Errorf("Could not find the app of %v; error %v", r.Name, err)
+			return &r, &httpError{
+				Message: fmt.Sprintf("Deployment %v not found", r.Name),
+				Code:    http.StatusNotFound,
+				cause:   err,
+			}
+		}
+		if err := s.loadKfApp(ctx, cfgFile); err != nil {
+			return &r, err
+		}
+	}
+
+	s.setPhase(PhaseDelete)
+	if _, err := s.configureKustomizePlugin(ctx, r); err != nil {
+		return s.kfDefGetter.GetKfDef(), err
+	}
+
+	resources := kftypes.ALL
+	if s.targetCluster != nil {
+		resources = kftypes.K8S
+	}
+	log.Infof("Calling delete %v", resources)
+	if err := s.kfApp.Delete(resources); err != nil {
+		log.Errorf("Calling delete failed; %v", err)
+		return s.kfDefGetter.GetKfDef(), &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	return s.kfDefGetter.GetKfDef(), nil
+}
+
+// DeleteDeployment forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) DeleteDeployment(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.DeleteDeployment(ctx, req)
+}
+
+// DeleteDeployment deletes the resources of the deployment in the background. The request must
+// hold the token returned by PrepareDelete in DeleteConfirmationAnnotation.
+func (c *KfctlClient) DeleteDeployment(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	return c.callKfDefEndpoint(ctx, "DeleteDeployment", c.deleteEndpoint, req)
+}
+
+// makeListEndpoint creates an endpoint to handle requests to list the deployments in a project.
+// Deployments are streamed if the client prefers ND-JSON and the service supports it.
+func makeListEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		if s, ok := svc.(deploymentStreamer); ok && prefersNDJSON(ctx) {
+			return s.streamDeployments(ctx, req)
+		}
+		return svc.ListDeployments(ctx, req)
+	}
+}
+
+// makeDeleteEndpoint creates an endpoint to handle requests to delete a deployment.
+func makeDeleteEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.DeleteDeployment(ctx, req)
+	}
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KfctlDeprecationHeader is set once per deprecated field of a request to the JSON encoded Deprecation.
+// A Warning header with the message is set as well for HTTP clients which don't know the header.
+const KfctlDeprecationHeader = "X-Kfctl-Deprecation"
+
+// deprecationWarnCode is the Warning code of deprecations; 299 is a miscellaneous persistent warning.
+const deprecationWarnCode = 299
+
+// Deprecation is a notice that a field of a request is slated for removal.
+type Deprecation struct {
+	// Field is the path of the field in the KfDef e.g. spec.components.
+	Field string `json:"field"`
+	// RemovedIn is the version of the KfDef API the field is removed in.
+	RemovedIn string `json:"removedIn"`
+	// Replacement describes what to set instead; empty if the field is no longer needed.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// Message describes the deprecation to users.
+func (d Deprecation) Message() string {
+	m := fmt.Sprintf("%v is deprecated and will be removed in %v", d.Field, d.RemovedIn)
+	if d.Replacement == "" {
+		return m + "; it is no longer needed"
+	}
+	return fmt.Sprintf("%v; %v", m, d.Replacement)
+}
+
+// removedInVersion is the version of the KfDef API the deprecated fields are removed in.
+const removedInVersion = "kfdef.apps.kubeflow.org/v1beta1"
+
+// deprecatedFields are the fields of the KfDef slated for removal. A path element of * matches
+// every element of a list.
+var deprecatedFields = []struct {
+	path []string
+	Deprecation
+}{
+	{[]string{"spec", "components"}, Deprecation{Field: "spec.components", RemovedIn: removedInVersion,
+		Replacement: "use spec.applications"}},
+	{[]string{"spec", "componentParams"}, Deprecation{Field: "spec.componentParams", RemovedIn: removedInVersion,
+		Replacement: "set the overlays and parameters in spec.applications[].kustomizeConfig"}},
+	{[]string{"spec", "packages"}, Deprecation{Field: "spec.packages", RemovedIn: removedInVersion,
+		Replacement: "use spec.applications"}},
+	{[]string{"spec", "repos", "*", "root"}, Deprecation{Field: "spec.repos[].root", RemovedIn: removedInVersion}},
+	{[]string{"spec", "useBasicAuth"}, Deprecation{Field: "spec.useBasicAuth", RemovedIn: removedInVersion,
+		Replacement: "set spec.plugins[gcp].spec.auth.basicAuth"}},
+}
+
+// requestDeprecations returns the deprecated fields set in the KfDef of a decoded request body;
+// the body is either a KfDef or a request with the KfDef in kfDef.
+func requestDeprecations(body map[string]interface{}) []Deprecation {
+	kfDef := body
+	if d, ok := body["kfDef"].(map[string]interface{}); ok {
+		kfDef = d
+	}
+	deprecations := []Deprecation{}
+	for _, f := range deprecatedFields {
+		if isFieldSet(kfDef, f.path) {
+			deprecations = append(deprecations, f.Deprecation)
+		}
+	}
+	return deprecations
+}
+
+// isFieldSet returns true if the field at path is set to a non zero value in v.
+func isFieldSet(v interface{}, path []string) bool {
+	if len(path) == 0 {
+		switch value := v.(type) {
+		case nil:
+			return false
+		case bool:
+			return value
+		case string:
+			return value != ""
+		case []interface{}:
+			return len(value) > 0
+		case map[string]interface{}:
+			return len(value) > 0
+		}
+		return true
+	}
+	if path[0] == "*" {
+		list, _ := v.([]interface{})
+		for _, e := range list {
+			if isFieldSet(e, path[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	return isFieldSet(m[path[0]], path[1:])
+}
+
+// setDeprecationHeaders warns about the deprecated fields in the body of r. The body is restored
+// so the handler can decode it; bodies which aren't JSON or YAML objects are ignored.
+func setDeprecationHeaders(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil || isProtobuf(r.Header.Get("Content-Type")) {
+		return
+	}
+	buf, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	if err != nil || len(buf) == 0 {
+		return
+	}
+	if isYAML(r.Header.Get("Content-Type")) {
+		if buf, err = yaml.YAMLToJSON(buf); err != nil {
+			return
+		}
+	}
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &body); err != nil {
+		return
+	}
+
+	for _, d := range requestDeprecations(body) {
+		notice, err := json.Marshal(d)
+		if err != nil {
+			continue
+		}
+		log.Infof("Request to %v sets deprecated field %v", r.URL.Path, d.Field)
+		w.Header().Add(KfctlDeprecationHeader, string(notice))
+		w.Header().Add("Warning", fmt.Sprintf("%v kfctl %v", deprecationWarnCode, strconv.Quote(d.Message())))
+	}
+}
+
+// makeDeprecationResponseFunc returns a ClientResponseFunc that reports the deprecations in the
+// headers of responses to f as ProgressDeprecation events or logs them if f is nil.
+func makeDeprecationResponseFunc(method string, f ProgressFunc) func(context.Context, *http.Response) context.Context {
+	return func(ctx context.Context, r *http.Response) context.Context {
+		for _, h := range r.Header[http.CanonicalHeaderKey(KfctlDeprecationHeader)] {
+			d := Deprecation{}
+			if err := json.NewDecoder(strings.NewReader(h)).Decode(&d); err != nil {
+				log.Warnf("Could not parse the deprecation %q of the response to %v; %v", h, method, err)
+				continue
+			}
+			if f == nil {
+				log.Warnf("%v: %v", method, d.Message())
+				continue
+			}
+			f(ProgressEvent{
+				Type:        ProgressDeprecation,
+				Method:      method,
+				Time:        time.Now(),
+				Message:     d.Message(),
+				Deprecation: &d,
+			})
+		}
+		return ctx
+	}
+}
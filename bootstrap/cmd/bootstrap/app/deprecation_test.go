@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequestDeprecations(t *testing.T) {
+	type testCase struct {
+		name     string
+		body     string
+		expected []string
+	}
+
+	cases := []testCase{
+		{
+			name:     "current",
+			body:     `{"spec": {"useBasicAuth": false, "applications": [{"name": "jupyter"}], "repos": [{"name": "manifests", "uri": "https://github.com/kubeflow/manifests/archive/v0.6.2.tar.gz"}]}}`,
+			expected: []string{},
+		},
+		{
+			name:     "kfdef",
+			body:     `{"spec": {"components": ["jupyter"], "useBasicAuth": true, "componentParams": {}}}`,
+			expected: []string{"spec.components", "spec.useBasicAuth"},
+		},
+		{
+			name:     "request",
+			body:     `{"kfDef": {"spec": {"packages": ["jupyter"], "repos": [{"name": "kubeflow"}, {"name": "manifests", "root": "manifests-0.6.2"}]}}}`,
+			expected: []string{"spec.packages", "spec.repos[].root"},
+		},
+	}
+
+	for _, c := range cases {
+		body := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(c.body), &body); err != nil {
+			t.Fatalf("%v: could not parse body; %v", c.name, err)
+		}
+		fields := []string{}
+		for _, d := range requestDeprecations(body) {
+			fields = append(fields, d.Field)
+		}
+		if !reflect.DeepEqual(fields, c.expected) {
+			t.Errorf("%v: got %v; want %v", c.name, fields, c.expected)
+		}
+	}
+}
+
+func TestKfctlClient_DeprecationEvents(t *testing.T) {
+	svc := &fakeKfctlService{}
+	server := newFakeKfctlServer(svc)
+	defer server.Close()
+
+	// Check the requests for deprecated fields the way the kfctl server does.
+	warnings := []string{}
+	proxy := httptest.NewServer(optionsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		warnings = append(warnings, w.Header()["Warning"]...)
+		server.Config.Handler.ServeHTTP(w, r)
+	})))
+	defer proxy.Close()
+
+	events := []ProgressEvent{}
+	c, err := NewKfctlClient(proxy.URL, WithProgressFunc(func(e ProgressEvent) {
+		events = append(events, e)
+	}))
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+
+	d := kfdefsv3.KfDef{}
+	d.Spec.ComponentConfig = config.ComponentConfig{Components: []string{"jupyter"}}
+	got, err := c.CreateDeployment(context.Background(), d)
+	if err != nil {
+		t.Fatalf("CreateDeployment error; %v", err)
+	}
+	if !reflect.DeepEqual(got.Spec.Components, []string{"jupyter"}) {
+		t.Errorf("The server got components %v; want the body of the request", got.Spec.Components)
+	}
+
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], `299 kfctl "spec.components is deprecated`) {
+		t.Errorf("Warning headers: got %v", warnings)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Got %v events; want 1:\n%v", len(events), PrettyPrint(events))
+	}
+	e := events[0]
+	if e.Type != ProgressDeprecation || e.Method != "CreateDeployment" || e.Deprecation == nil ||
+		e.Deprecation.Field != "spec.components" || e.Deprecation.RemovedIn != removedInVersion {
+		t.Errorf("Want deprecation event for spec.components; got %+v", e)
+	}
+}
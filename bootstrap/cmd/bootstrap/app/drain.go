@@ -0,0 +1,256 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+)
+
+// checkpointFile is the name of the file in the apps directory recording an interrupted deployment.
+const checkpointFile = ".checkpoint.json"
+
+// DeploymentInterruptedReason indicates the deployment was checkpointed because the server shut down.
+const DeploymentInterruptedReason = "DeploymentInterrupted"
+
+// deploymentCheckpoint records a deployment that was stopped at a phase boundary so it can be resumed.
+type deploymentCheckpoint struct {
+	// Request is the request being processed with the secrets removed.
+	Request kfdefsv3.KfDef `json:"request"`
+	// Phase is the first phase that hasn't run.
+	Phase DeploymentPhase `json:"phase"`
+	Time  time.Time       `json:"time"`
+}
+
+// errDrained is returned by handleDeployment when it stopped because the server is draining.
+var errDrained = errors.New("deployment checkpointed because the server is shutting down")
+
+// isDraining returns true once the server stopped accepting new requests.
+func (s *kfctlServer) isDraining() bool {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	return s.serverStatus == StatusFrozen
+}
+
+// atPhaseBoundary is called by handleDeployment before starting next.
+// If the deployment is paused it holds until it is resumed; if it was canceled errCanceled is returned.
+// If the deadline of the request passed the deployment is checkpointed and errDeadlineExceeded is
+// returned. If the server is draining the deployment is checkpointed and errDrained is returned.
+func (s *kfctlServer) atPhaseBoundary(r kfdefsv3.KfDef, next DeploymentPhase) error {
+	s.waitWhilePaused(r, next)
+	if s.takeCanceled() {
+		log.Infof("Deployment %v was canceled; stopping before phase %v", r.Name, next)
+		return errCanceled
+	}
+	if s.deadlineExceeded() {
+		log.Infof("Deadline of deployment %v passed; checkpointing it before phase %v", r.Name, next)
+		if err := s.writeCheckpoint(r, next); err != nil {
+			return err
+		}
+		// The deployment resumes from next when it is resubmitted.
+		s.resumePhase = next
+		return errDeadlineExceeded
+	}
+	if !s.isDraining() {
+		return nil
+	}
+
+	log.Infof("Server is draining; checkpointing deployment %v before phase %v", r.Name, next)
+	if err := s.writeCheckpoint(r, next); err != nil {
+		return err
+	}
+	return errDrained
+}
+
+// writeCheckpoint records that r stopped before phase next so it can be resumed.
+func (s *kfctlServer) writeCheckpoint(r kfdefsv3.KfDef, next DeploymentPhase) error {
+	cp := &deploymentCheckpoint{
+		Request: r,
+		Phase:   next,
+		Time:    time.Now(),
+	}
+
+	buf, err := json.Marshal(cp)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// The request may contain sensitive parameters.
+	if err := stateKeys.writeFile(path.Join(s.appsDir, checkpointFile), buf); err != nil {
+		log.Errorf("Could not write checkpoint; %v", err)
+		return err
+	}
+	return nil
+}
+
+// skipPhase returns true if phase was completed before the deployment was checkpointed.
+func (s *kfctlServer) skipPhase(phase DeploymentPhase) bool {
+	if s.resumePhase == "" {
+		return false
+	}
+	for _, p := range phaseOrder {
+		if p == s.resumePhase {
+			return false
+		}
+		if p == phase {
+			log.Infof("Skipping phase %v; resuming from %v", phase, s.resumePhase)
+			return true
+		}
+	}
+	return false
+}
+
+// loadCheckpoint restores the deployment interrupted by the last shutdown if there is one.
+// The deployment resumes from the checkpointed phase when the request is resubmitted since
+// the access token isn't persisted.
+func (s *kfctlServer) loadCheckpoint() {
+	file := path.Join(s.appsDir, checkpointFile)
+	buf, err := stateKeys.readFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read checkpoint %v; error %v", file, err)
+		}
+		return
+	}
+
+	cp := &deploymentCheckpoint{}
+	if err := json.Unmarshal(buf, cp); err != nil {
+		log.Warnf("Could not parse checkpoint %v; ignoring it; error %v", file, err)
+		return
+	}
+
+	log.Infof("Deployment %v was interrupted before phase %v; it will resume when resubmitted", cp.Request.Name, cp.Phase)
+	s.resumePhase = cp.Phase
+	s.latestKfDef = cp.Request
+	s.latestKfDef.Status.Conditions = append(s.latestKfDef.Status.Conditions, kfdefsv3.KfDefCondition{
+		Type:               kfdefsv3.KfDeploying,
+		Status:             v1.ConditionFalse,
+		Reason:             DeploymentInterruptedReason,
+		Message:            fmt.Sprintf("The deployment was interrupted before phase %v; resubmit it to resume.", cp.Phase),
+		LastUpdateTime:     metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// clearCheckpoint removes the checkpoint once the resumed deployment finished.
+func (s *kfctlServer) clearCheckpoint() {
+	s.resumePhase = ""
+	if err := os.Remove(path.Join(s.appsDir, checkpointFile)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Could not remove checkpoint; %v", err)
+	}
+}
+
+// startHandling marks the server busy with a request taken off the queue. It returns false if the
+// server is draining; the request must then be checkpointed with checkpointQueued rather than started.
+// Checking and marking the server busy under the same lock as Drain ensures Drain waits for it.
+func (s *kfctlServer) startHandling() bool {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.busy = true
+	s.publishStatus()
+	return s.serverStatus != StatusFrozen
+}
+
+// checkpointQueued checkpoints r, a request taken off the queue once the server started draining,
+// before its first phase that hasn't run so it resumes when it is resubmitted.
+func (s *kfctlServer) checkpointQueued(r kfdefsv3.KfDef) {
+	next := PhaseGenerate
+	if s.resumePhase != "" {
+		next = s.resumePhase
+	}
+	log.Infof("Server is draining; checkpointing queued deployment %v before phase %v", r.Name, next)
+	if err := s.writeCheckpoint(r, next); err != nil {
+		s.failQueued(r, errors.Wrap(err, "could not checkpoint the request queued when the server shut down"))
+	}
+}
+
+// drainQueue accounts for the requests still queued once the server stopped handling requests
+// because it is draining, then signals Drain. Queued requests were acknowledged so they can't be
+// dropped silently. Unless a deployment was already checkpointed the first one is checkpointed;
+// there is a single checkpoint so the others are reported as failed.
+func (s *kfctlServer) drainQueue(checkpointed bool) {
+	defer s.setBusy(false)
+	for {
+		select {
+		case r := <-s.c:
+			if !checkpointed {
+				s.checkpointQueued(r)
+				checkpointed = true
+				continue
+			}
+			s.failQueued(r, errors.New("the server shut down before the request was started; resubmit it"))
+		default:
+			return
+		}
+	}
+}
+
+// failQueued records that the queued request r was dropped because the server shut down.
+func (s *kfctlServer) failQueued(r kfdefsv3.KfDef, err error) {
+	log.Errorf("Dropping queued request for %v; %v", r.Name, err)
+	s.errHistory.record(r.Name, PhasePending, err)
+	s.config.notify(DeploymentEvent{
+		Name:    r.Name,
+		Project: r.Spec.Project,
+		Phase:   PhaseFailed,
+		Time:    time.Now(),
+		Error:   err.Error(),
+	})
+}
+
+// Drain stops accepting new deployments and waits up to timeout for the in-flight
+// deployment, or the queued requests, to be checkpointed.
+func (s *kfctlServer) Drain(timeout time.Duration) error {
+	s.kfDefMux.Lock()
+	s.serverStatus = StatusFrozen
+	busy := s.busy || len(s.c) > 0
+	// A deployment held because it is paused is checkpointed; it stays paused after the restart.
+	s.releasePause()
+	s.kfDefMux.Unlock()
+
+	if !busy {
+		log.Infof("No deployment in flight; nothing to drain")
+		return nil
+	}
+
+	log.Infof("Waiting up to %v for the in-flight deployment to reach a phase boundary", timeout)
+	select {
+	case <-s.idle:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %v waiting for the in-flight deployment", timeout)
+	}
+}
+
+// drainingError is returned to requests received while the server is draining.
+func drainingError() error {
+	return &httpError{
+		Message: "The server is shutting down; please retry your request shortly.",
+		Code:    http.StatusServiceUnavailable,
+	}
+}
+
+// DrainOnSignal drains the server and exits when the process receives SIGTERM or SIGINT.
+// The drain timeout is read from the config when the signal is received.
+func (s *kfctlServer) DrainOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		sig := <-c
+		log.Infof("Received %v; draining", sig)
+		if err := s.Drain(s.config.get().DrainTimeout.Duration); err != nil {
+			log.Errorf("Drain failed; the deployment may be left partially applied; %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
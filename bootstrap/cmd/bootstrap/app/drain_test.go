@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKfctlServer_DrainAndResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drain")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewKfctlServer(dir)
+	if err != nil {
+		t.Fatalf("Could not create server; %v", err)
+	}
+
+	req := kfdefsv3.KfDef{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kf-app",
+		},
+		Spec: kfdefsv3.KfDefSpec{
+			Project: "acme",
+			Zone:    "us-east1-d",
+		},
+	}
+
+	if err := s.atPhaseBoundary(req, PhaseApplyPlatform); err != nil {
+		t.Fatalf("atPhaseBoundary should be a no op when the server isn't draining; got %v", err)
+	}
+
+	if err := s.Drain(time.Second); err != nil {
+		t.Fatalf("Drain of an idle server failed; %v", err)
+	}
+
+	_, err = s.CreateDeployment(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("CreateDeployment while draining: want 503; got %v", err)
+	}
+
+	if err := s.atPhaseBoundary(req, PhaseApplyK8s); err != errDrained {
+		t.Fatalf("atPhaseBoundary while draining: want errDrained; got %v", err)
+	}
+
+	// Simulate the server restarting.
+	resumed, err := NewKfctlServer(dir)
+	if err != nil {
+		t.Fatalf("Could not create server; %v", err)
+	}
+
+	if resumed.resumePhase != PhaseApplyK8s {
+		t.Errorf("Got resume phase %v; want %v", resumed.resumePhase, PhaseApplyK8s)
+	}
+
+	latest, _ := resumed.GetLatestKfdef(req)
+	if !isMatch(latest, &req) {
+		t.Errorf("Latest KfDef %v doesn't match the checkpointed request", PrettyPrint(latest))
+	}
+
+	for _, p := range []DeploymentPhase{PhaseGenerate, PhaseApplyPlatform} {
+		if !resumed.skipPhase(p) {
+			t.Errorf("Phase %v should be skipped", p)
+		}
+	}
+
+	if resumed.skipPhase(PhaseApplyK8s) {
+		t.Errorf("Phase %v shouldn't be skipped", PhaseApplyK8s)
+	}
+
+	resumed.clearCheckpoint()
+	if resumed.skipPhase(PhaseGenerate) {
+		t.Errorf("No phases should be skipped after the checkpoint is cleared")
+	}
+}
+
+func TestKfctlServer_DrainQueued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drain")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewKfctlServer(dir)
+	if err != nil {
+		t.Fatalf("Could not create server; %v", err)
+	}
+
+	req := newPlanTestKfDef()
+	update := newPlanTestKfDef()
+	update.Spec.Zone = "us-west1-b"
+
+	// The requests were acknowledged before the server started draining.
+	s.kfDefMux.Lock()
+	s.serverStatus = StatusFrozen
+	s.c <- req
+	s.c <- update
+	s.kfDefMux.Unlock()
+
+	if err := s.Drain(time.Second); err != nil {
+		t.Fatalf("Drain failed; %v", err)
+	}
+	if len(s.c) != 0 {
+		t.Errorf("%v requests are still queued after the drain", len(s.c))
+	}
+	if errs := s.errHistory.get(update.Name).Errors; len(errs) != 1 {
+		t.Errorf("Got errors %v; want the request that wasn't checkpointed reported", PrettyPrint(errs))
+	}
+
+	// Simulate the server restarting.
+	resumed, err := NewKfctlServer(dir)
+	if err != nil {
+		t.Fatalf("Could not create server; %v", err)
+	}
+	if resumed.resumePhase != PhaseGenerate {
+		t.Errorf("Got resume phase %v; want %v", resumed.resumePhase, PhaseGenerate)
+	}
+	if latest, _ := resumed.GetLatestKfdef(req); latest.Spec.Zone != req.Spec.Zone {
+		t.Errorf("Latest KfDef %v doesn't match the queued request", PrettyPrint(latest))
+	}
+}
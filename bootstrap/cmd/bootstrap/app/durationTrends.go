@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// KfctlDurationTrendsPath is the path on which to serve deployment duration trend requests
+const KfctlDurationTrendsPath = "/kfctl/apps/v1alpha2/stats/durations"
+
+// defaultTrendsWindow is the window trends are computed over if the request doesn't set one.
+const defaultTrendsWindow = 30 * 24 * time.Hour
+
+// defaultTrendsInterval is the width of a bucket if the request doesn't set one.
+const defaultTrendsInterval = 24 * time.Hour
+
+// maxTrendBuckets bounds the number of buckets a request can ask for.
+const maxTrendBuckets = 1000
+
+// DurationTrendsRequest asks for the percentiles of the durations of the deployments in a project over time.
+type DurationTrendsRequest struct {
+	// KfDef provides the project and the credentials; the name is ignored.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// Window is how far back to compute the trends over; defaults to 30 days.
+	Window metav1.Duration `json:"window,omitempty"`
+	// Interval is the width of each bucket; defaults to a day.
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+// DurationPercentiles are percentiles of a set of durations.
+type DurationPercentiles struct {
+	P50 metav1.Duration `json:"p50"`
+	P90 metav1.Duration `json:"p90"`
+	P99 metav1.Duration `json:"p99"`
+}
+
+// DurationTrendBucket summarizes the durations of the successful runs started within an interval.
+type DurationTrendBucket struct {
+	Start time.Time `json:"start"`
+	// Runs is the number of successful runs; the percentiles are zero if there were none.
+	Runs int `json:"runs"`
+	// Total are the percentiles of the durations of the runs.
+	Total DurationPercentiles `json:"total"`
+	// Phases are the percentiles of the time spent in each phase of the pipeline.
+	Phases map[DeploymentPhase]DurationPercentiles `json:"phases"`
+}
+
+// DurationTrends are the percentiles of the durations of deployments bucketed by the time they started,
+// oldest first. A manifests change which makes deployments slower shows up as a step in the percentiles.
+type DurationTrends struct {
+	Project  string                `json:"project"`
+	Since    time.Time             `json:"since"`
+	Interval metav1.Duration       `json:"interval"`
+	Buckets  []DurationTrendBucket `json:"buckets"`
+	// Unavailable is the number of kfctl servers that couldn't be queried; their runs aren't included.
+	Unavailable int `json:"unavailable,omitempty"`
+	// Runs are the runs the trends are computed from. Only kfctl servers report them.
+	Runs []DeploymentRun `json:"runs,omitempty"`
+}
+
+// trendsWindow returns the window and interval of the request.
+func trendsWindow(req DurationTrendsRequest) (time.Duration, time.Duration, error) {
+	window := req.Window.Duration
+	if window <= 0 {
+		window = defaultTrendsWindow
+	}
+	interval := req.Interval.Duration
+	if interval <= 0 {
+		interval = defaultTrendsInterval
+	}
+	if window/interval > maxTrendBuckets {
+		return 0, 0, &httpError{
+			Message: fmt.Sprintf("window %v would have more than %v buckets of %v", window, maxTrendBuckets, interval),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return window, interval, nil
+}
+
+// percentiles returns the nearest rank percentiles of durations which must be sorted.
+func percentiles(durations []time.Duration) DurationPercentiles {
+	rank := func(p float64) metav1.Duration {
+		i := int(math.Ceil(p*float64(len(durations)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return metav1.Duration{Duration: durations[i]}
+	}
+	return DurationPercentiles{
+		P50: rank(0.5),
+		P90: rank(0.9),
+		P99: rank(0.99),
+	}
+}
+
+// computeDurationTrends buckets the successful runs started between since and until by interval
+// and computes the percentiles of their durations. Failed and canceled runs are excluded since
+// they stop early.
+func computeDurationTrends(project string, since time.Time, until time.Time, interval time.Duration, runs []DeploymentRun) *DurationTrends {
+	trends := &DurationTrends{
+		Project:  project,
+		Since:    since,
+		Interval: metav1.Duration{Duration: interval},
+		Buckets:  []DurationTrendBucket{},
+	}
+
+	n := int((until.Sub(since) + interval - 1) / interval)
+	totals := make([][]time.Duration, n)
+	phases := make([]map[DeploymentPhase][]time.Duration, n)
+	for _, r := range runs {
+		if r.Status != RunSucceeded || r.End == nil || r.Start.Before(since) || !r.Start.Before(until) {
+			continue
+		}
+		i := int(r.Start.Sub(since) / interval)
+		totals[i] = append(totals[i], r.End.Sub(r.Start))
+		if phases[i] == nil {
+			phases[i] = map[DeploymentPhase][]time.Duration{}
+		}
+		for p, d := range r.PhaseDurations {
+			phases[i][p] = append(phases[i][p], d.Duration)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		b := DurationTrendBucket{
+			Start:  since.Add(time.Duration(i) * interval),
+			Runs:   len(totals[i]),
+			Phases: map[DeploymentPhase]DurationPercentiles{},
+		}
+		if len(totals[i]) > 0 {
+			sort.Slice(totals[i], func(x, y int) bool { return totals[i][x] < totals[i][y] })
+			b.Total = percentiles(totals[i])
+		}
+		for p, durations := range phases[i] {
+			sort.Slice(durations, func(x, y int) bool { return durations[x] < durations[y] })
+			b.Phases[p] = percentiles(durations)
+		}
+		trends.Buckets = append(trends.Buckets, b)
+	}
+	return trends
+}
+
+// makeDurationTrendsEndpoint creates an endpoint to handle deployment duration trend requests.
+func makeDurationTrendsEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(DurationTrendsRequest)
+		return svc.GetDurationTrends(ctx, req)
+	}
+}
+
+// decodeHTTPDurationTrendsRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded DurationTrendsRequest from the HTTP request body.
+func decodeHTTPDurationTrendsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request DurationTrendsRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding duration trends request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
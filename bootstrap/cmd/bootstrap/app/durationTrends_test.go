@@ -0,0 +1,139 @@
+package app
+
+import (
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRunHistory_PhaseDurations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runHistory")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+
+	file := path.Join(dir, runHistoryFile)
+	h := newRunHistory(file, 10)
+	h.now = func() time.Time { return now }
+
+	// Phases entered outside a run aren't recorded.
+	h.enterPhase(PhaseDelete)
+
+	h.begin("kf-app")
+	h.enterPhase(PhaseGenerate)
+	now = now.Add(time.Minute)
+	h.enterPhase(PhaseApplyPlatform)
+	now = now.Add(10 * time.Minute)
+	h.enterPhase(PhaseApplyK8s)
+	now = now.Add(5 * time.Minute)
+
+	runs := h.list(start)
+	if len(runs) != 1 || len(runs[0].PhaseDurations) != 2 {
+		t.Fatalf("Got runs %v; want the current run with 2 completed phases", PrettyPrint(runs))
+	}
+
+	h.finish(PhaseDone, nil)
+
+	// Reload from the file to verify the durations are persisted.
+	reloaded := newRunHistory(file, 10)
+	runs = reloaded.list(start)
+	if len(runs) != 1 {
+		t.Fatalf("Got %v runs; want 1", len(runs))
+	}
+	expected := map[DeploymentPhase]time.Duration{
+		PhaseGenerate:      time.Minute,
+		PhaseApplyPlatform: 10 * time.Minute,
+		PhaseApplyK8s:      5 * time.Minute,
+	}
+	if len(runs[0].PhaseDurations) != len(expected) {
+		t.Errorf("Got phase durations %v; want %v", runs[0].PhaseDurations, expected)
+	}
+	for p, d := range expected {
+		if runs[0].PhaseDurations[p].Duration != d {
+			t.Errorf("Phase %v: got %v; want %v", p, runs[0].PhaseDurations[p].Duration, d)
+		}
+	}
+}
+
+func TestComputeDurationTrends(t *testing.T) {
+	since := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(48 * time.Hour)
+
+	run := func(startOffset time.Duration, minutes int, status RunStatus) DeploymentRun {
+		r := DeploymentRun{
+			Name:   "kf-app",
+			Start:  since.Add(startOffset),
+			Status: status,
+			PhaseDurations: map[DeploymentPhase]metav1.Duration{
+				PhaseApplyPlatform: {Duration: time.Duration(minutes-1) * time.Minute},
+				PhaseGenerate:      {Duration: time.Minute},
+			},
+		}
+		end := r.Start.Add(time.Duration(minutes) * time.Minute)
+		r.End = &end
+		return r
+	}
+
+	runs := []DeploymentRun{
+		// Before the window.
+		run(-time.Hour, 100, RunSucceeded),
+		run(time.Hour, 10, RunSucceeded),
+		run(2*time.Hour, 20, RunSucceeded),
+		run(3*time.Hour, 15, RunSucceeded),
+		// Failed runs stop early so they are excluded.
+		run(4*time.Hour, 2, RunFailed),
+		// A change on the second day made the deployments slower.
+		run(25*time.Hour, 40, RunSucceeded),
+		run(26*time.Hour, 50, RunSucceeded),
+	}
+
+	trends := computeDurationTrends("acme", since, until, 24*time.Hour, runs)
+	if len(trends.Buckets) != 2 {
+		t.Fatalf("Got %v buckets; want 2", len(trends.Buckets))
+	}
+
+	first, second := trends.Buckets[0], trends.Buckets[1]
+	if first.Runs != 3 || second.Runs != 2 {
+		t.Errorf("Got runs %v, %v; want 3, 2", first.Runs, second.Runs)
+	}
+	if first.Total.P50.Duration != 15*time.Minute || first.Total.P90.Duration != 20*time.Minute {
+		t.Errorf("First bucket: got %v", PrettyPrint(first.Total))
+	}
+	if second.Total.P50.Duration != 40*time.Minute || second.Total.P99.Duration != 50*time.Minute {
+		t.Errorf("Second bucket: got %v", PrettyPrint(second.Total))
+	}
+	if p := second.Phases[PhaseApplyPlatform]; p.P50.Duration != 39*time.Minute {
+		t.Errorf("Second bucket %v: got %v; want a median of 39m", PhaseApplyPlatform, PrettyPrint(p))
+	}
+	if !second.Start.Equal(since.Add(24 * time.Hour)) {
+		t.Errorf("Second bucket: got start %v", second.Start)
+	}
+
+	empty := computeDurationTrends("acme", since, until, time.Hour, nil)
+	if len(empty.Buckets) != 48 || empty.Buckets[0].Runs != 0 || empty.Buckets[0].Total.P50.Duration != 0 {
+		t.Errorf("Got %v buckets; want 48 empty buckets", len(empty.Buckets))
+	}
+}
+
+func TestTrendsWindow(t *testing.T) {
+	window, interval, err := trendsWindow(DurationTrendsRequest{})
+	if err != nil || window != defaultTrendsWindow || interval != defaultTrendsInterval {
+		t.Errorf("trendsWindow of an empty request: got %v, %v, %v", window, interval, err)
+	}
+
+	_, _, err = trendsWindow(DurationTrendsRequest{
+		Window:   metav1.Duration{Duration: 30 * 24 * time.Hour},
+		Interval: metav1.Duration{Duration: time.Minute},
+	})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("trendsWindow with too many buckets: got %v; want bad request", err)
+	}
+}
@@ -0,0 +1,496 @@
+package app
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// KfctlReencryptPath is the path on which to serve requests to re-encrypt the state stored for the deployment
+const KfctlReencryptPath = "/kfctl/apps/v1alpha2/reencrypt"
+
+// sealedStateKind identifies the files of the apps directory encrypted by stateEncryption.
+const sealedStateKind = "SealedState"
+
+// dataKeyLifetime is how long a data key encrypts the state before a new one is generated.
+const dataKeyLifetime = 24 * time.Hour
+
+// kmsKeyPattern matches the name of a Cloud KMS key.
+var kmsKeyPattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// encryptedStateFiles are the files of the apps directory recording the deployment; they are
+// encrypted when a StateEncryptionKey is configured. The app.yaml of the app directory of the
+// deployment is encrypted too; see stateFiles.
+var encryptedStateFiles = []string{
+	checkpointFile,
+	statusSnapshotFile,
+	errorHistoryFile,
+	runLogFile,
+	runHistoryFile,
+	revisionHistoryFile,
+	telemetrySpoolFile,
+	metadataFile,
+}
+
+// sealedState is a file of the apps directory encrypted with a data key. The data key is stored
+// wrapped by the Cloud KMS key so only callers allowed to use the KMS key can read the state.
+type sealedState struct {
+	Kind string `json:"kind"`
+	// KmsKey is the Cloud KMS key which wrapped the data key.
+	KmsKey     string `json:"kmsKey"`
+	WrappedKey []byte `json:"wrappedKey"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// keyWrapper wraps and unwraps data keys with a KMS key.
+type keyWrapper interface {
+	wrapKey(ctx context.Context, kmsKey string, key []byte) ([]byte, error)
+	unwrapKey(ctx context.Context, kmsKey string, wrapped []byte) ([]byte, error)
+}
+
+// kmsKeyWrapper wraps data keys with Cloud KMS using the credentials of the server. Cloud KMS
+// decrypts with the key version which encrypted so rotating the KMS key doesn't break reads.
+type kmsKeyWrapper struct {
+	service *cloudkms.Service
+}
+
+func newKmsKeyWrapper() (keyWrapper, error) {
+	ctx := context.Background()
+	ts, err := NewDefaultTokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := cloudkms.NewService(ctx, option.WithTokenSource(ts))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &kmsKeyWrapper{service: s}, nil
+}
+
+func (w *kmsKeyWrapper) wrapKey(ctx context.Context, kmsKey string, key []byte) ([]byte, error) {
+	r, err := w.service.Projects.Locations.KeyRings.CryptoKeys.Encrypt(kmsKey, &cloudkms.EncryptRequest{
+		Plaintext: base64.StdEncoding.EncodeToString(key),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not wrap the data key with %v", kmsKey)
+	}
+	return base64.StdEncoding.DecodeString(r.Ciphertext)
+}
+
+func (w *kmsKeyWrapper) unwrapKey(ctx context.Context, kmsKey string, wrapped []byte) ([]byte, error) {
+	r, err := w.service.Projects.Locations.KeyRings.CryptoKeys.Decrypt(kmsKey, &cloudkms.DecryptRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(wrapped),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not unwrap the data key with %v", kmsKey)
+	}
+	return base64.StdEncoding.DecodeString(r.Plaintext)
+}
+
+// dataKey is the key the state is currently encrypted with.
+type dataKey struct {
+	kmsKey  string
+	key     []byte
+	wrapped []byte
+	created time.Time
+}
+
+// stateEncryption is the envelope encryption of the files of the apps directory recording KfDefs.
+// A data key is generated and wrapped by the KMS key once a day rather than for every write so
+// the status can be published without a KMS call; each file is sealed with a new nonce.
+type stateEncryption struct {
+	mu sync.Mutex
+	// kmsKey is the configured Cloud KMS key; the state is written in plain text if it is empty.
+	kmsKey string
+	// newWrapper creates the wrapper the first time a key is wrapped or unwrapped.
+	newWrapper func() (keyWrapper, error)
+	wrapper    keyWrapper
+	current    *dataKey
+	// unwrapped caches the data keys unwrapped to read the state by KMS key and wrapped key.
+	unwrapped map[string][]byte
+}
+
+// stateKeys encrypts the state stored by the server; its key is set from the ServerConfig.
+var stateKeys = newStateEncryption(newKmsKeyWrapper)
+
+func newStateEncryption(newWrapper func() (keyWrapper, error)) *stateEncryption {
+	return &stateEncryption{
+		newWrapper: newWrapper,
+		unwrapped:  map[string][]byte{},
+	}
+}
+
+// setKey sets the KMS key the state is encrypted with; changing it starts a new data key.
+func (e *stateEncryption) setKey(kmsKey string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if kmsKey != e.kmsKey {
+		e.kmsKey = kmsKey
+		e.current = nil
+	}
+}
+
+// key returns the configured KMS key.
+func (e *stateEncryption) key() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.kmsKey
+}
+
+// rotate makes the next seal generate a new data key.
+func (e *stateEncryption) rotate() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.current = nil
+}
+
+// getWrapper returns the keyWrapper creating it if needed.
+func (e *stateEncryption) getWrapper() (keyWrapper, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.wrapper == nil {
+		w, err := e.newWrapper()
+		if err != nil {
+			return nil, err
+		}
+		e.wrapper = w
+	}
+	return e.wrapper, nil
+}
+
+// dataKey returns the data key to seal with or nil if no KMS key is configured. A new data key is
+// generated and wrapped if the KMS key changed or the current one expired; e.mu isn't held during
+// the KMS call so it doesn't block the state being read and written meanwhile.
+func (e *stateEncryption) dataKey() (*dataKey, error) {
+	e.mu.Lock()
+	kmsKey := e.kmsKey
+	current := e.current
+	e.mu.Unlock()
+	if kmsKey == "" {
+		return nil, nil
+	}
+	if current != nil && time.Since(current.created) < dataKeyLifetime {
+		return current, nil
+	}
+
+	w, err := e.getWrapper()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	wrapped, err := w.wrapKey(context.Background(), kmsKey, key)
+	if err != nil {
+		return nil, err
+	}
+	k := &dataKey{
+		kmsKey:  kmsKey,
+		key:     key,
+		wrapped: wrapped,
+		created: time.Now(),
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.unwrapped[kmsKey+"/"+string(wrapped)] = key
+	// The KMS key may have changed or the data key rotated while the key was wrapped.
+	if e.kmsKey == kmsKey && e.current == current {
+		e.current = k
+		log.Infof("Encrypting the stored state with a new data key wrapped by %v", kmsKey)
+	}
+	return k, nil
+}
+
+// seal encrypts buf with the current data key; buf is returned unchanged if no KMS key is configured.
+func (e *stateEncryption) seal(buf []byte) ([]byte, error) {
+	k, err := e.dataKey()
+	if err != nil || k == nil {
+		return buf, err
+	}
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sealed, err := json.Marshal(sealedState{
+		Kind:       sealedStateKind,
+		KmsKey:     k.kmsKey,
+		WrappedKey: k.wrapped,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, buf, []byte(k.kmsKey)),
+	})
+	return sealed, errors.WithStack(err)
+}
+
+// open decrypts buf if it was sealed; plain text state written before encryption was enabled is
+// returned unchanged. State sealed with a KMS key which is no longer configured can still be read.
+func (e *stateEncryption) open(buf []byte) ([]byte, error) {
+	s, ok := parseSealedState(buf)
+	if !ok {
+		return buf, nil
+	}
+
+	cacheKey := s.KmsKey + "/" + string(s.WrappedKey)
+	e.mu.Lock()
+	key, ok := e.unwrapped[cacheKey]
+	e.mu.Unlock()
+	if !ok {
+		w, err := e.getWrapper()
+		if err != nil {
+			return nil, err
+		}
+		if key, err = w.unwrapKey(context.Background(), s.KmsKey, s.WrappedKey); err != nil {
+			return nil, err
+		}
+		e.mu.Lock()
+		e.unwrapped[cacheKey] = key
+		e.mu.Unlock()
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, s.Nonce, s.Ciphertext, []byte(s.KmsKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decrypt state encrypted with %v", s.KmsKey)
+	}
+	return plain, nil
+}
+
+// Seal implements kfdefs.ConfigSealer so app.yaml is encrypted like the other state.
+func (e *stateEncryption) Seal(buf []byte) ([]byte, error) {
+	return e.seal(buf)
+}
+
+// Open implements kfdefs.ConfigSealer.
+func (e *stateEncryption) Open(buf []byte) ([]byte, error) {
+	return e.open(buf)
+}
+
+// readFile returns the content of the state file decrypting it if it was sealed. The error of
+// reading the file is returned unchanged so callers can check os.IsNotExist.
+func (e *stateEncryption) readFile(file string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return e.open(buf)
+}
+
+// writeFile seals buf and replaces the state file with it using writeFileAtomic.
+func (e *stateEncryption) writeFile(file string, buf []byte) error {
+	sealed, err := e.seal(buf)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, sealed)
+}
+
+// stateFiles returns the files of dir which are encrypted relative to dir.
+func stateFiles(dir string) ([]string, error) {
+	configs, err := filepath.Glob(path.Join(dir, "*", kftypes.KfConfigFile))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	files := append([]string{}, encryptedStateFiles...)
+	for _, c := range configs {
+		rel, err := filepath.Rel(dir, c)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		files = append(files, rel)
+	}
+	return files, nil
+}
+
+// parseSealedState returns the sealedState in buf if it is one.
+func parseSealedState(buf []byte) (*sealedState, bool) {
+	s := &sealedState{}
+	if err := json.Unmarshal(buf, s); err != nil || s.Kind != sealedStateKind {
+		return nil, false
+	}
+	return s, true
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	return gcm, errors.WithStack(err)
+}
+
+// ReencryptionRequest re-encrypts the state stored for a deployment with the configured key.
+type ReencryptionRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// DryRun reports the files which would be re-encrypted without changing them.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// ReencryptedFile is a file of the stored state which was or would be re-encrypted.
+type ReencryptedFile struct {
+	File string `json:"file"`
+	// FromKey is the KMS key the file was encrypted with; empty if it was in plain text.
+	FromKey string `json:"fromKey,omitempty"`
+	// ToKey is the KMS key the file is encrypted with; empty if it is written in plain text.
+	ToKey string `json:"toKey,omitempty"`
+}
+
+// ReencryptionReport describes the re-encryption of the state stored for a deployment.
+type ReencryptionReport struct {
+	Name   string            `json:"name"`
+	DryRun bool              `json:"dryRun,omitempty"`
+	Files  []ReencryptedFile `json:"files"`
+}
+
+// reencryptState encrypts the state files in dir with a new data key wrapped by the configured KMS
+// key, or writes them in plain text if no key is configured. Files are replaced atomically.
+func reencryptState(dir string, e *stateEncryption, dryRun bool) ([]ReencryptedFile, error) {
+	if !dryRun {
+		e.rotate()
+	}
+	names, err := stateFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []ReencryptedFile{}
+	for _, name := range names {
+		file := path.Join(dir, name)
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return files, errors.WithStack(err)
+		}
+		f := ReencryptedFile{File: name, ToKey: e.key()}
+		if s, ok := parseSealedState(buf); ok {
+			f.FromKey = s.KmsKey
+		}
+		files = append(files, f)
+		if dryRun {
+			continue
+		}
+
+		plain, err := e.open(buf)
+		if err != nil {
+			return files, err
+		}
+		if err := e.writeFile(file, plain); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// Reencrypt re-encrypts the state stored for the deployment with a new data key wrapped by the
+// configured KMS key e.g. after the KMS key was rotated or changed. The status and the run are
+// held so no state is written while the files are replaced.
+func (s *kfctlServer) Reencrypt(ctx context.Context, req ReencryptionRequest) (*ReencryptionReport, error) {
+	if err := s.checkDeploymentRequest(req.KfDef); err != nil {
+		return nil, err
+	}
+	if s.standby {
+		return nil, &httpError{
+			Message: "Standby replicas can't re-encrypt the state; send the request to the leader",
+			Code:    http.StatusConflict,
+		}
+	}
+
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+
+	files, err := reencryptState(s.appsDir, stateKeys, req.DryRun)
+	if err != nil {
+		log.Errorf("Could not re-encrypt the state of deployment %v; %v", req.KfDef.Name, err)
+		return nil, &httpError{
+			Message: fmt.Sprintf("Could not re-encrypt the state of deployment %v: %v", req.KfDef.Name, err),
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	return &ReencryptionReport{
+		Name:   req.KfDef.Name,
+		DryRun: req.DryRun,
+		Files:  files,
+	}, nil
+}
+
+// Reencrypt forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) Reencrypt(ctx context.Context, req ReencryptionRequest) (*ReencryptionReport, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.Reencrypt(ctx, req)
+}
+
+// Reencrypt re-encrypts the state stored for the deployment with the key configured on the server;
+// with DryRun it only reports the files which would be re-encrypted.
+func (c *KfctlClient) Reencrypt(ctx context.Context, req ReencryptionRequest) (*ReencryptionReport, error) {
+	resp, err := c.reencryptEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*ReencryptionReport)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeReencryptEndpoint creates an endpoint to handle requests to re-encrypt the state of the deployment.
+func makeReencryptEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ReencryptionRequest)
+		return svc.Reencrypt(ctx, req)
+	}
+}
+
+// decodeHTTPReencryptionRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded ReencryptionRequest from the HTTP request body.
+func decodeHTTPReencryptionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request ReencryptionRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding re-encryption request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,231 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// fakeKeyWrapper wraps keys by prefixing them with the name of the KMS key.
+type fakeKeyWrapper struct {
+	wraps   int
+	unwraps int
+}
+
+func (w *fakeKeyWrapper) wrapKey(ctx context.Context, kmsKey string, key []byte) ([]byte, error) {
+	w.wraps++
+	return append([]byte(kmsKey+":"), key...), nil
+}
+
+func (w *fakeKeyWrapper) unwrapKey(ctx context.Context, kmsKey string, wrapped []byte) ([]byte, error) {
+	w.unwraps++
+	if !bytes.HasPrefix(wrapped, []byte(kmsKey+":")) {
+		return nil, fmt.Errorf("key wasn't wrapped by %v", kmsKey)
+	}
+	return wrapped[len(kmsKey)+1:], nil
+}
+
+func newTestStateEncryption(w *fakeKeyWrapper) *stateEncryption {
+	return newStateEncryption(func() (keyWrapper, error) { return w, nil })
+}
+
+const testKmsKey = "projects/p/locations/global/keyRings/kfctl/cryptoKeys/state"
+
+func TestStateEncryption(t *testing.T) {
+	w := &fakeKeyWrapper{}
+	e := newTestStateEncryption(w)
+	state := []byte(`{"request": {"metadata": {"name": "kf-app"}}}`)
+
+	if buf, err := e.seal(state); err != nil || !bytes.Equal(buf, state) {
+		t.Errorf("seal without a key: got %s, %v; want the state unchanged", buf, err)
+	}
+
+	e.setKey(testKmsKey)
+	sealed, err := e.seal(state)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("kf-app")) {
+		t.Errorf("seal: the sealed state contains the plain text: %s", sealed)
+	}
+	if _, err := e.seal(state); err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if w.wraps != 1 {
+		t.Errorf("Wrapped %v data keys; want the data key reused", w.wraps)
+	}
+
+	// A restarted server unwraps the data key once.
+	restarted := newTestStateEncryption(w)
+	for i := 0; i < 2; i++ {
+		plain, err := restarted.open(sealed)
+		if err != nil || !bytes.Equal(plain, state) {
+			t.Errorf("open: got %s, %v; want the state", plain, err)
+		}
+	}
+	if w.unwraps != 1 {
+		t.Errorf("Unwrapped %v data keys; want 1", w.unwraps)
+	}
+
+	if plain, err := restarted.open(state); err != nil || !bytes.Equal(plain, state) {
+		t.Errorf("open of plain text: got %s, %v; want the state unchanged", plain, err)
+	}
+
+	tampered, _ := parseSealedState(sealed)
+	tampered.Ciphertext[0] ^= 0xff
+	buf, _ := json.Marshal(tampered)
+	if _, err := newTestStateEncryption(w).open(buf); err == nil {
+		t.Errorf("open of tampered state: got nil; want error")
+	}
+}
+
+func TestReencryptState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+	state := []byte(`{"phase": "ApplyK8s"}`)
+	if err := ioutil.WriteFile(path.Join(dir, checkpointFile), state, 0644); err != nil {
+		t.Fatalf("Could not write checkpoint; %v", err)
+	}
+	appFile := path.Join(dir, "kf-app", kftypes.KfConfigFile)
+	if err := os.MkdirAll(path.Dir(appFile), os.ModePerm); err != nil {
+		t.Fatalf("Could not create app directory; %v", err)
+	}
+	if err := ioutil.WriteFile(appFile, []byte("metadata:\n  name: kf-app\n"), 0644); err != nil {
+		t.Fatalf("Could not write app.yaml; %v", err)
+	}
+
+	w := &fakeKeyWrapper{}
+	e := newTestStateEncryption(w)
+	e.setKey(testKmsKey)
+
+	files, err := reencryptState(dir, e, true)
+	if err != nil || len(files) != 2 || files[0].FromKey != "" || files[0].ToKey != testKmsKey || files[1].File != path.Join("kf-app", kftypes.KfConfigFile) {
+		t.Errorf("reencryptState dry run: got %+v, %v", files, err)
+	}
+	if buf, _ := ioutil.ReadFile(path.Join(dir, checkpointFile)); !bytes.Equal(buf, state) {
+		t.Errorf("reencryptState dry run changed the checkpoint: %s", buf)
+	}
+
+	if _, err := reencryptState(dir, e, false); err != nil {
+		t.Fatalf("reencryptState: %v", err)
+	}
+	buf, _ := ioutil.ReadFile(path.Join(dir, checkpointFile))
+	if s, ok := parseSealedState(buf); !ok || s.KmsKey != testKmsKey {
+		t.Errorf("checkpoint after reencryptState: got %s; want it sealed with %v", buf, testKmsKey)
+	}
+	buf, _ = ioutil.ReadFile(appFile)
+	if _, ok := parseSealedState(buf); !ok {
+		t.Errorf("app.yaml after reencryptState: got %s; want it sealed", buf)
+	}
+	if info, err := os.Stat(appFile); err != nil {
+		t.Errorf("Could not stat app.yaml; %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("app.yaml after reencryptState: got mode %v; want 0600", info.Mode())
+	}
+
+	// Changing the key re-encrypts with a data key wrapped by the new key.
+	newKey := testKmsKey + "-2"
+	e.setKey(newKey)
+	files, err = reencryptState(dir, e, false)
+	if err != nil || len(files) != 2 || files[0].FromKey != testKmsKey || files[0].ToKey != newKey {
+		t.Errorf("reencryptState with a new key: got %+v, %v", files, err)
+	}
+	buf, _ = ioutil.ReadFile(path.Join(dir, checkpointFile))
+	if plain, err := newTestStateEncryption(w).open(buf); err != nil || !bytes.Equal(plain, state) {
+		t.Errorf("open after reencryptState: got %s, %v; want the state", plain, err)
+	}
+
+	// Removing the key stores the state in plain text.
+	e.setKey("")
+	if _, err := reencryptState(dir, e, false); err != nil {
+		t.Fatalf("reencryptState without a key: %v", err)
+	}
+	if buf, _ := ioutil.ReadFile(path.Join(dir, checkpointFile)); !bytes.Equal(buf, state) {
+		t.Errorf("checkpoint after removing the key: got %s; want plain text", buf)
+	}
+}
+
+// blockingKeyWrapper blocks wrapping keys until wrap is closed.
+type blockingKeyWrapper struct {
+	fakeKeyWrapper
+	wrapping chan struct{}
+	wrap     chan struct{}
+}
+
+func (w *blockingKeyWrapper) wrapKey(ctx context.Context, kmsKey string, key []byte) ([]byte, error) {
+	close(w.wrapping)
+	<-w.wrap
+	return w.fakeKeyWrapper.wrapKey(ctx, kmsKey, key)
+}
+
+func TestStateEncryption_SealDoesntHoldLockDuringKmsCall(t *testing.T) {
+	w := &blockingKeyWrapper{wrapping: make(chan struct{}), wrap: make(chan struct{})}
+	e := newStateEncryption(func() (keyWrapper, error) { return w, nil })
+	e.setKey(testKmsKey)
+
+	sealed := make(chan error)
+	go func() {
+		_, err := e.seal([]byte("state"))
+		sealed <- err
+	}()
+	<-w.wrapping
+
+	done := make(chan struct{})
+	go func() {
+		e.key()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("The state encryption was locked during the KMS call")
+	}
+
+	close(w.wrap)
+	if err := <-sealed; err != nil {
+		t.Errorf("seal: %v", err)
+	}
+}
+
+func TestStateEncryption_WriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, metadataFile)
+	if err := ioutil.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Could not write metadata; %v", err)
+	}
+
+	e := newTestStateEncryption(&fakeKeyWrapper{})
+	e.setKey(testKmsKey)
+	state := []byte(`{"description": "team"}`)
+	if err := e.writeFile(file, state); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	if info, err := os.Stat(file); err != nil {
+		t.Errorf("Could not stat %v; %v", file, err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("writeFile: got mode %v; want 0600", info.Mode())
+	}
+	if buf, _ := ioutil.ReadFile(file); bytes.Contains(buf, []byte("team")) {
+		t.Errorf("writeFile: the file contains the plain text: %s", buf)
+	}
+	if buf, err := e.readFile(file); err != nil || !bytes.Equal(buf, state) {
+		t.Errorf("readFile: got %s, %v; want the state", buf, err)
+	}
+	if _, err := e.readFile(path.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("readFile of a missing file: got %v; want not exist", err)
+	}
+}
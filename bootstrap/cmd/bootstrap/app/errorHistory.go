@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// KfctlErrorsPath is the path on which to serve error history requests
+const KfctlErrorsPath = "/kfctl/apps/v1alpha2/errors"
+
+// errorHistoryFile is the name of the file in the apps directory in which the history is persisted.
+const errorHistoryFile = ".error_history.json"
+
+// defaultMaxErrors is the number of errors retained per deployment.
+const defaultMaxErrors = 20
+
+// DeploymentError is a single failure encountered while handling a deployment.
+type DeploymentError struct {
+	// Phase is the pipeline phase in which the error occurred.
+	Phase DeploymentPhase `json:"phase"`
+	Time  time.Time       `json:"time"`
+	// Message is the message returned to the user.
+	Message string `json:"message"`
+	// Cause is the underlying error e.g. the error from a deployment manager operation.
+	Cause string `json:"cause,omitempty"`
+	// Code is the http status code returned to the user.
+	Code int `json:"code,omitempty"`
+	// ErrorCode and Remediation are set if the cause of the error is known.
+	ErrorCode   ErrorCode    `json:"errorCode,omitempty"`
+	Remediation *Remediation `json:"remediation,omitempty"`
+}
+
+// ErrorHistory is the list of the most recent errors for a deployment; oldest first.
+type ErrorHistory struct {
+	Name   string            `json:"name"`
+	Errors []DeploymentError `json:"errors"`
+}
+
+// errorHistory keeps the last maxErrors errors for each deployment and persists them to a file.
+type errorHistory struct {
+	mu        sync.Mutex
+	file      string
+	maxErrors int
+	errors    map[string][]DeploymentError
+}
+
+// newErrorHistory creates an errorHistory persisted in file.
+// If file exists the history is loaded from it.
+func newErrorHistory(file string, maxErrors int) *errorHistory {
+	h := &errorHistory{
+		file:      file,
+		maxErrors: maxErrors,
+		errors:    map[string][]DeploymentError{},
+	}
+	h.load()
+	return h
+}
+
+// load replaces the history with the one persisted in file e.g. by the leader of a standby
+// replica. The history is kept if file can't be read.
+func (h *errorHistory) load() {
+	if h.file == "" {
+		return
+	}
+
+	buf, err := stateKeys.readFile(h.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read error history %v; error %v", h.file, err)
+		}
+		return
+	}
+
+	errs := map[string][]DeploymentError{}
+	if err := json.Unmarshal(buf, &errs); err != nil {
+		log.Warnf("Could not parse error history %v; error %v", h.file, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.errors = errs
+}
+
+// record adds an error for the named deployment evicting the oldest error if necessary.
+func (h *errorHistory) record(name string, phase DeploymentPhase, err error) {
+	e := DeploymentError{
+		Phase:   phase,
+		Time:    time.Now(),
+		Message: err.Error(),
+	}
+
+	if hErr, ok := err.(*httpError); ok {
+		e.Code = hErr.Code
+		e.ErrorCode = hErr.ErrorCode
+		e.Remediation = hErr.Remediation
+		if hErr.cause != nil {
+			e.Cause = hErr.cause.Error()
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	errs := append(h.errors[name], e)
+	if len(errs) > h.maxErrors {
+		errs = errs[len(errs)-h.maxErrors:]
+	}
+	h.errors[name] = errs
+
+	if err := h.save(); err != nil {
+		log.Errorf("Could not persist error history; %v", err)
+	}
+}
+
+// get returns a copy of the history for the named deployment.
+func (h *errorHistory) get(name string) *ErrorHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := &ErrorHistory{
+		Name:   name,
+		Errors: make([]DeploymentError, len(h.errors[name])),
+	}
+	copy(r.Errors, h.errors[name])
+	return r
+}
+
+// save writes the history to file; callers must hold mu.
+func (h *errorHistory) save() error {
+	if h.file == "" {
+		return nil
+	}
+	buf, err := json.Marshal(h.errors)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return stateKeys.writeFile(h.file, buf)
+}
+
+// makeErrorHistoryEndpoint creates an endpoint to handle error history requests.
+func makeErrorHistoryEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.GetErrorHistory(ctx, req)
+	}
+}
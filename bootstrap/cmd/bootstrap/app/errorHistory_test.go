@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestErrorHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errorHistory")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, errorHistoryFile)
+	h := newErrorHistory(file, 3)
+
+	h.record("kf-app", PhaseApplyPlatform, &httpError{
+		Code:    http.StatusInternalServerError,
+		Message: "kfApp.Apply failed",
+		cause:   fmt.Errorf("quota exceeded"),
+	})
+
+	for i := 0; i < 3; i++ {
+		h.record("kf-app", PhaseApplyK8s, fmt.Errorf("error %v", i))
+	}
+
+	h.record("other-app", PhaseGenerate, fmt.Errorf("generate failed"))
+
+	// Reload from the file to verify the history is persisted.
+	reloaded := newErrorHistory(file, 3)
+
+	for _, hist := range []*errorHistory{h, reloaded} {
+		actual := hist.get("kf-app")
+		if len(actual.Errors) != 3 {
+			t.Fatalf("Got %v errors; want 3:\n%v", len(actual.Errors), PrettyPrint(actual))
+		}
+
+		// The oldest error should have been evicted.
+		for i, e := range actual.Errors {
+			expected := fmt.Sprintf("error %v", i)
+			if e.Message != expected || e.Phase != PhaseApplyK8s {
+				t.Errorf("Error %v: got %v in phase %v; want %v in phase %v", i, e.Message, e.Phase, expected, PhaseApplyK8s)
+			}
+		}
+
+		if other := hist.get("other-app"); len(other.Errors) != 1 {
+			t.Errorf("Got %v errors for other-app; want 1", len(other.Errors))
+		}
+	}
+
+	h = newErrorHistory(file, 3)
+	h.record("http-app", PhaseApplyPlatform, &httpError{
+		Code:    http.StatusInternalServerError,
+		Message: "kfApp.Apply failed",
+		cause:   fmt.Errorf("quota exceeded"),
+	})
+
+	e := h.get("http-app").Errors[0]
+	if e.Code != http.StatusInternalServerError || e.Cause != "quota exceeded" {
+		t.Errorf("Got code %v and cause %v; want %v and quota exceeded", e.Code, e.Cause, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,366 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KfctlExportPath is the path on which to serve export requests
+const KfctlExportPath = "/kfctl/apps/v1alpha2/export"
+
+// ExportChecksumHeader is the response header containing the hex encoded SHA256 of the complete archive.
+const ExportChecksumHeader = "X-Kfctl-Content-Sha256"
+
+// exportFile is the name of the file in the apps directory the archive is built in.
+const exportFile = ".export.tar.gz"
+
+// partialSuffix is appended to the destination of a download while it is in progress.
+// The ETag of the archive being downloaded is stored next to it so the download can be resumed.
+const partialSuffix = ".partial"
+
+// exportMux serializes building archives.
+var exportMux sync.Mutex
+
+// buildExportArchive writes a gzipped tarball of the files in appDir to archive and returns
+// the SHA256 of the archive. Hidden files such as the repo cache are skipped.
+// The archive only depends on the contents of appDir so a download can be resumed from a later build.
+func buildExportArchive(appDir string, archive string) (string, error) {
+	tmp := archive + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, h))
+	tw := tar.NewWriter(gz)
+
+	err = filepath.Walk(appDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == appDir {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(appDir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(tw, in)
+		return err
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := os.Rename(tmp, archive); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// serveExport serves the archive of appDir. Range and If-Range requests are supported so
+// clients can resume interrupted downloads.
+func serveExport(w http.ResponseWriter, r *http.Request, name string, appDir string, archive string) {
+	exportMux.Lock()
+	checksum, err := buildExportArchive(appDir, archive)
+	var f *os.File
+	if err == nil {
+		// Open the archive before releasing the lock so a concurrent build can't replace it.
+		f, err = os.Open(archive)
+	}
+	exportMux.Unlock()
+
+	if err != nil {
+		log.Errorf("Could not build the export archive of %v; error %v", name, err)
+		errorEncoder(r.Context(), &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}, w)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("ETag", strconv.Quote(checksum))
+	w.Header().Set(ExportChecksumHeader, checksum)
+	w.Header().Set("Content-Type", "application/gzip")
+	http.ServeContent(w, r, name+".tar.gz", time.Time{}, f)
+}
+
+// decodeExportRequest decodes the KfDef in the body of an export request.
+func decodeExportRequest(w http.ResponseWriter, r *http.Request) (*kfdefs.KfDef, bool) {
+	req := &kfdefs.KfDef{}
+	if err := decodeBody(r, req); err != nil {
+		log.Info("Err decoding export request: " + err.Error())
+		errorEncoder(r.Context(), &httpError{
+			Message: "Could not decode the request; the body must be the KfDef of the deployment",
+			Code:    http.StatusBadRequest,
+		}, w)
+		return nil, false
+	}
+	return req, true
+}
+
+// exportHandler serves the archive of the deployment handled by the server.
+func (s *kfctlServer) exportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeExportRequest(w, r)
+		if !ok {
+			return
+		}
+
+		s.kfDefMux.Lock()
+		latest := s.latestKfDef.DeepCopy()
+		s.kfDefMux.Unlock()
+
+		if latest.Name == "" || latest.Name != req.Name || latest.Spec.AppDir == "" {
+			errorEncoder(r.Context(), &httpError{
+				Message: fmt.Sprintf("Deployment %v not found", req.Name),
+				Code:    http.StatusNotFound,
+			}, w)
+			return
+		}
+		serveExport(w, r, latest.Name, latest.Spec.AppDir, path.Join(s.appsDir, exportFile))
+	})
+}
+
+// exportHandler checks the caller owns the project and proxies the request to the backend
+// handling the deployment. The response is streamed so archives aren't buffered in the router.
+func (r *kfctlRouter) exportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, hr *http.Request) {
+		body, err := ioutil.ReadAll(hr.Body)
+		if err != nil {
+			errorEncoder(hr.Context(), &httpError{
+				Message: "Could not read the request",
+				Code:    http.StatusBadRequest,
+			}, w)
+			return
+		}
+		hr.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		req, ok := decodeExportRequest(w, hr)
+		if !ok {
+			return
+		}
+		name, err := r.authCheckAndExtractService(*req, RoleViewer)
+		if err != nil {
+			errorEncoder(hr.Context(), err, w)
+			return
+		}
+
+		backend, err := url.Parse(r.backendAddress(name))
+		if err != nil {
+			errorEncoder(hr.Context(), err, w)
+			return
+		}
+		hr.Body = ioutil.NopCloser(bytes.NewReader(body))
+		httputil.NewSingleHostReverseProxy(backend).ServeHTTP(w, hr)
+	})
+}
+
+// DownloadExport downloads the archive of the deployment to dest.
+//
+// The archive is first written to dest + ".partial". If the download is interrupted it is resumed
+// from the end of the partial file, by this call when it retries or by a later call, as long as
+// the archive hasn't changed. The checksum of the complete archive is verified before it is
+// renamed to dest.
+func (c *KfctlClient) DownloadExport(ctx context.Context, req kfdefs.KfDef, dest string) error {
+	partial := dest + partialSuffix
+	etagFile := partial + ".etag"
+
+	return c.retry("DownloadExport", func() error {
+		err := c.downloadExportOnce(ctx, req, partial, etagFile)
+		if err != nil {
+			if hErr, ok := err.(*httpError); ok && hErr.Code >= 400 && hErr.Code < 500 {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+
+		os.Remove(etagFile)
+		return errors.WithStack(os.Rename(partial, dest))
+	})
+}
+
+// downloadExportOnce makes a single request for the archive resuming from the end of partial.
+func (c *KfctlClient) downloadExportOnce(ctx context.Context, req kfdefs.KfDef, partial string, etagFile string) error {
+	var offset int64
+	etag := ""
+	if info, err := os.Stat(partial); err == nil {
+		if b, err := ioutil.ReadFile(etagFile); err == nil {
+			offset = info.Size()
+			etag = string(b)
+		}
+	}
+
+	req, err := c.withToken(req)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	u, err := c.balancedURL(c.exportURL)
+	if err != nil {
+		return err
+	}
+	hReq, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	hReq = hReq.WithContext(ctx)
+	hReq.Header.Set("Content-Type", "application/json")
+	if offset > 0 {
+		log.Infof("Resuming download of %v from byte %v", req.Name, offset)
+		hReq.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+		hReq.Header.Set("If-Range", etag)
+	}
+
+	resp, err := c.httpClient.Do(hReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var out *os.File
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			os.Remove(partial)
+			return fmt.Errorf("server returned range %v; want bytes %v-", resp.Header.Get("Content-Range"), offset)
+		}
+		out, err = os.OpenFile(partial, os.O_WRONLY|os.O_APPEND, 0644)
+	case http.StatusOK:
+		// The archive changed or the server doesn't support ranges; start from the beginning.
+		if offset > 0 {
+			log.Infof("Restarting download of %v; the archive changed", req.Name)
+		}
+		if err := ioutil.WriteFile(etagFile, []byte(resp.Header.Get("ETag")), 0644); err != nil {
+			return errors.WithStack(err)
+		}
+		out, err = os.Create(partial)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is longer than the archive; start again.
+		os.Remove(partial)
+		return fmt.Errorf("partial download of %v is larger than the archive", req.Name)
+	default:
+		h := httpError{}
+		if err := json.NewDecoder(resp.Body).Decode(&h); err == nil {
+			return &h
+		}
+		return &httpError{
+			Message: resp.Status,
+			Code:    resp.StatusCode,
+		}
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return verifyChecksum(partial, resp.Header.Get(ExportChecksumHeader))
+}
+
+// contentRangeStart returns the first byte of a Content-Range header e.g. "bytes 100-199/200".
+func contentRangeStart(contentRange string) (int64, bool) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, false
+	}
+	r := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "-", 2)
+	start, err := strconv.ParseInt(r[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// verifyChecksum checks the SHA256 of file is the hex encoded checksum; if it isn't the file
+// is removed so the next attempt downloads it from the beginning.
+func verifyChecksum(file string, checksum string) error {
+	if checksum == "" {
+		log.Warnf("Server didn't provide a checksum; not verifying %v", file)
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return errors.WithStack(err)
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != checksum {
+		os.Remove(file)
+		return fmt.Errorf("checksum of %v is %v; want %v", file, actual, checksum)
+	}
+	return nil
+}
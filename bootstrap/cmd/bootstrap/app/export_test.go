@@ -0,0 +1,203 @@
+package app
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"github.com/cenkalti/backoff"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// truncatingWriter aborts the response after limit bytes of the body have been written.
+type truncatingWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *truncatingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		w.ResponseWriter.Write(b[:w.limit])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.limit -= len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func TestDownloadExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	appDir := path.Join(dir, "kf-app")
+	for _, d := range []string{"kustomize", ".cache"} {
+		if err := os.MkdirAll(path.Join(appDir, d), 0755); err != nil {
+			t.Fatalf("Could not create %v; %v", d, err)
+		}
+	}
+	files := map[string]string{
+		"app.yaml":                 "apiVersion: kfdef.apps.kubeflow.org/v1alpha1\n",
+		"kustomize/jupyter.yaml":   strings.Repeat("kind: Deployment\n", 4096),
+		".cache/manifests.tar.gz":  "cached",
+		"kustomize/kustomize.yaml": "resources: []\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(path.Join(appDir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Could not write %v; %v", name, err)
+		}
+	}
+
+	type testCase struct {
+		name string
+		// truncate is the number of bytes after which the first response is aborted; 0 to not abort.
+		truncate int
+		// badChecksum if true the server reports the wrong checksum.
+		badChecksum bool
+		// expectedRanges are the Range headers of the requests.
+		expectedRanges []string
+		expectError    bool
+	}
+
+	cases := []testCase{
+		{
+			name:           "complete",
+			expectedRanges: []string{""},
+		},
+		{
+			name:           "resume",
+			truncate:       100,
+			expectedRanges: []string{"", "bytes=100-"},
+		},
+		{
+			name:           "checksum-mismatch",
+			badChecksum:    true,
+			expectedRanges: []string{"", "", ""},
+			expectError:    true,
+		},
+	}
+
+	for _, c := range cases {
+		var mu sync.Mutex
+		ranges := []string{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			first := len(ranges) == 1
+			mu.Unlock()
+
+			if _, ok := decodeExportRequest(w, r); !ok {
+				return
+			}
+			if c.truncate > 0 && first {
+				w = &truncatingWriter{ResponseWriter: w, limit: c.truncate}
+			}
+			if c.badChecksum {
+				w = &checksumOverrideWriter{ResponseWriter: w}
+			}
+			serveExport(w, r, "kf-app", appDir, path.Join(dir, exportFile))
+		}))
+
+		u, _ := url.Parse(ts.URL)
+		client := &KfctlClient{
+			exportURL:  copyURL(u, KfctlExportPath),
+			httpClient: ts.Client(),
+			newBackOff: func() backoff.BackOff {
+				return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2)
+			},
+			retryBudget: defaultRetryBudget(),
+		}
+
+		dest := path.Join(dir, c.name+".tar.gz")
+		err := client.DownloadExport(context.Background(), kfdefs.KfDef{}, dest)
+		ts.Close()
+
+		if c.expectError {
+			if err == nil {
+				t.Errorf("Case %v: expected an error", c.name)
+			}
+			if _, err := os.Stat(dest); err == nil {
+				t.Errorf("Case %v: %v exists after the download failed", c.name, dest)
+			}
+		} else if err != nil {
+			t.Errorf("Case %v: DownloadExport failed; %v", c.name, err)
+		} else {
+			verifyExportArchive(t, c.name, dest, files)
+		}
+
+		if strings.Join(ranges, ",") != strings.Join(c.expectedRanges, ",") {
+			t.Errorf("Case %v: got ranges %v; want %v", c.name, ranges, c.expectedRanges)
+		}
+	}
+}
+
+// checksumOverrideWriter reports the wrong checksum for the response.
+type checksumOverrideWriter struct {
+	http.ResponseWriter
+}
+
+func (w *checksumOverrideWriter) WriteHeader(code int) {
+	w.Header().Set(ExportChecksumHeader, strings.Repeat("0", 64))
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// verifyExportArchive checks the archive contains the non hidden files.
+func verifyExportArchive(t *testing.T, name string, archive string, files map[string]string) {
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Errorf("Case %v: could not open %v; %v", name, archive, err)
+		return
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Errorf("Case %v: could not read %v; %v", name, archive, err)
+		return
+	}
+	tr := tar.NewReader(gz)
+
+	actual := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Errorf("Case %v: could not read %v; %v", name, archive, err)
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Errorf("Case %v: could not read %v; %v", name, hdr.Name, err)
+			return
+		}
+		actual[hdr.Name] = string(b)
+	}
+
+	for file, contents := range files {
+		if strings.HasPrefix(file, ".") {
+			if _, ok := actual[file]; ok {
+				t.Errorf("Case %v: archive contains hidden file %v", name, file)
+			}
+			continue
+		}
+		if actual[file] != contents {
+			t.Errorf("Case %v: archive has wrong contents for %v", name, file)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultType identifies a kind of fault the FaultInjector can simulate.
+type FaultType string
+
+const (
+	// FaultNone lets the request through untouched.
+	FaultNone FaultType = "none"
+	// FaultDrop simulates packet loss; the request never reaches the server.
+	FaultDrop FaultType = "drop"
+	// FaultServerError answers the request with a 5xx status code.
+	FaultServerError FaultType = "5xx"
+	// FaultSlow delays the request by FaultInjector.Delay before handling it.
+	FaultSlow FaultType = "slow"
+	// FaultMalformed answers the request with a body that isn't valid JSON.
+	FaultMalformed FaultType = "malformed"
+)
+
+// malformedBody is returned for FaultMalformed. It is truncated JSON.
+const malformedBody = `{"metadata": {"name": "kf`
+
+// FaultInjector simulates an unreliable network between KfctlClient and the server.
+// It is intended for testing the retry logic of the client.
+//
+// Faults are chosen as follows. Requests first consume the Script in order;
+// once the script is exhausted each fault is chosen at random using Rates.
+//
+// A FaultInjector can wrap a client side http.RoundTripper (see Transport) or
+// a server side http.Handler (see Handler).
+type FaultInjector struct {
+	// Script is a fixed sequence of faults applied to successive requests.
+	Script []FaultType
+
+	// Rates is the probability in [0, 1] of each fault once Script is exhausted.
+	Rates map[FaultType]float64
+
+	// Delay is how long FaultSlow requests are delayed.
+	Delay time.Duration
+
+	// ErrorCode is the status code used for FaultServerError; defaults to 503.
+	ErrorCode int
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	requests int
+}
+
+// NewFaultInjectorFromSpec parses a comma separated spec of the form
+// "drop=0.1,5xx=0.2,slow=0.1,malformed=0.05,delay=5s,code=502" into a FaultInjector.
+func NewFaultInjectorFromSpec(spec string) (*FaultInjector, error) {
+	f := &FaultInjector{
+		Rates: map[FaultType]float64{},
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		pieces := strings.SplitN(pair, "=", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("invalid fault spec %v; expected key=value", pair)
+		}
+		k, v := pieces[0], pieces[1]
+
+		switch k {
+		case "delay":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid delay %v; %v", v, err)
+			}
+			f.Delay = d
+		case "code":
+			c, err := strconv.Atoi(v)
+			if err != nil || c < 500 || c > 599 {
+				return nil, fmt.Errorf("invalid code %v; must be a 5xx status code", v)
+			}
+			f.ErrorCode = c
+		case string(FaultDrop), string(FaultServerError), string(FaultSlow), string(FaultMalformed):
+			r, err := strconv.ParseFloat(v, 64)
+			if err != nil || r < 0 || r > 1 {
+				return nil, fmt.Errorf("invalid rate %v for %v; must be in [0, 1]", v, k)
+			}
+			f.Rates[FaultType(k)] = r
+		default:
+			return nil, fmt.Errorf("unknown fault %v", k)
+		}
+	}
+	return f, nil
+}
+
+// next returns the fault to apply to the next request.
+func (f *FaultInjector) next() FaultType {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := f.requests
+	f.requests++
+
+	if i < len(f.Script) {
+		return f.Script[i]
+	}
+
+	if f.rnd == nil {
+		f.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	// Walk the faults in a fixed order so a given seed is reproducible.
+	p := f.rnd.Float64()
+	for _, t := range []FaultType{FaultDrop, FaultServerError, FaultSlow, FaultMalformed} {
+		p -= f.Rates[t]
+		if p < 0 {
+			return t
+		}
+	}
+	return FaultNone
+}
+
+// Requests returns the number of requests seen by the injector.
+func (f *FaultInjector) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+func (f *FaultInjector) errorCode() int {
+	if f.ErrorCode == 0 {
+		return http.StatusServiceUnavailable
+	}
+	return f.ErrorCode
+}
+
+func (f *FaultInjector) errorBody() []byte {
+	b, _ := json.Marshal(&httpError{
+		Message: "Injected fault; service unavailable",
+		Code:    f.errorCode(),
+	})
+	return b
+}
+
+// Transport wraps base with fault injection. If base is nil http.DefaultTransport is used.
+func (f *FaultInjector) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &faultTransport{f: f, base: base}
+}
+
+type faultTransport struct {
+	f    *FaultInjector
+	base http.RoundTripper
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault := t.f.next()
+	log.Debugf("Injecting fault %v into request %v", fault, req.URL)
+
+	switch fault {
+	case FaultDrop:
+		return nil, fmt.Errorf("injected fault; connection to %v lost", req.URL.Host)
+	case FaultServerError:
+		return &http.Response{
+			Status:     http.StatusText(t.f.errorCode()),
+			StatusCode: t.f.errorCode(),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(t.f.errorBody())),
+			Request:    req,
+		}, nil
+	case FaultSlow:
+		select {
+		case <-time.After(t.f.Delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	case FaultMalformed:
+		res, err := t.base.RoundTrip(req)
+		if err != nil {
+			return res, err
+		}
+		res.Body.Close()
+		res.StatusCode = http.StatusOK
+		res.Status = http.StatusText(http.StatusOK)
+		res.ContentLength = int64(len(malformedBody))
+		res.Body = ioutil.NopCloser(strings.NewReader(malformedBody))
+		return res, nil
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Handler wraps h so that faults are injected into requests before they reach it.
+// This is used by the server when started with --fault-injection.
+func (f *FaultInjector) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fault := f.next()
+		log.Debugf("Injecting fault %v into request %v", fault, r.URL)
+
+		switch fault {
+		case FaultDrop:
+			hj, ok := w.(http.Hijacker)
+			if !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			conn, _, err := hj.Hijack()
+			if err != nil {
+				log.Errorf("Could not hijack connection to drop it; %v", err)
+				return
+			}
+			conn.Close()
+			return
+		case FaultServerError:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(f.errorCode())
+			w.Write(f.errorBody())
+			return
+		case FaultSlow:
+			select {
+			case <-time.After(f.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		case FaultMalformed:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(malformedBody))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
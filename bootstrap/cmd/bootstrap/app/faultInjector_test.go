@@ -0,0 +1,392 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cenkalti/backoff"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKfctlService is a KfctlService that echoes back the request and counts calls.
+type fakeKfctlService struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeKfctlService) CreateDeployment(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return &req, nil
+}
+
+func (f *fakeKfctlService) GetLatestKfdef(req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	return &req, nil
+}
+
+func (f *fakeKfctlService) Lint(ctx context.Context, req kfdefsv3.KfDef) (*LintResult, error) {
+	return lint.Lint(&req, nil), nil
+}
+
+func (f *fakeKfctlService) Convert(ctx context.Context, req kfdefsv3.KfDef) (*ConversionResult, error) {
+	return lint.Convert(&req), nil
+}
+
+func (f *fakeKfctlService) GetErrorHistory(ctx context.Context, req kfdefsv3.KfDef) (*ErrorHistory, error) {
+	return &ErrorHistory{Name: req.Name}, nil
+}
+
+func (f *fakeKfctlService) Plan(ctx context.Context, req kfdefsv3.KfDef) (*DeploymentPlan, error) {
+	return planDeployment(nil, req, time.Now())
+}
+
+func (f *fakeKfctlService) Execute(ctx context.Context, req ExecuteRequest) (*kfdefsv3.KfDef, error) {
+	if err := verifyPlan(nil, req, time.Now()); err != nil {
+		return nil, err
+	}
+	return f.CreateDeployment(ctx, req.KfDef)
+}
+
+func (f *fakeKfctlService) Clone(ctx context.Context, req CloneRequest) (*kfdefsv3.KfDef, error) {
+	d, err := cloneKfDef(&req.Source, req)
+	if err != nil {
+		return nil, err
+	}
+	return f.CreateDeployment(ctx, *d)
+}
+
+func (f *fakeKfctlService) GetConnectionInfo(ctx context.Context, req kfdefsv3.KfDef) (*ConnectionInfo, error) {
+	return &ConnectionInfo{Name: req.Name, Namespace: req.Namespace}, nil
+}
+
+func (f *fakeKfctlService) ScheduleMaintenance(ctx context.Context, req MaintenanceRequest) (*MaintenanceSchedule, error) {
+	if err := validateMaintenanceTasks(req.Tasks); err != nil {
+		return nil, err
+	}
+	return &MaintenanceSchedule{Name: req.KfDef.Name}, nil
+}
+
+func (f *fakeKfctlService) RunMaintenance(ctx context.Context, req MaintenanceRunRequest) (*MaintenanceEvent, error) {
+	if err := validateMaintenanceTaskType(req.Type); err != nil {
+		return nil, err
+	}
+	return &MaintenanceEvent{Type: req.Type, Time: time.Now(), Succeeded: true}, nil
+}
+
+func (f *fakeKfctlService) GetRevisionDiff(ctx context.Context, req RevisionDiffRequest) (*RevisionDiff, error) {
+	return &RevisionDiff{Name: req.KfDef.Name}, nil
+}
+
+func (f *fakeKfctlService) GetStats(ctx context.Context, req StatsRequest) (*DeploymentStats, error) {
+	return computeStats(req.KfDef.Spec.Project, time.Now().Add(-statsWindow(req)), nil), nil
+}
+
+func (f *fakeKfctlService) GetDurationTrends(ctx context.Context, req DurationTrendsRequest) (*DurationTrends, error) {
+	window, interval, err := trendsWindow(req)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return computeDurationTrends(req.KfDef.Spec.Project, now.Add(-window), now, interval, nil), nil
+}
+
+func (f *fakeKfctlService) RetryFailedApps(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	return f.CreateDeployment(ctx, req)
+}
+
+func (f *fakeKfctlService) Pause(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	return &req, nil
+}
+
+func (f *fakeKfctlService) Resume(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	return &req, nil
+}
+
+func (f *fakeKfctlService) Cancel(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	return &req, nil
+}
+
+func (f *fakeKfctlService) ListDeployments(ctx context.Context, req kfdefsv3.KfDef) (*DeploymentList, error) {
+	return &DeploymentList{Project: req.Spec.Project, Deployments: []DeploymentSummary{}}, nil
+}
+
+func (f *fakeKfctlService) DeleteDeployment(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	return &req, nil
+}
+
+func (f *fakeKfctlService) PrepareDelete(ctx context.Context, req kfdefsv3.KfDef) (*DeletePlan, error) {
+	return &DeletePlan{Name: req.Name, Resources: []kfdefsv3.InventoryResource{}}, nil
+}
+
+func (f *fakeKfctlService) GetIamReport(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	return &gcp.IamPolicyReport{Name: req.KfDef.Name}, nil
+}
+
+func (f *fakeKfctlService) RevokeUnused(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	return &gcp.IamPolicyReport{Name: req.KfDef.Name}, nil
+}
+
+func (f *fakeKfctlService) UpdateMetadata(ctx context.Context, req MetadataRequest) (*kfdefsv3.KfDef, error) {
+	return &req.KfDef, nil
+}
+
+func (f *fakeKfctlService) VerifyManifests(ctx context.Context, req kfdefsv3.KfDef) (*kustomize.ManifestVerification, error) {
+	return &kustomize.ManifestVerification{Verified: true}, nil
+}
+
+func (f *fakeKfctlService) GetInventory(ctx context.Context, req kfdefsv3.KfDef) (*Inventory, error) {
+	return &Inventory{Name: req.Name}, nil
+}
+
+func (f *fakeKfctlService) GetRunLog(ctx context.Context, req kfdefsv3.KfDef) (*RunLog, error) {
+	return &RunLog{Name: req.Name}, nil
+}
+
+func (f *fakeKfctlService) GetLogs(ctx context.Context, req LogsRequest) (*LogPage, error) {
+	return &LogPage{Name: req.KfDef.Name}, nil
+}
+
+func (f *fakeKfctlService) Migrate(ctx context.Context, req MigrationRequest) (*MigrationReport, error) {
+	return &MigrationReport{Name: req.KfDef.Name, DryRun: req.DryRun}, nil
+}
+
+func (f *fakeKfctlService) Backup(ctx context.Context, req BackupRequest) (*kustomize.ResourceSnapshot, error) {
+	return &kustomize.ResourceSnapshot{Deployment: req.KfDef.Name}, nil
+}
+
+func (f *fakeKfctlService) Restore(ctx context.Context, req RestoreRequest) (*kustomize.RestoreReport, error) {
+	return &kustomize.RestoreReport{Source: req.Backup.Deployment}, nil
+}
+
+func (f *fakeKfctlService) PreviewUpgrade(ctx context.Context, req kfdefsv3.KfDef) (*UpgradePreview, error) {
+	return &UpgradePreview{Name: req.Name}, nil
+}
+
+func (f *fakeKfctlService) GetKfDefDefaults(ctx context.Context, req DefaultsRequest) (*kfdefsv3.KfDef, error) {
+	return defaultKfDef(DefaultServerConfig(), req)
+}
+
+func (f *fakeKfctlService) ListVersions(ctx context.Context, req VersionsRequest) (*VersionList, error) {
+	return listVersions(DefaultServerConfig(), req), nil
+}
+
+func (f *fakeKfctlService) GarbageCollect(ctx context.Context, req GarbageCollectionRequest) (*GarbageCollectionReport, error) {
+	return &GarbageCollectionReport{DryRun: req.DryRun, Collected: []CollectedDeployment{}, Pending: []string{}}, nil
+}
+
+func (f *fakeKfctlService) CheckOAuthClient(ctx context.Context, req OAuthClientRequest) (*gcp.OAuthClientReport, error) {
+	return &gcp.OAuthClientReport{Project: req.KfDef.Spec.Project}, nil
+}
+
+func (f *fakeKfctlService) ShareDeployment(ctx context.Context, req ShareRequest) (*SharedLink, error) {
+	return &SharedLink{Name: req.KfDef.Name, Project: req.KfDef.Spec.Project}, nil
+}
+
+func (f *fakeKfctlService) Reencrypt(ctx context.Context, req ReencryptionRequest) (*ReencryptionReport, error) {
+	return &ReencryptionReport{Name: req.KfDef.Name, DryRun: req.DryRun}, nil
+}
+
+func (f *fakeKfctlService) numCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// newFakeKfctlServer starts an httptest server serving svc on KfctlCreatePath.
+func newFakeKfctlServer(svc KfctlService) *httptest.Server {
+	createHandler := httptransport.NewServer(
+		makeRouterCreateRequestEndpoint(svc),
+		func(_ context.Context, r *http.Request) (interface{}, error) {
+			var request kfdefsv3.KfDef
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				return nil, err
+			}
+			return request, nil
+		},
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(KfctlCreatePath, createHandler)
+	return httptest.NewServer(mux)
+}
+
+func TestKfctlClient_CreateDeploymentFaults(t *testing.T) {
+	type testCase struct {
+		name        string
+		script      []FaultType
+		maxRetries  uint64
+		delay       time.Duration
+		timeout     time.Duration
+		expectErr   bool
+		expectCalls int
+	}
+
+	testCases := []testCase{
+		{
+			name:        "no-faults",
+			maxRetries:  3,
+			expectCalls: 1,
+		},
+		{
+			name:        "packet-loss",
+			script:      []FaultType{FaultDrop, FaultDrop},
+			maxRetries:  3,
+			expectCalls: 1,
+		},
+		{
+			name:        "5xx-burst",
+			script:      []FaultType{FaultServerError, FaultServerError, FaultServerError},
+			maxRetries:  3,
+			expectCalls: 1,
+		},
+		{
+			// The first request is abandoned by the client before it reaches the server.
+			name:        "slow-response",
+			script:      []FaultType{FaultSlow},
+			delay:       200 * time.Millisecond,
+			timeout:     100 * time.Millisecond,
+			maxRetries:  3,
+			expectCalls: 1,
+		},
+		{
+			// Malformed responses are retried; the server sees both requests.
+			name:        "malformed-json",
+			script:      []FaultType{FaultMalformed},
+			maxRetries:  3,
+			expectCalls: 2,
+		},
+		{
+			name:        "mixed-faults",
+			script:      []FaultType{FaultDrop, FaultServerError, FaultMalformed, FaultNone},
+			maxRetries:  5,
+			expectCalls: 2,
+		},
+		{
+			name:        "retries-exhausted",
+			script:      []FaultType{FaultServerError, FaultServerError, FaultServerError, FaultServerError},
+			maxRetries:  2,
+			expectErr:   true,
+			expectCalls: 0,
+		},
+	}
+
+	for _, c := range testCases {
+		svc := &fakeKfctlService{}
+		server := newFakeKfctlServer(svc)
+
+		faults := &FaultInjector{
+			Script: c.script,
+			Delay:  c.delay,
+		}
+
+		httpClient := &http.Client{
+			Transport: faults.Transport(nil),
+			Timeout:   c.timeout,
+		}
+
+		maxRetries := c.maxRetries
+		client, err := NewKfctlClient(server.URL, WithHTTPClient(httpClient), WithRetryBackOff(func() backoff.BackOff {
+			return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, maxRetries)
+		}))
+
+		if err != nil {
+			t.Fatalf("Case %v: could not create client; %v", c.name, err)
+		}
+
+		res, err := client.CreateDeployment(context.Background(), kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kf-app",
+			},
+		})
+
+		if c.expectErr && err == nil {
+			t.Errorf("Case %v: want error; got nil", c.name)
+		}
+
+		if !c.expectErr {
+			if err != nil {
+				t.Errorf("Case %v: CreateDeployment error; %v", c.name, err)
+			} else if res.Name != "kf-app" {
+				t.Errorf("Case %v: got name %v; want kf-app", c.name, res.Name)
+			}
+		}
+
+		// The slow request may still be in flight on the server when the client gives up.
+		time.Sleep(2 * c.delay)
+
+		if svc.numCalls() != c.expectCalls {
+			t.Errorf("Case %v: server got %v calls; want %v", c.name, svc.numCalls(), c.expectCalls)
+		}
+		server.Close()
+	}
+}
+
+func TestFaultInjector_Handler(t *testing.T) {
+	faults := &FaultInjector{
+		Script: []FaultType{FaultServerError, FaultMalformed, FaultNone},
+	}
+
+	svc := &fakeKfctlService{}
+	server := newFakeKfctlServer(svc)
+	defer server.Close()
+
+	// Put the injector on the server side this time.
+	proxy := httptest.NewServer(faults.Handler(server.Config.Handler))
+	defer proxy.Close()
+
+	client, err := NewKfctlClient(proxy.URL, WithRetryBackOff(func() backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+	}))
+
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+
+	if _, err := client.CreateDeployment(context.Background(), kfdefsv3.KfDef{}); err != nil {
+		t.Fatalf("CreateDeployment error; %v", err)
+	}
+
+	if faults.Requests() != 3 {
+		t.Errorf("Injector saw %v requests; want 3", faults.Requests())
+	}
+
+	if svc.numCalls() != 1 {
+		t.Errorf("Server got %v calls; want 1", svc.numCalls())
+	}
+}
+
+func TestNewFaultInjectorFromSpec(t *testing.T) {
+	f, err := NewFaultInjectorFromSpec("drop=0.1, 5xx=0.2,delay=5s,code=502")
+	if err != nil {
+		t.Fatalf("NewFaultInjectorFromSpec error; %v", err)
+	}
+
+	if f.Rates[FaultDrop] != 0.1 || f.Rates[FaultServerError] != 0.2 {
+		t.Errorf("Incorrect rates; got %v", f.Rates)
+	}
+
+	if f.Delay != 5*time.Second {
+		t.Errorf("Incorrect delay; got %v", f.Delay)
+	}
+
+	if f.ErrorCode != 502 {
+		t.Errorf("Incorrect code; got %v", f.ErrorCode)
+	}
+
+	for _, bad := range []string{"drop", "drop=2", "code=404", "unknown=0.1", "delay=abc"} {
+		if _, err := NewFaultInjectorFromSpec(bad); err == nil {
+			t.Errorf("Spec %v; want error; got nil", bad)
+		}
+	}
+}
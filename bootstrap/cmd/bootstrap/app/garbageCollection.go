@@ -0,0 +1,341 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app/options"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"time"
+)
+
+// KfctlGarbageCollectPath is the path on which to serve requests to collect abandoned deployments
+const KfctlGarbageCollectPath = "/kfctl/apps/v1alpha2/gc"
+
+// garbageCollectAnnotation is set on the delete request queued to clean up an abandoned deployment.
+const garbageCollectAnnotation = "kfctl.kubeflow.org/garbage-collect"
+
+// DeploymentAbandonedReason indicates the resources of a deployment which never succeeded were
+// deleted by the garbage collector.
+const DeploymentAbandonedReason = "Abandoned"
+
+// minGarbageCollectionAge bounds the ages so deployments aren't collected while users retry them.
+const minGarbageCollectionAge = 30 * time.Minute
+
+// GarbageCollectionConfig configures the collection of the deployments which never succeeded.
+// Deployments with deletion protection or which are paused are never collected.
+type GarbageCollectionConfig struct {
+	// FailedAge is how long after its last run failed or was canceled a deployment is cleaned up.
+	FailedAge metav1.Duration `json:"failedAge"`
+	// StuckAge is how long after it started a run creating a deployment is canceled; the
+	// deployment is cleaned up once the run stops.
+	StuckAge metav1.Duration `json:"stuckAge"`
+}
+
+// validate returns an error if the ages are too short.
+func (c *GarbageCollectionConfig) validate() error {
+	if c.FailedAge.Duration < minGarbageCollectionAge || c.StuckAge.Duration < minGarbageCollectionAge {
+		return fmt.Errorf("garbageCollection failedAge and stuckAge must be at least %v", minGarbageCollectionAge)
+	}
+	return nil
+}
+
+// GarbageCollectionFromOptions returns the config of the --gc-failed-age and --gc-stuck-age flags;
+// nil if garbage collection isn't enabled.
+func GarbageCollectionFromOptions(opt *options.ServerOption) (*GarbageCollectionConfig, error) {
+	if opt.GcFailedAge == 0 && opt.GcStuckAge == 0 {
+		return nil, nil
+	}
+	c := &GarbageCollectionConfig{
+		FailedAge: metav1.Duration{Duration: opt.GcFailedAge},
+		StuckAge:  metav1.Duration{Duration: opt.GcStuckAge},
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GarbageCollectionAction is what the garbage collector did to a deployment.
+type GarbageCollectionAction string
+
+const (
+	// GarbageCollectionCleanup queued the deletion of the resources of a failed deployment; it is
+	// marked Abandoned once they are deleted.
+	GarbageCollectionCleanup GarbageCollectionAction = "Cleanup"
+	// GarbageCollectionCancel canceled a stuck run; the deployment is cleaned up once it stops.
+	GarbageCollectionCancel GarbageCollectionAction = "Cancel"
+)
+
+// GarbageCollectionRequest asks the kfctl servers to collect their deployment if it is abandoned.
+type GarbageCollectionRequest struct {
+	// KfDef provides the project and the credentials; the name is ignored. Admins of the operator
+	// project may collect the deployments of every project with AllProjectsAnnotation.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// DryRun reports the deployments which would be collected without changing them.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Config is the ages deployments are collected at. The router sets it from its server config.
+	Config GarbageCollectionConfig `json:"config"`
+}
+
+// CollectedDeployment is a deployment handled by the garbage collector.
+type CollectedDeployment struct {
+	Name    string                  `json:"name"`
+	Project string                  `json:"project"`
+	Action  GarbageCollectionAction `json:"action"`
+	// Reason describes the run which made the deployment abandoned.
+	Reason string `json:"reason"`
+	// Server is the name of the kfctl server handling the deployment; only set by the router.
+	Server string `json:"server,omitempty"`
+}
+
+// GarbageCollectionReport lists the deployments handled by a garbage collection.
+type GarbageCollectionReport struct {
+	DryRun    bool                  `json:"dryRun,omitempty"`
+	Collected []CollectedDeployment `json:"collected"`
+	// Pending are the names of the deployments which never succeeded but aren't old enough to
+	// be collected or are being cleaned up.
+	Pending []string `json:"pending"`
+	// Unavailable is the number of kfctl servers which couldn't be queried; only set by the router.
+	Unavailable int `json:"unavailable,omitempty"`
+}
+
+var (
+	gcCollectedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kfctl_gc_collected_deployments",
+		Help: "Number of abandoned deployments collected by the garbage collector",
+	}, []string{"action"})
+	gcAbandonedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kfctl_gc_abandoned_deployments",
+		Help: "Number of abandoned deployments whose resources were deleted",
+	})
+	gcCleanupFailuresCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kfctl_gc_cleanup_failures",
+		Help: "Number of failed cleanups of abandoned deployments",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(gcCollectedCounter)
+	prometheus.MustRegister(gcAbandonedCounter)
+	prometheus.MustRegister(gcCleanupFailuresCounter)
+}
+
+// takeGarbageCollect returns true if the request cleans up an abandoned deployment and removes the annotation.
+func takeGarbageCollect(r *kfdefs.KfDef) bool {
+	if _, ok := r.Annotations[garbageCollectAnnotation]; !ok {
+		return false
+	}
+	delete(r.Annotations, garbageCollectAnnotation)
+	return true
+}
+
+// collectGarbage collects the deployment if none of its runs succeeded and its last run failed,
+// was canceled or is stuck for longer than the ages of req.
+func (s *kfctlServer) collectGarbage(req GarbageCollectionRequest, now time.Time) *GarbageCollectionReport {
+	report := &GarbageCollectionReport{
+		DryRun:    req.DryRun,
+		Collected: []CollectedDeployment{},
+		Pending:   []string{},
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+
+	d := s.latestKfDef
+	project := req.KfDef.Spec.Project
+	if d.Name == "" || (project != "" && d.Spec.Project != project) || s.paused || s.metadata.DeletionProtection {
+		return report
+	}
+	runs := s.runs.list(time.Time{})
+	if len(runs) == 0 {
+		return report
+	}
+	for _, r := range runs {
+		if r.Status == RunSucceeded {
+			return report
+		}
+	}
+
+	last := runs[len(runs)-1]
+	collected := CollectedDeployment{
+		Name:    d.Name,
+		Project: d.Spec.Project,
+	}
+	switch {
+	case last.Status == RunInProgress && !s.gcCanceled && now.Sub(last.Start) >= req.Config.StuckAge.Duration:
+		collected.Action = GarbageCollectionCancel
+		collected.Reason = fmt.Sprintf("Run started at %v is still in phase %v", last.Start.Format(time.RFC3339), s.phase)
+		if !req.DryRun {
+			log.Infof("Canceling the stuck run of deployment %v; %v", d.Name, collected.Reason)
+			s.canceled = true
+			s.wakePaused()
+			s.gcCanceled = true
+		}
+	case s.busy || len(s.c) > 0 || last.End == nil:
+		report.Pending = append(report.Pending, d.Name)
+		return report
+	case s.gcCanceled || now.Sub(*last.End) >= req.Config.FailedAge.Duration:
+		collected.Action = GarbageCollectionCleanup
+		collected.Reason = fmt.Sprintf("Run %v in phase %v at %v", last.Status, last.Phase, last.End.Format(time.RFC3339))
+		if !req.DryRun {
+			r := d.DeepCopy()
+			r.Status = kfdefs.KfDefStatus{}
+			if r.Annotations == nil {
+				r.Annotations = map[string]string{}
+			}
+			r.Annotations[deleteAnnotation] = "true"
+			r.Annotations[garbageCollectAnnotation] = "true"
+			select {
+			case s.c <- *r:
+			default:
+				report.Pending = append(report.Pending, d.Name)
+				return report
+			}
+			log.Infof("Cleaning up abandoned deployment %v; %v", d.Name, collected.Reason)
+			s.gcCanceled = false
+		}
+	default:
+		report.Pending = append(report.Pending, d.Name)
+		return report
+	}
+
+	if !req.DryRun {
+		gcCollectedCounter.WithLabelValues(string(collected.Action)).Inc()
+	}
+	report.Collected = append(report.Collected, collected)
+	return report
+}
+
+// finishGarbageCollection records the outcome of the cleanup of an abandoned deployment; the
+// deployment is marked Abandoned if its resources were deleted.
+func (s *kfctlServer) finishGarbageCollection(name string, err error) {
+	if err != nil {
+		log.Errorf("Could not clean up abandoned deployment %v; the next collection will retry; %v", name, err)
+		gcCleanupFailuresCounter.Inc()
+		return
+	}
+	gcAbandonedCounter.Inc()
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.latestKfDef.Status.Conditions = append(s.latestKfDef.Status.Conditions, kfdefs.KfDefCondition{
+		Type:               kfdefs.KfFailed,
+		Status:             v1.ConditionTrue,
+		Reason:             DeploymentAbandonedReason,
+		Message:            "The deployment never succeeded; its resources were deleted by the garbage collector.",
+		LastUpdateTime:     metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	})
+	s.publishStatus()
+}
+
+// GarbageCollect collects the deployment handled by the server if it is abandoned.
+func (s *kfctlServer) GarbageCollect(ctx context.Context, req GarbageCollectionRequest) (*GarbageCollectionReport, error) {
+	if err := req.Config.validate(); err != nil {
+		return nil, &httpError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if s.isDraining() {
+		return nil, drainingError()
+	}
+	return s.collectGarbage(req, time.Now()), nil
+}
+
+// GarbageCollect collects the abandoned deployments of the kfctl servers in the project of the
+// request with the ages of the server config.
+func (r *kfctlRouter) GarbageCollect(ctx context.Context, req GarbageCollectionRequest) (*GarbageCollectionReport, error) {
+	c := r.config.get().GarbageCollection
+	if c == nil {
+		return nil, &httpError{
+			Message: "Garbage collection isn't enabled; set garbageCollection in the server config",
+			Code:    http.StatusConflict,
+		}
+	}
+	req.Config = *c
+
+	backends, err := r.listBackends(req.KfDef, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if allProjects(req.KfDef) {
+		// The servers collect their deployment whatever its project.
+		req.KfDef.Spec.Project = ""
+	}
+
+	report := &GarbageCollectionReport{
+		DryRun:    req.DryRun,
+		Collected: []CollectedDeployment{},
+		Pending:   []string{},
+	}
+	for _, b := range backends {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		svc, err := r.serviceClient(b)
+		if err != nil {
+			report.Unavailable++
+			continue
+		}
+		collected, err := svc.GarbageCollect(ctx, req)
+		if err != nil {
+			log.Warnf("Could not collect the deployment of kfctl server %v; error %v", b, err)
+			report.Unavailable++
+			continue
+		}
+		for _, d := range collected.Collected {
+			d.Server = b
+			report.Collected = append(report.Collected, d)
+		}
+		report.Pending = append(report.Pending, collected.Pending...)
+	}
+	return report, nil
+}
+
+// GarbageCollect collects the abandoned deployments in the project of the request.
+func (c *KfctlClient) GarbageCollect(ctx context.Context, req GarbageCollectionRequest) (*GarbageCollectionReport, error) {
+	var resp interface{}
+	err := c.retry("GarbageCollect", func() error {
+		var err error
+		resp, err = c.gcEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*GarbageCollectionReport)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeGarbageCollectEndpoint creates an endpoint to handle requests to collect abandoned deployments.
+func makeGarbageCollectEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(GarbageCollectionRequest)
+		return svc.GarbageCollect(ctx, req)
+	}
+}
+
+// decodeHTTPGarbageCollectionRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded GarbageCollectionRequest from the HTTP request body.
+func decodeHTTPGarbageCollectionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request GarbageCollectionRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding garbage collection request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
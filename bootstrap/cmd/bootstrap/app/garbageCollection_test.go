@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"testing"
+	"time"
+)
+
+func newGarbageCollectionRequest() GarbageCollectionRequest {
+	return GarbageCollectionRequest{
+		Config: GarbageCollectionConfig{
+			FailedAge: metav1.Duration{Duration: time.Hour},
+			StuckAge:  metav1.Duration{Duration: 2 * time.Hour},
+		},
+	}
+}
+
+func TestKfctlServer_CollectFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newQueueTestServer(dir)
+	start := time.Date(2019, time.October, 14, 12, 0, 0, 0, time.UTC)
+	s.runs.now = func() time.Time { return start }
+	req := newGarbageCollectionRequest()
+
+	if r := s.collectGarbage(req, start.Add(24*time.Hour)); len(r.Collected) != 0 || len(r.Pending) != 0 {
+		t.Errorf("Collected a deployment without runs; got %v", PrettyPrint(r))
+	}
+
+	s.runs.begin("kf-app")
+	s.runs.finish(PhaseApplyPlatform, errCanceled)
+	if r := s.collectGarbage(req, start.Add(30*time.Minute)); len(r.Collected) != 0 || len(r.Pending) != 1 {
+		t.Errorf("Collected a deployment which failed recently; got %v", PrettyPrint(r))
+	}
+
+	s.metadata.DeletionProtection = true
+	if r := s.collectGarbage(req, start.Add(2*time.Hour)); len(r.Collected) != 0 {
+		t.Errorf("Collected a deployment with deletion protection; got %v", PrettyPrint(r))
+	}
+	s.metadata.DeletionProtection = false
+
+	req.DryRun = true
+	r := s.collectGarbage(req, start.Add(2*time.Hour))
+	if len(r.Collected) != 1 || r.Collected[0].Action != GarbageCollectionCleanup {
+		t.Fatalf("Dry run: want a cleanup; got %v", PrettyPrint(r))
+	}
+	if len(s.c) != 0 {
+		t.Errorf("Dry run queued %v requests; want none", len(s.c))
+	}
+
+	req.DryRun = false
+	r = s.collectGarbage(req, start.Add(2*time.Hour))
+	if len(r.Collected) != 1 || r.Collected[0].Action != GarbageCollectionCleanup {
+		t.Fatalf("Want a cleanup; got %v", PrettyPrint(r))
+	}
+	queued := <-s.c
+	if !takeGarbageCollect(&queued) || !takeDelete(&queued) {
+		t.Errorf("Queued request doesn't clean up the deployment; annotations %v", queued.Annotations)
+	}
+
+	s.finishGarbageCollection("kf-app", nil)
+	found := false
+	for _, c := range s.latestKfDef.Status.Conditions {
+		found = found || c.Reason == DeploymentAbandonedReason
+	}
+	if !found {
+		t.Errorf("Status doesn't report the deployment was abandoned; %v", PrettyPrint(s.latestKfDef.Status))
+	}
+
+	// The successful cleanup is a successful run so the deployment isn't collected again.
+	s.runs.begin("kf-app")
+	s.runs.finish(PhaseAbandoned, nil)
+	if r := s.collectGarbage(req, start.Add(24*time.Hour)); len(r.Collected) != 0 || len(r.Pending) != 0 {
+		t.Errorf("Collected an abandoned deployment again; got %v", PrettyPrint(r))
+	}
+}
+
+func TestKfctlServer_CollectStuck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newQueueTestServer(dir)
+	start := time.Date(2019, time.October, 14, 12, 0, 0, 0, time.UTC)
+	s.runs.now = func() time.Time { return start }
+	req := newGarbageCollectionRequest()
+
+	s.runs.begin("kf-app")
+	s.setBusy(true)
+	if r := s.collectGarbage(req, start.Add(time.Hour)); len(r.Collected) != 0 || len(r.Pending) != 1 {
+		t.Errorf("Collected a run which isn't stuck; got %v", PrettyPrint(r))
+	}
+
+	r := s.collectGarbage(req, start.Add(3*time.Hour))
+	if len(r.Collected) != 1 || r.Collected[0].Action != GarbageCollectionCancel {
+		t.Fatalf("Want the stuck run to be canceled; got %v", PrettyPrint(r))
+	}
+	if !s.takeCanceled() {
+		t.Errorf("The stuck run wasn't canceled")
+	}
+	if r := s.collectGarbage(req, start.Add(3*time.Hour)); len(r.Collected) != 0 || len(r.Pending) != 1 {
+		t.Errorf("Canceled the stuck run twice; got %v", PrettyPrint(r))
+	}
+
+	// The deployment is cleaned up as soon as the canceled run stops.
+	s.runs.now = func() time.Time { return start.Add(3 * time.Hour) }
+	s.runs.finish(PhaseApplyPlatform, errCanceled)
+	s.setBusy(false)
+	r = s.collectGarbage(req, start.Add(3*time.Hour))
+	if len(r.Collected) != 1 || r.Collected[0].Action != GarbageCollectionCleanup {
+		t.Fatalf("Want the canceled deployment to be cleaned up; got %v", PrettyPrint(r))
+	}
+}
+
+func TestKfctlServer_GarbageCollectInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newQueueTestServer(dir)
+	req := newGarbageCollectionRequest()
+	req.Config.FailedAge.Duration = time.Minute
+	if _, err := s.GarbageCollect(context.Background(), req); err == nil {
+		t.Errorf("GarbageCollect with a failed age of a minute: want an error")
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/log"
@@ -15,13 +16,19 @@ type gcServer struct {
 	k8sclient       kubeclientset.Interface
 	targetnamespace string
 	thresholdInSec  int
+	// collection if set cleans up the deployments which never succeeded; see GarbageCollectionConfig.
+	collection *GarbageCollectionConfig
+	// newClient creates a client for the kfctl server at an address; overridden in tests.
+	newClient func(address string) (KfctlService, error)
 }
 
 type GcService interface {
 	StartGC() error
 }
 
-func NewGcServer(targetnamespace string) (*gcServer, error) {
+// NewGcServer creates a server removing the idle kfctl servers in targetnamespace. If collection is
+// set it also cleans up the deployments of the kfctl servers which never succeeded.
+func NewGcServer(targetnamespace string, collection *GarbageCollectionConfig) (*gcServer, error) {
 	if targetnamespace == "" {
 		return nil, errors.WithStack(fmt.Errorf("targetnamespace must be provided"))
 	}
@@ -49,9 +56,52 @@ func NewGcServer(targetnamespace string) (*gcServer, error) {
 		targetnamespace: targetnamespace,
 		// Use default threshold 20 minutes: gc statefulset if no request in previous 20 minutes
 		thresholdInSec: 1200,
+		collection:     collection,
+		newClient: func(address string) (KfctlService, error) {
+			return NewKfctlClient(address)
+		},
 	}, nil
 }
 
+// collectAbandoned asks the kfctl server of statefulSet to clean up its deployment if it never
+// succeeded. It returns true if the deployment is abandoned or being cleaned up so the server
+// must be kept until the cleanup finishes.
+func (gc *gcServer) collectAbandoned(statefulSet *apps.StatefulSet) bool {
+	if gc.collection == nil {
+		return false
+	}
+	c, err := gc.newClient(serviceAddress(statefulSet.Name, gc.targetnamespace))
+	if err != nil {
+		log.Errorf("Could not create a client for kfctl server %v: %v", statefulSet.Name, err)
+		return false
+	}
+	report, err := c.GarbageCollect(context.Background(), GarbageCollectionRequest{
+		Config: *gc.collection,
+	})
+	if err != nil {
+		log.Errorf("Could not collect the deployment of kfctl server %v: %v", statefulSet.Name, err)
+		return false
+	}
+	for _, d := range report.Collected {
+		log.Infof("Collected deployment %v of kfctl server %v; action %v; %v", d.Name, statefulSet.Name, d.Action, d.Reason)
+	}
+	return len(report.Collected) > 0 || len(report.Pending) > 0
+}
+
+// keepAlive refreshes the last request time of statefulSet so it isn't removed while idle.
+func (gc *gcServer) keepAlive(statefulSet *apps.StatefulSet) error {
+	now, err := time.Now().MarshalText()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if statefulSet.Annotations == nil {
+		statefulSet.Annotations = map[string]string{}
+	}
+	statefulSet.Annotations[LastRequestTime] = string(now)
+	_, err = gc.k8sclient.AppsV1().StatefulSets(gc.targetnamespace).Update(statefulSet)
+	return errors.WithStack(err)
+}
+
 // GCResources delete statefulSet and corresponding service if they expired
 func (gc *gcServer) IsExpired(statefulSet *apps.StatefulSet) bool {
 	rawTime, ok := statefulSet.Annotations[LastRequestTime]
@@ -76,6 +126,13 @@ func (gc *gcServer) StartGC() error {
 			return errors.WithStack(fmt.Errorf("Error listing StatefulSets in %v: %v", gc.targetnamespace, err))
 		}
 		for _, statefulSet := range statefulSets.Items {
+			if gc.collectAbandoned(&statefulSet) {
+				// The deployment can't be cleaned up once its kfctl server is removed.
+				if err := gc.keepAlive(&statefulSet); err != nil {
+					log.Errorf("Could not keep kfctl server %v: %v", statefulSet.Name, err)
+				}
+				continue
+			}
 			if gc.IsExpired(&statefulSet) {
 				// We delete service & statefulset in reverse of creating them.
 				if err := gc.k8sclient.CoreV1().Services(gc.targetnamespace).Delete(statefulSet.Name,
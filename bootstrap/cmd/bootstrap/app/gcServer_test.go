@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	apps "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
@@ -50,3 +51,48 @@ func TestStartGC(t *testing.T) {
 		}
 	}
 }
+
+// pendingKfctlService reports its deployment is waiting to be collected.
+type pendingKfctlService struct {
+	fakeKfctlService
+}
+
+func (f *pendingKfctlService) GarbageCollect(ctx context.Context, req GarbageCollectionRequest) (*GarbageCollectionReport, error) {
+	return &GarbageCollectionReport{Collected: []CollectedDeployment{}, Pending: []string{"kf-app"}}, nil
+}
+
+func TestCollectAbandoned(t *testing.T) {
+	statefulSet := &apps.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kfctl-kf-app",
+		},
+	}
+	server := &gcServer{
+		targetnamespace: "kubeflow-admin",
+		newClient: func(address string) (KfctlService, error) {
+			if address != serviceAddress(statefulSet.Name, "kubeflow-admin") {
+				t.Errorf("Got client for %v; want the kfctl server of %v", address, statefulSet.Name)
+			}
+			return &fakeKfctlService{}, nil
+		},
+	}
+	if server.collectAbandoned(statefulSet) {
+		t.Errorf("Kept the kfctl server with garbage collection disabled")
+	}
+
+	server.collection = &GarbageCollectionConfig{
+		FailedAge: metav1.Duration{Duration: time.Hour},
+		StuckAge:  metav1.Duration{Duration: time.Hour},
+	}
+	// The fake server has no abandoned deployment so it can be removed once idle.
+	if server.collectAbandoned(statefulSet) {
+		t.Errorf("Kept the kfctl server of a deployment which isn't abandoned")
+	}
+
+	server.newClient = func(address string) (KfctlService, error) {
+		return &pendingKfctlService{}, nil
+	}
+	if !server.collectAbandoned(statefulSet) {
+		t.Errorf("The kfctl server of a deployment waiting to be collected wasn't kept")
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/cenkalti/backoff"
 	"github.com/ghodss/yaml"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
@@ -92,7 +93,7 @@ func (s *ksServer) InsertDeployment(ctx context.Context, req CreateRequest, dmSp
 	ts := oauth2.StaticTokenSource(&oauth2.Token{
 		AccessToken: req.Token,
 	})
-	deploymentmanagerService, err := deploymentmanager.New(oauth2.NewClient(ctx, ts))
+	deploymentmanagerService, err := deploymentmanager.New(gcp.NewClient(ctx, ts))
 	if err != nil {
 		deployReqCounter.WithLabelValues("INTERNAL").Inc()
 		deploymentFailure.WithLabelValues("INTERNAL").Inc()
@@ -126,7 +127,7 @@ func (s *ksServer) GetDeploymentStatus(ctx context.Context, req CreateRequest, d
 	ts := oauth2.StaticTokenSource(&oauth2.Token{
 		AccessToken: req.Token,
 	})
-	deploymentmanagerService, err := deploymentmanager.New(oauth2.NewClient(ctx, ts))
+	deploymentmanagerService, err := deploymentmanager.New(gcp.NewClient(ctx, ts))
 	if err != nil {
 		return "", "", err
 	}
@@ -242,7 +243,7 @@ func (s *ksServer) ApplyIamPolicy(ctx context.Context, req ApplyIamRequest) erro
 	ts := oauth2.StaticTokenSource(&oauth2.Token{
 		AccessToken: req.Token,
 	})
-	resourceManager, err := cloudresourcemanager.New(oauth2.NewClient(ctx, ts))
+	resourceManager, err := cloudresourcemanager.New(gcp.NewClient(ctx, ts))
 	if err != nil {
 		log.Errorf("Cannot create resource manager client: %v", err)
 		return err
@@ -320,21 +321,24 @@ type ProjectAccessChecker func(string, oauth2.TokenSource) (bool, error)
 //
 // TODO(jlewi): Add a unittest using https://onsi.github.io/gomega/#ghttp-testing-http-clients
 func CheckProjectAccess(project string, ts oauth2.TokenSource) (bool, error) {
-	ctx := context.Background()
-
-	s, err := crm.NewService(ctx, option.WithTokenSource(ts))
+	// TODO(jlewi): We use setIamPolicy as a check that we have sufficient access to the project
+	// might be better to use cluster Admin or similar permission.
+	log.Infof("Testing new token grants sufficient privileges")
+	granted, err := testIamPermissions(project, ts, []string{"resourcemanager.projects.setIamPolicy"})
+	return len(granted) > 0, err
+}
 
+// testIamPermissions returns which of the permissions the token has on the project. Failures are
+// retried with backoff for up to a minute.
+func testIamPermissions(project string, ts oauth2.TokenSource, permissions []string) ([]string, error) {
+	s, err := crm.NewService(context.Background(), option.WithTokenSource(ts))
 	if err != nil {
 		log.Errorf("Failed to create service with error; %+v", err)
-		return false, err
+		return nil, err
 	}
 
-	p := crm.NewProjectsService(s)
-
-	// TODO(jlewi): We use setIamPolicy as a check that we have sufficient access to the project
-	// might be better to use cluster Admin or similar permission.
 	req := &crm.TestIamPermissionsRequest{
-		Permissions: []string{"resourcemanager.projects.setIamPolicy"},
+		Permissions: permissions,
 	}
 
 	exp := backoff.NewExponentialBackOff()
@@ -343,24 +347,15 @@ func CheckProjectAccess(project string, ts oauth2.TokenSource) (bool, error) {
 	exp.MaxElapsedTime = time.Minute
 	exp.Reset()
 
-	isValid := false
-
-	log.Infof("Testing new token grants sufficient privileges")
+	var granted []string
 	err = backoff.Retry(func() error {
-		// Get current policy
-
-		res, err := p.TestIamPermissions(project, req).Do()
-
+		res, err := crm.NewProjectsService(s).TestIamPermissions(project, req).Do()
 		if err != nil {
 			log.Errorf("There was a problem testing IAM permissions: %v", err)
 			return err
 		}
-
-		if len(res.Permissions) > 0 {
-			isValid = true
-		}
+		granted = res.Permissions
 		return nil
 	}, exp)
-
-	return isValid, err
+	return granted, err
 }
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	batchclient "k8s.io/client-go/kubernetes/typed/batch/v1"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultHookTimeout bounds how long a hook runs if it doesn't set a timeout.
+	defaultHookTimeout = 10 * time.Minute
+	// hookJobPollInterval is how often the status of the Job of a hook is checked.
+	hookJobPollInterval = 5 * time.Second
+	// HookLabel is the label identifying the hook a Job was created for.
+	HookLabel = "kfctl.kubeflow.org/hook"
+)
+
+// HookPayload is the body POSTed to a webhook hook.
+type HookPayload struct {
+	Phase kfdefsv3.HookPhase `json:"phase"`
+	Hook  string             `json:"hook"`
+	// KfDef is the deployment without its secrets.
+	KfDef *kfdefsv3.KfDef `json:"kfDef"`
+}
+
+// hookTimeout returns the time a hook may run.
+func hookTimeout(h kfdefsv3.Hook) time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return defaultHookTimeout
+}
+
+// runHooks runs the hooks of a phase of the deployment in order and stops at the first which
+// fails. The config of the cluster is only fetched if a hook runs a Job.
+func (s *kfctlServer) runHooks(ctx context.Context, r kfdefsv3.KfDef, phase kfdefsv3.HookPhase) error {
+	d := s.kfDefGetter.GetKfDef()
+	hooks := d.HooksFor(phase)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	var client kubernetes.Interface
+	for _, h := range hooks {
+		log.Infof("Running hook %v of deployment %v at phase %v", h.Name, d.Name, phase)
+		hookCtx, cancel := context.WithTimeout(ctx, hookTimeout(h))
+		var err error
+		if h.Webhook != nil {
+			err = callWebhook(hookCtx, http.DefaultClient, h, d)
+		} else {
+			if client == nil {
+				config, configErr := s.k8sRestConfig(ctx, r)
+				if configErr != nil {
+					cancel()
+					return configErr
+				}
+				if client, err = kubernetes.NewForConfig(config); err != nil {
+					cancel()
+					return errors.WithStack(err)
+				}
+			}
+			err = runJobHook(hookCtx, client, h, d)
+		}
+		cancel()
+		if err != nil {
+			log.Errorf("Hook %v of deployment %v failed; %v", h.Name, d.Name, err)
+			return &httpError{
+				Message: fmt.Sprintf("Hook %v failed at phase %v: %v", h.Name, phase, err),
+				Code:    http.StatusPreconditionFailed,
+				cause:   err,
+			}
+		}
+	}
+	return nil
+}
+
+// callWebhook POSTs the phase and the KfDef to the webhook of the hook; it fails unless the
+// response is a 2xx.
+func callWebhook(ctx context.Context, client *http.Client, h kfdefsv3.Hook, d *kfdefsv3.KfDef) error {
+	redacted := d.DeepCopy()
+	redacted.Spec.Secrets = nil
+	body, err := json.Marshal(&HookPayload{
+		Phase: h.Phase,
+		Hook:  h.Name,
+		KfDef: redacted,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "calling webhook %v", h.Webhook.URL)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("webhook %v returned %v: %s", h.Webhook.URL, res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// hookJob returns the Job running a hook in the namespace of the deployment. Each run creates a
+// new Job so the Jobs of earlier runs are kept for their logs.
+func hookJob(h kfdefsv3.Hook, d *kfdefsv3.KfDef) *batchv1.Job {
+	spec := h.Job.DeepCopy()
+	if spec.Template.Spec.RestartPolicy == "" {
+		spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+	}
+	if spec.ActiveDeadlineSeconds == nil {
+		deadline := int64(hookTimeout(h) / time.Second)
+		spec.ActiveDeadlineSeconds = &deadline
+	}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%v-%v-", d.Name, h.Name),
+			Namespace:    d.Namespace,
+			Labels: map[string]string{
+				HookLabel: h.Name,
+			},
+		},
+		Spec: *spec,
+	}
+}
+
+// jobDone returns true if the Job finished and an error if it failed.
+func jobDone(job *batchv1.Job) (bool, error) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return true, fmt.Errorf("job %v/%v failed: %v %v", job.Namespace, job.Name, c.Reason, c.Message)
+		}
+	}
+	return false, nil
+}
+
+// runJobHook creates the Job of the hook and waits for it to finish.
+func runJobHook(ctx context.Context, client kubernetes.Interface, h kfdefsv3.Hook, d *kfdefsv3.KfDef) error {
+	jobs := client.BatchV1().Jobs(d.Namespace)
+	job, err := jobs.Create(hookJob(h, d))
+	if err != nil {
+		return errors.Wrapf(err, "creating the job of hook %v", h.Name)
+	}
+	log.Infof("Created job %v/%v for hook %v", d.Namespace, job.Name, h.Name)
+	return waitForJob(ctx, jobs, job)
+}
+
+// waitForJob polls the Job until it finishes and returns an error if it failed or ctx is done first.
+func waitForJob(ctx context.Context, jobs batchclient.JobInterface, job *batchv1.Job) error {
+	name := job.Name
+	ticker := time.NewTicker(hookJobPollInterval)
+	defer ticker.Stop()
+	for {
+		if done, err := jobDone(job); done {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("job %v/%v didn't finish in time: %v", job.Namespace, name, ctx.Err())
+		case <-ticker.C:
+		}
+		var err error
+		if job, err = jobs.Get(name, metav1.GetOptions{}); err != nil {
+			return errors.Wrapf(err, "getting job %v", name)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallWebhook(t *testing.T) {
+	var payload HookPayload
+	approved := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Could not decode the payload; %v", err)
+		}
+		if !approved {
+			http.Error(w, "deployment kf-app isn't approved", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	d := &kfdefsv3.KfDef{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kf-app",
+		},
+		Spec: kfdefsv3.KfDefSpec{
+			Secrets: []kfdefsv3.Secret{
+				{Name: "password", SecretSource: &kfdefsv3.SecretSource{LiteralSource: &kfdefsv3.LiteralSource{Value: "secret"}}},
+			},
+		},
+	}
+	h := kfdefsv3.Hook{Name: "approval", Phase: kfdefsv3.HookPreProvision, Webhook: &kfdefsv3.WebhookHook{URL: server.URL}}
+
+	if err := callWebhook(context.Background(), server.Client(), h, d); err != nil {
+		t.Fatalf("callWebhook failed; %v", err)
+	}
+	if payload.Phase != kfdefsv3.HookPreProvision || payload.Hook != "approval" || payload.KfDef == nil || payload.KfDef.Name != "kf-app" {
+		t.Errorf("Got payload %+v; want the phase, hook and KfDef", payload)
+	}
+	if len(payload.KfDef.Spec.Secrets) != 0 {
+		t.Errorf("The payload has secrets %v; want none", payload.KfDef.Spec.Secrets)
+	}
+	if len(d.Spec.Secrets) != 1 {
+		t.Errorf("callWebhook removed the secrets of the KfDef")
+	}
+
+	approved = false
+	err := callWebhook(context.Background(), server.Client(), h, d)
+	if err == nil || !strings.Contains(err.Error(), "isn't approved") {
+		t.Errorf("callWebhook of a rejecting webhook: got %v; want the rejection", err)
+	}
+}
+
+func TestHookJob(t *testing.T) {
+	d := &kfdefsv3.KfDef{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kf-app",
+			Namespace: "kubeflow",
+		},
+	}
+	h := kfdefsv3.Hook{
+		Name:           "configure",
+		Phase:          kfdefsv3.HookPostApply,
+		TimeoutSeconds: 120,
+		Job: &batchv1.JobSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "configure", Image: "gcr.io/acme/configure:v1"}},
+				},
+			},
+		},
+	}
+
+	job := hookJob(h, d)
+	if job.GenerateName != "kf-app-configure-" || job.Namespace != "kubeflow" || job.Labels[HookLabel] != "configure" {
+		t.Errorf("Got job %v/%v with labels %v; want kubeflow/kf-app-configure-", job.Namespace, job.GenerateName, job.Labels)
+	}
+	if job.Spec.Template.Spec.RestartPolicy != v1.RestartPolicyNever {
+		t.Errorf("Got restart policy %v; want %v", job.Spec.Template.Spec.RestartPolicy, v1.RestartPolicyNever)
+	}
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != 120 {
+		t.Errorf("Got deadline %v; want 120", job.Spec.ActiveDeadlineSeconds)
+	}
+	if h.Job.ActiveDeadlineSeconds != nil {
+		t.Errorf("hookJob changed the spec of the hook")
+	}
+
+	if timeout := hookTimeout(kfdefsv3.Hook{}); timeout != defaultHookTimeout {
+		t.Errorf("hookTimeout: got %v; want %v", timeout, defaultHookTimeout)
+	}
+	if timeout := hookTimeout(h); timeout != 2*time.Minute {
+		t.Errorf("hookTimeout: got %v; want 2m", timeout)
+	}
+}
+
+func TestJobDone(t *testing.T) {
+	type testCase struct {
+		conditions []batchv1.JobCondition
+		done       bool
+		failed     bool
+	}
+	cases := []testCase{
+		{},
+		{
+			conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}},
+			done:       true,
+		},
+		{
+			conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue, Reason: "DeadlineExceeded"}},
+			done:       true,
+			failed:     true,
+		},
+		{
+			conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionFalse}},
+		},
+	}
+	for i, c := range cases {
+		job := &batchv1.Job{Status: batchv1.JobStatus{Conditions: c.conditions}}
+		done, err := jobDone(job)
+		if done != c.done || (err != nil) != c.failed {
+			t.Errorf("Case %v: jobDone got %v, %v; want %v and failed %v", i, done, err, c.done, c.failed)
+		}
+	}
+}
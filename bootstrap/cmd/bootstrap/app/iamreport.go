@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"net/http"
+	"time"
+)
+
+// KfctlIamReportPath is the path on which to serve requests for the IAM bindings of the deployment
+const KfctlIamReportPath = "/kfctl/apps/v1alpha2/iam"
+
+// KfctlRevokeUnusedPath is the path on which to serve requests to revoke the unused IAM bindings of the deployment
+const KfctlRevokeUnusedPath = "/kfctl/apps/v1alpha2/iam/revoke"
+
+// defaultUnusedDays is the number of days without activity after which a binding is reported as unused.
+const defaultUnusedDays = 90
+
+// IamReportRequest requests the IAM bindings of a deployment.
+type IamReportRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// UnusedDays is the number of days without activity after which a binding is unused.
+	// Defaults to 90 for reports; it must be set to revoke bindings.
+	UnusedDays int `json:"unusedDays,omitempty"`
+	// DryRun reports the bindings RevokeUnused would revoke without revoking them.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// unusedWindow returns how long a binding must be inactive to be unused.
+func unusedWindow(req IamReportRequest, required bool) (time.Duration, error) {
+	days := req.UnusedDays
+	if days == 0 && !required {
+		days = defaultUnusedDays
+	}
+	if days <= 0 {
+		return 0, &httpError{
+			Message: "unusedDays must be a positive number of days",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// iamAuditor returns the GCP plugin of the deployment handled by the server if it is the deployment
+// in the request. The access token in the request replaces the current one.
+func (s *kfctlServer) iamAuditor(req kfdefs.KfDef) (gcp.IamAuditor, error) {
+	s.kfDefMux.Lock()
+	name := s.latestKfDef.Name
+	ts := s.ts
+	s.kfDefMux.Unlock()
+
+	if name == "" || name != req.Name || s.kfDefGetter == nil {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	if token, err := req.GetSecret(gcp.GcpAccessTokenName); err == nil && ts != nil {
+		if err := ts.Refresh(oauth2.Token{AccessToken: token}); err != nil {
+			log.Errorf("Refreshing the token failed; %v", err)
+			return nil, &httpError{
+				Message: fmt.Sprintf("Could not verify you have admin priveleges on project %v", req.Spec.Project),
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+
+	p, ok := s.kfDefGetter.GetPlugin(kftypes.GCP)
+	if !ok {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v doesn't use GCP; there are no IAM bindings to report", req.Name),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	a, ok := p.(gcp.IamAuditor)
+	if !ok {
+		log.Errorf("Plugin %v doesn't implement the IamAuditor interface", kftypes.GCP)
+		return nil, &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return a, nil
+}
+
+// GetIamReport returns the IAM bindings created for the deployment handled by the server.
+func (s *kfctlServer) GetIamReport(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	unusedFor, err := unusedWindow(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+
+	a, err := s.iamAuditor(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	report, err := a.IamPolicyReport(unusedFor)
+	if err != nil {
+		log.Errorf("Could not get the IAM bindings of %v; error %v", req.KfDef.Name, err)
+		return nil, &httpError{
+			Message: "Could not get the IAM bindings of the deployment; please try again later",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	return report, nil
+}
+
+// RevokeUnused removes the project IAM bindings of the deployment handled by the server which
+// haven't been used in the requested number of days.
+func (s *kfctlServer) RevokeUnused(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	unusedFor, err := unusedWindow(req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't change the policy while the deployment is being applied since the apply rewrites it.
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+
+	a, err := s.iamAuditor(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	report, err := a.RevokeUnused(unusedFor, req.DryRun)
+	if err != nil {
+		log.Errorf("Could not revoke the unused IAM bindings of %v; error %v", req.KfDef.Name, err)
+		return nil, &httpError{
+			Message: "Could not revoke the unused IAM bindings of the deployment; please try again later",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	return report, nil
+}
+
+// GetIamReport forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) GetIamReport(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetIamReport(ctx, req)
+}
+
+// RevokeUnused forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) RevokeUnused(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.RevokeUnused(ctx, req)
+}
+
+// GetIamReport returns the IAM bindings created for the deployment.
+func (c *KfctlClient) GetIamReport(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	return c.callIamEndpoint(ctx, "GetIamReport", c.iamReportEndpoint, req)
+}
+
+// RevokeUnused removes the project IAM bindings of the deployment which haven't been used recently.
+// It isn't retried since the report of a retry wouldn't include the bindings already revoked.
+func (c *KfctlClient) RevokeUnused(ctx context.Context, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	resp, err := c.revokeUnusedEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return iamReportResponse(resp)
+}
+
+// callIamEndpoint calls an endpoint returning an IamPolicyReport retrying failures.
+func (c *KfctlClient) callIamEndpoint(ctx context.Context, method string, e endpoint.Endpoint, req IamReportRequest) (*gcp.IamPolicyReport, error) {
+	var resp interface{}
+	err := c.retry(method, func() error {
+		var err error
+		resp, err = e(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return iamReportResponse(resp)
+}
+
+// iamReportResponse asserts the response of an endpoint is an IamPolicyReport.
+func iamReportResponse(resp interface{}) (*gcp.IamPolicyReport, error) {
+	response, ok := resp.(*gcp.IamPolicyReport)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeIamReportEndpoint creates an endpoint to handle requests for the IAM bindings of the deployment.
+func makeIamReportEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(IamReportRequest)
+		return svc.GetIamReport(ctx, req)
+	}
+}
+
+// makeRevokeUnusedEndpoint creates an endpoint to handle requests to revoke unused IAM bindings.
+func makeRevokeUnusedEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(IamReportRequest)
+		return svc.RevokeUnused(ctx, req)
+	}
+}
+
+// decodeHTTPIamReportRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded IamReportRequest from the HTTP request body.
+func decodeHTTPIamReportRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request IamReportRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding IAM report request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUnusedWindow(t *testing.T) {
+	type testCase struct {
+		days     int
+		required bool
+		expected time.Duration
+		code     int
+	}
+
+	cases := []testCase{
+		{days: 0, required: false, expected: defaultUnusedDays * 24 * time.Hour},
+		{days: 30, required: false, expected: 30 * 24 * time.Hour},
+		{days: 30, required: true, expected: 30 * 24 * time.Hour},
+		{days: 0, required: true, code: http.StatusBadRequest},
+		{days: -1, required: false, code: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		actual, err := unusedWindow(IamReportRequest{UnusedDays: c.days}, c.required)
+		if c.code != 0 {
+			if hErr, ok := err.(*httpError); !ok || hErr.Code != c.code {
+				t.Errorf("unusedWindow(%v, %v): want %v; got %v", c.days, c.required, c.code, err)
+			}
+			continue
+		}
+		if err != nil || actual != c.expected {
+			t.Errorf("unusedWindow(%v, %v): got %v, %v; want %v", c.days, c.required, actual, err, c.expected)
+		}
+	}
+}
+
+func TestKfctlServer_IamReportNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamreport")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := IamReportRequest{KfDef: newPlanTestKfDef(), UnusedDays: 30}
+
+	// The KfApp isn't loaded until the deployment is applied.
+	_, err = s.GetIamReport(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("GetIamReport before the deployment is applied: want 404; got %v", err)
+	}
+
+	req.KfDef.Name = "other"
+	_, err = s.RevokeUnused(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("RevokeUnused of another deployment: want 404; got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"github.com/go-kit/kit/endpoint"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
@@ -34,7 +35,7 @@ func (s *ksServer) BindRole(ctx context.Context, project string, token string, s
 	ts := oauth2.StaticTokenSource(&oauth2.Token{
 		AccessToken: token,
 	})
-	resourcManger, err := cloudresourcemanager.New(oauth2.NewClient(ctx, ts))
+	resourcManger, err := cloudresourcemanager.New(gcp.NewClient(ctx, ts))
 	if err != nil {
 		log.Errorf("Cannot create resourc manger client: %v", err)
 		return err
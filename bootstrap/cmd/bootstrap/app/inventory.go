@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// KfctlInventoryPath is the path on which to serve requests for the resources created for the deployment
+const KfctlInventoryPath = "/kfctl/apps/v1alpha2/inventory"
+
+// Inventory lists the cloud and K8s resources created for a deployment in the order they were created.
+type Inventory struct {
+	Name      string                     `json:"name"`
+	Project   string                     `json:"project"`
+	Resources []kfdefs.InventoryResource `json:"resources"`
+}
+
+// GetInventory returns the resources created for the deployment handled by the server.
+func (s *kfctlServer) GetInventory(ctx context.Context, req kfdefs.KfDef) (*Inventory, error) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+
+	if s.latestKfDef.Name == "" || s.latestKfDef.Name != req.Name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	latest := s.latestKfDef.DeepCopy()
+	return &Inventory{
+		Name:      latest.Name,
+		Project:   latest.Spec.Project,
+		Resources: latest.Status.Inventory,
+	}, nil
+}
+
+// GetInventory forwards the request to the replicas of the backend handling the deployment which serve reads.
+func (r *kfctlRouter) GetInventory(ctx context.Context, req kfdefs.KfDef) (*Inventory, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.readClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInventory(ctx, req)
+}
+
+// GetInventory returns the resources created for the deployment.
+func (c *KfctlClient) GetInventory(ctx context.Context, req kfdefs.KfDef) (*Inventory, error) {
+	var resp interface{}
+	err := c.retry("GetInventory", func() error {
+		var err error
+		resp, err = c.inventoryEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*Inventory)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeInventoryEndpoint creates an endpoint to handle requests for the inventory of the deployment.
+func makeInventoryEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.GetInventory(ctx, req)
+	}
+}
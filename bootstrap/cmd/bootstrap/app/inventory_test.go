@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestKfctlServer_GetInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	s.latestKfDef.RecordResource(kfdefs.InventoryResource{
+		Kind:    "container.v1.cluster",
+		Name:    s.latestKfDef.Name,
+		Project: s.latestKfDef.Spec.Project,
+		Source:  s.latestKfDef.Name,
+	})
+	req := newPlanTestKfDef()
+
+	inventory, err := s.GetInventory(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if inventory.Name != req.Name || len(inventory.Resources) != 1 || inventory.Resources[0].Kind != "container.v1.cluster" {
+		t.Errorf("GetInventory: got %+v", inventory)
+	}
+
+	// The inventory is a copy of the status.
+	inventory.Resources[0].Name = "changed"
+	if s.latestKfDef.Status.Inventory[0].Name == "changed" {
+		t.Errorf("GetInventory returned the inventory of the latest KfDef rather than a copy")
+	}
+
+	req.Name = "other"
+	_, err = s.GetInventory(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("GetInventory of another deployment: want 404; got %v", err)
+	}
+}
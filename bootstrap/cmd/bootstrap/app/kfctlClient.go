@@ -8,8 +8,13 @@ import (
 	"github.com/go-kit/kit/ratelimit"
 	httptransport "github.com/go-kit/kit/transport/http"
 	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
 	"golang.org/x/time/rate"
+	"io"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -17,61 +22,383 @@ import (
 
 // KfctlClient provides a client to the KfctlServer
 type KfctlClient struct {
-	createEndpoint endpoint.Endpoint
-	getEndpoint    endpoint.Endpoint
+	createEndpoint    endpoint.Endpoint
+	getEndpoint       endpoint.Endpoint
+	getTableEndpoint  endpoint.Endpoint
+	lintEndpoint      endpoint.Endpoint
+	convertEndpoint   endpoint.Endpoint
+	errorsEndpoint    endpoint.Endpoint
+	revisionsEndpoint endpoint.Endpoint
+	planEndpoint      endpoint.Endpoint
+	executeEndpoint   endpoint.Endpoint
+	cloneEndpoint     endpoint.Endpoint
+	connEndpoint      endpoint.Endpoint
+	maintEndpoint     endpoint.Endpoint
+	maintRunEndpoint  endpoint.Endpoint
+	statsEndpoint     endpoint.Endpoint
+	trendsEndpoint    endpoint.Endpoint
+	retryEndpoint     endpoint.Endpoint
+	pauseEndpoint     endpoint.Endpoint
+	resumeEndpoint    endpoint.Endpoint
+	cancelEndpoint    endpoint.Endpoint
+	listEndpoint      endpoint.Endpoint
+	listTableEndpoint endpoint.Endpoint
+	deleteEndpoint    endpoint.Endpoint
+
+	iamReportEndpoint      endpoint.Endpoint
+	revokeUnusedEndpoint   endpoint.Endpoint
+	metadataEndpoint       endpoint.Endpoint
+	verifyEndpoint         endpoint.Endpoint
+	inventoryEndpoint      endpoint.Endpoint
+	runLogEndpoint         endpoint.Endpoint
+	logsEndpoint           endpoint.Endpoint
+	migrateEndpoint        endpoint.Endpoint
+	backupEndpoint         endpoint.Endpoint
+	restoreEndpoint        endpoint.Endpoint
+	upgradePreviewEndpoint endpoint.Endpoint
+	reencryptEndpoint      endpoint.Endpoint
+	defaultsEndpoint       endpoint.Endpoint
+	versionsEndpoint       endpoint.Endpoint
+	prepareDeleteEndpoint  endpoint.Endpoint
+	gcEndpoint             endpoint.Endpoint
+	oauthClientEndpoint    endpoint.Endpoint
+	shareEndpoint          endpoint.Endpoint
+
+	// exportURL is the URL archives are downloaded from. Downloads are streamed to disk
+	// so they are made with httpClient rather than an endpoint.
+	exportURL  *url.URL
+	httpClient *http.Client
+
+	// listURL is the URL deployments are listed from by StreamDeployments. The response is
+	// decoded as it is received so it is made with httpClient rather than an endpoint.
+	listURL *url.URL
+
+	// basePath is the path prefix of the instance the client was created with.
+	basePath string
+
+	// balancer if non nil spreads requests over the replicas of the server; exportURL and
+	// listURL are then resolved to an available replica with balancedURL.
+	balancer *instanceBalancer
+
+	// newBackOff returns the backoff policy used to retry requests.
+	newBackOff func() backoff.BackOff
+
+	// retryBudget bounds the retries of all methods.
+	retryBudget *RetryBudget
+
+	// progress if non nil is notified of retries and server reported progress.
+	progress ProgressFunc
+
+	// tokenSource if non nil provides the access token set on each request.
+	tokenSource oauth2.TokenSource
+
+	// hooks if non nil are called around the requests.
+	hooks *ClientHooks
+}
+
+// KfctlClientOption configures optional behavior of the KfctlClient.
+type KfctlClientOption func(*kfctlClientOptions)
+
+type kfctlClientOptions struct {
+	httpClient  *http.Client
+	newBackOff  func() backoff.BackOff
+	retryBudget *RetryBudget
+	progress    ProgressFunc
+	yaml        bool
+	protobuf    bool
+	tokenSource oauth2.TokenSource
+	hooks       *ClientHooks
+}
+
+// WithHTTPClient sets the http.Client used to talk to the server.
+// This can be used to inject a custom transport e.g. a FaultInjector during testing.
+func WithHTTPClient(c *http.Client) KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.httpClient = c
+	}
+}
+
+// WithYAMLRequests sends request bodies as YAML instead of JSON.
+// Responses are still decoded as JSON.
+func WithYAMLRequests() KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.yaml = true
+	}
+}
+
+// WithProtobuf sends KfDef request bodies as protobuf and asks for KfDef responses as protobuf.
+// Protobuf is smaller than JSON and plugin specs are passed through unchanged.
+// Other requests and responses are JSON. It takes precedence over WithYAMLRequests.
+func WithProtobuf() KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.protobuf = true
+	}
+}
+
+// WithRetryBackOff sets the function used to create the backoff policy for retrying requests.
+func WithRetryBackOff(f func() backoff.BackOff) KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.newBackOff = f
+	}
+}
+
+// defaultRetryBackOff is the backoff used when WithRetryBackOff isn't supplied.
+func defaultRetryBackOff() backoff.BackOff {
+	return backoff.WithMaxRetries(backoff.NewConstantBackOff(2*time.Second), 30)
 }
 
 // NewKfctlClient returns a KfctlClient backed by an HTTP server living at the
 // remote instance.
-func NewKfctlClient(instance string) (KfctlService, error) {
-	// Quickly sanitize the instance string.
-	if !strings.HasPrefix(instance, "http") {
-		instance = "http://" + instance
-	}
-	u, err := url.Parse(instance)
+//
+// instance may list the replicas of the server separated by commas or be a DNS SRV name
+// e.g. of a headless service prefixed with SrvInstancePrefix. Requests are then sent to
+// the replicas round robin. A request is sent to the next replica if a replica can't be
+// reached or is overloaded, and unreachable replicas are skipped for a while.
+//
+// instance may also be the path of the unix socket of a server on the same machine prefixed
+// with UnixInstancePrefix e.g. that of a LocalServer. A client set with WithHTTPClient must
+// then dial the socket itself.
+func NewKfctlClient(instance string, opts ...KfctlClientOption) (KfctlService, error) {
+	c, f, err := newKfctlClientBase(instance, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	// We construct a single ratelimiter middleware, to limit the total outgoing
-	// QPS from this client to all methods on the remote instance. We also
-	// construct per-endpoint circuitbreaker middlewares to demonstrate how
-	// that's done, although they could easily be combined into a single breaker
-	// for the entire remote instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
-
-	// Each individual endpoint is an http/transport.Client (which implements
-	// endpoint.Endpoint) that gets wrapped with various middlewares. If you
-	// made your own client library, you'd do this work there, so your server
-	// could rely on a consistent set of client behavior.
-	var createEndpoint endpoint.Endpoint
-	{
-		createEndpoint = httptransport.NewClient(
-			"POST",
-			copyURL(u, KfctlCreatePath),
-			encodeHTTPGenericRequest,
-			decodeHTTPKfdefResponse,
-		).Endpoint()
-		createEndpoint = limiter(createEndpoint)
+	c.createEndpoint = f.endpoint("CreateDeployment", KfctlCreatePath, decodeHTTPKfdefResponse)
+	c.getEndpoint = f.endpoint("GetLatestKfdef", KfctlGetpath, decodeHTTPKfdefResponse)
+	c.getTableEndpoint = f.tableEndpoint("GetLatestKfdefTable", KfctlGetpath)
+	c.lintEndpoint = f.endpoint("Lint", KfctlLintPath,
+		makeHTTPResponseDecoder(func() interface{} { return &LintResult{} }))
+	c.convertEndpoint = f.endpoint("Convert", KfctlConvertPath,
+		makeHTTPResponseDecoder(func() interface{} { return &ConversionResult{} }))
+	c.errorsEndpoint = f.endpoint("GetErrorHistory", KfctlErrorsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &ErrorHistory{} }))
+	c.revisionsEndpoint = f.endpoint("GetRevisionDiff", KfctlRevisionDiffPath,
+		makeHTTPResponseDecoder(func() interface{} { return &RevisionDiff{} }))
+	c.planEndpoint = f.endpoint("Plan", KfctlPlanPath,
+		makeHTTPResponseDecoder(func() interface{} { return &DeploymentPlan{} }))
+	c.executeEndpoint = f.endpoint("Execute", KfctlExecutePath, decodeHTTPKfdefResponse)
+	c.cloneEndpoint = f.endpoint("Clone", KfctlClonePath, decodeHTTPKfdefResponse)
+	c.connEndpoint = f.endpoint("GetConnectionInfo", KfctlConnectionInfoPath,
+		makeHTTPResponseDecoder(func() interface{} { return &ConnectionInfo{} }))
+	c.maintEndpoint = f.endpoint("ScheduleMaintenance", KfctlMaintenancePath,
+		makeHTTPResponseDecoder(func() interface{} { return &MaintenanceSchedule{} }))
+	c.maintRunEndpoint = f.endpoint("RunMaintenance", KfctlMaintenanceRunPath,
+		makeHTTPResponseDecoder(func() interface{} { return &MaintenanceEvent{} }))
+	c.statsEndpoint = f.endpoint("GetStats", KfctlStatsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &DeploymentStats{} }))
+	c.trendsEndpoint = f.endpoint("GetDurationTrends", KfctlDurationTrendsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &DurationTrends{} }))
+	c.retryEndpoint = f.endpoint("RetryFailedApps", KfctlRetryFailedAppsPath, decodeHTTPKfdefResponse)
+	c.pauseEndpoint = f.endpoint("Pause", KfctlPausePath, decodeHTTPKfdefResponse)
+	c.resumeEndpoint = f.endpoint("Resume", KfctlResumePath, decodeHTTPKfdefResponse)
+	c.cancelEndpoint = f.endpoint("Cancel", KfctlCancelPath, decodeHTTPKfdefResponse)
+	c.listEndpoint = f.endpoint("ListDeployments", KfctlListPath,
+		makeHTTPResponseDecoder(func() interface{} { return &DeploymentList{} }))
+	c.listTableEndpoint = f.tableEndpoint("ListDeploymentsTable", KfctlListPath)
+	c.deleteEndpoint = f.endpoint("DeleteDeployment", KfctlDeletePath, decodeHTTPKfdefResponse)
+	c.prepareDeleteEndpoint = f.endpoint("PrepareDelete", KfctlPrepareDeletePath,
+		makeHTTPResponseDecoder(func() interface{} { return &DeletePlan{} }))
+	c.iamReportEndpoint = f.endpoint("GetIamReport", KfctlIamReportPath,
+		makeHTTPResponseDecoder(func() interface{} { return &gcp.IamPolicyReport{} }))
+	c.revokeUnusedEndpoint = f.endpoint("RevokeUnused", KfctlRevokeUnusedPath,
+		makeHTTPResponseDecoder(func() interface{} { return &gcp.IamPolicyReport{} }))
+	c.metadataEndpoint = f.endpoint("UpdateMetadata", KfctlMetadataPath, decodeHTTPKfdefResponse)
+	c.verifyEndpoint = f.endpoint("VerifyManifests", KfctlVerifyPath,
+		makeHTTPResponseDecoder(func() interface{} { return &kustomize.ManifestVerification{} }))
+	c.inventoryEndpoint = f.endpoint("GetInventory", KfctlInventoryPath,
+		makeHTTPResponseDecoder(func() interface{} { return &Inventory{} }))
+	c.runLogEndpoint = f.endpoint("GetRunLog", KfctlRunLogPath,
+		makeHTTPResponseDecoder(func() interface{} { return &RunLog{} }))
+	c.logsEndpoint = f.endpoint("GetLogs", KfctlLogsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &LogPage{} }))
+	c.migrateEndpoint = f.endpoint("Migrate", KfctlMigratePath,
+		makeHTTPResponseDecoder(func() interface{} { return &MigrationReport{} }))
+	c.backupEndpoint = f.endpoint("Backup", KfctlBackupPath,
+		makeHTTPResponseDecoder(func() interface{} { return &kustomize.ResourceSnapshot{} }))
+	c.restoreEndpoint = f.endpoint("Restore", KfctlRestorePath,
+		makeHTTPResponseDecoder(func() interface{} { return &kustomize.RestoreReport{} }))
+	c.upgradePreviewEndpoint = f.endpoint("PreviewUpgrade", KfctlUpgradePreviewPath,
+		makeHTTPResponseDecoder(func() interface{} { return &UpgradePreview{} }))
+	c.reencryptEndpoint = f.endpoint("Reencrypt", KfctlReencryptPath,
+		makeHTTPResponseDecoder(func() interface{} { return &ReencryptionReport{} }))
+	c.defaultsEndpoint = f.endpoint("GetKfDefDefaults", KfctlDefaultsPath, decodeHTTPKfdefResponse)
+	c.versionsEndpoint = f.endpoint("ListVersions", KfctlVersionsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &VersionList{} }))
+	c.gcEndpoint = f.endpoint("GarbageCollect", KfctlGarbageCollectPath,
+		makeHTTPResponseDecoder(func() interface{} { return &GarbageCollectionReport{} }))
+	c.oauthClientEndpoint = f.endpoint("CheckOAuthClient", KfctlOAuthClientPath,
+		makeHTTPResponseDecoder(func() interface{} { return &gcp.OAuthClientReport{} }))
+	c.shareEndpoint = f.endpoint("ShareDeployment", KfctlSharePath,
+		makeHTTPResponseDecoder(func() interface{} { return &SharedLink{} }))
+	c.exportURL = copyURL(f.instance, KfctlExportPath)
+
+	// Returning the endpoint.Set as a service.Service relies on the
+	// endpoint.Set implementing the Service methods. That's just a simple bit
+	// of glue code.
+	return c, nil
+}
+
+// clientEndpointFactory creates the endpoints of a client to a remote instance.
+type clientEndpointFactory struct {
+	instance *url.URL
+	// balancer if non nil spreads the requests over several instances.
+	balancer      *instanceBalancer
+	encodeRequest httptransport.EncodeRequestFunc
+	options       *kfctlClientOptions
+	limiter       endpoint.Middleware
+}
+
+// endpoint returns the endpoint POSTing requests for method to path on the remote instance.
+// The extra options are applied after the options of the client.
+//
+// Each individual endpoint is an http/transport.Client (which implements
+// endpoint.Endpoint) that gets wrapped with various middlewares. If you
+// made your own client library, you'd do this work there, so your server
+// could rely on a consistent set of client behavior.
+func (f *clientEndpointFactory) endpoint(method string, path string, dec httptransport.DecodeResponseFunc, extra ...httptransport.ClientOption) endpoint.Endpoint {
+	var options []httptransport.ClientOption
+	if f.options.httpClient != nil {
+		options = append(options, httptransport.SetClient(f.options.httpClient))
+	}
+	if f.options.progress != nil {
+		options = append(options, httptransport.ClientAfter(makeProgressResponseFunc(method, f.options.progress)))
 	}
-	var getEndpoint endpoint.Endpoint
-	{
-		getEndpoint = httptransport.NewClient(
+	options = append(options, httptransport.ClientAfter(makeDeprecationResponseFunc(method, f.options.progress)))
+	options = append(options, httptransport.ClientAfter(recordRetryAfter))
+	options = append(options, httptransport.ClientAfter(recordProgress))
+	options = append(options, httptransport.ClientBefore(setDeadlineHeader))
+	if f.options.hooks != nil {
+		options = append(options, httptransport.ClientBefore(recordHookRequest), httptransport.ClientAfter(recordHookResponse))
+	}
+	options = append(options, extra...)
+	var e endpoint.Endpoint
+	if f.balancer == nil {
+		e = httptransport.NewClient(
 			"POST",
-			copyURL(u, KfctlCreatePath),
-			encodeHTTPGenericRequest,
-			decodeHTTPKfdefResponse,
+			copyURL(f.instance, path),
+			f.encodeRequest,
+			dec,
+			options...,
 		).Endpoint()
-		getEndpoint = limiter(getEndpoint)
+	} else {
+		e = f.balancer.endpoint(func(instance string) (endpoint.Endpoint, io.Closer, error) {
+			u, err := instanceURL(instance)
+			if err != nil {
+				return nil, nil, err
+			}
+			return httptransport.NewClient("POST", copyURL(u, path), f.encodeRequest, dec, options...).Endpoint(), nil, nil
+		})
+	}
+	e = f.limiter(e)
+	// The hooks are outermost so they also see the requests rejected by the rate limiter.
+	if f.options.hooks != nil {
+		e = hooksMiddleware(method, f.options.hooks)(e)
 	}
+	return e
+}
 
-	// Returning the endpoint.Set as a service.Service relies on the
-	// endpoint.Set implementing the Service methods. That's just a simple bit
-	// of glue code.
+// newKfctlClientBase applies the options and returns a KfctlClient without any endpoints and
+// the factory creating them. Clients only get the endpoints their constructor creates.
+func newKfctlClientBase(instance string, opts []KfctlClientOption) (*KfctlClient, *clientEndpointFactory, error) {
+	o := &kfctlClientOptions{
+		newBackOff: defaultRetryBackOff,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.retryBudget == nil {
+		o.retryBudget = defaultRetryBudget()
+	}
+
+	if strings.HasPrefix(instance, UnixInstancePrefix) {
+		// Requests are sent to the socket whatever the host of their URL.
+		if o.httpClient == nil {
+			o.httpClient = newUnixSocketClient(strings.TrimPrefix(instance, UnixInstancePrefix))
+		}
+		instance = "http://" + unixSocketHost
+	}
+
+	encodeRequest := encodeHTTPGenericRequest
+	if o.yaml {
+		encodeRequest = encodeHTTPYAMLRequest
+	}
+	if o.protobuf {
+		encodeRequest = encodeHTTPProtobufRequest
+	}
+	if o.tokenSource != nil {
+		encodeRequest = encodeWithToken(o.tokenSource, encodeRequest)
+	}
+
+	balancer, u, err := newInstanceBalancer(instance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpClient := http.DefaultClient
+	if o.httpClient != nil {
+		httpClient = o.httpClient
+	}
+
+	// We construct a single ratelimiter middleware, to limit the total outgoing
+	// QPS from this client to all methods on the remote instance.
+	f := &clientEndpointFactory{
+		instance:      u,
+		balancer:      balancer,
+		encodeRequest: encodeRequest,
+		options:       o,
+		limiter:       ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100)),
+	}
 	return &KfctlClient{
-		createEndpoint: createEndpoint,
-		getEndpoint:    getEndpoint,
-	}, nil
+		basePath:    u.Path,
+		listURL:     copyURL(u, KfctlListPath),
+		balancer:    balancer,
+		httpClient:  httpClient,
+		newBackOff:  o.newBackOff,
+		retryBudget: o.retryBudget,
+		progress:    o.progress,
+		tokenSource: o.tokenSource,
+		hooks:       o.hooks,
+	}, f, nil
+}
+
+// balancedURL returns u or, if the client spreads requests over several replicas of the
+// server, the path of u on the next available replica.
+func (c *KfctlClient) balancedURL(u *url.URL) (*url.URL, error) {
+	if c.balancer == nil {
+		return u, nil
+	}
+	// Each replica has its own path prefix.
+	return c.balancer.url(strings.TrimPrefix(u.Path, c.basePath))
+}
+
+// notifyRetry returns a backoff.Notify which reports retries of method as progress events.
+func (c *KfctlClient) notifyRetry(method string) backoff.Notify {
+	attempt := 0
+	return func(err error, next time.Duration) {
+		attempt++
+		log.Infof("%v attempt %v failed; retrying in %v; error %v", method, attempt, next, err)
+		if c.hooks != nil && c.hooks.OnRetry != nil {
+			c.hooks.OnRetry(RetryInfo{
+				Method:    method,
+				Attempt:   attempt,
+				Err:       err,
+				NextRetry: next,
+			})
+		}
+		if c.progress == nil {
+			return
+		}
+		c.progress(ProgressEvent{
+			Type:      ProgressRetry,
+			Method:    method,
+			Time:      time.Now(),
+			Attempt:   attempt,
+			Err:       err,
+			NextRetry: next,
+		})
+	}
 }
 
 // CreateDeployment issues a CreateDeployment to the requested backend
@@ -79,14 +406,21 @@ func (c *KfctlClient) CreateDeployment(ctx context.Context, req kfdefs.KfDef) (*
 	var resp interface{}
 	var err error
 	// Add retry logic
-	bo := backoff.WithMaxRetries(backoff.NewConstantBackOff(2*time.Second), 30)
-	permErr := backoff.Retry(func() error {
+	permErr := c.retry("CreateDeployment", func() error {
 		resp, err = c.createEndpoint(ctx, req)
 		if err != nil {
+			if IsValidationError(err) {
+				// Resending an invalid request won't help.
+				return backoff.Permanent(err)
+			}
+			if l, ok := err.(*RequestLimitError); ok && l.Code == http.StatusRequestEntityTooLarge {
+				// Neither will resending one which is too large.
+				return backoff.Permanent(err)
+			}
 			return err
 		}
 		return nil
-	}, bo)
+	})
 
 	if permErr != nil {
 		return nil, permErr
@@ -112,7 +446,11 @@ func (c *KfctlClient) CreateDeployment(ctx context.Context, req kfdefs.KfDef) (*
 }
 
 func (c *KfctlClient) GetLatestKfdef(req kfdefs.KfDef) (*kfdefs.KfDef, error) {
-	resp, err := c.getEndpoint(context.Background(), req)
+	return c.getLatestKfdef(context.Background(), req)
+}
+
+func (c *KfctlClient) getLatestKfdef(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	resp, err := c.getEndpoint(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -135,3 +473,259 @@ func (c *KfctlClient) GetLatestKfdef(req kfdefs.KfDef) (*kfdefs.KfDef, error) {
 	log.Errorf("Recieved unexpected response; %v", pRes)
 	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
 }
+
+// TypedKfDef is a KfDef with the specs of its plugins decoded to their registered types.
+type TypedKfDef struct {
+	*kfdefs.KfDef
+	// PluginSpecs maps the names of the plugins to their specs e.g. gcp to a *gcp.GcpPluginSpec.
+	// Plugins without a registered spec are omitted.
+	PluginSpecs map[string]kfdefs.PluginSpec
+}
+
+// GetTypedKfdef returns the latest KfDef of the deployment with the specs of its plugins typed.
+// An error is returned if a plugin spec doesn't match its registered type.
+func (c *KfctlClient) GetTypedKfdef(req kfdefs.KfDef) (*TypedKfDef, error) {
+	d, err := c.GetLatestKfdef(req)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := d.TypedPluginSpecs()
+	if err != nil {
+		return nil, err
+	}
+	return &TypedKfDef{
+		KfDef:       d,
+		PluginSpecs: specs,
+	}, nil
+}
+
+// Lint asks the server to validate the KfDef and report warnings about risky configurations.
+func (c *KfctlClient) Lint(ctx context.Context, req kfdefs.KfDef) (*LintResult, error) {
+	resp, err := c.lintEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*LintResult)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// Convert asks the server to convert the app.yaml of the ksonnet based kfctl to a KfDef using kustomize.
+func (c *KfctlClient) Convert(ctx context.Context, req kfdefs.KfDef) (*ConversionResult, error) {
+	resp, err := c.convertEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*ConversionResult)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// GetKfDefDefaults asks the server for the KfDef it uses for a platform and Kubeflow version.
+func (c *KfctlClient) GetKfDefDefaults(ctx context.Context, req DefaultsRequest) (*kfdefs.KfDef, error) {
+	resp, err := c.defaultsEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kfdefs.KfDef)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// GetErrorHistory returns the most recent errors encountered by the server while handling the deployment.
+func (c *KfctlClient) GetErrorHistory(ctx context.Context, req kfdefs.KfDef) (*ErrorHistory, error) {
+	resp, err := c.errorsEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*ErrorHistory)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// GetRevisionDiff returns the changes made by a revision of the deployment.
+func (c *KfctlClient) GetRevisionDiff(ctx context.Context, req RevisionDiffRequest) (*RevisionDiff, error) {
+	resp, err := c.revisionsEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*RevisionDiff)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// Plan asks the server for the actions CreateDeployment would take for the KfDef.
+func (c *KfctlClient) Plan(ctx context.Context, req kfdefs.KfDef) (*DeploymentPlan, error) {
+	resp, err := c.planEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*DeploymentPlan)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// Execute creates the deployment for a plan previously returned by Plan.
+func (c *KfctlClient) Execute(ctx context.Context, req ExecuteRequest) (*kfdefs.KfDef, error) {
+	var resp interface{}
+	err := c.retry("Execute", func() error {
+		var err error
+		resp, err = c.executeEndpoint(ctx, req)
+		if hErr, ok := err.(*httpError); ok && hErr.Code == http.StatusConflict {
+			// The plan is stale; retrying won't help.
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kfdefs.KfDef)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// Clone creates a new deployment from the KfDef of an existing deployment.
+func (c *KfctlClient) Clone(ctx context.Context, req CloneRequest) (*kfdefs.KfDef, error) {
+	resp, err := c.cloneEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kfdefs.KfDef)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// GetConnectionInfo returns a kubeconfig and the endpoint for the deployment.
+func (c *KfctlClient) GetConnectionInfo(ctx context.Context, req kfdefs.KfDef) (*ConnectionInfo, error) {
+	resp, err := c.connEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*ConnectionInfo)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// ScheduleMaintenance configures the recurring maintenance tasks of the deployment and returns the schedule.
+func (c *KfctlClient) ScheduleMaintenance(ctx context.Context, req MaintenanceRequest) (*MaintenanceSchedule, error) {
+	resp, err := c.maintEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*MaintenanceSchedule)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// RunMaintenance runs a maintenance task of the deployment now. Requests aren't retried since a
+// retry could run the task twice e.g. creating a second key.
+func (c *KfctlClient) RunMaintenance(ctx context.Context, req MaintenanceRunRequest) (*MaintenanceEvent, error) {
+	resp, err := c.maintRunEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*MaintenanceEvent)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// GetStats returns a summary of the recent runs of the deployments in a project.
+func (c *KfctlClient) GetStats(ctx context.Context, req StatsRequest) (*DeploymentStats, error) {
+	resp, err := c.statsEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*DeploymentStats)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// GetDurationTrends returns percentiles of the durations of the deployments in a project over time.
+func (c *KfctlClient) GetDurationTrends(ctx context.Context, req DurationTrendsRequest) (*DurationTrends, error) {
+	resp, err := c.trendsEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*DurationTrends)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
@@ -10,7 +10,6 @@ import (
 	"cloud.google.com/go/container/apiv1"
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
@@ -20,18 +19,23 @@ import (
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/coordinator"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/simulate"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"io/ioutil"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"net/http"
 	"os"
 	"path"
 	"sync"
+	"time"
 )
 
 const (
@@ -70,6 +74,109 @@ type kfctlServer struct {
 
 	// Server status, running or Frozen.
 	serverStatus int
+
+	// faults if non nil injects faults into responses; only used for testing clients.
+	faults *FaultInjector
+
+	// targetCluster if non nil is the cluster deployments are applied to instead of a GKE cluster
+	// created for them; GCP credentials aren't used. Only used for end to end tests e.g. with kind.
+	targetCluster *rest.Config
+
+	// simulate if true simulates deployments with the simulate platform and package manager
+	// instead of deploying them; GCP credentials aren't used. Only used for demos and tests.
+	simulate bool
+
+	// errHistory keeps the most recent errors for each deployment.
+	errHistory *errorHistory
+
+	// runLog keeps the log of the latest run at the verbosity of its request.
+	runLog *runLogger
+	// logBuffer keeps the recent output of the runs in memory whatever their verbosity.
+	logBuffer *logBuffer
+
+	// phase is the pipeline phase of the current deployment and phaseStart when it started.
+	// Protected by kfDefMux.
+	phase      DeploymentPhase
+	phaseStart time.Time
+
+	// busy is true while a deployment is being handled; protected by kfDefMux.
+	// idle is signaled when handling stops while the server is draining.
+	busy bool
+	idle chan struct{}
+
+	// resumePhase if set is the phase to resume the checkpointed deployment from.
+	resumePhase DeploymentPhase
+
+	// canceled is set to stop the in-flight deployment at the next phase boundary; protected by kfDefMux.
+	canceled bool
+
+	// paused is true while an operator paused the deployment; protected by kfDefMux.
+	// resumed is closed to release the pipeline held at a phase boundary.
+	paused  bool
+	resumed chan struct{}
+
+	// deployTs is the TokenSource used to run the deployment; it generates tokens for the
+	// service account minted for the deployment or falls back to ts.
+	deployTs oauth2.TokenSource
+
+	// opMux serializes handling deployments and running maintenance tasks.
+	opMux sync.Mutex
+
+	// runs keeps the recent runs of the deployment for computing stats.
+	runs *runHistory
+
+	// revisions keeps the changes made by the recent updates of the deployment.
+	revisions *revisionHistory
+
+	// config is the reloadable config of the server.
+	config *serverConfigStore
+
+	// telemetry reports the outcomes of the deployments which opted in to usage reporting.
+	telemetry *telemetryReporter
+
+	// metadata is the description, owner contact and labels of the deployment; protected by kfDefMux.
+	metadata DeploymentMetadata
+
+	// deadline if set is when the client which requested the deployment being handled gives up.
+	// Only used by the goroutine handling deployments.
+	deadline time.Time
+
+	// applyingDeferred is true if the KfApp is configured to apply a deferred update as the deployer
+	// of the deployment; see takeDeferredApply. Only used by the goroutine handling deployments.
+	applyingDeferred bool
+
+	// appliedHash is the hash of the request last applied successfully; empty if the next request
+	// must be applied. Protected by kfDefMux.
+	appliedHash string
+
+	// jobClient is the client of the cluster the server runs in used to run phases as Jobs; it is
+	// created the first time a phase runs as a Job.
+	jobClient kubernetes.Interface
+
+	// standby is true if the server is a standby replica serving reads from the state published by
+	// the leader; publishesStatus is true if the server is the leader of standby replicas.
+	standby         bool
+	publishesStatus bool
+
+	// certStop is closed to stop reporting the provisioning of the managed certificate of the
+	// deployment; protected by kfDefMux.
+	certStop chan struct{}
+
+	// deleteConfirmation is the token issued to delete the deployment; protected by kfDefMux.
+	deleteConfirmation *deleteConfirmation
+
+	// gcCanceled is true if the garbage collector canceled the stuck run of the deployment so it
+	// is cleaned up as soon as the run stops; protected by kfDefMux.
+	gcCanceled bool
+
+	// updateCondition is the UpdateAvailable condition set by the last check for updates and
+	// lastUpdateCheck is when it ran; protected by kfDefMux.
+	updateCondition *kfdefsv3.KfDefCondition
+	lastUpdateCheck time.Time
+
+	// mux if non nil is the mux the endpoints are registered on instead of http.DefaultServeMux
+	// e.g. by a LocalServer.
+	mux *http.ServeMux
 }
 
 // NewServer returns a new kfctl server
@@ -78,13 +185,45 @@ func NewKfctlServer(appsDir string) (*kfctlServer, error) {
 		return nil, errors.WithStack(fmt.Errorf("appsDir must be provided"))
 	}
 
+	config, err := newServerConfigStore("", DefaultServerConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	// The app.yaml of the deployment is encrypted like the rest of its state.
+	kfdefsv3.SetConfigSealer(stateKeys)
+
+	// Upgrade the state stored by earlier versions of the server before loading it.
+	if _, err := migrateState(appsDir, false); err != nil {
+		return nil, errors.Wrapf(err, "could not migrate the state in %v", appsDir)
+	}
+
 	s := &kfctlServer{
 		c:            make(chan kfdefsv3.KfDef, 10),
 		appsDir:      appsDir,
 		builder:      &coordinator.DefaultBuilder{},
 		serverStatus: StatusRunning,
+		errHistory:   newErrorHistory(path.Join(appsDir, errorHistoryFile), defaultMaxErrors),
+		runLog:       newRunLogger(path.Join(appsDir, runLogFile), defaultMaxLogEntries),
+		runs:         newRunHistory(path.Join(appsDir, runHistoryFile), defaultMaxRuns),
+		revisions:    newRevisionHistory(path.Join(appsDir, revisionHistoryFile), defaultMaxRevisions),
+		phase:        PhasePending,
+		phaseStart:   time.Now(),
+		idle:         make(chan struct{}, 1),
+		config:       config,
+		telemetry:    newTelemetryReporter(path.Join(appsDir, telemetrySpoolFile)),
 	}
 
+	s.logBuffer = newLogBuffer(s.logBufferBytes)
+	log.AddHook(s.runLog)
+	log.AddHook(s.logBuffer)
+	s.loadCheckpoint()
+	s.loadPaused()
+	s.loadMetadata()
+	s.loadAppliedHash()
+
+	go s.startUpdateChecks(time.Minute, nil)
+
 	// Start a background thread to process requests
 	go s.process()
 
@@ -101,6 +240,23 @@ func NewKfctlServer(appsDir string) (*kfctlServer, error) {
 func (s *kfctlServer) handleDeployment(r kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
 	ctx := context.Background()
 
+	if err := trustCABundle(&r); err != nil {
+		log.Warnf("Outbound requests don't trust the CA bundle of %v; %v", r.Name, err)
+	}
+
+	// Deferred updates run with other credentials than the requests of the users.
+	if deferred := takeDeferredApply(&r); deferred != s.applyingDeferred {
+		s.applyingDeferred = deferred
+		s.kfApp = nil
+	}
+
+	if takeDelete(&r) {
+		return s.deleteDeployment(ctx, r)
+	}
+
+	// A retry of the failed applications only reruns the K8s apply for those applications.
+	retryApps := takeRetryApps(&r)
+
 	if s.kfApp == nil {
 		if r.Spec.AppDir != "" {
 			log.Warnf("r.Spec.AppDir is set it will be overwritten.")
@@ -108,6 +264,21 @@ func (s *kfctlServer) handleDeployment(r kfdefsv3.KfDef) (*kfdefsv3.KfDef, error
 		r.Spec.AppDir = path.Join(s.appsDir, r.Name)
 		cfgFile := path.Join(r.Spec.AppDir, kftypes.KfConfigFile)
 		if _, err := os.Stat(cfgFile); os.IsNotExist(err) {
+			if s.simulate {
+				log.Infof("Simulating the deployment; not minting a service account")
+				r.Spec.Platform = kftypes.SIMULATE
+				r.Spec.PackageManager = kftypes.SIMULATE
+			} else if s.targetCluster != nil {
+				log.Infof("Deploying to the target cluster; not minting a service account")
+			} else if err := s.mintDeployer(ctx, &r); err != nil {
+				log.Errorf("Could not mint a service account for the deployment; error %v", err)
+				return &r, &httpError{
+					Message: "Internal service error please try again later.",
+					Code:    http.StatusInternalServerError,
+					cause:   err,
+				}
+			}
+
 			log.Infof("Creating cfgFile; %v", cfgFile)
 			newCfgFile, err := coordinator.CreateKfAppCfgFile(&r)
 
@@ -122,171 +293,511 @@ func (s *kfctlServer) handleDeployment(r kfdefsv3.KfDef) (*kfdefsv3.KfDef, error
 				return &r, &httpError{
 					Message: "Internal service error please try again later.",
 					Code:    http.StatusInternalServerError,
+					cause:   err,
 				}
 			}
 		}
 
-		kfApp, err := s.builder.LoadKfAppCfgFile(cfgFile)
+		if err := s.loadKfApp(ctx, cfgFile); err != nil {
+			return &r, err
+		}
+	}
 
-		getter, ok := kfApp.(coordinator.KfDefGetter)
-		if !ok {
-			log.Errorf("Could not assert KfApp as type KfDefGetter; error %v", err)
-			return &r, &httpError{
+	if err := s.atPhaseBoundary(r, PhaseGenerate); err != nil {
+		return s.kfDefGetter.GetKfDef(), err
+	}
+	if retryApps != nil {
+		log.Infof("Retrying applications %v; skipping phase %v", retryApps, PhaseGenerate)
+	} else if !s.skipPhase(PhaseGenerate) {
+		s.setPhase(PhaseGenerate)
+		log.Infof("Calling generate")
+		if err := s.runPhase(ctx, PhaseGenerate, nil, func() error { return s.kfApp.Generate(kftypes.ALL) }); err != nil {
+			log.Errorf("Calling generate failed; %v", err)
+			return s.kfDefGetter.GetKfDef(), &httpError{
 				Message: "Internal service error please try again later.",
 				Code:    http.StatusInternalServerError,
+				cause:   err,
 			}
 		}
+	}
 
-		p, ok := getter.GetPlugin(kftypes.GCP)
-		if !ok {
-			log.Errorf("Could not get GCP plugin from KfApp")
-			return &r, &httpError{
+	// We need to split the apply into two steps because after
+	// creating the platform we need to construct and inject the K8s client to
+	// be used with kustomize.
+	if err := s.atPhaseBoundary(r, PhaseApplyPlatform); err != nil {
+		return s.kfDefGetter.GetKfDef(), err
+	}
+	if retryApps != nil {
+		log.Infof("Retrying applications %v; skipping phase %v", retryApps, PhaseApplyPlatform)
+	} else if !s.skipPhase(PhaseApplyPlatform) {
+		s.setPhase(PhaseApplyPlatform)
+		if err := s.runHooks(ctx, r, kfdefsv3.HookPreProvision); err != nil {
+			return s.kfDefGetter.GetKfDef(), err
+		}
+		log.Infof("Calling apply platform")
+		if err := s.runPhase(ctx, PhaseApplyPlatform, nil, func() error { return s.kfApp.Apply(kftypes.PLATFORM) }); err != nil {
+			log.Errorf("Calling apply platform failed; %v", err)
+			return s.kfDefGetter.GetKfDef(), &httpError{
 				Message: "Internal service error please try again later.",
 				Code:    http.StatusInternalServerError,
+				cause:   err,
 			}
 		}
+		if err := s.runHooks(ctx, r, kfdefsv3.HookPostProvision); err != nil {
+			return s.kfDefGetter.GetKfDef(), err
+		}
+	}
 
-		gcpPlugin, ok := p.(gcp.Setter)
+	kPluginSetter, err := s.configureKustomizePlugin(ctx, r)
+	if err != nil {
+		return s.kfDefGetter.GetKfDef(), err
+	}
+	kPluginSetter.SetApplicationFilter(retryApps)
 
-		if !ok {
-			log.Errorf("Plugin %v doesn't implement Setter interface; can't set TokenSource", kftypes.GCP)
-			return &r, &httpError{
-				Message: "Internal service error please try again later.",
-				Code:    http.StatusInternalServerError,
+	if err := s.atPhaseBoundary(r, PhaseApplyK8s); err != nil {
+		return s.kfDefGetter.GetKfDef(), err
+	}
+	s.setPhase(PhaseApplyK8s)
+	if err := s.runHooks(ctx, r, kfdefsv3.HookPreApply); err != nil {
+		return s.kfDefGetter.GetKfDef(), err
+	}
+	log.Infof("Calling apply K8s")
+	if err := s.runPhase(ctx, PhaseApplyK8s, retryApps, func() error { return s.kfApp.Apply(kftypes.K8S) }); err != nil {
+		log.Errorf("Calling apply K8s failed; %v", err)
+		if kustomize.IsResourceConflict(err) {
+			return s.kfDefGetter.GetKfDef(), &httpError{
+				Message: err.Error(),
+				Code:    http.StatusConflict,
+				cause:   err,
+			}
+		}
+		if kustomize.IsIncompatibleCluster(err) {
+			return s.kfDefGetter.GetKfDef(), &httpError{
+				Message: err.Error(),
+				Code:    http.StatusPreconditionFailed,
+				cause:   err,
 			}
 		}
+		return s.kfDefGetter.GetKfDef(), &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
 
-		setTokenSource := func() bool {
-			s.kfDefMux.Lock()
-			defer s.kfDefMux.Unlock()
+	if err := s.runHooks(ctx, r, kfdefsv3.HookPostApply); err != nil {
+		return s.kfDefGetter.GetKfDef(), err
+	}
 
-			if s.ts == nil {
-				log.Errorf("No token source set; can't create KfApp")
-				return false
-			}
+	log.Errorf("Need to implement code to push app to source repo.")
+	return s.kfDefGetter.GetKfDef(), nil
 
-			gcpPlugin.SetTokenSource(s.ts)
-			// We don't want to run get-credentials
-			gcpPlugin.SetRunGetCredentials(false)
-			return true
+	// Push to source repo.
+	// TODO(jlewi): Copy code in CloneRepoToLocal to clone the repo.
+	//err = SaveAppToRepo(req.Email, path.Join(repoDir, GetRepoNameKfctl(req.Project)))
+}
+
+// loadKfApp loads the KfApp from cfgFile and configures its plugins.
+func (s *kfctlServer) loadKfApp(ctx context.Context, cfgFile string) error {
+	kfApp, err := s.builder.LoadKfAppCfgFile(cfgFile)
+
+	getter, ok := kfApp.(coordinator.KfDefGetter)
+	if !ok {
+		log.Errorf("Could not assert KfApp as type KfDefGetter; error %v", err)
+		return &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
 		}
+	}
 
-		if !setTokenSource() {
-			return &r, &httpError{
-				Message: "Internal service error please try again later.",
-				Code:    http.StatusInternalServerError,
-			}
+	if s.deploysToGcp() {
+		if err := s.configureGcpPlugin(ctx, getter); err != nil {
+			return err
 		}
-		s.kfApp = kfApp
-		s.kfDefGetter = getter
 	}
+	s.kfApp = kfApp
+	s.kfDefGetter = getter
+	return nil
+}
 
-	log.Infof("Calling generate")
-	if err := s.kfApp.Generate(kftypes.ALL); err != nil {
-		log.Errorf("Calling generate failed; %v", err)
-		return s.kfDefGetter.GetKfDef(), &httpError{
+// configureKustomizePlugin sets the cluster the kustomize plugin applies to and returns the plugin.
+func (s *kfctlServer) configureKustomizePlugin(ctx context.Context, r kfdefsv3.KfDef) (kustomize.Setter, error) {
+	packageManager := kftypes.KUSTOMIZE
+	if s.simulate {
+		packageManager = kftypes.SIMULATE
+	}
+	kPlugin, ok := s.kfDefGetter.GetPlugin(packageManager)
+	if !ok {
+		log.Errorf("Could not get %v plugin from KfApp", packageManager)
+		return nil, &httpError{
 			Message: "Internal service error please try again later.",
 			Code:    http.StatusInternalServerError,
 		}
 	}
 
-	// We need to split the apply into two steps because after
-	// creating the platform we need to construct and inject the K8s client to
-	// be used with kustomize.
-	log.Infof("Calling apply platform")
-	if err := s.kfApp.Apply(kftypes.PLATFORM); err != nil {
-		log.Errorf("Calling apply platform failed; %v", err)
-		return s.kfDefGetter.GetKfDef(), &httpError{
+	kPluginSetter, ok := kPlugin.(kustomize.Setter)
+
+	if !ok {
+		log.Errorf("Plugin %v doesn't implement Setter interface; can't set K8s client", packageManager)
+		return nil, &httpError{
 			Message: "Internal service error please try again later.",
 			Code:    http.StatusInternalServerError,
 		}
 	}
 
-	kPlugin, ok := s.kfDefGetter.GetPlugin(kftypes.KUSTOMIZE)
+	k8sRest, err := s.k8sRestConfig(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	kPluginSetter.SetK8sRestConfig(k8sRest)
+	return kPluginSetter, nil
+}
+
+// configureGcpPlugin sets the credentials the GCP plugin deploys with.
+func (s *kfctlServer) configureGcpPlugin(ctx context.Context, getter coordinator.KfDefGetter) error {
+	p, ok := getter.GetPlugin(kftypes.GCP)
 	if !ok {
-		log.Errorf("Could not get %v plugin from KfApp", kftypes.KUSTOMIZE)
-		return s.kfDefGetter.GetKfDef(), &httpError{
+		log.Errorf("Could not get GCP plugin from KfApp")
+		return &httpError{
 			Message: "Internal service error please try again later.",
 			Code:    http.StatusInternalServerError,
 		}
 	}
 
-	kPluginSetter, ok := kPlugin.(kustomize.Setter)
+	gcpPlugin, ok := p.(gcp.Setter)
 
 	if !ok {
-		log.Errorf("Plugin %v doesn't implement Setter interface; can't set K8s client", kftypes.KUSTOMIZE)
-		return s.kfDefGetter.GetKfDef(), &httpError{
+		log.Errorf("Plugin %v doesn't implement Setter interface; can't set TokenSource", kftypes.GCP)
+		return &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	setTokenSource := func() bool {
+		s.kfDefMux.Lock()
+		defer s.kfDefMux.Unlock()
+
+		// The token of the user who sent a deferred update has expired by the time it is applied.
+		if s.applyingDeferred {
+			ts, err := maintenanceTokenSource(ctx, getter.GetKfDef())
+			if err != nil {
+				log.Errorf("Could not create token source for the deferred update; error %v", err)
+				return false
+			}
+			log.Infof("Applying the deferred update as %v", gcp.DeployerServiceAccount(getter.GetKfDef()))
+			s.deployTs = ts
+			gcpPlugin.SetTokenSource(ts)
+			gcpPlugin.SetOwnerTokenSource(ts)
+			gcpPlugin.SetRunGetCredentials(false)
+			return true
+		}
+
+		if s.ts == nil {
+			log.Errorf("No token source set; can't create KfApp")
+			return false
+		}
+
+		s.deployTs = s.ts
+		if email := gcp.DeployerServiceAccount(getter.GetKfDef()); email != "" {
+			ts, err := gcp.NewDeployerTokenSource(ctx, gcp.NewClient(ctx, s.ts), email)
+			if err != nil {
+				log.Errorf("Could not create token source for %v; error %v", email, err)
+				return false
+			}
+			log.Infof("Running deployment as %v", email)
+			s.deployTs = ts
+		}
+
+		gcpPlugin.SetTokenSource(s.deployTs)
+		// IAM policies and the deployer itself are managed with the user's credentials.
+		gcpPlugin.SetOwnerTokenSource(s.ts)
+		// We don't want to run get-credentials
+		gcpPlugin.SetRunGetCredentials(false)
+		return true
+	}
+
+	if !setTokenSource() {
+		return &httpError{
 			Message: "Internal service error please try again later.",
 			Code:    http.StatusInternalServerError,
 		}
 	}
+	// Report the progress of Deployment Manager while the pipeline waits for it.
+	gcpPlugin.SetDMStatusFunc(s.setDMConditions)
+	return nil
+}
+
+// deploysToGcp returns true if deployments are deployed to GCP with the credentials of the caller
+// rather than to the target cluster or simulated.
+func (s *kfctlServer) deploysToGcp() bool {
+	return s.targetCluster == nil && !s.simulate
+}
+
+// k8sRestConfig returns the config of the cluster to apply the K8s resources to.
+func (s *kfctlServer) k8sRestConfig(ctx context.Context, r kfdefsv3.KfDef) (*rest.Config, error) {
+	if s.simulate {
+		return simulate.ClusterConfig(), nil
+	}
+	if s.targetCluster != nil {
+		log.Infof("Using the target cluster %v", s.targetCluster.Host)
+		return s.targetCluster, nil
+	}
 
 	log.Infof("Creating K8s client")
-	token, err := s.ts.Token()
+	token, err := s.deployTs.Token()
 
 	if err != nil {
 		log.Errorf("Could not get a GCP token; error %v", err)
-		return s.kfDefGetter.GetKfDef(), &httpError{
+		return nil, &httpError{
 			Message: "Internal service error please try again later.",
 			Code:    http.StatusInternalServerError,
+			cause:   err,
 		}
 	}
 
+	// The request doesn't record the fallback zone the cluster may have been provisioned in.
+	if r.Status.Zone == "" && s.kfDefGetter != nil {
+		r.Status.Zone = s.kfDefGetter.GetKfDef().Status.Zone
+	}
+
 	// TODO(jlewi): BuildClusterConfig makes a call to the Containers API to get cluster info.
 	// Should we add retries?
-	k8sRest, err := BuildClusterConfig(ctx, token.AccessToken, r.Spec.Project, r.Spec.Zone, r.Name)
+	k8sRest, err := BuildClusterConfig(ctx, token.AccessToken, r.Spec.Project, gcp.ClusterLocation(&r), r.Name)
 	if err != nil {
 		log.Errorf("Could not build K8s client; error %v", err)
-		return s.kfDefGetter.GetKfDef(), &httpError{
+		return nil, &httpError{
 			Message: "Internal service error please try again later.",
 			Code:    http.StatusInternalServerError,
+			cause:   err,
 		}
 	}
 
 	if k8sRest == nil {
 		log.Errorf("K8sRestConfig is nil; error %v", err)
-		return s.kfDefGetter.GetKfDef(), &httpError{
+		return nil, &httpError{
 			Message: "Internal service error please try again later.",
 			Code:    http.StatusInternalServerError,
 		}
 	}
+	return k8sRest, nil
+}
 
-	kPluginSetter.SetK8sRestConfig(k8sRest)
-
-	log.Infof("Calling apply K8s")
-	if err := s.kfApp.Apply(kftypes.K8S); err != nil {
-		log.Errorf("Calling apply K8s failed; %v", err)
-		return s.kfDefGetter.GetKfDef(), &httpError{
-			Message: "Internal service error please try again later.",
-			Code:    http.StatusInternalServerError,
-		}
+// mintDeployer mints a service account with the minimal roles needed to run the deployment
+// and records it in r. The user is allowed to generate tokens for the service account so it
+// must be known; otherwise the deployment runs with the user's credentials.
+func (s *kfctlServer) mintDeployer(ctx context.Context, r *kfdefsv3.KfDef) error {
+	if r.Spec.Email == "" {
+		log.Warnf("Email isn't set; deployment %v will run with the user's credentials", r.Name)
+		return nil
 	}
 
-	log.Errorf("Need to implement code to push app to source repo.")
-	return s.kfDefGetter.GetKfDef(), nil
+	s.kfDefMux.Lock()
+	ts := s.ts
+	s.kfDefMux.Unlock()
 
-	// Push to source repo.
-	// TODO(jlewi): Copy code in CloneRepoToLocal to clone the repo.
-	//err = SaveAppToRepo(req.Email, path.Join(repoDir, GetRepoNameKfctl(req.Project)))
+	_, err := gcp.MintDeployerServiceAccount(ctx, gcp.NewClient(ctx, ts), r, r.Spec.Email)
+	return err
 }
 
 func (s *kfctlServer) process() {
 	for {
 		r := <-s.c
+		if !s.startHandling() {
+			s.checkpointQueued(r)
+			s.drainQueue(true)
+			return
+		}
 
-		newDeployment, err := s.handleDeployment(r)
+		s.deadline = takeDeadline(&r)
+		if s.deadlineExceeded() {
+			log.Infof("The deadline of the request for %v passed while it was queued; dropping it", r.Name)
+			if s.isDraining() {
+				s.drainQueue(false)
+				return
+			}
+			s.setBusy(false)
+			continue
+		}
 
-		if err != nil {
+		if rev, err := s.revisions.record(r.Name, r.Spec); err != nil {
+			log.Errorf("Could not record the revision of %v; %v", r.Name, err)
+		} else if rev != nil {
+			log.Infof("Deployment %v is at revision %v with %v changes", r.Name, rev.Number, len(rev.Changes))
+		}
+
+		s.stopCertificateWatch()
+		// Resources may change even if the run fails so the next request must be applied.
+		s.kfDefMux.Lock()
+		s.setAppliedHash("")
+		s.kfDefMux.Unlock()
+		s.runs.begin(r.Name)
+		s.runLog.begin(r.Name, takeLogVerbosity(&r))
+		s.logBuffer.begin(r.Name)
+		collecting := takeGarbageCollect(&r)
+		// handleDeployment removes the annotation from the shared map.
+		_, deleting := r.Annotations[deleteAnnotation]
+		s.opMux.Lock()
+		newDeployment, err := s.handleDeployment(r)
+		s.opMux.Unlock()
+		if hErr, ok := err.(*httpError); ok && collecting && hErr.Code == http.StatusNotFound {
+			log.Infof("Deployment %v was never generated; there is nothing to clean up", r.Name)
+			err = nil
+		}
+		s.runLog.finish(err)
+		s.logBuffer.finish()
+
+		var run *DeploymentRun
+		switch {
+		case err == errDrained:
+			log.Infof("Stopped handling %v; %v", r.Name, err)
+			s.runs.abandon()
+		case err == errCanceled, err == errDeadlineExceeded:
+			log.Infof("Stopped handling %v; %v", r.Name, err)
+			run = s.runs.finish(s.currentPhase(), err)
+			s.setPhase(PhaseCanceled)
+		case err != nil:
 			log.Errorf("Error occured; %v", err)
+			err = withRemediation(err, r.Spec.Project)
+			s.errHistory.record(r.Name, s.currentPhase(), err)
+			run = s.runs.finish(s.currentPhase(), err)
+			s.setPhase(PhaseFailed)
+		default:
+			run = s.runs.finish(PhaseDone, nil)
+			if collecting {
+				s.setPhase(PhaseAbandoned)
+			} else {
+				s.setPhase(PhaseDone)
+			}
+			s.clearCheckpoint()
+			if !deleting {
+				s.recordApplied(r, newDeployment)
+			}
 		}
 		s.setLatestKfDef(newDeployment)
+		if collecting && err != errDrained {
+			s.finishGarbageCollection(r.Name, err)
+		}
+		if err == errDeadlineExceeded {
+			s.setDeadlineCondition(s.resumePhase)
+		}
+		s.setRemediationCondition(err)
+		if !deleting && err == nil {
+			s.startCertificateWatch(*newDeployment)
+		}
+
+		if t := s.config.get().Telemetry; t != nil && r.Spec.ReportUsage && run != nil {
+			go s.telemetry.report(t, newUsageReport(r, *run))
+		}
+
+		if err != errDrained {
+			event := DeploymentEvent{
+				Name:    r.Name,
+				Project: r.Spec.Project,
+				Phase:   s.currentPhase(),
+				Time:    time.Now(),
+			}
+			if err != nil {
+				event.Error = err.Error()
+			}
+			s.config.notify(event)
+		}
+
+		if s.isDraining() {
+			// Drain returns once the queued requests are accounted for.
+			s.drainQueue(err == errDrained)
+			return
+		}
+		s.setBusy(false)
 	}
 }
 
+// setBusy records whether a deployment is being handled and signals Drain when handling stops.
+func (s *kfctlServer) setBusy(busy bool) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.busy = busy
+	s.publishStatus()
+	if !busy && s.serverStatus == StatusFrozen {
+		select {
+		case s.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// setPhase records the phase the pipeline is currently in.
+func (s *kfctlServer) setPhase(phase DeploymentPhase) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	log.Infof("Deployment entering phase %v", phase)
+	s.phase = phase
+	s.phaseStart = time.Now()
+	if s.runs != nil {
+		s.runs.enterPhase(phase)
+	}
+	if s.runLog != nil {
+		s.runLog.enterPhase(phase)
+	}
+	if s.logBuffer != nil {
+		s.logBuffer.enterPhase(phase)
+	}
+	s.publishStatus()
+}
+
+// currentPhase returns the phase the pipeline is currently in.
+func (s *kfctlServer) currentPhase() DeploymentPhase {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	return s.phase
+}
+
+// reportedPhase is the phase reported to clients. While a request is queued or starting, the
+// outcome of the previous run is reported as Pending so clients waiting for the request don't
+// mistake it for its own. kfDefMux must be held.
+func (s *kfctlServer) reportedPhase() DeploymentPhase {
+	switch s.phase {
+	case PhaseDone, PhaseFailed, PhaseCanceled, PhaseAbandoned:
+		if s.busy || len(s.c) > 0 {
+			return PhasePending
+		}
+	}
+	return s.phase
+}
+
+// writeProgressHeaders is a ServerResponseFunc reporting the current phase to the client.
+func (s *kfctlServer) writeProgressHeaders(ctx context.Context, w http.ResponseWriter) context.Context {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	setProgressHeaders(w, s.reportedPhase(), time.Since(s.phaseStart))
+	return ctx
+}
+
 func (s *kfctlServer) setLatestKfDef(r *kfdefsv3.KfDef) {
 	s.kfDefMux.Lock()
 	defer s.kfDefMux.Unlock()
+	previous := s.latestKfDef
 	s.latestKfDef = *s.kfDefGetter.GetKfDef()
+	if s.latestKfDef.CreationTimestamp.IsZero() {
+		s.latestKfDef.CreationTimestamp = previous.CreationTimestamp
+	}
+	applyMetadata(&s.latestKfDef, s.metadata)
+	s.keepUpdateCondition(&previous)
+	if s.paused {
+		setPausedCondition(&s.latestKfDef, true)
+	}
+	s.publishStatus()
+}
+
+// setDMConditions reports the progress of the Deployment Manager deployments in the latest KfDef
+// while the deployment is being applied.
+func (s *kfctlServer) setDMConditions(conditions []kfdefsv3.KfDefCondition) {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	gcp.SetDMConditions(&s.latestKfDef, conditions)
+	s.publishStatus()
 }
 
 // makeServerStatusRequestEndpoint creates an endpoint to handle get latest kfdef requests in the router.
@@ -303,26 +814,264 @@ func (s *kfctlServer) RegisterEndpoints() {
 		makeRouterCreateRequestEndpoint(s),
 		func(_ context.Context, r *http.Request) (interface{}, error) {
 			var request kfdefsv3.KfDef
-			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			if err := decodeBody(r, &request); err != nil {
 				log.Info("Err decoding kfdef: " + err.Error())
 				return nil, err
 			}
 			return request, nil
 		},
 		encodeResponse,
+		httptransport.ServerBefore(readDeadlineHeader),
+		httptransport.ServerAfter(s.writeProgressHeaders),
 	)
 
 	statusHandler := httptransport.NewServer(
 		makeServerStatusRequestEndpoint(s),
 		func(_ context.Context, r *http.Request) (interface{}, error) {
 			var request kfdefsv3.KfDef
-			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			if err := decodeBody(r, &request); err != nil {
 				log.Info("Err decoding kfdef: " + err.Error())
 				return nil, err
 			}
 			return request, nil
 		},
 		encodeResponse,
+		httptransport.ServerAfter(s.writeProgressHeaders),
+	)
+
+	lintHandler := httptransport.NewServer(
+		makeLintEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+	)
+
+	convertHandler := httptransport.NewServer(
+		makeConvertEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+	)
+
+	maintenanceHandler := httptransport.NewServer(
+		makeMaintenanceEndpoint(s),
+		decodeHTTPMaintenanceRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	maintenanceRunHandler := httptransport.NewServer(
+		makeMaintenanceRunEndpoint(s),
+		decodeHTTPMaintenanceRunRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	connectionHandler := httptransport.NewServer(
+		makeConnectionInfoEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	retryAppsHandler := httptransport.NewServer(
+		makeRetryFailedAppsEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerBefore(readDeadlineHeader),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(s.writeProgressHeaders),
+	)
+
+	pauseHandler := httptransport.NewServer(
+		makePauseEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(s.writeProgressHeaders),
+	)
+
+	resumeHandler := httptransport.NewServer(
+		makeResumeEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(s.writeProgressHeaders),
+	)
+
+	cancelHandler := httptransport.NewServer(
+		makeCancelEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(s.writeProgressHeaders),
+	)
+
+	listHandler := httptransport.NewServer(
+		makeListEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	deleteHandler := httptransport.NewServer(
+		makeDeleteEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(s.writeProgressHeaders),
+	)
+
+	prepareDeleteHandler := httptransport.NewServer(
+		makePrepareDeleteEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	iamReportHandler := httptransport.NewServer(
+		makeIamReportEndpoint(s),
+		decodeHTTPIamReportRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	revokeUnusedHandler := httptransport.NewServer(
+		makeRevokeUnusedEndpoint(s),
+		decodeHTTPIamReportRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	statsHandler := httptransport.NewServer(
+		makeStatsEndpoint(s),
+		decodeHTTPStatsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	durationTrendsHandler := httptransport.NewServer(
+		makeDurationTrendsEndpoint(s),
+		decodeHTTPDurationTrendsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	errorsHandler := httptransport.NewServer(
+		makeErrorHistoryEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	revisionDiffHandler := httptransport.NewServer(
+		makeRevisionDiffEndpoint(s),
+		decodeHTTPRevisionDiffRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	metadataHandler := httptransport.NewServer(
+		makeMetadataEndpoint(s),
+		decodeHTTPMetadataRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	verifyHandler := httptransport.NewServer(
+		makeVerifyEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	inventoryHandler := httptransport.NewServer(
+		makeInventoryEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	runLogHandler := httptransport.NewServer(
+		makeRunLogEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	logsHandler := httptransport.NewServer(
+		makeLogsEndpoint(s),
+		decodeHTTPLogsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	migrateHandler := httptransport.NewServer(
+		makeMigrateEndpoint(s),
+		decodeHTTPMigrationRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	backupHandler := httptransport.NewServer(
+		makeBackupEndpoint(s),
+		decodeHTTPBackupRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	restoreHandler := httptransport.NewServer(
+		makeRestoreEndpoint(s),
+		decodeHTTPRestoreRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	upgradePreviewHandler := httptransport.NewServer(
+		makeUpgradePreviewEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	reencryptHandler := httptransport.NewServer(
+		makeReencryptEndpoint(s),
+		decodeHTTPReencryptionRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	defaultsHandler := httptransport.NewServer(
+		makeDefaultsEndpoint(s),
+		decodeHTTPDefaultsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	versionsHandler := httptransport.NewServer(
+		makeVersionsEndpoint(s),
+		decodeHTTPVersionsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	gcHandler := httptransport.NewServer(
+		makeGarbageCollectEndpoint(s),
+		decodeHTTPGarbageCollectionRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	oauthClientHandler := httptransport.NewServer(
+		makeOAuthClientEndpoint(s),
+		decodeHTTPOAuthClientRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	shareHandler := httptransport.NewServer(
+		makeShareEndpoint(s),
+		decodeHTTPShareRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
 	)
 
 	// Override the default error encoder. We want to be able to set the status code based on the type of error.
@@ -334,9 +1083,69 @@ func (s *kfctlServer) RegisterEndpoints() {
 	// 2. Migrating to a new REST API for deployments
 	// 3. This PR aimed at running the deployment in each pod.
 	// Depending on how we stage these changes we might need to change these URLs.
-	http.Handle(KfctlCreatePath, optionsHandler(createHandler))
-	http.Handle(KfctlGetpath, optionsHandler(statusHandler))
-	http.Handle("/", optionsHandler(GetHealthzHandler()))
+	s.handle(KfctlCreatePath, optionsHandler(s.injectFaults(createHandler)))
+	s.handle(KfctlGetpath, optionsHandler(s.injectFaults(statusHandler)))
+	planHandler := httptransport.NewServer(
+		makePlanEndpoint(s),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	executeHandler := httptransport.NewServer(
+		makeExecuteEndpoint(s),
+		decodeHTTPExecuteRequest,
+		encodeResponse,
+		httptransport.ServerBefore(readDeadlineHeader),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(s.writeProgressHeaders),
+	)
+
+	s.handle(KfctlLintPath, optionsHandler(lintHandler))
+	s.handle(KfctlConvertPath, optionsHandler(convertHandler))
+	s.handle(KfctlErrorsPath, optionsHandler(errorsHandler))
+	s.handle(KfctlRevisionDiffPath, optionsHandler(revisionDiffHandler))
+	s.handle(KfctlConnectionInfoPath, optionsHandler(connectionHandler))
+	s.handle(KfctlMaintenancePath, optionsHandler(maintenanceHandler))
+	s.handle(KfctlMaintenanceRunPath, optionsHandler(maintenanceRunHandler))
+	s.handle(KfctlStatsPath, optionsHandler(statsHandler))
+	s.handle(KfctlDurationTrendsPath, optionsHandler(durationTrendsHandler))
+	s.handle(KfctlRetryFailedAppsPath, optionsHandler(retryAppsHandler))
+	s.handle(KfctlPausePath, optionsHandler(pauseHandler))
+	s.handle(KfctlResumePath, optionsHandler(resumeHandler))
+	s.handle(KfctlCancelPath, optionsHandler(cancelHandler))
+	s.handle(KfctlListPath, optionsHandler(listHandler))
+	s.handle(KfctlDeletePath, optionsHandler(deleteHandler))
+	s.handle(KfctlPrepareDeletePath, optionsHandler(prepareDeleteHandler))
+	s.handle(KfctlIamReportPath, optionsHandler(iamReportHandler))
+	s.handle(KfctlRevokeUnusedPath, optionsHandler(revokeUnusedHandler))
+	s.handle(KfctlMetadataPath, optionsHandler(metadataHandler))
+	s.handle(KfctlVerifyPath, optionsHandler(verifyHandler))
+	s.handle(KfctlInventoryPath, optionsHandler(inventoryHandler))
+	s.handle(KfctlRunLogPath, optionsHandler(runLogHandler))
+	s.handle(KfctlLogsPath, optionsHandler(logsHandler))
+	s.handle(KfctlMigratePath, optionsHandler(migrateHandler))
+	s.handle(KfctlBackupPath, optionsHandler(backupHandler))
+	s.handle(KfctlRestorePath, optionsHandler(restoreHandler))
+	s.handle(KfctlUpgradePreviewPath, optionsHandler(upgradePreviewHandler))
+	s.handle(KfctlReencryptPath, optionsHandler(reencryptHandler))
+	s.handle(KfctlDefaultsPath, optionsHandler(defaultsHandler))
+	s.handle(KfctlVersionsPath, optionsHandler(versionsHandler))
+	s.handle(KfctlGarbageCollectPath, optionsHandler(gcHandler))
+	s.handle(KfctlOAuthClientPath, optionsHandler(oauthClientHandler))
+	s.handle(KfctlSharePath, optionsHandler(shareHandler))
+	s.handle(KfctlExportPath, optionsHandler(s.exportHandler()))
+	s.handle(KfctlPlanPath, optionsHandler(planHandler))
+	s.handle(KfctlExecutePath, optionsHandler(s.injectFaults(executeHandler)))
+	s.handle("/", optionsHandler(GetHealthzHandler()))
+}
+
+// injectFaults wraps h with the server's FaultInjector if one is configured.
+func (s *kfctlServer) injectFaults(h http.Handler) http.Handler {
+	if s.faults == nil {
+		return h
+	}
+	return s.faults.Handler(h)
 }
 
 // isMatch checks whether the incoming request is a match for the deployment
@@ -363,6 +1172,10 @@ func isMatch(current *kfdefsv3.KfDef, new *kfdefsv3.KfDef) bool {
 		return false
 	}
 
+	if current.Spec.Region != new.Spec.Region {
+		return false
+	}
+
 	if current.Name != new.Name {
 		return false
 	}
@@ -407,16 +1220,261 @@ func (s *kfctlServer) GetLatestKfdef(req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error
 	return s.latestKfDef.DeepCopy(), nil
 }
 
-// CreateDeployment creates the deployment.
-//
-// Not thread safe
-// TODO(jlewi): We should check if the request matches the current deployment and if not reject
-func (s *kfctlServer) CreateDeployment(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+// GetErrorHistory returns the most recent errors encountered while handling the deployment.
+func (s *kfctlServer) GetErrorHistory(ctx context.Context, req kfdefsv3.KfDef) (*ErrorHistory, error) {
+	if req.Name == "" {
+		return nil, &httpError{
+			Message: "name is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return s.errHistory.get(req.Name), nil
+}
+
+// GetRevisionDiff returns the changes made by a revision of the deployment handled by the server.
+func (s *kfctlServer) GetRevisionDiff(ctx context.Context, req RevisionDiffRequest) (*RevisionDiff, error) {
+	if req.KfDef.Name == "" {
+		return nil, &httpError{
+			Message: "name is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return s.revisions.get(req.KfDef.Name, req.Revision)
+}
+
+// GetStats returns the stats of the runs of the deployment handled by the server including the runs
+// so the router can aggregate them.
+func (s *kfctlServer) GetStats(ctx context.Context, req StatsRequest) (*DeploymentStats, error) {
+	since := time.Now().Add(-statsWindow(req))
+	runs := s.runs.list(since)
+	stats := computeStats(req.KfDef.Spec.Project, since, runs)
+	stats.Runs = runs
+	return stats, nil
+}
+
+// GetDurationTrends returns the duration trends of the runs of the deployment handled by the server
+// including the runs.
+func (s *kfctlServer) GetDurationTrends(ctx context.Context, req DurationTrendsRequest) (*DurationTrends, error) {
+	window, interval, err := trendsWindow(req)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	runs := s.runs.list(now.Add(-window))
+	trends := computeDurationTrends(req.KfDef.Spec.Project, now.Add(-window), now, interval, runs)
+	trends.Runs = runs
+	return trends, nil
+}
+
+// GetConnectionInfo returns the connection info of the deployment handled by the server.
+func (s *kfctlServer) GetConnectionInfo(ctx context.Context, req kfdefsv3.KfDef) (*ConnectionInfo, error) {
+	token, err := connectionToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	latest := s.latestKfDef.DeepCopy()
+	s.kfDefMux.Unlock()
+
+	if latest.Name == "" || latest.Name != req.Name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	return getConnectionInfo(ctx, latest, token)
+}
+
+// ScheduleMaintenance isn't supported by the kfctl server; the router keeps the schedules so they
+// outlive the kfctl servers.
+func (s *kfctlServer) ScheduleMaintenance(ctx context.Context, req MaintenanceRequest) (*MaintenanceSchedule, error) {
+	return nil, &httpError{
+		Message: "Maintenance requests must be sent to the router",
+		Code:    http.StatusNotImplemented,
+	}
+}
+
+// RunMaintenance runs a maintenance task of the deployment handled by the server. The task runs as
+// the deployer of the deployment; see maintenanceTokenSource. A task which fails is reported in the
+// event; an error means the task couldn't run. A deferred update is queued like other requests.
+func (s *kfctlServer) RunMaintenance(ctx context.Context, req MaintenanceRunRequest) (*MaintenanceEvent, error) {
+	if req.Type == TaskApplyDeferredUpdate {
+		return s.applyDeferredUpdate(req.KfDef, time.Now())
+	}
+	if err := validateMaintenanceTaskType(req.Type); err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	latest := s.latestKfDef.DeepCopy()
+	busy := s.busy
+	s.kfDefMux.Unlock()
+
+	if latest.Name == "" || latest.Name != req.KfDef.Name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.KfDef.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	if busy || s.isDraining() {
+		return nil, maintenanceNotReadyError("a deployment is in progress")
+	}
+	// Maintenance tasks are disruptive so they wait for a maintenance window.
+	if !latest.InMaintenanceWindow(time.Now()) {
+		return nil, maintenanceNotReadyError("its maintenance windows are closed")
+	}
+
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+
+	err := s.runMaintenanceTask(ctx, latest, req.Type)
+	e := &MaintenanceEvent{
+		Type:      req.Type,
+		Time:      time.Now(),
+		Succeeded: err == nil,
+	}
+	if err != nil {
+		log.Errorf("Maintenance task %v failed; %v", req.Type, err)
+		e.Message = err.Error()
+	}
+	return e, nil
+}
+
+// maintenanceTokenSource returns the credentials maintenance tasks run with: tokens of the deployer
+// of the deployment generated with the credentials of the pod, which the router allowed when the
+// tasks were scheduled or the update was deferred. The token of the user isn't used since it
+// expires long before tasks run.
+func maintenanceTokenSource(ctx context.Context, d *kfdefsv3.KfDef) (oauth2.TokenSource, error) {
+	email := gcp.DeployerServiceAccount(d)
+	if email == "" {
+		return nil, fmt.Errorf("Deployment %v has no deployer service account to run maintenance tasks as", d.Name)
+	}
+	return gcp.NewDeployerTokenSource(ctx, gcp.NewClient(ctx, NewMetadataTokenSource("")), email)
+}
+
+// runMaintenanceTask runs a single maintenance task with the GCP plugin of a KfApp loaded for the
+// task, so the credentials of the KfApp handling the deployments aren't changed.
+func (s *kfctlServer) runMaintenanceTask(ctx context.Context, d *kfdefsv3.KfDef, t MaintenanceTaskType) error {
+	if !s.deploysToGcp() {
+		return fmt.Errorf("Maintenance tasks are only supported for deployments to %v", kftypes.GCP)
+	}
+	kfApp, err := s.builder.LoadKfAppCfgFile(path.Join(s.appsDir, d.Name, kftypes.KfConfigFile))
+	if err != nil {
+		return errors.Wrapf(err, "could not load deployment %v", d.Name)
+	}
+	getter, ok := kfApp.(coordinator.KfDefGetter)
+	if !ok {
+		return fmt.Errorf("Could not assert KfApp as type KfDefGetter")
+	}
+	p, ok := getter.GetPlugin(kftypes.GCP)
+	if !ok {
+		return fmt.Errorf("Could not get GCP plugin from KfApp")
+	}
+	setter, ok := p.(gcp.Setter)
+	if !ok {
+		return fmt.Errorf("Plugin %v doesn't implement Setter interface; can't set TokenSource", kftypes.GCP)
+	}
+	m, ok := p.(gcp.Maintainer)
+	if !ok {
+		return fmt.Errorf("Plugin %v doesn't support maintenance tasks", kftypes.GCP)
+	}
+
+	ts, err := maintenanceTokenSource(ctx, getter.GetKfDef())
+	if err != nil {
+		return err
+	}
+	setter.SetTokenSource(ts)
+	setter.SetOwnerTokenSource(ts)
+	setter.SetRunGetCredentials(false)
+
+	switch t {
+	case TaskRotateIAPSecret:
+		return m.RotateIAPSecret()
+	case TaskRenewCertificate:
+		return m.RenewCertificate()
+	case TaskRefreshServiceAccountKeys:
+		return m.RefreshServiceAccountKeys()
+	default:
+		return fmt.Errorf("Unknown maintenance task %v", t)
+	}
+}
+
+// Plan returns the actions CreateDeployment would take for the request.
+func (s *kfctlServer) Plan(ctx context.Context, req kfdefsv3.KfDef) (*DeploymentPlan, error) {
+	return planDeployment(s.config.get().Plans, req, time.Now())
+}
+
+// Clone isn't supported by the server; a server only handles a single deployment
+// so clones are created by the router.
+func (s *kfctlServer) Clone(ctx context.Context, req CloneRequest) (*kfdefsv3.KfDef, error) {
+	return nil, &httpError{
+		Message: "Clone requests must be sent to the router",
+		Code:    http.StatusNotImplemented,
+	}
+}
+
+// Execute creates the deployment if the request matches the plan.
+func (s *kfctlServer) Execute(ctx context.Context, req ExecuteRequest) (*kfdefsv3.KfDef, error) {
+	if err := verifyPlan(s.config.get().Plans, req, time.Now()); err != nil {
+		return nil, err
+	}
+	log.Infof("Executing plan %v for %v", req.PlanID, req.KfDef.Name)
+	return s.CreateDeployment(ctx, req.KfDef)
+}
+
+// Lint validates the KfDef and returns warnings about risky configurations.
+func (s *kfctlServer) Lint(ctx context.Context, req kfdefsv3.KfDef) (*LintResult, error) {
+	return lint.Lint(&req, s.clusterConfig(req)), nil
+}
+
+// clusterConfig returns the DM cluster config generated for the deployment handled by the server
+// if req is for it. The app dir of the request isn't used; clients mustn't choose the files read.
+func (s *kfctlServer) clusterConfig(req kfdefsv3.KfDef) []byte {
+	s.kfDefMux.Lock()
+	name := s.latestKfDef.Name
+	s.kfDefMux.Unlock()
+	if name == "" || req.Name != name {
+		return nil
+	}
+
+	configFile := path.Join(s.appsDir, name, gcp.GCP_CONFIG, gcp.CONFIG_FILE)
+	buf, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read %v; skipping node pool checks; error %v", configFile, err)
+		}
+		return nil
+	}
+	return buf
+}
+
+// Convert converts the app.yaml of the ksonnet based kfctl to a KfDef using kustomize.
+func (s *kfctlServer) Convert(ctx context.Context, req kfdefsv3.KfDef) (*ConversionResult, error) {
+	return lint.Convert(&req), nil
+}
+
+// GetKfDefDefaults returns the KfDef used for the platform and version in the request.
+func (s *kfctlServer) GetKfDefDefaults(ctx context.Context, req DefaultsRequest) (*kfdefsv3.KfDef, error) {
+	d, err := defaultKfDef(s.config.get(), req)
+	if err != nil {
+		return nil, err
+	}
+	if s.simulate {
+		d.Spec.Platform = kftypes.SIMULATE
+		d.Spec.PackageManager = kftypes.SIMULATE
+	}
+	return d, nil
+}
+
+// verifyAccess initializes the token source from the GCP access token in the request and
+// checks it provides access to the project.
+func (s *kfctlServer) verifyAccess(req kfdefsv3.KfDef) error {
 	token, err := req.GetSecret(gcp.GcpAccessTokenName)
 
 	if err != nil {
 		log.Errorf("Failed to get secret %v; error %v", gcp.GcpAccessTokenName, err)
-		return nil, &httpError{
+		return &httpError{
 			Message: fmt.Sprintf("Could not obtain an access token from secret %v", gcp.GcpAccessTokenName),
 			Code:    http.StatusBadRequest,
 		}
@@ -445,7 +1503,7 @@ func (s *kfctlServer) CreateDeployment(ctx context.Context, req kfdefsv3.KfDef)
 	}
 
 	if err := initFunc(); err != nil {
-		return nil, err
+		return err
 	}
 
 	// Refresh the credential. This will fail if it doesn't provide access to the project
@@ -455,11 +1513,45 @@ func (s *kfctlServer) CreateDeployment(ctx context.Context, req kfdefsv3.KfDef)
 
 	if err != nil {
 		log.Errorf("Refreshing the token failed; %v", err)
-		return nil, &httpError{
+		return &httpError{
 			Message: fmt.Sprintf("Could not verify you have admin priveleges on project %v; please check that the project is correct and you have admin priveleges", req.Spec.Project),
 			Code:    http.StatusBadRequest,
 		}
 	}
+	return nil
+}
+
+// CreateDeployment creates the deployment.
+//
+// Not thread safe
+// TODO(jlewi): We should check if the request matches the current deployment and if not reject
+func (s *kfctlServer) CreateDeployment(ctx context.Context, req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	if s.isDraining() {
+		return nil, drainingError()
+	}
+
+	if err := checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := parseLogVerbosity(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.config.admitCreate(req); err != nil {
+		return nil, err
+	}
+	if shedder := s.config.get().shedder; shedder != nil {
+		if err := shedder.admit(s.inFlight()); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.deploysToGcp() {
+		if err := s.verifyAccess(req); err != nil {
+			return nil, err
+		}
+	}
 
 	checkIsMatch := func() bool {
 		s.kfDefMux.Lock()
@@ -475,18 +1567,67 @@ func (s *kfctlServer) CreateDeployment(ctx context.Context, req kfdefsv3.KfDef)
 	}
 
 	// Check that it is a valid request.
-	if isValid, msg := (&req).IsValid(); !isValid {
+	if err := newValidationError("KfDef.Spec is invalid", lint.Validate(&req)); err != nil {
+		return nil, err
+	}
+
+	// The preflights below call the GCP APIs through the proxy of the deployment.
+	if err := trustCABundle(&req); err != nil {
+		log.Warnf("Outbound requests don't trust the CA bundle of %v; %v", req.Name, err)
+	}
+
+	// Verify the caller owns the custom domain before we start creating resources for it.
+	if !s.deploysToGcp() {
+		log.Infof("Not deploying to GCP; not verifying domain ownership")
+	} else if err := gcp.VerifyDomainOwnership(ctx, gcp.NewClient(ctx, s.ts), &req); err != nil {
+		log.Errorf("Domain ownership preflight failed; %v", err)
 		req.Status.Conditions = append(req.Status.Conditions, kfdefsv3.KfDefCondition{
 			Type:               kfdefsv3.KfFailed,
 			Status:             v1.ConditionTrue,
-			Reason:             kfdefsv3.InvalidKfDefSpecReason,
-			Message:            fmt.Sprintf("KfDef.Spec is invalid; " + msg),
+			Reason:             kfdefsv3.DomainNotVerifiedReason,
+			Message:            err.Error(),
 			LastUpdateTime:     metav1.Now(),
 			LastTransitionTime: metav1.Now(),
 		})
 		return &req, nil
 	}
 
+	// IAP can't sign users in on a custom domain the OAuth client doesn't redirect to.
+	if s.deploysToGcp() {
+		if err := gcp.CheckIAPRedirectURI(ctx, http.DefaultClient, &req); err != nil {
+			log.Errorf("OAuth redirect URI preflight failed; %v", err)
+			req.Status.Conditions = append(req.Status.Conditions, kfdefsv3.KfDefCondition{
+				Type:               kfdefsv3.KfFailed,
+				Status:             v1.ConditionTrue,
+				Reason:             kfdefsv3.RedirectURINotAuthorizedReason,
+				Message:            err.Error(),
+				LastUpdateTime:     metav1.Now(),
+				LastTransitionTime: metav1.Now(),
+			})
+			return &req, nil
+		}
+	}
+
+	// Check the organization policies before provisioning resources they would reject half way.
+	if s.deploysToGcp() {
+		violations, err := gcp.CheckOrgPolicies(ctx, gcp.NewClient(ctx, s.ts), &req)
+		if err != nil {
+			log.Warnf("Could not check the organization policies of project %v; %v", req.Spec.Project, err)
+		} else if len(violations) > 0 {
+			msg := gcp.FormatOrgPolicyViolations(req.Spec.Project, violations)
+			log.Errorf("Organization policy preflight failed; %v", msg)
+			req.Status.Conditions = append(req.Status.Conditions, kfdefsv3.KfDefCondition{
+				Type:               kfdefsv3.KfFailed,
+				Status:             v1.ConditionTrue,
+				Reason:             kfdefsv3.OrgPolicyViolationReason,
+				Message:            msg,
+				LastUpdateTime:     metav1.Now(),
+				LastTransitionTime: metav1.Now(),
+			})
+			return &req, nil
+		}
+	}
+
 	// TODo(jlewi): Uncoment when gcp.IsValid is checked in.
 	//if isValid, msg := gcp.IsValid(req); !isValid {
 	//	req.Status.Conditions = append(req.Status.Conditions, kfdefsv3.KfDefCondition{
@@ -501,11 +1642,24 @@ func (s *kfctlServer) CreateDeployment(ctx context.Context, req kfdefsv3.KfDef)
 	//	return &req, nil
 	//}
 
+	// Re-clicking deploy shouldn't redo minutes of work if nothing changed.
+	if d := s.noChange(req); d != nil {
+		return d, nil
+	}
+
 	strippedReq := req.DeepCopy()
+	s.setCreationTimestamp(strippedReq)
 
 	// Enqueue the request
 	prepareSecrets(strippedReq)
 
+	// Updates outside the maintenance windows are applied when the next window opens; the
+	// deadline of the request doesn't apply to them.
+	if d := s.deferToMaintenanceWindow(*strippedReq, time.Now()); d != nil {
+		return d, nil
+	}
+	setDeadline(ctx, strippedReq)
+
 	s.c <- *strippedReq
 
 	// Return the current status.
@@ -4,10 +4,13 @@ import (
 	"context"
 	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
 	"golang.org/x/oauth2"
+	"io/ioutil"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"os"
+	"path"
 	"reflect"
 	"testing"
 )
@@ -28,9 +31,15 @@ func (ts *FakeRefreshableTokenSource) Token() (*oauth2.Token, error) {
 func TestKfctlServer_CreateDeployment(t *testing.T) {
 	ts := &FakeRefreshableTokenSource{}
 
+	config, err := newServerConfigStore("", DefaultServerConfig())
+	if err != nil {
+		t.Fatalf("Could not create the server config; %v", err)
+	}
+
 	s := &kfctlServer{
-		ts: ts,
-		c:  make(chan kfdefsv3.KfDef, 1),
+		ts:     ts,
+		c:      make(chan kfdefsv3.KfDef, 1),
+		config: config,
 		latestKfDef: kfdefsv3.KfDef{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: "input",
@@ -228,6 +237,28 @@ func TestKfctlServer_isMatch(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			current: &kfdefsv3.KfDef{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "app1",
+				},
+				Spec: kfdefsv3.KfDefSpec{
+					Project: "p1",
+					Zone:    "z1",
+				},
+			},
+			new: &kfdefsv3.KfDef{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "app1",
+				},
+				Spec: kfdefsv3.KfDefSpec{
+					Project: "p1",
+					Zone:    "z1",
+					Region:  "r1",
+				},
+			},
+			expected: false,
+		},
 	}
 
 	for _, c := range testCases {
@@ -325,3 +356,49 @@ func TestKfctlServer_prepareSecrets(t *testing.T) {
 		}
 	}
 }
+
+func TestKfctlServer_LintClusterConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The same oversized cluster config is generated for the deployment of the server and in a
+	// directory the request points to.
+	config := []byte("resources:\n- properties:\n    cpu-pool-max-nodes: 100\n")
+	for _, appDir := range []string{path.Join(dir, "kf-app"), path.Join(dir, "elsewhere")} {
+		if err := os.MkdirAll(path.Join(appDir, gcp.GCP_CONFIG), os.ModePerm); err != nil {
+			t.Fatalf("Could not create directory; %v", err)
+		}
+		if err := ioutil.WriteFile(path.Join(appDir, gcp.GCP_CONFIG, gcp.CONFIG_FILE), config, 0644); err != nil {
+			t.Fatalf("Could not write cluster config; %v", err)
+		}
+	}
+
+	s := newQueueTestServer(dir)
+	hasOversizedPool := func(req kfdefsv3.KfDef) bool {
+		r, err := s.Lint(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Lint error; %v", err)
+		}
+		for _, w := range r.Warnings {
+			if w.Code == lint.OversizedNodePool {
+				return true
+			}
+		}
+		return false
+	}
+
+	req := newPlanTestKfDef()
+	if !hasOversizedPool(req) {
+		t.Errorf("The cluster config of the deployment wasn't linted")
+	}
+
+	other := newPlanTestKfDef()
+	other.Name = "other"
+	other.Spec.AppDir = path.Join(dir, "elsewhere")
+	if hasOversizedPool(other) {
+		t.Errorf("Lint read the cluster config from the app dir of the request")
+	}
+}
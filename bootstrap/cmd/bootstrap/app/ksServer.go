@@ -806,25 +806,31 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 		errorEncoder(ctx, f.Failed(), w)
 		return nil
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	return json.NewEncoder(w).Encode(response)
+	return encodeBody(ctx, w, response)
 }
 
 // Handle "OPTIONS" request from browser
 // Decorate your browser-facing handlers with it.
+// It also records the Accept header so responses can be encoded as YAML.
 func optionsHandler(h http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		setCORSHeaders(w)
 		if r.Method == "OPTIONS" {
 			return
 		} else {
-			h.ServeHTTP(w, r)
+			setDeprecationHeaders(w, r)
+			h.ServeHTTP(w, withAccept(r))
 		}
 	}
 }
 
+// setCORSHeaders allows browsers to send requests to the endpoints from any origin.
+func setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+}
+
 // Addr returns the address we are listening on
 func (s *ksServer) Addr() net.Addr {
 	s.serverMux.Lock()
@@ -850,6 +856,20 @@ func (s *ksServer) StartHttp(port int) error {
 		panic(err)
 	}
 
+	return s.serve(listener)
+}
+
+// StartUnix starts an HTTP server on the unix socket at socket and blocks.
+func (s *ksServer) StartUnix(socket string) error {
+	listener, err := listenUnix(socket)
+	if err != nil {
+		return err
+	}
+	return s.serve(listener)
+}
+
+// serve serves the endpoints on listener and blocks.
+func (s *ksServer) serve(listener net.Listener) error {
 	s.listener = listener
 
 	applyAppHandler := httptransport.NewServer(
@@ -909,7 +929,5 @@ func (s *ksServer) StartHttp(port int) error {
 
 	log.Infof("Listening on address: %+v", listener.Addr())
 
-	err = http.Serve(s.listener, nil)
-
-	return err
+	return http.Serve(s.listener, nil)
 }
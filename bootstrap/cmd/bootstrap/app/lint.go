@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+)
+
+// KfctlLintPath is the path on which to serve lint requests
+const KfctlLintPath = "/kfctl/apps/v1alpha2/lint"
+
+// Codes identifying the lint warnings; see package lint.
+const (
+	LintBasicAuth         = lint.BasicAuth
+	LintDefaultPassword   = lint.DefaultPassword
+	LintSingleZone        = lint.SingleZone
+	LintDeprecatedVersion = lint.DeprecatedVersion
+	LintOversizedNodePool = lint.OversizedNodePool
+	LintUnpinnedVersion   = lint.UnpinnedVersion
+	LintDuplicateGpuSetup = lint.DuplicateGpuSetup
+)
+
+// LintWarning flags a risky but valid configuration.
+type LintWarning = lint.Warning
+
+// LintResult is the result of linting a KfDef.
+type LintResult = lint.Result
+
+// makeLintEndpoint creates an endpoint to handle lint requests.
+func makeLintEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.Lint(ctx, req)
+	}
+}
@@ -0,0 +1,334 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/dnssrv"
+	"github.com/go-kit/kit/sd/lb"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SrvInstancePrefix prefixes a DNS SRV name e.g. that of a headless service passed to
+// NewKfctlClient as the instance. The replicas behind the name are looked up every srvTTL.
+const SrvInstancePrefix = "srv://"
+
+const (
+	// srvTTL is how often the instances behind a DNS SRV name are looked up.
+	srvTTL = 30 * time.Second
+	// unhealthyCooldown is how long requests skip an instance after it couldn't be reached.
+	unhealthyCooldown = 10 * time.Second
+	// failoverTimeout bounds a request including its failovers to other instances.
+	failoverTimeout = 10 * time.Minute
+)
+
+// errUnhealthy is returned instead of sending a request to an instance which recently couldn't
+// be reached.
+var errUnhealthy = errors.New("instance is unhealthy")
+
+// kitLogger logs the messages of go-kit's sd package with logrus.
+var kitLogger = kitlog.LoggerFunc(func(keyvals ...interface{}) error {
+	fields := log.Fields{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+	}
+	log.WithFields(fields).Info("Service discovery")
+	return nil
+})
+
+// instanceURL returns the URL of an instance of the server. The instance is a URL or a host with
+// an optional port and path prefix e.g. when the server is behind an ingress. Hosts may be IPv6
+// literals; a port requires the literal in brackets e.g. [::1]:8080. The scheme defaults to https
+// on port 443 and http otherwise.
+func instanceURL(instance string) (*url.URL, error) {
+	instance = strings.TrimSpace(instance)
+	if instance == "" {
+		return nil, fmt.Errorf("instance is empty")
+	}
+	if !strings.Contains(instance, "://") {
+		instance = bracketIPv6(instance)
+		instance = defaultScheme(instance) + "://" + instance
+	}
+	u, err := url.Parse(instance)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance %q: %v", instance, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid instance %q: scheme must be http or https", instance)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid instance %q: host is empty", instance)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid instance %q: port must be between 1 and 65535", instance)
+		}
+	} else if strings.HasSuffix(u.Host, ":") {
+		return nil, fmt.Errorf("invalid instance %q: port is empty", instance)
+	}
+	// Credentials would be sent in the clear to every endpoint and logged with the URL; the
+	// query and fragment would be dropped from the request paths.
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || u.Opaque != "" {
+		return nil, fmt.Errorf("invalid instance %q: only a scheme, host, port and path are allowed", instance)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u, nil
+}
+
+// bracketIPv6 encloses the host of instance in brackets if it is a bare IPv6 literal.
+func bracketIPv6(instance string) string {
+	host, rest := instance, ""
+	if i := strings.Index(instance, "/"); i >= 0 {
+		host, rest = instance[:i], instance[i:]
+	}
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") < 2 {
+		return instance
+	}
+	ip := host
+	zone := ""
+	if i := strings.Index(host, "%"); i >= 0 {
+		ip, zone = host[:i], host[i+1:]
+	}
+	if net.ParseIP(ip) == nil {
+		return instance
+	}
+	if zone != "" {
+		ip += "%25" + zone
+	}
+	return "[" + ip + "]" + rest
+}
+
+// defaultScheme returns the scheme of an instance given without one.
+func defaultScheme(instance string) string {
+	host := instance
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if strings.HasSuffix(host, ":443") {
+		return "https"
+	}
+	return "http"
+}
+
+// instanceHealth tracks the instances of the server known to the client and which of them
+// recently couldn't be reached.
+type instanceHealth struct {
+	mu sync.Mutex
+	// refs is the number of endpoints of each instance.
+	refs map[string]int
+	// unhealthyUntil is when each unreachable instance is tried again.
+	unhealthyUntil map[string]time.Time
+	// next is the count of instances picked.
+	next int
+	now  func() time.Time
+}
+
+func newInstanceHealth() *instanceHealth {
+	return &instanceHealth{
+		refs:           map[string]int{},
+		unhealthyUntil: map[string]time.Time{},
+		now:            time.Now,
+	}
+}
+
+func (h *instanceHealth) add(instance string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.refs[instance]++
+}
+
+func (h *instanceHealth) remove(instance string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.refs[instance]--
+	if h.refs[instance] <= 0 {
+		delete(h.refs, instance)
+		delete(h.unhealthyUntil, instance)
+	}
+}
+
+func (h *instanceHealth) markUnhealthy(instance string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	log.Warnf("Instance %v is unreachable; skipping it for %v", instance, unhealthyCooldown)
+	h.unhealthyUntil[instance] = h.now().Add(unhealthyCooldown)
+}
+
+// healthyLocked returns the known instances which aren't cooling down. If every instance is
+// cooling down it returns all of them since failing fast wouldn't help.
+func (h *instanceHealth) healthyLocked() []string {
+	now := h.now()
+	all := []string{}
+	healthy := []string{}
+	for i := range h.refs {
+		all = append(all, i)
+		if !now.Before(h.unhealthyUntil[i]) {
+			healthy = append(healthy, i)
+		}
+	}
+	if len(healthy) == 0 {
+		return all
+	}
+	return healthy
+}
+
+// available returns whether requests should be sent to the instance.
+func (h *instanceHealth) available(instance string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, i := range h.healthyLocked() {
+		if i == instance {
+			return true
+		}
+	}
+	return false
+}
+
+// pick returns the available instances in turn.
+func (h *instanceHealth) pick() (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	healthy := h.healthyLocked()
+	if len(healthy) == 0 {
+		return "", lb.ErrNoEndpoints
+	}
+	// Map iteration order is random so the instances are sorted for round robin.
+	sort.Strings(healthy)
+	h.next++
+	return healthy[h.next%len(healthy)], nil
+}
+
+// instanceBalancer spreads the requests of a client over the replicas of the server.
+type instanceBalancer struct {
+	instancer sd.Instancer
+	health    *instanceHealth
+}
+
+// newInstanceBalancer returns a balancer over the instances, or nil if there is a single
+// instance. instances is either a comma separated list of instances or a DNS SRV name
+// prefixed with SrvInstancePrefix. The base URL of the client is returned for building
+// the URLs of requests not made with endpoints.
+func newInstanceBalancer(instances string) (*instanceBalancer, *url.URL, error) {
+	if strings.HasPrefix(instances, SrvInstancePrefix) {
+		name := strings.TrimPrefix(instances, SrvInstancePrefix)
+		// The instancer lives as long as the client so it's never stopped.
+		return &instanceBalancer{
+			instancer: dnssrv.NewInstancer(name, srvTTL, kitLogger),
+			health:    newInstanceHealth(),
+		}, &url.URL{Scheme: "http", Host: name}, nil
+	}
+
+	fixed := sd.FixedInstancer{}
+	for _, i := range strings.Split(instances, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			fixed = append(fixed, i)
+		}
+	}
+	if len(fixed) == 0 {
+		return nil, nil, fmt.Errorf("no instances in %q", instances)
+	}
+	u, err := instanceURL(fixed[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fixed) == 1 {
+		return nil, u, nil
+	}
+	for _, i := range fixed[1:] {
+		if _, err := instanceURL(i); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &instanceBalancer{
+		instancer: fixed,
+		health:    newInstanceHealth(),
+	}, u, nil
+}
+
+// endpoint returns an endpoint sending each request to the next available instance. Requests
+// are sent to another instance if the instance can't be reached or is overloaded.
+func (b *instanceBalancer) endpoint(f sd.Factory) endpoint.Endpoint {
+	endpointer := sd.NewEndpointer(b.instancer, b.healthAware(f), kitLogger)
+	retry := lb.RetryWithCallback(failoverTimeout, lb.NewRoundRobin(endpointer),
+		func(n int, err error) (bool, error) {
+			endpoints, _ := endpointer.Endpoints()
+			return n < len(endpoints) && shouldFailover(err), nil
+		})
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := retry(ctx, request)
+		// Return the error of the last instance so the client can decide whether to retry.
+		if r, ok := err.(lb.RetryError); ok {
+			err = r.Final
+		}
+		return resp, err
+	}
+}
+
+// healthAware wraps the endpoints created by f to skip instances which couldn't be reached.
+func (b *instanceBalancer) healthAware(f sd.Factory) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		e, closer, err := f(instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		b.health.add(instance)
+		healthy := func(ctx context.Context, request interface{}) (interface{}, error) {
+			if !b.health.available(instance) {
+				return nil, errUnhealthy
+			}
+			resp, err := e(ctx, request)
+			if _, ok := err.(*url.Error); ok && ctx.Err() == nil {
+				b.health.markUnhealthy(instance)
+			}
+			return resp, err
+		}
+		return healthy, closerFunc(func() error {
+			b.health.remove(instance)
+			if closer != nil {
+				return closer.Close()
+			}
+			return nil
+		}), nil
+	}
+}
+
+// url returns the URL of path on the next available instance.
+func (b *instanceBalancer) url(path string) (*url.URL, error) {
+	instance, err := b.health.pick()
+	if err != nil {
+		return nil, err
+	}
+	u, err := instanceURL(instance)
+	if err != nil {
+		return nil, err
+	}
+	return copyURL(u, path), nil
+}
+
+// shouldFailover returns whether a request which failed with err should be sent to another
+// instance. Errors reported by the server other than overload apply to every instance.
+func shouldFailover(err error) bool {
+	switch err.(type) {
+	case *url.Error, *OverloadedError:
+		return true
+	}
+	return err == errUnhealthy
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,310 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRetryAfter is how long clients are asked to wait when the server is overloaded.
+const defaultRetryAfter = 30 * time.Second
+
+// cgroupRoot is where the memory controller of the container is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// OverloadedError is returned when the server rejects a new deployment because it is saturated.
+// It is served as a 503 with a Retry-After header; the client waits at least RetryAfter before
+// retrying the request.
+type OverloadedError struct {
+	// Reason is the resource which crossed its threshold e.g. memory.
+	Reason string
+	// Message describes the load of the server.
+	Message string
+	// RetryAfter is how long the client should wait before retrying.
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return e.Message
+}
+
+// StatusCode implements the StatusCoder interface of go-kit's http transport.
+func (e *OverloadedError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// Headers implements the Headerer interface of go-kit's http transport.
+func (e *OverloadedError) Headers() http.Header {
+	return http.Header{
+		"Retry-After": []string{strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds())))},
+	}
+}
+
+// MarshalJSON encodes the error like an httpError so older clients can still decode it.
+func (e *OverloadedError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&httpError{
+		Message: e.Message,
+		Code:    e.StatusCode(),
+	})
+}
+
+// IsOverloaded returns true if err is an OverloadedError.
+func IsOverloaded(err error) bool {
+	_, ok := err.(*OverloadedError)
+	return ok
+}
+
+// overloadedError returns the OverloadedError sent in the response r with the decoded body h or
+// nil if r isn't a 503 with a Retry-After header.
+func overloadedError(r *http.Response, h *httpError) *OverloadedError {
+	if r.StatusCode != http.StatusServiceUnavailable {
+		return nil
+	}
+	seconds, err := strconv.Atoi(r.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return nil
+	}
+	return &OverloadedError{
+		Message:    h.Message,
+		RetryAfter: time.Duration(seconds) * time.Second,
+	}
+}
+
+// loadSample is the utilization of the server.
+type loadSample struct {
+	// memory is the fraction of the memory limit in use.
+	memory float64
+	// cpu is the 1 minute load average per CPU.
+	cpu float64
+}
+
+// LoadShedder rejects new deployments while the server is saturated so that it isn't OOM-killed
+// in the middle of applying a deployment. A threshold of 0 disables the check.
+type LoadShedder struct {
+	// MaxMemory is the fraction of the memory limit in use above which deployments are rejected.
+	MaxMemory float64
+	// MaxCPU is the load average per CPU above which deployments are rejected.
+	MaxCPU float64
+	// MaxInFlight is the number of deployments queued or being handled at which new ones are rejected.
+	MaxInFlight int
+	// RetryAfter is how long rejected clients are asked to wait; defaults to defaultRetryAfter.
+	RetryAfter time.Duration
+
+	// sample returns the current utilization; defaults to sampleLoad. Overridden in tests.
+	sample func() (*loadSample, error)
+}
+
+// NewLoadShedderFromSpec parses a comma separated spec of the form
+// "memory=0.85,cpu=2,inflight=5,retry-after=30s" into a LoadShedder.
+func NewLoadShedderFromSpec(spec string) (*LoadShedder, error) {
+	l := &LoadShedder{}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		pieces := strings.SplitN(pair, "=", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("invalid load shedding spec %v; expected key=value", pair)
+		}
+		k, v := pieces[0], pieces[1]
+
+		switch k {
+		case "memory":
+			m, err := strconv.ParseFloat(v, 64)
+			if err != nil || m < 0 || m > 1 {
+				return nil, fmt.Errorf("invalid memory threshold %v; must be in [0, 1]", v)
+			}
+			l.MaxMemory = m
+		case "cpu":
+			c, err := strconv.ParseFloat(v, 64)
+			if err != nil || c < 0 {
+				return nil, fmt.Errorf("invalid cpu threshold %v; must be a non negative load per CPU", v)
+			}
+			l.MaxCPU = c
+		case "inflight":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid inflight threshold %v; must be a non negative integer", v)
+			}
+			l.MaxInFlight = n
+		case "retry-after":
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid retry-after %v; %v", v, err)
+			}
+			l.RetryAfter = d
+		default:
+			return nil, fmt.Errorf("unknown load shedding threshold %v", k)
+		}
+	}
+	return l, nil
+}
+
+// admit returns an OverloadedError if a new deployment shouldn't be accepted while inFlight
+// deployments are queued or being handled.
+func (l *LoadShedder) admit(inFlight int) error {
+	retryAfter := l.RetryAfter
+	if retryAfter == 0 {
+		retryAfter = defaultRetryAfter
+	}
+	overloaded := func(reason string, format string, args ...interface{}) error {
+		msg := fmt.Sprintf("The server is overloaded; "+format+"; please retry your request in %v.",
+			append(args, retryAfter)...)
+		log.Warnf("Rejecting deployment; %v", msg)
+		return &OverloadedError{
+			Reason:     reason,
+			Message:    msg,
+			RetryAfter: retryAfter,
+		}
+	}
+
+	if l.MaxInFlight > 0 && inFlight >= l.MaxInFlight {
+		return overloaded("inflight", "%v deployments are in flight", inFlight)
+	}
+
+	if l.MaxMemory == 0 && l.MaxCPU == 0 {
+		return nil
+	}
+	sample := l.sample
+	if sample == nil {
+		sample = sampleLoad
+	}
+	load, err := sample()
+	if err != nil {
+		// Don't reject requests because the load couldn't be measured.
+		log.Warnf("Could not measure the load of the server; not shedding load; error %v", err)
+		return nil
+	}
+	if l.MaxMemory > 0 && load.memory > l.MaxMemory {
+		return overloaded("memory", "%.0f%% of its memory is in use", load.memory*100)
+	}
+	if l.MaxCPU > 0 && load.cpu > l.MaxCPU {
+		return overloaded("cpu", "the load average per CPU is %.2f", load.cpu)
+	}
+	return nil
+}
+
+// sampleLoad measures the memory of the container and the load average of the host.
+func sampleLoad() (*loadSample, error) {
+	memory, err := readCgroupMemory(cgroupRoot)
+	if err != nil {
+		log.Debugf("Could not read the cgroup memory usage; falling back to /proc/meminfo; error %v", err)
+		if memory, err = readMeminfo("/proc/meminfo"); err != nil {
+			return nil, err
+		}
+	}
+
+	buf, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(buf))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("/proc/loadavg is empty")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid load average %v; %v", fields[0], err)
+	}
+
+	return &loadSample{
+		memory: memory,
+		cpu:    load / float64(runtime.NumCPU()),
+	}, nil
+}
+
+// readCgroupMemory returns the fraction of the memory limit of the cgroup mounted at root in use.
+// Both cgroup v2 and v1 are supported; an error is returned if the cgroup has no limit.
+func readCgroupMemory(root string) (float64, error) {
+	readInt := func(file string) (int64, error) {
+		buf, err := ioutil.ReadFile(path.Join(root, file))
+		if err != nil {
+			return 0, err
+		}
+		v := strings.TrimSpace(string(buf))
+		if v == "max" {
+			return 0, fmt.Errorf("%v isn't limited", file)
+		}
+		return strconv.ParseInt(v, 10, 64)
+	}
+
+	files := [][2]string{
+		{"memory.current", "memory.max"},
+		{"memory/memory.usage_in_bytes", "memory/memory.limit_in_bytes"},
+	}
+	var lastErr error
+	for _, f := range files {
+		usage, err := readInt(f[0])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		limit, err := readInt(f[1])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		// cgroup v1 reports an unlimited cgroup with a limit close to the max int64.
+		if limit <= 0 || limit >= math.MaxInt64/2 {
+			return 0, fmt.Errorf("the memory of cgroup %v isn't limited", root)
+		}
+		return float64(usage) / float64(limit), nil
+	}
+	return 0, lastErr
+}
+
+// readMeminfo returns the fraction of the memory of the host in use.
+func readMeminfo(file string) (float64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	total, ok := values["MemTotal"]
+	available, hasAvailable := values["MemAvailable"]
+	if !ok || !hasAvailable || total == 0 {
+		return 0, fmt.Errorf("%v doesn't report MemTotal and MemAvailable", file)
+	}
+	return (total - available) / total, nil
+}
+
+// inFlight returns the number of deployments queued or being handled by the server.
+func (s *kfctlServer) inFlight() int {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	n := len(s.c)
+	if s.busy {
+		n++
+	}
+	return n
+}
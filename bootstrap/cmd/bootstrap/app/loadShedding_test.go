@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"golang.org/x/time/rate"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestNewLoadShedderFromSpec(t *testing.T) {
+	l, err := NewLoadShedderFromSpec("memory=0.85, cpu=2,inflight=5,retry-after=1m")
+	if err != nil {
+		t.Fatalf("NewLoadShedderFromSpec failed; %v", err)
+	}
+	if l.MaxMemory != 0.85 || l.MaxCPU != 2 || l.MaxInFlight != 5 || l.RetryAfter != time.Minute {
+		t.Errorf("NewLoadShedderFromSpec: got %+v", l)
+	}
+
+	for _, spec := range []string{"memory=1.5", "inflight=-1", "cpu", "disk=0.5"} {
+		if _, err := NewLoadShedderFromSpec(spec); err == nil {
+			t.Errorf("NewLoadShedderFromSpec(%v): want an error", spec)
+		}
+	}
+}
+
+func TestLoadShedder_admit(t *testing.T) {
+	type testCase struct {
+		load     *loadSample
+		inFlight int
+		reason   string
+	}
+
+	testCases := []testCase{
+		{load: &loadSample{memory: 0.5, cpu: 0.5}, inFlight: 1, reason: ""},
+		{load: &loadSample{memory: 0.5, cpu: 0.5}, inFlight: 3, reason: "inflight"},
+		{load: &loadSample{memory: 0.95, cpu: 0.5}, inFlight: 0, reason: "memory"},
+		{load: &loadSample{memory: 0.5, cpu: 3}, inFlight: 0, reason: "cpu"},
+		// The load couldn't be measured.
+		{load: nil, inFlight: 0, reason: ""},
+	}
+
+	for _, c := range testCases {
+		l := &LoadShedder{
+			MaxMemory:   0.9,
+			MaxCPU:      2,
+			MaxInFlight: 3,
+			sample: func() (*loadSample, error) {
+				if c.load == nil {
+					return nil, fmt.Errorf("no load")
+				}
+				return c.load, nil
+			},
+		}
+		err := l.admit(c.inFlight)
+		if c.reason == "" {
+			if err != nil {
+				t.Errorf("admit(%v) with load %+v: got %v; want no error", c.inFlight, c.load, err)
+			}
+			continue
+		}
+		o, ok := err.(*OverloadedError)
+		if !ok || o.Reason != c.reason || o.RetryAfter != defaultRetryAfter {
+			t.Errorf("admit(%v) with load %+v: got %v; want an OverloadedError for %v", c.inFlight, c.load, err, c.reason)
+		}
+	}
+}
+
+func TestOverloadedError_RoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorEncoder(context.Background(), &OverloadedError{
+			Reason:     "memory",
+			Message:    "The server is overloaded",
+			RetryAfter: 1500 * time.Millisecond,
+		}, w)
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get failed; %v", err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Retry-After") != "2" {
+		t.Errorf("Retry-After: got %v; want 2", res.Header.Get("Retry-After"))
+	}
+
+	_, err = decodeHTTPKfdefResponse(context.Background(), res)
+	o, ok := err.(*OverloadedError)
+	if !ok {
+		t.Fatalf("decodeHTTPKfdefResponse: got %v; want an OverloadedError", err)
+	}
+	if o.Message != "The server is overloaded" || o.RetryAfter != 2*time.Second {
+		t.Errorf("decodeHTTPKfdefResponse: got %+v", o)
+	}
+}
+
+func TestBudgetBackOff_RetryAfter(t *testing.T) {
+	bo := &budgetBackOff{
+		BackOff: backoff.NewConstantBackOff(time.Second),
+		budget:  NewRetryBudget(rate.Inf, 1),
+	}
+	if next := bo.NextBackOff(); next != time.Second {
+		t.Errorf("NextBackOff: got %v; want 1s", next)
+	}
+	bo.retryAfter = time.Minute
+	if next := bo.NextBackOff(); next != time.Minute {
+		t.Errorf("NextBackOff after a Retry-After: got %v; want 1m", next)
+	}
+}
+
+func TestReadCgroupMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := readCgroupMemory(dir); err == nil {
+		t.Errorf("readCgroupMemory without a cgroup: want an error")
+	}
+
+	write := func(file string, contents string) {
+		if err := ioutil.WriteFile(path.Join(dir, file), []byte(contents), 0644); err != nil {
+			t.Fatalf("Could not write %v; %v", file, err)
+		}
+	}
+	write("memory.current", "750\n")
+	write("memory.max", "max\n")
+	if _, err := readCgroupMemory(dir); err == nil {
+		t.Errorf("readCgroupMemory of an unlimited cgroup: want an error")
+	}
+
+	write("memory.max", "1000\n")
+	if m, err := readCgroupMemory(dir); err != nil || m != 0.75 {
+		t.Errorf("readCgroupMemory: got %v, %v; want 0.75", m, err)
+	}
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"k8s.io/client-go/rest"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// UnixInstancePrefix prefixes the path of the unix socket of a kfctl server passed to
+// NewKfctlClient as the instance e.g. unix:///tmp/kfctl.sock.
+const UnixInstancePrefix = "unix://"
+
+// unixSocketHost is the host of the URLs of requests sent over a unix socket; it is ignored.
+const unixSocketHost = "kfctl.sock"
+
+// localSocketName is the name of the socket of a LocalServer in a temporary directory.
+const localSocketName = "kfctl.sock"
+
+// newUnixSocketClient returns an http.Client sending every request to the unix socket at socket.
+func newUnixSocketClient(socket string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// listenUnix listens on the unix socket at socket; only the user running the server can connect
+// to it. A socket left behind by a server which exited is replaced.
+func listenUnix(socket string) (net.Listener, error) {
+	if _, err := os.Stat(socket); err == nil {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a server is already listening on %v", socket)
+		}
+		log.Infof("Removing stale socket %v", socket)
+		if err := os.Remove(socket); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not listen on %v", socket)
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, errors.WithStack(err)
+	}
+	return listener, nil
+}
+
+// LocalServerOptions configures a LocalServer.
+type LocalServerOptions struct {
+	// AppsDir holds the app directory of the deployment, named after it, and the state of the
+	// server. An existing app directory e.g. one created by kfctl init is applied as is.
+	AppsDir string
+	// Socket is the path of the unix socket to serve on; a socket in a new temporary directory is
+	// used if it is empty.
+	Socket string
+	// TargetCluster if non nil is the cluster the deployment is applied to instead of a GKE cluster
+	// created for it; GCP credentials aren't checked.
+	TargetCluster *rest.Config
+}
+
+// LocalServer is a kfctl server running in the process of a CLI. It serves the endpoints of a
+// hosted kfctl server on a unix socket and is driven with a KfctlClient like a remote server, so
+// deployments made locally and by the hosted service go through the same code path.
+type LocalServer struct {
+	server  *kfctlServer
+	http    *http.Server
+	socket  string
+	tempDir string
+}
+
+// StartLocalServer starts a kfctl server handling the deployment in opts.AppsDir.
+func StartLocalServer(opts LocalServerOptions) (*LocalServer, error) {
+	l := &LocalServer{socket: opts.Socket}
+	if l.socket == "" {
+		tempDir, err := ioutil.TempDir("", "kfctl")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		l.tempDir = tempDir
+		l.socket = path.Join(tempDir, localSocketName)
+	}
+	listener, err := listenUnix(l.socket)
+	if err != nil {
+		l.removeTempDir()
+		return nil, err
+	}
+
+	s, err := NewKfctlServer(opts.AppsDir)
+	if err != nil {
+		listener.Close()
+		l.removeTempDir()
+		return nil, err
+	}
+	s.targetCluster = opts.TargetCluster
+	s.mux = http.NewServeMux()
+	s.RegisterEndpoints()
+	l.server = s
+	l.http = &http.Server{Handler: s.mux}
+
+	go func() {
+		if err := l.http.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Local kfctl server on %v stopped; %v", l.socket, err)
+		}
+	}()
+	log.Infof("Local kfctl server listening on %v", l.socket)
+	return l, nil
+}
+
+// Instance returns the instance to pass to NewKfctlClient to talk to the server.
+func (l *LocalServer) Instance() string {
+	return UnixInstancePrefix + l.socket
+}
+
+// NewClient returns a client of the server.
+func (l *LocalServer) NewClient(opts ...KfctlClientOption) (*KfctlClient, error) {
+	c, err := NewKfctlClient(l.Instance(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.(*KfctlClient), nil
+}
+
+// Close drains the server waiting up to timeout for the in-flight deployment to be checkpointed
+// at a phase boundary, so it resumes from there the next time a server is started in the apps
+// directory, and stops serving.
+func (l *LocalServer) Close(timeout time.Duration) error {
+	drainErr := l.server.Drain(timeout)
+	err := l.http.Close()
+	l.removeTempDir()
+	if drainErr != nil {
+		return drainErr
+	}
+	return errors.WithStack(err)
+}
+
+// removeTempDir removes the temporary directory holding the socket if the server created one.
+func (l *LocalServer) removeTempDir() {
+	if l.tempDir == "" {
+		return
+	}
+	if err := os.RemoveAll(l.tempDir); err != nil {
+		log.Warnf("Could not remove %v; %v", l.tempDir, err)
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A socket left behind by a server which exited is replaced.
+	socket := path.Join(dir, "kfctl.sock")
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Could not listen on %v; %v", socket, err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := StartLocalServer(LocalServerOptions{AppsDir: dir, Socket: socket})
+	if err != nil {
+		t.Fatalf("StartLocalServer error; %v", err)
+	}
+	if l.Instance() != "unix://"+socket {
+		t.Errorf("Got instance %v; want unix://%v", l.Instance(), socket)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Got socket %v, %v; want it to be only accessible by the user", info, err)
+	}
+
+	// A second server can't take over the socket.
+	if _, err := StartLocalServer(LocalServerOptions{AppsDir: dir, Socket: socket}); err == nil || !strings.Contains(err.Error(), "already listening") {
+		t.Errorf("Starting a second server on %v: got %v; want an error", socket, err)
+	}
+
+	c, err := l.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient error; %v", err)
+	}
+	list, err := c.ListDeployments(context.Background(), kfdefsv3.KfDef{})
+	if err != nil {
+		t.Fatalf("ListDeployments over the socket failed; %v", err)
+	}
+	if len(list.Deployments) != 0 {
+		t.Errorf("Got deployments %v; want none", list.Deployments)
+	}
+	if _, err := c.GetLatestKfdef(kfdefsv3.KfDef{}); err != nil {
+		t.Errorf("GetLatestKfdef over the socket failed; %v", err)
+	}
+
+	if err := l.Close(time.Second); err != nil {
+		t.Errorf("Close error; %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("The socket wasn't removed; %v", err)
+	}
+}
+
+func TestLocalServer_TempSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := StartLocalServer(LocalServerOptions{AppsDir: dir})
+	if err != nil {
+		t.Fatalf("StartLocalServer error; %v", err)
+	}
+	socketDir := path.Dir(strings.TrimPrefix(l.Instance(), UnixInstancePrefix))
+	if err := l.Close(time.Second); err != nil {
+		t.Errorf("Close error; %v", err)
+	}
+	if _, err := os.Stat(socketDir); !os.IsNotExist(err) {
+		t.Errorf("The temporary directory of the socket wasn't removed; %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KfctlLogsPath is the path on which to serve requests for pages of the recent output of the deployment
+const KfctlLogsPath = "/kfctl/apps/v1alpha2/logs/output"
+
+// defaultLogBufferBytes bounds the output kept in memory for a deployment when the server config
+// doesn't set logBufferBytes.
+const defaultLogBufferBytes = 1 << 20
+
+// minLogBufferBytes is the smallest buffer the server config may set.
+const minLogBufferBytes = 64 << 10
+
+// logLineOverhead approximates the bytes a line takes in the buffer besides its message.
+const logLineOverhead = 64
+
+// defaultLogPageLines and maxLogPageLines bound the lines returned by GetLogs.
+const (
+	defaultLogPageLines = 500
+	maxLogPageLines     = 5000
+)
+
+// LogsRequest requests a page of the recent output of a deployment.
+type LogsRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// Offset is the offset of the first line to return; lines are numbered from 0 when the server
+	// starts. A negative offset counts back from the end e.g. -100 returns the last 100 lines.
+	Offset int64 `json:"offset"`
+	// Limit bounds the lines returned; defaults to 500 and at most 5000.
+	Limit int `json:"limit,omitempty"`
+}
+
+// LogLine is a line of the output of a deployment.
+type LogLine struct {
+	Offset  int64           `json:"offset"`
+	Time    time.Time       `json:"time"`
+	Level   string          `json:"level"`
+	Phase   DeploymentPhase `json:"phase,omitempty"`
+	Message string          `json:"message"`
+}
+
+// LogPage is a page of the output of a deployment kept in memory by the kfctl server. The oldest
+// lines are rotated out once the output exceeds the size of the buffer so the most recent output
+// is always available, including on servers without persistent storage.
+type LogPage struct {
+	Name  string    `json:"name"`
+	Lines []LogLine `json:"lines"`
+	// Start is the offset of the oldest line still in the buffer.
+	Start int64 `json:"start"`
+	// Next is the offset to request the following page with; End if the page reaches the end.
+	Next int64 `json:"next"`
+	// End is the offset the next line of output will have.
+	End int64 `json:"end"`
+	// Skipped is the number of requested lines which were rotated out before they were read.
+	Skipped int64 `json:"skipped,omitempty"`
+	// Running is true while a run is in progress; more lines will be added.
+	Running bool `json:"running"`
+}
+
+// logBuffer keeps the output of the runs of a deployment in memory. Lines are added while a run is
+// in progress at every level logged by the server and the oldest are dropped once their size
+// exceeds the limit. It is a logrus hook.
+type logBuffer struct {
+	mu sync.Mutex
+	// maxBytes returns the size of the buffer; it is read on every line so it follows the config.
+	maxBytes func() int
+	lines    []LogLine
+	size     int
+	// start is the offset of lines[0].
+	start   int64
+	name    string
+	running bool
+	phase   DeploymentPhase
+}
+
+// newLogBuffer creates a logBuffer bounded by the size maxBytes returns.
+func newLogBuffer(maxBytes func() int) *logBuffer {
+	return &logBuffer{
+		maxBytes: maxBytes,
+		lines:    []LogLine{},
+	}
+}
+
+// lineSize returns the bytes l takes in the buffer.
+func lineSize(l LogLine) int {
+	return len(l.Message) + logLineOverhead
+}
+
+// begin starts capturing the output of a run of the named deployment; the output of the previous
+// runs is kept until it is rotated out.
+func (b *logBuffer) begin(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.name = name
+	b.running = true
+	b.phase = PhasePending
+}
+
+// enterPhase tags the lines added next with phase.
+func (b *logBuffer) enterPhase(phase DeploymentPhase) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.phase = phase
+}
+
+// finish stops capturing output until the next run.
+func (b *logBuffer) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = false
+}
+
+// Levels implements logrus.Hook.
+func (b *logBuffer) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook. logrus holds its lock while hooks fire so nothing may be logged here.
+func (b *logBuffer) Fire(e *log.Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.running {
+		return nil
+	}
+	b.add(LogLine{
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Phase:   b.phase,
+		Message: e.Message,
+	})
+	return nil
+}
+
+// add appends l rotating out the oldest lines past the size of the buffer. A line larger than the
+// buffer is truncated. Callers must hold mu.
+func (b *logBuffer) add(l LogLine) {
+	max := b.maxBytes()
+	if over := lineSize(l) - max; over > 0 {
+		keep := len(l.Message) - over
+		if keep < 0 {
+			keep = 0
+		}
+		l.Message = l.Message[:keep]
+	}
+	l.Offset = b.start + int64(len(b.lines))
+	b.lines = append(b.lines, l)
+	b.size += lineSize(l)
+	dropped := 0
+	for b.size > max && dropped < len(b.lines) {
+		b.size -= lineSize(b.lines[dropped])
+		dropped++
+	}
+	if dropped > 0 {
+		// Copy the lines kept so the dropped ones don't stay reachable through the backing array.
+		b.lines = append([]LogLine{}, b.lines[dropped:]...)
+		b.start += int64(dropped)
+	}
+}
+
+// page returns the lines from offset; at most limit of them.
+func (b *logBuffer) page(name string, offset int64, limit int) (*LogPage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.name == "" || b.name != name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("No output of deployment %v was captured", name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	if limit <= 0 {
+		limit = defaultLogPageLines
+	}
+	if limit > maxLogPageLines {
+		limit = maxLogPageLines
+	}
+
+	end := b.start + int64(len(b.lines))
+	if offset < 0 {
+		offset = end + offset
+	}
+	p := &LogPage{
+		Name:    b.name,
+		Lines:   []LogLine{},
+		Start:   b.start,
+		End:     end,
+		Running: b.running,
+	}
+	if offset < b.start {
+		p.Skipped = b.start - offset
+		offset = b.start
+	}
+	if offset > end {
+		offset = end
+	}
+	first := int(offset - b.start)
+	last := first + limit
+	if last > len(b.lines) {
+		last = len(b.lines)
+	}
+	p.Lines = append(p.Lines, b.lines[first:last]...)
+	p.Next = offset + int64(len(p.Lines))
+	return p, nil
+}
+
+// logBufferBytes returns the size of the log buffer set by the server config.
+func (s *kfctlServer) logBufferBytes() int {
+	if s.config != nil {
+		if n := s.config.get().LogBufferBytes; n > 0 {
+			return n
+		}
+	}
+	return defaultLogBufferBytes
+}
+
+// GetLogs returns a page of the recent output of the deployment handled by the server.
+func (s *kfctlServer) GetLogs(ctx context.Context, req LogsRequest) (*LogPage, error) {
+	if req.KfDef.Name == "" {
+		return nil, &httpError{
+			Message: "name is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return s.logBuffer.page(req.KfDef.Name, req.Offset, req.Limit)
+}
+
+// GetLogs forwards the request to the backend handling the deployment. The output is only kept in
+// the memory of the leader so standby replicas can't serve it.
+func (r *kfctlRouter) GetLogs(ctx context.Context, req LogsRequest) (*LogPage, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetLogs(ctx, req)
+}
+
+// GetLogs returns a page of the recent output of the deployment. Follow a run by requesting the
+// Next offset of each page until the page isn't Running and reaches its End.
+func (c *KfctlClient) GetLogs(ctx context.Context, req LogsRequest) (*LogPage, error) {
+	var resp interface{}
+	err := c.retry("GetLogs", func() error {
+		var err error
+		resp, err = c.logsEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*LogPage)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeLogsEndpoint creates an endpoint to handle requests for pages of the recent output.
+func makeLogsEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(LogsRequest)
+		return svc.GetLogs(ctx, req)
+	}
+}
+
+// decodeHTTPLogsRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded LogsRequest from the HTTP request body.
+func decodeHTTPLogsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request LogsRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding logs request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
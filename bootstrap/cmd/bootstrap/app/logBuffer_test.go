@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fillLogBuffer adds n lines whose messages are their index.
+func fillLogBuffer(b *logBuffer, n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < n; i++ {
+		b.add(LogLine{Time: time.Now(), Level: "info", Message: strings.Repeat("x", 36)})
+	}
+}
+
+func TestLogBuffer_Rotation(t *testing.T) {
+	// Each line takes 100 bytes so the buffer keeps the last 10.
+	b := newLogBuffer(func() int { return 1000 })
+	b.begin("kf-app")
+	fillLogBuffer(b, 25)
+
+	p, err := b.page("kf-app", 0, 0)
+	if err != nil {
+		t.Fatalf("page: %v", err)
+	}
+	if p.Start != 15 || p.End != 25 || p.Skipped != 15 || len(p.Lines) != 10 || p.Next != 25 {
+		t.Errorf("page after rotation: got start %v, end %v, skipped %v, %v lines, next %v; want 15, 25, 15, 10, 25",
+			p.Start, p.End, p.Skipped, len(p.Lines), p.Next)
+	}
+	if p.Lines[0].Offset != 15 || p.Lines[9].Offset != 24 {
+		t.Errorf("page after rotation: got offsets %v to %v; want 15 to 24", p.Lines[0].Offset, p.Lines[9].Offset)
+	}
+	if b.size > 1000 {
+		t.Errorf("buffer holds %v bytes; want at most 1000", b.size)
+	}
+
+	// A line larger than the buffer is truncated and replaces the others.
+	b.mu.Lock()
+	b.add(LogLine{Message: strings.Repeat("y", 2000)})
+	b.mu.Unlock()
+	p, _ = b.page("kf-app", -1, 0)
+	if len(p.Lines) != 1 || lineSize(p.Lines[0]) != 1000 || p.Start != 25 {
+		t.Errorf("page after a large line: got %v lines starting at %v", len(p.Lines), p.Start)
+	}
+}
+
+func TestLogBuffer_Page(t *testing.T) {
+	type testCase struct {
+		offset  int64
+		limit   int
+		first   int64
+		lines   int
+		next    int64
+		skipped int64
+	}
+
+	b := newLogBuffer(func() int { return defaultLogBufferBytes })
+	b.begin("kf-app")
+	fillLogBuffer(b, 20)
+
+	cases := []testCase{
+		{offset: 0, limit: 5, first: 0, lines: 5, next: 5},
+		{offset: 5, limit: 5, first: 5, lines: 5, next: 10},
+		{offset: 18, limit: 5, first: 18, lines: 2, next: 20},
+		{offset: 20, limit: 5, lines: 0, next: 20},
+		{offset: 50, limit: 5, lines: 0, next: 20},
+		{offset: -3, first: 17, lines: 3, next: 20},
+		{offset: -30, limit: 5, first: 0, lines: 5, next: 5, skipped: 10},
+	}
+
+	for _, c := range cases {
+		p, err := b.page("kf-app", c.offset, c.limit)
+		if err != nil {
+			t.Errorf("page(%v, %v): %v", c.offset, c.limit, err)
+			continue
+		}
+		if len(p.Lines) != c.lines || p.Next != c.next || p.Skipped != c.skipped {
+			t.Errorf("page(%v, %v): got %v lines, next %v, skipped %v; want %v, %v, %v", c.offset, c.limit,
+				len(p.Lines), p.Next, p.Skipped, c.lines, c.next, c.skipped)
+			continue
+		}
+		if c.lines > 0 && p.Lines[0].Offset != c.first {
+			t.Errorf("page(%v, %v): got first offset %v; want %v", c.offset, c.limit, p.Lines[0].Offset, c.first)
+		}
+	}
+
+	if _, err := b.page("other", 0, 0); err == nil {
+		t.Errorf("page of another deployment: got nil; want error")
+	}
+}
+
+func TestKfctlServer_GetLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logBuffer")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := LogsRequest{KfDef: newPlanTestKfDef()}
+
+	_, err = s.GetLogs(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("GetLogs before any run: want 404; got %v", err)
+	}
+
+	// Output is captured at every level while a run is in progress.
+	s.logBuffer.begin(req.KfDef.Name)
+	s.setPhase(PhaseGenerate)
+	log.Warnf("captured while generating")
+	s.logBuffer.finish()
+	log.Warnf("not captured after the run")
+
+	p, err := s.GetLogs(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetLogs: %v", err)
+	}
+	found := false
+	for _, l := range p.Lines {
+		found = found || (l.Message == "captured while generating" && l.Phase == PhaseGenerate)
+		if l.Message == "not captured after the run" {
+			t.Errorf("GetLogs returned a line logged after the run")
+		}
+	}
+	if !found || p.Running {
+		t.Errorf("GetLogs: got %+v", p)
+	}
+}
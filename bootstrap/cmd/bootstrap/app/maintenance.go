@@ -0,0 +1,609 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// KfctlMaintenancePath is the path on which to serve maintenance schedule requests
+const KfctlMaintenancePath = "/kfctl/apps/v1alpha2/maintenance"
+
+// KfctlMaintenanceRunPath is the path on which to serve requests to run a maintenance task now
+const KfctlMaintenanceRunPath = "/kfctl/apps/v1alpha2/maintenance/run"
+
+// MaintenanceLabel labels the ConfigMaps in which the router persists the maintenance schedules.
+const MaintenanceLabel = "kfctl.kubeflow.org/maintenance"
+
+// maintenanceStateKey is the key of the ConfigMap data holding the schedule.
+const maintenanceStateKey = "schedule.json"
+
+// defaultMaxMaintenanceEvents is the number of task executions retained.
+const defaultMaxMaintenanceEvents = 50
+
+// minMaintenanceInterval is the smallest interval a task can be scheduled at.
+const minMaintenanceInterval = time.Hour
+
+// maintenancePeriod is how often the router runs the due tasks.
+const maintenancePeriod = time.Minute
+
+// MaintenanceTaskType identifies a recurring maintenance task.
+type MaintenanceTaskType string
+
+const (
+	// TaskRotateIAPSecret writes the current IAP OAuth client credentials to the cluster.
+	TaskRotateIAPSecret MaintenanceTaskType = "RotateIAPSecret"
+	// TaskRenewCertificate reissues the Let's Encrypt certificate if it is about to expire.
+	TaskRenewCertificate MaintenanceTaskType = "RenewCertificate"
+	// TaskRefreshServiceAccountKeys replaces the service account keys stored in the cluster.
+	TaskRefreshServiceAccountKeys MaintenanceTaskType = "RefreshServiceAccountKeys"
+	// TaskApplyDeferredUpdate applies an update deferred to the next maintenance window. It isn't
+	// scheduled; the router sends it once a window opens.
+	TaskApplyDeferredUpdate MaintenanceTaskType = "ApplyDeferredUpdate"
+)
+
+// MaintenanceConfig enables recurring maintenance of the deployments. The router keeps the schedule
+// of each deployment in a ConfigMap and asks the kfctl server of the deployment to run the due
+// tasks, starting it again if it was removed while idle. The updates deferred to the maintenance
+// windows of a deployment are kept and sent the same way. The tasks and updates run as the deployer
+// service account of the deployment so they don't depend on the credentials of the user.
+type MaintenanceConfig struct {
+	// ServiceAccount is the email of the GCP service account the kfctl servers run as. Scheduling
+	// maintenance allows it to generate tokens for the deployer of the deployment.
+	ServiceAccount string `json:"serviceAccount"`
+}
+
+// validate returns an error if the config isn't valid.
+func (c *MaintenanceConfig) validate() error {
+	if !strings.HasSuffix(c.ServiceAccount, ".iam.gserviceaccount.com") {
+		return fmt.Errorf("maintenance serviceAccount %q must be the email of a GCP service account", c.ServiceAccount)
+	}
+	return nil
+}
+
+// MaintenanceTask configures a recurring task.
+type MaintenanceTask struct {
+	Type     MaintenanceTaskType `json:"type"`
+	Interval metav1.Duration     `json:"interval"`
+}
+
+// ScheduledTask is a task and when it runs.
+type ScheduledTask struct {
+	MaintenanceTask `json:",inline"`
+	LastRun         *time.Time `json:"lastRun,omitempty"`
+	NextRun         time.Time  `json:"nextRun"`
+}
+
+// MaintenanceEvent records a single execution of a task.
+type MaintenanceEvent struct {
+	Type      MaintenanceTaskType `json:"type"`
+	Time      time.Time           `json:"time"`
+	Succeeded bool                `json:"succeeded"`
+	Message   string              `json:"message,omitempty"`
+}
+
+// MaintenanceRequest configures the maintenance tasks of a deployment.
+type MaintenanceRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// Tasks replace the scheduled tasks. If nil the schedule is returned unchanged;
+	// an empty list removes all tasks.
+	Tasks []MaintenanceTask `json:"tasks"`
+}
+
+// MaintenanceRunRequest requests running a maintenance task of a deployment now.
+type MaintenanceRunRequest struct {
+	// KfDef identifies the deployment; for TaskApplyDeferredUpdate it is the update. The task runs
+	// as the deployer of the deployment rather than with the credentials of the request.
+	KfDef kfdefs.KfDef        `json:"kfDef"`
+	Type  MaintenanceTaskType `json:"type"`
+}
+
+// MaintenanceSchedule is the scheduled tasks of a deployment and the most recent executions; oldest first.
+type MaintenanceSchedule struct {
+	Name   string             `json:"name"`
+	Tasks  []ScheduledTask    `json:"tasks"`
+	Events []MaintenanceEvent `json:"events"`
+}
+
+// maintenanceState is the schedule of a deployment persisted by the router.
+type maintenanceState struct {
+	Name    string             `json:"name"`
+	Project string             `json:"project"`
+	Tasks   []*ScheduledTask   `json:"tasks"`
+	Events  []MaintenanceEvent `json:"events"`
+	// Deferred is the update held until a maintenance window of the deployment opens; see
+	// holdDeferredUpdate.
+	Deferred *kfdefs.KfDef `json:"deferred,omitempty"`
+}
+
+// maintenanceConfigMapName returns the name of the ConfigMap holding the schedule of the
+// deployment handled by the kfctl server name.
+func maintenanceConfigMapName(name string) string {
+	return name + "-maintenance"
+}
+
+// validateMaintenanceTasks checks the task types are known, intervals aren't too short and each type appears once.
+func validateMaintenanceTasks(tasks []MaintenanceTask) error {
+	seen := map[MaintenanceTaskType]bool{}
+	for _, t := range tasks {
+		if err := validateMaintenanceTaskType(t.Type); err != nil {
+			return err
+		}
+
+		if seen[t.Type] {
+			return &httpError{
+				Message: fmt.Sprintf("Maintenance task %v is scheduled more than once", t.Type),
+				Code:    http.StatusBadRequest,
+			}
+		}
+		seen[t.Type] = true
+
+		if t.Interval.Duration < minMaintenanceInterval {
+			return &httpError{
+				Message: fmt.Sprintf("Maintenance task %v interval %v is less than the minimum %v", t.Type, t.Interval.Duration, minMaintenanceInterval),
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+	return nil
+}
+
+// validateMaintenanceTaskType returns an error if t isn't a known task.
+func validateMaintenanceTaskType(t MaintenanceTaskType) error {
+	switch t {
+	case TaskRotateIAPSecret, TaskRenewCertificate, TaskRefreshServiceAccountKeys:
+		return nil
+	default:
+		return &httpError{
+			Message: fmt.Sprintf("Maintenance task %v isn't supported; must be one of %v, %v, %v",
+				t, TaskRotateIAPSecret, TaskRenewCertificate, TaskRefreshServiceAccountKeys),
+			Code: http.StatusBadRequest,
+		}
+	}
+}
+
+// configure replaces the scheduled tasks; tasks must be valid.
+// Tasks whose interval is unchanged keep their next run; other tasks are next run one interval from now.
+func (st *maintenanceState) configure(tasks []MaintenanceTask, now time.Time) {
+	existing := map[MaintenanceTaskType]*ScheduledTask{}
+	for _, t := range st.Tasks {
+		existing[t.Type] = t
+	}
+
+	scheduled := []*ScheduledTask{}
+	for _, t := range tasks {
+		if e, ok := existing[t.Type]; ok && e.Interval.Duration == t.Interval.Duration {
+			scheduled = append(scheduled, e)
+			continue
+		}
+		scheduled = append(scheduled, &ScheduledTask{
+			MaintenanceTask: t,
+			NextRun:         now.Add(t.Interval.Duration),
+		})
+	}
+	st.Tasks = scheduled
+}
+
+// due returns the tasks whose next run has passed.
+func (st *maintenanceState) due(now time.Time) []*ScheduledTask {
+	due := []*ScheduledTask{}
+	for _, t := range st.Tasks {
+		if !now.Before(t.NextRun) {
+			due = append(due, t)
+		}
+	}
+	return due
+}
+
+// record adds the execution of t to the history keeping at most maxEvents and schedules its next run.
+func (st *maintenanceState) record(t *ScheduledTask, e MaintenanceEvent, maxEvents int) {
+	lastRun := e.Time
+	t.LastRun = &lastRun
+	t.NextRun = e.Time.Add(t.Interval.Duration)
+	st.addEvent(e, maxEvents)
+}
+
+// addEvent adds e to the history keeping at most maxEvents.
+func (st *maintenanceState) addEvent(e MaintenanceEvent, maxEvents int) {
+	st.Events = append(st.Events, e)
+	if len(st.Events) > maxEvents {
+		st.Events = st.Events[len(st.Events)-maxEvents:]
+	}
+}
+
+// schedule returns a copy of the schedule.
+func (st *maintenanceState) schedule() *MaintenanceSchedule {
+	s := &MaintenanceSchedule{
+		Name:   st.Name,
+		Tasks:  make([]ScheduledTask, 0, len(st.Tasks)),
+		Events: make([]MaintenanceEvent, len(st.Events)),
+	}
+	for _, t := range st.Tasks {
+		s.Tasks = append(s.Tasks, *t)
+	}
+	copy(s.Events, st.Events)
+	return s
+}
+
+// isMaintenanceNotReady returns true if the kfctl server reported the task couldn't run yet e.g.
+// because it is starting, a deployment is in progress or the maintenance windows are closed; the task
+// is retried on the next tick without recording an event. Other errors, including transport errors,
+// are recorded as failed executions so a task which keeps failing shows up in the history.
+func isMaintenanceNotReady(err error) bool {
+	if e, ok := err.(*RetryBudgetExhaustedError); ok {
+		err = e.Err
+	}
+	if IsOverloaded(err) {
+		return true
+	}
+	hErr, ok := err.(*httpError)
+	return ok && (hErr.Code == http.StatusConflict || hErr.Code == http.StatusServiceUnavailable)
+}
+
+// maintenanceNotReadyError is returned by a kfctl server which can't run a task yet.
+func maintenanceNotReadyError(reason string) error {
+	return &httpError{
+		Message: "The deployment isn't ready for maintenance; " + reason,
+		Code:    http.StatusConflict,
+	}
+}
+
+// runMaintenanceTasks runs the due tasks of st with c and records their executions in st.
+// It returns the events recorded.
+func runMaintenanceTasks(ctx context.Context, st *maintenanceState, c KfctlService, now time.Time, maxEvents int) []MaintenanceEvent {
+	d := kfdefs.KfDef{}
+	d.Name = st.Name
+	d.Spec.Project = st.Project
+
+	events := []MaintenanceEvent{}
+	for _, t := range st.due(now) {
+		log.Infof("Running maintenance task %v of %v", t.Type, st.Name)
+		e, err := c.RunMaintenance(ctx, MaintenanceRunRequest{KfDef: d, Type: t.Type})
+		if err != nil {
+			if isMaintenanceNotReady(err) {
+				log.Infof("Postponing maintenance task %v of %v; %v", t.Type, st.Name, err)
+				continue
+			}
+			e = &MaintenanceEvent{
+				Type:    t.Type,
+				Time:    now,
+				Message: err.Error(),
+			}
+		}
+		if !e.Succeeded {
+			log.Errorf("Maintenance task %v of %v failed; %v", t.Type, st.Name, e.Message)
+		}
+		st.record(t, *e, maxEvents)
+		events = append(events, *e)
+	}
+	return events
+}
+
+// sendDeferredUpdate sends the update held in st to c if a maintenance window of the update is open
+// at now. It returns the event recorded in st or nil if the update is still held.
+func sendDeferredUpdate(ctx context.Context, st *maintenanceState, c KfctlService, now time.Time, maxEvents int) *MaintenanceEvent {
+	if st.Deferred == nil || !st.Deferred.InMaintenanceWindow(now) {
+		return nil
+	}
+	log.Infof("Maintenance window of %v opened; applying the deferred update", st.Name)
+	e, err := c.RunMaintenance(ctx, MaintenanceRunRequest{KfDef: *st.Deferred, Type: TaskApplyDeferredUpdate})
+	if err != nil {
+		if isMaintenanceNotReady(err) {
+			log.Infof("Postponing the deferred update of %v; %v", st.Name, err)
+			return nil
+		}
+		e = &MaintenanceEvent{
+			Type:    TaskApplyDeferredUpdate,
+			Time:    now,
+			Message: err.Error(),
+		}
+	}
+	if !e.Succeeded {
+		log.Errorf("Could not apply the deferred update of %v; %v", st.Name, e.Message)
+	}
+	st.Deferred = nil
+	st.addEvent(*e, maxEvents)
+	return e
+}
+
+// decodeMaintenanceState returns the schedule stored in cm.
+func decodeMaintenanceState(cm *corev1.ConfigMap) (*maintenanceState, error) {
+	st := &maintenanceState{}
+	if err := json.Unmarshal([]byte(cm.Data[maintenanceStateKey]), st); err != nil {
+		return nil, errors.Wrapf(err, "could not parse the maintenance schedule in ConfigMap %v", cm.Name)
+	}
+	return st, nil
+}
+
+// loadMaintenance returns the schedule of the deployment handled by the kfctl server name and the
+// ConfigMap holding it; the ConfigMap is nil if nothing was scheduled yet.
+func (r *kfctlRouter) loadMaintenance(name string) (*maintenanceState, *corev1.ConfigMap, error) {
+	cm, err := r.k8sclient.CoreV1().ConfigMaps(r.namespace).Get(maintenanceConfigMapName(name), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return &maintenanceState{}, nil, nil
+		}
+		return nil, nil, errors.WithStack(err)
+	}
+	st, err := decodeMaintenanceState(cm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, cm, nil
+}
+
+// saveMaintenance writes st to the ConfigMap of the kfctl server name. cm is the ConfigMap st was
+// loaded from or nil to create it; the update fails with a conflict if it changed since.
+func (r *kfctlRouter) saveMaintenance(name string, st *maintenanceState, cm *corev1.ConfigMap) error {
+	buf, err := json.Marshal(st)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if cm == nil {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      maintenanceConfigMapName(name),
+				Namespace: r.namespace,
+				Labels: map[string]string{
+					MaintenanceLabel: "true",
+					AppNameKey:       st.Name,
+					ProjectKey:       projectLabelValue(st.Project),
+				},
+			},
+			Data: map[string]string{maintenanceStateKey: string(buf)},
+		}
+		_, err = r.k8sclient.CoreV1().ConfigMaps(r.namespace).Create(cm)
+		return errors.WithStack(err)
+	}
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[maintenanceStateKey] = string(buf)
+	_, err = r.k8sclient.CoreV1().ConfigMaps(r.namespace).Update(cm)
+	return errors.WithStack(err)
+}
+
+// maintenanceDisabledError is returned for maintenance requests if the router doesn't enable maintenance.
+func maintenanceDisabledError() error {
+	return &httpError{
+		Message: "Maintenance isn't enabled on this server",
+		Code:    http.StatusNotFound,
+	}
+}
+
+// allowMaintenance allows the service account of the kfctl servers to act as the deployer of
+// deployment d using the credentials of d. refreshKeys also allows the deployer to replace the keys
+// of the service accounts of the deployment.
+func (r *kfctlRouter) allowMaintenance(ctx context.Context, d kfdefs.KfDef, refreshKeys bool, c *MaintenanceConfig) error {
+	backend, err := r.backendClient(d)
+	if err != nil {
+		return err
+	}
+	latest, err := backend.GetLatestKfdef(d)
+	if err != nil {
+		return err
+	}
+	if gcp.DeployerServiceAccount(latest) == "" {
+		return &httpError{
+			Message: fmt.Sprintf("Deployment %v runs with the credentials of its users; maintenance needs a deployer service account to run without them. Create the deployment with spec.email set.", d.Name),
+			Code:    http.StatusPreconditionFailed,
+		}
+	}
+	token, err := d.GetSecret(gcp.GcpAccessTokenName)
+	if err != nil {
+		return &httpError{
+			Message: fmt.Sprintf("Could not obtain an access token from secret %v", gcp.GcpAccessTokenName),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	client := gcp.NewClient(ctx, NewStaticTokenSource(token))
+	if err := gcp.AllowMaintenance(ctx, client, latest, "serviceAccount:"+c.ServiceAccount, refreshKeys); err != nil {
+		log.Errorf("Could not allow the maintenance of %v; error %v", d.Name, err)
+		return &httpError{
+			Message: "Could not allow maintenance to run as the deployer of the deployment; check you can set the IAM policy of its service accounts",
+			Code:    http.StatusForbidden,
+			cause:   err,
+		}
+	}
+	return nil
+}
+
+// ScheduleMaintenance configures the maintenance tasks of the deployment. The schedule is kept by
+// the router in a ConfigMap so it outlives the kfctl server, which is removed while idle.
+func (r *kfctlRouter) ScheduleMaintenance(ctx context.Context, req MaintenanceRequest) (*MaintenanceSchedule, error) {
+	c := r.config.get().Maintenance
+	if c == nil {
+		return nil, maintenanceDisabledError()
+	}
+	name, err := r.authCheckAndExtractService(req.KfDef, RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	st, cm, err := r.loadMaintenance(name)
+	if err != nil {
+		log.Errorf("Could not load the maintenance schedule of %v; error %v", req.KfDef.Name, err)
+		return nil, &httpError{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Unable to process your Kubeflow request; please try again later",
+			cause:   err,
+		}
+	}
+	st.Name = req.KfDef.Name
+	st.Project = req.KfDef.Spec.Project
+
+	if req.Tasks != nil {
+		if err := validateMaintenanceTasks(req.Tasks); err != nil {
+			return nil, err
+		}
+		if len(req.Tasks) > 0 {
+			refreshKeys := false
+			for _, t := range req.Tasks {
+				refreshKeys = refreshKeys || t.Type == TaskRefreshServiceAccountKeys
+			}
+			if err := r.allowMaintenance(ctx, req.KfDef, refreshKeys, c); err != nil {
+				return nil, err
+			}
+		}
+		st.configure(req.Tasks, time.Now())
+		if err := r.saveMaintenance(name, st, cm); err != nil {
+			log.Errorf("Could not save the maintenance schedule of %v; error %v", req.KfDef.Name, err)
+			code := http.StatusServiceUnavailable
+			if k8serrors.IsConflict(errors.Cause(err)) {
+				code = http.StatusConflict
+			}
+			return nil, &httpError{
+				Code:    code,
+				Message: "The maintenance schedule couldn't be saved; please try again",
+				cause:   err,
+			}
+		}
+	}
+	return st.schedule(), nil
+}
+
+// RunMaintenance forwards the request to the backend handling the deployment. The schedule isn't changed.
+// Deferred updates are only sent by the router.
+func (r *kfctlRouter) RunMaintenance(ctx context.Context, req MaintenanceRunRequest) (*MaintenanceEvent, error) {
+	if err := validateMaintenanceTaskType(req.Type); err != nil {
+		return nil, err
+	}
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleEditor); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.RunMaintenance(ctx, req)
+}
+
+// StartMaintenance runs the due maintenance tasks of the deployments every period until stop is closed.
+func (r *kfctlRouter) StartMaintenance(period time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.config.get().Maintenance != nil {
+				r.runDueMaintenance(time.Now())
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runDueMaintenance runs the tasks which are due in the schedules of all the deployments and sends
+// the deferred updates whose maintenance window opened. Each execution is recorded in the schedule
+// and sent to the webhook sinks as a DeploymentEvent.
+func (r *kfctlRouter) runDueMaintenance(now time.Time) {
+	list, err := r.k8sclient.CoreV1().ConfigMaps(r.namespace).List(metav1.ListOptions{
+		LabelSelector: MaintenanceLabel + "=true",
+	})
+	if err != nil {
+		log.Errorf("Could not list the maintenance schedules in %v; error %v", r.namespace, err)
+		return
+	}
+	for i := range list.Items {
+		cm := &list.Items[i]
+		st, err := decodeMaintenanceState(cm)
+		if err != nil {
+			log.Errorf("%v", err)
+			continue
+		}
+		if len(st.due(now)) == 0 && (st.Deferred == nil || !st.Deferred.InMaintenanceWindow(now)) {
+			continue
+		}
+
+		name, err := k8sName(st.Name, st.Project)
+		if err != nil {
+			log.Errorf("Could not generate the name of the kfctl server of %v; error %v", st.Name, err)
+			continue
+		}
+		// The kfctl server may have been removed while idle; it picks up the deployment from its volume.
+		if err := r.ensureKfctlServer(name, st.Project); err != nil {
+			log.Errorf("Could not start the kfctl server of %v for maintenance; error %v", st.Name, err)
+			continue
+		}
+		c, err := r.serviceClient(name)
+		if err != nil {
+			log.Errorf("Could not create a client for the kfctl server of %v for maintenance; error %v", st.Name, err)
+			continue
+		}
+
+		events := runMaintenanceTasks(context.Background(), st, c, now, defaultMaxMaintenanceEvents)
+		if e := sendDeferredUpdate(context.Background(), st, c, now, defaultMaxMaintenanceEvents); e != nil {
+			events = append(events, *e)
+		}
+		if len(events) == 0 {
+			continue
+		}
+		if err := r.saveMaintenance(name, st, cm); err != nil {
+			log.Errorf("Could not save the maintenance schedule of %v; error %v", st.Name, err)
+		}
+		for _, e := range events {
+			event := DeploymentEvent{
+				Name:    st.Name,
+				Project: st.Project,
+				Task:    e.Type,
+				Time:    e.Time,
+			}
+			if !e.Succeeded {
+				event.Error = e.Message
+			}
+			r.config.notify(event)
+		}
+	}
+}
+
+// makeMaintenanceEndpoint creates an endpoint to handle maintenance schedule requests.
+func makeMaintenanceEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(MaintenanceRequest)
+		return svc.ScheduleMaintenance(ctx, req)
+	}
+}
+
+// decodeHTTPMaintenanceRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded MaintenanceRequest from the HTTP request body.
+func decodeHTTPMaintenanceRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request MaintenanceRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding maintenance request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
+
+// makeMaintenanceRunEndpoint creates an endpoint to handle requests to run a maintenance task.
+func makeMaintenanceRunEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(MaintenanceRunRequest)
+		return svc.RunMaintenance(ctx, req)
+	}
+}
+
+// decodeHTTPMaintenanceRunRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded MaintenanceRunRequest from the HTTP request body.
+func decodeHTTPMaintenanceRunRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request MaintenanceRunRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding maintenance run request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"time"
+)
+
+// IgnoreMaintenanceWindowAnnotation if set to true on a request applies it immediately even if
+// the maintenance windows of the deployment are closed.
+const IgnoreMaintenanceWindowAnnotation = "kfctl.kubeflow.org/ignore-maintenance-window"
+
+// DeploymentDeferredReason indicates a request was deferred to the next maintenance window.
+const DeploymentDeferredReason = "DeferredToMaintenanceWindow"
+
+// deferredApplyAnnotation marks a deferred update sent by the router once the maintenance window opened.
+const deferredApplyAnnotation = "kfctl.kubeflow.org/deferred-apply"
+
+// deferToMaintenanceWindow returns the status of the deployment if req updates a deployment
+// which was already applied while the maintenance windows of req are closed. The server doesn't
+// hold req since it is removed while idle; the router holds it and sends it back once a window
+// opens, see holdDeferredUpdate. Otherwise it returns nil and req should be applied now.
+func (s *kfctlServer) deferToMaintenanceWindow(req kfdefsv3.KfDef, now time.Time) *kfdefsv3.KfDef {
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+
+	// Creating the deployment isn't disruptive.
+	if req.Annotations[IgnoreMaintenanceWindowAnnotation] == "true" || s.appliedHash == "" || req.InMaintenanceWindow(now) {
+		s.setDeferredCondition("")
+		return nil
+	}
+
+	next := req.NextMaintenanceWindow(now)
+	log.Infof("Deferring the update of deployment %v to the maintenance window opening at %v", req.Name, next)
+	s.setDeferredCondition(fmt.Sprintf("The update was deferred to the maintenance window opening at %v; set the annotation %v to true to apply it now.",
+		next.Format(time.RFC3339), IgnoreMaintenanceWindowAnnotation))
+	s.publishStatus()
+	return s.latestKfDef.DeepCopy()
+}
+
+// isDeferred returns true if d reports its last update was deferred to a maintenance window.
+func isDeferred(d *kfdefsv3.KfDef) bool {
+	if d == nil {
+		return false
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Reason == DeploymentDeferredReason {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDeferredUpdate enqueues req, an update the router held until a maintenance window of the
+// deployment opened at now. The update is applied as the deployer of the deployment since the
+// token of the user who sent it has expired; see takeDeferredApply.
+func (s *kfctlServer) applyDeferredUpdate(req kfdefsv3.KfDef, now time.Time) (*MaintenanceEvent, error) {
+	if s.isDraining() {
+		return nil, maintenanceNotReadyError("the server is draining")
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	if s.latestKfDef.Name == "" || s.latestKfDef.Name != req.Name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	if s.busy {
+		return nil, maintenanceNotReadyError("a deployment is in progress")
+	}
+	if !req.InMaintenanceWindow(now) {
+		return nil, maintenanceNotReadyError("its maintenance windows are closed")
+	}
+
+	update := req.DeepCopy()
+	update.CreationTimestamp = s.latestKfDef.CreationTimestamp
+	prepareSecrets(update)
+	if update.Annotations == nil {
+		update.Annotations = map[string]string{}
+	}
+	update.Annotations[deferredApplyAnnotation] = "true"
+	select {
+	case s.c <- *update:
+	default:
+		return nil, maintenanceNotReadyError("its queue is full")
+	}
+	log.Infof("Maintenance window of deployment %v opened; applying the deferred update", req.Name)
+	s.setDeferredCondition("")
+	s.publishStatus()
+	return &MaintenanceEvent{
+		Type:      TaskApplyDeferredUpdate,
+		Time:      now,
+		Succeeded: true,
+		Message:   "The deferred update was queued",
+	}, nil
+}
+
+// takeDeferredApply returns true if r is a deferred update sent once the maintenance window opened
+// and removes the annotation.
+func takeDeferredApply(r *kfdefsv3.KfDef) bool {
+	if r.Annotations[deferredApplyAnnotation] != "true" {
+		return false
+	}
+	annotations := map[string]string{}
+	for k, v := range r.Annotations {
+		if k != deferredApplyAnnotation {
+			annotations[k] = v
+		}
+	}
+	r.Annotations = annotations
+	return true
+}
+
+// holdDeferredUpdate records in the maintenance schedule of the kfctl server name whether req was
+// deferred to the next maintenance window of the deployment. A deferred update replaces the one
+// held; an update applied now drops it. The router sends the held update once a window opens, see
+// runDueMaintenance, as the deployer of the deployment so req must allow maintenance.
+func (r *kfctlRouter) holdDeferredUpdate(ctx context.Context, name string, req kfdefsv3.KfDef, deferred bool) error {
+	c := r.config.get().Maintenance
+	if c == nil {
+		if deferred {
+			log.Warnf("Maintenance isn't enabled so the update of %v deferred to its maintenance window isn't held; send it again once the window is open", req.Name)
+		}
+		return nil
+	}
+	st, cm, err := r.loadMaintenance(name)
+	if err != nil {
+		return err
+	}
+	if !deferred {
+		if st.Deferred == nil {
+			return nil
+		}
+		log.Infof("Dropping the deferred update of %v replaced by a later update", req.Name)
+		st.Deferred = nil
+		return r.saveMaintenance(name, st, cm)
+	}
+
+	if err := r.allowMaintenance(ctx, req, false, c); err != nil {
+		return err
+	}
+	// The ConfigMap must not hold credentials; the secrets written by earlier runs are reused.
+	update := req.DeepCopy()
+	secrets := []kfdefsv3.Secret{}
+	for _, s := range update.Spec.Secrets {
+		if s.Name != gcp.GcpAccessTokenName && s.SecretSource.LiteralSource == nil {
+			secrets = append(secrets, s)
+		}
+	}
+	update.Spec.Secrets = secrets
+	st.Name = req.Name
+	st.Project = req.Spec.Project
+	st.Deferred = update
+	return r.saveMaintenance(name, st, cm)
+}
+
+// forwardDeployment sends req to the kfctl server name and holds the update if the server deferred
+// it to the next maintenance window of the deployment.
+func (r *kfctlRouter) forwardDeployment(ctx context.Context, c KfctlService, name string, req kfdefsv3.KfDef) {
+	res, err := c.CreateDeployment(ctx, req)
+	if err != nil {
+		return
+	}
+	if err := r.holdDeferredUpdate(ctx, name, req, isDeferred(res)); err != nil {
+		log.Errorf("Could not hold the deferred update of %v; error %v", req.Name, err)
+	}
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// newWindowTestKfDef returns a deployment maintained every day from 02:00 to 04:00 UTC.
+func newWindowTestKfDef() kfdefsv3.KfDef {
+	d := newPlanTestKfDef()
+	d.Spec.MaintenanceWindows = []kfdefsv3.MaintenanceWindow{{
+		Start:    "02:00",
+		Duration: metav1.Duration{Duration: 2 * time.Hour},
+	}}
+	return d
+}
+
+func TestKfctlServer_DeferToMaintenanceWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "window")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The windows of the request apply, not those of the deployment being updated.
+	s := newQueueTestServer(dir)
+	noon := time.Date(2019, time.October, 14, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2019, time.October, 15, 3, 0, 0, 0, time.UTC)
+	req := newWindowTestKfDef()
+
+	if d := s.deferToMaintenanceWindow(req, noon); d != nil {
+		t.Errorf("Creating the deployment was deferred")
+	}
+
+	s.appliedHash = "applied"
+	d := s.deferToMaintenanceWindow(req, noon)
+	if d == nil {
+		t.Fatalf("The update outside the maintenance window wasn't deferred")
+	}
+	if !isDeferred(d) {
+		t.Errorf("Status doesn't report the update was deferred; %v", PrettyPrint(d.Status))
+	}
+
+	if d := s.deferToMaintenanceWindow(req, night); d != nil {
+		t.Errorf("The update in the maintenance window was deferred")
+	}
+	if isDeferred(&s.latestKfDef) {
+		t.Errorf("The deferred condition wasn't removed once an update was applied")
+	}
+
+	forced := *req.DeepCopy()
+	forced.Annotations = map[string]string{IgnoreMaintenanceWindowAnnotation: "true"}
+	if d := s.deferToMaintenanceWindow(forced, noon); d != nil {
+		t.Errorf("The forced update was deferred")
+	}
+}
+
+func TestKfctlServer_ApplyDeferredUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "window")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newQueueTestServer(dir)
+	s.appliedHash = "applied"
+	noon := time.Date(2019, time.October, 14, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2019, time.October, 15, 3, 0, 0, 0, time.UTC)
+	req := newWindowTestKfDef()
+	s.deferToMaintenanceWindow(req, noon)
+
+	if _, err := s.applyDeferredUpdate(req, noon); !isMaintenanceNotReady(err) {
+		t.Errorf("Applying outside the maintenance window: got %v; want not ready", err)
+	}
+	other := *req.DeepCopy()
+	other.Name = "other"
+	if _, err := s.applyDeferredUpdate(other, night); err == nil || err.(*httpError).Code != http.StatusNotFound {
+		t.Errorf("Applying the update of another deployment: got %v; want not found", err)
+	}
+
+	e, err := s.applyDeferredUpdate(req, night)
+	if err != nil || !e.Succeeded {
+		t.Fatalf("The deferred update wasn't applied in the maintenance window; %v %v", PrettyPrint(e), err)
+	}
+	queued := <-s.c
+	if queued.Name != req.Name || !takeDeferredApply(&queued) {
+		t.Errorf("Queued %v; want the deferred update of %v", PrettyPrint(queued.ObjectMeta), req.Name)
+	}
+	if takeDeferredApply(&queued) {
+		t.Errorf("takeDeferredApply didn't remove the annotation")
+	}
+	if isDeferred(&s.latestKfDef) {
+		t.Errorf("The deferred condition wasn't removed once the update was applied")
+	}
+}
+
+func TestSendDeferredUpdate(t *testing.T) {
+	noon := time.Date(2019, time.October, 14, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2019, time.October, 15, 3, 0, 0, 0, time.UTC)
+	update := newWindowTestKfDef()
+	st := &maintenanceState{Name: "kf-app", Project: "acme", Deferred: &update}
+	svc := &maintenanceKfctlService{now: night}
+
+	if e := sendDeferredUpdate(context.Background(), st, svc, noon, 3); e != nil || len(svc.ran) != 0 {
+		t.Errorf("The update was sent outside the maintenance window")
+	}
+	if e := sendDeferredUpdate(context.Background(), st, svc, night, 3); e != nil || st.Deferred == nil {
+		t.Errorf("The update was dropped while the deployment wasn't ready")
+	}
+
+	svc.ready = true
+	e := sendDeferredUpdate(context.Background(), st, svc, night, 3)
+	if e == nil || !e.Succeeded || len(svc.ran) != 1 || svc.ran[0] != TaskApplyDeferredUpdate {
+		t.Fatalf("Ran %v; want the deferred update", svc.ran)
+	}
+	if st.Deferred != nil || len(st.Events) != 1 {
+		t.Errorf("The applied update is still held; events %v", PrettyPrint(st.Events))
+	}
+}
+
+func TestKfctlRouter_RunMaintenanceRejectsDeferredUpdates(t *testing.T) {
+	r := newRbacTestRouter(t, map[string]Role{"acme": RoleEditor}, "")
+	_, err := r.RunMaintenance(context.Background(), MaintenanceRunRequest{KfDef: newPlanTestKfDef(), Type: TaskApplyDeferredUpdate})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("RunMaintenance of a deferred update: want 400; got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateMaintenanceTasks(t *testing.T) {
+	type testCase struct {
+		name      string
+		tasks     []MaintenanceTask
+		expectErr bool
+	}
+
+	day := metav1.Duration{Duration: 24 * time.Hour}
+	cases := []testCase{
+		{
+			name:  "empty",
+			tasks: []MaintenanceTask{},
+		},
+		{
+			name: "valid",
+			tasks: []MaintenanceTask{
+				{Type: TaskRotateIAPSecret, Interval: day},
+				{Type: TaskRefreshServiceAccountKeys, Interval: day},
+			},
+		},
+		{
+			name: "unknown",
+			tasks: []MaintenanceTask{
+				{Type: "RebootNodes", Interval: day},
+			},
+			expectErr: true,
+		},
+		{
+			name: "duplicate",
+			tasks: []MaintenanceTask{
+				{Type: TaskRenewCertificate, Interval: day},
+				{Type: TaskRenewCertificate, Interval: day},
+			},
+			expectErr: true,
+		},
+		{
+			name: "too-frequent",
+			tasks: []MaintenanceTask{
+				{Type: TaskRenewCertificate, Interval: metav1.Duration{Duration: time.Minute}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		err := validateMaintenanceTasks(c.tasks)
+		if !c.expectErr && err != nil {
+			t.Errorf("Case %v: unexpected error; %v", c.name, err)
+		}
+		if c.expectErr {
+			if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+				t.Errorf("Case %v: got error %v; want a bad request", c.name, err)
+			}
+		}
+	}
+}
+
+// maintenanceKfctlService runs maintenance tasks once ready; RefreshServiceAccountKeys fails.
+type maintenanceKfctlService struct {
+	fakeKfctlService
+	ready bool
+	now   time.Time
+	ran   []MaintenanceTaskType
+}
+
+func (f *maintenanceKfctlService) RunMaintenance(ctx context.Context, req MaintenanceRunRequest) (*MaintenanceEvent, error) {
+	if !f.ready {
+		return nil, maintenanceNotReadyError("a deployment is in progress")
+	}
+	f.ran = append(f.ran, req.Type)
+	e := &MaintenanceEvent{Type: req.Type, Time: f.now, Succeeded: true}
+	if req.Type == TaskRefreshServiceAccountKeys {
+		e.Succeeded = false
+		e.Message = "quota exceeded"
+	}
+	return e, nil
+}
+
+func TestRunMaintenanceTasks(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	svc := &maintenanceKfctlService{now: now}
+
+	day := metav1.Duration{Duration: 24 * time.Hour}
+	week := metav1.Duration{Duration: 7 * 24 * time.Hour}
+	st := &maintenanceState{Name: "kf-app", Project: "acme"}
+	st.configure([]MaintenanceTask{
+		{Type: TaskRotateIAPSecret, Interval: day},
+		{Type: TaskRefreshServiceAccountKeys, Interval: week},
+	}, now)
+
+	// Nothing is due yet.
+	if events := runMaintenanceTasks(context.Background(), st, svc, now, 3); len(events) != 0 || len(svc.ran) != 0 {
+		t.Errorf("Ran %v; want nothing", svc.ran)
+	}
+
+	// Tasks aren't recorded while the deployment isn't ready.
+	now = now.Add(8 * 24 * time.Hour)
+	svc.now = now
+	if events := runMaintenanceTasks(context.Background(), st, svc, now, 3); len(events) != 0 || len(st.Events) != 0 {
+		t.Errorf("Got events %v; want none", PrettyPrint(st.Events))
+	}
+
+	svc.ready = true
+	events := runMaintenanceTasks(context.Background(), st, svc, now, 3)
+	if len(svc.ran) != 2 || len(events) != 2 {
+		t.Fatalf("Ran %v; want both tasks", svc.ran)
+	}
+	if !st.Events[0].Succeeded || st.Events[1].Succeeded || st.Events[1].Message != "quota exceeded" {
+		t.Errorf("Got events %v", PrettyPrint(st.Events))
+	}
+	for _, task := range st.Tasks {
+		if task.LastRun == nil || !task.LastRun.Equal(now) || !task.NextRun.Equal(now.Add(task.Interval.Duration)) {
+			t.Errorf("Task %v: got last run %v next run %v", task.Type, task.LastRun, task.NextRun)
+		}
+	}
+
+	// Only the daily task is due after another day and the history is bounded.
+	for i := 0; i < 2; i++ {
+		now = now.Add(24 * time.Hour)
+		svc.now = now
+		runMaintenanceTasks(context.Background(), st, svc, now, 3)
+	}
+	if len(st.Events) != 3 {
+		t.Fatalf("Got %v events; want 3", len(st.Events))
+	}
+	for _, e := range st.Events[1:] {
+		if e.Type != TaskRotateIAPSecret {
+			t.Errorf("Got event for %v; want %v", e.Type, TaskRotateIAPSecret)
+		}
+	}
+
+	// Reconfiguring with the same interval keeps the next run; a new interval reschedules it.
+	next := st.Tasks[0].NextRun
+	st.configure([]MaintenanceTask{
+		{Type: TaskRotateIAPSecret, Interval: day},
+		{Type: TaskRenewCertificate, Interval: week},
+	}, now)
+
+	// The schedule survives being stored in a ConfigMap.
+	buf, err := json.Marshal(st)
+	if err != nil {
+		t.Fatalf("Marshal error; %v", err)
+	}
+	reloaded, err := decodeMaintenanceState(&corev1.ConfigMap{Data: map[string]string{maintenanceStateKey: string(buf)}})
+	if err != nil {
+		t.Fatalf("decodeMaintenanceState error; %v", err)
+	}
+	for _, s := range []*MaintenanceSchedule{st.schedule(), reloaded.schedule()} {
+		if s.Name != "kf-app" || len(s.Tasks) != 2 || s.Tasks[0].Type != TaskRotateIAPSecret || s.Tasks[1].Type != TaskRenewCertificate {
+			t.Fatalf("Got schedule %v", PrettyPrint(s))
+		}
+		if !s.Tasks[0].NextRun.Equal(next) {
+			t.Errorf("Got next run %v; want %v", s.Tasks[0].NextRun, next)
+		}
+		if !s.Tasks[1].NextRun.Equal(now.Add(week.Duration)) {
+			t.Errorf("Got next run %v; want %v", s.Tasks[1].NextRun, now.Add(week.Duration))
+		}
+		if len(s.Events) != 3 {
+			t.Errorf("Got %v events; want 3", len(s.Events))
+		}
+	}
+}
+
+// unreachableKfctlService fails every request as if the kfctl server couldn't be reached.
+type unreachableKfctlService struct {
+	fakeKfctlService
+}
+
+func (f *unreachableKfctlService) RunMaintenance(ctx context.Context, req MaintenanceRunRequest) (*MaintenanceEvent, error) {
+	return nil, fmt.Errorf("dial tcp: connection refused")
+}
+
+func TestRunMaintenanceTasks_TransportError(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	day := metav1.Duration{Duration: 24 * time.Hour}
+	st := &maintenanceState{Name: "kf-app", Project: "acme"}
+	st.configure([]MaintenanceTask{{Type: TaskRotateIAPSecret, Interval: day}}, now)
+
+	now = now.Add(day.Duration)
+	events := runMaintenanceTasks(context.Background(), st, &unreachableKfctlService{}, now, 3)
+	if len(events) != 1 || events[0].Succeeded || !strings.Contains(events[0].Message, "connection refused") {
+		t.Fatalf("Got events %v; want the failure recorded", PrettyPrint(events))
+	}
+	if !st.Tasks[0].NextRun.Equal(now.Add(day.Duration)) {
+		t.Errorf("Got next run %v; want %v", st.Tasks[0].NextRun, now.Add(day.Duration))
+	}
+}
+
+func TestIsMaintenanceNotReady(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{maintenanceNotReadyError("busy"), true},
+		{&httpError{Code: http.StatusServiceUnavailable}, true},
+		{&RetryBudgetExhaustedError{Method: "RunMaintenance", Err: maintenanceNotReadyError("busy")}, true},
+		{&OverloadedError{Reason: "memory"}, true},
+		{fmt.Errorf("connection refused"), false},
+		{&RetryBudgetExhaustedError{Method: "RunMaintenance", Err: fmt.Errorf("connection refused")}, false},
+		{&httpError{Code: http.StatusNotFound}, false},
+		{&httpError{Code: http.StatusBadRequest}, false},
+	}
+	for _, c := range cases {
+		if actual := isMaintenanceNotReady(c.err); actual != c.expected {
+			t.Errorf("isMaintenanceNotReady(%v): got %v; want %v", c.err, actual, c.expected)
+		}
+	}
+}
+
+func TestKfctlRouter_ScheduleMaintenanceDisabled(t *testing.T) {
+	r := newRbacTestRouter(t, map[string]Role{"acme": RoleEditor}, "")
+	_, err := r.ScheduleMaintenance(context.Background(), MaintenanceRequest{KfDef: newPlanTestKfDef()})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("ScheduleMaintenance without maintenance: want 404; got %v", err)
+	}
+}
+
+func TestMaintenanceConfig_validate(t *testing.T) {
+	if err := (&MaintenanceConfig{ServiceAccount: "kfctl@acme.iam.gserviceaccount.com"}).validate(); err != nil {
+		t.Errorf("validate: got %v; want nil", err)
+	}
+	if err := (&MaintenanceConfig{ServiceAccount: "someone@acme.com"}).validate(); err == nil {
+		t.Errorf("validate of a user account: got nil; want error")
+	}
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// KfctlMetadataPath is the path on which to serve requests to edit the metadata of the deployment
+const KfctlMetadataPath = "/kfctl/apps/v1alpha2/metadata"
+
+// DescriptionAnnotation is the annotation of the KfDef holding the description of the deployment.
+const DescriptionAnnotation = "kfctl.kubeflow.org/description"
+
+// OwnerContactAnnotation is the annotation of the KfDef holding who to contact about the deployment.
+const OwnerContactAnnotation = "kfctl.kubeflow.org/owner-contact"
+
+// DeletionProtectionAnnotation is set to true on the KfDef of a deployment which can't be deleted.
+const DeletionProtectionAnnotation = "kfctl.kubeflow.org/deletion-protection"
+
+// metadataFile is the name of the file in the apps directory storing the metadata of the deployment.
+const metadataFile = ".metadata.json"
+
+// maxMetadataLength bounds the length of the description and the owner contact.
+const maxMetadataLength = 1024
+
+// DeploymentMetadata is the metadata of a deployment which doesn't affect what is deployed.
+type DeploymentMetadata struct {
+	Description  string            `json:"description,omitempty"`
+	OwnerContact string            `json:"ownerContact,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	// DeletionProtection if true rejects requests to delete the deployment.
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+}
+
+// MetadataRequest edits the metadata of a deployment. Fields which aren't set are unchanged.
+// Editing the metadata doesn't apply the deployment again.
+type MetadataRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// Description if set replaces the description; empty removes it.
+	Description *string `json:"description,omitempty"`
+	// OwnerContact if set replaces the owner contact; empty removes it.
+	OwnerContact *string `json:"ownerContact,omitempty"`
+	// Labels are merged into the labels of the deployment; a label set to null is removed.
+	Labels map[string]*string `json:"labels,omitempty"`
+	// DeletionProtection if set enables or disables the deletion protection; it requires the
+	// admin role on the project.
+	DeletionProtection *bool `json:"deletionProtection,omitempty"`
+}
+
+// validate returns an error if the request would set invalid metadata.
+func (r *MetadataRequest) validate() error {
+	problems := []string{}
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{"description", r.Description}, {"ownerContact", r.OwnerContact}} {
+		if f.value != nil && len(*f.value) > maxMetadataLength {
+			problems = append(problems, fmt.Sprintf("%v is longer than %v characters", f.name, maxMetadataLength))
+		}
+	}
+	for k, v := range r.Labels {
+		for _, msg := range validation.IsQualifiedName(k) {
+			problems = append(problems, fmt.Sprintf("label %v: %v", k, msg))
+		}
+		if v == nil {
+			continue
+		}
+		for _, msg := range validation.IsValidLabelValue(*v) {
+			problems = append(problems, fmt.Sprintf("label %v value %v: %v", k, *v, msg))
+		}
+	}
+	if len(problems) > 0 {
+		return &httpError{
+			Message: "Invalid metadata: " + strings.Join(problems, "; "),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// patch applies the request to m.
+func (r *MetadataRequest) patch(m *DeploymentMetadata) {
+	if r.Description != nil {
+		m.Description = *r.Description
+	}
+	if r.OwnerContact != nil {
+		m.OwnerContact = *r.OwnerContact
+	}
+	for k, v := range r.Labels {
+		if v == nil {
+			delete(m.Labels, k)
+			continue
+		}
+		if m.Labels == nil {
+			m.Labels = map[string]string{}
+		}
+		m.Labels[k] = *v
+	}
+	if r.DeletionProtection != nil {
+		m.DeletionProtection = *r.DeletionProtection
+	}
+}
+
+// applyMetadata sets the metadata on the KfDef of the deployment.
+func applyMetadata(d *kfdefs.KfDef, m DeploymentMetadata) {
+	protection := ""
+	if m.DeletionProtection {
+		protection = "true"
+	}
+	for k, v := range map[string]string{
+		DescriptionAnnotation:        m.Description,
+		OwnerContactAnnotation:       m.OwnerContact,
+		DeletionProtectionAnnotation: protection,
+	} {
+		if v == "" {
+			delete(d.Annotations, k)
+			continue
+		}
+		if d.Annotations == nil {
+			d.Annotations = map[string]string{}
+		}
+		d.Annotations[k] = v
+	}
+	for k, v := range m.Labels {
+		if d.Labels == nil {
+			d.Labels = map[string]string{}
+		}
+		d.Labels[k] = v
+	}
+}
+
+// loadMetadata restores the metadata stored before the server restarted.
+func (s *kfctlServer) loadMetadata() {
+	buf, err := stateKeys.readFile(path.Join(s.appsDir, metadataFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read the metadata of the deployment; %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(buf, &s.metadata); err != nil {
+		log.Warnf("Could not parse the metadata of the deployment; %v", err)
+		return
+	}
+	applyMetadata(&s.latestKfDef, s.metadata)
+}
+
+// saveMetadata stores the metadata of the deployment so it survives restarts.
+// Must be called with kfDefMux held.
+func (s *kfctlServer) saveMetadata() error {
+	buf, err := json.Marshal(s.metadata)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return stateKeys.writeFile(path.Join(s.appsDir, metadataFile), buf)
+}
+
+// UpdateMetadata edits the description, owner contact, labels and deletion protection of the
+// deployment. The deployment isn't applied again and requests queued for it are unaffected.
+func (s *kfctlServer) UpdateMetadata(ctx context.Context, req MetadataRequest) (*kfdefs.KfDef, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkDeploymentRequest(req.KfDef); err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	m := s.metadata
+	m.Labels = map[string]string{}
+	for k, v := range s.metadata.Labels {
+		m.Labels[k] = v
+	}
+	req.patch(&m)
+
+	previous := s.metadata
+	s.metadata = m
+	if err := s.saveMetadata(); err != nil {
+		s.metadata = previous
+		log.Errorf("Could not save the metadata of the deployment; %v", err)
+		return nil, &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	for k, v := range req.Labels {
+		if v == nil {
+			delete(s.latestKfDef.Labels, k)
+		}
+	}
+	applyMetadata(&s.latestKfDef, s.metadata)
+	s.publishStatus()
+	log.Infof("Updated the metadata of deployment %v", req.KfDef.Name)
+	return s.latestKfDef.DeepCopy(), nil
+}
+
+// UpdateMetadata forwards the request to the backend handling the deployment. Changing the
+// deletion protection requires the admin role since it guards deleting the deployment.
+func (r *kfctlRouter) UpdateMetadata(ctx context.Context, req MetadataRequest) (*kfdefs.KfDef, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	role := RoleEditor
+	if req.DeletionProtection != nil {
+		role = RoleAdmin
+	}
+	if _, err := r.authCheckAndExtractService(req.KfDef, role); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.UpdateMetadata(ctx, req)
+}
+
+// UpdateMetadata edits the description, owner contact and labels of the deployment without
+// applying it again.
+func (c *KfctlClient) UpdateMetadata(ctx context.Context, req MetadataRequest) (*kfdefs.KfDef, error) {
+	return c.callKfDefEndpoint(ctx, "UpdateMetadata", c.metadataEndpoint, req)
+}
+
+// makeMetadataEndpoint creates an endpoint to handle requests to edit the metadata of the deployment.
+func makeMetadataEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(MetadataRequest)
+		return svc.UpdateMetadata(ctx, req)
+	}
+}
+
+// decodeHTTPMetadataRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded MetadataRequest from the HTTP request body.
+func decodeHTTPMetadataRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request MetadataRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding metadata request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestKfctlServer_UpdateMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := MetadataRequest{
+		KfDef:        newPlanTestKfDef(),
+		Description:  strPtr("Team A's training cluster"),
+		OwnerContact: strPtr("team-a@example.com"),
+		Labels: map[string]*string{
+			"team":        strPtr("a"),
+			"cost-center": strPtr("1234"),
+		},
+	}
+	d, err := s.UpdateMetadata(context.Background(), req)
+	if err != nil {
+		t.Fatalf("UpdateMetadata failed; %v", err)
+	}
+	if d.Annotations[DescriptionAnnotation] != "Team A's training cluster" || d.Annotations[OwnerContactAnnotation] != "team-a@example.com" {
+		t.Errorf("Annotations of the KfDef aren't the metadata; got %v", d.Annotations)
+	}
+	if d.Labels["team"] != "a" || d.Labels["cost-center"] != "1234" {
+		t.Errorf("Labels of the KfDef aren't the metadata; got %v", d.Labels)
+	}
+	if len(s.c) != 0 {
+		t.Errorf("Editing the metadata queued %v requests; want none", len(s.c))
+	}
+
+	// Unset fields are unchanged and labels set to null are removed.
+	d, err = s.UpdateMetadata(context.Background(), MetadataRequest{
+		KfDef:       newPlanTestKfDef(),
+		Description: strPtr(""),
+		Labels:      map[string]*string{"cost-center": nil},
+	})
+	if err != nil {
+		t.Fatalf("UpdateMetadata failed; %v", err)
+	}
+	if _, ok := d.Annotations[DescriptionAnnotation]; ok {
+		t.Errorf("Description wasn't removed; got %v", d.Annotations)
+	}
+	if d.Annotations[OwnerContactAnnotation] != "team-a@example.com" {
+		t.Errorf("Owner contact changed; got %v", d.Annotations)
+	}
+	if _, ok := d.Labels["cost-center"]; ok || d.Labels["team"] != "a" {
+		t.Errorf("Labels: got %v; want only team=a", d.Labels)
+	}
+
+	// The metadata survives restarts and is listed.
+	restarted := newPauseTestServer(t, dir)
+	restarted.loadMetadata()
+	list, err := restarted.ListDeployments(context.Background(), newPlanTestKfDef())
+	if err != nil {
+		t.Fatalf("ListDeployments failed; %v", err)
+	}
+	if len(list.Deployments) != 1 || list.Deployments[0].OwnerContact != "team-a@example.com" || list.Deployments[0].Labels["team"] != "a" {
+		t.Errorf("Listed deployments don't have the metadata; got %v", PrettyPrint(list))
+	}
+}
+
+func TestKfctlServer_UpdateMetadataInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	for _, labels := range []map[string]*string{
+		{"not a key": strPtr("a")},
+		{"team": strPtr("not a value")},
+	} {
+		_, err := s.UpdateMetadata(context.Background(), MetadataRequest{
+			KfDef:  newPlanTestKfDef(),
+			Labels: labels,
+		})
+		if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+			t.Errorf("UpdateMetadata with labels %v: want 400; got %v", labels, err)
+		}
+	}
+
+	other := newPlanTestKfDef()
+	other.Name = "other"
+	_, err = s.UpdateMetadata(context.Background(), MetadataRequest{KfDef: other})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("UpdateMetadata of another deployment: want 404; got %v", err)
+	}
+}
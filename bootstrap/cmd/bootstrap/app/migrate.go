@@ -0,0 +1,314 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// KfctlMigratePath is the path on which to serve requests to migrate the state stored for the deployment
+const KfctlMigratePath = "/kfctl/apps/v1alpha2/migrate"
+
+// schemaVersionFile is the name of the file in the apps directory recording the schema version of
+// the state stored by the server; state written before versioning has version 0.
+const schemaVersionFile = ".schema_version"
+
+// stateMigration upgrades the state stored in the apps directory to Version.
+type stateMigration struct {
+	// Version is the schema version of the state after the migration.
+	Version     int
+	Description string
+	// Migrate upgrades the state in dir and returns the changes it made; if dryRun it only
+	// returns the changes it would make. Every replica of a server migrates at startup so
+	// migrations must be idempotent.
+	Migrate func(dir string, dryRun bool) ([]string, error)
+}
+
+// stateMigrations upgrade the state stored by earlier versions of the server; ordered by Version.
+// Add a migration when changing the format of the files in the apps directory.
+var stateMigrations = []stateMigration{
+	{
+		Version:     1,
+		Description: "Record the schema version; state written before versioning needs no other changes",
+		Migrate: func(string, bool) ([]string, error) {
+			return nil, nil
+		},
+	},
+}
+
+// renamedPhases maps the phases of earlier versions of the pipeline to the phase a deployment
+// checkpointed before them resumes from. Add an entry when a phase is renamed or merged;
+// checkpoints of phases which no longer exist and aren't mapped restart from the first phase.
+var renamedPhases = map[DeploymentPhase]DeploymentPhase{}
+
+// schemaVersion returns the schema version of the state stored by this version of the server.
+func schemaVersion() int {
+	if len(stateMigrations) == 0 {
+		return 0
+	}
+	return stateMigrations[len(stateMigrations)-1].Version
+}
+
+// MigrationRequest migrates the state stored for a deployment to the schema of the server.
+type MigrationRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// DryRun reports the migrations which would run and the problems of the resumable state
+	// without changing anything.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// MigrationStep is a migration which ran or would run.
+type MigrationStep struct {
+	Version     int      `json:"version"`
+	Description string   `json:"description"`
+	Changes     []string `json:"changes,omitempty"`
+}
+
+// MigrationReport describes the migration of the state stored for a deployment.
+type MigrationReport struct {
+	Name   string `json:"name"`
+	DryRun bool   `json:"dryRun,omitempty"`
+	// FromVersion is the schema version of the stored state before the migration and ToVersion
+	// the schema version of the server.
+	FromVersion int             `json:"fromVersion"`
+	ToVersion   int             `json:"toVersion"`
+	Steps       []MigrationStep `json:"steps,omitempty"`
+	// ResumePhase is the phase the checkpointed deployment resumes from after the migration;
+	// empty if there is no valid checkpoint.
+	ResumePhase DeploymentPhase `json:"resumePhase,omitempty"`
+	// ResumableState lists the problems found in the checkpoint and how they were resolved.
+	ResumableState []string `json:"resumableState,omitempty"`
+}
+
+// readSchemaVersion returns the schema version of the state stored in dir.
+func readSchemaVersion(dir string) (int, error) {
+	buf, err := ioutil.ReadFile(path.Join(dir, schemaVersionFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.WithStack(err)
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid schema version in %v", schemaVersionFile)
+	}
+	return v, nil
+}
+
+// writeSchemaVersion records the schema version of the state stored in dir.
+func writeSchemaVersion(dir string, version int) error {
+	return writeFileAtomic(path.Join(dir, schemaVersionFile), []byte(strconv.Itoa(version)))
+}
+
+// migrateState runs the migrations of the state stored in dir which haven't run yet and then
+// revalidates the checkpoint of the interrupted deployment. The schema version is recorded after
+// each migration so a failed migration is retried from where it stopped.
+func migrateState(dir string, dryRun bool) (*MigrationReport, error) {
+	report := &MigrationReport{
+		DryRun:    dryRun,
+		ToVersion: schemaVersion(),
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		// Nothing was stored yet.
+		report.FromVersion = report.ToVersion
+		return report, nil
+	}
+
+	from, err := readSchemaVersion(dir)
+	if err != nil {
+		return report, err
+	}
+	report.FromVersion = from
+	if from > report.ToVersion {
+		return report, &httpError{
+			Message: fmt.Sprintf("The state was written by a newer kfctl server with schema version %v; this server only supports up to %v", from, report.ToVersion),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	for _, m := range stateMigrations {
+		if m.Version <= from {
+			continue
+		}
+		changes, err := m.Migrate(dir, dryRun)
+		report.Steps = append(report.Steps, MigrationStep{
+			Version:     m.Version,
+			Description: m.Description,
+			Changes:     changes,
+		})
+		if err != nil {
+			return report, errors.Wrapf(err, "migration to schema version %v failed", m.Version)
+		}
+		if dryRun {
+			continue
+		}
+		if err := writeSchemaVersion(dir, m.Version); err != nil {
+			return report, err
+		}
+		log.Infof("Migrated the state in %v to schema version %v; %v", dir, m.Version, m.Description)
+	}
+
+	report.ResumePhase, report.ResumableState, err = revalidateCheckpoint(dir, dryRun)
+	return report, err
+}
+
+// revalidateCheckpoint checks the checkpoint in dir can be resumed by this version of the pipeline.
+// Checkpoints of renamed phases are moved to the new phase; checkpoints which can't be resumed
+// are removed so the deployment restarts from the first phase when it is resubmitted.
+// It returns the phase the deployment resumes from and the problems found.
+func revalidateCheckpoint(dir string, dryRun bool) (DeploymentPhase, []string, error) {
+	file := path.Join(dir, checkpointFile)
+	// A checkpoint which can't be decrypted e.g. because the KMS key isn't reachable yet is kept.
+	buf, err := stateKeys.readFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, nil
+		}
+		return "", nil, errors.WithStack(err)
+	}
+
+	remove := func(problem string) (DeploymentPhase, []string, error) {
+		problems := []string{fmt.Sprintf("%v; removing the checkpoint so the deployment restarts from phase %v", problem, phaseOrder[0])}
+		if dryRun {
+			return "", problems, nil
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return "", problems, errors.WithStack(err)
+		}
+		return "", problems, nil
+	}
+
+	cp := &deploymentCheckpoint{}
+	if err := json.Unmarshal(buf, cp); err != nil {
+		return remove(fmt.Sprintf("The checkpoint can't be parsed: %v", err))
+	}
+	if cp.Request.Name == "" {
+		return remove("The checkpoint doesn't record the deployment")
+	}
+	for _, p := range phaseOrder {
+		if p == cp.Phase {
+			return cp.Phase, nil, nil
+		}
+	}
+
+	renamed, ok := renamedPhases[cp.Phase]
+	if !ok {
+		return remove(fmt.Sprintf("Deployment %v was checkpointed before phase %v which no longer exists", cp.Request.Name, cp.Phase))
+	}
+	problems := []string{fmt.Sprintf("Deployment %v was checkpointed before phase %v which was renamed; it resumes from phase %v", cp.Request.Name, cp.Phase, renamed)}
+	if dryRun {
+		return renamed, problems, nil
+	}
+	cp.Phase = renamed
+	if buf, err = json.Marshal(cp); err != nil {
+		return "", problems, errors.WithStack(err)
+	}
+	if err := stateKeys.writeFile(file, buf); err != nil {
+		return "", problems, err
+	}
+	return renamed, problems, nil
+}
+
+// Migrate migrates the state stored for the deployment to the schema of the server. The server
+// migrates its state at startup; this migrates state restored into the apps directory while the
+// server runs and with DryRun is a preflight for an upgrade. State is only changed while the
+// deployment isn't being applied.
+func (s *kfctlServer) Migrate(ctx context.Context, req MigrationRequest) (*MigrationReport, error) {
+	if err := s.checkDeploymentRequest(req.KfDef); err != nil {
+		return nil, err
+	}
+
+	if !req.DryRun {
+		// Hold opMux so no run or maintenance task starts while the state is migrated.
+		s.opMux.Lock()
+		defer s.opMux.Unlock()
+		s.kfDefMux.Lock()
+		busy := s.busy
+		s.kfDefMux.Unlock()
+		if busy {
+			return nil, &httpError{
+				Message: fmt.Sprintf("Deployment %v is being applied; migrate it once the run finishes", req.KfDef.Name),
+				Code:    http.StatusConflict,
+			}
+		}
+	}
+
+	report, err := migrateState(s.appsDir, req.DryRun)
+	if err != nil {
+		log.Errorf("Could not migrate the state of deployment %v; %v", req.KfDef.Name, err)
+		if _, ok := err.(*httpError); ok {
+			return nil, err
+		}
+		return nil, &httpError{
+			Message: fmt.Sprintf("Could not migrate the state of deployment %v: %v", req.KfDef.Name, err),
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	if !req.DryRun {
+		s.resumePhase = report.ResumePhase
+	}
+	report.Name = req.KfDef.Name
+	return report, nil
+}
+
+// Migrate forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) Migrate(ctx context.Context, req MigrationRequest) (*MigrationReport, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.Migrate(ctx, req)
+}
+
+// Migrate migrates the state stored for the deployment to the schema of the server; with DryRun
+// it only reports the migrations which would run.
+func (c *KfctlClient) Migrate(ctx context.Context, req MigrationRequest) (*MigrationReport, error) {
+	resp, err := c.migrateEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*MigrationReport)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeMigrateEndpoint creates an endpoint to handle requests to migrate the state of the deployment.
+func makeMigrateEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(MigrationRequest)
+		return svc.Migrate(ctx, req)
+	}
+}
+
+// decodeHTTPMigrationRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded MigrationRequest from the HTTP request body.
+func decodeHTTPMigrationRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request MigrationRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding migration request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func writeTestCheckpoint(t *testing.T, dir string, name string, phase DeploymentPhase) {
+	cp := deploymentCheckpoint{Phase: phase, Time: time.Now()}
+	cp.Request.Name = name
+	buf, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatalf("Could not marshal checkpoint; %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, checkpointFile), buf, 0644); err != nil {
+		t.Fatalf("Could not write checkpoint; %v", err)
+	}
+}
+
+func TestMigrateState(t *testing.T) {
+	migrations := stateMigrations
+	renamed := renamedPhases
+	defer func() {
+		stateMigrations = migrations
+		renamedPhases = renamed
+	}()
+
+	migrated := []int{}
+	stateMigrations = []stateMigration{
+		{Version: 1, Description: "first", Migrate: func(_ string, dryRun bool) ([]string, error) {
+			if !dryRun {
+				migrated = append(migrated, 1)
+			}
+			return nil, nil
+		}},
+		{Version: 2, Description: "second", Migrate: func(_ string, dryRun bool) ([]string, error) {
+			if !dryRun {
+				migrated = append(migrated, 2)
+			}
+			return []string{"rewrote the status"}, nil
+		}},
+	}
+	renamedPhases = map[DeploymentPhase]DeploymentPhase{"ApplyCluster": PhaseApplyK8s}
+
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestCheckpoint(t, dir, "kf-app", "ApplyCluster")
+
+	// A dry run changes nothing.
+	r, err := migrateState(dir, true)
+	if err != nil {
+		t.Fatalf("Dry run: %v", err)
+	}
+	if r.FromVersion != 0 || r.ToVersion != 2 || len(r.Steps) != 2 || len(r.Steps[1].Changes) != 1 || r.ResumePhase != PhaseApplyK8s {
+		t.Errorf("Dry run: got %+v", r)
+	}
+	if v, _ := readSchemaVersion(dir); v != 0 {
+		t.Errorf("Dry run wrote schema version %v", v)
+	}
+	if phase, _, _ := revalidateCheckpoint(dir, true); phase != PhaseApplyK8s {
+		t.Errorf("Dry run rewrote the checkpoint; got phase %v", phase)
+	}
+
+	r, err = migrateState(dir, false)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if v, _ := readSchemaVersion(dir); v != 2 {
+		t.Errorf("Schema version: got %v; want 2", v)
+	}
+	if r.ResumePhase != PhaseApplyK8s || len(r.ResumableState) != 1 {
+		t.Errorf("Migrate: got %+v", r)
+	}
+	if _, problems, _ := revalidateCheckpoint(dir, true); len(problems) != 0 {
+		t.Errorf("Checkpoint wasn't rewritten; got problems %v", problems)
+	}
+
+	// Migrations only run once.
+	if r, err = migrateState(dir, false); err != nil || len(r.Steps) != 0 {
+		t.Errorf("Migrate again: got %+v, %v", r, err)
+	}
+	if len(migrated) != 2 {
+		t.Errorf("Migrations ran %v; want each once", migrated)
+	}
+
+	// State written by a newer server isn't touched.
+	if err := writeSchemaVersion(dir, 3); err != nil {
+		t.Fatalf("Could not write schema version; %v", err)
+	}
+	_, err = migrateState(dir, false)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("Migrate newer state: want 409; got %v", err)
+	}
+}
+
+func TestRevalidateCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestCheckpoint(t, dir, "kf-app", PhaseApplyPlatform)
+	phase, problems, err := revalidateCheckpoint(dir, false)
+	if err != nil || phase != PhaseApplyPlatform || len(problems) != 0 {
+		t.Errorf("Valid checkpoint: got %v %v %v", phase, problems, err)
+	}
+
+	writeTestCheckpoint(t, dir, "kf-app", "Bootstrap")
+	phase, problems, err = revalidateCheckpoint(dir, false)
+	if err != nil || phase != "" || len(problems) != 1 {
+		t.Errorf("Checkpoint of an unknown phase: got %v %v %v", phase, problems, err)
+	}
+	if _, err := os.Stat(path.Join(dir, checkpointFile)); !os.IsNotExist(err) {
+		t.Errorf("Checkpoint of an unknown phase wasn't removed")
+	}
+
+	writeTestCheckpoint(t, dir, "", PhaseGenerate)
+	if phase, problems, _ = revalidateCheckpoint(dir, false); phase != "" || len(problems) != 1 {
+		t.Errorf("Checkpoint without a deployment: got %v %v", phase, problems)
+	}
+}
+
+func TestKfctlServer_Migrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	// The server migrates its state when it starts.
+	if v, _ := readSchemaVersion(dir); v != schemaVersion() {
+		t.Errorf("Schema version after startup: got %v; want %v", v, schemaVersion())
+	}
+
+	s.setBusy(true)
+	_, err = s.Migrate(context.Background(), MigrationRequest{KfDef: req})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("Migrate while applying: want 409; got %v", err)
+	}
+	r, err := s.Migrate(context.Background(), MigrationRequest{KfDef: req, DryRun: true})
+	if err != nil || r.Name != req.Name || r.FromVersion != r.ToVersion {
+		t.Errorf("Dry run while applying: got %+v, %v", r, err)
+	}
+	s.setBusy(false)
+
+	other := kfdefsv3.KfDef{}
+	other.Name = "other"
+	if _, err := s.Migrate(context.Background(), MigrationRequest{KfDef: other}); err == nil {
+		t.Errorf("Migrate of another deployment: got nil; want error")
+	}
+}
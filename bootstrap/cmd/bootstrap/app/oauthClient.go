@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"net/http"
+)
+
+// KfctlOAuthClientPath is the path on which to serve requests to check or provision the OAuth client used by IAP
+const KfctlOAuthClientPath = "/kfctl/apps/v1alpha2/oauth"
+
+// OAuthClientRequest requests a check of the OAuth consent screen and the OAuth client used by IAP.
+type OAuthClientRequest struct {
+	// KfDef provides the project, the IAP spec holding the OAuth client and the credentials.
+	// The deployment doesn't have to exist.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// Provision creates the OAuth consent screen if the project doesn't have one and an OAuth client
+	// if the KfDef doesn't set one.
+	Provision bool `json:"provision,omitempty"`
+}
+
+// checkOAuthClient checks or provisions the OAuth client of the request with the access token in the request.
+func checkOAuthClient(ctx context.Context, req OAuthClientRequest) (*gcp.OAuthClientReport, error) {
+	token, err := req.KfDef.GetSecret(gcp.GcpAccessTokenName)
+	if err != nil {
+		log.Errorf("Failed to get secret %v; error %v", gcp.GcpAccessTokenName, err)
+		return nil, &httpError{
+			Message: fmt.Sprintf("Could not obtain an access token from secret %v", gcp.GcpAccessTokenName),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	client := gcp.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	report, err := gcp.CheckOAuthClient(ctx, client, &req.KfDef, req.Provision)
+	if err != nil {
+		if kfErr, ok := err.(*kfapis.KfError); ok && kfErr.Code == int(kfapis.INVALID_ARGUMENT) {
+			return nil, &httpError{
+				Message: kfErr.Message,
+				Code:    http.StatusBadRequest,
+			}
+		}
+		log.Errorf("Could not check the OAuth client of %v; error %v", req.KfDef.Name, err)
+		return nil, &httpError{
+			Message: "Could not check the OAuth client; please try again later",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	return report, nil
+}
+
+// CheckOAuthClient checks the OAuth client of the request. It doesn't depend on the deployment
+// handled by the server so it can be called before the deployment is created.
+func (s *kfctlServer) CheckOAuthClient(ctx context.Context, req OAuthClientRequest) (*gcp.OAuthClientReport, error) {
+	return checkOAuthClient(ctx, req)
+}
+
+// CheckOAuthClient checks the OAuth client of the request. The deployment may not exist yet so the
+// router handles it directly rather than forwarding to a backend. Provisioning requires the admin role.
+func (r *kfctlRouter) CheckOAuthClient(ctx context.Context, req OAuthClientRequest) (*gcp.OAuthClientReport, error) {
+	role := RoleViewer
+	if req.Provision {
+		role = RoleAdmin
+	}
+	if err := r.authorize(req.KfDef, role); err != nil {
+		return nil, err
+	}
+	return checkOAuthClient(ctx, req)
+}
+
+// CheckOAuthClient checks the OAuth consent screen and the OAuth client used by IAP before the
+// deployment is created. Requests provisioning a client aren't retried since a retry could create
+// a second client.
+func (c *KfctlClient) CheckOAuthClient(ctx context.Context, req OAuthClientRequest) (*gcp.OAuthClientReport, error) {
+	var resp interface{}
+	var err error
+	if req.Provision {
+		resp, err = c.oauthClientEndpoint(ctx, req)
+	} else {
+		err = c.retry("CheckOAuthClient", func() error {
+			var err error
+			resp, err = c.oauthClientEndpoint(ctx, req)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*gcp.OAuthClientReport)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeOAuthClientEndpoint creates an endpoint to handle requests to check the OAuth client used by IAP.
+func makeOAuthClientEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(OAuthClientRequest)
+		return svc.CheckOAuthClient(ctx, req)
+	}
+}
+
+// decodeHTTPOAuthClientRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded OAuthClientRequest from the HTTP request body.
+func decodeHTTPOAuthClientRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request OAuthClientRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding OAuth client request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
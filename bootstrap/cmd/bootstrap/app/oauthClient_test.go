@@ -0,0 +1,23 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"testing"
+)
+
+func TestCheckOAuthClient_BadRequest(t *testing.T) {
+	noToken := newPlanTestKfDef()
+	noToken.Spec.Secrets = []kfdefsv3.Secret{}
+
+	basicAuth := newPlanTestKfDef()
+	basicAuth.Spec.UseBasicAuth = true
+
+	for name, d := range map[string]kfdefsv3.KfDef{"no access token": noToken, "basic auth": basicAuth} {
+		_, err := checkOAuthClient(context.Background(), OAuthClientRequest{KfDef: d, Provision: true})
+		if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+			t.Errorf("%v: want 400; got %v", name, err)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package options
 
 import (
 	"flag"
+	"time"
 )
 
 // ServerOption is the main context object for the controller manager.
@@ -27,6 +28,7 @@ type ServerOption struct {
 	KeepAlive            bool
 	InstallIstio         bool
 	Port                 int
+	Socket               string
 	AppName              string
 	AppDir               string
 	Config               string
@@ -36,6 +38,20 @@ type ServerOption struct {
 	NameSpace            string
 	RegistriesConfigFile string
 	KfctlAppsNamespace   string
+	FaultInjection       string
+	TargetKubeconfig     string
+	Simulate             bool
+	DrainTimeout         time.Duration
+	LoadShedding         string
+	ServerConfig         string
+	ProxyOverrides       string
+	PhaseJobs            string
+	Phase                string
+	PhaseApplications    string
+	Standby              bool
+	StateEncryptionKey   string
+	GcFailedAge          time.Duration
+	GcStuckAge           time.Duration
 }
 
 // NewServerOption creates a new CMServer with a default config.
@@ -51,6 +67,7 @@ func (s *ServerOption) AddFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&s.PrintVersion, "version", false, "Show version and quit")
 	fs.BoolVar(&s.JsonLogFormat, "json-log-format", true, "Set true to use json style log format. Set false to use plaintext style log format")
 	fs.IntVar(&s.Port, "port", 8080, "The port to use when running an http server.")
+	fs.StringVar(&s.Socket, "socket", "", "Serve on the unix socket at this path instead of --port e.g. for kfctl on the same machine; clients use the instance unix://<path>.")
 	fs.StringVar(&s.AppDir, "app-dir", "/opt/bootstrap", "The directory for the ksonnet applications.")
 	fs.StringVar(&s.GkeVersionOverride, "gke-version-override", "", "Override GKE master version only when GKE latest breaks")
 	fs.StringVar(&s.NameSpace, "namespace", "kubeflow", "The namespace where all resources for kubeflow will be created")
@@ -70,6 +87,24 @@ func (s *ServerOption) AddFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&s.InstallIstio, "install-istio", false, "Whether to install istio.")
 
 	// Options below are related to the new API and router + backend design
-	fs.StringVar(&s.Mode, "mode", "router", "What mode to start the binary in. Options are router, kfctl and gc.")
+	fs.StringVar(&s.Mode, "mode", "router", "What mode to start the binary in. Options are router, kfctl, gc and phase.")
 	fs.StringVar(&s.KfctlAppsNamespace, "kfctl-apps-namespace", "", "The namespace where the kfctl apps will be created.")
+	fs.DurationVar(&s.DrainTimeout, "drain-timeout", 10*time.Minute, "How long the kfctl server waits on SIGTERM for the in-flight deployment to reach a phase boundary. Ignored if --server-config is set.")
+	fs.StringVar(&s.ProxyOverrides, "proxy-overrides", "", "Comma separated host=proxy pairs overriding HTTP(S)_PROXY and NO_PROXY for outbound requests to those hosts e.g. github.com=http://proxy.acme.com:3128,.googleapis.com=direct. Ignored if --server-config is set.")
+	fs.StringVar(&s.ServerConfig, "server-config", "", "Path to a ServerConfig file with the settings of the kfctl server and router; it is reloaded on SIGHUP. Overrides --drain-timeout, --load-shedding and --proxy-overrides.")
+	fs.StringVar(&s.PhaseJobs, "phase-jobs", "", "JSON of a PhaseJobConfig; if set the kfctl server runs the phases of the deployment as Kubernetes Jobs. Ignored if --server-config is set.")
+	fs.StringVar(&s.Phase, "phase", "", "The phase to run in --mode=phase; one of Generate, ApplyPlatform and ApplyK8s.")
+	fs.StringVar(&s.PhaseApplications, "phase-applications", "", "Comma separated applications to apply in --mode=phase --phase=ApplyK8s; all applications if empty.")
+	fs.BoolVar(&s.Standby, "standby", false, "Whether the kfctl server runs with standby replicas; the pod with ordinal 0 of the StatefulSet is the leader and the others serve reads from the state it publishes in --app-dir.")
+	fs.StringVar(&s.StateEncryptionKey, "state-encryption-key", "", "The Cloud KMS key projects/*/locations/*/keyRings/*/cryptoKeys/* wrapping the data keys which encrypt the state stored by the kfctl servers; stored in plain text if empty. Ignored if --server-config is set.")
+	fs.DurationVar(&s.GcFailedAge, "gc-failed-age", 0, "How long after its last run failed a deployment which never succeeded is cleaned up and marked Abandoned; garbage collection is disabled unless it and --gc-stuck-age are set. Ignored by the router if --server-config is set.")
+	fs.DurationVar(&s.GcStuckAge, "gc-stuck-age", 0, "How long after it started a run creating a deployment which never succeeded is canceled so the deployment is cleaned up. Ignored by the router if --server-config is set.")
+	fs.StringVar(&s.LoadShedding, "load-shedding", "memory=0.85,cpu=2,inflight=5,retry-after=30s", "Thresholds above which the kfctl server rejects new deployments with a 503 e.g. memory=0.85,cpu=2,inflight=5,retry-after=30s; empty disables load shedding. Ignored if --server-config is set.")
+
+	// Only intended for testing client retry logic; should never be set in production.
+	fs.StringVar(&s.FaultInjection, "fault-injection", "", "(Testing only) Inject faults into kfctl server responses e.g. drop=0.1,5xx=0.2,slow=0.1,malformed=0.05,delay=5s.")
+	// Only intended for end to end tests against a local cluster; should never be set in production.
+	fs.StringVar(&s.TargetKubeconfig, "target-kubeconfig", "", "(Testing only) Deploy to the cluster in this kubeconfig e.g. a kind cluster instead of a GKE cluster; GCP credentials aren't checked.")
+	// Only intended for demos and tests of the UI and clients; should never be set in production.
+	fs.BoolVar(&s.Simulate, "simulate", false, "(Testing only) Simulate deployments instead of deploying them; the steps take about as long as on GCP and the simulate plugin of the KfDef sets their speedup and failures. GCP credentials aren't checked.")
 }
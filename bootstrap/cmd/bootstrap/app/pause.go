@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"path"
+)
+
+// KfctlPausePath is the path on which to serve requests to pause the deployment
+const KfctlPausePath = "/kfctl/apps/v1alpha2/pause"
+
+// KfctlResumePath is the path on which to serve requests to resume a paused deployment
+const KfctlResumePath = "/kfctl/apps/v1alpha2/resume"
+
+// DeploymentPausedReason indicates an operator paused the deployment.
+const DeploymentPausedReason = "DeploymentPaused"
+
+// pauseFile is the name of the file in the apps directory recording that the deployment is paused
+// so it stays paused if the server restarts.
+const pauseFile = ".paused"
+
+// setPausedCondition adds the condition reporting the deployment is paused to d or removes it.
+func setPausedCondition(d *kfdefs.KfDef, paused bool) {
+	conditions := []kfdefs.KfDefCondition{}
+	for _, c := range d.Status.Conditions {
+		if c.Reason != DeploymentPausedReason {
+			conditions = append(conditions, c)
+		}
+	}
+	if paused {
+		conditions = append(conditions, kfdefs.KfDefCondition{
+			Type:               kfdefs.KfDeploying,
+			Status:             v1.ConditionFalse,
+			Reason:             DeploymentPausedReason,
+			Message:            "The deployment is paused; it will hold at the next phase boundary until it is resumed.",
+			LastUpdateTime:     metav1.Now(),
+			LastTransitionTime: metav1.Now(),
+		})
+	}
+	d.Status.Conditions = conditions
+}
+
+// loadPaused restores the paused state recorded before the server restarted.
+func (s *kfctlServer) loadPaused() {
+	if _, err := os.Stat(path.Join(s.appsDir, pauseFile)); err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not check whether the deployment is paused; %v", err)
+		}
+		return
+	}
+	log.Infof("Deployment was paused before the server restarted; it will hold until it is resumed")
+	s.paused = true
+	s.resumed = make(chan struct{})
+	setPausedCondition(&s.latestKfDef, true)
+}
+
+// waitWhilePaused blocks the pipeline before next until the deployment is resumed or the server drains.
+func (s *kfctlServer) waitWhilePaused(r kfdefs.KfDef, next DeploymentPhase) {
+	s.kfDefMux.Lock()
+	resumed := s.resumed
+	s.kfDefMux.Unlock()
+
+	if resumed == nil {
+		return
+	}
+	log.Infof("Deployment %v is paused; holding before phase %v", r.Name, next)
+	<-resumed
+	log.Infof("Deployment %v is no longer held; continuing with phase %v", r.Name, next)
+}
+
+// releasePause unblocks a pipeline held by waitWhilePaused without resuming the deployment.
+// Used when draining so the held deployment is checkpointed. Must be called with kfDefMux held.
+func (s *kfctlServer) releasePause() {
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+// wakePaused unblocks a pipeline held by waitWhilePaused e.g. so it can stop because it was canceled.
+// The deployment stays paused. Must be called with kfDefMux held.
+func (s *kfctlServer) wakePaused() {
+	if s.resumed == nil {
+		return
+	}
+	close(s.resumed)
+	s.resumed = make(chan struct{})
+}
+
+// checkDeploymentRequest returns an error if req isn't the deployment handled by the server.
+func (s *kfctlServer) checkDeploymentRequest(req kfdefs.KfDef) error {
+	if s.isDraining() {
+		return drainingError()
+	}
+
+	if s.deploysToGcp() {
+		if err := s.verifyAccess(req); err != nil {
+			return err
+		}
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	if s.latestKfDef.Name == "" || s.latestKfDef.Name != req.Name {
+		return &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+// Pause stops the deployment at the next phase boundary and holds it until Resume is called.
+// Requests received while paused are queued. Pausing a paused deployment has no effect.
+func (s *kfctlServer) Pause(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if err := s.checkDeploymentRequest(req); err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	if !s.paused {
+		log.Infof("Pausing deployment %v", req.Name)
+		if err := ioutil.WriteFile(path.Join(s.appsDir, pauseFile), []byte{}, 0644); err != nil {
+			log.Errorf("Could not record the deployment is paused; %v", err)
+			return nil, &httpError{
+				Message: "Internal service error please try again later.",
+				Code:    http.StatusInternalServerError,
+				cause:   err,
+			}
+		}
+		s.paused = true
+		s.resumed = make(chan struct{})
+	}
+	setPausedCondition(&s.latestKfDef, true)
+	s.publishStatus()
+	return s.latestKfDef.DeepCopy(), nil
+}
+
+// Resume continues a paused deployment from the phase boundary it is held at.
+func (s *kfctlServer) Resume(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if err := s.checkDeploymentRequest(req); err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	if !s.paused {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v isn't paused", req.Name),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	log.Infof("Resuming deployment %v", req.Name)
+	if err := os.Remove(path.Join(s.appsDir, pauseFile)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Could not remove %v; %v", pauseFile, err)
+	}
+	s.paused = false
+	s.releasePause()
+	setPausedCondition(&s.latestKfDef, false)
+	s.publishStatus()
+	return s.latestKfDef.DeepCopy(), nil
+}
+
+// Pause forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) Pause(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleEditor); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Pause(ctx, req)
+}
+
+// Resume forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) Resume(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleEditor); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Resume(ctx, req)
+}
+
+// Pause stops the deployment at the next phase boundary until Resume is called.
+func (c *KfctlClient) Pause(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	return c.callKfDefEndpoint(ctx, "Pause", c.pauseEndpoint, req)
+}
+
+// Resume continues a paused deployment.
+func (c *KfctlClient) Resume(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	return c.callKfDefEndpoint(ctx, "Resume", c.resumeEndpoint, req)
+}
+
+// callKfDefEndpoint calls an endpoint returning a KfDef; client errors aren't retried.
+func (c *KfctlClient) callKfDefEndpoint(ctx context.Context, method string, e endpoint.Endpoint, req interface{}) (*kfdefs.KfDef, error) {
+	var resp interface{}
+	err := c.retry(method, func() error {
+		var err error
+		resp, err = e(ctx, req)
+		if hErr, ok := err.(*httpError); ok && hErr.Code >= 400 && hErr.Code < 500 {
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kfdefs.KfDef)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makePauseEndpoint creates an endpoint to handle requests to pause the deployment.
+func makePauseEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.Pause(ctx, req)
+	}
+}
+
+// makeResumeEndpoint creates an endpoint to handle requests to resume the deployment.
+func makeResumeEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.Resume(ctx, req)
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// isPaused returns true if d has the condition reporting the deployment is paused.
+func isPaused(d *kfdefsv3.KfDef) bool {
+	for _, c := range d.Status.Conditions {
+		if c.Reason == DeploymentPausedReason {
+			return true
+		}
+	}
+	return false
+}
+
+func newPauseTestServer(t *testing.T, dir string) *kfctlServer {
+	s, err := NewKfctlServer(dir)
+	if err != nil {
+		t.Fatalf("Could not create server; %v", err)
+	}
+	s.targetCluster = &rest.Config{}
+	s.latestKfDef = newPlanTestKfDef()
+	return s
+}
+
+// newQueueTestServer returns a test server which doesn't process the requests it queues so tests
+// can inspect them.
+func newQueueTestServer(dir string) *kfctlServer {
+	return &kfctlServer{
+		c:             make(chan kfdefsv3.KfDef, 10),
+		appsDir:       dir,
+		runs:          newRunHistory(path.Join(dir, runHistoryFile), defaultMaxRuns),
+		latestKfDef:   newPlanTestKfDef(),
+		targetCluster: &rest.Config{},
+	}
+}
+
+func TestKfctlServer_PauseAndResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pause")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	_, err = s.Resume(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("Resume of a deployment that isn't paused: want 409; got %v", err)
+	}
+
+	other := newPlanTestKfDef()
+	other.Name = "other"
+	_, err = s.Pause(context.Background(), other)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("Pause of another deployment: want 404; got %v", err)
+	}
+
+	d, err := s.Pause(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Pause failed; %v", err)
+	}
+	if !isPaused(d) {
+		t.Errorf("Status of the paused deployment doesn't report it is paused; %v", PrettyPrint(d.Status))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.atPhaseBoundary(req, PhaseApplyK8s)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("atPhaseBoundary returned %v while the deployment is paused; want it to hold", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The deployment stays paused if the server restarts.
+	if restarted := newPauseTestServer(t, dir); !restarted.paused {
+		t.Errorf("Deployment isn't paused after the server restarted")
+	}
+
+	d, err = s.Resume(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Resume failed; %v", err)
+	}
+	if isPaused(d) {
+		t.Errorf("Status of the resumed deployment reports it is paused; %v", PrettyPrint(d.Status))
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("atPhaseBoundary after resume: want nil; got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("atPhaseBoundary is still held after the deployment was resumed")
+	}
+
+	if _, err := os.Stat(path.Join(dir, pauseFile)); !os.IsNotExist(err) {
+		t.Errorf("%v wasn't removed when the deployment was resumed; %v", pauseFile, err)
+	}
+}
+
+func TestKfctlServer_DrainWhilePaused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pause")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	if _, err := s.Pause(context.Background(), req); err != nil {
+		t.Fatalf("Pause failed; %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.atPhaseBoundary(req, PhaseApplyPlatform)
+	}()
+
+	if err := s.Drain(time.Second); err != nil {
+		t.Fatalf("Drain failed; %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != errDrained {
+			t.Errorf("atPhaseBoundary while draining: want errDrained; got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Drain didn't release the paused deployment")
+	}
+
+	restarted := newPauseTestServer(t, dir)
+	if !restarted.paused {
+		t.Errorf("Deployment isn't paused after the server restarted")
+	}
+	if restarted.resumePhase != PhaseApplyPlatform {
+		t.Errorf("Got resume phase %v; want %v", restarted.resumePhase, PhaseApplyPlatform)
+	}
+}
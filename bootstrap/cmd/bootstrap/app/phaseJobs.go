@@ -0,0 +1,409 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app/options"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/coordinator"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPhaseJobTimeout bounds how long the Job of a phase runs if the config doesn't set a timeout.
+	defaultPhaseJobTimeout = time.Hour
+	// PhaseJobLabel is the label identifying the phase a Job was created for.
+	PhaseJobLabel = "kfctl.kubeflow.org/phase"
+	// PhaseTokenEnv is the environment variable holding the access token of the deployment in the
+	// Job of a phase.
+	PhaseTokenEnv = "KFCTL_PHASE_TOKEN"
+	// phaseTokenKey is the key of the access token in the secret created for the Job of a phase.
+	phaseTokenKey = "token"
+	// phaseTerminationLog is where the Job of a phase writes why it failed; the kfctl server
+	// reports it as the error of the phase.
+	phaseTerminationLog = "/dev/termination-log"
+)
+
+// jobPhases are the phases which can run as Jobs.
+var jobPhases = []DeploymentPhase{PhaseGenerate, PhaseApplyPlatform, PhaseApplyK8s}
+
+// PhaseJobConfig runs the phases of the deployments as Kubernetes Jobs in the cluster of the
+// kfctl servers instead of in the kfctl server process. Each Job runs the image with --mode=phase,
+// has its own service account and resource limits and shares the app directory of the deployment
+// with the kfctl server through VolumeClaim. A failed phase only takes down its Job and the heavy
+// phases of many deployments are spread over the nodes of the cluster.
+type PhaseJobConfig struct {
+	// Image is the image of the Jobs; it must contain the bootstrapper binary.
+	Image string `json:"image"`
+	// Namespace is the namespace of the Jobs; defaults to the namespace of the kfctl servers.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceAccount is the service account the Jobs run as.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// ServerServiceAccount is the service account of the kfctl servers; it must be allowed to
+	// create Jobs and Secrets and list Pods in Namespace.
+	ServerServiceAccount string `json:"serverServiceAccount,omitempty"`
+	// VolumeClaim is a ReadWriteMany PersistentVolumeClaim holding the app directories. The kfctl
+	// servers and the Jobs mount the directory of their deployment from it.
+	VolumeClaim string `json:"volumeClaim"`
+	// Phases are the phases run as Jobs; the other phases run in the kfctl server. Defaults to
+	// Generate, ApplyPlatform and ApplyK8s.
+	Phases []DeploymentPhase `json:"phases,omitempty"`
+	// Resources are the resource requests and limits of the Jobs.
+	Resources v1.ResourceRequirements `json:"resources,omitempty"`
+	// TimeoutSeconds is how long a Job may run; defaults to an hour.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// validate returns an error if the config isn't valid and sets the defaults.
+func (c *PhaseJobConfig) validate() error {
+	if c.Image == "" {
+		return fmt.Errorf("phaseJobs.image is required")
+	}
+	if c.VolumeClaim == "" {
+		return fmt.Errorf("phaseJobs.volumeClaim is required")
+	}
+	if c.TimeoutSeconds < 0 {
+		return fmt.Errorf("phaseJobs.timeoutSeconds must not be negative")
+	}
+	if len(c.Phases) == 0 {
+		c.Phases = append([]DeploymentPhase{}, jobPhases...)
+	}
+	for _, p := range c.Phases {
+		valid := false
+		for _, j := range jobPhases {
+			valid = valid || p == j
+		}
+		if !valid {
+			return fmt.Errorf("phaseJobs.phases has unsupported phase %q; must be one of %v", p, jobPhases)
+		}
+	}
+	return nil
+}
+
+// runsPhase returns true if phase runs as a Job.
+func (c *PhaseJobConfig) runsPhase(phase DeploymentPhase) bool {
+	for _, p := range c.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// timeout returns how long a Job may run.
+func (c *PhaseJobConfig) timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return defaultPhaseJobTimeout
+}
+
+// ParsePhaseJobs parses the JSON of a PhaseJobConfig as passed with --phase-jobs.
+func ParsePhaseJobs(spec string) (*PhaseJobConfig, error) {
+	c := &PhaseJobConfig{}
+	if err := json.Unmarshal([]byte(spec), c); err != nil {
+		return nil, errors.Wrapf(err, "could not parse the phase jobs config")
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// formatPhaseJobs is the inverse of ParsePhaseJobs.
+func formatPhaseJobs(c *PhaseJobConfig) (string, error) {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(buf), nil
+}
+
+// appsVolume returns the volume of claim holding the app directory of the deployment name and its
+// mount at appsDir; the replicas of the kfctl server and the Jobs of its phases mount the same directory.
+func appsVolume(claim string, name string, appsDir string) (v1.Volume, v1.VolumeMount) {
+	volume := v1.Volume{
+		Name: "apps",
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+		},
+	}
+	mount := v1.VolumeMount{
+		Name:      "apps",
+		MountPath: appsDir,
+		SubPath:   name,
+	}
+	return volume, mount
+}
+
+// phaseJob returns the Job running phase of deployment d; its access token is read from secret.
+// apps if not nil are the only applications applied by ApplyK8s.
+func phaseJob(c *PhaseJobConfig, d *kfdefsv3.KfDef, appsDir string, phase DeploymentPhase, apps []string, secret string, proxies []ProxyRule) *batchv1.Job {
+	labels := map[string]string{
+		AppNameKey:    d.Name,
+		PhaseJobLabel: string(phase),
+	}
+	command := []string{
+		"/opt/kubeflow/bootstrapper",
+		"--mode=phase",
+		"--phase=" + string(phase),
+		"--app-dir=" + d.Spec.AppDir,
+		"--registries-config-file=",
+		"--keep-alive=false",
+	}
+	if apps != nil {
+		command = append(command, "--phase-applications="+strings.Join(apps, ","))
+	}
+	if len(proxies) > 0 {
+		command = append(command, "--proxy-overrides="+formatProxyRules(proxies))
+	}
+	// The Job reads and writes the state the kfctl server encrypts.
+	if key := stateKeys.key(); key != "" {
+		command = append(command, "--state-encryption-key="+key)
+	}
+	env := append(proxyEnv(), v1.EnvVar{
+		Name: PhaseTokenEnv,
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: secret},
+				Key:                  phaseTokenKey,
+			},
+		},
+	})
+	volume, mount := appsVolume(c.VolumeClaim, d.Name, appsDir)
+	deadline := int64(c.timeout() / time.Second)
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: strings.ToLower(fmt.Sprintf("%v-%v-", d.Name, phase)),
+			Namespace:    c.Namespace,
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			// The kfctl server retries failed deployments so the Job doesn't retry the phase.
+			BackoffLimit:          proto.Int32(0),
+			ActiveDeadlineSeconds: &deadline,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: c.ServiceAccount,
+					// The phase uses the access token of the deployment; not the K8s API.
+					AutomountServiceAccountToken: proto.Bool(false),
+					RestartPolicy:                v1.RestartPolicyNever,
+					Containers: []v1.Container{
+						{
+							Name:         "kfctl",
+							Command:      command,
+							Env:          env,
+							Image:        c.Image,
+							Resources:    c.Resources,
+							VolumeMounts: []v1.VolumeMount{mount},
+						},
+					},
+					Volumes: []v1.Volume{volume},
+				},
+			},
+		},
+	}
+}
+
+// phaseJobClient returns the client of the cluster the kfctl server runs in.
+func (s *kfctlServer) phaseJobClient() (kubernetes.Interface, error) {
+	if s.jobClient != nil {
+		return s.jobClient, nil
+	}
+	config, err := getClusterConfig(true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting the config of the cluster of the kfctl server")
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s.jobClient = client
+	return client, nil
+}
+
+// runPhase runs phase of the deployment. The phase runs as a Job if the server config says so;
+// otherwise run is called. After a Job the KfApp is loaded again from the app directory to pick up
+// the changes made by the Job. apps if not nil are the only applications applied by ApplyK8s.
+func (s *kfctlServer) runPhase(ctx context.Context, phase DeploymentPhase, apps []string, run func() error) error {
+	var c *PhaseJobConfig
+	if s.config != nil {
+		c = s.config.get().PhaseJobs
+	}
+	if c == nil || !c.runsPhase(phase) || !s.deploysToGcp() {
+		return run()
+	}
+
+	s.kfDefMux.Lock()
+	var ts oauth2.TokenSource = s.ts
+	if s.applyingDeferred {
+		ts = s.deployTs
+	}
+	s.kfDefMux.Unlock()
+	if ts == nil {
+		return fmt.Errorf("no token source set; can't run phase %v as a job", phase)
+	}
+	token, err := ts.Token()
+	if err != nil || token == nil {
+		return errors.Wrapf(err, "getting the token of phase %v", phase)
+	}
+
+	client, err := s.phaseJobClient()
+	if err != nil {
+		return err
+	}
+	d := s.kfDefGetter.GetKfDef()
+	jobCtx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+	if err := runPhaseJob(jobCtx, client, c, d, s.appsDir, phase, apps, token.AccessToken, s.config.get().Proxies); err != nil {
+		return err
+	}
+	return s.loadKfApp(ctx, path.Join(d.Spec.AppDir, kftypes.KfConfigFile))
+}
+
+// runPhaseJob runs phase of deployment d as a Job and waits for it to finish. The access token is
+// passed to the Job in a secret which is deleted once the Job finishes.
+func runPhaseJob(ctx context.Context, client kubernetes.Interface, c *PhaseJobConfig, d *kfdefsv3.KfDef,
+	appsDir string, phase DeploymentPhase, apps []string, token string, proxies []ProxyRule) error {
+	if c.Namespace == "" {
+		return fmt.Errorf("the namespace of the jobs of the phases isn't set")
+	}
+	secrets := client.CoreV1().Secrets(c.Namespace)
+	secret, err := secrets.Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: strings.ToLower(fmt.Sprintf("%v-%v-", d.Name, phase)),
+			Namespace:    c.Namespace,
+			Labels: map[string]string{
+				AppNameKey:    d.Name,
+				PhaseJobLabel: string(phase),
+			},
+		},
+		StringData: map[string]string{phaseTokenKey: token},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "creating the secret of phase %v", phase)
+	}
+	defer func() {
+		if err := secrets.Delete(secret.Name, &metav1.DeleteOptions{}); err != nil {
+			log.Warnf("Could not delete secret %v/%v; error %v", c.Namespace, secret.Name, err)
+		}
+	}()
+
+	jobs := client.BatchV1().Jobs(c.Namespace)
+	job, err := jobs.Create(phaseJob(c, d, appsDir, phase, apps, secret.Name, proxies))
+	if err != nil {
+		return errors.Wrapf(err, "creating the job of phase %v", phase)
+	}
+	log.Infof("Created job %v/%v for phase %v of deployment %v", c.Namespace, job.Name, phase, d.Name)
+
+	if err := waitForJob(ctx, jobs, job); err != nil {
+		if msg := phaseJobMessage(client, c.Namespace, job.Name); msg != "" {
+			return fmt.Errorf("phase %v failed: %v", phase, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// phaseJobMessage returns the termination message of the pod of the Job; empty if there is none.
+func phaseJobMessage(client kubernetes.Interface, namespace string, job string) string {
+	pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: "job-name=" + job,
+	})
+	if err != nil {
+		log.Warnf("Could not list the pods of job %v/%v; error %v", namespace, job, err)
+		return ""
+	}
+	for _, p := range pods.Items {
+		for _, c := range p.Status.ContainerStatuses {
+			if t := c.State.Terminated; t != nil && t.Message != "" {
+				return strings.TrimSpace(t.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// RunPhase runs a single phase of the deployment in --app-dir; it is the entrypoint of the Jobs
+// created for the phases. The access token of the deployment is read from PhaseTokenEnv and the
+// error if the phase fails is written to the termination log of the pod.
+func RunPhase(opt *options.ServerOption) error {
+	err := runPhaseInProcess(opt)
+	if err != nil {
+		log.Errorf("Phase %v failed; %v", opt.Phase, err)
+		if writeErr := ioutil.WriteFile(phaseTerminationLog, []byte(err.Error()), 0644); writeErr != nil {
+			log.Warnf("Could not write the termination log; %v", writeErr)
+		}
+	}
+	return err
+}
+
+// runPhaseInProcess loads the KfApp in --app-dir and runs --phase the same way the kfctl server does.
+func runPhaseInProcess(opt *options.ServerOption) error {
+	token := os.Getenv(PhaseTokenEnv)
+	if token == "" {
+		return fmt.Errorf("%v isn't set", PhaseTokenEnv)
+	}
+	proxies, err := ParseProxyRules(opt.ProxyOverrides)
+	if err != nil {
+		return err
+	}
+	config := DefaultServerConfig()
+	config.Proxies = proxies
+	config.StateEncryptionKey = opt.StateEncryptionKey
+	store, err := newServerConfigStore("", config)
+	if err != nil {
+		return err
+	}
+	store.InstallProxy()
+	kfdefsv3.SetConfigSealer(stateKeys)
+
+	ctx := context.Background()
+	s := &kfctlServer{
+		ts:      &RefreshableTokenSource{t: &oauth2.Token{AccessToken: token}},
+		appsDir: path.Dir(opt.AppDir),
+		builder: &coordinator.DefaultBuilder{},
+		config:  store,
+	}
+	if err := s.loadKfApp(ctx, path.Join(opt.AppDir, kftypes.KfConfigFile)); err != nil {
+		return err
+	}
+
+	switch DeploymentPhase(opt.Phase) {
+	case PhaseGenerate:
+		return s.kfApp.Generate(kftypes.ALL)
+	case PhaseApplyPlatform:
+		return s.kfApp.Apply(kftypes.PLATFORM)
+	case PhaseApplyK8s:
+		setter, err := s.configureKustomizePlugin(ctx, *s.kfDefGetter.GetKfDef())
+		if err != nil {
+			return err
+		}
+		var apps []string
+		if opt.PhaseApplications != "" {
+			apps = strings.Split(opt.PhaseApplications, ",")
+		}
+		setter.SetApplicationFilter(apps)
+		return s.kfApp.Apply(kftypes.K8S)
+	default:
+		return fmt.Errorf("unsupported phase %q; must be one of %v", opt.Phase, jobPhases)
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePhaseJobs(t *testing.T) {
+	type testCase struct {
+		spec  string
+		valid bool
+	}
+
+	cases := []testCase{
+		{spec: `{"image": "gcr.io/kubeflow/bootstrapper:v1", "volumeClaim": "apps"}`, valid: true},
+		{spec: `{"image": "gcr.io/kubeflow/bootstrapper:v1", "volumeClaim": "apps", "phases": ["ApplyPlatform"]}`, valid: true},
+		{spec: `{"volumeClaim": "apps"}`, valid: false},
+		{spec: `{"image": "gcr.io/kubeflow/bootstrapper:v1"}`, valid: false},
+		{spec: `{"image": "gcr.io/kubeflow/bootstrapper:v1", "volumeClaim": "apps", "phases": ["Delete"]}`, valid: false},
+		{spec: `{"image": "gcr.io/kubeflow/bootstrapper:v1", "volumeClaim": "apps", "timeoutSeconds": -1}`, valid: false},
+		{spec: `not json`, valid: false},
+	}
+
+	for _, c := range cases {
+		_, err := ParsePhaseJobs(c.spec)
+		if (err == nil) != c.valid {
+			t.Errorf("ParsePhaseJobs(%v): got %v; want valid %v", c.spec, err, c.valid)
+		}
+	}
+
+	c, err := ParsePhaseJobs(`{"image": "gcr.io/kubeflow/bootstrapper:v1", "volumeClaim": "apps"}`)
+	if err != nil {
+		t.Fatalf("ParsePhaseJobs: %v", err)
+	}
+	if !reflect.DeepEqual(c.Phases, jobPhases) {
+		t.Errorf("Default phases: got %v; want %v", c.Phases, jobPhases)
+	}
+	spec, err := formatPhaseJobs(c)
+	if err != nil {
+		t.Fatalf("formatPhaseJobs: %v", err)
+	}
+	parsed, err := ParsePhaseJobs(spec)
+	if err != nil || !reflect.DeepEqual(parsed, c) {
+		t.Errorf("ParsePhaseJobs(formatPhaseJobs(c)): got %+v, %v; want %+v", parsed, err, c)
+	}
+}
+
+func TestPhaseJob(t *testing.T) {
+	c := &PhaseJobConfig{
+		Image:          "gcr.io/kubeflow/bootstrapper:v1",
+		Namespace:      "kfctl",
+		ServiceAccount: "kfctl-phase",
+		VolumeClaim:    "apps",
+		Resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")},
+		},
+	}
+	if err := c.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	d := &kfdefsv3.KfDef{
+		ObjectMeta: metav1.ObjectMeta{Name: "kf-app"},
+		Spec:       kfdefsv3.KfDefSpec{AppDir: "/apps/kf-app"},
+	}
+
+	job := phaseJob(c, d, "/apps", PhaseApplyK8s, []string{"jupyter", "pipelines"}, "kf-app-token", nil)
+	if job.Namespace != "kfctl" || !strings.HasPrefix(job.GenerateName, "kf-app-applyk8s-") {
+		t.Errorf("Job metadata: got %v %v", job.Namespace, job.GenerateName)
+	}
+	if job.Labels[PhaseJobLabel] != string(PhaseApplyK8s) || job.Labels[AppNameKey] != "kf-app" {
+		t.Errorf("Job labels: got %v", job.Labels)
+	}
+	if *job.Spec.BackoffLimit != 0 || *job.Spec.ActiveDeadlineSeconds != int64(defaultPhaseJobTimeout.Seconds()) {
+		t.Errorf("Job retries and deadline: got %v %v", *job.Spec.BackoffLimit, *job.Spec.ActiveDeadlineSeconds)
+	}
+
+	pod := job.Spec.Template.Spec
+	if pod.ServiceAccountName != "kfctl-phase" || pod.RestartPolicy != v1.RestartPolicyNever {
+		t.Errorf("Pod spec: got service account %v restart policy %v", pod.ServiceAccountName, pod.RestartPolicy)
+	}
+	container := pod.Containers[0]
+	args := strings.Join(container.Command, " ")
+	for _, want := range []string{"--mode=phase", "--phase=ApplyK8s", "--app-dir=/apps/kf-app", "--phase-applications=jupyter,pipelines"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Command %v doesn't contain %v", args, want)
+		}
+	}
+	if container.Image != c.Image || !reflect.DeepEqual(container.Resources, c.Resources) {
+		t.Errorf("Container: got image %v resources %v", container.Image, container.Resources)
+	}
+	token := container.Env[len(container.Env)-1]
+	if token.Name != PhaseTokenEnv || token.ValueFrom.SecretKeyRef.Name != "kf-app-token" {
+		t.Errorf("Token env: got %+v", token)
+	}
+	if pod.Volumes[0].PersistentVolumeClaim.ClaimName != "apps" ||
+		container.VolumeMounts[0].MountPath != "/apps" || container.VolumeMounts[0].SubPath != "kf-app" {
+		t.Errorf("Volume: got %+v mounted %+v", pod.Volumes[0], container.VolumeMounts[0])
+	}
+}
+
+func TestKfctlServer_RunPhaseInProcess(t *testing.T) {
+	config := DefaultServerConfig()
+	config.PhaseJobs = &PhaseJobConfig{
+		Image:       "gcr.io/kubeflow/bootstrapper:v1",
+		VolumeClaim: "apps",
+		Phases:      []DeploymentPhase{PhaseApplyPlatform},
+	}
+	store, err := newServerConfigStore("", config)
+	if err != nil {
+		t.Fatalf("newServerConfigStore: %v", err)
+	}
+	s := &kfctlServer{config: store}
+
+	// Phases which aren't run as Jobs run in the server.
+	ran := false
+	err = s.runPhase(context.Background(), PhaseGenerate, nil, func() error {
+		ran = true
+		return fmt.Errorf("generate failed")
+	})
+	if !ran || err == nil || err.Error() != "generate failed" {
+		t.Errorf("runPhase of a phase run in the server: got ran %v, %v", ran, err)
+	}
+
+	// Without a token the phase can't run as a Job.
+	ran = false
+	err = s.runPhase(context.Background(), PhaseApplyPlatform, nil, func() error {
+		ran = true
+		return nil
+	})
+	if ran || err == nil {
+		t.Errorf("runPhase of a phase run as a job without a token: got ran %v, %v", ran, err)
+	}
+}
@@ -0,0 +1,340 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	log "github.com/sirupsen/logrus"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KfctlPlanPath is the path on which to serve plan requests
+const KfctlPlanPath = "/kfctl/apps/v1alpha2/plan"
+
+// KfctlExecutePath is the path on which to serve execute requests
+const KfctlExecutePath = "/kfctl/apps/v1alpha2/execute"
+
+// defaultPlanTTL is how long a plan can be executed if the config doesn't set a TTL.
+const defaultPlanTTL = time.Hour
+
+// maxPlanTTL is the largest TTL the config may set.
+const maxPlanTTL = 24 * time.Hour
+
+// processPlanKey signs the plans if the config doesn't set a key. It is generated when the
+// process starts so the plans can only be executed by the process which returned them.
+var processPlanKey = newPlanKey()
+
+// PlanConfig sets the key signing the IDs of the plans, how long they can be executed and whether
+// executing a plan is the only way to create deployments.
+type PlanConfig struct {
+	// Required makes the router reject CreateDeployment and Clone requests so deployments are
+	// only created by executing a plan e.g. one approved by an approval workflow.
+	Required bool `json:"required,omitempty"`
+	// KeyFile holds the secret key signing the plan IDs; at least 32 bytes. Every replica of the
+	// router must use the same key to execute the plans returned by the others. A random key
+	// generated when the process starts is used if it is empty.
+	KeyFile string `json:"keyFile,omitempty"`
+	// TTL is how long a plan can be executed; defaults to an hour and at most 24 hours.
+	TTL metav1.Duration `json:"ttl,omitempty"`
+
+	// key is read from KeyFile by validate.
+	key []byte
+}
+
+// validate returns an error if the config isn't valid, reads the key and sets the defaults.
+func (c *PlanConfig) validate() error {
+	if c.TTL.Duration < 0 || c.TTL.Duration > maxPlanTTL {
+		return fmt.Errorf("plans ttl must be between 0 and %v", maxPlanTTL)
+	}
+	if c.TTL.Duration == 0 {
+		c.TTL.Duration = defaultPlanTTL
+	}
+	if c.KeyFile == "" {
+		return nil
+	}
+	key, err := readSigningKey("plans", c.KeyFile)
+	if err != nil {
+		return err
+	}
+	c.key = key
+	return nil
+}
+
+// planSettings returns the key signing the plans and how long they can be executed with the config c.
+func planSettings(c *PlanConfig) ([]byte, time.Duration) {
+	if c == nil {
+		return processPlanKey, defaultPlanTTL
+	}
+	if c.key == nil {
+		return processPlanKey, c.TTL.Duration
+	}
+	return c.key, c.TTL.Duration
+}
+
+// newPlanKey returns a random key signing the plans.
+func newPlanKey() []byte {
+	key := make([]byte, minSigningKeyBytes)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		log.Fatalf("Could not generate the key signing the plans; %v", err)
+	}
+	return key
+}
+
+// PlanActionType identifies the kind of change made by a PlanAction.
+type PlanActionType string
+
+const (
+	// PlanCreateCloudResource creates or updates a cloud resource e.g. a deployment manager deployment.
+	PlanCreateCloudResource PlanActionType = "CreateCloudResource"
+	// PlanApplyApplication applies the manifests of a Kubeflow application to the cluster.
+	PlanApplyApplication PlanActionType = "ApplyApplication"
+	// PlanIAMChange creates a service account or grants a role.
+	PlanIAMChange PlanActionType = "IAMChange"
+)
+
+// PlanAction is a single change that executing the plan will make.
+type PlanAction struct {
+	Type PlanActionType `json:"type"`
+	// Resource identifies the resource that is changed.
+	Resource    string `json:"resource"`
+	Description string `json:"description,omitempty"`
+}
+
+// DeploymentPlan describes what CreateDeployment would do for a KfDef.
+type DeploymentPlan struct {
+	// ID identifies the plan. It is signed by the service and derived from the KfDef so Execute
+	// can verify the KfDef it is given is the one that was planned and the plan hasn't expired.
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	// Expires is when the plan can no longer be executed.
+	Expires time.Time    `json:"expires"`
+	Actions []PlanAction `json:"actions"`
+}
+
+// ExecuteRequest is a request to run a previously returned plan.
+type ExecuteRequest struct {
+	PlanID string `json:"planId"`
+	// KfDef must be the KfDef the plan was computed for; it also provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+}
+
+// planDigest computes the digest of the KfDef d planned.
+// Secret values, e.g. the access token, and the status don't affect the plan so they are excluded.
+func planDigest(d kfdefs.KfDef) (string, error) {
+	stripped := d.DeepCopy()
+	for i := range stripped.Spec.Secrets {
+		stripped.Spec.Secrets[i].SecretSource = nil
+	}
+
+	buf, err := json.Marshal(struct {
+		Name      string           `json:"name"`
+		Namespace string           `json:"namespace"`
+		Spec      kfdefs.KfDefSpec `json:"spec"`
+	}{
+		Name:      stripped.Name,
+		Namespace: stripped.Namespace,
+		Spec:      stripped.Spec,
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(buf)), nil
+}
+
+// signPlan returns the signature of the plan of the KfDef with the digest expiring at expires.
+func signPlan(key []byte, digest string, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%v\n%v", digest, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// planDeployment computes the plan for d with the config c at now.
+func planDeployment(c *PlanConfig, d kfdefs.KfDef, now time.Time) (*DeploymentPlan, error) {
+	if err := newValidationError("KfDef.Spec is invalid", d.Validate()); err != nil {
+		return nil, err
+	}
+
+	digest, err := planDigest(d)
+	if err != nil {
+		log.Errorf("Could not compute the plan ID; %v", err)
+		return nil, &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+
+	key, ttl := planSettings(c)
+	expires := now.Add(ttl).Unix()
+	p := &DeploymentPlan{
+		ID:      fmt.Sprintf("%v.%v", expires, signPlan(key, digest, expires)),
+		Name:    d.Name,
+		Created: now,
+		Expires: time.Unix(expires, 0),
+		Actions: []PlanAction{},
+	}
+
+	if d.Spec.Platform == gcp.GcpPluginName {
+		p.Actions = append(p.Actions, planGcp(d)...)
+	}
+
+	for _, a := range d.Spec.Applications {
+		p.Actions = append(p.Actions, PlanAction{
+			Type:     PlanApplyApplication,
+			Resource: a.Name,
+		})
+	}
+	return p, nil
+}
+
+// planGcp returns the cloud resource and IAM actions of a deployment on GCP.
+func planGcp(d kfdefs.KfDef) []PlanAction {
+	pluginSpec := &gcp.GcpPluginSpec{}
+	if err := d.GetPluginSpec(gcp.GcpPluginName, pluginSpec); err != nil {
+		log.Warnf("Could not get the gcp plugin; planning with defaults; %v", err)
+	}
+
+	ipName := d.Spec.IpName
+	if ipName == "" {
+		ipName = d.Name + "-ip"
+	}
+
+	actions := []PlanAction{
+		{
+			Type:        PlanCreateCloudResource,
+			Resource:    fmt.Sprintf("deploymentmanager/%v/%v", d.Spec.Project, d.Name),
+			Description: fmt.Sprintf("GKE cluster %v in %v and static IP %v", d.Name, gcp.ClusterLocation(&d), ipName),
+		},
+	}
+
+	if pluginSpec.GetCreatePipelinePersistentStorage() {
+		actions = append(actions, PlanAction{
+			Type:        PlanCreateCloudResource,
+			Resource:    fmt.Sprintf("deploymentmanager/%v/%v-storage", d.Spec.Project, d.Name),
+			Description: "Persistent disks for the pipelines artifact and metadata stores",
+		})
+	}
+
+	switch {
+	case pluginSpec.Endpoint != nil && pluginSpec.Endpoint.DNS != nil:
+		actions = append(actions, PlanAction{
+			Type:        PlanCreateCloudResource,
+			Resource:    fmt.Sprintf("dns/%v/%v", pluginSpec.Endpoint.DNS.ManagedZone, d.Spec.Hostname),
+			Description: fmt.Sprintf("A record for %v pointing at %v", d.Spec.Hostname, ipName),
+		})
+	case !gcp.IsCustomDomain(&d):
+		hostname := d.Spec.Hostname
+		if hostname == "" {
+			hostname = d.Name + ".endpoints." + d.Spec.Project + ".cloud.goog"
+		}
+		actions = append(actions, PlanAction{
+			Type:     PlanCreateCloudResource,
+			Resource: fmt.Sprintf("endpoints/%v", hostname),
+		})
+	}
+
+	for _, suffix := range []string{"admin", "user", "vm"} {
+		actions = append(actions, PlanAction{
+			Type:        PlanIAMChange,
+			Resource:    fmt.Sprintf("serviceAccount:%v-%v@%v.iam.gserviceaccount.com", d.Name, suffix, d.Spec.Project),
+			Description: "Create the service account and grant it the roles in iam_bindings.yaml",
+		})
+	}
+
+	if d.Spec.Email != "" {
+		actions = append(actions, PlanAction{
+			Type:        PlanIAMChange,
+			Resource:    fmt.Sprintf("serviceAccount:%v-%v@%v.iam.gserviceaccount.com", d.Name, gcp.DEPLOYER_SA_SUFFIX, d.Spec.Project),
+			Description: fmt.Sprintf("Create the service account that runs the deployment and allow %v to generate tokens for it", d.Spec.Email),
+		})
+		actions = append(actions, PlanAction{
+			Type:        PlanIAMChange,
+			Resource:    fmt.Sprintf("user:%v", d.Spec.Email),
+			Description: fmt.Sprintf("Grant cluster-admin on cluster %v", d.Name),
+		})
+	}
+	return actions
+}
+
+// verifyPlan checks that req.PlanID was signed with the key of the config c for req.KfDef and
+// hasn't expired at now.
+func verifyPlan(c *PlanConfig, req ExecuteRequest, now time.Time) error {
+	if req.PlanID == "" {
+		return &httpError{
+			Message: "planId is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	pieces := strings.SplitN(req.PlanID, ".", 2)
+	expires, err := strconv.ParseInt(pieces[0], 10, 64)
+	if len(pieces) != 2 || err != nil {
+		return &httpError{
+			Message: fmt.Sprintf("planId %v is malformed", req.PlanID),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	digest, err := planDigest(req.KfDef)
+	if err != nil {
+		return &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+
+	key, _ := planSettings(c)
+	if !hmac.Equal([]byte(signPlan(key, digest, expires)), []byte(pieces[1])) {
+		return &httpError{
+			Message: fmt.Sprintf("The KfDef doesn't match plan %v; it changed since it was planned or the plan wasn't returned by this service. Please plan again.", req.PlanID),
+			Code:    http.StatusConflict,
+		}
+	}
+	if t := time.Unix(expires, 0); !now.Before(t) {
+		return &httpError{
+			Message: fmt.Sprintf("Plan %v expired at %v. Please plan again.", req.PlanID, t.UTC()),
+			Code:    http.StatusConflict,
+		}
+	}
+	return nil
+}
+
+// makePlanEndpoint creates an endpoint to handle plan requests.
+func makePlanEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.Plan(ctx, req)
+	}
+}
+
+// makeExecuteEndpoint creates an endpoint to handle execute requests.
+func makeExecuteEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ExecuteRequest)
+		return svc.Execute(ctx, req)
+	}
+}
+
+// decodeHTTPExecuteRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded ExecuteRequest from the HTTP request body.
+func decodeHTTPExecuteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request ExecuteRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding execute request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPlanTestKfDef() kfdefsv3.KfDef {
+	return kfdefsv3.KfDef{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kf-app",
+		},
+		Spec: kfdefsv3.KfDefSpec{
+			Platform:       gcp.GcpPluginName,
+			PackageManager: "kustomize",
+			Project:        "acme",
+			Zone:           "us-east1-d",
+			Email:          "jlewi@acme.com",
+			Applications: []kfdefsv3.Application{
+				{
+					Name: "jupyter-web-app",
+				},
+				{
+					Name: "iap-ingress",
+				},
+			},
+			Secrets: []kfdefsv3.Secret{
+				{
+					Name: gcp.GcpAccessTokenName,
+					SecretSource: &kfdefsv3.SecretSource{
+						LiteralSource: &kfdefsv3.LiteralSource{
+							Value: "token1",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestPlanDeployment(t *testing.T) {
+	d := newPlanTestKfDef()
+	now := time.Date(2019, time.October, 14, 12, 0, 0, 0, time.UTC)
+	p, err := planDeployment(nil, d, now)
+	if err != nil {
+		t.Fatalf("planDeployment error; %v", err)
+	}
+
+	counts := map[PlanActionType]int{}
+	for _, a := range p.Actions {
+		counts[a.Type]++
+	}
+
+	// The cluster, storage and endpoint.
+	if counts[PlanCreateCloudResource] != 3 {
+		t.Errorf("Got %v cloud resources; want 3:\n%v", counts[PlanCreateCloudResource], PrettyPrint(p))
+	}
+
+	// 3 service accounts, the deployer and the cluster admin binding.
+	if counts[PlanIAMChange] != 5 {
+		t.Errorf("Got %v IAM changes; want 5:\n%v", counts[PlanIAMChange], PrettyPrint(p))
+	}
+
+	if counts[PlanApplyApplication] != 2 {
+		t.Errorf("Got %v applications; want 2:\n%v", counts[PlanApplyApplication], PrettyPrint(p))
+	}
+
+	// A new access token shouldn't invalidate the plan.
+	d.Spec.Secrets[0].SecretSource.LiteralSource.Value = "token2"
+	if err := verifyPlan(nil, ExecuteRequest{PlanID: p.ID, KfDef: d}, now); err != nil {
+		t.Errorf("verifyPlan with a new token; got %v; want nil", err)
+	}
+
+	err = verifyPlan(nil, ExecuteRequest{PlanID: p.ID, KfDef: d}, p.Expires)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("verifyPlan of an expired plan; got %v; want a conflict", err)
+	}
+
+	other := &PlanConfig{TTL: metav1.Duration{Duration: defaultPlanTTL}, key: []byte("another key signing the plans..")}
+	err = verifyPlan(other, ExecuteRequest{PlanID: p.ID, KfDef: d}, now)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("verifyPlan of a plan signed with another key; got %v; want a conflict", err)
+	}
+
+	// The expiry can't be extended without the key.
+	forged := fmt.Sprintf("%v%v", p.Expires.Add(time.Hour).Unix(), p.ID[strings.Index(p.ID, "."):])
+	err = verifyPlan(nil, ExecuteRequest{PlanID: forged, KfDef: d}, now)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("verifyPlan with a forged expiry; got %v; want a conflict", err)
+	}
+
+	d.Spec.Zone = "us-central1-a"
+	err = verifyPlan(nil, ExecuteRequest{PlanID: p.ID, KfDef: d}, now)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("verifyPlan with a changed KfDef; got %v; want a conflict", err)
+	}
+
+	if err := verifyPlan(nil, ExecuteRequest{KfDef: d}, now); err == nil {
+		t.Errorf("verifyPlan without a plan id; want error got nil")
+	}
+	if err := verifyPlan(nil, ExecuteRequest{PlanID: "abc", KfDef: d}, now); err == nil {
+		t.Errorf("verifyPlan with a malformed plan id; want error got nil")
+	}
+}
+
+func TestKfctlRouter_PlanRequired(t *testing.T) {
+	r := newRbacTestRouter(t, map[string]Role{"acme": RoleViewer}, "")
+	c := DefaultServerConfig()
+	c.Plans = &PlanConfig{Required: true}
+	config, err := newServerConfigStore("", c)
+	if err != nil {
+		t.Fatalf("newServerConfigStore: %v", err)
+	}
+	r.config = config
+
+	req := newPlanTestKfDef()
+	p, err := r.Plan(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Viewer couldn't plan the deployment; %v", err)
+	}
+
+	other := newPlanTestKfDef()
+	other.Spec.Project = "other"
+	_, err = r.Plan(context.Background(), other)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusUnauthorized {
+		t.Errorf("Plan without access to the project: want 401; got %v", err)
+	}
+
+	_, err = r.CreateDeployment(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusForbidden {
+		t.Errorf("CreateDeployment when plans are required: want 403; got %v", err)
+	}
+
+	// The plan is accepted; the viewer is then denied creating the deployment.
+	_, err = r.Execute(context.Background(), ExecuteRequest{PlanID: p.ID, KfDef: req})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusForbidden || strings.Contains(hErr.Message, "planned") {
+		t.Errorf("Execute by a viewer: want 403 denying the role; got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeploymentPhase is a step of the pipeline run by the kfctl server to handle a deployment.
+type DeploymentPhase string
+
+const (
+	PhasePending       DeploymentPhase = "Pending"
+	PhaseGenerate      DeploymentPhase = "Generate"
+	PhaseApplyPlatform DeploymentPhase = "ApplyPlatform"
+	PhaseApplyK8s      DeploymentPhase = "ApplyK8s"
+	PhaseDone          DeploymentPhase = "Done"
+	PhaseFailed        DeploymentPhase = "Failed"
+	PhaseCanceled      DeploymentPhase = "Canceled"
+	PhaseDelete        DeploymentPhase = "Delete"
+	// PhaseAbandoned deployments never succeeded and were cleaned up by the garbage collector.
+	PhaseAbandoned DeploymentPhase = "Abandoned"
+)
+
+// Headers used by the kfctl server to report progress to clients.
+const (
+	KfctlPhaseHeader = "X-Kfctl-Phase"
+	// KfctlEtaHeader is the estimated number of seconds until the deployment finishes.
+	KfctlEtaHeader = "X-Kfctl-Eta"
+)
+
+// phaseOrder is the order in which the server runs the phases.
+var phaseOrder = []DeploymentPhase{PhaseGenerate, PhaseApplyPlatform, PhaseApplyK8s}
+
+// expectedPhaseDurations are rough estimates of how long each phase takes on GCP.
+// They are only used to compute an ETA.
+var expectedPhaseDurations = map[DeploymentPhase]time.Duration{
+	PhaseGenerate:      1 * time.Minute,
+	PhaseApplyPlatform: 12 * time.Minute,
+	PhaseApplyK8s:      5 * time.Minute,
+}
+
+// phaseEta estimates the time remaining given the current phase and how long we have been in it.
+func phaseEta(phase DeploymentPhase, elapsed time.Duration) time.Duration {
+	switch phase {
+	case PhaseDone, PhaseFailed, PhaseCanceled, PhaseAbandoned:
+		return 0
+	case PhasePending, "":
+		var total time.Duration
+		for _, p := range phaseOrder {
+			total += expectedPhaseDurations[p]
+		}
+		return total
+	}
+
+	var eta time.Duration
+	found := false
+	for _, p := range phaseOrder {
+		if p == phase {
+			found = true
+			if remaining := expectedPhaseDurations[p] - elapsed; remaining > 0 {
+				eta += remaining
+			}
+			continue
+		}
+		if found {
+			eta += expectedPhaseDurations[p]
+		}
+	}
+	return eta
+}
+
+// ProgressEventType identifies the kind of ProgressEvent.
+type ProgressEventType string
+
+const (
+	// ProgressRetry is emitted when a request failed and will be retried.
+	ProgressRetry ProgressEventType = "Retry"
+	// ProgressPhase is emitted when the server reports the phase of the deployment.
+	ProgressPhase ProgressEventType = "Phase"
+	// ProgressCertificate is emitted by WaitForEndpoint while the managed certificate is provisioned.
+	ProgressCertificate ProgressEventType = "Certificate"
+	// ProgressDeprecation is emitted when the server reports a deprecated field of the request.
+	ProgressDeprecation ProgressEventType = "Deprecation"
+)
+
+// ProgressEvent is reported to the function registered with WithProgressFunc.
+type ProgressEvent struct {
+	Type ProgressEventType
+	// Method is the client method that generated the event e.g. CreateDeployment.
+	Method string
+	Time   time.Time
+
+	// Attempt is the number of the attempt that failed; only set for ProgressRetry.
+	Attempt int
+	// Err is the error that caused the retry; only set for ProgressRetry.
+	Err error
+	// NextRetry is how long the client waits before retrying; only set for ProgressRetry.
+	NextRetry time.Duration
+
+	// Phase is the phase reported by the server; only set for ProgressPhase.
+	Phase DeploymentPhase
+	// ETA is the server's estimate of the time remaining; only set for ProgressPhase and
+	// ProgressCertificate.
+	ETA time.Duration
+
+	// Message describes the provisioning of the certificate or the deprecation; only set for
+	// ProgressCertificate and ProgressDeprecation.
+	Message string
+	// Deprecation is the deprecated field; only set for ProgressDeprecation.
+	Deprecation *Deprecation
+}
+
+// ProgressFunc receives progress events from the KfctlClient.
+type ProgressFunc func(ProgressEvent)
+
+// WithProgressFunc registers a function to be notified of retries, server reported progress and
+// deprecated fields of the requests.
+// The function is called synchronously so it should return quickly.
+func WithProgressFunc(f ProgressFunc) KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.progress = f
+	}
+}
+
+// setProgressHeaders writes the progress headers for the given phase.
+func setProgressHeaders(w http.ResponseWriter, phase DeploymentPhase, elapsed time.Duration) {
+	w.Header().Set(KfctlPhaseHeader, string(phase))
+	w.Header().Set(KfctlEtaHeader, strconv.Itoa(int(phaseEta(phase, elapsed).Seconds())))
+}
+
+// progressKey is the context key of the *forwardedProgress recordProgress stores the progress headers
+// of a response from a kfctl server in.
+type progressKey struct{}
+
+// forwardedProgress holds the progress headers reported by the kfctl server a request was forwarded to.
+type forwardedProgress struct {
+	phase string
+	eta   string
+}
+
+// recordProgress is a ClientResponseFunc storing the progress headers of the response in the
+// context of the request if it has a progressKey.
+func recordProgress(ctx context.Context, r *http.Response) context.Context {
+	p, ok := ctx.Value(progressKey{}).(*forwardedProgress)
+	if !ok {
+		return ctx
+	}
+	if phase := r.Header.Get(KfctlPhaseHeader); phase != "" {
+		p.phase = phase
+		p.eta = r.Header.Get(KfctlEtaHeader)
+	}
+	return ctx
+}
+
+// withForwardedProgress is a ServerRequestFunc letting the router record the progress reported by
+// the kfctl server it forwards the request to.
+func withForwardedProgress(ctx context.Context, _ *http.Request) context.Context {
+	return context.WithValue(ctx, progressKey{}, &forwardedProgress{})
+}
+
+// writeForwardedProgress is a ServerResponseFunc writing the progress headers recorded from the
+// kfctl server the router forwarded the request to, if it reported any.
+func writeForwardedProgress(ctx context.Context, w http.ResponseWriter) context.Context {
+	p, ok := ctx.Value(progressKey{}).(*forwardedProgress)
+	if !ok || p.phase == "" {
+		return ctx
+	}
+	w.Header().Set(KfctlPhaseHeader, p.phase)
+	if p.eta != "" {
+		w.Header().Set(KfctlEtaHeader, p.eta)
+	}
+	return ctx
+}
+
+// writePendingProgress is a ServerResponseFunc reporting the deployment is pending; the router
+// forwards deployments to the kfctl servers in the background so they haven't started yet.
+func writePendingProgress(ctx context.Context, w http.ResponseWriter) context.Context {
+	setProgressHeaders(w, PhasePending, 0)
+	return ctx
+}
+
+// makeProgressResponseFunc returns a ClientResponseFunc that reports the phase headers
+// of responses to f.
+func makeProgressResponseFunc(method string, f ProgressFunc) func(context.Context, *http.Response) context.Context {
+	return func(ctx context.Context, r *http.Response) context.Context {
+		phase := r.Header.Get(KfctlPhaseHeader)
+		if phase == "" {
+			return ctx
+		}
+		e := ProgressEvent{
+			Type:   ProgressPhase,
+			Method: method,
+			Time:   time.Now(),
+			Phase:  DeploymentPhase(phase),
+		}
+		if secs, err := strconv.Atoi(r.Header.Get(KfctlEtaHeader)); err == nil {
+			e.ETA = time.Duration(secs) * time.Second
+		}
+		f(e)
+		return ctx
+	}
+}
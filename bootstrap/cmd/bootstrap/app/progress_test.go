@@ -0,0 +1,155 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cenkalti/backoff"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPhaseEta(t *testing.T) {
+	type testCase struct {
+		phase    DeploymentPhase
+		elapsed  time.Duration
+		expected time.Duration
+	}
+
+	testCases := []testCase{
+		{
+			phase:    PhasePending,
+			expected: 18 * time.Minute,
+		},
+		{
+			phase:    PhaseGenerate,
+			elapsed:  30 * time.Second,
+			expected: 17*time.Minute + 30*time.Second,
+		},
+		{
+			phase:    PhaseApplyPlatform,
+			elapsed:  20 * time.Minute,
+			expected: 5 * time.Minute,
+		},
+		{
+			phase:    PhaseApplyK8s,
+			elapsed:  1 * time.Minute,
+			expected: 4 * time.Minute,
+		},
+		{
+			phase:    PhaseDone,
+			expected: 0,
+		},
+		{
+			phase:    PhaseFailed,
+			expected: 0,
+		},
+	}
+
+	for _, c := range testCases {
+		actual := phaseEta(c.phase, c.elapsed)
+		if actual != c.expected {
+			t.Errorf("phaseEta(%v, %v): got %v; want %v", c.phase, c.elapsed, actual, c.expected)
+		}
+	}
+}
+
+func TestKfctlClient_ProgressEvents(t *testing.T) {
+	svc := &fakeKfctlService{}
+	server := newFakeKfctlServer(svc)
+	defer server.Close()
+
+	// Report progress headers the way kfctlServer does.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setProgressHeaders(w, PhaseApplyK8s, time.Minute)
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	faults := &FaultInjector{
+		Script: []FaultType{FaultServerError, FaultDrop},
+	}
+
+	mu := sync.Mutex{}
+	events := []ProgressEvent{}
+
+	c, err := NewKfctlClient(proxy.URL,
+		WithHTTPClient(&http.Client{Transport: faults.Transport(nil)}),
+		WithRetryBackOff(func() backoff.BackOff {
+			return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+		}),
+		WithProgressFunc(func(e ProgressEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}))
+
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+
+	if _, err := c.CreateDeployment(context.Background(), kfdefsv3.KfDef{}); err != nil {
+		t.Fatalf("CreateDeployment error; %v", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Got %v events; want 3:\n%v", len(events), PrettyPrint(events))
+	}
+
+	for i, e := range events[0:2] {
+		if e.Type != ProgressRetry || e.Attempt != i+1 || e.Err == nil {
+			t.Errorf("Event %v: want retry event for attempt %v; got %+v", i, i+1, e)
+		}
+	}
+
+	last := events[2]
+	if last.Type != ProgressPhase || last.Phase != PhaseApplyK8s || last.ETA != 4*time.Minute {
+		t.Errorf("Want phase event for %v with ETA 4m; got %+v", PhaseApplyK8s, last)
+	}
+
+	if last.Method != "CreateDeployment" {
+		t.Errorf("Got method %v; want CreateDeployment", last.Method)
+	}
+}
+
+func TestKfctlRouter_ForwardsProgress(t *testing.T) {
+	// Report progress headers the way kfctlServer does.
+	mux := http.NewServeMux()
+	mux.Handle(KfctlGetpath, httptransport.NewServer(makeServerStatusRequestEndpoint(&fakeKfctlService{}), decodeHTTPKfdefRequest, encodeResponse,
+		httptransport.ServerAfter(func(ctx context.Context, w http.ResponseWriter) context.Context {
+			setProgressHeaders(w, PhaseApplyK8s, time.Minute)
+			return ctx
+		})))
+	backend := httptest.NewServer(mux)
+	defer backend.Close()
+
+	r := newRbacTestRouter(t, map[string]Role{"acme": RoleViewer}, "")
+	r.address = func(name string) string {
+		return backend.URL
+	}
+
+	body, err := json.Marshal(newPlanTestKfDef())
+	if err != nil {
+		t.Fatalf("Could not encode the request; %v", err)
+	}
+	w := httptest.NewRecorder()
+	r.statusHandler().ServeHTTP(w, httptest.NewRequest("POST", KfctlGetpath, bytes.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got status %v; want 200: %v", w.Code, w.Body.String())
+	}
+	if phase, eta := w.Header().Get(KfctlPhaseHeader), w.Header().Get(KfctlEtaHeader); phase != string(PhaseApplyK8s) || eta != "240" {
+		t.Errorf("Got phase %v ETA %v; want the %v 240 reported by the backend", phase, eta, PhaseApplyK8s)
+	}
+
+	w = httptest.NewRecorder()
+	writePendingProgress(context.Background(), w)
+	if phase := w.Header().Get(KfctlPhaseHeader); phase != string(PhasePending) {
+		t.Errorf("Got phase %v for a forwarded deployment; want %v", phase, PhasePending)
+	}
+}
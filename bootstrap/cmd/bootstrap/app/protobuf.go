@@ -0,0 +1,1537 @@
+package app
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sort"
+	"time"
+)
+
+// The protobuf encoding of KfDef is hand written since KfDef doesn't have generated protobuf code.
+// The schema is below; field numbers must never be reused. ObjectMeta, Time and the core/v1 types
+// use the encoding generated by apimachinery. Plugin specs are carried as the raw JSON bytes of the RawExtension so
+// their values are never reinterpreted e.g. integers don't become floats.
+//
+//	message KfDef {
+//	  string apiVersion = 1;
+//	  string kind = 2;
+//	  k8s.io.apimachinery.pkg.apis.meta.v1.ObjectMeta metadata = 3;
+//	  KfDefSpec spec = 4;
+//	  KfDefStatus status = 5;
+//	}
+//
+//	message KfDefSpec {
+//	  string repo = 1;
+//	  repeated string components = 2;
+//	  repeated string packages = 3;
+//	  repeated ComponentParams componentParams = 4;
+//	  string platform = 5;
+//	  string appdir = 6;
+//	  string version = 7;
+//	  bool mountLocal = 8;
+//	  string project = 9;
+//	  string email = 10;
+//	  string ipName = 11;
+//	  string hostname = 12;
+//	  string zone = 13;
+//	  bool useBasicAuth = 14;
+//	  bool skipInitProject = 15;
+//	  bool useIstio = 16;
+//	  bool enableApplications = 17;
+//	  string serverVersion = 18;
+//	  bool deleteStorage = 19;
+//	  string packageManager = 20;
+//	  repeated Repo repos = 21;
+//	  repeated Secret secrets = 22;
+//	  repeated Plugin plugins = 23;
+//	  repeated Application applications = 24;
+//	  string adoptionPolicy = 25;
+//	  NamespaceLayout namespaces = 26;
+//	  k8s.io.api.core.v1.ResourceQuotaSpec resourceQuota = 27;
+//	  k8s.io.api.core.v1.LimitRangeSpec limitRange = 28;
+//	  string region = 29;
+//	  repeated WorkloadPlacement placements = 30;
+//	  repeated string admins = 31;
+//	  repeated TeamProfile profiles = 32;
+//	  repeated Hook hooks = 33;
+//	  repeated string features = 34;
+//	  repeated string manifestSinks = 35;
+//	  IstioConfig istio = 36;
+//	  bool reportUsage = 37;
+//	  InstanceScope instance = 38;
+//	  string caBundle = 39;
+//	  ManifestSigning manifestSigning = 40;
+//	  ExternalStorage externalStorage = 41;
+//	  ExistingPlatform existingPlatform = 42;
+//	  GpuConfig gpu = 43;
+//	  repeated KustomizeTransformer transformers = 44;
+//	  repeated MaintenanceWindow maintenanceWindows = 45;
+//	}
+//
+//	message ComponentParams { string component = 1; repeated NameValue parameters = 2; }
+//	message NameValue { string name = 1; string value = 2; bool initRequired = 3; }
+//	message Repo { string name = 1; string uri = 2; string root = 3; }
+//	message Secret { string name = 1; SecretSource secretSource = 2; }
+//	message SecretSource { Value literalSource = 1; Value hashedSource = 2; Value envSource = 3; }
+//	message Value { string value = 1; }
+//	message Plugin { string name = 1; bytes spec = 2; }
+//	message Application { string name = 1; KustomizeConfig kustomizeConfig = 2; Readiness readiness = 3; }
+//	message KustomizeConfig { RepoRef repoRef = 1; repeated string overlays = 2; repeated NameValue parameters = 3; }
+//	message RepoRef { string name = 1; string path = 2; }
+//	message Readiness { repeated ReadinessCheck checks = 1; int64 timeoutSeconds = 2; }
+//	message ReadinessCheck { string deployment = 1; string job = 2; string namespace = 3; string url = 4; }
+//	message NamespaceLayout { string istio = 1; string knative = 2; }
+//	message WorkloadPlacement {
+//	  string name = 1;
+//	  repeated string applications = 2;
+//	  map<string, string> nodeSelector = 3;
+//	  repeated k8s.io.api.core.v1.Toleration tolerations = 4;
+//	}
+//	message TeamProfile { string name = 1; string owner = 2; repeated ProfileContributor contributors = 3; }
+//	message ProfileContributor { string user = 1; string role = 2; }
+//	message Hook {
+//	  string name = 1;
+//	  string phase = 2;
+//	  WebhookHook webhook = 3;
+//	  k8s.io.api.batch.v1.JobSpec job = 4;
+//	  int64 timeoutSeconds = 5;
+//	}
+//	message WebhookHook { string url = 1; }
+//	message IstioConfig { string mtls = 1; string ingressGatewayType = 2; repeated string injectionNamespaces = 3; }
+//	message InstanceScope { string namePrefix = 1; string ingressGateway = 2; string crdStrategy = 3; }
+//	message ManifestSigning { string keySecret = 1; }
+//	message ExternalStorage { ExternalDatabase database = 1; ExternalObjectStore objectStore = 2; }
+//	message ExternalDatabase {
+//	  string host = 1;
+//	  int32 port = 2;
+//	  string user = 3;
+//	  string passwordSecret = 4;
+//	  CloudSQLInstance cloudSQL = 5;
+//	}
+//	message CloudSQLInstance { string name = 1; string tier = 2; }
+//	message ExternalObjectStore {
+//	  string endpoint = 1;
+//	  string bucket = 2;
+//	  bool insecure = 3;
+//	  string accessKeySecret = 4;
+//	  string secretKeySecret = 5;
+//	  bool createBucket = 6;
+//	}
+//	message ExistingPlatform { string mode = 1; map<string, string> ingressGatewaySelector = 2; }
+//	message GpuConfig {
+//	  map<string, string> nodeSelector = 1;
+//	  GpuDriver driver = 2;
+//	  GpuDevicePlugin devicePlugin = 3;
+//	  map<string, string> nodeLabels = 4;
+//	}
+//	message GpuDriver { string nodeOS = 1; string image = 2; string version = 3; }
+//	message GpuDevicePlugin { string image = 1; }
+//	message KustomizeTransformer {
+//	  string name = 1;
+//	  repeated string applications = 2;
+//	  string namePrefix = 3;
+//	  map<string, string> commonLabels = 4;
+//	  repeated FieldReplacement replacements = 5;
+//	}
+//	message FieldReplacement {
+//	  string group = 1;
+//	  string version = 2;
+//	  string kind = 3;
+//	  string name = 4;
+//	  string namespace = 5;
+//	  string path = 6;
+//	  bytes value = 7;
+//	}
+//	// duration is in nanoseconds.
+//	message MaintenanceWindow { repeated string days = 1; string start = 2; int64 duration = 3; string timeZone = 4; }
+//
+//	message KfDefStatus {
+//	  repeated KfDefCondition conditions = 1;
+//	  repeated RepoCache reposCache = 2;
+//	  repeated ApplicationStatus applications = 3;
+//	  string clusterVersion = 4;
+//	  string zone = 5;
+//	  repeated ManifestSignature manifestSignatures = 6;
+//	  repeated InventoryResource inventory = 7;
+//	  CertificateStatus certificate = 8;
+//	}
+//
+//	message KfDefCondition {
+//	  string type = 1;
+//	  string status = 2;
+//	  string reason = 4;
+//	  string message = 5;
+//	  k8s.io.apimachinery.pkg.apis.meta.v1.Time lastUpdateTime = 6;
+//	  k8s.io.apimachinery.pkg.apis.meta.v1.Time lastTransitionTime = 7;
+//	}
+//
+//	message RepoCache { string name = 1; string localPath = 2; }
+//	message ApplicationStatus { string name = 1; string state = 2; string message = 3; k8s.io.apimachinery.pkg.apis.meta.v1.Time lastUpdateTime = 4; }
+//	message ManifestSignature {
+//	  string application = 1;
+//	  string digest = 2;
+//	  string signature = 3;
+//	  k8s.io.apimachinery.pkg.apis.meta.v1.Time signedTime = 4;
+//	}
+//	message InventoryResource {
+//	  string kind = 1;
+//	  string apiVersion = 2;
+//	  string name = 3;
+//	  string namespace = 4;
+//	  string project = 5;
+//	  string source = 6;
+//	  k8s.io.apimachinery.pkg.apis.meta.v1.Time creationTime = 7;
+//	}
+//	message CertificateStatus {
+//	  string name = 1;
+//	  repeated string domains = 2;
+//	  string state = 3;
+//	  k8s.io.apimachinery.pkg.apis.meta.v1.Time creationTime = 4;
+//	  k8s.io.apimachinery.pkg.apis.meta.v1.Time expectedReadyTime = 5;
+//	}
+//
+// Every field of KfDef must be in the schema; TestKfDefProtoCoversKfDef fails otherwise.
+
+// Protobuf wire types used by the encoding.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// pbWriter appends protobuf fields to a buffer. Zero values are omitted as in proto3.
+// err records the first error encountered; once set the buffer shouldn't be used.
+type pbWriter struct {
+	buf []byte
+	err error
+}
+
+func (w *pbWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *pbWriter) tag(field int, wire int) {
+	w.varint(uint64(field<<3 | wire))
+}
+
+func (w *pbWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf = append(w.buf, b[:n]...)
+}
+
+func (w *pbWriter) bytes(field int, b []byte) {
+	w.tag(field, wireBytes)
+	w.varint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *pbWriter) str(field int, s string) {
+	if s == "" {
+		return
+	}
+	w.bytes(field, []byte(s))
+}
+
+func (w *pbWriter) strs(field int, s []string) {
+	for _, v := range s {
+		w.bytes(field, []byte(v))
+	}
+}
+
+func (w *pbWriter) boolean(field int, v bool) {
+	if !v {
+		return
+	}
+	w.tag(field, wireVarint)
+	w.varint(1)
+}
+
+func (w *pbWriter) integer(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	w.tag(field, wireVarint)
+	w.varint(uint64(v))
+}
+
+// stringMap writes the entries of m sorted by key so the encoding is deterministic.
+func (w *pbWriter) stringMap(field int, m map[string]string) {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		k := k
+		w.message(field, func(w *pbWriter) {
+			w.str(1, k)
+			w.str(2, m[k])
+		})
+	}
+}
+
+// message writes the nested message written by f. It is always written so a nil pointer
+// can be distinguished from a pointer to an empty message.
+func (w *pbWriter) message(field int, f func(w *pbWriter)) {
+	nested := &pbWriter{}
+	f(nested)
+	if nested.err != nil {
+		w.fail(nested.err)
+	}
+	w.bytes(field, nested.buf)
+}
+
+// time writes t using the encoding generated by apimachinery; the zero time is omitted.
+func (w *pbWriter) time(field int, t metav1.Time) {
+	if t.IsZero() {
+		return
+	}
+	b, err := t.Marshal()
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	w.bytes(field, b)
+}
+
+// readFields calls f with the number and value of each field in b.
+// For varint fields value is nil and v is set; for length delimited fields value is the contents.
+func readFields(b []byte, f func(field int, v uint64, value []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("invalid protobuf field key")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint in field %v", field)
+			}
+			b = b[n:]
+			if err := f(field, v, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return fmt.Errorf("invalid length of field %v", field)
+			}
+			value := b[n : n+int(l)]
+			b = b[n+int(l):]
+			if err := f(field, 0, value); err != nil {
+				return err
+			}
+		case 1:
+			// Fixed 64 bit fields aren't used; skip them so newer encodings can be read.
+			if len(b) < 8 {
+				return fmt.Errorf("invalid fixed64 in field %v", field)
+			}
+			b = b[8:]
+		case 5:
+			if len(b) < 4 {
+				return fmt.Errorf("invalid fixed32 in field %v", field)
+			}
+			b = b[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %v in field %v", key&7, field)
+		}
+	}
+	return nil
+}
+
+// marshalKfDefProto returns the protobuf encoding of d.
+func marshalKfDefProto(d *kfdefs.KfDef) ([]byte, error) {
+	w := &pbWriter{}
+	w.str(1, d.APIVersion)
+	w.str(2, d.Kind)
+	meta, err := d.ObjectMeta.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	w.bytes(3, meta)
+	w.message(4, func(w *pbWriter) { writeKfDefSpec(w, &d.Spec) })
+	w.message(5, func(w *pbWriter) { writeKfDefStatus(w, &d.Status) })
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf, nil
+}
+
+func writeNameValues(w *pbWriter, field int, params []config.NameValue) {
+	for _, p := range params {
+		p := p
+		w.message(field, func(w *pbWriter) {
+			w.str(1, p.Name)
+			w.str(2, p.Value)
+			w.boolean(3, p.InitRequired)
+		})
+	}
+}
+
+func writeKfDefSpec(w *pbWriter, s *kfdefs.KfDefSpec) {
+	w.str(1, s.Repo)
+	w.strs(2, s.Components)
+	w.strs(3, s.Packages)
+
+	// Sort the components so the encoding is deterministic.
+	components := []string{}
+	for c := range s.ComponentParams {
+		components = append(components, c)
+	}
+	sort.Strings(components)
+	for _, c := range components {
+		c := c
+		w.message(4, func(w *pbWriter) {
+			w.str(1, c)
+			writeNameValues(w, 2, s.ComponentParams[c])
+		})
+	}
+
+	w.str(5, s.Platform)
+	w.str(6, s.AppDir)
+	w.str(7, s.Version)
+	w.boolean(8, s.MountLocal)
+	w.str(9, s.Project)
+	w.str(10, s.Email)
+	w.str(11, s.IpName)
+	w.str(12, s.Hostname)
+	w.str(13, s.Zone)
+	w.boolean(14, s.UseBasicAuth)
+	w.boolean(15, s.SkipInitProject)
+	w.boolean(16, s.UseIstio)
+	w.boolean(17, s.EnableApplications)
+	w.str(18, s.ServerVersion)
+	w.boolean(19, s.DeleteStorage)
+	w.str(20, s.PackageManager)
+
+	for _, r := range s.Repos {
+		r := r
+		w.message(21, func(w *pbWriter) {
+			w.str(1, r.Name)
+			w.str(2, r.Uri)
+			w.str(3, r.Root)
+		})
+	}
+
+	for _, secret := range s.Secrets {
+		secret := secret
+		w.message(22, func(w *pbWriter) {
+			w.str(1, secret.Name)
+			src := secret.SecretSource
+			if src == nil {
+				return
+			}
+			w.message(2, func(w *pbWriter) {
+				if src.LiteralSource != nil {
+					w.message(1, func(w *pbWriter) { w.str(1, src.LiteralSource.Value) })
+				}
+				if src.HashedSource != nil {
+					w.message(2, func(w *pbWriter) { w.str(1, src.HashedSource.HashedValue) })
+				}
+				if src.EnvSource != nil {
+					w.message(3, func(w *pbWriter) { w.str(1, src.EnvSource.Name) })
+				}
+			})
+		})
+	}
+
+	for _, p := range s.Plugins {
+		p := p
+		w.message(23, func(w *pbWriter) {
+			w.str(1, p.Name)
+			if p.Spec == nil {
+				return
+			}
+			if p.Spec.Raw == nil && p.Spec.Object != nil {
+				w.fail(fmt.Errorf("plugin %v: spec must be raw JSON to be encoded as protobuf", p.Name))
+				return
+			}
+			w.bytes(2, p.Spec.Raw)
+		})
+	}
+
+	for _, a := range s.Applications {
+		a := a
+		w.message(24, func(w *pbWriter) {
+			w.str(1, a.Name)
+			if k := a.KustomizeConfig; k != nil {
+				w.message(2, func(w *pbWriter) {
+					if k.RepoRef != nil {
+						w.message(1, func(w *pbWriter) {
+							w.str(1, k.RepoRef.Name)
+							w.str(2, k.RepoRef.Path)
+						})
+					}
+					w.strs(2, k.Overlays)
+					writeNameValues(w, 3, k.Parameters)
+				})
+			}
+			if r := a.Readiness; r != nil {
+				w.message(3, func(w *pbWriter) {
+					for _, c := range r.Checks {
+						c := c
+						w.message(1, func(w *pbWriter) {
+							w.str(1, c.Deployment)
+							w.str(2, c.Job)
+							w.str(3, c.Namespace)
+							w.str(4, c.URL)
+						})
+					}
+					w.integer(2, r.TimeoutSeconds)
+				})
+			}
+		})
+	}
+
+	w.str(25, string(s.AdoptionPolicy))
+
+	if n := s.Namespaces; n != nil {
+		w.message(26, func(w *pbWriter) {
+			w.str(1, n.Istio)
+			w.str(2, n.Knative)
+		})
+	}
+
+	if s.ResourceQuota != nil {
+		b, err := s.ResourceQuota.Marshal()
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		w.bytes(27, b)
+	}
+
+	if s.LimitRange != nil {
+		b, err := s.LimitRange.Marshal()
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		w.bytes(28, b)
+	}
+
+	w.str(29, s.Region)
+
+	for _, p := range s.Placements {
+		p := p
+		w.message(30, func(w *pbWriter) {
+			w.str(1, p.Name)
+			w.strs(2, p.Applications)
+			w.stringMap(3, p.NodeSelector)
+			for _, t := range p.Tolerations {
+				b, err := t.Marshal()
+				if err != nil {
+					w.fail(err)
+					return
+				}
+				w.bytes(4, b)
+			}
+		})
+	}
+
+	w.strs(31, s.Admins)
+
+	for _, p := range s.Profiles {
+		p := p
+		w.message(32, func(w *pbWriter) {
+			w.str(1, p.Name)
+			w.str(2, p.Owner)
+			for _, c := range p.Contributors {
+				c := c
+				w.message(3, func(w *pbWriter) {
+					w.str(1, c.User)
+					w.str(2, string(c.Role))
+				})
+			}
+		})
+	}
+
+	for _, h := range s.Hooks {
+		h := h
+		w.message(33, func(w *pbWriter) {
+			w.str(1, h.Name)
+			w.str(2, string(h.Phase))
+			if h.Webhook != nil {
+				w.message(3, func(w *pbWriter) {
+					w.str(1, h.Webhook.URL)
+				})
+			}
+			if h.Job != nil {
+				b, err := h.Job.Marshal()
+				if err != nil {
+					w.fail(err)
+					return
+				}
+				w.bytes(4, b)
+			}
+			w.integer(5, h.TimeoutSeconds)
+		})
+	}
+
+	w.strs(34, s.Features)
+	w.strs(35, s.ManifestSinks)
+
+	if i := s.Istio; i != nil {
+		w.message(36, func(w *pbWriter) {
+			w.str(1, string(i.MTLS))
+			w.str(2, string(i.IngressGatewayType))
+			w.strs(3, i.InjectionNamespaces)
+		})
+	}
+	w.boolean(37, s.ReportUsage)
+
+	if i := s.Instance; i != nil {
+		w.message(38, func(w *pbWriter) {
+			w.str(1, i.NamePrefix)
+			w.str(2, i.IngressGateway)
+			w.str(3, string(i.CRDStrategy))
+		})
+	}
+	w.str(39, s.CABundle)
+	if m := s.ManifestSigning; m != nil {
+		w.message(40, func(w *pbWriter) { w.str(1, m.KeySecret) })
+	}
+	if e := s.ExternalStorage; e != nil {
+		w.message(41, func(w *pbWriter) { writeExternalStorage(w, e) })
+	}
+	if e := s.ExistingPlatform; e != nil {
+		w.message(42, func(w *pbWriter) {
+			w.str(1, string(e.Mode))
+			w.stringMap(2, e.IngressGatewaySelector)
+		})
+	}
+	if g := s.Gpu; g != nil {
+		w.message(43, func(w *pbWriter) { writeGpuConfig(w, g) })
+	}
+	for _, t := range s.Transformers {
+		t := t
+		w.message(44, func(w *pbWriter) { writeTransformer(w, &t) })
+	}
+	for _, m := range s.MaintenanceWindows {
+		m := m
+		w.message(45, func(w *pbWriter) {
+			w.strs(1, m.Days)
+			w.str(2, m.Start)
+			w.integer(3, int64(m.Duration.Duration))
+			w.str(4, m.TimeZone)
+		})
+	}
+}
+
+func writeExternalStorage(w *pbWriter, e *kfdefs.ExternalStorage) {
+	if d := e.Database; d != nil {
+		w.message(1, func(w *pbWriter) {
+			w.str(1, d.Host)
+			w.integer(2, int64(d.Port))
+			w.str(3, d.User)
+			w.str(4, d.PasswordSecret)
+			if c := d.CloudSQL; c != nil {
+				w.message(5, func(w *pbWriter) {
+					w.str(1, c.Name)
+					w.str(2, c.Tier)
+				})
+			}
+		})
+	}
+	if o := e.ObjectStore; o != nil {
+		w.message(2, func(w *pbWriter) {
+			w.str(1, o.Endpoint)
+			w.str(2, o.Bucket)
+			w.boolean(3, o.Insecure)
+			w.str(4, o.AccessKeySecret)
+			w.str(5, o.SecretKeySecret)
+			w.boolean(6, o.CreateBucket)
+		})
+	}
+}
+
+func writeGpuConfig(w *pbWriter, g *kfdefs.GpuConfig) {
+	w.stringMap(1, g.NodeSelector)
+	if d := g.Driver; d != nil {
+		w.message(2, func(w *pbWriter) {
+			w.str(1, string(d.NodeOS))
+			w.str(2, d.Image)
+			w.str(3, d.Version)
+		})
+	}
+	if p := g.DevicePlugin; p != nil {
+		w.message(3, func(w *pbWriter) { w.str(1, p.Image) })
+	}
+	w.stringMap(4, g.NodeLabels)
+}
+
+func writeTransformer(w *pbWriter, t *kfdefs.KustomizeTransformer) {
+	w.str(1, t.Name)
+	w.strs(2, t.Applications)
+	w.str(3, t.NamePrefix)
+	w.stringMap(4, t.CommonLabels)
+	for _, r := range t.Replacements {
+		r := r
+		w.message(5, func(w *pbWriter) {
+			w.str(1, r.Group)
+			w.str(2, r.Version)
+			w.str(3, r.Kind)
+			w.str(4, r.Name)
+			w.str(5, r.Namespace)
+			w.str(6, r.Path)
+			// Like plugin specs the value is carried as raw JSON.
+			if r.Value.Raw == nil && r.Value.Object != nil {
+				w.fail(fmt.Errorf("transformer %v: replacement values must be raw JSON to be encoded as protobuf", t.Name))
+				return
+			}
+			if r.Value.Raw != nil {
+				w.bytes(7, r.Value.Raw)
+			}
+		})
+	}
+}
+
+func writeKfDefStatus(w *pbWriter, s *kfdefs.KfDefStatus) {
+	for _, c := range s.Conditions {
+		c := c
+		w.message(1, func(w *pbWriter) {
+			w.str(1, string(c.Type))
+			w.str(2, string(c.Status))
+			w.str(4, c.Reason)
+			w.str(5, c.Message)
+			w.time(6, c.LastUpdateTime)
+			w.time(7, c.LastTransitionTime)
+		})
+	}
+
+	// Sort the repos so the encoding is deterministic.
+	names := []string{}
+	for n := range s.ReposCache {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		n := n
+		w.message(2, func(w *pbWriter) {
+			w.str(1, n)
+			w.str(2, s.ReposCache[n].LocalPath)
+		})
+	}
+
+	for _, a := range s.Applications {
+		a := a
+		w.message(3, func(w *pbWriter) {
+			w.str(1, a.Name)
+			w.str(2, string(a.State))
+			w.str(3, a.Message)
+			w.time(4, a.LastUpdateTime)
+		})
+	}
+	w.str(4, s.ClusterVersion)
+	w.str(5, s.Zone)
+
+	for _, m := range s.ManifestSignatures {
+		m := m
+		w.message(6, func(w *pbWriter) {
+			w.str(1, m.Application)
+			w.str(2, m.Digest)
+			w.str(3, m.Signature)
+			w.time(4, m.SignedTime)
+		})
+	}
+
+	for _, r := range s.Inventory {
+		r := r
+		w.message(7, func(w *pbWriter) {
+			w.str(1, r.Kind)
+			w.str(2, r.APIVersion)
+			w.str(3, r.Name)
+			w.str(4, r.Namespace)
+			w.str(5, r.Project)
+			w.str(6, r.Source)
+			w.time(7, r.CreationTime)
+		})
+	}
+
+	if c := s.Certificate; c != nil {
+		w.message(8, func(w *pbWriter) {
+			w.str(1, c.Name)
+			w.strs(2, c.Domains)
+			w.str(3, c.State)
+			w.time(4, c.CreationTime)
+			w.time(5, c.ExpectedReadyTime)
+		})
+	}
+}
+
+// unmarshalKfDefProto decodes the protobuf encoding of a KfDef into d.
+// Unknown fields are ignored so older servers and clients can read newer encodings.
+func unmarshalKfDefProto(b []byte, d *kfdefs.KfDef) error {
+	return readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			d.APIVersion = string(value)
+		case 2:
+			d.Kind = string(value)
+		case 3:
+			return d.ObjectMeta.Unmarshal(value)
+		case 4:
+			return readKfDefSpec(value, &d.Spec)
+		case 5:
+			return readKfDefStatus(value, &d.Status)
+		}
+		return nil
+	})
+}
+
+func readNameValue(b []byte) (config.NameValue, error) {
+	p := config.NameValue{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			p.Name = string(value)
+		case 2:
+			p.Value = string(value)
+		case 3:
+			p.InitRequired = v != 0
+		}
+		return nil
+	})
+	return p, err
+}
+
+// readStringMapEntry adds the map entry b to *m, creating the map if it is nil.
+func readStringMapEntry(b []byte, m *map[string]string) error {
+	var key, val string
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			key = string(value)
+		case 2:
+			val = string(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	(*m)[key] = val
+	return nil
+}
+
+func readValue(b []byte) (string, error) {
+	s := ""
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		if field == 1 {
+			s = string(value)
+		}
+		return nil
+	})
+	return s, err
+}
+
+func readKfDefSpec(b []byte, s *kfdefs.KfDefSpec) error {
+	return readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			s.Repo = string(value)
+		case 2:
+			s.Components = append(s.Components, string(value))
+		case 3:
+			s.Packages = append(s.Packages, string(value))
+		case 4:
+			component := ""
+			params := []config.NameValue{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					component = string(value)
+				case 2:
+					p, err := readNameValue(value)
+					if err != nil {
+						return err
+					}
+					params = append(params, p)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if s.ComponentParams == nil {
+				s.ComponentParams = config.Parameters{}
+			}
+			s.ComponentParams[component] = params
+		case 5:
+			s.Platform = string(value)
+		case 6:
+			s.AppDir = string(value)
+		case 7:
+			s.Version = string(value)
+		case 8:
+			s.MountLocal = v != 0
+		case 9:
+			s.Project = string(value)
+		case 10:
+			s.Email = string(value)
+		case 11:
+			s.IpName = string(value)
+		case 12:
+			s.Hostname = string(value)
+		case 13:
+			s.Zone = string(value)
+		case 14:
+			s.UseBasicAuth = v != 0
+		case 15:
+			s.SkipInitProject = v != 0
+		case 16:
+			s.UseIstio = v != 0
+		case 17:
+			s.EnableApplications = v != 0
+		case 18:
+			s.ServerVersion = string(value)
+		case 19:
+			s.DeleteStorage = v != 0
+		case 20:
+			s.PackageManager = string(value)
+		case 21:
+			r := kfdefs.Repo{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					r.Name = string(value)
+				case 2:
+					r.Uri = string(value)
+				case 3:
+					r.Root = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.Repos = append(s.Repos, r)
+		case 22:
+			secret, err := readSecret(value)
+			if err != nil {
+				return err
+			}
+			s.Secrets = append(s.Secrets, secret)
+		case 23:
+			p := kfdefs.Plugin{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					p.Name = string(value)
+				case 2:
+					p.Spec = &runtime.RawExtension{Raw: append([]byte{}, value...)}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.Plugins = append(s.Plugins, p)
+		case 24:
+			a, err := readApplication(value)
+			if err != nil {
+				return err
+			}
+			s.Applications = append(s.Applications, a)
+		case 25:
+			s.AdoptionPolicy = kfdefs.AdoptionPolicy(value)
+		case 26:
+			n := &kfdefs.NamespaceLayout{}
+			s.Namespaces = n
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					n.Istio = string(value)
+				case 2:
+					n.Knative = string(value)
+				}
+				return nil
+			})
+		case 27:
+			s.ResourceQuota = &v1.ResourceQuotaSpec{}
+			return s.ResourceQuota.Unmarshal(value)
+		case 28:
+			s.LimitRange = &v1.LimitRangeSpec{}
+			return s.LimitRange.Unmarshal(value)
+		case 29:
+			s.Region = string(value)
+		case 30:
+			p, err := readPlacement(value)
+			if err != nil {
+				return err
+			}
+			s.Placements = append(s.Placements, p)
+		case 31:
+			s.Admins = append(s.Admins, string(value))
+		case 32:
+			p, err := readTeamProfile(value)
+			if err != nil {
+				return err
+			}
+			s.Profiles = append(s.Profiles, p)
+		case 33:
+			h, err := readHook(value)
+			if err != nil {
+				return err
+			}
+			s.Hooks = append(s.Hooks, h)
+		case 34:
+			s.Features = append(s.Features, string(value))
+		case 35:
+			s.ManifestSinks = append(s.ManifestSinks, string(value))
+		case 36:
+			i := &kfdefs.IstioConfig{}
+			s.Istio = i
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					i.MTLS = kfdefs.IstioMTLSMode(value)
+				case 2:
+					i.IngressGatewayType = v1.ServiceType(value)
+				case 3:
+					i.InjectionNamespaces = append(i.InjectionNamespaces, string(value))
+				}
+				return nil
+			})
+		case 37:
+			s.ReportUsage = v != 0
+		case 38:
+			i := &kfdefs.InstanceScope{}
+			s.Instance = i
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					i.NamePrefix = string(value)
+				case 2:
+					i.IngressGateway = string(value)
+				case 3:
+					i.CRDStrategy = kfdefs.CRDStrategy(value)
+				}
+				return nil
+			})
+		case 39:
+			s.CABundle = string(value)
+		case 40:
+			m := &kfdefs.ManifestSigning{}
+			s.ManifestSigning = m
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				if field == 1 {
+					m.KeySecret = string(value)
+				}
+				return nil
+			})
+		case 41:
+			s.ExternalStorage = &kfdefs.ExternalStorage{}
+			return readExternalStorage(value, s.ExternalStorage)
+		case 42:
+			e := &kfdefs.ExistingPlatform{}
+			s.ExistingPlatform = e
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					e.Mode = kfdefs.ExistingPlatformMode(value)
+				case 2:
+					return readStringMapEntry(value, &e.IngressGatewaySelector)
+				}
+				return nil
+			})
+		case 43:
+			s.Gpu = &kfdefs.GpuConfig{}
+			return readGpuConfig(value, s.Gpu)
+		case 44:
+			t, err := readTransformer(value)
+			if err != nil {
+				return err
+			}
+			s.Transformers = append(s.Transformers, t)
+		case 45:
+			m := kfdefs.MaintenanceWindow{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					m.Days = append(m.Days, string(value))
+				case 2:
+					m.Start = string(value)
+				case 3:
+					m.Duration.Duration = time.Duration(int64(v))
+				case 4:
+					m.TimeZone = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.MaintenanceWindows = append(s.MaintenanceWindows, m)
+		}
+		return nil
+	})
+}
+
+func readExternalStorage(b []byte, e *kfdefs.ExternalStorage) error {
+	return readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			d := &kfdefs.ExternalDatabase{}
+			e.Database = d
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					d.Host = string(value)
+				case 2:
+					d.Port = int32(v)
+				case 3:
+					d.User = string(value)
+				case 4:
+					d.PasswordSecret = string(value)
+				case 5:
+					c := &kfdefs.CloudSQLInstance{}
+					d.CloudSQL = c
+					return readFields(value, func(field int, v uint64, value []byte) error {
+						switch field {
+						case 1:
+							c.Name = string(value)
+						case 2:
+							c.Tier = string(value)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		case 2:
+			o := &kfdefs.ExternalObjectStore{}
+			e.ObjectStore = o
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					o.Endpoint = string(value)
+				case 2:
+					o.Bucket = string(value)
+				case 3:
+					o.Insecure = v != 0
+				case 4:
+					o.AccessKeySecret = string(value)
+				case 5:
+					o.SecretKeySecret = string(value)
+				case 6:
+					o.CreateBucket = v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func readGpuConfig(b []byte, g *kfdefs.GpuConfig) error {
+	return readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			return readStringMapEntry(value, &g.NodeSelector)
+		case 2:
+			d := &kfdefs.GpuDriver{}
+			g.Driver = d
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					d.NodeOS = kfdefs.GpuNodeOS(value)
+				case 2:
+					d.Image = string(value)
+				case 3:
+					d.Version = string(value)
+				}
+				return nil
+			})
+		case 3:
+			p := &kfdefs.GpuDevicePlugin{}
+			g.DevicePlugin = p
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				if field == 1 {
+					p.Image = string(value)
+				}
+				return nil
+			})
+		case 4:
+			return readStringMapEntry(value, &g.NodeLabels)
+		}
+		return nil
+	})
+}
+
+func readTransformer(b []byte) (kfdefs.KustomizeTransformer, error) {
+	t := kfdefs.KustomizeTransformer{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			t.Name = string(value)
+		case 2:
+			t.Applications = append(t.Applications, string(value))
+		case 3:
+			t.NamePrefix = string(value)
+		case 4:
+			return readStringMapEntry(value, &t.CommonLabels)
+		case 5:
+			r := kfdefs.FieldReplacement{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					r.Group = string(value)
+				case 2:
+					r.Version = string(value)
+				case 3:
+					r.Kind = string(value)
+				case 4:
+					r.Name = string(value)
+				case 5:
+					r.Namespace = string(value)
+				case 6:
+					r.Path = string(value)
+				case 7:
+					r.Value.Raw = append([]byte{}, value...)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			t.Replacements = append(t.Replacements, r)
+		}
+		return nil
+	})
+	return t, err
+}
+
+func readSecret(b []byte) (kfdefs.Secret, error) {
+	secret := kfdefs.Secret{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			secret.Name = string(value)
+		case 2:
+			src := &kfdefs.SecretSource{}
+			secret.SecretSource = src
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				s, err := readValue(value)
+				if err != nil {
+					return err
+				}
+				switch field {
+				case 1:
+					src.LiteralSource = &kfdefs.LiteralSource{Value: s}
+				case 2:
+					src.HashedSource = &kfdefs.HashedSource{HashedValue: s}
+				case 3:
+					src.EnvSource = &kfdefs.EnvSource{Name: s}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return secret, err
+}
+
+func readApplication(b []byte) (kfdefs.Application, error) {
+	a := kfdefs.Application{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			a.Name = string(value)
+		case 2:
+			k := &kfdefs.KustomizeConfig{}
+			a.KustomizeConfig = k
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					ref := &kfdefs.RepoRef{}
+					k.RepoRef = ref
+					return readFields(value, func(field int, v uint64, value []byte) error {
+						switch field {
+						case 1:
+							ref.Name = string(value)
+						case 2:
+							ref.Path = string(value)
+						}
+						return nil
+					})
+				case 2:
+					k.Overlays = append(k.Overlays, string(value))
+				case 3:
+					p, err := readNameValue(value)
+					if err != nil {
+						return err
+					}
+					k.Parameters = append(k.Parameters, p)
+				}
+				return nil
+			})
+		case 3:
+			r, err := readReadiness(value)
+			if err != nil {
+				return err
+			}
+			a.Readiness = r
+		}
+		return nil
+	})
+	return a, err
+}
+
+func readReadiness(b []byte) (*kfdefs.Readiness, error) {
+	r := &kfdefs.Readiness{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			c := kfdefs.ReadinessCheck{}
+			if err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					c.Deployment = string(value)
+				case 2:
+					c.Job = string(value)
+				case 3:
+					c.Namespace = string(value)
+				case 4:
+					c.URL = string(value)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			r.Checks = append(r.Checks, c)
+		case 2:
+			r.TimeoutSeconds = int64(v)
+		}
+		return nil
+	})
+	return r, err
+}
+
+func readPlacement(b []byte) (kfdefs.WorkloadPlacement, error) {
+	p := kfdefs.WorkloadPlacement{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			p.Name = string(value)
+		case 2:
+			p.Applications = append(p.Applications, string(value))
+		case 3:
+			return readStringMapEntry(value, &p.NodeSelector)
+		case 4:
+			t := v1.Toleration{}
+			if err := t.Unmarshal(value); err != nil {
+				return err
+			}
+			p.Tolerations = append(p.Tolerations, t)
+		}
+		return nil
+	})
+	return p, err
+}
+
+func readTeamProfile(b []byte) (kfdefs.TeamProfile, error) {
+	p := kfdefs.TeamProfile{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			p.Name = string(value)
+		case 2:
+			p.Owner = string(value)
+		case 3:
+			c := kfdefs.ProfileContributor{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					c.User = string(value)
+				case 2:
+					c.Role = kfdefs.ContributorRole(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			p.Contributors = append(p.Contributors, c)
+		}
+		return nil
+	})
+	return p, err
+}
+
+func readHook(b []byte) (kfdefs.Hook, error) {
+	h := kfdefs.Hook{}
+	err := readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			h.Name = string(value)
+		case 2:
+			h.Phase = kfdefs.HookPhase(value)
+		case 3:
+			h.Webhook = &kfdefs.WebhookHook{}
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				if field == 1 {
+					h.Webhook.URL = string(value)
+				}
+				return nil
+			})
+		case 4:
+			h.Job = &batchv1.JobSpec{}
+			return h.Job.Unmarshal(value)
+		case 5:
+			h.TimeoutSeconds = int64(v)
+		}
+		return nil
+	})
+	return h, err
+}
+
+func readKfDefStatus(b []byte, s *kfdefs.KfDefStatus) error {
+	return readFields(b, func(field int, v uint64, value []byte) error {
+		switch field {
+		case 1:
+			c := kfdefs.KfDefCondition{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					c.Type = kfdefs.KfDefConditionType(value)
+				case 2:
+					c.Status = v1.ConditionStatus(value)
+				case 4:
+					c.Reason = string(value)
+				case 5:
+					c.Message = string(value)
+				case 6:
+					return c.LastUpdateTime.Unmarshal(value)
+				case 7:
+					return c.LastTransitionTime.Unmarshal(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.Conditions = append(s.Conditions, c)
+		case 2:
+			name := ""
+			cache := kfdefs.RepoCache{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					name = string(value)
+				case 2:
+					cache.LocalPath = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if s.ReposCache == nil {
+				s.ReposCache = map[string]kfdefs.RepoCache{}
+			}
+			s.ReposCache[name] = cache
+		case 3:
+			a := kfdefs.ApplicationStatus{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					a.Name = string(value)
+				case 2:
+					a.State = kfdefs.ApplicationState(value)
+				case 3:
+					a.Message = string(value)
+				case 4:
+					return a.LastUpdateTime.Unmarshal(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.Applications = append(s.Applications, a)
+		case 4:
+			s.ClusterVersion = string(value)
+		case 5:
+			s.Zone = string(value)
+		case 6:
+			m := kfdefs.ManifestSignature{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					m.Application = string(value)
+				case 2:
+					m.Digest = string(value)
+				case 3:
+					m.Signature = string(value)
+				case 4:
+					return m.SignedTime.Unmarshal(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.ManifestSignatures = append(s.ManifestSignatures, m)
+		case 7:
+			r := kfdefs.InventoryResource{}
+			err := readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					r.Kind = string(value)
+				case 2:
+					r.APIVersion = string(value)
+				case 3:
+					r.Name = string(value)
+				case 4:
+					r.Namespace = string(value)
+				case 5:
+					r.Project = string(value)
+				case 6:
+					r.Source = string(value)
+				case 7:
+					return r.CreationTime.Unmarshal(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.Inventory = append(s.Inventory, r)
+		case 8:
+			c := &kfdefs.CertificateStatus{}
+			s.Certificate = c
+			return readFields(value, func(field int, v uint64, value []byte) error {
+				switch field {
+				case 1:
+					c.Name = string(value)
+				case 2:
+					c.Domains = append(c.Domains, string(value))
+				case 3:
+					c.State = string(value)
+				case 4:
+					return c.CreationTime.Unmarshal(value)
+				case 5:
+					return c.ExpectedReadyTime.Unmarshal(value)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
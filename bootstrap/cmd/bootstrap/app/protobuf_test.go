@@ -0,0 +1,373 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newProtobufTestKfDef returns a KfDef with every field the protobuf encoding supports set.
+func newProtobufTestKfDef() *kfdefs.KfDef {
+	now := metav1.NewTime(time.Unix(1565000000, 0))
+	return &kfdefs.KfDef{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "kfdef.apps.kubeflow.org/v1alpha1",
+			Kind:       "KfDef",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "kf-app",
+			Namespace:   "kubeflow",
+			Labels:      map[string]string{"app": "kubeflow"},
+			Annotations: map[string]string{"kfctl.kubeflow.org/retry-apps": "jupyter"},
+		},
+		Spec: kfdefs.KfDefSpec{
+			ComponentConfig: config.ComponentConfig{
+				Repo:       "/tmp/repo",
+				Components: []string{"jupyter", "katib"},
+				Packages:   []string{"core"},
+				ComponentParams: config.Parameters{
+					"jupyter": {{Name: "image", Value: "jupyter:v1", InitRequired: true}},
+					"katib":   {{Name: "replicas", Value: "2"}},
+				},
+				Platform: "gcp",
+			},
+			AppDir:             "/apps/kf-app",
+			Version:            "v0.6.0",
+			MountLocal:         true,
+			Project:            "acme",
+			Email:              "admin@acme.com",
+			IpName:             "kf-app-ip",
+			Hostname:           "kf-app.endpoints.acme.cloud.goog",
+			Zone:               "us-east1-d",
+			UseBasicAuth:       true,
+			SkipInitProject:    true,
+			UseIstio:           true,
+			EnableApplications: true,
+			ServerVersion:      "v1",
+			DeleteStorage:      true,
+			PackageManager:     "kustomize",
+			Repos: []kfdefs.Repo{
+				{Name: "manifests", Uri: "https://github.com/kubeflow/manifests/archive/master.tar.gz", Root: "manifests-master"},
+			},
+			Secrets: []kfdefs.Secret{
+				{Name: "literal", SecretSource: &kfdefs.SecretSource{LiteralSource: &kfdefs.LiteralSource{Value: "secret"}}},
+				{Name: "hashed", SecretSource: &kfdefs.SecretSource{HashedSource: &kfdefs.HashedSource{HashedValue: "abc"}}},
+				{Name: "env", SecretSource: &kfdefs.SecretSource{EnvSource: &kfdefs.EnvSource{Name: "PASSWORD"}}},
+				{Name: "none"},
+			},
+			Plugins: []kfdefs.Plugin{
+				{Name: "gcp", Spec: &runtime.RawExtension{Raw: []byte(`{"diskSizeGb":1000000,"nodeCount":3}`)}},
+				{Name: "empty"},
+			},
+			Applications: []kfdefs.Application{
+				{
+					Name: "jupyter",
+					KustomizeConfig: &kfdefs.KustomizeConfig{
+						RepoRef:    &kfdefs.RepoRef{Name: "manifests", Path: "jupyter/jupyter-web-app"},
+						Overlays:   []string{"istio", "application"},
+						Parameters: []config.NameValue{{Name: "clusterRbacConfig", Value: "OFF"}},
+					},
+					Readiness: &kfdefs.Readiness{
+						Checks: []kfdefs.ReadinessCheck{
+							{Deployment: "jupyter-web-app", Namespace: "kubeflow"},
+							{URL: "http://jupyter-web-app.kubeflow.svc.cluster.local/healthz"},
+						},
+						TimeoutSeconds: 300,
+					},
+				},
+				{Name: "readiness-only", Readiness: &kfdefs.Readiness{}},
+				{Name: "bare"},
+			},
+			AdoptionPolicy: kfdefs.AdoptionPolicyForce,
+			Namespaces:     &kfdefs.NamespaceLayout{Istio: "istio-system", Knative: "knative-serving"},
+			ResourceQuota: &v1.ResourceQuotaSpec{
+				Hard: v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("64")},
+			},
+			LimitRange: &v1.LimitRangeSpec{
+				Limits: []v1.LimitRangeItem{
+					{Type: v1.LimitTypeContainer, Default: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")}},
+				},
+			},
+			Region: "us-east1",
+			Placements: []kfdefs.WorkloadPlacement{
+				{
+					Name:         "preemptible",
+					Applications: []string{"tf-job-operator", "pytorch-operator"},
+					NodeSelector: map[string]string{"cloud.google.com/gke-preemptible": "true", "pool": "training"},
+					Tolerations: []v1.Toleration{
+						{Key: "cloud.google.com/gke-preemptible", Operator: v1.TolerationOpEqual, Value: "true", Effect: v1.TaintEffectNoSchedule},
+					},
+				},
+				{Name: "empty"},
+			},
+			Admins: []string{"admin@acme.com", "ops@acme.com"},
+			Profiles: []kfdefs.TeamProfile{
+				{
+					Name:  "team-a",
+					Owner: "lead@acme.com",
+					Contributors: []kfdefs.ProfileContributor{
+						{User: "dev@acme.com", Role: kfdefs.ContributorRoleEdit},
+						{User: "analyst@acme.com"},
+					},
+				},
+				{Name: "team-b", Owner: "other@acme.com"},
+			},
+			Hooks: []kfdefs.Hook{
+				{Name: "approval", Phase: kfdefs.HookPreProvision, Webhook: &kfdefs.WebhookHook{URL: "https://approvals.acme.com"}},
+				{
+					Name:           "configure",
+					Phase:          kfdefs.HookPostApply,
+					TimeoutSeconds: 300,
+					Job: &batchv1.JobSpec{
+						Template: v1.PodTemplateSpec{
+							Spec: v1.PodSpec{
+								RestartPolicy: v1.RestartPolicyNever,
+								Containers:    []v1.Container{{Name: "configure", Image: "gcr.io/acme/configure:v1"}},
+							},
+						},
+					},
+				},
+			},
+			Features:      []string{"multi-user", "kfserving"},
+			ManifestSinks: []string{"gs://kf-archive/manifests", "/var/lib/manifests"},
+			Istio: &kfdefs.IstioConfig{
+				MTLS:                kfdefs.IstioMTLSStrict,
+				IngressGatewayType:  v1.ServiceTypeNodePort,
+				InjectionNamespaces: []string{"kubeflow", "serving"},
+			},
+			ReportUsage: true,
+		},
+		Status: kfdefs.KfDefStatus{
+			Conditions: []kfdefs.KfDefCondition{
+				{
+					Type:               kfdefs.KfDeploying,
+					Status:             v1.ConditionFalse,
+					Reason:             DeploymentPausedReason,
+					Message:            "paused",
+					LastUpdateTime:     now,
+					LastTransitionTime: now,
+				},
+			},
+			ReposCache: map[string]kfdefs.RepoCache{
+				"manifests": {LocalPath: "/apps/kf-app/.cache/manifests"},
+			},
+			Applications: []kfdefs.ApplicationStatus{
+				{Name: "jupyter", State: kfdefs.ApplicationFailed, Message: "timeout", LastUpdateTime: now},
+			},
+			ClusterVersion: "1.14.8-gke.12",
+		},
+	}
+}
+
+func TestKfDefProtoRoundTrip(t *testing.T) {
+	for _, expected := range []*kfdefs.KfDef{newProtobufTestKfDef(), {}} {
+		b, err := marshalKfDefProto(expected)
+		if err != nil {
+			t.Fatalf("marshalKfDefProto failed; %v", err)
+		}
+		actual := &kfdefs.KfDef{}
+		if err := unmarshalKfDefProto(b, actual); err != nil {
+			t.Fatalf("unmarshalKfDefProto failed; %v", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Round trip got\n%v\nwant\n%v", PrettyPrint(actual), PrettyPrint(expected))
+		}
+
+		again, err := marshalKfDefProto(actual)
+		if err != nil {
+			t.Fatalf("marshalKfDefProto failed; %v", err)
+		}
+		if !reflect.DeepEqual(again, b) {
+			t.Errorf("Encoding isn't deterministic")
+		}
+	}
+}
+
+// protoSamples are values of the types the protobuf encoding of KfDef delegates to other
+// encodings or carries as raw bytes; protoFiller uses them rather than descending into the types.
+var protoSamples = map[reflect.Type]func(n int) interface{}{
+	reflect.TypeOf(metav1.TypeMeta{}): func(n int) interface{} {
+		return metav1.TypeMeta{APIVersion: fmt.Sprintf("v%v", n), Kind: "KfDef"}
+	},
+	reflect.TypeOf(metav1.ObjectMeta{}): func(n int) interface{} {
+		return metav1.ObjectMeta{Name: fmt.Sprintf("kf-app-%v", n), Labels: map[string]string{"n": fmt.Sprint(n)}}
+	},
+	reflect.TypeOf(metav1.Time{}): func(n int) interface{} {
+		return metav1.NewTime(time.Unix(1565000000+int64(n), 0))
+	},
+	reflect.TypeOf(metav1.Duration{}): func(n int) interface{} {
+		return metav1.Duration{Duration: time.Duration(n) * time.Minute}
+	},
+	reflect.TypeOf(runtime.RawExtension{}): func(n int) interface{} {
+		return runtime.RawExtension{Raw: []byte(fmt.Sprintf(`{"n":%v}`, n))}
+	},
+	reflect.TypeOf(v1.ResourceQuotaSpec{}): func(n int) interface{} {
+		return v1.ResourceQuotaSpec{Hard: v1.ResourceList{v1.ResourceCPU: *resource.NewQuantity(int64(n), resource.DecimalSI)}}
+	},
+	reflect.TypeOf(v1.LimitRangeSpec{}): func(n int) interface{} {
+		return v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{{Type: v1.LimitTypeContainer}}}
+	},
+	reflect.TypeOf(v1.Toleration{}): func(n int) interface{} {
+		return v1.Toleration{Key: fmt.Sprintf("key-%v", n), Operator: v1.TolerationOpExists}
+	},
+	reflect.TypeOf(batchv1.JobSpec{}): func(n int) interface{} {
+		return batchv1.JobSpec{Parallelism: proto.Int32(int32(n))}
+	},
+}
+
+// protoFiller sets every field of a value to a distinct non zero value so a field the protobuf
+// encoding drops is detected.
+type protoFiller struct {
+	t *testing.T
+	n int
+}
+
+func (f *protoFiller) fill(v reflect.Value, path string) {
+	f.n++
+	if sample, ok := protoSamples[v.Type()]; ok {
+		v.Set(reflect.ValueOf(sample(f.n)))
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(fmt.Sprintf("%v-%v", path, f.n))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(f.n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(f.n))
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		f.fill(v.Elem(), path)
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		f.fill(s.Index(0), path+"[0]")
+		v.Set(s)
+	case reflect.Map:
+		key := reflect.New(v.Type().Key()).Elem()
+		f.fill(key, path+".key")
+		value := reflect.New(v.Type().Elem()).Elem()
+		f.fill(value, path+".value")
+		m := reflect.MakeMap(v.Type())
+		m.SetMapIndex(key, value)
+		v.Set(m)
+	case reflect.Struct:
+		pkg := v.Type().PkgPath()
+		if pkg != reflect.TypeOf(kfdefs.KfDef{}).PkgPath() && pkg != reflect.TypeOf(config.ComponentConfig{}).PkgPath() {
+			f.t.Fatalf("%v: add a sample of %v to protoSamples", path, v.Type())
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			f.fill(v.Field(i), path+"."+field.Name)
+		}
+	default:
+		f.t.Fatalf("%v: can't fill a %v", path, v.Kind())
+	}
+}
+
+// diffJSON returns the paths at which the JSON values expected and actual differ.
+func diffJSON(path string, expected interface{}, actual interface{}) []string {
+	e, eok := expected.(map[string]interface{})
+	a, aok := actual.(map[string]interface{})
+	if eok && aok {
+		diffs := []string{}
+		for k, v := range e {
+			diffs = append(diffs, diffJSON(path+"."+k, v, a[k])...)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				diffs = append(diffs, path+"."+k)
+			}
+		}
+		return diffs
+	}
+	el, eok := expected.([]interface{})
+	al, aok := actual.([]interface{})
+	if eok && aok && len(el) == len(al) {
+		diffs := []string{}
+		for i := range el {
+			diffs = append(diffs, diffJSON(fmt.Sprintf("%v[%v]", path, i), el[i], al[i])...)
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		return []string{path}
+	}
+	return nil
+}
+
+// TestKfDefProtoCoversKfDef fails when a field of KfDef isn't encoded e.g. because it was added
+// without updating protobuf.go; protobuf clients would silently drop it otherwise.
+func TestKfDefProtoCoversKfDef(t *testing.T) {
+	expected := &kfdefs.KfDef{}
+	f := &protoFiller{t: t}
+	f.fill(reflect.ValueOf(expected).Elem(), "KfDef")
+
+	b, err := marshalKfDefProto(expected)
+	if err != nil {
+		t.Fatalf("marshalKfDefProto failed; %v", err)
+	}
+	actual := &kfdefs.KfDef{}
+	if err := unmarshalKfDefProto(b, actual); err != nil {
+		t.Fatalf("unmarshalKfDefProto failed; %v", err)
+	}
+
+	var e, a interface{}
+	for _, c := range []struct {
+		d *kfdefs.KfDef
+		v *interface{}
+	}{{expected, &e}, {actual, &a}} {
+		buf, err := json.Marshal(c.d)
+		if err != nil {
+			t.Fatalf("Could not encode KfDef; %v", err)
+		}
+		if err := json.Unmarshal(buf, c.v); err != nil {
+			t.Fatalf("Could not decode KfDef; %v", err)
+		}
+	}
+	diffs := diffJSON("", e, a)
+	sort.Strings(diffs)
+	for _, d := range diffs {
+		t.Errorf("Field %v doesn't round trip; add it to the schema in protobuf.go", d)
+	}
+}
+
+func TestKfDefProtoSkipsUnknownFields(t *testing.T) {
+	expected := newProtobufTestKfDef()
+	b, err := marshalKfDefProto(expected)
+	if err != nil {
+		t.Fatalf("marshalKfDefProto failed; %v", err)
+	}
+
+	// Append fields a newer encoding might add.
+	w := &pbWriter{buf: b}
+	w.str(100, "future")
+	w.boolean(101, true)
+
+	actual := &kfdefs.KfDef{}
+	if err := unmarshalKfDefProto(w.buf, actual); err != nil {
+		t.Fatalf("unmarshalKfDefProto failed; %v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Got\n%v\nwant\n%v", PrettyPrint(actual), PrettyPrint(expected))
+	}
+
+	if err := unmarshalKfDefProto(b[:len(b)-1], &kfdefs.KfDef{}); err == nil {
+		t.Errorf("unmarshalKfDefProto of a truncated encoding should fail")
+	}
+}
@@ -0,0 +1,139 @@
+package app
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// proxyDirect is the proxy of a ProxyRule which sends matching requests without a proxy.
+	proxyDirect = "direct"
+
+	// clusterLocalSuffix is the suffix of the addresses of K8s services e.g. the kfctl servers.
+	// Requests to them never go through the proxy from the environment.
+	clusterLocalSuffix = ".svc.cluster.local"
+)
+
+// proxyEnvVars are the environment variables configuring the proxy which the router passes to the
+// kfctl servers it creates.
+var proxyEnvVars = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"}
+
+// ProxyRule overrides the proxy from HTTP(S)_PROXY and NO_PROXY for requests to some hosts.
+type ProxyRule struct {
+	// Host is the host the rule applies to; it also applies to the subdomains of host.
+	// A leading dot is ignored and * matches every host.
+	Host string `json:"host"`
+	// Proxy is the URL of the proxy requests to host are sent through or direct to bypass the proxy.
+	Proxy string `json:"proxy"`
+}
+
+// matches returns true if the rule applies to requests to host.
+func (p ProxyRule) matches(host string) bool {
+	domain := strings.ToLower(strings.TrimPrefix(p.Host, "."))
+	host = strings.ToLower(host)
+	return domain == "*" || host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// proxyURL returns the URL of the proxy of the rule; it is nil if the rule bypasses the proxy.
+func (p ProxyRule) proxyURL() (*url.URL, error) {
+	if p.Proxy == proxyDirect {
+		return nil, nil
+	}
+	u, err := url.Parse(p.Proxy)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		return nil, fmt.Errorf("proxy %q for %v must be %v or an http, https or socks5 URL", p.Proxy, p.Host, proxyDirect)
+	}
+	return u, nil
+}
+
+// validateProxyRules returns an error if a rule doesn't have a host or a valid proxy.
+func validateProxyRules(rules []ProxyRule) error {
+	for _, r := range rules {
+		if r.Host == "" {
+			return fmt.Errorf("proxy rules require a host")
+		}
+		if _, err := r.proxyURL(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseProxyRules parses a comma separated list of host=proxy pairs e.g.
+// github.com=http://proxy.acme.com:3128,.googleapis.com=direct. Earlier rules take precedence.
+func ParseProxyRules(spec string) ([]ProxyRule, error) {
+	rules := []ProxyRule{}
+	if strings.TrimSpace(spec) == "" {
+		return rules, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		pieces := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("proxy rule %q must be of the form host=proxy", pair)
+		}
+		rules = append(rules, ProxyRule{Host: pieces[0], Proxy: pieces[1]})
+	}
+	if err := validateProxyRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// formatProxyRules is the inverse of ParseProxyRules.
+func formatProxyRules(rules []ProxyRule) string {
+	pairs := []string{}
+	for _, r := range rules {
+		pairs = append(pairs, r.Host+"="+r.Proxy)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// proxyForRequest returns the proxy req should be sent through. The first rule matching the host
+// of req wins; without a match the proxy is taken from HTTP(S)_PROXY and NO_PROXY except for
+// requests to K8s services which are always sent directly.
+func proxyForRequest(rules []ProxyRule, req *http.Request) (*url.URL, error) {
+	host := req.URL.Hostname()
+	for _, r := range rules {
+		if r.matches(host) {
+			return r.proxyURL()
+		}
+	}
+	if strings.HasSuffix(strings.ToLower(host), clusterLocalSuffix) {
+		return nil, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// proxy is an http.Transport Proxy applying the proxy rules of the current config.
+func (s *serverConfigStore) proxy(req *http.Request) (*url.URL, error) {
+	return proxyForRequest(s.get().Proxies, req)
+}
+
+// InstallProxy makes http.DefaultTransport apply the proxy rules of the config. The GitHub and GCP
+// clients, the webhooks and the clients of the kfctl servers all use http.DefaultTransport so
+// their requests are proxied the same way; rules changed by a reload apply to the next request.
+func (s *serverConfigStore) InstallProxy() {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		log.Warnf("Not installing the proxy rules; the default transport is a %T", http.DefaultTransport)
+		return
+	}
+	t.Proxy = s.proxy
+}
+
+// proxyEnv returns the proxy environment variables set in the environment of the process so they
+// can be passed on to the kfctl servers.
+func proxyEnv() []corev1.EnvVar {
+	env := []corev1.EnvVar{}
+	for _, name := range proxyEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, corev1.EnvVar{Name: name, Value: v})
+		}
+	}
+	return env
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestParseProxyRules(t *testing.T) {
+	spec := "github.com=http://proxy.acme.com:3128, .googleapis.com=direct"
+	rules, err := ParseProxyRules(spec)
+	if err != nil {
+		t.Fatalf("ParseProxyRules failed; %v", err)
+	}
+	if len(rules) != 2 || rules[0].Host != "github.com" || rules[1].Proxy != proxyDirect {
+		t.Errorf("ParseProxyRules: got %+v", rules)
+	}
+	if got := formatProxyRules(rules); got != "github.com=http://proxy.acme.com:3128,.googleapis.com=direct" {
+		t.Errorf("formatProxyRules: got %v", got)
+	}
+
+	for _, spec := range []string{"github.com", "=direct", "github.com=ftp://proxy.acme.com", "github.com=proxy"} {
+		if _, err := ParseProxyRules(spec); err == nil {
+			t.Errorf("ParseProxyRules(%v): want an error", spec)
+		}
+	}
+}
+
+func TestProxyForRequest(t *testing.T) {
+	rules, err := ParseProxyRules("api.github.com=direct,github.com=http://github-proxy:3128,.googleapis.com=http://gcp-proxy:3128")
+	if err != nil {
+		t.Fatalf("ParseProxyRules failed; %v", err)
+	}
+
+	// http.ProxyFromEnvironment reads the environment once so the fallback to the environment
+	// is only checked for K8s services which never use it.
+	type testCase struct {
+		url      string
+		expected string
+	}
+	testCases := []testCase{
+		{url: "https://api.github.com/repos/kubeflow/manifests", expected: ""},
+		{url: "https://codeload.github.com/kubeflow/manifests", expected: "http://github-proxy:3128"},
+		{url: "https://GitHub.com/kubeflow", expected: "http://github-proxy:3128"},
+		{url: "https://iam.googleapis.com/v1/projects", expected: "http://gcp-proxy:3128"},
+		{url: "http://kf-app.kubeflow-admin.svc.cluster.local:80/kfctl/apps/v1alpha2/create", expected: ""},
+	}
+	for _, c := range testCases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		if err != nil {
+			t.Fatalf("NewRequest failed; %v", err)
+		}
+		u, err := proxyForRequest(rules, req)
+		if err != nil {
+			t.Errorf("proxyForRequest(%v) failed; %v", c.url, err)
+			continue
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != c.expected {
+			t.Errorf("proxyForRequest(%v): got %q; want %q", c.url, got, c.expected)
+		}
+	}
+}
+
+func TestProxyEnv(t *testing.T) {
+	for _, name := range proxyEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, v)
+			os.Unsetenv(name)
+		}
+	}
+	os.Setenv("HTTPS_PROXY", "http://proxy.acme.com:3128")
+	defer os.Unsetenv("HTTPS_PROXY")
+
+	env := proxyEnv()
+	if len(env) != 1 || env[0].Name != "HTTPS_PROXY" || env[0].Value != "http://proxy.acme.com:3128" {
+		t.Errorf("proxyEnv: got %+v", env)
+	}
+}
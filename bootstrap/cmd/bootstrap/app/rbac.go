@@ -0,0 +1,250 @@
+package app
+
+import (
+	"crypto/sha256"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AllProjectsAnnotation if set to true on a list request lists the deployments of every project.
+// Only admins of the operator project (see ServerConfig.OperatorProject) may set it.
+const AllProjectsAnnotation = "kfctl.kubeflow.org/all-projects"
+
+// accessTokenLifetime is how long the Google access tokens are valid.
+const accessTokenLifetime = time.Hour
+
+// maxCachedRoles bounds the roles cached by the router; the cache is emptied once it is full of
+// roles which haven't expired.
+const maxCachedRoles = 10000
+
+// Role is the access a caller has to the deployments of a project. Each role includes the
+// access of the roles below it.
+type Role int
+
+const (
+	// RoleNone has no access to the project.
+	RoleNone Role = iota
+	// RoleViewer can get the status of, list and export deployments.
+	RoleViewer
+	// RoleEditor can also create, update, pause and resume deployments.
+	RoleEditor
+	// RoleAdmin can also delete and cancel deployments, change their deletion protection and
+	// revoke their IAM bindings.
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleEditor:
+		return "editor"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// rolePermissions are the IAM permissions on the project which grant each role from highest to
+// lowest. The claims of an access token are the permissions it has on the project of the request.
+var rolePermissions = []struct {
+	role       Role
+	permission string
+}{
+	{RoleAdmin, "resourcemanager.projects.setIamPolicy"},
+	{RoleEditor, "container.clusters.create"},
+	{RoleViewer, "resourcemanager.projects.get"},
+}
+
+// ProjectRoleFunc returns the role the token grants on the project.
+type ProjectRoleFunc func(project string, ts oauth2.TokenSource) (Role, error)
+
+// roleFromPermissions returns the highest role granted by the permissions.
+func roleFromPermissions(granted []string) Role {
+	for _, p := range rolePermissions {
+		for _, g := range granted {
+			if g == p.permission {
+				return p.role
+			}
+		}
+	}
+	return RoleNone
+}
+
+// ProjectRole returns the role the token grants on the project based on the IAM permissions it has.
+func ProjectRole(project string, ts oauth2.TokenSource) (Role, error) {
+	permissions := []string{}
+	for _, p := range rolePermissions {
+		permissions = append(permissions, p.permission)
+	}
+	granted, err := testIamPermissions(project, ts, permissions)
+	if err != nil {
+		return RoleNone, err
+	}
+	return roleFromPermissions(granted), nil
+}
+
+// roleCacheKey identifies the role a token grants on a project. The token is hashed so the
+// cache doesn't hold the tokens.
+type roleCacheKey struct {
+	token   [sha256.Size]byte
+	project string
+}
+
+// cachedRole is a role cached until the token granting it expires.
+type cachedRole struct {
+	role    Role
+	expires time.Time
+}
+
+// roleCache caches the roles the access tokens grant on the projects for the lifetime of the
+// tokens so the IAM permissions of a caller aren't tested on every request. RoleNone isn't cached
+// so a caller granted access doesn't have to wait for a new token.
+type roleCache struct {
+	mu    sync.Mutex
+	roles map[roleCacheKey]cachedRole
+}
+
+// newRoleCache returns an empty cache.
+func newRoleCache() *roleCache {
+	return &roleCache{
+		roles: map[roleCacheKey]cachedRole{},
+	}
+}
+
+// get returns the role the token grants on the project; it calls projectRole unless the role is
+// cached. The tokens of the requests don't carry their expiry so a role is cached for the lifetime
+// of a new access token at most.
+func (c *roleCache) get(project string, token string, projectRole ProjectRoleFunc, now time.Time) (Role, error) {
+	key := roleCacheKey{
+		token:   sha256.Sum256([]byte(token)),
+		project: project,
+	}
+	c.mu.Lock()
+	cached, ok := c.roles[key]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.role, nil
+	}
+
+	role, err := projectRole(project, oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: token,
+	}))
+	if err != nil || role == RoleNone {
+		return role, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.roles) >= maxCachedRoles {
+		for k, r := range c.roles {
+			if !now.Before(r.expires) {
+				delete(c.roles, k)
+			}
+		}
+		if len(c.roles) >= maxCachedRoles {
+			c.roles = map[roleCacheKey]cachedRole{}
+		}
+	}
+	c.roles[key] = cachedRole{
+		role:    role,
+		expires: now.Add(accessTokenLifetime),
+	}
+	return role, nil
+}
+
+// callerRole returns the role granted by the access token of the request on its project. Admins of
+// the operator project are admins of every project.
+func (r *kfctlRouter) callerRole(req kfdefs.KfDef) (Role, error) {
+	token, err := req.GetSecret(gcp.GcpAccessTokenName)
+	if err != nil {
+		log.Errorf("Failed to get secret %v; error %v", gcp.GcpAccessTokenName, err)
+		return RoleNone, &httpError{
+			Message: fmt.Sprintf("Could not obtain an access token from secret %v", gcp.GcpAccessTokenName),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	now := time.Now()
+	role, err := r.roles.get(req.Spec.Project, token, r.projectRole, now)
+	if err != nil {
+		log.Errorf("Could not get the role on project %v; error %v", req.Spec.Project, err)
+		return RoleNone, &httpError{
+			Message: fmt.Sprintf("There was a problem verifying access to project: %v; please try again later", req.Spec.Project),
+			Code:    http.StatusUnauthorized,
+		}
+	}
+
+	operator := r.config.get().OperatorProject
+	if role == RoleAdmin || operator == "" || operator == req.Spec.Project {
+		return role, nil
+	}
+	if opRole, err := r.roles.get(operator, token, r.projectRole, now); err != nil {
+		log.Warnf("Could not get the role on operator project %v; error %v", operator, err)
+	} else if opRole == RoleAdmin {
+		return RoleAdmin, nil
+	}
+	return role, nil
+}
+
+// authorize returns an error unless the access token of the request grants at least role on its project.
+func (r *kfctlRouter) authorize(req kfdefs.KfDef, role Role) error {
+	granted, err := r.callerRole(req)
+	if err != nil {
+		return err
+	}
+	if granted == RoleNone {
+		log.Errorf("Request isn't authorized for project %v", req.Spec.Project)
+		return &httpError{
+			Message: fmt.Sprintf("There was a problem verifying access to project: %v; please check the project id is correct and that you have access to it", req.Spec.Project),
+			Code:    http.StatusUnauthorized,
+		}
+	}
+	if granted < role {
+		log.Errorf("Request requires role %v on project %v; caller is %v", role, req.Spec.Project, granted)
+		hErr := &httpError{
+			Message: fmt.Sprintf("This request requires the %v role on project %v; you are a %v", role, req.Spec.Project, granted),
+			Code:    http.StatusForbidden,
+		}
+		for _, p := range rolePermissions {
+			if p.role == role {
+				r := permissionRemediation(p.permission, req.Spec.Project)
+				hErr.ErrorCode = ErrorPermissionDenied
+				hErr.Remediation = &r
+			}
+		}
+		return hErr
+	}
+	log.Infof("User has sufficient access; role %v", granted)
+	return nil
+}
+
+// allProjects returns true if the list request asks for the deployments of every project.
+func allProjects(req kfdefs.KfDef) bool {
+	return req.Annotations[AllProjectsAnnotation] == "true"
+}
+
+// authorizeAllProjects returns an error unless the access token of the request grants the admin
+// role on the operator project.
+func (r *kfctlRouter) authorizeAllProjects(req kfdefs.KfDef) error {
+	operator := r.config.get().OperatorProject
+	if operator == "" {
+		return &httpError{
+			Message: "Listing the deployments of every project isn't enabled; the server has no operator project",
+			Code:    http.StatusForbidden,
+		}
+	}
+	if req.Spec.Project != operator {
+		return &httpError{
+			Message: fmt.Sprintf("Listing the deployments of every project requires the operator project %v", operator),
+			Code:    http.StatusForbidden,
+		}
+	}
+	return r.authorize(req, RoleAdmin)
+}
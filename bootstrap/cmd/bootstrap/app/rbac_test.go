@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"golang.org/x/oauth2"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRoleFromPermissions(t *testing.T) {
+	type testCase struct {
+		granted  []string
+		expected Role
+	}
+
+	testCases := []testCase{
+		{
+			granted:  nil,
+			expected: RoleNone,
+		},
+		{
+			granted:  []string{"resourcemanager.projects.get"},
+			expected: RoleViewer,
+		},
+		{
+			granted:  []string{"resourcemanager.projects.get", "container.clusters.create"},
+			expected: RoleEditor,
+		},
+		{
+			granted:  []string{"container.clusters.create", "resourcemanager.projects.setIamPolicy"},
+			expected: RoleAdmin,
+		},
+	}
+
+	for _, c := range testCases {
+		if actual := roleFromPermissions(c.granted); actual != c.expected {
+			t.Errorf("roleFromPermissions(%v): got %v; want %v", c.granted, actual, c.expected)
+		}
+	}
+}
+
+// newRbacTestRouter returns a router whose callers have the given role on each project.
+func newRbacTestRouter(t *testing.T, roles map[string]Role, operator string) *kfctlRouter {
+	c := DefaultServerConfig()
+	c.OperatorProject = operator
+	config, err := newServerConfigStore("", c)
+	if err != nil {
+		t.Fatalf("newServerConfigStore: %v", err)
+	}
+	return &kfctlRouter{
+		config:       config,
+		retryBudgets: newRetryBudgets(),
+		roles:        newRoleCache(),
+		projectRole: func(project string, ts oauth2.TokenSource) (Role, error) {
+			return roles[project], nil
+		},
+	}
+}
+
+func TestKfctlRouter_Authorize(t *testing.T) {
+	r := newRbacTestRouter(t, map[string]Role{
+		"acme":     RoleEditor,
+		"operator": RoleAdmin,
+		"other":    RoleViewer,
+	}, "")
+
+	req := newPlanTestKfDef()
+	if err := r.authorize(req, RoleViewer); err != nil {
+		t.Errorf("Editor denied the viewer role; %v", err)
+	}
+	if err := r.authorize(req, RoleEditor); err != nil {
+		t.Errorf("Editor denied the editor role; %v", err)
+	}
+	if hErr, ok := r.authorize(req, RoleAdmin).(*httpError); !ok || hErr.Code != http.StatusForbidden {
+		t.Errorf("Editor granted the admin role; want 403 got %v", hErr)
+	}
+
+	none := *req.DeepCopy()
+	none.Spec.Project = "unknown"
+	if hErr, ok := r.authorize(none, RoleViewer).(*httpError); !ok || hErr.Code != http.StatusUnauthorized {
+		t.Errorf("Caller without access granted the viewer role; want 401 got %v", hErr)
+	}
+
+	noToken := *req.DeepCopy()
+	noToken.Spec.Secrets = []kfdefsv3.Secret{}
+	if hErr, ok := r.authorize(noToken, RoleViewer).(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("Request without a token; want 400 got %v", hErr)
+	}
+
+	// Admins of the operator project are admins of every project.
+	r = newRbacTestRouter(t, map[string]Role{
+		"acme":     RoleEditor,
+		"operator": RoleAdmin,
+	}, "operator")
+	if err := r.authorize(req, RoleAdmin); err != nil {
+		t.Errorf("Operator denied the admin role; %v", err)
+	}
+}
+
+func TestKfctlRouter_AuthorizeAllProjects(t *testing.T) {
+	req := newPlanTestKfDef()
+	req.Spec.Project = "operator"
+	req.Annotations = map[string]string{AllProjectsAnnotation: "true"}
+	if !allProjects(req) {
+		t.Fatalf("allProjects: got false; want true")
+	}
+
+	r := newRbacTestRouter(t, map[string]Role{"operator": RoleAdmin}, "")
+	if err := r.authorizeAllProjects(req); err == nil {
+		t.Errorf("Listing every project allowed without an operator project")
+	}
+
+	r = newRbacTestRouter(t, map[string]Role{"operator": RoleAdmin}, "operator")
+	if err := r.authorizeAllProjects(req); err != nil {
+		t.Errorf("Operator admin denied listing every project; %v", err)
+	}
+
+	other := *req.DeepCopy()
+	other.Spec.Project = "acme"
+	r = newRbacTestRouter(t, map[string]Role{"operator": RoleAdmin, "acme": RoleAdmin}, "operator")
+	if err := r.authorizeAllProjects(other); err == nil {
+		t.Errorf("Listing every project allowed from a project other than the operator project")
+	}
+
+	r = newRbacTestRouter(t, map[string]Role{"operator": RoleEditor}, "operator")
+	if err := r.authorizeAllProjects(req); err == nil {
+		t.Errorf("Operator editor allowed to list every project")
+	}
+}
+
+func TestRoleCache(t *testing.T) {
+	calls := 0
+	roles := map[string]Role{"acme": RoleEditor}
+	projectRole := func(project string, ts oauth2.TokenSource) (Role, error) {
+		calls++
+		return roles[project], nil
+	}
+	c := newRoleCache()
+	now := time.Date(2019, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if role, err := c.get("acme", "token1", projectRole, now); err != nil || role != RoleEditor {
+			t.Errorf("get: got %v, %v; want editor", role, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("The role was tested %v times; want it cached after the first", calls)
+	}
+	if _, err := c.get("acme", "token2", projectRole, now); err != nil || calls != 2 {
+		t.Errorf("The role of another token was served from the cache")
+	}
+
+	// Callers without access aren't cached so they can be granted access.
+	c.get("other", "token1", projectRole, now)
+	roles["other"] = RoleViewer
+	if role, _ := c.get("other", "token1", projectRole, now); role != RoleViewer {
+		t.Errorf("get after access was granted: got %v; want viewer", role)
+	}
+
+	// The token has expired by then.
+	roles["acme"] = RoleAdmin
+	if role, _ := c.get("acme", "token1", projectRole, now.Add(accessTokenLifetime)); role != RoleAdmin {
+		t.Errorf("get once the token expired: got %v; want admin", role)
+	}
+}
+
+func TestKfctlRouter_UpdateMetadataDeletionProtection(t *testing.T) {
+	r := newRbacTestRouter(t, map[string]Role{"acme": RoleEditor}, "")
+	protect := false
+	_, err := r.UpdateMetadata(context.Background(), MetadataRequest{
+		KfDef:              newPlanTestKfDef(),
+		DeletionProtection: &protect,
+	})
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusForbidden {
+		t.Errorf("Editor changing the deletion protection: want 403 got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"context"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+)
+
+// ReadOnlyKfctlService is the subset of KfctlService which only reads deployments.
+type ReadOnlyKfctlService interface {
+	// GetLatestKfdef returns latest KfDef copy which include deployment status
+	GetLatestKfdef(kfdefs.KfDef) (*kfdefs.KfDef, error)
+	// GetErrorHistory returns the most recent errors encountered while handling the deployment.
+	GetErrorHistory(context.Context, kfdefs.KfDef) (*ErrorHistory, error)
+	// GetRunLog returns the log of the latest run of the deployment.
+	GetRunLog(context.Context, kfdefs.KfDef) (*RunLog, error)
+	// GetLogs returns a page of the recent output of the deployment.
+	GetLogs(context.Context, LogsRequest) (*LogPage, error)
+	// GetRevisionDiff returns the changes made by a revision of the deployment.
+	GetRevisionDiff(context.Context, RevisionDiffRequest) (*RevisionDiff, error)
+	// GetStats returns a summary of the recent runs of the deployments in a project.
+	GetStats(context.Context, StatsRequest) (*DeploymentStats, error)
+	// GetDurationTrends returns percentiles of the durations of the deployments in a project over time.
+	GetDurationTrends(context.Context, DurationTrendsRequest) (*DurationTrends, error)
+	// ListDeployments lists the deployments in the project of the request.
+	ListDeployments(context.Context, kfdefs.KfDef) (*DeploymentList, error)
+	// StreamDeployments lists the deployments in the project of the request one at a time.
+	StreamDeployments(context.Context, kfdefs.KfDef, func(DeploymentSummary) error) (int, error)
+	// ListDeploymentsTable lists the deployments in the project of the request as a table.
+	ListDeploymentsTable(context.Context, kfdefs.KfDef) (*Table, error)
+	// GetLatestKfdefTable returns the deployment as a table.
+	GetLatestKfdefTable(context.Context, kfdefs.KfDef) (*Table, error)
+}
+
+// ReadOnlyKfctlClient is a client to the KfctlServer which can get the status, events and list of
+// deployments but can't change them. It can be handed to dashboards and monitoring services.
+//
+// Only the endpoints of its methods are constructed so it can't send a request which creates or
+// deletes a deployment even if the underlying KfctlClient is reached.
+type ReadOnlyKfctlClient struct {
+	client *KfctlClient
+}
+
+// NewReadOnlyKfctlClient returns a ReadOnlyKfctlClient backed by an HTTP server living at the
+// remote instance. It takes the same options as NewKfctlClient.
+func NewReadOnlyKfctlClient(instance string, opts ...KfctlClientOption) (*ReadOnlyKfctlClient, error) {
+	c, f, err := newKfctlClientBase(instance, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The status is fetched from the get path since the create path would queue the request.
+	c.getEndpoint = f.endpoint("GetLatestKfdef", KfctlGetpath, decodeHTTPKfdefResponse)
+	c.getTableEndpoint = f.tableEndpoint("GetLatestKfdefTable", KfctlGetpath)
+	c.errorsEndpoint = f.endpoint("GetErrorHistory", KfctlErrorsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &ErrorHistory{} }))
+	c.runLogEndpoint = f.endpoint("GetRunLog", KfctlRunLogPath,
+		makeHTTPResponseDecoder(func() interface{} { return &RunLog{} }))
+	c.logsEndpoint = f.endpoint("GetLogs", KfctlLogsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &LogPage{} }))
+	c.revisionsEndpoint = f.endpoint("GetRevisionDiff", KfctlRevisionDiffPath,
+		makeHTTPResponseDecoder(func() interface{} { return &RevisionDiff{} }))
+	c.statsEndpoint = f.endpoint("GetStats", KfctlStatsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &DeploymentStats{} }))
+	c.trendsEndpoint = f.endpoint("GetDurationTrends", KfctlDurationTrendsPath,
+		makeHTTPResponseDecoder(func() interface{} { return &DurationTrends{} }))
+	c.listEndpoint = f.endpoint("ListDeployments", KfctlListPath,
+		makeHTTPResponseDecoder(func() interface{} { return &DeploymentList{} }))
+	c.listTableEndpoint = f.tableEndpoint("ListDeploymentsTable", KfctlListPath)
+
+	return &ReadOnlyKfctlClient{client: c}, nil
+}
+
+// GetLatestKfdef returns the latest KfDef of the deployment including its status.
+func (c *ReadOnlyKfctlClient) GetLatestKfdef(req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	return c.client.GetLatestKfdef(req)
+}
+
+func (c *ReadOnlyKfctlClient) getLatestKfdef(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	return c.client.getLatestKfdef(ctx, req)
+}
+
+// GetTypedKfdef returns the latest KfDef of the deployment with the specs of its plugins typed.
+func (c *ReadOnlyKfctlClient) GetTypedKfdef(req kfdefs.KfDef) (*TypedKfDef, error) {
+	return c.client.GetTypedKfdef(req)
+}
+
+// GetErrorHistory returns the most recent errors encountered by the server while handling the deployment.
+func (c *ReadOnlyKfctlClient) GetErrorHistory(ctx context.Context, req kfdefs.KfDef) (*ErrorHistory, error) {
+	return c.client.GetErrorHistory(ctx, req)
+}
+
+// GetRunLog returns the log of the latest run of the deployment at the verbosity it was requested with.
+func (c *ReadOnlyKfctlClient) GetRunLog(ctx context.Context, req kfdefs.KfDef) (*RunLog, error) {
+	return c.client.GetRunLog(ctx, req)
+}
+
+// GetLogs returns a page of the recent output of the deployment.
+func (c *ReadOnlyKfctlClient) GetLogs(ctx context.Context, req LogsRequest) (*LogPage, error) {
+	return c.client.GetLogs(ctx, req)
+}
+
+// GetRevisionDiff returns the changes made by a revision of the deployment.
+func (c *ReadOnlyKfctlClient) GetRevisionDiff(ctx context.Context, req RevisionDiffRequest) (*RevisionDiff, error) {
+	return c.client.GetRevisionDiff(ctx, req)
+}
+
+// GetStats returns a summary of the recent runs of the deployments in a project.
+func (c *ReadOnlyKfctlClient) GetStats(ctx context.Context, req StatsRequest) (*DeploymentStats, error) {
+	return c.client.GetStats(ctx, req)
+}
+
+// GetDurationTrends returns percentiles of the durations of the deployments in a project over time.
+func (c *ReadOnlyKfctlClient) GetDurationTrends(ctx context.Context, req DurationTrendsRequest) (*DurationTrends, error) {
+	return c.client.GetDurationTrends(ctx, req)
+}
+
+// ListDeployments lists the deployments in the project of the request.
+func (c *ReadOnlyKfctlClient) ListDeployments(ctx context.Context, req kfdefs.KfDef) (*DeploymentList, error) {
+	return c.client.ListDeployments(ctx, req)
+}
+
+// ListDeploymentsTable lists the deployments in the project of the request as a table.
+func (c *ReadOnlyKfctlClient) ListDeploymentsTable(ctx context.Context, req kfdefs.KfDef) (*Table, error) {
+	return c.client.ListDeploymentsTable(ctx, req)
+}
+
+// GetLatestKfdefTable returns the deployment as a table.
+func (c *ReadOnlyKfctlClient) GetLatestKfdefTable(ctx context.Context, req kfdefs.KfDef) (*Table, error) {
+	return c.client.GetLatestKfdefTable(ctx, req)
+}
+
+// StreamDeployments lists the deployments in the project of the request calling fn for each one
+// as it is received; it returns the number of kfctl servers that couldn't be queried.
+func (c *ReadOnlyKfctlClient) StreamDeployments(ctx context.Context, req kfdefs.KfDef, fn func(DeploymentSummary) error) (int, error) {
+	return c.client.StreamDeployments(ctx, req, fn)
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestReadOnlyKfctlClient(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		var response interface{}
+		switch r.URL.Path {
+		case KfctlGetpath:
+			d := &kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Name: "kf-app"}}
+			d.SetPluginSpec(gcp.GcpPluginName, &gcp.GcpPluginSpec{SAClientId: "admin@acme.com"})
+			response = d
+		case KfctlListPath:
+			response = &DeploymentList{}
+		case KfctlErrorsPath:
+			response = &ErrorHistory{}
+		default:
+			http.Error(w, "unexpected path", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	c, err := NewReadOnlyKfctlClient(server.URL)
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+	req := kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Name: "kf-app"}}
+	if d, err := c.GetLatestKfdef(req); err != nil || d.Name != "kf-app" {
+		t.Errorf("GetLatestKfdef: got %v, %v; want kf-app", d, err)
+	}
+	if d, err := c.GetTypedKfdef(req); err != nil {
+		t.Errorf("GetTypedKfdef failed; %v", err)
+	} else if p, ok := d.PluginSpecs[gcp.GcpPluginName].(*gcp.GcpPluginSpec); !ok || p.SAClientId != "admin@acme.com" {
+		t.Errorf("GetTypedKfdef: got plugin specs %v; want a GcpPluginSpec", d.PluginSpecs)
+	}
+	if _, err := c.ListDeployments(context.Background(), req); err != nil {
+		t.Errorf("ListDeployments failed; %v", err)
+	}
+	if _, err := c.GetErrorHistory(context.Background(), req); err != nil {
+		t.Errorf("GetErrorHistory failed; %v", err)
+	}
+	expected := []string{KfctlGetpath, KfctlGetpath, KfctlListPath, KfctlErrorsPath}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Client requested %v; want %v", paths, expected)
+	}
+
+	// Only the endpoints of the read-only methods are constructed.
+	if _, ok := interface{}(c).(KfctlService); ok {
+		t.Errorf("ReadOnlyKfctlClient implements KfctlService")
+	}
+	unsafe := map[string]interface{}{
+		"create":         c.client.createEndpoint,
+		"execute":        c.client.executeEndpoint,
+		"delete":         c.client.deleteEndpoint,
+		"prepareDelete":  c.client.prepareDeleteEndpoint,
+		"retry":          c.client.retryEndpoint,
+		"cancel":         c.client.cancelEndpoint,
+		"revokeUnused":   c.client.revokeUnusedEndpoint,
+		"oauthClient":    c.client.oauthClientEndpoint,
+		"share":          c.client.shareEndpoint,
+		"maintenanceRun": c.client.maintRunEndpoint,
+	}
+	for name, e := range unsafe {
+		if !reflect.ValueOf(e).IsNil() {
+			t.Errorf("The %v endpoint of the read-only client is set", name)
+		}
+	}
+	if c.client.exportURL != nil {
+		t.Errorf("The export URL of the read-only client is set")
+	}
+}
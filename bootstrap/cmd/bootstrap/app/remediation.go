@@ -0,0 +1,241 @@
+package app
+
+import (
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrorCode identifies a known cause of failure so clients can act on it without parsing messages.
+type ErrorCode string
+
+const (
+	// ErrorAPINotEnabled means an API the deployment uses isn't enabled in the project.
+	ErrorAPINotEnabled ErrorCode = "APINotEnabled"
+	// ErrorBillingDisabled means the project doesn't have a billing account.
+	ErrorBillingDisabled ErrorCode = "BillingDisabled"
+	// ErrorQuotaExceeded means a resource quota of the project is too low for the deployment.
+	ErrorQuotaExceeded ErrorCode = "QuotaExceeded"
+	// ErrorRateLimited means the requests to an API exceeded its rate quota.
+	ErrorRateLimited ErrorCode = "RateLimited"
+	// ErrorZoneExhausted means the zone doesn't have the capacity for the nodes of the cluster.
+	ErrorZoneExhausted ErrorCode = "ZoneResourcesExhausted"
+	// ErrorPermissionDenied means the credentials of the request lack an IAM permission.
+	ErrorPermissionDenied ErrorCode = "PermissionDenied"
+)
+
+// Remediation tells the user how to fix a failure with a known cause.
+type Remediation struct {
+	Summary string `json:"summary"`
+	// Role is the IAM role to grant; only set for PermissionDenied.
+	Role string `json:"role,omitempty"`
+	// Link is the page of the Cloud Console to fix the failure on.
+	Link string `json:"link,omitempty"`
+}
+
+// String returns the summary and the link of the remediation.
+func (r Remediation) String() string {
+	if r.Link == "" {
+		return r.Summary
+	}
+	return fmt.Sprintf("%v; see %v", r.Summary, r.Link)
+}
+
+// consoleURL returns the url of the page of the Cloud Console at path for project.
+func consoleURL(path string, project string) string {
+	return fmt.Sprintf("https://console.cloud.google.com/%v?project=%v", path, url.QueryEscape(project))
+}
+
+// remediationRule diagnoses the errors whose text matches pattern. Rules are tried in order so
+// the more specific ones come first e.g. an API which isn't enabled is also reported as denied.
+type remediationRule struct {
+	code    ErrorCode
+	pattern *regexp.Regexp
+	// remediate returns the remediation given the submatches of pattern.
+	remediate func(match []string, project string) Remediation
+}
+
+// remediationRules is the knowledge base of the known causes of failure.
+var remediationRules = []remediationRule{
+	{
+		code: ErrorAPINotEnabled,
+		// The service name of the API usually follows in the link to enable it.
+		pattern: regexp.MustCompile(`(?s)(?:has not been used in project|it is disabled|SERVICE_DISABLED|accessNotConfigured)(?:.*?([a-z0-9-]+\.googleapis\.com))?`),
+		remediate: func(match []string, project string) Remediation {
+			if api := match[1]; api != "" {
+				return Remediation{
+					Summary: fmt.Sprintf("Enable %v in the project and resubmit the deployment", api),
+					Link:    consoleURL("apis/library/"+api, project),
+				}
+			}
+			return Remediation{
+				Summary: "Enable the API in the project and resubmit the deployment",
+				Link:    consoleURL("apis/library", project),
+			}
+		},
+	},
+	{
+		code:    ErrorBillingDisabled,
+		pattern: regexp.MustCompile(`(?i)billing (?:is )?(?:not enabled|disabled)|requires billing to be enabled|BILLING_DISABLED`),
+		remediate: func(match []string, project string) Remediation {
+			return Remediation{
+				Summary: "Link the project to a billing account and resubmit the deployment",
+				Link:    consoleURL("billing/linkedaccount", project),
+			}
+		},
+	},
+	{
+		code:    ErrorQuotaExceeded,
+		pattern: regexp.MustCompile(`Quota '([A-Za-z0-9_-]+)' exceeded|resource "([A-Za-z0-9_-]+)": request requires`),
+		remediate: func(match []string, project string) Remediation {
+			metric := match[1] + match[2]
+			return Remediation{
+				Summary: fmt.Sprintf("Request an increase of quota %v or reduce the resources of the deployment", metric),
+				Link:    consoleURL("iam-admin/quotas", project),
+			}
+		},
+	},
+	{
+		code:    ErrorRateLimited,
+		pattern: regexp.MustCompile(`rateLimitExceeded|userRateLimitExceeded|RATE_LIMIT_EXCEEDED`),
+		remediate: func(match []string, project string) Remediation {
+			return Remediation{
+				Summary: "Resubmit the deployment later or request a higher rate quota for the API",
+				Link:    consoleURL("iam-admin/quotas", project),
+			}
+		},
+	},
+	{
+		code:    ErrorZoneExhausted,
+		pattern: regexp.MustCompile(`ZONE_RESOURCE_POOL_EXHAUSTED|does not have enough resources available`),
+		remediate: func(match []string, project string) Remediation {
+			return Remediation{
+				Summary: "Resubmit the deployment later or set fallbackZones in the GCP plugin spec",
+			}
+		},
+	},
+	{
+		code:    ErrorPermissionDenied,
+		pattern: regexp.MustCompile(`[Pp]ermission ['"]([a-z]+(?:\.[A-Za-z]+)+)['"] denied|Required ['"]([a-z]+(?:\.[A-Za-z]+)+)['"] permission`),
+		remediate: func(match []string, project string) Remediation {
+			return permissionRemediation(match[1]+match[2], project)
+		},
+	},
+}
+
+// permissionRoles are the predefined roles granting the permissions of a service or resource;
+// the longest prefix of a permission selects its role.
+var permissionRoles = map[string]string{
+	"cloudkms":                              "roles/cloudkms.admin",
+	"compute":                               "roles/compute.admin",
+	"container":                             "roles/container.admin",
+	"deploymentmanager":                     "roles/deploymentmanager.editor",
+	"dns":                                   "roles/dns.admin",
+	"iam.roles":                             "roles/iam.roleAdmin",
+	"iam.serviceAccountKeys":                "roles/iam.serviceAccountKeyAdmin",
+	"iam.serviceAccounts":                   "roles/iam.serviceAccountAdmin",
+	"iam.serviceAccounts.actAs":             "roles/iam.serviceAccountUser",
+	"iap":                                   "roles/iap.admin",
+	"resourcemanager.projects.get":          "roles/browser",
+	"resourcemanager.projects.getIamPolicy": "roles/iam.securityReviewer",
+	"resourcemanager.projects.setIamPolicy": "roles/resourcemanager.projectIamAdmin",
+	"servicemanagement":                     "roles/servicemanagement.admin",
+	"serviceusage":                          "roles/serviceusage.serviceUsageAdmin",
+	"storage":                               "roles/storage.admin",
+}
+
+// roleForPermission returns the predefined role to grant for permission; empty if it isn't known.
+func roleForPermission(permission string) string {
+	for p := permission; p != ""; {
+		if role, ok := permissionRoles[p]; ok {
+			return role
+		}
+		i := strings.LastIndex(p, ".")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return ""
+}
+
+// permissionRemediation returns how to grant permission to the caller.
+func permissionRemediation(permission string, project string) Remediation {
+	r := Remediation{
+		Summary: fmt.Sprintf("Grant the account deploying Kubeflow a role including %v and resubmit the deployment", permission),
+		Role:    roleForPermission(permission),
+		Link:    consoleURL("iam-admin/iam", project),
+	}
+	if r.Role != "" {
+		r.Summary = fmt.Sprintf("Grant the account deploying Kubeflow %v, which includes %v, and resubmit the deployment", r.Role, permission)
+	}
+	return r
+}
+
+// diagnose returns the code and the remediation of the first rule matching text; nil if none does.
+func diagnose(text string, project string) (ErrorCode, *Remediation) {
+	for _, rule := range remediationRules {
+		if match := rule.pattern.FindStringSubmatch(text); match != nil {
+			r := rule.remediate(match, project)
+			return rule.code, &r
+		}
+	}
+	return "", nil
+}
+
+// withRemediation returns err with the code and the remediation of its cause if the cause is
+// known. The message and the cause of the error are both checked since the errors of the GCP APIs
+// are usually only in the cause. err is returned unchanged otherwise.
+func withRemediation(err error, project string) error {
+	if err == nil {
+		return nil
+	}
+	hErr, ok := err.(*httpError)
+	if ok && hErr.ErrorCode != "" {
+		return err
+	}
+	text := err.Error()
+	if ok && hErr.cause != nil {
+		text += "\n" + hErr.cause.Error()
+	}
+	code, r := diagnose(text, project)
+	if r == nil {
+		return err
+	}
+	diagnosed := &httpError{
+		Message: err.Error(),
+		Code:    err2code(err),
+		cause:   err,
+	}
+	if ok {
+		copied := *hErr
+		diagnosed = &copied
+	}
+	diagnosed.ErrorCode = code
+	diagnosed.Remediation = r
+	return diagnosed
+}
+
+// setRemediationCondition reports the known cause of the failure of the deployment with how to
+// fix it. The condition is replaced with the status of the next run.
+func (s *kfctlServer) setRemediationCondition(err error) {
+	hErr, ok := err.(*httpError)
+	if !ok || hErr.Remediation == nil {
+		return
+	}
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.latestKfDef.Status.Conditions = append(s.latestKfDef.Status.Conditions, kfdefs.KfDefCondition{
+		Type:               kfdefs.KfFailed,
+		Status:             v1.ConditionTrue,
+		Reason:             string(hErr.ErrorCode),
+		Message:            hErr.Remediation.String(),
+		LastUpdateTime:     metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	})
+	s.publishStatus()
+}
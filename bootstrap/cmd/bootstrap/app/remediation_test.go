@@ -0,0 +1,134 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	type testCase struct {
+		text string
+		code ErrorCode
+		role string
+		link string
+	}
+
+	cases := []testCase{
+		{
+			text: "Cloud Resource Manager API has not been used in project 123 before or it is disabled. Enable it by visiting https://console.developers.google.com/apis/api/cloudresourcemanager.googleapis.com/overview?project=123",
+			code: ErrorAPINotEnabled,
+			link: "https://console.cloud.google.com/apis/library/cloudresourcemanager.googleapis.com?project=acme",
+		},
+		{
+			text: "Quota 'CPUS' exceeded.  Limit: 24.0 in region us-east1.",
+			code: ErrorQuotaExceeded,
+			link: "https://console.cloud.google.com/iam-admin/quotas?project=acme",
+		},
+		{
+			text: `Insufficient regional quota to satisfy request: resource "SSD_TOTAL_GB": request requires '500.0' and is short '100.0'`,
+			code: ErrorQuotaExceeded,
+			link: "https://console.cloud.google.com/iam-admin/quotas?project=acme",
+		},
+		{
+			text: "googleapi: Error 403: Permission 'iam.serviceAccounts.create' denied on resource (or it may not exist)., forbidden",
+			code: ErrorPermissionDenied,
+			role: "roles/iam.serviceAccountAdmin",
+			link: "https://console.cloud.google.com/iam-admin/iam?project=acme",
+		},
+		{
+			text: "Required 'compute.instances.create' permission for 'projects/acme/zones/us-east1-d/instances/kf-app'",
+			code: ErrorPermissionDenied,
+			role: "roles/compute.admin",
+			link: "https://console.cloud.google.com/iam-admin/iam?project=acme",
+		},
+		{
+			text: "The zone 'projects/acme/zones/us-east1-d' does not have enough resources available to fulfill the request.",
+			code: ErrorZoneExhausted,
+		},
+		{
+			text: "googleapi: Error 429: Quota exceeded for quota group 'default', rateLimitExceeded",
+			code: ErrorRateLimited,
+			link: "https://console.cloud.google.com/iam-admin/quotas?project=acme",
+		},
+		{
+			text: "Billing is disabled for project acme",
+			code: ErrorBillingDisabled,
+			link: "https://console.cloud.google.com/billing/linkedaccount?project=acme",
+		},
+		{
+			text: "kustomize build failed",
+		},
+	}
+
+	for _, c := range cases {
+		code, r := diagnose(c.text, "acme")
+		if code != c.code {
+			t.Errorf("diagnose(%q): got code %q; want %q", c.text, code, c.code)
+			continue
+		}
+		if c.code == "" {
+			if r != nil {
+				t.Errorf("diagnose(%q): got remediation %+v; want nil", c.text, r)
+			}
+			continue
+		}
+		if r == nil || r.Role != c.role || r.Link != c.link || r.Summary == "" {
+			t.Errorf("diagnose(%q): got %+v; want role %q and link %q", c.text, r, c.role, c.link)
+		}
+	}
+}
+
+func TestRoleForPermission(t *testing.T) {
+	cases := map[string]string{
+		"iam.serviceAccounts.actAs":             "roles/iam.serviceAccountUser",
+		"iam.serviceAccounts.create":            "roles/iam.serviceAccountAdmin",
+		"resourcemanager.projects.setIamPolicy": "roles/resourcemanager.projectIamAdmin",
+		"container.clusters.create":             "roles/container.admin",
+		"unknown.things.do":                     "",
+	}
+	for permission, expected := range cases {
+		if actual := roleForPermission(permission); actual != expected {
+			t.Errorf("roleForPermission(%v): got %q; want %q", permission, actual, expected)
+		}
+	}
+}
+
+func TestWithRemediation(t *testing.T) {
+	// The error of the API is only in the cause.
+	err := &httpError{
+		Message: "Could not create the cluster",
+		Code:    http.StatusInternalServerError,
+		cause:   fmt.Errorf("Quota 'CPUS' exceeded.  Limit: 24.0 in region us-east1."),
+	}
+	hErr, ok := withRemediation(err, "acme").(*httpError)
+	if !ok || hErr.ErrorCode != ErrorQuotaExceeded || hErr.Remediation == nil {
+		t.Fatalf("withRemediation: got %+v; want a QuotaExceeded error", hErr)
+	}
+	if hErr.Message != err.Message || hErr.Code != err.Code || err.Remediation != nil {
+		t.Errorf("withRemediation: got %+v; want a copy of %+v", hErr, err)
+	}
+
+	plain := fmt.Errorf("Permission 'container.clusters.create' denied")
+	hErr, ok = withRemediation(plain, "acme").(*httpError)
+	if !ok || hErr.ErrorCode != ErrorPermissionDenied || hErr.Message != plain.Error() || hErr.cause != plain {
+		t.Errorf("withRemediation of a plain error: got %+v", hErr)
+	}
+
+	unknown := fmt.Errorf("kustomize build failed")
+	if actual := withRemediation(unknown, "acme"); actual != unknown {
+		t.Errorf("withRemediation of an unknown error: got %v; want it unchanged", actual)
+	}
+}
+
+func TestKfctlRouter_AuthorizeRemediation(t *testing.T) {
+	r := newRbacTestRouter(t, map[string]Role{"acme": RoleViewer}, "")
+	hErr, ok := r.authorize(newPlanTestKfDef(), RoleAdmin).(*httpError)
+	if !ok || hErr.ErrorCode != ErrorPermissionDenied || hErr.Remediation == nil {
+		t.Fatalf("authorize: got %+v; want a PermissionDenied error", hErr)
+	}
+	if hErr.Remediation.Role != "roles/resourcemanager.projectIamAdmin" || !strings.Contains(hErr.Remediation.Link, "project=acme") {
+		t.Errorf("authorize: got remediation %+v", hErr.Remediation)
+	}
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+)
+
+// The limits of RequestLimitConfig named by a RequestLimitError.
+const (
+	LimitKfDefBytes      = "maxKfDefBytes"
+	LimitPlugins         = "maxPlugins"
+	LimitRequestDuration = "maxRequestDuration"
+)
+
+// RequestLimitConfig bounds the requests served by the kfctl servers and the router so a
+// pathological payload can't exhaust the service shared by all the deployments. A zero limit
+// isn't enforced.
+type RequestLimitConfig struct {
+	// MaxKfDefBytes bounds the size of the body of a request.
+	MaxKfDefBytes int64 `json:"maxKfDefBytes,omitempty"`
+	// MaxPlugins bounds the number of plugins of the KfDef sent in a request.
+	MaxPlugins int `json:"maxPlugins,omitempty"`
+	// MaxRequestDuration bounds how long a request is handled including streamed lists and
+	// exports. The context of the request is canceled once it passes so only the endpoints
+	// honoring it are stopped; the deployments queued by the requests aren't bounded.
+	MaxRequestDuration metav1.Duration `json:"maxRequestDuration,omitempty"`
+}
+
+func (l *RequestLimitConfig) validate() error {
+	if l.MaxKfDefBytes < 0 || l.MaxPlugins < 0 || l.MaxRequestDuration.Duration < 0 {
+		return fmt.Errorf("requestLimits must not be negative")
+	}
+	return nil
+}
+
+// RequestLimitError is returned when a request exceeds a limit of RequestLimitConfig. It is
+// served as a 413 if the request is too large and as a 408 if it took too long to handle.
+type RequestLimitError struct {
+	Message string
+	Code    int
+	// Limit is the exceeded limit e.g. LimitKfDefBytes.
+	Limit string
+}
+
+func (e *RequestLimitError) Error() string {
+	return e.Message
+}
+
+// StatusCode implements the StatusCoder interface of go-kit's http transport.
+func (e *RequestLimitError) StatusCode() int {
+	return e.Code
+}
+
+// MarshalJSON encodes the error like an httpError so older clients can still decode it.
+func (e *RequestLimitError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&validationPayload{
+		httpError: httpError{
+			Message: e.Message,
+			Code:    e.Code,
+		},
+		Limit: e.Limit,
+	})
+}
+
+// IsRequestLimitError returns true if err is a RequestLimitError.
+func IsRequestLimitError(err error) bool {
+	_, ok := err.(*RequestLimitError)
+	return ok
+}
+
+// requestLimitError returns the RequestLimitError sent in the response r with the decoded body p
+// or nil if r isn't a 413 or 408 naming a limit.
+func requestLimitError(r *http.Response, p *validationPayload) *RequestLimitError {
+	if (r.StatusCode != http.StatusRequestEntityTooLarge && r.StatusCode != http.StatusRequestTimeout) || p.Limit == "" {
+		return nil
+	}
+	return &RequestLimitError{
+		Message: p.Message,
+		Code:    r.StatusCode,
+		Limit:   p.Limit,
+	}
+}
+
+type requestLimitsKey struct{}
+
+// limitRequests returns a handler enforcing the request limits of the current config before
+// calling h. The body is read up to MaxKfDefBytes so a larger one is rejected before it is
+// decoded; the limits are stored in the context of the request for decodeBody and errorEncoder.
+func (s *serverConfigStore) limitRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := s.get().RequestLimits
+		if l == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if l.MaxKfDefBytes > 0 && r.Body != nil {
+			if r.ContentLength > l.MaxKfDefBytes {
+				rejectRequest(w, r, l.bodyTooLarge())
+				return
+			}
+			buf, err := ioutil.ReadAll(io.LimitReader(r.Body, l.MaxKfDefBytes+1))
+			r.Body.Close()
+			if err != nil {
+				rejectRequest(w, r, &httpError{
+					Message: fmt.Sprintf("Could not read the body of the request; %v", err),
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			if int64(len(buf)) > l.MaxKfDefBytes {
+				rejectRequest(w, r, l.bodyTooLarge())
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		}
+
+		ctx := context.WithValue(r.Context(), requestLimitsKey{}, l)
+		if l.MaxRequestDuration.Duration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, l.MaxRequestDuration.Duration)
+			defer cancel()
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// rejectRequest writes err as the response to r without handling it. The CORS headers are set
+// so browsers can show the error.
+func rejectRequest(w http.ResponseWriter, r *http.Request, err error) {
+	setCORSHeaders(w)
+	errorEncoder(r.Context(), err, w)
+}
+
+func (l *RequestLimitConfig) bodyTooLarge() *RequestLimitError {
+	return &RequestLimitError{
+		Message: fmt.Sprintf("The body of the request is larger than the limit of %v bytes of this service; remove the unused applications and plugins from the KfDef", l.MaxKfDefBytes),
+		Code:    http.StatusRequestEntityTooLarge,
+		Limit:   LimitKfDefBytes,
+	}
+}
+
+// checkRequestLimits returns a RequestLimitError if the KfDef of the request v decoded from the
+// request with the context ctx has more plugins than allowed.
+func checkRequestLimits(ctx context.Context, v interface{}) error {
+	l, ok := ctx.Value(requestLimitsKey{}).(*RequestLimitConfig)
+	d := requestKfDef(v)
+	if !ok || d == nil || l.MaxPlugins == 0 || len(d.Spec.Plugins) <= l.MaxPlugins {
+		return nil
+	}
+	return &RequestLimitError{
+		Message: fmt.Sprintf("The KfDef has %v plugins; this service accepts at most %v", len(d.Spec.Plugins), l.MaxPlugins),
+		Code:    http.StatusRequestEntityTooLarge,
+		Limit:   LimitPlugins,
+	}
+}
+
+// requestKfDef returns the KfDef of the request v decoded by decodeBody; nil if it has none.
+func requestKfDef(v interface{}) *kfdefs.KfDef {
+	switch r := v.(type) {
+	case *kfdefs.KfDef:
+		return r
+	case *ExecuteRequest:
+		return &r.KfDef
+	case *CloneRequest:
+		return &r.Source
+	case *ShareRequest:
+		return &r.KfDef
+	case *StatsRequest:
+		return &r.KfDef
+	case *DurationTrendsRequest:
+		return &r.KfDef
+	case *RevisionDiffRequest:
+		return &r.KfDef
+	case *LogsRequest:
+		return &r.KfDef
+	case *MaintenanceRequest:
+		return &r.KfDef
+	case *MaintenanceRunRequest:
+		return &r.KfDef
+	case *IamReportRequest:
+		return &r.KfDef
+	case *OAuthClientRequest:
+		return &r.KfDef
+	case *MetadataRequest:
+		return &r.KfDef
+	case *MigrationRequest:
+		return &r.KfDef
+	case *ReencryptionRequest:
+		return &r.KfDef
+	case *BackupRequest:
+		return &r.KfDef
+	case *RestoreRequest:
+		return &r.KfDef
+	case *GarbageCollectionRequest:
+		return &r.KfDef
+	default:
+		return nil
+	}
+}
+
+// durationLimitError returns a RequestLimitError if the request with the context ctx was stopped
+// because it exceeded MaxRequestDuration; err otherwise.
+func durationLimitError(ctx context.Context, err error) error {
+	l, ok := ctx.Value(requestLimitsKey{}).(*RequestLimitConfig)
+	if !ok || l.MaxRequestDuration.Duration == 0 || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	return &RequestLimitError{
+		Message: fmt.Sprintf("The request wasn't handled within the limit of %v of this service; retry it later", l.MaxRequestDuration.Duration),
+		Code:    http.StatusRequestTimeout,
+		Limit:   LimitRequestDuration,
+	}
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRequestLimitsTestHandler(t *testing.T, limits *RequestLimitConfig) http.Handler {
+	config := DefaultServerConfig()
+	config.RequestLimits = limits
+	store, err := newServerConfigStore("", config)
+	if err != nil {
+		t.Fatalf("newServerConfigStore: %v", err)
+	}
+	handler := httptransport.NewServer(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			d := request.(kfdefs.KfDef)
+			if d.Name == "slow" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &d, nil
+		},
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+	return store.limitRequests(optionsHandler(handler))
+}
+
+func TestLimitRequests(t *testing.T) {
+	type testCase struct {
+		name     string
+		body     string
+		chunked  bool
+		code     int
+		limit    string
+		limitsOf *RequestLimitConfig
+	}
+
+	limits := &RequestLimitConfig{
+		MaxKfDefBytes:      200,
+		MaxPlugins:         1,
+		MaxRequestDuration: metav1.Duration{Duration: 50 * time.Millisecond},
+	}
+	twoPlugins := `{"metadata": {"name": "kf-app"}, "spec": {"plugins": [{"name": "gcp"}, {"name": "basic-auth"}]}}`
+	cases := []testCase{
+		{
+			name:     "small",
+			body:     `{"metadata": {"name": "kf-app"}}`,
+			code:     http.StatusOK,
+			limitsOf: limits,
+		},
+		{
+			name:     "large",
+			body:     `{"metadata": {"name": "kf-app", "labels": {"a": "` + strings.Repeat("a", 200) + `"}}}`,
+			code:     http.StatusRequestEntityTooLarge,
+			limit:    LimitKfDefBytes,
+			limitsOf: limits,
+		},
+		{
+			// The length of a chunked body isn't known before it is read.
+			name:     "large-chunked",
+			body:     `{"metadata": {"name": "kf-app", "labels": {"a": "` + strings.Repeat("a", 200) + `"}}}`,
+			chunked:  true,
+			code:     http.StatusRequestEntityTooLarge,
+			limit:    LimitKfDefBytes,
+			limitsOf: limits,
+		},
+		{
+			name:     "plugins",
+			body:     twoPlugins,
+			code:     http.StatusRequestEntityTooLarge,
+			limit:    LimitPlugins,
+			limitsOf: limits,
+		},
+		{
+			name:     "slow",
+			body:     `{"metadata": {"name": "slow"}}`,
+			code:     http.StatusRequestTimeout,
+			limit:    LimitRequestDuration,
+			limitsOf: limits,
+		},
+		{
+			name: "unlimited",
+			body: twoPlugins,
+			code: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		h := newRequestLimitsTestHandler(t, c.limitsOf)
+		r := httptest.NewRequest("POST", KfctlGetpath, strings.NewReader(c.body))
+		if c.chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("Case %v: got status %v; want %v; body %v", c.name, w.Code, c.code, w.Body.String())
+			continue
+		}
+		if c.limit == "" {
+			continue
+		}
+		if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Errorf("Case %v: the CORS headers aren't set", c.name)
+		}
+		p := validationPayload{}
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Errorf("Case %v: could not decode the error; %v", c.name, err)
+			continue
+		}
+		if p.Limit != c.limit || p.Code != c.code || p.Message == "" {
+			t.Errorf("Case %v: got error %+v; want limit %v", c.name, p, c.limit)
+		}
+	}
+}
+
+func TestCheckRequestLimits_WrappedRequests(t *testing.T) {
+	ctx := context.WithValue(context.Background(), requestLimitsKey{}, &RequestLimitConfig{MaxPlugins: 1})
+	d := newPlanTestKfDef()
+	d.Spec.Plugins = []kfdefs.Plugin{{Name: "gcp"}, {Name: "basic-auth"}}
+
+	requests := []interface{}{
+		&d,
+		&ExecuteRequest{KfDef: d},
+		&CloneRequest{Source: d},
+		&ShareRequest{KfDef: d},
+		&MaintenanceRunRequest{KfDef: d},
+		&RestoreRequest{KfDef: d},
+	}
+	for _, r := range requests {
+		err := checkRequestLimits(ctx, r)
+		if lErr, ok := err.(*RequestLimitError); !ok || lErr.Limit != LimitPlugins {
+			t.Errorf("checkRequestLimits(%T): got %v; want the plugins limit", r, err)
+		}
+	}
+	if err := checkRequestLimits(ctx, &VersionsRequest{}); err != nil {
+		t.Errorf("checkRequestLimits of a request without a KfDef: got %v; want nil", err)
+	}
+}
+
+func TestRequestLimitError_RoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorEncoder(context.Background(), &RequestLimitError{
+			Message: "The KfDef has 3 plugins; this service accepts at most 2",
+			Code:    http.StatusRequestEntityTooLarge,
+			Limit:   LimitPlugins,
+		}, w)
+	}))
+	defer server.Close()
+
+	for _, decode := range []httptransport.DecodeResponseFunc{
+		decodeHTTPKfdefResponse,
+		makeHTTPResponseDecoder(func() interface{} { return &LintResult{} }),
+	} {
+		res, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Get failed; %v", err)
+		}
+		_, err = decode(context.Background(), res)
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		l, ok := err.(*RequestLimitError)
+		if !ok {
+			t.Fatalf("decode: got %v; want a RequestLimitError", err)
+		}
+		if l.Limit != LimitPlugins || l.Code != http.StatusRequestEntityTooLarge || !strings.Contains(l.Message, "at most 2") {
+			t.Errorf("decode: got %+v", l)
+		}
+	}
+}
+
+func TestRequestLimitConfig_validate(t *testing.T) {
+	config := DefaultServerConfig()
+	config.RequestLimits = &RequestLimitConfig{MaxPlugins: -1}
+	if err := config.validate(); err == nil {
+		t.Errorf("validate accepted a negative limit")
+	}
+	config.RequestLimits = &RequestLimitConfig{MaxKfDefBytes: 1 << 20}
+	if err := config.validate(); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// KfctlRetryFailedAppsPath is the path on which to serve requests to retry the failed applications
+const KfctlRetryFailedAppsPath = "/kfctl/apps/v1alpha2/retryFailedApps"
+
+// retryAppsAnnotation is set on a queued request to apply only the listed applications.
+// The applications are comma separated.
+const retryAppsAnnotation = "kfctl.kubeflow.org/retry-apps"
+
+// setRetryApps marks the request as a retry of the named applications.
+func setRetryApps(r *kfdefs.KfDef, apps []string) {
+	if r.Annotations == nil {
+		r.Annotations = map[string]string{}
+	}
+	r.Annotations[retryAppsAnnotation] = strings.Join(apps, ",")
+}
+
+// takeRetryApps returns the applications the request retries and removes the annotation.
+// It returns nil if the request isn't a retry.
+func takeRetryApps(r *kfdefs.KfDef) []string {
+	v, ok := r.Annotations[retryAppsAnnotation]
+	if !ok {
+		return nil
+	}
+	delete(r.Annotations, retryAppsAnnotation)
+	return strings.Split(v, ",")
+}
+
+// RetryFailedApps reapplies the applications which failed the last time the deployment was applied.
+// The other phases of the deployment aren't rerun and the other applications aren't touched.
+func (s *kfctlServer) RetryFailedApps(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if s.isDraining() {
+		return nil, drainingError()
+	}
+
+	if s.deploysToGcp() {
+		if err := s.verifyAccess(req); err != nil {
+			return nil, err
+		}
+	}
+
+	s.kfDefMux.Lock()
+	latest := s.latestKfDef.DeepCopy()
+	busy := s.busy
+	s.kfDefMux.Unlock()
+
+	if latest.Name == "" || latest.Name != req.Name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	if busy {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v is being applied; retry the failed applications once it finishes", req.Name),
+			Code:    http.StatusConflict,
+		}
+	}
+
+	failed := latest.FailedApplications()
+	if len(failed) == 0 {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v doesn't have any failed applications", req.Name),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	log.Infof("Retrying applications %v of %v", strings.Join(failed, ", "), req.Name)
+	retry := req.DeepCopy()
+	prepareSecrets(retry)
+	setRetryApps(retry, failed)
+	setDeadline(ctx, retry)
+	s.c <- *retry
+
+	return latest, nil
+}
+
+// RetryFailedApps forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) RetryFailedApps(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleEditor); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.RetryFailedApps(ctx, req)
+}
+
+// RetryFailedApps reapplies the applications which failed the last time the deployment was applied.
+func (c *KfctlClient) RetryFailedApps(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	var resp interface{}
+	err := c.retry("RetryFailedApps", func() error {
+		var err error
+		resp, err = c.retryEndpoint(ctx, req)
+		if hErr, ok := err.(*httpError); ok && hErr.Code >= 400 && hErr.Code < 500 {
+			// There's nothing to retry or the deployment is busy; retrying the request won't help.
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kfdefs.KfDef)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeRetryFailedAppsEndpoint creates an endpoint to handle requests to retry the failed applications.
+func makeRetryFailedAppsEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.RetryFailedApps(ctx, req)
+	}
+}
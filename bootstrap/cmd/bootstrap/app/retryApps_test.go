@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRetryAppsAnnotation(t *testing.T) {
+	d := &kfdefsv3.KfDef{}
+	if apps := takeRetryApps(d); apps != nil {
+		t.Errorf("Got %v; want nil for a request that isn't a retry", apps)
+	}
+
+	setRetryApps(d, []string{"jupyter", "katib"})
+	apps := takeRetryApps(d)
+	if !reflect.DeepEqual(apps, []string{"jupyter", "katib"}) {
+		t.Errorf("Got %v; want [jupyter katib]", apps)
+	}
+	if _, ok := d.Annotations[retryAppsAnnotation]; ok {
+		t.Errorf("takeRetryApps didn't remove the annotation")
+	}
+}
+
+func TestKfctlServer_RetryFailedApps(t *testing.T) {
+	latest := newPlanTestKfDef()
+	s := &kfctlServer{
+		c:             make(chan kfdefsv3.KfDef, 1),
+		latestKfDef:   latest,
+		targetCluster: &rest.Config{},
+	}
+
+	// Nothing failed so there's nothing to retry.
+	_, err := s.RetryFailedApps(context.Background(), newPlanTestKfDef())
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("Got error %v; want bad request", err)
+	}
+
+	other := newPlanTestKfDef()
+	other.Name = "other"
+	_, err = s.RetryFailedApps(context.Background(), other)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("Got error %v; want not found", err)
+	}
+
+	s.latestKfDef.SetApplicationStatus(kfdefsv3.ApplicationStatus{
+		Name:  "jupyter",
+		State: kfdefsv3.ApplicationFailed,
+	})
+	s.latestKfDef.SetApplicationStatus(kfdefsv3.ApplicationStatus{
+		Name:  "katib",
+		State: kfdefsv3.ApplicationApplied,
+	})
+
+	s.busy = true
+	_, err = s.RetryFailedApps(context.Background(), newPlanTestKfDef())
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusConflict {
+		t.Errorf("Got error %v; want conflict", err)
+	}
+	s.busy = false
+
+	if _, err := s.RetryFailedApps(context.Background(), newPlanTestKfDef()); err != nil {
+		t.Fatalf("RetryFailedApps failed; %v", err)
+	}
+	queued := <-s.c
+	if apps := takeRetryApps(&queued); !reflect.DeepEqual(apps, []string{"jupyter"}) {
+		t.Errorf("Got retry of %v; want [jupyter]", apps)
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// RetryBudget bounds the aggregate rate of retries across all methods of a KfctlClient.
+//
+// Every retry takes a token from the bucket; the initial attempt of a request is free.
+// When the bucket is empty requests fail instead of retrying so that a client polling
+// an unavailable server doesn't multiply the load on it.
+// A RetryBudget can be shared by several clients using WithRetryBudget.
+type RetryBudget struct {
+	limiter *rate.Limiter
+}
+
+// NewRetryBudget returns a budget allowing bursts of burst retries refilled at rate r.
+func NewRetryBudget(r rate.Limit, burst int) *RetryBudget {
+	return &RetryBudget{
+		limiter: rate.NewLimiter(r, burst),
+	}
+}
+
+// defaultRetryBudget is the budget used when WithRetryBudget isn't supplied.
+// It allows a burst of 30 retries, enough for a single CreateDeployment using the
+// default backoff, refilled at one retry every 2 seconds.
+func defaultRetryBudget() *RetryBudget {
+	return NewRetryBudget(rate.Every(2*time.Second), 30)
+}
+
+// allow takes a token from the budget if one is available.
+func (b *RetryBudget) allow() bool {
+	return b.limiter.Allow()
+}
+
+// maxRetryBudgets bounds the budgets kept by the router. Idle kfctl servers are garbage collected
+// by another process so the budget of the server used least recently is dropped to make room.
+const maxRetryBudgets = 1000
+
+// retryBudgets keeps a RetryBudget per kfctl server so an outage of the server of one deployment
+// doesn't use up the retries of the requests to the others.
+type retryBudgets struct {
+	mu sync.Mutex
+	// max is the number of budgets kept.
+	max int
+	// budgets are keyed by the address of the kfctl server; the elements hold a *retryBudgetEntry.
+	budgets map[string]*list.Element
+	// lru orders the budgets from the most to the least recently used.
+	lru *list.List
+}
+
+// retryBudgetEntry is the budget of the kfctl server at address.
+type retryBudgetEntry struct {
+	address string
+	budget  *RetryBudget
+}
+
+// newRetryBudgets returns an empty set of budgets.
+func newRetryBudgets() *retryBudgets {
+	return &retryBudgets{
+		max:     maxRetryBudgets,
+		budgets: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// get returns the budget of the kfctl server at address creating it if needed. If there are max
+// budgets the least recently used one is dropped; it is full again if its server is called later.
+func (b *retryBudgets) get(address string) *RetryBudget {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.budgets[address]; ok {
+		b.lru.MoveToFront(e)
+		return e.Value.(*retryBudgetEntry).budget
+	}
+	if b.lru.Len() >= b.max {
+		oldest := b.lru.Back()
+		b.lru.Remove(oldest)
+		delete(b.budgets, oldest.Value.(*retryBudgetEntry).address)
+	}
+	budget := defaultRetryBudget()
+	b.budgets[address] = b.lru.PushFront(&retryBudgetEntry{address: address, budget: budget})
+	return budget
+}
+
+// WithRetryBudget sets the budget shared by the retries of all methods of the client.
+func WithRetryBudget(b *RetryBudget) KfctlClientOption {
+	return func(o *kfctlClientOptions) {
+		o.retryBudget = b
+	}
+}
+
+// RetryBudgetExhaustedError is returned when a request failed and the retry budget didn't allow retrying it.
+type RetryBudgetExhaustedError struct {
+	Method string
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *RetryBudgetExhaustedError) Error() string {
+	return fmt.Sprintf("%v failed and the client retry budget is exhausted; last error: %v", e.Method, e.Err)
+}
+
+// budgetBackOff is a backoff.BackOff which stops retrying when the budget is exhausted.
+// It waits at least as long as an overloaded server asked for before the next retry.
+type budgetBackOff struct {
+	backoff.BackOff
+	budget    *RetryBudget
+	exhausted bool
+	// retryAfter is the Retry-After of the last attempt if the server was overloaded.
+	retryAfter time.Duration
+}
+
+func (b *budgetBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop {
+		return next
+	}
+	if !b.budget.allow() {
+		b.exhausted = true
+		return backoff.Stop
+	}
+	if next < b.retryAfter {
+		next = b.retryAfter
+	}
+	return next
+}
+
+// retry calls op until it succeeds using the client's backoff policy and retry budget.
+func (c *KfctlClient) retry(method string, op backoff.Operation) error {
+	bo := &budgetBackOff{
+		BackOff: c.newBackOff(),
+		budget:  c.retryBudget,
+	}
+
+	err := backoff.RetryNotify(func() error {
+		err := op()
+		bo.retryAfter = 0
+		if o, ok := err.(*OverloadedError); ok {
+			bo.retryAfter = o.RetryAfter
+		}
+		return err
+	}, bo, c.notifyRetry(method))
+	if err != nil && bo.exhausted {
+		log.Warnf("Not retrying %v; retry budget exhausted", method)
+		return &RetryBudgetExhaustedError{
+			Method: method,
+			Err:    err,
+		}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"github.com/cenkalti/backoff"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"golang.org/x/time/rate"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestKfctlClient_RetryBudget(t *testing.T) {
+	svc := &fakeKfctlService{}
+	server := newFakeKfctlServer(svc)
+	defer server.Close()
+
+	// The server is down; every request fails.
+	faults := &FaultInjector{
+		Rates: map[FaultType]float64{
+			FaultServerError: 1,
+		},
+	}
+
+	// The budget is shared by both methods and doesn't refill during the test.
+	budget := NewRetryBudget(rate.Every(time.Hour), 3)
+
+	c, err := NewKfctlClient(server.URL,
+		WithHTTPClient(&http.Client{Transport: faults.Transport(nil)}),
+		WithRetryBudget(budget),
+		WithRetryBackOff(func() backoff.BackOff {
+			return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 10)
+		}))
+
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+
+	_, err = c.CreateDeployment(context.Background(), kfdefsv3.KfDef{})
+	if _, ok := err.(*RetryBudgetExhaustedError); !ok {
+		t.Errorf("CreateDeployment: want RetryBudgetExhaustedError; got %v", err)
+	}
+
+	// The initial attempt plus 3 retries.
+	if faults.Requests() != 4 {
+		t.Errorf("Injector saw %v requests; want 4", faults.Requests())
+	}
+
+	// The budget is exhausted so the next request shouldn't retry.
+	_, err = c.CreateDeployment(context.Background(), kfdefsv3.KfDef{})
+	if _, ok := err.(*RetryBudgetExhaustedError); !ok {
+		t.Errorf("CreateDeployment: want RetryBudgetExhaustedError; got %v", err)
+	}
+
+	if faults.Requests() != 5 {
+		t.Errorf("Injector saw %v requests; want 5", faults.Requests())
+	}
+}
+
+func TestRetryBudgets_PerServer(t *testing.T) {
+	b := newRetryBudgets()
+	acme := b.get(serviceAddress("kf-app-acme", "kubeflow"))
+	for acme.allow() {
+	}
+	if b.get(serviceAddress("kf-app-acme", "kubeflow")) != acme {
+		t.Errorf("get returned a new budget for the same server")
+	}
+	if !b.get(serviceAddress("kf-app-other", "kubeflow")).allow() {
+		t.Errorf("The exhausted budget of one server stopped the retries to another")
+	}
+}
+
+func TestRetryBudgets_DropsLeastRecentlyUsed(t *testing.T) {
+	b := newRetryBudgets()
+	b.max = 2
+	acme := b.get(serviceAddress("kf-app-acme", "kubeflow"))
+	other := b.get(serviceAddress("kf-app-other", "kubeflow"))
+	b.get(serviceAddress("kf-app-acme", "kubeflow"))
+	b.get(serviceAddress("kf-app-third", "kubeflow"))
+
+	if len(b.budgets) != 2 || b.lru.Len() != 2 {
+		t.Errorf("Got %v budgets; want 2", len(b.budgets))
+	}
+	if b.get(serviceAddress("kf-app-acme", "kubeflow")) != acme {
+		t.Errorf("The budget used recently was dropped")
+	}
+	if b.get(serviceAddress("kf-app-other", "kubeflow")) == other {
+		t.Errorf("The budget used least recently was kept")
+	}
+}
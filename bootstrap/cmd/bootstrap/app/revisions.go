@@ -0,0 +1,359 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KfctlRevisionDiffPath is the path on which to serve revision diff requests
+const KfctlRevisionDiffPath = "/kfctl/apps/v1alpha2/revisions/diff"
+
+// revisionHistoryFile is the name of the file in the apps directory in which the revisions are persisted.
+const revisionHistoryFile = ".revision_history.json"
+
+// defaultMaxRevisions is the number of revisions retained per deployment.
+const defaultMaxRevisions = 50
+
+// SpecChangeOp is the kind of a change to a field of the KfDef spec.
+type SpecChangeOp string
+
+const (
+	SpecFieldAdded   SpecChangeOp = "added"
+	SpecFieldRemoved SpecChangeOp = "removed"
+	SpecFieldChanged SpecChangeOp = "changed"
+)
+
+// SpecChange is a change to a single field of the KfDef spec.
+type SpecChange struct {
+	// Path is the path of the field in the spec e.g. applications[name=jupyter].kustomizeConfig.
+	// Elements of lists of named objects are identified by their name rather than their index.
+	Path string       `json:"path"`
+	Op   SpecChangeOp `json:"op"`
+	Old  interface{}  `json:"old,omitempty"`
+	New  interface{}  `json:"new,omitempty"`
+}
+
+// Revision is an update of the spec of a deployment.
+type Revision struct {
+	// Number increases by one with each update; the first request for a deployment is revision 1.
+	Number int       `json:"number"`
+	Time   time.Time `json:"time"`
+	// Changes are the changes to the spec of the previous revision.
+	Changes []SpecChange `json:"changes"`
+}
+
+// RevisionDiffRequest asks for the changes made by a revision of a deployment.
+type RevisionDiffRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// Revision is the number of the revision; defaults to the latest.
+	Revision int `json:"revision,omitempty"`
+}
+
+// RevisionDiff is the changes made by a revision of a deployment.
+type RevisionDiff struct {
+	Name     string `json:"name"`
+	Revision `json:",inline"`
+	// Latest is the number of the latest revision of the deployment.
+	Latest int `json:"latest"`
+}
+
+// deploymentRevisions is the spec of the latest revision of a deployment and its revisions; oldest first.
+type deploymentRevisions struct {
+	Spec      kfdefs.KfDefSpec `json:"spec"`
+	Revisions []Revision       `json:"revisions"`
+}
+
+// revisionHistory keeps the last maxRevisions revisions for each deployment and persists them to a file.
+type revisionHistory struct {
+	mu           sync.Mutex
+	file         string
+	maxRevisions int
+	deployments  map[string]*deploymentRevisions
+}
+
+// newRevisionHistory creates a revisionHistory persisted in file.
+// If file exists the revisions are loaded from it.
+func newRevisionHistory(file string, maxRevisions int) *revisionHistory {
+	h := &revisionHistory{
+		file:         file,
+		maxRevisions: maxRevisions,
+		deployments:  map[string]*deploymentRevisions{},
+	}
+	h.load()
+	return h
+}
+
+// load replaces the revisions with the ones persisted in file e.g. by the leader of a standby
+// replica. The revisions are kept if file can't be read.
+func (h *revisionHistory) load() {
+	if h.file == "" {
+		return
+	}
+
+	buf, err := stateKeys.readFile(h.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read revision history %v; error %v", h.file, err)
+		}
+		return
+	}
+
+	deployments := map[string]*deploymentRevisions{}
+	if err := json.Unmarshal(buf, &deployments); err != nil {
+		log.Warnf("Could not parse revision history %v; error %v", h.file, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deployments = deployments
+}
+
+// record adds a revision for the named deployment if spec differs from the spec of its latest
+// revision. It returns the revision or nil if the spec didn't change.
+func (h *revisionHistory) record(name string, spec kfdefs.KfDefSpec) (*Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	d, ok := h.deployments[name]
+	if !ok {
+		d = &deploymentRevisions{}
+	}
+	changes, err := diffSpecs(&d.Spec, &spec)
+	if err != nil {
+		return nil, err
+	}
+	if ok && len(changes) == 0 {
+		return nil, nil
+	}
+
+	number := 1
+	if len(d.Revisions) > 0 {
+		number = d.Revisions[len(d.Revisions)-1].Number + 1
+	}
+	r := Revision{
+		Number:  number,
+		Time:    time.Now(),
+		Changes: changes,
+	}
+	d.Spec = *spec.DeepCopy()
+	d.Revisions = append(d.Revisions, r)
+	if len(d.Revisions) > h.maxRevisions {
+		d.Revisions = d.Revisions[len(d.Revisions)-h.maxRevisions:]
+	}
+	h.deployments[name] = d
+
+	if err := h.save(); err != nil {
+		log.Errorf("Could not persist revision history; %v", err)
+	}
+	return &r, nil
+}
+
+// get returns the numbered revision of the named deployment or the latest one if number is 0.
+func (h *revisionHistory) get(name string, number int) (*RevisionDiff, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	d, ok := h.deployments[name]
+	if !ok || len(d.Revisions) == 0 {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v has no revisions", name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	latest := d.Revisions[len(d.Revisions)-1].Number
+	if number == 0 {
+		number = latest
+	}
+	for _, r := range d.Revisions {
+		if r.Number != number {
+			continue
+		}
+		diff := &RevisionDiff{
+			Name:     name,
+			Revision: r,
+			Latest:   latest,
+		}
+		diff.Changes = make([]SpecChange, len(r.Changes))
+		copy(diff.Changes, r.Changes)
+		return diff, nil
+	}
+	return nil, &httpError{
+		Message: fmt.Sprintf("Revision %v of deployment %v not found; the oldest revision retained is %v",
+			number, name, d.Revisions[0].Number),
+		Code: http.StatusNotFound,
+	}
+}
+
+// save writes the history to file; callers must hold mu.
+func (h *revisionHistory) save() error {
+	if h.file == "" {
+		return nil
+	}
+	buf, err := json.Marshal(h.deployments)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return stateKeys.writeFile(h.file, buf)
+}
+
+// diffSpecs returns the changes from the spec before to the spec after an update. The specs are
+// compared as JSON so the paths match the fields users write in their KfDef.
+func diffSpecs(before *kfdefs.KfDefSpec, after *kfdefs.KfDefSpec) ([]SpecChange, error) {
+	var beforeValue, afterValue interface{}
+	for _, v := range []struct {
+		spec  *kfdefs.KfDefSpec
+		value *interface{}
+	}{{before, &beforeValue}, {after, &afterValue}} {
+		buf, err := json.Marshal(v.spec)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := json.Unmarshal(buf, v.value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	changes := []SpecChange{}
+	diffValues("", beforeValue, afterValue, &changes)
+	return changes, nil
+}
+
+// diffValues appends the changes from before to after at path to changes.
+func diffValues(path string, before interface{}, after interface{}, changes *[]SpecChange) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	switch {
+	case before == nil:
+		*changes = append(*changes, SpecChange{Path: path, Op: SpecFieldAdded, New: after})
+		return
+	case after == nil:
+		*changes = append(*changes, SpecChange{Path: path, Op: SpecFieldRemoved, Old: before})
+		return
+	}
+
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		keys := map[string]bool{}
+		for k := range beforeMap {
+			keys[k] = true
+		}
+		for k := range afterMap {
+			keys[k] = true
+		}
+		sorted := []string{}
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diffValues(child, beforeMap[k], afterMap[k], changes)
+		}
+		return
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList {
+		beforeNamed, beforeOk := namedElements(beforeList)
+		afterNamed, afterOk := namedElements(afterList)
+		if beforeOk && afterOk {
+			// Match the elements by name so inserting an element doesn't show up as changes to
+			// all the elements after it.
+			for _, e := range beforeNamed {
+				diffValues(fmt.Sprintf("%v[name=%v]", path, e.name), e.value, lookupNamed(afterNamed, e.name), changes)
+			}
+			for _, e := range afterNamed {
+				if lookupNamed(beforeNamed, e.name) == nil {
+					diffValues(fmt.Sprintf("%v[name=%v]", path, e.name), nil, e.value, changes)
+				}
+			}
+			return
+		}
+		for i := 0; i < len(beforeList) || i < len(afterList); i++ {
+			var o, n interface{}
+			if i < len(beforeList) {
+				o = beforeList[i]
+			}
+			if i < len(afterList) {
+				n = afterList[i]
+			}
+			diffValues(fmt.Sprintf("%v[%v]", path, i), o, n, changes)
+		}
+		return
+	}
+
+	*changes = append(*changes, SpecChange{Path: path, Op: SpecFieldChanged, Old: before, New: after})
+}
+
+// namedElement is an element of a list of objects with unique names.
+type namedElement struct {
+	name  string
+	value interface{}
+}
+
+// namedElements returns the elements of the list with their names; false if an element isn't an
+// object with a name or the names aren't unique.
+func namedElements(list []interface{}) ([]namedElement, bool) {
+	elements := []namedElement{}
+	seen := map[string]bool{}
+	for _, v := range list {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || name == "" || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		elements = append(elements, namedElement{name: name, value: v})
+	}
+	return elements, true
+}
+
+// lookupNamed returns the value of the named element or nil.
+func lookupNamed(elements []namedElement, name string) interface{} {
+	for _, e := range elements {
+		if e.name == name {
+			return e.value
+		}
+	}
+	return nil
+}
+
+// makeRevisionDiffEndpoint creates an endpoint to handle revision diff requests.
+func makeRevisionDiffEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RevisionDiffRequest)
+		return svc.GetRevisionDiff(ctx, req)
+	}
+}
+
+// decodeHTTPRevisionDiffRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded RevisionDiffRequest from the HTTP request body.
+func decodeHTTPRevisionDiffRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request RevisionDiffRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding revision diff request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	before := &kfdefsv3.KfDefSpec{
+		Project: "my-project",
+		Zone:    "us-east1-d",
+		Applications: []kfdefsv3.Application{
+			{Name: "jupyter"},
+			{Name: "katib"},
+		},
+	}
+	after := &kfdefsv3.KfDefSpec{
+		Project:  "my-project",
+		Zone:     "us-central1-a",
+		Hostname: "kf.acme.com",
+		Applications: []kfdefsv3.Application{
+			{Name: "pipelines"},
+			{Name: "jupyter"},
+		},
+	}
+
+	actual, err := diffSpecs(before, after)
+	if err != nil {
+		t.Fatalf("diffSpecs failed; %v", err)
+	}
+	expected := []SpecChange{
+		{Path: "applications[name=katib]", Op: SpecFieldRemoved, Old: map[string]interface{}{"name": "katib"}},
+		{Path: "applications[name=pipelines]", Op: SpecFieldAdded, New: map[string]interface{}{"name": "pipelines"}},
+		{Path: "hostname", Op: SpecFieldAdded, New: "kf.acme.com"},
+		{Path: "zone", Op: SpecFieldChanged, Old: "us-east1-d", New: "us-central1-a"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("diffSpecs: got\n%v\nwant\n%v", PrettyPrint(actual), PrettyPrint(expected))
+	}
+
+	if actual, err := diffSpecs(after, after.DeepCopy()); err != nil || len(actual) != 0 {
+		t.Errorf("diffSpecs of equal specs: got %v, %v; want no changes", actual, err)
+	}
+}
+
+func TestRevisionHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revisionHistory")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, revisionHistoryFile)
+	h := newRevisionHistory(file, 2)
+
+	spec := kfdefsv3.KfDefSpec{Project: "my-project", Zone: "us-east1-d"}
+	if r, err := h.record("kf-app", spec); err != nil || r == nil || r.Number != 1 {
+		t.Fatalf("record of a new deployment: got %v, %v; want revision 1", r, err)
+	}
+	// Resubmitting the same spec e.g. to retry isn't a revision.
+	if r, err := h.record("kf-app", spec); err != nil || r != nil {
+		t.Errorf("record of an unchanged spec: got %v, %v; want no revision", r, err)
+	}
+	for _, zone := range []string{"us-central1-a", "us-west1-b"} {
+		spec.Zone = zone
+		if _, err := h.record("kf-app", spec); err != nil {
+			t.Fatalf("record failed; %v", err)
+		}
+	}
+
+	// Reload from the file to verify the revisions are persisted.
+	reloaded := newRevisionHistory(file, 2)
+	for _, hist := range []*revisionHistory{h, reloaded} {
+		latest, err := hist.get("kf-app", 0)
+		if err != nil {
+			t.Fatalf("get of the latest revision failed; %v", err)
+		}
+		expected := []SpecChange{{Path: "zone", Op: SpecFieldChanged, Old: "us-central1-a", New: "us-west1-b"}}
+		if latest.Number != 3 || latest.Latest != 3 || !reflect.DeepEqual(latest.Changes, expected) {
+			t.Errorf("get of the latest revision: got\n%v", PrettyPrint(latest))
+		}
+
+		// The first revision should have been evicted.
+		_, err = hist.get("kf-app", 1)
+		if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+			t.Errorf("get of an evicted revision: got %v; want a %v", err, http.StatusNotFound)
+		}
+		if _, err := hist.get("other-app", 0); err == nil {
+			t.Errorf("get of an unknown deployment: want an error")
+		}
+	}
+}
@@ -12,8 +12,9 @@ import (
 	"github.com/golang/protobuf/proto"
 	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/oauth2"
 	apps "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -38,6 +39,22 @@ type kfctlRouter struct {
 
 	// namespace is the namespace to launch the kfctl servers in
 	namespace string
+
+	// retryBudgets bound the retries of the clients of each backend during outages.
+	retryBudgets *retryBudgets
+
+	// config is the reloadable config of the router.
+	config *serverConfigStore
+
+	// projectRole returns the role an access token grants on a project.
+	projectRole ProjectRoleFunc
+
+	// roles caches the results of projectRole.
+	roles *roleCache
+
+	// address returns the address of the kfctl server with the given service name; if nil it is
+	// the address of the service in namespace. Tests point it at fake kfctl servers.
+	address func(name string) string
 }
 
 // NewRouter returns a new router
@@ -52,10 +69,18 @@ func NewRouter(c kubeclientset.Interface, image string, namespace string) (*kfct
 	if namespace == "" {
 		return nil, fmt.Errorf("namespace must be the namespace to launch the kfctl backend pods")
 	}
+	config, err := newServerConfigStore("", DefaultServerConfig())
+	if err != nil {
+		return nil, err
+	}
 	return &kfctlRouter{
-		k8sclient: c,
-		image:     image,
-		namespace: namespace,
+		k8sclient:    c,
+		image:        image,
+		namespace:    namespace,
+		retryBudgets: newRetryBudgets(),
+		config:       config,
+		projectRole:  ProjectRole,
+		roles:        newRoleCache(),
 	}, nil
 }
 
@@ -72,6 +97,78 @@ type KfctlService interface {
 	CreateDeployment(context.Context, kfdefs.KfDef) (*kfdefs.KfDef, error)
 	// GetLatestKfdef returns latest KfDef copy which include deployment status
 	GetLatestKfdef(kfdefs.KfDef) (*kfdefs.KfDef, error)
+	// Lint validates the KfDef and returns warnings about risky configurations.
+	Lint(context.Context, kfdefs.KfDef) (*LintResult, error)
+	// Convert converts the app.yaml of the ksonnet based kfctl to a KfDef using kustomize.
+	Convert(context.Context, kfdefs.KfDef) (*ConversionResult, error)
+	// GetErrorHistory returns the most recent errors encountered while handling the deployment.
+	GetErrorHistory(context.Context, kfdefs.KfDef) (*ErrorHistory, error)
+	// Plan returns the actions CreateDeployment would take without taking them.
+	Plan(context.Context, kfdefs.KfDef) (*DeploymentPlan, error)
+	// Execute creates the deployment for a plan previously returned by Plan.
+	Execute(context.Context, ExecuteRequest) (*kfdefs.KfDef, error)
+	// Clone creates a new deployment from the KfDef of an existing deployment.
+	Clone(context.Context, CloneRequest) (*kfdefs.KfDef, error)
+	// GetConnectionInfo returns a kubeconfig and the endpoint for the deployment.
+	GetConnectionInfo(context.Context, kfdefs.KfDef) (*ConnectionInfo, error)
+	// ScheduleMaintenance configures the recurring maintenance tasks of the deployment and returns the schedule.
+	ScheduleMaintenance(context.Context, MaintenanceRequest) (*MaintenanceSchedule, error)
+	// RunMaintenance runs a maintenance task of the deployment now.
+	RunMaintenance(context.Context, MaintenanceRunRequest) (*MaintenanceEvent, error)
+	// GetRevisionDiff returns the changes made by a revision of the deployment.
+	GetRevisionDiff(context.Context, RevisionDiffRequest) (*RevisionDiff, error)
+	// GetStats returns a summary of the recent runs of the deployments in a project.
+	GetStats(context.Context, StatsRequest) (*DeploymentStats, error)
+	// GetDurationTrends returns percentiles of the durations of the deployments in a project over time.
+	GetDurationTrends(context.Context, DurationTrendsRequest) (*DurationTrends, error)
+	// RetryFailedApps reapplies the applications which failed the last time the deployment was applied.
+	RetryFailedApps(context.Context, kfdefs.KfDef) (*kfdefs.KfDef, error)
+	// Pause stops the deployment at the next phase boundary and holds it until it is resumed.
+	Pause(context.Context, kfdefs.KfDef) (*kfdefs.KfDef, error)
+	// Resume continues a paused deployment.
+	Resume(context.Context, kfdefs.KfDef) (*kfdefs.KfDef, error)
+	// Cancel stops the in-flight deployment at the next phase boundary and drops the queued requests.
+	Cancel(context.Context, kfdefs.KfDef) (*kfdefs.KfDef, error)
+	// ListDeployments lists the deployments in the project of the request.
+	ListDeployments(context.Context, kfdefs.KfDef) (*DeploymentList, error)
+	// DeleteDeployment deletes the resources of the deployment in the background.
+	DeleteDeployment(context.Context, kfdefs.KfDef) (*kfdefs.KfDef, error)
+	// PrepareDelete returns what deleting the deployment would destroy and the token confirming the deletion.
+	PrepareDelete(context.Context, kfdefs.KfDef) (*DeletePlan, error)
+	// GetIamReport returns the IAM bindings created for the deployment.
+	GetIamReport(context.Context, IamReportRequest) (*gcp.IamPolicyReport, error)
+	// RevokeUnused removes the project IAM bindings of the deployment which haven't been used recently.
+	RevokeUnused(context.Context, IamReportRequest) (*gcp.IamPolicyReport, error)
+	// UpdateMetadata edits the description, owner contact, labels and deletion protection of the deployment without applying it again.
+	UpdateMetadata(context.Context, MetadataRequest) (*kfdefs.KfDef, error)
+	// VerifyManifests checks the cluster of the deployment against the signed manifests it was last applied with.
+	VerifyManifests(context.Context, kfdefs.KfDef) (*kustomize.ManifestVerification, error)
+	// GetInventory returns the cloud and K8s resources created for the deployment.
+	GetInventory(context.Context, kfdefs.KfDef) (*Inventory, error)
+	// GetRunLog returns the log of the latest run of the deployment.
+	GetRunLog(context.Context, kfdefs.KfDef) (*RunLog, error)
+	// GetLogs returns a page of the recent output of the deployment.
+	GetLogs(context.Context, LogsRequest) (*LogPage, error)
+	// Migrate migrates the state stored for the deployment to the schema of the server.
+	Migrate(context.Context, MigrationRequest) (*MigrationReport, error)
+	// Backup snapshots the K8s resources of the deployment and optionally the data of its volumes.
+	Backup(context.Context, BackupRequest) (*kustomize.ResourceSnapshot, error)
+	// Restore recreates the K8s resources of a backup in the deployment.
+	Restore(context.Context, RestoreRequest) (*kustomize.RestoreReport, error)
+	// PreviewUpgrade returns what submitting the KfDef would change in the deployment without changing it.
+	PreviewUpgrade(context.Context, kfdefs.KfDef) (*UpgradePreview, error)
+	// Reencrypt re-encrypts the state stored for the deployment with the configured key.
+	Reencrypt(context.Context, ReencryptionRequest) (*ReencryptionReport, error)
+	// GetKfDefDefaults returns the KfDef used for a platform and Kubeflow version without creating anything.
+	GetKfDefDefaults(context.Context, DefaultsRequest) (*kfdefs.KfDef, error)
+	// ListVersions returns the Kubeflow versions which can be deployed.
+	ListVersions(context.Context, VersionsRequest) (*VersionList, error)
+	// GarbageCollect cleans up the deployments which never succeeded and were abandoned.
+	GarbageCollect(context.Context, GarbageCollectionRequest) (*GarbageCollectionReport, error)
+	// CheckOAuthClient checks the OAuth client used by IAP and optionally creates it before deploying.
+	CheckOAuthClient(context.Context, OAuthClientRequest) (*gcp.OAuthClientReport, error)
+	// ShareDeployment returns a link granting read-only access to the status of the deployment until it expires.
+	ShareDeployment(context.Context, ShareRequest) (*SharedLink, error)
 }
 
 // makeRouterCreateRequestEndpoint creates an endpoint to handle createdeployment requests in the router.
@@ -99,13 +196,15 @@ func (r *kfctlRouter) RegisterEndpoints() {
 		makeRouterCreateRequestEndpoint(r),
 		func(_ context.Context, r *http.Request) (interface{}, error) {
 			var request kfdefs.KfDef
-			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			if err := decodeBody(r, &request); err != nil {
 				log.Info("Err decoding create request: " + err.Error())
 				return nil, err
 			}
 			return request, nil
 		},
 		encodeResponse,
+		httptransport.ServerBefore(readDeadlineHeader),
+		httptransport.ServerAfter(writePendingProgress),
 	)
 
 	// TODO(jlewi): We probably want to fix the URL we are serving on.
@@ -114,8 +213,330 @@ func (r *kfctlRouter) RegisterEndpoints() {
 	// 2. Migrating to a new REST API for deployments
 	// 3. This PR aimed at running the deployment in each pod.
 	// Depending on how we stage these changes we might need to change these URLs.
-	http.Handle("/kfctl/apps/v1alpha2/create", optionsHandler(createHandler))
-	http.Handle("/", optionsHandler(GetHealthzHandler()))
+	lintHandler := httptransport.NewServer(
+		makeLintEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+	)
+
+	convertHandler := httptransport.NewServer(
+		makeConvertEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+	)
+
+	r.handle("/kfctl/apps/v1alpha2/create", optionsHandler(createHandler))
+	r.handle(KfctlGetpath, optionsHandler(r.statusHandler()))
+	errorsHandler := httptransport.NewServer(
+		makeErrorHistoryEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	revisionDiffHandler := httptransport.NewServer(
+		makeRevisionDiffEndpoint(r),
+		decodeHTTPRevisionDiffRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	planHandler := httptransport.NewServer(
+		makePlanEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	executeHandler := httptransport.NewServer(
+		makeExecuteEndpoint(r),
+		decodeHTTPExecuteRequest,
+		encodeResponse,
+		httptransport.ServerBefore(readDeadlineHeader),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(writePendingProgress),
+	)
+
+	r.handle(KfctlLintPath, optionsHandler(lintHandler))
+	r.handle(KfctlConvertPath, optionsHandler(convertHandler))
+	r.handle(KfctlErrorsPath, optionsHandler(errorsHandler))
+	r.handle(KfctlRevisionDiffPath, optionsHandler(revisionDiffHandler))
+	r.handle(KfctlPlanPath, optionsHandler(planHandler))
+	cloneHandler := httptransport.NewServer(
+		makeCloneEndpoint(r),
+		decodeHTTPCloneRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	maintenanceHandler := httptransport.NewServer(
+		makeMaintenanceEndpoint(r),
+		decodeHTTPMaintenanceRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	maintenanceRunHandler := httptransport.NewServer(
+		makeMaintenanceRunEndpoint(r),
+		decodeHTTPMaintenanceRunRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	connectionHandler := httptransport.NewServer(
+		makeConnectionInfoEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	statsHandler := httptransport.NewServer(
+		makeStatsEndpoint(r),
+		decodeHTTPStatsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	durationTrendsHandler := httptransport.NewServer(
+		makeDurationTrendsEndpoint(r),
+		decodeHTTPDurationTrendsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	r.handle(KfctlExecutePath, optionsHandler(executeHandler))
+	r.handle(KfctlClonePath, optionsHandler(cloneHandler))
+	r.handle(KfctlConnectionInfoPath, optionsHandler(connectionHandler))
+	r.handle(KfctlMaintenancePath, optionsHandler(maintenanceHandler))
+	r.handle(KfctlMaintenanceRunPath, optionsHandler(maintenanceRunHandler))
+	retryAppsHandler := httptransport.NewServer(
+		makeRetryFailedAppsEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerBefore(readDeadlineHeader, withForwardedProgress),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(writeForwardedProgress),
+	)
+
+	pauseHandler := httptransport.NewServer(
+		makePauseEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerBefore(withForwardedProgress),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(writeForwardedProgress),
+	)
+
+	resumeHandler := httptransport.NewServer(
+		makeResumeEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerBefore(withForwardedProgress),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(writeForwardedProgress),
+	)
+
+	cancelHandler := httptransport.NewServer(
+		makeCancelEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerBefore(withForwardedProgress),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(writeForwardedProgress),
+	)
+
+	listHandler := httptransport.NewServer(
+		makeListEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	deleteHandler := httptransport.NewServer(
+		makeDeleteEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerBefore(withForwardedProgress),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(writeForwardedProgress),
+	)
+
+	prepareDeleteHandler := httptransport.NewServer(
+		makePrepareDeleteEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	iamReportHandler := httptransport.NewServer(
+		makeIamReportEndpoint(r),
+		decodeHTTPIamReportRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	revokeUnusedHandler := httptransport.NewServer(
+		makeRevokeUnusedEndpoint(r),
+		decodeHTTPIamReportRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	metadataHandler := httptransport.NewServer(
+		makeMetadataEndpoint(r),
+		decodeHTTPMetadataRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	verifyHandler := httptransport.NewServer(
+		makeVerifyEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	inventoryHandler := httptransport.NewServer(
+		makeInventoryEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	runLogHandler := httptransport.NewServer(
+		makeRunLogEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	logsHandler := httptransport.NewServer(
+		makeLogsEndpoint(r),
+		decodeHTTPLogsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	migrateHandler := httptransport.NewServer(
+		makeMigrateEndpoint(r),
+		decodeHTTPMigrationRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	backupHandler := httptransport.NewServer(
+		makeBackupEndpoint(r),
+		decodeHTTPBackupRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	restoreHandler := httptransport.NewServer(
+		makeRestoreEndpoint(r),
+		decodeHTTPRestoreRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	upgradePreviewHandler := httptransport.NewServer(
+		makeUpgradePreviewEndpoint(r),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	reencryptHandler := httptransport.NewServer(
+		makeReencryptEndpoint(r),
+		decodeHTTPReencryptionRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	defaultsHandler := httptransport.NewServer(
+		makeDefaultsEndpoint(r),
+		decodeHTTPDefaultsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	versionsHandler := httptransport.NewServer(
+		makeVersionsEndpoint(r),
+		decodeHTTPVersionsRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	gcHandler := httptransport.NewServer(
+		makeGarbageCollectEndpoint(r),
+		decodeHTTPGarbageCollectionRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	oauthClientHandler := httptransport.NewServer(
+		makeOAuthClientEndpoint(r),
+		decodeHTTPOAuthClientRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	shareHandler := httptransport.NewServer(
+		makeShareEndpoint(r),
+		decodeHTTPShareRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+
+	r.handle(KfctlStatsPath, optionsHandler(statsHandler))
+	r.handle(KfctlDurationTrendsPath, optionsHandler(durationTrendsHandler))
+	r.handle(KfctlRetryFailedAppsPath, optionsHandler(retryAppsHandler))
+	r.handle(KfctlPausePath, optionsHandler(pauseHandler))
+	r.handle(KfctlResumePath, optionsHandler(resumeHandler))
+	r.handle(KfctlCancelPath, optionsHandler(cancelHandler))
+	r.handle(KfctlListPath, optionsHandler(listHandler))
+	r.handle(KfctlDeletePath, optionsHandler(deleteHandler))
+	r.handle(KfctlPrepareDeletePath, optionsHandler(prepareDeleteHandler))
+	r.handle(KfctlIamReportPath, optionsHandler(iamReportHandler))
+	r.handle(KfctlRevokeUnusedPath, optionsHandler(revokeUnusedHandler))
+	r.handle(KfctlMetadataPath, optionsHandler(metadataHandler))
+	r.handle(KfctlVerifyPath, optionsHandler(verifyHandler))
+	r.handle(KfctlInventoryPath, optionsHandler(inventoryHandler))
+	r.handle(KfctlRunLogPath, optionsHandler(runLogHandler))
+	r.handle(KfctlLogsPath, optionsHandler(logsHandler))
+	r.handle(KfctlMigratePath, optionsHandler(migrateHandler))
+	r.handle(KfctlBackupPath, optionsHandler(backupHandler))
+	r.handle(KfctlRestorePath, optionsHandler(restoreHandler))
+	r.handle(KfctlUpgradePreviewPath, optionsHandler(upgradePreviewHandler))
+	r.handle(KfctlReencryptPath, optionsHandler(reencryptHandler))
+	r.handle(KfctlDefaultsPath, optionsHandler(defaultsHandler))
+	r.handle(KfctlVersionsPath, optionsHandler(versionsHandler))
+	r.handle(KfctlGarbageCollectPath, optionsHandler(gcHandler))
+	r.handle(KfctlOAuthClientPath, optionsHandler(oauthClientHandler))
+	r.handle(KfctlSharePath, optionsHandler(shareHandler))
+	r.handle(KfctlSharedPath, optionsHandler(r.sharedHandler()))
+	r.handle(KfctlExportPath, optionsHandler(r.exportHandler()))
+	r.handle("/", optionsHandler(GetHealthzHandler()))
+}
+
+// statusHandler returns the handler of the requests for the latest KfDef of a deployment. The
+// progress reported by the backend is forwarded to the client.
+func (r *kfctlRouter) statusHandler() http.Handler {
+	return httptransport.NewServer(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			return r.getLatestKfdef(ctx, request.(kfdefs.KfDef))
+		},
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerBefore(withForwardedProgress),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerAfter(writeForwardedProgress),
+	)
+}
+
+// handle registers h on pattern of the default mux. The requests are bounded by the request
+// limits of the config of the router.
+func (r *kfctlRouter) handle(pattern string, h http.Handler) {
+	http.Handle(pattern, r.config.limitRequests(h))
 }
 
 // decodeHTTPKfdefResponse is a transport/http.DecodeResponseFunc that decodes a
@@ -126,22 +547,70 @@ func (r *kfctlRouter) RegisterEndpoints() {
 func decodeHTTPKfdefResponse(_ context.Context, r *http.Response) (interface{}, error) {
 	if r.StatusCode != http.StatusOK {
 		// Try to decode the error as an httpError
-		h := httpError{}
-		err := json.NewDecoder(r.Body).Decode(&h)
+		p := validationPayload{}
+		err := json.NewDecoder(r.Body).Decode(&p)
 		if err == nil {
-			return nil, &h
+			if o := overloadedError(r, &p.httpError); o != nil {
+				return nil, o
+			}
+			if l := requestLimitError(r, &p); l != nil {
+				return nil, l
+			}
+			return nil, &p.httpError
 		}
 
 		return nil, errors.New(r.Status)
 	}
 	var resp kfdefs.KfDef
-	err := json.NewDecoder(r.Body).Decode(&resp)
+	err := decodeResponseBody(r, &resp)
 	return &resp, err
 }
 
+// makeHTTPResponseDecoder returns a DecodeResponseFunc which behaves like decodeHTTPKfdefResponse
+// but decodes successful responses into the value returned by newResponse.
+func makeHTTPResponseDecoder(newResponse func() interface{}) httptransport.DecodeResponseFunc {
+	return func(_ context.Context, r *http.Response) (interface{}, error) {
+		if r.StatusCode != http.StatusOK {
+			p := validationPayload{}
+			err := json.NewDecoder(r.Body).Decode(&p)
+			if err == nil {
+				if o := overloadedError(r, &p.httpError); o != nil {
+					return nil, o
+				}
+				if v := validationError(r, &p); v != nil {
+					return nil, v
+				}
+				if l := requestLimitError(r, &p); l != nil {
+					return nil, l
+				}
+				return nil, &p.httpError
+			}
+
+			return nil, errors.New(r.Status)
+		}
+		resp := newResponse()
+		err := decodeResponseBody(r, resp)
+		return resp, err
+	}
+}
+
+// decodeHTTPKfdefRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded KfDef from the HTTP request body.
+func decodeHTTPKfdefRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request kfdefs.KfDef
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding kfdef: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
+
+// copyURL returns the URL of path on base; the path of base is kept as a prefix e.g. when the
+// server is behind an ingress.
 func copyURL(base *url.URL, path string) *url.URL {
 	next := *base
-	next.Path = path
+	next.Path = strings.TrimSuffix(base.Path, "/") + path
+	next.RawPath = ""
 	return &next
 }
 
@@ -183,43 +652,12 @@ func k8sName(name string, project string) (string, error) {
 	return name, nil
 }
 
-// authCheckAndExtractService: 1. check if request is owner of target project; 2. return service name that handle the request.
-func (r *kfctlRouter) authCheckAndExtractService(req kfdefs.KfDef) (string, error) {
-	token, err := req.GetSecret(gcp.GcpAccessTokenName)
-
-	if err != nil {
-		log.Errorf("Failed to get secret %v; error %v", gcp.GcpAccessTokenName, err)
-		return "", &httpError{
-			Message: fmt.Sprintf("Could not obtain an access token from secret %v", gcp.GcpAccessTokenName),
-			Code:    http.StatusBadRequest,
-		}
-	}
-
-	// Verify that user has access. We shouldn't do any processing until verifying access.
-	ts := oauth2.StaticTokenSource(&oauth2.Token{
-		AccessToken: token,
-	})
-
-	isValid, err := CheckProjectAccess(req.Spec.Project, ts)
-
-	if err != nil {
-		log.Errorf("CreateDeployment CheckProjectAccess failed; error %v", err)
-
-		return "", &httpError{
-			Message: fmt.Sprintf("There was a problem verifying access to project: %v; please try again later", req.Spec.Project),
-			Code:    http.StatusUnauthorized,
-		}
-	}
-
-	if !isValid {
-		log.Errorf("CreateDeployment request isn't authorized for the project")
-		return "", &httpError{
-			Message: fmt.Sprintf("There was a problem verifying owner access to project: %v; please check the project id is correct and that you have admin priveleges", req.Spec.Project),
-			Code:    http.StatusUnauthorized,
-		}
+// authCheckAndExtractService: 1. check the caller has at least role on the target project; 2. return service name that handle the request.
+func (r *kfctlRouter) authCheckAndExtractService(req kfdefs.KfDef, role Role) (string, error) {
+	if err := r.authorize(req, role); err != nil {
+		return "", err
 	}
 
-	log.Infof("User has sufficient access.")
 	name, err := k8sName(req.Name, req.Spec.Project)
 
 	if err != nil {
@@ -232,14 +670,96 @@ func (r *kfctlRouter) authCheckAndExtractService(req kfdefs.KfDef) (string, erro
 // AppNameKey is the name of the label to use containing hte name of the kfctl app.
 const AppNameKey = "app-name"
 
-func (r *kfctlRouter) CreateKfctlServer(name string, currTime []byte) error {
+// ProjectKey is the name of the label containing the project of the deployment handled by a kfctl server.
+const ProjectKey = "project"
+
+// projectLabelValue returns the project as a label value; domain scoped project ids contain a colon.
+func projectLabelValue(project string) string {
+	return strings.Replace(project, ":", ".", -1)
+}
+
+func (r *kfctlRouter) CreateKfctlServer(name string, project string, currTime []byte) error {
 	labels := map[string]string{
 		"app":      "kfctl",
 		AppNameKey: name,
+		ProjectKey: projectLabelValue(project),
 	}
 
 	targetPort := 8080
 
+	command := []string{
+		"/opt/kubeflow/bootstrapper",
+		"--keep-alive=true",
+		"--mode=kfctl",
+		"--app-dir=/apps",
+		"--registries-config-file=",
+		"--in-cluster=true",
+		fmt.Sprintf("--port=%v", targetPort),
+	}
+	// The kfctl server makes the calls to GitHub and GCP so it needs the same proxy settings.
+	if proxies := r.config.get().Proxies; len(proxies) > 0 {
+		command = append(command, "--proxy-overrides="+formatProxyRules(proxies))
+	}
+	// The pod is given the drain timeout of the router to checkpoint the in-flight deployment.
+	command = append(command, "--drain-timeout="+r.config.get().DrainTimeout.Duration.String())
+	// The kfctl server encrypts the state it stores in the app directory.
+	if key := r.config.get().StateEncryptionKey; key != "" {
+		command = append(command, "--state-encryption-key="+key)
+	}
+
+	// With phase jobs the app directory is on the shared volume so the Jobs of the phases can
+	// read and write it and the server needs a service account to create the Jobs.
+	volume := corev1.Volume{
+		Name: "apps",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	mount := corev1.VolumeMount{
+		Name:      "apps",
+		MountPath: "/apps",
+	}
+	if claim := r.config.get().AppsVolumeClaim; claim != "" {
+		volume, mount = appsVolume(claim, name, "/apps")
+	}
+	serviceAccount := ""
+	if c := r.config.get().PhaseJobs; c != nil {
+		jobs := *c
+		if jobs.Namespace == "" {
+			jobs.Namespace = r.namespace
+		}
+		spec, err := formatPhaseJobs(&jobs)
+		if err != nil {
+			log.Errorf("Could not format the phase jobs config; error %v", err)
+			return &httpError{
+				Code:    http.StatusServiceUnavailable,
+				Message: "Unable to process your Kubeflow request; please try again later",
+			}
+		}
+		command = append(command, "--phase-jobs="+spec)
+		volume, mount = appsVolume(jobs.VolumeClaim, name, "/apps")
+		serviceAccount = jobs.ServerServiceAccount
+	}
+
+	// Standby replicas read the state published by the leader in the shared app directory.
+	replicas := int32(1)
+	selector := map[string]string{AppNameKey: labels[AppNameKey]}
+	standby := r.config.get().Standby
+	if standby != nil {
+		command = append(command, "--standby=true")
+		volume, mount = appsVolume(standby.volumeClaim(r.config.get().PhaseJobs), name, "/apps")
+		replicas += standby.Replicas
+		// Only the leader handles the requests changing the deployment.
+		selector = map[string]string{
+			AppNameKey:                           labels[AppNameKey],
+			"statefulset.kubernetes.io/pod-name": name + "-0",
+		}
+	}
+
+	if volume.EmptyDir != nil {
+		log.Warnf("The app directory of kfctl server %v is lost with its pod; set appsVolumeClaim so interrupted deployments can resume", name)
+	}
+
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
@@ -249,7 +769,7 @@ func (r *kfctlRouter) CreateKfctlServer(name string, currTime []byte) error {
 		Spec: corev1.ServiceSpec{
 			Type: "ClusterIP",
 			// TODO(jlewi): Fix the selector
-			Selector: map[string]string{AppNameKey: labels[AppNameKey]},
+			Selector: selector,
 			Ports: []corev1.ServicePort{
 				corev1.ServicePort{
 
@@ -276,6 +796,21 @@ func (r *kfctlRouter) CreateKfctlServer(name string, currTime []byte) error {
 	pService, _ := Pformat(newService)
 	log.Infof("Result of create service: %+v", pService)
 
+	if standby != nil {
+		readSvc := svc.DeepCopy()
+		readSvc.Name = readServiceName(name)
+		readSvc.Spec.Selector = map[string]string{AppNameKey: labels[AppNameKey]}
+		readSvc.Spec.Ports[0].Name = "http-" + readSvc.Name
+		log.Infof("Create K8s service for reads")
+		if _, err := r.k8sclient.CoreV1().Services(r.namespace).Create(readSvc); err != nil && !k8serrors.IsAlreadyExists(err) {
+			log.Errorf("unable to create service %v; error %v", readSvc.Name, err)
+			return &httpError{
+				Code:    http.StatusServiceUnavailable,
+				Message: "Unable to process your Kubeflow request; please try again later",
+			}
+		}
+	}
+
 	backend := &apps.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
@@ -286,7 +821,7 @@ func (r *kfctlRouter) CreateKfctlServer(name string, currTime []byte) error {
 			Labels: labels,
 		},
 		Spec: apps.StatefulSetSpec{
-			Replicas: proto.Int32(1),
+			Replicas: proto.Int32(replicas),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
 					AppNameKey: labels[AppNameKey],
@@ -299,22 +834,18 @@ func (r *kfctlRouter) CreateKfctlServer(name string, currTime []byte) error {
 					Labels: labels,
 				},
 				Spec: corev1.PodSpec{
-					// We don't need a service account token so don't mount one.
-					AutomountServiceAccountToken: proto.Bool(false),
+					// We only need a service account token to run the phases as Jobs.
+					ServiceAccountName:           serviceAccount,
+					AutomountServiceAccountToken: proto.Bool(serviceAccount != ""),
+					// The kubelet would kill the server before the drain timeout otherwise.
+					TerminationGracePeriodSeconds: proto.Int64(r.config.get().terminationGracePeriodSeconds()),
 					// TODO(jlewi): Avoid running as root.
 					Containers: []corev1.Container{
 						{
-							Name: "kfctl",
-							Command: []string{
-								"/opt/kubeflow/bootstrapper",
-								"--keep-alive=true",
-								"--mode=kfctl",
-								"--app-dir=/apps",
-								"--registries-config-file=",
-								"--in-cluster=true",
-								fmt.Sprintf("--port=%v", targetPort),
-							},
-							Image: r.image,
+							Name:    "kfctl",
+							Command: command,
+							Env:     proxyEnv(),
+							Image:   r.image,
 							Ports: []corev1.ContainerPort{
 								{
 									ContainerPort: int32(targetPort),
@@ -328,26 +859,18 @@ func (r *kfctlRouter) CreateKfctlServer(name string, currTime []byte) error {
 									corev1.ResourceMemory: resource.MustParse("2Gi"),
 								},
 							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "apps",
-									MountPath: "/apps",
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "apps",
-							VolumeSource: corev1.VolumeSource{
-								EmptyDir: &corev1.EmptyDirVolumeSource{},
-							},
+							VolumeMounts: []corev1.VolumeMount{mount},
 						},
 					},
+					Volumes: []corev1.Volume{volume},
 				},
 			},
 		},
 	}
+	if standby != nil {
+		// The standby replicas serve reads while the leader is still starting or restarting.
+		backend.Spec.PodManagementPolicy = apps.ParallelPodManagement
+	}
 	log.Infof("Create or update K8s statefulset")
 
 	newBackend, err := r.k8sclient.AppsV1().StatefulSets(r.namespace).Create(backend)
@@ -366,27 +889,22 @@ func (r *kfctlRouter) CreateKfctlServer(name string, currTime []byte) error {
 	}
 }
 
-// CreateDeployment creates a Kubeflow deployment.
-func (r *kfctlRouter) CreateDeployment(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
-	name, err := r.authCheckAndExtractService(req)
+// ensureKfctlServer creates the kfctl server name of a deployment in project if it doesn't exist and
+// otherwise records the time of the request so it isn't removed while idle.
+func (r *kfctlRouter) ensureKfctlServer(name string, project string) error {
 	currTime, err := time.Now().MarshalText()
 	if err != nil {
-		return nil, &httpError{
+		return &httpError{
 			Code:    http.StatusServiceUnavailable,
 			Message: "Unable to process your Kubeflow request; please try again later",
 		}
 	}
-
-	if err != nil {
-		log.Errorf("Could not access corresponding service; error %v", err)
-		return nil, err
-	}
 	// We check kube DNS record to see if target service / statefulset already exist in cluster
 	_, err = net.LookupIP(fmt.Sprintf("%v.%v.svc.cluster.local", name, r.namespace))
 	if err != nil {
 		log.Infof("KfctlServer service could not be resolved: %v \n Try to create them", err)
-		if err := r.CreateKfctlServer(name, currTime); err != nil {
-			return nil, &httpError{
+		if err := r.CreateKfctlServer(name, project, currTime); err != nil {
+			return &httpError{
 				Code:    http.StatusServiceUnavailable,
 				Message: "Unable to process your Kubeflow request; please try again later",
 			}
@@ -396,7 +914,7 @@ func (r *kfctlRouter) CreateDeployment(ctx context.Context, req kfdefs.KfDef) (*
 		// TODO(kunming): we should equeue this kube-API facing call and rate limit to avoid k8s master overload during traffic spikes
 		currBackend, err := r.k8sclient.AppsV1().StatefulSets(r.namespace).Get(name, metav1.GetOptions{})
 		if err != nil {
-			return nil, &httpError{
+			return &httpError{
 				Code:    http.StatusServiceUnavailable,
 				Message: "Unable to process your Kubeflow request; please try again later",
 			}
@@ -404,16 +922,51 @@ func (r *kfctlRouter) CreateDeployment(ctx context.Context, req kfdefs.KfDef) (*
 		currBackend.Annotations[LastRequestTime] = string(currTime)
 		_, err = r.k8sclient.AppsV1().StatefulSets(r.namespace).Update(currBackend)
 		if err != nil {
-			return nil, &httpError{
+			return &httpError{
 				Code:    http.StatusServiceUnavailable,
 				Message: "Unable to process your Kubeflow request; please try again later",
 			}
 		}
 	}
+	return nil
+}
+
+// CreateDeployment creates a Kubeflow deployment.
+// If the config requires plans deployments are only created by Execute.
+func (r *kfctlRouter) CreateDeployment(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if c := r.config.get().Plans; c != nil && c.Required {
+		return nil, &httpError{
+			Message: "Deployments must be planned; call Plan and run the plan with Execute once it is approved",
+			Code:    http.StatusForbidden,
+		}
+	}
+	return r.createDeployment(ctx, req)
+}
+
+// createDeployment creates the deployment requested directly or by executing a plan.
+func (r *kfctlRouter) createDeployment(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	if err := checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.config.admitCreate(req); err != nil {
+		return nil, err
+	}
+	// The request is forwarded in the background so reject invalid requests before accepting them.
+	if err := newValidationError("KfDef.Spec is invalid", lint.Validate(&req)); err != nil {
+		return nil, err
+	}
+	name, err := r.authCheckAndExtractService(req, RoleEditor)
+	if err != nil {
+		log.Errorf("Could not access corresponding service; error %v", err)
+		return nil, err
+	}
+	if err := r.ensureKfctlServer(name, req.Spec.Project); err != nil {
+		return nil, err
+	}
 
-	address := fmt.Sprintf("http://%v.%v.svc.cluster.local:80", name, r.namespace)
+	address := r.backendAddress(name)
 	log.Infof("Creating client for %v", address)
-	c, err := NewKfctlClient(address)
+	c, err := NewKfctlClient(address, WithRetryBudget(r.retryBudgets.get(address)))
 
 	if err != nil {
 		log.Errorf("Error creating client; %v", err)
@@ -426,19 +979,284 @@ func (r *kfctlRouter) CreateDeployment(ctx context.Context, req kfdefs.KfDef) (*
 	log.Infof("Calling CreateDeployment at %s", address)
 
 	// Continue request process in separate thread.
-	go c.CreateDeployment(context.Background(), req)
+	go r.forwardDeployment(detachDeadline(ctx), c, name, req)
 	return &req, nil
 }
 
-// CreateDeployment creates a Kubeflow deployment.
+// GetLatestKfdef returns the latest KfDef of the deployment from the backend handling it.
+// The backend is queried with a read-only client so the request can't queue a deployment.
 func (r *kfctlRouter) GetLatestKfdef(req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	return r.getLatestKfdef(context.Background(), req)
+}
+
+// getLatestKfdef is GetLatestKfdef with the context of the request so the progress reported by the
+// backend is forwarded.
+func (r *kfctlRouter) getLatestKfdef(ctx context.Context, req kfdefs.KfDef) (*kfdefs.KfDef, error) {
+	name, err := r.authCheckAndExtractService(req, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	address := r.readServiceAddress(name)
+	c, err := NewReadOnlyKfctlClient(address, WithRetryBudget(r.retryBudgets.get(address)))
+	if err != nil {
+		log.Errorf("Error creating client; %v", err)
+		return nil, &httpError{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Unable to process your Kubeflow request; please try again later",
+			cause:   err,
+		}
+	}
+	return c.getLatestKfdef(ctx, req)
+}
+
+// backendClient returns a client for the kfctl server handling the deployment.
+func (r *kfctlRouter) backendClient(req kfdefs.KfDef) (KfctlService, error) {
+	name, err := k8sName(req.Name, req.Spec.Project)
+	if err != nil {
+		log.Errorf("Could not generate the name; error %v", err)
+		return nil, err
+	}
+	return r.serviceClient(name)
+}
+
+// serviceAddress returns the address of the kfctl server with the given service name.
+func serviceAddress(name string, namespace string) string {
+	return fmt.Sprintf("http://%v.%v.svc.cluster.local:80", name, namespace)
+}
+
+// backendAddress returns the address of the kfctl server with the given service name.
+func (r *kfctlRouter) backendAddress(name string) string {
+	if r.address != nil {
+		return r.address(name)
+	}
+	return serviceAddress(name, r.namespace)
+}
+
+// readClient returns a client for the replicas of the kfctl server handling the deployment which
+// serve the requests reading it.
+func (r *kfctlRouter) readClient(req kfdefs.KfDef) (KfctlService, error) {
 	name, err := k8sName(req.Name, req.Spec.Project)
 	if err != nil {
 		log.Errorf("Could not generate the name; error %v", err)
 		return nil, err
 	}
-	address := fmt.Sprintf("http://%v.%v.svc.cluster.local:80", name, r.namespace)
+	return r.readServiceClient(name)
+}
+
+// readServiceAddress returns the address of the replicas of the kfctl server with the given
+// service name which serve reads; the leader and its standby replicas if it has any.
+func (r *kfctlRouter) readServiceAddress(name string) string {
+	if r.config.get().Standby == nil {
+		return r.backendAddress(name)
+	}
+	return r.backendAddress(readServiceName(name))
+}
+
+// serviceClient returns a client for the kfctl server with the given service name.
+func (r *kfctlRouter) serviceClient(name string) (KfctlService, error) {
+	return r.addressClient(r.backendAddress(name))
+}
+
+// readServiceClient returns a client for the replicas of the kfctl server with the given service
+// name which serve reads.
+func (r *kfctlRouter) readServiceClient(name string) (KfctlService, error) {
+	return r.addressClient(r.readServiceAddress(name))
+}
+
+// addressClient returns a client for the kfctl server at address.
+func (r *kfctlRouter) addressClient(address string) (KfctlService, error) {
 	log.Infof("Creating client for %v", address)
-	c, err := NewKfctlClient(address)
-	return c.GetLatestKfdef(req)
+	c, err := NewKfctlClient(address, WithRetryBudget(r.retryBudgets.get(address)))
+	if err != nil {
+		log.Errorf("Error creating client; %v", err)
+		return nil, &httpError{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Unable to process your Kubeflow request; please try again later",
+			cause:   err,
+		}
+	}
+	return c, nil
+}
+
+// GetErrorHistory returns the error history of the deployment from the backend handling it.
+func (r *kfctlRouter) GetErrorHistory(ctx context.Context, req kfdefs.KfDef) (*ErrorHistory, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.readClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetErrorHistory(ctx, req)
+}
+
+// GetRevisionDiff returns the changes made by a revision of the deployment from the backend handling it.
+func (r *kfctlRouter) GetRevisionDiff(ctx context.Context, req RevisionDiffRequest) (*RevisionDiff, error) {
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.readClient(req.KfDef)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetRevisionDiff(ctx, req)
+}
+
+// GetConnectionInfo returns the connection info of the deployment from the backend handling it.
+// Only admins of the project can get the connection info.
+func (r *kfctlRouter) GetConnectionInfo(ctx context.Context, req kfdefs.KfDef) (*ConnectionInfo, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleAdmin); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetConnectionInfo(ctx, req)
+}
+
+// Lint validates the KfDef and returns warnings about risky configurations.
+// Linting is stateless so the router handles it directly rather than forwarding to a backend.
+// The router has no generated configs; the app dir of the request refers to the filesystem of
+// the client so it is cleared.
+func (r *kfctlRouter) Lint(ctx context.Context, req kfdefs.KfDef) (*LintResult, error) {
+	req.Spec.AppDir = ""
+	return lint.Lint(&req, nil), nil
+}
+
+// Convert converts the app.yaml of the ksonnet based kfctl to a KfDef using kustomize.
+// Converting is stateless so the router handles it directly rather than forwarding to a backend.
+func (r *kfctlRouter) Convert(ctx context.Context, req kfdefs.KfDef) (*ConversionResult, error) {
+	return lint.Convert(&req), nil
+}
+
+// GetKfDefDefaults returns the KfDef used for the platform and version in the request.
+// Defaulting is stateless so the router handles it directly rather than forwarding to a backend.
+func (r *kfctlRouter) GetKfDefDefaults(ctx context.Context, req DefaultsRequest) (*kfdefs.KfDef, error) {
+	return defaultKfDef(r.config.get(), req)
+}
+
+// Plan returns the actions CreateDeployment would take for the request.
+func (r *kfctlRouter) Plan(ctx context.Context, req kfdefs.KfDef) (*DeploymentPlan, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleViewer); err != nil {
+		return nil, err
+	}
+	return planDeployment(r.config.get().Plans, req, time.Now())
+}
+
+// Execute creates the deployment if the request matches the plan.
+func (r *kfctlRouter) Execute(ctx context.Context, req ExecuteRequest) (*kfdefs.KfDef, error) {
+	if err := verifyPlan(r.config.get().Plans, req, time.Now()); err != nil {
+		return nil, err
+	}
+	log.Infof("Executing plan %v for %v", req.PlanID, req.KfDef.Name)
+	return r.createDeployment(ctx, req.KfDef)
+}
+
+// Clone creates a new deployment from the latest KfDef of the source deployment.
+// The caller must have access to the source project; CreateDeployment checks access to the new project
+// and rejects the clone if deployments must be planned.
+func (r *kfctlRouter) Clone(ctx context.Context, req CloneRequest) (*kfdefs.KfDef, error) {
+	if _, err := r.authCheckAndExtractService(req.Source, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req.Source)
+	if err != nil {
+		return nil, err
+	}
+	source, err := c.GetLatestKfdef(req.Source)
+	if err != nil {
+		log.Errorf("Could not get the KfDef of %v; error %v", req.Source.Name, err)
+		return nil, err
+	}
+
+	// The secrets of the backend's KfDef refer to its environment so use the secrets in the request.
+	source.Spec.Secrets = req.Source.Spec.Secrets
+	d, err := cloneKfDef(source, req)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Cloning %v in project %v as %v in project %v", source.Name, source.Spec.Project, d.Name, d.Spec.Project)
+	return r.CreateDeployment(ctx, *d)
+}
+
+// GetStats aggregates the stats of the kfctl servers handling deployments in the project.
+// Servers are garbage collected once idle so only the runs of recently active deployments are included.
+func (r *kfctlRouter) GetStats(ctx context.Context, req StatsRequest) (*DeploymentStats, error) {
+	since := time.Now().Add(-statsWindow(req))
+	runs, unavailable, err := r.projectRuns(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := computeStats(req.KfDef.Spec.Project, since, runs)
+	stats.Unavailable = unavailable
+	return stats, nil
+}
+
+// GetDurationTrends computes the duration trends from the runs of the kfctl servers handling
+// deployments in the project.
+func (r *kfctlRouter) GetDurationTrends(ctx context.Context, req DurationTrendsRequest) (*DurationTrends, error) {
+	window, interval, err := trendsWindow(req)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	runs, unavailable, err := r.projectRuns(ctx, StatsRequest{
+		KfDef:  req.KfDef,
+		Window: metav1.Duration{Duration: window},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trends := computeDurationTrends(req.KfDef.Spec.Project, now.Add(-window), now, interval, runs)
+	trends.Unavailable = unavailable
+	return trends, nil
+}
+
+// projectRuns returns the runs reported by the kfctl servers handling deployments in the project of
+// the request and the number of servers that couldn't be queried.
+func (r *kfctlRouter) projectRuns(ctx context.Context, req StatsRequest) ([]DeploymentRun, int, error) {
+	project := req.KfDef.Spec.Project
+	if project == "" {
+		return nil, 0, &httpError{
+			Message: "project is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	if err := r.authorize(req.KfDef, RoleViewer); err != nil {
+		return nil, 0, err
+	}
+
+	backends, err := r.k8sclient.AppsV1().StatefulSets(r.namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app=kfctl,%v=%v", ProjectKey, projectLabelValue(project)),
+	})
+	if err != nil {
+		log.Errorf("Could not list kfctl servers for project %v; error %v", project, err)
+		return nil, 0, &httpError{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Unable to process your Kubeflow request; please try again later",
+			cause:   err,
+		}
+	}
+
+	runs := []DeploymentRun{}
+	unavailable := 0
+	for _, b := range backends.Items {
+		c, err := r.readServiceClient(b.Name)
+		if err != nil {
+			unavailable++
+			continue
+		}
+		stats, err := c.GetStats(ctx, req)
+		if err != nil {
+			log.Warnf("Could not get stats from kfctl server %v; error %v", b.Name, err)
+			unavailable++
+			continue
+		}
+		runs = append(runs, stats.Runs...)
+	}
+
+	return runs, unavailable, nil
 }
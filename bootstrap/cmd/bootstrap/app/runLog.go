@@ -0,0 +1,328 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// KfctlRunLogPath is the path on which to serve requests for the log of the latest run of the deployment
+const KfctlRunLogPath = "/kfctl/apps/v1alpha2/logs"
+
+// LogVerbosityAnnotation sets the LogVerbosity of a create request; LogVerbosityPhases if unset.
+const LogVerbosityAnnotation = "kfctl.kubeflow.org/log-verbosity"
+
+// runLogFile is the name of the file in the apps directory in which the log of the latest run is persisted.
+const runLogFile = ".run_log.json"
+
+// defaultMaxLogEntries bounds the entries kept for a run; the oldest are dropped first.
+const defaultMaxLogEntries = 5000
+
+// LogVerbosity controls how much of a run is persisted and served by the kfctl server.
+type LogVerbosity string
+
+const (
+	// LogVerbosityErrors only logs the errors of the run.
+	LogVerbosityErrors LogVerbosity = "errors"
+	// LogVerbosityPhases also logs when the run enters each phase.
+	LogVerbosityPhases LogVerbosity = "phases"
+	// LogVerbosityFull also logs the output of the commands run by kfctl e.g. the manifests
+	// applied; only meant for debugging since it grows the log a lot.
+	LogVerbosityFull LogVerbosity = "full"
+)
+
+// includes returns true if logs at verbosity v include the entries of verbosity o.
+func (v LogVerbosity) includes(o LogVerbosity) bool {
+	rank := map[LogVerbosity]int{LogVerbosityErrors: 0, LogVerbosityPhases: 1, LogVerbosityFull: 2}
+	return rank[v] >= rank[o]
+}
+
+// parseLogVerbosity returns the LogVerbosity set on the request r.
+func parseLogVerbosity(r kfdefs.KfDef) (LogVerbosity, error) {
+	v, ok := r.Annotations[LogVerbosityAnnotation]
+	if !ok || v == "" {
+		return LogVerbosityPhases, nil
+	}
+	switch LogVerbosity(v) {
+	case LogVerbosityErrors, LogVerbosityPhases, LogVerbosityFull:
+		return LogVerbosity(v), nil
+	}
+	return "", &httpError{
+		Message: fmt.Sprintf("Invalid %v %v; must be one of %v, %v or %v", LogVerbosityAnnotation, v,
+			LogVerbosityErrors, LogVerbosityPhases, LogVerbosityFull),
+		Code: http.StatusBadRequest,
+	}
+}
+
+// takeLogVerbosity removes the LogVerbosity from a queued request and returns it. Requests are
+// validated when they are queued so an invalid verbosity falls back to the default.
+func takeLogVerbosity(r *kfdefs.KfDef) LogVerbosity {
+	v, err := parseLogVerbosity(*r)
+	if err != nil {
+		log.Warnf("Ignoring %v; %v", LogVerbosityAnnotation, err)
+		v = LogVerbosityPhases
+	}
+	delete(r.Annotations, LogVerbosityAnnotation)
+	return v
+}
+
+// LogEntry is a line of the log of a run.
+type LogEntry struct {
+	Time  time.Time       `json:"time"`
+	Level string          `json:"level"`
+	Phase DeploymentPhase `json:"phase,omitempty"`
+	// Message is the message logged by kfctl; the phase entered for phase entries.
+	Message string `json:"message"`
+}
+
+// RunLog is the log of the latest run of a deployment; oldest first.
+type RunLog struct {
+	Name      string       `json:"name"`
+	Verbosity LogVerbosity `json:"verbosity"`
+	Start     time.Time    `json:"start"`
+	// Running is true while the run is in progress; more entries will be logged.
+	Running bool       `json:"running"`
+	Entries []LogEntry `json:"entries"`
+	// Dropped is the number of the oldest entries dropped to bound the size of the log.
+	Dropped int `json:"dropped,omitempty"`
+}
+
+func (l *RunLog) streamNDJSON(ctx context.Context, emit func(item interface{}) error) (int, error) {
+	for _, e := range l.Entries {
+		if err := emit(e); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// runLogger records the log of the run in progress at the verbosity of its request and persists
+// it to a file. It is a logrus hook so the output of kfctl is captured at LogVerbosityFull.
+type runLogger struct {
+	mu         sync.Mutex
+	file       string
+	maxEntries int
+	current    *RunLog
+	phase      DeploymentPhase
+}
+
+// newRunLogger creates a runLogger persisted in file. If file exists the log is loaded from it.
+func newRunLogger(file string, maxEntries int) *runLogger {
+	l := &runLogger{
+		file:       file,
+		maxEntries: maxEntries,
+	}
+	l.load()
+	return l
+}
+
+// load replaces the log with the one persisted in file e.g. by the leader of a standby replica.
+// The log is kept if file can't be read.
+func (l *runLogger) load() {
+	if l.file == "" {
+		return
+	}
+
+	buf, err := stateKeys.readFile(l.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read run log %v; error %v", l.file, err)
+		}
+		return
+	}
+
+	r := &RunLog{}
+	if err := json.Unmarshal(buf, r); err != nil {
+		log.Warnf("Could not parse run log %v; error %v", l.file, err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = r
+}
+
+// begin starts the log of a new run of the named deployment replacing the log of the previous run.
+func (l *runLogger) begin(name string, verbosity LogVerbosity) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = &RunLog{
+		Name:      name,
+		Verbosity: verbosity,
+		Start:     time.Now(),
+		Running:   true,
+		Entries:   []LogEntry{},
+	}
+	l.phase = PhasePending
+	l.persist()
+}
+
+// enterPhase logs that the run entered phase and persists the entries logged so far.
+func (l *runLogger) enterPhase(phase DeploymentPhase) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil || !l.current.Running {
+		return
+	}
+	l.phase = phase
+	if l.current.Verbosity.includes(LogVerbosityPhases) {
+		l.add(LogEntry{
+			Time:    time.Now(),
+			Level:   log.InfoLevel.String(),
+			Phase:   phase,
+			Message: fmt.Sprintf("Entering phase %v", phase),
+		})
+	}
+	l.persist()
+}
+
+// finish logs the error the run failed with if any and persists the log.
+func (l *runLogger) finish(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil || !l.current.Running {
+		return
+	}
+	if err != nil {
+		l.add(LogEntry{
+			Time:    time.Now(),
+			Level:   log.ErrorLevel.String(),
+			Phase:   l.phase,
+			Message: err.Error(),
+		})
+	}
+	l.current.Running = false
+	l.persist()
+}
+
+// get returns a copy of the log of the latest run of the named deployment.
+func (l *runLogger) get(name string) (*RunLog, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil || l.current.Name != name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("No run of deployment %v was logged", name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	r := *l.current
+	r.Entries = make([]LogEntry, len(l.current.Entries))
+	copy(r.Entries, l.current.Entries)
+	return &r, nil
+}
+
+// Levels implements logrus.Hook.
+func (l *runLogger) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook; errors are logged at every verbosity and the other entries only
+// at LogVerbosityFull. logrus holds its lock while hooks fire so entries are only persisted at
+// the next phase boundary and nothing may be logged here.
+func (l *runLogger) Fire(e *log.Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil || !l.current.Running {
+		return nil
+	}
+	if e.Level > log.ErrorLevel && !l.current.Verbosity.includes(LogVerbosityFull) {
+		return nil
+	}
+	l.add(LogEntry{
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Phase:   l.phase,
+		Message: e.Message,
+	})
+	return nil
+}
+
+// add appends e dropping the oldest entries past maxEntries; callers must hold mu.
+func (l *runLogger) add(e LogEntry) {
+	l.current.Entries = append(l.current.Entries, e)
+	if over := len(l.current.Entries) - l.maxEntries; l.maxEntries > 0 && over > 0 {
+		l.current.Entries = l.current.Entries[over:]
+		l.current.Dropped += over
+	}
+}
+
+// persist saves the log; failures are written to stderr since logging while mu is held would
+// deadlock with Fire. Callers must hold mu.
+func (l *runLogger) persist() {
+	if err := l.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not persist the run log; %v\n", err)
+	}
+}
+
+// save writes the log to file; callers must hold mu.
+func (l *runLogger) save() error {
+	if l.file == "" || l.current == nil {
+		return nil
+	}
+	buf, err := json.Marshal(l.current)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return stateKeys.writeFile(l.file, buf)
+}
+
+// GetRunLog returns the log of the latest run of the deployment handled by the server.
+func (s *kfctlServer) GetRunLog(ctx context.Context, req kfdefs.KfDef) (*RunLog, error) {
+	if req.Name == "" {
+		return nil, &httpError{
+			Message: "name is required",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return s.runLog.get(req.Name)
+}
+
+// GetRunLog forwards the request to the replicas of the backend handling the deployment which serve reads.
+func (r *kfctlRouter) GetRunLog(ctx context.Context, req kfdefs.KfDef) (*RunLog, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.readClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetRunLog(ctx, req)
+}
+
+// GetRunLog returns the log of the latest run of the deployment at the verbosity it was requested with.
+func (c *KfctlClient) GetRunLog(ctx context.Context, req kfdefs.KfDef) (*RunLog, error) {
+	var resp interface{}
+	err := c.retry("GetRunLog", func() error {
+		var err error
+		resp, err = c.runLogEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*RunLog)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeRunLogEndpoint creates an endpoint to handle requests for the log of the latest run.
+func makeRunLogEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.GetRunLog(ctx, req)
+	}
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"errors"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestParseLogVerbosity(t *testing.T) {
+	type testCase struct {
+		annotations map[string]string
+		expected    LogVerbosity
+		valid       bool
+	}
+
+	cases := []testCase{
+		{expected: LogVerbosityPhases, valid: true},
+		{annotations: map[string]string{LogVerbosityAnnotation: "errors"}, expected: LogVerbosityErrors, valid: true},
+		{annotations: map[string]string{LogVerbosityAnnotation: "full"}, expected: LogVerbosityFull, valid: true},
+		{annotations: map[string]string{LogVerbosityAnnotation: "debug"}},
+	}
+
+	for _, c := range cases {
+		r := kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Annotations: c.annotations}}
+		actual, err := parseLogVerbosity(r)
+		if !c.valid {
+			if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+				t.Errorf("parseLogVerbosity(%v): want 400; got %v", c.annotations, err)
+			}
+			continue
+		}
+		if err != nil || actual != c.expected {
+			t.Errorf("parseLogVerbosity(%v): got %v, %v; want %v", c.annotations, actual, err, c.expected)
+		}
+	}
+
+	r := kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{LogVerbosityAnnotation: "full"}}}
+	if v := takeLogVerbosity(&r); v != LogVerbosityFull {
+		t.Errorf("takeLogVerbosity: got %v; want %v", v, LogVerbosityFull)
+	}
+	if _, ok := r.Annotations[LogVerbosityAnnotation]; ok {
+		t.Errorf("takeLogVerbosity didn't remove the annotation")
+	}
+}
+
+func TestRunLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runLog")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := func(l *runLogger, verbosity LogVerbosity) *RunLog {
+		l.begin("kf-app", verbosity)
+		l.enterPhase(PhaseGenerate)
+		l.Fire(&log.Entry{Level: log.InfoLevel, Time: time.Now(), Message: "Creating manifests"})
+		l.enterPhase(PhaseApplyK8s)
+		l.Fire(&log.Entry{Level: log.ErrorLevel, Time: time.Now(), Message: "Apply failed"})
+		l.finish(errors.New("could not apply the K8s resources"))
+		// Entries logged after the run are ignored.
+		l.Fire(&log.Entry{Level: log.ErrorLevel, Time: time.Now(), Message: "Error occured"})
+		r, err := l.get("kf-app")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return r
+	}
+
+	type testCase struct {
+		verbosity LogVerbosity
+		expected  []string
+	}
+
+	cases := []testCase{
+		{
+			verbosity: LogVerbosityErrors,
+			expected:  []string{"Apply failed", "could not apply the K8s resources"},
+		},
+		{
+			verbosity: LogVerbosityPhases,
+			expected:  []string{"Entering phase Generate", "Entering phase ApplyK8s", "Apply failed", "could not apply the K8s resources"},
+		},
+		{
+			verbosity: LogVerbosityFull,
+			expected:  []string{"Entering phase Generate", "Creating manifests", "Entering phase ApplyK8s", "Apply failed", "could not apply the K8s resources"},
+		},
+	}
+
+	for _, c := range cases {
+		r := run(newRunLogger("", 0), c.verbosity)
+		messages := []string{}
+		for _, e := range r.Entries {
+			messages = append(messages, e.Message)
+		}
+		if len(messages) != len(c.expected) {
+			t.Errorf("Verbosity %v: got entries %v; want %v", c.verbosity, messages, c.expected)
+			continue
+		}
+		for i := range messages {
+			if messages[i] != c.expected[i] {
+				t.Errorf("Verbosity %v: got entries %v; want %v", c.verbosity, messages, c.expected)
+				break
+			}
+		}
+		if r.Running || r.Verbosity != c.verbosity {
+			t.Errorf("Verbosity %v: got running %v verbosity %v", c.verbosity, r.Running, r.Verbosity)
+		}
+	}
+
+	// The oldest entries are dropped and the log is persisted for standby replicas.
+	file := path.Join(dir, runLogFile)
+	l := newRunLogger(file, 3)
+	r := run(l, LogVerbosityFull)
+	if len(r.Entries) != 3 || r.Dropped != 2 || r.Entries[0].Phase != PhaseApplyK8s {
+		t.Errorf("Bounded log: got %+v", r)
+	}
+
+	loaded, err := newRunLogger(file, 3).get("kf-app")
+	if err != nil || len(loaded.Entries) != 3 {
+		t.Errorf("Persisted log: got %+v, %v", loaded, err)
+	}
+
+	if _, err := l.get("other"); err == nil {
+		t.Errorf("get of another deployment: got nil; want error")
+	}
+}
+
+func TestKfctlServer_GetRunLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runLog")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	_, err = s.GetRunLog(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("GetRunLog before any run: want 404; got %v", err)
+	}
+
+	s.runLog.begin(req.Name, LogVerbosityPhases)
+	s.setPhase(PhaseGenerate)
+	r, err := s.GetRunLog(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetRunLog: %v", err)
+	}
+	if !r.Running || len(r.Entries) != 1 || r.Entries[0].Phase != PhaseGenerate {
+		t.Errorf("GetRunLog: got %+v", r)
+	}
+}
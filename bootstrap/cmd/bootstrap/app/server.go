@@ -223,6 +223,11 @@ func Run(opt *options.ServerOption) error {
 		log.Info("--registries-config-file not provided; not loading any registries")
 	}
 
+	if strings.ToLower(opt.Mode) == "phase" {
+		log.Infof("Running phase %v of the deployment in %v", opt.Phase, opt.AppDir)
+		return RunPhase(opt)
+	}
+
 	if strings.ToLower(opt.Mode) == "kfctl" {
 		log.Info("Creating kfctl server")
 		kServer, err := NewKfctlServer(opt.AppDir)
@@ -230,7 +235,53 @@ func Run(opt *options.ServerOption) error {
 		if err != nil {
 			return err
 		}
+
+		if opt.FaultInjection != "" {
+			log.Warnf("Fault injection is enabled (%v); this should only be used for testing", opt.FaultInjection)
+			f, err := NewFaultInjectorFromSpec(opt.FaultInjection)
+			if err != nil {
+				return err
+			}
+			kServer.faults = f
+		}
+		serverConfig, err := newServerConfigStoreFromOptions(opt)
+		if err != nil {
+			return err
+		}
+		kServer.config = serverConfig
+		serverConfig.InstallProxy()
+		if opt.TargetKubeconfig != "" {
+			log.Warnf("Deploying to the cluster in %v; this should only be used for testing", opt.TargetKubeconfig)
+			config, err := clientcmd.BuildConfigFromFlags("", opt.TargetKubeconfig)
+			if err != nil {
+				return err
+			}
+			kServer.targetCluster = config
+		}
+		if opt.Simulate {
+			log.Warnf("Simulating deployments; this should only be used for demos and testing")
+			kServer.simulate = true
+		}
+		if opt.Standby {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return err
+			}
+			standby, err := IsStandbyReplica(hostname)
+			if err != nil {
+				return err
+			}
+			if standby {
+				log.Infof("Replica %v is a standby serving reads from the state published by the leader", hostname)
+				kServer.standby = true
+				go kServer.followLeader(standbyRefreshInterval, nil)
+			} else {
+				log.Infof("Replica %v is the leader; publishing the status for the standby replicas", hostname)
+				kServer.publishesStatus = true
+			}
+		}
 		kServer.RegisterEndpoints()
+		kServer.DrainOnSignal()
 	} else {
 		if strings.ToLower(opt.Mode) == "gc" {
 			log.Info("Creating gc server")
@@ -278,7 +329,14 @@ func Run(opt *options.ServerOption) error {
 			if err != nil {
 				return err
 			}
+			serverConfig, err := newServerConfigStoreFromOptions(opt)
+			if err != nil {
+				return err
+			}
+			router.config = serverConfig
+			serverConfig.InstallProxy()
 			router.RegisterEndpoints()
+			go router.StartMaintenance(maintenancePeriod, nil)
 		}
 	}
 
@@ -289,6 +347,10 @@ func Run(opt *options.ServerOption) error {
 	}
 
 	if opt.KeepAlive {
+		if opt.Socket != "" {
+			log.Infof("Starting http server on unix socket %v.", opt.Socket)
+			return ksServer.StartUnix(opt.Socket)
+		}
 		log.Infof("Starting http server.")
 		ksServer.StartHttp(opt.Port)
 	}
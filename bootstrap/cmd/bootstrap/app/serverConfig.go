@@ -0,0 +1,503 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app/options"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// ServerConfigAPIVersion is the version of the format of the server config file.
+	ServerConfigAPIVersion = "kfctl.kubeflow.org/v1alpha1"
+	// ServerConfigKind is the kind of the server config file.
+	ServerConfigKind = "ServerConfig"
+
+	// defaultDrainTimeout is the drain timeout used when the config doesn't set one.
+	defaultDrainTimeout = 10 * time.Minute
+	// drainGraceMargin is added to the drain timeout in the termination grace period of the kfctl
+	// servers so they have time to write the checkpoint and exit before they are killed.
+	drainGraceMargin = time.Minute
+	// defaultSinkTimeout is how long a webhook sink may take to accept an event.
+	defaultSinkTimeout = 10 * time.Second
+)
+
+// ServerConfig holds the settings of the kfctl server and router which can be changed while
+// they are running. It is loaded from the file passed with --server-config and reloaded when
+// the process receives SIGHUP; an invalid file is rejected and the previous settings are kept.
+type ServerConfig struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// RateLimit bounds the rate at which create requests are accepted; unlimited if nil.
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+
+	// LoadShedding is the thresholds above which the kfctl server rejects new deployments
+	// e.g. memory=0.85,cpu=2,inflight=5,retry-after=30s; see NewLoadShedderFromSpec.
+	// Load shedding is disabled if empty.
+	LoadShedding string `json:"loadShedding,omitempty"`
+
+	// AllowedPlatforms restricts the platforms of deployments e.g. gcp; any platform is allowed if empty.
+	AllowedPlatforms []string `json:"allowedPlatforms,omitempty"`
+
+	// WebhookSinks are sent a DeploymentEvent each time the kfctl server finishes handling a deployment.
+	WebhookSinks []WebhookSink `json:"webhookSinks,omitempty"`
+
+	// DrainTimeout is how long the kfctl server waits on SIGTERM for the in-flight deployment to
+	// reach a phase boundary; defaults to 10 minutes.
+	DrainTimeout metav1.Duration `json:"drainTimeout,omitempty"`
+
+	// AppsVolumeClaim is the PersistentVolumeClaim the kfctl servers created by the router keep
+	// their app directories on, each in a sub directory named after the server. The checkpoint of
+	// a deployment interrupted by a drain and the files it resumes from then survive the pod being
+	// evicted or rescheduled. It is ignored if PhaseJobs or Standby is set since the app
+	// directories are then on their claim. Without any claim the app directories are lost with
+	// the pods and interrupted deployments restart from the first phase. Only used by the router.
+	AppsVolumeClaim string `json:"appsVolumeClaim,omitempty"`
+
+	// Proxies override HTTP(S)_PROXY and NO_PROXY for outbound requests to some hosts. The router
+	// passes them on to the kfctl servers it creates.
+	Proxies []ProxyRule `json:"proxies,omitempty"`
+
+	// GcpQuotas are the request budgets of the GCP APIs shared by all the deployments running in
+	// the process; gcp.DefaultAPIQuotas are used if empty.
+	GcpQuotas []gcp.APIQuota `json:"gcpQuotas,omitempty"`
+
+	// Telemetry is where the deployments which opted in with reportUsage report their anonymized
+	// outcomes; nothing is reported if it isn't set.
+	Telemetry *TelemetryConfig `json:"telemetry,omitempty"`
+
+	// OperatorProject is the project of the operators of the service. Admins of the project are
+	// admins of the deployments in every project and can list them all; see AllProjectsAnnotation.
+	OperatorProject string `json:"operatorProject,omitempty"`
+
+	// PhaseJobs if set runs the phases of the deployments as Kubernetes Jobs instead of in the
+	// kfctl servers; see PhaseJobConfig. The router passes it on to the kfctl servers it creates.
+	PhaseJobs *PhaseJobConfig `json:"phaseJobs,omitempty"`
+
+	// Standby if set runs warm standby replicas of the kfctl servers serving the requests reading
+	// the deployments; see StandbyConfig. Only used by the router.
+	Standby *StandbyConfig `json:"standby,omitempty"`
+
+	// StateEncryptionKey is the Cloud KMS key e.g.
+	// projects/p/locations/global/keyRings/kfctl/cryptoKeys/state wrapping the data keys which
+	// encrypt the state stored by the kfctl servers including app.yaml. The state is stored in
+	// plain text if it is empty. The router passes it on to the kfctl servers it creates.
+	StateEncryptionKey string `json:"stateEncryptionKey,omitempty"`
+
+	// Versions is the registry of the Kubeflow versions listed by ListVersions in the order they
+	// are shown to users; defaultVersions are listed if it is empty.
+	Versions []KubeflowVersion `json:"versions,omitempty"`
+
+	// GarbageCollection if set enables cleaning up the deployments which never succeeded on
+	// demand with GarbageCollect; see GarbageCollectionConfig. The gc server collects them in the
+	// background with the ages of its --gc-failed-age and --gc-stuck-age flags.
+	GarbageCollection *GarbageCollectionConfig `json:"garbageCollection,omitempty"`
+
+	// UpdateChecks if set enables comparing the manifests the deployments are pinned to with
+	// their upstream release branch; see UpdateCheckConfig. Only used by the kfctl servers.
+	UpdateChecks *UpdateCheckConfig `json:"updateChecks,omitempty"`
+
+	// LogBufferBytes bounds the recent output each kfctl server keeps in memory for GetLogs; the
+	// oldest lines are rotated out past it. Defaults to 1 MiB.
+	LogBufferBytes int `json:"logBufferBytes,omitempty"`
+
+	// SharedLinks if set enables ShareDeployment; see SharedLinkConfig. Only used by the router.
+	SharedLinks *SharedLinkConfig `json:"sharedLinks,omitempty"`
+
+	// Plans sets the key signing the plans returned by Plan, how long they can be executed and
+	// whether deployments can only be created by executing a plan; see PlanConfig.
+	Plans *PlanConfig `json:"plans,omitempty"`
+
+	// RequestLimits if set bounds the size and duration of the requests; see RequestLimitConfig.
+	RequestLimits *RequestLimitConfig `json:"requestLimits,omitempty"`
+
+	// Maintenance if set enables ScheduleMaintenance; see MaintenanceConfig. Only used by the router.
+	Maintenance *MaintenanceConfig `json:"maintenance,omitempty"`
+
+	// shedder is parsed from LoadShedding by validate.
+	shedder *LoadShedder
+}
+
+// RateLimitConfig bounds the rate of create requests.
+type RateLimitConfig struct {
+	// CreatesPerMinute is the sustained rate of create requests.
+	CreatesPerMinute float64 `json:"createsPerMinute"`
+	// Burst is the number of create requests which can be accepted at once.
+	Burst int `json:"burst"`
+}
+
+// WebhookSink is a URL deployment events are POSTed to.
+type WebhookSink struct {
+	URL string `json:"url"`
+	// TimeoutSeconds is how long the sink may take to accept an event; defaults to 10 seconds.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// TelemetryConfig is the endpoint usage reports are POSTed to.
+type TelemetryConfig struct {
+	URL string `json:"url"`
+	// TimeoutSeconds is how long the endpoint may take to accept the reports; defaults to 10 seconds.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// DeploymentEvent is POSTed to the webhook sinks when the server finishes handling a deployment
+// or the router runs a maintenance task of a deployment.
+type DeploymentEvent struct {
+	Name    string          `json:"name"`
+	Project string          `json:"project"`
+	Phase   DeploymentPhase `json:"phase"`
+	// Task is the maintenance task the event records; Phase is empty for maintenance events.
+	Task  MaintenanceTaskType `json:"task,omitempty"`
+	Error string              `json:"error,omitempty"`
+	Time  time.Time           `json:"time"`
+}
+
+// validate returns an error if the config isn't valid and sets the defaults.
+func (c *ServerConfig) validate() error {
+	if c.APIVersion != ServerConfigAPIVersion || c.Kind != ServerConfigKind {
+		return fmt.Errorf("unsupported server config %v %v; must be %v %v",
+			c.APIVersion, c.Kind, ServerConfigAPIVersion, ServerConfigKind)
+	}
+	if c.RateLimit != nil && (c.RateLimit.CreatesPerMinute <= 0 || c.RateLimit.Burst <= 0) {
+		return fmt.Errorf("rateLimit.createsPerMinute and rateLimit.burst must be positive")
+	}
+	c.shedder = nil
+	if c.LoadShedding != "" {
+		l, err := NewLoadShedderFromSpec(c.LoadShedding)
+		if err != nil {
+			return err
+		}
+		c.shedder = l
+	}
+	for _, s := range c.WebhookSinks {
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook sink %q must be an http or https URL", s.URL)
+		}
+		if s.TimeoutSeconds < 0 {
+			return fmt.Errorf("timeoutSeconds of webhook sink %v must not be negative", s.URL)
+		}
+	}
+	if err := validateProxyRules(c.Proxies); err != nil {
+		return err
+	}
+	if err := gcp.ValidateAPIQuotas(c.GcpQuotas); err != nil {
+		return err
+	}
+	if t := c.Telemetry; t != nil {
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("telemetry url %q must be an http or https URL", t.URL)
+		}
+		if t.TimeoutSeconds < 0 {
+			return fmt.Errorf("telemetry timeoutSeconds must not be negative")
+		}
+	}
+	if c.PhaseJobs != nil {
+		if err := c.PhaseJobs.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Standby != nil {
+		if err := c.Standby.validate(c.PhaseJobs); err != nil {
+			return err
+		}
+	}
+	if c.StateEncryptionKey != "" && !kmsKeyPattern.MatchString(c.StateEncryptionKey) {
+		return fmt.Errorf("stateEncryptionKey %q must be a Cloud KMS key projects/*/locations/*/keyRings/*/cryptoKeys/*", c.StateEncryptionKey)
+	}
+	if err := validateVersions(c.Versions); err != nil {
+		return err
+	}
+	if c.GarbageCollection != nil {
+		if err := c.GarbageCollection.validate(); err != nil {
+			return err
+		}
+	}
+	if c.UpdateChecks != nil {
+		if err := c.UpdateChecks.validate(); err != nil {
+			return err
+		}
+	}
+	if c.SharedLinks != nil {
+		if err := c.SharedLinks.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Plans != nil {
+		if err := c.Plans.validate(); err != nil {
+			return err
+		}
+	}
+	if c.RequestLimits != nil {
+		if err := c.RequestLimits.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Maintenance != nil {
+		if err := c.Maintenance.validate(); err != nil {
+			return err
+		}
+	}
+	if c.LogBufferBytes != 0 && c.LogBufferBytes < minLogBufferBytes {
+		return fmt.Errorf("logBufferBytes must be at least %v", minLogBufferBytes)
+	}
+	if c.DrainTimeout.Duration < 0 {
+		return fmt.Errorf("drainTimeout must not be negative")
+	}
+	if c.DrainTimeout.Duration == 0 {
+		c.DrainTimeout.Duration = defaultDrainTimeout
+	}
+	return nil
+}
+
+// allowsPlatform returns true if deployments may use platform.
+func (c *ServerConfig) allowsPlatform(platform string) bool {
+	if len(c.AllowedPlatforms) == 0 {
+		return true
+	}
+	for _, p := range c.AllowedPlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// terminationGracePeriodSeconds returns the grace period of the pods of the kfctl servers; it
+// leaves them the time to drain.
+func (c *ServerConfig) terminationGracePeriodSeconds() int64 {
+	return int64((c.DrainTimeout.Duration + drainGraceMargin) / time.Second)
+}
+
+// DefaultServerConfig returns the config used when no config file is provided.
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		APIVersion:   ServerConfigAPIVersion,
+		Kind:         ServerConfigKind,
+		DrainTimeout: metav1.Duration{Duration: defaultDrainTimeout},
+	}
+}
+
+// LoadServerConfig reads and validates the server config in file.
+func LoadServerConfig(file string) (*ServerConfig, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c := &ServerConfig{}
+	if err := yaml.Unmarshal(buf, c); err != nil {
+		return nil, errors.Wrapf(err, "could not parse server config %v", file)
+	}
+	if err := c.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid server config %v", file)
+	}
+	return c, nil
+}
+
+// serverConfigStore holds the current ServerConfig and the state which outlives a reload.
+type serverConfigStore struct {
+	// file is the config file; the config can't be reloaded if it is empty.
+	file string
+
+	mu     sync.RWMutex
+	config *ServerConfig
+
+	// limiter enforces the rate limit. Its rate is updated on reload so the tokens aren't reset
+	// unless the burst changes.
+	limiter *rate.Limiter
+	client  *http.Client
+}
+
+// newServerConfigStore returns a store holding c which is reloaded from file.
+func newServerConfigStore(file string, c *ServerConfig) (*serverConfigStore, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	s := &serverConfigStore{
+		file:    file,
+		limiter: rate.NewLimiter(rate.Inf, 0),
+		client:  http.DefaultClient,
+	}
+	s.set(c)
+	return s, nil
+}
+
+// NewServerConfigStore loads the config from file or uses defaults if file is empty.
+func NewServerConfigStore(file string, defaults *ServerConfig) (*serverConfigStore, error) {
+	if file == "" {
+		return newServerConfigStore("", defaults)
+	}
+	c, err := LoadServerConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	return newServerConfigStore(file, c)
+}
+
+// newServerConfigStoreFromOptions loads the config from --server-config and watches it for
+// changes. Without a config file the config is built from the individual flags.
+func newServerConfigStoreFromOptions(opt *options.ServerOption) (*serverConfigStore, error) {
+	defaults := DefaultServerConfig()
+	defaults.LoadShedding = opt.LoadShedding
+	defaults.DrainTimeout.Duration = opt.DrainTimeout
+	proxies, err := ParseProxyRules(opt.ProxyOverrides)
+	if err != nil {
+		return nil, err
+	}
+	defaults.Proxies = proxies
+	defaults.StateEncryptionKey = opt.StateEncryptionKey
+	if defaults.GarbageCollection, err = GarbageCollectionFromOptions(opt); err != nil {
+		return nil, err
+	}
+	if opt.PhaseJobs != "" {
+		if defaults.PhaseJobs, err = ParsePhaseJobs(opt.PhaseJobs); err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := NewServerConfigStore(opt.ServerConfig, defaults)
+	if err != nil {
+		return nil, err
+	}
+	if opt.ServerConfig != "" {
+		log.Infof("Loaded the server config from %v; send SIGHUP to reload it", opt.ServerConfig)
+		s.ReloadOnSignal()
+	}
+	return s, nil
+}
+
+// set makes c the current config.
+func (s *serverConfigStore) set(c *ServerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = c
+	gcp.SetAPIQuotas(c.GcpQuotas)
+	stateKeys.setKey(c.StateEncryptionKey)
+	if c.RateLimit == nil {
+		s.limiter.SetLimit(rate.Inf)
+		return
+	}
+	limit := rate.Limit(c.RateLimit.CreatesPerMinute / 60)
+	if s.limiter.Burst() != c.RateLimit.Burst {
+		s.limiter = rate.NewLimiter(limit, c.RateLimit.Burst)
+		return
+	}
+	s.limiter.SetLimit(limit)
+}
+
+// get returns the current config; it must not be modified.
+func (s *serverConfigStore) get() *ServerConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// reload loads the config file again. If the file isn't valid the current config is kept.
+func (s *serverConfigStore) reload() error {
+	if s.file == "" {
+		return fmt.Errorf("the server wasn't started with a config file")
+	}
+	c, err := LoadServerConfig(s.file)
+	if err != nil {
+		log.Errorf("Not reloading the server config; keeping the current config; error %v", err)
+		return err
+	}
+	s.set(c)
+	log.Infof("Reloaded the server config from %v", s.file)
+	return nil
+}
+
+// ReloadOnSignal reloads the config each time the process receives SIGHUP.
+func (s *serverConfigStore) ReloadOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			log.Infof("Received SIGHUP; reloading the server config")
+			s.reload()
+		}
+	}()
+}
+
+// admitCreate returns an error if a request to create the deployment req shouldn't be accepted
+// under the current config.
+func (s *serverConfigStore) admitCreate(req kfdefs.KfDef) error {
+	s.mu.RLock()
+	c, limiter := s.config, s.limiter
+	s.mu.RUnlock()
+
+	if !c.allowsPlatform(req.Spec.Platform) {
+		return &httpError{
+			Message: fmt.Sprintf("Platform %q isn't supported by this service; supported platforms are %v",
+				req.Spec.Platform, strings.Join(c.AllowedPlatforms, ", ")),
+			Code: http.StatusBadRequest,
+		}
+	}
+	if !limiter.Allow() {
+		return &httpError{
+			Message: "Too many deployments are being created; please retry your request shortly.",
+			Code:    http.StatusTooManyRequests,
+		}
+	}
+	return nil
+}
+
+// notify POSTs the event to each webhook sink in the background. Failures are only logged
+// since the sinks are informational.
+func (s *serverConfigStore) notify(event DeploymentEvent) {
+	sinks := s.get().WebhookSinks
+	if len(sinks) == 0 {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("Could not encode deployment event; %v", err)
+		return
+	}
+	for _, sink := range sinks {
+		go func(sink WebhookSink) {
+			timeout := defaultSinkTimeout
+			if sink.TimeoutSeconds > 0 {
+				timeout = time.Duration(sink.TimeoutSeconds) * time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			req, err := http.NewRequest(http.MethodPost, sink.URL, bytes.NewReader(body))
+			if err != nil {
+				log.Errorf("Could not create request to webhook sink %v; %v", sink.URL, err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			res, err := s.client.Do(req.WithContext(ctx))
+			if err != nil {
+				log.Warnf("Could not send event for %v to webhook sink %v; %v", event.Name, sink.URL, err)
+				return
+			}
+			defer res.Body.Close()
+			if res.StatusCode < 200 || res.StatusCode >= 300 {
+				log.Warnf("Webhook sink %v rejected event for %v; %v", sink.URL, event.Name, res.Status)
+			}
+		}(sink)
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"encoding/json"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestServerConfigStore_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serverConfig")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "config.yaml")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatalf("Could not write %v; %v", file, err)
+		}
+	}
+	write(`apiVersion: kfctl.kubeflow.org/v1alpha1
+kind: ServerConfig
+allowedPlatforms:
+- gcp
+loadShedding: inflight=3
+drainTimeout: 5m
+`)
+
+	s, err := NewServerConfigStore(file, DefaultServerConfig())
+	if err != nil {
+		t.Fatalf("NewServerConfigStore failed; %v", err)
+	}
+	c := s.get()
+	if c.DrainTimeout.Duration != 5*time.Minute || c.shedder == nil || c.shedder.MaxInFlight != 3 {
+		t.Errorf("Loaded config: got %+v", c)
+	}
+
+	gcpReq := kfdefsv3.KfDef{Spec: kfdefsv3.KfDefSpec{Platform: "gcp"}}
+	awsReq := kfdefsv3.KfDef{Spec: kfdefsv3.KfDefSpec{Platform: "aws"}}
+	if err := s.admitCreate(gcpReq); err != nil {
+		t.Errorf("admitCreate of an allowed platform: got %v", err)
+	}
+	if hErr, ok := s.admitCreate(awsReq).(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("admitCreate of a platform which isn't allowed: want a %v", http.StatusBadRequest)
+	}
+
+	// An invalid file is rejected and the current config kept.
+	write(`apiVersion: kfctl.kubeflow.org/v2
+kind: ServerConfig
+`)
+	if err := s.reload(); err == nil {
+		t.Errorf("reload of an unsupported version: want an error")
+	}
+	if s.get() != c {
+		t.Errorf("reload of an invalid file replaced the config")
+	}
+
+	write(`apiVersion: kfctl.kubeflow.org/v1alpha1
+kind: ServerConfig
+rateLimit:
+  createsPerMinute: 1
+  burst: 1
+`)
+	if err := s.reload(); err != nil {
+		t.Fatalf("reload failed; %v", err)
+	}
+	if s.get().DrainTimeout.Duration != defaultDrainTimeout || s.get().shedder != nil {
+		t.Errorf("Reloaded config: got %+v", s.get())
+	}
+	if err := s.admitCreate(awsReq); err != nil {
+		t.Errorf("admitCreate once every platform is allowed: got %v", err)
+	}
+	if hErr, ok := s.admitCreate(awsReq).(*httpError); !ok || hErr.Code != http.StatusTooManyRequests {
+		t.Errorf("admitCreate over the rate limit: want a %v", http.StatusTooManyRequests)
+	}
+}
+
+func TestServerConfig_validate(t *testing.T) {
+	invalid := []*ServerConfig{
+		{APIVersion: ServerConfigAPIVersion},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, RateLimit: &RateLimitConfig{CreatesPerMinute: 1}},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, LoadShedding: "disk=0.5"},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, WebhookSinks: []WebhookSink{{URL: "ftp://acme.com"}}},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, Proxies: []ProxyRule{{Host: "github.com", Proxy: "proxy"}}},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, GcpQuotas: []gcp.APIQuota{{API: "iam.googleapis.com", Burst: 1}}},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, Telemetry: &TelemetryConfig{URL: "usage.acme.com"}},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, StateEncryptionKey: "keyRings/kfctl/cryptoKeys/state"},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, Versions: []KubeflowVersion{{Version: "v0.7.0"}, {Version: "v0.7.0"}}},
+		{APIVersion: ServerConfigAPIVersion, Kind: ServerConfigKind, GarbageCollection: &GarbageCollectionConfig{}},
+	}
+	for _, c := range invalid {
+		if err := c.validate(); err == nil {
+			t.Errorf("validate(%+v): want an error", c)
+		}
+	}
+}
+
+func TestServerConfigStore_notify(t *testing.T) {
+	events := make(chan DeploymentEvent, 1)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := DeploymentEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("Could not decode event; %v", err)
+		}
+		events <- e
+	}))
+	defer sink.Close()
+
+	c := DefaultServerConfig()
+	c.WebhookSinks = []WebhookSink{{URL: sink.URL}}
+	s, err := newServerConfigStore("", c)
+	if err != nil {
+		t.Fatalf("newServerConfigStore failed; %v", err)
+	}
+
+	s.notify(DeploymentEvent{Name: "kf-app", Phase: PhaseDone})
+	select {
+	case e := <-events:
+		if e.Name != "kf-app" || e.Phase != PhaseDone {
+			t.Errorf("Sink received %+v", e)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("Timed out waiting for the sink to receive the event")
+	}
+}
+
+func TestServerConfig_terminationGracePeriodSeconds(t *testing.T) {
+	c := DefaultServerConfig()
+	// The kubelet must wait for the drain; the default grace period of 30s is far shorter.
+	if g := c.terminationGracePeriodSeconds(); g <= int64(defaultDrainTimeout/time.Second) {
+		t.Errorf("terminationGracePeriodSeconds: got %v; want more than the drain timeout of %v", g, defaultDrainTimeout)
+	}
+}
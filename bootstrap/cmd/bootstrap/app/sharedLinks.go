@@ -0,0 +1,332 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KfctlSharePath is the path on which to serve requests for a link sharing the status of a deployment
+const KfctlSharePath = "/kfctl/apps/v1alpha2/share"
+
+// KfctlSharedPath is the path on which the links returned by ShareDeployment are served
+const KfctlSharedPath = "/kfctl/apps/v1alpha2/shared"
+
+// The query parameters of a shared link.
+const (
+	sharedProjectParam   = "project"
+	sharedNameParam      = "name"
+	sharedExpiresParam   = "expires"
+	sharedSignatureParam = "signature"
+)
+
+// defaultSharedLinkTTL is how long a link is valid if the request doesn't set a TTL.
+const defaultSharedLinkTTL = time.Hour
+
+// defaultMaxSharedLinkTTL bounds the TTL of the links if the config doesn't set maxTTL.
+const defaultMaxSharedLinkTTL = 24 * time.Hour
+
+// maxSharedLinkTTL is the largest maxTTL the config may set.
+const maxSharedLinkTTL = 7 * 24 * time.Hour
+
+// minSigningKeyBytes is the shortest signing key accepted.
+const minSigningKeyBytes = 32
+
+// SharedLinkConfig enables links sharing the status of a deployment read-only with people who
+// don't have access to its project e.g. support staff. Links are signed with the key in KeyFile;
+// replacing the key and reloading the config voids every link issued.
+type SharedLinkConfig struct {
+	// KeyFile holds the secret key signing the links; at least 32 bytes.
+	KeyFile string `json:"keyFile"`
+	// BaseURL is the URL the router is reachable at by the people the links are shared with e.g.
+	// https://deploy.kubeflow.cloud.
+	BaseURL string `json:"baseURL"`
+	// MaxTTL bounds how long a link is valid; defaults to 24 hours and at most 7 days.
+	MaxTTL metav1.Duration `json:"maxTTL,omitempty"`
+
+	// key is read from KeyFile by validate.
+	key []byte
+}
+
+// validate returns an error if the config isn't valid, reads the key and sets the defaults.
+func (c *SharedLinkConfig) validate() error {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("sharedLinks baseURL %q must be an http or https URL", c.BaseURL)
+	}
+	if c.MaxTTL.Duration < 0 || c.MaxTTL.Duration > maxSharedLinkTTL {
+		return fmt.Errorf("sharedLinks maxTTL must be between 0 and %v", maxSharedLinkTTL)
+	}
+	if c.MaxTTL.Duration == 0 {
+		c.MaxTTL.Duration = defaultMaxSharedLinkTTL
+	}
+	key, err := readSigningKey("sharedLinks", c.KeyFile)
+	if err != nil {
+		return err
+	}
+	c.key = key
+	return nil
+}
+
+// readSigningKey reads the signing key of the field of the config from the file.
+func readSigningKey(field string, file string) ([]byte, error) {
+	key, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %v keyFile %v; %v", field, file, err)
+	}
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) < minSigningKeyBytes {
+		return nil, fmt.Errorf("%v keyFile %v must hold a key of at least %v bytes", field, file, minSigningKeyBytes)
+	}
+	return key, nil
+}
+
+// ShareRequest requests a link sharing the status of a deployment.
+type ShareRequest struct {
+	// KfDef identifies the deployment and provides the credentials.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// TTL is how long the link is valid; defaults to an hour and is bounded by the maxTTL of the
+	// server config.
+	TTL metav1.Duration `json:"ttl,omitempty"`
+}
+
+// SharedLink grants whoever holds it read-only access to the status of a deployment until it expires.
+type SharedLink struct {
+	Name    string      `json:"name"`
+	Project string      `json:"project"`
+	URL     string      `json:"url"`
+	Expires metav1.Time `json:"expires"`
+}
+
+// SharedDeploymentView is the status of a deployment served to the holders of a shared link. It
+// leaves out the spec, the secrets and the causes of the errors since they can reveal details of
+// the project.
+type SharedDeploymentView struct {
+	Name         string                     `json:"name"`
+	Project      string                     `json:"project"`
+	Version      string                     `json:"version,omitempty"`
+	Platform     string                     `json:"platform,omitempty"`
+	Conditions   []kfdefs.KfDefCondition    `json:"conditions"`
+	Applications []kfdefs.ApplicationStatus `json:"applications"`
+	// Errors are the most recent errors handling the deployment; oldest first.
+	Errors []DeploymentError `json:"errors"`
+	// Expires is when the link stops granting access.
+	Expires metav1.Time `json:"expires"`
+}
+
+// signSharedLink returns the signature of the link to the deployment expiring at expires.
+func signSharedLink(key []byte, project string, name string, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%v\n%v\n%v", project, name, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sharedLinkURL returns the link to the deployment signed with the key of c.
+func (c *SharedLinkConfig) sharedLinkURL(project string, name string, expires time.Time) string {
+	q := url.Values{}
+	q.Set(sharedProjectParam, project)
+	q.Set(sharedNameParam, name)
+	q.Set(sharedExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	q.Set(sharedSignatureParam, signSharedLink(c.key, project, name, expires.Unix()))
+	return strings.TrimSuffix(c.BaseURL, "/") + KfctlSharedPath + "?" + q.Encode()
+}
+
+// verifySharedLink returns the deployment the link of the query grants access to and when the
+// link expires; an error if the signature doesn't match or the link expired.
+func (c *SharedLinkConfig) verifySharedLink(q url.Values, now time.Time) (kfdefs.KfDef, time.Time, error) {
+	d := kfdefs.KfDef{}
+	d.Name = q.Get(sharedNameParam)
+	d.Spec.Project = q.Get(sharedProjectParam)
+	expires, err := strconv.ParseInt(q.Get(sharedExpiresParam), 10, 64)
+	if err != nil || d.Name == "" || d.Spec.Project == "" {
+		return d, time.Time{}, &httpError{
+			Message: "The link is malformed",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	expected := signSharedLink(c.key, d.Spec.Project, d.Name, expires)
+	if !hmac.Equal([]byte(expected), []byte(q.Get(sharedSignatureParam))) {
+		return d, time.Time{}, &httpError{
+			Message: "The signature of the link is invalid",
+			Code:    http.StatusForbidden,
+		}
+	}
+	t := time.Unix(expires, 0)
+	if !now.Before(t) {
+		return d, time.Time{}, &httpError{
+			Message: fmt.Sprintf("The link expired at %v", t.UTC()),
+			Code:    http.StatusForbidden,
+		}
+	}
+	return d, t, nil
+}
+
+// sharedLinksDisabledError is returned if the server config doesn't enable shared links.
+func sharedLinksDisabledError() error {
+	return &httpError{
+		Message: "Shared links aren't enabled by the server",
+		Code:    http.StatusNotFound,
+	}
+}
+
+// newSharedDeploymentView returns the status of d and the errors of history shown by a shared link.
+func newSharedDeploymentView(d *kfdefs.KfDef, history *ErrorHistory, expires time.Time) *SharedDeploymentView {
+	v := &SharedDeploymentView{
+		Name:         d.Name,
+		Project:      d.Spec.Project,
+		Version:      d.Spec.Version,
+		Platform:     d.Spec.Platform,
+		Conditions:   append([]kfdefs.KfDefCondition{}, d.Status.Conditions...),
+		Applications: append([]kfdefs.ApplicationStatus{}, d.Status.Applications...),
+		Errors:       []DeploymentError{},
+		Expires:      metav1.NewTime(expires),
+	}
+	if history != nil {
+		for _, e := range history.Errors {
+			e.Cause = ""
+			v.Errors = append(v.Errors, e)
+		}
+	}
+	return v
+}
+
+// ShareDeployment isn't supported by the server; the links are served by the router.
+func (s *kfctlServer) ShareDeployment(ctx context.Context, req ShareRequest) (*SharedLink, error) {
+	return nil, &httpError{
+		Message: "Share requests must be sent to the router",
+		Code:    http.StatusNotImplemented,
+	}
+}
+
+// ShareDeployment returns a link granting read-only access to the status and the recent errors of
+// the deployment until it expires. Links aren't stored; they stay valid until they expire or the
+// signing key is replaced. Sharing requires the editor role since the link can be passed on to
+// anyone.
+func (r *kfctlRouter) ShareDeployment(ctx context.Context, req ShareRequest) (*SharedLink, error) {
+	c := r.config.get().SharedLinks
+	if c == nil {
+		return nil, sharedLinksDisabledError()
+	}
+	if _, err := r.authCheckAndExtractService(req.KfDef, RoleEditor); err != nil {
+		return nil, err
+	}
+	ttl := req.TTL.Duration
+	if ttl == 0 {
+		ttl = defaultSharedLinkTTL
+	}
+	if ttl < 0 || ttl > c.MaxTTL.Duration {
+		return nil, &httpError{
+			Message: fmt.Sprintf("ttl must be between 0 and %v", c.MaxTTL.Duration),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	// Links are valid to the second.
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	link := &SharedLink{
+		Name:    req.KfDef.Name,
+		Project: req.KfDef.Spec.Project,
+		URL:     c.sharedLinkURL(req.KfDef.Spec.Project, req.KfDef.Name, expires),
+		Expires: metav1.NewTime(expires),
+	}
+	log.Infof("Issued a link sharing deployment %v of project %v expiring at %v", link.Name, link.Project, expires)
+	return link, nil
+}
+
+// sharedHandler serves the links returned by ShareDeployment. The link is the credential so the
+// request isn't authorized otherwise; the status is read from the replicas serving reads.
+func (r *kfctlRouter) sharedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, hr *http.Request) {
+		ctx := hr.Context()
+		view, err := r.sharedView(ctx, hr.URL.Query(), time.Now())
+		if err != nil {
+			errorEncoder(ctx, err, w)
+			return
+		}
+		encodeResponse(ctx, w, view)
+	})
+}
+
+// sharedView returns the view of the deployment the link of the query grants access to.
+func (r *kfctlRouter) sharedView(ctx context.Context, q url.Values, now time.Time) (*SharedDeploymentView, error) {
+	c := r.config.get().SharedLinks
+	if c == nil {
+		return nil, sharedLinksDisabledError()
+	}
+	req, expires, err := c.verifySharedLink(q, now)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := r.readClient(req)
+	if err != nil {
+		return nil, err
+	}
+	d, err := backend.GetLatestKfdef(req)
+	if err != nil {
+		return nil, err
+	}
+	if d.Name != req.Name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	history, err := backend.GetErrorHistory(ctx, req)
+	if err != nil {
+		// The status is still useful without the errors.
+		log.Warnf("Could not get the error history of shared deployment %v; %v", req.Name, err)
+	}
+	return newSharedDeploymentView(d, history, expires), nil
+}
+
+// ShareDeployment asks the router for a link sharing the status of the deployment read-only.
+func (c *KfctlClient) ShareDeployment(ctx context.Context, req ShareRequest) (*SharedLink, error) {
+	var resp interface{}
+	err := c.retry("ShareDeployment", func() error {
+		var err error
+		resp, err = c.shareEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*SharedLink)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeShareEndpoint creates an endpoint to handle requests for links sharing a deployment.
+func makeShareEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ShareRequest)
+		return svc.ShareDeployment(ctx, req)
+	}
+}
+
+// decodeHTTPShareRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded ShareRequest from the HTTP request body.
+func decodeHTTPShareRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request ShareRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding share request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSharedLinkTestConfig returns a valid config whose key is written to dir.
+func newSharedLinkTestConfig(t *testing.T, dir string) *SharedLinkConfig {
+	keyFile := path.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte(strings.Repeat("k", minSigningKeyBytes)+"\n"), 0600); err != nil {
+		t.Fatalf("Could not write the key; %v", err)
+	}
+	c := &SharedLinkConfig{KeyFile: keyFile, BaseURL: "https://deploy.example.com/"}
+	if err := c.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	return c
+}
+
+func TestSharedLinkConfig_Validate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sharedLinks")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newSharedLinkTestConfig(t, dir)
+	if c.MaxTTL.Duration != defaultMaxSharedLinkTTL || len(c.key) != minSigningKeyBytes {
+		t.Errorf("validate: got maxTTL %v and a key of %v bytes; want %v and %v", c.MaxTTL.Duration, len(c.key),
+			defaultMaxSharedLinkTTL, minSigningKeyBytes)
+	}
+
+	short := path.Join(dir, "short")
+	if err := ioutil.WriteFile(short, []byte("secret"), 0600); err != nil {
+		t.Fatalf("Could not write the key; %v", err)
+	}
+	invalid := []SharedLinkConfig{
+		{KeyFile: c.KeyFile, BaseURL: "deploy.example.com"},
+		{KeyFile: c.KeyFile, BaseURL: c.BaseURL, MaxTTL: metav1.Duration{Duration: 30 * 24 * time.Hour}},
+		{KeyFile: short, BaseURL: c.BaseURL},
+		{KeyFile: path.Join(dir, "missing"), BaseURL: c.BaseURL},
+	}
+	for _, i := range invalid {
+		if err := i.validate(); err == nil {
+			t.Errorf("validate(%+v): got nil; want error", i)
+		}
+	}
+}
+
+func TestKfctlRouter_ShareDeployment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sharedLinks")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := newRbacTestRouter(t, map[string]Role{"acme": RoleEditor, "other": RoleViewer}, "")
+	req := ShareRequest{KfDef: newPlanTestKfDef()}
+
+	_, err = r.ShareDeployment(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("ShareDeployment without shared links: want 404; got %v", err)
+	}
+
+	c := newSharedLinkTestConfig(t, dir)
+	r.config.get().SharedLinks = c
+
+	link, err := r.ShareDeployment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ShareDeployment: %v", err)
+	}
+	u, err := url.Parse(link.URL)
+	if err != nil || !strings.HasPrefix(link.URL, "https://deploy.example.com"+KfctlSharedPath+"?") {
+		t.Fatalf("ShareDeployment: got url %v", link.URL)
+	}
+	if d := time.Until(link.Expires.Time); d <= 0 || d > defaultSharedLinkTTL {
+		t.Errorf("ShareDeployment: link expires in %v; want at most %v", d, defaultSharedLinkTTL)
+	}
+
+	q := u.Query()
+	d, expires, err := c.verifySharedLink(q, time.Now())
+	if err != nil {
+		t.Fatalf("verifySharedLink: %v", err)
+	}
+	if d.Name != req.KfDef.Name || d.Spec.Project != req.KfDef.Spec.Project || !expires.Equal(link.Expires.Time) {
+		t.Errorf("verifySharedLink: got %v/%v expiring at %v", d.Spec.Project, d.Name, expires)
+	}
+	if _, _, err := c.verifySharedLink(q, link.Expires.Time); err == nil {
+		t.Errorf("verifySharedLink of an expired link: got nil; want error")
+	}
+	tampered := url.Values{}
+	for k, v := range q {
+		tampered[k] = v
+	}
+	tampered.Set(sharedNameParam, "other-app")
+	_, _, err = c.verifySharedLink(tampered, time.Now())
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusForbidden {
+		t.Errorf("verifySharedLink of a tampered link: want 403; got %v", err)
+	}
+
+	long := req
+	long.TTL = metav1.Duration{Duration: 2 * defaultMaxSharedLinkTTL}
+	if _, err := r.ShareDeployment(context.Background(), long); err == nil {
+		t.Errorf("ShareDeployment with a ttl above maxTTL: got nil; want error")
+	}
+
+	viewer := req
+	viewer.KfDef = *req.KfDef.DeepCopy()
+	viewer.KfDef.Spec.Project = "other"
+	if _, err := r.ShareDeployment(context.Background(), viewer); err == nil {
+		t.Errorf("ShareDeployment by a viewer: got nil; want error")
+	}
+}
+
+func TestNewSharedDeploymentView(t *testing.T) {
+	d := newPlanTestKfDef()
+	d.Status.Applications = []kfdefsv3.ApplicationStatus{{Name: "jupyter", State: kfdefsv3.ApplicationFailed}}
+	history := &ErrorHistory{
+		Name:   d.Name,
+		Errors: []DeploymentError{{Phase: PhaseGenerate, Message: "apply failed", Cause: "secret detail"}},
+	}
+	v := newSharedDeploymentView(&d, history, time.Now())
+	if v.Name != d.Name || v.Project != d.Spec.Project || len(v.Applications) != 1 {
+		t.Errorf("newSharedDeploymentView: got %+v", v)
+	}
+	if len(v.Errors) != 1 || v.Errors[0].Message != "apply failed" || v.Errors[0].Cause != "" {
+		t.Errorf("newSharedDeploymentView: got errors %+v; want the message without the cause", v.Errors)
+	}
+	if history.Errors[0].Cause == "" {
+		t.Errorf("newSharedDeploymentView changed the history")
+	}
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusSnapshotFile is the name of the file in the apps directory in which the leader publishes
+// the status of the deployment for the standby replicas.
+const statusSnapshotFile = ".status.json"
+
+// standbyRefreshInterval is how often a standby replica reloads the state published by the leader.
+const standbyRefreshInterval = 5 * time.Second
+
+// standbyReadPaths are the paths served by standby replicas; they only read the deployment.
+var standbyReadPaths = map[string]bool{
+	KfctlGetpath:            true,
+	KfctlErrorsPath:         true,
+	KfctlRevisionDiffPath:   true,
+	KfctlStatsPath:          true,
+	KfctlDurationTrendsPath: true,
+	KfctlListPath:           true,
+	KfctlInventoryPath:      true,
+	KfctlRunLogPath:         true,
+	KfctlLintPath:           true,
+	KfctlConvertPath:        true,
+	KfctlUpgradePreviewPath: true,
+	KfctlDefaultsPath:       true,
+	KfctlVersionsPath:       true,
+	"/":                     true,
+}
+
+// StandbyConfig runs warm standby replicas of each kfctl server. The replica with ordinal 0 of
+// the StatefulSet is the leader; it handles the requests changing the deployment and publishes
+// its state in the apps directory. The standby replicas serve the requests reading the deployment
+// from that state so status queries stay available while the leader is busy applying.
+type StandbyConfig struct {
+	// Replicas is the number of standby replicas in addition to the leader.
+	Replicas int32 `json:"replicas"`
+	// VolumeClaim is the ReadWriteMany claim holding the apps directories shared by the replicas;
+	// defaults to the volume claim of the phase jobs.
+	VolumeClaim string `json:"volumeClaim,omitempty"`
+}
+
+// validate returns an error if the config isn't valid; phaseJobs is the config of the phase jobs if any.
+func (c *StandbyConfig) validate(phaseJobs *PhaseJobConfig) error {
+	if c.Replicas < 1 {
+		return fmt.Errorf("standby.replicas must be at least 1")
+	}
+	if c.VolumeClaim == "" && phaseJobs == nil {
+		return fmt.Errorf("standby.volumeClaim is required unless phaseJobs is set")
+	}
+	return nil
+}
+
+// volumeClaim returns the claim of the volume shared by the replicas.
+func (c *StandbyConfig) volumeClaim(phaseJobs *PhaseJobConfig) string {
+	if c.VolumeClaim == "" && phaseJobs != nil {
+		return phaseJobs.VolumeClaim
+	}
+	return c.VolumeClaim
+}
+
+// readServiceName returns the name of the service spreading reads over the leader and the standby
+// replicas of the kfctl server name.
+func readServiceName(name string) string {
+	return name + "-read"
+}
+
+// IsStandbyReplica returns true if hostname is the hostname of a standby replica of a kfctl
+// server i.e. a pod of its StatefulSet with an ordinal other than 0.
+func IsStandbyReplica(hostname string) (bool, error) {
+	i := strings.LastIndex(hostname, "-")
+	if i < 0 {
+		return false, fmt.Errorf("hostname %v isn't the name of a StatefulSet pod", hostname)
+	}
+	ordinal, err := strconv.Atoi(hostname[i+1:])
+	if err != nil || ordinal < 0 {
+		return false, fmt.Errorf("hostname %v isn't the name of a StatefulSet pod", hostname)
+	}
+	return ordinal > 0, nil
+}
+
+// statusSnapshot is the state of the deployment published by the leader.
+type statusSnapshot struct {
+	KfDef      kfdefsv3.KfDef     `json:"kfDef"`
+	Phase      DeploymentPhase    `json:"phase"`
+	PhaseStart time.Time          `json:"phaseStart"`
+	Busy       bool               `json:"busy"`
+	Paused     bool               `json:"paused"`
+	Metadata   DeploymentMetadata `json:"metadata"`
+}
+
+// publishStatus writes the status of the deployment for the standby replicas if the server has
+// any. A failure is only logged; the standby replicas serve the previous status until the next
+// change. Must be called with kfDefMux held.
+func (s *kfctlServer) publishStatus() {
+	if !s.publishesStatus {
+		return
+	}
+	buf, err := json.Marshal(statusSnapshot{
+		KfDef:      s.latestKfDef,
+		Phase:      s.phase,
+		PhaseStart: s.phaseStart,
+		Busy:       s.busy,
+		Paused:     s.paused,
+		Metadata:   s.metadata,
+	})
+	if err == nil {
+		// The file is replaced atomically so the replicas never read a partial file.
+		err = stateKeys.writeFile(path.Join(s.appsDir, statusSnapshotFile), buf)
+	}
+	if err != nil {
+		log.Errorf("Could not publish the status of the deployment; %v", err)
+	}
+}
+
+// loadStatusSnapshot replaces the status of the deployment with the one published by the leader.
+func (s *kfctlServer) loadStatusSnapshot() error {
+	buf, err := stateKeys.readFile(path.Join(s.appsDir, statusSnapshotFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The leader hasn't handled a deployment yet.
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	snapshot := &statusSnapshot{}
+	if err := json.Unmarshal(buf, snapshot); err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.latestKfDef = snapshot.KfDef
+	s.phase = snapshot.Phase
+	s.phaseStart = snapshot.PhaseStart
+	s.busy = snapshot.Busy
+	s.paused = snapshot.Paused
+	s.metadata = snapshot.Metadata
+	return nil
+}
+
+// refreshFromLeader reloads the status and the histories published by the leader.
+func (s *kfctlServer) refreshFromLeader() {
+	if err := s.loadStatusSnapshot(); err != nil {
+		log.Warnf("Could not load the status published by the leader; serving the previous status; %v", err)
+	}
+	s.errHistory.load()
+	s.runLog.load()
+	s.runs.load()
+	s.revisions.load()
+}
+
+// followLeader refreshes the state of a standby replica every interval until stop is closed.
+func (s *kfctlServer) followLeader(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.refreshFromLeader()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handle registers h on pattern of the mux of the server or the default mux if it has none; see
+// standbyHandler for the patterns served by a standby replica. The requests are bounded by the
+// request limits of the config of the server.
+func (s *kfctlServer) handle(pattern string, h http.Handler) {
+	h = s.config.limitRequests(s.standbyHandler(pattern, h))
+	if s.mux != nil {
+		s.mux.Handle(pattern, h)
+		return
+	}
+	http.Handle(pattern, h)
+}
+
+// standbyHandler returns h if the server serves pattern. A standby replica only serves the paths
+// reading the deployment; the other requests are rejected so they aren't mistaken for handled.
+func (s *kfctlServer) standbyHandler(pattern string, h http.Handler) http.Handler {
+	if !s.standby || standbyReadPaths[pattern] {
+		return h
+	}
+	return optionsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorEncoder(r.Context(), &httpError{
+			Message: "This replica of the kfctl server is a standby serving reads; send the request to the leader",
+			Code:    http.StatusServiceUnavailable,
+		}, w)
+	}))
+}
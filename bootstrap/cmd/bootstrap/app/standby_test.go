@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestIsStandbyReplica(t *testing.T) {
+	type testCase struct {
+		hostname string
+		standby  bool
+		valid    bool
+	}
+
+	cases := []testCase{
+		{hostname: "kf-abc-0", standby: false, valid: true},
+		{hostname: "kf-abc-1", standby: true, valid: true},
+		{hostname: "kf-abc-12", standby: true, valid: true},
+		{hostname: "kf-abc", valid: false},
+		{hostname: "kfctl", valid: false},
+	}
+
+	for _, c := range cases {
+		standby, err := IsStandbyReplica(c.hostname)
+		if (err == nil) != c.valid {
+			t.Errorf("IsStandbyReplica(%v): got %v; want valid %v", c.hostname, err, c.valid)
+			continue
+		}
+		if standby != c.standby {
+			t.Errorf("IsStandbyReplica(%v): got %v; want %v", c.hostname, standby, c.standby)
+		}
+	}
+}
+
+func TestServerConfig_ValidateStandby(t *testing.T) {
+	type testCase struct {
+		standby   *StandbyConfig
+		phaseJobs *PhaseJobConfig
+		valid     bool
+	}
+
+	jobs := &PhaseJobConfig{Image: "gcr.io/kubeflow/bootstrapper:v1", VolumeClaim: "apps"}
+	cases := []testCase{
+		{standby: &StandbyConfig{Replicas: 2, VolumeClaim: "apps"}, valid: true},
+		{standby: &StandbyConfig{Replicas: 1}, phaseJobs: jobs, valid: true},
+		{standby: &StandbyConfig{Replicas: 1}, valid: false},
+		{standby: &StandbyConfig{VolumeClaim: "apps"}, valid: false},
+	}
+
+	for _, c := range cases {
+		config := DefaultServerConfig()
+		config.Standby = c.standby
+		config.PhaseJobs = c.phaseJobs
+		if err := config.validate(); (err == nil) != c.valid {
+			t.Errorf("validate(%+v): got %v; want valid %v", c.standby, err, c.valid)
+		}
+	}
+
+	if claim := (&StandbyConfig{Replicas: 1}).volumeClaim(jobs); claim != "apps" {
+		t.Errorf("volumeClaim: got %v; want the claim of the phase jobs", claim)
+	}
+}
+
+func TestKfctlServer_FollowLeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "standby")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	leader := newPauseTestServer(t, dir)
+	leader.publishesStatus = true
+	leader.setPhase(PhaseApplyK8s)
+	leader.setBusy(true)
+	leader.errHistory.record("kf-app", PhaseApplyK8s, fmt.Errorf("apply failed"))
+
+	standby, err := NewKfctlServer(dir)
+	if err != nil {
+		t.Fatalf("Could not create server; %v", err)
+	}
+	standby.standby = true
+	standby.refreshFromLeader()
+
+	req := newPlanTestKfDef()
+	latest, err := standby.GetLatestKfdef(req)
+	if err != nil || latest.Name != req.Name {
+		t.Errorf("GetLatestKfdef of the standby: got %v, %v; want %v", latest, err, req.Name)
+	}
+	list, err := standby.ListDeployments(context.Background(), req)
+	if err != nil || len(list.Deployments) != 1 {
+		t.Fatalf("ListDeployments of the standby: got %+v, %v; want 1 deployment", list, err)
+	}
+	if d := list.Deployments[0]; d.Phase != PhaseApplyK8s || !d.Busy {
+		t.Errorf("Deployment listed by the standby: got phase %v busy %v; want %v busy", d.Phase, d.Busy, PhaseApplyK8s)
+	}
+	history, err := standby.GetErrorHistory(context.Background(), req)
+	if err != nil || len(history.Errors) != 1 {
+		t.Errorf("GetErrorHistory of the standby: got %+v, %v; want 1 error", history, err)
+	}
+
+	// The standby follows the changes of the leader.
+	leader.setBusy(false)
+	standby.refreshFromLeader()
+	if list, _ := standby.ListDeployments(context.Background(), req); list.Deployments[0].Busy {
+		t.Errorf("Deployment listed by the standby is busy after the leader finished")
+	}
+}
+
+func TestKfctlServer_StandbyHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	type testCase struct {
+		standby  bool
+		path     string
+		expected int
+	}
+
+	cases := []testCase{
+		{standby: false, path: KfctlCreatePath, expected: http.StatusOK},
+		{standby: true, path: KfctlCreatePath, expected: http.StatusServiceUnavailable},
+		{standby: true, path: KfctlExecutePath, expected: http.StatusServiceUnavailable},
+		{standby: true, path: KfctlGetpath, expected: http.StatusOK},
+		{standby: true, path: KfctlListPath, expected: http.StatusOK},
+		{standby: true, path: "/", expected: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		s := &kfctlServer{standby: c.standby}
+		w := httptest.NewRecorder()
+		s.standbyHandler(c.path, ok).ServeHTTP(w, httptest.NewRequest("POST", c.path, nil))
+		if w.Code != c.expected {
+			t.Errorf("Standby %v request to %v: got %v; want %v", c.standby, c.path, w.Code, c.expected)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KfctlStatsPath is the path on which to serve deployment stats requests
+const KfctlStatsPath = "/kfctl/apps/v1alpha2/stats"
+
+// runHistoryFile is the name of the file in the apps directory in which the runs are persisted.
+const runHistoryFile = ".run_history.json"
+
+// defaultMaxRuns is the number of completed runs retained.
+const defaultMaxRuns = 100
+
+// defaultStatsWindow is the window stats are computed over if the request doesn't set one.
+const defaultStatsWindow = 7 * 24 * time.Hour
+
+// maxFailureCodes is the number of failure codes reported in DeploymentStats.
+const maxFailureCodes = 5
+
+// RunStatus is the outcome of a run of a deployment.
+type RunStatus string
+
+const (
+	RunInProgress RunStatus = "InProgress"
+	RunSucceeded  RunStatus = "Succeeded"
+	RunFailed     RunStatus = "Failed"
+	// RunCanceled runs were stopped by an operator; they don't count towards the success rate.
+	RunCanceled RunStatus = "Canceled"
+)
+
+// DeploymentRun is a single attempt to create or update a deployment.
+type DeploymentRun struct {
+	Name  string     `json:"name"`
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+	// Status is the outcome of the run.
+	Status RunStatus `json:"status"`
+	// Phase is the pipeline phase in which a failed run failed.
+	Phase DeploymentPhase `json:"phase,omitempty"`
+	// Code is the http status code of the error of a failed run.
+	Code int `json:"code,omitempty"`
+	// PhaseDurations is how long the run spent in each phase of the pipeline it entered.
+	PhaseDurations map[DeploymentPhase]metav1.Duration `json:"phaseDurations,omitempty"`
+}
+
+// StatsRequest asks for the stats of the deployments in a project.
+type StatsRequest struct {
+	// KfDef provides the project and the credentials; the name is ignored.
+	KfDef kfdefs.KfDef `json:"kfDef"`
+	// Window is how far back to compute the stats over; defaults to a week.
+	Window metav1.Duration `json:"window,omitempty"`
+}
+
+// FailureCodeCount is the number of failed runs with an error code.
+type FailureCodeCount struct {
+	Code  int `json:"code"`
+	Count int `json:"count"`
+}
+
+// DeploymentStats summarizes the runs started within a window.
+type DeploymentStats struct {
+	Project string    `json:"project"`
+	Since   time.Time `json:"since"`
+	// Total is the number of runs.
+	Total    int               `json:"total"`
+	ByStatus map[RunStatus]int `json:"byStatus"`
+	// SuccessRate is the fraction of completed runs that succeeded.
+	SuccessRate float64 `json:"successRate"`
+	// MedianDuration is the median duration of the successful runs.
+	MedianDuration metav1.Duration `json:"medianDuration"`
+	// FailureCodes are the most common error codes of failed runs; most common first.
+	FailureCodes []FailureCodeCount `json:"failureCodes"`
+	// Unavailable is the number of kfctl servers that couldn't be queried; their runs aren't included.
+	Unavailable int `json:"unavailable,omitempty"`
+	// Runs are the runs the stats are computed from. Only kfctl servers report them
+	// so that the router can aggregate the stats of several servers.
+	Runs []DeploymentRun `json:"runs,omitempty"`
+}
+
+// runHistory keeps the last maxRuns completed runs and the current run and persists the completed runs to a file.
+type runHistory struct {
+	mu      sync.Mutex
+	file    string
+	maxRuns int
+	runs    []DeploymentRun
+	current *DeploymentRun
+	// phaseStart is when the current run entered its current phase.
+	phaseStart time.Time
+	phase      DeploymentPhase
+
+	// now supports injecting the time during testing.
+	now func() time.Time
+}
+
+// newRunHistory creates a runHistory persisted in file.
+// If file exists the runs are loaded from it.
+func newRunHistory(file string, maxRuns int) *runHistory {
+	h := &runHistory{
+		file:    file,
+		maxRuns: maxRuns,
+		now:     time.Now,
+	}
+	h.load()
+	return h
+}
+
+// load replaces the runs with the ones persisted in file e.g. by the leader of a standby replica.
+// The runs are kept if file can't be read.
+func (h *runHistory) load() {
+	if h.file == "" {
+		return
+	}
+
+	buf, err := stateKeys.readFile(h.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read run history %v; error %v", h.file, err)
+		}
+		return
+	}
+
+	var runs []DeploymentRun
+	if err := json.Unmarshal(buf, &runs); err != nil {
+		log.Warnf("Could not parse run history %v; error %v", h.file, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = runs
+}
+
+// begin records the start of a run of the named deployment.
+func (h *runHistory) begin(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.current = &DeploymentRun{
+		Name:   name,
+		Start:  h.now(),
+		Status: RunInProgress,
+	}
+	h.phase = ""
+}
+
+// enterPhase records that the current run entered phase; the time spent in the previous phase is
+// added to the durations of the run.
+func (h *runHistory) enterPhase(phase DeploymentPhase) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.current == nil {
+		return
+	}
+	h.endPhase()
+	h.phase = phase
+	h.phaseStart = h.now()
+}
+
+// endPhase adds the time spent in the current phase to the durations of the current run; callers must hold mu.
+func (h *runHistory) endPhase() {
+	if h.phase == "" {
+		return
+	}
+	if h.current.PhaseDurations == nil {
+		h.current.PhaseDurations = map[DeploymentPhase]metav1.Duration{}
+	}
+	d := h.current.PhaseDurations[h.phase]
+	d.Duration += h.now().Sub(h.phaseStart)
+	h.current.PhaseDurations[h.phase] = d
+	h.phase = ""
+}
+
+// finish records the outcome of the current run; err is nil if it succeeded and phase is the phase it failed in.
+// The completed run is returned or nil if there is no current run.
+func (h *runHistory) finish(phase DeploymentPhase, err error) *DeploymentRun {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.current == nil {
+		return nil
+	}
+	h.endPhase()
+	run := *h.current
+	h.current = nil
+
+	end := h.now()
+	run.End = &end
+	run.Status = RunSucceeded
+	if err == errCanceled {
+		run.Status = RunCanceled
+		run.Phase = phase
+	} else if err != nil {
+		run.Status = RunFailed
+		run.Phase = phase
+		run.Code = http.StatusInternalServerError
+		if hErr, ok := err.(*httpError); ok && hErr.Code != 0 {
+			run.Code = hErr.Code
+		}
+	}
+
+	h.runs = append(h.runs, run)
+	if len(h.runs) > h.maxRuns {
+		h.runs = h.runs[len(h.runs)-h.maxRuns:]
+	}
+
+	if err := h.save(); err != nil {
+		log.Errorf("Could not persist run history; %v", err)
+	}
+	return &run
+}
+
+// abandon discards the current run e.g. because the server is draining and another server will resume it.
+func (h *runHistory) abandon() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.current = nil
+}
+
+// list returns a copy of the runs started at or after since including the current run.
+func (h *runHistory) list(since time.Time) []DeploymentRun {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var runs []DeploymentRun
+	for _, r := range h.runs {
+		if !r.Start.Before(since) {
+			runs = append(runs, r)
+		}
+	}
+	if h.current != nil && !h.current.Start.Before(since) {
+		// The durations of the current run are still being updated so they are copied.
+		current := *h.current
+		current.PhaseDurations = map[DeploymentPhase]metav1.Duration{}
+		for p, d := range h.current.PhaseDurations {
+			current.PhaseDurations[p] = d
+		}
+		runs = append(runs, current)
+	}
+	return runs
+}
+
+// save writes the completed runs to file; callers must hold mu.
+func (h *runHistory) save() error {
+	if h.file == "" {
+		return nil
+	}
+	buf, err := json.Marshal(h.runs)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return stateKeys.writeFile(h.file, buf)
+}
+
+// statsWindow returns the window of the request.
+func statsWindow(req StatsRequest) time.Duration {
+	if req.Window.Duration <= 0 {
+		return defaultStatsWindow
+	}
+	return req.Window.Duration
+}
+
+// computeStats summarizes the runs of project started at or after since.
+func computeStats(project string, since time.Time, runs []DeploymentRun) *DeploymentStats {
+	stats := &DeploymentStats{
+		Project:      project,
+		Since:        since,
+		ByStatus:     map[RunStatus]int{},
+		FailureCodes: []FailureCodeCount{},
+	}
+
+	durations := []time.Duration{}
+	codes := map[int]int{}
+	for _, r := range runs {
+		if r.Start.Before(since) {
+			continue
+		}
+		stats.Total++
+		stats.ByStatus[r.Status]++
+		switch r.Status {
+		case RunSucceeded:
+			if r.End != nil {
+				durations = append(durations, r.End.Sub(r.Start))
+			}
+		case RunFailed:
+			codes[r.Code]++
+		}
+	}
+
+	if completed := stats.ByStatus[RunSucceeded] + stats.ByStatus[RunFailed]; completed > 0 {
+		stats.SuccessRate = float64(stats.ByStatus[RunSucceeded]) / float64(completed)
+	}
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		mid := len(durations) / 2
+		median := durations[mid]
+		if len(durations)%2 == 0 {
+			median = (durations[mid-1] + durations[mid]) / 2
+		}
+		stats.MedianDuration = metav1.Duration{Duration: median}
+	}
+
+	for code, count := range codes {
+		stats.FailureCodes = append(stats.FailureCodes, FailureCodeCount{Code: code, Count: count})
+	}
+	sort.Slice(stats.FailureCodes, func(i, j int) bool {
+		if stats.FailureCodes[i].Count != stats.FailureCodes[j].Count {
+			return stats.FailureCodes[i].Count > stats.FailureCodes[j].Count
+		}
+		return stats.FailureCodes[i].Code < stats.FailureCodes[j].Code
+	})
+	if len(stats.FailureCodes) > maxFailureCodes {
+		stats.FailureCodes = stats.FailureCodes[:maxFailureCodes]
+	}
+	return stats
+}
+
+// makeStatsEndpoint creates an endpoint to handle deployment stats requests.
+func makeStatsEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(StatsRequest)
+		return svc.GetStats(ctx, req)
+	}
+}
+
+// decodeHTTPStatsRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded StatsRequest from the HTTP request body.
+func decodeHTTPStatsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request StatsRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding stats request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
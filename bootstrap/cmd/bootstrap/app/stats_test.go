@@ -0,0 +1,138 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runHistory")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+
+	file := path.Join(dir, runHistoryFile)
+	h := newRunHistory(file, 2)
+	h.now = func() time.Time { return now }
+
+	h.begin("kf-app")
+	now = now.Add(10 * time.Minute)
+	h.finish(PhaseApplyPlatform, &httpError{Code: http.StatusForbidden, Message: "permission denied"})
+
+	h.begin("kf-app")
+	now = now.Add(20 * time.Minute)
+	h.finish(PhaseDone, nil)
+
+	// A drained run isn't recorded.
+	h.begin("kf-app")
+	h.abandon()
+
+	h.begin("kf-app")
+	now = now.Add(30 * time.Minute)
+	h.finish(PhaseApplyK8s, fmt.Errorf("apply failed"))
+
+	h.begin("kf-app")
+
+	runs := h.list(start)
+	if len(runs) != 3 {
+		t.Fatalf("Got %v runs; want 3:\n%v", len(runs), PrettyPrint(runs))
+	}
+
+	// The oldest run should have been evicted.
+	expected := []RunStatus{RunSucceeded, RunFailed, RunInProgress}
+	for i, r := range runs {
+		if r.Status != expected[i] {
+			t.Errorf("Run %v: got status %v; want %v", i, r.Status, expected[i])
+		}
+	}
+	if runs[1].Code != http.StatusInternalServerError || runs[1].Phase != PhaseApplyK8s {
+		t.Errorf("Got code %v phase %v; want %v %v", runs[1].Code, runs[1].Phase, http.StatusInternalServerError, PhaseApplyK8s)
+	}
+
+	if runs := h.list(now); len(runs) != 1 || runs[0].Status != RunInProgress {
+		t.Errorf("Got runs %v; want only the current run", PrettyPrint(runs))
+	}
+
+	// Reload from the file to verify the completed runs are persisted.
+	reloaded := newRunHistory(file, 2)
+	if runs := reloaded.list(start); len(runs) != 2 || runs[0].Status != RunSucceeded || runs[1].Status != RunFailed {
+		t.Errorf("Got runs %v; want the completed runs", PrettyPrint(runs))
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	since := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	run := func(startOffset time.Duration, minutes int, status RunStatus, code int) DeploymentRun {
+		r := DeploymentRun{
+			Name:   "kf-app",
+			Start:  since.Add(startOffset),
+			Status: status,
+			Code:   code,
+		}
+		if status != RunInProgress {
+			end := r.Start.Add(time.Duration(minutes) * time.Minute)
+			r.End = &end
+		}
+		return r
+	}
+
+	runs := []DeploymentRun{
+		// Before the window.
+		run(-time.Hour, 5, RunFailed, http.StatusForbidden),
+		run(time.Hour, 10, RunSucceeded, 0),
+		run(2*time.Hour, 30, RunSucceeded, 0),
+		run(3*time.Hour, 20, RunSucceeded, 0),
+		run(4*time.Hour, 40, RunSucceeded, 0),
+		run(5*time.Hour, 3, RunFailed, http.StatusInternalServerError),
+		run(6*time.Hour, 3, RunFailed, http.StatusForbidden),
+		run(7*time.Hour, 3, RunFailed, http.StatusForbidden),
+		run(8*time.Hour, 0, RunInProgress, 0),
+	}
+
+	stats := computeStats("acme", since, runs)
+
+	if stats.Total != 8 {
+		t.Errorf("Got total %v; want 8", stats.Total)
+	}
+
+	expectedByStatus := map[RunStatus]int{
+		RunSucceeded:  4,
+		RunFailed:     3,
+		RunInProgress: 1,
+	}
+	if !reflect.DeepEqual(stats.ByStatus, expectedByStatus) {
+		t.Errorf("Got by status %v; want %v", stats.ByStatus, expectedByStatus)
+	}
+
+	if expected := 4.0 / 7.0; stats.SuccessRate != expected {
+		t.Errorf("Got success rate %v; want %v", stats.SuccessRate, expected)
+	}
+
+	if stats.MedianDuration.Duration != 25*time.Minute {
+		t.Errorf("Got median duration %v; want 25m", stats.MedianDuration.Duration)
+	}
+
+	expectedCodes := []FailureCodeCount{
+		{Code: http.StatusForbidden, Count: 2},
+		{Code: http.StatusInternalServerError, Count: 1},
+	}
+	if !reflect.DeepEqual(stats.FailureCodes, expectedCodes) {
+		t.Errorf("Got failure codes %v; want %v", stats.FailureCodes, expectedCodes)
+	}
+
+	empty := computeStats("acme", since, nil)
+	if empty.Total != 0 || empty.SuccessRate != 0 || empty.MedianDuration.Duration != 0 || len(empty.FailureCodes) != 0 {
+		t.Errorf("Got %v; want empty stats", PrettyPrint(empty))
+	}
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ContentTypeNDJSON is the media type of newline delimited JSON responses. List responses are
+// written one item per line when the client prefers it so neither side buffers the whole list.
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// Trailers sent after the items of an ND-JSON response.
+const (
+	// UnavailableTrailer is the number of kfctl servers that couldn't be queried.
+	UnavailableTrailer = "Kfctl-Unavailable"
+	// StreamErrorTrailer is set if the response stopped early; the items received are incomplete.
+	StreamErrorTrailer = "Kfctl-Stream-Error"
+)
+
+// ndjsonStreamer is implemented by list responses which can be written as ND-JSON.
+// streamNDJSON calls emit for each item and returns the number of kfctl servers that
+// couldn't be queried.
+type ndjsonStreamer interface {
+	streamNDJSON(ctx context.Context, emit func(item interface{}) error) (int, error)
+}
+
+// deploymentStreamer is implemented by services which can list deployments as they are found
+// rather than building the whole list first. Errors which prevent listing any deployment are
+// returned by streamDeployments so they get the right status code.
+type deploymentStreamer interface {
+	streamDeployments(ctx context.Context, req kfdefs.KfDef) (ndjsonStreamer, error)
+}
+
+// prefersNDJSON returns true if the client of the request in ctx prefers ND-JSON responses.
+func prefersNDJSON(ctx context.Context) bool {
+	accept, _ := ctx.Value(acceptKey{}).(string)
+	return preferredMediaType(accept) == ContentTypeNDJSON
+}
+
+func (l *DeploymentList) streamNDJSON(ctx context.Context, emit func(item interface{}) error) (int, error) {
+	for _, d := range l.Deployments {
+		if err := emit(d); err != nil {
+			return l.Unavailable, err
+		}
+	}
+	return l.Unavailable, nil
+}
+
+// deploymentStream lists the deployments of a project one kfctl server at a time.
+type deploymentStream struct {
+	router   *kfctlRouter
+	req      kfdefs.KfDef
+	backends []string
+}
+
+func (s *deploymentStream) streamNDJSON(ctx context.Context, emit func(item interface{}) error) (int, error) {
+	return s.router.forEachDeployment(ctx, s.req, s.backends, func(d DeploymentSummary) error {
+		return emit(d)
+	})
+}
+
+// encodeNDJSON writes the items of s one per line flushing after each one. The status has been
+// sent by the time an error occurs so errors are reported in the StreamErrorTrailer.
+func encodeNDJSON(ctx context.Context, w http.ResponseWriter, s ndjsonStreamer) error {
+	w.Header().Set("Content-Type", ContentTypeNDJSON)
+	w.Header().Set("Trailer", UnavailableTrailer+", "+StreamErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	unavailable, err := s.streamNDJSON(ctx, func(item interface{}) error {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Streaming the response stopped early; %v", err)
+		w.Header().Set(StreamErrorTrailer, err.Error())
+	}
+	w.Header().Set(UnavailableTrailer, strconv.Itoa(unavailable))
+	return nil
+}
+
+// StreamDeployments lists the deployments in the project of the request calling fn for each one
+// as it is received; it returns the number of kfctl servers that couldn't be queried.
+// Only the request is retried; once deployments are received an error is returned as is since
+// fn may have been called. Servers which don't support ND-JSON respond with the whole list.
+func (c *KfctlClient) StreamDeployments(ctx context.Context, req kfdefs.KfDef, fn func(DeploymentSummary) error) (int, error) {
+	req, err := c.withToken(req)
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var resp *http.Response
+	err = c.retry("StreamDeployments", func() error {
+		u, err := c.balancedURL(c.listURL)
+		if err != nil {
+			return err
+		}
+		hReq, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+		if err != nil {
+			return backoff.Permanent(errors.WithStack(err))
+		}
+		hReq = hReq.WithContext(ctx)
+		hReq.Header.Set("Content-Type", "application/json")
+		hReq.Header.Set("Accept", ContentTypeNDJSON+", application/json")
+
+		resp, err = c.httpClient.Do(hReq)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+		defer resp.Body.Close()
+		h := &httpError{}
+		if err := json.NewDecoder(resp.Body).Decode(h); err != nil {
+			h = &httpError{
+				Message: resp.Status,
+				Code:    resp.StatusCode,
+			}
+		}
+		if h.Code >= 400 && h.Code < 500 {
+			return backoff.Permanent(h)
+		}
+		return h
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if !isNDJSON(resp.Header.Get("Content-Type")) {
+		list := &DeploymentList{}
+		if err := json.NewDecoder(resp.Body).Decode(list); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		_, err := list.streamNDJSON(ctx, func(item interface{}) error {
+			return fn(item.(DeploymentSummary))
+		})
+		return list.Unavailable, err
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		d := DeploymentSummary{}
+		if err := dec.Decode(&d); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		if err := fn(d); err != nil {
+			return 0, err
+		}
+	}
+
+	// Trailers are only available once the body has been read.
+	if msg := resp.Trailer.Get(StreamErrorTrailer); msg != "" {
+		return 0, fmt.Errorf("listing deployments stopped early; %v", msg)
+	}
+	unavailable, _ := strconv.Atoi(resp.Trailer.Get(UnavailableTrailer))
+	return unavailable, nil
+}
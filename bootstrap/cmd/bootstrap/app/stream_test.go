@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// streamingKfctlService is a KfctlService which streams deployments and then fails with err if set.
+type streamingKfctlService struct {
+	fakeKfctlService
+	deployments []DeploymentSummary
+	unavailable int
+	err         error
+}
+
+func (s *streamingKfctlService) streamDeployments(ctx context.Context, req kfdefsv3.KfDef) (ndjsonStreamer, error) {
+	return s, nil
+}
+
+func (s *streamingKfctlService) streamNDJSON(ctx context.Context, emit func(item interface{}) error) (int, error) {
+	for _, d := range s.deployments {
+		if err := emit(d); err != nil {
+			return s.unavailable, err
+		}
+	}
+	return s.unavailable, s.err
+}
+
+// newListTestServer starts an httptest server serving svc on KfctlListPath.
+func newListTestServer(svc KfctlService) *httptest.Server {
+	listHandler := httptransport.NewServer(
+		makeListEndpoint(svc),
+		decodeHTTPKfdefRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(KfctlListPath, optionsHandler(listHandler))
+	return httptest.NewServer(mux)
+}
+
+func TestKfctlClient_StreamDeployments(t *testing.T) {
+	deployments := []DeploymentSummary{}
+	for i := 0; i < 100; i++ {
+		deployments = append(deployments, DeploymentSummary{
+			Name:    fmt.Sprintf("kf-app-%v", i),
+			Project: "acme",
+			Phase:   PhaseDone,
+			Server:  fmt.Sprintf("kfctl-%v", i),
+		})
+	}
+
+	type testCase struct {
+		name        string
+		svc         KfctlService
+		expected    []DeploymentSummary
+		unavailable int
+		err         string
+	}
+
+	cases := []testCase{
+		{
+			name:        "stream",
+			svc:         &streamingKfctlService{deployments: deployments, unavailable: 2},
+			expected:    deployments,
+			unavailable: 2,
+		},
+		{
+			name:     "stopped-early",
+			svc:      &streamingKfctlService{deployments: deployments[:3], err: fmt.Errorf("server went away")},
+			expected: deployments[:3],
+			err:      "server went away",
+		},
+		{
+			// A service which can't stream still writes its list as ND-JSON.
+			name:     "list",
+			svc:      &fakeKfctlService{},
+			expected: []DeploymentSummary{},
+		},
+	}
+
+	for _, c := range cases {
+		server := newListTestServer(c.svc)
+		client, err := NewKfctlClient(server.URL)
+		if err != nil {
+			t.Fatalf("Could not create client; %v", err)
+		}
+
+		actual := []DeploymentSummary{}
+		unavailable, err := client.(*KfctlClient).StreamDeployments(context.Background(), kfdefsv3.KfDef{},
+			func(d DeploymentSummary) error {
+				actual = append(actual, d)
+				return nil
+			})
+		server.Close()
+
+		if c.err == "" && err != nil {
+			t.Errorf("Case %v: StreamDeployments failed; %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("Case %v: got error %v; want %v", c.name, err, c.err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Case %v: got %v deployments; want %v", c.name, len(actual), len(c.expected))
+		}
+		if unavailable != c.unavailable {
+			t.Errorf("Case %v: got %v unavailable; want %v", c.name, unavailable, c.unavailable)
+		}
+	}
+}
+
+func TestKfctlClient_StreamDeploymentsFallback(t *testing.T) {
+	// Servers which don't support ND-JSON respond with the whole list as JSON.
+	expected := []DeploymentSummary{{Name: "kf-app", Project: "acme"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&DeploymentList{Project: "acme", Deployments: expected, Unavailable: 1})
+	}))
+	defer server.Close()
+
+	client, err := NewKfctlClient(server.URL)
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+	actual := []DeploymentSummary{}
+	unavailable, err := client.(*KfctlClient).StreamDeployments(context.Background(), kfdefsv3.KfDef{},
+		func(d DeploymentSummary) error {
+			actual = append(actual, d)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("StreamDeployments failed; %v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) || unavailable != 1 {
+		t.Errorf("Got %v and %v unavailable; want %v and 1 unavailable", actual, unavailable, expected)
+	}
+}
+
+func TestKfctlClient_StreamDeploymentsError(t *testing.T) {
+	// Client errors aren't retried.
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		errorEncoder(r.Context(), &httpError{Message: "project is required", Code: http.StatusBadRequest}, w)
+	}))
+	defer server.Close()
+
+	client, err := NewKfctlClient(server.URL, WithRetryBackOff(func() backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+	}))
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+	_, err = client.(*KfctlClient).StreamDeployments(context.Background(), kfdefsv3.KfDef{},
+		func(d DeploymentSummary) error { return nil })
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusBadRequest {
+		t.Errorf("Got error %v; want 400", err)
+	}
+	if calls != 1 {
+		t.Errorf("Got %v calls; want 1", calls)
+	}
+}
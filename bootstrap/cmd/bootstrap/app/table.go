@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// ContentTypeTable is the media type of table responses. Like kubectl, clients ask for a table
+// with Accept: application/json;as=Table. List and Get responses are then rendered by the server
+// as rows of printable cells so CLIs don't duplicate the formatting; other responses are JSON.
+const ContentTypeTable = "application/json;as=Table"
+
+// TableKind is the kind of table responses.
+const TableKind = "Table"
+
+// Table is a list of rows of printable cells modelled on the K8s metav1.Table.
+type Table struct {
+	Kind              string                  `json:"kind"`
+	ColumnDefinitions []TableColumnDefinition `json:"columnDefinitions"`
+	Rows              []TableRow              `json:"rows"`
+}
+
+// TableColumnDefinition describes a column of a table.
+type TableColumnDefinition struct {
+	Name string `json:"name"`
+	// Type is the OpenAPI type of the cells of the column e.g. string or integer.
+	Type        string `json:"type"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Priority is 0 for the columns shown by default; the others are only shown in wide output.
+	Priority int32 `json:"priority"`
+}
+
+// TableRow is a row of a table; it has a cell for each column.
+type TableRow struct {
+	Cells []interface{} `json:"cells"`
+}
+
+// deploymentColumns are the columns of the tables of deployments.
+var deploymentColumns = []TableColumnDefinition{
+	{Name: "Name", Type: "string", Format: "name", Description: "The name of the deployment."},
+	{Name: "Platform", Type: "string", Description: "The platform the deployment runs on."},
+	{Name: "Version", Type: "string", Description: "The Kubeflow version of the deployment."},
+	{Name: "Status", Type: "string", Description: "The phase of the deployment or the latest condition of its KfDef."},
+	{Name: "Age", Type: "string", Description: "The time since the deployment was created."},
+	{Name: "Project", Type: "string", Priority: 1, Description: "The project of the deployment."},
+	{Name: "Owner", Type: "string", Priority: 1, Description: "The owner contact of the deployment."},
+	{Name: "Server", Type: "string", Priority: 1, Description: "The kfctl server handling the deployment."},
+	{Name: "Update Available", Type: "boolean", Priority: 1, Description: "Whether the upstream release branch has changes the deployment doesn't have."},
+}
+
+// isTable returns true if the media range asks for a table.
+func isTable(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" && params["as"] == TableKind
+}
+
+// formatAge returns the time since created like kubectl e.g. 45s, 12m, 5h or 3d.
+func formatAge(created metav1.Time, now time.Time) string {
+	if created.IsZero() {
+		return "<unknown>"
+	}
+	d := now.Sub(created.Time)
+	switch {
+	case d < 0:
+		return "0s"
+	case d < 2*time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < 2*time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 2*365*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return fmt.Sprintf("%dy", int(d.Hours()/24/365))
+}
+
+// summaryStatus returns the status column of a deployment in a list.
+func summaryStatus(d DeploymentSummary) string {
+	if d.Paused {
+		return "Paused"
+	}
+	return string(d.Phase)
+}
+
+// kfDefStatus returns the status column of a KfDef; the type of its latest true condition other
+// than UpdateAvailable which has its own column.
+func kfDefStatus(d *kfdefs.KfDef) string {
+	status := "Unknown"
+	var latest time.Time
+	for _, c := range d.Status.Conditions {
+		if c.Status != "True" || c.Type == kfdefs.KfUpdateAvailable || c.LastUpdateTime.Time.Before(latest) {
+			continue
+		}
+		latest = c.LastUpdateTime.Time
+		status = string(c.Type)
+	}
+	return status
+}
+
+// updateAvailable returns true if the UpdateAvailable condition of d is true.
+func updateAvailable(d *kfdefs.KfDef) bool {
+	for _, c := range d.Status.Conditions {
+		if c.Type == kfdefs.KfUpdateAvailable {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+// toTable returns response as a table; false if it can't be rendered as one.
+func toTable(response interface{}, now time.Time) (*Table, bool) {
+	t := &Table{
+		Kind:              TableKind,
+		ColumnDefinitions: deploymentColumns,
+		Rows:              []TableRow{},
+	}
+	switch r := response.(type) {
+	case *DeploymentList:
+		for _, d := range r.Deployments {
+			t.Rows = append(t.Rows, TableRow{Cells: []interface{}{
+				d.Name, d.Platform, d.Version, summaryStatus(d), formatAge(d.Created, now), d.Project, d.OwnerContact, d.Server,
+				d.UpdateAvailable,
+			}})
+		}
+	case *kfdefs.KfDef:
+		t.Rows = append(t.Rows, TableRow{Cells: []interface{}{
+			r.Name, r.Spec.Platform, r.Spec.Version, kfDefStatus(r), formatAge(r.CreationTimestamp, now), r.Spec.Project,
+			r.Annotations[OwnerContactAnnotation], "", updateAvailable(r),
+		}})
+	default:
+		return nil, false
+	}
+	return t, true
+}
+
+// acceptTable is a transport/http.RequestFunc asking for a table response.
+func acceptTable(ctx context.Context, r *http.Request) context.Context {
+	r.Header.Set("Accept", ContentTypeTable)
+	return ctx
+}
+
+// tableEndpoint returns the endpoint POSTing requests for method to path asking for a table response.
+func (f *clientEndpointFactory) tableEndpoint(method string, path string) endpoint.Endpoint {
+	return f.endpoint(method, path, makeHTTPResponseDecoder(func() interface{} { return &Table{} }),
+		httptransport.ClientBefore(acceptTable))
+}
+
+// GetLatestKfdefTable returns the deployment as a table with a single row rather than a KfDef.
+func (c *KfctlClient) GetLatestKfdefTable(ctx context.Context, req kfdefs.KfDef) (*Table, error) {
+	return c.callTableEndpoint(ctx, "GetLatestKfdefTable", c.getTableEndpoint, req)
+}
+
+// ListDeploymentsTable lists the deployments in the project of the request as a table with a row per
+// deployment. The deployments of kfctl servers which couldn't be queried aren't listed.
+func (c *KfctlClient) ListDeploymentsTable(ctx context.Context, req kfdefs.KfDef) (*Table, error) {
+	return c.callTableEndpoint(ctx, "ListDeploymentsTable", c.listTableEndpoint, req)
+}
+
+// callTableEndpoint calls an endpoint returning a table retrying failures.
+func (c *KfctlClient) callTableEndpoint(ctx context.Context, method string, e endpoint.Endpoint, req kfdefs.KfDef) (*Table, error) {
+	var resp interface{}
+	err := c.retry(method, func() error {
+		var err error
+		resp, err = e(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*Table)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPreferredMediaType_Table(t *testing.T) {
+	cases := map[string]string{
+		ContentTypeTable:                                    ContentTypeTable,
+		"application/json; as=Table":                        ContentTypeTable,
+		"application/json;as=Table, application/json":       ContentTypeTable,
+		"application/json, application/json;as=Table":       "application/json",
+		"application/json;as=List":                          "application/json",
+		"application/yaml;as=Table":                         ContentTypeYAML,
+		"application/x-protobuf, application/json;as=Table": ContentTypeProtobuf,
+	}
+
+	for accept, expected := range cases {
+		if actual := preferredMediaType(accept); actual != expected {
+			t.Errorf("Accept %q: got %v; want %v", accept, actual, expected)
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[time.Duration]string{
+		-time.Minute:             "0s",
+		45 * time.Second:         "45s",
+		90 * time.Second:         "90s",
+		12 * time.Minute:         "12m",
+		5 * time.Hour:            "5h",
+		3 * 24 * time.Hour:       "3d",
+		3 * 365 * 24 * time.Hour: "3y",
+	}
+	for age, expected := range cases {
+		if actual := formatAge(metav1.NewTime(now.Add(-age)), now); actual != expected {
+			t.Errorf("Age %v: got %v; want %v", age, actual, expected)
+		}
+	}
+	if actual := formatAge(metav1.Time{}, now); actual != "<unknown>" {
+		t.Errorf("Zero creation time: got %v; want <unknown>", actual)
+	}
+}
+
+func TestToTable(t *testing.T) {
+	now := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	list := &DeploymentList{
+		Project: "acme",
+		Deployments: []DeploymentSummary{
+			{
+				Name: "kf-app", Project: "acme", Phase: PhaseDone, Platform: "gcp", Version: "v0.6.0",
+				Created: metav1.NewTime(now.Add(-5 * time.Hour)), OwnerContact: "team-a@example.com", Server: "kfctl-kf-app",
+				UpdateAvailable: true,
+			},
+			{Name: "kf-paused", Project: "acme", Phase: PhaseDone, Paused: true},
+		},
+	}
+
+	table, ok := toTable(list, now)
+	if !ok {
+		t.Fatalf("toTable of a DeploymentList: want a table")
+	}
+	expected := [][]interface{}{
+		{"kf-app", "gcp", "v0.6.0", string(PhaseDone), "5h", "acme", "team-a@example.com", "kfctl-kf-app", true},
+		{"kf-paused", "", "", "Paused", "<unknown>", "acme", "", "", false},
+	}
+	if len(table.Rows) != len(expected) {
+		t.Fatalf("Got %v rows; want %v", len(table.Rows), len(expected))
+	}
+	for i, r := range table.Rows {
+		if len(r.Cells) != len(table.ColumnDefinitions) {
+			t.Errorf("Row %v has %v cells; want one per column", i, len(r.Cells))
+		}
+		if !reflect.DeepEqual(r.Cells, expected[i]) {
+			t.Errorf("Row %v: got %v; want %v", i, r.Cells, expected[i])
+		}
+	}
+
+	d := newPlanTestKfDef()
+	d.CreationTimestamp = metav1.NewTime(now.Add(-3 * 24 * time.Hour))
+	d.Status.Conditions = []kfdefs.KfDefCondition{
+		{Type: kfdefs.KfSucceeded, Status: "True", LastUpdateTime: metav1.NewTime(now.Add(-time.Hour))},
+		{Type: kfdefs.KfDeploying, Status: "False", LastUpdateTime: metav1.NewTime(now)},
+		{Type: kfdefs.KfUpdateAvailable, Status: "True", LastUpdateTime: metav1.NewTime(now)},
+	}
+	table, ok = toTable(&d, now)
+	if !ok || len(table.Rows) != 1 {
+		t.Fatalf("toTable of a KfDef: want a table with a single row; got %v", table)
+	}
+	if status, age := table.Rows[0].Cells[3], table.Rows[0].Cells[4]; status != string(kfdefs.KfSucceeded) || age != "3d" {
+		t.Errorf("Got status %v age %v; want %v 3d", status, age, kfdefs.KfSucceeded)
+	}
+	if update := table.Rows[0].Cells[8]; update != true {
+		t.Errorf("Got update available %v; want true", update)
+	}
+
+	if _, ok := toTable(&ErrorHistory{}, now); ok {
+		t.Errorf("toTable of an ErrorHistory: want no table")
+	}
+}
+
+func TestEncodeResponse_Table(t *testing.T) {
+	list := &DeploymentList{Project: "acme", Deployments: []DeploymentSummary{{Name: "kf-app", Project: "acme"}}}
+
+	r := httptest.NewRequest("POST", KfctlListPath, nil)
+	r.Header.Set("Accept", ContentTypeTable)
+	r = withAccept(r)
+	w := httptest.NewRecorder()
+	if err := encodeResponse(r.Context(), w, list); err != nil {
+		t.Fatalf("encodeResponse failed; %v", err)
+	}
+	if contentType := w.Header().Get("Content-Type"); !isTable(contentType) {
+		t.Errorf("Got Content-Type %v; want %v", contentType, ContentTypeTable)
+	}
+	table := &Table{}
+	if err := json.Unmarshal(w.Body.Bytes(), table); err != nil {
+		t.Fatalf("Could not decode table; %v", err)
+	}
+	if table.Kind != TableKind || len(table.Rows) != 1 || table.Rows[0].Cells[0] != "kf-app" {
+		t.Errorf("Got table %v; want a row for kf-app", PrettyPrint(table))
+	}
+
+	// Responses which can't be rendered as a table are JSON.
+	w = httptest.NewRecorder()
+	if err := encodeResponse(r.Context(), w, &ErrorHistory{Name: "kf-app"}); err != nil {
+		t.Fatalf("encodeResponse failed; %v", err)
+	}
+	if contentType := w.Header().Get("Content-Type"); isTable(contentType) {
+		t.Errorf("Got Content-Type %v for an ErrorHistory; want JSON", contentType)
+	}
+}
+
+func TestListDeploymentsTable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != KfctlListPath {
+			http.Error(w, "unexpected path", http.StatusNotFound)
+			return
+		}
+		r = withAccept(r)
+		list := &DeploymentList{Project: "acme", Deployments: []DeploymentSummary{{Name: "kf-app", Project: "acme"}}}
+		if err := encodeResponse(r.Context(), w, list); err != nil {
+			t.Errorf("encodeResponse failed; %v", err)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewReadOnlyKfctlClient(server.URL)
+	if err != nil {
+		t.Fatalf("Could not create client; %v", err)
+	}
+	table, err := c.ListDeploymentsTable(context.Background(), kfdefs.KfDef{})
+	if err != nil {
+		t.Fatalf("ListDeploymentsTable failed; %v", err)
+	}
+	if len(table.Rows) != 1 || table.Rows[0].Cells[0] != "kf-app" {
+		t.Errorf("Got table %v; want a row for kf-app", PrettyPrint(table))
+	}
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// telemetrySpoolFile is the name of the file in the apps directory in which the reports which
+// haven't been sent are persisted.
+const telemetrySpoolFile = ".telemetry_spool.json"
+
+// maxSpooledReports is the number of unsent reports kept; the oldest are dropped first.
+const maxSpooledReports = 500
+
+// UsageReport is the anonymized outcome of a run of a deployment which opted in with
+// KfDef.Spec.ReportUsage. It doesn't identify the deployment, its project or its users.
+type UsageReport struct {
+	Platform       string `json:"platform"`
+	Version        string `json:"version,omitempty"`
+	PackageManager string `json:"packageManager,omitempty"`
+	// Status is the outcome of the run.
+	Status RunStatus `json:"status"`
+	// Phase is the pipeline phase in which a failed run failed.
+	Phase DeploymentPhase `json:"phase,omitempty"`
+	// Code is the http status code of the error of a failed run.
+	Code            int       `json:"code,omitempty"`
+	DurationSeconds int64     `json:"durationSeconds"`
+	Time            time.Time `json:"time"`
+}
+
+// newUsageReport returns the report of the completed run of the deployment d.
+func newUsageReport(d kfdefs.KfDef, run DeploymentRun) UsageReport {
+	r := UsageReport{
+		Platform:       d.Spec.Platform,
+		Version:        d.Spec.Version,
+		PackageManager: d.Spec.PackageManager,
+		Status:         run.Status,
+		Phase:          run.Phase,
+		Code:           run.Code,
+		Time:           run.Start,
+	}
+	if run.End != nil {
+		r.DurationSeconds = int64(run.End.Sub(run.Start).Seconds())
+	}
+	return r
+}
+
+// telemetryReporter sends usage reports to the telemetry endpoint. Reports are spooled to a file
+// first so the reports of a server which is offline or restarted are sent with the next report.
+type telemetryReporter struct {
+	mu      sync.Mutex
+	file    string
+	reports []UsageReport
+	client  *http.Client
+}
+
+// newTelemetryReporter creates a telemetryReporter spooling to file.
+// If file exists the unsent reports are loaded from it.
+func newTelemetryReporter(file string) *telemetryReporter {
+	t := &telemetryReporter{
+		file:   file,
+		client: &http.Client{},
+	}
+
+	if file == "" {
+		return t
+	}
+
+	buf, err := stateKeys.readFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read telemetry spool %v; starting with an empty spool; error %v", file, err)
+		}
+		return t
+	}
+
+	if err := json.Unmarshal(buf, &t.reports); err != nil {
+		log.Warnf("Could not parse telemetry spool %v; starting with an empty spool; error %v", file, err)
+		t.reports = nil
+	}
+	return t
+}
+
+// report spools r and sends the spooled reports to the endpoint of c. The reports are kept if
+// they can't be sent. Failures are only logged since telemetry is informational.
+func (t *telemetryReporter) report(c *TelemetryConfig, r UsageReport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reports = append(t.reports, r)
+	if len(t.reports) > maxSpooledReports {
+		t.reports = t.reports[len(t.reports)-maxSpooledReports:]
+	}
+	if err := t.send(c); err != nil {
+		log.Warnf("Could not send %v usage reports; they will be sent with the next report; %v", len(t.reports), err)
+	} else {
+		t.reports = nil
+	}
+	if err := t.save(); err != nil {
+		log.Errorf("Could not persist telemetry spool; %v", err)
+	}
+}
+
+// send POSTs the spooled reports to the endpoint; callers must hold mu.
+func (t *telemetryReporter) send(c *TelemetryConfig) error {
+	body, err := json.Marshal(t.reports)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	timeout := defaultSinkTimeout
+	if c.TimeoutSeconds > 0 {
+		timeout = time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%v rejected the reports; %v", c.URL, res.Status)
+	}
+	return nil
+}
+
+// save writes the spooled reports to file; callers must hold mu.
+func (t *telemetryReporter) save() error {
+	if t.file == "" {
+		return nil
+	}
+	buf, err := json.Marshal(t.reports)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return stateKeys.writeFile(t.file, buf)
+}
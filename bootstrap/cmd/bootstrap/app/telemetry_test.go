@@ -0,0 +1,85 @@
+package app
+
+import (
+	"encoding/json"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestNewUsageReport(t *testing.T) {
+	d := kfdefs.KfDef{}
+	d.Name = "kf-app"
+	d.Spec.Project = "acme"
+	d.Spec.Platform = "gcp"
+	d.Spec.Version = "v0.6.0"
+
+	start := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	r := newUsageReport(d, DeploymentRun{
+		Name:   "kf-app",
+		Start:  start,
+		End:    &end,
+		Status: RunFailed,
+		Phase:  PhaseApplyPlatform,
+		Code:   http.StatusForbidden,
+	})
+	expected := UsageReport{
+		Platform:        "gcp",
+		Version:         "v0.6.0",
+		Status:          RunFailed,
+		Phase:           PhaseApplyPlatform,
+		Code:            http.StatusForbidden,
+		DurationSeconds: 90,
+		Time:            start,
+	}
+	if r != expected {
+		t.Errorf("newUsageReport: got %+v; want %+v", r, expected)
+	}
+}
+
+func TestTelemetryReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	online := false
+	received := []UsageReport{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reports := []UsageReport{}
+		if err := json.NewDecoder(r.Body).Decode(&reports); err != nil {
+			t.Errorf("Could not decode reports; %v", err)
+		}
+		received = append(received, reports...)
+	}))
+	defer ts.Close()
+	c := &TelemetryConfig{URL: ts.URL}
+
+	// Reports which can't be sent are spooled and survive a restart.
+	file := path.Join(dir, telemetrySpoolFile)
+	newTelemetryReporter(file).report(c, UsageReport{Platform: "gcp", Status: RunFailed})
+	reporter := newTelemetryReporter(file)
+	if len(reporter.reports) != 1 {
+		t.Fatalf("Got %v spooled reports; want 1", len(reporter.reports))
+	}
+
+	online = true
+	reporter.report(c, UsageReport{Platform: "gcp", Status: RunSucceeded})
+	if len(received) != 2 || received[0].Status != RunFailed || received[1].Status != RunSucceeded {
+		t.Errorf("Endpoint received %+v; want the spooled and the new report", received)
+	}
+	if reporter = newTelemetryReporter(file); len(reporter.reports) != 0 {
+		t.Errorf("Got %v spooled reports after sending them; want 0", len(reporter.reports))
+	}
+}
@@ -0,0 +1,278 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ManifestsBehindReason indicates the upstream release branch has changes the pinned manifests
+// of the deployment don't have.
+const ManifestsBehindReason = "ManifestsBehind"
+
+// ManifestsUpToDateReason indicates the pinned manifests have every change of the upstream release branch.
+const ManifestsUpToDateReason = "ManifestsUpToDate"
+
+// minUpdateCheckInterval bounds how often the servers query GitHub.
+const minUpdateCheckInterval = time.Hour
+
+// maxListedChanges is the number of pending commits listed in the UpdateAvailable condition.
+const maxListedChanges = 3
+
+// githubAPIURL is the URL of the GitHub API the pinned manifests are compared with.
+var githubAPIURL = "https://api.github.com"
+
+// githubArchive matches the URI of a repo pinned to a commit of a GitHub repo e.g.
+// https://github.com/kubeflow/manifests/archive/<sha>.tar.gz.
+var githubArchive = regexp.MustCompile(`^https://github\.com/([^/]+)/([^/]+)/archive/([0-9a-f]{40})\.tar\.gz$`)
+
+// releaseVersion matches a release e.g. v0.7.0; the submatches are the major and minor versions.
+var releaseVersion = regexp.MustCompile(`^v(\d+)\.(\d+)\.\d+(-[0-9A-Za-z.]+)?$`)
+
+// UpdateCheckConfig configures the periodic comparison of the manifests the deployments are
+// pinned to with their upstream release branch. Only repos pinned to a commit of a GitHub repo
+// are compared; the release branch of a version vX.Y.Z is vX.Y-branch.
+type UpdateCheckConfig struct {
+	// Interval is how often each deployment is compared; at least an hour.
+	Interval metav1.Duration `json:"interval"`
+}
+
+// validate returns an error if the interval is too short.
+func (c *UpdateCheckConfig) validate() error {
+	if c.Interval.Duration < minUpdateCheckInterval {
+		return fmt.Errorf("updateChecks interval must be at least %v", minUpdateCheckInterval)
+	}
+	return nil
+}
+
+// pinnedRepo is a repo of a KfDef pinned to a commit of a GitHub repo.
+type pinnedRepo struct {
+	Name  string
+	Owner string
+	Repo  string
+	SHA   string
+}
+
+// pinnedRepos returns the repos of d pinned to a commit of a GitHub repo.
+func pinnedRepos(d *kfdefs.KfDef) []pinnedRepo {
+	repos := []pinnedRepo{}
+	for _, r := range d.Spec.Repos {
+		m := githubArchive.FindStringSubmatch(r.Uri)
+		if m == nil {
+			continue
+		}
+		repos = append(repos, pinnedRepo{Name: r.Name, Owner: m[1], Repo: m[2], SHA: m[3]})
+	}
+	return repos
+}
+
+// releaseBranch returns the upstream branch of version e.g. v0.7-branch for v0.7.0 and master for
+// master; empty if the version doesn't track a branch.
+func releaseBranch(version string) string {
+	if version == "master" {
+		return version
+	}
+	m := releaseVersion.FindStringSubmatch(version)
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprintf("v%v.%v-branch", m[1], m[2])
+}
+
+// githubComparison is the part of the response of the GitHub compare API we use.
+type githubComparison struct {
+	// AheadBy is the number of commits of the branch the pinned commit doesn't have.
+	AheadBy int `json:"ahead_by"`
+	// Commits are the commits of the branch the pinned commit doesn't have, oldest first.
+	Commits []struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Message string `json:"message"`
+		} `json:"commit"`
+	} `json:"commits"`
+}
+
+// compareWithBranch compares the commit r is pinned to with branch.
+func compareWithBranch(ctx context.Context, client *http.Client, r pinnedRepo, branch string) (*githubComparison, error) {
+	u := fmt.Sprintf("%v/repos/%v/%v/compare/%v...%v", githubAPIURL, r.Owner, r.Repo, r.SHA, branch)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not compare %v with %v", r.Name, branch)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not compare %v with %v; GitHub returned %v", r.Name, branch, resp.Status)
+	}
+	c := &githubComparison{}
+	if err := json.NewDecoder(resp.Body).Decode(c); err != nil {
+		return nil, errors.Wrapf(err, "could not decode the comparison of %v with %v", r.Name, branch)
+	}
+	return c, nil
+}
+
+// summarizeChanges summarizes the commits of branch repo r doesn't have listing the latest ones.
+func summarizeChanges(r pinnedRepo, branch string, c *githubComparison) string {
+	listed := []string{}
+	for i := len(c.Commits) - 1; i >= 0 && len(listed) < maxListedChanges; i-- {
+		commit := c.Commits[i]
+		sha := commit.SHA
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		title := strings.SplitN(commit.Commit.Message, "\n", 2)[0]
+		listed = append(listed, fmt.Sprintf("%v %v", sha, title))
+	}
+	summary := fmt.Sprintf("%v is %v commits behind %v", r.Name, c.AheadBy, branch)
+	if len(listed) > 0 {
+		summary += ": " + strings.Join(listed, "; ")
+	}
+	if more := c.AheadBy - len(listed); more > 0 && len(listed) > 0 {
+		summary += fmt.Sprintf("; and %v more", more)
+	}
+	return summary
+}
+
+// checkUpstream compares the pinned repos of d with the release branch of its version and returns
+// the UpdateAvailable condition; nil if d has no repo pinned to a commit or its version doesn't
+// track a branch. A repo which can't be compared fails the check.
+func checkUpstream(ctx context.Context, client *http.Client, d *kfdefs.KfDef) (*kfdefs.KfDefCondition, error) {
+	branch := releaseBranch(d.Spec.Version)
+	repos := pinnedRepos(d)
+	if branch == "" || len(repos) == 0 {
+		return nil, nil
+	}
+
+	summaries := []string{}
+	for _, r := range repos {
+		c, err := compareWithBranch(ctx, client, r, branch)
+		if err != nil {
+			return nil, err
+		}
+		if c.AheadBy > 0 {
+			summaries = append(summaries, summarizeChanges(r, branch, c))
+		}
+	}
+
+	now := metav1.Now()
+	if len(summaries) == 0 {
+		return &kfdefs.KfDefCondition{
+			Type:               kfdefs.KfUpdateAvailable,
+			Status:             v1.ConditionFalse,
+			Reason:             ManifestsUpToDateReason,
+			Message:            fmt.Sprintf("The pinned manifests are up to date with %v.", branch),
+			LastUpdateTime:     now,
+			LastTransitionTime: now,
+		}, nil
+	}
+	return &kfdefs.KfDefCondition{
+		Type:               kfdefs.KfUpdateAvailable,
+		Status:             v1.ConditionTrue,
+		Reason:             ManifestsBehindReason,
+		Message:            strings.Join(summaries, "\n"),
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+	}, nil
+}
+
+// setUpdateCondition replaces the UpdateAvailable condition of d with condition. The transition
+// time is kept while the status doesn't change.
+func setUpdateCondition(d *kfdefs.KfDef, condition kfdefs.KfDefCondition) {
+	kept := []kfdefs.KfDefCondition{}
+	for _, c := range d.Status.Conditions {
+		if c.Type != kfdefs.KfUpdateAvailable {
+			kept = append(kept, c)
+			continue
+		}
+		if c.Status == condition.Status {
+			condition.LastTransitionTime = c.LastTransitionTime
+		}
+	}
+	d.Status.Conditions = append(kept, condition)
+}
+
+// checkForUpdates compares the deployment with its upstream release branch if update checks are
+// enabled and the last check is older than their interval. A failed check is only logged and
+// retried at the next interval; the condition of the last successful check is kept.
+func (s *kfctlServer) checkForUpdates(ctx context.Context, client *http.Client, now time.Time) {
+	if s.config == nil {
+		return
+	}
+	c := s.config.get().UpdateChecks
+	if c == nil {
+		return
+	}
+
+	s.kfDefMux.Lock()
+	due := now.Sub(s.lastUpdateCheck) >= c.Interval.Duration
+	d := s.latestKfDef.DeepCopy()
+	if due {
+		s.lastUpdateCheck = now
+	}
+	s.kfDefMux.Unlock()
+	if !due || d.Name == "" {
+		return
+	}
+
+	condition, err := checkUpstream(ctx, client, d)
+	if err != nil {
+		log.Warnf("Could not check deployment %v for updates; %v", d.Name, err)
+		return
+	}
+	if condition == nil {
+		return
+	}
+	if condition.Status == v1.ConditionTrue {
+		log.Infof("Deployment %v is behind its release branch; %v", d.Name, condition.Message)
+	}
+
+	s.kfDefMux.Lock()
+	defer s.kfDefMux.Unlock()
+	s.updateCondition = condition
+	setUpdateCondition(&s.latestKfDef, *condition)
+	s.publishStatus()
+}
+
+// startUpdateChecks checks for updates every period until stop is closed.
+func (s *kfctlServer) startUpdateChecks(period time.Duration, stop <-chan struct{}) {
+	client := &http.Client{Timeout: time.Minute}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkForUpdates(context.Background(), client, time.Now())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// keepUpdateCondition sets the UpdateAvailable condition of the last check on the latest KfDef
+// which replaced previous. The check is redone at the next tick if the repos changed. Callers
+// must hold kfDefMux.
+func (s *kfctlServer) keepUpdateCondition(previous *kfdefs.KfDef) {
+	if s.updateCondition == nil {
+		return
+	}
+	if !reflect.DeepEqual(pinnedRepos(previous), pinnedRepos(&s.latestKfDef)) || previous.Spec.Version != s.latestKfDef.Spec.Version {
+		s.updateCondition = nil
+		s.lastUpdateCheck = time.Time{}
+		return
+	}
+	setUpdateCondition(&s.latestKfDef, *s.updateCondition)
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPinnedSHA = "0123456789abcdef0123456789abcdef01234567"
+
+// newUpdateTestKfDef returns a KfDef at version pinning the manifests repo to testPinnedSHA.
+func newUpdateTestKfDef(version string) kfdefsv3.KfDef {
+	d := newPlanTestKfDef()
+	d.Spec.Version = version
+	d.Spec.Repos = []kfdefsv3.Repo{
+		{Name: "manifests", Uri: "https://github.com/kubeflow/manifests/archive/" + testPinnedSHA + ".tar.gz"},
+		{Name: "kubeflow", Uri: "https://github.com/kubeflow/kubeflow/archive/v0.7.0.tar.gz"},
+	}
+	return d
+}
+
+// newGitHubTestServer fakes the GitHub compare API; the pinned commit is aheadBy commits behind.
+func newGitHubTestServer(t *testing.T, aheadBy int, requested *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requested = append(*requested, r.URL.Path)
+		commits := []string{}
+		for i := 0; i < aheadBy; i++ {
+			commits = append(commits, fmt.Sprintf(`{"sha": "%040d", "commit": {"message": "Change %v\n\nDetails"}}`, i, i))
+		}
+		fmt.Fprintf(w, `{"status": "ahead", "ahead_by": %v, "commits": [%v]}`, aheadBy, strings.Join(commits, ","))
+	}))
+}
+
+func TestReleaseBranch(t *testing.T) {
+	cases := map[string]string{
+		"v0.7.0":     "v0.7-branch",
+		"v0.6.2":     "v0.6-branch",
+		"v1.0.0-rc1": "v1.0-branch",
+		"master":     "master",
+		"v0.7":       "",
+		"":           "",
+	}
+	for version, expected := range cases {
+		if actual := releaseBranch(version); actual != expected {
+			t.Errorf("Version %q: got %q; want %q", version, actual, expected)
+		}
+	}
+}
+
+func TestCheckUpstream(t *testing.T) {
+	defer func(u string) { githubAPIURL = u }(githubAPIURL)
+
+	var requested []string
+	server := newGitHubTestServer(t, 5, &requested)
+	defer server.Close()
+	githubAPIURL = server.URL
+
+	d := newUpdateTestKfDef("v0.7.0")
+	c, err := checkUpstream(context.Background(), server.Client(), &d)
+	if err != nil {
+		t.Fatalf("checkUpstream error; %v", err)
+	}
+	// Only the repo pinned to a commit is compared.
+	if expected := "/repos/kubeflow/manifests/compare/" + testPinnedSHA + "...v0.7-branch"; len(requested) != 1 || requested[0] != expected {
+		t.Errorf("Requested %v; want %v", requested, expected)
+	}
+	if c == nil || c.Status != v1.ConditionTrue || c.Reason != ManifestsBehindReason {
+		t.Fatalf("Got condition %v; want UpdateAvailable true", c)
+	}
+	for _, s := range []string{"5 commits behind v0.7-branch", "Change 4", "Change 2", "and 2 more"} {
+		if !strings.Contains(c.Message, s) {
+			t.Errorf("Message %q doesn't contain %q", c.Message, s)
+		}
+	}
+	if strings.Contains(c.Message, "Details") || strings.Contains(c.Message, "Change 1") {
+		t.Errorf("Message %q should only list the titles of the latest changes", c.Message)
+	}
+
+	// A deployment whose version doesn't track a branch isn't checked.
+	requested = nil
+	d.Spec.Version = "custom"
+	if c, err := checkUpstream(context.Background(), server.Client(), &d); err != nil || c != nil || len(requested) != 0 {
+		t.Errorf("Got %v, %v after requesting %v; want no check", c, err, requested)
+	}
+}
+
+func TestCheckForUpdates(t *testing.T) {
+	defer func(u string) { githubAPIURL = u }(githubAPIURL)
+
+	var requested []string
+	server := newGitHubTestServer(t, 0, &requested)
+	defer server.Close()
+	githubAPIURL = server.URL
+
+	config := DefaultServerConfig()
+	config.UpdateChecks = &UpdateCheckConfig{Interval: metav1.Duration{Duration: 6 * time.Hour}}
+	store, err := newServerConfigStore("", config)
+	if err != nil {
+		t.Fatalf("newServerConfigStore: %v", err)
+	}
+	s := &kfctlServer{latestKfDef: newUpdateTestKfDef("v0.7.0"), config: store}
+
+	now := time.Now()
+	s.checkForUpdates(context.Background(), server.Client(), now)
+	if len(requested) != 1 {
+		t.Fatalf("Requested %v; want a comparison", requested)
+	}
+	if c, ok := updateConditionOf(s.latestKfDef); !ok || c.Status != v1.ConditionFalse || c.Reason != ManifestsUpToDateReason {
+		t.Errorf("Got condition %v; want UpdateAvailable false", c)
+	}
+
+	// The deployment isn't compared again before the interval elapsed.
+	s.checkForUpdates(context.Background(), server.Client(), now.Add(time.Hour))
+	if len(requested) != 1 {
+		t.Errorf("Requested %v; want no comparison before the interval elapsed", requested)
+	}
+
+	// The condition is kept when the KfDef is replaced unless the pinned repos change.
+	previous := s.latestKfDef.DeepCopy()
+	s.latestKfDef.Status.Conditions = nil
+	s.keepUpdateCondition(previous)
+	if _, ok := updateConditionOf(s.latestKfDef); !ok {
+		t.Errorf("The UpdateAvailable condition wasn't kept")
+	}
+	previous = s.latestKfDef.DeepCopy()
+	s.latestKfDef.Spec.Repos[0].Uri = "https://github.com/kubeflow/manifests/archive/" + strings.Repeat("f", 40) + ".tar.gz"
+	s.latestKfDef.Status.Conditions = nil
+	s.keepUpdateCondition(previous)
+	if _, ok := updateConditionOf(s.latestKfDef); ok || !s.lastUpdateCheck.IsZero() {
+		t.Errorf("Want the check to be redone after the pinned repos changed")
+	}
+	s.checkForUpdates(context.Background(), server.Client(), now.Add(time.Hour))
+	if len(requested) != 2 {
+		t.Errorf("Requested %v; want a comparison of the new pin", requested)
+	}
+}
+
+// updateConditionOf returns the UpdateAvailable condition of d.
+func updateConditionOf(d kfdefsv3.KfDef) (kfdefsv3.KfDefCondition, bool) {
+	for _, c := range d.Status.Conditions {
+		if c.Type == kfdefsv3.KfUpdateAvailable {
+			return c, true
+		}
+	}
+	return kfdefsv3.KfDefCondition{}, false
+}
@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// KfctlUpgradePreviewPath is the path on which to serve requests to preview upgrading a deployment
+const KfctlUpgradePreviewPath = "/kfctl/apps/v1alpha2/upgrade/preview"
+
+// ApplicationChange is how upgrading changes an application.
+type ApplicationChange string
+
+const (
+	ApplicationAdded        ApplicationChange = "Added"
+	ApplicationRemoved      ApplicationChange = "Removed"
+	ApplicationUpgraded     ApplicationChange = "Upgraded"
+	ApplicationReconfigured ApplicationChange = "Reconfigured"
+	ApplicationUnchanged    ApplicationChange = "Unchanged"
+)
+
+// ApplicationUpgrade is the change to a single application.
+type ApplicationUpgrade struct {
+	Name   string            `json:"name"`
+	Change ApplicationChange `json:"change"`
+	// Current and Target are the versions of the manifests the application is applied from e.g.
+	// v0.6.2; empty if the deployment doesn't have the application before or after the upgrade.
+	Current string `json:"current,omitempty"`
+	Target  string `json:"target,omitempty"`
+}
+
+// UpgradePreview is what submitting the target KfDef for an existing deployment would change.
+type UpgradePreview struct {
+	Name           string               `json:"name"`
+	CurrentVersion string               `json:"currentVersion,omitempty"`
+	TargetVersion  string               `json:"targetVersion,omitempty"`
+	Applications   []ApplicationUpgrade `json:"applications"`
+	// UpdatedCRDs are the CRDs in the inventory created by upgraded applications e.g.
+	// CustomResourceDefinition/tfjobs.kubeflow.org; custom resources of them may need migrating.
+	UpdatedCRDs []string `json:"updatedCrds,omitempty"`
+	// Removed are the objects in the inventory created by applications the target doesn't have.
+	// Applying doesn't delete them; they are deleted with the deployment or by hand.
+	Removed []string `json:"removed,omitempty"`
+}
+
+// repoVersion matches the version in the URI of a manifests repo e.g.
+// https://github.com/kubeflow/manifests/archive/v0.6.2.tar.gz or ...?ref=v0.6.2.
+var repoVersion = regexp.MustCompile(`(?:/archive/([^/]+?)\.(?:tar\.gz|zip)|[?&]ref=([^&]+))$`)
+
+// applicationVersion returns the version of the manifests app is applied from; the version in
+// the URI of its repo or else the version of the KfDef.
+func applicationVersion(d *kfdefs.KfDef, app kfdefs.Application) string {
+	if app.KustomizeConfig != nil && app.KustomizeConfig.RepoRef != nil {
+		for _, r := range d.Spec.Repos {
+			if r.Name != app.KustomizeConfig.RepoRef.Name {
+				continue
+			}
+			if m := repoVersion.FindStringSubmatch(r.Uri); m != nil {
+				if m[1] != "" {
+					return m[1]
+				}
+				return m[2]
+			}
+		}
+	}
+	return d.Spec.Version
+}
+
+// previewUpgrade compares the applications of the target KfDef with the current KfDef of the
+// deployment and its inventory.
+func previewUpgrade(current *kfdefs.KfDef, target *kfdefs.KfDef) *UpgradePreview {
+	p := &UpgradePreview{
+		Name:           current.Name,
+		CurrentVersion: current.Spec.Version,
+		TargetVersion:  target.Spec.Version,
+		Applications:   []ApplicationUpgrade{},
+	}
+
+	currentApps := map[string]kfdefs.Application{}
+	for _, a := range current.Spec.Applications {
+		currentApps[a.Name] = a
+	}
+	targetApps := map[string]bool{}
+	upgraded := map[string]bool{}
+	for _, a := range target.Spec.Applications {
+		targetApps[a.Name] = true
+		u := ApplicationUpgrade{
+			Name:   a.Name,
+			Target: applicationVersion(target, a),
+		}
+		before, ok := currentApps[a.Name]
+		switch {
+		case !ok:
+			u.Change = ApplicationAdded
+		default:
+			u.Current = applicationVersion(current, before)
+			switch {
+			case u.Current != u.Target:
+				u.Change = ApplicationUpgraded
+				upgraded[a.Name] = true
+			case !reflect.DeepEqual(before.KustomizeConfig, a.KustomizeConfig):
+				u.Change = ApplicationReconfigured
+			default:
+				u.Change = ApplicationUnchanged
+			}
+		}
+		p.Applications = append(p.Applications, u)
+	}
+	removed := map[string]bool{}
+	for _, a := range current.Spec.Applications {
+		if targetApps[a.Name] {
+			continue
+		}
+		removed[a.Name] = true
+		p.Applications = append(p.Applications, ApplicationUpgrade{
+			Name:    a.Name,
+			Change:  ApplicationRemoved,
+			Current: applicationVersion(current, a),
+		})
+	}
+
+	for _, r := range current.Status.Inventory {
+		object := fmt.Sprintf("%v/%v", r.Kind, r.Name)
+		if r.Namespace != "" {
+			object = fmt.Sprintf("%v %v/%v", r.Kind, r.Namespace, r.Name)
+		}
+		switch {
+		case removed[r.Source]:
+			p.Removed = append(p.Removed, object)
+		case upgraded[r.Source] && r.Kind == "CustomResourceDefinition":
+			p.UpdatedCRDs = append(p.UpdatedCRDs, object)
+		}
+	}
+	sort.Strings(p.UpdatedCRDs)
+	sort.Strings(p.Removed)
+	return p
+}
+
+// PreviewUpgrade returns what submitting the KfDef in the request would change in the deployment
+// handled by the server without changing anything.
+func (s *kfctlServer) PreviewUpgrade(ctx context.Context, req kfdefs.KfDef) (*UpgradePreview, error) {
+	if err := newValidationError("KfDef.Spec is invalid", req.Validate()); err != nil {
+		return nil, err
+	}
+
+	s.kfDefMux.Lock()
+	latest := s.latestKfDef.DeepCopy()
+	s.kfDefMux.Unlock()
+
+	if latest.Name == "" || latest.Name != req.Name {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+	p := previewUpgrade(latest, &req)
+	log.Infof("Upgrade preview of deployment %v from %v to %v: %v applications, %v CRDs updated, %v objects removed",
+		req.Name, p.CurrentVersion, p.TargetVersion, len(p.Applications), len(p.UpdatedCRDs), len(p.Removed))
+	return p, nil
+}
+
+// PreviewUpgrade forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) PreviewUpgrade(ctx context.Context, req kfdefs.KfDef) (*UpgradePreview, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.readClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.PreviewUpgrade(ctx, req)
+}
+
+// PreviewUpgrade asks the server what submitting the KfDef would change in the deployment.
+func (c *KfctlClient) PreviewUpgrade(ctx context.Context, req kfdefs.KfDef) (*UpgradePreview, error) {
+	var resp interface{}
+	err := c.retry("PreviewUpgrade", func() error {
+		var err error
+		resp, err = c.upgradePreviewEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*UpgradePreview)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeUpgradePreviewEndpoint creates an endpoint to handle requests to preview upgrading the deployment.
+func makeUpgradePreviewEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.PreviewUpgrade(ctx, req)
+	}
+}
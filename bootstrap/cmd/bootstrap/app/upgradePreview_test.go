@@ -0,0 +1,109 @@
+package app
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"reflect"
+	"testing"
+)
+
+func TestApplicationVersion(t *testing.T) {
+	type testCase struct {
+		uri      string
+		expected string
+	}
+
+	cases := []testCase{
+		{uri: "https://github.com/kubeflow/manifests/archive/v0.6.2.tar.gz", expected: "v0.6.2"},
+		{uri: "https://github.com/kubeflow/manifests/archive/master.zip", expected: "master"},
+		{uri: "git::https://github.com/kubeflow/manifests.git?ref=v0.7-branch", expected: "v0.7-branch"},
+		{uri: "file:///opt/manifests", expected: "v0.7.0"},
+	}
+
+	for _, c := range cases {
+		d := &kfdefs.KfDef{
+			Spec: kfdefs.KfDefSpec{
+				Version: "v0.7.0",
+				Repos:   []kfdefs.Repo{{Name: "manifests", Uri: c.uri}},
+			},
+		}
+		app := kfdefs.Application{
+			Name: "jupyter",
+			KustomizeConfig: &kfdefs.KustomizeConfig{
+				RepoRef: &kfdefs.RepoRef{Name: "manifests", Path: "jupyter/jupyter-web-app"},
+			},
+		}
+		if got := applicationVersion(d, app); got != c.expected {
+			t.Errorf("applicationVersion(%v): got %v; want %v", c.uri, got, c.expected)
+		}
+	}
+}
+
+func TestPreviewUpgrade(t *testing.T) {
+	app := func(name string, overlays ...string) kfdefs.Application {
+		return kfdefs.Application{
+			Name: name,
+			KustomizeConfig: &kfdefs.KustomizeConfig{
+				RepoRef:  &kfdefs.RepoRef{Name: "manifests", Path: name},
+				Overlays: overlays,
+			},
+		}
+	}
+	current := &kfdefs.KfDef{
+		Spec: kfdefs.KfDefSpec{
+			Version: "v0.6.2",
+			Repos:   []kfdefs.Repo{{Name: "manifests", Uri: "https://github.com/kubeflow/manifests/archive/v0.6.2.tar.gz"}},
+			Applications: []kfdefs.Application{
+				app("tf-job-operator"),
+				app("centraldashboard"),
+				app("ambassador"),
+			},
+		},
+		Status: kfdefs.KfDefStatus{
+			Inventory: []kfdefs.InventoryResource{
+				{Kind: "CustomResourceDefinition", APIVersion: "apiextensions.k8s.io/v1beta1", Name: "tfjobs.kubeflow.org", Source: "tf-job-operator"},
+				{Kind: "Deployment", APIVersion: "apps/v1", Namespace: "kubeflow", Name: "tf-job-operator", Source: "tf-job-operator"},
+				{Kind: "Deployment", APIVersion: "apps/v1", Namespace: "kubeflow", Name: "ambassador", Source: "ambassador"},
+				{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1", Name: "ambassador", Source: "ambassador"},
+				{Kind: "Namespace", APIVersion: "v1", Name: "kubeflow", Source: "namespaces"},
+			},
+		},
+	}
+	current.Name = "kf-app"
+
+	// The target moves the upgraded applications to a second repo so the others keep their version.
+	target := current.DeepCopy()
+	target.Spec.Version = "v0.7.0"
+	target.Spec.Repos = append(target.Spec.Repos, kfdefs.Repo{Name: "manifests-v0.7", Uri: "https://github.com/kubeflow/manifests/archive/v0.7.0.tar.gz"})
+	upgraded := app("tf-job-operator")
+	upgraded.KustomizeConfig.RepoRef.Name = "manifests-v0.7"
+	target.Spec.Applications = []kfdefs.Application{
+		upgraded,
+		app("centraldashboard", "istio"),
+		app("metadata"),
+	}
+	target.Spec.Applications[2].KustomizeConfig.RepoRef.Name = "manifests-v0.7"
+
+	p := previewUpgrade(current, target)
+	if p.CurrentVersion != "v0.6.2" || p.TargetVersion != "v0.7.0" {
+		t.Errorf("versions: got %v -> %v; want v0.6.2 -> v0.7.0", p.CurrentVersion, p.TargetVersion)
+	}
+	expected := []ApplicationUpgrade{
+		{Name: "tf-job-operator", Change: ApplicationUpgraded, Current: "v0.6.2", Target: "v0.7.0"},
+		{Name: "centraldashboard", Change: ApplicationReconfigured, Current: "v0.6.2", Target: "v0.6.2"},
+		{Name: "metadata", Change: ApplicationAdded, Target: "v0.7.0"},
+		{Name: "ambassador", Change: ApplicationRemoved, Current: "v0.6.2"},
+	}
+	if !reflect.DeepEqual(p.Applications, expected) {
+		t.Errorf("applications: got %+v; want %+v", p.Applications, expected)
+	}
+	if want := []string{"CustomResourceDefinition/tfjobs.kubeflow.org"}; !reflect.DeepEqual(p.UpdatedCRDs, want) {
+		t.Errorf("updated CRDs: got %v; want %v", p.UpdatedCRDs, want)
+	}
+	if want := []string{"ClusterRole/ambassador", "Deployment kubeflow/ambassador"}; !reflect.DeepEqual(p.Removed, want) {
+		t.Errorf("removed: got %v; want %v", p.Removed, want)
+	}
+
+	if p := previewUpgrade(current, current); len(p.UpdatedCRDs) != 0 || len(p.Removed) != 0 {
+		t.Errorf("previewUpgrade of the same KfDef: got %+v", p)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"io/ioutil"
@@ -31,6 +32,16 @@ func copyFile(src, dst string) error {
 	return err
 }
 
+// writeFileAtomic replaces file with buf; the file is only readable by the server. buf is written
+// to a temporary file which is then renamed so a crash doesn't leave a partial file.
+func writeFileAtomic(file string, buf []byte) error {
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, file))
+}
+
 // Pformat returns a pretty format output of any value.
 func Pformat(value interface{}) (string, error) {
 	if s, ok := value.(string); ok {
@@ -51,7 +62,29 @@ func err2code(err error) int {
 // errorEncoder is a custom error used to encode errors into the http response.
 // If the error is of type httpError that is used to obtain the statuscode.
 // TODO(jlewi): Should we follow the model
-func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+func errorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	err = durationLimitError(ctx, err)
+	if o, ok := err.(*OverloadedError); ok {
+		for k, v := range o.Headers() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(o.StatusCode())
+		json.NewEncoder(w).Encode(o)
+		return
+	}
+
+	if v, ok := err.(*ValidationError); ok {
+		w.WriteHeader(v.StatusCode())
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+
+	if l, ok := err.(*RequestLimitError); ok {
+		w.WriteHeader(l.StatusCode())
+		json.NewEncoder(w).Encode(l)
+		return
+	}
+
 	h, ok := err.(*httpError)
 
 	if ok {
@@ -72,6 +105,14 @@ func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
 type httpError struct {
 	Message string
 	Code    int
+
+	// ErrorCode and Remediation are set if the cause of the error is known; see withRemediation.
+	ErrorCode   ErrorCode    `json:",omitempty"`
+	Remediation *Remediation `json:",omitempty"`
+
+	// cause is the underlying error. It is logged and recorded in the error history; it isn't
+	// part of the response but GetErrorHistory returns it to the users with access to the deployment.
+	cause error
 }
 
 func (e *httpError) Error() string {
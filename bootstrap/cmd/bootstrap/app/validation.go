@@ -0,0 +1,79 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"net/http"
+)
+
+// ValidationError is returned when a KfDef fails validation. It is served as a 400 like an
+// httpError with the failures of each field so CLI and UI callers can highlight the offending
+// fields of the KfDef.
+type ValidationError struct {
+	Message string
+	// Fields are the validation failures; Field is the path of the offending field in the KfDef.
+	Fields []kfdefs.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// StatusCode implements the StatusCoder interface of go-kit's http transport.
+func (e *ValidationError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// MarshalJSON encodes the error like an httpError so older clients can still decode it.
+func (e *ValidationError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&validationPayload{
+		httpError: httpError{
+			Message: e.Message,
+			Code:    e.StatusCode(),
+		},
+		Fields: e.Fields,
+	})
+}
+
+// IsValidationError returns true if err is a ValidationError.
+func IsValidationError(err error) bool {
+	_, ok := err.(*ValidationError)
+	return ok
+}
+
+// validationPayload is the body of an error response; Fields is only set for a ValidationError
+// and Limit for a RequestLimitError.
+type validationPayload struct {
+	httpError
+	Fields []kfdefs.FieldError `json:",omitempty"`
+	Limit  string              `json:",omitempty"`
+}
+
+// validationError returns the ValidationError sent in the response r with the decoded body p or
+// nil if r isn't a 400 listing the failures of fields.
+func validationError(r *http.Response, p *validationPayload) *ValidationError {
+	if r.StatusCode != http.StatusBadRequest || len(p.Fields) == 0 {
+		return nil
+	}
+	return &ValidationError{
+		Message: p.Message,
+		Fields:  p.Fields,
+	}
+}
+
+// newValidationError returns a ValidationError for the failures or nil if there are none.
+// The message is prefixed with what failed e.g. "KfDef.Spec is invalid".
+func newValidationError(prefix string, failures []kfdefs.FieldError) *ValidationError {
+	if len(failures) == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("%v; %v", prefix, failures[0].Message)
+	if len(failures) > 1 {
+		message = fmt.Sprintf("%v (and %v more)", message, len(failures)-1)
+	}
+	return &ValidationError{
+		Message: message,
+		Fields:  failures,
+	}
+}
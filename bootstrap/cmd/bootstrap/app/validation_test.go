@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateCreate(t *testing.T) {
+	d := newPlanTestKfDef()
+	if failures := lint.Validate(&d); len(failures) != 0 {
+		t.Fatalf("lint.Validate of a valid KfDef: got %v", failures)
+	}
+	if err := newValidationError("KfDef.Spec is invalid", nil); err != nil {
+		t.Errorf("newValidationError without failures: got %v; want nil", err)
+	}
+
+	d.Spec.PackageManager = ""
+	d.Spec.Features = []string{"time-travel"}
+	err := newValidationError("KfDef.Spec is invalid", lint.Validate(&d))
+	if err == nil || len(err.Fields) != 2 {
+		t.Fatalf("newValidationError: got %+v; want failures of spec.packageManager and spec.features", err)
+	}
+	if err.Fields[0].Field != "spec.packageManager" || err.Fields[1].Field != "spec.features" {
+		t.Errorf("Fields: got %v", err.Fields)
+	}
+	if !strings.HasPrefix(err.Message, "KfDef.Spec is invalid; KfDef.Spec.PackageManager is required") || !strings.HasSuffix(err.Message, "(and 1 more)") {
+		t.Errorf("Message: got %q", err.Message)
+	}
+}
+
+func TestValidationError_RoundTrip(t *testing.T) {
+	sent := &ValidationError{
+		Message: "KfDef.Spec is invalid; invalid name",
+		Fields:  []kfdefsv3.FieldError{{Field: "metadata.name", Message: "invalid name"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorEncoder(r.Context(), sent, w)
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Status: got %v; want %v", res.StatusCode, http.StatusBadRequest)
+	}
+
+	_, err = makeHTTPResponseDecoder(func() interface{} { return &kfdefsv3.KfDef{} })(context.Background(), res)
+	vErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Decoded error: got %T %v; want a ValidationError", err, err)
+	}
+	if vErr.Message != sent.Message || len(vErr.Fields) != 1 || vErr.Fields[0] != sent.Fields[0] {
+		t.Errorf("Decoded error: got %+v; want %+v", vErr, sent)
+	}
+
+	// Older clients decode the error as an httpError.
+	buf, err := json.Marshal(sent)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	h := httpError{}
+	if err := json.Unmarshal(buf, &h); err != nil || h.Code != http.StatusBadRequest || h.Message != sent.Message {
+		t.Errorf("Decoded as an httpError: got %+v, %v", h, err)
+	}
+}
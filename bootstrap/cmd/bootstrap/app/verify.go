@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"net/http"
+)
+
+// KfctlVerifyPath is the path on which to serve requests to verify the cluster against the signed manifests of the deployment
+const KfctlVerifyPath = "/kfctl/apps/v1alpha2/verify"
+
+// clusterPlugin returns the kustomize plugin of the deployment handled by the server configured
+// to access the cluster if it is the deployment in the request, and the latest KfDef of the
+// deployment. The access token in the request replaces the current one.
+func (s *kfctlServer) clusterPlugin(ctx context.Context, req kfdefs.KfDef) (kustomize.Setter, *kfdefs.KfDef, error) {
+	s.kfDefMux.Lock()
+	latest := *s.latestKfDef.DeepCopy()
+	ts := s.ts
+	s.kfDefMux.Unlock()
+
+	if latest.Name == "" || latest.Name != req.Name || s.kfDefGetter == nil {
+		return nil, nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v not found", req.Name),
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	if token, err := req.GetSecret(gcp.GcpAccessTokenName); err == nil && ts != nil {
+		if err := ts.Refresh(oauth2.Token{AccessToken: token}); err != nil {
+			log.Errorf("Refreshing the token failed; %v", err)
+			return nil, nil, &httpError{
+				Message: fmt.Sprintf("Could not verify you have admin priveleges on project %v", req.Spec.Project),
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+
+	p, err := s.configureKustomizePlugin(ctx, latest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, &latest, nil
+}
+
+// manifestVerifier returns the kustomize plugin of the deployment handled by the server configured
+// to read the cluster if it is the deployment in the request.
+func (s *kfctlServer) manifestVerifier(ctx context.Context, req kfdefs.KfDef) (kustomize.ManifestVerifier, error) {
+	p, latest, err := s.clusterPlugin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Spec.ManifestSigning == nil {
+		return nil, &httpError{
+			Message: fmt.Sprintf("Deployment %v doesn't sign its manifests; set manifestSigning in the KfDef", req.Name),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	v, ok := p.(kustomize.ManifestVerifier)
+	if !ok {
+		log.Errorf("The kustomize plugin doesn't implement the ManifestVerifier interface")
+		return nil, &httpError{
+			Message: "Internal service error please try again later.",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return v, nil
+}
+
+// VerifyManifests checks the signatures of the manifests the deployment handled by the server was
+// last applied with and compares the objects in the cluster with them.
+func (s *kfctlServer) VerifyManifests(ctx context.Context, req kfdefs.KfDef) (*kustomize.ManifestVerification, error) {
+	// The manifests and signatures are replaced while the deployment is being applied.
+	s.opMux.Lock()
+	defer s.opMux.Unlock()
+
+	v, err := s.manifestVerifier(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	report, err := v.VerifyManifests()
+	if err != nil {
+		log.Errorf("Could not verify the manifests of %v; error %v", req.Name, err)
+		return nil, &httpError{
+			Message: "Could not verify the manifests of the deployment; please try again later",
+			Code:    http.StatusInternalServerError,
+			cause:   err,
+		}
+	}
+	if !report.Verified {
+		log.Warnf("The cluster of deployment %v doesn't match its signed manifests", req.Name)
+	}
+	return report, nil
+}
+
+// VerifyManifests forwards the request to the backend handling the deployment.
+func (r *kfctlRouter) VerifyManifests(ctx context.Context, req kfdefs.KfDef) (*kustomize.ManifestVerification, error) {
+	if _, err := r.authCheckAndExtractService(req, RoleViewer); err != nil {
+		return nil, err
+	}
+	c, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.VerifyManifests(ctx, req)
+}
+
+// VerifyManifests checks the cluster of the deployment against its signed manifests.
+func (c *KfctlClient) VerifyManifests(ctx context.Context, req kfdefs.KfDef) (*kustomize.ManifestVerification, error) {
+	var resp interface{}
+	err := c.retry("VerifyManifests", func() error {
+		var err error
+		resp, err = c.verifyEndpoint(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*kustomize.ManifestVerification)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeVerifyEndpoint creates an endpoint to handle requests to verify the manifests of the deployment.
+func makeVerifyEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(kfdefs.KfDef)
+		return svc.VerifyManifests(ctx, req)
+	}
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestKfctlServer_VerifyManifestsNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newPauseTestServer(t, dir)
+	req := newPlanTestKfDef()
+
+	// The KfApp isn't loaded until the deployment is applied.
+	_, err = s.VerifyManifests(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("VerifyManifests before the deployment is applied: want 404; got %v", err)
+	}
+
+	req.Name = "other"
+	_, err = s.VerifyManifests(context.Background(), req)
+	if hErr, ok := err.(*httpError); !ok || hErr.Code != http.StatusNotFound {
+		t.Errorf("VerifyManifests of another deployment: want 404; got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+)
+
+// KfctlVersionsPath is the path on which to serve requests to list the deployable Kubeflow versions
+const KfctlVersionsPath = "/kfctl/apps/v1alpha2/versions"
+
+// KubeflowVersion is a Kubeflow version the service can deploy.
+type KubeflowVersion struct {
+	// Version is the Kubeflow version e.g. v0.7.0; it is the spec.version of the KfDef.
+	Version string `json:"version"`
+	// ManifestsRef is the URI of the manifests repo of the version e.g.
+	// https://github.com/kubeflow/manifests/archive/v0.7.0.tar.gz.
+	ManifestsRef string `json:"manifestsRef,omitempty"`
+	// ReleaseNotes is the URL of the release notes of the version.
+	ReleaseNotes string `json:"releaseNotes,omitempty"`
+	// Deprecated versions can still be deployed but users should pick a newer one.
+	Deprecated bool `json:"deprecated,omitempty"`
+	// Default is the version preselected for new deployments; at most one version is the default.
+	Default bool `json:"default,omitempty"`
+}
+
+// VersionsRequest asks for the deployable Kubeflow versions.
+type VersionsRequest struct {
+	// IncludeDeprecated lists the deprecated versions as well.
+	IncludeDeprecated bool `json:"includeDeprecated,omitempty"`
+}
+
+// VersionList is the deployable Kubeflow versions in the order of the registry.
+type VersionList struct {
+	Versions []KubeflowVersion `json:"versions"`
+}
+
+// defaultVersions is the registry of versions used when the server config doesn't set one.
+var defaultVersions = []KubeflowVersion{
+	{
+		Version:      "v0.7.0",
+		ManifestsRef: "https://github.com/kubeflow/manifests/archive/v0.7.0.tar.gz",
+		ReleaseNotes: "https://github.com/kubeflow/kubeflow/releases/tag/v0.7.0",
+		Default:      true,
+	},
+	{
+		Version:      "v0.6.2",
+		ManifestsRef: "https://github.com/kubeflow/manifests/archive/v0.6.2.tar.gz",
+		ReleaseNotes: "https://github.com/kubeflow/kubeflow/releases/tag/v0.6.2",
+	},
+	{
+		Version:      "master",
+		ManifestsRef: "https://github.com/kubeflow/manifests/archive/master.tar.gz",
+	},
+}
+
+// validateVersions returns an error if the registry of versions isn't valid.
+func validateVersions(versions []KubeflowVersion) error {
+	seen := map[string]bool{}
+	defaults := 0
+	for _, v := range versions {
+		if v.Version == "" {
+			return fmt.Errorf("versions must set version")
+		}
+		if seen[v.Version] {
+			return fmt.Errorf("version %v is listed more than once", v.Version)
+		}
+		seen[v.Version] = true
+		if v.ReleaseNotes != "" {
+			u, err := url.Parse(v.ReleaseNotes)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("releaseNotes %q of version %v must be an http or https URL", v.ReleaseNotes, v.Version)
+			}
+		}
+		if v.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("at most one version may be the default")
+	}
+	return nil
+}
+
+// listVersions returns the versions in the registry of c. The versions lint considers deprecated
+// are flagged even if the registry doesn't.
+func listVersions(c *ServerConfig, req VersionsRequest) *VersionList {
+	registry := c.Versions
+	if len(registry) == 0 {
+		registry = defaultVersions
+	}
+	l := &VersionList{Versions: []KubeflowVersion{}}
+	for _, v := range registry {
+		v.Deprecated = v.Deprecated || lint.IsDeprecatedVersion(v.Version)
+		if v.Deprecated && !req.IncludeDeprecated {
+			continue
+		}
+		l.Versions = append(l.Versions, v)
+	}
+	return l
+}
+
+// ListVersions returns the Kubeflow versions the server can deploy.
+func (s *kfctlServer) ListVersions(ctx context.Context, req VersionsRequest) (*VersionList, error) {
+	return listVersions(s.config.get(), req), nil
+}
+
+// ListVersions returns the Kubeflow versions the service can deploy.
+// Listing is stateless so the router handles it directly rather than forwarding to a backend.
+func (r *kfctlRouter) ListVersions(ctx context.Context, req VersionsRequest) (*VersionList, error) {
+	return listVersions(r.config.get(), req), nil
+}
+
+// ListVersions asks the server for the Kubeflow versions it can deploy.
+func (c *KfctlClient) ListVersions(ctx context.Context, req VersionsRequest) (*VersionList, error) {
+	resp, err := c.versionsEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := resp.(*VersionList)
+
+	if ok {
+		return response, nil
+	}
+
+	pRes, _ := Pformat(resp)
+	log.Errorf("Recieved unexpected response; %v", pRes)
+	return nil, fmt.Errorf("Recieved unexpected response; %v", pRes)
+}
+
+// makeVersionsEndpoint creates an endpoint to handle requests to list the deployable versions.
+func makeVersionsEndpoint(svc KfctlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(VersionsRequest)
+		return svc.ListVersions(ctx, req)
+	}
+}
+
+// decodeHTTPVersionsRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded VersionsRequest from the HTTP request body.
+func decodeHTTPVersionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request VersionsRequest
+	if err := decodeBody(r, &request); err != nil {
+		log.Info("Err decoding versions request: " + err.Error())
+		return nil, err
+	}
+	return request, nil
+}
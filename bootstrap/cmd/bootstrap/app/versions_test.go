@@ -0,0 +1,57 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListVersions(t *testing.T) {
+	names := func(l *VersionList) []string {
+		n := []string{}
+		for _, v := range l.Versions {
+			n = append(n, v.Version)
+		}
+		return n
+	}
+
+	c := DefaultServerConfig()
+	if got := names(listVersions(c, VersionsRequest{})); !reflect.DeepEqual(got, []string{"v0.7.0", "v0.6.2", "master"}) {
+		t.Errorf("Default registry: got %v", got)
+	}
+
+	c.Versions = []KubeflowVersion{
+		{Version: "v0.7.1", Default: true},
+		{Version: "v0.6.2", Deprecated: true},
+		{Version: "v0.5.1"},
+	}
+	if got := names(listVersions(c, VersionsRequest{})); !reflect.DeepEqual(got, []string{"v0.7.1"}) {
+		t.Errorf("Without deprecated versions: got %v; want [v0.7.1]", got)
+	}
+	l := listVersions(c, VersionsRequest{IncludeDeprecated: true})
+	if got := names(l); !reflect.DeepEqual(got, []string{"v0.7.1", "v0.6.2", "v0.5.1"}) {
+		t.Errorf("With deprecated versions: got %v", got)
+	}
+	if !l.Versions[2].Deprecated {
+		t.Errorf("v0.5.1 should be flagged as deprecated")
+	}
+	if c.Versions[2].Deprecated {
+		t.Errorf("listVersions modified the registry")
+	}
+}
+
+func TestValidateVersions(t *testing.T) {
+	if err := validateVersions(defaultVersions); err != nil {
+		t.Errorf("validateVersions(defaultVersions): %v", err)
+	}
+	invalid := [][]KubeflowVersion{
+		{{ReleaseNotes: "https://github.com/kubeflow/kubeflow/releases"}},
+		{{Version: "v0.7.0"}, {Version: "v0.7.0"}},
+		{{Version: "v0.7.0", ReleaseNotes: "github.com/kubeflow/kubeflow/releases"}},
+		{{Version: "v0.7.0", Default: true}, {Version: "v0.6.2", Default: true}},
+	}
+	for _, v := range invalid {
+		if err := validateVersions(v); err == nil {
+			t.Errorf("validateVersions(%+v): want an error", v)
+		}
+	}
+}
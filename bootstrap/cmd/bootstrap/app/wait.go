@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults of WaitOptions.
+const (
+	defaultWaitInitialInterval = 2 * time.Second
+	defaultWaitMaxInterval     = time.Minute
+	waitIntervalMultiplier     = 1.5
+)
+
+// WaitOptions configures how WaitForDeployment polls the server.
+type WaitOptions struct {
+	// InitialInterval is the delay before the second poll; defaults to 2s. The delay grows after
+	// each poll so that long deployments don't keep the server busy answering polls.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between polls; defaults to 1m.
+	MaxInterval time.Duration
+	// Timeout if non zero bounds the wait in addition to the context.
+	Timeout time.Duration
+}
+
+// DeploymentResult is the outcome of the run of a deployment returned by WaitForDeployment.
+type DeploymentResult struct {
+	Name string
+	// Phase is the phase the run ended in; one of Done, Failed or Canceled.
+	Phase DeploymentPhase
+	// Message is the error of a failed run if the server reported one.
+	Message string
+	// KfDef is the latest KfDef of the deployment.
+	KfDef *kfdefs.KfDef
+	// Polls is the number of times the server was polled.
+	Polls int
+	// Elapsed is how long WaitForDeployment waited.
+	Elapsed time.Duration
+}
+
+// Succeeded returns true if the run was applied successfully.
+func (r *DeploymentResult) Succeeded() bool {
+	return r.Phase == PhaseDone
+}
+
+// isTerminalPhase returns true if the run of a deployment ended in phase.
+func isTerminalPhase(phase DeploymentPhase) bool {
+	switch phase {
+	case PhaseDone, PhaseFailed, PhaseCanceled, PhaseAbandoned:
+		return true
+	}
+	return false
+}
+
+// retryAfterKey is the context key of the *time.Duration recordRetryAfter stores the Retry-After of
+// a response in.
+type retryAfterKey struct{}
+
+// recordRetryAfter is a ClientResponseFunc storing the Retry-After header of the response in the
+// context of the request if it has a retryAfterKey.
+func recordRetryAfter(ctx context.Context, r *http.Response) context.Context {
+	retryAfter, ok := ctx.Value(retryAfterKey{}).(*time.Duration)
+	if !ok {
+		return ctx
+	}
+	if seconds, err := strconv.Atoi(r.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		*retryAfter = time.Duration(seconds) * time.Second
+	}
+	return ctx
+}
+
+// WaitForDeployment waits until the server finishes handling the latest request for the deployment
+// and returns the outcome of the run. A request queued just before the call is waited for rather
+// than the run before it. The server is polled quickly at first and less often as the wait goes
+// on; Retry-After headers sent by the server are honored. Phase changes are sent to the
+// ProgressFunc as ProgressPhase events. An error is returned if the server can't be polled or the
+// context or timeout expires first; a failed run isn't an error.
+func (c *KfctlClient) WaitForDeployment(ctx context.Context, req kfdefs.KfDef, opts WaitOptions) (*DeploymentResult, error) {
+	start := time.Now()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	bo := &backoff.ExponentialBackOff{
+		InitialInterval:     opts.InitialInterval,
+		RandomizationFactor: 0.1,
+		Multiplier:          waitIntervalMultiplier,
+		MaxInterval:         opts.MaxInterval,
+		Clock:               backoff.SystemClock,
+	}
+	if bo.InitialInterval == 0 {
+		bo.InitialInterval = defaultWaitInitialInterval
+	}
+	if bo.MaxInterval == 0 {
+		bo.MaxInterval = defaultWaitMaxInterval
+	}
+	bo.Reset()
+
+	result := &DeploymentResult{Name: req.Name}
+	var last DeploymentPhase
+	for {
+		var retryAfter time.Duration
+		summary, err := c.deploymentSummary(context.WithValue(ctx, retryAfterKey{}, &retryAfter), req)
+		result.Polls++
+		if o, ok := err.(*OverloadedError); ok {
+			retryAfter = o.RetryAfter
+		} else if err != nil {
+			return nil, err
+		}
+
+		if summary != nil {
+			if summary.Phase != last && c.progress != nil {
+				c.progress(ProgressEvent{
+					Type:   ProgressPhase,
+					Method: "WaitForDeployment",
+					Time:   time.Now(),
+					Phase:  summary.Phase,
+				})
+			}
+			last = summary.Phase
+			if isTerminalPhase(summary.Phase) {
+				d, err := c.GetLatestKfdef(req)
+				if err != nil {
+					return nil, err
+				}
+				result.Phase = summary.Phase
+				result.KfDef = d
+				result.Message = failureMessage(d)
+				result.Elapsed = time.Since(start)
+				return result, nil
+			}
+		}
+
+		next := bo.NextBackOff()
+		if next < retryAfter {
+			next = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			if summary == nil {
+				return nil, fmt.Errorf("deployment %v wasn't found; %v", req.Name, ctx.Err())
+			}
+			return nil, fmt.Errorf("deployment %v is still in phase %v; %v", req.Name, last, ctx.Err())
+		case <-time.After(next):
+		}
+	}
+}
+
+// deploymentSummary returns the summary of the deployment of req or nil if no server handles it
+// yet. Summaries are listed so the phase is reported the same by kfctl servers and routers.
+func (c *KfctlClient) deploymentSummary(ctx context.Context, req kfdefs.KfDef) (*DeploymentSummary, error) {
+	l, err := c.ListDeployments(ctx, req)
+	if err != nil {
+		if e, ok := err.(*RetryBudgetExhaustedError); ok && IsOverloaded(e.Err) {
+			return nil, e.Err
+		}
+		return nil, err
+	}
+	for i, d := range l.Deployments {
+		if d.Name == req.Name {
+			return &l.Deployments[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// failureMessage returns the message of the latest Failed condition of d if any.
+func failureMessage(d *kfdefs.KfDef) string {
+	for i := len(d.Status.Conditions) - 1; i >= 0; i-- {
+		if c := d.Status.Conditions[i]; c.Type == kfdefs.KfFailed && c.Status == v1.ConditionTrue {
+			return c.Message
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	httptransport "github.com/go-kit/kit/transport/http"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitKfctlService reports the given phases one ListDeployments call after another.
+type waitKfctlService struct {
+	fakeKfctlService
+	phases []DeploymentPhase
+}
+
+func (f *waitKfctlService) ListDeployments(ctx context.Context, req kfdefsv3.KfDef) (*DeploymentList, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := &DeploymentList{Project: req.Spec.Project, Deployments: []DeploymentSummary{}}
+	phase := f.phases[f.calls]
+	if f.calls < len(f.phases)-1 {
+		f.calls++
+	}
+	if phase != "" {
+		list.Deployments = append(list.Deployments, DeploymentSummary{Name: req.Name, Phase: phase})
+	}
+	return list, nil
+}
+
+func (f *waitKfctlService) GetLatestKfdef(req kfdefsv3.KfDef) (*kfdefsv3.KfDef, error) {
+	req.Status.Conditions = []kfdefsv3.KfDefCondition{
+		{Type: kfdefsv3.KfFailed, Status: v1.ConditionTrue, Message: "quota exceeded"},
+	}
+	return &req, nil
+}
+
+func TestKfctlClient_WaitForDeployment(t *testing.T) {
+	newClient := func(svc KfctlService, progress ProgressFunc) (*KfctlClient, func()) {
+		mux := http.NewServeMux()
+		mux.Handle(KfctlListPath, httptransport.NewServer(makeListEndpoint(svc), decodeHTTPKfdefRequest, encodeResponse))
+		mux.Handle(KfctlGetpath, httptransport.NewServer(makeServerStatusRequestEndpoint(svc), decodeHTTPKfdefRequest, encodeResponse))
+		server := httptest.NewServer(mux)
+
+		c, err := NewKfctlClient(server.URL, WithProgressFunc(progress))
+		if err != nil {
+			t.Fatalf("Could not create client; %v", err)
+		}
+		return c.(*KfctlClient), server.Close
+	}
+	opts := WaitOptions{InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond}
+	req := kfdefsv3.KfDef{}
+	req.Name = "kf-app"
+	req.Spec.Project = "someproject"
+
+	phases := []DeploymentPhase{}
+	progress := func(e ProgressEvent) {
+		if e.Type == ProgressPhase && e.Method == "WaitForDeployment" {
+			phases = append(phases, e.Phase)
+		}
+	}
+	svc := &waitKfctlService{phases: []DeploymentPhase{"", PhasePending, PhaseGenerate, PhaseGenerate, PhaseApplyK8s, PhaseFailed}}
+	c, closeServer := newClient(svc, progress)
+	defer closeServer()
+	r, err := c.WaitForDeployment(context.Background(), req, opts)
+	if err != nil {
+		t.Fatalf("WaitForDeployment: %v", err)
+	}
+	if r.Succeeded() || r.Phase != PhaseFailed || r.Message != "quota exceeded" || r.Polls != 6 || r.KfDef == nil {
+		t.Errorf("WaitForDeployment: got %+v; want the failed run after 6 polls", r)
+	}
+	expected := []DeploymentPhase{PhasePending, PhaseGenerate, PhaseApplyK8s, PhaseFailed}
+	if !reflect.DeepEqual(phases, expected) {
+		t.Errorf("Phase events: got %v; want %v", phases, expected)
+	}
+
+	svc = &waitKfctlService{phases: []DeploymentPhase{PhaseApplyPlatform}}
+	c, closeServer = newClient(svc, progress)
+	defer closeServer()
+	opts.Timeout = 20 * time.Millisecond
+	if _, err := c.WaitForDeployment(context.Background(), req, opts); err == nil {
+		t.Errorf("WaitForDeployment past the timeout: got nil; want error")
+	}
+}
+
+func TestRecordRetryAfter(t *testing.T) {
+	var retryAfter time.Duration
+	ctx := context.WithValue(context.Background(), retryAfterKey{}, &retryAfter)
+	recordRetryAfter(ctx, &http.Response{Header: http.Header{"Retry-After": []string{"30"}}})
+	if retryAfter != 30*time.Second {
+		t.Errorf("Retry-After: got %v; want 30s", retryAfter)
+	}
+
+	// Responses without a Retry-After and requests which don't record it are ignored.
+	recordRetryAfter(ctx, &http.Response{Header: http.Header{}})
+	recordRetryAfter(context.Background(), &http.Response{Header: http.Header{"Retry-After": []string{"5"}}})
+	if retryAfter != 30*time.Second {
+		t.Errorf("Retry-After: got %v; want 30s", retryAfter)
+	}
+}
+
+func TestKfctlServer_reportedPhase(t *testing.T) {
+	s := &kfctlServer{c: make(chan kfdefsv3.KfDef, 1), phase: PhaseDone}
+	if p := s.reportedPhase(); p != PhaseDone {
+		t.Errorf("reportedPhase when idle: got %v; want Done", p)
+	}
+	s.c <- kfdefsv3.KfDef{}
+	if p := s.reportedPhase(); p != PhasePending {
+		t.Errorf("reportedPhase with a queued request: got %v; want Pending", p)
+	}
+	<-s.c
+	s.busy = true
+	if p := s.reportedPhase(); p != PhasePending {
+		t.Errorf("reportedPhase of a starting run: got %v; want Pending", p)
+	}
+	s.phase = PhaseApplyK8s
+	if p := s.reportedPhase(); p != PhaseApplyK8s {
+		t.Errorf("reportedPhase of a running run: got %v; want ApplyK8s", p)
+	}
+}
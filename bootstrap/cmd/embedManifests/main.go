@@ -0,0 +1,85 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// embedManifests fetches a snapshot of each repo and writes a go file registering them with the
+// utils package. The file is only built with the embedmanifests build tag; binaries built with
+// it deploy the snapshots instead of fetching the repos.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// uriList is a flag which can be set more than once.
+type uriList []string
+
+func (l *uriList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *uriList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	uris := uriList{}
+	flag.Var(&uris, "uri", "URI of a repo to embed e.g. https://github.com/kubeflow/manifests/archive/v0.6.0.tar.gz; may be repeated. "+
+		"The URI must match the uri of the repo in the KfDef for the snapshot to be used.")
+	output := flag.String("output", "pkg/utils/zz_generated.embedded.go", "The go file to write.")
+	flag.Parse()
+
+	if len(uris) == 0 {
+		log.Fatalf("--uri is required")
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by embedManifests. DO NOT EDIT.\n\n")
+	fmt.Fprintf(src, "// +build %v\n\npackage utils\n\nfunc init() {\n", utils.EmbedManifestsTag)
+	for _, uri := range uris {
+		dir, err := ioutil.TempDir("", "embed")
+		if err != nil {
+			log.Fatalf("Could not create a temporary directory; %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		log.Infof("Fetching %v", uri)
+		if err := utils.GetAny(dir, uri); err != nil {
+			log.Fatalf("Could not fetch %v; %v", uri, err)
+		}
+		archive, err := utils.ArchiveDir(dir)
+		if err != nil {
+			log.Fatalf("Could not archive %v; %v", uri, err)
+		}
+		log.Infof("Embedding %v bytes of %v", len(archive), uri)
+		fmt.Fprintf(src, "\tembeddedRepos[%q] = []byte(%q)\n", uri, archive)
+	}
+	fmt.Fprintf(src, "}\n")
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		log.Fatalf("Could not format the generated source; %v", err)
+	}
+	if err := ioutil.WriteFile(*output, formatted, 0644); err != nil {
+		log.Fatalf("Could not write %v; %v", *output, err)
+	}
+}
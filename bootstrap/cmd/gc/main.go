@@ -35,7 +35,12 @@ func main() {
 
 	flag.Parse()
 
-	gcServer, err := app.NewGcServer(s.KfctlAppsNamespace)
+	collection, err := app.GarbageCollectionFromOptions(s)
+	if err != nil {
+		log.Errorf("Invalid garbage collection flags: %v", err)
+		return
+	}
+	gcServer, err := app.NewGcServer(s.KfctlAppsNamespace, collection)
 	if err != nil {
 		log.Errorf("Failed creating GC Server: %v", err)
 		return
@@ -39,6 +39,12 @@ var applyCmd = &cobra.Command{
 		if resourceErr != nil {
 			return fmt.Errorf("invalid resource: %v", resourceErr)
 		}
+		if server := applyCfg.GetString(string(kftypes.SERVER)); server != "" {
+			if resource != kftypes.ALL {
+				return fmt.Errorf("--%v only applies all resources", kftypes.SERVER)
+			}
+			return applyWithServer(server)
+		}
 		kfApp, kfAppErr := coordinator.LoadKfApp(map[string]interface{}{})
 		if kfAppErr != nil {
 			return fmt.Errorf("couldn't load KfApp: %v", kfAppErr)
@@ -66,4 +72,14 @@ func init() {
 		log.Errorf("couldn't set flag --%v: %v", string(kftypes.VERBOSE), bindErr)
 		return
 	}
+
+	// kfctl server
+	applyCmd.Flags().String(string(kftypes.SERVER), "",
+		"Apply through a kfctl server like the hosted service instead of directly; "+localServer+
+			" starts one in process, otherwise the endpoint of a server e.g. unix:///tmp/kfctl.sock")
+	bindErr = applyCfg.BindPFlag(string(kftypes.SERVER), applyCmd.Flags().Lookup(string(kftypes.SERVER)))
+	if bindErr != nil {
+		log.Errorf("couldn't set flag --%v: %v", string(kftypes.SERVER), bindErr)
+		return
+	}
 }
@@ -0,0 +1,96 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var convertCfg = viper.New()
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert <app.yaml>",
+	Short: "Convert the app.yaml of a ksonnet kubeflow application to use kustomize.",
+	Long: `Convert the app.yaml of a kubeflow application created by the ksonnet based kfctl to a KfDef
+using kustomize. Each component is replaced by the kustomize applications implementing it. The options
+which can't be converted and the validation failures of the converted KfDef are reported on stderr.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.SetLevel(log.InfoLevel)
+		if convertCfg.GetBool(string(kftypes.VERBOSE)) != true {
+			log.SetLevel(log.WarnLevel)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("app.yaml is required")
+		}
+		buf, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't read %v: %v", args[0], err)
+		}
+		d := &kfdefs.KfDef{}
+		if err := yaml.Unmarshal(buf, d); err != nil {
+			return fmt.Errorf("couldn't parse %v: %v", args[0], err)
+		}
+
+		r := lint.Convert(d)
+		for _, i := range r.Unconverted {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", i.Field, i.Message)
+		}
+		for _, e := range r.Errors {
+			fmt.Fprintf(os.Stderr, "error: %v\n", e)
+		}
+		out, err := yaml.Marshal(r.KfDef)
+		if err != nil {
+			return fmt.Errorf("couldn't encode the converted KfDef: %v", err)
+		}
+		output := convertCfg.GetString("output")
+		if output == "" {
+			_, err = os.Stdout.Write(out)
+			return err
+		}
+		return ioutil.WriteFile(output, out, 0644)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().StringP("output", "o", "",
+		"file to write the converted KfDef to; defaults to stdout")
+	bindErr := convertCfg.BindPFlag("output", convertCmd.Flags().Lookup("output"))
+	if bindErr != nil {
+		log.Errorf("couldn't set flag --output: %v", bindErr)
+		return
+	}
+
+	// verbose output
+	convertCmd.Flags().BoolP(string(kftypes.VERBOSE), "V", false,
+		string(kftypes.VERBOSE)+" output default is false")
+	bindErr = convertCfg.BindPFlag(string(kftypes.VERBOSE), convertCmd.Flags().Lookup(string(kftypes.VERBOSE)))
+	if bindErr != nil {
+		log.Errorf("couldn't set flag --%v: %v", string(kftypes.VERBOSE), bindErr)
+		return
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ghodss/yaml"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var lintCfg = viper.New()
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint <kfdef.yaml>",
+	Short: "Validate a KfDef and warn about risky configurations without deploying it.",
+	Long: `Validate a KfDef and warn about risky but valid configurations e.g. basic auth or a single zone.
+The checks are the ones of the kfctl server so a KfDef which passes them offline is accepted by the
+server. The validation failures and warnings are reported on stderr; the command fails if there are
+validation failures.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.SetLevel(log.InfoLevel)
+		if lintCfg.GetBool(string(kftypes.VERBOSE)) != true {
+			log.SetLevel(log.WarnLevel)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("kfdef.yaml is required")
+		}
+		buf, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't read %v: %v", args[0], err)
+		}
+		d := &kfdefs.KfDef{}
+		if err := yaml.Unmarshal(buf, d); err != nil {
+			return fmt.Errorf("couldn't parse %v: %v", args[0], err)
+		}
+
+		failures := lint.Validate(d)
+		reported := map[string]bool{}
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "error: %v: %v\n", f.Field, f.Message)
+			reported[f.Message] = true
+		}
+		// The errors of the lint include the first validation failure and those of the platform.
+		// The node pools are checked in the DM cluster config if the app was generated.
+		var clusterConfig []byte
+		if d.Spec.AppDir != "" {
+			configFile := path.Join(d.Spec.AppDir, gcp.GCP_CONFIG, gcp.CONFIG_FILE)
+			if clusterConfig, err = ioutil.ReadFile(configFile); err != nil && !os.IsNotExist(err) {
+				log.Warnf("Could not read %v; skipping node pool checks; error %v", configFile, err)
+			}
+		}
+		r := lint.Lint(d, clusterConfig)
+		for _, e := range r.Errors {
+			if !reported[e] {
+				fmt.Fprintf(os.Stderr, "error: %v\n", e)
+			}
+		}
+		for _, w := range r.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %v: %v: %v\n", w.Code, w.Field, w.Message)
+		}
+		if len(failures) > 0 || len(r.Errors) > 0 {
+			return fmt.Errorf("%v is invalid", args[0])
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	// verbose output
+	lintCmd.Flags().BoolP(string(kftypes.VERBOSE), "V", false,
+		string(kftypes.VERBOSE)+" output default is false")
+	bindErr := lintCfg.BindPFlag(string(kftypes.VERBOSE), lintCmd.Flags().Lookup(string(kftypes.VERBOSE)))
+	if bindErr != nil {
+		log.Errorf("couldn't set flag --%v: %v", string(kftypes.VERBOSE), bindErr)
+		return
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ghodss/yaml"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/lint"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/marketplace"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var marketplaceCfg = viper.New()
+
+// marketplaceCmd represents the marketplace command
+var marketplaceCmd = &cobra.Command{
+	Use:   "marketplace <kfdef.yaml>",
+	Short: "Generate the metadata needed to publish a KfDef to GCP Marketplace.",
+	Long: `Generate the schema of the Marketplace deployer and the Application resource needed to publish
+the Kubeflow configuration of a KfDef to GCP Marketplace as a click to deploy application. The files
+are written to the output directory as ` + marketplace.SchemaFile + ` and ` + marketplace.ApplicationFile + `.
+The KfDef must be valid and pin a released Kubeflow version. Secrets of the KfDef aren't published;
+users provide them when deploying. The resources the cluster must have available are the requests of
+the workloads of the kustomizations in --manifests-dir e.g. the kustomize directory of the app
+generated by kfctl generate.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.SetLevel(log.InfoLevel)
+		if marketplaceCfg.GetBool(string(kftypes.VERBOSE)) != true {
+			log.SetLevel(log.WarnLevel)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("kfdef.yaml is required")
+		}
+		buf, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't read %v: %v", args[0], err)
+		}
+		d := &kfdefs.KfDef{}
+		if err := yaml.Unmarshal(buf, d); err != nil {
+			return fmt.Errorf("couldn't parse %v: %v", args[0], err)
+		}
+
+		if failures := lint.Validate(d); len(failures) > 0 {
+			for _, f := range failures {
+				fmt.Fprintf(os.Stderr, "error: %v: %v\n", f.Field, f.Message)
+			}
+			return fmt.Errorf("%v is invalid", args[0])
+		}
+
+		manifests := [][]byte{}
+		if dir := marketplaceCfg.GetString("manifests-dir"); dir != "" {
+			for _, app := range d.Spec.Applications {
+				resMap, err := kustomize.EvaluateKustomizeManifest(path.Join(dir, app.Name))
+				if err != nil {
+					return fmt.Errorf("couldn't evaluate the kustomization of %v: %v", app.Name, err)
+				}
+				data, err := resMap.EncodeAsYaml()
+				if err != nil {
+					return fmt.Errorf("couldn't encode the manifests of %v: %v", app.Name, err)
+				}
+				manifests = append(manifests, data)
+			}
+		} else {
+			log.Warnf("--manifests-dir isn't set; the listing won't require any resources from the cluster")
+		}
+
+		m, err := marketplace.Generate(d, marketplace.Options{
+			PartnerId:   marketplaceCfg.GetString("partner-id"),
+			ProductId:   marketplaceCfg.GetString("product-id"),
+			PartnerName: marketplaceCfg.GetString("partner-name"),
+			Manifests:   manifests,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't generate the Marketplace metadata: %v", err)
+		}
+		files, err := m.Files()
+		if err != nil {
+			return fmt.Errorf("couldn't encode the Marketplace metadata: %v", err)
+		}
+		outputDir := marketplaceCfg.GetString("output-dir")
+		if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+			return fmt.Errorf("couldn't create %v: %v", outputDir, err)
+		}
+		for name, content := range files {
+			p := path.Join(outputDir, name)
+			if err := ioutil.WriteFile(p, content, 0644); err != nil {
+				return fmt.Errorf("couldn't write %v: %v", p, err)
+			}
+			log.Infof("Wrote %v", p)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(marketplaceCmd)
+
+	marketplaceCmd.Flags().StringP("output-dir", "o", "marketplace",
+		"directory to write the Marketplace metadata to")
+	bindErr := marketplaceCfg.BindPFlag("output-dir", marketplaceCmd.Flags().Lookup("output-dir"))
+	if bindErr != nil {
+		log.Errorf("couldn't set flag --output-dir: %v", bindErr)
+		return
+	}
+
+	for _, f := range []struct {
+		name  string
+		usage string
+	}{
+		{"partner-id", "id of the Marketplace partner publishing the listing"},
+		{"product-id", "id of the Marketplace product; required with --partner-id"},
+		{"partner-name", "display name of the Marketplace partner"},
+		{"manifests-dir", "directory of the kustomizations of the applications of the KfDef; the cluster must have the resources their workloads request"},
+	} {
+		marketplaceCmd.Flags().String(f.name, "", f.usage)
+		bindErr = marketplaceCfg.BindPFlag(f.name, marketplaceCmd.Flags().Lookup(f.name))
+		if bindErr != nil {
+			log.Errorf("couldn't set flag --%v: %v", f.name, bindErr)
+			return
+		}
+	}
+
+	// verbose output
+	marketplaceCmd.Flags().BoolP(string(kftypes.VERBOSE), "V", false,
+		string(kftypes.VERBOSE)+" output default is false")
+	bindErr = marketplaceCfg.BindPFlag(string(kftypes.VERBOSE), marketplaceCmd.Flags().Lookup(string(kftypes.VERBOSE)))
+	if bindErr != nil {
+		log.Errorf("couldn't set flag --%v: %v", string(kftypes.VERBOSE), bindErr)
+		return
+	}
+}
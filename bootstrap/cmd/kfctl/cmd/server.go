@@ -0,0 +1,120 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// localServer is the value of --server starting a kfctl server in process.
+const localServer = "local"
+
+// localDrainTimeout is how long the in-process server waits for the deployment to be
+// checkpointed when kfctl exits before it finishes.
+const localDrainTimeout = 5 * time.Minute
+
+// printProgress logs the progress reported by the kfctl server.
+func printProgress(e app.ProgressEvent) {
+	switch e.Type {
+	case app.ProgressRetry:
+		log.Infof("%v: attempt %v failed (%v); retrying in %v", e.Method, e.Attempt, e.Err, e.NextRetry)
+	case app.ProgressPhase:
+		log.Warnf("Deployment phase %v; estimated time remaining %v", e.Phase, e.ETA)
+	}
+}
+
+// applyWithServer applies the app in the current directory with the kfctl server at server using
+// the KfctlService of the hosted deployments. If server is local a kfctl server is started in
+// process on a unix socket; it keeps its state next to the app directory.
+func applyWithServer(server string) error {
+	ctx := context.Background()
+	appDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("couldn't get the current directory: %v", err)
+	}
+	d, err := kfdefs.LoadKFDefFromURI(filepath.Join(appDir, kftypes.KfConfigFile))
+	if err != nil {
+		return fmt.Errorf("couldn't load %v: %v", kftypes.KfConfigFile, err)
+	}
+	// The server keeps the app directory of the deployment in its own directory.
+	d.Spec.AppDir = ""
+
+	opts := []app.KfctlClientOption{app.WithProgressFunc(printProgress)}
+	if d.Spec.Platform == kftypes.GCP {
+		ts, err := app.NewDefaultTokenSource(ctx)
+		if err != nil {
+			return fmt.Errorf("couldn't get the application default credentials: %v", err)
+		}
+		opts = append(opts, app.WithTokenSource(ts))
+	}
+
+	var c *app.KfctlClient
+	if server == localServer {
+		if d.Name != filepath.Base(appDir) {
+			return fmt.Errorf("the app directory %v must be named after the deployment %v", appDir, d.Name)
+		}
+		options := app.LocalServerOptions{AppsDir: filepath.Dir(appDir)}
+		if d.Spec.Platform != kftypes.GCP {
+			// Like kfctl apply, deploy to the cluster of the current kubeconfig context.
+			if options.TargetCluster = kftypes.GetConfig(); options.TargetCluster == nil {
+				return fmt.Errorf("couldn't load the kubeconfig %v", kftypes.KubeConfigPath())
+			}
+		}
+		l, err := app.StartLocalServer(options)
+		if err != nil {
+			return fmt.Errorf("couldn't start the kfctl server: %v", err)
+		}
+		defer func() {
+			if err := l.Close(localDrainTimeout); err != nil {
+				log.Errorf("couldn't stop the kfctl server: %v", err)
+			}
+		}()
+		if c, err = l.NewClient(opts...); err != nil {
+			return err
+		}
+	} else {
+		svc, err := app.NewKfctlClient(server, opts...)
+		if err != nil {
+			return fmt.Errorf("couldn't connect to %v: %v", server, err)
+		}
+		c = svc.(*app.KfctlClient)
+	}
+
+	if _, err := c.CreateDeployment(ctx, *d); err != nil {
+		if vErr, ok := err.(*app.ValidationError); ok {
+			for _, f := range vErr.Fields {
+				log.Errorf("Invalid %v: %v", f.Field, f.Message)
+			}
+		}
+		return fmt.Errorf("couldn't apply KfApp: %v", err)
+	}
+	result, err := c.WaitForDeployment(ctx, *d, app.WaitOptions{})
+	if err != nil {
+		return fmt.Errorf("couldn't wait for KfApp: %v", err)
+	}
+	if !result.Succeeded() {
+		return fmt.Errorf("couldn't apply KfApp: deployment %v; %v", result.Phase, result.Message)
+	}
+	log.Warnf("Applied %v in %v", d.Name, result.Elapsed)
+	return nil
+}
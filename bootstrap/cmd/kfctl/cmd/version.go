@@ -17,6 +17,7 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -27,6 +28,9 @@ var versionCmd = &cobra.Command{
 	Long:  `Print the version of kfctl.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println(rootCmd.Use + " " + VERSION)
+		for _, uri := range utils.EmbeddedURIs() {
+			fmt.Println("embedded: " + uri)
+		}
 	}}
 
 func init() {
@@ -0,0 +1,137 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+)
+
+var (
+	backupOutput        string
+	backupVolumes       bool
+	backupSnapshotClass string
+	restoreInput        string
+)
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup <name>",
+	Short: "Back up the K8s resources of a deployment.",
+	Long: `Snapshot the K8s resources created for a deployment to a file which restore can recreate
+them from. With --volumes the data of its persistent volume claims is snapshotted with
+VolumeSnapshots which are retained after the deployment is deleted; the cluster must support CSI
+snapshots. The backup contains the secrets of the deployment; store it securely.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := backupOutput
+		if output == "" {
+			output = args[0] + ".backup.json"
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		s, err := c.Backup(context.Background(), app.BackupRequest{
+			KfDef: *req,
+			Options: kustomize.BackupOptions{
+				SnapshotVolumes:     backupVolumes,
+				VolumeSnapshotClass: backupSnapshotClass,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't back up deployment %v: %v", args[0], err)
+		}
+		buf, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(output, buf, 0600); err != nil {
+			return err
+		}
+		fmt.Printf("Backed up %v objects and %v volumes of deployment %v to %v\n", len(s.Objects), len(s.Volumes), args[0], output)
+		for _, m := range s.Missing {
+			fmt.Printf("  missing %v\n", m)
+		}
+		return nil
+	},
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Restore a backup into a deployment.",
+	Long: `Recreate the K8s resources of a backup in a deployment, usually a new deployment created
+from the KfDef of the deployment backed up. The resources are moved to the namespaces of the
+deployment; existing resources owned by it are replaced and existing claims keep their data.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buf, err := ioutil.ReadFile(restoreInput)
+		if err != nil {
+			return err
+		}
+		s := kustomize.ResourceSnapshot{}
+		if err := json.Unmarshal(buf, &s); err != nil {
+			return fmt.Errorf("couldn't parse backup %v: %v", restoreInput, err)
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		r, err := c.Restore(context.Background(), app.RestoreRequest{KfDef: *req, Backup: s})
+		if err != nil {
+			return fmt.Errorf("couldn't restore the backup into deployment %v: %v", args[0], err)
+		}
+		fmt.Printf("Restored the backup of %v into deployment %v: %v created, %v replaced, %v skipped, %v failed\n",
+			r.Source, args[0], len(r.Created), len(r.Replaced), len(r.Skipped), len(r.Failed))
+		for _, v := range r.Volumes {
+			fmt.Printf("  restored the data of %v\n", v)
+		}
+		for _, skipped := range r.Skipped {
+			fmt.Printf("  skipped %v\n", skipped)
+		}
+		for _, f := range r.Failed {
+			fmt.Printf("  failed %v\n", f)
+		}
+		if len(r.Failed) > 0 {
+			return fmt.Errorf("couldn't restore %v objects", len(r.Failed))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+
+	backupCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "The file to write the backup to; defaults to <name>.backup.json.")
+	backupCmd.Flags().BoolVar(&backupVolumes, "volumes", false, "Also snapshot the data of the persistent volume claims.")
+	backupCmd.Flags().StringVar(&backupSnapshotClass, "snapshot-class", "", "The VolumeSnapshotClass of the snapshots; the default class if empty.")
+	restoreCmd.Flags().StringVarP(&restoreInput, "from", "f", "", "The backup to restore.")
+	restoreCmd.MarkFlagRequired("from")
+}
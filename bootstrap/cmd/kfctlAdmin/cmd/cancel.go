@@ -0,0 +1,49 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+// cancelCmd represents the cancel command
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <name>",
+	Short: "Cancel the in-flight deployment.",
+	Long: `Stop the deployment at the next phase boundary and drop its queued requests.
+Resources created by the phases that already ran aren't removed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := c.Cancel(context.Background(), *req); err != nil {
+			return fmt.Errorf("couldn't cancel deployment %v: %v", args[0], err)
+		}
+		fmt.Printf("Canceling deployment %v; it stops at the next phase boundary\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cancelCmd)
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+var deleteYes bool
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a deployment.",
+	Long: `Delete the resources of a deployment. The resources which would be deleted are listed;
+pass --yes to delete them. The resources are deleted in the background; use describe to follow
+the progress. A deployment which is being applied must be canceled first and a deployment with
+deletion protection can't be deleted until the protection is disabled with edit.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		plan, err := c.PrepareDelete(context.Background(), *req)
+		if err != nil {
+			return fmt.Errorf("couldn't prepare deleting deployment %v: %v", args[0], err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tNAME\tNAMESPACE\tPROJECT")
+		for _, r := range plan.Resources {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r.Kind, r.Name, r.Namespace, r.Project)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if !deleteYes {
+			fmt.Printf("Deployment %v wasn't deleted; pass --yes to delete the resources above\n", args[0])
+			return nil
+		}
+
+		if req.Annotations == nil {
+			req.Annotations = map[string]string{}
+		}
+		req.Annotations[app.DeleteConfirmationAnnotation] = plan.Token
+		if _, err := c.DeleteDeployment(context.Background(), *req); err != nil {
+			return fmt.Errorf("couldn't delete deployment %v: %v", args[0], err)
+		}
+		fmt.Printf("Deleting deployment %v\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.Flags().BoolVar(&deleteYes, "yes", false, "Delete the listed resources without stopping after listing them.")
+}
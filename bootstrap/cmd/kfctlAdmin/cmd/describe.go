@@ -0,0 +1,83 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// describeCmd represents the describe command
+var describeCmd = &cobra.Command{
+	Use:   "describe <name>",
+	Short: "Show the status of a deployment.",
+	Long:  `Show the conditions of a deployment and the status of its applications.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		d, err := c.GetLatestKfdef(*req)
+		if err != nil {
+			return fmt.Errorf("couldn't get deployment %v: %v", args[0], err)
+		}
+
+		fmt.Printf("Name:     %v\n", d.Name)
+		fmt.Printf("Project:  %v\n", d.Spec.Project)
+		if d.Status.Zone != "" && d.Status.Zone != d.Spec.Zone {
+			fmt.Printf("Zone:     %v (requested %v was out of capacity)\n", d.Status.Zone, d.Spec.Zone)
+		} else {
+			fmt.Printf("Zone:     %v\n", d.Spec.Zone)
+		}
+		if d.Spec.Region != "" {
+			fmt.Printf("Region:   %v\n", d.Spec.Region)
+		}
+		fmt.Printf("Version:  %v\n", d.Spec.Version)
+		fmt.Printf("Hostname: %v\n", d.Spec.Hostname)
+		if v := d.Annotations[app.DescriptionAnnotation]; v != "" {
+			fmt.Printf("Description: %v\n", v)
+		}
+		if v := d.Annotations[app.OwnerContactAnnotation]; v != "" {
+			fmt.Printf("Owner contact: %v\n", v)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "\nCONDITION\tSTATUS\tREASON\tUPDATED\tMESSAGE")
+		for _, cond := range d.Status.Conditions {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", cond.Type, cond.Status, cond.Reason,
+				cond.LastUpdateTime.Format(time.RFC3339), cond.Message)
+		}
+		if len(d.Status.Applications) > 0 {
+			fmt.Fprintln(w, "\nAPPLICATION\tSTATE\tUPDATED\tMESSAGE")
+			for _, a := range d.Status.Applications {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", a.Name, a.State, a.LastUpdateTime.Format(time.RFC3339), a.Message)
+			}
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var (
+	editDescription  string
+	editOwnerContact string
+	editLabels       []string
+	editRemoveLabels []string
+	editProtect      bool
+)
+
+// editCmd represents the edit command
+var editCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Edit the description, owner contact, labels and deletion protection of a deployment.",
+	Long: `Edit the description, owner contact, labels and deletion protection of a deployment.
+Only the flags which are set are changed. The deployment isn't applied again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		d, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		req := app.MetadataRequest{
+			KfDef:  *d,
+			Labels: map[string]*string{},
+		}
+		if cmd.Flags().Changed("description") {
+			req.Description = &editDescription
+		}
+		if cmd.Flags().Changed("owner-contact") {
+			req.OwnerContact = &editOwnerContact
+		}
+		for _, l := range editLabels {
+			pieces := strings.SplitN(l, "=", 2)
+			if len(pieces) != 2 {
+				return fmt.Errorf("label %v isn't of the form key=value", l)
+			}
+			req.Labels[pieces[0]] = &pieces[1]
+		}
+		for _, k := range editRemoveLabels {
+			req.Labels[k] = nil
+		}
+		if cmd.Flags().Changed("deletion-protection") {
+			req.DeletionProtection = &editProtect
+		}
+		if _, err := c.UpdateMetadata(context.Background(), req); err != nil {
+			return fmt.Errorf("couldn't edit the metadata of deployment %v: %v", args[0], err)
+		}
+		fmt.Printf("Updated the metadata of deployment %v\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+
+	editCmd.Flags().StringVar(&editDescription, "description", "", "The description of the deployment; empty removes it.")
+	editCmd.Flags().StringVar(&editOwnerContact, "owner-contact", "", "Who to contact about the deployment e.g. an email address; empty removes it.")
+	editCmd.Flags().StringArrayVar(&editLabels, "label", nil, "A label to set of the form key=value; may be repeated.")
+	editCmd.Flags().StringArrayVar(&editRemoveLabels, "remove-label", nil, "The key of a label to remove; may be repeated.")
+	editCmd.Flags().BoolVar(&editProtect, "deletion-protection", false, "Whether requests to delete the deployment are rejected.")
+}
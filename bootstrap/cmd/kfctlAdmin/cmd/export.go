@@ -0,0 +1,57 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var exportOutput string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export <name>",
+	Short: "Download the archive of a deployment.",
+	Long: `Download the archive of the app directory of a deployment. An interrupted download
+is resumed when the command is run again with the same output.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := exportOutput
+		if output == "" {
+			output = args[0] + ".tar.gz"
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		if err := c.DownloadExport(context.Background(), *req, output); err != nil {
+			return fmt.Errorf("couldn't export deployment %v: %v", args[0], err)
+		}
+		fmt.Printf("Exported deployment %v to %v\n", args[0], output)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "The file to write the archive to; defaults to <name>.tar.gz.")
+}
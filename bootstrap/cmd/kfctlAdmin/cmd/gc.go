@@ -0,0 +1,90 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	gcAllProjects bool
+	gcDryRun      bool
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Clean up the abandoned deployments in the project.",
+	Long: `Clean up the deployments in the project which never succeeded and whose last run failed
+or is stuck for longer than the ages in the garbage collection config of the router. Stuck runs
+are canceled; the resources of failed deployments are deleted in the background and the
+deployments are marked Abandoned. Deployments with deletion protection are never cleaned up.
+
+Admins of the operator project of the router can clean up the deployments of every project
+with --all-projects; --project must be the operator project.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		d, err := newRequest("")
+		if err != nil {
+			return err
+		}
+		if gcAllProjects {
+			d.Annotations = map[string]string{app.AllProjectsAnnotation: "true"}
+		}
+		report, err := c.GarbageCollect(context.Background(), app.GarbageCollectionRequest{
+			KfDef:  *d,
+			DryRun: gcDryRun,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't collect the abandoned deployments: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPROJECT\tACTION\tREASON\tSERVER")
+		for _, d := range report.Collected {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", d.Name, d.Project, d.Action, d.Reason, d.Server)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if report.DryRun {
+			fmt.Println("Dry run; no deployment was changed")
+		}
+		if len(report.Pending) > 0 {
+			fmt.Printf("Not old enough to be collected or being cleaned up: %v\n", strings.Join(report.Pending, ", "))
+		}
+		if report.Unavailable > 0 {
+			fmt.Fprintf(os.Stderr, "%v kfctl servers couldn't be queried; their deployments weren't collected\n", report.Unavailable)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+
+	gcCmd.Flags().BoolVar(&gcAllProjects, "all-projects", false, "Clean up the deployments of every project; requires the admin role on the operator project.")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "List the deployments which would be cleaned up without changing them.")
+}
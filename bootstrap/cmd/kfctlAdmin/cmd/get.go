@@ -0,0 +1,105 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	getOutput      string
+	getAllProjects bool
+)
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get [name]",
+	Short: "Print a table of the deployments in the project or of a single deployment.",
+	Long: `Print a table of the deployments in the project or of the named deployment.
+The columns are chosen by the server; -o wide prints the additional columns.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if getOutput != "" && getOutput != "wide" {
+			return fmt.Errorf("unsupported output format %v; only wide is supported", getOutput)
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		req, err := newRequest(name)
+		if err != nil {
+			return err
+		}
+
+		var t *app.Table
+		if name != "" {
+			t, err = c.GetLatestKfdefTable(context.Background(), *req)
+		} else {
+			if getAllProjects {
+				req.Annotations = map[string]string{app.AllProjectsAnnotation: "true"}
+			}
+			t, err = c.ListDeploymentsTable(context.Background(), *req)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get deployments: %v", err)
+		}
+		return printTable(os.Stdout, t, getOutput == "wide")
+	},
+}
+
+// printTable prints the columns of t with priority 0 and all the columns if wide is true.
+func printTable(out io.Writer, t *app.Table, wide bool) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	columns := []int{}
+	headers := []string{}
+	for i, c := range t.ColumnDefinitions {
+		if c.Priority > 0 && !wide {
+			continue
+		}
+		columns = append(columns, i)
+		headers = append(headers, strings.ToUpper(c.Name))
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, r := range t.Rows {
+		cells := []string{}
+		for _, i := range columns {
+			cell := ""
+			if i < len(r.Cells) && r.Cells[i] != nil {
+				cell = fmt.Sprintf("%v", r.Cells[i])
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+
+	getCmd.Flags().StringVarP(&getOutput, "output", "o", "", "Output format; wide prints the additional columns.")
+	getCmd.Flags().BoolVar(&getAllProjects, "all-projects", false, "List the deployments of every project; requires the admin role on the operator project.")
+}
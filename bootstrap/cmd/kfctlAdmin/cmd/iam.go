@@ -0,0 +1,85 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	unusedDays   int
+	revokeUnused bool
+	dryRun       bool
+)
+
+// iamCmd represents the iam command
+var iamCmd = &cobra.Command{
+	Use:   "iam <name>",
+	Short: "Report the IAM bindings created for a deployment.",
+	Long: `List every IAM binding created for the deployment and when its member was last active.
+With --revoke the project bindings whose member wasn't active in the last --unused-days are removed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		d, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		req := app.IamReportRequest{
+			KfDef:      *d,
+			UnusedDays: unusedDays,
+			DryRun:     dryRun,
+		}
+
+		var report *gcp.IamPolicyReport
+		if revokeUnused {
+			report, err = c.RevokeUnused(context.Background(), req)
+		} else {
+			report, err = c.GetIamReport(context.Background(), req)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get the IAM bindings of deployment %v: %v", args[0], err)
+		}
+
+		fmt.Printf("Activity since %v\n\n", report.Since.Format(time.RFC3339))
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "RESOURCE\tROLE\tMEMBER\tLAST USED\tUNUSED\tREVOKED")
+		for _, b := range report.Bindings {
+			lastUsed := "-"
+			if b.LastUsed != nil {
+				lastUsed = b.LastUsed.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", b.Resource, b.Role, b.Member, lastUsed, b.Unused, b.Revoked)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(iamCmd)
+	iamCmd.Flags().IntVar(&unusedDays, "unused-days", 0, "Number of days without activity after which a binding is unused; defaults to 90 for reports and is required with --revoke.")
+	iamCmd.Flags().BoolVar(&revokeUnused, "revoke", false, "Revoke the unused project bindings.")
+	iamCmd.Flags().BoolVar(&dryRun, "dry-run", false, "With --revoke report the bindings that would be revoked without revoking them.")
+}
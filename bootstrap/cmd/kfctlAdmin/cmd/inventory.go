@@ -0,0 +1,62 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory <name>",
+	Short: "List the resources created for a deployment.",
+	Long: `List the cloud and K8s resources created for a deployment in the order they were created.
+The source is the Deployment Manager deployment or the application which created the resource.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		d, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		inventory, err := c.GetInventory(context.Background(), *d)
+		if err != nil {
+			return fmt.Errorf("couldn't get the inventory of deployment %v: %v", args[0], err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tNAME\tNAMESPACE\tPROJECT\tSOURCE\tCREATED")
+		for _, r := range inventory.Resources {
+			created := ""
+			if !r.CreationTime.IsZero() {
+				created = r.CreationTime.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", r.Kind, r.Name, r.Namespace, r.Project, r.Source, created)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+}
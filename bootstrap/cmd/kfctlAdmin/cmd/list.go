@@ -0,0 +1,73 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+var listAllProjects bool
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the deployments in the project.",
+	Long: `List the deployments in the project. Only deployments which were recently
+active are listed since idle kfctl servers are garbage collected.
+
+Admins of the operator project of the router can list the deployments of every project
+with --all-projects; --project must be the operator project.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest("")
+		if err != nil {
+			return err
+		}
+		if listAllProjects {
+			req.Annotations = map[string]string{app.AllProjectsAnnotation: "true"}
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPROJECT\tPHASE\tBUSY\tPAUSED\tSERVER")
+		unavailable, err := c.StreamDeployments(context.Background(), *req, func(d app.DeploymentSummary) error {
+			_, err := fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", d.Name, d.Project, d.Phase, d.Busy, d.Paused, d.Server)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't list deployments: %v", err)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if unavailable > 0 {
+			fmt.Fprintf(os.Stderr, "%v kfctl servers couldn't be queried; their deployments aren't listed\n", unavailable)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().BoolVar(&listAllProjects, "all-projects", false, "List the deployments of every project; requires the admin role on the operator project.")
+}
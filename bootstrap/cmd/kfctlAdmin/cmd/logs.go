@@ -0,0 +1,100 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+var logsRun bool
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs <name>",
+	Short: "Show the recent errors or the log of the latest run of a deployment.",
+	Long: `Show the most recent errors the kfctl server encountered while handling a deployment,
+oldest first.
+
+With --run show the log of the latest run instead. How much it contains depends on the
+kfctl.kubeflow.org/log-verbosity annotation of the request which started the run: errors,
+phases (the default) or full which includes the output of kfctl.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		if logsRun {
+			return printRunLog(c, *req)
+		}
+		h, err := c.GetErrorHistory(context.Background(), *req)
+		if err != nil {
+			return fmt.Errorf("couldn't get the errors of deployment %v: %v", args[0], err)
+		}
+
+		if len(h.Errors) == 0 {
+			fmt.Printf("No errors recorded for deployment %v\n", args[0])
+			return nil
+		}
+		for _, e := range h.Errors {
+			fmt.Printf("%v [%v] %v", e.Time.Format(time.RFC3339), e.Phase, e.Message)
+			if e.Code != 0 {
+				fmt.Printf(" (code %v)", e.Code)
+			}
+			fmt.Println()
+			if e.Cause != "" {
+				fmt.Printf("    cause: %v\n", e.Cause)
+			}
+		}
+		return nil
+	},
+}
+
+// printRunLog prints the log of the latest run of the deployment.
+func printRunLog(c *app.KfctlClient, req kfdefs.KfDef) error {
+	l, err := c.GetRunLog(context.Background(), req)
+	if err != nil {
+		return fmt.Errorf("couldn't get the log of deployment %v: %v", req.Name, err)
+	}
+
+	state := "finished"
+	if l.Running {
+		state = "running"
+	}
+	fmt.Printf("Run of deployment %v started %v (%v, verbosity %v)\n", l.Name, l.Start.Format(time.RFC3339), state, l.Verbosity)
+	if l.Dropped > 0 {
+		fmt.Printf("... %v earlier entries dropped\n", l.Dropped)
+	}
+	for _, e := range l.Entries {
+		fmt.Printf("%v %v [%v] %v\n", e.Time.Format(time.RFC3339), strings.ToUpper(e.Level), e.Phase, e.Message)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().BoolVar(&logsRun, "run", false, "Show the log of the latest run rather than the recent errors.")
+}
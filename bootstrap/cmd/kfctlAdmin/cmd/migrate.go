@@ -0,0 +1,80 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun bool
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate <name>",
+	Short: "Migrate the state stored for a deployment to the schema of the kfctl server.",
+	Long: `Migrate the state the kfctl server stores for a deployment to the schema of its version
+and check the checkpoint of an interrupted run can be resumed.
+
+kfctl servers migrate their state when they start so this is only needed for state restored
+while the server runs. Run it with --dry-run against the new version of the server before an
+upgrade to list the migrations which would run and the problems found in the checkpoint.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		r, err := c.Migrate(context.Background(), app.MigrationRequest{KfDef: *req, DryRun: migrateDryRun})
+		if err != nil {
+			return fmt.Errorf("couldn't migrate deployment %v: %v", args[0], err)
+		}
+
+		verb := "Migrated"
+		if r.DryRun {
+			verb = "Would migrate"
+		}
+		if r.FromVersion == r.ToVersion {
+			fmt.Printf("The state of deployment %v is at schema version %v\n", r.Name, r.ToVersion)
+		} else {
+			fmt.Printf("%v the state of deployment %v from schema version %v to %v\n", verb, r.Name, r.FromVersion, r.ToVersion)
+		}
+		for _, s := range r.Steps {
+			fmt.Printf("  %v: %v\n", s.Version, s.Description)
+			for _, c := range s.Changes {
+				fmt.Printf("    %v\n", c)
+			}
+		}
+		for _, p := range r.ResumableState {
+			fmt.Println(p)
+		}
+		if r.ResumePhase != "" {
+			fmt.Printf("The interrupted run resumes from phase %v\n", r.ResumePhase)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Report the migrations which would run without changing anything.")
+}
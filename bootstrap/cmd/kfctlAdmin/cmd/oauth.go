@@ -0,0 +1,91 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var (
+	oauthClientId  string
+	oauthHostname  string
+	oauthProvision bool
+)
+
+// oauthCmd represents the oauth command
+var oauthCmd = &cobra.Command{
+	Use:   "oauth <name>",
+	Short: "Check or create the OAuth client IAP uses before deploying.",
+	Long: `Check the OAuth consent screen of the project and the OAuth client a deployment will use
+for IAP. The secret of the client is read from the environment variable CLIENT_SECRET. Problems
+which would prevent IAP from working are listed with the steps to fix them.
+
+With --provision a missing consent screen is created and, if --client-id isn't set, a new
+OAuth client is created; its id and secret are printed. The IAP API can only create consent
+screens for projects in an organization; other projects must configure it in the console.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		d, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		d.Spec.Hostname = oauthHostname
+		if oauthClientId != "" {
+			if err := gcp.SetOAuthClient(d, oauthClientId, os.Getenv(gcp.CLIENT_SECRET)); err != nil {
+				return err
+			}
+		}
+		report, err := c.CheckOAuthClient(context.Background(), app.OAuthClientRequest{
+			KfDef:     *d,
+			Provision: oauthProvision,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't check the OAuth client of %v: %v", args[0], err)
+		}
+
+		if report.BrandCreated {
+			fmt.Printf("Created the OAuth consent screen %v\n", report.Brand)
+		}
+		if report.ClientCreated {
+			fmt.Printf("Created OAuth client %v\nSecret: %v\nThe secret can't be read again; store it now.\n",
+				report.ClientId, report.ClientSecret)
+		}
+		for _, p := range report.Problems {
+			fmt.Fprintf(os.Stderr, "- %v\n", p)
+		}
+		if len(report.Problems) > 0 {
+			return fmt.Errorf("IAP won't work with the OAuth client of %v", args[0])
+		}
+		fmt.Printf("OAuth client %v is ready to be used by IAP\n", report.ClientId)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(oauthCmd)
+
+	oauthCmd.Flags().StringVar(&oauthClientId, "client-id", "", "The id of the OAuth client to check; its secret is read from CLIENT_SECRET.")
+	oauthCmd.Flags().StringVar(&oauthHostname, "hostname", "", "The hostname of the deployment; checks the IAP redirect URI is authorized on the client.")
+	oauthCmd.Flags().BoolVar(&oauthProvision, "provision", false, "Create the consent screen and the OAuth client if they don't exist.")
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/spf13/cobra"
+)
+
+var reencryptDryRun bool
+
+// reencryptCmd represents the reencrypt command
+var reencryptCmd = &cobra.Command{
+	Use:   "reencrypt <name>",
+	Short: "Re-encrypt the KfDefs stored for a deployment with the key of the kfctl server.",
+	Long: `Encrypt the KfDefs the kfctl server stores for a deployment with a new data key wrapped by the
+Cloud KMS key set as stateEncryptionKey in the server config.
+
+Run it after rotating the KMS key so the old key versions are no longer needed, after changing the
+key, or after removing it to store the state in plain text.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		r, err := c.Reencrypt(context.Background(), app.ReencryptionRequest{KfDef: *req, DryRun: reencryptDryRun})
+		if err != nil {
+			return fmt.Errorf("couldn't re-encrypt deployment %v: %v", args[0], err)
+		}
+
+		verb := "Re-encrypted"
+		if r.DryRun {
+			verb = "Would re-encrypt"
+		}
+		if len(r.Files) == 0 {
+			fmt.Printf("No state is stored for deployment %v\n", r.Name)
+		}
+		keyName := func(key string) string {
+			if key == "" {
+				return "plain text"
+			}
+			return key
+		}
+		for _, f := range r.Files {
+			fmt.Printf("%v %v: %v -> %v\n", verb, f.File, keyName(f.FromKey), keyName(f.ToKey))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reencryptCmd)
+
+	reencryptCmd.Flags().BoolVar(&reencryptDryRun, "dry-run", false, "Report the files which would be re-encrypted without changing them.")
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"os"
+)
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "kfctlAdmin",
+	Short: "An admin CLI to manage the deployments of a kfctl server",
+	Long: `An admin CLI to manage the deployments handled by a kfctl server or router
+e.g. the hosted deploy service.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		log.SetLevel(log.WarnLevel)
+		if verbose {
+			log.SetLevel(log.InfoLevel)
+		}
+		if endpoint == "" {
+			return fmt.Errorf("--endpoint is required")
+		}
+		if project == "" {
+			return fmt.Errorf("--project is required")
+		}
+		return nil
+	},
+}
+
+var (
+	endpoint  string
+	project   string
+	verbose   bool
+	tokenFile string
+	metadata  bool
+)
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&endpoint, "endpoint", "", "The endpoint of the kfctl server or router e.g. http://localhost:8080, [::1]:8080 or https://ingress.example.com/kfctl; the path is kept as a prefix of the requests. Replicas may be listed separated by commas or given as a DNS SRV name e.g. srv://kfctl.kubeflow.svc.cluster.local.")
+	rootCmd.PersistentFlags().StringVar(&project, "project", "", "The project of the deployments.")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "V", false, "verbose output default is false")
+	rootCmd.PersistentFlags().StringVar(&tokenFile, "token-file", "", "A file containing the access token; it is read again whenever it changes.")
+	rootCmd.PersistentFlags().BoolVar(&metadata, "metadata", false, "Use the credentials of the default service account from the GCE metadata server.")
+}
+
+// newClient returns a client for the endpoint. Requests carry an access token which the server
+// uses to check access to the project; by default from the application default credentials.
+func newClient() (*app.KfctlClient, error) {
+	var ts oauth2.TokenSource
+	switch {
+	case tokenFile != "":
+		ts = app.NewFileTokenSource(tokenFile)
+	case metadata:
+		ts = app.NewMetadataTokenSource("")
+	default:
+		var err error
+		ts, err = app.NewDefaultTokenSource(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := app.NewKfctlClient(endpoint, app.WithTokenSource(ts))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c.(*app.KfctlClient), nil
+}
+
+// newRequest returns a KfDef identifying the deployment name in the project.
+func newRequest(name string) (*kfdefs.KfDef, error) {
+	d := &kfdefs.KfDef{}
+	d.Name = name
+	d.Spec.Project = project
+	return d, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+)
+
+var upgradePreviewInput string
+
+// upgradePreviewCmd represents the upgrade-preview command
+var upgradePreviewCmd = &cobra.Command{
+	Use:   "upgrade-preview <name>",
+	Short: "Preview upgrading a deployment to a KfDef.",
+	Long: `Compare the KfDef a deployment would be upgraded to with the deployment without changing it.
+The applications which are added, removed, upgraded or reconfigured are listed with their current
+and target versions, along with the CRDs of the upgraded applications and the resources of the
+removed applications.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buf, err := ioutil.ReadFile(upgradePreviewInput)
+		if err != nil {
+			return err
+		}
+		req, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(buf, req); err != nil {
+			return fmt.Errorf("couldn't parse KfDef %v: %v", upgradePreviewInput, err)
+		}
+		req.Name = args[0]
+		if req.Spec.Project == "" {
+			req.Spec.Project = project
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		p, err := c.PreviewUpgrade(context.Background(), *req)
+		if err != nil {
+			return fmt.Errorf("couldn't preview upgrading deployment %v: %v", args[0], err)
+		}
+
+		fmt.Printf("Deployment %v: %v -> %v\n\n", p.Name, p.CurrentVersion, p.TargetVersion)
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "APPLICATION\tCHANGE\tCURRENT\tTARGET")
+		for _, a := range p.Applications {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", a.Name, a.Change, a.Current, a.Target)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		for _, crd := range p.UpdatedCRDs {
+			fmt.Printf("  updated %v\n", crd)
+		}
+		for _, o := range p.Removed {
+			fmt.Printf("  %v of a removed application is left in the cluster\n", o)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradePreviewCmd)
+
+	upgradePreviewCmd.Flags().StringVarP(&upgradePreviewInput, "file", "f", "", "The KfDef to upgrade the deployment to.")
+	upgradePreviewCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <name>",
+	Short: "Verify the cluster of a deployment against its signed manifests.",
+	Long: `Check the signatures of the manifests the deployment was last applied with and compare the
+objects in the cluster with them. Objects which are missing or whose fields differ from the signed
+manifests are listed. The deployment must set manifestSigning.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		d, err := newRequest(args[0])
+		if err != nil {
+			return err
+		}
+		report, err := c.VerifyManifests(context.Background(), *d)
+		if err != nil {
+			return fmt.Errorf("couldn't verify deployment %v: %v", args[0], err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "APPLICATION\tDIGEST\tSIGNATURE\tMISSING\tDRIFTED\tMESSAGE")
+		for _, a := range report.Applications {
+			signature := "invalid"
+			if a.SignatureValid {
+				signature = "valid"
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", a.Name, a.Digest, signature, len(a.Missing), len(a.Drifted), a.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		for _, a := range report.Applications {
+			for _, o := range a.Missing {
+				fmt.Printf("%v: %v is missing\n", a.Name, o)
+			}
+			for _, o := range a.Drifted {
+				fmt.Printf("%v: %v differs in %v\n", a.Name, o.Object, strings.Join(o.Fields, ", "))
+			}
+		}
+		if !report.Verified {
+			return fmt.Errorf("the cluster of deployment %v doesn't match its signed manifests", args[0])
+		}
+		fmt.Printf("\nThe cluster of deployment %v matches its signed manifests\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
 	"os"
+	"strings"
 
 	// log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2/google"
@@ -25,6 +26,7 @@ type ServerOption struct {
 	Config   string
 	Endpoint string
 	Zone     string
+	Region   string
 }
 
 // NewServerOption creates a new CMServer with a default config.
@@ -39,8 +41,9 @@ func (s *ServerOption) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&s.Config, "config", "https://raw.githubusercontent.com/kubeflow/kubeflow/master/bootstrap/config/kfctl_gcp_iap.yaml", "URI of a YAML file containing a KfDef object.")
 	fs.StringVar(&s.Name, "name", "", "Name for the deployment.")
 	fs.StringVar(&s.Project, "project", "", "Project.")
-	fs.StringVar(&s.Endpoint, "endpoint", "", "The endpoint e.g. http://localhost:8080.")
+	fs.StringVar(&s.Endpoint, "endpoint", "", "The endpoint e.g. http://localhost:8080. Replicas may be listed separated by commas or given as a DNS SRV name e.g. srv://kfctl.kubeflow.svc.cluster.local.")
 	fs.StringVar(&s.Zone, "zone", "", "Zone.")
+	fs.StringVar(&s.Region, "region", "", "Region; if set creates a regional cluster with nodes in several zones of the region.")
 
 }
 
@@ -58,6 +61,17 @@ func checkAccess(project string, token string) {
 
 	log.Infof("You have access to project %v", project)
 }
+
+// printProgress logs progress events reported by the client.
+func printProgress(e app.ProgressEvent) {
+	switch e.Type {
+	case app.ProgressRetry:
+		log.Infof("%v: attempt %v failed (%v); retrying in %v", e.Method, e.Attempt, e.Err, e.NextRetry)
+	case app.ProgressPhase:
+		log.Infof("%v: deployment phase %v; estimated time remaining %v", e.Method, e.Phase, e.ETA)
+	}
+}
+
 func run(opt *ServerOption) error {
 	if opt.Name == "" {
 		return fmt.Errorf("--name is required.")
@@ -86,7 +100,7 @@ func run(opt *ServerOption) error {
 	d.Spec.Email = email
 
 	fmt.Printf("Connecting to server: %v", opt.Endpoint)
-	c, err := app.NewKfctlClient(opt.Endpoint)
+	c, err := app.NewKfctlClient(opt.Endpoint, app.WithProgressFunc(printProgress))
 
 	if err != nil {
 		log.Errorf("There was a problem connecting to the server %+v", err)
@@ -153,6 +167,7 @@ func run(opt *ServerOption) error {
 	})
 
 	d.Spec.Zone = opt.Zone
+	d.Spec.Region = opt.Region
 
 	fmt.Printf("Spec to create:\n%v", utils.PrettyPrint(d))
 
@@ -160,9 +175,26 @@ func run(opt *ServerOption) error {
 
 	// TODO(jlewi) continually retry and wait for success or failure
 	ctx := context.Background()
+
+	lintResult, err := c.Lint(ctx, *d)
+	if err != nil {
+		log.Warningf("Could not lint KfDef; error %v", err)
+	} else {
+		for _, w := range lintResult.Warnings {
+			log.Warningf("Lint %v (%v): %v", w.Code, w.Field, w.Message)
+		}
+		if len(lintResult.Errors) > 0 {
+			return fmt.Errorf("KfDef is invalid; %v", strings.Join(lintResult.Errors, "; "))
+		}
+	}
 	res, err := c.CreateDeployment(ctx, *d)
 
 	if err != nil {
+		if vErr, ok := err.(*app.ValidationError); ok {
+			for _, f := range vErr.Fields {
+				log.Errorf("Invalid %v: %v", f.Field, f.Message)
+			}
+		}
 		log.Errorf("CreateDeployment failed; error %v", err)
 		return err
 	}
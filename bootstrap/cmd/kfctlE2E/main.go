@@ -0,0 +1,405 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// kfctlE2E starts a kfctl server targeting a kind cluster and drives a deployment through
+// the KfctlClient; it exits non zero if the deployment or any assertion on the cluster fails.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/cmd/bootstrap/app/options"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	"github.com/onrik/logrus/filename"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// pollInterval is how often the harness polls the server and the cluster.
+const pollInterval = 10 * time.Second
+
+// E2EOption are the options of the harness.
+type E2EOption struct {
+	Kubeconfig string
+	Config     string
+	Name       string
+	AppDir     string
+	Port       int
+	Timeout    time.Duration
+	KeepApp    bool
+}
+
+// AddFlags adds the flags of the harness to the specified FlagSet
+func (o *E2EOption) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Kubeconfig, "kubeconfig", os.Getenv(app.RecommendedConfigPathEnvVar), "Kubeconfig of the kind cluster to deploy to e.g. the output of kind get kubeconfig-path.")
+	fs.StringVar(&o.Config, "config", "https://raw.githubusercontent.com/kubeflow/kubeflow/master/bootstrap/config/kfctl_k8s_istio.yaml", "URI of a YAML file containing a KfDef object; the platform must be unset.")
+	fs.StringVar(&o.Name, "name", "kfctl-e2e", "Name for the deployment.")
+	fs.StringVar(&o.AppDir, "app-dir", "", "The directory for the kfctl server's apps; defaults to a temporary directory.")
+	fs.IntVar(&o.Port, "port", 8080, "The port to run the kfctl server on.")
+	fs.DurationVar(&o.Timeout, "timeout", 30*time.Minute, "How long to wait for each step to complete.")
+	fs.BoolVar(&o.KeepApp, "keep-app", false, "Don't delete the deployment at the end; useful for debugging failures.")
+}
+
+// step is a stage of the test; steps run in order and the test stops at the first failure.
+type step struct {
+	name string
+	run  func(context.Context) error
+}
+
+// harness drives the deployment through the client and checks the cluster.
+type harness struct {
+	opt       *E2EOption
+	client    app.KfctlService
+	k8sClient kubeclientset.Interface
+	kfDef     *kfdefs.KfDef
+}
+
+func init() {
+	// Add filename as one of the fields of the structured log message
+	filenameHook := filename.NewHook()
+	filenameHook.Field = "filename"
+	log.AddHook(filenameHook)
+}
+
+// logProgress logs progress events reported by the client.
+func logProgress(e app.ProgressEvent) {
+	switch e.Type {
+	case app.ProgressRetry:
+		log.Infof("%v: attempt %v failed (%v); retrying in %v", e.Method, e.Attempt, e.Err, e.NextRetry)
+	case app.ProgressPhase:
+		log.Infof("%v: deployment phase %v", e.Method, e.Phase)
+	}
+}
+
+// startServer runs a kfctl server in process which deploys to the cluster in kubeconfig.
+func startServer(opt *E2EOption) (string, error) {
+	sOpt := options.NewServerOption()
+	sOpt.Mode = "kfctl"
+	sOpt.AppDir = opt.AppDir
+	sOpt.Port = opt.Port
+	sOpt.KeepAlive = true
+	sOpt.TargetKubeconfig = opt.Kubeconfig
+	sOpt.DrainTimeout = time.Minute
+
+	go func() {
+		if err := app.Run(sOpt); err != nil {
+			log.Fatalf("kfctl server exited; error %v", err)
+		}
+	}()
+
+	endpoint := fmt.Sprintf("http://localhost:%v", opt.Port)
+	err := poll(opt.Timeout, func() (bool, error) {
+		resp, err := http.Get(endpoint)
+		if err != nil {
+			log.Infof("Waiting for the kfctl server; %v", err)
+			return false, nil
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK, nil
+	})
+	return endpoint, err
+}
+
+// poll calls condition every pollInterval until it returns true or an error or timeout elapses.
+func poll(timeout time.Duration, condition func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// completedRuns returns the number of runs of the deployment the server recorded.
+func (h *harness) completedRuns(ctx context.Context) (int, error) {
+	stats, err := h.client.GetStats(ctx, app.StatsRequest{KfDef: *h.kfDef})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range stats.Runs {
+		if r.Name == h.kfDef.Name && r.Status != app.RunInProgress {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// deploy submits the KfDef and waits for the server to finish handling it.
+func (h *harness) deploy(ctx context.Context) error {
+	return h.submitAndWait(ctx, func() error {
+		_, err := h.client.CreateDeployment(ctx, *h.kfDef)
+		return err
+	})
+}
+
+// submitAndWait calls submit to queue a request and waits for the server to finish handling it.
+func (h *harness) submitAndWait(ctx context.Context, submit func() error) error {
+	before, err := h.completedRuns(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := submit(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var run *app.DeploymentRun
+	err = poll(h.opt.Timeout, func() (bool, error) {
+		stats, err := h.client.GetStats(ctx, app.StatsRequest{KfDef: *h.kfDef})
+		if err != nil {
+			return false, err
+		}
+		n := 0
+		for i, r := range stats.Runs {
+			if r.Name != h.kfDef.Name || r.Status == app.RunInProgress {
+				continue
+			}
+			n++
+			if n > before {
+				run = &stats.Runs[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "waiting for the deployment to finish")
+	}
+
+	if run.Status == app.RunFailed {
+		msg := fmt.Sprintf("deployment failed in phase %v with code %v", run.Phase, run.Code)
+		if history, err := h.client.GetErrorHistory(ctx, *h.kfDef); err == nil && len(history.Errors) > 0 {
+			last := history.Errors[len(history.Errors)-1]
+			msg = fmt.Sprintf("%v; %v %v", msg, last.Message, last.Cause)
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// namespaceUID returns the UID of the namespace of the deployment.
+func (h *harness) namespaceUID() (types.UID, error) {
+	ns, err := h.k8sClient.CoreV1().Namespaces().Get(h.kfDef.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "namespace %v doesn't exist", h.kfDef.Namespace)
+	}
+	return ns.UID, nil
+}
+
+// assertDeployed checks the deployments in the namespace of the deployment become ready.
+func (h *harness) assertDeployed() error {
+	if _, err := h.namespaceUID(); err != nil {
+		return err
+	}
+
+	return poll(h.opt.Timeout, func() (bool, error) {
+		deployments, err := h.k8sClient.AppsV1().Deployments(h.kfDef.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		if len(deployments.Items) == 0 {
+			return false, fmt.Errorf("no deployments were created in namespace %v", h.kfDef.Namespace)
+		}
+
+		notReady := []string{}
+		for _, d := range deployments.Items {
+			replicas := int32(1)
+			if d.Spec.Replicas != nil {
+				replicas = *d.Spec.Replicas
+			}
+			if d.Status.ReadyReplicas < replicas {
+				notReady = append(notReady, d.Name)
+			}
+		}
+		if len(notReady) > 0 {
+			log.Infof("Waiting for deployments to be ready: %v", strings.Join(notReady, ", "))
+			return false, nil
+		}
+		log.Infof("All %v deployments in %v are ready", len(deployments.Items), h.kfDef.Namespace)
+		return true, nil
+	})
+}
+
+// create deploys Kubeflow and checks it becomes ready.
+func (h *harness) create(ctx context.Context) error {
+	if err := h.deploy(ctx); err != nil {
+		return err
+	}
+	return h.assertDeployed()
+}
+
+// upgrade resubmits the KfDef and checks the existing resources are updated rather than recreated.
+//
+// TODO: The server reuses the KfApp loaded for the first request so changes to the spec
+// aren't picked up; once they are the harness should upgrade to a different version.
+func (h *harness) upgrade(ctx context.Context) error {
+	before, err := h.namespaceUID()
+	if err != nil {
+		return err
+	}
+	if err := h.deploy(ctx); err != nil {
+		return err
+	}
+	after, err := h.namespaceUID()
+	if err != nil {
+		return err
+	}
+	if before != after {
+		return fmt.Errorf("namespace %v was recreated by the upgrade", h.kfDef.Namespace)
+	}
+	return h.assertDeployed()
+}
+
+// delete deletes the deployment and checks its namespace is deleted.
+func (h *harness) delete(ctx context.Context) error {
+	err := h.submitAndWait(ctx, func() error {
+		plan, err := h.client.PrepareDelete(ctx, *h.kfDef)
+		if err != nil {
+			return err
+		}
+		req := h.kfDef.DeepCopy()
+		if req.Annotations == nil {
+			req.Annotations = map[string]string{}
+		}
+		req.Annotations[app.DeleteConfirmationAnnotation] = plan.Token
+		_, err = h.client.DeleteDeployment(ctx, *req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return poll(h.opt.Timeout, func() (bool, error) {
+		_, err := h.k8sClient.CoreV1().Namespaces().Get(h.kfDef.Namespace, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		log.Infof("Waiting for namespace %v to be deleted", h.kfDef.Namespace)
+		return false, nil
+	})
+}
+
+func run(opt *E2EOption) error {
+	if opt.Kubeconfig == "" {
+		return fmt.Errorf("--kubeconfig is required.")
+	}
+
+	if opt.AppDir == "" {
+		dir, err := ioutil.TempDir("", "kfctlE2E")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		opt.AppDir = dir
+	}
+
+	d, err := kfdefs.LoadKFDefFromURI(opt.Config)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if d.Spec.Platform != "" {
+		return fmt.Errorf("%v has platform %v; only KfDefs for existing clusters can be deployed to kind", opt.Config, d.Spec.Platform)
+	}
+	d.Name = opt.Name
+	if d.Spec.Project == "" {
+		// The server keys deployments by project.
+		d.Spec.Project = "kind"
+	}
+	if d.Namespace == "" {
+		d.Namespace = "kubeflow"
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", opt.Kubeconfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	k8sClient, err := kubeclientset.NewForConfig(config)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	endpoint, err := startServer(opt)
+	if err != nil {
+		return errors.Wrap(err, "starting the kfctl server")
+	}
+
+	c, err := app.NewKfctlClient(endpoint, app.WithProgressFunc(logProgress))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	h := &harness{
+		opt:       opt,
+		client:    c,
+		k8sClient: k8sClient,
+		kfDef:     d,
+	}
+
+	log.Infof("Spec to deploy:\n%v", utils.PrettyPrint(d))
+
+	ctx := context.Background()
+	steps := []step{
+		{"create", h.create},
+		{"upgrade", h.upgrade},
+	}
+	if !opt.KeepApp {
+		steps = append(steps, step{"delete", h.delete})
+	}
+
+	for _, s := range steps {
+		log.Infof("Running step %v", s.name)
+		start := time.Now()
+		if err := s.run(ctx); err != nil {
+			return errors.Wrapf(err, "step %v failed", s.name)
+		}
+		log.Infof("Step %v passed in %v", s.name, time.Since(start))
+	}
+	return nil
+}
+
+func main() {
+	o := &E2EOption{}
+	o.AddFlags(flag.CommandLine)
+
+	flag.Parse()
+
+	if err := run(o); err != nil {
+		log.Fatalf("E2E test failed; error %+v", err)
+	}
+	log.Info("E2E test passed")
+}
@@ -26,9 +26,9 @@ import (
 	"regexp"
 	"strings"
 
-	gogetter "github.com/hashicorp/go-getter"
 	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
 	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	ext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	crdclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
@@ -94,6 +94,7 @@ const (
 	DISABLE_USAGE_REPORT  CliOption = "disable_usage_report"
 	PACKAGE_MANAGER       CliOption = "package-manager"
 	CONFIG                CliOption = "config"
+	SERVER                CliOption = "server"
 )
 
 //
@@ -153,6 +154,8 @@ const (
 	GCP              = "gcp"
 	MINIKUBE         = "minikube"
 	EXISTING_ARRIKTO = "existing_arrikto"
+	// SIMULATE fakes the deployment; it is both a platform and a package manager.
+	SIMULATE = "simulate"
 )
 
 // PackageManagers
@@ -219,7 +222,7 @@ func DownloadToCache(appDir string, repo string, version string) (string, error)
 		}
 	}
 	tarballUrl := "https://github.com/kubeflow/" + repo + "/tarball/" + version + "?archive=tar.gz"
-	tarballUrlErr := gogetter.GetAny(cacheDir, tarballUrl)
+	tarballUrlErr := utils.GetAny(cacheDir, tarballUrl)
 	if tarballUrlErr != nil {
 		return "", &kfapis.KfError{
 			Code:    int(kfapis.INVALID_ARGUMENT),
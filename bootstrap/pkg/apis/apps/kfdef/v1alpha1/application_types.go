@@ -15,22 +15,28 @@
 package v1alpha1
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"github.com/ghodss/yaml"
 	gogetter "github.com/hashicorp/go-getter"
 	"github.com/hashicorp/go-getter/helper/url"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
 	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
 	valid "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 const (
@@ -72,8 +78,438 @@ type KfDefSpec struct {
 
 	// Applications defines a list of applications to install
 	Applications []Application `json:"applications,omitempty"`
+
+	// AdoptionPolicy controls what happens when applying a resource that already exists
+	// but isn't owned by this deployment. Defaults to adopt which only takes over the resources
+	// not owned by another deployment.
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// Namespaces lays out the platform components across namespaces. If it isn't set the
+	// components are deployed to the namespaces their manifests use.
+	Namespaces *NamespaceLayout `json:"namespaces,omitempty"`
+
+	// Instance scopes the resources of the deployment so several deployments e.g. staging and
+	// prod can be applied to the same cluster. If it isn't set the deployment assumes it is the
+	// only one in its cluster.
+	Instance *InstanceScope `json:"instance,omitempty"`
+
+	// CABundle is PEM encoded CA certificates trusted in addition to the system roots e.g. the
+	// CA of a TLS intercepting proxy. The package manager mounts it in the containers of the
+	// applications and the kfctl server trusts it for its own outbound requests.
+	CABundle string `json:"caBundle,omitempty"`
+
+	// ResourceQuota caps the resources the Kubeflow namespace may consume.
+	ResourceQuota *v1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+	// LimitRange sets the default and maximum resources of the pods and containers in the
+	// Kubeflow namespace.
+	LimitRange *v1.LimitRangeSpec `json:"limitRange,omitempty"`
+
+	// Region if set creates a regional GKE cluster whose control plane and nodes are spread
+	// across the zones of the region. Zone must be in the region; zonal resources such as the
+	// pipeline persistent disks are still created in it.
+	Region string `json:"region,omitempty"`
+
+	// Placements schedule the pods of applications onto dedicated nodes e.g. a preemptible
+	// node pool for training. Platforms which create the nodes add the placements for them.
+	Placements []WorkloadPlacement `json:"placements,omitempty"`
+
+	// Admins are the emails of the users granted the kubeflow-admin cluster role when the
+	// deployment is applied.
+	Admins []string `json:"admins,omitempty"`
+	// Profiles are created when the deployment is applied, in addition to the default profile
+	// of Email, so teams can use the deployment without creating their profiles by hand.
+	Profiles []TeamProfile `json:"profiles,omitempty"`
+
+	// Hooks run at the phases of a deployment e.g. to gate it on an approval or to configure
+	// the cluster; a hook which fails stops the deployment.
+	Hooks []Hook `json:"hooks,omitempty"`
+
+	// Features are the optional features enabled for the deployment e.g. multi-user. The
+	// package manager maps each feature to the overlays and applications implementing it so
+	// users don't edit the kustomizations by hand; removing a feature disables it.
+	Features []string `json:"features,omitempty"`
+
+	// ManifestSinks are where the rendered manifests are written in addition to being applied
+	// e.g. for archiving or for GitOps; gs://bucket/prefix, s3://bucket/prefix or the absolute
+	// path of a directory e.g. a mounted volume.
+	ManifestSinks []string `json:"manifestSinks,omitempty"`
+
+	// Istio configures the istio installed by the deployment. The package manager renders it into
+	// the istio manifests so istio doesn't have to be edited after the deployment; requires useIstio.
+	Istio *IstioConfig `json:"istio,omitempty"`
+
+	// ReportUsage opts the deployment in to reporting its anonymized outcome; the platform,
+	// version, error code and duration of each run. Names, projects and emails aren't reported.
+	// Reports are only sent if the kfctl server is configured with a telemetry endpoint.
+	ReportUsage bool `json:"reportUsage,omitempty"`
+
+	// ManifestSigning signs the rendered manifest of each application before it is applied so
+	// what was applied can be attested and the cluster verified against it later.
+	ManifestSigning *ManifestSigning `json:"manifestSigning,omitempty"`
+
+	// ExternalStorage stores the data of pipelines and metadata in an external MySQL database
+	// and object store instead of the in-cluster MySQL and Minio e.g. for production installs.
+	ExternalStorage *ExternalStorage `json:"externalStorage,omitempty"`
+
+	// ExistingPlatform reuses the Istio and Knative already installed in the cluster instead of
+	// installing the bundled ones; they are looked for in the namespaces of the namespace layout.
+	ExistingPlatform *ExistingPlatform `json:"existingPlatform,omitempty"`
+
+	// Gpu installs the NVIDIA driver and device plugin on the GPU nodes of the cluster and labels
+	// the nodes when the deployment is applied so GPUs can be used without setting them up by hand.
+	Gpu *GpuConfig `json:"gpu,omitempty"`
+
+	// Transformers customize the resources of applications when their kustomizations are
+	// generated e.g. to prefix their names or add labels. Only declarative transformers are
+	// supported; they can't reference files or run programs on the kfctl server.
+	Transformers []KustomizeTransformer `json:"transformers,omitempty"`
+
+	// MaintenanceWindows are the recurring periods in which disruptive operations e.g. upgrades,
+	// certificate rotation and node pool changes run; they are deferred to the next window
+	// otherwise. Disruptive operations can run at any time if there are no windows.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+}
+
+// GpuNodeOS is the image of the GPU nodes; it selects the driver installer.
+type GpuNodeOS string
+
+const (
+	GpuNodeOSCos    GpuNodeOS = "cos"
+	GpuNodeOSUbuntu GpuNodeOS = "ubuntu"
+)
+
+// GpuConfig configures the NVIDIA GPUs of the cluster.
+type GpuConfig struct {
+	// NodeSelector selects the GPU nodes; the nodes with the label cloud.google.com/gke-accelerator
+	// if empty.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Driver installs the NVIDIA driver on the GPU nodes with a daemonset.
+	Driver *GpuDriver `json:"driver,omitempty"`
+	// DevicePlugin runs the NVIDIA device plugin which advertises the GPUs of the nodes as
+	// nvidia.com/gpu. GKE runs its own device plugin so it is only needed on other clusters.
+	DevicePlugin *GpuDevicePlugin `json:"devicePlugin,omitempty"`
+	// NodeLabels are added to the GPU nodes e.g. so workloads can select them. Nodes added after
+	// the deployment is applied are labeled the next time it is applied.
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+}
+
+// GpuDriver configures the NVIDIA driver installer.
+type GpuDriver struct {
+	// NodeOS defaults to cos.
+	NodeOS GpuNodeOS `json:"nodeOS,omitempty"`
+	// Image replaces the installer of the node OS preloaded on GKE nodes e.g. on other clusters.
+	Image string `json:"image,omitempty"`
+	// Version is the version of the driver installed e.g. 418.67; the default of the installer if empty.
+	Version string `json:"version,omitempty"`
+}
+
+// GpuDevicePlugin configures the NVIDIA device plugin.
+type GpuDevicePlugin struct {
+	// Image defaults to nvidia/k8s-device-plugin:1.0.0-beta4.
+	Image string `json:"image,omitempty"`
+}
+
+// Limits of the transformers so a KfDef can't make generating its manifests arbitrarily expensive.
+const (
+	MaxTransformerReplacements = 50
+	MaxReplacementValueBytes   = 4096
+	MaxTransformerNamePrefix   = 20
+)
+
+// KustomizeTransformer is added to the kustomizations of applications when they are generated.
+type KustomizeTransformer struct {
+	// Name identifies the transformer.
+	Name string `json:"name"`
+	// Applications are the names of the applications transformed; all applications if empty.
+	Applications []string `json:"applications,omitempty"`
+	// NamePrefix is prepended to the names of the resources and the references to them.
+	NamePrefix string `json:"namePrefix,omitempty"`
+	// CommonLabels are added to the resources and their selectors.
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	// Replacements replace the values of fields of the resources; they are applied as JSON patches.
+	Replacements []FieldReplacement `json:"replacements,omitempty"`
+}
+
+// FieldReplacement replaces the value of a field of a resource.
+type FieldReplacement struct {
+	// Group, Version and Kind select the type of the resource; Group is empty for the core group.
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Name is the name of the resource in the manifests, before any name prefix.
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Path is the JSON pointer of the field e.g. /spec/replicas; the field must exist.
+	Path string `json:"path"`
+	// Value is the new value of the field.
+	Value runtime.RawExtension `json:"value"`
+}
+
+// MaintenanceWindow is a recurring period in which disruptive operations may run.
+type MaintenanceWindow struct {
+	// Days are the days of the week the window opens on e.g. Saturday; every day if empty.
+	Days []string `json:"days,omitempty"`
+	// Start is the time of day the window opens at e.g. 02:00.
+	Start string `json:"start"`
+	// Duration is how long the window stays open; between an hour and a day.
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone is the IANA time zone of Start e.g. America/Los_Angeles; defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// ExistingPlatformMode controls when the Istio and Knative installed in the cluster are reused.
+type ExistingPlatformMode string
+
+const (
+	// ExistingPlatformDetect reuses the components which are installed and installs the bundled
+	// ones which aren't.
+	ExistingPlatformDetect ExistingPlatformMode = "Detect"
+	// ExistingPlatformRequire reuses the installed components and fails if one isn't installed.
+	ExistingPlatformRequire ExistingPlatformMode = "Require"
+)
+
+// ExistingPlatform configures reusing the platform components installed in the cluster. An
+// installed component whose version isn't supported by the Kubeflow version always fails the
+// deployment rather than being replaced by the bundled one.
+type ExistingPlatform struct {
+	// Mode defaults to Detect.
+	Mode ExistingPlatformMode `json:"mode,omitempty"`
+	// IngressGatewaySelector selects the pods of the installed ingress gateway the Kubeflow
+	// gateway binds to; the selector of the manifests e.g. istio: ingressgateway if empty.
+	IngressGatewaySelector map[string]string `json:"ingressGatewaySelector,omitempty"`
+}
+
+// ExternalStorage configures the external storage of pipelines and metadata. The in-cluster
+// MySQL or Minio is still used for whichever of Database and ObjectStore isn't set.
+type ExternalStorage struct {
+	Database    *ExternalDatabase    `json:"database,omitempty"`
+	ObjectStore *ExternalObjectStore `json:"objectStore,omitempty"`
+}
+
+// ExternalDatabase is a MySQL database.
+type ExternalDatabase struct {
+	// Host is the host of the MySQL server. It defaults to the Cloud SQL proxy if CloudSQL is set
+	// and is otherwise required.
+	Host string `json:"host,omitempty"`
+	// Port defaults to 3306.
+	Port int32 `json:"port,omitempty"`
+	// User is the MySQL user pipelines and metadata connect as.
+	User string `json:"user"`
+	// PasswordSecret is the name of the secret of the KfDef holding the password of User.
+	PasswordSecret string `json:"passwordSecret"`
+	// CloudSQL creates the database as a Cloud SQL instance on GCP with User; the in-cluster
+	// MySQL is replaced by the Cloud SQL proxy.
+	CloudSQL *CloudSQLInstance `json:"cloudSQL,omitempty"`
+}
+
+// CloudSQLInstance is a Cloud SQL for MySQL instance in the region of the deployment.
+type CloudSQLInstance struct {
+	// Name defaults to the name of the deployment followed by -mysql.
+	Name string `json:"name,omitempty"`
+	// Tier is the machine type of the instance; defaults to db-n1-standard-1.
+	Tier string `json:"tier,omitempty"`
+}
+
+// ExternalObjectStore is a bucket of an S3 compatible object store e.g. GCS or S3.
+type ExternalObjectStore struct {
+	// Endpoint is the host[:port] of the S3 API; defaults to storage.googleapis.com.
+	Endpoint string `json:"endpoint,omitempty"`
+	Bucket   string `json:"bucket"`
+	// Insecure connects to Endpoint with HTTP rather than HTTPS.
+	Insecure bool `json:"insecure,omitempty"`
+	// AccessKeySecret and SecretKeySecret are the names of the secrets of the KfDef holding the
+	// access key and secret key e.g. the HMAC key of a GCS service account.
+	AccessKeySecret string `json:"accessKeySecret"`
+	SecretKeySecret string `json:"secretKeySecret"`
+	// CreateBucket creates the bucket on GCP.
+	CreateBucket bool `json:"createBucket,omitempty"`
 }
 
+// Defaults of the external storage.
+const (
+	DefaultMySQLPort           = 3306
+	DefaultCloudSQLTier        = "db-n1-standard-1"
+	DefaultObjectStoreEndpoint = "storage.googleapis.com"
+)
+
+// ManifestSigning configures signing the rendered manifests.
+type ManifestSigning struct {
+	// KeySecret is the name of the secret holding the PEM encoded ECDSA P-256 private key the
+	// manifests are signed with. The signatures are ASN.1 encoded ECDSA signatures of the SHA-256
+	// digest of each manifest so they can be checked with cosign verify-blob.
+	KeySecret string `json:"keySecret"`
+}
+
+// IstioMTLSMode is the mesh wide mutual TLS mode of istio.
+type IstioMTLSMode string
+
+const (
+	// IstioMTLSStrict only accepts mutual TLS traffic between the sidecars.
+	IstioMTLSStrict IstioMTLSMode = "STRICT"
+	// IstioMTLSPermissive accepts both mutual TLS and plain text traffic.
+	IstioMTLSPermissive IstioMTLSMode = "PERMISSIVE"
+)
+
+// IstioConfig holds the istio options of a deployment. Options which aren't set keep the values
+// of the manifests.
+type IstioConfig struct {
+	// MTLS is the mesh wide mutual TLS mode.
+	MTLS IstioMTLSMode `json:"mtls,omitempty"`
+	// IngressGatewayType is the type of the istio-ingressgateway service e.g. NodePort.
+	IngressGatewayType v1.ServiceType `json:"ingressGatewayType,omitempty"`
+	// InjectionNamespaces are labeled so istio injects sidecars into their pods; they are
+	// created if they don't exist.
+	InjectionNamespaces []string `json:"injectionNamespaces,omitempty"`
+}
+
+// Namespaces the manifests deploy components to.
+const (
+	ManifestsNamespace        = "kubeflow"
+	ManifestsIstioNamespace   = "istio-system"
+	ManifestsKnativeNamespace = "knative-serving"
+)
+
+// ManifestsIngressGatewayLabel is the value of the istio label of the pods of the ingress gateway
+// in the manifests.
+const ManifestsIngressGatewayLabel = "ingressgateway"
+
+// CABundleConfigMap is the config map holding the CA bundle of the deployment in each namespace
+// with pods it is mounted in; CABundleKey is its key.
+const (
+	CABundleConfigMap = "kubeflow-ca-bundle"
+	CABundleKey       = "ca-bundle.crt"
+)
+
+// CABundleMountPath is where the CA bundle is mounted in the containers. The certificate directory
+// is read by the TLS clients of Go and of most distributions in addition to the system bundle.
+const CABundleMountPath = "/etc/ssl/certs/kubeflow-ca-bundle.crt"
+
+// NamespaceLayout sets the namespaces the platform components are deployed to. A component
+// whose namespace isn't set is deployed to the namespace of the KfDef; so an empty layout
+// deploys everything to a single namespace.
+type NamespaceLayout struct {
+	// Istio is the namespace of the istio control plane and gateways.
+	Istio string `json:"istio,omitempty"`
+	// Knative is the namespace of knative serving.
+	Knative string `json:"knative,omitempty"`
+}
+
+// CRDStrategy decides which of the deployments sharing a cluster manages the CRDs; CRDs are
+// cluster scoped so they can't be scoped to an instance.
+type CRDStrategy string
+
+const (
+	// CRDStrategyShared creates the CRDs which don't exist but never adopts, updates or deletes
+	// CRDs so deleting the deployment doesn't delete the custom resources of the others.
+	CRDStrategyShared CRDStrategy = "shared"
+	// CRDStrategyOwner applies the CRDs like a deployment alone in its cluster and deletes them
+	// with the deployment. At most one of the deployments sharing a cluster should own the CRDs.
+	CRDStrategyOwner CRDStrategy = "owner"
+)
+
+// InstanceScope keeps the resources of deployments sharing a cluster apart. The namespaced
+// resources are kept apart by the namespaces of the deployments; without a namespace layout the
+// istio and knative components are deployed to the namespace of the KfDef too.
+type InstanceScope struct {
+	// NamePrefix is prepended to the names of the cluster scoped RBAC resources and webhook
+	// configurations and to the references to them. Defaults to the name of the KfDef and a dash.
+	NamePrefix string `json:"namePrefix,omitempty"`
+	// IngressGateway is the value of the istio label of the pods of the ingress gateway of the
+	// deployment; the Kubeflow gateway only selects them. Defaults to <namePrefix>ingressgateway.
+	IngressGateway string `json:"ingressGateway,omitempty"`
+	// CRDStrategy defaults to shared.
+	CRDStrategy CRDStrategy `json:"crdStrategy,omitempty"`
+}
+
+// WorkloadPlacement schedules the pods of applications onto dedicated nodes by adding a node
+// selector and tolerations to the pod templates in their manifests.
+type WorkloadPlacement struct {
+	// Name identifies the placement e.g. by the node pool it targets.
+	Name string `json:"name"`
+	// Applications are the names of the applications whose pods are placed.
+	Applications []string `json:"applications,omitempty"`
+	// NodeSelector is merged into the node selector of the pods.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations are added to the pods unless they already have them.
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+}
+
+// TeamProfile is a profile created for a team; its namespace is named after the profile.
+type TeamProfile struct {
+	// Name of the profile and its namespace.
+	Name string `json:"name"`
+	// Owner is the email of the user who owns the profile.
+	Owner string `json:"owner"`
+	// Contributors are the other users with access to the namespace of the profile.
+	Contributors []ProfileContributor `json:"contributors,omitempty"`
+}
+
+// ProfileContributor is a user with access to the namespace of a profile.
+type ProfileContributor struct {
+	// User is the email of the user.
+	User string `json:"user"`
+	// Role is the role of the user in the namespace; defaults to edit.
+	Role ContributorRole `json:"role,omitempty"`
+}
+
+// ContributorRole is the access a contributor has to the namespace of a profile.
+type ContributorRole string
+
+const (
+	// ContributorRoleEdit binds the kubeflow-edit cluster role in the namespace.
+	ContributorRoleEdit ContributorRole = "edit"
+	// ContributorRoleView binds the kubeflow-view cluster role in the namespace.
+	ContributorRoleView ContributorRole = "view"
+)
+
+// HookPhase is the phase of a deployment at which a hook runs.
+type HookPhase string
+
+const (
+	// HookPreProvision runs before the platform e.g. the GKE cluster is created or updated.
+	HookPreProvision HookPhase = "pre-provision"
+	// HookPostProvision runs after the platform is created or updated.
+	HookPostProvision HookPhase = "post-provision"
+	// HookPreApply runs before the applications are applied to the cluster.
+	HookPreApply HookPhase = "pre-apply"
+	// HookPostApply runs after the applications are applied to the cluster.
+	HookPostApply HookPhase = "post-apply"
+)
+
+// Hook is a step run at a phase of a deployment; either a webhook or a Job in the cluster.
+// Hooks of the same phase run in order.
+type Hook struct {
+	// Name identifies the hook.
+	Name  string    `json:"name"`
+	Phase HookPhase `json:"phase"`
+	// Webhook is called with the phase and the KfDef.
+	Webhook *WebhookHook `json:"webhook,omitempty"`
+	// Job runs in the namespace of the KfDef. It can't run before the cluster is provisioned.
+	Job *batchv1.JobSpec `json:"job,omitempty"`
+	// TimeoutSeconds bounds how long the hook may run; defaults to 600.
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+}
+
+// WebhookHook is a hook which POSTs the phase and the KfDef to a URL; the hook fails unless the
+// response is a 2xx.
+type WebhookHook struct {
+	URL string `json:"url"`
+}
+
+// AdoptionPolicy determines how pre-existing resources not owned by the deployment are handled.
+type AdoptionPolicy string
+
+const (
+	// AdoptionPolicyFail fails the apply with a conflict error.
+	AdoptionPolicyFail AdoptionPolicy = "fail"
+	// AdoptionPolicyAdopt labels the existing resource as owned by the deployment but leaves it unchanged.
+	// Resources owned by another deployment fail the apply with a conflict error.
+	AdoptionPolicyAdopt AdoptionPolicy = "adopt"
+	// AdoptionPolicyForce replaces the existing resource and labels it as owned by the deployment,
+	// even if it is owned by another deployment.
+	AdoptionPolicyForce AdoptionPolicy = "force"
+)
+
 var DefaultRegistry = RegistryConfig{
 	Name: "kubeflow",
 	Repo: "https://github.com/kubeflow/kubeflow.git",
@@ -84,6 +520,30 @@ var DefaultRegistry = RegistryConfig{
 type Application struct {
 	Name            string           `json:"name,omitempty"`
 	KustomizeConfig *KustomizeConfig `json:"kustomizeConfig,omitempty"`
+	// Readiness defines when the application is ready once it is applied.
+	Readiness *Readiness `json:"readiness,omitempty"`
+}
+
+// Readiness defines when an application is ready after it is applied. The deployment only
+// succeeds once all its applications are ready.
+type Readiness struct {
+	// Checks must all pass for the application to be ready. If there are none every Deployment
+	// and Job in the manifest of the application is checked.
+	Checks []ReadinessCheck `json:"checks,omitempty"`
+	// TimeoutSeconds bounds how long to wait for the application to be ready; defaults to 600.
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+}
+
+// ReadinessCheck is a single readiness check; exactly one of Deployment, Job and URL must be set.
+type ReadinessCheck struct {
+	// Deployment is the name of a Deployment which must be available.
+	Deployment string `json:"deployment,omitempty"`
+	// Job is the name of a Job which must complete.
+	Job string `json:"job,omitempty"`
+	// Namespace of the Deployment or Job; defaults to the namespace of the KfDef.
+	Namespace string `json:"namespace,omitempty"`
+	// URL must respond to a GET with a 2xx.
+	URL string `json:"url,omitempty"`
 }
 
 type KustomizeConfig struct {
@@ -243,6 +703,92 @@ type KfDefStatus struct {
 	Conditions []KfDefCondition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,6,rep,name=conditions"`
 	// ReposCache is used to cache information about local caching of the URIs.
 	ReposCache map[string]RepoCache `json:"reposCache,omitempty"`
+	// Applications is the outcome of applying each application the last time it was applied.
+	Applications []ApplicationStatus `json:"applications,omitempty"`
+	// ClusterVersion is the GKE version the cluster was created or updated with; it is resolved
+	// from the version and release channel requested in the GCP plugin spec.
+	ClusterVersion string `json:"clusterVersion,omitempty"`
+	// Zone is the zone the cluster was provisioned in when it differs from Spec.Zone because the
+	// requested zone was out of capacity and a fallback zone of the GCP plugin spec was used.
+	Zone string `json:"zone,omitempty"`
+	// ManifestSignatures are the signatures of the manifests of each application the last time
+	// it was applied; only set if ManifestSigning is configured.
+	ManifestSignatures []ManifestSignature `json:"manifestSignatures,omitempty"`
+	// Inventory are the cloud and K8s resources created for the deployment. A resource stays in
+	// the inventory until the deployment is deleted.
+	Inventory []InventoryResource `json:"inventory,omitempty"`
+	// Certificate is the provisioning state of the managed certificate of the endpoint; only set
+	// by platforms which provision one.
+	Certificate *CertificateStatus `json:"certificate,omitempty"`
+}
+
+// CertificateStatus is the provisioning state of a managed TLS certificate. Provisioning can take
+// well over the time the deployment takes so it is tracked after the deployment finishes.
+type CertificateStatus struct {
+	Name    string   `json:"name"`
+	Domains []string `json:"domains,omitempty"`
+	// State is the state reported for the certificate e.g. Provisioning or Active.
+	State string `json:"state"`
+	// CreationTime is when the certificate was requested.
+	CreationTime metav1.Time `json:"creationTime,omitempty"`
+	// ExpectedReadyTime is when the certificate is expected to be issued by.
+	ExpectedReadyTime metav1.Time `json:"expectedReadyTime,omitempty"`
+}
+
+// InventoryResource is a cloud or K8s resource created for a deployment.
+type InventoryResource struct {
+	// Kind is the kind of a K8s object e.g. Deployment or the type of a cloud resource e.g.
+	// container.v1.cluster.
+	Kind string `json:"kind"`
+	// APIVersion is the API version of a K8s object; empty for cloud resources.
+	APIVersion string `json:"apiVersion,omitempty"`
+	Name       string `json:"name"`
+	// Namespace is the namespace of a namespaced K8s object.
+	Namespace string `json:"namespace,omitempty"`
+	// Project is the project of a cloud resource.
+	Project string `json:"project,omitempty"`
+	// Source is what created the resource; the application of a K8s object or the Deployment
+	// Manager deployment of a cloud resource.
+	Source string `json:"source,omitempty"`
+	// CreationTime is when the resource was created or first recorded.
+	CreationTime metav1.Time `json:"creationTime,omitempty"`
+}
+
+// ManifestSignature is the signature of the rendered manifest of an application.
+type ManifestSignature struct {
+	Application string `json:"application"`
+	// Digest is the SHA-256 digest of the manifest e.g. sha256:<hex>.
+	Digest string `json:"digest"`
+	// Signature is the base64 encoded signature of the manifest.
+	Signature  string      `json:"signature"`
+	SignedTime metav1.Time `json:"signedTime,omitempty"`
+}
+
+// ApplicationState is the outcome of applying an application.
+type ApplicationState string
+
+const (
+	// ApplicationApplied means the resources of the application were created or updated.
+	ApplicationApplied ApplicationState = "Applied"
+	// ApplicationFailed means there was a problem applying the application.
+	ApplicationFailed ApplicationState = "Failed"
+	// ApplicationSkipped means the application wasn't applied because the apply stopped before reaching it
+	// e.g. because the cluster isn't compatible, or because the component it installs is already
+	// installed in the cluster and reused.
+	ApplicationSkipped ApplicationState = "Skipped"
+	// ApplicationReady means the application was applied and its readiness checks passed.
+	ApplicationReady ApplicationState = "Ready"
+	// ApplicationNotReady means the application was applied but its readiness checks didn't pass in time.
+	ApplicationNotReady ApplicationState = "NotReady"
+)
+
+// ApplicationStatus is the outcome of applying an application.
+type ApplicationStatus struct {
+	Name  string           `json:"name"`
+	State ApplicationState `json:"state"`
+	// Message is the error for a failed application or why it was skipped.
+	Message        string      `json:"message,omitempty"`
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
 }
 
 type RepoCache struct {
@@ -264,10 +810,25 @@ const (
 	// KfFailed meansthere was a problem deploying Kubeflow.
 	KfFailed KfDefConditionType = "Failed"
 
+	// KfUpdateAvailable means the upstream release branch has changes the pinned manifests of
+	// the deployment don't have.
+	KfUpdateAvailable KfDefConditionType = "UpdateAvailable"
+
 	// Reasons for conditions
 
 	// InvalidKfDefSpecReason indicates the KfDef was not valid.
 	InvalidKfDefSpecReason = "InvalidKfDefSpec"
+
+	// DomainNotVerifiedReason indicates the owner of the custom domain couldn't be verified.
+	DomainNotVerifiedReason = "DomainNotVerified"
+
+	// RedirectURINotAuthorizedReason indicates the OAuth client used by IAP doesn't authorize the
+	// redirect URI of the custom domain.
+	RedirectURINotAuthorizedReason = "RedirectURINotAuthorized"
+
+	// OrgPolicyViolationReason indicates the organization policies of the project don't allow
+	// the resources of the deployment.
+	OrgPolicyViolationReason = "OrgPolicyViolation"
 )
 
 type KfDefCondition struct {
@@ -352,6 +913,14 @@ func LoadKFDefFromURI(configFile string) (*KfDef, error) {
 			Message: fmt.Sprintf("could not read from config file %s: %v", configFile, err),
 		}
 	}
+	if configSealer != nil {
+		if configFileBytes, err = configSealer.Open(configFileBytes); err != nil {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("could not decrypt config file %s: %v", configFile, err),
+			}
+		}
+	}
 	// Unmarshal content onto KfDef struct
 	kfDef := &KfDef{}
 	if err := yaml.Unmarshal(configFileBytes, kfDef); err != nil {
@@ -405,8 +974,8 @@ func (d *KfDef) SyncCache() error {
 	}
 	appDir := d.Spec.AppDir
 	// Loop over all the repos and download them.
-	// TODO(https://github.com/kubeflow/kubeflow/issues/3545): We should check if we already have a local copy and
-	// not redownload it.
+	// GitHub archives are fetched conditionally so an unchanged archive is reused from the
+	// archive cache instead of being downloaded again.
 
 	baseCacheDir := path.Join(appDir, DefaultCacheDir)
 	if _, err := os.Stat(baseCacheDir); os.IsNotExist(err) {
@@ -451,7 +1020,7 @@ func (d *KfDef) SyncCache() error {
 		}
 
 		log.Infof("Fetching %v to %v", r.Uri, cacheDir)
-		tarballUrlErr := gogetter.GetAny(cacheDir, r.Uri)
+		tarballUrlErr := utils.GetAny(cacheDir, r.Uri)
 		if tarballUrlErr != nil {
 			return &kfapis.KfError{
 				Code:    int(kfapis.INVALID_ARGUMENT),
@@ -514,6 +1083,58 @@ func (d *KfDef) SetSecret(newSecret Secret) {
 	d.Spec.Secrets = append(d.Spec.Secrets, newSecret)
 }
 
+// SetApplicationStatus sets the status of an application; if the application already has a status it is overwritten.
+func (d *KfDef) SetApplicationStatus(newStatus ApplicationStatus) {
+	for i, s := range d.Status.Applications {
+		if s.Name == newStatus.Name {
+			d.Status.Applications[i] = newStatus
+			return
+		}
+	}
+
+	d.Status.Applications = append(d.Status.Applications, newStatus)
+}
+
+// SetManifestSignature records the signature of the manifest of an application replacing its previous signature.
+func (d *KfDef) SetManifestSignature(newSignature ManifestSignature) {
+	for i, s := range d.Status.ManifestSignatures {
+		if s.Application == newSignature.Application {
+			d.Status.ManifestSignatures[i] = newSignature
+			return
+		}
+	}
+
+	d.Status.ManifestSignatures = append(d.Status.ManifestSignatures, newSignature)
+}
+
+// RecordResource adds the resource to the inventory of the deployment. A resource which is already
+// in the inventory keeps its creation time.
+func (d *KfDef) RecordResource(r InventoryResource) {
+	if r.CreationTime.IsZero() {
+		r.CreationTime = metav1.Now()
+	}
+	for i, e := range d.Status.Inventory {
+		if e.Kind == r.Kind && e.Namespace == r.Namespace && e.Project == r.Project && e.Name == r.Name {
+			r.CreationTime = e.CreationTime
+			d.Status.Inventory[i] = r
+			return
+		}
+	}
+
+	d.Status.Inventory = append(d.Status.Inventory, r)
+}
+
+// FailedApplications returns the names of the applications which failed the last time they were applied.
+func (d *KfDef) FailedApplications() []string {
+	failed := []string{}
+	for _, s := range d.Status.Applications {
+		if s.State == ApplicationFailed {
+			failed = append(failed, s.Name)
+		}
+	}
+	return failed
+}
+
 // GetPluginSpec will try to unmarshal the spec for the specified plugin to the supplied
 // interface. Returns an error if the plugin isn't defined or if there is a problem
 // unmarshaling it.
@@ -537,7 +1158,7 @@ func (d *KfDef) GetPluginSpec(pluginName string, s interface{}) error {
 		if err != nil {
 			log.Errorf("Could not unmarshal plugin %v to the provided type; error %v", pluginName, err)
 		}
-		return nil
+		return err
 	}
 
 	return NewPluginNotFound(pluginName)
@@ -588,23 +1209,686 @@ func (d *KfDef) SetPluginSpec(pluginName string, spec interface{}) error {
 	return nil
 }
 
+// FieldError is a validation failure of a field of the KfDef.
+type FieldError struct {
+	// Field is the path of the offending field e.g. spec.hooks[notify].webhook.url; items of lists
+	// are selected by name or by index if they don't have one.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
 // IsValid returns true if the spec is a valid and complete spec.
 // If false it will also return a string providing a message about why its invalid.
 func (d *KfDef) IsValid() (bool, string) {
+	if errs := d.Validate(); len(errs) > 0 {
+		return false, errs[0].Message
+	}
+	return true, ""
+}
+
+// Validate returns the validation failures of the KfDef; empty if it is a valid and complete spec.
+// Items of lists are only checked until their first failure.
+func (d *KfDef) Validate() []FieldError {
 	// TODO(jlewi): Add more validation and a unittest.
+	failures := []FieldError{}
+	fail := func(field string, format string, args ...interface{}) {
+		failures = append(failures, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
 	// Validate kfDef
 	errs := valid.NameIsDNSLabel(d.Name, false)
 	if errs != nil && len(errs) > 0 {
-		return false, fmt.Sprintf("invalid name due to %v", strings.Join(errs, ","))
+		fail("metadata.name", "invalid name due to %v", strings.Join(errs, ","))
 	}
 
 	// PackageManager is currently required because we will try to load the package manager and get an error if
 	// none is specified.
 	if d.Spec.PackageManager == "" {
-		return false, fmt.Sprintf("KfDef.Spec.PackageManager is required")
+		fail("spec.packageManager", "KfDef.Spec.PackageManager is required")
 	}
 
-	return true, ""
+	switch d.Spec.AdoptionPolicy {
+	case "", AdoptionPolicyFail, AdoptionPolicyAdopt, AdoptionPolicyForce:
+	default:
+		fail("spec.adoptionPolicy", "KfDef.Spec.AdoptionPolicy %v isn't supported; must be one of %v, %v, %v",
+			d.Spec.AdoptionPolicy, AdoptionPolicyFail, AdoptionPolicyAdopt, AdoptionPolicyForce)
+	}
+
+	if i := d.Spec.Instance; i != nil {
+		if i.NamePrefix != "" {
+			if errs := valid.NameIsDNSSubdomain(i.NamePrefix, true); len(errs) > 0 {
+				fail("spec.instance.namePrefix", "invalid name prefix %v due to %v", i.NamePrefix, strings.Join(errs, ","))
+			}
+		}
+		if errs := validation.IsValidLabelValue(d.IngressGatewayLabel()); len(errs) > 0 {
+			fail("spec.instance.ingressGateway", "invalid ingress gateway %v due to %v", d.IngressGatewayLabel(), strings.Join(errs, ","))
+		}
+		switch i.CRDStrategy {
+		case "", CRDStrategyShared, CRDStrategyOwner:
+		default:
+			fail("spec.instance.crdStrategy", "KfDef.Spec.Instance.CRDStrategy %v isn't supported; must be one of %v, %v",
+				i.CRDStrategy, CRDStrategyShared, CRDStrategyOwner)
+		}
+	}
+
+	if d.Spec.CABundle != "" {
+		if _, err := d.CABundleCertificates(); err != nil {
+			fail("spec.caBundle", "invalid CA bundle; %v", err)
+		}
+	}
+
+	for _, ns := range d.TargetNamespaces() {
+		if errs := valid.ValidateNamespaceName(ns, false); len(errs) > 0 {
+			field := "spec.namespaces"
+			if ns == d.Namespace {
+				field = "metadata.namespace"
+			}
+			fail(field, "invalid namespace %v due to %v", ns, strings.Join(errs, ","))
+		}
+	}
+
+	placements := map[string]bool{}
+	for i, p := range d.Spec.Placements {
+		if p.Name == "" || placements[p.Name] {
+			fail(fmt.Sprintf("spec.placements[%v].name", i), "KfDef.Spec.Placements must have unique, non empty names; got %q", p.Name)
+		}
+		placements[p.Name] = true
+	}
+
+	for i, admin := range d.Spec.Admins {
+		if admin == "" {
+			fail(fmt.Sprintf("spec.admins[%v]", i), "KfDef.Spec.Admins must not contain empty emails")
+		}
+	}
+
+	hooks := map[string]bool{}
+	for i, h := range d.Spec.Hooks {
+		if h.Name == "" || hooks[h.Name] {
+			fail(fmt.Sprintf("spec.hooks[%v].name", i), "KfDef.Spec.Hooks must have unique, non empty names; got %q", h.Name)
+			continue
+		}
+		hooks[h.Name] = true
+		field := fmt.Sprintf("spec.hooks[%v]", h.Name)
+		switch h.Phase {
+		case HookPreProvision, HookPostProvision, HookPreApply, HookPostApply:
+		default:
+			fail(field+".phase", "phase %v of hook %v isn't supported; must be one of %v, %v, %v, %v", h.Phase,
+				h.Name, HookPreProvision, HookPostProvision, HookPreApply, HookPostApply)
+			continue
+		}
+		if (h.Webhook == nil) == (h.Job == nil) {
+			fail(field, "hook %v must set exactly one of webhook and job", h.Name)
+			continue
+		}
+		if h.Webhook != nil && !strings.HasPrefix(h.Webhook.URL, "https://") && !strings.HasPrefix(h.Webhook.URL, "http://") {
+			fail(field+".webhook.url", "hook %v has an invalid webhook url %q", h.Name, h.Webhook.URL)
+			continue
+		}
+		if h.Job != nil && h.Phase == HookPreProvision {
+			fail(field+".job", "hook %v can't run a job %v since there is no cluster yet", h.Name, h.Phase)
+		}
+	}
+
+	// Decode the specs of the plugins to their registered types so a malformed spec is rejected
+	// up front rather than when the plugin runs.
+	if _, err := d.TypedPluginSpecs(); err != nil {
+		fail("spec.plugins", "KfDef.Spec.Plugins is invalid; %v", err)
+	}
+
+	for _, a := range d.Spec.Applications {
+		if a.Readiness == nil {
+			continue
+		}
+		field := fmt.Sprintf("spec.applications[%v].readiness", a.Name)
+		if a.Readiness.TimeoutSeconds < 0 {
+			fail(field+".timeoutSeconds", "the readiness timeout of application %v must not be negative", a.Name)
+			continue
+		}
+		for i, c := range a.Readiness.Checks {
+			set := 0
+			for _, v := range []string{c.Deployment, c.Job, c.URL} {
+				if v != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				fail(fmt.Sprintf("%v.checks[%v]", field, i), "the readiness checks of application %v must set exactly one of deployment, job and url", a.Name)
+				break
+			}
+			if c.URL != "" && !strings.HasPrefix(c.URL, "https://") && !strings.HasPrefix(c.URL, "http://") {
+				fail(fmt.Sprintf("%v.checks[%v].url", field, i), "application %v has an invalid readiness url %q", a.Name, c.URL)
+				break
+			}
+		}
+	}
+
+	features := map[string]bool{}
+	for i, f := range d.Spec.Features {
+		if f == "" || features[f] {
+			fail(fmt.Sprintf("spec.features[%v]", i), "KfDef.Spec.Features must have unique, non empty names; got %q", f)
+		}
+		features[f] = true
+	}
+
+	for i, sink := range d.Spec.ManifestSinks {
+		if err := ValidateManifestSink(sink); err != nil {
+			fail(fmt.Sprintf("spec.manifestSinks[%v]", i), "KfDef.Spec.ManifestSinks is invalid; %v", err)
+		}
+	}
+
+	if signing := d.Spec.ManifestSigning; signing != nil {
+		if signing.KeySecret == "" {
+			fail("spec.manifestSigning.keySecret", "KfDef.Spec.ManifestSigning.KeySecret must be the name of the secret holding the signing key")
+		} else if _, err := d.GetSecret(signing.KeySecret); err != nil {
+			fail("spec.manifestSigning.keySecret", "KfDef.Spec.ManifestSigning.KeySecret %v isn't a secret of the KfDef", signing.KeySecret)
+		}
+	}
+
+	if istio := d.Spec.Istio; istio != nil {
+		if !d.Spec.UseIstio {
+			fail("spec.istio", "KfDef.Spec.Istio requires KfDef.Spec.UseIstio")
+		}
+		switch istio.MTLS {
+		case "", IstioMTLSStrict, IstioMTLSPermissive:
+		default:
+			fail("spec.istio.mtls", "KfDef.Spec.Istio.MTLS %v isn't supported; must be one of %v, %v",
+				istio.MTLS, IstioMTLSStrict, IstioMTLSPermissive)
+		}
+		switch istio.IngressGatewayType {
+		case "", v1.ServiceTypeClusterIP, v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer:
+		default:
+			fail("spec.istio.ingressGatewayType", "KfDef.Spec.Istio.IngressGatewayType %v isn't supported; must be one of %v, %v, %v",
+				istio.IngressGatewayType, v1.ServiceTypeClusterIP, v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer)
+		}
+		for i, ns := range istio.InjectionNamespaces {
+			if errs := valid.ValidateNamespaceName(ns, false); len(errs) > 0 {
+				fail(fmt.Sprintf("spec.istio.injectionNamespaces[%v]", i), "invalid injection namespace %q due to %v", ns, strings.Join(errs, ","))
+			}
+		}
+	}
+
+	if existing := d.Spec.ExistingPlatform; existing != nil {
+		switch existing.Mode {
+		case "", ExistingPlatformDetect, ExistingPlatformRequire:
+		default:
+			fail("spec.existingPlatform.mode", "KfDef.Spec.ExistingPlatform.Mode %v isn't supported; must be one of %v, %v",
+				existing.Mode, ExistingPlatformDetect, ExistingPlatformRequire)
+		}
+		for k := range existing.IngressGatewaySelector {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				fail("spec.existingPlatform.ingressGatewaySelector", "invalid label %q due to %v", k, strings.Join(errs, ","))
+			}
+		}
+	}
+
+	if gpu := d.Spec.Gpu; gpu != nil {
+		for _, labels := range []struct {
+			field  string
+			values map[string]string
+		}{{"spec.gpu.nodeSelector", gpu.NodeSelector}, {"spec.gpu.nodeLabels", gpu.NodeLabels}} {
+			for k, v := range labels.values {
+				if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+					fail(labels.field, "invalid label %q due to %v", k, strings.Join(errs, ","))
+				}
+				if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+					fail(labels.field, "invalid value %q of label %v due to %v", v, k, strings.Join(errs, ","))
+				}
+			}
+		}
+		if driver := gpu.Driver; driver != nil {
+			switch driver.NodeOS {
+			case "", GpuNodeOSCos, GpuNodeOSUbuntu:
+			default:
+				fail("spec.gpu.driver.nodeOS", "KfDef.Spec.Gpu.Driver.NodeOS %v isn't supported; must be one of %v, %v",
+					driver.NodeOS, GpuNodeOSCos, GpuNodeOSUbuntu)
+			}
+		}
+	}
+
+	transformers := map[string]bool{}
+	for i, t := range d.Spec.Transformers {
+		if t.Name == "" || transformers[t.Name] {
+			fail(fmt.Sprintf("spec.transformers[%v].name", i), "KfDef.Spec.Transformers must have unique, non empty names; got %q", t.Name)
+			continue
+		}
+		transformers[t.Name] = true
+		field := fmt.Sprintf("spec.transformers[%v]", t.Name)
+		if t.NamePrefix != "" {
+			if errs := validation.IsDNS1123Label(strings.TrimSuffix(t.NamePrefix, "-")); len(errs) > 0 || len(t.NamePrefix) > MaxTransformerNamePrefix {
+				fail(field+".namePrefix", "transformer %v has an invalid name prefix %q; it must be at most %v lower case alphanumeric characters or '-'",
+					t.Name, t.NamePrefix, MaxTransformerNamePrefix)
+			}
+		}
+		for k, v := range t.CommonLabels {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				fail(field+".commonLabels", "invalid label %q due to %v", k, strings.Join(errs, ","))
+			}
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				fail(field+".commonLabels", "invalid value %q of label %v due to %v", v, k, strings.Join(errs, ","))
+			}
+		}
+		if len(t.Replacements) > MaxTransformerReplacements {
+			fail(field+".replacements", "transformer %v has %v replacements; at most %v are allowed", t.Name, len(t.Replacements), MaxTransformerReplacements)
+			continue
+		}
+		for j, r := range t.Replacements {
+			rField := fmt.Sprintf("%v.replacements[%v]", field, j)
+			if r.Version == "" || r.Kind == "" || r.Name == "" {
+				fail(rField, "the replacements of transformer %v must set the version, kind and name of the resource", t.Name)
+				break
+			}
+			if !strings.HasPrefix(r.Path, "/") {
+				fail(rField+".path", "transformer %v has an invalid path %q; it must be a JSON pointer e.g. /spec/replicas", t.Name, r.Path)
+				break
+			}
+			if len(r.Value.Raw) == 0 || len(r.Value.Raw) > MaxReplacementValueBytes {
+				fail(rField+".value", "the replacements of transformer %v must have a value of at most %v bytes", t.Name, MaxReplacementValueBytes)
+				break
+			}
+		}
+	}
+
+	for i, w := range d.Spec.MaintenanceWindows {
+		field := fmt.Sprintf("spec.maintenanceWindows[%v]", i)
+		if _, err := time.Parse(maintenanceWindowStartLayout, w.Start); err != nil {
+			fail(field+".start", "KfDef.Spec.MaintenanceWindows start %q must be a time of day e.g. 02:00", w.Start)
+		}
+		if w.Duration.Duration < time.Hour || w.Duration.Duration > 24*time.Hour {
+			fail(field+".duration", "KfDef.Spec.MaintenanceWindows duration %v must be between 1h and 24h", w.Duration.Duration)
+		}
+		if _, err := time.LoadLocation(w.TimeZone); err != nil {
+			fail(field+".timeZone", "KfDef.Spec.MaintenanceWindows time zone %q isn't known", w.TimeZone)
+		}
+		for _, day := range w.Days {
+			if _, ok := weekdays[day]; !ok {
+				fail(field+".days", "KfDef.Spec.MaintenanceWindows day %q must be a day of the week e.g. Saturday", day)
+			}
+		}
+	}
+
+	if storage := d.Spec.ExternalStorage; storage != nil {
+		if db := storage.Database; db != nil {
+			if db.Host == "" && db.CloudSQL == nil {
+				fail("spec.externalStorage.database.host", "KfDef.Spec.ExternalStorage.Database.Host is required unless CloudSQL is set")
+			}
+			if db.Port < 0 || db.Port > 65535 {
+				fail("spec.externalStorage.database.port", "KfDef.Spec.ExternalStorage.Database.Port %v isn't a valid port", db.Port)
+			}
+			if db.User == "" {
+				fail("spec.externalStorage.database.user", "KfDef.Spec.ExternalStorage.Database.User is required")
+			}
+			if _, err := d.GetSecret(db.PasswordSecret); err != nil {
+				fail("spec.externalStorage.database.passwordSecret", "KfDef.Spec.ExternalStorage.Database.PasswordSecret %q isn't a secret of the KfDef", db.PasswordSecret)
+			}
+		}
+		if store := storage.ObjectStore; store != nil {
+			if store.Bucket == "" {
+				fail("spec.externalStorage.objectStore.bucket", "KfDef.Spec.ExternalStorage.ObjectStore.Bucket is required")
+			}
+			if _, err := d.GetSecret(store.AccessKeySecret); err != nil {
+				fail("spec.externalStorage.objectStore.accessKeySecret", "KfDef.Spec.ExternalStorage.ObjectStore.AccessKeySecret %q isn't a secret of the KfDef", store.AccessKeySecret)
+			}
+			if _, err := d.GetSecret(store.SecretKeySecret); err != nil {
+				fail("spec.externalStorage.objectStore.secretKeySecret", "KfDef.Spec.ExternalStorage.ObjectStore.SecretKeySecret %q isn't a secret of the KfDef", store.SecretKeySecret)
+			}
+		}
+	}
+
+	profiles := map[string]bool{}
+	for i, p := range d.Spec.Profiles {
+		if errs := valid.ValidateNamespaceName(p.Name, false); len(errs) > 0 {
+			fail(fmt.Sprintf("spec.profiles[%v].name", i), "invalid profile name %q due to %v", p.Name, strings.Join(errs, ","))
+			continue
+		}
+		if profiles[p.Name] {
+			fail(fmt.Sprintf("spec.profiles[%v].name", i), "KfDef.Spec.Profiles has more than one profile named %v", p.Name)
+			continue
+		}
+		profiles[p.Name] = true
+		field := fmt.Sprintf("spec.profiles[%v]", p.Name)
+		if p.Owner == "" {
+			fail(field+".owner", "profile %v must have an owner", p.Name)
+		}
+		for j, c := range p.Contributors {
+			if c.User == "" {
+				fail(fmt.Sprintf("%v.contributors[%v].user", field, j), "the contributors of profile %v must have a user", p.Name)
+				continue
+			}
+			switch c.Role {
+			case "", ContributorRoleEdit, ContributorRoleView:
+			default:
+				fail(fmt.Sprintf("%v.contributors[%v].role", field, j), "role %v of contributor %v of profile %v isn't supported; must be one of %v, %v",
+					c.Role, c.User, p.Name, ContributorRoleEdit, ContributorRoleView)
+			}
+		}
+	}
+
+	return failures
+}
+
+// FeatureEnabled returns true if the named feature is enabled for the deployment.
+func (d *KfDef) FeatureEnabled(name string) bool {
+	for _, f := range d.Spec.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CloudSQLInstanceName returns the name of the Cloud SQL instance of the deployment.
+func (d *KfDef) CloudSQLInstanceName() string {
+	if s := d.Spec.ExternalStorage; s != nil && s.Database != nil && s.Database.CloudSQL != nil && s.Database.CloudSQL.Name != "" {
+		return s.Database.CloudSQL.Name
+	}
+	return d.Name + "-mysql"
+}
+
+// Schemes of the manifest sinks in buckets.
+const (
+	ManifestSinkGCS = "gs"
+	ManifestSinkS3  = "s3"
+)
+
+// ParseManifestSink splits a manifest sink into the scheme, bucket and prefix of a bucket
+// e.g. gs://bucket/prefix; the scheme and bucket of a local directory are empty and the
+// prefix is its path.
+func ParseManifestSink(sink string) (string, string, string, error) {
+	for _, scheme := range []string{ManifestSinkGCS, ManifestSinkS3} {
+		if !strings.HasPrefix(sink, scheme+"://") {
+			continue
+		}
+		pieces := strings.SplitN(strings.TrimPrefix(sink, scheme+"://"), "/", 2)
+		if pieces[0] == "" {
+			return "", "", "", fmt.Errorf("manifest sink %q doesn't have a bucket", sink)
+		}
+		prefix := ""
+		if len(pieces) == 2 {
+			prefix = strings.Trim(pieces[1], "/")
+		}
+		return scheme, pieces[0], prefix, nil
+	}
+	if !path.IsAbs(sink) {
+		return "", "", "", fmt.Errorf("manifest sink %q must be gs://bucket/prefix, s3://bucket/prefix or an absolute path", sink)
+	}
+	return "", "", path.Clean(sink), nil
+}
+
+// ValidateManifestSink returns an error if sink isn't a bucket or an absolute path.
+func ValidateManifestSink(sink string) error {
+	_, _, _, err := ParseManifestSink(sink)
+	return err
+}
+
+// SetPlacement adds the placement p or replaces the placement with the same name.
+func (d *KfDef) SetPlacement(p WorkloadPlacement) {
+	for i, existing := range d.Spec.Placements {
+		if existing.Name == p.Name {
+			d.Spec.Placements[i] = p
+			return
+		}
+	}
+	d.Spec.Placements = append(d.Spec.Placements, p)
+}
+
+// RemovePlacement removes the placement with the given name if there is one.
+func (d *KfDef) RemovePlacement(name string) {
+	placements := []WorkloadPlacement{}
+	for _, p := range d.Spec.Placements {
+		if p.Name != name {
+			placements = append(placements, p)
+		}
+	}
+	if len(placements) == 0 {
+		placements = nil
+	}
+	d.Spec.Placements = placements
+}
+
+// PlacementsFor returns the placements of the pods of an application.
+func (d *KfDef) PlacementsFor(appName string) []WorkloadPlacement {
+	placements := []WorkloadPlacement{}
+	for _, p := range d.Spec.Placements {
+		for _, a := range p.Applications {
+			if a == appName {
+				placements = append(placements, p)
+				break
+			}
+		}
+	}
+	return placements
+}
+
+// TransformersFor returns the transformers of an application in order.
+func (d *KfDef) TransformersFor(appName string) []KustomizeTransformer {
+	transformers := []KustomizeTransformer{}
+	for _, t := range d.Spec.Transformers {
+		if len(t.Applications) == 0 {
+			transformers = append(transformers, t)
+			continue
+		}
+		for _, a := range t.Applications {
+			if a == appName {
+				transformers = append(transformers, t)
+				break
+			}
+		}
+	}
+	return transformers
+}
+
+// maintenanceWindowStartLayout is the layout of the start of a maintenance window.
+const maintenanceWindowStartLayout = "15:04"
+
+// weekdays maps the names of the days of the week to their time.Weekday.
+var weekdays = map[string]time.Weekday{}
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays[d.String()] = d
+	}
+}
+
+// openings returns the times the window opens at from the day before t to the given number of
+// days after t in order. Invalid windows never open.
+func (w MaintenanceWindow) openings(t time.Time, days int) []time.Time {
+	start, err := time.Parse(maintenanceWindowStartLayout, w.Start)
+	if err != nil {
+		return nil
+	}
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return nil
+	}
+	allowed := map[time.Weekday]bool{}
+	for _, day := range w.Days {
+		allowed[weekdays[day]] = true
+	}
+	local := t.In(loc)
+	openings := []time.Time{}
+	for i := -1; i <= days; i++ {
+		open := time.Date(local.Year(), local.Month(), local.Day()+i, start.Hour(), start.Minute(), 0, 0, loc)
+		if len(allowed) == 0 || allowed[open.Weekday()] {
+			openings = append(openings, open)
+		}
+	}
+	return openings
+}
+
+// InMaintenanceWindow returns true if disruptive operations may run at t; always true if the
+// KfDef doesn't declare maintenance windows.
+func (d *KfDef) InMaintenanceWindow(t time.Time) bool {
+	if len(d.Spec.MaintenanceWindows) == 0 {
+		return true
+	}
+	for _, w := range d.Spec.MaintenanceWindows {
+		for _, open := range w.openings(t, 0) {
+			if !t.Before(open) && t.Before(open.Add(w.Duration.Duration)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NextMaintenanceWindow returns when the next maintenance window opens after t; t if a window
+// is open and the zero time if no window will open.
+func (d *KfDef) NextMaintenanceWindow(t time.Time) time.Time {
+	if d.InMaintenanceWindow(t) {
+		return t
+	}
+	next := time.Time{}
+	for _, w := range d.Spec.MaintenanceWindows {
+		for _, open := range w.openings(t, 7) {
+			if open.After(t) && (next.IsZero() || open.Before(next)) {
+				next = open
+			}
+		}
+	}
+	return next
+}
+
+// HooksFor returns the hooks of a phase in order.
+func (d *KfDef) HooksFor(phase HookPhase) []Hook {
+	hooks := []Hook{}
+	for _, h := range d.Spec.Hooks {
+		if h.Phase == phase {
+			hooks = append(hooks, h)
+		}
+	}
+	return hooks
+}
+
+// RelocateNamespace returns the namespace to deploy the resources the manifests put in ns to.
+func (d *KfDef) RelocateNamespace(ns string) string {
+	if d.Namespace == "" {
+		return ns
+	}
+	switch ns {
+	case ManifestsNamespace:
+		return d.Namespace
+	case ManifestsIstioNamespace:
+		if layout := d.namespaceLayout(); layout != nil {
+			return d.layoutNamespace(layout.Istio)
+		}
+	case ManifestsKnativeNamespace:
+		if layout := d.namespaceLayout(); layout != nil {
+			return d.layoutNamespace(layout.Knative)
+		}
+	}
+	return ns
+}
+
+// namespaceLayout returns the namespace layout of the deployment; an empty layout for an instance
+// without one so it doesn't share the istio and knative namespaces. Nil if there is no layout.
+func (d *KfDef) namespaceLayout() *NamespaceLayout {
+	if d.Spec.Namespaces == nil && d.Spec.Instance != nil {
+		return &NamespaceLayout{}
+	}
+	return d.Spec.Namespaces
+}
+
+// InstancePrefix returns the prefix of the names of the cluster scoped resources of the
+// deployment; empty if it isn't scoped to an instance.
+func (d *KfDef) InstancePrefix() string {
+	if d.Spec.Instance == nil {
+		return ""
+	}
+	if d.Spec.Instance.NamePrefix != "" {
+		return d.Spec.Instance.NamePrefix
+	}
+	return d.Name + "-"
+}
+
+// IngressGatewayLabel returns the value of the istio label of the pods of the ingress gateway of
+// the deployment.
+func (d *KfDef) IngressGatewayLabel() string {
+	if d.Spec.Instance != nil && d.Spec.Instance.IngressGateway != "" {
+		return d.Spec.Instance.IngressGateway
+	}
+	return d.InstancePrefix() + ManifestsIngressGatewayLabel
+}
+
+// SharesCRDs returns true if the deployment doesn't manage the CRDs it applies.
+func (d *KfDef) SharesCRDs() bool {
+	return d.Spec.Instance != nil && d.Spec.Instance.CRDStrategy != CRDStrategyOwner
+}
+
+// CABundleCertificates returns the certificates of the CA bundle; an error if it holds anything
+// other than PEM encoded certificates or none.
+func (d *KfDef) CABundleCertificates() ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	rest := []byte(d.Spec.CABundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("the bundle holds a %v; only certificates are allowed", block.Type)
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return nil, fmt.Errorf("the bundle holds data which isn't PEM encoded")
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("the bundle holds no certificates")
+	}
+	return certs, nil
+}
+
+// layoutNamespace returns ns or the namespace of the KfDef if ns isn't set.
+func (d *KfDef) layoutNamespace(ns string) string {
+	if ns == "" {
+		return d.Namespace
+	}
+	return ns
+}
+
+// TargetNamespaces returns the namespaces the deployment creates; the namespace of the
+// KfDef first.
+func (d *KfDef) TargetNamespaces() []string {
+	namespaces := []string{}
+	if d.Namespace == "" {
+		return namespaces
+	}
+	namespaces = append(namespaces, d.Namespace)
+	layout := d.namespaceLayout()
+	if layout == nil {
+		return namespaces
+	}
+	for _, ns := range []string{d.layoutNamespace(layout.Istio), d.layoutNamespace(layout.Knative)} {
+		seen := false
+		for _, n := range namespaces {
+			seen = seen || n == ns
+		}
+		if !seen {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// ConfigSealer encrypts the KfDefs written to config files and decrypts them when they are read.
+type ConfigSealer interface {
+	Seal(buf []byte) ([]byte, error)
+	Open(buf []byte) ([]byte, error)
+}
+
+// configSealer if set seals the files written by WriteToFile and opens the files read by
+// LoadKFDefFromURI.
+var configSealer ConfigSealer
+
+// SetConfigSealer makes WriteToFile seal the config files with s and LoadKFDefFromURI open them
+// e.g. so the kfctl server stores app.yaml encrypted. Files which aren't sealed are still read.
+func SetConfigSealer(s ConfigSealer) {
+	configSealer = s
 }
 
 // WriteToFile write the KfDef to a file.
@@ -630,6 +1914,18 @@ func (d *KfDef) WriteToFile(path string) error {
 		log.Errorf("Error marshaling kfdev; %v", bufErr)
 		return bufErr
 	}
+	if configSealer != nil {
+		if buf, bufErr = configSealer.Seal(buf); bufErr != nil {
+			log.Errorf("Error sealing kfdef; %v", bufErr)
+			return bufErr
+		}
+		log.Infof("Writing sealed KfDef to %v", path)
+		if err := ioutil.WriteFile(path, buf, 0600); err != nil {
+			return err
+		}
+		// WriteFile keeps the mode of a file written before the KfDefs were sealed.
+		return os.Chmod(path, 0600)
+	}
 	log.Infof("Writing stripped KfDef to %v", path)
 	return ioutil.WriteFile(path, buf, 0644)
 }
@@ -15,16 +15,29 @@
 package v1alpha1
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/ghodss/yaml"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
 	"github.com/prometheus/common/log"
 	"io/ioutil"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"math/big"
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO(https://github.com/kubeflow/kubeflow/issues/3056): Fix the test and uncomment.
@@ -243,6 +256,71 @@ func TestWriteKfDef(t *testing.T) {
 	}
 }
 
+// xorSealer seals config files by flipping the bits of every byte.
+type xorSealer struct{}
+
+const xorSealerPrefix = "sealed:"
+
+func (xorSealer) Seal(buf []byte) ([]byte, error) {
+	sealed := []byte(xorSealerPrefix)
+	for _, b := range buf {
+		sealed = append(sealed, ^b)
+	}
+	return sealed, nil
+}
+
+func (xorSealer) Open(buf []byte) ([]byte, error) {
+	if !strings.HasPrefix(string(buf), xorSealerPrefix) {
+		return buf, nil
+	}
+	plain := []byte{}
+	for _, b := range buf[len(xorSealerPrefix):] {
+		plain = append(plain, ^b)
+	}
+	return plain, nil
+}
+
+func TestKfDef_WriteToFileSealed(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	testFile := path.Join(testDir, "app.yaml")
+	if err := ioutil.WriteFile(testFile, []byte("metadata:\n  name: old\n"), 0644); err != nil {
+		t.Fatalf("Could not write file; %v", err)
+	}
+
+	SetConfigSealer(xorSealer{})
+	defer SetConfigSealer(nil)
+
+	d := &KfDef{}
+	d.Name = "kf-app"
+	if err := d.WriteToFile(testFile); err != nil {
+		t.Fatalf("Could not write file; %v", err)
+	}
+	buf, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("Could not read file; %v", err)
+	}
+	if strings.Contains(string(buf), "kf-app") {
+		t.Errorf("The sealed file contains the plain text: %s", buf)
+	}
+	if info, err := os.Stat(testFile); err != nil {
+		t.Errorf("Could not stat %v; %v", testFile, err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("Sealed file has mode %v; want 0600", info.Mode())
+	}
+
+	loaded, err := LoadKFDefFromURI(testFile)
+	if err != nil {
+		t.Fatalf("Could not load the sealed file; %v", err)
+	}
+	if loaded.Name != "kf-app" {
+		t.Errorf("Loaded %v; want kf-app", loaded.Name)
+	}
+}
+
 type FakePluginSpec struct {
 	Param     string `json:"param,omitempty"`
 	BoolParam bool   `json:"boolParam,omitempty"`
@@ -298,6 +376,66 @@ func TestKfDef_GetPluginSpec(t *testing.T) {
 	}
 }
 
+// typedPluginName is the plugin whose spec is registered as FakePluginSpec.
+const typedPluginName = "typedplugin"
+
+func init() {
+	RegisterPluginSpec(typedPluginName, func() PluginSpec { return &FakePluginSpec{} })
+}
+
+func (s *FakePluginSpec) IsValid() (bool, string) {
+	if s.Param == "" {
+		return false, "param is required"
+	}
+	return true, ""
+}
+
+func TestKfDef_GetTypedPluginSpec(t *testing.T) {
+	d := &KfDef{}
+	if err := d.SetPluginSpec(typedPluginName, &FakePluginSpec{Param: "someparam"}); err != nil {
+		t.Fatalf("Could not set plugin spec; error %v", err)
+	}
+	if err := d.SetPluginSpec("untypedplugin", map[string]string{"other": "value"}); err != nil {
+		t.Fatalf("Could not set plugin spec; error %v", err)
+	}
+
+	actual, err := d.GetTypedPluginSpec(typedPluginName)
+	if err != nil {
+		t.Fatalf("Could not get typed plugin spec; error %v", err)
+	}
+	if !reflect.DeepEqual(actual, &FakePluginSpec{Param: "someparam"}) {
+		t.Errorf("GetTypedPluginSpec: got %v", actual)
+	}
+	if _, err := d.GetTypedPluginSpec("untypedplugin"); !IsUnregisteredPlugin(err) {
+		t.Errorf("GetTypedPluginSpec of an unregistered plugin: got %v; want UnregisteredPlugin", err)
+	}
+	specs, err := d.TypedPluginSpecs()
+	if err != nil || len(specs) != 1 || specs[typedPluginName] == nil {
+		t.Errorf("TypedPluginSpecs: got %v, %v; want only %v", specs, err, typedPluginName)
+	}
+	if isValid, msg := d.ValidatePluginSpecs(); !isValid {
+		t.Errorf("ValidatePluginSpecs: got %v", msg)
+	}
+
+	// A misspelt field is an error rather than being dropped.
+	if err := d.SetPluginSpec(typedPluginName, map[string]string{"parm": "someparam"}); err != nil {
+		t.Fatalf("Could not set plugin spec; error %v", err)
+	}
+	if _, err := d.GetTypedPluginSpec(typedPluginName); err == nil {
+		t.Errorf("GetTypedPluginSpec of a spec with an unknown field: want an error")
+	}
+	if isValid, _ := d.ValidatePluginSpecs(); isValid {
+		t.Errorf("ValidatePluginSpecs of a spec with an unknown field: want invalid")
+	}
+
+	if err := d.SetPluginSpec(typedPluginName, &FakePluginSpec{BoolParam: true}); err != nil {
+		t.Fatalf("Could not set plugin spec; error %v", err)
+	}
+	if isValid, _ := d.ValidatePluginSpecs(); isValid {
+		t.Errorf("ValidatePluginSpecs of a spec without param: want invalid")
+	}
+}
+
 func TestKfDef_SetPluginSpec(t *testing.T) {
 	// Test that we can properly parse the gcp structs.
 	type testCase struct {
@@ -786,6 +924,661 @@ func TestKfDef_GetApplicationParameter(t *testing.T) {
 }
 
 // Pformat returns a pretty format output of any value.
+func TestKfDef_SetApplicationStatus(t *testing.T) {
+	d := &KfDef{}
+	d.SetApplicationStatus(ApplicationStatus{Name: "jupyter", State: ApplicationFailed, Message: "timeout"})
+	d.SetApplicationStatus(ApplicationStatus{Name: "katib", State: ApplicationFailed})
+	d.SetApplicationStatus(ApplicationStatus{Name: "pipelines", State: ApplicationSkipped})
+
+	if failed := d.FailedApplications(); !reflect.DeepEqual(failed, []string{"jupyter", "katib"}) {
+		t.Errorf("Got failed applications %v; want [jupyter katib]", failed)
+	}
+
+	// A later status overwrites the earlier one.
+	d.SetApplicationStatus(ApplicationStatus{Name: "jupyter", State: ApplicationApplied})
+	if len(d.Status.Applications) != 3 {
+		t.Errorf("Got %v application statuses; want 3", len(d.Status.Applications))
+	}
+	if failed := d.FailedApplications(); !reflect.DeepEqual(failed, []string{"katib"}) {
+		t.Errorf("Got failed applications %v; want [katib]", failed)
+	}
+}
+
+func TestKfDef_RecordResource(t *testing.T) {
+	d := &KfDef{}
+	created := metav1.NewTime(time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC))
+	d.RecordResource(InventoryResource{Kind: "container.v1.cluster", Name: "kf-app", Project: "acme", CreationTime: created})
+	d.RecordResource(InventoryResource{Kind: "Deployment", APIVersion: "apps/v1", Name: "jupyter", Namespace: "kubeflow", Source: "jupyter"})
+	if len(d.Status.Inventory) != 2 || d.Status.Inventory[1].CreationTime.IsZero() {
+		t.Fatalf("Got inventory %v; want the cluster and the deployment with a creation time", d.Status.Inventory)
+	}
+
+	// Recording a resource again keeps its creation time.
+	d.RecordResource(InventoryResource{Kind: "container.v1.cluster", Name: "kf-app", Project: "acme", Source: "kf-app"})
+	if len(d.Status.Inventory) != 2 {
+		t.Errorf("Got %v resources; want 2", len(d.Status.Inventory))
+	}
+	if r := d.Status.Inventory[0]; !r.CreationTime.Equal(&created) || r.Source != "kf-app" {
+		t.Errorf("Got %+v; want the original creation time and the new source", r)
+	}
+
+	// The same name in another namespace is another resource.
+	d.RecordResource(InventoryResource{Kind: "Deployment", APIVersion: "apps/v1", Name: "jupyter", Namespace: "team-a"})
+	if len(d.Status.Inventory) != 3 {
+		t.Errorf("Got %v resources; want 3", len(d.Status.Inventory))
+	}
+}
+
+func TestKfDef_RelocateNamespace(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Namespaces *NamespaceLayout
+		Expected   map[string]string
+		Targets    []string
+	}
+
+	cases := []testCase{
+		{
+			Name: "no-layout",
+			Expected: map[string]string{
+				ManifestsNamespace:        "kf",
+				ManifestsIstioNamespace:   ManifestsIstioNamespace,
+				ManifestsKnativeNamespace: ManifestsKnativeNamespace,
+				"other":                   "other",
+			},
+			Targets: []string{"kf"},
+		},
+		{
+			Name:       "single-namespace",
+			Namespaces: &NamespaceLayout{},
+			Expected: map[string]string{
+				ManifestsNamespace:        "kf",
+				ManifestsIstioNamespace:   "kf",
+				ManifestsKnativeNamespace: "kf",
+				"other":                   "other",
+			},
+			Targets: []string{"kf"},
+		},
+		{
+			Name:       "multi-namespace",
+			Namespaces: &NamespaceLayout{Istio: "kf-istio", Knative: "kf-knative"},
+			Expected: map[string]string{
+				ManifestsNamespace:        "kf",
+				ManifestsIstioNamespace:   "kf-istio",
+				ManifestsKnativeNamespace: "kf-knative",
+			},
+			Targets: []string{"kf", "kf-istio", "kf-knative"},
+		},
+	}
+
+	for _, c := range cases {
+		d := &KfDef{}
+		d.Namespace = "kf"
+		d.Spec.Namespaces = c.Namespaces
+		for ns, expected := range c.Expected {
+			if actual := d.RelocateNamespace(ns); actual != expected {
+				t.Errorf("Case %v: RelocateNamespace(%v) got %v; want %v", c.Name, ns, actual, expected)
+			}
+		}
+		if actual := d.TargetNamespaces(); !reflect.DeepEqual(actual, c.Targets) {
+			t.Errorf("Case %v: TargetNamespaces got %v; want %v", c.Name, actual, c.Targets)
+		}
+	}
+}
+
+func TestKfDef_IsValidNamespaces(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Namespace = "kf"
+	d.Spec.PackageManager = "kustomize"
+	d.Spec.Namespaces = &NamespaceLayout{Istio: "Istio_System"}
+	if isValid, _ := d.IsValid(); isValid {
+		t.Errorf("IsValid should reject the invalid istio namespace")
+	}
+	d.Spec.Namespaces.Istio = "kf-istio"
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+}
+
+func TestKfDef_Instance(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "staging"
+	d.Namespace = "kf-staging"
+	d.Spec.PackageManager = "kustomize"
+	if d.InstancePrefix() != "" || d.IngressGatewayLabel() != ManifestsIngressGatewayLabel || d.SharesCRDs() {
+		t.Errorf("A deployment without an instance must not be scoped")
+	}
+
+	d.Spec.Instance = &InstanceScope{}
+	if actual := d.InstancePrefix(); actual != "staging-" {
+		t.Errorf("InstancePrefix got %v; want staging-", actual)
+	}
+	if actual := d.IngressGatewayLabel(); actual != "staging-ingressgateway" {
+		t.Errorf("IngressGatewayLabel got %v; want staging-ingressgateway", actual)
+	}
+	if !d.SharesCRDs() {
+		t.Errorf("SharesCRDs should default to true for an instance")
+	}
+	// The istio and knative components are deployed to the namespace of the instance.
+	if actual := d.RelocateNamespace(ManifestsIstioNamespace); actual != "kf-staging" {
+		t.Errorf("RelocateNamespace(%v) got %v; want kf-staging", ManifestsIstioNamespace, actual)
+	}
+	if actual := d.TargetNamespaces(); !reflect.DeepEqual(actual, []string{"kf-staging"}) {
+		t.Errorf("TargetNamespaces got %v; want [kf-staging]", actual)
+	}
+
+	d.Spec.Instance = &InstanceScope{NamePrefix: "stg-", IngressGateway: "stg-gateway", CRDStrategy: CRDStrategyOwner}
+	if d.InstancePrefix() != "stg-" || d.IngressGatewayLabel() != "stg-gateway" || d.SharesCRDs() {
+		t.Errorf("The options of the instance should override the defaults; got %v, %v, %v",
+			d.InstancePrefix(), d.IngressGatewayLabel(), d.SharesCRDs())
+	}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+	d.Spec.Instance.CRDStrategy = "elect"
+	if isValid, _ := d.IsValid(); isValid {
+		t.Errorf("IsValid should reject the unknown CRD strategy")
+	}
+	d.Spec.Instance = &InstanceScope{NamePrefix: "Staging_"}
+	if isValid, _ := d.IsValid(); isValid {
+		t.Errorf("IsValid should reject the invalid name prefix")
+	}
+}
+
+// newTestCABundle returns a self signed PEM encoded CA certificate.
+func newTestCABundle(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate a key; %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Acme Proxy CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create a certificate; %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestKfDef_CABundle(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	bundle := newTestCABundle(t)
+	d.Spec.CABundle = bundle + bundle
+	certs, err := d.CABundleCertificates()
+	if err != nil || len(certs) != 2 || certs[0].Subject.CommonName != "Acme Proxy CA" {
+		t.Errorf("CABundleCertificates got %v certificates; error %v", len(certs), err)
+	}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+
+	invalid := []string{
+		"not a certificate",
+		bundle + "trailing data",
+		strings.Replace(bundle, "CERTIFICATE", "PRIVATE KEY", -1),
+	}
+	for _, b := range invalid {
+		d.Spec.CABundle = b
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("IsValid should reject the CA bundle %q", b)
+		}
+	}
+}
+
+func TestKfDef_SetPlacement(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	d.SetPlacement(WorkloadPlacement{Name: "preemptible", Applications: []string{"tf-job-operator"}})
+	d.SetPlacement(WorkloadPlacement{Name: "gpu", Applications: []string{"tf-job-operator", "pytorch-operator"}})
+	d.SetPlacement(WorkloadPlacement{Name: "preemptible", Applications: []string{"katib"}})
+
+	if len(d.Spec.Placements) != 2 {
+		t.Fatalf("Got %v placements; want 2", len(d.Spec.Placements))
+	}
+	names := func(placements []WorkloadPlacement) []string {
+		n := []string{}
+		for _, p := range placements {
+			n = append(n, p.Name)
+		}
+		return n
+	}
+	if actual := names(d.PlacementsFor("tf-job-operator")); !reflect.DeepEqual(actual, []string{"gpu"}) {
+		t.Errorf("PlacementsFor(tf-job-operator) got %v; want [gpu]", actual)
+	}
+	if actual := names(d.PlacementsFor("katib")); !reflect.DeepEqual(actual, []string{"preemptible"}) {
+		t.Errorf("PlacementsFor(katib) got %v; want [preemptible]", actual)
+	}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+
+	d.Spec.Placements = append(d.Spec.Placements, WorkloadPlacement{Name: "gpu"})
+	if isValid, _ := d.IsValid(); isValid {
+		t.Errorf("IsValid should reject placements with the same name")
+	}
+
+	d.RemovePlacement("gpu")
+	d.RemovePlacement("preemptible")
+	if d.Spec.Placements != nil {
+		t.Errorf("Got placements %v after removing them all; want nil", d.Spec.Placements)
+	}
+}
+
+func TestKfDef_IsValidProfiles(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Admins   []string
+		Profiles []TeamProfile
+		IsValid  bool
+	}
+
+	cases := []testCase{
+		{
+			Name:   "valid",
+			Admins: []string{"admin@acme.com"},
+			Profiles: []TeamProfile{
+				{
+					Name:  "team-a",
+					Owner: "lead@acme.com",
+					Contributors: []ProfileContributor{
+						{User: "dev@acme.com"},
+						{User: "analyst@acme.com", Role: ContributorRoleView},
+					},
+				},
+			},
+			IsValid: true,
+		},
+		{
+			Name:    "empty-admin",
+			Admins:  []string{""},
+			IsValid: false,
+		},
+		{
+			Name:     "invalid-name",
+			Profiles: []TeamProfile{{Name: "Team_A", Owner: "lead@acme.com"}},
+			IsValid:  false,
+		},
+		{
+			Name: "duplicate-name",
+			Profiles: []TeamProfile{
+				{Name: "team-a", Owner: "lead@acme.com"},
+				{Name: "team-a", Owner: "other@acme.com"},
+			},
+			IsValid: false,
+		},
+		{
+			Name:     "no-owner",
+			Profiles: []TeamProfile{{Name: "team-a"}},
+			IsValid:  false,
+		},
+		{
+			Name: "unknown-role",
+			Profiles: []TeamProfile{
+				{
+					Name:         "team-a",
+					Owner:        "lead@acme.com",
+					Contributors: []ProfileContributor{{User: "dev@acme.com", Role: "owner"}},
+				},
+			},
+			IsValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		d := &KfDef{}
+		d.Name = "kf-app"
+		d.Spec.PackageManager = "kustomize"
+		d.Spec.Admins = c.Admins
+		d.Spec.Profiles = c.Profiles
+		if isValid, msg := d.IsValid(); isValid != c.IsValid {
+			t.Errorf("Case %v: IsValid got %v (%v); want %v", c.Name, isValid, msg, c.IsValid)
+		}
+	}
+}
+
+func TestKfDef_Hooks(t *testing.T) {
+	approval := Hook{Name: "approval", Phase: HookPreProvision, Webhook: &WebhookHook{URL: "https://approvals.acme.com/kubeflow"}}
+	configure := Hook{Name: "configure", Phase: HookPostApply, Job: &batchv1.JobSpec{}}
+	notify := Hook{Name: "notify", Phase: HookPostApply, Webhook: &WebhookHook{URL: "http://chat.acme.com/hook"}}
+
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	d.Spec.Hooks = []Hook{approval, configure, notify}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+	if actual := d.HooksFor(HookPostApply); !reflect.DeepEqual(actual, []Hook{configure, notify}) {
+		t.Errorf("HooksFor(%v) got %v; want [configure notify]", HookPostApply, actual)
+	}
+	if actual := d.HooksFor(HookPreApply); len(actual) != 0 {
+		t.Errorf("HooksFor(%v) got %v; want none", HookPreApply, actual)
+	}
+
+	invalid := map[string]Hook{
+		"unknown-phase":      {Name: "h", Phase: "pre-delete", Webhook: &WebhookHook{URL: "https://acme.com"}},
+		"no-action":          {Name: "h", Phase: HookPreApply},
+		"both-actions":       {Name: "h", Phase: HookPreApply, Webhook: &WebhookHook{URL: "https://acme.com"}, Job: &batchv1.JobSpec{}},
+		"invalid-url":        {Name: "h", Phase: HookPreApply, Webhook: &WebhookHook{URL: "acme.com"}},
+		"job-before-cluster": {Name: "h", Phase: HookPreProvision, Job: &batchv1.JobSpec{}},
+		"duplicate-name":     {Name: "approval", Phase: HookPreApply, Webhook: &WebhookHook{URL: "https://acme.com"}},
+	}
+	for name, h := range invalid {
+		d.Spec.Hooks = []Hook{approval, h}
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("Case %v: IsValid got true; want false", name)
+		}
+	}
+}
+
+func TestKfDef_Features(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	d.Spec.Features = []string{"multi-user", "kfserving"}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+	if !d.FeatureEnabled("kfserving") || d.FeatureEnabled("kfserving-beta") {
+		t.Errorf("FeatureEnabled doesn't match the features %v", d.Spec.Features)
+	}
+
+	for _, features := range [][]string{{"multi-user", "multi-user"}, {""}} {
+		d.Spec.Features = features
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("IsValid of features %q got true; want false", features)
+		}
+	}
+}
+
+func TestKfDef_IsValidReadiness(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	d.Spec.Applications = []Application{{
+		Name: "jupyter",
+		Readiness: &Readiness{
+			Checks: []ReadinessCheck{
+				{Deployment: "jupyter-web-app", Namespace: "kubeflow"},
+				{URL: "http://jupyter-web-app.kubeflow.svc.cluster.local/healthz"},
+			},
+			TimeoutSeconds: 300,
+		},
+	}}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+
+	invalid := []Readiness{
+		{TimeoutSeconds: -1},
+		{Checks: []ReadinessCheck{{}}},
+		{Checks: []ReadinessCheck{{Deployment: "jupyter-web-app", Job: "spartakus-init"}}},
+		{Checks: []ReadinessCheck{{URL: "jupyter-web-app:80/healthz"}}},
+	}
+	for _, r := range invalid {
+		r := r
+		d.Spec.Applications[0].Readiness = &r
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("IsValid of readiness %+v got true; want false", r)
+		}
+	}
+}
+
+func TestKfDef_IsValidIstio(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	d.Spec.Istio = &IstioConfig{
+		MTLS:                IstioMTLSStrict,
+		IngressGatewayType:  v1.ServiceTypeNodePort,
+		InjectionNamespaces: []string{"serving"},
+	}
+	if isValid, _ := d.IsValid(); isValid {
+		t.Errorf("IsValid should require useIstio")
+	}
+	d.Spec.UseIstio = true
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+
+	invalid := []IstioConfig{
+		{MTLS: "DISABLE"},
+		{IngressGatewayType: v1.ServiceTypeExternalName},
+		{InjectionNamespaces: []string{"Serving"}},
+	}
+	for _, i := range invalid {
+		i := i
+		d.Spec.Istio = &i
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("IsValid of istio %+v got true; want false", i)
+		}
+	}
+}
+
+func TestKfDef_IsValidExternalStorage(t *testing.T) {
+	literal := func(name string) Secret {
+		return Secret{Name: name, SecretSource: &SecretSource{LiteralSource: &LiteralSource{Value: name}}}
+	}
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	d.Spec.Secrets = []Secret{literal("mysql-password"), literal("access-key"), literal("secret-key")}
+	d.Spec.ExternalStorage = &ExternalStorage{
+		Database: &ExternalDatabase{
+			User:           "kubeflow",
+			PasswordSecret: "mysql-password",
+			CloudSQL:       &CloudSQLInstance{},
+		},
+		ObjectStore: &ExternalObjectStore{
+			Bucket:          "kf-app-artifacts",
+			AccessKeySecret: "access-key",
+			SecretKeySecret: "secret-key",
+		},
+	}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+	if name := d.CloudSQLInstanceName(); name != "kf-app-mysql" {
+		t.Errorf("CloudSQLInstanceName: got %v; want kf-app-mysql", name)
+	}
+
+	invalid := []ExternalStorage{
+		{Database: &ExternalDatabase{User: "kubeflow", PasswordSecret: "mysql-password"}},
+		{Database: &ExternalDatabase{Host: "10.0.0.3", PasswordSecret: "mysql-password"}},
+		{Database: &ExternalDatabase{Host: "10.0.0.3", User: "kubeflow", PasswordSecret: "missing"}},
+		{Database: &ExternalDatabase{Host: "10.0.0.3", Port: 70000, User: "kubeflow", PasswordSecret: "mysql-password"}},
+		{ObjectStore: &ExternalObjectStore{AccessKeySecret: "access-key", SecretKeySecret: "secret-key"}},
+		{ObjectStore: &ExternalObjectStore{Bucket: "b", AccessKeySecret: "access-key"}},
+	}
+	for _, s := range invalid {
+		s := s
+		d.Spec.ExternalStorage = &s
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("IsValid of external storage %+v got true; want false", s)
+		}
+	}
+}
+
+func TestKfDef_IsValidTransformers(t *testing.T) {
+	replicas := FieldReplacement{Group: "apps", Version: "v1", Kind: "Deployment", Name: "centraldashboard",
+		Path: "/spec/replicas", Value: runtime.RawExtension{Raw: []byte("3")}}
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	d.Spec.Transformers = []KustomizeTransformer{
+		{Name: "team", NamePrefix: "ml-", CommonLabels: map[string]string{"team": "ml"}, Replacements: []FieldReplacement{replicas}},
+		{Name: "jupyter", Applications: []string{"jupyter-web-app"}, CommonLabels: map[string]string{"notebooks": "true"}},
+	}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Errorf("IsValid failed; %v", msg)
+	}
+	names := func(transformers []KustomizeTransformer) []string {
+		n := []string{}
+		for _, t := range transformers {
+			n = append(n, t.Name)
+		}
+		return n
+	}
+	if actual := names(d.TransformersFor("jupyter-web-app")); !reflect.DeepEqual(actual, []string{"team", "jupyter"}) {
+		t.Errorf("TransformersFor(jupyter-web-app) got %v; want [team jupyter]", actual)
+	}
+	if actual := names(d.TransformersFor("katib")); !reflect.DeepEqual(actual, []string{"team"}) {
+		t.Errorf("TransformersFor(katib) got %v; want [team]", actual)
+	}
+
+	noPath, noValue := replicas, replicas
+	noPath.Path = "spec.replicas"
+	noValue.Value = runtime.RawExtension{}
+	invalid := []KustomizeTransformer{
+		{},
+		{Name: "prefix", NamePrefix: "ML_"},
+		{Name: "long-prefix", NamePrefix: "a-very-long-name-prefix-"},
+		{Name: "labels", CommonLabels: map[string]string{"team": "machine learning"}},
+		{Name: "no-kind", Replacements: []FieldReplacement{{Version: "v1", Name: "centraldashboard", Path: "/spec/replicas"}}},
+		{Name: "no-path", Replacements: []FieldReplacement{noPath}},
+		{Name: "no-value", Replacements: []FieldReplacement{noValue}},
+	}
+	for _, tr := range invalid {
+		d.Spec.Transformers = []KustomizeTransformer{tr}
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("IsValid of transformer %+v got true; want false", tr)
+		}
+	}
+}
+
+func TestKfDef_MaintenanceWindows(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf-app"
+	d.Spec.PackageManager = "kustomize"
+	if !d.InMaintenanceWindow(time.Now()) {
+		t.Errorf("InMaintenanceWindow without windows got false; want true")
+	}
+
+	// Saturdays and Sundays from 23:00 to 03:00 in New York.
+	d.Spec.MaintenanceWindows = []MaintenanceWindow{{
+		Days:     []string{"Saturday", "Sunday"},
+		Start:    "23:00",
+		Duration: metav1.Duration{Duration: 4 * time.Hour},
+		TimeZone: "America/New_York",
+	}}
+	if isValid, msg := d.IsValid(); !isValid {
+		t.Fatalf("IsValid failed; %v", msg)
+	}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Could not load the time zone; %v", err)
+	}
+	sundayNight := time.Date(2019, time.October, 13, 23, 0, 0, 0, ny)
+	cases := []struct {
+		t    time.Time
+		in   bool
+		next time.Time
+	}{
+		// Friday at noon.
+		{t: time.Date(2019, time.October, 11, 12, 0, 0, 0, ny), in: false, next: time.Date(2019, time.October, 12, 23, 0, 0, 0, ny)},
+		// Sunday at 1:30am in the window opened on Saturday.
+		{t: time.Date(2019, time.October, 13, 1, 30, 0, 0, ny), in: true, next: time.Date(2019, time.October, 13, 1, 30, 0, 0, ny)},
+		// Sunday at noon.
+		{t: time.Date(2019, time.October, 13, 12, 0, 0, 0, ny), in: false, next: sundayNight},
+		// Monday at 4am after the window closed.
+		{t: time.Date(2019, time.October, 14, 4, 0, 0, 0, ny), in: false, next: time.Date(2019, time.October, 19, 23, 0, 0, 0, ny)},
+	}
+	for _, c := range cases {
+		if in := d.InMaintenanceWindow(c.t.UTC()); in != c.in {
+			t.Errorf("InMaintenanceWindow(%v) got %v; want %v", c.t, in, c.in)
+		}
+		if next := d.NextMaintenanceWindow(c.t.UTC()); !next.Equal(c.next) {
+			t.Errorf("NextMaintenanceWindow(%v) got %v; want %v", c.t, next, c.next)
+		}
+	}
+
+	invalid := []MaintenanceWindow{
+		{Start: "2am", Duration: metav1.Duration{Duration: time.Hour}},
+		{Start: "02:00", Duration: metav1.Duration{Duration: time.Minute}},
+		{Start: "02:00", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Mars/Olympus_Mons"},
+		{Start: "02:00", Duration: metav1.Duration{Duration: time.Hour}, Days: []string{"Sat"}},
+	}
+	for _, w := range invalid {
+		d.Spec.MaintenanceWindows = []MaintenanceWindow{w}
+		if isValid, _ := d.IsValid(); isValid {
+			t.Errorf("IsValid of maintenance window %+v got true; want false", w)
+		}
+	}
+}
+
+func TestKfDef_Validate(t *testing.T) {
+	d := &KfDef{}
+	d.Name = "kf_app"
+	d.Spec.AdoptionPolicy = "Merge"
+	d.Spec.Hooks = []Hook{{Name: "notify", Phase: HookPostApply, Webhook: &WebhookHook{URL: "ftp://acme.com"}}}
+	d.Spec.Profiles = []TeamProfile{{Name: "team-a", Contributors: []ProfileContributor{{User: "dev@acme.com", Role: "owner"}}}}
+	d.Spec.ExistingPlatform = &ExistingPlatform{Mode: "Always"}
+	d.Spec.Gpu = &GpuConfig{NodeLabels: map[string]string{"gpu": "nvidia tesla"}, Driver: &GpuDriver{NodeOS: "rhel"}}
+
+	expected := []string{
+		"metadata.name",
+		"spec.packageManager",
+		"spec.adoptionPolicy",
+		"spec.hooks[notify].webhook.url",
+		"spec.existingPlatform.mode",
+		"spec.gpu.nodeLabels",
+		"spec.gpu.driver.nodeOS",
+		"spec.profiles[team-a].owner",
+		"spec.profiles[team-a].contributors[0].role",
+	}
+	failures := d.Validate()
+	if len(failures) != len(expected) {
+		t.Fatalf("Validate got %v; want failures of %v", failures, expected)
+	}
+	for i, f := range failures {
+		if f.Field != expected[i] || f.Message == "" {
+			t.Errorf("Failure %v: got %+v; want field %v", i, f, expected[i])
+		}
+	}
+
+	// IsValid reports the first failure.
+	if isValid, msg := d.IsValid(); isValid || msg != failures[0].Message {
+		t.Errorf("IsValid got %v %q; want false %q", isValid, msg, failures[0].Message)
+	}
+}
+
+func TestParseManifestSink(t *testing.T) {
+	type testCase struct {
+		sink   string
+		scheme string
+		bucket string
+		prefix string
+	}
+	testCases := []testCase{
+		{sink: "gs://kf-archive/manifests/", scheme: ManifestSinkGCS, bucket: "kf-archive", prefix: "manifests"},
+		{sink: "s3://kf-archive", scheme: ManifestSinkS3, bucket: "kf-archive", prefix: ""},
+		{sink: "/var/lib/manifests/", scheme: "", bucket: "", prefix: "/var/lib/manifests"},
+	}
+	for _, c := range testCases {
+		scheme, bucket, prefix, err := ParseManifestSink(c.sink)
+		if err != nil || scheme != c.scheme || bucket != c.bucket || prefix != c.prefix {
+			t.Errorf("ParseManifestSink(%v): got %v, %v, %v, %v; want %v, %v, %v", c.sink, scheme, bucket, prefix, err,
+				c.scheme, c.bucket, c.prefix)
+		}
+	}
+
+	for _, sink := range []string{"gs://", "s3:///manifests", "manifests", "https://kf-archive/manifests"} {
+		if err := ValidateManifestSink(sink); err == nil {
+			t.Errorf("ValidateManifestSink(%v): want an error", sink)
+		}
+	}
+}
+
 func Pformat(value interface{}) (string, error) {
 	if s, ok := value.(string); ok {
 		return s, nil
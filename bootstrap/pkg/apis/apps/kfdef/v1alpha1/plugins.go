@@ -0,0 +1,155 @@
+// Copyright 2019 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+)
+
+// PluginSpec is implemented by the Go types of the specs of the plugins in KfDef.Spec.Plugins.
+type PluginSpec interface {
+	// IsValid returns true if the spec is a valid and complete spec.
+	// If false it will also return a string providing a message about why its invalid.
+	IsValid() (bool, string)
+}
+
+var (
+	pluginSpecsMux sync.Mutex
+	// pluginSpecs maps the names of the plugins to functions returning a new spec of their type.
+	pluginSpecs = map[string]func() PluginSpec{}
+)
+
+// RegisterPluginSpec registers the type of the spec of the named plugin. Plugins register their
+// spec in an init function so the specs in a KfDef are decoded to their type.
+func RegisterPluginSpec(pluginName string, newSpec func() PluginSpec) {
+	pluginSpecsMux.Lock()
+	defer pluginSpecsMux.Unlock()
+	if _, ok := pluginSpecs[pluginName]; ok {
+		panic(fmt.Sprintf("The spec of plugin %v is already registered", pluginName))
+	}
+	pluginSpecs[pluginName] = newSpec
+}
+
+// RegisteredPlugins returns the names of the plugins with a registered spec.
+func RegisteredPlugins() []string {
+	pluginSpecsMux.Lock()
+	defer pluginSpecsMux.Unlock()
+	names := []string{}
+	for name := range pluginSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newPluginSpec returns a new spec of the registered type of the named plugin.
+func newPluginSpec(pluginName string) (PluginSpec, bool) {
+	pluginSpecsMux.Lock()
+	defer pluginSpecsMux.Unlock()
+	newSpec, ok := pluginSpecs[pluginName]
+	if !ok {
+		return nil, false
+	}
+	return newSpec(), true
+}
+
+// UnregisteredPlugin is returned when a typed spec is requested for a plugin without a registered spec.
+type UnregisteredPlugin struct {
+	Name string
+}
+
+func (e *UnregisteredPlugin) Error() string {
+	return fmt.Sprintf("Plugin %v doesn't have a registered spec; registered plugins are %v", e.Name, RegisteredPlugins())
+}
+
+func IsUnregisteredPlugin(e error) bool {
+	if e == nil {
+		return false
+	}
+	_, ok := e.(*UnregisteredPlugin)
+	return ok
+}
+
+// GetTypedPluginSpec returns the spec of the named plugin decoded to its registered type.
+// Unlike GetPluginSpec fields which aren't in the type are an error so that a misspelt field is
+// reported when the KfDef is submitted rather than silently ignored.
+func (d *KfDef) GetTypedPluginSpec(pluginName string) (PluginSpec, error) {
+	for _, p := range d.Spec.Plugins {
+		if p.Name != pluginName {
+			continue
+		}
+		s, ok := newPluginSpec(pluginName)
+		if !ok {
+			return nil, &UnregisteredPlugin{Name: pluginName}
+		}
+		if p.Spec == nil {
+			return s, nil
+		}
+
+		specBytes, err := json.Marshal(p.Spec)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(specBytes))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(s); err != nil {
+			return nil, errors.Wrapf(err, "the spec of plugin %v is invalid", pluginName)
+		}
+		return s, nil
+	}
+
+	return nil, NewPluginNotFound(pluginName)
+}
+
+// TypedPluginSpecs returns the specs of the plugins with a registered type keyed by the name of
+// the plugin. Plugins without a registered spec are omitted.
+func (d *KfDef) TypedPluginSpecs() (map[string]PluginSpec, error) {
+	specs := map[string]PluginSpec{}
+	for _, p := range d.Spec.Plugins {
+		s, err := d.GetTypedPluginSpec(p.Name)
+		if err != nil {
+			if IsUnregisteredPlugin(err) {
+				continue
+			}
+			return nil, err
+		}
+		specs[p.Name] = s
+	}
+	return specs, nil
+}
+
+// ValidatePluginSpecs returns false and a message if the spec of a plugin with a registered type
+// can't be decoded or isn't valid.
+func (d *KfDef) ValidatePluginSpecs() (bool, string) {
+	specs, err := d.TypedPluginSpecs()
+	if err != nil {
+		return false, err.Error()
+	}
+	for _, p := range d.Spec.Plugins {
+		s, ok := specs[p.Name]
+		if !ok {
+			continue
+		}
+		if isValid, msg := s.IsValid(); !isValid {
+			return false, fmt.Sprintf("The spec of plugin %v is invalid; %v", p.Name, msg)
+		}
+	}
+	return true, ""
+}
@@ -22,6 +22,8 @@ package v1alpha1
 
 import (
 	config "github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -96,6 +98,11 @@ func (in *Application) DeepCopyInto(out *Application) {
 		*out = new(KustomizeConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Readiness != nil {
+		in, out := &in.Readiness, &out.Readiness
+		*out = new(Readiness)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -109,6 +116,62 @@ func (in *Application) DeepCopy() *Application {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApplicationStatus) DeepCopyInto(out *ApplicationStatus) {
+	*out = *in
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApplicationStatus.
+func (in *ApplicationStatus) DeepCopy() *ApplicationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ApplicationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateStatus) DeepCopyInto(out *CertificateStatus) {
+	*out = *in
+	if in.Domains != nil {
+		in, out := &in.Domains, &out.Domains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.CreationTime.DeepCopyInto(&out.CreationTime)
+	in.ExpectedReadyTime.DeepCopyInto(&out.ExpectedReadyTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateStatus.
+func (in *CertificateStatus) DeepCopy() *CertificateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudSQLInstance) DeepCopyInto(out *CloudSQLInstance) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudSQLInstance.
+func (in *CloudSQLInstance) DeepCopy() *CloudSQLInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudSQLInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvSource) DeepCopyInto(out *EnvSource) {
 	*out = *in
@@ -125,6 +188,181 @@ func (in *EnvSource) DeepCopy() *EnvSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalDatabase) DeepCopyInto(out *ExternalDatabase) {
+	*out = *in
+	if in.CloudSQL != nil {
+		in, out := &in.CloudSQL, &out.CloudSQL
+		*out = new(CloudSQLInstance)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalDatabase.
+func (in *ExternalDatabase) DeepCopy() *ExternalDatabase {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalDatabase)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalObjectStore) DeepCopyInto(out *ExternalObjectStore) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalObjectStore.
+func (in *ExternalObjectStore) DeepCopy() *ExternalObjectStore {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalObjectStore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExistingPlatform) DeepCopyInto(out *ExistingPlatform) {
+	*out = *in
+	if in.IngressGatewaySelector != nil {
+		in, out := &in.IngressGatewaySelector, &out.IngressGatewaySelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExistingPlatform.
+func (in *ExistingPlatform) DeepCopy() *ExistingPlatform {
+	if in == nil {
+		return nil
+	}
+	out := new(ExistingPlatform)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalStorage) DeepCopyInto(out *ExternalStorage) {
+	*out = *in
+	if in.Database != nil {
+		in, out := &in.Database, &out.Database
+		*out = new(ExternalDatabase)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ObjectStore != nil {
+		in, out := &in.ObjectStore, &out.ObjectStore
+		*out = new(ExternalObjectStore)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalStorage.
+func (in *ExternalStorage) DeepCopy() *ExternalStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldReplacement) DeepCopyInto(out *FieldReplacement) {
+	*out = *in
+	in.Value.DeepCopyInto(&out.Value)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldReplacement.
+func (in *FieldReplacement) DeepCopy() *FieldReplacement {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldReplacement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GpuConfig) DeepCopyInto(out *GpuConfig) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Driver != nil {
+		in, out := &in.Driver, &out.Driver
+		*out = new(GpuDriver)
+		**out = **in
+	}
+	if in.DevicePlugin != nil {
+		in, out := &in.DevicePlugin, &out.DevicePlugin
+		*out = new(GpuDevicePlugin)
+		**out = **in
+	}
+	if in.NodeLabels != nil {
+		in, out := &in.NodeLabels, &out.NodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuConfig.
+func (in *GpuConfig) DeepCopy() *GpuConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GpuConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GpuDevicePlugin) DeepCopyInto(out *GpuDevicePlugin) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuDevicePlugin.
+func (in *GpuDevicePlugin) DeepCopy() *GpuDevicePlugin {
+	if in == nil {
+		return nil
+	}
+	out := new(GpuDevicePlugin)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GpuDriver) DeepCopyInto(out *GpuDriver) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuDriver.
+func (in *GpuDriver) DeepCopy() *GpuDriver {
+	if in == nil {
+		return nil
+	}
+	out := new(GpuDriver)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HashedSource) DeepCopyInto(out *HashedSource) {
 	*out = *in
@@ -141,6 +379,86 @@ func (in *HashedSource) DeepCopy() *HashedSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Hook) DeepCopyInto(out *Hook) {
+	*out = *in
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookHook)
+		**out = **in
+	}
+	if in.Job != nil {
+		in, out := &in.Job, &out.Job
+		*out = new(batchv1.JobSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Hook.
+func (in *Hook) DeepCopy() *Hook {
+	if in == nil {
+		return nil
+	}
+	out := new(Hook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryResource) DeepCopyInto(out *InventoryResource) {
+	*out = *in
+	in.CreationTime.DeepCopyInto(&out.CreationTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryResource.
+func (in *InventoryResource) DeepCopy() *InventoryResource {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstanceScope) DeepCopyInto(out *InstanceScope) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstanceScope.
+func (in *InstanceScope) DeepCopy() *InstanceScope {
+	if in == nil {
+		return nil
+	}
+	out := new(InstanceScope)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IstioConfig) DeepCopyInto(out *IstioConfig) {
+	*out = *in
+	if in.InjectionNamespaces != nil {
+		in, out := &in.InjectionNamespaces, &out.InjectionNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IstioConfig.
+func (in *IstioConfig) DeepCopy() *IstioConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(IstioConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KfDef) DeepCopyInto(out *KfDef) {
 	*out = *in
@@ -250,6 +568,101 @@ func (in *KfDefSpec) DeepCopyInto(out *KfDefSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = new(NamespaceLayout)
+		**out = **in
+	}
+	if in.Instance != nil {
+		in, out := &in.Instance, &out.Instance
+		*out = new(InstanceScope)
+		**out = **in
+	}
+	if in.ResourceQuota != nil {
+		in, out := &in.ResourceQuota, &out.ResourceQuota
+		*out = new(corev1.ResourceQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LimitRange != nil {
+		in, out := &in.LimitRange, &out.LimitRange
+		*out = new(corev1.LimitRangeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Placements != nil {
+		in, out := &in.Placements, &out.Placements
+		*out = make([]WorkloadPlacement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Admins != nil {
+		in, out := &in.Admins, &out.Admins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Profiles != nil {
+		in, out := &in.Profiles, &out.Profiles
+		*out = make([]TeamProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]Hook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Features != nil {
+		in, out := &in.Features, &out.Features
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ManifestSinks != nil {
+		in, out := &in.ManifestSinks, &out.ManifestSinks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Istio != nil {
+		in, out := &in.Istio, &out.Istio
+		*out = new(IstioConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ManifestSigning != nil {
+		in, out := &in.ManifestSigning, &out.ManifestSigning
+		*out = new(ManifestSigning)
+		**out = **in
+	}
+	if in.ExternalStorage != nil {
+		in, out := &in.ExternalStorage, &out.ExternalStorage
+		*out = new(ExternalStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExistingPlatform != nil {
+		in, out := &in.ExistingPlatform, &out.ExistingPlatform
+		*out = new(ExistingPlatform)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Gpu != nil {
+		in, out := &in.Gpu, &out.Gpu
+		*out = new(GpuConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transformers != nil {
+		in, out := &in.Transformers, &out.Transformers
+		*out = make([]KustomizeTransformer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -280,6 +693,32 @@ func (in *KfDefStatus) DeepCopyInto(out *KfDefStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.Applications != nil {
+		in, out := &in.Applications, &out.Applications
+		*out = make([]ApplicationStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ManifestSignatures != nil {
+		in, out := &in.ManifestSignatures, &out.ManifestSignatures
+		*out = make([]ManifestSignature, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Inventory != nil {
+		in, out := &in.Inventory, &out.Inventory
+		*out = make([]InventoryResource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Certificate != nil {
+		in, out := &in.Certificate, &out.Certificate
+		*out = new(CertificateStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -449,6 +888,41 @@ func (in *KustomizeConfig) DeepCopy() *KustomizeConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizeTransformer) DeepCopyInto(out *KustomizeTransformer) {
+	*out = *in
+	if in.Applications != nil {
+		in, out := &in.Applications, &out.Applications
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CommonLabels != nil {
+		in, out := &in.CommonLabels, &out.CommonLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Replacements != nil {
+		in, out := &in.Replacements, &out.Replacements
+		*out = make([]FieldReplacement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizeTransformer.
+func (in *KustomizeTransformer) DeepCopy() *KustomizeTransformer {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizeTransformer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LibrarySpec) DeepCopyInto(out *LibrarySpec) {
 	*out = *in
@@ -481,6 +955,77 @@ func (in *LiteralSource) DeepCopy() *LiteralSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.Duration = in.Duration
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManifestSignature) DeepCopyInto(out *ManifestSignature) {
+	*out = *in
+	in.SignedTime.DeepCopyInto(&out.SignedTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManifestSignature.
+func (in *ManifestSignature) DeepCopy() *ManifestSignature {
+	if in == nil {
+		return nil
+	}
+	out := new(ManifestSignature)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManifestSigning) DeepCopyInto(out *ManifestSigning) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManifestSigning.
+func (in *ManifestSigning) DeepCopy() *ManifestSigning {
+	if in == nil {
+		return nil
+	}
+	out := new(ManifestSigning)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceLayout) DeepCopyInto(out *NamespaceLayout) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceLayout.
+func (in *NamespaceLayout) DeepCopy() *NamespaceLayout {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceLayout)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Plugin) DeepCopyInto(out *Plugin) {
 	*out = *in
@@ -518,6 +1063,59 @@ func (in *PluginNotFound) DeepCopy() *PluginNotFound {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileContributor) DeepCopyInto(out *ProfileContributor) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileContributor.
+func (in *ProfileContributor) DeepCopy() *ProfileContributor {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileContributor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Readiness) DeepCopyInto(out *Readiness) {
+	*out = *in
+	if in.Checks != nil {
+		in, out := &in.Checks, &out.Checks
+		*out = make([]ReadinessCheck, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Readiness.
+func (in *Readiness) DeepCopy() *Readiness {
+	if in == nil {
+		return nil
+	}
+	out := new(Readiness)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadinessCheck) DeepCopyInto(out *ReadinessCheck) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadinessCheck.
+func (in *ReadinessCheck) DeepCopy() *ReadinessCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadinessCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RegistriesConfigFile) DeepCopyInto(out *RegistriesConfigFile) {
 	*out = *in
@@ -708,3 +1306,75 @@ func (in *SecretSource) DeepCopy() *SecretSource {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TeamProfile) DeepCopyInto(out *TeamProfile) {
+	*out = *in
+	if in.Contributors != nil {
+		in, out := &in.Contributors, &out.Contributors
+		*out = make([]ProfileContributor, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TeamProfile.
+func (in *TeamProfile) DeepCopy() *TeamProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(TeamProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookHook) DeepCopyInto(out *WebhookHook) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookHook.
+func (in *WebhookHook) DeepCopy() *WebhookHook {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadPlacement) DeepCopyInto(out *WorkloadPlacement) {
+	*out = *in
+	if in.Applications != nil {
+		in, out := &in.Applications, &out.Applications
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadPlacement.
+func (in *WorkloadPlacement) DeepCopy() *WorkloadPlacement {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadPlacement)
+	in.DeepCopyInto(out)
+	return out
+}
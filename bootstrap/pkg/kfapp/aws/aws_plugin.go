@@ -4,6 +4,10 @@ import (
 	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
 )
 
+func init() {
+	kfdefs.RegisterPluginSpec(AwsPluginName, func() kfdefs.PluginSpec { return &AwsPluginSpec{} })
+}
+
 // AwsPlugin defines the extra data provided by the GCP Plugin in KfDef
 type AwsPluginSpec struct {
 	Auth *Auth `json:"auth,omitempty"`
@@ -44,6 +48,10 @@ type Coginito struct {
 // IsValid returns true if the spec is a valid and complete spec.
 // If false it will also return a string providing a message about why its invalid.
 func (plugin *AwsPluginSpec) IsValid() (bool, string) {
+	if plugin.Auth == nil {
+		return true, ""
+	}
+
 	basicAuthSet := plugin.Auth.BasicAuth != nil
 	oidcAuthSet := plugin.Auth.Oidc != nil
 	cognitoAuthSet := plugin.Auth.Cognito != nil
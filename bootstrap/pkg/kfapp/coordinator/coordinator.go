@@ -34,6 +34,7 @@ import (
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
 	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/minikube"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/simulate"
 	homedir "github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	valid "k8s.io/apimachinery/pkg/api/validation"
@@ -118,6 +119,8 @@ func getPlatform(kfdef *kfdefsv3.KfDef) (kftypesv3.Platform, error) {
 		return existing_arrikto.GetPlatform(kfdef)
 	case string(kftypesv3.AWS):
 		return aws.GetPlatform(kfdef)
+	case string(kftypesv3.SIMULATE):
+		return simulate.GetPlatform(kfdef), nil
 	default:
 		// TODO(https://github.com/kubeflow/kubeflow/issues/3520) Fix dynamic loading
 		// of platform plugins.
@@ -148,6 +151,8 @@ func getPackageManager(kfdef *kfdefsv3.KfDef) (kftypesv3.KfApp, error) {
 		return kustomize.GetKfApp(kfdef), nil
 	case kftypesv3.KSONNET:
 		return nil, fmt.Errorf("Support for ksonnet is no longer implemented")
+	case kftypesv3.SIMULATE:
+		return simulate.GetKfApp(kfdef), nil
 	default:
 		log.Infof("** loading %v.so for package manager %v **", kfdef.Spec.PackageManager, kfdef.Spec.PackageManager)
 		return kftypesv3.LoadKfApp(kfdef.Spec.PackageManager, kfdef)
@@ -739,6 +744,10 @@ func (kfapp *coordinator) Apply(resources kftypesv3.ResourceEnum) error {
 	k8s := func() error {
 		for packageManagerName, packageManager := range kfapp.PackageManagers {
 			packageManagerErr := packageManager.Apply(kftypesv3.K8S)
+			if kustomize.IsResourceConflict(packageManagerErr) || kustomize.IsIncompatibleCluster(packageManagerErr) {
+				// Preserve the type so callers can report the conflict or incompatibility.
+				return packageManagerErr
+			}
 			if packageManagerErr != nil {
 				return &kfapis.KfError{
 					Code: int(kfapis.INTERNAL_ERROR),
@@ -767,10 +776,14 @@ func (kfapp *coordinator) Apply(resources kftypesv3.ResourceEnum) error {
 				return err
 			}
 			if *p.EnableWorkloadIdentity {
-				return gcp.SetupDefaultNamespaceWorkloadIdentity()
+				err = gcp.SetupDefaultNamespaceWorkloadIdentity()
 			} else {
-				return gcp.ConfigPodDefault()
+				err = gcp.ConfigPodDefault()
+			}
+			if err != nil {
+				return err
 			}
+			return gcp.ProvisionProfileResources()
 		}
 	}
 
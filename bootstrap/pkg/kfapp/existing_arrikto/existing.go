@@ -137,7 +137,18 @@ func (existing *Existing) Apply(resources kftypesv3.ResourceEnum) error {
 	}
 
 	// Get Kubeflow and Dex Endpoints
-	kfEndpoint, oidcEndpoint, err := getEndpoints(kubeclient)
+	spec, err := existing.pluginSpec()
+	if err != nil {
+		return internalError(errors.WithStack(err))
+	}
+	if isValid, msg := spec.IsValid(); !isValid {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("The %v plugin spec is invalid; %v", ExistingArriktoPluginName, msg),
+		}
+	}
+
+	kfEndpoint, oidcEndpoint, err := getEndpoints(kubeclient, spec)
 	if err != nil {
 		return internalError(errors.WithStack(err))
 	}
@@ -156,7 +167,15 @@ func (existing *Existing) Apply(resources kftypesv3.ResourceEnum) error {
 	// Get the kubeflow user to add
 	// TODO(yanniszark): get this from a plugin struct eventually (https://github.com/kubeflow/kubeflow/issues/3529)
 	log.Info("Getting the Kubeflow User")
-	kubeflowUser, err := getKubeflowUser()
+	kfUserEmail := os.Getenv(KUBEFLOW_USER_EMAIL)
+	kfPassword := os.Getenv(kftypesv3.KUBEFLOW_PASSWORD)
+	if spec.User != nil {
+		kfUserEmail = spec.User.Email
+		if kfPassword, err = existing.GetSecret(spec.User.Password.Name); err != nil {
+			return internalError(errors.WithStack(err))
+		}
+	}
+	kubeflowUser, err := getKubeflowUser(kfUserEmail, kfPassword)
 	if err != nil {
 		return internalError(errors.WithStack(err))
 	}
@@ -262,9 +281,7 @@ type kfUser struct {
 	PasswordHash string
 }
 
-func getKubeflowUser() (*kfUser, error) {
-	kfUserEmail := os.Getenv(KUBEFLOW_USER_EMAIL)
-	kfPassword := os.Getenv(kftypesv3.KUBEFLOW_PASSWORD)
+func getKubeflowUser(kfUserEmail string, kfPassword string) (*kfUser, error) {
 	kfUsername := ""
 
 	if kfUserEmail == "" || kfPassword == "" {
@@ -287,14 +304,20 @@ func getKubeflowUser() (*kfUser, error) {
 	}, nil
 }
 
-func getEndpoints(kubeclient client.Client) (string, string, error) {
+func getEndpoints(kubeclient client.Client, spec *ExistingArriktoPluginSpec) (string, string, error) {
 
 	// Get Istio IngressGateway Service LoadBalancer IP
-	kfEndpoint := os.Getenv(KUBEFLOW_ENDPOINT)
+	kfEndpoint := spec.KubeflowEndpoint
+	if kfEndpoint == "" {
+		kfEndpoint = os.Getenv(KUBEFLOW_ENDPOINT)
+	}
 	if !strings.HasPrefix(kfEndpoint, "https") && kfEndpoint != "" {
 		return "", "", errors.New("KUBEFLOW_ENDPOINT address must start with https:// scheme.")
 	}
-	oidcEndpoint := os.Getenv(OIDC_ENDPOINT)
+	oidcEndpoint := spec.OIDCEndpoint
+	if oidcEndpoint == "" {
+		oidcEndpoint = os.Getenv(OIDC_ENDPOINT)
+	}
 	if !strings.HasPrefix(oidcEndpoint, "https") && oidcEndpoint != "" {
 		return "", "", errors.New("OIDC_ENDPOINT address must start with https:// scheme.")
 	}
@@ -0,0 +1,68 @@
+package existing_arrikto
+
+import (
+	"fmt"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"strings"
+)
+
+// ExistingArriktoPluginName is the name of the plugin in KfDef.Spec.Plugins.
+const ExistingArriktoPluginName = kftypesv3.EXISTING_ARRIKTO
+
+func init() {
+	kfdefs.RegisterPluginSpec(ExistingArriktoPluginName, func() kfdefs.PluginSpec { return &ExistingArriktoPluginSpec{} })
+}
+
+// ExistingArriktoPluginSpec defines the extra data provided by the existing_arrikto plugin in KfDef.
+// Fields which aren't set fall back to the environment variables read by earlier versions.
+type ExistingArriktoPluginSpec struct {
+	// KubeflowEndpoint is the https URL Kubeflow is served on; defaults to KUBEFLOW_ENDPOINT or
+	// the address of the istio ingress gateway.
+	KubeflowEndpoint string `json:"kubeflowEndpoint,omitempty"`
+
+	// OIDCEndpoint is the https URL of Dex; defaults to OIDC_ENDPOINT or port 5556 of the Kubeflow endpoint.
+	OIDCEndpoint string `json:"oidcEndpoint,omitempty"`
+
+	// User is the static user added to Dex; defaults to KUBEFLOW_USER_EMAIL and KUBEFLOW_PASSWORD.
+	User *StaticUser `json:"user,omitempty"`
+}
+
+// StaticUser is a user which can log in to Kubeflow with a password.
+type StaticUser struct {
+	Email    string            `json:"email,omitempty"`
+	Password *kfdefs.SecretRef `json:"password,omitempty"`
+}
+
+// IsValid returns true if the spec is a valid and complete spec.
+// If false it will also return a string providing a message about why its invalid.
+func (s *ExistingArriktoPluginSpec) IsValid() (bool, string) {
+	if s.KubeflowEndpoint != "" && !strings.HasPrefix(s.KubeflowEndpoint, "https") {
+		return false, "KubeflowEndpoint must start with https:// scheme."
+	}
+	if s.OIDCEndpoint != "" && !strings.HasPrefix(s.OIDCEndpoint, "https") {
+		return false, "OIDCEndpoint must start with https:// scheme."
+	}
+
+	if s.User != nil {
+		if !strings.Contains(s.User.Email, "@") {
+			return false, fmt.Sprintf("User.Email %q is not a valid email (does not contain '@')", s.User.Email)
+		}
+		if s.User.Password == nil {
+			return false, "User requires password."
+		}
+	}
+	return true, ""
+}
+
+// pluginSpec returns the spec of the plugin or an empty spec if the KfDef doesn't have one.
+func (existing *Existing) pluginSpec() (*ExistingArriktoPluginSpec, error) {
+	s, err := existing.GetTypedPluginSpec(ExistingArriktoPluginName)
+	if err != nil {
+		if kfdefs.IsPluginNotFound(err) {
+			return &ExistingArriktoPluginSpec{}, nil
+		}
+		return nil, err
+	}
+	return s.(*ExistingArriktoPluginSpec), nil
+}
@@ -100,7 +100,7 @@ func TestGetEndpoints(t *testing.T) {
 			os.Setenv(KUBEFLOW_ENDPOINT, c.kubeflowEndpoint)
 			os.Setenv(OIDC_ENDPOINT, c.oidcEndpoint)
 
-			kubeflowEndpoint, oidcEndpoint, err := getEndpoints(nil)
+			kubeflowEndpoint, oidcEndpoint, err := getEndpoints(nil, &ExistingArriktoPluginSpec{})
 
 			if err != nil {
 				if !c.expectError {
@@ -120,6 +120,24 @@ func TestGetEndpoints(t *testing.T) {
 	}
 }
 
+func TestGetEndpoints_PluginSpec(t *testing.T) {
+	// The spec takes precedence over the environment.
+	os.Setenv(KUBEFLOW_ENDPOINT, "https://172.56.12.125")
+	os.Setenv(OIDC_ENDPOINT, "")
+	defer os.Unsetenv(KUBEFLOW_ENDPOINT)
+
+	kubeflowEndpoint, oidcEndpoint, err := getEndpoints(nil, &ExistingArriktoPluginSpec{
+		KubeflowEndpoint: "https://example.com",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error occured: %+v", err)
+	}
+	if kubeflowEndpoint != "https://example.com" || oidcEndpoint != "https://example.com:5556/dex" {
+		t.Errorf("Wrong endpoints. Got %s and %s, expected https://example.com and https://example.com:5556/dex.",
+			kubeflowEndpoint, oidcEndpoint)
+	}
+}
+
 func TestGetLBAddress(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -0,0 +1,216 @@
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"strings"
+	"time"
+)
+
+const (
+	// MANAGED_CERT_NAME is the name of the ManagedCertificate created by the managed-cert overlay.
+	MANAGED_CERT_NAME = "gke-certificate"
+
+	// ManagedCertificateReason is the reason of the condition reporting the provisioning of the
+	// managed certificate of the endpoint.
+	ManagedCertificateReason = "ManagedCertificate"
+
+	// ManagedCertificateExpectedDuration is how long Google usually takes to issue a managed
+	// certificate once the DNS record of its domain points at the load balancer of the ingress.
+	ManagedCertificateExpectedDuration = 60 * time.Minute
+)
+
+// States of a ManagedCertificate.
+const (
+	ManagedCertificateProvisioning      = "Provisioning"
+	ManagedCertificateActive            = "Active"
+	ManagedCertificateFailedPermanently = "ProvisioningFailedPermanently"
+)
+
+// ManagedCertificate is a networking.gke.io ManagedCertificate.
+type ManagedCertificate struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Domains []string `json:"domains,omitempty"`
+	} `json:"spec,omitempty"`
+	Status struct {
+		CertificateStatus string                     `json:"certificateStatus,omitempty"`
+		DomainStatus      []ManagedCertificateDomain `json:"domainStatus,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+// ManagedCertificateDomain is the provisioning status of a domain of a ManagedCertificate
+// e.g. FailedNotVisible while its DNS record doesn't point at the load balancer.
+type ManagedCertificateDomain struct {
+	Domain string `json:"domain"`
+	Status string `json:"status"`
+}
+
+// ingressApp returns the name of the application creating the ingress of the deployment.
+func ingressApp(kfDef *kfdefs.KfDef) string {
+	if kfDef.Spec.UseBasicAuth {
+		return "basic-auth-ingress"
+	}
+	return "iap-ingress"
+}
+
+// UsesManagedCertificate returns true if the ingress of the deployment is served with a Google
+// managed certificate.
+func UsesManagedCertificate(kfDef *kfdefs.KfDef) bool {
+	name := ingressApp(kfDef)
+	for _, a := range kfDef.Spec.Applications {
+		if a.Name != name || a.KustomizeConfig == nil {
+			continue
+		}
+		for _, o := range a.KustomizeConfig.Overlays {
+			if o == MANAGED_CERT_OVERLAY {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IngressNamespace returns the namespace of the ingress after applying the namespace layout.
+func IngressNamespace(kfDef *kfdefs.KfDef) string {
+	if ingressNamespace, ok := kfDef.GetApplicationParameter("iap-ingress", "namespace"); ok {
+		return kfDef.RelocateNamespace(ingressNamespace)
+	}
+	if ingressNamespace, ok := kfDef.GetApplicationParameter("basic-auth-ingress", "namespace"); ok {
+		return kfDef.RelocateNamespace(ingressNamespace)
+	}
+	return kfDef.Namespace
+}
+
+// GetManagedCertificate reads the managed certificate of the ingress of the deployment.
+func GetManagedCertificate(config *rest.Config, kfDef *kfdefs.KfDef) (*ManagedCertificate, error) {
+	c := rest.CopyConfig(config)
+	c.GroupVersion = &schema.GroupVersion{
+		Group:   "networking.gke.io",
+		Version: "v1beta1",
+	}
+	c.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
+	c.APIPath = "/apis"
+	client, err := rest.RESTClientFor(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	body, err := client.Get().
+		Namespace(IngressNamespace(kfDef)).
+		Resource("managedcertificates").
+		Name(MANAGED_CERT_NAME).
+		DoRaw()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get managed certificate %v", MANAGED_CERT_NAME)
+	}
+	cert := &ManagedCertificate{}
+	if err := json.Unmarshal(body, cert); err != nil {
+		return nil, errors.Wrapf(err, "could not parse managed certificate %v", MANAGED_CERT_NAME)
+	}
+	return cert, nil
+}
+
+// CertificateStatus returns the provisioning state of the certificate for the KfDef status.
+func (c *ManagedCertificate) CertificateStatus() *kfdefs.CertificateStatus {
+	state := c.Status.CertificateStatus
+	if state == "" {
+		// The controller hasn't picked up the certificate yet.
+		state = ManagedCertificateProvisioning
+	}
+	return &kfdefs.CertificateStatus{
+		Name:              c.Name,
+		Domains:           append([]string{}, c.Spec.Domains...),
+		State:             state,
+		CreationTime:      c.CreationTimestamp,
+		ExpectedReadyTime: metav1.NewTime(c.CreationTimestamp.Add(ManagedCertificateExpectedDuration)),
+	}
+}
+
+// Condition returns the condition reporting the provisioning of the certificate at now. While
+// the certificate is provisioned the condition says when it is expected so users don't mistake
+// the wait for a hung deployment.
+func (c *ManagedCertificate) Condition(now time.Time) kfdefs.KfDefCondition {
+	status := c.CertificateStatus()
+	name := fmt.Sprintf("Managed certificate %v for %v", status.Name, strings.Join(status.Domains, ", "))
+	pending := []string{}
+	for _, d := range c.Status.DomainStatus {
+		if d.Status != ManagedCertificateActive {
+			pending = append(pending, fmt.Sprintf("%v is %v", d.Domain, d.Status))
+		}
+	}
+
+	t := kfdefs.KfDeploying
+	var message string
+	switch status.State {
+	case ManagedCertificateActive:
+		t = kfdefs.KfSucceeded
+		message = fmt.Sprintf("%v is Active; the endpoint is served over HTTPS", name)
+	case ManagedCertificateFailedPermanently:
+		t = kfdefs.KfFailed
+		message = fmt.Sprintf("%v failed permanently", name)
+		if len(pending) > 0 {
+			message += fmt.Sprintf(" (%v)", strings.Join(pending, ", "))
+		}
+		message += fmt.Sprintf("; delete ManagedCertificate %v to request a new one", status.Name)
+	default:
+		message = fmt.Sprintf("%v is %v", name, status.State)
+		if len(pending) > 0 {
+			message += fmt.Sprintf(" (%v)", strings.Join(pending, ", "))
+		}
+		if now.Before(status.ExpectedReadyTime.Time) {
+			message += fmt.Sprintf("; Google usually issues it within %v once DNS points at the ingress so it is expected by %v",
+				ManagedCertificateExpectedDuration, status.ExpectedReadyTime.UTC().Format(time.RFC3339))
+		} else {
+			message += fmt.Sprintf("; it was expected by %v, check the DNS records of %v point at the IP of the ingress",
+				status.ExpectedReadyTime.UTC().Format(time.RFC3339), strings.Join(status.Domains, ", "))
+		}
+	}
+
+	transition := metav1.NewTime(now)
+	return kfdefs.KfDefCondition{
+		Type:               t,
+		Status:             v1.ConditionTrue,
+		Reason:             ManagedCertificateReason,
+		Message:            message,
+		LastUpdateTime:     transition,
+		LastTransitionTime: transition,
+	}
+}
+
+// SetCertificateStatus records the provisioning state of the managed certificate in d replacing
+// the previous state and condition. The transition time of the condition is kept while its type
+// doesn't change.
+func SetCertificateStatus(d *kfdefs.KfDef, status *kfdefs.CertificateStatus, condition kfdefs.KfDefCondition) {
+	d.Status.Certificate = status
+	kept := []kfdefs.KfDefCondition{}
+	for _, c := range d.Status.Conditions {
+		if c.Reason != ManagedCertificateReason {
+			kept = append(kept, c)
+			continue
+		}
+		if c.Type == condition.Type {
+			condition.LastTransitionTime = c.LastTransitionTime
+		}
+	}
+	d.Status.Conditions = append(kept, condition)
+}
+
+// CertificateCondition returns the condition reporting the provisioning of the managed
+// certificate of d if there is one.
+func CertificateCondition(d *kfdefs.KfDef) (*kfdefs.KfDefCondition, bool) {
+	for i := range d.Status.Conditions {
+		if d.Status.Conditions[i].Reason == ManagedCertificateReason {
+			return &d.Status.Conditions[i], true
+		}
+	}
+	return nil, false
+}
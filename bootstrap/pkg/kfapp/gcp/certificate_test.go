@@ -0,0 +1,126 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsesManagedCertificate(t *testing.T) {
+	kfDef := &kfdefs.KfDef{
+		Spec: kfdefs.KfDefSpec{
+			Applications: []kfdefs.Application{
+				{
+					Name:            "iap-ingress",
+					KustomizeConfig: &kfdefs.KustomizeConfig{Overlays: []string{"gcp-credentials", MANAGED_CERT_OVERLAY}},
+				},
+				{
+					Name:            "basic-auth-ingress",
+					KustomizeConfig: &kfdefs.KustomizeConfig{Overlays: []string{"gcp-credentials"}},
+				},
+			},
+		},
+	}
+	if !UsesManagedCertificate(kfDef) {
+		t.Errorf("UsesManagedCertificate with the managed-cert overlay on iap-ingress: got false; want true")
+	}
+	kfDef.Spec.UseBasicAuth = true
+	if UsesManagedCertificate(kfDef) {
+		t.Errorf("UsesManagedCertificate with basic auth: got true; want false")
+	}
+}
+
+func TestManagedCertificate_Condition(t *testing.T) {
+	created := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	newCert := func(state string, domains ...ManagedCertificateDomain) *ManagedCertificate {
+		c := &ManagedCertificate{}
+		c.Name = MANAGED_CERT_NAME
+		c.CreationTimestamp = metav1.NewTime(created)
+		c.Spec.Domains = []string{"kf-app.endpoints.my-project.cloud.goog"}
+		c.Status.CertificateStatus = state
+		c.Status.DomainStatus = domains
+		return c
+	}
+
+	type testCase struct {
+		cert     *ManagedCertificate
+		now      time.Time
+		expected kfdefs.KfDefConditionType
+		contains string
+	}
+
+	cases := []testCase{
+		{
+			cert:     newCert(""),
+			now:      created.Add(time.Minute),
+			expected: kfdefs.KfDeploying,
+			contains: "expected by 2019-06-01T13:00:00Z",
+		},
+		{
+			cert:     newCert(ManagedCertificateProvisioning, ManagedCertificateDomain{Domain: "kf-app.endpoints.my-project.cloud.goog", Status: "FailedNotVisible"}),
+			now:      created.Add(2 * time.Hour),
+			expected: kfdefs.KfDeploying,
+			contains: "check the DNS records",
+		},
+		{
+			cert:     newCert(ManagedCertificateActive),
+			now:      created.Add(30 * time.Minute),
+			expected: kfdefs.KfSucceeded,
+			contains: "is Active",
+		},
+		{
+			cert:     newCert(ManagedCertificateFailedPermanently),
+			now:      created.Add(30 * time.Minute),
+			expected: kfdefs.KfFailed,
+			contains: "failed permanently",
+		},
+	}
+
+	for _, c := range cases {
+		condition := c.cert.Condition(c.now)
+		if condition.Type != c.expected || condition.Reason != ManagedCertificateReason {
+			t.Errorf("Condition of %v at %v: got %v %v; want %v %v", c.cert.Status.CertificateStatus, c.now,
+				condition.Type, condition.Reason, c.expected, ManagedCertificateReason)
+		}
+		if !strings.Contains(condition.Message, c.contains) {
+			t.Errorf("Condition of %v at %v: got message %q; want it to contain %q", c.cert.Status.CertificateStatus, c.now,
+				condition.Message, c.contains)
+		}
+	}
+
+	status := newCert("").CertificateStatus()
+	if status.State != ManagedCertificateProvisioning || !status.ExpectedReadyTime.Time.Equal(created.Add(ManagedCertificateExpectedDuration)) {
+		t.Errorf("CertificateStatus: got %+v", status)
+	}
+}
+
+func TestSetCertificateStatus(t *testing.T) {
+	created := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	cert := &ManagedCertificate{}
+	cert.Name = MANAGED_CERT_NAME
+	cert.CreationTimestamp = metav1.NewTime(created)
+
+	d := &kfdefs.KfDef{
+		Status: kfdefs.KfDefStatus{
+			Conditions: []kfdefs.KfDefCondition{{Type: kfdefs.KfSucceeded, Reason: "KfDeployed"}},
+		},
+	}
+	SetCertificateStatus(d, cert.CertificateStatus(), cert.Condition(created.Add(time.Minute)))
+	SetCertificateStatus(d, cert.CertificateStatus(), cert.Condition(created.Add(2*time.Minute)))
+
+	if len(d.Status.Conditions) != 2 {
+		t.Fatalf("Conditions: got %v; want the existing and the certificate condition", d.Status.Conditions)
+	}
+	condition, ok := CertificateCondition(d)
+	if !ok {
+		t.Fatalf("CertificateCondition: got none")
+	}
+	if !condition.LastTransitionTime.Time.Equal(created.Add(time.Minute)) || !condition.LastUpdateTime.Time.Equal(created.Add(2*time.Minute)) {
+		t.Errorf("Certificate condition: got transition %v update %v; want the transition kept", condition.LastTransitionTime, condition.LastUpdateTime)
+	}
+	if d.Status.Certificate == nil || d.Status.Certificate.Name != MANAGED_CERT_NAME {
+		t.Errorf("Certificate status: got %+v", d.Status.Certificate)
+	}
+}
@@ -0,0 +1,251 @@
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// LatestClusterVersion requests the newest version available in the location or release channel.
+const LatestClusterVersion = "latest"
+
+// gkeServerConfigURL is the URL of the GKE serverConfig of a zone or region. The v1beta1 API is used since
+// release channels aren't reported by v1.
+const gkeServerConfigURL = "https://container.googleapis.com/v1beta1/projects/%v/locations/%v/serverConfig"
+
+// releaseChannels are the GKE release channels.
+var releaseChannels = []string{"RAPID", "REGULAR", "STABLE"}
+
+// clusterVersionRe matches a GKE version or a prefix of one e.g. 1.14 or 1.14.8-gke.12.
+var clusterVersionRe = regexp.MustCompile(`^\d+(\.\d+(\.\d+(-gke\.\d+)?)?)?$`)
+
+// ClusterSpec selects the version of the GKE cluster. If neither field is set the version in
+// the Deployment Manager template is used.
+type ClusterSpec struct {
+	// Version is a GKE version, a prefix of one e.g. 1.14 which selects the newest matching
+	// version or "latest". Defaults to the default version of the location or release channel.
+	Version string `json:"version,omitempty"`
+	// ReleaseChannel enrolls the cluster in a release channel; one of RAPID, REGULAR or STABLE.
+	ReleaseChannel string `json:"releaseChannel,omitempty"`
+}
+
+// IsValid returns true if the spec is valid.
+// If false it will also return a string providing a message about why its invalid.
+// Availability of the version is checked against the cluster location when the deployment is applied.
+func (s *ClusterSpec) IsValid() (bool, string) {
+	if s.Version != "" && s.Version != LatestClusterVersion && !clusterVersionRe.MatchString(s.Version) {
+		return false, fmt.Sprintf("Cluster version %v isn't a GKE version e.g. 1.14 or 1.14.8-gke.12 or %v.", s.Version, LatestClusterVersion)
+	}
+	if s.ReleaseChannel != "" {
+		valid := false
+		for _, c := range releaseChannels {
+			valid = valid || c == s.ReleaseChannel
+		}
+		if !valid {
+			return false, fmt.Sprintf("Release channel %v must be one of %v.", s.ReleaseChannel, strings.Join(releaseChannels, ", "))
+		}
+	}
+	return true, ""
+}
+
+// gkeVersion is a version available in a release channel.
+type gkeVersion struct {
+	Version string `json:"version"`
+}
+
+// gkeChannelConfig is the versions available in a release channel.
+type gkeChannelConfig struct {
+	Channel           string       `json:"channel"`
+	DefaultVersion    string       `json:"defaultVersion"`
+	AvailableVersions []gkeVersion `json:"availableVersions"`
+}
+
+// gkeServerConfig is the subset of the GKE serverConfig of a location used to resolve versions.
+// Versions are listed newest first.
+type gkeServerConfig struct {
+	DefaultClusterVersion string             `json:"defaultClusterVersion"`
+	ValidMasterVersions   []string           `json:"validMasterVersions"`
+	Channels              []gkeChannelConfig `json:"channels"`
+}
+
+// resolveClusterVersion returns the version of the cluster selected by spec in location.
+// It returns a KfError if the version or release channel isn't available.
+func resolveClusterVersion(spec *ClusterSpec, location string, config *gkeServerConfig) (string, error) {
+	available := config.ValidMasterVersions
+	defaultVersion := config.DefaultClusterVersion
+	where := location
+
+	if spec.ReleaseChannel != "" {
+		var channel *gkeChannelConfig
+		for i := range config.Channels {
+			if config.Channels[i].Channel == spec.ReleaseChannel {
+				channel = &config.Channels[i]
+			}
+		}
+		if channel == nil {
+			return "", &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("Release channel %v isn't available in %v", spec.ReleaseChannel, location),
+			}
+		}
+		available = []string{}
+		for _, v := range channel.AvailableVersions {
+			available = append(available, v.Version)
+		}
+		defaultVersion = channel.DefaultVersion
+		where = fmt.Sprintf("release channel %v in %v", spec.ReleaseChannel, location)
+	}
+
+	switch spec.Version {
+	case "":
+		if defaultVersion != "" {
+			return defaultVersion, nil
+		}
+	case LatestClusterVersion:
+		if len(available) > 0 {
+			return available[0], nil
+		}
+	default:
+		for _, v := range available {
+			if v == spec.Version || strings.HasPrefix(v, spec.Version+".") || strings.HasPrefix(v, spec.Version+"-") {
+				return v, nil
+			}
+		}
+	}
+
+	version := spec.Version
+	if version == "" {
+		version = "the default version"
+	}
+	return "", &kfapis.KfError{
+		Code: int(kfapis.INVALID_ARGUMENT),
+		Message: fmt.Sprintf("GKE version %v isn't available in %v; available versions: %v",
+			version, where, strings.Join(available, ", ")),
+	}
+}
+
+// getServerConfig returns the GKE serverConfig of the cluster location of the deployment.
+func (gcp *Gcp) getServerConfig() (*gkeServerConfig, error) {
+	location := ClusterLocation(gcp.kfDef)
+	u := fmt.Sprintf(gkeServerConfigURL, url.PathEscape(gcp.kfDef.Spec.Project), url.PathEscape(location))
+	resp, err := gcp.client.Get(u)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error getting the GKE versions of %v: %v", location, err),
+		}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error reading the GKE versions of %v: %v", location, err),
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error getting the GKE versions of %v: %v %v", location, resp.Status, string(body)),
+		}
+	}
+
+	config := &gkeServerConfig{}
+	if err := json.Unmarshal(body, config); err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error parsing the GKE versions of %v: %v", location, err),
+		}
+	}
+	return config, nil
+}
+
+// setClusterVersion resolves the version of the cluster requested in the plugin spec, writes it
+// to the cluster config and records it in the KfDef status. It is a no-op if neither a version
+// nor a release channel is requested.
+//
+// The version is only resolved when the cluster is created; the initial version of a cluster
+// can't be changed and upgrades are done by GKE.
+func (gcp *Gcp) setClusterVersion(spec *ClusterSpec) error {
+	if spec == nil || (spec.Version == "" && spec.ReleaseChannel == "") {
+		return nil
+	}
+
+	version := gcp.kfDef.Status.ClusterVersion
+	if version == "" {
+		config, err := gcp.getServerConfig()
+		if err != nil {
+			return err
+		}
+		version, err = resolveClusterVersion(spec, ClusterLocation(gcp.kfDef), config)
+		if err != nil {
+			return err
+		}
+	}
+
+	clusterFile := path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, CONFIG_FILE)
+	if err := setClusterVersionProperty(clusterFile, version); err != nil {
+		return err
+	}
+	log.Infof("Using GKE version %v for cluster %v", version, gcp.kfDef.Name)
+	gcp.kfDef.Status.ClusterVersion = version
+	return nil
+}
+
+// setClusterVersionProperty sets the cluster-version property of the resources in the cluster config.
+func setClusterVersionProperty(clusterFile string, version string) error {
+	buf, err := ioutil.ReadFile(clusterFile)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error reading %v: %v", clusterFile, err),
+		}
+	}
+
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(buf, &data); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error parsing %v: %v", clusterFile, err),
+		}
+	}
+	resources, ok := data["resources"].([]interface{})
+	if !ok {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: "Invalid cluster config - not able to find resources entry.",
+		}
+	}
+	for _, re := range resources {
+		resource := re.(map[string]interface{})
+		properties, ok := resource["properties"].(map[string]interface{})
+		if !ok {
+			properties = map[string]interface{}{}
+			resource["properties"] = properties
+		}
+		properties["cluster-version"] = version
+	}
+
+	if buf, err = yaml.Marshal(data); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error when marshaling for %v: %v", clusterFile, err),
+		}
+	}
+	if err := ioutil.WriteFile(clusterFile, buf, 0644); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error when writing to %v: %v", clusterFile, err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package gcp
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestClusterSpec_IsValid(t *testing.T) {
+	type testCase struct {
+		input    *ClusterSpec
+		expected bool
+	}
+
+	cases := []testCase{
+		{input: &ClusterSpec{}, expected: true},
+		{input: &ClusterSpec{Version: "1.14"}, expected: true},
+		{input: &ClusterSpec{Version: "1.14.8-gke.12"}, expected: true},
+		{input: &ClusterSpec{Version: LatestClusterVersion, ReleaseChannel: "RAPID"}, expected: true},
+		{input: &ClusterSpec{Version: "1.14.x"}, expected: false},
+		{input: &ClusterSpec{Version: "v1.14"}, expected: false},
+		{input: &ClusterSpec{ReleaseChannel: "stable"}, expected: false},
+	}
+
+	for _, c := range cases {
+		isValid, msg := c.input.IsValid()
+		if isValid != c.expected {
+			t.Errorf("Spec %+v; IsValid Got:%v %v; want %v", c.input, isValid, msg, c.expected)
+		}
+	}
+}
+
+func TestGcpPluginSpec_IsValidClusterVersionOverride(t *testing.T) {
+	spec := &GcpPluginSpec{
+		Auth: &Auth{
+			BasicAuth: &BasicAuth{
+				Username: "jlewi",
+				Password: &kfdefs.SecretRef{
+					Name: "somesecret",
+				},
+			},
+		},
+		Cluster: &ClusterSpec{ReleaseChannel: "REGULAR"},
+	}
+	if isValid, msg := spec.IsValid(); !isValid {
+		t.Errorf("Spec with a release channel: IsValid Got:false %v; want true", msg)
+	}
+
+	spec.DeploymentManager = &DeploymentManagerSpec{
+		Cluster: DMPropertyOverrides{"cluster-version": "1.13"},
+	}
+	if isValid, _ := spec.IsValid(); isValid {
+		t.Errorf("Spec with a release channel and cluster-version override: IsValid Got:true; want false")
+	}
+}
+
+func TestResolveClusterVersion(t *testing.T) {
+	config := &gkeServerConfig{
+		DefaultClusterVersion: "1.13.11-gke.14",
+		ValidMasterVersions:   []string{"1.14.8-gke.12", "1.14.7-gke.23", "1.13.11-gke.14", "1.13.11-gke.9"},
+		Channels: []gkeChannelConfig{
+			{
+				Channel:           "RAPID",
+				DefaultVersion:    "1.15.4-gke.18",
+				AvailableVersions: []gkeVersion{{Version: "1.15.4-gke.18"}},
+			},
+		},
+	}
+
+	type testCase struct {
+		input    *ClusterSpec
+		expected string
+		isError  bool
+	}
+
+	cases := []testCase{
+		{input: &ClusterSpec{}, expected: "1.13.11-gke.14"},
+		{input: &ClusterSpec{Version: LatestClusterVersion}, expected: "1.14.8-gke.12"},
+		{input: &ClusterSpec{Version: "1.13"}, expected: "1.13.11-gke.14"},
+		{input: &ClusterSpec{Version: "1.14.7"}, expected: "1.14.7-gke.23"},
+		{input: &ClusterSpec{Version: "1.13.11-gke.9"}, expected: "1.13.11-gke.9"},
+		// 1.1 isn't a prefix of 1.14.
+		{input: &ClusterSpec{Version: "1.1"}, isError: true},
+		{input: &ClusterSpec{ReleaseChannel: "RAPID"}, expected: "1.15.4-gke.18"},
+		{input: &ClusterSpec{ReleaseChannel: "RAPID", Version: "1.14"}, isError: true},
+		{input: &ClusterSpec{ReleaseChannel: "STABLE"}, isError: true},
+	}
+
+	for _, c := range cases {
+		actual, err := resolveClusterVersion(c.input, "us-east1-d", config)
+		if c.isError {
+			if err == nil {
+				t.Errorf("resolveClusterVersion(%+v): got %v; want an error", c.input, actual)
+			}
+			continue
+		}
+		if err != nil || actual != c.expected {
+			t.Errorf("resolveClusterVersion(%+v): got %v, %v; want %v", c.input, actual, err, c.expected)
+		}
+	}
+}
+
+func TestSetClusterVersionProperty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cluster")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	clusterFile := path.Join(dir, CONFIG_FILE)
+	config := `imports:
+- path: cluster.jinja
+resources:
+- name: kubeflow
+  type: cluster.jinja
+  properties:
+    zone: us-east1-d
+    cluster-version: "1.13"
+`
+	if err := ioutil.WriteFile(clusterFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Could not write %v; %v", clusterFile, err)
+	}
+
+	if err := setClusterVersionProperty(clusterFile, "1.14.8-gke.12"); err != nil {
+		t.Fatalf("setClusterVersionProperty failed; %v", err)
+	}
+
+	buf, err := ioutil.ReadFile(clusterFile)
+	if err != nil {
+		t.Fatalf("Could not read %v; %v", clusterFile, err)
+	}
+	var data struct {
+		Resources []struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"resources"`
+	}
+	if err := yaml.Unmarshal(buf, &data); err != nil {
+		t.Fatalf("Could not parse %v; %v", clusterFile, err)
+	}
+	if len(data.Resources) != 1 {
+		t.Fatalf("Got %v resources; want 1", len(data.Resources))
+	}
+	props := data.Resources[0].Properties
+	if props["cluster-version"] != "1.14.8-gke.12" || props["zone"] != "us-east1-d" {
+		t.Errorf("Got properties %v; want cluster-version 1.14.8-gke.12 and zone us-east1-d", props)
+	}
+}
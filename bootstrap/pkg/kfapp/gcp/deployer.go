@@ -0,0 +1,337 @@
+package gcp
+
+import (
+	"fmt"
+	"github.com/cenkalti/backoff"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/iamcredentials/v1"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DeployerServiceAccountAnnotation is the KfDef annotation recording the service account
+	// minted to run the deployment.
+	DeployerServiceAccountAnnotation = "kfctl.kubeflow.org/deployer-service-account"
+	// DEPLOYER_SA_SUFFIX is the suffix of the name of the deployer service account.
+	DEPLOYER_SA_SUFFIX = "deployer"
+	// TOKEN_CREATOR_ROLE allows a member to generate access tokens for a service account.
+	TOKEN_CREATOR_ROLE = "roles/iam.serviceAccountTokenCreator"
+	// DEPLOYER_TOKEN_LIFETIME is the lifetime of the access tokens generated for the deployer.
+	DEPLOYER_TOKEN_LIFETIME = "3600s"
+	// KEY_ADMIN_ROLE allows a member to create and delete the keys of a service account.
+	KEY_ADMIN_ROLE = "roles/iam.serviceAccountKeyAdmin"
+)
+
+// deployerRoles is the minimal set of project roles the deployer needs to create and delete a deployment.
+// None of them allow changing IAM policies, creating service account keys or acting as other service
+// accounts since those would let the deployer grant itself more permissions; the owner of the deployment
+// makes those changes (see Gcp.ownerTokenSource).
+var deployerRoles = []string{
+	"roles/compute.networkAdmin",
+	"roles/compute.securityAdmin",
+	"roles/container.admin",
+	"roles/deploymentmanager.editor",
+	"roles/servicemanagement.admin",
+	"roles/serviceusage.serviceUsageAdmin",
+}
+
+// deployerRolesFor returns the roles the deployer of kfDef needs.
+func deployerRolesFor(kfDef *kfdefs.KfDef) []string {
+	roles := append([]string{}, deployerRoles...)
+
+	pluginSpec := &GcpPluginSpec{}
+	if err := kfDef.GetPluginSpec(GcpPluginName, pluginSpec); err != nil {
+		return roles
+	}
+	if pluginSpec.Endpoint != nil && pluginSpec.Endpoint.DNS != nil {
+		roles = append(roles, "roles/dns.admin")
+	}
+	if pluginSpec.ProfileResources != nil && pluginSpec.ProfileResources.Bucket {
+		roles = append(roles, "roles/storage.admin")
+	}
+	return roles
+}
+
+// DeployerServiceAccount returns the email of the service account minted for kfDef or "" if there isn't one.
+func DeployerServiceAccount(kfDef *kfdefs.KfDef) string {
+	return kfDef.GetAnnotations()[DeployerServiceAccountAnnotation]
+}
+
+// accountMember returns the IAM member for the account with the given email.
+func accountMember(email string) string {
+	if strings.HasSuffix(email, "iam.gserviceaccount.com") {
+		return "serviceAccount:" + email
+	}
+	return "user:" + email
+}
+
+// addBindings adds member to roles in policy creating bindings as needed.
+func addBindings(policy *cloudresourcemanager.Policy, member string, roles []string) {
+	for _, role := range roles {
+		var binding *cloudresourcemanager.Binding
+		for _, b := range policy.Bindings {
+			if b.Role == role {
+				binding = b
+				break
+			}
+		}
+		if binding == nil {
+			binding = &cloudresourcemanager.Binding{Role: role}
+			policy.Bindings = append(policy.Bindings, binding)
+		}
+		found := false
+		for _, m := range binding.Members {
+			if m == member {
+				found = true
+				break
+			}
+		}
+		if !found {
+			binding.Members = append(binding.Members, member)
+		}
+	}
+}
+
+// MintDeployerServiceAccount creates a service account dedicated to running kfDef's deployment.
+//
+// The service account is granted the minimal roles needed by the deployment and owner is allowed to
+// generate access tokens for it. client should be authorized as owner. The email of the service account
+// is recorded in kfDef's annotations so it can be deleted on teardown.
+func MintDeployerServiceAccount(ctx context.Context, client *http.Client, kfDef *kfdefs.KfDef, owner string) (string, error) {
+	project := kfDef.Spec.Project
+	email := getSA(kfDef.Name, DEPLOYER_SA_SUFFIX, project)
+
+	iamService, err := iam.New(client)
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating IAM service: %v", err),
+		}
+	}
+
+	log.Infof("Creating deployer service account %v", email)
+	_, err = iamService.Projects.ServiceAccounts.Create("projects/"+project, &iam.CreateServiceAccountRequest{
+		AccountId: kfDef.Name + "-" + DEPLOYER_SA_SUFFIX,
+		ServiceAccount: &iam.ServiceAccount{
+			DisplayName: fmt.Sprintf("kfctl deployer for %v", kfDef.Name),
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); !ok || gErr.Code != http.StatusConflict {
+			return "", &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("Error creating service account %v: %v", email, err),
+			}
+		}
+		log.Infof("Service account %v already exists", email)
+	}
+
+	policy, err := utils.GetIamPolicy(project, client)
+	if err != nil {
+		return "", err
+	}
+	addBindings(policy, "serviceAccount:"+email, deployerRolesFor(kfDef))
+	if err := utils.SetIamPolicy(project, policy, client); err != nil {
+		return "", err
+	}
+
+	saPolicy := &iam.Policy{
+		Bindings: []*iam.Binding{
+			{
+				Role:    TOKEN_CREATOR_ROLE,
+				Members: []string{accountMember(owner)},
+			},
+		},
+	}
+	if err := utils.SetServiceAccountIamPolicy(iamService, saPolicy, project, email); err != nil {
+		return "", err
+	}
+
+	annotations := kfDef.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[DeployerServiceAccountAnnotation] = email
+	kfDef.SetAnnotations(annotations)
+	kfDef.RecordResource(kfdefs.InventoryResource{
+		Kind:    ServiceAccountKind,
+		Name:    email,
+		Project: project,
+		Source:  DEPLOYER_SA_SUFFIX,
+	})
+	return email, nil
+}
+
+// addServiceAccountBinding adds member to role in the IAM policy of a service account.
+func addServiceAccountBinding(policy *iam.Policy, role string, member string) {
+	for _, b := range policy.Bindings {
+		if b.Role != role {
+			continue
+		}
+		for _, m := range b.Members {
+			if m == member {
+				return
+			}
+		}
+		b.Members = append(b.Members, member)
+		return
+	}
+	policy.Bindings = append(policy.Bindings, &iam.Binding{Role: role, Members: []string{member}})
+}
+
+// AllowMaintenance lets member generate access tokens for the deployer of kfDef so maintenance
+// tasks run as the deployer rather than with the credentials of a user. If refreshKeys the deployer
+// is also allowed to replace the keys of the admin and user service accounts of the deployment;
+// the role is granted on those service accounts only. client should be authorized as the owner.
+func AllowMaintenance(ctx context.Context, client *http.Client, kfDef *kfdefs.KfDef, member string, refreshKeys bool) error {
+	email := DeployerServiceAccount(kfDef)
+	if email == "" {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Deployment %v has no deployer service account", kfDef.Name),
+		}
+	}
+	project := kfDef.Spec.Project
+
+	iamService, err := iam.New(client)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating IAM service: %v", err),
+		}
+	}
+
+	type grant struct {
+		sa     string
+		role   string
+		member string
+	}
+	grants := []grant{{sa: email, role: TOKEN_CREATOR_ROLE, member: member}}
+	if refreshKeys {
+		for _, suffix := range []string{"admin", "user"} {
+			grants = append(grants, grant{
+				sa:     getSA(kfDef.Name, suffix, project),
+				role:   KEY_ADMIN_ROLE,
+				member: "serviceAccount:" + email,
+			})
+		}
+	}
+	for _, g := range grants {
+		policy, err := utils.GetServiceAccountIamPolicy(iamService, project, g.sa)
+		if err != nil {
+			return err
+		}
+		addServiceAccountBinding(policy, g.role, g.member)
+		log.Infof("Granting %v %v on %v", g.member, g.role, g.sa)
+		if err := utils.SetServiceAccountIamPolicy(iamService, policy, project, g.sa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployerTokenSource generates access tokens for a deployer service account.
+type deployerTokenSource struct {
+	ctx     context.Context
+	service *iamcredentials.Service
+	email   string
+}
+
+// Token generates a new access token.
+// Newly granted IAM bindings take time to propagate so permission errors are retried.
+func (d *deployerTokenSource) Token() (*oauth2.Token, error) {
+	name := "projects/-/serviceAccounts/" + d.email
+	req := &iamcredentials.GenerateAccessTokenRequest{
+		Lifetime: DEPLOYER_TOKEN_LIFETIME,
+		Scope:    []string{iam.CloudPlatformScope},
+	}
+
+	var res *iamcredentials.GenerateAccessTokenResponse
+	b := newDefaultBackoff()
+	b.MaxElapsedTime = 2 * time.Minute
+	err := backoff.Retry(func() error {
+		var err error
+		res, err = d.service.Projects.ServiceAccounts.GenerateAccessToken(name, req).Context(d.ctx).Do()
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code != http.StatusForbidden && gErr.Code < 500 {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, b)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error generating access token for %v: %v", d.email, err),
+		}
+	}
+
+	expiry, err := time.Parse(time.RFC3339, res.ExpireTime)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Could not parse token expiry %v: %v", res.ExpireTime, err),
+		}
+	}
+	return &oauth2.Token{
+		AccessToken: res.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
+
+// NewDeployerTokenSource returns a TokenSource for the deployer service account email.
+// Tokens are generated using client's credentials and reused until they expire.
+func NewDeployerTokenSource(ctx context.Context, client *http.Client, email string) (oauth2.TokenSource, error) {
+	service, err := iamcredentials.New(client)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating IAM credentials service: %v", err),
+		}
+	}
+	return oauth2.ReuseTokenSource(nil, &deployerTokenSource{
+		ctx:     ctx,
+		service: service,
+		email:   email,
+	}), nil
+}
+
+// deleteDeployerServiceAccount deletes the deployer service account if one was minted.
+// The deployer's project IAM bindings are removed along with those of the other service accounts
+// of the deployment. client must be authorized as the owner since the deployer can't delete itself.
+func (gcp *Gcp) deleteDeployerServiceAccount(ctx context.Context, client *http.Client) error {
+	email := DeployerServiceAccount(gcp.kfDef)
+	if email == "" {
+		return nil
+	}
+
+	iamService, err := iam.New(client)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating IAM service: %v", err),
+		}
+	}
+
+	log.Infof("Deleting deployer service account %v", email)
+	name := fmt.Sprintf("projects/%v/serviceAccounts/%v", gcp.kfDef.Spec.Project, email)
+	if _, err := iamService.Projects.ServiceAccounts.Delete(name).Context(ctx).Do(); err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error deleting service account %v: %v", email, err),
+		}
+	}
+	return nil
+}
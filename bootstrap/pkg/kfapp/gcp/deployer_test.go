@@ -0,0 +1,126 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/iam/v1"
+	"reflect"
+	"testing"
+)
+
+func TestDeployerRolesFor(t *testing.T) {
+	d := &kfdefs.KfDef{}
+	if roles := deployerRolesFor(d); !reflect.DeepEqual(roles, deployerRoles) {
+		t.Errorf("Got roles %v; want %v", roles, deployerRoles)
+	}
+
+	if err := d.SetPluginSpec(GcpPluginName, &GcpPluginSpec{
+		Endpoint: &EndpointSpec{
+			DNS: &CloudDNS{
+				ManagedZone: "acme",
+			},
+		},
+	}); err != nil {
+		t.Fatalf("SetPluginSpec error; %v", err)
+	}
+
+	roles := deployerRolesFor(d)
+	if len(roles) != len(deployerRoles)+1 || roles[len(roles)-1] != "roles/dns.admin" {
+		t.Errorf("Got roles %v; want %v plus roles/dns.admin", roles, deployerRoles)
+	}
+
+	if len(deployerRoles) != len(deployerRolesFor(&kfdefs.KfDef{})) {
+		t.Errorf("deployerRolesFor modified deployerRoles")
+	}
+
+	// These roles would let the deployer grant itself more permissions.
+	escalating := map[string]bool{
+		"roles/iam.serviceAccountAdmin":         true,
+		"roles/iam.serviceAccountKeyAdmin":      true,
+		"roles/iam.serviceAccountUser":          true,
+		"roles/resourcemanager.projectIamAdmin": true,
+		TOKEN_CREATOR_ROLE:                      true,
+	}
+	for _, role := range roles {
+		if escalating[role] {
+			t.Errorf("Deployer is granted %v", role)
+		}
+	}
+}
+
+func TestAddBindings(t *testing.T) {
+	policy := &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			{
+				Role:    "roles/container.admin",
+				Members: []string{"user:jlewi@acme.com"},
+			},
+		},
+	}
+
+	member := "serviceAccount:kf-app-deployer@acme.iam.gserviceaccount.com"
+	roles := []string{"roles/container.admin", "roles/dns.admin"}
+
+	// Adding twice shouldn't duplicate members.
+	addBindings(policy, member, roles)
+	addBindings(policy, member, roles)
+
+	expected := &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			{
+				Role:    "roles/container.admin",
+				Members: []string{"user:jlewi@acme.com", member},
+			},
+			{
+				Role:    "roles/dns.admin",
+				Members: []string{member},
+			},
+		},
+	}
+	if !reflect.DeepEqual(policy, expected) {
+		t.Errorf("Got policy %v; want %v", utils.PrettyPrint(policy), utils.PrettyPrint(expected))
+	}
+}
+
+func TestDeployerServiceAccount(t *testing.T) {
+	d := &kfdefs.KfDef{}
+	if email := DeployerServiceAccount(d); email != "" {
+		t.Errorf("Got %v; want no deployer", email)
+	}
+
+	email := getSA("kf-app", DEPLOYER_SA_SUFFIX, "acme")
+	d.SetAnnotations(map[string]string{DeployerServiceAccountAnnotation: email})
+	if actual := DeployerServiceAccount(d); actual != email {
+		t.Errorf("Got %v; want %v", actual, email)
+	}
+
+	if m := accountMember(email); m != "serviceAccount:"+email {
+		t.Errorf("Got member %v", m)
+	}
+	if m := accountMember("jlewi@acme.com"); m != "user:jlewi@acme.com" {
+		t.Errorf("Got member %v", m)
+	}
+}
+
+func TestAddServiceAccountBinding(t *testing.T) {
+	policy := &iam.Policy{}
+	member := "serviceAccount:kfctl@acme.iam.gserviceaccount.com"
+
+	// Adding twice shouldn't duplicate members.
+	addServiceAccountBinding(policy, TOKEN_CREATOR_ROLE, member)
+	addServiceAccountBinding(policy, TOKEN_CREATOR_ROLE, member)
+	addServiceAccountBinding(policy, TOKEN_CREATOR_ROLE, "user:jlewi@acme.com")
+
+	expected := &iam.Policy{
+		Bindings: []*iam.Binding{
+			{
+				Role:    TOKEN_CREATOR_ROLE,
+				Members: []string{member, "user:jlewi@acme.com"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(policy, expected) {
+		t.Errorf("Got policy %v; want %v", utils.PrettyPrint(policy), utils.PrettyPrint(expected))
+	}
+}
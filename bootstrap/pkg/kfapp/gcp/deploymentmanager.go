@@ -0,0 +1,192 @@
+package gcp
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DMPropertyOverrides are values for the properties of a Deployment Manager template keyed by property name.
+// Values must match the type declared for the property in the template's schema.
+type DMPropertyOverrides map[string]interface{}
+
+// DeploymentManagerSpec customizes the properties the Deployment Manager templates are instantiated with
+// e.g. to create the cluster in a shared VPC or to choose a different min CPU platform.
+type DeploymentManagerSpec struct {
+	// Cluster overrides properties of cluster.jinja.
+	Cluster DMPropertyOverrides `json:"cluster,omitempty"`
+	// Storage overrides properties of storage.jinja.
+	Storage DMPropertyOverrides `json:"storage,omitempty"`
+}
+
+// clusterManagedProperties are the properties of cluster.jinja set by kfctl from the KfDef.
+var clusterManagedProperties = []string{
+	"zone", "gkeApiVersion", "users", "ipName", "enable-workload-identity", "identity-namespace", "release-channel",
+	"region", "preemptible-pool-machine-type", "preemptible-pool-min-nodes", "preemptible-pool-max-nodes",
+	"preemptible-pool-gpu-type", "preemptible-pool-gpu-number-per-node",
+}
+
+// storageManagedProperties are the properties of storage.jinja set by kfctl from the KfDef.
+var storageManagedProperties = []string{
+	"zone", "createPipelinePersistentStorage",
+}
+
+// IsValid returns true if the spec doesn't override properties set by kfctl.
+// If false it will also return a string providing a message about why its invalid.
+// Overrides are validated against the template schemas when the configs are generated.
+func (s *DeploymentManagerSpec) IsValid() (bool, string) {
+	msg := ""
+	for _, p := range clusterManagedProperties {
+		if _, ok := s.Cluster[p]; ok {
+			msg += fmt.Sprintf("Cluster property %v is set by kfctl and can't be overridden. ", p)
+		}
+	}
+	for _, p := range storageManagedProperties {
+		if _, ok := s.Storage[p]; ok {
+			msg += fmt.Sprintf("Storage property %v is set by kfctl and can't be overridden. ", p)
+		}
+	}
+	return msg == "", msg
+}
+
+// clusterOverride returns the override of a property of cluster.jinja; s may be nil.
+func (s *DeploymentManagerSpec) clusterOverride(name string) (interface{}, bool) {
+	if s == nil {
+		return nil, false
+	}
+	v, ok := s.Cluster[name]
+	return v, ok
+}
+
+// dmSchemaProperty is the declaration of a property in a Deployment Manager template schema.
+type dmSchemaProperty struct {
+	Type string        `json:"type,omitempty"`
+	Enum []interface{} `json:"enum,omitempty"`
+}
+
+// dmSchema is the subset of a Deployment Manager template schema used to validate overrides.
+type dmSchema struct {
+	Properties map[string]dmSchemaProperty `json:"properties,omitempty"`
+}
+
+// validateDMProperties validates overrides against the schema of a template.
+// It returns a KfError listing every property that isn't declared or has the wrong type.
+func validateDMProperties(schemaFile string, overrides DMPropertyOverrides) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	buf, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error reading schema %v: %v", schemaFile, err),
+		}
+	}
+
+	schema := &dmSchema{}
+	if err := yaml.Unmarshal(buf, schema); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error parsing schema %v: %v", schemaFile, err),
+		}
+	}
+
+	names := []string{}
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	violations := []string{}
+	for _, name := range names {
+		value := overrides[name]
+		p, ok := schema.Properties[name]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%v isn't a property of the template", name))
+			continue
+		}
+		if p.Type != "" && !matchesDMType(p.Type, value) {
+			violations = append(violations, fmt.Sprintf("%v must be of type %v; got %v", name, p.Type, value))
+			continue
+		}
+		if len(p.Enum) > 0 && !inEnum(p.Enum, value) {
+			violations = append(violations, fmt.Sprintf("%v must be one of %v; got %v", name, p.Enum, value))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Invalid overrides for %v: %v", schemaFile, strings.Join(violations, "; ")),
+		}
+	}
+	return nil
+}
+
+// matchesDMType returns true if value is of the JSON schema type t.
+// Numbers decoded from JSON are float64 so integers are floats without a fractional part.
+func matchesDMType(t string, value interface{}) bool {
+	switch t {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		switch v := value.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			return v == math.Trunc(v)
+		}
+		return false
+	case "number":
+		switch value.(type) {
+		case int, int32, int64, float32, float64:
+			return true
+		}
+		return false
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+// inEnum returns true if value is one of the allowed values.
+func inEnum(allowed []interface{}, value interface{}) bool {
+	for _, a := range allowed {
+		if reflect.DeepEqual(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDMOverrides sets the overrides in the properties of every resource of a DM config.
+func applyDMOverrides(resources []interface{}, overrides DMPropertyOverrides) {
+	if len(overrides) == 0 {
+		return
+	}
+	for _, re := range resources {
+		resource := re.(map[string]interface{})
+		properties, ok := resource["properties"].(map[string]interface{})
+		if !ok {
+			properties = map[string]interface{}{}
+			resource["properties"] = properties
+		}
+		for k, v := range overrides {
+			properties[k] = v
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package gcp
+
+import (
+	"github.com/ghodss/yaml"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testClusterSchema = `
+info:
+  title: GKE cluster
+required:
+- zone
+properties:
+  zone:
+    type: string
+  network:
+    type: string
+  min-cpu-platform:
+    type: string
+    default: Intel Broadwell
+  cpu-pool-max-nodes:
+    type: integer
+  cpu-pool-enable-autoscaling:
+    type: boolean
+  gkeApiVersion:
+    type: string
+    enum:
+    - v1
+    - v1beta1
+  securityConfig:
+    type: object
+`
+
+func TestValidateDMProperties(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmSchema")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	schemaFile := path.Join(dir, "cluster.jinja.schema")
+	if err := ioutil.WriteFile(schemaFile, []byte(testClusterSchema), 0644); err != nil {
+		t.Fatalf("Could not write schema; %v", err)
+	}
+
+	type testCase struct {
+		name string
+		// overrides is YAML so values are typed as they would be when decoded from a request.
+		overrides string
+		// expected are substrings of the error; empty if the overrides are valid.
+		expected []string
+	}
+
+	cases := []testCase{
+		{
+			name:      "empty",
+			overrides: "",
+		},
+		{
+			name: "valid",
+			overrides: `
+network: shared-vpc
+min-cpu-platform: Intel Skylake
+cpu-pool-max-nodes: 20
+cpu-pool-enable-autoscaling: false
+gkeApiVersion: v1beta1
+securityConfig:
+  privatecluster: true
+`,
+		},
+		{
+			name: "invalid",
+			overrides: `
+subnet: shared-subnet
+cpu-pool-max-nodes: 2.5
+cpu-pool-enable-autoscaling: "yes"
+gkeApiVersion: v2
+network: shared-vpc
+`,
+			expected: []string{
+				"cpu-pool-enable-autoscaling must be of type boolean",
+				"cpu-pool-max-nodes must be of type integer",
+				"gkeApiVersion must be one of",
+				"subnet isn't a property of the template",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		overrides := DMPropertyOverrides{}
+		if err := yaml.Unmarshal([]byte(c.overrides), &overrides); err != nil {
+			t.Fatalf("Case %v: could not parse overrides; %v", c.name, err)
+		}
+
+		err := validateDMProperties(schemaFile, overrides)
+		if len(c.expected) == 0 {
+			if err != nil {
+				t.Errorf("Case %v: unexpected error; %v", c.name, err)
+			}
+			continue
+		}
+
+		kfErr, ok := err.(*kfapis.KfError)
+		if !ok || kfErr.Code != int(kfapis.INVALID_ARGUMENT) {
+			t.Errorf("Case %v: got error %v; want an invalid argument error", c.name, err)
+			continue
+		}
+		for _, e := range c.expected {
+			if !strings.Contains(kfErr.Message, e) {
+				t.Errorf("Case %v: error %v doesn't contain %v", c.name, kfErr.Message, e)
+			}
+		}
+		if strings.Contains(kfErr.Message, "network") {
+			t.Errorf("Case %v: error %v reports the valid property network", c.name, kfErr.Message)
+		}
+	}
+}
+
+func TestDeploymentManagerSpec_IsValid(t *testing.T) {
+	valid := &DeploymentManagerSpec{
+		Cluster: DMPropertyOverrides{
+			"network": "shared-vpc",
+		},
+	}
+	if isValid, msg := valid.IsValid(); !isValid {
+		t.Errorf("Got invalid; %v", msg)
+	}
+
+	invalid := &DeploymentManagerSpec{
+		Cluster: DMPropertyOverrides{
+			"zone": "us-east1-d",
+		},
+		Storage: DMPropertyOverrides{
+			"createPipelinePersistentStorage": false,
+		},
+	}
+	isValid, msg := invalid.IsValid()
+	if isValid || !strings.Contains(msg, "Cluster property zone") || !strings.Contains(msg, "Storage property createPipelinePersistentStorage") {
+		t.Errorf("Got valid %v message %v; want both managed properties rejected", isValid, msg)
+	}
+}
+
+func TestApplyDMOverrides(t *testing.T) {
+	resources := []interface{}{
+		map[string]interface{}{
+			"name": "kubeflow",
+			"properties": map[string]interface{}{
+				"network":          "default",
+				"min-cpu-platform": "Intel Broadwell",
+			},
+		},
+		map[string]interface{}{
+			"name": "other",
+		},
+	}
+
+	applyDMOverrides(resources, DMPropertyOverrides{
+		"network": "shared-vpc",
+	})
+
+	expected := []interface{}{
+		map[string]interface{}{
+			"name": "kubeflow",
+			"properties": map[string]interface{}{
+				"network":          "shared-vpc",
+				"min-cpu-platform": "Intel Broadwell",
+			},
+		},
+		map[string]interface{}{
+			"name": "other",
+			"properties": map[string]interface{}{
+				"network": "shared-vpc",
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(resources, expected) {
+		t.Errorf("Got %v; want %v", resources, expected)
+	}
+}
@@ -0,0 +1,155 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/deploymentmanager/v2"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+// DeploymentManagerReason is the reason of the conditions reporting the progress of the
+// Deployment Manager deployments.
+const DeploymentManagerReason = "DeploymentManager"
+
+// DMStatusFunc is notified of the conditions reporting the progress of the Deployment Manager
+// deployments each time the operations are polled.
+type DMStatusFunc func(conditions []kfdefs.KfDefCondition)
+
+// SetDMStatusFunc sets the function notified of the progress of the Deployment Manager deployments.
+func (gcp *Gcp) SetDMStatusFunc(f DMStatusFunc) {
+	gcp.dmStatusFunc = f
+}
+
+// SetDMConditions replaces the conditions reporting the progress of the Deployment Manager
+// deployments in d with conditions.
+func SetDMConditions(d *kfdefs.KfDef, conditions []kfdefs.KfDefCondition) {
+	kept := []kfdefs.KfDefCondition{}
+	for _, c := range d.Status.Conditions {
+		if c.Reason != DeploymentManagerReason {
+			kept = append(kept, c)
+		}
+	}
+	d.Status.Conditions = append(kept, conditions...)
+}
+
+// dmStatusRecorder returns a function recording the progress of the operations in the KfDef
+// status. The conditions of each deployment are replaced as its operation is polled.
+func (gcp *Gcp) dmStatusRecorder(deploymentmanagerService *deploymentmanager.Service) func(*dmOperationEntry, *deploymentmanager.Operation) {
+	byDeployment := map[string][]kfdefs.KfDefCondition{}
+	order := []string{}
+	return func(dmEntry *dmOperationEntry, op *deploymentmanager.Operation) {
+		var resources []*deploymentmanager.Resource
+		err := deploymentmanagerService.Resources.List(gcp.kfDef.Spec.Project, dmEntry.deployment).Pages(
+			context.Background(), func(page *deploymentmanager.ResourcesListResponse) error {
+				resources = append(resources, page.Resources...)
+				return nil
+			})
+		if err != nil {
+			// The operation status is still reported; the resources may not exist yet.
+			log.Warnf("Could not list the resources of deployment %v; error %v", dmEntry.deployment, err)
+		}
+
+		if _, ok := byDeployment[dmEntry.deployment]; !ok {
+			order = append(order, dmEntry.deployment)
+		}
+		byDeployment[dmEntry.deployment] = dmConditions(dmEntry.deployment, op, resources)
+
+		conditions := []kfdefs.KfDefCondition{}
+		for _, d := range order {
+			conditions = append(conditions, byDeployment[d]...)
+		}
+		SetDMConditions(gcp.kfDef, conditions)
+		if gcp.dmStatusFunc != nil {
+			gcp.dmStatusFunc(conditions)
+		}
+	}
+}
+
+// dmConditions returns the conditions reporting the progress of the operation on a deployment.
+// The first condition summarizes the deployment; it is followed by a condition for each resource
+// that is still being created or updated or that failed. Completed resources are only counted.
+func dmConditions(deployment string, op *deploymentmanager.Operation, resources []*deploymentmanager.Resource) []kfdefs.KfDefCondition {
+	now := metav1.Now()
+	newCondition := func(t kfdefs.KfDefConditionType, message string) kfdefs.KfDefCondition {
+		return kfdefs.KfDefCondition{
+			Type:               t,
+			Status:             v1.ConditionTrue,
+			Reason:             DeploymentManagerReason,
+			Message:            message,
+			LastUpdateTime:     now,
+			LastTransitionTime: now,
+		}
+	}
+
+	completed := 0
+	failed := 0
+	resourceConditions := []kfdefs.KfDefCondition{}
+	for _, r := range resources {
+		if r.Update == nil {
+			completed++
+			continue
+		}
+		name := fmt.Sprintf("Deployment Manager resource %v/%v (%v)", deployment, r.Name, r.Type)
+		switch r.Update.State {
+		case "FAILED", "ABORTED":
+			failed++
+			message := fmt.Sprintf("%v is %v", name, r.Update.State)
+			if r.Update.Error != nil {
+				message += ": " + dmErrorMessage(r.Update.Error.Errors)
+			}
+			resourceConditions = append(resourceConditions, newCondition(kfdefs.KfFailed, message))
+		default:
+			resourceConditions = append(resourceConditions, newCondition(kfdefs.KfDeploying,
+				fmt.Sprintf("%v is %v", name, r.Update.State)))
+		}
+	}
+
+	summary := fmt.Sprintf("Deployment Manager deployment %v is %v; %v of %v resources completed",
+		deployment, op.Status, completed, len(resources))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %v failed", failed)
+	}
+	t := kfdefs.KfDeploying
+	if op.Status == "DONE" {
+		t = kfdefs.KfSucceeded
+		switch {
+		case op.Error != nil && len(op.Error.Errors) > 0:
+			t = kfdefs.KfFailed
+			summary += ": " + dmOperationErrorMessage(op.Error.Errors)
+		case op.HttpErrorStatusCode > 0:
+			t = kfdefs.KfFailed
+			summary += fmt.Sprintf(": error(%v) %v", op.HttpErrorStatusCode, op.HttpErrorMessage)
+		}
+	}
+
+	return append([]kfdefs.KfDefCondition{newCondition(t, summary)}, resourceConditions...)
+}
+
+// dmErrorMessage joins the errors of a resource update.
+func dmErrorMessage(errs []*deploymentmanager.ResourceUpdateErrorErrors) string {
+	messages := []string{}
+	for _, e := range errs {
+		messages = append(messages, formatDMError(e.Code, e.Location, e.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// dmOperationErrorMessage joins the errors of an operation.
+func dmOperationErrorMessage(errs []*deploymentmanager.OperationErrorErrors) string {
+	messages := []string{}
+	for _, e := range errs {
+		messages = append(messages, formatDMError(e.Code, e.Location, e.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+func formatDMError(code string, location string, message string) string {
+	if location != "" {
+		return fmt.Sprintf("%v at %v: %v", code, location, message)
+	}
+	return fmt.Sprintf("%v: %v", code, message)
+}
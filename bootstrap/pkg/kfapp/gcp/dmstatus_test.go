@@ -0,0 +1,116 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"google.golang.org/api/deploymentmanager/v2"
+	"testing"
+)
+
+func TestDMConditions(t *testing.T) {
+	type expected struct {
+		Type    kfdefs.KfDefConditionType
+		Message string
+	}
+
+	type testCase struct {
+		name      string
+		op        *deploymentmanager.Operation
+		resources []*deploymentmanager.Resource
+		expected  []expected
+	}
+
+	cluster := &deploymentmanager.Resource{Name: "kf-gke", Type: "container.v1.cluster"}
+	pool := &deploymentmanager.Resource{
+		Name: "kf-cpu-pool",
+		Type: "container.v1.nodePool",
+		Update: &deploymentmanager.ResourceUpdate{
+			State: "IN_PROGRESS",
+		},
+	}
+	ip := &deploymentmanager.Resource{
+		Name: "kf-ip",
+		Type: "compute.v1.globalAddress",
+		Update: &deploymentmanager.ResourceUpdate{
+			State: "FAILED",
+			Error: &deploymentmanager.ResourceUpdateError{
+				Errors: []*deploymentmanager.ResourceUpdateErrorErrors{
+					{Code: "RESOURCE_ERROR", Location: "/deployments/kf/resources/kf-ip", Message: "quota exceeded"},
+				},
+			},
+		},
+	}
+
+	cases := []testCase{
+		{
+			name:      "running",
+			op:        &deploymentmanager.Operation{Status: "RUNNING"},
+			resources: []*deploymentmanager.Resource{cluster, pool},
+			expected: []expected{
+				{kfdefs.KfDeploying, "Deployment Manager deployment kf is RUNNING; 1 of 2 resources completed"},
+				{kfdefs.KfDeploying, "Deployment Manager resource kf/kf-cpu-pool (container.v1.nodePool) is IN_PROGRESS"},
+			},
+		},
+		{
+			name: "failed",
+			op: &deploymentmanager.Operation{
+				Status: "DONE",
+				Error: &deploymentmanager.OperationError{
+					Errors: []*deploymentmanager.OperationErrorErrors{
+						{Code: "RESOURCE_ERROR", Message: "kf-ip failed"},
+					},
+				},
+			},
+			resources: []*deploymentmanager.Resource{cluster, ip},
+			expected: []expected{
+				{kfdefs.KfFailed, "Deployment Manager deployment kf is DONE; 1 of 2 resources completed, 1 failed: RESOURCE_ERROR: kf-ip failed"},
+				{kfdefs.KfFailed, "Deployment Manager resource kf/kf-ip (compute.v1.globalAddress) is FAILED: RESOURCE_ERROR at /deployments/kf/resources/kf-ip: quota exceeded"},
+			},
+		},
+		{
+			name:      "done",
+			op:        &deploymentmanager.Operation{Status: "DONE"},
+			resources: []*deploymentmanager.Resource{cluster},
+			expected: []expected{
+				{kfdefs.KfSucceeded, "Deployment Manager deployment kf is DONE; 1 of 1 resources completed"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		actual := dmConditions("kf", c.op, c.resources)
+		if len(actual) != len(c.expected) {
+			t.Errorf("Case %v: got %v conditions; want %v", c.name, len(actual), len(c.expected))
+			continue
+		}
+		for i, e := range c.expected {
+			if actual[i].Type != e.Type || actual[i].Message != e.Message {
+				t.Errorf("Case %v: condition %v got %v %q; want %v %q", c.name, i, actual[i].Type, actual[i].Message, e.Type, e.Message)
+			}
+			if actual[i].Reason != DeploymentManagerReason {
+				t.Errorf("Case %v: condition %v got reason %v; want %v", c.name, i, actual[i].Reason, DeploymentManagerReason)
+			}
+		}
+	}
+}
+
+func TestSetDMConditions(t *testing.T) {
+	d := &kfdefs.KfDef{}
+	d.Status.Conditions = []kfdefs.KfDefCondition{
+		{Type: kfdefs.KfDeploying, Reason: "DeploymentPaused"},
+		{Type: kfdefs.KfDeploying, Reason: DeploymentManagerReason, Message: "old"},
+	}
+
+	SetDMConditions(d, []kfdefs.KfDefCondition{
+		{Type: kfdefs.KfSucceeded, Reason: DeploymentManagerReason, Message: "new"},
+	})
+
+	if len(d.Status.Conditions) != 2 {
+		t.Fatalf("Got %v conditions; want 2", len(d.Status.Conditions))
+	}
+	if d.Status.Conditions[0].Reason != "DeploymentPaused" {
+		t.Errorf("Other conditions weren't kept; got %v", d.Status.Conditions[0])
+	}
+	if d.Status.Conditions[1].Message != "new" {
+		t.Errorf("Deployment Manager conditions weren't replaced; got %v", d.Status.Conditions[1])
+	}
+}
@@ -0,0 +1,160 @@
+package gcp
+
+import (
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/siteverification/v1"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CLOUD_ENDPOINTS_SUFFIX is the suffix of hostnames managed by Cloud Endpoints.
+	CLOUD_ENDPOINTS_SUFFIX = ".cloud.goog"
+	// IAP_REDIRECT_PATH is the path IAP redirects to after the OAuth flow.
+	IAP_REDIRECT_PATH = "/_gcp_gatekeeper/authenticate"
+)
+
+// IsCustomDomain returns true if the hostname isn't managed by Cloud Endpoints.
+func IsCustomDomain(kfDef *kfdefs.KfDef) bool {
+	return kfDef.Spec.Hostname != "" && !strings.HasSuffix(kfDef.Spec.Hostname, CLOUD_ENDPOINTS_SUFFIX)
+}
+
+// OAuthRedirectURI returns the redirect URI that must be authorized on the OAuth client used by IAP.
+func OAuthRedirectURI(hostname string) string {
+	return "https://" + hostname + IAP_REDIRECT_PATH
+}
+
+// CheckIAPRedirectURI checks that the OAuth client used by IAP authorizes the redirect URI of the
+// custom domain of kfDef. Redirect URIs of OAuth clients can't be set through an API, so a missing
+// URI is returned as an error telling where to add it. The IAP JWT audience doesn't need to be
+// checked; it is derived from the backend service, which doesn't depend on the hostname.
+func CheckIAPRedirectURI(ctx context.Context, client *http.Client, kfDef *kfdefs.KfDef) error {
+	if !IsCustomDomain(kfDef) {
+		return nil
+	}
+	pluginSpec := &GcpPluginSpec{}
+	if err := kfDef.GetPluginSpec(GcpPluginName, pluginSpec); err != nil && !kfdefs.IsPluginNotFound(err) {
+		return err
+	}
+	if pluginSpec.Auth == nil || pluginSpec.Auth.IAP == nil {
+		return nil
+	}
+
+	iap := pluginSpec.Auth.IAP
+	clientsURL := fmt.Sprintf(credentialsURL, kfDef.Spec.Project)
+	if iap.OAuthClientSecret == nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: "IAP requires OAuthClientSecret; set it to the secret holding the secret of the OAuth client",
+		}
+	}
+	secret, err := kfDef.GetSecret(iap.OAuthClientSecret.Name)
+	if err != nil {
+		return &kfapis.KfError{
+			Code: int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Could not read the secret of OAuth client %v from secret %v of the KfDef: %v",
+				iap.OAuthClientId, iap.OAuthClientSecret.Name, err),
+		}
+	}
+	redirectURI := OAuthRedirectURI(kfDef.Spec.Hostname)
+	code, err := checkClientCredentials(ctx, client, iap.OAuthClientId, secret, redirectURI)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case "invalid_client", "unauthorized_client":
+		return &kfapis.KfError{
+			Code: int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("OAuth client %v doesn't exist or its secret is wrong; copy the id and secret of the client from %v",
+				iap.OAuthClientId, clientsURL),
+		}
+	case "redirect_uri_mismatch":
+		return &kfapis.KfError{
+			Code: int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Custom domain %v requires %v to be an authorized redirect URI of OAuth client %v; "+
+				"add it to the client at %v and retry", kfDef.Spec.Hostname, redirectURI, iap.OAuthClientId, clientsURL),
+		}
+	}
+	return nil
+}
+
+// isInDomain returns true if hostname is domain or a subdomain of it.
+func isInDomain(hostname string, domain string) bool {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	return hostname == domain || strings.HasSuffix(hostname, "."+domain)
+}
+
+// VerifyDomainOwnership checks that the caller owns the custom domain of the deployment.
+//
+// Ownership is established if the hostname is in the Cloud DNS managed zone configured in the
+// Endpoint spec or if the caller has verified the domain (or a parent domain) with Site Verification.
+// Hostnames managed by Cloud Endpoints don't need to be verified.
+func VerifyDomainOwnership(ctx context.Context, client *http.Client, kfDef *kfdefs.KfDef) error {
+	if !IsCustomDomain(kfDef) {
+		return nil
+	}
+
+	pluginSpec := &GcpPluginSpec{}
+	if err := kfDef.GetPluginSpec(GcpPluginName, pluginSpec); err != nil && !kfdefs.IsPluginNotFound(err) {
+		return err
+	}
+
+	if pluginSpec.Endpoint != nil && pluginSpec.Endpoint.DNS != nil {
+		provider, err := newCloudDNSProvider(client, kfDef.Spec.Project, pluginSpec.Endpoint.DNS)
+		if err != nil {
+			return err
+		}
+		zone, err := provider.service.ManagedZones.Get(provider.project, provider.zone).Context(ctx).Do()
+		if err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("Could not get managed zone %v in project %v: %v", provider.zone, provider.project, err),
+			}
+		}
+		if !isInDomain(kfDef.Spec.Hostname, zone.DnsName) {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("hostname %v isn't in managed zone %v (%v)", kfDef.Spec.Hostname, provider.zone, zone.DnsName),
+			}
+		}
+		log.Infof("Hostname %v is in managed zone %v", kfDef.Spec.Hostname, provider.zone)
+		return nil
+	}
+
+	service, err := siteverification.New(client)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating site verification client: %v", err),
+		}
+	}
+
+	res, err := service.WebResource.List().Context(ctx).Do()
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error listing verified domains: %v", err),
+		}
+	}
+
+	for _, r := range res.Items {
+		if r.Site == nil || r.Site.Type != "INET_DOMAIN" {
+			continue
+		}
+		if isInDomain(kfDef.Spec.Hostname, r.Site.Identifier) {
+			log.Infof("Hostname %v is in verified domain %v", kfDef.Spec.Hostname, r.Site.Identifier)
+			return nil
+		}
+	}
+
+	return &kfapis.KfError{
+		Code: int(kfapis.INVALID_ARGUMENT),
+		Message: fmt.Sprintf("Could not verify you own the domain of %v; verify the domain at "+
+			"https://search.google.com/search-console or configure a Cloud DNS managed zone containing it.", kfDef.Spec.Hostname),
+	}
+}
@@ -0,0 +1,135 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"golang.org/x/net/context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIsCustomDomain(t *testing.T) {
+	type testCase struct {
+		hostname string
+		expected bool
+	}
+
+	cases := []testCase{
+		{
+			hostname: "",
+			expected: false,
+		},
+		{
+			hostname: "kf-app.endpoints.acme.cloud.goog",
+			expected: false,
+		},
+		{
+			hostname: "kubeflow.acme.com",
+			expected: true,
+		},
+	}
+
+	for _, c := range cases {
+		d := &kfdefs.KfDef{
+			Spec: kfdefs.KfDefSpec{
+				Hostname: c.hostname,
+			},
+		}
+		if actual := IsCustomDomain(d); actual != c.expected {
+			t.Errorf("IsCustomDomain(%v): got %v; want %v", c.hostname, actual, c.expected)
+		}
+	}
+}
+
+func TestIsInDomain(t *testing.T) {
+	type testCase struct {
+		hostname string
+		domain   string
+		expected bool
+	}
+
+	cases := []testCase{
+		{
+			hostname: "kubeflow.acme.com",
+			domain:   "acme.com",
+			expected: true,
+		},
+		{
+			// Cloud DNS zones are fully qualified.
+			hostname: "kubeflow.acme.com",
+			domain:   "acme.com.",
+			expected: true,
+		},
+		{
+			hostname: "Acme.com",
+			domain:   "acme.com",
+			expected: true,
+		},
+		{
+			// The apex of a Cloud DNS zone.
+			hostname: "acme.com",
+			domain:   "acme.com.",
+			expected: true,
+		},
+		{
+			hostname: "kubeflow.notacme.com",
+			domain:   "acme.com",
+			expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		if actual := isInDomain(c.hostname, c.domain); actual != c.expected {
+			t.Errorf("isInDomain(%v, %v): got %v; want %v", c.hostname, c.domain, actual, c.expected)
+		}
+	}
+}
+
+func TestCheckIAPRedirectURI(t *testing.T) {
+	type testCase struct {
+		name     string
+		hostname string
+		body     string
+		contains string
+	}
+
+	cases := []testCase{
+		{
+			name:     "authorized",
+			hostname: "kubeflow.acme.com",
+			body:     `{"error": "invalid_grant"}`,
+		},
+		{
+			name:     "not authorized",
+			hostname: "kubeflow.acme.com",
+			body:     `{"error": "redirect_uri_mismatch"}`,
+			contains: "https://kubeflow.acme.com" + IAP_REDIRECT_PATH,
+		},
+		{
+			name:     "wrong secret",
+			hostname: "kubeflow.acme.com",
+			body:     `{"error": "invalid_client"}`,
+			contains: "secret is wrong",
+		},
+		{
+			name:     "cloud endpoints",
+			hostname: "kf-app.endpoints.acme.cloud.goog",
+		},
+	}
+
+	for _, c := range cases {
+		d := newOAuthTestKfDef(t, "123-abc"+oauthClientIdSuffix)
+		d.Spec.Hostname = c.hostname
+		f := &fakeRoundTripper{codes: []int{http.StatusBadRequest}, bodies: []string{c.body}}
+		err := CheckIAPRedirectURI(context.Background(), &http.Client{Transport: f}, d)
+		if c.contains == "" {
+			if err != nil {
+				t.Errorf("%v: CheckIAPRedirectURI error; %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.contains) {
+			t.Errorf("%v: got error %v; want it to contain %v", c.name, err, c.contains)
+		}
+	}
+}
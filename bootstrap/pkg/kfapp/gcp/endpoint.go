@@ -0,0 +1,372 @@
+package gcp
+
+import (
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/dns/v1"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CertProvider identifies how the TLS certificate for the endpoint is obtained.
+type CertProvider string
+
+const (
+	// CertProviderManaged uses a Google managed certificate.
+	CertProviderManaged CertProvider = "managed"
+	// CertProviderLetsEncrypt uses cert-manager to obtain a certificate from Let's Encrypt.
+	CertProviderLetsEncrypt CertProvider = "letsencrypt"
+
+	// Names of the applications and overlays configured for the endpoint.
+	CERT_MANAGER_APP     = "cert-manager"
+	MANAGED_CERT_OVERLAY = "managed-cert"
+	DEFAULT_ISSUER       = "letsencrypt-prod"
+	DEFAULT_DNS_TTL      = 300
+)
+
+// EndpointSpec configures DNS and certificates for the Kubeflow endpoint.
+type EndpointSpec struct {
+	// DNS if set creates an A record for spec.hostname in a Cloud DNS managed zone
+	// instead of using Cloud Endpoints.
+	DNS *CloudDNS `json:"dns,omitempty"`
+
+	// Certificate configures the TLS certificate. Defaults to a managed certificate.
+	Certificate *Certificate `json:"certificate,omitempty"`
+}
+
+type CloudDNS struct {
+	// ManagedZone is the name of the Cloud DNS zone that contains the hostname.
+	ManagedZone string `json:"managedZone,omitempty"`
+	// Project owning the managed zone; defaults to the project of the deployment.
+	Project string `json:"project,omitempty"`
+	// TTL of the record in seconds.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+type Certificate struct {
+	Provider CertProvider `json:"provider,omitempty"`
+	// AcmeEmail is the email registered with Let's Encrypt; required for letsencrypt.
+	AcmeEmail string `json:"acmeEmail,omitempty"`
+	// Issuer is the name of the cert-manager issuer; defaults to letsencrypt-prod.
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// IsValid returns true if the spec is valid.
+// If false it will also return a string providing a message about why its invalid.
+func (s *EndpointSpec) IsValid() (bool, string) {
+	if s.DNS != nil && s.DNS.ManagedZone == "" {
+		return false, "Endpoint.DNS requires managedZone. "
+	}
+
+	if s.Certificate == nil {
+		return true, ""
+	}
+
+	switch s.Certificate.Provider {
+	case "", CertProviderManaged:
+		return true, ""
+	case CertProviderLetsEncrypt:
+		if s.Certificate.AcmeEmail == "" {
+			return false, "Endpoint.Certificate provider letsencrypt requires acmeEmail. "
+		}
+		return true, ""
+	default:
+		return false, fmt.Sprintf("Endpoint.Certificate.Provider %v isn't supported; must be one of %v, %v. ",
+			s.Certificate.Provider, CertProviderManaged, CertProviderLetsEncrypt)
+	}
+}
+
+// GetCertProvider returns the certificate provider; defaults to CertProviderManaged.
+func (s *EndpointSpec) GetCertProvider() CertProvider {
+	if s == nil || s.Certificate == nil || s.Certificate.Provider == "" {
+		return CertProviderManaged
+	}
+	return s.Certificate.Provider
+}
+
+// DNSProvider manages the DNS record for the Kubeflow endpoint.
+type DNSProvider interface {
+	// EnsureRecord creates or updates the A record for hostname to point at ip.
+	EnsureRecord(ctx context.Context, hostname string, ip string) error
+	// DeleteRecord deletes the A record for hostname if it exists.
+	DeleteRecord(ctx context.Context, hostname string) error
+}
+
+// cloudDNSProvider is a DNSProvider using a Cloud DNS managed zone.
+type cloudDNSProvider struct {
+	service *dns.Service
+	project string
+	zone    string
+	ttl     int64
+}
+
+func newCloudDNSProvider(client *http.Client, project string, spec *CloudDNS) (*cloudDNSProvider, error) {
+	service, err := dns.New(client)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating Cloud DNS client: %v", err),
+		}
+	}
+
+	p := &cloudDNSProvider{
+		service: service,
+		project: project,
+		zone:    spec.ManagedZone,
+		ttl:     spec.TTL,
+	}
+
+	if spec.Project != "" {
+		p.project = spec.Project
+	}
+
+	if p.ttl == 0 {
+		p.ttl = DEFAULT_DNS_TTL
+	}
+	return p, nil
+}
+
+// fqdn returns the hostname as a fully qualified domain name as expected by Cloud DNS.
+func fqdn(hostname string) string {
+	if strings.HasSuffix(hostname, ".") {
+		return hostname
+	}
+	return hostname + "."
+}
+
+// getRecord returns the existing A record for hostname or nil if there isn't one.
+func (p *cloudDNSProvider) getRecord(ctx context.Context, hostname string) (*dns.ResourceRecordSet, error) {
+	res, err := p.service.ResourceRecordSets.List(p.project, p.zone).Name(fqdn(hostname)).Type("A").Context(ctx).Do()
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error listing records in managed zone %v: %v", p.zone, err),
+		}
+	}
+	if len(res.Rrsets) == 0 {
+		return nil, nil
+	}
+	return res.Rrsets[0], nil
+}
+
+// applyChange submits the change and waits for it to be done.
+func (p *cloudDNSProvider) applyChange(ctx context.Context, change *dns.Change) error {
+	op, err := p.service.Changes.Create(p.project, p.zone, change).Context(ctx).Do()
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error updating managed zone %v: %v", p.zone, err),
+		}
+	}
+
+	id := op.Id
+	for op.Status != "done" {
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+		log.Infof("Waiting for DNS change %v to be done; status %v", id, op.Status)
+		if op, err = p.service.Changes.Get(p.project, p.zone, id).Context(ctx).Do(); err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("Error getting DNS change %v: %v", id, err),
+			}
+		}
+	}
+	return nil
+}
+
+func (p *cloudDNSProvider) EnsureRecord(ctx context.Context, hostname string, ip string) error {
+	zone, err := p.service.ManagedZones.Get(p.project, p.zone).Context(ctx).Do()
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error getting managed zone %v in project %v: %v", p.zone, p.project, err),
+		}
+	}
+
+	if !isInDomain(hostname, zone.DnsName) {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("hostname %v isn't in managed zone %v (%v)", hostname, p.zone, zone.DnsName),
+		}
+	}
+
+	existing, err := p.getRecord(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && len(existing.Rrdatas) == 1 && existing.Rrdatas[0] == ip && existing.Ttl == p.ttl {
+		log.Infof("DNS record %v -> %v is up to date", hostname, ip)
+		return nil
+	}
+
+	change := &dns.Change{
+		Additions: []*dns.ResourceRecordSet{
+			{
+				Name:    fqdn(hostname),
+				Type:    "A",
+				Ttl:     p.ttl,
+				Rrdatas: []string{ip},
+			},
+		},
+	}
+
+	if existing != nil {
+		change.Deletions = []*dns.ResourceRecordSet{existing}
+	}
+
+	log.Infof("Setting DNS record %v -> %v in managed zone %v", hostname, ip, p.zone)
+	return p.applyChange(ctx, change)
+}
+
+func (p *cloudDNSProvider) DeleteRecord(ctx context.Context, hostname string) error {
+	existing, err := p.getRecord(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		log.Infof("DNS record %v not found in managed zone %v; nothing to delete", hostname, p.zone)
+		return nil
+	}
+
+	log.Infof("Deleting DNS record %v in managed zone %v", hostname, p.zone)
+	return p.applyChange(ctx, &dns.Change{
+		Deletions: []*dns.ResourceRecordSet{existing},
+	})
+}
+
+// getDNSProvider returns the DNSProvider for the deployment or nil if DNS is handled by Cloud Endpoints.
+func (gcp *Gcp) getDNSProvider(pluginSpec *GcpPluginSpec) (DNSProvider, error) {
+	if pluginSpec.Endpoint == nil || pluginSpec.Endpoint.DNS == nil {
+		return nil, nil
+	}
+	if gcp.dnsProvider != nil {
+		return gcp.dnsProvider, nil
+	}
+	return newCloudDNSProvider(gcp.client, gcp.kfDef.Spec.Project, pluginSpec.Endpoint.DNS)
+}
+
+// getIngressIP returns the address of the global static IP reserved for the ingress.
+func (gcp *Gcp) getIngressIP(ctx context.Context) (string, error) {
+	computeService, err := compute.New(gcp.client)
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating compute client: %v", err),
+		}
+	}
+
+	address, err := computeService.GlobalAddresses.Get(gcp.kfDef.Spec.Project, gcp.kfDef.Spec.IpName).Context(ctx).Do()
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error getting address %v: %v", gcp.kfDef.Spec.IpName, err),
+		}
+	}
+	return address.Address, nil
+}
+
+// ensureDNSRecord points the hostname at the ingress IP if DNS is managed by kfctl.
+func (gcp *Gcp) ensureDNSRecord(ctx context.Context, pluginSpec *GcpPluginSpec) error {
+	provider, err := gcp.getDNSProvider(pluginSpec)
+	if err != nil || provider == nil {
+		return err
+	}
+
+	ip, err := gcp.getIngressIP(ctx)
+	if err != nil {
+		return err
+	}
+	return provider.EnsureRecord(ctx, gcp.kfDef.Spec.Hostname, ip)
+}
+
+// deleteDNSRecord deletes the record created by ensureDNSRecord.
+func (gcp *Gcp) deleteDNSRecord(ctx context.Context, pluginSpec *GcpPluginSpec) error {
+	provider, err := gcp.getDNSProvider(pluginSpec)
+	if err != nil || provider == nil {
+		return err
+	}
+	return provider.DeleteRecord(ctx, gcp.kfDef.Spec.Hostname)
+}
+
+// getIngressApp returns the name of the application creating the ingress.
+func (gcp *Gcp) getIngressApp() string {
+	return ingressApp(gcp.kfDef)
+}
+
+// configureCertificate sets the overlays and parameters of the ingress and cert-manager
+// applications for the certificate provider.
+func (gcp *Gcp) configureCertificate(pluginSpec *GcpPluginSpec) error {
+	ingressApp := gcp.getIngressApp()
+	provider := pluginSpec.Endpoint.GetCertProvider()
+
+	if err := setApplicationOverlay(gcp.kfDef, ingressApp, MANAGED_CERT_OVERLAY, provider == CertProviderManaged); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if provider != CertProviderLetsEncrypt {
+		return nil
+	}
+
+	issuer := pluginSpec.Endpoint.Certificate.Issuer
+	if issuer == "" {
+		issuer = DEFAULT_ISSUER
+	}
+
+	if err := gcp.kfDef.SetApplicationParameter(ingressApp, "issuer", issuer); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := gcp.kfDef.SetApplicationParameter(CERT_MANAGER_APP, "acmeEmail", pluginSpec.Endpoint.Certificate.AcmeEmail); err != nil {
+		if kfdefs.IsAppNotFound(err) {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("certificate provider %v requires application %v", CertProviderLetsEncrypt, CERT_MANAGER_APP),
+			}
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// setApplicationOverlay adds or removes the overlay from the application.
+func setApplicationOverlay(d *kfdefs.KfDef, appName string, overlay string, enabled bool) error {
+	for i, a := range d.Spec.Applications {
+		if a.Name != appName {
+			continue
+		}
+
+		if a.KustomizeConfig == nil {
+			return fmt.Errorf("Application %v doesn't have KustomizeConfig", appName)
+		}
+
+		overlays := []string{}
+		found := false
+		for _, o := range a.KustomizeConfig.Overlays {
+			if o == overlay {
+				found = true
+				if !enabled {
+					continue
+				}
+			}
+			overlays = append(overlays, o)
+		}
+
+		if enabled && !found {
+			overlays = append(overlays, overlay)
+		}
+		d.Spec.Applications[i].KustomizeConfig.Overlays = overlays
+		return nil
+	}
+	return &kfdefs.AppNotFound{Name: appName}
+}
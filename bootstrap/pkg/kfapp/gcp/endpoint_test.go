@@ -0,0 +1,199 @@
+package gcp
+
+import (
+	"github.com/ghodss/yaml"
+	"golang.org/x/net/context"
+	"reflect"
+	"testing"
+)
+
+func TestEndpointSpec_IsValid(t *testing.T) {
+	type testCase struct {
+		input    *EndpointSpec
+		expected bool
+	}
+
+	cases := []testCase{
+		{
+			input:    &EndpointSpec{},
+			expected: true,
+		},
+		{
+			input: &EndpointSpec{
+				DNS: &CloudDNS{},
+			},
+			expected: false,
+		},
+		{
+			input: &EndpointSpec{
+				DNS: &CloudDNS{
+					ManagedZone: "kubeflow-zone",
+				},
+				Certificate: &Certificate{
+					Provider: CertProviderManaged,
+				},
+			},
+			expected: true,
+		},
+		{
+			input: &EndpointSpec{
+				Certificate: &Certificate{
+					Provider: CertProviderLetsEncrypt,
+				},
+			},
+			expected: false,
+		},
+		{
+			input: &EndpointSpec{
+				Certificate: &Certificate{
+					Provider:  CertProviderLetsEncrypt,
+					AcmeEmail: "jlewi@acme.com",
+				},
+			},
+			expected: true,
+		},
+		{
+			input: &EndpointSpec{
+				Certificate: &Certificate{
+					Provider: "selfsigned",
+				},
+			},
+			expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		isValid, msg := c.input.IsValid()
+
+		if isValid != c.expected {
+			pSpec, _ := yaml.Marshal(c.input)
+			t.Errorf("Spec %v;\n IsValid Got %v; want %v; msg %v", string(pSpec), isValid, c.expected, msg)
+		}
+	}
+}
+
+func TestGcp_configureCertificate(t *testing.T) {
+	type testCase struct {
+		endpoint         *EndpointSpec
+		expectedOverlays []string
+		expectedIssuer   string
+		expectedEmail    string
+	}
+
+	cases := []testCase{
+		{
+			endpoint:         &EndpointSpec{},
+			expectedOverlays: []string{"gcp-credentials", MANAGED_CERT_OVERLAY},
+		},
+		{
+			endpoint: &EndpointSpec{
+				Certificate: &Certificate{
+					Provider:  CertProviderLetsEncrypt,
+					AcmeEmail: "jlewi@acme.com",
+				},
+			},
+			expectedOverlays: []string{"gcp-credentials"},
+			expectedIssuer:   DEFAULT_ISSUER,
+			expectedEmail:    "jlewi@acme.com",
+		},
+		{
+			endpoint: &EndpointSpec{
+				Certificate: &Certificate{
+					Provider:  CertProviderLetsEncrypt,
+					AcmeEmail: "jlewi@acme.com",
+					Issuer:    "letsencrypt-staging",
+				},
+			},
+			expectedOverlays: []string{"gcp-credentials"},
+			expectedIssuer:   "letsencrypt-staging",
+			expectedEmail:    "jlewi@acme.com",
+		},
+	}
+
+	for _, c := range cases {
+		gcp := &Gcp{
+			kfDef: &kfdefs.KfDef{
+				Spec: kfdefs.KfDefSpec{
+					Applications: []kfdefs.Application{
+						{
+							Name: "iap-ingress",
+							KustomizeConfig: &kfdefs.KustomizeConfig{
+								Overlays: []string{"gcp-credentials", MANAGED_CERT_OVERLAY},
+							},
+						},
+						{
+							Name:            CERT_MANAGER_APP,
+							KustomizeConfig: &kfdefs.KustomizeConfig{},
+						},
+					},
+				},
+			},
+		}
+
+		if err := gcp.configureCertificate(&GcpPluginSpec{Endpoint: c.endpoint}); err != nil {
+			t.Errorf("configureCertificate error; %v", err)
+			continue
+		}
+
+		overlays := gcp.kfDef.Spec.Applications[0].KustomizeConfig.Overlays
+		if !reflect.DeepEqual(overlays, c.expectedOverlays) {
+			t.Errorf("Got overlays %v; want %v", overlays, c.expectedOverlays)
+		}
+
+		issuer, _ := gcp.kfDef.GetApplicationParameter("iap-ingress", "issuer")
+		if issuer != c.expectedIssuer {
+			t.Errorf("Got issuer %v; want %v", issuer, c.expectedIssuer)
+		}
+
+		email, _ := gcp.kfDef.GetApplicationParameter(CERT_MANAGER_APP, "acmeEmail")
+		if email != c.expectedEmail {
+			t.Errorf("Got acmeEmail %v; want %v", email, c.expectedEmail)
+		}
+	}
+}
+
+type fakeDNSProvider struct {
+	deleted []string
+}
+
+func (f *fakeDNSProvider) EnsureRecord(ctx context.Context, hostname string, ip string) error {
+	return nil
+}
+
+func (f *fakeDNSProvider) DeleteRecord(ctx context.Context, hostname string) error {
+	f.deleted = append(f.deleted, hostname)
+	return nil
+}
+
+func TestGcp_deleteDNSRecord(t *testing.T) {
+	provider := &fakeDNSProvider{}
+	gcp := &Gcp{
+		kfDef: &kfdefs.KfDef{
+			Spec: kfdefs.KfDefSpec{
+				Hostname: "kubeflow.acme.com",
+			},
+		},
+		dnsProvider: provider,
+	}
+
+	// DNS is managed by Cloud Endpoints so there is nothing to delete.
+	if err := gcp.deleteDNSRecord(context.Background(), &GcpPluginSpec{}); err != nil {
+		t.Fatalf("deleteDNSRecord error; %v", err)
+	}
+
+	spec := &GcpPluginSpec{
+		Endpoint: &EndpointSpec{
+			DNS: &CloudDNS{
+				ManagedZone: "acme-zone",
+			},
+		},
+	}
+
+	if err := gcp.deleteDNSRecord(context.Background(), spec); err != nil {
+		t.Fatalf("deleteDNSRecord error; %v", err)
+	}
+
+	if !reflect.DeepEqual(provider.deleted, []string{"kubeflow.acme.com"}) {
+		t.Errorf("Got deleted records %v; want [kubeflow.acme.com]", provider.deleted)
+	}
+}
@@ -0,0 +1,150 @@
+package gcp
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// cloudSQLDatabaseVersion is the MySQL version of the Cloud SQL instances; the version of the
+// in-cluster MySQL.
+const cloudSQLDatabaseVersion = "MYSQL_5_7"
+
+// externalStorageDeployment returns the name of the DM deployment creating the external storage.
+// It ends with -storage so it is only deleted with the deployment if DeleteStorage is set.
+func externalStorageDeployment(kfDef *kfdefs.KfDef) string {
+	return kfDef.Name + "-external-storage"
+}
+
+// storageRegion returns the region the external storage of a deployment is created in.
+func storageRegion(kfDef *kfdefs.KfDef) string {
+	if kfDef.Spec.Region != "" {
+		return kfDef.Spec.Region
+	}
+	return zoneRegion(kfDef.Spec.Zone)
+}
+
+// cloudSQLConnectionName returns the connection name of the Cloud SQL instance of a deployment
+// which the Cloud SQL proxy connects to.
+func cloudSQLConnectionName(kfDef *kfdefs.KfDef) string {
+	return fmt.Sprintf("%v:%v:%v", kfDef.Spec.Project, storageRegion(kfDef), kfDef.CloudSQLInstanceName())
+}
+
+// externalStorageResources returns the DM resources creating the external storage of the KfDef;
+// the Cloud SQL instance and its user if the database is a Cloud SQL instance and the bucket if
+// the object store should be created. It is empty if there is nothing to create.
+func externalStorageResources(kfDef *kfdefs.KfDef) ([]interface{}, error) {
+	resources := []interface{}{}
+	storage := kfDef.Spec.ExternalStorage
+	if storage == nil {
+		return resources, nil
+	}
+	region := storageRegion(kfDef)
+	if db := storage.Database; db != nil && db.CloudSQL != nil {
+		password, err := kfDef.GetSecret(db.PasswordSecret)
+		if err != nil {
+			return nil, err
+		}
+		tier := db.CloudSQL.Tier
+		if tier == "" {
+			tier = kfdefs.DefaultCloudSQLTier
+		}
+		instance := kfDef.CloudSQLInstanceName()
+		resources = append(resources,
+			map[string]interface{}{
+				"name": instance,
+				"type": "sqladmin.v1beta4.instance",
+				"properties": map[string]interface{}{
+					"region":          region,
+					"databaseVersion": cloudSQLDatabaseVersion,
+					"settings": map[string]interface{}{
+						"tier": tier,
+						"backupConfiguration": map[string]interface{}{
+							"enabled":          true,
+							"binaryLogEnabled": true,
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"name": instance + "-" + db.User,
+				"type": "sqladmin.v1beta4.user",
+				"properties": map[string]interface{}{
+					"name":     db.User,
+					"host":     "%",
+					"instance": fmt.Sprintf("$(ref.%v.name)", instance),
+					"password": password,
+				},
+			})
+	}
+	if store := storage.ObjectStore; store != nil && store.CreateBucket {
+		resources = append(resources, map[string]interface{}{
+			"name": store.Bucket,
+			"type": "storage.v1.bucket",
+			"properties": map[string]interface{}{
+				"location": region,
+			},
+		})
+	}
+	return resources, nil
+}
+
+// writeExternalStorageConfig writes the DM config creating the external storage of the KfDef to
+// the gcp_config directory; a stale config is removed if there is nothing to create. The config
+// holds the password of the database user so only the owner can read it.
+func (gcp *Gcp) writeExternalStorageConfig() error {
+	dest := path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, EXTERNAL_STORAGE_FILE)
+	resources, err := externalStorageResources(gcp.kfDef)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error when reading the credentials of the external storage: %v", err),
+		}
+	}
+	if len(resources) == 0 {
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("Error when removing %v: %v", dest, err),
+			}
+		}
+		return nil
+	}
+
+	log.Infof("Configuring the external storage of pipelines and metadata")
+	buf, err := yaml.Marshal(map[string]interface{}{"resources": resources})
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error when marshaling for %v: %v", dest, err),
+		}
+	}
+	if err = ioutil.WriteFile(dest, buf, 0600); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error when writing to %v: %v", dest, err),
+		}
+	}
+	return nil
+}
+
+// setExternalStorageParameters points the Cloud SQL proxy replacing the in-cluster MySQL at the
+// Cloud SQL instance of the deployment.
+func (gcp *Gcp) setExternalStorageParameters() error {
+	storage := gcp.kfDef.Spec.ExternalStorage
+	if storage == nil || storage.Database == nil || storage.Database.CloudSQL == nil {
+		return nil
+	}
+	err := gcp.kfDef.SetApplicationParameter("mysql", "cloudSqlInstance", cloudSQLConnectionName(gcp.kfDef))
+	if kfdefs.IsAppNotFound(err) {
+		log.Warnf("MySQL isn't included; the Cloud SQL proxy must be deployed to reach instance %v",
+			gcp.kfDef.CloudSQLInstanceName())
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestExternalStorageResources(t *testing.T) {
+	kfDef := &kfdefs.KfDef{
+		ObjectMeta: metav1.ObjectMeta{Name: "kf-app"},
+		Spec: kfdefs.KfDefSpec{
+			Project: "my-project",
+			Zone:    "us-east1-d",
+			Secrets: []kfdefs.Secret{
+				{
+					Name:         "mysql-password",
+					SecretSource: &kfdefs.SecretSource{LiteralSource: &kfdefs.LiteralSource{Value: "pw"}},
+				},
+			},
+		},
+	}
+
+	if resources, err := externalStorageResources(kfDef); err != nil || len(resources) != 0 {
+		t.Errorf("externalStorageResources without external storage: got %v, %v; want none", resources, err)
+	}
+
+	kfDef.Spec.ExternalStorage = &kfdefs.ExternalStorage{
+		Database: &kfdefs.ExternalDatabase{
+			User:           "kubeflow",
+			PasswordSecret: "mysql-password",
+			CloudSQL:       &kfdefs.CloudSQLInstance{},
+		},
+		ObjectStore: &kfdefs.ExternalObjectStore{
+			Bucket:       "kf-app-artifacts",
+			CreateBucket: true,
+		},
+	}
+	resources, err := externalStorageResources(kfDef)
+	if err != nil {
+		t.Fatalf("externalStorageResources: %v", err)
+	}
+	if len(resources) != 3 {
+		t.Fatalf("externalStorageResources: got %v resources; want 3", len(resources))
+	}
+
+	instance := resources[0].(map[string]interface{})
+	properties := instance["properties"].(map[string]interface{})
+	settings := properties["settings"].(map[string]interface{})
+	if instance["name"] != "kf-app-mysql" || properties["region"] != "us-east1" || settings["tier"] != kfdefs.DefaultCloudSQLTier {
+		t.Errorf("Cloud SQL instance: got %v", instance)
+	}
+	user := resources[1].(map[string]interface{})["properties"].(map[string]interface{})
+	if user["name"] != "kubeflow" || user["password"] != "pw" || user["instance"] != "$(ref.kf-app-mysql.name)" {
+		t.Errorf("Cloud SQL user: got %v", user)
+	}
+	bucket := resources[2].(map[string]interface{})
+	if bucket["name"] != "kf-app-artifacts" || bucket["type"] != "storage.v1.bucket" {
+		t.Errorf("Bucket: got %v", bucket)
+	}
+
+	if name := cloudSQLConnectionName(kfDef); name != "my-project:us-east1:kf-app-mysql" {
+		t.Errorf("cloudSQLConnectionName: got %v", name)
+	}
+
+	kfDef.Spec.ExternalStorage.Database.PasswordSecret = "missing"
+	if _, err := externalStorageResources(kfDef); err == nil {
+		t.Errorf("externalStorageResources with a missing password: got nil; want error")
+	}
+}
@@ -22,7 +22,6 @@ import (
 	"github.com/cenkalti/backoff"
 	"github.com/deckarep/golang-set"
 	"github.com/ghodss/yaml"
-	"github.com/gogo/protobuf/proto"
 	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
 	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
 	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
@@ -68,20 +67,21 @@ import (
 
 // TODO: golint complains that we should not use all capital var name.
 const (
-	GCP_CONFIG        = "gcp_config"
-	CONFIG_FILE       = "cluster-kubeflow.yaml"
-	STORAGE_FILE      = "storage-kubeflow.yaml"
-	NETWORK_FILE      = "network.yaml"
-	GCFS_FILE         = "gcfs.yaml"
-	ADMIN_SECRET_NAME = "admin-gcp-sa"
-	USER_SECRET_NAME  = "user-gcp-sa"
-	KUBEFLOW_OAUTH    = "kubeflow-oauth"
-	IMPORTS           = "imports"
-	PATH              = "path"
-	CLIENT_ID         = "CLIENT_ID"
-	CLIENT_SECRET     = "CLIENT_SECRET"
-	BASIC_AUTH_SECRET = "kubeflow-login"
-	KUBECONFIG_FORMAT = "gke_{project}_{zone}_{cluster}"
+	GCP_CONFIG            = "gcp_config"
+	CONFIG_FILE           = "cluster-kubeflow.yaml"
+	STORAGE_FILE          = "storage-kubeflow.yaml"
+	EXTERNAL_STORAGE_FILE = "external-storage-kubeflow.yaml"
+	NETWORK_FILE          = "network.yaml"
+	GCFS_FILE             = "gcfs.yaml"
+	ADMIN_SECRET_NAME     = "admin-gcp-sa"
+	USER_SECRET_NAME      = "user-gcp-sa"
+	KUBEFLOW_OAUTH        = "kubeflow-oauth"
+	IMPORTS               = "imports"
+	PATH                  = "path"
+	CLIENT_ID             = "CLIENT_ID"
+	CLIENT_SECRET         = "CLIENT_SECRET"
+	BASIC_AUTH_SECRET     = "kubeflow-login"
+	KUBECONFIG_FORMAT     = "gke_{project}_{zone}_{cluster}"
 
 	// Plugin parameter constants
 	GcpPluginName               = kftypesv3.GCP
@@ -97,11 +97,27 @@ type Gcp struct {
 	client      *http.Client
 	tokenSource oauth2.TokenSource
 
+	// ownerTokenSource if non nil is the token source of the owner of the deployment when tokenSource
+	// is that of a deployer service account. Changes to IAM policies and service account keys are made
+	// with it so the deployer doesn't need roles allowing it to grant itself more permissions.
+	ownerTokenSource oauth2.TokenSource
+
 	// Function to get the GcpAccount.
 	// Support injection for testing.
 	gcpAccountGetter func() (string, error)
 
 	runGetCredentials bool
+
+	// dnsProvider overrides the provider created from the Endpoint spec.
+	// Support injection for testing.
+	dnsProvider DNSProvider
+
+	// secretsProvider overrides the provider created from the Secrets spec.
+	// Support injection for testing.
+	secretsProvider SecretsProvider
+
+	// dmStatusFunc if non nil is notified of the progress of the Deployment Manager deployments.
+	dmStatusFunc DMStatusFunc
 }
 
 type Setter interface {
@@ -109,6 +125,12 @@ type Setter interface {
 
 	// SetRunGetCredentials controls whether or not to run get credentials
 	SetRunGetCredentials(v bool)
+
+	// SetDMStatusFunc sets the function notified of the progress of the Deployment Manager deployments.
+	SetDMStatusFunc(f DMStatusFunc)
+
+	// SetOwnerTokenSource sets the token source of the owner of the deployment; see ownerTokenSource.
+	SetOwnerTokenSource(s oauth2.TokenSource)
 }
 
 func (gcp *Gcp) SetTokenSource(s oauth2.TokenSource) error {
@@ -116,12 +138,27 @@ func (gcp *Gcp) SetTokenSource(s oauth2.TokenSource) error {
 	return nil
 }
 
+func (gcp *Gcp) SetOwnerTokenSource(s oauth2.TokenSource) {
+	gcp.ownerTokenSource = s
+}
+
+// ownerClient returns a client authorized as the owner of the deployment.
+// If no owner token source is set the deployment runs with the owner's credentials.
+func (gcp *Gcp) ownerClient(ctx context.Context) *http.Client {
+	if gcp.ownerTokenSource == nil {
+		return NewClient(ctx, gcp.tokenSource)
+	}
+	return NewClient(ctx, gcp.ownerTokenSource)
+}
+
 func (gcp *Gcp) SetRunGetCredentials(v bool) {
 	gcp.runGetCredentials = v
 }
 
 type dmOperationEntry struct {
 	operationName string
+	// deployment is the name of the Deployment Manager deployment.
+	deployment string
 	// create or update dmName
 	action string
 }
@@ -179,7 +216,7 @@ func (gcp *Gcp) initGcpClient() error {
 	}
 
 	log.Infof("Creating GCP client.")
-	gcp.client = oauth2.NewClient(ctx, gcp.tokenSource)
+	gcp.client = NewClient(ctx, gcp.tokenSource)
 
 	return nil
 }
@@ -211,7 +248,7 @@ func (gcp *Gcp) GetK8sConfig() (*rest.Config, *clientcmdapi.Config) {
 	// a TokenSource which can then be pointed at either the DefaultTokenSource
 	// or the refreshable token source?
 	restConfig, err := utils.BuildClusterConfig(ctx, accessToken, gcp.kfDef.Spec.Project,
-		gcp.kfDef.Spec.Zone, gcp.kfDef.Name)
+		ClusterLocation(gcp.kfDef), gcp.kfDef.Name)
 	if err != nil {
 		return nil, nil
 	}
@@ -300,7 +337,7 @@ func generateTarget(configPath string) (*deploymentmanager.TargetConfiguration,
 
 func (gcp *Gcp) getK8sClientset(ctx context.Context) (*clientset.Clientset, error) {
 	cluster, err := utils.GetClusterInfo(ctx, gcp.kfDef.Spec.Project,
-		gcp.kfDef.Spec.Zone, gcp.kfDef.Name, gcp.tokenSource)
+		ClusterLocation(gcp.kfDef), gcp.kfDef.Name, gcp.tokenSource)
 	if err != nil {
 		return nil, &kfapis.KfError{
 			Code:    int(kfapis.INVALID_ARGUMENT),
@@ -325,8 +362,10 @@ func (gcp *Gcp) getK8sClientset(ctx context.Context) (*clientset.Clientset, erro
 	}
 }
 
+// blockingWait waits for the operations to finish. observe if non nil is called with each
+// operation every time it is polled.
 func blockingWait(project string, deploymentmanagerService *deploymentmanager.Service,
-	dmOperationEntries []*dmOperationEntry) error {
+	dmOperationEntries []*dmOperationEntry, observe func(*dmOperationEntry, *deploymentmanager.Operation)) error {
 	ctx := context.Background()
 	// Explicitly copy string to avoid memory leak.
 	p := "" + project
@@ -342,6 +381,9 @@ func blockingWait(project string, deploymentmanagerService *deploymentmanager.Se
 					Message: fmt.Sprintf("%v error: %v", dmEntry.action, err),
 				}
 			}
+			if observe != nil {
+				observe(dmEntry, op)
+			}
 			if op.Error != nil {
 				for _, e := range op.Error.Errors {
 					log.Errorf("%v error: %+v", dmEntry.action, e)
@@ -356,11 +398,15 @@ func blockingWait(project string, deploymentmanagerService *deploymentmanager.Se
 				}
 			}
 			if op.HttpErrorStatusCode > 0 {
+				message := fmt.Sprintf("%v error(%v): %v", dmEntry.action, op.HttpErrorStatusCode, op.HttpErrorMessage)
+				if op.Error != nil && len(op.Error.Errors) > 0 {
+					// Keep the errors of the resources so callers can tell why the operation failed
+					// e.g. the zone is out of capacity.
+					message += "; " + dmOperationErrorMessage(op.Error.Errors)
+				}
 				return backoff.Permanent(&kfapis.KfError{
-					Code: int(kfapis.INVALID_ARGUMENT),
-					Message: fmt.Sprintf("%v error(%v): %v",
-						dmEntry.action,
-						op.HttpErrorStatusCode, op.HttpErrorMessage),
+					Code:    int(kfapis.INVALID_ARGUMENT),
+					Message: message,
 				})
 			}
 			log.Infof("%v is finished: %v", dmEntry.action, op.Status)
@@ -417,6 +463,7 @@ func (gcp *Gcp) updateDeployment(deploymentmanagerService *deploymentmanager.Ser
 		}
 		return &dmOperationEntry{
 			operationName: opName,
+			deployment:    deployment,
 			action:        "Updating " + deployment,
 		}, nil
 	} else {
@@ -430,6 +477,7 @@ func (gcp *Gcp) updateDeployment(deploymentmanagerService *deploymentmanager.Ser
 		}
 		return &dmOperationEntry{
 			operationName: op.Name,
+			deployment:    deployment,
 			action:        "Creating " + deployment,
 		}, nil
 	}
@@ -544,7 +592,7 @@ func (gcp *Gcp) ConfigK8s() error {
 // Add a conveniently named context to KUBECONFIG.
 func (gcp *Gcp) AddNamedContext() error {
 	name := strings.Replace(KUBECONFIG_FORMAT, "{project}", gcp.kfDef.Spec.Project, 1)
-	name = strings.Replace(name, "{zone}", gcp.kfDef.Spec.Zone, 1)
+	name = strings.Replace(name, "{zone}", ClusterLocation(gcp.kfDef), 1)
 	name = strings.Replace(name, "{cluster}", gcp.kfDef.Name, 1)
 	log.Infof("KUBECONFIG name is %v", name)
 
@@ -649,7 +697,7 @@ func (gcp *Gcp) AddNamedContext() error {
 
 func (gcp *Gcp) updateDM(resources kftypesv3.ResourceEnum) error {
 	ctx := context.Background()
-	gcpClient := oauth2.NewClient(ctx, gcp.tokenSource)
+	gcpClient := gcp.ownerClient(ctx)
 	dmOperationEntries := []*dmOperationEntry{}
 	deploymentmanagerService, err := deploymentmanager.New(gcp.client)
 	if err != nil {
@@ -684,10 +732,19 @@ func (gcp *Gcp) updateDM(resources kftypesv3.ResourceEnum) error {
 		}
 		dmOperationEntries = append(dmOperationEntries, gcfsEntry)
 	}
+	if _, externalStatErr := os.Stat(path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, EXTERNAL_STORAGE_FILE)); externalStatErr == nil {
+		externalEntry, err := gcp.updateDeployment(deploymentmanagerService, externalStorageDeployment(gcp.kfDef), EXTERNAL_STORAGE_FILE)
+		if err != nil {
+			return kfapis.NewKfErrorWithMessage(err, fmt.Sprintf("could not update %v", EXTERNAL_STORAGE_FILE))
+		}
+		dmOperationEntries = append(dmOperationEntries, externalEntry)
+	}
 
-	if err = blockingWait(gcp.kfDef.Spec.Project, deploymentmanagerService, dmOperationEntries); err != nil {
+	if err = blockingWait(gcp.kfDef.Spec.Project, deploymentmanagerService, dmOperationEntries,
+		gcp.dmStatusRecorder(deploymentmanagerService)); err != nil {
 		return kfapis.NewKfErrorWithMessage(err, "could not update deployment manager entries")
 	}
+	gcp.recordDMInventory(deploymentmanagerService, dmOperationEntries)
 	exp := backoff.NewExponentialBackOff()
 	exp.InitialInterval = 1 * time.Second
 	exp.MaxInterval = 3 * time.Second
@@ -756,13 +813,17 @@ func (gcp *Gcp) updateDM(resources kftypesv3.ResourceEnum) error {
 
 	if gcp.runGetCredentials {
 		log.Infof("Running get-credentials to build .kubeconfig")
+		location := "--zone=" + ClusterZone(gcp.kfDef)
+		if gcp.kfDef.Spec.Region != "" {
+			location = "--region=" + gcp.kfDef.Spec.Region
+		}
 		credCmd := exec.Command("gcloud", "container", "clusters", "get-credentials",
 			gcp.kfDef.Name,
-			"--zone="+gcp.kfDef.Spec.Zone,
+			location,
 			"--project="+gcp.kfDef.Spec.Project)
 		credCmd.Stdout = os.Stdout
-		log.Infof("Running get-credentials %v --zone=%v --project=%v ...", gcp.kfDef.Name,
-			gcp.kfDef.Spec.Zone, gcp.kfDef.Spec.Project)
+		log.Infof("Running get-credentials %v %v --project=%v ...", gcp.kfDef.Name,
+			location, gcp.kfDef.Spec.Project)
 		if err := credCmd.Run(); err != nil {
 			return &kfapis.KfError{
 				Code:    int(kfapis.INVALID_ARGUMENT),
@@ -797,8 +858,18 @@ func (gcp *Gcp) Apply(resources kftypesv3.ResourceEnum) error {
 		return fmt.Errorf(msg)
 	}
 
-	// Update deployment manager
-	updateDMErr := gcp.updateDM(resources)
+	// Resolve the requested GKE version against the versions available in the cluster location.
+	if err := gcp.setClusterVersion(p.Cluster); err != nil {
+		return err
+	}
+
+	// Fail before creating the cluster if the region doesn't have the quota for its nodes.
+	if err := gcp.checkQuota(context.Background()); err != nil {
+		return err
+	}
+
+	// Update deployment manager; falls back to another zone if the zone is out of capacity.
+	updateDMErr := gcp.updateDMWithZoneFallback(resources, p)
 	if updateDMErr != nil {
 		return &kfapis.KfError{
 			Code: updateDMErr.(*kfapis.KfError).Code,
@@ -806,6 +877,10 @@ func (gcp *Gcp) Apply(resources kftypesv3.ResourceEnum) error {
 				updateDMErr.(*kfapis.KfError).Message),
 		}
 	}
+	// Point the hostname at the ingress IP reserved by deployment manager.
+	if err := gcp.ensureDNSRecord(context.Background(), p); err != nil {
+		return err
+	}
 	// Insert secrets into the cluster
 	secretsErr := gcp.createSecrets()
 	if secretsErr != nil {
@@ -865,9 +940,10 @@ func deleteDeployment(deploymentmanagerService *deploymentmanager.Service, ctx c
 	}
 	deleteEntry := []*dmOperationEntry{&dmOperationEntry{
 		operationName: op.Name,
+		deployment:    name,
 		action:        "Deleting " + name,
 	}}
-	if err = blockingWait(project, deploymentmanagerService, deleteEntry); err != nil {
+	if err = blockingWait(project, deploymentmanagerService, deleteEntry, nil); err != nil {
 		return &kfapis.KfError{
 			Code: err.(*kfapis.KfError).Code,
 			Message: fmt.Sprintf("Gcp.Delete is failed for %v/%v: %v",
@@ -879,6 +955,11 @@ func deleteDeployment(deploymentmanagerService *deploymentmanager.Service, ctx c
 
 // Delete endpoint service from resources.
 func (gcp *Gcp) deleteEndpoints(ctx context.Context) error {
+	if IsCustomDomain(gcp.kfDef) {
+		log.Infof("Hostname %v isn't managed by Cloud Endpoints; skipping endpoint deletion", gcp.kfDef.Spec.Hostname)
+		return nil
+	}
+
 	servicemanagementService, err := servicemanagement.New(gcp.client)
 	if err != nil {
 		return &kfapis.KfError{
@@ -974,6 +1055,12 @@ func (gcp *Gcp) Delete(resources kftypesv3.ResourceEnum) error {
 		}
 	}
 
+	if p, err := gcp.GetPluginSpec(); err == nil {
+		if err := gcp.deleteDNSRecord(ctx, p); err != nil {
+			return err
+		}
+	}
+
 	// cluster and storage deployments are required to be deleted. network and gcfs deployments are optional.
 	project := gcp.kfDef.Spec.Project
 	deletingDeployments := []string{
@@ -981,6 +1068,9 @@ func (gcp *Gcp) Delete(resources kftypesv3.ResourceEnum) error {
 	}
 	if gcp.kfDef.Spec.DeleteStorage {
 		deletingDeployments = append(deletingDeployments, gcp.kfDef.Name+"-storage")
+		if _, externalStatErr := os.Stat(path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, EXTERNAL_STORAGE_FILE)); externalStatErr == nil {
+			deletingDeployments = append(deletingDeployments, externalStorageDeployment(gcp.kfDef))
+		}
 	}
 	if _, networkStatErr := os.Stat(path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, NETWORK_FILE)); !os.IsNotExist(networkStatErr) {
 		deletingDeployments = append(deletingDeployments, gcp.kfDef.Name+"-network")
@@ -988,6 +1078,7 @@ func (gcp *Gcp) Delete(resources kftypesv3.ResourceEnum) error {
 	if _, gcfsStatErr := os.Stat(path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, GCFS_FILE)); !os.IsNotExist(gcfsStatErr) {
 		deletingDeployments = append(deletingDeployments, gcp.kfDef.Name+"-gcfs")
 	}
+	deletingDeployments = appendInventoryDeployments(gcp.kfDef, deletingDeployments)
 
 	for _, d := range deletingDeployments {
 		if err = deleteDeployment(deploymentmanagerService, ctx, project, d); err != nil {
@@ -995,7 +1086,14 @@ func (gcp *Gcp) Delete(resources kftypesv3.ResourceEnum) error {
 		}
 	}
 
-	policy, err := utils.GetIamPolicy(project, gcp.client)
+	// The endpoints are deleted while the deployer still has its roles.
+	if err = gcp.deleteEndpoints(ctx); err != nil {
+		return err
+	}
+
+	// The deployer can't change IAM policies so its bindings and service account are removed by the owner.
+	ownerClient := gcp.ownerClient(ctx)
+	policy, err := utils.GetIamPolicy(project, ownerClient)
 	if err != nil {
 		return &kfapis.KfError{
 			Code:    err.(*kfapis.KfError).Code,
@@ -1006,6 +1104,9 @@ func (gcp *Gcp) Delete(resources kftypesv3.ResourceEnum) error {
 		"serviceAccount:"+getSA(gcp.kfDef.Name, "admin", project),
 		"serviceAccount:"+getSA(gcp.kfDef.Name, "user", project),
 		"serviceAccount:"+getSA(gcp.kfDef.Name, "vm", project))
+	if deployer := DeployerServiceAccount(gcp.kfDef); deployer != "" {
+		saSet.Add("serviceAccount:" + deployer)
+	}
 	for idx, binding := range policy.Bindings {
 		cleanedMembers := []string{}
 		for _, member := range binding.Members {
@@ -1017,17 +1118,13 @@ func (gcp *Gcp) Delete(resources kftypesv3.ResourceEnum) error {
 		}
 		policy.Bindings[idx].Members = cleanedMembers
 	}
-	if err = utils.SetIamPolicy(project, policy, gcp.client); err != nil {
+	if err = utils.SetIamPolicy(project, policy, ownerClient); err != nil {
 		return &kfapis.KfError{
 			Code:    err.(*kfapis.KfError).Code,
 			Message: fmt.Sprintf("Error when cleaning IAM policy: %v", err.(*kfapis.KfError).Message),
 		}
 	}
-	if err = gcp.deleteEndpoints(ctx); err != nil {
-		return err
-	}
-
-	return nil
+	return gcp.deleteDeployerServiceAccount(ctx, ownerClient)
 }
 
 func (gcp *Gcp) copyFile(source string, dest string) error {
@@ -1123,6 +1220,13 @@ func (gcp *Gcp) writeIamBindingsFile(src string, dest string) error {
 			}
 		}
 	}
+	// The Cloud SQL proxy replacing the in-cluster MySQL runs as the user service account.
+	if s := gcp.kfDef.Spec.ExternalStorage; s != nil && s.Database != nil && s.Database.CloudSQL != nil {
+		bindings = append(bindings, map[string]interface{}{
+			"members": []string{roles["set-kubeflow-user-service-account"]},
+			"roles":   []string{"roles/cloudsql.client"},
+		})
+	}
 	data["bindings"] = bindings
 
 	if buf, err = yaml.Marshal(data); err != nil {
@@ -1169,6 +1273,9 @@ func (gcp *Gcp) writeClusterConfig(src string, dest string, gcpPluginSpec GcpPlu
 	}
 
 	resources := res.([]interface{})
+	if gcpPluginSpec.DeploymentManager != nil {
+		applyDMOverrides(resources, gcpPluginSpec.DeploymentManager.Cluster)
+	}
 	for idx, re := range resources {
 		resource := re.(map[string]interface{})
 		var properties map[string]interface{}
@@ -1178,7 +1285,10 @@ func (gcp *Gcp) writeClusterConfig(src string, dest string, gcpPluginSpec GcpPlu
 			properties = make(map[string]interface{})
 		}
 		properties["gkeApiVersion"] = kftypesv3.DefaultGkeApiVer
-		properties["zone"] = gcp.kfDef.Spec.Zone
+		properties["zone"] = ClusterZone(gcp.kfDef)
+		if gcp.kfDef.Spec.Region != "" {
+			properties["region"] = gcp.kfDef.Spec.Region
+		}
 		properties["users"] = []string{
 			gcp.getIapAccount(),
 		}
@@ -1188,6 +1298,10 @@ func (gcp *Gcp) writeClusterConfig(src string, dest string, gcpPluginSpec GcpPlu
 			properties["enable-workload-identity"] = true
 			properties["identity-namespace"] = gcp.kfDef.Spec.Project + ".svc.id.goog"
 		}
+		if gcpPluginSpec.Cluster != nil && gcpPluginSpec.Cluster.ReleaseChannel != "" {
+			properties["release-channel"] = gcpPluginSpec.Cluster.ReleaseChannel
+		}
+		setPreemptiblePoolProperties(properties, gcpPluginSpec.PreemptiblePool)
 		resources[idx] = resource
 	}
 	data["resources"] = resources
@@ -1209,7 +1323,7 @@ func (gcp *Gcp) writeClusterConfig(src string, dest string, gcpPluginSpec GcpPlu
 }
 
 // Replace placeholders and write to storage-kubeflow.yaml
-func (gcp *Gcp) writeStorageConfig(src string, dest string) error {
+func (gcp *Gcp) writeStorageConfig(src string, dest string, gcpPluginSpec GcpPluginSpec) error {
 	buf, err := ioutil.ReadFile(src)
 	if err != nil {
 		return &kfapis.KfError{
@@ -1235,6 +1349,9 @@ func (gcp *Gcp) writeStorageConfig(src string, dest string) error {
 	}
 
 	resources := res.([]interface{})
+	if gcpPluginSpec.DeploymentManager != nil {
+		applyDMOverrides(resources, gcpPluginSpec.DeploymentManager.Storage)
+	}
 	for idx, re := range resources {
 		resource := re.(map[string]interface{})
 		var properties map[string]interface{}
@@ -1243,7 +1360,7 @@ func (gcp *Gcp) writeStorageConfig(src string, dest string) error {
 		} else {
 			properties = make(map[string]interface{})
 		}
-		properties["zone"] = gcp.kfDef.Spec.Zone
+		properties["zone"] = ClusterZone(gcp.kfDef)
 		properties["createPipelinePersistentStorage"] = true
 		resource["properties"] = properties
 		resources[idx] = resource
@@ -1307,6 +1424,16 @@ func (gcp *Gcp) generateDMConfigs() error {
 		}
 	}
 
+	// Validate the overrides against the schemas of the templates before writing any configs.
+	if dm := pluginSpec.DeploymentManager; dm != nil {
+		if err := validateDMProperties(filepath.Join(sourceDir, "cluster.jinja.schema"), dm.Cluster); err != nil {
+			return err
+		}
+		if err := validateDMProperties(filepath.Join(sourceDir, "storage.jinja.schema"), dm.Storage); err != nil {
+			return err
+		}
+	}
+
 	// Reading from templates and write to gcp_config directory with content had placeholders
 	// replaced.
 	from := filepath.Join(sourceDir, "iam_bindings_template.yaml")
@@ -1323,10 +1450,13 @@ func (gcp *Gcp) generateDMConfigs() error {
 		log.Infof("Configuring pipelines persistent storage")
 		from = filepath.Join(sourceDir, STORAGE_FILE)
 		to = filepath.Join(gcpConfigDir, STORAGE_FILE)
-		if err := gcp.writeStorageConfig(from, to); err != nil {
+		if err := gcp.writeStorageConfig(from, to, *pluginSpec); err != nil {
 			return err
 		}
 	}
+	if err := gcp.writeExternalStorageConfig(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -1388,10 +1518,21 @@ func (gcp *Gcp) createGcpServiceAcctSecret(ctx context.Context, client *clientse
 	}
 
 	log.Infof("Secret for %v not found, creating ...", secretName)
-	oClient := oauth2.NewClient(ctx, gcp.tokenSource)
+	privateKeyData, err := gcp.newServiceAccountKey(ctx, email)
+	if err != nil {
+		return err
+	}
+	return insertSecret(client, secretName, namespace, map[string][]byte{
+		secretName + ".json": privateKeyData,
+	})
+}
+
+// newServiceAccountKey creates a key for the service account and returns the credentials file.
+func (gcp *Gcp) newServiceAccountKey(ctx context.Context, email string) ([]byte, error) {
+	oClient := gcp.ownerClient(ctx)
 	iamService, err := iam.New(oClient)
 	if err != nil {
-		return &kfapis.KfError{
+		return nil, &kfapis.KfError{
 			Code:    int(kfapis.INVALID_ARGUMENT),
 			Message: fmt.Sprintf("Get Oauth Client error: %v", err),
 		}
@@ -1404,21 +1545,19 @@ func (gcp *Gcp) createGcpServiceAcctSecret(ctx context.Context, client *clientse
 	}
 	saKey, err := iamService.Projects.ServiceAccounts.Keys.Create(name, req).Context(ctx).Do()
 	if err != nil {
-		return &kfapis.KfError{
+		return nil, &kfapis.KfError{
 			Code:    int(kfapis.INVALID_ARGUMENT),
 			Message: fmt.Sprintf("Service account key creation error: %v", err),
 		}
 	}
 	privateKeyData, err := base64.StdEncoding.DecodeString(saKey.PrivateKeyData)
 	if err != nil {
-		return &kfapis.KfError{
+		return nil, &kfapis.KfError{
 			Code:    int(kfapis.INTERNAL_ERROR),
 			Message: fmt.Sprintf("PrivateKeyData decoding error: %v", err),
 		}
 	}
-	return insertSecret(client, secretName, namespace, map[string][]byte{
-		secretName + ".json": privateKeyData,
-	})
+	return privateKeyData, nil
 }
 
 // User CLIENT_ID and CLIENT_SECRET from GCP to create a secret for IAP.
@@ -1449,24 +1588,37 @@ func (gcp *Gcp) createIapSecret(ctx context.Context, client *clientset.Clientset
 		return nil
 	}
 
+	secret, err := gcp.buildIapSecret(p, oauthSecretNamespace)
+	if err != nil {
+		return err
+	}
+
+	provider, err := gcp.getSecretsProvider(client)
+	if err != nil {
+		return err
+	}
+	return provider.WriteSecret(ctx, secret)
+}
+
+// buildIapSecret builds the secret containing the IAP OAuth client credentials.
+func (gcp *Gcp) buildIapSecret(p *GcpPluginSpec, namespace string) (*v1.Secret, error) {
 	oauthSecret, err := gcp.kfDef.GetSecret(p.Auth.IAP.OAuthClientSecret.Name)
 
 	if err != nil {
 		log.Errorf("Could not read IAP OAuth ClientSecret from KfDef; error %v", err)
-		return err
+		return nil, err
 	}
 
-	secret := &v1.Secret{
+	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      KUBEFLOW_OAUTH,
-			Namespace: oauthSecretNamespace,
+			Namespace: namespace,
 		},
 		Data: map[string][]byte{
 			strings.ToLower(CLIENT_ID):     []byte(p.Auth.IAP.OAuthClientId),
 			strings.ToLower(CLIENT_SECRET): []byte(oauthSecret),
 		},
-	}
-	return createOrUpdateSecret(client, secret)
+	}, nil
 }
 
 func base64EncryptPassword(password string) (string, error) {
@@ -1518,24 +1670,23 @@ func (gcp *Gcp) buildBasicAuthSecret() (*v1.Secret, error) {
 }
 
 // createBasicAuthSecret creates a secret containing basic auth information.
-func (gcp *Gcp) createBasicAuthSecret(client *clientset.Clientset) error {
+func (gcp *Gcp) createBasicAuthSecret(ctx context.Context, client *clientset.Clientset) error {
 	secret, err := gcp.buildBasicAuthSecret()
 
 	if err != nil {
 		return err
 	}
 
-	return createOrUpdateSecret(client, secret)
+	provider, err := gcp.getSecretsProvider(client)
+	if err != nil {
+		return err
+	}
+	return provider.WriteSecret(ctx, secret)
 }
 
+// getIstioNamespace returns the namespace of the ingress after applying the namespace layout.
 func (gcp *Gcp) getIstioNamespace() string {
-	if ingressNamespace, ok := gcp.kfDef.GetApplicationParameter("iap-ingress", "namespace"); ok {
-		return ingressNamespace
-	}
-	if ingressNamespace, ok := gcp.kfDef.GetApplicationParameter("basic-auth-ingress", "namespace"); ok {
-		return ingressNamespace
-	}
-	return gcp.kfDef.Namespace
+	return IngressNamespace(gcp.kfDef)
 }
 
 func (gcp *Gcp) createSecrets() error {
@@ -1574,7 +1725,7 @@ func (gcp *Gcp) createSecrets() error {
 		}
 	}
 	if gcp.kfDef.Spec.UseBasicAuth {
-		if err := gcp.createBasicAuthSecret(k8sClient); err != nil {
+		if err := gcp.createBasicAuthSecret(ctx, k8sClient); err != nil {
 			return kfapis.NewKfErrorWithMessage(err, "cannot create basic auth login secret")
 		}
 	} else {
@@ -1608,7 +1759,7 @@ func (gcp *Gcp) setupWorkloadIdentity(namespace string) error {
 		createK8sServiceAccount(k8sClient, namespace, k8sSa, "serviceAccount:"+gcpServiceAccounts[idx])
 	}
 
-	oClient := oauth2.NewClient(ctx, gcp.tokenSource)
+	oClient := gcp.ownerClient(ctx)
 	iamService, err := iam.New(oClient)
 	if err != nil {
 		return &kfapis.KfError{
@@ -1752,7 +1903,7 @@ func (gcp *Gcp) ConfigPodDefault() error {
 	kind := "PodDefault"
 	podDefault := generatePodDefault(group, version, kind, defaultNamespace)
 	cluster, err := utils.GetClusterInfo(ctx, gcp.kfDef.Spec.Project,
-		gcp.kfDef.Spec.Zone, gcp.kfDef.Name, gcp.tokenSource)
+		ClusterLocation(gcp.kfDef), gcp.kfDef.Name, gcp.tokenSource)
 	if err != nil {
 		return &kfapis.KfError{
 			Code:    int(kfapis.INVALID_ARGUMENT),
@@ -1841,14 +1992,13 @@ func (gcp *Gcp) setGcpPluginDefaults() error {
 	}
 
 	if pluginSpec.CreatePipelinePersistentStorage == nil {
-		pluginSpec.CreatePipelinePersistentStorage = proto.Bool(pluginSpec.GetCreatePipelinePersistentStorage())
-		log.Infof("CreatePipelinePersistentStorage not set defaulting to %v", *pluginSpec.CreatePipelinePersistentStorage)
+		log.Infof("CreatePipelinePersistentStorage not set defaulting to %v", pluginSpec.GetCreatePipelinePersistentStorage())
 	}
 
 	if pluginSpec.EnableWorkloadIdentity == nil {
-		pluginSpec.EnableWorkloadIdentity = proto.Bool(pluginSpec.GetEnableWorkloadIdentity())
-		log.Infof("EnableWorkloadIdentity not set defaulting to %v", *pluginSpec.EnableWorkloadIdentity)
+		log.Infof("EnableWorkloadIdentity not set defaulting to %v", pluginSpec.GetEnableWorkloadIdentity())
 	}
+	pluginSpec.SetDefaults()
 
 	if pluginSpec.Auth == nil {
 		pluginSpec.Auth = &Auth{}
@@ -1951,6 +2101,12 @@ func (gcp *Gcp) Generate(resources kftypesv3.ResourceEnum) error {
 		gcp.kfDef.Spec.IpName = gcp.kfDef.Name + "-ip"
 	}
 	if gcp.kfDef.Spec.Hostname == "" {
+		if pluginSpec.Endpoint != nil && pluginSpec.Endpoint.DNS != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: "hostname must be set when using a Cloud DNS managed zone.",
+			}
+		}
 		gcp.kfDef.Spec.Hostname = gcp.kfDef.Name + ".endpoints." + gcp.kfDef.Spec.Project + ".cloud.goog"
 	}
 
@@ -1978,6 +2134,9 @@ func (gcp *Gcp) Generate(resources kftypesv3.ResourceEnum) error {
 		return errors.WithStack(err)
 	}
 
+	// Schedule the pods of the training applications onto the preemptible pool.
+	gcp.setPreemptiblePlacement(pluginSpec.PreemptiblePool)
+
 	if gcp.kfDef.Spec.UseBasicAuth {
 		if err := gcp.kfDef.SetApplicationParameter("basic-auth-ingress", "ipName", gcp.kfDef.Spec.IpName); err != nil {
 			return errors.WithStack(err)
@@ -2001,6 +2160,15 @@ func (gcp *Gcp) Generate(resources kftypesv3.ResourceEnum) error {
 		if err := gcp.kfDef.SetApplicationParameter("profiles", "admin", gcp.kfDef.Spec.Email); err != nil {
 			return errors.WithStack(err)
 		}
+		// The token endpoint doesn't need credentials besides those of the OAuth client.
+		if err := CheckIAPRedirectURI(context.Background(), http.DefaultClient, gcp.kfDef); err != nil {
+			return err
+		}
+	}
+	if pluginSpec.Endpoint != nil {
+		if err := gcp.configureCertificate(pluginSpec); err != nil {
+			return err
+		}
 	}
 	if *pluginSpec.CreatePipelinePersistentStorage {
 		log.Infof("Configuring pipeline, minio, and mysql applications")
@@ -2015,6 +2183,10 @@ func (gcp *Gcp) Generate(resources kftypesv3.ResourceEnum) error {
 		}
 	}
 
+	if err := gcp.setExternalStorageParameters(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	// TODO(jlewi): Why is this hard coded here?
 	if err := gcp.kfDef.SetApplicationParameter("notebook-controller", "injectGcpCredentials", "true"); err != nil {
 		return errors.WithStack(err)
@@ -1,9 +1,14 @@
 package gcp
 
 import (
+	"github.com/gogo/protobuf/proto"
 	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
 )
 
+func init() {
+	kfdefs.RegisterPluginSpec(GcpPluginName, func() kfdefs.PluginSpec { return &GcpPluginSpec{} })
+}
+
 // GcpPlugin defines the extra data provided by the GCP Plugin in KfDef
 type GcpPluginSpec struct {
 	Auth *Auth `json:"auth,omitempty"`
@@ -19,6 +24,35 @@ type GcpPluginSpec struct {
 	// EnableWorkloadIdentity indicates whether to enable workload identity.
 	// Use a pointer so we can distinguish unset values.
 	EnableWorkloadIdentity *bool `json:"enableWorkloadIdentity,omitempty"`
+
+	// Endpoint configures DNS and TLS for the Kubeflow endpoint.
+	// If nil Cloud Endpoints provides DNS for <name>.endpoints.<project>.cloud.goog
+	// and a Google managed certificate is used.
+	Endpoint *EndpointSpec `json:"endpoint,omitempty"`
+
+	// Secrets configures where credentials generated during deployment are stored.
+	// If nil they are stored as Kubernetes Secrets.
+	Secrets *SecretsSpec `json:"secrets,omitempty"`
+
+	// DeploymentManager overrides properties of the Deployment Manager templates.
+	DeploymentManager *DeploymentManagerSpec `json:"deploymentManager,omitempty"`
+
+	// Cluster selects the GKE version and release channel of the cluster.
+	// If nil the version in the Deployment Manager template is used.
+	Cluster *ClusterSpec `json:"cluster,omitempty"`
+
+	// PreemptiblePool adds a node pool of preemptible VMs for training; the pods of the
+	// applications it lists are scheduled onto it. If nil there is no preemptible pool.
+	PreemptiblePool *PreemptiblePoolSpec `json:"preemptiblePool,omitempty"`
+
+	// ProfileResources provisions a service account and storage for each profile declared in
+	// the KfDef. If nil the profiles don't get cloud resources.
+	ProfileResources *ProfileResourcesSpec `json:"profileResources,omitempty"`
+
+	// FallbackZones are tried in order when KfDef.Spec.Zone is out of capacity for the nodes of
+	// the cluster e.g. for GPUs; they must be in the same region. The zone the cluster is
+	// provisioned in is recorded in KfDef.Status.Zone. Only zonal clusters being created fall back.
+	FallbackZones []string `json:"fallbackZones,omitempty"`
 }
 
 type Auth struct {
@@ -39,6 +73,42 @@ type IAP struct {
 // IsValid returns true if the spec is a valid and complete spec.
 // If false it will also return a string providing a message about why its invalid.
 func (s *GcpPluginSpec) IsValid() (bool, string) {
+	if s.Endpoint != nil {
+		if isValid, msg := s.Endpoint.IsValid(); !isValid {
+			return isValid, msg
+		}
+	}
+
+	if s.Secrets != nil {
+		if isValid, msg := s.Secrets.IsValid(); !isValid {
+			return isValid, msg
+		}
+	}
+
+	if s.DeploymentManager != nil {
+		if isValid, msg := s.DeploymentManager.IsValid(); !isValid {
+			return isValid, msg
+		}
+	}
+
+	if s.Cluster != nil {
+		if isValid, msg := s.Cluster.IsValid(); !isValid {
+			return isValid, msg
+		}
+		if _, ok := s.DeploymentManager.clusterOverride("cluster-version"); ok {
+			return false, "Cluster property cluster-version can't be overridden when the cluster version or release channel is set."
+		}
+	}
+
+	if s.PreemptiblePool != nil {
+		if isValid, msg := s.PreemptiblePool.IsValid(); !isValid {
+			return isValid, msg
+		}
+	}
+
+	if s.Auth == nil {
+		return false, "Either BasicAuth or IAP must be set"
+	}
 
 	basicAuthSet := s.Auth.BasicAuth != nil
 	iapAuthSet := s.Auth.IAP != nil
@@ -102,3 +172,13 @@ func (p *GcpPluginSpec) GetEnableWorkloadIdentity() bool {
 	v := p.EnableWorkloadIdentity
 	return *v
 }
+
+// SetDefaults explicitly sets the unset options which have a default value.
+func (p *GcpPluginSpec) SetDefaults() {
+	if p.CreatePipelinePersistentStorage == nil {
+		p.CreatePipelinePersistentStorage = proto.Bool(p.GetCreatePipelinePersistentStorage())
+	}
+	if p.EnableWorkloadIdentity == nil {
+		p.EnableWorkloadIdentity = proto.Bool(p.GetEnableWorkloadIdentity())
+	}
+}
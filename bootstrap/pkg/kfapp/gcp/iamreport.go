@@ -0,0 +1,334 @@
+package gcp
+
+import (
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/logging/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IamAuditor is implemented by plugins which can report and trim the IAM bindings created for a deployment.
+type IamAuditor interface {
+	// IamPolicyReport returns the IAM bindings created for the deployment which still exist. Bindings
+	// whose member wasn't active in the last unusedFor are marked unused.
+	IamPolicyReport(unusedFor time.Duration) (*IamPolicyReport, error)
+	// RevokeUnused removes the project bindings of the deployment whose member wasn't active in the
+	// last unusedFor. If dryRun is true the bindings are only reported.
+	RevokeUnused(unusedFor time.Duration, dryRun bool) (*IamPolicyReport, error)
+}
+
+// IamBinding is a role granted to a member on a resource.
+type IamBinding struct {
+	Member string `json:"member"`
+	Role   string `json:"role"`
+	// Resource is the resource the role is granted on; the project or a service account.
+	Resource string `json:"resource"`
+	// LastUsed is the time of the most recent audit log entry of the member; nil if there is none in the window.
+	LastUsed *metav1.Time `json:"lastUsed,omitempty"`
+	// Unused is true if the member wasn't active in the window. Members whose activity can't be
+	// determined e.g. groups are never unused.
+	Unused bool `json:"unused,omitempty"`
+	// Revoked is true if the binding was removed by RevokeUnused or would be in a dry run.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// IamPolicyReport lists the IAM bindings created for a deployment.
+type IamPolicyReport struct {
+	Name    string `json:"name"`
+	Project string `json:"project"`
+	// Since is the start of the window in which the activity of the members was checked.
+	Since    metav1.Time  `json:"since"`
+	Bindings []IamBinding `json:"bindings"`
+}
+
+// projectResource returns the name of the project as an IAM resource.
+func projectResource(project string) string {
+	return "projects/" + project
+}
+
+// projectBindings returns the bindings in expected which are in the current policy of the project.
+func projectBindings(project string, expected *cloudresourcemanager.Policy, current *cloudresourcemanager.Policy) []IamBinding {
+	granted := map[string]map[string]bool{}
+	for _, b := range current.Bindings {
+		if granted[b.Role] == nil {
+			granted[b.Role] = map[string]bool{}
+		}
+		for _, m := range b.Members {
+			granted[b.Role][m] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	bindings := []IamBinding{}
+	for _, b := range expected.Bindings {
+		for _, m := range b.Members {
+			key := b.Role + "/" + m
+			if !granted[b.Role][m] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			bindings = append(bindings, IamBinding{
+				Member:   m,
+				Role:     b.Role,
+				Resource: projectResource(project),
+			})
+		}
+	}
+	return bindings
+}
+
+// activityEmail returns the email the activity of member is recorded with in the audit logs
+// or "" if the activity of the member can't be determined.
+func activityEmail(member string) string {
+	for _, prefix := range []string{"user:", "serviceAccount:"} {
+		if strings.HasPrefix(member, prefix) {
+			email := strings.TrimPrefix(member, prefix)
+			// Workload identity members are K8s service accounts e.g. project.svc.id.goog[ns/ksa].
+			if strings.Contains(email, "[") {
+				return ""
+			}
+			return email
+		}
+	}
+	return ""
+}
+
+// markUnused sets the last activity of the bindings and marks those whose member wasn't active
+// since the start of the window as unused.
+func markUnused(bindings []IamBinding, lastUsed map[string]time.Time) {
+	for i := range bindings {
+		email := activityEmail(bindings[i].Member)
+		if email == "" {
+			continue
+		}
+		t, ok := lastUsed[email]
+		if !ok {
+			bindings[i].Unused = true
+			continue
+		}
+		used := metav1.NewTime(t)
+		bindings[i].LastUsed = &used
+	}
+}
+
+// revokeBindings removes the unused bindings on the project from policy except those of the
+// members in keep. It returns true if the policy changed.
+func revokeBindings(policy *cloudresourcemanager.Policy, project string, bindings []IamBinding, keep map[string]bool) bool {
+	revoke := map[string]map[string]bool{}
+	for i := range bindings {
+		b := &bindings[i]
+		if !b.Unused || b.Resource != projectResource(project) || keep[b.Member] {
+			continue
+		}
+		if revoke[b.Role] == nil {
+			revoke[b.Role] = map[string]bool{}
+		}
+		revoke[b.Role][b.Member] = true
+		b.Revoked = true
+	}
+	if len(revoke) == 0 {
+		return false
+	}
+
+	for _, b := range policy.Bindings {
+		members := []string{}
+		for _, m := range b.Members {
+			if !revoke[b.Role][m] {
+				members = append(members, m)
+			}
+		}
+		b.Members = members
+	}
+	return true
+}
+
+// deploymentServiceAccounts returns the emails of the service accounts created for the deployment.
+func (gcp *Gcp) deploymentServiceAccounts() []string {
+	accounts := []string{}
+	for _, suffix := range []string{"admin", "user", "vm"} {
+		accounts = append(accounts, getSA(gcp.kfDef.Name, suffix, gcp.kfDef.Spec.Project))
+	}
+	if email := DeployerServiceAccount(gcp.kfDef); email != "" {
+		accounts = append(accounts, email)
+	}
+	return accounts
+}
+
+// iamBindings returns the bindings created for the deployment; the project bindings from the
+// IAM bindings file and of the deployer and the bindings on its service accounts.
+func (gcp *Gcp) iamBindings(ctx context.Context) ([]IamBinding, error) {
+	project := gcp.kfDef.Spec.Project
+	expected := &cloudresourcemanager.Policy{}
+	bindingsFile := filepath.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, "iam_bindings.yaml")
+	if _, err := os.Stat(bindingsFile); err == nil {
+		expected, err = utils.ReadIamBindingsYAML(bindingsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if email := DeployerServiceAccount(gcp.kfDef); email != "" {
+		addBindings(expected, "serviceAccount:"+email, deployerRolesFor(gcp.kfDef))
+	}
+
+	current, err := utils.GetIamPolicy(project, gcp.client)
+	if err != nil {
+		return nil, err
+	}
+	bindings := projectBindings(project, expected, current)
+
+	iamService, err := iam.New(gcp.client)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating IAM service: %v", err),
+		}
+	}
+	for _, email := range gcp.deploymentServiceAccounts() {
+		policy, err := utils.GetServiceAccountIamPolicy(iamService, project, email)
+		if err != nil {
+			// The service account may not exist e.g. if the deployment failed before creating it.
+			log.Warnf("Could not get the IAM policy of %v; error %v", email, err)
+			continue
+		}
+		for _, b := range policy.Bindings {
+			for _, m := range b.Members {
+				bindings = append(bindings, IamBinding{
+					Member:   m,
+					Role:     b.Role,
+					Resource: fmt.Sprintf("projects/%v/serviceAccounts/%v", project, email),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(bindings, func(i, j int) bool {
+		if bindings[i].Resource != bindings[j].Resource {
+			return bindings[i].Resource < bindings[j].Resource
+		}
+		if bindings[i].Role != bindings[j].Role {
+			return bindings[i].Role < bindings[j].Role
+		}
+		return bindings[i].Member < bindings[j].Member
+	})
+	return bindings, nil
+}
+
+// lastActivity returns the time of the most recent audit log entry in the project of each
+// member since the given time. Members without an entry are omitted.
+//
+// Only logged activity is seen; members which only read data are missed unless Data Access
+// audit logs are enabled for the services they use.
+func (gcp *Gcp) lastActivity(ctx context.Context, bindings []IamBinding, since time.Time) (map[string]time.Time, error) {
+	loggingService, err := logging.New(gcp.client)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating logging service: %v", err),
+		}
+	}
+
+	lastUsed := map[string]time.Time{}
+	checked := map[string]bool{}
+	for _, b := range bindings {
+		email := activityEmail(b.Member)
+		if email == "" || checked[email] {
+			continue
+		}
+		checked[email] = true
+
+		resp, err := loggingService.Entries.List(&logging.ListLogEntriesRequest{
+			ResourceNames: []string{projectResource(gcp.kfDef.Spec.Project)},
+			Filter: fmt.Sprintf(`protoPayload.authenticationInfo.principalEmail="%v" AND timestamp>="%v"`,
+				email, since.UTC().Format(time.RFC3339)),
+			OrderBy:  "timestamp desc",
+			PageSize: 1,
+		}).Context(ctx).Do()
+		if err != nil {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("Error reading the audit logs of %v: %v", email, err),
+			}
+		}
+		if len(resp.Entries) == 0 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, resp.Entries[0].Timestamp)
+		if err != nil {
+			log.Warnf("Could not parse the time of the audit log entry of %v; error %v", email, err)
+			t = since
+		}
+		lastUsed[email] = t
+	}
+	return lastUsed, nil
+}
+
+// IamPolicyReport returns the IAM bindings created for the deployment which still exist.
+// Bindings whose member has no audit log entry in the last unusedFor are marked unused.
+func (gcp *Gcp) IamPolicyReport(unusedFor time.Duration) (*IamPolicyReport, error) {
+	if err := gcp.initGcpClient(); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	bindings, err := gcp.iamBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-unusedFor)
+	lastUsed, err := gcp.lastActivity(ctx, bindings, since)
+	if err != nil {
+		return nil, err
+	}
+	markUnused(bindings, lastUsed)
+
+	return &IamPolicyReport{
+		Name:     gcp.kfDef.Name,
+		Project:  gcp.kfDef.Spec.Project,
+		Since:    metav1.NewTime(since),
+		Bindings: bindings,
+	}, nil
+}
+
+// RevokeUnused removes the project bindings of the deployment whose member has no audit log entry
+// in the last unusedFor. Bindings on the service accounts aren't revoked since they are needed by the
+// cluster, and neither are the deployer's since it is only active while the deployment is applied.
+func (gcp *Gcp) RevokeUnused(unusedFor time.Duration, dryRun bool) (*IamPolicyReport, error) {
+	report, err := gcp.IamPolicyReport(unusedFor)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[string]bool{}
+	if email := DeployerServiceAccount(gcp.kfDef); email != "" {
+		keep["serviceAccount:"+email] = true
+	}
+
+	project := gcp.kfDef.Spec.Project
+	policy, err := utils.GetIamPolicy(project, gcp.client)
+	if err != nil {
+		return nil, err
+	}
+	if !revokeBindings(policy, project, report.Bindings, keep) || dryRun {
+		return report, nil
+	}
+
+	for _, b := range report.Bindings {
+		if b.Revoked {
+			log.Infof("Revoking %v from %v; no activity since %v", b.Role, b.Member, report.Since)
+		}
+	}
+	if err := utils.SetIamPolicy(project, policy, gcp.client); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,126 @@
+package gcp
+
+import (
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProjectBindings(t *testing.T) {
+	expected := &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			{
+				Role:    "roles/storage.admin",
+				Members: []string{"serviceAccount:kf-admin@p.iam.gserviceaccount.com", "serviceAccount:kf-user@p.iam.gserviceaccount.com"},
+			},
+			{
+				Role:    "roles/logging.logWriter",
+				Members: []string{"serviceAccount:kf-vm@p.iam.gserviceaccount.com"},
+			},
+		},
+	}
+	current := &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			{
+				Role:    "roles/storage.admin",
+				Members: []string{"serviceAccount:kf-admin@p.iam.gserviceaccount.com", "user:someone@example.com"},
+			},
+			{
+				Role:    "roles/owner",
+				Members: []string{"user:someone@example.com"},
+			},
+		},
+	}
+
+	actual := projectBindings("p", expected, current)
+	want := []IamBinding{
+		{
+			Member:   "serviceAccount:kf-admin@p.iam.gserviceaccount.com",
+			Role:     "roles/storage.admin",
+			Resource: "projects/p",
+		},
+	}
+	if !reflect.DeepEqual(actual, want) {
+		t.Errorf("projectBindings got %+v; want %+v", actual, want)
+	}
+}
+
+func TestActivityEmail(t *testing.T) {
+	cases := map[string]string{
+		"user:someone@example.com":                          "someone@example.com",
+		"serviceAccount:kf-admin@p.iam.gserviceaccount.com": "kf-admin@p.iam.gserviceaccount.com",
+		"serviceAccount:p.svc.id.goog[kubeflow/kf-admin]":   "",
+		"group:admins@example.com":                          "",
+		"domain:example.com":                                "",
+		"projectOwner:p":                                    "",
+	}
+	for member, expected := range cases {
+		if actual := activityEmail(member); actual != expected {
+			t.Errorf("activityEmail(%v): got %v; want %v", member, actual, expected)
+		}
+	}
+}
+
+func TestMarkUnusedAndRevoke(t *testing.T) {
+	used := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	bindings := []IamBinding{
+		{Member: "serviceAccount:kf-admin@p.iam.gserviceaccount.com", Role: "roles/storage.admin", Resource: "projects/p"},
+		{Member: "serviceAccount:kf-user@p.iam.gserviceaccount.com", Role: "roles/storage.admin", Resource: "projects/p"},
+		{Member: "serviceAccount:kf-deployer@p.iam.gserviceaccount.com", Role: "roles/container.admin", Resource: "projects/p"},
+		{Member: "group:admins@example.com", Role: "roles/storage.admin", Resource: "projects/p"},
+		{Member: "user:someone@example.com", Role: TOKEN_CREATOR_ROLE, Resource: "projects/p/serviceAccounts/kf-deployer@p.iam.gserviceaccount.com"},
+	}
+
+	markUnused(bindings, map[string]time.Time{
+		"kf-admin@p.iam.gserviceaccount.com": used,
+	})
+
+	unused := []bool{false, true, true, false, true}
+	for i, b := range bindings {
+		if b.Unused != unused[i] {
+			t.Errorf("Binding %v of %v: got unused %v; want %v", b.Role, b.Member, b.Unused, unused[i])
+		}
+	}
+	if bindings[0].LastUsed == nil || !bindings[0].LastUsed.Time.Equal(used) {
+		t.Errorf("LastUsed of %v: got %v; want %v", bindings[0].Member, bindings[0].LastUsed, used)
+	}
+
+	policy := &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{
+			{
+				Role: "roles/storage.admin",
+				Members: []string{
+					"serviceAccount:kf-admin@p.iam.gserviceaccount.com",
+					"serviceAccount:kf-user@p.iam.gserviceaccount.com",
+					"group:admins@example.com",
+				},
+			},
+			{
+				Role:    "roles/container.admin",
+				Members: []string{"serviceAccount:kf-deployer@p.iam.gserviceaccount.com"},
+			},
+		},
+	}
+	keep := map[string]bool{"serviceAccount:kf-deployer@p.iam.gserviceaccount.com": true}
+	if !revokeBindings(policy, "p", bindings, keep) {
+		t.Fatalf("revokeBindings: got false; want true")
+	}
+
+	revoked := []bool{false, true, false, false, false}
+	for i, b := range bindings {
+		if b.Revoked != revoked[i] {
+			t.Errorf("Binding %v of %v: got revoked %v; want %v", b.Role, b.Member, b.Revoked, revoked[i])
+		}
+	}
+
+	wantMembers := map[string][]string{
+		"roles/storage.admin":   {"serviceAccount:kf-admin@p.iam.gserviceaccount.com", "group:admins@example.com"},
+		"roles/container.admin": {"serviceAccount:kf-deployer@p.iam.gserviceaccount.com"},
+	}
+	for _, b := range policy.Bindings {
+		if !reflect.DeepEqual(b.Members, wantMembers[b.Role]) {
+			t.Errorf("Members of %v: got %v; want %v", b.Role, b.Members, wantMembers[b.Role])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package gcp
+
+import (
+	"context"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/deploymentmanager/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+	"time"
+)
+
+// Kinds of the GCP resources in the inventory which aren't typed by Deployment Manager.
+const (
+	DeploymentManagerKind = "deploymentmanager.v2.deployment"
+	ServiceAccountKind    = "iam.v1.serviceAccount"
+)
+
+// dmInventory returns the inventory entries of a Deployment Manager deployment and of the
+// resources it created. The resources are typed like in Deployment Manager, e.g. container.v1.cluster.
+func dmInventory(project string, deployment string, resources []*deploymentmanager.Resource) []kfdefs.InventoryResource {
+	inventory := []kfdefs.InventoryResource{
+		{
+			Kind:    DeploymentManagerKind,
+			Name:    deployment,
+			Project: project,
+			Source:  deployment,
+		},
+	}
+	for _, r := range resources {
+		entry := kfdefs.InventoryResource{
+			Kind:    r.Type,
+			Name:    r.Name,
+			Project: project,
+			Source:  deployment,
+		}
+		if t, err := time.Parse(time.RFC3339, r.InsertTime); err == nil {
+			entry.CreationTime = metav1.NewTime(t)
+		}
+		inventory = append(inventory, entry)
+	}
+	return inventory
+}
+
+// recordDMInventory records the resources of the deployments in the inventory of the KfDef.
+// A deployment whose resources can't be listed is only logged since it was applied.
+func (gcp *Gcp) recordDMInventory(deploymentmanagerService *deploymentmanager.Service, dmOperationEntries []*dmOperationEntry) {
+	project := gcp.kfDef.Spec.Project
+	for _, dmEntry := range dmOperationEntries {
+		var resources []*deploymentmanager.Resource
+		err := deploymentmanagerService.Resources.List(project, dmEntry.deployment).Pages(
+			context.Background(), func(page *deploymentmanager.ResourcesListResponse) error {
+				resources = append(resources, page.Resources...)
+				return nil
+			})
+		if err != nil {
+			log.Warnf("Could not list the resources of deployment %v for the inventory; error %v", dmEntry.deployment, err)
+			continue
+		}
+		for _, r := range dmInventory(project, dmEntry.deployment, resources) {
+			gcp.kfDef.RecordResource(r)
+		}
+	}
+	if gcp.kfDef.Spec.AppDir == "" {
+		return
+	}
+	if err := gcp.kfDef.WriteToConfigFile(); err != nil {
+		log.Warnf("Could not save the inventory of deployment %v; error %v", gcp.kfDef.Name, err)
+	}
+}
+
+// appendInventoryDeployments appends the Deployment Manager deployments in the inventory of kfDef
+// to deployments if they aren't already deleted. The storage deployment is only deleted on request.
+func appendInventoryDeployments(kfDef *kfdefs.KfDef, deployments []string) []string {
+	deleting := map[string]bool{}
+	for _, d := range deployments {
+		deleting[d] = true
+	}
+	for _, r := range kfDef.Status.Inventory {
+		if r.Kind != DeploymentManagerKind || r.Project != kfDef.Spec.Project || deleting[r.Name] {
+			continue
+		}
+		if strings.HasSuffix(r.Name, "-storage") && !kfDef.Spec.DeleteStorage {
+			continue
+		}
+		deleting[r.Name] = true
+		deployments = append(deployments, r.Name)
+	}
+	return deployments
+}
@@ -0,0 +1,63 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"google.golang.org/api/deploymentmanager/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func TestDMInventory(t *testing.T) {
+	resources := []*deploymentmanager.Resource{
+		{Name: "kf-app", Type: "container.v1.cluster", InsertTime: "2019-05-01T10:00:00.000-07:00"},
+		{Name: "kf-app-ip", Type: "compute.v1.globalAddress", InsertTime: "not a time"},
+	}
+
+	inventory := dmInventory("my-project", "kf-app", resources)
+	if len(inventory) != 3 {
+		t.Fatalf("dmInventory: got %v entries; want 3", len(inventory))
+	}
+	if inventory[0].Kind != DeploymentManagerKind || inventory[0].Name != "kf-app" {
+		t.Errorf("Deployment entry: got %+v", inventory[0])
+	}
+	cluster := inventory[1]
+	if cluster.Kind != "container.v1.cluster" || cluster.Project != "my-project" || cluster.Source != "kf-app" {
+		t.Errorf("Cluster entry: got %+v", cluster)
+	}
+	if cluster.CreationTime.UTC().Hour() != 17 {
+		t.Errorf("Cluster creation time: got %v", cluster.CreationTime)
+	}
+	if !inventory[2].CreationTime.IsZero() {
+		t.Errorf("Creation time of an invalid insert time: got %v", inventory[2].CreationTime)
+	}
+}
+
+func TestAppendInventoryDeployments(t *testing.T) {
+	kfDef := &kfdefs.KfDef{
+		ObjectMeta: metav1.ObjectMeta{Name: "kf-app"},
+		Spec:       kfdefs.KfDefSpec{Project: "my-project"},
+		Status: kfdefs.KfDefStatus{
+			Inventory: []kfdefs.InventoryResource{
+				{Kind: DeploymentManagerKind, Name: "kf-app", Project: "my-project"},
+				{Kind: DeploymentManagerKind, Name: "kf-app-storage", Project: "my-project"},
+				{Kind: DeploymentManagerKind, Name: "kf-app-gcfs", Project: "my-project"},
+				{Kind: DeploymentManagerKind, Name: "kf-app-other", Project: "other-project"},
+				{Kind: "container.v1.cluster", Name: "kf-app", Project: "my-project"},
+			},
+		},
+	}
+
+	actual := appendInventoryDeployments(kfDef, []string{"kf-app"})
+	expected := []string{"kf-app", "kf-app-gcfs"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("appendInventoryDeployments: got %v; want %v", actual, expected)
+	}
+
+	kfDef.Spec.DeleteStorage = true
+	actual = appendInventoryDeployments(kfDef, []string{"kf-app"})
+	expected = []string{"kf-app", "kf-app-storage", "kf-app-gcfs"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("appendInventoryDeployments with DeleteStorage: got %v; want %v", actual, expected)
+	}
+}
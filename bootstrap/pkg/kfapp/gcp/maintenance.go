@@ -0,0 +1,252 @@
+package gcp
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iam/v1"
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"net/http"
+	"time"
+)
+
+const (
+	// INGRESS_TLS_SECRET is the secret cert-manager stores the certificate of the ingress in.
+	INGRESS_TLS_SECRET = "envoy-ingress-tls"
+	// CERT_RENEW_BEFORE is how long before expiry a Let's Encrypt certificate is renewed.
+	CERT_RENEW_BEFORE = 30 * 24 * time.Hour
+)
+
+// Maintainer is implemented by plugins supporting recurring maintenance of a deployment.
+type Maintainer interface {
+	// RefreshServiceAccountKeys replaces the keys in the service account secrets and deletes the old keys.
+	RefreshServiceAccountKeys() error
+	// RotateIAPSecret writes the IAP OAuth client credentials currently in the KfDef to the OAuth secret
+	// so credentials rotated in the OAuth consent screen take effect.
+	RotateIAPSecret() error
+	// RenewCertificate forces cert-manager to reissue the certificate of the ingress if it is about to expire.
+	RenewCertificate() error
+}
+
+// RefreshServiceAccountKeys replaces the keys in the service account secrets and deletes the old keys.
+// It is a no-op when workload identity is enabled since there are no keys.
+func (gcp *Gcp) RefreshServiceAccountKeys() error {
+	if err := gcp.initGcpClient(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	p, err := gcp.GetPluginSpec()
+	if err != nil {
+		return err
+	}
+	if p.GetEnableWorkloadIdentity() {
+		log.Infof("Workload identity is enabled; there are no service account keys to refresh")
+		return nil
+	}
+
+	k8sClient, err := gcp.getK8sClientset(ctx)
+	if err != nil {
+		return kfapis.NewKfErrorWithMessage(err, "set K8s clientset error")
+	}
+
+	namespaces := []string{gcp.kfDef.Namespace}
+	if gcp.kfDef.Spec.UseIstio && gcp.getIstioNamespace() != gcp.kfDef.Namespace {
+		namespaces = append(namespaces, gcp.getIstioNamespace())
+	}
+
+	accounts := map[string]string{
+		ADMIN_SECRET_NAME: getSA(gcp.kfDef.Name, "admin", gcp.kfDef.Spec.Project),
+		USER_SECRET_NAME:  getSA(gcp.kfDef.Name, "user", gcp.kfDef.Spec.Project),
+	}
+
+	for secretName, email := range accounts {
+		// Share a single new key between the namespaces.
+		privateKeyData, err := gcp.newServiceAccountKey(ctx, email)
+		if err != nil {
+			return err
+		}
+		for _, ns := range namespaces {
+			if err := gcp.replaceServiceAccountKey(ctx, k8sClient, email, secretName, ns, privateKeyData); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replaceServiceAccountKey writes privateKeyData to the secret and deletes the key previously in it.
+func (gcp *Gcp) replaceServiceAccountKey(ctx context.Context, client *clientset.Clientset,
+	email string, secretName string, namespace string, privateKeyData []byte) error {
+	key := secretName + ".json"
+	oldKeyID := ""
+	if old, err := client.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{}); err == nil {
+		oldKeyID = privateKeyID(old.Data[key])
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			key: privateKeyData,
+		},
+	}
+	if err := createOrUpdateSecret(client, secret); err != nil {
+		return err
+	}
+
+	if oldKeyID == "" || oldKeyID == privateKeyID(privateKeyData) {
+		return nil
+	}
+
+	iamService, err := iam.New(NewClient(ctx, gcp.tokenSource))
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Get Oauth Client error: %v", err),
+		}
+	}
+
+	name := fmt.Sprintf("projects/%v/serviceAccounts/%v/keys/%v", gcp.kfDef.Spec.Project, email, oldKeyID)
+	log.Infof("Deleting old key %v of %v", oldKeyID, email)
+	if _, err := iamService.Projects.ServiceAccounts.Keys.Delete(name).Context(ctx).Do(); err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error deleting key %v of %v: %v", oldKeyID, email, err),
+		}
+	}
+	return nil
+}
+
+// privateKeyID returns the id of the key in a service account credentials file or "" if it can't be parsed.
+func privateKeyID(credentials []byte) string {
+	var key struct {
+		PrivateKeyID string `json:"private_key_id"`
+	}
+	if err := json.Unmarshal(credentials, &key); err != nil {
+		return ""
+	}
+	return key.PrivateKeyID
+}
+
+// RotateIAPSecret writes the IAP OAuth client credentials currently in the KfDef to the OAuth secret.
+// It is a no-op for deployments using basic auth.
+func (gcp *Gcp) RotateIAPSecret() error {
+	if err := gcp.initGcpClient(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	p, err := gcp.GetPluginSpec()
+	if err != nil {
+		return err
+	}
+	if p.Auth == nil || p.Auth.IAP == nil {
+		log.Infof("Deployment doesn't use IAP; there is no OAuth secret to rotate")
+		return nil
+	}
+
+	k8sClient, err := gcp.getK8sClientset(ctx)
+	if err != nil {
+		return kfapis.NewKfErrorWithMessage(err, "set K8s clientset error")
+	}
+
+	namespace := gcp.kfDef.Namespace
+	if gcp.kfDef.Spec.UseIstio {
+		namespace = gcp.getIstioNamespace()
+	}
+
+	secret, err := gcp.buildIapSecret(p, namespace)
+	if err != nil {
+		return err
+	}
+	provider, err := gcp.getSecretsProvider(k8sClient)
+	if err != nil {
+		return err
+	}
+	return provider.WriteSecret(ctx, secret)
+}
+
+// RenewCertificate deletes the ingress certificate if it expires within CERT_RENEW_BEFORE so that
+// cert-manager reissues it. Google managed certificates are renewed by Google so it is a no-op for them.
+func (gcp *Gcp) RenewCertificate() error {
+	if err := gcp.initGcpClient(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	p, err := gcp.GetPluginSpec()
+	if err != nil {
+		return err
+	}
+	if p.Endpoint.GetCertProvider() != CertProviderLetsEncrypt {
+		log.Infof("Deployment uses a managed certificate; it is renewed by Google")
+		return nil
+	}
+
+	k8sClient, err := gcp.getK8sClientset(ctx)
+	if err != nil {
+		return kfapis.NewKfErrorWithMessage(err, "set K8s clientset error")
+	}
+
+	namespace := gcp.getIstioNamespace()
+	secret, err := k8sClient.CoreV1().Secrets(namespace).Get(INGRESS_TLS_SECRET, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			log.Infof("Certificate %v.%v hasn't been issued yet", namespace, INGRESS_TLS_SECRET)
+			return nil
+		}
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error getting secret %v.%v: %v", namespace, INGRESS_TLS_SECRET, err),
+		}
+	}
+
+	expiry, err := certificateExpiry(secret.Data["tls.crt"])
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Could not parse certificate %v.%v: %v", namespace, INGRESS_TLS_SECRET, err),
+		}
+	}
+
+	if time.Until(expiry) > CERT_RENEW_BEFORE {
+		log.Infof("Certificate %v.%v expires %v; not renewing", namespace, INGRESS_TLS_SECRET, expiry)
+		return nil
+	}
+
+	log.Infof("Certificate %v.%v expires %v; deleting it so it is reissued", namespace, INGRESS_TLS_SECRET, expiry)
+	if err := k8sClient.CoreV1().Secrets(namespace).Delete(INGRESS_TLS_SECRET, &metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error deleting secret %v.%v: %v", namespace, INGRESS_TLS_SECRET, err),
+		}
+	}
+	return nil
+}
+
+// certificateExpiry returns the expiry of the first certificate in the PEM encoded chain.
+func certificateExpiry(chain []byte) (time.Time, error) {
+	block, _ := pem.Decode(chain)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no PEM data found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
@@ -0,0 +1,76 @@
+package gcp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestPrivateKeyID(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			input:    `{"type": "service_account", "private_key_id": "abc123"}`,
+			expected: "abc123",
+		},
+		{
+			input:    `{"type": "service_account"}`,
+			expected: "",
+		},
+		{
+			input:    "not json",
+			expected: "",
+		},
+	}
+
+	for _, c := range cases {
+		if actual := privateKeyID([]byte(c.input)); actual != c.expected {
+			t.Errorf("privateKeyID(%v): got %v; want %v", c.input, actual, c.expected)
+		}
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key; %v", err)
+	}
+
+	notAfter := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second).UTC()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "kubeflow.acme.com",
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create certificate; %v", err)
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	expiry, err := certificateExpiry(chain)
+	if err != nil {
+		t.Fatalf("certificateExpiry error; %v", err)
+	}
+	if !expiry.Equal(notAfter) {
+		t.Errorf("Got expiry %v; want %v", expiry, notAfter)
+	}
+
+	if _, err := certificateExpiry([]byte("garbage")); err == nil {
+		t.Errorf("certificateExpiry(garbage): want error; got nil")
+	}
+}
@@ -0,0 +1,353 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// iapAPIURL is the URL of the IAP API managing the OAuth consent screen (brand) and the OAuth
+	// clients of a project.
+	iapAPIURL = "https://iap.googleapis.com/v1"
+	// oauthTokenURL is the token endpoint used to check the credentials of an OAuth client.
+	oauthTokenURL = "https://oauth2.googleapis.com/token"
+	// oauthClientIdSuffix is the suffix of the ids of OAuth clients.
+	oauthClientIdSuffix = ".apps.googleusercontent.com"
+	// consentScreenURL is the page on which the OAuth consent screen of a project is configured.
+	consentScreenURL = "https://console.cloud.google.com/apis/credentials/consent?project=%v"
+	// credentialsURL is the page on which the OAuth clients of a project are managed.
+	credentialsURL = "https://console.cloud.google.com/apis/credentials?project=%v"
+)
+
+// OAuthClientReport is the result of checking or provisioning the OAuth client used by IAP.
+type OAuthClientReport struct {
+	Project string `json:"project"`
+	// Brand is the resource name of the OAuth consent screen of the project; empty if it isn't
+	// configured or couldn't be read.
+	Brand        string `json:"brand,omitempty"`
+	BrandCreated bool   `json:"brandCreated,omitempty"`
+	ClientId     string `json:"clientId,omitempty"`
+	// ClientSecret is only set for a client created by CheckOAuthClient; set it in the IAP spec of
+	// the KfDef with SetOAuthClient. It can't be read again.
+	ClientSecret  string `json:"clientSecret,omitempty"`
+	ClientCreated bool   `json:"clientCreated,omitempty"`
+	// Problems are actionable errors which would prevent IAP from working. The OAuth client is
+	// ready to be used if there are none.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// iapBrand is an OAuth consent screen in the IAP API.
+type iapBrand struct {
+	Name             string `json:"name,omitempty"`
+	SupportEmail     string `json:"supportEmail"`
+	ApplicationTitle string `json:"applicationTitle"`
+	OrgInternalOnly  bool   `json:"orgInternalOnly,omitempty"`
+}
+
+// iapBrandList is the response of the IAP API listing the brands of a project.
+type iapBrandList struct {
+	Brands []iapBrand `json:"brands"`
+}
+
+// iapClient is an OAuth client in the IAP API.
+type iapClient struct {
+	Name        string `json:"name,omitempty"`
+	Secret      string `json:"secret,omitempty"`
+	DisplayName string `json:"displayName"`
+}
+
+// apiError is the body of an error returned by a Google API.
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// oauthError is the body of an error returned by the OAuth token endpoint.
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// callIapAPI sends a request to the IAP API and decodes the response into out. Errors returned
+// by the API are returned as a *kfapis.KfError whose message is the message of the API.
+func callIapAPI(ctx context.Context, client *http.Client, method string, resource string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("Error encoding the request to %v: %v", resource, err),
+			}
+		}
+	}
+	req, err := http.NewRequest(method, iapAPIURL+"/"+resource, bytes.NewReader(body))
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating the request to %v: %v", resource, err),
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error calling the IAP API: %v", err),
+		}
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error reading the response of the IAP API: %v", err),
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &apiError{}
+		if err := json.Unmarshal(buf, e); err != nil || e.Error.Message == "" {
+			e.Error.Message = fmt.Sprintf("%v %v", resp.Status, string(buf))
+		}
+		return &kfapis.KfError{
+			Code:    resp.StatusCode,
+			Message: e.Error.Message,
+		}
+	}
+	if err := json.Unmarshal(buf, out); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error parsing the response of the IAP API: %v", err),
+		}
+	}
+	return nil
+}
+
+// iapProblem returns an actionable message for an error returned by the IAP API.
+func iapProblem(project string, action string, err error) string {
+	kfErr, ok := err.(*kfapis.KfError)
+	if !ok {
+		return fmt.Sprintf("Could not %v: %v", action, err)
+	}
+	switch {
+	case strings.Contains(kfErr.Message, "has not been used") || strings.Contains(kfErr.Message, "is disabled"):
+		return fmt.Sprintf("Could not %v because the IAP API isn't enabled; enable it with "+
+			"gcloud services enable iap.googleapis.com --project=%v", action, project)
+	case kfErr.Code == http.StatusForbidden:
+		return fmt.Sprintf("Could not %v; you need the roles/oauthconfig.editor role on project %v "+
+			"(roles/oauthconfig.viewer to only check the client): %v", action, project, kfErr.Message)
+	}
+	return fmt.Sprintf("Could not %v: %v", action, kfErr.Message)
+}
+
+// clientProjectNumber returns the number of the project an OAuth client belongs to; it is the
+// prefix of the client id.
+func clientProjectNumber(clientId string) string {
+	i := strings.Index(clientId, "-")
+	if i <= 0 {
+		return ""
+	}
+	return clientId[:i]
+}
+
+// brandProjectNumber returns the number of the project of a brand named projects/<number>/brands/<id>.
+func brandProjectNumber(brand string) string {
+	parts := strings.Split(brand, "/")
+	if len(parts) < 2 || parts[0] != "projects" {
+		return ""
+	}
+	return parts[1]
+}
+
+// checkClientCredentials checks the id and secret of an OAuth client by exchanging an invalid
+// authorization code with them. The token endpoint rejects unknown clients and wrong secrets with
+// invalid_client before it checks the code. It returns the error of the token endpoint.
+func checkClientCredentials(ctx context.Context, client *http.Client, clientId string, secret string, redirectURI string) (string, error) {
+	form := url.Values{
+		"client_id":     {clientId},
+		"client_secret": {secret},
+		"grant_type":    {"authorization_code"},
+		"code":          {"kfctl-credentials-check"},
+	}
+	if redirectURI != "" {
+		form.Set("redirect_uri", redirectURI)
+	}
+	req, err := http.NewRequest(http.MethodPost, oauthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error checking the credentials of OAuth client %v: %v", clientId, err),
+		}
+	}
+	defer resp.Body.Close()
+
+	e := &oauthError{}
+	if err := json.NewDecoder(resp.Body).Decode(e); err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error parsing the response checking OAuth client %v: %v", clientId, err),
+		}
+	}
+	return e.Error, nil
+}
+
+// CheckOAuthClient checks the OAuth consent screen of the project of kfDef and the OAuth client set
+// in its IAP spec. Problems which would prevent IAP from working are reported with the steps to fix
+// them; an error is only returned if the check couldn't be done.
+//
+// If provision is true a missing consent screen is created and, if kfDef doesn't set a client,
+// a client is created. The IAP API can only create consent screens restricted to the users of the
+// organization of the project; other projects must configure the consent screen by hand.
+func CheckOAuthClient(ctx context.Context, client *http.Client, kfDef *kfdefs.KfDef, provision bool) (*OAuthClientReport, error) {
+	project := kfDef.Spec.Project
+	if project == "" {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: "KfDef.Spec.Project must be set",
+		}
+	}
+
+	pluginSpec := &GcpPluginSpec{}
+	if err := kfDef.GetPluginSpec(GcpPluginName, pluginSpec); err != nil && !kfdefs.IsPluginNotFound(err) {
+		return nil, err
+	}
+	if kfDef.Spec.UseBasicAuth || (pluginSpec.Auth != nil && pluginSpec.Auth.BasicAuth != nil) {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Deployment %v uses basic auth; it doesn't need an OAuth client", kfDef.Name),
+		}
+	}
+
+	report := &OAuthClientReport{Project: project}
+	if pluginSpec.Auth != nil && pluginSpec.Auth.IAP != nil {
+		report.ClientId = pluginSpec.Auth.IAP.OAuthClientId
+	}
+
+	brands := &iapBrandList{}
+	if err := callIapAPI(ctx, client, http.MethodGet, "projects/"+url.PathEscape(project)+"/brands", nil, brands); err != nil {
+		report.Problems = append(report.Problems, iapProblem(project, "read the OAuth consent screen", err))
+	} else if len(brands.Brands) > 0 {
+		report.Brand = brands.Brands[0].Name
+	} else if provision {
+		brand := &iapBrand{}
+		err := callIapAPI(ctx, client, http.MethodPost, "projects/"+url.PathEscape(project)+"/brands", &iapBrand{
+			SupportEmail:     kfDef.Spec.Email,
+			ApplicationTitle: "Kubeflow",
+		}, brand)
+		if err != nil {
+			report.Problems = append(report.Problems, iapProblem(project, "create the OAuth consent screen", err)+
+				fmt.Sprintf("; configure it at %v", fmt.Sprintf(consentScreenURL, project)))
+		} else {
+			log.Infof("Created OAuth consent screen %v of project %v", brand.Name, project)
+			report.Brand = brand.Name
+			report.BrandCreated = true
+		}
+	} else {
+		report.Problems = append(report.Problems, fmt.Sprintf("The OAuth consent screen of project %v isn't configured; "+
+			"configure it at %v", project, fmt.Sprintf(consentScreenURL, project)))
+	}
+
+	if report.ClientId == "" {
+		if !provision || report.Brand == "" {
+			report.Problems = append(report.Problems, fmt.Sprintf("IAP requires an OAuth client; create one at %v "+
+				"and set its id and secret in the IAP spec of the KfDef", fmt.Sprintf(credentialsURL, project)))
+			return report, nil
+		}
+		c := &iapClient{}
+		if err := callIapAPI(ctx, client, http.MethodPost, report.Brand+"/identityAwareProxyClients", &iapClient{
+			DisplayName: kfDef.Name,
+		}, c); err != nil {
+			report.Problems = append(report.Problems, iapProblem(project, "create the OAuth client", err))
+			return report, nil
+		}
+		report.ClientId = c.Name[strings.LastIndex(c.Name, "/")+1:]
+		report.ClientSecret = c.Secret
+		report.ClientCreated = true
+		log.Infof("Created OAuth client %v of project %v", report.ClientId, project)
+		return report, nil
+	}
+
+	if !strings.HasSuffix(report.ClientId, oauthClientIdSuffix) {
+		report.Problems = append(report.Problems, fmt.Sprintf("%v isn't the id of an OAuth client; client ids end in %v",
+			report.ClientId, oauthClientIdSuffix))
+		return report, nil
+	}
+	if number := brandProjectNumber(report.Brand); number != "" && clientProjectNumber(report.ClientId) != number {
+		report.Problems = append(report.Problems, fmt.Sprintf("OAuth client %v doesn't belong to project %v; "+
+			"IAP requires a client of the project of the deployment", report.ClientId, project))
+	}
+
+	if pluginSpec.Auth.IAP.OAuthClientSecret == nil {
+		report.Problems = append(report.Problems, "IAP requires OAuthClientSecret; set it to the secret holding the secret of the OAuth client")
+		return report, nil
+	}
+	secret, err := kfDef.GetSecret(pluginSpec.Auth.IAP.OAuthClientSecret.Name)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("Could not read the secret of OAuth client %v from secret %v of the KfDef: %v",
+			report.ClientId, pluginSpec.Auth.IAP.OAuthClientSecret.Name, err))
+		return report, nil
+	}
+	redirectURI := ""
+	if kfDef.Spec.Hostname != "" {
+		redirectURI = OAuthRedirectURI(kfDef.Spec.Hostname)
+	}
+	code, err := checkClientCredentials(ctx, client, report.ClientId, secret, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case "invalid_client", "unauthorized_client":
+		report.Problems = append(report.Problems, fmt.Sprintf("OAuth client %v doesn't exist or its secret is wrong; "+
+			"copy the id and secret of the client from %v", report.ClientId, fmt.Sprintf(credentialsURL, project)))
+	case "redirect_uri_mismatch":
+		report.Problems = append(report.Problems, fmt.Sprintf("%v isn't an authorized redirect URI of OAuth client %v; "+
+			"add it to the client at %v", redirectURI, report.ClientId, fmt.Sprintf(credentialsURL, project)))
+	}
+	return report, nil
+}
+
+// SetOAuthClient sets the OAuth client used by IAP in the GCP plugin spec of kfDef. The secret of
+// the client is stored as a literal in the secret KUBEFLOW_OAUTH of the KfDef.
+func SetOAuthClient(kfDef *kfdefs.KfDef, clientId string, clientSecret string) error {
+	pluginSpec := &GcpPluginSpec{}
+	if err := kfDef.GetPluginSpec(GcpPluginName, pluginSpec); err != nil && !kfdefs.IsPluginNotFound(err) {
+		return err
+	}
+	if pluginSpec.Auth == nil {
+		pluginSpec.Auth = &Auth{}
+	}
+	pluginSpec.Auth.IAP = &IAP{
+		OAuthClientId: clientId,
+		OAuthClientSecret: &kfdefs.SecretRef{
+			Name: KUBEFLOW_OAUTH,
+		},
+	}
+	kfDef.SetSecret(kfdefs.Secret{
+		Name: KUBEFLOW_OAUTH,
+		SecretSource: &kfdefs.SecretSource{
+			LiteralSource: &kfdefs.LiteralSource{
+				Value: clientSecret,
+			},
+		},
+	})
+	return kfDef.SetPluginSpec(GcpPluginName, pluginSpec)
+}
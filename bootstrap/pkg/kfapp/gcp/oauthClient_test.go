@@ -0,0 +1,164 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newOAuthTestKfDef returns a KfDef using IAP with the OAuth client clientId.
+func newOAuthTestKfDef(t *testing.T, clientId string) *kfdefs.KfDef {
+	d := &kfdefs.KfDef{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kf-app",
+		},
+		Spec: kfdefs.KfDefSpec{
+			Project:  "acme",
+			Email:    "admin@acme.com",
+			Hostname: "kf-app.endpoints.acme.cloud.goog",
+		},
+	}
+	if clientId != "" {
+		if err := SetOAuthClient(d, clientId, "s3cret"); err != nil {
+			t.Fatalf("SetOAuthClient error; %v", err)
+		}
+	}
+	return d
+}
+
+func TestCheckOAuthClient(t *testing.T) {
+	type testCase struct {
+		name     string
+		clientId string
+		codes    []int
+		bodies   []string
+		problems int
+		contains string
+	}
+
+	brands := `{"brands": [{"name": "projects/123/brands/123", "supportEmail": "admin@acme.com"}]}`
+	cases := []testCase{
+		{
+			name:     "valid",
+			clientId: "123-abc" + oauthClientIdSuffix,
+			codes:    []int{http.StatusOK, http.StatusBadRequest},
+			bodies:   []string{brands, `{"error": "invalid_grant"}`},
+		},
+		{
+			name:     "wrong secret",
+			clientId: "123-abc" + oauthClientIdSuffix,
+			codes:    []int{http.StatusOK, http.StatusUnauthorized},
+			bodies:   []string{brands, `{"error": "invalid_client"}`},
+			problems: 1,
+			contains: "secret is wrong",
+		},
+		{
+			name:     "redirect URI",
+			clientId: "123-abc" + oauthClientIdSuffix,
+			codes:    []int{http.StatusOK, http.StatusBadRequest},
+			bodies:   []string{brands, `{"error": "redirect_uri_mismatch"}`},
+			problems: 1,
+			contains: "https://kf-app.endpoints.acme.cloud.goog" + IAP_REDIRECT_PATH,
+		},
+		{
+			name:     "other project",
+			clientId: "456-abc" + oauthClientIdSuffix,
+			codes:    []int{http.StatusOK, http.StatusBadRequest},
+			bodies:   []string{brands, `{"error": "invalid_grant"}`},
+			problems: 1,
+			contains: "doesn't belong to project acme",
+		},
+		{
+			name:     "not a client id",
+			clientId: "abc",
+			codes:    []int{http.StatusOK},
+			bodies:   []string{brands},
+			problems: 1,
+			contains: oauthClientIdSuffix,
+		},
+		{
+			name:     "no consent screen",
+			codes:    []int{http.StatusOK},
+			bodies:   []string{`{}`},
+			problems: 2,
+			contains: "isn't configured",
+		},
+		{
+			name:     "permission denied",
+			clientId: "123-abc" + oauthClientIdSuffix,
+			codes:    []int{http.StatusForbidden, http.StatusBadRequest},
+			bodies:   []string{`{"error": {"code": 403, "message": "The caller does not have permission"}}`, `{"error": "invalid_grant"}`},
+			problems: 1,
+			contains: "roles/oauthconfig.editor",
+		},
+	}
+
+	for _, c := range cases {
+		f := &fakeRoundTripper{codes: c.codes, bodies: c.bodies}
+		report, err := CheckOAuthClient(context.Background(), &http.Client{Transport: f}, newOAuthTestKfDef(t, c.clientId), false)
+		if err != nil {
+			t.Errorf("%v: CheckOAuthClient error; %v", c.name, err)
+			continue
+		}
+		if len(report.Problems) != c.problems {
+			t.Errorf("%v: got problems %v; want %v", c.name, report.Problems, c.problems)
+			continue
+		}
+		if c.contains != "" && !strings.Contains(report.Problems[0], c.contains) {
+			t.Errorf("%v: problem %v doesn't contain %v", c.name, report.Problems[0], c.contains)
+		}
+		if report.ClientCreated || report.BrandCreated {
+			t.Errorf("%v: created a brand or client without provisioning", c.name)
+		}
+	}
+}
+
+func TestCheckOAuthClient_Provision(t *testing.T) {
+	f := &fakeRoundTripper{
+		codes: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		bodies: []string{
+			`{}`,
+			`{"name": "projects/123/brands/123", "supportEmail": "admin@acme.com", "orgInternalOnly": true}`,
+			`{"name": "projects/123/brands/123/identityAwareProxyClients/123-xyz.apps.googleusercontent.com", "secret": "s3cret", "displayName": "kf-app"}`,
+		},
+	}
+	d := newOAuthTestKfDef(t, "")
+	report, err := CheckOAuthClient(context.Background(), &http.Client{Transport: f}, d, true)
+	if err != nil {
+		t.Fatalf("CheckOAuthClient error; %v", err)
+	}
+	if len(report.Problems) != 0 || !report.BrandCreated || !report.ClientCreated {
+		t.Fatalf("Want the brand and client to be created; got %+v", report)
+	}
+	if report.ClientId != "123-xyz.apps.googleusercontent.com" || report.ClientSecret != "s3cret" {
+		t.Errorf("Got client %v secret %v; want 123-xyz.apps.googleusercontent.com s3cret", report.ClientId, report.ClientSecret)
+	}
+	if u := f.sent[2].URL.String(); u != iapAPIURL+"/projects/123/brands/123/identityAwareProxyClients" {
+		t.Errorf("Client created at %v; want it in the created brand", u)
+	}
+
+	if err := SetOAuthClient(d, report.ClientId, report.ClientSecret); err != nil {
+		t.Fatalf("SetOAuthClient error; %v", err)
+	}
+	pluginSpec := &GcpPluginSpec{}
+	if err := d.GetPluginSpec(GcpPluginName, pluginSpec); err != nil {
+		t.Fatalf("GetPluginSpec error; %v", err)
+	}
+	if pluginSpec.Auth.IAP.OAuthClientId != report.ClientId {
+		t.Errorf("Got client id %v; want %v", pluginSpec.Auth.IAP.OAuthClientId, report.ClientId)
+	}
+	if secret, err := d.GetSecret(pluginSpec.Auth.IAP.OAuthClientSecret.Name); err != nil || secret != "s3cret" {
+		t.Errorf("Got secret %v, %v; want s3cret", secret, err)
+	}
+}
+
+func TestCheckOAuthClient_BasicAuth(t *testing.T) {
+	d := newOAuthTestKfDef(t, "")
+	d.Spec.UseBasicAuth = true
+	if _, err := CheckOAuthClient(context.Background(), http.DefaultClient, d, true); err == nil {
+		t.Errorf("CheckOAuthClient of a deployment using basic auth: want an error")
+	}
+}
@@ -0,0 +1,227 @@
+package gcp
+
+import (
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"net/http"
+	"strings"
+)
+
+const (
+	// externalIpConstraint restricts the VMs which can have an external IP; the GKE nodes of a
+	// deployment have one.
+	externalIpConstraint = "constraints/compute.vmExternalIpAccess"
+	// serviceAccountKeyConstraint prevents creating keys for service accounts; they are created
+	// for the admin, user and profile service accounts unless workload identity is enabled.
+	serviceAccountKeyConstraint = "constraints/iam.disableServiceAccountKeyCreation"
+	// resourceLocationConstraint restricts the locations resources can be created in.
+	resourceLocationConstraint = "constraints/gcp.resourceLocations"
+	// orgPoliciesURL is the page on which the organization policies of a project are listed.
+	orgPoliciesURL = "https://console.cloud.google.com/iam-admin/orgpolicies?project=%v"
+)
+
+// OrgPolicyViolation is an organization policy constraint the resources of a deployment would violate.
+type OrgPolicyViolation struct {
+	Constraint string `json:"constraint"`
+	Message    string `json:"message"`
+	// Remediation is how to change the deployment or the policy so it can be provisioned.
+	Remediation string `json:"remediation"`
+}
+
+// String returns the violation and its remediation on a single line.
+func (v OrgPolicyViolation) String() string {
+	return fmt.Sprintf("%v: %v %v", v.Constraint, v.Message, v.Remediation)
+}
+
+// FormatOrgPolicyViolations returns the message of a condition listing the violations.
+func FormatOrgPolicyViolations(project string, violations []OrgPolicyViolation) string {
+	lines := []string{fmt.Sprintf("The organization policies of project %v don't allow the deployment (see %v):",
+		project, fmt.Sprintf(orgPoliciesURL, project))}
+	for _, v := range violations {
+		lines = append(lines, v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// locationValue strips the prefix of a value of a resource location list policy.
+func locationValue(v string) string {
+	return strings.TrimPrefix(v, "is:")
+}
+
+// locationGroups returns the value groups of a resource location list policy which contain the
+// region e.g. in:us-east1-locations and in:us-locations for us-east1.
+func locationGroups(region string) []string {
+	groups := []string{"in:" + region + "-locations"}
+	if i := strings.Index(region, "-"); i > 0 {
+		groups = append(groups, "in:"+region[:i]+"-locations")
+	}
+	return groups
+}
+
+// matchesLocation returns true if the value of a resource location list policy covers location;
+// a zone is covered by its region and the groups of its region.
+func matchesLocation(value string, location string) bool {
+	value = locationValue(value)
+	region := location
+	if strings.Count(location, "-") > 1 {
+		region = zoneRegion(location)
+	}
+	if value == location || value == region {
+		return true
+	}
+	for _, g := range locationGroups(region) {
+		if value == g {
+			return true
+		}
+	}
+	return false
+}
+
+// isEvaluable returns true if matchesLocation can tell whether the value covers a location. The
+// groups other than the ones of a region or a continent e.g. in:eu-locations aren't expanded.
+func isEvaluable(value string) bool {
+	value = locationValue(value)
+	if !strings.HasPrefix(value, "in:") {
+		return true
+	}
+	group := strings.TrimSuffix(strings.TrimPrefix(value, "in:"), "-locations")
+	for _, continent := range []string{"us", "europe", "asia", "australia", "northamerica", "southamerica"} {
+		if group == continent || strings.HasPrefix(group, continent+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocationAllowed returns true if the list policy allows location. A location which can't be
+// evaluated is assumed to be allowed so the check doesn't block deployments GCP would accept.
+func isLocationAllowed(p *cloudresourcemanager.ListPolicy, location string) bool {
+	if p == nil {
+		return true
+	}
+	for _, v := range p.DeniedValues {
+		if matchesLocation(v, location) {
+			return false
+		}
+	}
+	if p.AllValues == "DENY" {
+		return false
+	}
+	if p.AllValues == "ALLOW" || len(p.AllowedValues) == 0 {
+		return true
+	}
+	for _, v := range p.AllowedValues {
+		if matchesLocation(v, location) || !isEvaluable(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// deploymentLocations returns the locations the resources of kfDef are created in; its region and
+// the zones its cluster may be created in.
+func deploymentLocations(kfDef *kfdefs.KfDef, pluginSpec *GcpPluginSpec) []string {
+	if kfDef.Spec.Region != "" {
+		return []string{kfDef.Spec.Region}
+	}
+	locations := []string{}
+	if kfDef.Spec.Zone != "" {
+		locations = append(locations, zoneRegion(kfDef.Spec.Zone), kfDef.Spec.Zone)
+	}
+	return append(locations, pluginSpec.FallbackZones...)
+}
+
+// orgPolicyChecker gets the effective organization policies of a project.
+type orgPolicyChecker struct {
+	service *cloudresourcemanager.Service
+	project string
+}
+
+// effectivePolicy returns the policy of the project for constraint including the ones inherited
+// from its folders and organization.
+func (c *orgPolicyChecker) effectivePolicy(ctx context.Context, constraint string) (*cloudresourcemanager.OrgPolicy, error) {
+	p, err := c.service.Projects.GetEffectiveOrgPolicy("projects/"+c.project,
+		&cloudresourcemanager.GetEffectiveOrgPolicyRequest{Constraint: constraint}).Context(ctx).Do()
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Could not get the effective policy of %v for project %v: %v", constraint, c.project, err),
+		}
+	}
+	return p, nil
+}
+
+// CheckOrgPolicies checks the resources kfDef plans to create against the organization policies
+// of its project and returns the constraints they would violate with how to remediate them.
+//
+// Only the constraints which commonly block deployments are checked: external IPs of the GKE
+// nodes, creation of service account keys and the locations of the resources. An error means
+// the policies couldn't be read e.g. because the caller can't get them; it doesn't mean the
+// deployment would fail.
+func CheckOrgPolicies(ctx context.Context, client *http.Client, kfDef *kfdefs.KfDef) ([]OrgPolicyViolation, error) {
+	pluginSpec := &GcpPluginSpec{}
+	if err := kfDef.GetPluginSpec(GcpPluginName, pluginSpec); err != nil && !kfdefs.IsPluginNotFound(err) {
+		return nil, err
+	}
+
+	service, err := cloudresourcemanager.New(client)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating resource manager client: %v", err),
+		}
+	}
+	c := &orgPolicyChecker{service: service, project: kfDef.Spec.Project}
+	violations := []OrgPolicyViolation{}
+
+	p, err := c.effectivePolicy(ctx, externalIpConstraint)
+	if err != nil {
+		return nil, err
+	}
+	// The allowed values are the names of VMs; the nodes GKE creates can't be listed in advance.
+	if l := p.ListPolicy; l != nil && (l.AllValues == "DENY" || (l.AllValues != "ALLOW" && len(l.AllowedValues) > 0)) {
+		violations = append(violations, OrgPolicyViolation{
+			Constraint:  externalIpConstraint,
+			Message:     "The nodes of the GKE cluster need external IPs but the policy only allows them for listed VMs.",
+			Remediation: fmt.Sprintf("Ask an organization policy administrator to allow external IPs in project %v.", c.project),
+		})
+	}
+
+	if !pluginSpec.GetEnableWorkloadIdentity() {
+		p, err := c.effectivePolicy(ctx, serviceAccountKeyConstraint)
+		if err != nil {
+			return nil, err
+		}
+		if p.BooleanPolicy != nil && p.BooleanPolicy.Enforced {
+			violations = append(violations, OrgPolicyViolation{
+				Constraint:  serviceAccountKeyConstraint,
+				Message:     "Keys are created for the service accounts of the deployment but the policy disables key creation.",
+				Remediation: fmt.Sprintf("Set enableWorkloadIdentity to true in the spec of plugin %v so no keys are created.", GcpPluginName),
+			})
+		}
+	}
+
+	p, err = c.effectivePolicy(ctx, resourceLocationConstraint)
+	if err != nil {
+		return nil, err
+	}
+	for _, location := range deploymentLocations(kfDef, pluginSpec) {
+		if isLocationAllowed(p.ListPolicy, location) {
+			continue
+		}
+		violations = append(violations, OrgPolicyViolation{
+			Constraint:  resourceLocationConstraint,
+			Message:     fmt.Sprintf("Resources can't be created in %v.", location),
+			Remediation: "Choose a zone or region allowed by the policy or ask an organization policy administrator to allow it.",
+		})
+	}
+
+	if len(violations) == 0 {
+		log.Infof("Project %v has no organization policy blocking deployment %v", c.project, kfDef.Name)
+	}
+	return violations, nil
+}
@@ -0,0 +1,147 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"golang.org/x/net/context"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIsLocationAllowed(t *testing.T) {
+	type testCase struct {
+		policy   *cloudresourcemanager.ListPolicy
+		location string
+		expected bool
+	}
+
+	cases := []testCase{
+		{
+			policy:   nil,
+			location: "us-east1-b",
+			expected: true,
+		},
+		{
+			policy:   &cloudresourcemanager.ListPolicy{AllowedValues: []string{"in:us-locations"}},
+			location: "us-east1-b",
+			expected: true,
+		},
+		{
+			policy:   &cloudresourcemanager.ListPolicy{AllowedValues: []string{"in:europe-west1-locations"}},
+			location: "us-east1-b",
+			expected: false,
+		},
+		{
+			policy:   &cloudresourcemanager.ListPolicy{AllowedValues: []string{"is:us-east1"}},
+			location: "us-east1",
+			expected: true,
+		},
+		{
+			policy:   &cloudresourcemanager.ListPolicy{DeniedValues: []string{"us-east1-b"}},
+			location: "us-east1-b",
+			expected: false,
+		},
+		{
+			// Groups which aren't expanded are assumed to allow the location.
+			policy:   &cloudresourcemanager.ListPolicy{AllowedValues: []string{"in:eu-locations"}},
+			location: "us-east1-b",
+			expected: true,
+		},
+		{
+			policy:   &cloudresourcemanager.ListPolicy{AllValues: "DENY"},
+			location: "us-east1-b",
+			expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		if actual := isLocationAllowed(c.policy, c.location); actual != c.expected {
+			t.Errorf("isLocationAllowed(%+v, %v): got %v; want %v", c.policy, c.location, actual, c.expected)
+		}
+	}
+}
+
+func TestCheckOrgPolicies(t *testing.T) {
+	type testCase struct {
+		name                   string
+		enableWorkloadIdentity bool
+		bodies                 []string
+		constraints            []string
+	}
+
+	noPolicy := `{}`
+	cases := []testCase{
+		{
+			name:   "no policies",
+			bodies: []string{noPolicy, noPolicy, noPolicy},
+		},
+		{
+			name:        "external IPs denied",
+			bodies:      []string{`{"listPolicy": {"allValues": "DENY"}}`, noPolicy, noPolicy},
+			constraints: []string{externalIpConstraint},
+		},
+		{
+			name:        "keys disabled",
+			bodies:      []string{noPolicy, `{"booleanPolicy": {"enforced": true}}`, noPolicy},
+			constraints: []string{serviceAccountKeyConstraint},
+		},
+		{
+			name:                   "keys disabled with workload identity",
+			enableWorkloadIdentity: true,
+			bodies:                 []string{noPolicy, noPolicy},
+		},
+		{
+			name:        "location",
+			bodies:      []string{noPolicy, noPolicy, `{"listPolicy": {"allowedValues": ["in:europe-locations"]}}`},
+			constraints: []string{resourceLocationConstraint, resourceLocationConstraint},
+		},
+	}
+
+	for _, c := range cases {
+		d := &kfdefs.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kf-app",
+			},
+			Spec: kfdefs.KfDefSpec{
+				Project: "acme",
+				Zone:    "us-east1-d",
+			},
+		}
+		if err := d.SetPluginSpec(GcpPluginName, &GcpPluginSpec{EnableWorkloadIdentity: &c.enableWorkloadIdentity}); err != nil {
+			t.Fatalf("SetPluginSpec error; %v", err)
+		}
+		codes := []int{}
+		for range c.bodies {
+			codes = append(codes, http.StatusOK)
+		}
+		f := &fakeRoundTripper{codes: codes, bodies: c.bodies}
+		violations, err := CheckOrgPolicies(context.Background(), &http.Client{Transport: f}, d)
+		if err != nil {
+			t.Errorf("%v: CheckOrgPolicies error; %v", c.name, err)
+			continue
+		}
+		if len(f.sent) != len(c.bodies) {
+			t.Errorf("%v: got %v requests; want %v", c.name, len(f.sent), len(c.bodies))
+		}
+		constraints := []string{}
+		for _, v := range violations {
+			constraints = append(constraints, v.Constraint)
+		}
+		if strings.Join(constraints, ",") != strings.Join(c.constraints, ",") {
+			t.Errorf("%v: got violations %v; want %v", c.name, constraints, c.constraints)
+		}
+	}
+}
+
+func TestCheckOrgPolicies_Error(t *testing.T) {
+	d := &kfdefs.KfDef{Spec: kfdefs.KfDefSpec{Project: "acme", Zone: "us-east1-d"}}
+	f := &fakeRoundTripper{
+		codes:  []int{http.StatusForbidden},
+		bodies: []string{`{"error": {"code": 403, "message": "The caller does not have permission"}}`},
+	}
+	if _, err := CheckOrgPolicies(context.Background(), &http.Client{Transport: f}, d); err == nil {
+		t.Errorf("CheckOrgPolicies: want an error if the policies can't be read")
+	}
+}
@@ -0,0 +1,95 @@
+package gcp
+
+import (
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// PreemptiblePlacementName is the name of the KfDef placement of the preemptible node pool.
+	PreemptiblePlacementName = "gcp-preemptible-pool"
+	// PreemptibleNodeLabel is the label and taint GKE and cluster.jinja put on preemptible nodes.
+	PreemptibleNodeLabel = "cloud.google.com/gke-preemptible"
+	// defaultPreemptibleMachineType is the machine type of the preemptible nodes if none is set.
+	defaultPreemptibleMachineType = "n1-standard-8"
+)
+
+// PreemptiblePoolSpec configures a node pool of preemptible VMs dedicated to training. The nodes
+// are tainted so only the pods of the listed applications, which tolerate the taint, run on them.
+type PreemptiblePoolSpec struct {
+	// Applications are the names of the applications whose pods run on the pool e.g. the
+	// applications running training jobs.
+	Applications []string `json:"applications"`
+	// MachineType of the nodes; defaults to n1-standard-8.
+	MachineType string `json:"machineType,omitempty"`
+	// MinNodes and MaxNodes bound the autoscaling of the pool.
+	MinNodes int `json:"minNodes,omitempty"`
+	MaxNodes int `json:"maxNodes"`
+	// GpuType and GpusPerNode attach GPUs to the nodes e.g. nvidia-tesla-k80.
+	GpuType     string `json:"gpuType,omitempty"`
+	GpusPerNode int    `json:"gpusPerNode,omitempty"`
+}
+
+// IsValid returns true if the spec is valid.
+// If false it will also return a string providing a message about why its invalid.
+func (s *PreemptiblePoolSpec) IsValid() (bool, string) {
+	if len(s.Applications) == 0 {
+		return false, "PreemptiblePool.Applications must list the applications to run on the pool."
+	}
+	if s.MaxNodes <= 0 || s.MinNodes < 0 || s.MinNodes > s.MaxNodes {
+		return false, fmt.Sprintf("PreemptiblePool requires 0 <= minNodes <= maxNodes and maxNodes > 0; got %v and %v.", s.MinNodes, s.MaxNodes)
+	}
+	if (s.GpuType == "") != (s.GpusPerNode == 0) || s.GpusPerNode < 0 {
+		return false, "PreemptiblePool.GpuType and GpusPerNode must both be set to attach GPUs."
+	}
+	return true, ""
+}
+
+// preemptiblePlacement returns the placement which schedules the pods of the applications of
+// the pool onto its nodes.
+func preemptiblePlacement(s *PreemptiblePoolSpec) kfdefs.WorkloadPlacement {
+	return kfdefs.WorkloadPlacement{
+		Name:         PreemptiblePlacementName,
+		Applications: append([]string{}, s.Applications...),
+		NodeSelector: map[string]string{
+			PreemptibleNodeLabel: "true",
+		},
+		Tolerations: []v1.Toleration{
+			{
+				Key:      PreemptibleNodeLabel,
+				Operator: v1.TolerationOpEqual,
+				Value:    "true",
+				Effect:   v1.TaintEffectNoSchedule,
+			},
+		},
+	}
+}
+
+// setPreemptiblePoolProperties sets the properties of cluster.jinja creating the preemptible pool.
+// A pool with no nodes isn't created.
+func setPreemptiblePoolProperties(properties map[string]interface{}, s *PreemptiblePoolSpec) {
+	if s == nil {
+		properties["preemptible-pool-max-nodes"] = 0
+		return
+	}
+	machineType := s.MachineType
+	if machineType == "" {
+		machineType = defaultPreemptibleMachineType
+	}
+	properties["preemptible-pool-machine-type"] = machineType
+	properties["preemptible-pool-min-nodes"] = s.MinNodes
+	properties["preemptible-pool-max-nodes"] = s.MaxNodes
+	properties["preemptible-pool-gpu-type"] = s.GpuType
+	properties["preemptible-pool-gpu-number-per-node"] = s.GpusPerNode
+}
+
+// setPreemptiblePlacement adds the placement of the preemptible pool to the KfDef or removes it
+// if there is no pool.
+func (gcp *Gcp) setPreemptiblePlacement(s *PreemptiblePoolSpec) {
+	if s == nil {
+		gcp.kfDef.RemovePlacement(PreemptiblePlacementName)
+		return
+	}
+	gcp.kfDef.SetPlacement(preemptiblePlacement(s))
+}
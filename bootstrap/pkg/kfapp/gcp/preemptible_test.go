@@ -0,0 +1,82 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"reflect"
+	"testing"
+)
+
+func TestPreemptiblePoolSpec_IsValid(t *testing.T) {
+	type testCase struct {
+		input   PreemptiblePoolSpec
+		isValid bool
+	}
+
+	cases := []testCase{
+		{
+			input:   PreemptiblePoolSpec{Applications: []string{"tf-job-operator"}, MaxNodes: 4},
+			isValid: true,
+		},
+		{
+			input:   PreemptiblePoolSpec{Applications: []string{"tf-job-operator"}, MaxNodes: 4, GpuType: "nvidia-tesla-k80", GpusPerNode: 1},
+			isValid: true,
+		},
+		{
+			input:   PreemptiblePoolSpec{MaxNodes: 4},
+			isValid: false,
+		},
+		{
+			input:   PreemptiblePoolSpec{Applications: []string{"tf-job-operator"}},
+			isValid: false,
+		},
+		{
+			input:   PreemptiblePoolSpec{Applications: []string{"tf-job-operator"}, MinNodes: 5, MaxNodes: 4},
+			isValid: false,
+		},
+		{
+			input:   PreemptiblePoolSpec{Applications: []string{"tf-job-operator"}, MaxNodes: 4, GpuType: "nvidia-tesla-k80"},
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		isValid, _ := c.input.IsValid()
+		if isValid != c.isValid {
+			t.Errorf("IsValid(%+v): got %v; want %v", c.input, isValid, c.isValid)
+		}
+	}
+}
+
+func TestGcp_setPreemptiblePlacement(t *testing.T) {
+	gcp := &Gcp{
+		kfDef: &kfdefs.KfDef{},
+	}
+	spec := &PreemptiblePoolSpec{Applications: []string{"tf-job-operator", "pytorch-operator"}, MaxNodes: 4}
+
+	gcp.setPreemptiblePlacement(spec)
+	placements := gcp.kfDef.PlacementsFor("pytorch-operator")
+	if len(placements) != 1 || !reflect.DeepEqual(placements[0], preemptiblePlacement(spec)) {
+		t.Errorf("PlacementsFor(pytorch-operator): got %+v; want the preemptible placement", placements)
+	}
+	if placements := gcp.kfDef.PlacementsFor("jupyter"); len(placements) != 0 {
+		t.Errorf("PlacementsFor(jupyter): got %+v; want none", placements)
+	}
+
+	gcp.setPreemptiblePlacement(nil)
+	if gcp.kfDef.Spec.Placements != nil {
+		t.Errorf("Placements after removing the pool: got %+v; want nil", gcp.kfDef.Spec.Placements)
+	}
+
+	properties := map[string]interface{}{}
+	setPreemptiblePoolProperties(properties, spec)
+	expected := map[string]interface{}{
+		"preemptible-pool-machine-type":        defaultPreemptibleMachineType,
+		"preemptible-pool-min-nodes":           0,
+		"preemptible-pool-max-nodes":           4,
+		"preemptible-pool-gpu-type":            "",
+		"preemptible-pool-gpu-number-per-node": 0,
+	}
+	if !reflect.DeepEqual(properties, expected) {
+		t.Errorf("setPreemptiblePoolProperties: got %v; want %v", properties, expected)
+	}
+}
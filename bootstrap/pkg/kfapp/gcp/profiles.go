@@ -0,0 +1,330 @@
+package gcp
+
+import (
+	"fmt"
+	"github.com/cenkalti/backoff"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/storage/v1"
+	"hash/fnv"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// PROFILE_RESOURCES_CONFIGMAP is the ConfigMap in the namespace of a profile naming its cloud resources.
+	PROFILE_RESOURCES_CONFIGMAP = "gcp-profile-resources"
+	// PROFILE_KSA is the K8s service account of a profile bound to its GCP service account by workload identity.
+	PROFILE_KSA = "kf-user"
+	// PROFILE_BUCKET_ROLE is the role of the service account of a profile on its bucket.
+	PROFILE_BUCKET_ROLE = "roles/storage.objectAdmin"
+	// maxServiceAccountIdLength is the maximum length of the account id of a GCP service account.
+	maxServiceAccountIdLength = 30
+	// maxBucketNameLength is the maximum length of the name of a GCS bucket.
+	maxBucketNameLength = 63
+)
+
+// ProfileResourcesSpec provisions cloud resources for each of the profiles declared in the KfDef;
+// a service account whose identity the pods of the profile use and optionally a GCS bucket.
+// The resources aren't deleted with the deployment so the data of the profiles is kept.
+type ProfileResourcesSpec struct {
+	// Bucket creates a GCS bucket for each profile which its service account can read and write.
+	Bucket bool `json:"bucket,omitempty"`
+	// BucketLocation is the location of the buckets; defaults to the region of the zone.
+	BucketLocation string `json:"bucketLocation,omitempty"`
+	// Roles are project roles granted to the service account of each profile.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// shortenName truncates name to max characters replacing the end with a hash of the name so
+// truncated names stay unique.
+func shortenName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+	return strings.TrimRight(name[:max-len(suffix)], "-") + suffix
+}
+
+// profileServiceAccountId returns the account id of the service account of a profile.
+func profileServiceAccountId(deployment string, profile string) string {
+	return shortenName(deployment+"-"+profile, maxServiceAccountIdLength)
+}
+
+// profileBucketName returns the name of the bucket of a profile; bucket names are global so
+// it is prefixed with the project.
+func profileBucketName(project string, deployment string, profile string) string {
+	name := strings.Replace(strings.ToLower(project), ":", "-", -1)
+	return shortenName(name+"-"+deployment+"-"+profile, maxBucketNameLength)
+}
+
+// addBucketBinding adds member to role in the IAM policy of a bucket. It returns false if the
+// policy already has the binding.
+func addBucketBinding(policy *storage.Policy, role string, member string) bool {
+	for _, b := range policy.Bindings {
+		if b.Role != role {
+			continue
+		}
+		for _, m := range b.Members {
+			if m == member {
+				return false
+			}
+		}
+		b.Members = append(b.Members, member)
+		return true
+	}
+	policy.Bindings = append(policy.Bindings, &storage.PolicyBindings{
+		Role:    role,
+		Members: []string{member},
+	})
+	return true
+}
+
+// profileResourcesData returns the data of the ConfigMap naming the resources of a profile.
+func profileResourcesData(email string, bucket string) map[string]string {
+	data := map[string]string{
+		"serviceAccount": email,
+	}
+	if bucket != "" {
+		data["bucket"] = "gs://" + bucket
+	}
+	return data
+}
+
+// ProvisionProfileResources creates the cloud resources of the profiles declared in the KfDef
+// and wires them to the namespaces of the profiles; with workload identity the K8s service
+// account kf-user of the namespace acts as the service account of the profile, otherwise a key
+// of the service account is stored in the secret user-gcp-sa. It is a no-op unless the plugin
+// spec sets profileResources. The profiles must have been applied.
+func (gcp *Gcp) ProvisionProfileResources() error {
+	p, err := gcp.GetPluginSpec()
+	if err != nil {
+		return err
+	}
+	if p.ProfileResources == nil || len(gcp.kfDef.Spec.Profiles) == 0 {
+		return nil
+	}
+	spec := p.ProfileResources
+	ctx := context.Background()
+	project := gcp.kfDef.Spec.Project
+
+	iamService, err := iam.New(gcp.client)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating IAM service: %v", err),
+		}
+	}
+	var storageService *storage.Service
+	if spec.Bucket {
+		if storageService, err = storage.New(gcp.client); err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("Error creating storage service: %v", err),
+			}
+		}
+	}
+	k8sClient, err := gcp.getK8sClientset(ctx)
+	if err != nil {
+		return kfapis.NewKfErrorWithMessage(err, "set K8s clientset error")
+	}
+
+	emails := []string{}
+	for _, profile := range gcp.kfDef.Spec.Profiles {
+		email, err := gcp.createProfileServiceAccount(ctx, iamService, profile.Name)
+		if err != nil {
+			return err
+		}
+		emails = append(emails, email)
+	}
+
+	if len(spec.Roles) > 0 {
+		policy, err := utils.GetIamPolicy(project, gcp.client)
+		if err != nil {
+			return err
+		}
+		for _, email := range emails {
+			addBindings(policy, "serviceAccount:"+email, spec.Roles)
+		}
+		if err := utils.SetIamPolicy(project, policy, gcp.client); err != nil {
+			return err
+		}
+	}
+
+	for i, profile := range gcp.kfDef.Spec.Profiles {
+		email := emails[i]
+		bucket := ""
+		if spec.Bucket {
+			bucket = profileBucketName(project, gcp.kfDef.Name, profile.Name)
+			if err := gcp.createProfileBucket(ctx, storageService, bucket, spec.BucketLocation, email); err != nil {
+				return err
+			}
+		}
+
+		// The profile controller creates the namespace of the profile asynchronously.
+		if err := waitForNamespace(k8sClient, profile.Name); err != nil {
+			return err
+		}
+		if p.GetEnableWorkloadIdentity() {
+			if err := gcp.bindProfileServiceAccount(iamService, k8sClient, profile.Name, email); err != nil {
+				return err
+			}
+		} else if err := gcp.createGcpServiceAcctSecret(ctx, k8sClient, email, USER_SECRET_NAME, profile.Name); err != nil {
+			return kfapis.NewKfErrorWithMessage(err, fmt.Sprintf("cannot create secret %v in namespace %v", USER_SECRET_NAME, profile.Name))
+		}
+		if err := applyProfileResourcesConfigMap(k8sClient, profile.Name, profileResourcesData(email, bucket)); err != nil {
+			return err
+		}
+		log.Infof("Provisioned the resources of profile %v; service account %v bucket %q", profile.Name, email, bucket)
+	}
+	return nil
+}
+
+// createProfileServiceAccount creates the service account of a profile if it doesn't exist.
+func (gcp *Gcp) createProfileServiceAccount(ctx context.Context, iamService *iam.Service, profile string) (string, error) {
+	project := gcp.kfDef.Spec.Project
+	accountId := profileServiceAccountId(gcp.kfDef.Name, profile)
+	email := fmt.Sprintf("%v@%v.iam.gserviceaccount.com", accountId, project)
+
+	log.Infof("Creating service account %v for profile %v", email, profile)
+	_, err := iamService.Projects.ServiceAccounts.Create("projects/"+project, &iam.CreateServiceAccountRequest{
+		AccountId: accountId,
+		ServiceAccount: &iam.ServiceAccount{
+			DisplayName: fmt.Sprintf("Kubeflow profile %v of %v", profile, gcp.kfDef.Name),
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); !ok || gErr.Code != http.StatusConflict {
+			return "", &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("Error creating service account %v: %v", email, err),
+			}
+		}
+		log.Infof("Service account %v already exists", email)
+	}
+	return email, nil
+}
+
+// createProfileBucket creates the bucket of a profile if it doesn't exist and grants the service
+// account of the profile access to it.
+func (gcp *Gcp) createProfileBucket(ctx context.Context, storageService *storage.Service, bucket string,
+	location string, email string) error {
+	if location == "" {
+		location = zoneRegion(gcp.kfDef.Spec.Zone)
+	}
+	log.Infof("Creating bucket %v in %v", bucket, location)
+	_, err := storageService.Buckets.Insert(gcp.kfDef.Spec.Project, &storage.Bucket{
+		Name:     bucket,
+		Location: location,
+		Labels: map[string]string{
+			"kubeflow-deployment": gcp.kfDef.Name,
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); !ok || gErr.Code != http.StatusConflict {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("Error creating bucket %v: %v", bucket, err),
+			}
+		}
+		log.Infof("Bucket %v already exists", bucket)
+	}
+
+	policy, err := storageService.Buckets.GetIamPolicy(bucket).Context(ctx).Do()
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error getting the IAM policy of bucket %v: %v", bucket, err),
+		}
+	}
+	if !addBucketBinding(policy, PROFILE_BUCKET_ROLE, "serviceAccount:"+email) {
+		return nil
+	}
+	if _, err := storageService.Buckets.SetIamPolicy(bucket, policy).Context(ctx).Do(); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error setting the IAM policy of bucket %v: %v", bucket, err),
+		}
+	}
+	return nil
+}
+
+// bindProfileServiceAccount lets the K8s service account kf-user of the namespace of a profile
+// act as the service account of the profile.
+func (gcp *Gcp) bindProfileServiceAccount(iamService *iam.Service, k8sClient *clientset.Clientset,
+	namespace string, email string) error {
+	if err := createK8sServiceAccount(k8sClient, namespace, PROFILE_KSA, "serviceAccount:"+email); err != nil {
+		return err
+	}
+	policy, err := utils.GetServiceAccountIamPolicy(iamService, gcp.kfDef.Spec.Project, email)
+	if err != nil {
+		return err
+	}
+	member := fmt.Sprintf("serviceAccount:%v.svc.id.goog[%v/%v]", gcp.kfDef.Spec.Project, namespace, PROFILE_KSA)
+	for _, b := range policy.Bindings {
+		for _, m := range b.Members {
+			if b.Role == "roles/iam.workloadIdentityUser" && m == member {
+				return nil
+			}
+		}
+	}
+	if err := utils.UpdateWorkloadIdentityBindingsPolicy(policy, gcp.kfDef.Spec.Project, namespace, PROFILE_KSA); err != nil {
+		return err
+	}
+	return utils.SetServiceAccountIamPolicy(iamService, policy, gcp.kfDef.Spec.Project, email)
+}
+
+// applyProfileResourcesConfigMap creates or updates the ConfigMap naming the resources of a profile.
+func applyProfileResourcesConfigMap(k8sClient *clientset.Clientset, namespace string, data map[string]string) error {
+	configMaps := k8sClient.CoreV1().ConfigMaps(namespace)
+	existing, err := configMaps.Get(PROFILE_RESOURCES_CONFIGMAP, metav1.GetOptions{})
+	if err == nil {
+		existing.Data = data
+		_, err = configMaps.Update(existing)
+	} else {
+		_, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      PROFILE_RESOURCES_CONFIGMAP,
+				Namespace: namespace,
+			},
+			Data: data,
+		})
+	}
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error applying configmap %v/%v: %v", namespace, PROFILE_RESOURCES_CONFIGMAP, err),
+		}
+	}
+	return nil
+}
+
+// waitForNamespace waits for a namespace to be created.
+func waitForNamespace(k8sClient *clientset.Clientset, namespace string) error {
+	b := newDefaultBackoff()
+	b.MaxElapsedTime = 15 * time.Minute
+	err := backoff.Retry(func() error {
+		_, err := k8sClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+		if err != nil {
+			log.Warnf("Could not find namespace %v, wait and retry: %v", namespace, err)
+		}
+		return err
+	}, b)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Namespace %v wasn't created: %v", namespace, err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package gcp
+
+import (
+	"google.golang.org/api/storage/v1"
+	"reflect"
+	"testing"
+)
+
+func TestProfileResourceNames(t *testing.T) {
+	if actual := profileServiceAccountId("kf-app", "team-a"); actual != "kf-app-team-a" {
+		t.Errorf("profileServiceAccountId: got %v; want kf-app-team-a", actual)
+	}
+	long := profileServiceAccountId("kubeflow-production", "data-science-team")
+	if len(long) != maxServiceAccountIdLength {
+		t.Errorf("profileServiceAccountId: got %v with %v characters; want %v", long, len(long), maxServiceAccountIdLength)
+	}
+	if other := profileServiceAccountId("kubeflow-production", "data-science-team-2"); other == long {
+		t.Errorf("profileServiceAccountId: got %v for different profiles; want unique ids", other)
+	}
+
+	if actual := profileBucketName("my-project", "kf-app", "team-a"); actual != "my-project-kf-app-team-a" {
+		t.Errorf("profileBucketName: got %v; want my-project-kf-app-team-a", actual)
+	}
+	if actual := profileBucketName("acme.com:ml", "kf-app", "team-a"); actual != "acme.com-ml-kf-app-team-a" {
+		t.Errorf("profileBucketName of a domain scoped project: got %v; want acme.com-ml-kf-app-team-a", actual)
+	}
+}
+
+func TestAddBucketBinding(t *testing.T) {
+	policy := &storage.Policy{
+		Bindings: []*storage.PolicyBindings{
+			{Role: "roles/storage.legacyBucketOwner", Members: []string{"projectOwner:my-project"}},
+		},
+	}
+	member := "serviceAccount:kf-app-team-a@my-project.iam.gserviceaccount.com"
+	if !addBucketBinding(policy, PROFILE_BUCKET_ROLE, member) {
+		t.Errorf("addBucketBinding: got false; want the binding added")
+	}
+	if addBucketBinding(policy, PROFILE_BUCKET_ROLE, member) {
+		t.Errorf("addBucketBinding: got true for an existing binding; want false")
+	}
+
+	expected := []*storage.PolicyBindings{
+		{Role: "roles/storage.legacyBucketOwner", Members: []string{"projectOwner:my-project"}},
+		{Role: PROFILE_BUCKET_ROLE, Members: []string{member}},
+	}
+	if !reflect.DeepEqual(policy.Bindings, expected) {
+		t.Errorf("addBucketBinding: got bindings %+v; want %+v", policy.Bindings, expected)
+	}
+}
+
+func TestProfileResourcesData(t *testing.T) {
+	email := "kf-app-team-a@my-project.iam.gserviceaccount.com"
+	expected := map[string]string{
+		"serviceAccount": email,
+		"bucket":         "gs://my-project-kf-app-team-a",
+	}
+	if actual := profileResourcesData(email, "my-project-kf-app-team-a"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("profileResourcesData: got %v; want %v", actual, expected)
+	}
+	if actual := profileResourcesData(email, ""); !reflect.DeepEqual(actual, map[string]string{"serviceAccount": email}) {
+		t.Errorf("profileResourcesData without a bucket: got %v", actual)
+	}
+}
@@ -0,0 +1,311 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// googleapisHost serves several APIs under a path prefix each e.g. /deploymentmanager/v2.
+	googleapisHost = "www.googleapis.com"
+	// quotaRetryTimeout bounds how long a throttled request is retried.
+	quotaRetryTimeout = 3 * time.Minute
+)
+
+// APIQuota is the request budget of a GCP API shared by every client created by NewClient in
+// the process so concurrent deployments don't exceed the quota of the API together.
+type APIQuota struct {
+	// API is the service name of the API e.g. deploymentmanager.googleapis.com.
+	API string `json:"api"`
+	// RequestsPerSecond is the sustained rate of requests to the API.
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	// Burst is the number of requests which can be sent at once.
+	Burst int `json:"burst"`
+}
+
+// DefaultAPIQuotas are the budgets of the APIs called by the server; requests to other APIs
+// aren't rate limited but are still retried when they are throttled.
+var DefaultAPIQuotas = []APIQuota{
+	{API: "cloudresourcemanager.googleapis.com", RequestsPerSecond: 5, Burst: 10},
+	{API: "container.googleapis.com", RequestsPerSecond: 5, Burst: 10},
+	{API: "deploymentmanager.googleapis.com", RequestsPerSecond: 2, Burst: 5},
+	{API: "iam.googleapis.com", RequestsPerSecond: 5, Burst: 10},
+	{API: "servicemanagement.googleapis.com", RequestsPerSecond: 2, Burst: 5},
+}
+
+// rateLimitReasons are the reasons of the errors returned when a quota is exceeded; the request
+// can be sent again once the quota is refilled.
+var rateLimitReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"RATE_LIMIT_EXCEEDED":   true,
+}
+
+// transientReasons are the reasons of server errors which are expected to go away.
+var transientReasons = map[string]bool{
+	"backendError":  true,
+	"internalError": true,
+}
+
+// ValidateAPIQuotas returns an error unless each quota names an API and has a positive budget.
+func ValidateAPIQuotas(quotas []APIQuota) error {
+	for _, q := range quotas {
+		if q.API == "" {
+			return fmt.Errorf("GCP API quotas require an api")
+		}
+		if q.RequestsPerSecond <= 0 || q.Burst <= 0 {
+			return fmt.Errorf("requestsPerSecond and burst of the quota of %v must be positive", q.API)
+		}
+	}
+	return nil
+}
+
+// quotaPool holds the rate limiters of the APIs.
+type quotaPool struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	// pausedUntil is when the requests to an API may be sent again after it throttled a request.
+	pausedUntil map[string]time.Time
+}
+
+// sharedQuotaPool is used by every client created by NewClient.
+var sharedQuotaPool = newQuotaPool(DefaultAPIQuotas)
+
+func newQuotaPool(quotas []APIQuota) *quotaPool {
+	p := &quotaPool{
+		limiters:    map[string]*rate.Limiter{},
+		pausedUntil: map[string]time.Time{},
+	}
+	p.set(quotas)
+	return p
+}
+
+// set replaces the budgets. The tokens of a limiter are kept unless its burst changes.
+func (p *quotaPool) set(quotas []APIQuota) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	limiters := map[string]*rate.Limiter{}
+	for _, q := range quotas {
+		limit := rate.Limit(q.RequestsPerSecond)
+		if l, ok := p.limiters[q.API]; ok && l.Burst() == q.Burst {
+			l.SetLimit(limit)
+			limiters[q.API] = l
+			continue
+		}
+		limiters[q.API] = rate.NewLimiter(limit, q.Burst)
+	}
+	p.limiters = limiters
+}
+
+// wait blocks until a request may be sent to the API or ctx is done.
+func (p *quotaPool) wait(ctx context.Context, api string) error {
+	p.mu.Lock()
+	l, until := p.limiters[api], p.pausedUntil[api]
+	p.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+	if l == nil {
+		return nil
+	}
+	return l.Wait(ctx)
+}
+
+// pause holds back the requests to the API for d after it throttled a request so the clients
+// sharing the pool back off together.
+func (p *quotaPool) pause(api string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until := time.Now().Add(d); until.After(p.pausedUntil[api]) {
+		p.pausedUntil[api] = until
+	}
+}
+
+// SetAPIQuotas replaces the budgets of the shared quota pool; the defaults are used if quotas is empty.
+func SetAPIQuotas(quotas []APIQuota) {
+	if len(quotas) == 0 {
+		quotas = DefaultAPIQuotas
+	}
+	sharedQuotaPool.set(quotas)
+}
+
+// apiName returns the service name of the API req is sent to. The APIs served by
+// www.googleapis.com are identified by the first element of the path.
+func apiName(req *http.Request) string {
+	host := req.URL.Hostname()
+	if host != googleapisHost {
+		return host
+	}
+	pieces := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if len(pieces) > 1 && pieces[0] == "upload" {
+		pieces = strings.SplitN(pieces[1], "/", 2)
+	}
+	return pieces[0] + ".googleapis.com"
+}
+
+// isIdempotent returns true if sending the request twice has the same effect as sending it once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// shouldRetry returns true if the response is an error which is expected to go away when the
+// request is sent again later. Throttled requests are always retried since they weren't handled;
+// server errors are only retried for idempotent requests. body is the body of the response.
+func shouldRetry(method string, resp *http.Response, body []byte) (retry bool, throttled bool) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, true
+	}
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode < 500 {
+		return false, false
+	}
+	err := googleapi.CheckResponse(&http.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	})
+	reasons := []string{}
+	if gErr, ok := err.(*googleapi.Error); ok {
+		for _, e := range gErr.Errors {
+			reasons = append(reasons, e.Reason)
+		}
+	}
+	for _, r := range reasons {
+		if rateLimitReasons[r] {
+			return true, true
+		}
+	}
+	if resp.StatusCode == http.StatusForbidden || !isIdempotent(method) {
+		return false, false
+	}
+	for _, r := range reasons {
+		if transientReasons[r] {
+			return true, false
+		}
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, false
+	}
+	return false, false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the response or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return 0
+}
+
+// throttledTransport rate limits the requests to each API with a quota pool and retries the
+// requests which are throttled or fail with a transient server error with exponential backoff.
+type throttledTransport struct {
+	// base sends the requests; http.DefaultTransport if nil.
+	base       http.RoundTripper
+	pool       *quotaPool
+	newBackOff func() backoff.BackOff
+}
+
+func (t *throttledTransport) backOff() backoff.BackOff {
+	if t.newBackOff != nil {
+		return t.newBackOff()
+	}
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.MaxInterval = 30 * time.Second
+	b.MaxElapsedTime = quotaRetryTimeout
+	return b
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	api := apiName(req)
+	// A request can only be sent again if its body can be recreated.
+	canRetry := req.Body == nil || req.GetBody != nil
+	b := t.backOff()
+	for {
+		if err := t.pool.wait(req.Context(), api); err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		if err != nil || !canRetry {
+			return resp, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		retry, throttled := shouldRetry(req.Method, resp, body)
+		if !retry {
+			return resp, nil
+		}
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			return resp, nil
+		}
+		if d := retryAfter(resp); d > next {
+			next = d
+		}
+		if throttled {
+			t.pool.pause(api, next)
+		}
+		log.Warnf("%v %v returned %v; retrying in %v", req.Method, api, resp.Status, next)
+
+		if req.GetBody != nil {
+			r := req.WithContext(req.Context())
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+			req = r
+		}
+		if !throttled {
+			timer := time.NewTimer(next)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			}
+		}
+	}
+}
+
+// NewClient returns a client for the GCP APIs authorized by ts. The requests of all the clients
+// are rate limited by the shared quota pool and retried when they are throttled so server side
+// deployments running concurrently stay within the quotas of the project.
+func NewClient(ctx context.Context, ts oauth2.TokenSource) *http.Client {
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.ReuseTokenSource(nil, ts),
+			Base:   &throttledTransport{pool: sharedQuotaPool},
+		},
+	}
+}
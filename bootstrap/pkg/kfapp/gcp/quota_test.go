@@ -0,0 +1,122 @@
+package gcp
+
+import (
+	"bytes"
+	"github.com/cenkalti/backoff"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeRoundTripper returns the responses in order and records the requests.
+type fakeRoundTripper struct {
+	codes  []int
+	bodies []string
+	sent   []*http.Request
+}
+
+func (f *fakeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := len(f.sent)
+	f.sent = append(f.sent, req)
+	return &http.Response{
+		StatusCode: f.codes[i],
+		Status:     http.StatusText(f.codes[i]),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(f.bodies[i])),
+	}, nil
+}
+
+const rateLimitedBody = `{"error": {"code": 403, "message": "Rate Limit Exceeded", "errors": [{"reason": "rateLimitExceeded"}]}}`
+
+func TestAPIName(t *testing.T) {
+	cases := map[string]string{
+		"https://container.googleapis.com/v1/projects/acme":                  "container.googleapis.com",
+		"https://www.googleapis.com/deploymentmanager/v2/projects/acme":      "deploymentmanager.googleapis.com",
+		"https://www.googleapis.com/upload/storage/v1/b/acme/o?name=kf.yaml": "storage.googleapis.com",
+	}
+	for u, expected := range cases {
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		if api := apiName(req); api != expected {
+			t.Errorf("apiName(%v): got %v; want %v", u, api, expected)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	type testCase struct {
+		method    string
+		code      int
+		body      string
+		retry     bool
+		throttled bool
+	}
+	cases := []testCase{
+		{method: http.MethodPost, code: http.StatusTooManyRequests, retry: true, throttled: true},
+		{method: http.MethodPost, code: http.StatusForbidden, body: rateLimitedBody, retry: true, throttled: true},
+		{method: http.MethodGet, code: http.StatusForbidden, body: `{"error": {"code": 403, "errors": [{"reason": "forbidden"}]}}`},
+		{method: http.MethodGet, code: http.StatusInternalServerError, body: `{"error": {"code": 500, "errors": [{"reason": "backendError"}]}}`, retry: true},
+		{method: http.MethodPost, code: http.StatusServiceUnavailable},
+		{method: http.MethodGet, code: http.StatusServiceUnavailable, retry: true},
+		{method: http.MethodGet, code: http.StatusNotFound},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.code, Header: http.Header{}}
+		retry, throttled := shouldRetry(c.method, resp, []byte(c.body))
+		if retry != c.retry || throttled != c.throttled {
+			t.Errorf("shouldRetry(%v, %v, %v): got %v, %v; want %v, %v", c.method, c.code, c.body,
+				retry, throttled, c.retry, c.throttled)
+		}
+	}
+}
+
+func TestThrottledTransport(t *testing.T) {
+	base := &fakeRoundTripper{
+		codes:  []int{http.StatusForbidden, http.StatusOK},
+		bodies: []string{rateLimitedBody, `{"name": "kf-app"}`},
+	}
+	tr := &throttledTransport{
+		base:       base,
+		pool:       newQuotaPool(DefaultAPIQuotas),
+		newBackOff: func() backoff.BackOff { return &backoff.ZeroBackOff{} },
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://www.googleapis.com/deploymentmanager/v2/projects/acme",
+		bytes.NewBufferString(`{"name": "kf-app"}`))
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != `{"name": "kf-app"}` {
+		t.Errorf("RoundTrip: got %v %s", resp.StatusCode, body)
+	}
+	if len(base.sent) != 2 {
+		t.Fatalf("RoundTrip sent %v requests; want 2", len(base.sent))
+	}
+	if sent, _ := ioutil.ReadAll(base.sent[1].Body); string(sent) != `{"name": "kf-app"}` {
+		t.Errorf("RoundTrip retried with body %s", sent)
+	}
+
+	// Requests which aren't idempotent aren't retried after server errors.
+	base = &fakeRoundTripper{codes: []int{http.StatusServiceUnavailable}, bodies: []string{""}}
+	tr.base = base
+	req, _ = http.NewRequest(http.MethodPost, "https://container.googleapis.com/v1/projects/acme", nil)
+	if resp, err := tr.RoundTrip(req); err != nil || resp.StatusCode != http.StatusServiceUnavailable || len(base.sent) != 1 {
+		t.Errorf("RoundTrip: got %v, %v after %v requests", resp, err, len(base.sent))
+	}
+}
+
+func TestQuotaPool_set(t *testing.T) {
+	p := newQuotaPool(DefaultAPIQuotas)
+	l := p.limiters["iam.googleapis.com"]
+	p.set([]APIQuota{{API: "iam.googleapis.com", RequestsPerSecond: 1, Burst: 10}})
+	if p.limiters["iam.googleapis.com"] != l || float64(l.Limit()) != 1 {
+		t.Errorf("set replaced the limiter of an API whose burst didn't change")
+	}
+	if _, ok := p.limiters["container.googleapis.com"]; ok {
+		t.Errorf("set kept the limiter of an API without a quota")
+	}
+	if err := ValidateAPIQuotas([]APIQuota{{API: "iam.googleapis.com"}}); err == nil {
+		t.Errorf("ValidateAPIQuotas: want an error for a quota without a budget")
+	}
+}
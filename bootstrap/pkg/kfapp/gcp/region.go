@@ -0,0 +1,262 @@
+package gcp
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/deploymentmanager/v2"
+	"google.golang.org/api/googleapi"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// regionalClusterZones is the number of zones GKE spreads the nodes of a regional cluster across.
+	regionalClusterZones = 3
+	// defaultNodeDiskSizeGb is the size of the boot disk of the nodes; cluster.jinja uses the GKE default.
+	defaultNodeDiskSizeGb = 100
+)
+
+// ClusterLocation returns the location of the GKE cluster of a deployment; its region if it is a
+// regional cluster otherwise its zone.
+func ClusterLocation(kfDef *kfdefs.KfDef) string {
+	if kfDef.Spec.Region != "" {
+		return kfDef.Spec.Region
+	}
+	return ClusterZone(kfDef)
+}
+
+// zoneRegion returns the region of a zone e.g. us-east1 for us-east1-d.
+func zoneRegion(zone string) string {
+	i := strings.LastIndex(zone, "-")
+	if i < 0 {
+		return zone
+	}
+	return zone[:i]
+}
+
+// nodePoolQuota is the number and shape of the nodes a node pool creates in each zone.
+type nodePoolQuota struct {
+	nodes       int64
+	machineType string
+	gpusPerNode int64
+	gpuType     string
+}
+
+// intProperty returns a numeric property of a DM template; YAML numbers are parsed as floats.
+func intProperty(properties map[string]interface{}, name string) int64 {
+	switch v := properties[name].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	}
+	return 0
+}
+
+// clusterNodePools returns the node pools created by cluster.jinja with the given properties.
+func clusterNodePools(properties map[string]interface{}) []nodePoolQuota {
+	pools := []nodePoolQuota{}
+	if n := intProperty(properties, "cpu-pool-initialNodeCount"); n > 0 {
+		machineType, _ := properties["cpu-pool-machine-type"].(string)
+		pools = append(pools, nodePoolQuota{nodes: n, machineType: machineType})
+	}
+	// The GPU pool is only created if it can scale up.
+	if n := intProperty(properties, "gpu-pool-initialNodeCount"); n > 0 && intProperty(properties, "gpu-pool-max-nodes") > 0 {
+		machineType, _ := properties["gpu-pool-machine-type"].(string)
+		gpuType, _ := properties["gpu-type"].(string)
+		pools = append(pools, nodePoolQuota{
+			nodes:       n,
+			machineType: machineType,
+			gpusPerNode: intProperty(properties, "gpu-number-per-node"),
+			gpuType:     gpuType,
+		})
+	}
+	return pools
+}
+
+// gpuQuotaMetric returns the regional quota metric of a GPU type e.g. NVIDIA_K80_GPUS for nvidia-tesla-k80.
+func gpuQuotaMetric(gpuType string) string {
+	model := strings.TrimPrefix(strings.TrimPrefix(gpuType, "nvidia-"), "tesla-")
+	return "NVIDIA_" + strings.ToUpper(strings.Replace(model, "-", "_", -1)) + "_GPUS"
+}
+
+// quotaRequirements returns the regional quota needed by the node pools when each is created in
+// the given number of zones. cpus is the number of CPUs of each machine type. Nodes of private
+// clusters don't have external IPs.
+func quotaRequirements(pools []nodePoolQuota, zones int64, cpus map[string]int64, private bool) map[string]float64 {
+	required := map[string]float64{}
+	for _, p := range pools {
+		nodes := float64(p.nodes * zones)
+		required["CPUS"] += nodes * float64(cpus[p.machineType])
+		required["DISKS_TOTAL_GB"] += nodes * defaultNodeDiskSizeGb
+		if !private {
+			required["IN_USE_ADDRESSES"] += nodes
+		}
+		if p.gpusPerNode > 0 && p.gpuType != "" {
+			required[gpuQuotaMetric(p.gpuType)] += nodes * float64(p.gpusPerNode)
+		}
+	}
+	return required
+}
+
+// quotaShortfalls returns a message for each metric whose available quota is less than required.
+// Metrics missing from quotas are ignored.
+func quotaShortfalls(required map[string]float64, quotas []*compute.Quota) []string {
+	available := map[string]*compute.Quota{}
+	for _, q := range quotas {
+		available[q.Metric] = q
+	}
+
+	metrics := []string{}
+	for m := range required {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	shortfalls := []string{}
+	for _, m := range metrics {
+		q, ok := available[m]
+		if !ok || required[m] <= q.Limit-q.Usage {
+			continue
+		}
+		shortfalls = append(shortfalls, fmt.Sprintf("%v requires %v but only %v of %v are available",
+			m, required[m], q.Limit-q.Usage, q.Limit))
+	}
+	return shortfalls
+}
+
+// readClusterProperties returns the properties of the cluster.jinja resource in the cluster config.
+func readClusterProperties(clusterFile string) (map[string]interface{}, error) {
+	buf, err := ioutil.ReadFile(clusterFile)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error reading %v: %v", clusterFile, err),
+		}
+	}
+
+	var data struct {
+		Resources []struct {
+			Type       string                 `json:"type"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"resources"`
+	}
+	if err := yaml.Unmarshal(buf, &data); err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error parsing %v: %v", clusterFile, err),
+		}
+	}
+	for _, r := range data.Resources {
+		if r.Type == "cluster.jinja" {
+			return r.Properties, nil
+		}
+	}
+	return nil, &kfapis.KfError{
+		Code:    int(kfapis.INVALID_ARGUMENT),
+		Message: fmt.Sprintf("Invalid cluster config %v - not able to find the cluster.jinja resource.", clusterFile),
+	}
+}
+
+// deploymentExists returns true if the Deployment Manager deployment exists.
+func (gcp *Gcp) deploymentExists(ctx context.Context, name string) (bool, error) {
+	deploymentmanagerService, err := deploymentmanager.New(gcp.client)
+	if err != nil {
+		return false, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating deploymentmanagerService: %v", err),
+		}
+	}
+	_, err = deploymentmanagerService.Deployments.Get(gcp.kfDef.Spec.Project, name).Context(ctx).Do()
+	if err == nil {
+		return true, nil
+	}
+	if e, ok := err.(*googleapi.Error); ok && e.Code == 404 {
+		return false, nil
+	}
+	return false, &kfapis.KfError{
+		Code:    int(kfapis.INTERNAL_ERROR),
+		Message: fmt.Sprintf("Error getting deployment %v/%v: %v", gcp.kfDef.Spec.Project, name, err),
+	}
+}
+
+// checkQuota returns an error if the region of the deployment doesn't have the quota for the
+// nodes of the cluster. It only runs before the cluster is created; node pools which autoscale
+// can still run out of quota later.
+func (gcp *Gcp) checkQuota(ctx context.Context) error {
+	exists, err := gcp.deploymentExists(ctx, gcp.kfDef.Name)
+	if err != nil || exists {
+		return err
+	}
+
+	project := gcp.kfDef.Spec.Project
+	properties, err := readClusterProperties(path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, CONFIG_FILE))
+	if err != nil {
+		return err
+	}
+	pools := clusterNodePools(properties)
+	if len(pools) == 0 {
+		return nil
+	}
+
+	computeService, err := compute.New(gcp.client)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error creating compute client: %v", err),
+		}
+	}
+
+	cpus := map[string]int64{}
+	for _, p := range pools {
+		if _, ok := cpus[p.machineType]; ok {
+			continue
+		}
+		mt, err := computeService.MachineTypes.Get(project, ClusterZone(gcp.kfDef), p.machineType).Context(ctx).Do()
+		if err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("Error getting machine type %v in zone %v: %v", p.machineType, ClusterZone(gcp.kfDef), err),
+			}
+		}
+		cpus[p.machineType] = mt.GuestCpus
+	}
+
+	zones := int64(1)
+	if gcp.kfDef.Spec.Region != "" {
+		zones = regionalClusterZones
+	}
+	private := false
+	if securityConfig, ok := properties["securityConfig"].(map[string]interface{}); ok {
+		private, _ = securityConfig["privatecluster"].(bool)
+	}
+	required := quotaRequirements(pools, zones, cpus, private)
+
+	region := zoneRegion(gcp.kfDef.Spec.Zone)
+	r, err := computeService.Regions.Get(project, region).Context(ctx).Do()
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error getting the quotas of region %v: %v", region, err),
+		}
+	}
+	if shortfalls := quotaShortfalls(required, r.Quotas); len(shortfalls) > 0 {
+		return &kfapis.KfError{
+			Code: int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Insufficient quota in region %v to create cluster %v: %v; request an increase at "+
+				"https://console.cloud.google.com/iam-admin/quotas?project=%v",
+				region, gcp.kfDef.Name, strings.Join(shortfalls, "; "), project),
+		}
+	}
+	log.Infof("Region %v has the quota for cluster %v", region, gcp.kfDef.Name)
+	return nil
+}
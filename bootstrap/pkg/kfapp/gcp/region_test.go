@@ -0,0 +1,123 @@
+package gcp
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"google.golang.org/api/compute/v1"
+	"reflect"
+	"testing"
+)
+
+func TestClusterLocation(t *testing.T) {
+	d := &kfdefs.KfDef{
+		Spec: kfdefs.KfDefSpec{
+			Zone: "us-east1-d",
+		},
+	}
+	if actual := ClusterLocation(d); actual != "us-east1-d" {
+		t.Errorf("ClusterLocation of a zonal cluster: got %v; want us-east1-d", actual)
+	}
+	d.Spec.Region = "us-east1"
+	if actual := ClusterLocation(d); actual != "us-east1" {
+		t.Errorf("ClusterLocation of a regional cluster: got %v; want us-east1", actual)
+	}
+
+	cases := map[string]string{
+		"us-east1-d":         "us-east1",
+		"europe-west4-a":     "europe-west4",
+		"northamerica-ne1-b": "northamerica-ne1",
+	}
+	for zone, expected := range cases {
+		if actual := zoneRegion(zone); actual != expected {
+			t.Errorf("zoneRegion(%v): got %v; want %v", zone, actual, expected)
+		}
+	}
+}
+
+func TestClusterNodePools(t *testing.T) {
+	properties := map[string]interface{}{
+		"cpu-pool-initialNodeCount": float64(2),
+		"cpu-pool-machine-type":     "n1-standard-8",
+		"gpu-pool-initialNodeCount": float64(1),
+		"gpu-pool-machine-type":     "n1-standard-4",
+		"gpu-pool-max-nodes":        float64(4),
+		"gpu-number-per-node":       float64(2),
+		"gpu-type":                  "nvidia-tesla-k80",
+	}
+
+	expected := []nodePoolQuota{
+		{nodes: 2, machineType: "n1-standard-8"},
+		{nodes: 1, machineType: "n1-standard-4", gpusPerNode: 2, gpuType: "nvidia-tesla-k80"},
+	}
+	if actual := clusterNodePools(properties); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("clusterNodePools: got %+v; want %+v", actual, expected)
+	}
+
+	// The GPU pool isn't created if it can't scale up.
+	properties["gpu-pool-max-nodes"] = float64(0)
+	if actual := clusterNodePools(properties); !reflect.DeepEqual(actual, expected[:1]) {
+		t.Errorf("clusterNodePools without a GPU pool: got %+v; want %+v", actual, expected[:1])
+	}
+}
+
+func TestGpuQuotaMetric(t *testing.T) {
+	cases := map[string]string{
+		"nvidia-tesla-k80":  "NVIDIA_K80_GPUS",
+		"nvidia-tesla-v100": "NVIDIA_V100_GPUS",
+		"nvidia-tesla-t4":   "NVIDIA_T4_GPUS",
+	}
+	for gpuType, expected := range cases {
+		if actual := gpuQuotaMetric(gpuType); actual != expected {
+			t.Errorf("gpuQuotaMetric(%v): got %v; want %v", gpuType, actual, expected)
+		}
+	}
+}
+
+func TestQuotaShortfalls(t *testing.T) {
+	pools := []nodePoolQuota{
+		{nodes: 2, machineType: "n1-standard-8"},
+		{nodes: 1, machineType: "n1-standard-4", gpusPerNode: 2, gpuType: "nvidia-tesla-k80"},
+	}
+	cpus := map[string]int64{"n1-standard-8": 8, "n1-standard-4": 4}
+
+	required := quotaRequirements(pools, regionalClusterZones, cpus, false)
+	expected := map[string]float64{
+		"CPUS":             60,
+		"DISKS_TOTAL_GB":   900,
+		"IN_USE_ADDRESSES": 9,
+		"NVIDIA_K80_GPUS":  6,
+	}
+	if !reflect.DeepEqual(required, expected) {
+		t.Errorf("quotaRequirements: got %v; want %v", required, expected)
+	}
+
+	if private := quotaRequirements(pools, 1, cpus, true); private["IN_USE_ADDRESSES"] != 0 {
+		t.Errorf("quotaRequirements of a private cluster: got %v addresses; want 0", private["IN_USE_ADDRESSES"])
+	}
+
+	quotas := []*compute.Quota{
+		{Metric: "CPUS", Limit: 72, Usage: 24},
+		{Metric: "DISKS_TOTAL_GB", Limit: 4096, Usage: 0},
+		{Metric: "IN_USE_ADDRESSES", Limit: 8, Usage: 0},
+	}
+	shortfalls := quotaShortfalls(required, quotas)
+	want := []string{
+		"CPUS requires 60 but only 48 of 72 are available",
+		"IN_USE_ADDRESSES requires 9 but only 8 of 8 are available",
+	}
+	if !reflect.DeepEqual(shortfalls, want) {
+		t.Errorf("quotaShortfalls: got %v; want %v", shortfalls, want)
+	}
+}
+
+func TestIsValidRegion(t *testing.T) {
+	d := kfdefs.KfDef{
+		Spec: kfdefs.KfDefSpec{
+			Project: "p",
+			Zone:    "us-east1-d",
+			Region:  "us-west1",
+		},
+	}
+	if isValid, _ := IsValid(d); isValid {
+		t.Errorf("IsValid with zone %v outside region %v: got true; want false", d.Spec.Zone, d.Spec.Region)
+	}
+}
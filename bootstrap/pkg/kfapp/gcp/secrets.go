@@ -0,0 +1,208 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"k8s.io/api/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SecretsBackend identifies where credentials generated during deployment are stored.
+type SecretsBackend string
+
+const (
+	// SecretsBackendKubernetes stores credentials as Kubernetes Secrets.
+	SecretsBackendKubernetes SecretsBackend = "kubernetes"
+	// SecretsBackendVault stores credentials in a HashiCorp Vault KV version 2 secrets engine.
+	// They are also written as Kubernetes Secrets since the IAP and basic auth components mount them.
+	SecretsBackendVault SecretsBackend = "vault"
+
+	DEFAULT_VAULT_MOUNT = "secret"
+	// VAULT_TOKEN_HEADER is the header used to authenticate requests to Vault.
+	VAULT_TOKEN_HEADER = "X-Vault-Token"
+	// VAULT_TIMEOUT is the timeout of requests to Vault.
+	VAULT_TIMEOUT = 30 * time.Second
+)
+
+// SecretsSpec configures where credentials such as the basic auth password hash and the
+// IAP OAuth client secret are stored. Defaults to Kubernetes Secrets.
+type SecretsSpec struct {
+	Backend SecretsBackend `json:"backend,omitempty"`
+	Vault   *VaultSpec     `json:"vault,omitempty"`
+}
+
+type VaultSpec struct {
+	// Address of the Vault server e.g. https://vault.acme.com:8200.
+	Address string `json:"address,omitempty"`
+	// Mount is the path the KV version 2 secrets engine is mounted at; defaults to secret.
+	Mount string `json:"mount,omitempty"`
+	// PathPrefix is the path under which secrets are written as <pathPrefix>/<namespace>/<name>.
+	// Defaults to kubeflow/<deployment name>.
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// Token is a reference to the KfDef secret containing the Vault token.
+	Token *kfdefs.SecretRef `json:"token,omitempty"`
+}
+
+// IsValid returns true if the spec is valid.
+// If false it will also return a string providing a message about why its invalid.
+func (s *SecretsSpec) IsValid() (bool, string) {
+	switch s.Backend {
+	case "", SecretsBackendKubernetes:
+		return true, ""
+	case SecretsBackendVault:
+		msg := ""
+		if s.Vault == nil {
+			return false, "Secrets backend vault requires vault. "
+		}
+		if s.Vault.Address == "" {
+			msg += "Secrets.Vault requires address. "
+		}
+		if s.Vault.Token == nil || s.Vault.Token.Name == "" {
+			msg += "Secrets.Vault requires token. "
+		}
+		return msg == "", msg
+	default:
+		return false, fmt.Sprintf("Secrets.Backend %v isn't supported; must be one of %v, %v. ",
+			s.Backend, SecretsBackendKubernetes, SecretsBackendVault)
+	}
+}
+
+// SecretsProvider stores credentials generated during deployment.
+type SecretsProvider interface {
+	// WriteSecret creates or updates secret.
+	WriteSecret(ctx context.Context, secret *v1.Secret) error
+}
+
+// kubernetesSecretsProvider stores credentials as Kubernetes Secrets.
+type kubernetesSecretsProvider struct {
+	client *clientset.Clientset
+}
+
+func (p *kubernetesSecretsProvider) WriteSecret(ctx context.Context, secret *v1.Secret) error {
+	return createOrUpdateSecret(p.client, secret)
+}
+
+// vaultSecretsProvider stores credentials in Vault.
+//
+// The Kubeflow components read their credentials from Kubernetes Secrets rather than Vault so
+// each secret is also written to mirror if it is set.
+type vaultSecretsProvider struct {
+	client  *http.Client
+	address string
+	mount   string
+	prefix  string
+	token   string
+	mirror  SecretsProvider
+}
+
+// newVaultSecretsProvider creates a vaultSecretsProvider for the deployment kfDef mirroring secrets to mirror.
+func newVaultSecretsProvider(kfDef *kfdefs.KfDef, spec *VaultSpec, mirror SecretsProvider) (*vaultSecretsProvider, error) {
+	token, err := kfDef.GetSecret(spec.Token.Name)
+	if err != nil {
+		log.Errorf("Could not read the Vault token from KfDef; error %v", err)
+		return nil, err
+	}
+
+	p := &vaultSecretsProvider{
+		client:  &http.Client{Timeout: VAULT_TIMEOUT},
+		address: strings.TrimSuffix(spec.Address, "/"),
+		mount:   strings.Trim(spec.Mount, "/"),
+		prefix:  strings.Trim(spec.PathPrefix, "/"),
+		token:   token,
+		mirror:  mirror,
+	}
+
+	if p.mount == "" {
+		p.mount = DEFAULT_VAULT_MOUNT
+	}
+	if p.prefix == "" {
+		p.prefix = "kubeflow/" + kfDef.Name
+	}
+	return p, nil
+}
+
+// secretURL returns the URL of the KV version 2 data endpoint for secret.
+func (p *vaultSecretsProvider) secretURL(secret *v1.Secret) string {
+	return fmt.Sprintf("%v/v1/%v/data/%v/%v/%v", p.address, p.mount, p.prefix, secret.Namespace, secret.Name)
+}
+
+func (p *vaultSecretsProvider) WriteSecret(ctx context.Context, secret *v1.Secret) error {
+	data := map[string]string{}
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	for k, v := range secret.StringData {
+		data[k] = v
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"data": data,
+	})
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Could not marshal secret %v.%v: %v", secret.Namespace, secret.Name, err),
+		}
+	}
+
+	u := p.secretURL(secret)
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Could not create request for %v: %v", u, err),
+		}
+	}
+	req.Header.Set(VAULT_TOKEN_HEADER, p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	log.Infof("Writing secret %v.%v to Vault %v", secret.Namespace, secret.Name, u)
+	res, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("Error writing secret %v.%v to Vault: %v", secret.Namespace, secret.Name, err),
+		}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Vault returned %v writing secret %v.%v: %v", res.Status, secret.Namespace, secret.Name, string(msg)),
+		}
+	}
+
+	if p.mirror == nil {
+		return nil
+	}
+	return p.mirror.WriteSecret(ctx, secret)
+}
+
+// getSecretsProvider returns the SecretsProvider selected by the plugin spec.
+func (gcp *Gcp) getSecretsProvider(client *clientset.Clientset) (SecretsProvider, error) {
+	if gcp.secretsProvider != nil {
+		return gcp.secretsProvider, nil
+	}
+
+	p, err := gcp.GetPluginSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	k8sProvider := &kubernetesSecretsProvider{client: client}
+	if p.Secrets != nil && p.Secrets.Backend == SecretsBackendVault {
+		return newVaultSecretsProvider(gcp.kfDef, p.Secrets.Vault, k8sProvider)
+	}
+	return k8sProvider, nil
+}
@@ -0,0 +1,180 @@
+package gcp
+
+import (
+	"encoding/json"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"golang.org/x/net/context"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSecretsSpec_IsValid(t *testing.T) {
+	type testCase struct {
+		input    *SecretsSpec
+		expected bool
+	}
+
+	cases := []testCase{
+		{
+			input:    &SecretsSpec{},
+			expected: true,
+		},
+		{
+			input: &SecretsSpec{
+				Backend: SecretsBackendVault,
+			},
+			expected: false,
+		},
+		{
+			input: &SecretsSpec{
+				Backend: SecretsBackendVault,
+				Vault: &VaultSpec{
+					Address: "https://vault.acme.com:8200",
+				},
+			},
+			expected: false,
+		},
+		{
+			input: &SecretsSpec{
+				Backend: SecretsBackendVault,
+				Vault: &VaultSpec{
+					Address: "https://vault.acme.com:8200",
+					Token: &kfdefs.SecretRef{
+						Name: "vault-token",
+					},
+				},
+			},
+			expected: true,
+		},
+		{
+			input: &SecretsSpec{
+				Backend: "aws",
+			},
+			expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		if actual, msg := c.input.IsValid(); actual != c.expected {
+			t.Errorf("IsValid(%+v): got %v; want %v; msg %v", c.input, actual, c.expected, msg)
+		}
+	}
+}
+
+// fakeSecretsProvider records the secrets written to it.
+type fakeSecretsProvider struct {
+	secrets []*v1.Secret
+}
+
+func (f *fakeSecretsProvider) WriteSecret(ctx context.Context, secret *v1.Secret) error {
+	f.secrets = append(f.secrets, secret)
+	return nil
+}
+
+func TestVaultSecretsProvider_WriteSecret(t *testing.T) {
+	var gotPath string
+	var gotToken string
+	var gotBody map[string]map[string]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotToken = r.Header.Get(VAULT_TOKEN_HEADER)
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	kfDef := &kfdefs.KfDef{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kf-app",
+		},
+		Spec: kfdefs.KfDefSpec{
+			Secrets: []kfdefs.Secret{
+				{
+					Name: "vault-token",
+					SecretSource: &kfdefs.SecretSource{
+						LiteralSource: &kfdefs.LiteralSource{
+							Value: "s.1234",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	mirror := &fakeSecretsProvider{}
+	p, err := newVaultSecretsProvider(kfDef, &VaultSpec{
+		Address: server.URL + "/",
+		Token: &kfdefs.SecretRef{
+			Name: "vault-token",
+		},
+	}, mirror)
+	if err != nil {
+		t.Fatalf("newVaultSecretsProvider error; %v", err)
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BASIC_AUTH_SECRET,
+			Namespace: "kubeflow",
+		},
+		Data: map[string][]byte{
+			"username":     []byte("admin"),
+			"passwordhash": []byte("hash"),
+		},
+	}
+
+	if err := p.WriteSecret(context.Background(), secret); err != nil {
+		t.Fatalf("WriteSecret error; %v", err)
+	}
+
+	if expected := "/v1/secret/data/kubeflow/kf-app/kubeflow/" + BASIC_AUTH_SECRET; gotPath != expected {
+		t.Errorf("Got path %v; want %v", gotPath, expected)
+	}
+
+	if gotToken != "s.1234" {
+		t.Errorf("Got token %v; want s.1234", gotToken)
+	}
+
+	expected := map[string]string{
+		"username":     "admin",
+		"passwordhash": "hash",
+	}
+	if !reflect.DeepEqual(gotBody["data"], expected) {
+		t.Errorf("Got data %v; want %v", gotBody["data"], expected)
+	}
+
+	// The components mount the Kubernetes Secret so it must be written too.
+	if len(mirror.secrets) != 1 || mirror.secrets[0] != secret {
+		t.Errorf("Got mirrored secrets %v; want %v", mirror.secrets, secret.Name)
+	}
+	if p.client.Timeout != VAULT_TIMEOUT {
+		t.Errorf("Got client timeout %v; want %v", p.client.Timeout, VAULT_TIMEOUT)
+	}
+}
+
+func TestVaultSecretsProvider_WriteSecretError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+	}))
+	defer server.Close()
+
+	p := &vaultSecretsProvider{
+		client:  http.DefaultClient,
+		address: server.URL,
+		mount:   DEFAULT_VAULT_MOUNT,
+		prefix:  "kubeflow/kf-app",
+	}
+
+	if err := p.WriteSecret(context.Background(), &v1.Secret{}); err == nil {
+		t.Errorf("WriteSecret: want error; got nil")
+	}
+}
@@ -19,6 +19,10 @@ func IsValid(kfDef kfdefs.KfDef) (bool, string) {
 		return false, "KfDef.Spec.Zone is required"
 	}
 
+	if kfDef.Spec.Region != "" && zoneRegion(kfDef.Spec.Zone) != kfDef.Spec.Region {
+		return false, fmt.Sprintf("KfDef.Spec.Zone %v must be in KfDef.Spec.Region %v", kfDef.Spec.Zone, kfDef.Spec.Region)
+	}
+
 	// Set the GCPPluginSpec.
 	pluginSpec := &GcpPluginSpec{}
 	if err := (&kfDef).GetPluginSpec(GcpPluginName, pluginSpec); err != nil {
@@ -28,5 +32,9 @@ func IsValid(kfDef kfdefs.KfDef) (bool, string) {
 		return false, fmt.Sprintf("The plugin named %v could not be desirealized as type GcpPluginSpec; error %v", GcpPluginName, err)
 	}
 
+	if isValid, msg := validFallbackZones(kfDef, pluginSpec.FallbackZones); !isValid {
+		return false, msg
+	}
+
 	return pluginSpec.IsValid()
 }
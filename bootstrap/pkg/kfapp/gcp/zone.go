@@ -0,0 +1,162 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/deploymentmanager/v2"
+	"os"
+	"path"
+	"strings"
+)
+
+// zoneExhaustedErrors are the errors GCE and GKE report when a zone doesn't have the capacity
+// for the nodes of the cluster; common for GPUs.
+var zoneExhaustedErrors = []string{
+	"ZONE_RESOURCE_POOL_EXHAUSTED",
+	"GCE_STOCKOUT",
+	"does not have enough resources available to fulfill the request",
+}
+
+// IsZoneExhausted returns true if err reports the zone of the cluster is out of capacity.
+func IsZoneExhausted(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range zoneExhaustedErrors {
+		if strings.Contains(err.Error(), e) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterZone returns the zone of the GKE cluster of a deployment; the fallback zone it was
+// provisioned in if the requested zone was out of capacity.
+func ClusterZone(kfDef *kfdefs.KfDef) string {
+	if kfDef.Status.Zone != "" {
+		return kfDef.Status.Zone
+	}
+	return kfDef.Spec.Zone
+}
+
+// validFallbackZones checks the fallback zones can host the cluster of kfDef. They must be in
+// the region of the requested zone since the quota is checked and the other resources of the
+// deployment are created in that region.
+func validFallbackZones(kfDef kfdefs.KfDef, zones []string) (bool, string) {
+	if len(zones) == 0 {
+		return true, ""
+	}
+	if kfDef.Spec.Region != "" {
+		return false, "FallbackZones only apply to zonal clusters; GKE picks the zones of regional clusters"
+	}
+	seen := map[string]bool{kfDef.Spec.Zone: true}
+	for _, z := range zones {
+		if z == "" || seen[z] {
+			return false, fmt.Sprintf("FallbackZones must be unique, non empty and differ from KfDef.Spec.Zone; got %q", z)
+		}
+		seen[z] = true
+		if zoneRegion(z) != zoneRegion(kfDef.Spec.Zone) {
+			return false, fmt.Sprintf("Fallback zone %v must be in region %v of KfDef.Spec.Zone %v", z, zoneRegion(kfDef.Spec.Zone), kfDef.Spec.Zone)
+		}
+	}
+	return true, ""
+}
+
+// nextFallbackZone returns the zone to retry provisioning the cluster in after the zone it is in
+// ran out of capacity; empty if every fallback zone was tried.
+func nextFallbackZone(kfDef *kfdefs.KfDef, zones []string) string {
+	current := ClusterZone(kfDef)
+	if current == kfDef.Spec.Zone {
+		if len(zones) == 0 {
+			return ""
+		}
+		return zones[0]
+	}
+	for i, z := range zones {
+		if z == current && i+1 < len(zones) {
+			return zones[i+1]
+		}
+	}
+	return ""
+}
+
+// updateDMWithZoneFallback updates the Deployment Manager deployments and, if the zone of the
+// cluster is out of capacity, retries provisioning in the fallback zones of the plugin spec in
+// order. The zone the cluster was provisioned in is recorded in KfDef.Status.Zone.
+//
+// Only deployments whose cluster and storage are created by this apply fall back; moving them
+// means deleting their Deployment Manager deployments which would delete an existing cluster or disks.
+func (gcp *Gcp) updateDMWithZoneFallback(resources kftypesv3.ResourceEnum, p *GcpPluginSpec) error {
+	ctx := context.Background()
+	fallback := false
+	if len(p.FallbackZones) > 0 {
+		if isValid, msg := validFallbackZones(*gcp.kfDef, p.FallbackZones); !isValid {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: msg,
+			}
+		}
+		fallback = true
+		for _, d := range gcp.zonalDeployments() {
+			exists, err := gcp.deploymentExists(ctx, d)
+			if err != nil {
+				return err
+			}
+			if exists {
+				log.Infof("Deployment %v already exists; not falling back to another zone if %v is out of capacity", d, ClusterZone(gcp.kfDef))
+				fallback = false
+			}
+		}
+	}
+
+	for {
+		err := gcp.updateDM(resources)
+		if err == nil || !fallback || !IsZoneExhausted(err) {
+			return err
+		}
+		zone := ClusterZone(gcp.kfDef)
+		next := nextFallbackZone(gcp.kfDef, p.FallbackZones)
+		if next == "" {
+			return kfapis.NewKfErrorWithMessage(err, fmt.Sprintf("zone %v and the fallback zones %v are out of capacity",
+				gcp.kfDef.Spec.Zone, strings.Join(p.FallbackZones, ", ")))
+		}
+		log.Warnf("Zone %v is out of capacity for cluster %v; retrying in zone %v", zone, gcp.kfDef.Name, next)
+
+		// The deployments failed before the cluster was provisioned; delete them so they are
+		// recreated in the fallback zone.
+		deploymentmanagerService, dmErr := deploymentmanager.New(gcp.client)
+		if dmErr != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("Error creating deploymentmanagerService: %v", dmErr),
+			}
+		}
+		for _, d := range gcp.zonalDeployments() {
+			if err := deleteDeployment(deploymentmanagerService, ctx, gcp.kfDef.Spec.Project, d); err != nil {
+				return kfapis.NewKfErrorWithMessage(err, fmt.Sprintf("could not delete deployment %v to retry in zone %v", d, next))
+			}
+		}
+
+		gcp.kfDef.Status.Zone = next
+		if err := gcp.generateDMConfigs(); err != nil {
+			return err
+		}
+		if err := gcp.checkQuota(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// zonalDeployments returns the Deployment Manager deployments whose resources are created in the
+// zone of the cluster; the cluster and the persistent disks of pipelines.
+func (gcp *Gcp) zonalDeployments() []string {
+	deployments := []string{gcp.kfDef.Name}
+	if _, err := os.Stat(path.Join(gcp.kfDef.Spec.AppDir, GCP_CONFIG, STORAGE_FILE)); err == nil {
+		deployments = append(deployments, gcp.kfDef.Name+"-storage")
+	}
+	return deployments
+}
@@ -0,0 +1,82 @@
+package gcp
+
+import (
+	"errors"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"testing"
+)
+
+func TestIsZoneExhausted(t *testing.T) {
+	type testCase struct {
+		err      error
+		expected bool
+	}
+
+	cases := []testCase{
+		{err: nil},
+		{err: errors.New("QUOTA_EXCEEDED at kf-app: Quota 'CPUS' exceeded")},
+		{
+			err:      &kfapis.KfError{Message: "Creating kf-app error(400): BAD REQUEST; RESOURCE_ERROR at kf-app/gpu-pool: ZONE_RESOURCE_POOL_EXHAUSTED"},
+			expected: true,
+		},
+		{
+			err:      errors.New("The zone 'us-east1-d' does not have enough resources available to fulfill the request"),
+			expected: true,
+		},
+	}
+	for _, c := range cases {
+		if actual := IsZoneExhausted(c.err); actual != c.expected {
+			t.Errorf("IsZoneExhausted(%v): got %v; want %v", c.err, actual, c.expected)
+		}
+	}
+}
+
+func TestNextFallbackZone(t *testing.T) {
+	d := &kfdefs.KfDef{Spec: kfdefs.KfDefSpec{Zone: "us-east1-d"}}
+	zones := []string{"us-east1-b", "us-east1-c"}
+
+	expected := []string{"us-east1-b", "us-east1-c", ""}
+	for _, e := range expected {
+		next := nextFallbackZone(d, zones)
+		if next != e {
+			t.Fatalf("nextFallbackZone from %v: got %q; want %q", ClusterZone(d), next, e)
+		}
+		if next != "" {
+			d.Status.Zone = next
+		}
+	}
+	if actual := ClusterLocation(d); actual != "us-east1-c" {
+		t.Errorf("ClusterLocation after falling back: got %v; want us-east1-c", actual)
+	}
+
+	d.Status.Zone = ""
+	if next := nextFallbackZone(d, nil); next != "" {
+		t.Errorf("nextFallbackZone without fallback zones: got %q; want none", next)
+	}
+}
+
+func TestValidFallbackZones(t *testing.T) {
+	type testCase struct {
+		region string
+		zones  []string
+		valid  bool
+	}
+
+	cases := []testCase{
+		{valid: true},
+		{zones: []string{"us-east1-b", "us-east1-c"}, valid: true},
+		{zones: []string{"us-east1-d"}},
+		{zones: []string{"us-east1-b", "us-east1-b"}},
+		{zones: []string{""}},
+		{zones: []string{"europe-west4-a"}},
+		{region: "us-east1", zones: []string{"us-east1-b"}},
+	}
+
+	for _, c := range cases {
+		d := kfdefs.KfDef{Spec: kfdefs.KfDefSpec{Zone: "us-east1-d", Region: c.region}}
+		if isValid, msg := validFallbackZones(d, c.zones); isValid != c.valid {
+			t.Errorf("validFallbackZones(%v, %v): got %v (%v); want %v", c.region, c.zones, isValid, msg, c.valid)
+		}
+	}
+}
@@ -0,0 +1,567 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"time"
+)
+
+const (
+	// restoreSource is the source in the inventory of the K8s objects restored from a backup.
+	restoreSource = "restore"
+
+	volumeSnapshotGroup      = "snapshot.storage.k8s.io"
+	volumeSnapshotAPIVersion = volumeSnapshotGroup + "/v1beta1"
+	// volumeSnapshotTimeout bounds how long to wait for a VolumeSnapshot to be ready to use.
+	volumeSnapshotTimeout = 10 * time.Minute
+)
+
+// layoutNamespaces are the namespaces of the manifests the deployment can relocate; the namespace
+// of the deployment first.
+var layoutNamespaces = []string{
+	kfdefsv3.ManifestsNamespace,
+	kfdefsv3.ManifestsIstioNamespace,
+	kfdefsv3.ManifestsKnativeNamespace,
+}
+
+// excludedBackupKinds are the kinds of the inventory which aren't backed up. Restoring a Job
+// would run it again; the new deployment ran its jobs when it was applied.
+var excludedBackupKinds = map[string]bool{
+	"Job": true,
+}
+
+// ResourceBackup snapshots the K8s objects of the deployment and restores them into a deployment.
+type ResourceBackup interface {
+	// BackupResources snapshots the K8s objects in the inventory of the deployment and optionally
+	// the data of its persistent volume claims.
+	BackupResources(opts BackupOptions) (*ResourceSnapshot, error)
+	// RestoreResources recreates the objects of a snapshot in the cluster of the deployment.
+	RestoreResources(s *ResourceSnapshot) (*RestoreReport, error)
+}
+
+// BackupOptions configures a backup.
+type BackupOptions struct {
+	// SnapshotVolumes takes a VolumeSnapshot of every persistent volume claim of the deployment.
+	// The cluster must support CSI snapshots.
+	SnapshotVolumes bool `json:"snapshotVolumes,omitempty"`
+	// VolumeSnapshotClass is the class of the VolumeSnapshots; the default class if empty.
+	VolumeSnapshotClass string `json:"volumeSnapshotClass,omitempty"`
+}
+
+// ResourceSnapshot is a backup of the K8s objects of a deployment. It includes the data of the
+// secrets of the deployment so it must be stored as securely as the cluster credentials.
+type ResourceSnapshot struct {
+	Deployment   string      `json:"deployment"`
+	Project      string      `json:"project,omitempty"`
+	CreationTime metav1.Time `json:"creationTime"`
+	// Namespaces maps the namespaces of the manifests e.g. kubeflow to the namespaces the
+	// deployment used for them.
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+	// Objects are the objects in the order they were created without the fields set by the cluster.
+	Objects []map[string]interface{} `json:"objects"`
+	Volumes []VolumeBackup           `json:"volumes,omitempty"`
+	// Missing are the objects of the inventory which no longer exist e.g. Deployment kubeflow/centraldashboard.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// VolumeBackup is a VolumeSnapshot of a persistent volume claim. The content of the snapshot is
+// retained when the VolumeSnapshot is deleted so it outlives the deployment.
+type VolumeBackup struct {
+	Namespace string `json:"namespace"`
+	Claim     string `json:"claim"`
+	// Snapshot is the name of the VolumeSnapshot.
+	Snapshot string `json:"snapshot"`
+	// Driver and SnapshotHandle identify the snapshot in the storage system.
+	Driver         string `json:"driver"`
+	SnapshotHandle string `json:"snapshotHandle"`
+	RestoreSize    string `json:"restoreSize,omitempty"`
+}
+
+// RestoreReport is the outcome of restoring a snapshot; objects are named e.g. Deployment kubeflow/centraldashboard.
+type RestoreReport struct {
+	// Source is the deployment the snapshot was taken of.
+	Source   string   `json:"source"`
+	Created  []string `json:"created,omitempty"`
+	Replaced []string `json:"replaced,omitempty"`
+	// Skipped are the objects which weren't restored and why.
+	Skipped []string `json:"skipped,omitempty"`
+	Failed  []string `json:"failed,omitempty"`
+	// Volumes are the claims created from the VolumeSnapshots of the backup.
+	Volumes []string `json:"volumes,omitempty"`
+}
+
+// backupName returns the name of the object o used in backups e.g. Deployment kubeflow/centraldashboard.
+func backupName(o map[string]interface{}) string {
+	metadata, _ := o["metadata"].(map[string]interface{})
+	if ns, _ := metadata["namespace"].(string); ns != "" {
+		return fmt.Sprintf("%v %v/%v", o["kind"], ns, metadata["name"])
+	}
+	return fmt.Sprintf("%v %v", o["kind"], metadata["name"])
+}
+
+// manifestNamespaces maps the namespaces of the manifests to the namespaces the deployment uses for them.
+func (kustomize *kustomize) manifestNamespaces() map[string]string {
+	namespaces := map[string]string{}
+	for _, ns := range layoutNamespaces {
+		namespaces[ns] = kustomize.kfDef.RelocateNamespace(ns)
+	}
+	return namespaces
+}
+
+// restoreNamespaces returns a function mapping the namespaces of the snapshot s to the namespaces
+// the deployment uses for them. Namespaces which aren't part of the layout e.g. the namespaces of
+// profiles are kept. A namespace used for several namespaces of the manifests e.g. when istio
+// runs in the namespace of the deployment maps to the namespace of the deployment.
+func (kustomize *kustomize) restoreNamespaces(s *ResourceSnapshot) func(string) string {
+	mapping := map[string]string{}
+	for _, manifestNs := range layoutNamespaces {
+		ns, ok := s.Namespaces[manifestNs]
+		if _, mapped := mapping[ns]; !ok || mapped {
+			continue
+		}
+		mapping[ns] = kustomize.kfDef.RelocateNamespace(manifestNs)
+	}
+	return func(ns string) string {
+		if t, ok := mapping[ns]; ok {
+			return t
+		}
+		return ns
+	}
+}
+
+// backupObject removes the fields set by the cluster from the object o so it can be created again.
+func backupObject(o map[string]interface{}) {
+	delete(o, "status")
+	metadata, _ := o["metadata"].(map[string]interface{})
+	for _, f := range []string{"uid", "resourceVersion", "selfLink", "creationTimestamp", "generation",
+		"deletionTimestamp", "deletionGracePeriodSeconds", "ownerReferences", "managedFields"} {
+		delete(metadata, f)
+	}
+	spec, _ := o["spec"].(map[string]interface{})
+	switch o["kind"] {
+	case "Service":
+		// The cluster IP is allocated when the service is created.
+		if ip, _ := spec["clusterIP"].(string); ip != "None" {
+			delete(spec, "clusterIP")
+		}
+	case "PersistentVolumeClaim":
+		// The claim binds to a new volume.
+		delete(spec, "volumeName")
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		for _, a := range []string{"pv.kubernetes.io/bind-completed", "pv.kubernetes.io/bound-by-controller",
+			"volume.beta.kubernetes.io/storage-provisioner"} {
+			delete(annotations, a)
+		}
+	case "ServiceAccount":
+		// The token secrets are created for the new service account.
+		delete(o, "secrets")
+	}
+}
+
+// BackupResources snapshots the K8s objects in the inventory of the deployment. With
+// SnapshotVolumes the VolumeSnapshots of its claims are taken after the objects are read.
+func (kustomize *kustomize) BackupResources(opts BackupOptions) (*ResourceSnapshot, error) {
+	if err := kustomize.initK8sClients(); err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error: kustomize plugin couldn't initialize a K8s client %v", err),
+		}
+	}
+	mapper, err := newRESTMapper(kustomize.restConfig)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't discover the resources of the cluster: %v", err),
+		}
+	}
+
+	s := &ResourceSnapshot{
+		Deployment:   kustomize.kfDef.Name,
+		Project:      kustomize.kfDef.Spec.Project,
+		CreationTime: metav1.Now(),
+		Namespaces:   kustomize.manifestNamespaces(),
+		Objects:      []map[string]interface{}{},
+	}
+	for _, r := range kustomize.kfDef.Status.Inventory {
+		if r.APIVersion == "" || excludedBackupKinds[r.Kind] {
+			continue
+		}
+		o := map[string]interface{}{
+			"apiVersion": r.APIVersion,
+			"kind":       r.Kind,
+			"metadata": map[string]interface{}{
+				"name":      r.Name,
+				"namespace": r.Namespace,
+			},
+		}
+		live, err := kustomize.getObject(mapper, o)
+		if k8serrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			s.Missing = append(s.Missing, backupName(o))
+			continue
+		}
+		if err != nil {
+			return nil, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't get %v: %v", backupName(o), err),
+			}
+		}
+		backupObject(live)
+		s.Objects = append(s.Objects, live)
+	}
+
+	if !opts.SnapshotVolumes {
+		return s, nil
+	}
+	for _, o := range s.Objects {
+		if o["kind"] != "PersistentVolumeClaim" {
+			continue
+		}
+		v, err := kustomize.snapshotVolume(mapper, o, opts.VolumeSnapshotClass)
+		if err != nil {
+			return nil, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't snapshot the volume of %v: %v", backupName(o), err),
+			}
+		}
+		s.Volumes = append(s.Volumes, *v)
+	}
+	return s, nil
+}
+
+// volumeSnapshotObject returns a VolumeSnapshot of the named claim.
+func volumeSnapshotObject(namespace string, name string, claim string, class string) map[string]interface{} {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": claim,
+		},
+	}
+	if class != "" {
+		spec["volumeSnapshotClassName"] = class
+	}
+	return map[string]interface{}{
+		"apiVersion": volumeSnapshotAPIVersion,
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}
+}
+
+// snapshotVolume takes a VolumeSnapshot of the claim o and waits for it to be ready to use. The
+// content of the snapshot is retained so it isn't deleted with the namespace of the deployment.
+func (kustomize *kustomize) snapshotVolume(mapper meta.RESTMapper, o map[string]interface{}, class string) (*VolumeBackup, error) {
+	metadata := o["metadata"].(map[string]interface{})
+	claim := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	name := fmt.Sprintf("%v-%v", claim, time.Now().Unix())
+
+	snapshot := volumeSnapshotObject(namespace, name, claim, class)
+	if err := kustomize.applyObject(kustomize.restConfig, mapper, snapshot); err != nil {
+		return nil, err
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 2 * time.Second
+	b.MaxInterval = 15 * time.Second
+	b.MaxElapsedTime = volumeSnapshotTimeout
+	var status map[string]interface{}
+	err := backoff.Retry(func() error {
+		live, err := kustomize.getObject(mapper, snapshot)
+		if err != nil {
+			return err
+		}
+		status, _ = live["status"].(map[string]interface{})
+		if snapshotErr, ok := status["error"].(map[string]interface{}); ok {
+			return backoff.Permanent(fmt.Errorf("VolumeSnapshot %v/%v failed: %v", namespace, name, snapshotErr["message"]))
+		}
+		if ready, _ := status["readyToUse"].(bool); !ready {
+			return fmt.Errorf("VolumeSnapshot %v/%v isn't ready to use yet", namespace, name)
+		}
+		return nil
+	}, b)
+	if err != nil {
+		return nil, err
+	}
+
+	contentName, _ := status["boundVolumeSnapshotContentName"].(string)
+	content := map[string]interface{}{
+		"apiVersion": volumeSnapshotAPIVersion,
+		"kind":       "VolumeSnapshotContent",
+		"metadata": map[string]interface{}{
+			"name": contentName,
+		},
+	}
+	live, err := kustomize.getObject(mapper, content)
+	if err != nil {
+		return nil, err
+	}
+	if err := kustomize.patchObject(mapper, content, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"deletionPolicy": "Retain",
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	contentSpec, _ := live["spec"].(map[string]interface{})
+	contentStatus, _ := live["status"].(map[string]interface{})
+	v := &VolumeBackup{
+		Namespace: namespace,
+		Claim:     claim,
+		Snapshot:  name,
+	}
+	v.Driver, _ = contentSpec["driver"].(string)
+	v.SnapshotHandle, _ = contentStatus["snapshotHandle"].(string)
+	v.RestoreSize, _ = status["restoreSize"].(string)
+	if v.SnapshotHandle == "" {
+		return nil, fmt.Errorf("VolumeSnapshotContent %v doesn't report its snapshot handle", contentName)
+	}
+	log.Infof("Snapshotted the volume of claim %v/%v as %v", namespace, claim, v.SnapshotHandle)
+	return v, nil
+}
+
+// patchObject applies the merge patch to the object o.
+func (kustomize *kustomize) patchObject(mapper meta.RESTMapper, o map[string]interface{}, patch map[string]interface{}) error {
+	restClient, mapping, err := restClientFor(kustomize.restConfig, mapper, o)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	metadata := o["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	request := restClient.Patch(k8stypes.MergePatchType).Resource(mapping.Resource.Resource).Name(metadata["name"].(string)).Body(body)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		request = request.Namespace(namespace)
+	}
+	return request.Do().Error()
+}
+
+// RestoreResources recreates the objects of the snapshot s in the cluster of the deployment. The
+// objects are moved to the namespaces of the deployment and owned by it. Objects which already
+// exist and are owned by the deployment are replaced; claims which already exist keep their data.
+// Claims with a VolumeSnapshot in the backup are created from it; the storage snapshot must be
+// readable from the cluster e.g. in the same project. Every object is attempted and the failures
+// are reported.
+func (kustomize *kustomize) RestoreResources(s *ResourceSnapshot) (*RestoreReport, error) {
+	if err := kustomize.initK8sClients(); err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error: kustomize plugin couldn't initialize a K8s client %v", err),
+		}
+	}
+	mapper, err := newRESTMapper(kustomize.restConfig)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't discover the resources of the cluster: %v", err),
+		}
+	}
+	// The inventory is saved so Delete removes the restored objects.
+	defer kustomize.writeInventory()
+
+	volumes := map[string]VolumeBackup{}
+	for _, v := range s.Volumes {
+		volumes[v.Namespace+"/"+v.Claim] = v
+	}
+	relocate := kustomize.restoreNamespaces(s)
+
+	report := &RestoreReport{Source: s.Deployment}
+	for _, backed := range s.Objects {
+		o := runtime.DeepCopyJSON(backed)
+		metadata, _ := o["metadata"].(map[string]interface{})
+		sourceNs, _ := metadata["namespace"].(string)
+		sourceName, _ := metadata["name"].(string)
+		mapNamespaces(o, relocate)
+		kustomize.setOwnershipLabels(o)
+		name := backupName(o)
+
+		v, hasVolume := volumes[sourceNs+"/"+sourceName]
+		if o["kind"] == "PersistentVolumeClaim" && hasVolume {
+			restored, err := kustomize.restoreClaim(mapper, o, v)
+			if err != nil {
+				log.Errorf("couldn't restore %v Error: %v", name, err)
+				report.Failed = append(report.Failed, fmt.Sprintf("%v: %v", name, err))
+				continue
+			}
+			if !restored {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("%v: the claim already exists; its data wasn't restored", name))
+				continue
+			}
+			report.Volumes = append(report.Volumes, name)
+		}
+
+		outcome, err := kustomize.restoreObject(mapper, o)
+		switch {
+		case err != nil:
+			log.Errorf("couldn't restore %v Error: %v", name, err)
+			report.Failed = append(report.Failed, fmt.Sprintf("%v: %v", name, err))
+		case outcome == restoreCreated:
+			kustomize.recordObject(restoreSource, o)
+			report.Created = append(report.Created, name)
+		case outcome == restoreReplaced:
+			report.Replaced = append(report.Replaced, name)
+		default:
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%v: %v", name, outcome))
+		}
+	}
+	return report, nil
+}
+
+// Outcomes of restoring an object other than the reason it was skipped.
+const (
+	restoreCreated  = "created"
+	restoreReplaced = "replaced"
+)
+
+// restoreObject creates the object o or replaces the existing object if it is owned by the
+// deployment. It returns the outcome or why the object was skipped.
+func (kustomize *kustomize) restoreObject(mapper meta.RESTMapper, o map[string]interface{}) (string, error) {
+	restClient, mapping, err := restClientFor(kustomize.restConfig, mapper, o)
+	if err != nil {
+		return "", err
+	}
+	namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	metadata := o["metadata"].(map[string]interface{})
+	name := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+
+	body, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	create := restClient.Post().Resource(mapping.Resource.Resource).Body(body)
+	if namespaced {
+		create = create.Namespace(namespace)
+	}
+	err = create.Do().Error()
+	if err == nil {
+		log.Infof("restored %v", backupName(o))
+		return restoreCreated, nil
+	}
+	if !k8serrors.IsAlreadyExists(err) {
+		return "", err
+	}
+
+	existing, err := kustomize.getObject(mapper, o)
+	if err != nil {
+		return "", err
+	}
+	existingMeta, _ := existing["metadata"].(map[string]interface{})
+	existingLabels, _ := existingMeta["labels"].(map[string]interface{})
+	if owner, _ := existingLabels[DeploymentLabel].(string); owner != toLabelValue(kustomize.kfDef.Name) {
+		return "it already exists and isn't owned by the deployment", nil
+	}
+	if o["kind"] == "PersistentVolumeClaim" {
+		return "the claim already exists; its data wasn't restored", nil
+	}
+
+	metadata["resourceVersion"] = existingMeta["resourceVersion"]
+	if o["kind"] == "Service" {
+		// The cluster IP of a service can't be changed.
+		spec, _ := o["spec"].(map[string]interface{})
+		existingSpec, _ := existing["spec"].(map[string]interface{})
+		if spec != nil && existingSpec != nil {
+			spec["clusterIP"] = existingSpec["clusterIP"]
+		}
+	}
+	body, err = json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	put := restClient.Put().Resource(mapping.Resource.Resource).Name(name).Body(body)
+	if namespaced {
+		put = put.Namespace(namespace)
+	}
+	if err := put.Do().Error(); err != nil {
+		return "", err
+	}
+	log.Infof("replaced %v with its backup", backupName(o))
+	return restoreReplaced, nil
+}
+
+// restoredVolumeObjects returns the VolumeSnapshotContent of the storage snapshot of v and the
+// VolumeSnapshot bound to it in namespace. The content is retained since the storage snapshot
+// is shared with the backup.
+func (kustomize *kustomize) restoredVolumeObjects(namespace string, v VolumeBackup) (map[string]interface{}, map[string]interface{}) {
+	contentName := fmt.Sprintf("%v-%v", kustomize.kfDef.Name, v.Snapshot)
+	content := map[string]interface{}{
+		"apiVersion": volumeSnapshotAPIVersion,
+		"kind":       "VolumeSnapshotContent",
+		"metadata": map[string]interface{}{
+			"name": contentName,
+		},
+		"spec": map[string]interface{}{
+			"deletionPolicy": "Retain",
+			"driver":         v.Driver,
+			"source": map[string]interface{}{
+				"snapshotHandle": v.SnapshotHandle,
+			},
+			"volumeSnapshotRef": map[string]interface{}{
+				"name":      v.Snapshot,
+				"namespace": namespace,
+			},
+		},
+	}
+	snapshot := map[string]interface{}{
+		"apiVersion": volumeSnapshotAPIVersion,
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":      v.Snapshot,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"volumeSnapshotContentName": contentName,
+			},
+		},
+	}
+	return content, snapshot
+}
+
+// restoreClaim provisions the VolumeSnapshot of v in the namespace of the claim o and sets it as
+// the data source of o. It returns false if the claim already exists since its data can't be replaced.
+func (kustomize *kustomize) restoreClaim(mapper meta.RESTMapper, o map[string]interface{}, v VolumeBackup) (bool, error) {
+	_, err := kustomize.getObject(mapper, o)
+	if err == nil {
+		return false, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return false, err
+	}
+
+	metadata := o["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	content, snapshot := kustomize.restoredVolumeObjects(namespace, v)
+	for _, s := range []map[string]interface{}{content, snapshot} {
+		if err := kustomize.applyObject(kustomize.restConfig, mapper, s); err != nil {
+			return false, err
+		}
+		kustomize.recordObject(restoreSource, s)
+	}
+
+	spec, _ := o["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+		o["spec"] = spec
+	}
+	spec["dataSource"] = map[string]interface{}{
+		"apiGroup": volumeSnapshotGroup,
+		"kind":     "VolumeSnapshot",
+		"name":     v.Snapshot,
+	}
+	return true, nil
+}
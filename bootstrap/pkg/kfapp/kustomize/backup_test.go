@@ -0,0 +1,218 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func TestBackupObject(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			input: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: jupyter-web-app-config
+  namespace: kubeflow
+  uid: 1b4e28ba-2fa1-11d2-883f-0016d3cca427
+  resourceVersion: "1234"
+  creationTimestamp: "2019-06-01T00:00:00Z"
+  ownerReferences:
+  - kind: Application
+    name: jupyter-web-app
+data:
+  spawner_ui_config.yaml: "{}"`,
+			expected: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: jupyter-web-app-config
+  namespace: kubeflow
+data:
+  spawner_ui_config.yaml: "{}"`,
+		},
+		{
+			input: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: centraldashboard
+  namespace: kubeflow
+spec:
+  clusterIP: 10.0.0.12
+  ports:
+  - port: 80
+status:
+  loadBalancer: {}`,
+			expected: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: centraldashboard
+  namespace: kubeflow
+spec:
+  ports:
+  - port: 80`,
+		},
+		{
+			input: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: katib-db
+  namespace: kubeflow
+spec:
+  clusterIP: None`,
+			expected: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: katib-db
+  namespace: kubeflow
+spec:
+  clusterIP: None`,
+		},
+		{
+			input: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: minio-pv-claim
+  namespace: kubeflow
+  annotations:
+    pv.kubernetes.io/bind-completed: "yes"
+    volume.beta.kubernetes.io/storage-provisioner: kubernetes.io/gce-pd
+    owner: ml-team
+spec:
+  volumeName: pvc-1234
+  resources:
+    requests:
+      storage: 20Gi`,
+			expected: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: minio-pv-claim
+  namespace: kubeflow
+  annotations:
+    owner: ml-team
+spec:
+  resources:
+    requests:
+      storage: 20Gi`,
+		},
+	}
+
+	for _, c := range cases {
+		input := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(c.input), &input); err != nil {
+			t.Fatalf("Could not parse input; %v", err)
+		}
+		expected := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(c.expected), &expected); err != nil {
+			t.Fatalf("Could not parse expected; %v", err)
+		}
+		backupObject(input)
+		if !reflect.DeepEqual(input, expected) {
+			t.Errorf("backupObject(%v): got %v; want %v", c.input, input, expected)
+		}
+	}
+}
+
+func TestKustomize_restoreNamespaces(t *testing.T) {
+	source := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{Name: "kf-app", Namespace: "kf-app"},
+			Spec: kfdefsv3.KfDefSpec{
+				Namespaces: &kfdefsv3.NamespaceLayout{Istio: "kf-app-istio"},
+			},
+		},
+	}
+	s := &ResourceSnapshot{
+		Deployment: "kf-app",
+		Namespaces: source.manifestNamespaces(),
+	}
+
+	target := &kustomize{
+		kfDef: &kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Name: "kf-restored", Namespace: "kf-restored"}},
+	}
+	relocate := target.restoreNamespaces(s)
+
+	expected := map[string]string{
+		"kf-app":       "kf-restored",
+		"kf-app-istio": "istio-system",
+		// Profile namespaces aren't part of the layout.
+		"alice": "alice",
+	}
+	for ns, want := range expected {
+		if got := relocate(ns); got != want {
+			t.Errorf("relocate(%v): got %v; want %v", ns, got, want)
+		}
+	}
+
+	o := map[string]interface{}{
+		"kind": "RoleBinding",
+		"metadata": map[string]interface{}{
+			"name":      "jupyter-notebook-role-binding",
+			"namespace": "kf-app",
+		},
+		"subjects": []interface{}{
+			map[string]interface{}{"kind": "ServiceAccount", "name": "jupyter-notebook", "namespace": "kf-app"},
+		},
+	}
+	mapNamespaces(o, relocate)
+	if ns := o["metadata"].(map[string]interface{})["namespace"]; ns != "kf-restored" {
+		t.Errorf("RoleBinding namespace: got %v; want kf-restored", ns)
+	}
+	if ns := o["subjects"].([]interface{})[0].(map[string]interface{})["namespace"]; ns != "kf-restored" {
+		t.Errorf("RoleBinding subject namespace: got %v; want kf-restored", ns)
+	}
+}
+
+func TestKustomize_restoredVolumeObjects(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Name: "kf-restored", Namespace: "kf-restored"}},
+	}
+	v := VolumeBackup{
+		Namespace:      "kubeflow",
+		Claim:          "minio-pv-claim",
+		Snapshot:       "minio-pv-claim-1559347200",
+		Driver:         "pd.csi.storage.gke.io",
+		SnapshotHandle: "projects/acme/global/snapshots/snapshot-1234",
+	}
+	content, snapshot := k.restoredVolumeObjects("kf-restored", v)
+
+	contentName := content["metadata"].(map[string]interface{})["name"]
+	if contentName != "kf-restored-minio-pv-claim-1559347200" {
+		t.Errorf("VolumeSnapshotContent name: got %v", contentName)
+	}
+	spec := content["spec"].(map[string]interface{})
+	if spec["deletionPolicy"] != "Retain" || spec["driver"] != v.Driver ||
+		spec["source"].(map[string]interface{})["snapshotHandle"] != v.SnapshotHandle {
+		t.Errorf("VolumeSnapshotContent spec: got %v", spec)
+	}
+	ref := spec["volumeSnapshotRef"].(map[string]interface{})
+	if ref["name"] != v.Snapshot || ref["namespace"] != "kf-restored" {
+		t.Errorf("VolumeSnapshotContent volumeSnapshotRef: got %v", ref)
+	}
+
+	source := snapshot["spec"].(map[string]interface{})["source"].(map[string]interface{})
+	if source["volumeSnapshotContentName"] != contentName {
+		t.Errorf("VolumeSnapshot source: got %v; want content %v", source, contentName)
+	}
+	if ns := snapshot["metadata"].(map[string]interface{})["namespace"]; ns != "kf-restored" {
+		t.Errorf("VolumeSnapshot namespace: got %v; want kf-restored", ns)
+	}
+
+	if s := volumeSnapshotObject("kubeflow", "snap", "minio-pv-claim", ""); s["spec"].(map[string]interface{})["volumeSnapshotClassName"] != nil {
+		t.Errorf("VolumeSnapshot without a class: got spec %v", s["spec"])
+	}
+}
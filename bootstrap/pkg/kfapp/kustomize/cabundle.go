@@ -0,0 +1,126 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"strings"
+)
+
+// caBundleVolume is the name of the volume of the CA bundle in the pods.
+const caBundleVolume = "kubeflow-ca-bundle"
+
+// injectCABundle mounts the CA bundle of the deployment in the containers of the pod templates in
+// the manifests and adds a config map holding it to each namespace with such pods. A config map is
+// added once, to the first manifest with pods in its namespace, so it has a single owner in the
+// inventory. The manifests are unchanged if the deployment doesn't have a CA bundle; nil
+// manifests are skipped.
+//
+// Pods created by the controllers e.g. notebooks in the namespaces of the profiles don't get the
+// bundle.
+func (kustomize *kustomize) injectCABundle(manifests [][]byte) error {
+	if kustomize.kfDef.Spec.CABundle == "" {
+		return nil
+	}
+	added := map[string]bool{}
+	for i, m := range manifests {
+		if m == nil {
+			continue
+		}
+		objects, err := decodeObjects(m)
+		if err != nil {
+			return err
+		}
+		namespaces := []string{}
+		for _, o := range objects {
+			specs := podSpecs(o)
+			if len(specs) == 0 {
+				continue
+			}
+			for _, spec := range specs {
+				mountCABundle(spec)
+			}
+			metadata, _ := o["metadata"].(map[string]interface{})
+			ns, _ := metadata["namespace"].(string)
+			if ns == "" {
+				ns = kustomize.kfDef.Namespace
+			}
+			if !added[ns] {
+				added[ns] = true
+				namespaces = append(namespaces, ns)
+			}
+		}
+		for _, ns := range namespaces {
+			objects = append(objects, kustomize.caBundleConfigMap(ns))
+		}
+
+		encoded := []string{}
+		for _, o := range objects {
+			b, err := yaml.Marshal(o)
+			if err != nil {
+				return err
+			}
+			encoded = append(encoded, string(b))
+		}
+		manifests[i] = []byte(strings.Join(encoded, "---\n"))
+	}
+	return nil
+}
+
+// caBundleConfigMap returns the config map holding the CA bundle in namespace ns.
+func (kustomize *kustomize) caBundleConfigMap(ns string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      kfdefsv3.CABundleConfigMap,
+			"namespace": ns,
+		},
+		"data": map[string]interface{}{
+			kfdefsv3.CABundleKey: kustomize.kfDef.Spec.CABundle,
+		},
+	}
+}
+
+// mountCABundle adds the volume of the CA bundle to the pod spec and mounts it in each container
+// which doesn't already mount something at CABundleMountPath.
+func mountCABundle(spec map[string]interface{}) {
+	volumes, _ := spec["volumes"].([]interface{})
+	found := false
+	for _, v := range volumes {
+		volume, _ := v.(map[string]interface{})
+		found = found || volume["name"] == caBundleVolume
+	}
+	if !found {
+		spec["volumes"] = append(volumes, map[string]interface{}{
+			"name": caBundleVolume,
+			"configMap": map[string]interface{}{
+				"name": kfdefsv3.CABundleConfigMap,
+			},
+		})
+	}
+
+	for _, key := range []string{"initContainers", "containers"} {
+		containers, _ := spec[key].([]interface{})
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			mounts, _ := container["volumeMounts"].([]interface{})
+			mounted := false
+			for _, m := range mounts {
+				mount, _ := m.(map[string]interface{})
+				mounted = mounted || mount["mountPath"] == kfdefsv3.CABundleMountPath
+			}
+			if mounted {
+				continue
+			}
+			container["volumeMounts"] = append(mounts, map[string]interface{}{
+				"name":      caBundleVolume,
+				"mountPath": kfdefsv3.CABundleMountPath,
+				"subPath":   kfdefsv3.CABundleKey,
+				"readOnly":  true,
+			})
+		}
+	}
+}
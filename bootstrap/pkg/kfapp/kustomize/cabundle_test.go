@@ -0,0 +1,138 @@
+package kustomize
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestKustomize_injectCABundle(t *testing.T) {
+	app := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: centraldashboard
+  namespace: kubeflow
+spec:
+  template:
+    spec:
+      containers:
+      - name: centraldashboard
+        image: gcr.io/kubeflow-images-public/centraldashboard
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: centraldashboard
+  namespace: kubeflow
+`
+	other := `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: admission-webhook
+  namespace: kubeflow
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: webhook
+        image: gcr.io/kubeflow-images-public/admission-webhook
+        volumeMounts:
+        - name: certs
+          mountPath: /etc/ssl/certs/kubeflow-ca-bundle.crt
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: istio-pilot
+  namespace: istio-system
+spec:
+  template:
+    spec:
+      containers:
+      - name: discovery
+        image: istio/pilot
+`
+
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kf-app",
+				Namespace: "kubeflow",
+			},
+		},
+	}
+	manifests := [][]byte{[]byte(app), []byte(other)}
+	if err := k.injectCABundle(manifests); err != nil || string(manifests[0]) != app {
+		t.Errorf("injectCABundle without a bundle changed the manifest; %v", err)
+	}
+
+	k.kfDef.Spec.CABundle = "-----BEGIN CERTIFICATE-----\n"
+	manifests = [][]byte{[]byte(app), nil, []byte(other)}
+	if err := k.injectCABundle(manifests); err != nil {
+		t.Fatalf("injectCABundle error; %v", err)
+	}
+	if manifests[1] != nil {
+		t.Errorf("injectCABundle changed a skipped manifest")
+	}
+
+	configMaps := map[string]int{}
+	mounts := map[string]int{}
+	for _, m := range [][]byte{manifests[0], manifests[2]} {
+		objects, err := decodeObjects(m)
+		if err != nil {
+			t.Fatalf("decodeObjects error; %v", err)
+		}
+		for _, o := range objects {
+			metadata := o["metadata"].(map[string]interface{})
+			if o["kind"] == "ConfigMap" {
+				data := o["data"].(map[string]interface{})
+				if data[kfdefsv3.CABundleKey] != k.kfDef.Spec.CABundle {
+					t.Errorf("The config map in %v doesn't hold the bundle", metadata["namespace"])
+				}
+				configMaps[metadata["namespace"].(string)]++
+				continue
+			}
+			for _, spec := range podSpecs(o) {
+				for _, key := range []string{"initContainers", "containers"} {
+					containers, _ := spec[key].([]interface{})
+					for _, c := range containers {
+						container := c.(map[string]interface{})
+						vm, _ := container["volumeMounts"].([]interface{})
+						for _, m := range vm {
+							if m.(map[string]interface{})["mountPath"] == kfdefsv3.CABundleMountPath {
+								mounts[container["name"].(string)]++
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// The config map of kubeflow is only added to the first manifest.
+	if configMaps["kubeflow"] != 1 || configMaps["istio-system"] != 1 || len(configMaps) != 2 {
+		t.Errorf("injectCABundle added the config maps %v; want one in kubeflow and istio-system", configMaps)
+	}
+	// The webhook already mounts something at the path.
+	expected := map[string]int{"centraldashboard": 1, "init": 1, "webhook": 1, "discovery": 1}
+	for name, n := range expected {
+		if mounts[name] != n {
+			t.Errorf("Container %v mounts the bundle %v times; want %v", name, mounts[name], n)
+		}
+	}
+
+	// Injecting again doesn't mount the bundle twice.
+	if err := k.injectCABundle(manifests[:1]); err != nil {
+		t.Fatalf("injectCABundle error; %v", err)
+	}
+	objects, _ := decodeObjects(manifests[0])
+	spec := podSpecs(objects[0])[0]
+	if volumes := spec["volumes"].([]interface{}); len(volumes) != 1 {
+		t.Errorf("Got %v volumes after injecting twice; want 1", len(volumes))
+	}
+}
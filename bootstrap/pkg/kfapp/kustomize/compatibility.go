@@ -0,0 +1,294 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// IncompatibleClusterError is returned when the manifests of a deployment can't be applied
+// to the cluster because the cluster's K8s version doesn't support them.
+type IncompatibleClusterError struct {
+	// ServerVersion is the version of the K8s API server.
+	ServerVersion string
+	// Violations describes each incompatibility.
+	Violations []string
+}
+
+func (e *IncompatibleClusterError) Error() string {
+	return fmt.Sprintf("cluster version %v is incompatible with the deployment: %v",
+		e.ServerVersion, strings.Join(e.Violations, "; "))
+}
+
+// IsIncompatibleCluster returns true if err is an IncompatibleClusterError.
+func IsIncompatibleCluster(err error) bool {
+	_, ok := err.(*IncompatibleClusterError)
+	return ok
+}
+
+// versionRange is a range of minor versions e.g. of K8s or Istio; an empty max means there is no upper bound.
+type versionRange struct {
+	min string
+	max string
+}
+
+// contains returns true if v is within the range; patch versions are ignored.
+func (r versionRange) contains(v *version.Version) bool {
+	minor := version.MustParseGeneric(fmt.Sprintf("%v.%v", v.Major(), v.Minor()))
+	if minor.LessThan(version.MustParseGeneric(r.min)) {
+		return false
+	}
+	return r.max == "" || !version.MustParseGeneric(r.max).LessThan(minor)
+}
+
+func (r versionRange) String() string {
+	if r.max == "" {
+		return r.min + " or later"
+	}
+	return r.min + " to " + r.max
+}
+
+// kubeflowCompatibility is the K8s versions supported by each Kubeflow release.
+// Releases which aren't listed e.g. master aren't checked.
+var kubeflowCompatibility = map[string]versionRange{
+	"0.4": {min: "1.10", max: "1.12"},
+	"0.5": {min: "1.11", max: "1.13"},
+	"0.6": {min: "1.11", max: "1.14"},
+}
+
+// istioCompatibility is the K8s versions supported by each Istio release.
+var istioCompatibility = map[string]versionRange{
+	"1.0": {min: "1.9", max: "1.13"},
+	"1.1": {min: "1.11", max: "1.14"},
+	"1.2": {min: "1.12", max: "1.14"},
+}
+
+// webhookFieldVersions is the K8s version each optional field of an admission webhook was added in;
+// the API server drops fields it doesn't know about so the webhook would silently behave differently.
+var webhookFieldVersions = []struct {
+	field string
+	added string
+}{
+	{field: "sideEffects", added: "1.12"},
+	{field: "timeoutSeconds", added: "1.14"},
+	{field: "objectSelector", added: "1.15"},
+	{field: "reinvocationPolicy", added: "1.15"},
+}
+
+// istioImage matches the images of the Istio control plane e.g. docker.io/istio/pilot:1.1.6.
+var istioImage = regexp.MustCompile(`istio(-release)?/(pilot|proxyv2|proxy_init|mixer|citadel|galley|sidecar_injector)[^:]*:(release-)?([0-9][^@]*)`)
+
+// clusterInfo is the information about the cluster used to check compatibility.
+type clusterInfo struct {
+	version *version.Version
+	// served is the set of group versions served by the API server e.g. apps/v1.
+	served map[string]bool
+}
+
+// getClusterInfo queries the API server for its version and the APIs it serves.
+func getClusterInfo(config *rest.Config) (*clusterInfo, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	info, err := client.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	served := map[string]bool{}
+	for _, g := range groups.Groups {
+		for _, gv := range g.Versions {
+			served[gv.GroupVersion] = true
+		}
+	}
+	return &clusterInfo{
+		version: v,
+		served:  served,
+	}, nil
+}
+
+// decodeObjects splits the YAML encoded manifests into objects skipping those without an apiVersion.
+func decodeObjects(data []byte) ([]map[string]interface{}, error) {
+	splitter := regexp.MustCompile(kftypesv3.YamlSeparator)
+	objects := []map[string]interface{}{}
+	for _, object := range splitter.Split(string(data), -1) {
+		var o map[string]interface{}
+		if err := yaml.Unmarshal([]byte(object), &o); err != nil {
+			return nil, err
+		}
+		if _, ok := o["apiVersion"].(string); !ok {
+			continue
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+// crdGroupVersions returns the group versions defined by the CustomResourceDefinitions in objects.
+func crdGroupVersions(objects []map[string]interface{}) map[string]bool {
+	defined := map[string]bool{}
+	for _, o := range objects {
+		if o["kind"] != "CustomResourceDefinition" {
+			continue
+		}
+		spec, _ := o["spec"].(map[string]interface{})
+		group, _ := spec["group"].(string)
+		if v, ok := spec["version"].(string); ok {
+			defined[group+"/"+v] = true
+		}
+		versions, _ := spec["versions"].([]interface{})
+		for _, v := range versions {
+			m, _ := v.(map[string]interface{})
+			if name, ok := m["name"].(string); ok {
+				defined[group+"/"+name] = true
+			}
+		}
+	}
+	return defined
+}
+
+// objectName returns kind/name of o for use in messages.
+func objectName(o map[string]interface{}) string {
+	metadata, _ := o["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%v/%v", o["kind"], metadata["name"])
+}
+
+// findImages returns the container images referenced anywhere in o.
+func findImages(o interface{}, images map[string]bool) {
+	switch v := o.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if image, ok := value.(string); ok && key == "image" {
+				images[image] = true
+				continue
+			}
+			findImages(value, images)
+		}
+	case []interface{}:
+		for _, value := range v {
+			findImages(value, images)
+		}
+	}
+}
+
+// checkCompatibility returns the reasons the objects of a deployment of Kubeflow kfVersion
+// can't be applied to cluster; it returns nil if they are compatible.
+func checkCompatibility(kfVersion string, cluster *clusterInfo, objects []map[string]interface{}) []string {
+	violations := []string{}
+	minor := fmt.Sprintf("%v.%v", cluster.version.Major(), cluster.version.Minor())
+
+	if v, err := version.ParseGeneric(kfVersion); err == nil {
+		release := fmt.Sprintf("%v.%v", v.Major(), v.Minor())
+		if r, ok := kubeflowCompatibility[release]; ok && !r.contains(cluster.version) {
+			violations = append(violations, fmt.Sprintf("Kubeflow %v requires K8s %v; cluster is %v", release, r, minor))
+		}
+	} else {
+		log.Infof("Not checking the K8s version supported by Kubeflow version %v", kfVersion)
+	}
+
+	defined := crdGroupVersions(objects)
+	missing := map[string][]string{}
+	images := map[string]bool{}
+	for _, o := range objects {
+		apiVersion := o["apiVersion"].(string)
+		if !cluster.served[apiVersion] && !defined[apiVersion] {
+			missing[apiVersion] = append(missing[apiVersion], objectName(o))
+		}
+
+		kind, _ := o["kind"].(string)
+		if kind == "MutatingWebhookConfiguration" || kind == "ValidatingWebhookConfiguration" {
+			webhooks, _ := o["webhooks"].([]interface{})
+			for _, w := range webhooks {
+				webhook, _ := w.(map[string]interface{})
+				for _, f := range webhookFieldVersions {
+					if _, ok := webhook[f.field]; ok && !(versionRange{min: f.added}).contains(cluster.version) {
+						violations = append(violations, fmt.Sprintf("%v webhook %v sets %v which requires K8s %v or later",
+							objectName(o), webhook["name"], f.field, f.added))
+					}
+				}
+			}
+		}
+
+		findImages(o, images)
+	}
+
+	apiVersions := []string{}
+	for apiVersion := range missing {
+		apiVersions = append(apiVersions, apiVersion)
+	}
+	sort.Strings(apiVersions)
+	for _, apiVersion := range apiVersions {
+		violations = append(violations, fmt.Sprintf("API %v isn't served by the cluster; required by %v",
+			apiVersion, strings.Join(missing[apiVersion], ", ")))
+	}
+
+	istioReleases := map[string]bool{}
+	for image := range images {
+		m := istioImage.FindStringSubmatch(image)
+		if m == nil {
+			continue
+		}
+		v, err := version.ParseGeneric(m[4])
+		if err != nil {
+			continue
+		}
+		istioReleases[fmt.Sprintf("%v.%v", v.Major(), v.Minor())] = true
+	}
+	releases := []string{}
+	for release := range istioReleases {
+		releases = append(releases, release)
+	}
+	sort.Strings(releases)
+	for _, release := range releases {
+		if r, ok := istioCompatibility[release]; ok && !r.contains(cluster.version) {
+			violations = append(violations, fmt.Sprintf("Istio %v requires K8s %v; cluster is %v", release, r, minor))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return violations
+}
+
+// checkCluster returns an IncompatibleClusterError if the manifests can't be applied to the cluster.
+func (kustomize *kustomize) checkCluster(manifests [][]byte) error {
+	cluster, err := getClusterInfo(kustomize.restConfig)
+	if err != nil {
+		return err
+	}
+
+	objects := []map[string]interface{}{}
+	for _, data := range manifests {
+		o, err := decodeObjects(data)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, o...)
+	}
+
+	violations := checkCompatibility(kustomize.kfDef.Spec.Version, cluster, objects)
+	if violations != nil {
+		return &IncompatibleClusterError{
+			ServerVersion: cluster.version.String(),
+			Violations:    violations,
+		}
+	}
+	log.Infof("Cluster version %v is compatible with the deployment", cluster.version)
+	return nil
+}
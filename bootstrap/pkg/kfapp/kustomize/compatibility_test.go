@@ -0,0 +1,143 @@
+package kustomize
+
+import (
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	"k8s.io/apimachinery/pkg/util/version"
+	"reflect"
+	"testing"
+)
+
+const compatibilityManifests = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: profiles.kubeflow.org
+spec:
+  group: kubeflow.org
+  version: v1alpha1
+---
+apiVersion: kubeflow.org/v1alpha1
+kind: Profile
+metadata:
+  name: anonymous
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: istio-pilot
+spec:
+  template:
+    spec:
+      containers:
+      - name: discovery
+        image: docker.io/istio/pilot:1.1.6
+      - name: istio-proxy
+        image: docker.io/istio/proxyv2:1.1.6
+---
+apiVersion: admissionregistration.k8s.io/v1beta1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: admission-webhook
+webhooks:
+- name: admission-webhook.kubeflow.org
+  sideEffects: None
+  timeoutSeconds: 5
+---
+apiVersion: app.k8s.io/v1beta1
+kind: Application
+metadata:
+  name: kubeflow
+`
+
+func TestCheckCompatibility(t *testing.T) {
+	objects, err := decodeObjects([]byte(compatibilityManifests))
+	if err != nil {
+		t.Fatalf("decodeObjects error; %v", err)
+	}
+	if len(objects) != 5 {
+		t.Fatalf("Got %v objects; want 5", len(objects))
+	}
+
+	served := map[string]bool{
+		"v1":                                   true,
+		"apps/v1":                              true,
+		"apiextensions.k8s.io/v1beta1":         true,
+		"admissionregistration.k8s.io/v1beta1": true,
+		"app.k8s.io/v1beta1":                   true,
+	}
+
+	type testCase struct {
+		name      string
+		kfVersion string
+		cluster   *clusterInfo
+		expected  []string
+	}
+
+	cases := []testCase{
+		{
+			name:      "compatible",
+			kfVersion: "v0.6.0",
+			cluster: &clusterInfo{
+				version: version.MustParseGeneric("v1.14.3-gke.11"),
+				served:  served,
+			},
+			expected: nil,
+		},
+		{
+			name:      "master",
+			kfVersion: "master",
+			cluster: &clusterInfo{
+				version: version.MustParseGeneric("v1.14.3-gke.11"),
+				served:  served,
+			},
+			expected: nil,
+		},
+		{
+			name:      "too-old",
+			kfVersion: "v0.6.0",
+			cluster: &clusterInfo{
+				version: version.MustParseGeneric("v1.10.11"),
+				served: map[string]bool{
+					"v1":                           true,
+					"apps/v1":                      true,
+					"apiextensions.k8s.io/v1beta1": true,
+				},
+			},
+			expected: []string{
+				"Kubeflow 0.6 requires K8s 1.11 to 1.14; cluster is 1.10",
+				"MutatingWebhookConfiguration/admission-webhook webhook admission-webhook.kubeflow.org sets sideEffects which requires K8s 1.12 or later",
+				"MutatingWebhookConfiguration/admission-webhook webhook admission-webhook.kubeflow.org sets timeoutSeconds which requires K8s 1.14 or later",
+				"API admissionregistration.k8s.io/v1beta1 isn't served by the cluster; required by MutatingWebhookConfiguration/admission-webhook",
+				"API app.k8s.io/v1beta1 isn't served by the cluster; required by Application/kubeflow",
+				"Istio 1.1 requires K8s 1.11 to 1.14; cluster is 1.10",
+			},
+		},
+		{
+			name:      "too-new",
+			kfVersion: "v0.5.1",
+			cluster: &clusterInfo{
+				version: version.MustParseGeneric("v1.15.0"),
+				served:  served,
+			},
+			expected: []string{
+				"Kubeflow 0.5 requires K8s 1.11 to 1.13; cluster is 1.15",
+				"Istio 1.1 requires K8s 1.11 to 1.14; cluster is 1.15",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		actual := checkCompatibility(c.kfVersion, c.cluster, objects)
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Case %v: got:\n%v\nwant:\n%v", c.name, utils.PrettyPrint(actual), utils.PrettyPrint(c.expected))
+		}
+	}
+}
+
+func TestIsIncompatibleCluster(t *testing.T) {
+	if !IsIncompatibleCluster(&IncompatibleClusterError{ServerVersion: "1.10.11"}) {
+		t.Errorf("IsIncompatibleCluster(IncompatibleClusterError) = false; want true")
+	}
+	if IsIncompatibleCluster(&ResourceConflictError{}) {
+		t.Errorf("IsIncompatibleCluster(ResourceConflictError) = true; want false")
+	}
+}
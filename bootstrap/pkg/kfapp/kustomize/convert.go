@@ -0,0 +1,171 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"path"
+	"sort"
+)
+
+// ConversionIssue is an option of a ksonnet KfDef which couldn't be converted.
+type ConversionIssue struct {
+	// Field is the path of the option in the ksonnet KfDef.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ksonnetComponents maps the ksonnet components to the paths of the applications implementing
+// them in the manifests repo, in the order they are applied. The applications are named after
+// the last element of their path.
+var ksonnetComponents = map[string][]string{
+	"admission-webhook":  {"admission-webhook/bootstrap", "admission-webhook/webhook"},
+	"ambassador":         {"common/ambassador"},
+	"application":        {"application/application-crds", "application/application"},
+	"argo":               {"argo"},
+	"basic-auth":         {"common/basic-auth"},
+	"basic-auth-ingress": {"gcp/basic-auth-ingress"},
+	"centraldashboard":   {"common/centraldashboard"},
+	"cloud-endpoints":    {"gcp/cloud-endpoints"},
+	"gpu-driver":         {"gcp/gpu-driver"},
+	"iap-ingress":        {"gcp/iap-ingress"},
+	"istio":              {"istio/istio"},
+	"istio-crds":         {"istio/istio-crds"},
+	"istio-install":      {"istio/istio-install"},
+	"jupyter-web-app":    {"jupyter/jupyter-web-app"},
+	"katib": {"katib-v1alpha2/katib-db", "katib-v1alpha2/katib-manager", "katib-v1alpha2/katib-controller",
+		"katib-v1alpha2/katib-ui", "katib-v1alpha2/metrics-collector", "katib-v1alpha2/suggestion"},
+	"metacontroller":      {"metacontroller"},
+	"metadata":            {"metadata"},
+	"notebook-controller": {"jupyter/notebook-controller"},
+	"pipeline": {"pipeline/api-service", "pipeline/minio", "pipeline/mysql", "pipeline/persistent-agent",
+		"pipeline/pipelines-runner", "pipeline/pipelines-ui", "pipeline/pipelines-viewer",
+		"pipeline/scheduledworkflow"},
+	"profiles":             {"profiles"},
+	"pytorch-operator":     {"pytorch-job/pytorch-job-crds", "pytorch-job/pytorch-operator"},
+	"seldon-core-operator": {"seldon/seldon-core-operator"},
+	"spartakus":            {"common/spartakus"},
+	"tensorboard":          {"tensorboard"},
+	"tf-job-operator":      {"tf-training/tf-job-operator"},
+}
+
+// manifestsRepo is the repo the converted applications are taken from.
+var manifestsRepo = kfdefsv3.Repo{
+	Name: kftypesv3.ManifestsRepoName,
+	Uri:  "https://github.com/kubeflow/manifests/archive/master.tar.gz",
+	Root: "manifests-master",
+}
+
+// ConvertKsonnetKfDef converts a KfDef using the ksonnet package manager i.e. the app.yaml of the
+// ksonnet based kfctl to an equivalent KfDef using kustomize. Each component is replaced by the
+// applications implementing it in the manifests repo; its overlay parameters become overlays and
+// its other parameters become kustomize parameters. The options which can't be converted are
+// dropped and reported. d isn't changed.
+func ConvertKsonnetKfDef(d *kfdefsv3.KfDef) (*kfdefsv3.KfDef, []ConversionIssue) {
+	converted := d.DeepCopy()
+	issues := []ConversionIssue{}
+	spec := &converted.Spec
+
+	existing := map[string]bool{}
+	for _, a := range spec.Applications {
+		existing[a.Name] = true
+	}
+	for _, c := range spec.Components {
+		paths, ok := ksonnetComponents[c]
+		if !ok {
+			issues = append(issues, ConversionIssue{
+				Field:   fmt.Sprintf("spec.components[%v]", c),
+				Message: fmt.Sprintf("component %v has no kustomize equivalent; it was dropped", c),
+			})
+			continue
+		}
+		overlays, params := []string{}, []config.NameValue{}
+		for _, p := range spec.ComponentParams[c] {
+			if p.Name == OverlayParamName {
+				overlays = append(overlays, p.Value)
+			} else {
+				params = append(params, p)
+			}
+		}
+		if len(paths) > 1 && len(params) > 0 {
+			issues = append(issues, ConversionIssue{
+				Field: fmt.Sprintf("spec.componentParams[%v]", c),
+				Message: fmt.Sprintf("component %v is implemented by %v applications so its parameters were dropped; "+
+					"set them on the applications which use them", c, len(paths)),
+			})
+			params = []config.NameValue{}
+		}
+		for _, p := range paths {
+			name := path.Base(p)
+			if existing[name] {
+				continue
+			}
+			existing[name] = true
+			spec.Applications = append(spec.Applications, kfdefsv3.Application{
+				Name: name,
+				KustomizeConfig: &kfdefsv3.KustomizeConfig{
+					RepoRef:    &kfdefsv3.RepoRef{Name: kftypesv3.ManifestsRepoName, Path: p},
+					Overlays:   append([]string{}, overlays...),
+					Parameters: append([]config.NameValue{}, params...),
+				},
+			})
+		}
+	}
+
+	unused := []string{}
+	for c := range spec.ComponentParams {
+		if !containsString(spec.Components, c) {
+			unused = append(unused, c)
+		}
+	}
+	sort.Strings(unused)
+	for _, c := range unused {
+		issues = append(issues, ConversionIssue{
+			Field:   fmt.Sprintf("spec.componentParams[%v]", c),
+			Message: fmt.Sprintf("%v isn't a component so its parameters were dropped", c),
+		})
+	}
+	if len(spec.Packages) > 0 {
+		issues = append(issues, ConversionIssue{
+			Field:   "spec.packages",
+			Message: "ksonnet packages have no kustomize equivalent; the applications of the components replace them",
+		})
+	}
+	if spec.Repo != "" {
+		issues = append(issues, ConversionIssue{
+			Field:   "spec.repo",
+			Message: fmt.Sprintf("the ksonnet registry %v was replaced by the manifests repo %v", spec.Repo, manifestsRepo.Uri),
+		})
+	}
+	hasManifests := false
+	for _, r := range spec.Repos {
+		hasManifests = hasManifests || r.Name == kftypesv3.ManifestsRepoName
+	}
+	if !hasManifests {
+		spec.Repos = append(spec.Repos, manifestsRepo)
+		if spec.Version != "" {
+			issues = append(issues, ConversionIssue{
+				Field: "spec.version",
+				Message: fmt.Sprintf("the applications of version %v are taken from the manifests master branch; "+
+					"pin spec.repos[%v] to a release", spec.Version, kftypesv3.ManifestsRepoName),
+			})
+		}
+	}
+	spec.PackageManager = kftypesv3.KUSTOMIZE
+	spec.Components = nil
+	spec.ComponentParams = nil
+	spec.Packages = nil
+	spec.Repo = ""
+	return converted, issues
+}
+
+// containsString returns true if v is one of values.
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
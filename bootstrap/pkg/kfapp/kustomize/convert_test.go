@@ -0,0 +1,90 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"reflect"
+	"testing"
+)
+
+const ksonnetAppYaml = `
+apiVersion: kfdef.apps.kubeflow.org/v1alpha1
+kind: KfDef
+metadata:
+  name: kf-app
+  namespace: kubeflow
+spec:
+  appdir: /apps/kf-app
+  version: v0.5.0
+  platform: gcp
+  project: acme
+  repo: /apps/kf-app/.cache/kubeflow/kubeflow
+  packages:
+  - argo
+  - common
+  components:
+  - ambassador
+  - pipeline
+  - openvino
+  componentParams:
+    ambassador:
+    - name: ambassadorServiceType
+      value: NodePort
+    - name: overlay
+      value: istio
+    pipeline:
+    - name: mysqlPd
+      value: kf-app-storage-metadata-store
+    spartakus:
+    - name: usageId
+      value: "1234"
+`
+
+func TestConvertKsonnetKfDef(t *testing.T) {
+	d := &kfdefsv3.KfDef{}
+	if err := yaml.Unmarshal([]byte(ksonnetAppYaml), d); err != nil {
+		t.Fatalf("Could not unmarshal the app.yaml; %v", err)
+	}
+	converted, issues := ConvertKsonnetKfDef(d)
+
+	if len(d.Spec.Components) != 3 {
+		t.Errorf("ConvertKsonnetKfDef changed the KfDef")
+	}
+	if converted.Spec.PackageManager != "kustomize" || converted.Spec.Components != nil ||
+		converted.Spec.ComponentParams != nil || converted.Spec.Packages != nil || converted.Spec.Repo != "" {
+		t.Errorf("ConvertKsonnetKfDef kept ksonnet options; got %+v", converted.Spec)
+	}
+	if len(converted.Spec.Repos) != 1 || converted.Spec.Repos[0].Name != "manifests" {
+		t.Errorf("ConvertKsonnetKfDef repos: got %+v", converted.Spec.Repos)
+	}
+
+	apps := converted.Spec.Applications
+	if len(apps) != 9 {
+		t.Fatalf("ConvertKsonnetKfDef: got %v applications; want 9", len(apps))
+	}
+	ambassador := apps[0]
+	if ambassador.Name != "ambassador" || ambassador.KustomizeConfig.RepoRef.Path != "common/ambassador" ||
+		!reflect.DeepEqual(ambassador.KustomizeConfig.Overlays, []string{"istio"}) ||
+		len(ambassador.KustomizeConfig.Parameters) != 1 || ambassador.KustomizeConfig.Parameters[0].Name != "ambassadorServiceType" {
+		t.Errorf("ConvertKsonnetKfDef ambassador: got %+v", ambassador.KustomizeConfig)
+	}
+	if apps[1].Name != "api-service" || len(apps[1].KustomizeConfig.Parameters) != 0 {
+		t.Errorf("ConvertKsonnetKfDef pipeline: got %v with %+v", apps[1].Name, apps[1].KustomizeConfig)
+	}
+
+	fields := []string{}
+	for _, i := range issues {
+		fields = append(fields, i.Field)
+	}
+	expected := []string{
+		"spec.componentParams[pipeline]",
+		"spec.components[openvino]",
+		"spec.componentParams[spartakus]",
+		"spec.packages",
+		"spec.repo",
+		"spec.version",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("ConvertKsonnetKfDef issues: got %v; want %v", fields, expected)
+	}
+}
@@ -0,0 +1,130 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// featureApplication is an application implementing part of a feature. The overlays are added
+// to the application; if path is set the application is added from the manifests repo when the
+// KfDef doesn't have it, otherwise the application is skipped.
+type featureApplication struct {
+	name     string
+	path     string
+	overlays []string
+}
+
+// features maps the features which can be enabled in KfDef.Spec.Features to the applications
+// implementing them.
+var features = map[string][]featureApplication{
+	// multi-user isolates the notebooks of each profile and authorizes users with istio.
+	"multi-user": {
+		{name: "centraldashboard", overlays: []string{"istio"}},
+		{name: "jupyter-web-app", overlays: []string{"istio"}},
+		{name: "notebook-controller", overlays: []string{"istio"}},
+		{name: "profiles", overlays: []string{"istio"}},
+	},
+	// kfserving-beta installs KFServing to serve models.
+	"kfserving-beta": {
+		{name: "kfserving-crds", path: "kfserving/kfserving-crds", overlays: []string{"application"}},
+		{name: "kfserving-install", path: "kfserving/kfserving-install", overlays: []string{"application"}},
+	},
+}
+
+// KnownFeatures returns the names of the features which can be enabled.
+func KnownFeatures() []string {
+	names := []string{}
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateFeatures returns an error if a feature isn't known.
+func ValidateFeatures(enabled []string) error {
+	for _, f := range enabled {
+		if _, ok := features[f]; !ok {
+			return fmt.Errorf("feature %v isn't supported; must be one of %v", f, KnownFeatures())
+		}
+	}
+	return nil
+}
+
+// featureApplications returns the applications of the KfDef with the enabled features applied.
+// The KfDef isn't changed so disabling a feature removes its overlays on the next apply.
+// The external storage of the KfDef is applied the same way so removing it restores the in-cluster storage.
+func (kustomize *kustomize) featureApplications() ([]kfdefsv3.Application, error) {
+	apps, err := applyFeatures(kustomize.kfDef.Spec.Applications, kustomize.kfDef.Spec.Features)
+	if err != nil {
+		return nil, err
+	}
+	return applyExternalStorage(apps, kustomize.kfDef.Spec.ExternalStorage), nil
+}
+
+// applyFeatures returns a copy of apps with the overlays and applications of the enabled features added.
+func applyFeatures(apps []kfdefsv3.Application, enabled []string) ([]kfdefsv3.Application, error) {
+	if err := ValidateFeatures(enabled); err != nil {
+		return nil, err
+	}
+	result := make([]kfdefsv3.Application, len(apps))
+	for i := range apps {
+		apps[i].DeepCopyInto(&result[i])
+	}
+
+	for _, f := range enabled {
+		for _, fa := range features[f] {
+			i := -1
+			for j, app := range result {
+				if app.Name == fa.name {
+					i = j
+					break
+				}
+			}
+			if i < 0 {
+				if fa.path == "" {
+					log.Warnf("Feature %v applies to application %v which isn't in the KfDef; skipping it", f, fa.name)
+					continue
+				}
+				log.Infof("Adding application %v for feature %v", fa.name, f)
+				result = append(result, kfdefsv3.Application{
+					Name: fa.name,
+					KustomizeConfig: &kfdefsv3.KustomizeConfig{
+						RepoRef: &kfdefsv3.RepoRef{
+							Name: kftypesv3.ManifestsRepoName,
+							Path: fa.path,
+						},
+						Overlays:   []string{},
+						Parameters: []config.NameValue{},
+					},
+				})
+				i = len(result) - 1
+			}
+
+			k := result[i].KustomizeConfig
+			if k == nil {
+				continue
+			}
+			for _, o := range fa.overlays {
+				if !hasOverlay(k.Overlays, o) {
+					k.Overlays = append(k.Overlays, o)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// hasOverlay returns true if overlays contains the overlay o.
+func hasOverlay(overlays []string, o string) bool {
+	for _, existing := range overlays {
+		if existing == o {
+			return true
+		}
+	}
+	return false
+}
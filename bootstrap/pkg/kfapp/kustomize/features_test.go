@@ -0,0 +1,77 @@
+package kustomize
+
+import (
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	"reflect"
+	"testing"
+)
+
+func TestApplyFeatures(t *testing.T) {
+	apps := []kfdefsv3.Application{
+		{
+			Name: "jupyter-web-app",
+			KustomizeConfig: &kfdefsv3.KustomizeConfig{
+				RepoRef:  &kfdefsv3.RepoRef{Name: "manifests", Path: "jupyter/jupyter-web-app"},
+				Overlays: []string{"istio", "application"},
+			},
+		},
+		{
+			Name: "profiles",
+			KustomizeConfig: &kfdefsv3.KustomizeConfig{
+				RepoRef:  &kfdefsv3.RepoRef{Name: "manifests", Path: "profiles"},
+				Overlays: []string{"application"},
+			},
+		},
+	}
+
+	actual, err := applyFeatures(apps, []string{"multi-user", "kfserving-beta"})
+	if err != nil {
+		t.Fatalf("applyFeatures failed; %v", err)
+	}
+	expected := []kfdefsv3.Application{
+		{
+			Name: "jupyter-web-app",
+			KustomizeConfig: &kfdefsv3.KustomizeConfig{
+				RepoRef:  &kfdefsv3.RepoRef{Name: "manifests", Path: "jupyter/jupyter-web-app"},
+				Overlays: []string{"istio", "application"},
+			},
+		},
+		{
+			Name: "profiles",
+			KustomizeConfig: &kfdefsv3.KustomizeConfig{
+				RepoRef:  &kfdefsv3.RepoRef{Name: "manifests", Path: "profiles"},
+				Overlays: []string{"application", "istio"},
+			},
+		},
+		{
+			Name: "kfserving-crds",
+			KustomizeConfig: &kfdefsv3.KustomizeConfig{
+				RepoRef:    &kfdefsv3.RepoRef{Name: "manifests", Path: "kfserving/kfserving-crds"},
+				Overlays:   []string{"application"},
+				Parameters: []config.NameValue{},
+			},
+		},
+		{
+			Name: "kfserving-install",
+			KustomizeConfig: &kfdefsv3.KustomizeConfig{
+				RepoRef:    &kfdefsv3.RepoRef{Name: "manifests", Path: "kfserving/kfserving-install"},
+				Overlays:   []string{"application"},
+				Parameters: []config.NameValue{},
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("applyFeatures: got\n%v\nwant\n%v", utils.PrettyPrint(actual), utils.PrettyPrint(expected))
+	}
+
+	// The applications of the KfDef aren't changed.
+	if !reflect.DeepEqual(apps[1].KustomizeConfig.Overlays, []string{"application"}) {
+		t.Errorf("applyFeatures changed the overlays of the KfDef to %v", apps[1].KustomizeConfig.Overlays)
+	}
+
+	if _, err := applyFeatures(apps, []string{"no-such-feature"}); err == nil {
+		t.Errorf("applyFeatures of an unknown feature: want an error")
+	}
+}
@@ -0,0 +1,285 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"fmt"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// gpuNamespace is the namespace of the GPU daemonsets; they set up the nodes for every namespace.
+	gpuNamespace = "kube-system"
+	// gkeAcceleratorLabel is set by GKE on the GPU nodes to the GPU type e.g. nvidia-tesla-k80.
+	gkeAcceleratorLabel = "cloud.google.com/gke-accelerator"
+
+	gpuDriverInstaller       = "nvidia-driver-installer"
+	gpuDevicePlugin          = "nvidia-device-plugin-daemonset"
+	defaultDevicePluginImage = "nvidia/k8s-device-plugin:1.0.0-beta4"
+	// nvidiaInstallDir is the directory of the node the driver is installed to; GKE mounts it
+	// into the containers requesting GPUs.
+	nvidiaInstallDir = "/home/kubernetes/bin/nvidia"
+	pauseImage       = "gcr.io/google-containers/pause:2.0"
+)
+
+// gpuDriverInstallers are the driver installers preloaded on the GKE nodes of each node OS.
+var gpuDriverInstallers = map[kfdefsv3.GpuNodeOS]string{
+	kfdefsv3.GpuNodeOSCos:    "cos-nvidia-installer:fixed",
+	kfdefsv3.GpuNodeOSUbuntu: "gke-nvidia-installer:fixed",
+}
+
+// gpuPodSpec returns the pod spec of a GPU daemonset scheduled to the GPU nodes of the config.
+// Every taint is tolerated so the GPU nodes, which are usually tainted, are set up.
+func gpuPodSpec(gpu *kfdefsv3.GpuConfig) v1.PodSpec {
+	spec := v1.PodSpec{
+		Tolerations: []v1.Toleration{{Operator: v1.TolerationOpExists}},
+	}
+	if len(gpu.NodeSelector) > 0 {
+		spec.NodeSelector = map[string]string{}
+		for k, v := range gpu.NodeSelector {
+			spec.NodeSelector[k] = v
+		}
+		return spec
+	}
+	spec.Affinity = &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{
+					MatchExpressions: []v1.NodeSelectorRequirement{{
+						Key:      gkeAcceleratorLabel,
+						Operator: v1.NodeSelectorOpExists,
+					}},
+				}},
+			},
+		},
+	}
+	return spec
+}
+
+// gpuNodeSelector returns the label selector of the GPU nodes of the config.
+func gpuNodeSelector(gpu *kfdefsv3.GpuConfig) string {
+	if len(gpu.NodeSelector) > 0 {
+		return labels.SelectorFromSet(gpu.NodeSelector).String()
+	}
+	return gkeAcceleratorLabel
+}
+
+// gpuDaemonSet returns a daemonset in gpuNamespace owned by the deployment.
+func (kustomize *kustomize) gpuDaemonSet(name string, spec v1.PodSpec) *appsv1.DaemonSet {
+	podLabels := map[string]string{"k8s-app": name}
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: gpuNamespace,
+			Labels:    kustomize.ownershipLabels(),
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+				Type: appsv1.RollingUpdateDaemonSetStrategyType,
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec:       spec,
+			},
+		},
+	}
+}
+
+// gpuDriverDaemonSet returns the daemonset installing the NVIDIA driver or nil if the KfDef doesn't
+// install it. The installer runs as an init container so the pod is only ready once the driver is
+// installed; a pause container keeps the pod running so the driver isn't installed again.
+func (kustomize *kustomize) gpuDriverDaemonSet() *appsv1.DaemonSet {
+	gpu := kustomize.kfDef.Spec.Gpu
+	if gpu == nil || gpu.Driver == nil {
+		return nil
+	}
+	nodeOS := gpu.Driver.NodeOS
+	if nodeOS == "" {
+		nodeOS = kfdefsv3.GpuNodeOSCos
+	}
+	image, pullPolicy := gpuDriverInstallers[nodeOS], v1.PullNever
+	if gpu.Driver.Image != "" {
+		image, pullPolicy = gpu.Driver.Image, v1.PullIfNotPresent
+	}
+
+	privileged := true
+	installer := v1.Container{
+		Name:            gpuDriverInstaller,
+		Image:           image,
+		ImagePullPolicy: pullPolicy,
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("150m")},
+		},
+		SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+		Env: []v1.EnvVar{
+			{Name: "NVIDIA_INSTALL_DIR_HOST", Value: nvidiaInstallDir},
+			{Name: "NVIDIA_INSTALL_DIR_CONTAINER", Value: "/usr/local/nvidia"},
+			{Name: "ROOT_MOUNT_DIR", Value: "/root"},
+		},
+		VolumeMounts: []v1.VolumeMount{
+			{Name: "nvidia-install-dir-host", MountPath: "/usr/local/nvidia"},
+			{Name: "dev", MountPath: "/dev"},
+			{Name: "root-mount", MountPath: "/root"},
+		},
+	}
+	volumes := []v1.Volume{
+		hostPathVolume("dev", "/dev"),
+		hostPathVolume("nvidia-install-dir-host", nvidiaInstallDir),
+		hostPathVolume("root-mount", "/"),
+	}
+	if nodeOS == kfdefsv3.GpuNodeOSCos {
+		installer.Env = append(installer.Env,
+			v1.EnvVar{Name: "COS_TOOLS_DIR_HOST", Value: "/var/lib/cos-tools"},
+			v1.EnvVar{Name: "COS_TOOLS_DIR_CONTAINER", Value: "/build/cos-tools"})
+		installer.VolumeMounts = append(installer.VolumeMounts, v1.VolumeMount{Name: "cos-tools", MountPath: "/build/cos-tools"})
+		volumes = append(volumes, hostPathVolume("cos-tools", "/var/lib/cos-tools"))
+	}
+	if gpu.Driver.Version != "" {
+		installer.Env = append(installer.Env, v1.EnvVar{Name: "NVIDIA_DRIVER_VERSION", Value: gpu.Driver.Version})
+	}
+
+	spec := gpuPodSpec(gpu)
+	spec.HostNetwork = true
+	spec.HostPID = true
+	spec.Volumes = volumes
+	spec.InitContainers = []v1.Container{installer}
+	spec.Containers = []v1.Container{{Name: "pause", Image: pauseImage}}
+	return kustomize.gpuDaemonSet(gpuDriverInstaller, spec)
+}
+
+// gpuDevicePluginDaemonSet returns the daemonset running the NVIDIA device plugin or nil if the
+// KfDef doesn't run it.
+func (kustomize *kustomize) gpuDevicePluginDaemonSet() *appsv1.DaemonSet {
+	gpu := kustomize.kfDef.Spec.Gpu
+	if gpu == nil || gpu.DevicePlugin == nil {
+		return nil
+	}
+	image := gpu.DevicePlugin.Image
+	if image == "" {
+		image = defaultDevicePluginImage
+	}
+
+	allowPrivilegeEscalation := false
+	spec := gpuPodSpec(gpu)
+	spec.PriorityClassName = "system-node-critical"
+	spec.Volumes = []v1.Volume{hostPathVolume("device-plugin", "/var/lib/kubelet/device-plugins")}
+	spec.Containers = []v1.Container{{
+		Name:  "nvidia-device-plugin-ctr",
+		Image: image,
+		SecurityContext: &v1.SecurityContext{
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			Capabilities:             &v1.Capabilities{Drop: []v1.Capability{"ALL"}},
+		},
+		VolumeMounts: []v1.VolumeMount{{Name: "device-plugin", MountPath: "/var/lib/kubelet/device-plugins"}},
+	}}
+	return kustomize.gpuDaemonSet(gpuDevicePlugin, spec)
+}
+
+func hostPathVolume(name string, path string) v1.Volume {
+	return v1.Volume{
+		Name:         name,
+		VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: path}},
+	}
+}
+
+// applyGpu creates or updates the GPU daemonsets of the KfDef and labels the GPU nodes. The
+// daemonsets which were removed from the KfDef are deleted as long as the deployment owns them.
+// It runs before the applications so the GPUs are being set up while they are applied.
+func (kustomize *kustomize) applyGpu(apps typedappsv1.AppsV1Interface, core corev1.CoreV1Interface) error {
+	daemonSets := apps.DaemonSets(gpuNamespace)
+	for _, d := range []struct {
+		name    string
+		desired *appsv1.DaemonSet
+	}{
+		{gpuDriverInstaller, kustomize.gpuDriverDaemonSet()},
+		{gpuDevicePlugin, kustomize.gpuDevicePluginDaemonSet()},
+	} {
+		existing, err := daemonSets.Get(d.name, metav1.GetOptions{})
+		switch {
+		case err != nil && !k8serrors.IsNotFound(err):
+		case err != nil && d.desired != nil:
+			log.Infof("Creating daemonset %v/%v", gpuNamespace, d.name)
+			_, err = daemonSets.Create(d.desired)
+		case err == nil && d.desired != nil:
+			if err := kustomize.checkAdoption("DaemonSet", gpuNamespace, d.name, existing.Labels[DeploymentLabel]); err != nil {
+				return err
+			}
+			log.Infof("Updating daemonset %v/%v", gpuNamespace, d.name)
+			existing.Labels = d.desired.Labels
+			existing.Spec = d.desired.Spec
+			_, err = daemonSets.Update(existing)
+		case err == nil && existing.Labels[DeploymentLabel] == toLabelValue(kustomize.kfDef.Name):
+			log.Infof("Deleting daemonset %v/%v", gpuNamespace, d.name)
+			err = daemonSets.Delete(d.name, &metav1.DeleteOptions{})
+		default:
+			err = nil
+		}
+		if err != nil {
+			return gpuError(fmt.Sprintf("daemonset %v/%v", gpuNamespace, d.name), err)
+		}
+		if d.desired != nil {
+			kustomize.recordResource(gpuSource, "apps/v1", "DaemonSet", gpuNamespace, d.name)
+		}
+	}
+
+	gpu := kustomize.kfDef.Spec.Gpu
+	if gpu == nil || len(gpu.NodeLabels) == 0 {
+		return nil
+	}
+	nodes, err := core.Nodes().List(metav1.ListOptions{LabelSelector: gpuNodeSelector(gpu)})
+	if err != nil {
+		return gpuError("the GPU node labels", err)
+	}
+	patch, err := gpuNodeLabelsPatch(gpu.NodeLabels)
+	if err != nil {
+		return gpuError("the GPU node labels", err)
+	}
+	for _, n := range nodes.Items {
+		if labelsSet(n.Labels, gpu.NodeLabels) {
+			continue
+		}
+		log.Infof("Labeling GPU node %v", n.Name)
+		if _, err := core.Nodes().Patch(n.Name, k8stypes.MergePatchType, patch); err != nil {
+			return gpuError(fmt.Sprintf("the labels of node %v", n.Name), err)
+		}
+	}
+	if len(nodes.Items) == 0 {
+		log.Warnf("No GPU nodes match %v; they are labeled the next time the deployment is applied", gpuNodeSelector(gpu))
+	}
+	return nil
+}
+
+// gpuNodeLabelsPatch returns the merge patch adding nodeLabels to a node.
+func gpuNodeLabelsPatch(nodeLabels map[string]string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": nodeLabels},
+	})
+}
+
+// labelsSet returns true if all the wanted labels are set to their values.
+func labelsSet(existing map[string]string, wanted map[string]string) bool {
+	for k, v := range wanted {
+		if existing[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func gpuError(what string, err error) error {
+	return &kfapisv3.KfError{
+		Code:    int(kfapisv3.INTERNAL_ERROR),
+		Message: fmt.Sprintf("couldn't apply %v Error: %v", what, err),
+	}
+}
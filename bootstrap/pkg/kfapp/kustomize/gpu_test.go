@@ -0,0 +1,111 @@
+package kustomize
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func envValue(c v1.Container, name string) (string, bool) {
+	for _, e := range c.Env {
+		if e.Name == name {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+func TestKustomize_gpuDriverDaemonSet(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Name: "kf-app"}},
+	}
+	if d := k.gpuDriverDaemonSet(); d != nil {
+		t.Errorf("gpuDriverDaemonSet without gpu: got %v; want nil", d.Name)
+	}
+
+	k.kfDef.Spec.Gpu = &kfdefsv3.GpuConfig{Driver: &kfdefsv3.GpuDriver{Version: "418.67"}}
+	d := k.gpuDriverDaemonSet()
+	if d == nil || d.Namespace != "kube-system" || d.Labels[DeploymentLabel] != "kf-app" {
+		t.Fatalf("gpuDriverDaemonSet: got %+v", d)
+	}
+	installer := d.Spec.Template.Spec.InitContainers[0]
+	if installer.Image != "cos-nvidia-installer:fixed" || installer.ImagePullPolicy != v1.PullNever {
+		t.Errorf("installer: got %v %v; want the preloaded cos installer", installer.Image, installer.ImagePullPolicy)
+	}
+	if v, _ := envValue(installer, "NVIDIA_DRIVER_VERSION"); v != "418.67" {
+		t.Errorf("NVIDIA_DRIVER_VERSION: got %q; want 418.67", v)
+	}
+	if _, ok := envValue(installer, "COS_TOOLS_DIR_HOST"); !ok {
+		t.Errorf("the cos installer doesn't mount the cos tools")
+	}
+	terms := d.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if terms[0].MatchExpressions[0].Key != gkeAcceleratorLabel {
+		t.Errorf("affinity: got %+v; want the GKE accelerator nodes", terms)
+	}
+
+	k.kfDef.Spec.Gpu = &kfdefsv3.GpuConfig{
+		NodeSelector: map[string]string{"accelerator": "nvidia"},
+		Driver:       &kfdefsv3.GpuDriver{NodeOS: kfdefsv3.GpuNodeOSUbuntu, Image: "acme.com/nvidia-installer:418"},
+	}
+	d = k.gpuDriverDaemonSet()
+	installer = d.Spec.Template.Spec.InitContainers[0]
+	if installer.Image != "acme.com/nvidia-installer:418" || installer.ImagePullPolicy != v1.PullIfNotPresent {
+		t.Errorf("installer: got %v %v; want the image of the KfDef", installer.Image, installer.ImagePullPolicy)
+	}
+	if _, ok := envValue(installer, "COS_TOOLS_DIR_HOST"); ok {
+		t.Errorf("the ubuntu installer mounts the cos tools")
+	}
+	if _, ok := envValue(installer, "NVIDIA_DRIVER_VERSION"); ok {
+		t.Errorf("NVIDIA_DRIVER_VERSION is set without a version")
+	}
+	if spec := d.Spec.Template.Spec; spec.Affinity != nil || spec.NodeSelector["accelerator"] != "nvidia" {
+		t.Errorf("node selection: got affinity %v, selector %v; want the selector of the KfDef", spec.Affinity, spec.NodeSelector)
+	}
+}
+
+func TestKustomize_gpuDevicePluginDaemonSet(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Name: "kf-app"}},
+	}
+	k.kfDef.Spec.Gpu = &kfdefsv3.GpuConfig{Driver: &kfdefsv3.GpuDriver{}}
+	if d := k.gpuDevicePluginDaemonSet(); d != nil {
+		t.Errorf("gpuDevicePluginDaemonSet without a device plugin: got %v; want nil", d.Name)
+	}
+
+	k.kfDef.Spec.Gpu.DevicePlugin = &kfdefsv3.GpuDevicePlugin{}
+	d := k.gpuDevicePluginDaemonSet()
+	if d == nil || d.Spec.Template.Spec.Containers[0].Image != defaultDevicePluginImage {
+		t.Fatalf("gpuDevicePluginDaemonSet: got %+v; want the default image", d)
+	}
+	if len(d.Spec.Template.Spec.Tolerations) != 1 || d.Spec.Template.Spec.Tolerations[0].Operator != v1.TolerationOpExists {
+		t.Errorf("tolerations: got %v; want every taint tolerated", d.Spec.Template.Spec.Tolerations)
+	}
+	if s := d.Spec.Selector.MatchLabels; s["k8s-app"] != gpuDevicePlugin || d.Spec.Template.Labels["k8s-app"] != gpuDevicePlugin {
+		t.Errorf("selector %v doesn't match the pod labels %v", s, d.Spec.Template.Labels)
+	}
+}
+
+func TestGpuNodeLabels(t *testing.T) {
+	gpu := &kfdefsv3.GpuConfig{}
+	if s := gpuNodeSelector(gpu); s != gkeAcceleratorLabel {
+		t.Errorf("gpuNodeSelector: got %v; want %v", s, gkeAcceleratorLabel)
+	}
+	gpu.NodeSelector = map[string]string{"accelerator": "nvidia"}
+	if s := gpuNodeSelector(gpu); s != "accelerator=nvidia" {
+		t.Errorf("gpuNodeSelector: got %v; want accelerator=nvidia", s)
+	}
+
+	patch, err := gpuNodeLabelsPatch(map[string]string{"kubeflow.org/gpu": "true"})
+	if err != nil || string(patch) != `{"metadata":{"labels":{"kubeflow.org/gpu":"true"}}}` {
+		t.Errorf("gpuNodeLabelsPatch: got %s, %v", patch, err)
+	}
+
+	wanted := map[string]string{"kubeflow.org/gpu": "true"}
+	if labelsSet(map[string]string{gkeAcceleratorLabel: "nvidia-tesla-k80"}, wanted) {
+		t.Errorf("labelsSet of an unlabeled node: got true")
+	}
+	if !labelsSet(map[string]string{gkeAcceleratorLabel: "nvidia-tesla-k80", "kubeflow.org/gpu": "true"}, wanted) {
+		t.Errorf("labelsSet of a labeled node: got false")
+	}
+}
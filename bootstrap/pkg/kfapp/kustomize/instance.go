@@ -0,0 +1,119 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"strings"
+)
+
+// istioLabel is the label istio gateways select the pods of ingress gateways by.
+const istioLabel = "istio"
+
+// scopedKinds are the cluster scoped kinds whose names are prefixed for an instance. Other
+// cluster scoped kinds e.g. CRDs and the istio MeshPolicy have well known names.
+var scopedKinds = map[string]bool{
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"MutatingWebhookConfiguration":   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// scopedName returns the name of a cluster scoped resource of the deployment.
+func (kustomize *kustomize) scopedName(name string) string {
+	return kustomize.kfDef.InstancePrefix() + name
+}
+
+// scopeInstance scopes the objects in the manifests to the instance of the deployment so they
+// don't collide with the ones of the other deployments in the cluster. The cluster scoped
+// resources are renamed and the role bindings follow the cluster roles defined by the manifests;
+// the ingress gateway gets the istio label of the instance so the Kubeflow gateway doesn't
+// select the ingress gateways of the others. The manifests are unchanged if the deployment isn't
+// scoped to an instance; nil manifests are skipped.
+func (kustomize *kustomize) scopeInstance(manifests [][]byte) error {
+	if kustomize.kfDef.Spec.Instance == nil {
+		return nil
+	}
+	decoded := make([][]map[string]interface{}, len(manifests))
+	clusterRoles := map[string]bool{}
+	for i, m := range manifests {
+		if m == nil {
+			continue
+		}
+		objects, err := decodeObjects(m)
+		if err != nil {
+			return err
+		}
+		for _, o := range objects {
+			if o["kind"] == "ClusterRole" {
+				metadata, _ := o["metadata"].(map[string]interface{})
+				name, _ := metadata["name"].(string)
+				clusterRoles[name] = true
+			}
+		}
+		decoded[i] = objects
+	}
+
+	// An ingress gateway installed outside the deployment is selected by ExistingPlatform.
+	relabelGateway := true
+	if existing := kustomize.kfDef.Spec.ExistingPlatform; existing != nil && len(existing.IngressGatewaySelector) > 0 {
+		relabelGateway = false
+	}
+	for i, objects := range decoded {
+		if objects == nil {
+			continue
+		}
+		encoded := []string{}
+		for _, o := range objects {
+			kustomize.scopeObject(o, clusterRoles)
+			if relabelGateway {
+				relabelIngressGateway(o, kustomize.kfDef.IngressGatewayLabel())
+			}
+			b, err := yaml.Marshal(o)
+			if err != nil {
+				return err
+			}
+			encoded = append(encoded, string(b))
+		}
+		manifests[i] = []byte(strings.Join(encoded, "---\n"))
+	}
+	return nil
+}
+
+// scopeObject prefixes the name of the object o if it is cluster scoped and the cluster role it
+// binds if the role is one of clusterRoles.
+func (kustomize *kustomize) scopeObject(o map[string]interface{}, clusterRoles map[string]bool) {
+	metadata, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	kind, _ := o["kind"].(string)
+	if name, ok := metadata["name"].(string); ok && scopedKinds[kind] {
+		metadata["name"] = kustomize.scopedName(name)
+	}
+	if kind != "RoleBinding" && kind != "ClusterRoleBinding" {
+		return
+	}
+	roleRef, _ := o["roleRef"].(map[string]interface{})
+	if name, ok := roleRef["name"].(string); ok && roleRef["kind"] == "ClusterRole" && clusterRoles[name] {
+		roleRef["name"] = kustomize.scopedName(name)
+	}
+}
+
+// relabelIngressGateway replaces the istio label of the ingress gateway with label wherever it
+// appears in v: the labels of the gateway pods, deployment and service and the selectors of the
+// service and the gateways.
+func relabelIngressGateway(v interface{}, label string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if t[istioLabel] == kfdefsv3.ManifestsIngressGatewayLabel {
+			t[istioLabel] = label
+		}
+		for _, child := range t {
+			relabelIngressGateway(child, label)
+		}
+	case []interface{}:
+		for _, child := range t {
+			relabelIngressGateway(child, label)
+		}
+	}
+}
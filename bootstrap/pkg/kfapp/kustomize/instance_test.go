@@ -0,0 +1,133 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func TestKustomize_scopeInstance(t *testing.T) {
+	// The cluster role and the binding to it are in different applications.
+	roles := `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: kubeflow-edit
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: kubeflow-admin-binding
+roleRef:
+  kind: ClusterRole
+  name: cluster-admin
+`
+	app := `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: default-editor
+  namespace: kubeflow
+roleRef:
+  kind: ClusterRole
+  name: kubeflow-edit
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: istio-ingressgateway
+  namespace: istio-system
+  labels:
+    istio: ingressgateway
+spec:
+  selector:
+    istio: ingressgateway
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: notebooks.kubeflow.org
+`
+	expectedRoles := `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: staging-kubeflow-edit
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: staging-kubeflow-admin-binding
+roleRef:
+  kind: ClusterRole
+  name: cluster-admin
+`
+	expectedApp := `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: default-editor
+  namespace: kubeflow
+roleRef:
+  kind: ClusterRole
+  name: staging-kubeflow-edit
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: istio-ingressgateway
+  namespace: istio-system
+  labels:
+    istio: staging-ingressgateway
+spec:
+  selector:
+    istio: staging-ingressgateway
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: notebooks.kubeflow.org
+`
+
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "staging",
+				Namespace: "kf-staging",
+			},
+			Spec: kfdefsv3.KfDefSpec{
+				Instance: &kfdefsv3.InstanceScope{},
+			},
+		},
+	}
+	manifests := [][]byte{[]byte(roles), nil, []byte(app)}
+	if err := k.scopeInstance(manifests); err != nil {
+		t.Fatalf("scopeInstance error; %v", err)
+	}
+	if manifests[1] != nil {
+		t.Errorf("scopeInstance changed a skipped manifest")
+	}
+	for i, expected := range map[int]string{0: expectedRoles, 2: expectedApp} {
+		actual, err := decodeObjects(manifests[i])
+		if err != nil {
+			t.Fatalf("decodeObjects error; %v", err)
+		}
+		want, err := decodeObjects([]byte(expected))
+		if err != nil {
+			t.Fatalf("decodeObjects error; %v", err)
+		}
+		if !reflect.DeepEqual(actual, want) {
+			a, _ := yaml.Marshal(actual)
+			t.Errorf("scopeInstance manifest %v:\ngot\n%v\nwant\n%v", i, string(a), expected)
+		}
+	}
+
+	// Without an instance the manifests are unchanged.
+	k.kfDef.Spec.Instance = nil
+	manifests = [][]byte{[]byte(roles)}
+	if err := k.scopeInstance(manifests); err != nil || string(manifests[0]) != roles {
+		t.Errorf("scopeInstance without an instance changed the manifest; %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"fmt"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"strings"
+)
+
+// Sources of the K8s objects in the inventory which aren't created by an application.
+const (
+	gpuSource        = "gpu"
+	namespacesSource = "namespaces"
+	profilesSource   = "profiles"
+	storageSource    = "external-storage"
+	usersSource      = "users"
+)
+
+// recordResource records a K8s object created for the deployment in its inventory.
+func (kustomize *kustomize) recordResource(source string, apiVersion string, kind string, namespace string, name string) {
+	kustomize.kfDef.RecordResource(kfdefsv3.InventoryResource{
+		Kind:       kind,
+		APIVersion: apiVersion,
+		Name:       name,
+		Namespace:  namespace,
+		Source:     source,
+	})
+}
+
+// recordObject records the applied object o in the inventory of the deployment.
+func (kustomize *kustomize) recordObject(source string, o map[string]interface{}) {
+	apiVersion, _ := o["apiVersion"].(string)
+	kind, _ := o["kind"].(string)
+	metadata, _ := o["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	kustomize.recordResource(source, apiVersion, kind, namespace, name)
+}
+
+// writeInventory saves the KfDef so the inventory is kept for Delete; a failure is only logged
+// since the resources were created.
+func (kustomize *kustomize) writeInventory() {
+	if kustomize.kfDef.Spec.AppDir == "" || len(kustomize.kfDef.Status.Inventory) == 0 {
+		return
+	}
+	if err := kustomize.kfDef.WriteToConfigFile(); err != nil {
+		log.Warnf("Could not save the inventory of deployment %v; error %v", kustomize.kfDef.Name, err)
+	}
+}
+
+// deleteInventory deletes the K8s objects in the inventory which are outside the namespace of the
+// deployment and are still owned by it; the objects in the namespace are deleted with it and the
+// objects which were adopted by another deployment are left alone. Every object is attempted
+// before the errors are returned.
+func (kustomize *kustomize) deleteInventory() error {
+	mapper, err := newRESTMapper(kustomize.restConfig)
+	if err != nil {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't create a restmapper Error: %v", err),
+		}
+	}
+
+	failed := []string{}
+	inventory := kustomize.kfDef.Status.Inventory
+	// Delete in the reverse order of creation so custom resources go before their CRDs.
+	for i := len(inventory) - 1; i >= 0; i-- {
+		r := inventory[i]
+		if r.APIVersion == "" || r.Namespace == kustomize.kfDef.Namespace ||
+			(r.Kind == "Namespace" && r.Name == kustomize.kfDef.Namespace) {
+			continue
+		}
+		if err := kustomize.deleteObject(mapper, r); err != nil {
+			log.Errorf("couldn't delete %v %v/%v Error: %v", r.Kind, r.Namespace, r.Name, err)
+			failed = append(failed, fmt.Sprintf("%v %v/%v: %v", r.Kind, r.Namespace, r.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't delete the resources of the inventory: %v", strings.Join(failed, "; ")),
+		}
+	}
+	return nil
+}
+
+// deleteObject deletes the K8s object r of the inventory if it still exists and is owned by the deployment.
+func (kustomize *kustomize) deleteObject(mapper meta.RESTMapper, r kfdefsv3.InventoryResource) error {
+	o := map[string]interface{}{
+		"apiVersion": r.APIVersion,
+		"kind":       r.Kind,
+	}
+	restClient, mapping, err := restClientFor(kustomize.restConfig, mapper, o)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			// The CRD of the object was deleted and the object with it.
+			return nil
+		}
+		return err
+	}
+	namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+
+	get := restClient.Get().Resource(mapping.Resource.Resource).Name(r.Name)
+	if namespaced {
+		get = get.Namespace(r.Namespace)
+	}
+	raw, err := get.Do().Raw()
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	existing := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return err
+	}
+	existingMeta, _ := existing["metadata"].(map[string]interface{})
+	existingLabels, _ := existingMeta["labels"].(map[string]interface{})
+	if owner, _ := existingLabels[DeploymentLabel].(string); owner != toLabelValue(kustomize.kfDef.Name) {
+		log.Infof("Not deleting %v %v/%v; it isn't owned by deployment %v", r.Kind, r.Namespace, r.Name, kustomize.kfDef.Name)
+		return nil
+	}
+
+	log.Infof("deleting %v %v/%v", r.Kind, r.Namespace, r.Name)
+	del := restClient.Delete().Resource(mapping.Resource.Resource).Name(r.Name)
+	if namespaced {
+		del = del.Namespace(r.Namespace)
+	}
+	if err := del.Do().Error(); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
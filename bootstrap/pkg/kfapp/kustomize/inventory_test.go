@@ -0,0 +1,44 @@
+package kustomize
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestKustomize_recordObject(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{ObjectMeta: metav1.ObjectMeta{Name: "kf-app", Namespace: "kubeflow"}},
+	}
+	k.recordObject("jupyter", map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "jupyter-web-app",
+			"namespace": "kubeflow",
+		},
+	})
+	k.recordObject("jupyter", map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "ClusterRole",
+		"metadata": map[string]interface{}{
+			"name": "jupyter-web-app-cluster-role",
+		},
+	})
+	k.recordResource(namespacesSource, "v1", "Namespace", "", "istio-system")
+
+	inventory := k.kfDef.Status.Inventory
+	if len(inventory) != 3 {
+		t.Fatalf("Got inventory %v; want 3 resources", inventory)
+	}
+	if r := inventory[0]; r.Kind != "Deployment" || r.APIVersion != "apps/v1" || r.Namespace != "kubeflow" ||
+		r.Name != "jupyter-web-app" || r.Source != "jupyter" || r.CreationTime.IsZero() {
+		t.Errorf("Got %+v; want the jupyter-web-app deployment", r)
+	}
+	if r := inventory[1]; r.Kind != "ClusterRole" || r.Namespace != "" {
+		t.Errorf("Got %+v; want the cluster scoped cluster role", r)
+	}
+	if r := inventory[2]; r.Kind != "Namespace" || r.Source != namespacesSource {
+		t.Errorf("Got %+v; want the istio-system namespace", r)
+	}
+}
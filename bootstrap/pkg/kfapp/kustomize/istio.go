@@ -0,0 +1,179 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"regexp"
+	"strings"
+)
+
+const (
+	// istioInstallApplication installs the istio control plane; the mesh policy is added to it.
+	istioInstallApplication = "istio-install"
+	istioIngressGateway     = "istio-ingressgateway"
+	istioInjectionLabel     = "istio-injection"
+)
+
+// configureIstio renders the istio options of the KfDef into the manifest of an application:
+// the type of the ingress gateway service and the mutual TLS mode of the mesh. The mesh policy
+// and, for strict mode, the destination rule making clients use mutual TLS are added to the
+// manifest of istio-install if the manifests don't have them. The manifest is returned
+// unchanged if there are no options.
+func (kustomize *kustomize) configureIstio(appName string, manifest []byte) ([]byte, error) {
+	istio := kustomize.kfDef.Spec.Istio
+	if istio == nil || (istio.MTLS == "" && istio.IngressGatewayType == "") {
+		return manifest, nil
+	}
+
+	splitter := regexp.MustCompile(kftypesv3.YamlSeparator)
+	objects := []string{}
+	hasPolicy, hasRule := false, false
+	for _, object := range splitter.Split(string(manifest), -1) {
+		var o map[string]interface{}
+		if err := yaml.Unmarshal([]byte(object), &o); err != nil {
+			return nil, err
+		}
+		if o == nil {
+			continue
+		}
+		kind, _ := o["kind"].(string)
+		metadata, _ := o["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		switch {
+		case kind == "Service" && name == istioIngressGateway && istio.IngressGatewayType != "":
+			setServiceType(o, istio.IngressGatewayType)
+		case kind == "MeshPolicy" && name == "default" && istio.MTLS != "":
+			o["spec"] = meshPolicySpec(istio.MTLS)
+			hasPolicy = true
+		case kind == "DestinationRule" && name == "default" && istio.MTLS == kfdefsv3.IstioMTLSStrict:
+			o["spec"] = destinationRuleSpec()
+			hasRule = true
+		}
+		b, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, string(b))
+	}
+
+	if appName == istioInstallApplication && istio.MTLS != "" {
+		added := []map[string]interface{}{}
+		if !hasPolicy {
+			added = append(added, map[string]interface{}{
+				"apiVersion": "authentication.istio.io/v1alpha1",
+				"kind":       "MeshPolicy",
+				"metadata":   map[string]interface{}{"name": "default"},
+				"spec":       meshPolicySpec(istio.MTLS),
+			})
+		}
+		if !hasRule && istio.MTLS == kfdefsv3.IstioMTLSStrict {
+			added = append(added, map[string]interface{}{
+				"apiVersion": "networking.istio.io/v1alpha3",
+				"kind":       "DestinationRule",
+				"metadata": map[string]interface{}{
+					"name":      "default",
+					"namespace": kfdefsv3.ManifestsIstioNamespace,
+				},
+				"spec": destinationRuleSpec(),
+			})
+		}
+		for _, o := range added {
+			b, err := yaml.Marshal(o)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, string(b))
+		}
+	}
+	return []byte(strings.Join(objects, "---\n")), nil
+}
+
+// setServiceType changes the type of the service o, removing the fields the type doesn't allow.
+func setServiceType(o map[string]interface{}, t v1.ServiceType) {
+	spec, _ := o["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+		o["spec"] = spec
+	}
+	spec["type"] = string(t)
+	if t == v1.ServiceTypeLoadBalancer {
+		return
+	}
+	delete(spec, "loadBalancerIP")
+	delete(spec, "loadBalancerSourceRanges")
+	if t != v1.ServiceTypeClusterIP {
+		return
+	}
+	delete(spec, "externalTrafficPolicy")
+	ports, _ := spec["ports"].([]interface{})
+	for _, p := range ports {
+		if port, ok := p.(map[string]interface{}); ok {
+			delete(port, "nodePort")
+		}
+	}
+}
+
+func meshPolicySpec(mode kfdefsv3.IstioMTLSMode) map[string]interface{} {
+	return map[string]interface{}{
+		"peers": []interface{}{
+			map[string]interface{}{
+				"mtls": map[string]interface{}{"mode": string(mode)},
+			},
+		},
+	}
+}
+
+// destinationRuleSpec makes the sidecars use mutual TLS to reach the services of the mesh.
+func destinationRuleSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"host": "*.local",
+		"trafficPolicy": map[string]interface{}{
+			"tls": map[string]interface{}{"mode": "ISTIO_MUTUAL"},
+		},
+	}
+}
+
+// labelInjectionNamespaces labels the injection namespaces of the KfDef so istio injects sidecars
+// into their pods, creating the namespaces which don't exist. Removing a namespace from the KfDef
+// doesn't remove the label since it may have been added by hand.
+func (kustomize *kustomize) labelInjectionNamespaces(client corev1.CoreV1Interface) error {
+	if kustomize.kfDef.Spec.Istio == nil {
+		return nil
+	}
+	for _, name := range kustomize.kfDef.Spec.Istio.InjectionNamespaces {
+		ns, err := client.Namespaces().Get(name, metav1.GetOptions{})
+		switch {
+		case err != nil && !k8serrors.IsNotFound(err):
+		case err != nil:
+			log.Infof("Creating namespace %v with sidecar injection", name)
+			_, err = client.Namespaces().Create(&v1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: map[string]string{istioInjectionLabel: "enabled"},
+				},
+			})
+		case ns.Labels[istioInjectionLabel] != "enabled":
+			log.Infof("Enabling sidecar injection in namespace %v", name)
+			if ns.Labels == nil {
+				ns.Labels = map[string]string{}
+			}
+			ns.Labels[istioInjectionLabel] = "enabled"
+			_, err = client.Namespaces().Update(ns)
+		}
+		if err != nil {
+			return &kfapisv3.KfError{
+				Code:    int(kfapisv3.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't enable sidecar injection in namespace %v Error: %v", name, err),
+			}
+		}
+	}
+	return nil
+}
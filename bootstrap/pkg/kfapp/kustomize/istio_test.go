@@ -0,0 +1,100 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestKustomize_configureIstio(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			Spec: kfdefsv3.KfDefSpec{
+				UseIstio: true,
+				Istio: &kfdefsv3.IstioConfig{
+					MTLS:               kfdefsv3.IstioMTLSStrict,
+					IngressGatewayType: v1.ServiceTypeClusterIP,
+				},
+			},
+		},
+	}
+
+	service := `apiVersion: v1
+kind: Service
+metadata:
+  name: istio-ingressgateway
+  namespace: istio-system
+spec:
+  type: LoadBalancer
+  loadBalancerIP: 10.0.0.1
+  externalTrafficPolicy: Local
+  ports:
+  - name: http2
+    port: 80
+    nodePort: 31380
+`
+	manifest := service + `---
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls:
+      mode: PERMISSIVE
+`
+	out, err := k.configureIstio(istioInstallApplication, []byte(manifest))
+	if err != nil {
+		t.Fatalf("configureIstio: %v", err)
+	}
+	objects := []map[string]interface{}{}
+	for _, s := range regexp.MustCompile("\n---\n").Split(string(out), -1) {
+		var o map[string]interface{}
+		if err := yaml.Unmarshal([]byte(s), &o); err != nil {
+			t.Fatalf("Could not unmarshal %v; %v", s, err)
+		}
+		objects = append(objects, o)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("configureIstio: got %v objects; want the service, mesh policy and destination rule", len(objects))
+	}
+
+	expectedService := map[string]interface{}{
+		"type": "ClusterIP",
+		"ports": []interface{}{
+			map[string]interface{}{"name": "http2", "port": float64(80)},
+		},
+	}
+	if spec := objects[0]["spec"]; !reflect.DeepEqual(spec, expectedService) {
+		t.Errorf("configureIstio service: got %v; want %v", spec, expectedService)
+	}
+	if spec := objects[1]["spec"]; !reflect.DeepEqual(spec, yamlValue(t, "peers: [{mtls: {mode: STRICT}}]")) {
+		t.Errorf("configureIstio mesh policy: got %v", spec)
+	}
+	if objects[2]["kind"] != "DestinationRule" || !reflect.DeepEqual(objects[2]["spec"],
+		yamlValue(t, "{host: '*.local', trafficPolicy: {tls: {mode: ISTIO_MUTUAL}}}")) {
+		t.Errorf("configureIstio destination rule: got %v", objects[2])
+	}
+
+	// Only istio-install gets the missing mesh policy.
+	if out, err := k.configureIstio("jupyter-web-app", []byte(service)); err != nil || strings.Contains(string(out), "MeshPolicy") {
+		t.Errorf("configureIstio added the mesh policy to jupyter-web-app: %s, %v", out, err)
+	}
+
+	k.kfDef.Spec.Istio = &kfdefsv3.IstioConfig{InjectionNamespaces: []string{"serving"}}
+	if out, err := k.configureIstio(istioInstallApplication, []byte(manifest)); err != nil || string(out) != manifest {
+		t.Errorf("configureIstio without manifest options changed the manifest: %s, %v", out, err)
+	}
+}
+
+func yamlValue(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("Could not unmarshal %v; %v", s, err)
+	}
+	return v
+}
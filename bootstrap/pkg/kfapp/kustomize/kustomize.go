@@ -37,6 +37,7 @@ import (
 	"k8s.io/api/core/v1"
 	rbacv2 "k8s.io/api/rbac/v1"
 	crdclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -48,6 +49,7 @@ import (
 	rbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -61,7 +63,6 @@ import (
 	"sigs.k8s.io/kustomize/pkg/target"
 	"sigs.k8s.io/kustomize/pkg/types"
 	"strings"
-	"time"
 
 	// Auth plugins
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -107,6 +108,12 @@ type kustomize struct {
 	componentMap     map[string]bool
 	packageMap       map[string]*[]string
 	restConfig       *rest.Config
+	// applications if non nil limits the next Apply to the named applications.
+	applications map[string]bool
+	// newApplyBackOff if non nil returns the backoff used to retry applying a resource.
+	newApplyBackOff func() backoff.BackOff
+	// openManifestSink if non nil opens the manifest sinks of the KfDef.
+	openManifestSink func(sink string) (manifestSink, error)
 }
 
 const (
@@ -117,6 +124,9 @@ const (
 // Setter defines an interface for modifying the plugin.
 type Setter interface {
 	SetK8sRestConfig(r *rest.Config)
+	// SetApplicationFilter limits the next Apply to the named applications; the status of the other
+	// applications is left unchanged. If names is nil all applications are applied.
+	SetApplicationFilter(names []string)
 }
 
 // GetKfApp is the common entry point for all implementations of the KfApp interface
@@ -259,46 +269,211 @@ func (kustomize *kustomize) Apply(resources kftypesv3.ResourceEnum) error {
 			Message: fmt.Sprintf("Error: kustomize plugin couldn't initialize a K8s client %v", err),
 		}
 	}
-	clientset := kftypesv3.GetClientset(kustomize.restConfig)
-	namespace := kustomize.kfDef.ObjectMeta.Namespace
-	log.Infof(string(kftypesv3.NAMESPACE)+": %v", namespace)
-	_, nsMissingErr := clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
-	if nsMissingErr != nil {
-		log.Infof("Creating namespace: %v", namespace)
-		nsSpec := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
-		_, nsErr := clientset.CoreV1().Namespaces().Create(nsSpec)
-		if nsErr != nil {
-			return &kfapisv3.KfError{
-				Code: int(kfapisv3.INVALID_ARGUMENT),
-				Message: fmt.Sprintf("couldn't create %v %v Error: %v",
-					string(kftypesv3.NAMESPACE), namespace, nsErr),
-			}
+
+	// The filter only applies to this call.
+	defer kustomize.SetApplicationFilter(nil)
+	// The inventory is saved even if the apply fails part way so Delete finds what was created.
+	defer kustomize.writeInventory()
+
+	// Evaluate all the manifests first so the cluster can be checked before anything is applied.
+	// An application which can't be evaluated is marked as failed and the others are still applied.
+	apps, err := kustomize.featureApplications()
+	if err != nil {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: err.Error(),
 		}
 	}
-
 	kustomizeDir := path.Join(kustomize.kfDef.Spec.AppDir, outputDir)
-	for _, app := range kustomize.kfDef.Spec.Applications {
+	manifests := make([][]byte, len(apps))
+	failed := []string{}
+	for i, app := range apps {
+		if !kustomize.selected(app.Name) {
+			continue
+		}
 		resMap, err := EvaluateKustomizeManifest(path.Join(kustomizeDir, app.Name))
 		if err != nil {
 			log.Errorf("error evaluating kustomization manifest for %v Error %v", app.Name, err)
-			return &kfapisv3.KfError{
-				Code:    int(kfapisv3.INTERNAL_ERROR),
-				Message: fmt.Sprintf("error evaluating kustomization manifest for %v Error %v", app.Name, err),
-			}
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationFailed,
+				fmt.Sprintf("error evaluating kustomization manifest Error %v", err))
+			failed = append(failed, app.Name)
+			continue
 		}
 		data, err := resMap.EncodeAsYaml()
 		if err != nil {
-			return &kfapisv3.KfError{
-				Code:    int(kfapisv3.INTERNAL_ERROR),
-				Message: fmt.Sprintf("can not encode component %v as yaml Error %v", app.Name, err),
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationFailed,
+				fmt.Sprintf("can not encode component as yaml Error %v", err))
+			failed = append(failed, app.Name)
+			continue
+		}
+		if data, err = kustomize.placeWorkloads(app.Name, data); err != nil {
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationFailed,
+				fmt.Sprintf("can not add the placements to the manifest Error %v", err))
+			failed = append(failed, app.Name)
+			continue
+		}
+		if data, err = kustomize.configureIstio(app.Name, data); err != nil {
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationFailed,
+				fmt.Sprintf("can not add the istio options to the manifest Error %v", err))
+			failed = append(failed, app.Name)
+			continue
+		}
+		if data, err = kustomize.configureGateway(data); err != nil {
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationFailed,
+				fmt.Sprintf("can not bind the gateway to the existing ingress gateway Error %v", err))
+			failed = append(failed, app.Name)
+			continue
+		}
+		manifests[i] = data
+	}
+
+	// The manifests are scoped together since bindings reference the cluster roles of other applications.
+	if err := kustomize.scopeInstance(manifests); err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("can not scope the manifests to the instance Error %v", err))
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("can not scope the manifests to the instance Error %v", err),
+		}
+	}
+
+	if err := kustomize.injectCABundle(manifests); err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("can not inject the CA bundle into the manifests Error %v", err))
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("can not inject the CA bundle into the manifests Error %v", err),
+		}
+	}
+
+	// Istio and Knative already installed in the cluster are reused instead of the bundled ones.
+	reused, err := kustomize.reusedApplications(kftypesv3.GetClientset(kustomize.restConfig).AppsV1())
+	if err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("the existing platform isn't compatible: %v", err))
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("the existing platform isn't compatible: %v", err),
+		}
+	}
+	for i, app := range apps {
+		if reason, ok := reused[app.Name]; ok && manifests[i] != nil {
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationSkipped, reason)
+			manifests[i] = nil
+		}
+	}
+
+	evaluated := [][]byte{}
+	for _, m := range manifests {
+		if m != nil {
+			evaluated = append(evaluated, m)
+		}
+	}
+	if err := kustomize.checkCluster(evaluated); err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("the cluster wasn't checked or isn't compatible: %v", err))
+		if IsIncompatibleCluster(err) {
+			return err
+		}
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't check the cluster is compatible Error: %v", err),
+		}
+	}
+
+	// The manifests are signed before anything is applied so an unsigned manifest is never applied.
+	if err := kustomize.signManifests(apps, manifests); err != nil {
+		kustomize.skipApplications(apps, manifests, err.Error())
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: err.Error(),
+		}
+	}
+
+	// The manifests are written before anything is applied so the sinks have what is applied.
+	if err := kustomize.writeManifests(apps, manifests); err != nil {
+		kustomize.skipApplications(apps, manifests, err.Error())
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: err.Error(),
+		}
+	}
+
+	clientset := kftypesv3.GetClientset(kustomize.restConfig)
+	for _, namespace := range kustomize.kfDef.TargetNamespaces() {
+		log.Infof(string(kftypesv3.NAMESPACE)+": %v", namespace)
+		_, nsMissingErr := clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+		if nsMissingErr != nil {
+			log.Infof("Creating namespace: %v", namespace)
+			nsSpec := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			_, nsErr := clientset.CoreV1().Namespaces().Create(nsSpec)
+			if nsErr != nil {
+				kustomize.skipApplications(apps, manifests, fmt.Sprintf("couldn't create namespace %v", namespace))
+				return &kfapisv3.KfError{
+					Code: int(kfapisv3.INVALID_ARGUMENT),
+					Message: fmt.Sprintf("couldn't create %v %v Error: %v",
+						string(kftypesv3.NAMESPACE), namespace, nsErr),
+				}
 			}
+			kustomize.recordResource(namespacesSource, "v1", "Namespace", "", namespace)
 		}
-		resourcesErr := kustomize.deployResources(kustomize.restConfig, data)
+	}
+
+	if err := kustomize.applyNamespaceLimits(clientset.CoreV1()); err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("couldn't apply the namespace limits: %v", err))
+		return err
+	}
+
+	if err := kustomize.labelInjectionNamespaces(clientset.CoreV1()); err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("couldn't enable sidecar injection: %v", err))
+		return err
+	}
+
+	if err := kustomize.applyExternalStorageSecrets(clientset.CoreV1()); err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("couldn't create the credentials of the external storage: %v", err))
+		return err
+	}
+
+	if err := kustomize.applyGpu(clientset.AppsV1(), clientset.CoreV1()); err != nil {
+		kustomize.skipApplications(apps, manifests, fmt.Sprintf("couldn't set up the GPU nodes: %v", err))
+		return err
+	}
+
+	// Apply every application even if an earlier one fails so a single failure doesn't block
+	// the rest of the deployment; the failed applications can be retried on their own.
+	var conflictErr error
+	applied := make([][]byte, len(apps))
+	for i, app := range apps {
+		if manifests[i] == nil {
+			continue
+		}
+		resourcesErr := kustomize.deployResources(kustomize.restConfig, app.Name, manifests[i])
 		if resourcesErr != nil {
-			return &kfapisv3.KfError{
-				Code:    int(kfapisv3.INTERNAL_ERROR),
-				Message: fmt.Sprintf("couldn't create resources from %v Error: %v", app.Name, resourcesErr),
+			log.Errorf("couldn't create resources from %v Error: %v", app.Name, resourcesErr)
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationFailed, resourcesErr.Error())
+			failed = append(failed, app.Name)
+			if IsResourceConflict(resourcesErr) && conflictErr == nil {
+				conflictErr = resourcesErr
 			}
+			continue
+		}
+		kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationApplied, "")
+		applied[i] = manifests[i]
+	}
+
+	if conflictErr != nil {
+		return conflictErr
+	}
+
+	// Applied YAML isn't a working deployment; wait for the applied applications to be ready.
+	probe := newReadinessProbe(clientset, &http.Client{Timeout: readinessProbeTimeout})
+	notReady := kustomize.waitForApplications(apps, applied, probe)
+	if len(failed) > 0 {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't apply applications %v; see the status of each application for the errors", strings.Join(failed, ", ")),
+		}
+	}
+	if len(notReady) > 0 {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("applications %v aren't ready; see the status of each application for the failing checks", strings.Join(notReady, ", ")),
 		}
 	}
 
@@ -333,34 +508,23 @@ func (kustomize *kustomize) Apply(resources kftypesv3.ResourceEnum) error {
 		if err != nil {
 			return err
 		}
-		resourcesErr := kustomize.deployResources(kustomize.restConfig, body)
+		resourcesErr := kustomize.deployResources(kustomize.restConfig, profilesSource, body)
 		if resourcesErr != nil {
 			return &kfapisv3.KfError{
 				Code:    int(kfapisv3.INTERNAL_ERROR),
 				Message: fmt.Sprintf("couldn't create default profile from %v Error: %v", profile, resourcesErr),
 			}
 		}
-		b := backoff.NewExponentialBackOff()
-		b.InitialInterval = 3 * time.Second
-		b.MaxInterval = 30 * time.Second
-		b.MaxElapsedTime = 15 * time.Minute
-		return backoff.Retry(func() error {
-			_, nsErr := clientset.CoreV1().Namespaces().Get(defaultProfileNamespace, metav1.GetOptions{})
-			if nsErr != nil {
-				msg := fmt.Sprintf("Could not find namespace %v, wait and retry: %v", defaultProfileNamespace, nsErr)
-				log.Warnf(msg)
-				return &kfapisv3.KfError{
-					Code:    int(kfapisv3.INVALID_ARGUMENT),
-					Message: msg,
-				}
-			}
-			return nil
-		}, b)
+		if err := waitForNamespace(clientset.CoreV1(), defaultProfileNamespace); err != nil {
+			return err
+		}
 	} else {
 		log.Infof("Default profile namespace already exists: %v within owner %v", defaultProfileNamespace,
 			profile.Spec.Owner.Name)
 	}
-	return nil
+
+	// Grant the admins access and create the profiles of the teams.
+	return kustomize.bootstrapUsers(clientset.CoreV1(), clientset.RbacV1())
 }
 
 // deployResourcesFromFile creates resources from a file, just like `kubectl create -f filename`
@@ -371,19 +535,18 @@ func (kustomize *kustomize) deployResourcesFromFile(config *rest.Config, filenam
 	if err != nil {
 		return err
 	}
-	return kustomize.deployResources(config, data)
+	return kustomize.deployResources(config, path.Base(filename), data)
 }
 
-// deployResources creates resources with byte array.
-func (kustomize *kustomize) deployResources(config *rest.Config, data []byte) error {
-	// Create a restmapper to determine the resource type.
-	_discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+// deployResources creates resources with byte array and records them in the inventory of the
+// deployment as created by source.
+// Each resource is retried on its own while it fails with a transient error e.g. a webhook or a
+// CRD it depends on isn't ready yet.
+func (kustomize *kustomize) deployResources(config *rest.Config, source string, data []byte) error {
+	mapper, err := newRESTMapper(config)
 	if err != nil {
 		return err
 	}
-	_cached := cached.NewMemCacheClient(_discoveryClient)
-	_cached.Invalidate()
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(_cached)
 
 	splitter := regexp.MustCompile(kftypesv3.YamlSeparator)
 	objects := splitter.Split(string(data), -1)
@@ -398,77 +561,125 @@ func (kustomize *kustomize) deployResources(config *rest.Config, data []byte) er
 			log.Warnf("Unknown resource: %v", object)
 			continue
 		}
-		apiVersion := strings.Split(a.(string), "/")
-		var group, version string
-		if len(apiVersion) == 1 {
-			// core v1, no group. e.g. namespace
-			group, version = "", apiVersion[0]
-		} else {
-			group, version = apiVersion[0], apiVersion[1]
-		}
+		kustomize.relocateNamespaces(o)
 		metadata := o["metadata"].(map[string]interface{})
-		var namespace string
-		if metadata["namespace"] != nil {
-			namespace = metadata["namespace"].(string)
-		} else {
-			namespace = ""
+		if metadata["name"] == nil {
+			log.Warnf("object with kind %v has no name\n", o["kind"])
+			continue
 		}
+		name := metadata["name"].(string)
 		kind := o["kind"].(string)
-		gk := schema.GroupKind{
-			Group: group,
-			Kind:  kind,
-		}
-		mapping, retryErr := mapper.RESTMapping(gk, version)
-		if retryErr != nil {
-			return retryErr
-		}
-		// build config for restClient
-		c := rest.CopyConfig(config)
-		c.GroupVersion = &schema.GroupVersion{
-			Group:   group,
-			Version: version,
-		}
-		c.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
-		if group == "" {
-			c.APIPath = "/api"
-		} else {
-			c.APIPath = "/apis"
-		}
-		restClient, err := rest.RESTClientFor(c)
+
+		err := retryApply(kind+"/"+name, kustomize.applyBackOff(),
+			func() error {
+				return kustomize.applyObject(config, mapper, o)
+			},
+			func(err error) {
+				kustomize.waitBeforeRetry(config, mapper, err)
+			})
 		if err != nil {
 			return err
 		}
+		// Shared CRDs aren't deleted with the deployment so they aren't part of its inventory.
+		if !isCRD(o) || !kustomize.kfDef.SharesCRDs() {
+			kustomize.recordObject(source, o)
+		}
 
-		// build the request
-		if metadata["name"] != nil {
-			name := metadata["name"].(string)
-			log.Infof("creating %v/%v\n", kind, name)
-			body, err := json.Marshal(o)
-			if err != nil {
-				return err
-			}
-
-			request := restClient.Post().Resource(mapping.Resource.Resource).Body(body)
-			if mapping.Scope.Name() == "namespace" {
-				request = request.Namespace(namespace)
-			}
-			result := request.Do()
-			if result.Error() != nil {
-				statusCode := 200
-				result.StatusCode(&statusCode)
-				switch statusCode {
-				case 200:
-					fallthrough
-				case 409:
-					continue
-				default:
-					return result.Error()
-				}
+		// Custom resources of the CRD can't be applied until it is established.
+		if isCRD(o) {
+			if err := waitForCRDEstablished(config, name); err != nil {
+				log.Warnf("CRD %v isn't established; its custom resources will be retried; error %v", name, err)
 			}
-		} else {
-			log.Warnf("object with kind %v has no name\n", metadata["kind"])
 		}
+	}
+	return nil
+}
+
+// newRESTMapper returns a restmapper to determine the resource type of objects.
+func newRESTMapper(config *rest.Config) (*restmapper.DeferredDiscoveryRESTMapper, error) {
+	_discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	_cached := cached.NewMemCacheClient(_discoveryClient)
+	_cached.Invalidate()
+	return restmapper.NewDeferredDiscoveryRESTMapper(_cached), nil
+}
+
+// restClientFor returns a client for the resource of o and its mapping.
+func restClientFor(config *rest.Config, mapper meta.RESTMapper, o map[string]interface{}) (*rest.RESTClient, *meta.RESTMapping, error) {
+	apiVersion := strings.Split(o["apiVersion"].(string), "/")
+	var group, version string
+	if len(apiVersion) == 1 {
+		// core v1, no group. e.g. namespace
+		group, version = "", apiVersion[0]
+	} else {
+		group, version = apiVersion[0], apiVersion[1]
+	}
+	kind := o["kind"].(string)
+	gk := schema.GroupKind{
+		Group: group,
+		Kind:  kind,
+	}
+	mapping, err := mapper.RESTMapping(gk, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	// build config for restClient
+	c := rest.CopyConfig(config)
+	c.GroupVersion = &schema.GroupVersion{
+		Group:   group,
+		Version: version,
+	}
+	c.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
+	if group == "" {
+		c.APIPath = "/api"
+	} else {
+		c.APIPath = "/apis"
+	}
+	restClient, err := rest.RESTClientFor(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return restClient, mapping, nil
+}
+
+// applyObject creates the resource o.
+func (kustomize *kustomize) applyObject(config *rest.Config, mapper meta.RESTMapper, o map[string]interface{}) error {
+	restClient, mapping, err := restClientFor(config, mapper, o)
+	if err != nil {
+		return err
+	}
+	metadata := o["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	kind := o["kind"].(string)
+
+	// build the request
+	name := metadata["name"].(string)
+	log.Infof("creating %v/%v\n", kind, name)
+	kustomize.setOwnershipLabels(o)
+	body, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
 
+	request := restClient.Post().Resource(mapping.Resource.Resource).Body(body)
+	if mapping.Scope.Name() == "namespace" {
+		request = request.Namespace(namespace)
+	}
+	result := request.Do()
+	if result.Error() != nil {
+		statusCode := 200
+		result.StatusCode(&statusCode)
+		switch statusCode {
+		case 200:
+			return nil
+		case 409:
+			return kustomize.resolveConflict(restClient, mapping.Resource.Resource,
+				mapping.Scope.Name() == "namespace", o)
+		default:
+			return result.Error()
+		}
 	}
 	return nil
 }
@@ -492,7 +703,12 @@ func (kustomize *kustomize) deleteGlobalResources() error {
 	lo := metav1.ListOptions{
 		LabelSelector: kftypesv3.DefaultAppLabel + "=" + kustomize.kfDef.Name,
 	}
-	crdsErr := apiextclientset.CustomResourceDefinitions().DeleteCollection(do, lo)
+	var crdsErr error
+	if kustomize.kfDef.SharesCRDs() {
+		log.Infof("Not deleting the CRDs; they are shared with the other deployments in the cluster")
+	} else {
+		crdsErr = apiextclientset.CustomResourceDefinitions().DeleteCollection(do, lo)
+	}
 	if crdsErr != nil {
 		return &kfapisv3.KfError{
 			Code:    int(kfapisv3.INVALID_ARGUMENT),
@@ -534,6 +750,9 @@ func (kustomize *kustomize) Delete(resources kftypesv3.ResourceEnum) error {
 	if err := kustomize.deleteGlobalResources(); err != nil {
 		return err
 	}
+	if err := kustomize.deleteInventory(); err != nil {
+		return err
+	}
 	corev1client, err := corev1.NewForConfig(kustomize.restConfig)
 	if err != nil {
 		return &kfapisv3.KfError{
@@ -541,6 +760,8 @@ func (kustomize *kustomize) Delete(resources kftypesv3.ResourceEnum) error {
 			Message: fmt.Sprintf("couldn't get core/v1 client Error: %v", err),
 		}
 	}
+	// The other namespaces of the namespace layout e.g. istio-system may be shared with other
+	// deployments so they aren't deleted.
 	namespace := kustomize.kfDef.Namespace
 	log.Infof("deleting namespace: %v", namespace)
 	ns, nsMissingErr := corev1client.Namespaces().Get(namespace, metav1.GetOptions{})
@@ -600,7 +821,16 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 			return errors.WithStack(err)
 		}
 
-		for _, app := range kustomize.kfDef.Spec.Applications {
+		// The overlays of the enabled features are only added to the generated kustomizations so
+		// users don't have to edit them.
+		apps, err := kustomize.featureApplications()
+		if err != nil {
+			return &kfapisv3.KfError{
+				Code:    int(kfapisv3.INVALID_ARGUMENT),
+				Message: err.Error(),
+			}
+		}
+		for _, app := range apps {
 			log.Infof("Processing application: %v", app.Name)
 
 			if app.KustomizeConfig == nil {
@@ -640,6 +870,12 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 					Message: fmt.Sprintf("couldn't generate kustomization file for component %s", app.Name),
 				}
 			}
+			if err := applyTransformers(kustomize.kfDef, path.Join(kustomizeDir, app.Name), app.Name); err != nil {
+				return &kfapisv3.KfError{
+					Code:    int(kfapisv3.INVALID_ARGUMENT),
+					Message: fmt.Sprintf("couldn't apply the transformers of application %v; %v", app.Name, err),
+				}
+			}
 		}
 		return nil
 	}
@@ -731,6 +967,41 @@ func (kustomize *kustomize) SetK8sRestConfig(r *rest.Config) {
 	kustomize.restConfig = r
 }
 
+func (kustomize *kustomize) SetApplicationFilter(names []string) {
+	if names == nil {
+		kustomize.applications = nil
+		return
+	}
+	kustomize.applications = map[string]bool{}
+	for _, n := range names {
+		kustomize.applications[n] = true
+	}
+}
+
+// selected returns true if the application should be applied by the current Apply.
+func (kustomize *kustomize) selected(name string) bool {
+	return kustomize.applications == nil || kustomize.applications[name]
+}
+
+// setApplicationStatus records the outcome of applying an application in the KfDef status.
+func (kustomize *kustomize) setApplicationStatus(name string, state kfdefsv3.ApplicationState, message string) {
+	kustomize.kfDef.SetApplicationStatus(kfdefsv3.ApplicationStatus{
+		Name:           name,
+		State:          state,
+		Message:        message,
+		LastUpdateTime: metav1.Now(),
+	})
+}
+
+// skipApplications marks the selected applications which haven't been applied as skipped.
+func (kustomize *kustomize) skipApplications(apps []kfdefsv3.Application, manifests [][]byte, reason string) {
+	for i, app := range apps {
+		if kustomize.selected(app.Name) && manifests[i] != nil {
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationSkipped, reason)
+		}
+	}
+}
+
 // GetKustomization will read a kustomization.yaml and return Kustomization type
 func GetKustomization(kustomizationPath string) *types.Kustomization {
 	kustomizationFile := filepath.Join(kustomizationPath, kftypesv3.KustomizationFile)
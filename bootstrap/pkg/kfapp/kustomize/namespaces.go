@@ -0,0 +1,139 @@
+package kustomize
+
+import (
+	"regexp"
+	"strings"
+)
+
+// serviceHostname matches the hostnames of services e.g. ml-pipeline.kubeflow,
+// ml-pipeline.kubeflow.svc and ml-pipeline.kubeflow.svc.cluster.local followed by the character
+// after them so the labels of longer domains e.g. www.kubeflow.org aren't matched.
+var serviceHostname = regexp.MustCompile(`([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.([a-z0-9]([-a-z0-9]*[a-z0-9])?)(\.svc(\.cluster\.local)?)?([^-A-Za-z0-9.]|$)`)
+
+// relocateNamespaces moves the object o to the namespace the deployment uses in place of the
+// namespace the manifests put it in. References to namespaces by RBAC subjects, webhooks, API
+// services, the hostnames of services in config maps and the env and args of containers are
+// moved consistently so the components can still reach each other.
+func (kustomize *kustomize) relocateNamespaces(o map[string]interface{}) {
+	mapNamespaces(o, kustomize.kfDef.RelocateNamespace)
+}
+
+// mapNamespaces replaces the namespace of the object o and the namespaces it references with the
+// namespaces relocate returns for them.
+func mapNamespaces(o map[string]interface{}, relocate func(string) string) {
+	metadata, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	kind, _ := o["kind"].(string)
+	if kind == "Namespace" {
+		relocateField(metadata, "name", relocate)
+		return
+	}
+	relocateField(metadata, "namespace", relocate)
+	relocateContainers(o, relocate)
+
+	switch kind {
+	case "RoleBinding", "ClusterRoleBinding":
+		subjects, _ := o["subjects"].([]interface{})
+		for _, s := range subjects {
+			if subject, ok := s.(map[string]interface{}); ok {
+				relocateField(subject, "namespace", relocate)
+			}
+		}
+	case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+		webhooks, _ := o["webhooks"].([]interface{})
+		for _, w := range webhooks {
+			webhook, _ := w.(map[string]interface{})
+			clientConfig, _ := webhook["clientConfig"].(map[string]interface{})
+			if service, ok := clientConfig["service"].(map[string]interface{}); ok {
+				relocateField(service, "namespace", relocate)
+			}
+		}
+	case "ConfigMap":
+		data, _ := o["data"].(map[string]interface{})
+		for k, v := range data {
+			if value, ok := v.(string); ok {
+				data[k] = relocateHostnames(value, relocate)
+			}
+		}
+	case "APIService":
+		spec, _ := o["spec"].(map[string]interface{})
+		if service, ok := spec["service"].(map[string]interface{}); ok {
+			relocateField(service, "namespace", relocate)
+		}
+	}
+}
+
+// relocateField replaces the namespace in m[key] with the namespace relocate returns for it.
+func relocateField(m map[string]interface{}, key string, relocate func(string) string) {
+	if ns, ok := m[key].(string); ok && ns != "" {
+		m[key] = relocate(ns)
+	}
+}
+
+// podSpecPaths are the paths of the pod specs in the workloads.
+var podSpecPaths = [][]string{
+	{"spec"},
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// relocateContainers replaces the namespaces the env and args of the containers of the object o
+// reference with the namespaces relocate returns for them.
+func relocateContainers(o map[string]interface{}, relocate func(string) string) {
+	for _, p := range podSpecPaths {
+		spec := o
+		for _, field := range p {
+			spec, _ = spec[field].(map[string]interface{})
+		}
+		for _, key := range []string{"initContainers", "containers"} {
+			containers, _ := spec[key].([]interface{})
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for _, key := range []string{"command", "args"} {
+					args, _ := container[key].([]interface{})
+					for i, a := range args {
+						if arg, ok := a.(string); ok {
+							args[i] = relocateArg(arg, relocate)
+						}
+					}
+				}
+				env, _ := container["env"].([]interface{})
+				for _, e := range env {
+					if v, ok := e.(map[string]interface{}); ok {
+						if value, ok := v["value"].(string); ok {
+							v["value"] = relocateArg(value, relocate)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// relocateArg replaces the namespace the argument or env value arg references e.g. kubeflow,
+// --namespace=kubeflow or http://ml-pipeline.kubeflow:8888 with the namespace relocate returns for it.
+func relocateArg(arg string, relocate func(string) string) string {
+	if ns := relocate(arg); ns != arg {
+		return ns
+	}
+	if i := strings.Index(arg, "="); i >= 0 {
+		if ns := relocate(arg[i+1:]); ns != arg[i+1:] {
+			return arg[:i+1] + ns
+		}
+	}
+	return relocateHostnames(arg, relocate)
+}
+
+// relocateHostnames replaces the namespaces of the service hostnames in s with the namespaces
+// relocate returns for them.
+func relocateHostnames(s string, relocate func(string) string) string {
+	return serviceHostname.ReplaceAllStringFunc(s, func(h string) string {
+		m := serviceHostname.FindStringSubmatch(h)
+		return m[1] + "." + relocate(m[3]) + m[5] + m[7]
+	})
+}
@@ -0,0 +1,212 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func TestKustomize_relocateNamespaces(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			input: `
+kind: Namespace
+metadata:
+  name: istio-system`,
+			expected: `
+kind: Namespace
+metadata:
+  name: kf-istio`,
+		},
+		{
+			input: `
+kind: Deployment
+metadata:
+  name: centraldashboard
+  namespace: kubeflow`,
+			expected: `
+kind: Deployment
+metadata:
+  name: centraldashboard
+  namespace: kf`,
+		},
+		{
+			input: `
+kind: ClusterRoleBinding
+metadata:
+  name: istio-pilot
+roleRef:
+  kind: ClusterRole
+  name: istio-pilot
+subjects:
+- kind: ServiceAccount
+  name: istio-pilot-service-account
+  namespace: istio-system
+- kind: User
+  name: jlewi@acme.com`,
+			expected: `
+kind: ClusterRoleBinding
+metadata:
+  name: istio-pilot
+roleRef:
+  kind: ClusterRole
+  name: istio-pilot
+subjects:
+- kind: ServiceAccount
+  name: istio-pilot-service-account
+  namespace: kf-istio
+- kind: User
+  name: jlewi@acme.com`,
+		},
+		{
+			input: `
+kind: MutatingWebhookConfiguration
+metadata:
+  name: istio-sidecar-injector
+webhooks:
+- name: sidecar-injector.istio.io
+  clientConfig:
+    service:
+      name: istio-sidecar-injector
+      namespace: istio-system`,
+			expected: `
+kind: MutatingWebhookConfiguration
+metadata:
+  name: istio-sidecar-injector
+webhooks:
+- name: sidecar-injector.istio.io
+  clientConfig:
+    service:
+      name: istio-sidecar-injector
+      namespace: kf-istio`,
+		},
+		{
+			input: `
+kind: APIService
+metadata:
+  name: v1alpha1.serving.knative.dev
+spec:
+  service:
+    name: webhook
+    namespace: knative-serving`,
+			expected: `
+kind: APIService
+metadata:
+  name: v1alpha1.serving.knative.dev
+spec:
+  service:
+    name: webhook
+    namespace: kf`,
+		},
+		{
+			input: `
+kind: ConfigMap
+metadata:
+  name: pipeline-config
+  namespace: kubeflow
+data:
+  config.json: '{"host": "minio-service.kubeflow:9000", "docs": "https://www.kubeflow.org"}'
+  pilot: istio-pilot.istio-system.svc.cluster.local`,
+			expected: `
+kind: ConfigMap
+metadata:
+  name: pipeline-config
+  namespace: kf
+data:
+  config.json: '{"host": "minio-service.kf:9000", "docs": "https://www.kubeflow.org"}'
+  pilot: istio-pilot.kf-istio.svc.cluster.local`,
+		},
+		{
+			input: `
+kind: Deployment
+metadata:
+  name: ml-pipeline-ui
+  namespace: kubeflow
+spec:
+  template:
+    spec:
+      containers:
+      - name: ml-pipeline-ui
+        args:
+        - --namespace=kubeflow
+        - --api-server=http://ml-pipeline.kubeflow:8888
+        env:
+        - name: ISTIO_NAMESPACE
+          value: istio-system
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace`,
+			expected: `
+kind: Deployment
+metadata:
+  name: ml-pipeline-ui
+  namespace: kf
+spec:
+  template:
+    spec:
+      containers:
+      - name: ml-pipeline-ui
+        args:
+        - --namespace=kf
+        - --api-server=http://ml-pipeline.kf:8888
+        env:
+        - name: ISTIO_NAMESPACE
+          value: kf-istio
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace`,
+		},
+		{
+			input: `
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: other`,
+			expected: `
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: other`,
+		},
+	}
+
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kf-app",
+				Namespace: "kf",
+			},
+			Spec: kfdefsv3.KfDefSpec{
+				Namespaces: &kfdefsv3.NamespaceLayout{
+					Istio: "kf-istio",
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		actual := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(c.input), &actual); err != nil {
+			t.Fatalf("Could not unmarshal %v; %v", c.input, err)
+		}
+		expected := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(c.expected), &expected); err != nil {
+			t.Fatalf("Could not unmarshal %v; %v", c.expected, err)
+		}
+
+		k.relocateNamespaces(actual)
+
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Got %v; want %v", actual, expected)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"regexp"
+	"strings"
+)
+
+// Labels added to every resource applied by kfctl.
+const (
+	DeploymentLabel = "kfctl.kubeflow.org/deployment"
+	OwnerLabel      = "kfctl.kubeflow.org/owner"
+)
+
+// ResourceConflictError is returned when applying a resource that already exists
+// and isn't owned by the deployment and the adoption policy doesn't allow taking it.
+type ResourceConflictError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Deployment is the deployment owning the existing resource; empty if it isn't owned by kfctl.
+	Deployment string
+}
+
+func (e *ResourceConflictError) Error() string {
+	if e.Deployment != "" {
+		return fmt.Sprintf("%v %v/%v already exists and is owned by deployment %v; set adoptionPolicy to force to take it from that deployment",
+			e.Kind, e.Namespace, e.Name, e.Deployment)
+	}
+	return fmt.Sprintf("%v %v/%v already exists and isn't managed by kfctl; set adoptionPolicy to adopt or force to take ownership of it",
+		e.Kind, e.Namespace, e.Name)
+}
+
+// IsResourceConflict returns true if err is a ResourceConflictError.
+func IsResourceConflict(err error) bool {
+	_, ok := err.(*ResourceConflictError)
+	return ok
+}
+
+var invalidLabelChars = regexp.MustCompile("[^A-Za-z0-9_.-]")
+
+// toLabelValue converts s to a valid label value.
+func toLabelValue(s string) string {
+	v := invalidLabelChars.ReplaceAllString(strings.Replace(s, "@", ".at.", 1), "-")
+	if len(v) > 63 {
+		v = v[:63]
+	}
+	return strings.Trim(v, "_.-")
+}
+
+// ownershipLabels returns the labels identifying resources owned by the deployment.
+func (kustomize *kustomize) ownershipLabels() map[string]string {
+	labels := map[string]string{
+		DeploymentLabel: toLabelValue(kustomize.kfDef.Name),
+	}
+	if kustomize.kfDef.Spec.Email != "" {
+		labels[OwnerLabel] = toLabelValue(kustomize.kfDef.Spec.Email)
+	}
+	return labels
+}
+
+// adoptionPolicy returns the adoption policy of the deployment; defaults to adopt.
+func (kustomize *kustomize) adoptionPolicy() kfdefsv3.AdoptionPolicy {
+	if kustomize.kfDef.Spec.AdoptionPolicy == "" {
+		return kfdefsv3.AdoptionPolicyAdopt
+	}
+	return kustomize.kfDef.Spec.AdoptionPolicy
+}
+
+// checkAdoption returns a ResourceConflictError if the adoption policy doesn't allow taking the
+// existing resource owned by the deployment owner; owner is empty if kfctl doesn't manage it.
+// Only AdoptionPolicyForce takes the resources of another deployment.
+func (kustomize *kustomize) checkAdoption(kind string, namespace string, name string, owner string) error {
+	if owner == toLabelValue(kustomize.kfDef.Name) {
+		return nil
+	}
+	switch policy := kustomize.adoptionPolicy(); {
+	case policy == kfdefsv3.AdoptionPolicyForce:
+		return nil
+	case policy == kfdefsv3.AdoptionPolicyAdopt && owner == "":
+		return nil
+	}
+	return &ResourceConflictError{
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+		Deployment: owner,
+	}
+}
+
+// setOwnershipLabels adds the ownership labels to the metadata of the object o.
+func (kustomize *kustomize) setOwnershipLabels(o map[string]interface{}) {
+	metadata := o["metadata"].(map[string]interface{})
+	labels, ok := metadata["labels"].(map[string]interface{})
+	if !ok {
+		labels = map[string]interface{}{}
+	}
+	for k, v := range kustomize.ownershipLabels() {
+		labels[k] = v
+	}
+	metadata["labels"] = labels
+}
+
+// resolveConflict is called when creating the object o failed because it already exists.
+// It applies the adoption policy if the existing object isn't owned by the deployment.
+func (kustomize *kustomize) resolveConflict(restClient *rest.RESTClient, resource string, namespaced bool,
+	o map[string]interface{}) error {
+	metadata := o["metadata"].(map[string]interface{})
+	name := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	kind := o["kind"].(string)
+
+	// A CRD applied by another deployment in the cluster is left to it.
+	if isCRD(o) && kustomize.kfDef.SharesCRDs() {
+		log.Infof("Using existing %v/%v; the CRDs are shared", kind, name)
+		return nil
+	}
+
+	request := restClient.Get().Resource(resource).Name(name)
+	if namespaced {
+		request = request.Namespace(namespace)
+	}
+	raw, err := request.Do().Raw()
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return err
+	}
+
+	existingMeta, _ := existing["metadata"].(map[string]interface{})
+	existingLabels, _ := existingMeta["labels"].(map[string]interface{})
+	owner, _ := existingLabels[DeploymentLabel].(string)
+
+	if owner == toLabelValue(kustomize.kfDef.Name) {
+		return nil
+	}
+	if err := kustomize.checkAdoption(kind, namespace, name, owner); err != nil {
+		return err
+	}
+
+	switch kustomize.adoptionPolicy() {
+	case kfdefsv3.AdoptionPolicyForce:
+		log.Infof("Replacing %v/%v not owned by the deployment", kind, name)
+		metadata["resourceVersion"] = existingMeta["resourceVersion"]
+		body, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		put := restClient.Put().Resource(resource).Name(name).Body(body)
+		if namespaced {
+			put = put.Namespace(namespace)
+		}
+		return put.Do().Error()
+	default:
+		log.Infof("Adopting existing %v/%v", kind, name)
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": kustomize.ownershipLabels(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		p := restClient.Patch(k8stypes.MergePatchType).Resource(resource).Name(name).Body(patch)
+		if namespaced {
+			p = p.Namespace(namespace)
+		}
+		return p.Do().Error()
+	}
+}
@@ -0,0 +1,134 @@
+package kustomize
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func TestToLabelValue(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			input:    "kf-app",
+			expected: "kf-app",
+		},
+		{
+			input:    "jlewi@acme.com",
+			expected: "jlewi.at.acme.com",
+		},
+		{
+			input:    "-some+user@acme.com",
+			expected: "some-user.at.acme.com",
+		},
+		{
+			input:    "a123456789b123456789c123456789d123456789e123456789f123456789g123456789",
+			expected: "a123456789b123456789c123456789d123456789e123456789f123456789g12",
+		},
+	}
+
+	for _, c := range cases {
+		if actual := toLabelValue(c.input); actual != c.expected {
+			t.Errorf("toLabelValue(%v): got %v; want %v", c.input, actual, c.expected)
+		}
+	}
+}
+
+func TestKustomize_setOwnershipLabels(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kf-app",
+			},
+			Spec: kfdefsv3.KfDefSpec{
+				Email: "jlewi@acme.com",
+			},
+		},
+	}
+
+	o := map[string]interface{}{
+		"kind": "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": "some-config",
+			"labels": map[string]interface{}{
+				"app": "some-app",
+			},
+		},
+	}
+
+	k.setOwnershipLabels(o)
+
+	expected := map[string]interface{}{
+		"app":           "some-app",
+		DeploymentLabel: "kf-app",
+		OwnerLabel:      "jlewi.at.acme.com",
+	}
+
+	actual := o["metadata"].(map[string]interface{})["labels"]
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Got labels %v; want %v", actual, expected)
+	}
+
+	if k.adoptionPolicy() != kfdefsv3.AdoptionPolicyAdopt {
+		t.Errorf("Got adoption policy %v; want %v", k.adoptionPolicy(), kfdefsv3.AdoptionPolicyAdopt)
+	}
+}
+
+func TestIsResourceConflict(t *testing.T) {
+	var err error = &ResourceConflictError{
+		Kind:       "ConfigMap",
+		Namespace:  "kubeflow",
+		Name:       "some-config",
+		Deployment: "other-app",
+	}
+
+	if !IsResourceConflict(err) {
+		t.Errorf("IsResourceConflict should be true for %v", err)
+	}
+
+	if IsResourceConflict(nil) {
+		t.Errorf("IsResourceConflict should be false for nil")
+	}
+}
+
+func TestKustomize_checkAdoption(t *testing.T) {
+	type testCase struct {
+		policy   kfdefsv3.AdoptionPolicy
+		owner    string
+		conflict bool
+	}
+
+	cases := []testCase{
+		{policy: "", owner: "", conflict: false},
+		{policy: "", owner: "kf-app", conflict: false},
+		// Resources of another deployment are only taken with force.
+		{policy: "", owner: "other-app", conflict: true},
+		{policy: kfdefsv3.AdoptionPolicyAdopt, owner: "other-app", conflict: true},
+		{policy: kfdefsv3.AdoptionPolicyForce, owner: "other-app", conflict: false},
+		{policy: kfdefsv3.AdoptionPolicyFail, owner: "", conflict: true},
+		{policy: kfdefsv3.AdoptionPolicyFail, owner: "kf-app", conflict: false},
+	}
+
+	for _, c := range cases {
+		k := &kustomize{
+			kfDef: &kfdefsv3.KfDef{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "kf-app",
+				},
+				Spec: kfdefsv3.KfDefSpec{
+					AdoptionPolicy: c.policy,
+				},
+			},
+		}
+		err := k.checkAdoption("ConfigMap", "kubeflow", "some-config", c.owner)
+		if IsResourceConflict(err) != c.conflict {
+			t.Errorf("checkAdoption with policy %q of a resource owned by %q: got %v; want conflict %v",
+				c.policy, c.owner, err, c.conflict)
+		}
+	}
+}
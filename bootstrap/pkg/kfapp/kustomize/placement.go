@@ -0,0 +1,137 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"github.com/ghodss/yaml"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// placeWorkloads adds the node selectors and tolerations of the placements of an application to
+// the pod templates in its manifest. The manifest is returned unchanged if there are none.
+func (kustomize *kustomize) placeWorkloads(appName string, manifest []byte) ([]byte, error) {
+	placements := kustomize.kfDef.PlacementsFor(appName)
+	if len(placements) == 0 {
+		return manifest, nil
+	}
+
+	splitter := regexp.MustCompile(kftypesv3.YamlSeparator)
+	objects := []string{}
+	for _, object := range splitter.Split(string(manifest), -1) {
+		var o map[string]interface{}
+		if err := yaml.Unmarshal([]byte(object), &o); err != nil {
+			return nil, err
+		}
+		if o == nil {
+			continue
+		}
+		for _, p := range placements {
+			if err := placeObject(o, p); err != nil {
+				return nil, err
+			}
+		}
+		b, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, string(b))
+	}
+	return []byte(strings.Join(objects, "---\n")), nil
+}
+
+// placeObject applies the placement p to the pod specs of the object o.
+// DaemonSets run a pod on every node so they only get the tolerations.
+func placeObject(o map[string]interface{}, p kfdefsv3.WorkloadPlacement) error {
+	kind, _ := o["kind"].(string)
+	tolerations := []interface{}{}
+	for _, t := range p.Tolerations {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		tolerations = append(tolerations, m)
+	}
+
+	for _, spec := range podSpecs(o) {
+		if kind != "DaemonSet" && len(p.NodeSelector) > 0 {
+			selector, _ := spec["nodeSelector"].(map[string]interface{})
+			if selector == nil {
+				selector = map[string]interface{}{}
+			}
+			for k, v := range p.NodeSelector {
+				selector[k] = v
+			}
+			spec["nodeSelector"] = selector
+		}
+
+		existing, _ := spec["tolerations"].([]interface{})
+		for _, t := range tolerations {
+			found := false
+			for _, e := range existing {
+				found = found || reflect.DeepEqual(e, t)
+			}
+			if !found {
+				existing = append(existing, t)
+			}
+		}
+		if len(existing) > 0 {
+			spec["tolerations"] = existing
+		}
+	}
+	return nil
+}
+
+// podSpecs returns the pod specs in the object o; the spec of a pod, the pod template of a
+// workload or the pod templates of the replicas of a training job e.g. a TFJob.
+func podSpecs(o map[string]interface{}) []map[string]interface{} {
+	spec, _ := o["spec"].(map[string]interface{})
+	if spec == nil {
+		return nil
+	}
+	templateSpec := func(m map[string]interface{}) map[string]interface{} {
+		template, _ := m["template"].(map[string]interface{})
+		podSpec, _ := template["spec"].(map[string]interface{})
+		return podSpec
+	}
+
+	specs := []map[string]interface{}{}
+	add := func(s map[string]interface{}) {
+		if s != nil {
+			specs = append(specs, s)
+		}
+	}
+
+	kind, _ := o["kind"].(string)
+	switch kind {
+	case "Pod":
+		add(spec)
+	case "Deployment", "StatefulSet", "ReplicaSet", "ReplicationController", "DaemonSet", "Job":
+		add(templateSpec(spec))
+	case "CronJob":
+		jobTemplate, _ := spec["jobTemplate"].(map[string]interface{})
+		jobSpec, _ := jobTemplate["spec"].(map[string]interface{})
+		add(templateSpec(jobSpec))
+	default:
+		// Training jobs e.g. TFJob and PyTorchJob have a pod template per replica type in
+		// spec.<kind>ReplicaSpecs.
+		for k, v := range spec {
+			replicaSpecs, ok := v.(map[string]interface{})
+			if !ok || !strings.HasSuffix(k, "ReplicaSpecs") {
+				continue
+			}
+			for _, r := range replicaSpecs {
+				if replica, ok := r.(map[string]interface{}); ok {
+					add(templateSpec(replica))
+				}
+			}
+		}
+	}
+	return specs
+}
@@ -0,0 +1,138 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestKustomize_placeWorkloads(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			Spec: kfdefsv3.KfDefSpec{
+				Placements: []kfdefsv3.WorkloadPlacement{
+					{
+						Name:         "preemptible",
+						Applications: []string{"tf-job-operator"},
+						NodeSelector: map[string]string{"cloud.google.com/gke-preemptible": "true"},
+						Tolerations: []v1.Toleration{
+							{
+								Key:      "cloud.google.com/gke-preemptible",
+								Operator: v1.TolerationOpEqual,
+								Value:    "true",
+								Effect:   v1.TaintEffectNoSchedule,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	manifest := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: tf-job-operator
+spec:
+  template:
+    spec:
+      nodeSelector:
+        disktype: ssd
+      containers:
+      - name: tf-job-operator
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    spec:
+      tolerations:
+      - key: cloud.google.com/gke-preemptible
+        operator: Equal
+        value: "true"
+        effect: NoSchedule
+---
+apiVersion: kubeflow.org/v1
+kind: TFJob
+metadata:
+  name: mnist
+spec:
+  tfReplicaSpecs:
+    Worker:
+      template:
+        spec:
+          containers:
+          - name: tensorflow
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+`
+
+	// Applications without placements are unchanged.
+	actual, err := k.placeWorkloads("jupyter", []byte(manifest))
+	if err != nil || string(actual) != manifest {
+		t.Errorf("placeWorkloads(jupyter) changed the manifest; got %v, %v", string(actual), err)
+	}
+
+	actual, err = k.placeWorkloads("tf-job-operator", []byte(manifest))
+	if err != nil {
+		t.Fatalf("placeWorkloads(tf-job-operator) failed; %v", err)
+	}
+
+	toleration := map[string]interface{}{
+		"key":      "cloud.google.com/gke-preemptible",
+		"operator": "Equal",
+		"value":    "true",
+		"effect":   "NoSchedule",
+	}
+	expected := []map[string]interface{}{
+		{
+			"nodeSelector": map[string]interface{}{"disktype": "ssd", "cloud.google.com/gke-preemptible": "true"},
+			"tolerations":  []interface{}{toleration},
+		},
+		{
+			// The DaemonSet already tolerates the taint and isn't restricted to the nodes.
+			"tolerations": []interface{}{toleration},
+		},
+		{
+			"nodeSelector": map[string]interface{}{"cloud.google.com/gke-preemptible": "true"},
+			"tolerations":  []interface{}{toleration},
+		},
+		nil,
+	}
+
+	objects := regexp.MustCompile(`(?m)^---[ \t]*$`).Split(string(actual), -1)
+	if len(objects) != len(expected) {
+		t.Fatalf("Got %v objects; want %v:\n%v", len(objects), len(expected), string(actual))
+	}
+	for i, object := range objects {
+		var o map[string]interface{}
+		if err := yaml.Unmarshal([]byte(object), &o); err != nil {
+			t.Fatalf("Could not parse object %v; %v", i, err)
+		}
+		specs := podSpecs(o)
+		if expected[i] == nil {
+			if len(specs) != 0 {
+				t.Errorf("Object %v: got pod specs %v; want none", i, specs)
+			}
+			continue
+		}
+		if len(specs) != 1 {
+			t.Fatalf("Object %v: got %v pod specs; want 1", i, len(specs))
+		}
+		for _, field := range []string{"nodeSelector", "tolerations"} {
+			if !reflect.DeepEqual(specs[0][field], expected[i][field]) {
+				t.Errorf("Object %v: got %v %v; want %v", i, field, specs[0][field], expected[i][field])
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	"strings"
+)
+
+const (
+	// kubeflowGateway is the istio Gateway the virtual services of Kubeflow are bound to.
+	kubeflowGateway = "kubeflow-gateway"
+	// knativeReleaseLabel is set on the deployments of knative serving to its release e.g. v0.8.0.
+	knativeReleaseLabel = "serving.knative.dev/release"
+)
+
+// platformComponent is a component of the platform Kubeflow runs on which may already be
+// installed in the cluster.
+type platformComponent struct {
+	name string
+	// applications install the bundled component.
+	applications []string
+	// manifestsNamespace is the namespace the manifests install the component to.
+	manifestsNamespace string
+	// deployment is the Deployment identifying an installation of the component.
+	deployment string
+	// version returns the version of the component the Deployment belongs to.
+	version func(d *appsv1.Deployment) (*version.Version, error)
+}
+
+var platformComponents = []platformComponent{
+	{
+		name:               "Istio",
+		applications:       []string{"istio-crds", istioInstallApplication},
+		manifestsNamespace: kfdefsv3.ManifestsIstioNamespace,
+		deployment:         "istio-pilot",
+		version:            istioVersion,
+	},
+	{
+		name:               "Knative",
+		applications:       []string{"knative-crds", "knative-install"},
+		manifestsNamespace: kfdefsv3.ManifestsKnativeNamespace,
+		deployment:         "controller",
+		version:            knativeVersion,
+	},
+}
+
+// platformCompatibility is the versions of the platform components supported by each Kubeflow
+// release. Releases which aren't listed e.g. master support defaultPlatformCompatibility.
+var platformCompatibility = map[string]map[string]versionRange{
+	"0.6": {"Istio": {min: "1.1", max: "1.1"}, "Knative": {min: "0.5", max: "0.6"}},
+	"0.7": {"Istio": {min: "1.1", max: "1.3"}, "Knative": {min: "0.8", max: "0.8"}},
+}
+
+var defaultPlatformCompatibility = map[string]versionRange{
+	"Istio":   {min: "1.1"},
+	"Knative": {min: "0.8"},
+}
+
+// platformRange returns the versions of the named component supported by Kubeflow kfVersion.
+func platformRange(kfVersion string, component string) versionRange {
+	if v, err := version.ParseGeneric(kfVersion); err == nil {
+		if r, ok := platformCompatibility[fmt.Sprintf("%v.%v", v.Major(), v.Minor())]; ok {
+			return r[component]
+		}
+	}
+	return defaultPlatformCompatibility[component]
+}
+
+// istioVersion returns the version of the istio image run by the deployment d.
+func istioVersion(d *appsv1.Deployment) (*version.Version, error) {
+	for _, c := range d.Spec.Template.Spec.Containers {
+		if m := istioImage.FindStringSubmatch(c.Image); m != nil {
+			return version.ParseGeneric(m[4])
+		}
+	}
+	return nil, fmt.Errorf("deployment %v/%v doesn't run an istio image", d.Namespace, d.Name)
+}
+
+// knativeVersion returns the knative serving release the deployment d is labeled with.
+func knativeVersion(d *appsv1.Deployment) (*version.Version, error) {
+	release, ok := d.Labels[knativeReleaseLabel]
+	if !ok {
+		return nil, fmt.Errorf("deployment %v/%v doesn't have label %v", d.Namespace, d.Name, knativeReleaseLabel)
+	}
+	return version.ParseGeneric(release)
+}
+
+// reuseComponent decides whether to reuse the installation of c in namespace; installed is nil if
+// c isn't installed. It returns why the bundled applications are skipped or "" if they are applied.
+// An installed version which Kubeflow doesn't support is an error since applying the bundled
+// component would replace the installation other workloads of the cluster depend on.
+func reuseComponent(c platformComponent, namespace string, installed *version.Version, mode kfdefsv3.ExistingPlatformMode, kfVersion string) (string, error) {
+	if installed == nil {
+		if mode == kfdefsv3.ExistingPlatformRequire {
+			return "", fmt.Errorf("%v isn't installed in namespace %v", c.name, namespace)
+		}
+		return "", nil
+	}
+	if r := platformRange(kfVersion, c.name); !r.contains(installed) {
+		return "", fmt.Errorf("%v %v is installed in namespace %v but Kubeflow %v requires %v %v; upgrade it or deploy %v to another namespace",
+			c.name, installed, namespace, kfVersion, c.name, r, c.name)
+	}
+	return fmt.Sprintf("reusing %v %v installed in namespace %v", c.name, installed, namespace), nil
+}
+
+// installedVersion returns the version of c installed in namespace or nil if it isn't installed.
+// An installation applied by the deployment itself isn't reused so it is upgraded with the manifests.
+func (kustomize *kustomize) installedVersion(apps typedappsv1.AppsV1Interface, c platformComponent, namespace string) (*version.Version, error) {
+	d, err := apps.Deployments(namespace).Get(c.deployment, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.Labels[DeploymentLabel] == toLabelValue(kustomize.kfDef.Name) {
+		return nil, nil
+	}
+	return c.version(d)
+}
+
+// reusedApplications detects the platform components installed in the cluster if the KfDef sets
+// ExistingPlatform. It returns the bundled applications which aren't applied since the installed
+// component is reused mapped to the reason. It returns an error if an installed component isn't
+// supported or a required component isn't installed.
+func (kustomize *kustomize) reusedApplications(apps typedappsv1.AppsV1Interface) (map[string]string, error) {
+	existing := kustomize.kfDef.Spec.ExistingPlatform
+	if existing == nil {
+		return nil, nil
+	}
+	mode := existing.Mode
+	if mode == "" {
+		mode = kfdefsv3.ExistingPlatformDetect
+	}
+
+	reused := map[string]string{}
+	problems := []string{}
+	for _, c := range platformComponents {
+		namespace := kustomize.kfDef.RelocateNamespace(c.manifestsNamespace)
+		installed, err := kustomize.installedVersion(apps, c, namespace)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("couldn't detect %v in namespace %v: %v", c.name, namespace, err))
+			continue
+		}
+		reason, err := reuseComponent(c, namespace, installed, mode, kustomize.kfDef.Spec.Version)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if reason == "" {
+			continue
+		}
+		log.Infof("%v; not applying %v", reason, strings.Join(c.applications, ", "))
+		for _, a := range c.applications {
+			reused[a] = reason
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%v", strings.Join(problems, "; "))
+	}
+	return reused, nil
+}
+
+// configureGateway binds the Kubeflow gateway in the manifest to the pods of the installed ingress
+// gateway selected by ExistingPlatform.IngressGatewaySelector. The manifest is returned unchanged
+// if no selector is set.
+func (kustomize *kustomize) configureGateway(manifest []byte) ([]byte, error) {
+	existing := kustomize.kfDef.Spec.ExistingPlatform
+	if existing == nil || len(existing.IngressGatewaySelector) == 0 {
+		return manifest, nil
+	}
+	objects, err := decodeObjects(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]interface{}{}
+	for k, v := range existing.IngressGatewaySelector {
+		selector[k] = v
+	}
+	encoded := []string{}
+	for _, o := range objects {
+		metadata, _ := o["metadata"].(map[string]interface{})
+		if o["kind"] == "Gateway" && metadata["name"] == kubeflowGateway {
+			spec, _ := o["spec"].(map[string]interface{})
+			if spec == nil {
+				spec = map[string]interface{}{}
+				o["spec"] = spec
+			}
+			spec["selector"] = selector
+		}
+		b, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, string(b))
+	}
+	return []byte(strings.Join(encoded, "---\n")), nil
+}
@@ -0,0 +1,151 @@
+package kustomize
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlatformVersions(t *testing.T) {
+	pilot := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "istio-pilot", Namespace: "istio-system"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{Name: "discovery", Image: "gcr.io/gke-release/istio/pilot:1.1.13-gke.0"},
+						{Name: "istio-proxy", Image: "gcr.io/gke-release/istio/proxyv2:1.1.13-gke.0"},
+					},
+				},
+			},
+		},
+	}
+	v, err := istioVersion(pilot)
+	if err != nil || v.Major() != 1 || v.Minor() != 1 {
+		t.Errorf("istioVersion: got %v, %v; want 1.1", v, err)
+	}
+	pilot.Spec.Template.Spec.Containers = []v1.Container{{Name: "discovery", Image: "example.com/pilot:1.1"}}
+	if _, err := istioVersion(pilot); err == nil {
+		t.Errorf("istioVersion of a deployment without an istio image: want an error")
+	}
+
+	controller := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "controller",
+			Namespace: "knative-serving",
+			Labels:    map[string]string{knativeReleaseLabel: "v0.8.0"},
+		},
+	}
+	v, err = knativeVersion(controller)
+	if err != nil || v.Major() != 0 || v.Minor() != 8 {
+		t.Errorf("knativeVersion: got %v, %v; want 0.8", v, err)
+	}
+	controller.Labels = nil
+	if _, err := knativeVersion(controller); err == nil {
+		t.Errorf("knativeVersion of a deployment without the release label: want an error")
+	}
+}
+
+func TestReuseComponent(t *testing.T) {
+	type testCase struct {
+		name      string
+		installed string
+		mode      kfdefsv3.ExistingPlatformMode
+		kfVersion string
+		reused    bool
+		err       string
+	}
+
+	cases := []testCase{
+		{name: "missing is installed", mode: kfdefsv3.ExistingPlatformDetect, kfVersion: "v0.7.0"},
+		{name: "missing is required", mode: kfdefsv3.ExistingPlatformRequire, kfVersion: "v0.7.0",
+			err: "Istio isn't installed in namespace istio-system"},
+		{name: "compatible is reused", installed: "1.3.1", mode: kfdefsv3.ExistingPlatformDetect, kfVersion: "v0.7.0",
+			reused: true},
+		{name: "newer than the release supports", installed: "1.3.1", mode: kfdefsv3.ExistingPlatformDetect, kfVersion: "v0.6.2",
+			err: "Istio 1.3.1 is installed in namespace istio-system but Kubeflow v0.6.2 requires Istio"},
+		{name: "older than master supports", installed: "1.0.6", mode: kfdefsv3.ExistingPlatformRequire, kfVersion: "master",
+			err: "Istio 1.0.6 is installed"},
+		{name: "master supports newer", installed: "1.4.0", mode: kfdefsv3.ExistingPlatformDetect, kfVersion: "master",
+			reused: true},
+	}
+
+	istio := platformComponents[0]
+	for _, c := range cases {
+		var installed *version.Version
+		if c.installed != "" {
+			installed = version.MustParseGeneric(c.installed)
+		}
+		reason, err := reuseComponent(istio, "istio-system", installed, c.mode, c.kfVersion)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%v: got error %v; want %v", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", c.name, err)
+			continue
+		}
+		if reused := reason != ""; reused != c.reused {
+			t.Errorf("%v: got reused %v (%v); want %v", c.name, reused, reason, c.reused)
+		}
+	}
+}
+
+func TestKustomize_configureGateway(t *testing.T) {
+	manifest := []byte(`apiVersion: networking.istio.io/v1alpha3
+kind: Gateway
+metadata:
+  name: kubeflow-gateway
+  namespace: kubeflow
+spec:
+  selector:
+    istio: ingressgateway
+  servers:
+  - hosts:
+    - '*'
+    port:
+      name: http
+      number: 80
+      protocol: HTTP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: centraldashboard
+  namespace: kubeflow
+`)
+
+	k := &kustomize{kfDef: &kfdefsv3.KfDef{}}
+	if got, err := k.configureGateway(manifest); err != nil || string(got) != string(manifest) {
+		t.Errorf("configureGateway without ExistingPlatform changed the manifest: %v, %v", string(got), err)
+	}
+
+	selector := map[string]string{"app": "istio-ingressgateway", "istio": "shared-ingress"}
+	k.kfDef.Spec.ExistingPlatform = &kfdefsv3.ExistingPlatform{IngressGatewaySelector: selector}
+	got, err := k.configureGateway(manifest)
+	if err != nil {
+		t.Fatalf("configureGateway: %v", err)
+	}
+	objects, err := decodeObjects(got)
+	if err != nil || len(objects) != 2 {
+		t.Fatalf("configureGateway: got %v objects, %v; want 2", len(objects), err)
+	}
+	spec := objects[0]["spec"].(map[string]interface{})
+	want := map[string]interface{}{"app": "istio-ingressgateway", "istio": "shared-ingress"}
+	if !reflect.DeepEqual(spec["selector"], want) {
+		t.Errorf("Gateway selector: got %v; want %v", spec["selector"], want)
+	}
+	if spec["servers"] == nil {
+		t.Errorf("Gateway servers were dropped")
+	}
+	if _, ok := objects[1]["spec"]; ok {
+		t.Errorf("Service was changed: %v", objects[1])
+	}
+}
@@ -0,0 +1,100 @@
+package kustomize
+
+import (
+	"fmt"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// namespaceLimits returns the ResourceQuota and LimitRange of the Kubeflow namespace set in the
+// KfDef; either is nil if it isn't set. They are named after the deployment.
+func (kustomize *kustomize) namespaceLimits() (*v1.ResourceQuota, *v1.LimitRange) {
+	meta := metav1.ObjectMeta{
+		Name:      kustomize.kfDef.Name,
+		Namespace: kustomize.kfDef.Namespace,
+		Labels:    kustomize.ownershipLabels(),
+	}
+
+	var quota *v1.ResourceQuota
+	if kustomize.kfDef.Spec.ResourceQuota != nil {
+		quota = &v1.ResourceQuota{
+			ObjectMeta: meta,
+			Spec:       *kustomize.kfDef.Spec.ResourceQuota.DeepCopy(),
+		}
+	}
+
+	var limits *v1.LimitRange
+	if kustomize.kfDef.Spec.LimitRange != nil {
+		limits = &v1.LimitRange{
+			ObjectMeta: *meta.DeepCopy(),
+			Spec:       *kustomize.kfDef.Spec.LimitRange.DeepCopy(),
+		}
+	}
+	return quota, limits
+}
+
+// applyNamespaceLimits creates or updates the ResourceQuota and LimitRange of the Kubeflow namespace.
+// If they were removed from the KfDef they are deleted as long as the deployment owns them.
+// They are applied before the applications so the defaults of the LimitRange apply to their pods.
+func (kustomize *kustomize) applyNamespaceLimits(client corev1.CoreV1Interface) error {
+	quota, limits := kustomize.namespaceLimits()
+	name := kustomize.kfDef.Name
+	quotas := client.ResourceQuotas(kustomize.kfDef.Namespace)
+	limitRanges := client.LimitRanges(kustomize.kfDef.Namespace)
+
+	existingQuota, err := quotas.Get(name, metav1.GetOptions{})
+	switch {
+	case err != nil && !k8serrors.IsNotFound(err):
+		return namespaceLimitsError("resourcequota", name, err)
+	case err != nil && quota != nil:
+		log.Infof("Creating resourcequota %v", name)
+		_, err = quotas.Create(quota)
+	case err == nil && quota != nil:
+		log.Infof("Updating resourcequota %v", name)
+		existingQuota.Labels = quota.Labels
+		existingQuota.Spec = quota.Spec
+		_, err = quotas.Update(existingQuota)
+	case err == nil && existingQuota.Labels[DeploymentLabel] == toLabelValue(name):
+		log.Infof("Deleting resourcequota %v", name)
+		err = quotas.Delete(name, &metav1.DeleteOptions{})
+	default:
+		err = nil
+	}
+	if err != nil {
+		return namespaceLimitsError("resourcequota", name, err)
+	}
+
+	existingLimits, err := limitRanges.Get(name, metav1.GetOptions{})
+	switch {
+	case err != nil && !k8serrors.IsNotFound(err):
+		return namespaceLimitsError("limitrange", name, err)
+	case err != nil && limits != nil:
+		log.Infof("Creating limitrange %v", name)
+		_, err = limitRanges.Create(limits)
+	case err == nil && limits != nil:
+		log.Infof("Updating limitrange %v", name)
+		existingLimits.Labels = limits.Labels
+		existingLimits.Spec = limits.Spec
+		_, err = limitRanges.Update(existingLimits)
+	case err == nil && existingLimits.Labels[DeploymentLabel] == toLabelValue(name):
+		log.Infof("Deleting limitrange %v", name)
+		err = limitRanges.Delete(name, &metav1.DeleteOptions{})
+	default:
+		err = nil
+	}
+	if err != nil {
+		return namespaceLimitsError("limitrange", name, err)
+	}
+	return nil
+}
+
+func namespaceLimitsError(kind string, name string, err error) error {
+	return &kfapisv3.KfError{
+		Code:    int(kfapisv3.INTERNAL_ERROR),
+		Message: fmt.Sprintf("couldn't apply %v %v Error: %v", kind, name, err),
+	}
+}
@@ -0,0 +1,61 @@
+package kustomize
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func TestKustomize_namespaceLimits(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kf-app",
+				Namespace: "kubeflow",
+			},
+		},
+	}
+
+	if quota, limits := k.namespaceLimits(); quota != nil || limits != nil {
+		t.Errorf("Got quota %v and limits %v; want nil when they aren't set", quota, limits)
+	}
+
+	k.kfDef.Spec.ResourceQuota = &v1.ResourceQuotaSpec{
+		Hard: v1.ResourceList{
+			v1.ResourceRequestsCPU:    resource.MustParse("64"),
+			"requests.nvidia.com/gpu": resource.MustParse("4"),
+		},
+	}
+	k.kfDef.Spec.LimitRange = &v1.LimitRangeSpec{
+		Limits: []v1.LimitRangeItem{
+			{
+				Type:           v1.LimitTypeContainer,
+				DefaultRequest: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+		},
+	}
+
+	quota, limits := k.namespaceLimits()
+	expectedMeta := metav1.ObjectMeta{
+		Name:      "kf-app",
+		Namespace: "kubeflow",
+		Labels:    map[string]string{DeploymentLabel: "kf-app"},
+	}
+	if quota == nil || !reflect.DeepEqual(quota.ObjectMeta, expectedMeta) ||
+		!reflect.DeepEqual(quota.Spec, *k.kfDef.Spec.ResourceQuota) {
+		t.Errorf("Got quota %v; want the quota of the KfDef in %v", quota, expectedMeta)
+	}
+	if limits == nil || !reflect.DeepEqual(limits.ObjectMeta, expectedMeta) ||
+		!reflect.DeepEqual(limits.Spec, *k.kfDef.Spec.LimitRange) {
+		t.Errorf("Got limits %v; want the limit range of the KfDef in %v", limits, expectedMeta)
+	}
+
+	// The objects don't share state with the KfDef.
+	quota.Labels["extra"] = "true"
+	if _, ok := limits.Labels["extra"]; ok {
+		t.Errorf("The quota and the limit range share labels")
+	}
+}
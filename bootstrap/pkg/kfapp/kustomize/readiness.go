@@ -0,0 +1,212 @@
+package kustomize
+
+import (
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultReadinessTimeout bounds how long to wait for an application without a readiness timeout.
+	defaultReadinessTimeout = 10 * time.Minute
+	// readinessPollInterval is the time between two rounds of readiness checks.
+	readinessPollInterval = 5 * time.Second
+	// readinessProbeTimeout bounds a single request to the URL of a readiness check.
+	readinessProbeTimeout = 10 * time.Second
+)
+
+// jobFailedError is returned by a readiness check of a Job which failed; waiting longer won't make it ready.
+type jobFailedError struct {
+	Namespace string
+	Name      string
+	Message   string
+}
+
+func (e *jobFailedError) Error() string {
+	return fmt.Sprintf("job %v/%v failed: %v", e.Namespace, e.Name, e.Message)
+}
+
+// readinessProbe returns nil if the check passes and an error explaining why it doesn't otherwise.
+type readinessProbe func(c kfdefsv3.ReadinessCheck) error
+
+// readinessTimeout returns how long to wait for the application to be ready.
+func readinessTimeout(app kfdefsv3.Application) time.Duration {
+	if app.Readiness == nil || app.Readiness.TimeoutSeconds == 0 {
+		return defaultReadinessTimeout
+	}
+	return time.Duration(app.Readiness.TimeoutSeconds) * time.Second
+}
+
+// readinessChecks returns the readiness checks of the application. Applications which don't define
+// any checks are ready once every Deployment in their manifest is available and every Job completed.
+// Checks without a namespace use the namespace of the KfDef.
+func (kustomize *kustomize) readinessChecks(app kfdefsv3.Application, manifest []byte) ([]kfdefsv3.ReadinessCheck, error) {
+	checks := []kfdefsv3.ReadinessCheck{}
+	if app.Readiness != nil && len(app.Readiness.Checks) > 0 {
+		checks = append(checks, app.Readiness.Checks...)
+	} else {
+		objects, err := decodeObjects(manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			kustomize.relocateNamespaces(o)
+			metadata, _ := o["metadata"].(map[string]interface{})
+			name, _ := metadata["name"].(string)
+			namespace, _ := metadata["namespace"].(string)
+			switch o["kind"] {
+			case "Deployment":
+				checks = append(checks, kfdefsv3.ReadinessCheck{Deployment: name, Namespace: namespace})
+			case "Job":
+				checks = append(checks, kfdefsv3.ReadinessCheck{Job: name, Namespace: namespace})
+			}
+		}
+	}
+	for i := range checks {
+		if checks[i].URL == "" && checks[i].Namespace == "" {
+			checks[i].Namespace = kustomize.kfDef.Namespace
+		}
+	}
+	return checks, nil
+}
+
+// describeCheck returns a description of the check for use in messages.
+func describeCheck(c kfdefsv3.ReadinessCheck) string {
+	switch {
+	case c.Deployment != "":
+		return fmt.Sprintf("deployment %v/%v", c.Namespace, c.Deployment)
+	case c.Job != "":
+		return fmt.Sprintf("job %v/%v", c.Namespace, c.Job)
+	default:
+		return "url " + c.URL
+	}
+}
+
+// deploymentAvailable returns nil if the latest revision of the deployment is rolled out and all
+// its replicas are available.
+func deploymentAvailable(d *appsv1.Deployment) error {
+	if d.Status.ObservedGeneration < d.Generation {
+		return fmt.Errorf("the latest spec hasn't been observed yet")
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	if d.Status.UpdatedReplicas < replicas {
+		return fmt.Errorf("%v of %v replicas are updated", d.Status.UpdatedReplicas, replicas)
+	}
+	if d.Status.AvailableReplicas < replicas {
+		return fmt.Errorf("%v of %v replicas are available", d.Status.AvailableReplicas, replicas)
+	}
+	return nil
+}
+
+// jobComplete returns nil if the job completed and a jobFailedError if it failed.
+func jobComplete(j *batchv1.Job) error {
+	for _, c := range j.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return nil
+		case batchv1.JobFailed:
+			return &jobFailedError{Namespace: j.Namespace, Name: j.Name, Message: c.Message}
+		}
+	}
+	return fmt.Errorf("%v pods succeeded; %v active", j.Status.Succeeded, j.Status.Active)
+}
+
+// newReadinessProbe returns a probe checking the Deployments and Jobs with clientset and sending
+// a GET to the URLs with client.
+func newReadinessProbe(clientset kubernetes.Interface, client *http.Client) readinessProbe {
+	return func(c kfdefsv3.ReadinessCheck) error {
+		switch {
+		case c.Deployment != "":
+			d, err := clientset.AppsV1().Deployments(c.Namespace).Get(c.Deployment, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			return deploymentAvailable(d)
+		case c.Job != "":
+			j, err := clientset.BatchV1().Jobs(c.Namespace).Get(c.Job, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			return jobComplete(j)
+		default:
+			resp, err := client.Get(c.URL)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return fmt.Errorf("GET returned %v", resp.Status)
+			}
+			return nil
+		}
+	}
+}
+
+// waitForChecks runs the checks until they all pass, a Job fails or the deadline passes.
+func waitForChecks(checks []kfdefsv3.ReadinessCheck, probe readinessProbe, deadline time.Time, interval time.Duration) error {
+	pending := checks
+	for {
+		notReady := []kfdefsv3.ReadinessCheck{}
+		reasons := []string{}
+		for _, c := range pending {
+			err := probe(c)
+			if err == nil {
+				continue
+			}
+			if _, ok := err.(*jobFailedError); ok {
+				return err
+			}
+			notReady = append(notReady, c)
+			reasons = append(reasons, fmt.Sprintf("%v: %v", describeCheck(c), err))
+		}
+		if len(notReady) == 0 {
+			return nil
+		}
+		if !time.Now().Add(interval).Before(deadline) {
+			return fmt.Errorf("not ready after the readiness timeout; %v", strings.Join(reasons, "; "))
+		}
+		log.Infof("Waiting for %v readiness checks; %v", len(notReady), strings.Join(reasons, "; "))
+		pending = notReady
+		time.Sleep(interval)
+	}
+}
+
+// waitForApplications waits for each of the applied applications to be ready and records the
+// outcome in its status. The timeouts of the applications all start when the wait starts. The
+// names of the applications which aren't ready are returned.
+func (kustomize *kustomize) waitForApplications(apps []kfdefsv3.Application, manifests [][]byte, probe readinessProbe) []string {
+	start := time.Now()
+	notReady := []string{}
+	for i, app := range apps {
+		if manifests[i] == nil {
+			continue
+		}
+		checks, err := kustomize.readinessChecks(app, manifests[i])
+		if err == nil {
+			log.Infof("Waiting for application %v to be ready", app.Name)
+			err = waitForChecks(checks, probe, start.Add(readinessTimeout(app)), readinessPollInterval)
+		}
+		if err != nil {
+			log.Errorf("Application %v isn't ready; %v", app.Name, err)
+			kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationNotReady, err.Error())
+			notReady = append(notReady, app.Name)
+			continue
+		}
+		kustomize.setApplicationStatus(app.Name, kfdefsv3.ApplicationReady, "")
+	}
+	return notReady
+}
@@ -0,0 +1,157 @@
+package kustomize
+
+import (
+	"fmt"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const readinessManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: jupyter-web-app
+  namespace: kubeflow
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: spartakus-init
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: jupyter-web-app
+  namespace: kubeflow`
+
+func TestKustomize_readinessChecks(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{Name: "kf-app", Namespace: "kf"},
+		},
+	}
+
+	checks, err := k.readinessChecks(kfdefsv3.Application{Name: "jupyter"}, []byte(readinessManifest))
+	if err != nil {
+		t.Fatalf("readinessChecks failed; %v", err)
+	}
+	expected := []kfdefsv3.ReadinessCheck{
+		{Deployment: "jupyter-web-app", Namespace: "kf"},
+		{Job: "spartakus-init", Namespace: "kf"},
+	}
+	if !reflect.DeepEqual(checks, expected) {
+		t.Errorf("readinessChecks of the manifest: got %+v; want %+v", checks, expected)
+	}
+
+	app := kfdefsv3.Application{
+		Name: "jupyter",
+		Readiness: &kfdefsv3.Readiness{Checks: []kfdefsv3.ReadinessCheck{
+			{Deployment: "jupyter-web-app"},
+			{URL: "http://jupyter-web-app.kf.svc.cluster.local/healthz"},
+		}},
+	}
+	checks, err = k.readinessChecks(app, []byte(readinessManifest))
+	if err != nil {
+		t.Fatalf("readinessChecks failed; %v", err)
+	}
+	expected = []kfdefsv3.ReadinessCheck{
+		{Deployment: "jupyter-web-app", Namespace: "kf"},
+		{URL: "http://jupyter-web-app.kf.svc.cluster.local/healthz"},
+	}
+	if !reflect.DeepEqual(checks, expected) {
+		t.Errorf("readinessChecks of the application: got %+v; want %+v", checks, expected)
+	}
+
+	if d := readinessTimeout(app); d != defaultReadinessTimeout {
+		t.Errorf("readinessTimeout without a timeout: got %v; want %v", d, defaultReadinessTimeout)
+	}
+	app.Readiness.TimeoutSeconds = 30
+	if d := readinessTimeout(app); d != 30*time.Second {
+		t.Errorf("readinessTimeout: got %v; want 30s", d)
+	}
+}
+
+func TestDeploymentAvailable(t *testing.T) {
+	replicas := int32(2)
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 2, AvailableReplicas: 2},
+	}
+	if deploymentAvailable(d) == nil {
+		t.Errorf("deploymentAvailable before the latest spec is observed: want an error")
+	}
+	d.Status.ObservedGeneration = 2
+	d.Status.AvailableReplicas = 1
+	if deploymentAvailable(d) == nil {
+		t.Errorf("deploymentAvailable with a replica which isn't available: want an error")
+	}
+	d.Status.AvailableReplicas = 2
+	if err := deploymentAvailable(d); err != nil {
+		t.Errorf("deploymentAvailable: got %v; want nil", err)
+	}
+}
+
+func TestJobComplete(t *testing.T) {
+	j := &batchv1.Job{Status: batchv1.JobStatus{Active: 1}}
+	if err := jobComplete(j); err == nil {
+		t.Errorf("jobComplete of an active job: want an error")
+	} else if _, ok := err.(*jobFailedError); ok {
+		t.Errorf("jobComplete of an active job: got %v; want an error which isn't a failure", err)
+	}
+	j.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+	if _, ok := jobComplete(j).(*jobFailedError); !ok {
+		t.Errorf("jobComplete of a failed job: want a jobFailedError")
+	}
+	j.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}
+	if err := jobComplete(j); err != nil {
+		t.Errorf("jobComplete: got %v; want nil", err)
+	}
+}
+
+func TestWaitForChecks(t *testing.T) {
+	checks := []kfdefsv3.ReadinessCheck{
+		{Deployment: "centraldashboard", Namespace: "kubeflow"},
+		{Job: "spartakus-init", Namespace: "kubeflow"},
+	}
+
+	// Checks are repeated until they pass.
+	calls := map[string]int{}
+	err := waitForChecks(checks, func(c kfdefsv3.ReadinessCheck) error {
+		calls[describeCheck(c)]++
+		if c.Job != "" && calls[describeCheck(c)] < 3 {
+			return fmt.Errorf("0 pods succeeded; 1 active")
+		}
+		return nil
+	}, time.Now().Add(time.Minute), time.Millisecond)
+	if err != nil || calls["deployment kubeflow/centraldashboard"] != 1 || calls["job kubeflow/spartakus-init"] != 3 {
+		t.Errorf("waitForChecks: got %v with calls %v", err, calls)
+	}
+
+	// A failed job stops the wait.
+	err = waitForChecks(checks, func(c kfdefsv3.ReadinessCheck) error {
+		if c.Job != "" {
+			return &jobFailedError{Namespace: c.Namespace, Name: c.Job, Message: "BackoffLimitExceeded"}
+		}
+		return fmt.Errorf("0 of 1 replicas are available")
+	}, time.Now().Add(time.Minute), time.Millisecond)
+	if _, ok := err.(*jobFailedError); !ok {
+		t.Errorf("waitForChecks with a failed job: got %v; want a jobFailedError", err)
+	}
+
+	// The checks which don't pass by the deadline are reported.
+	err = waitForChecks(checks, func(c kfdefsv3.ReadinessCheck) error {
+		if c.Deployment != "" {
+			return fmt.Errorf("0 of 1 replicas are available")
+		}
+		return nil
+	}, time.Now(), time.Millisecond)
+	if err == nil || err.Error() != "not ready after the readiness timeout; deployment kubeflow/centraldashboard: 0 of 1 replicas are available" {
+		t.Errorf("waitForChecks past the deadline: got %v", err)
+	}
+}
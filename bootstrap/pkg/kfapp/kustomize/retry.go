@@ -0,0 +1,194 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	crdv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	crdclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// applyRetryTimeout bounds how long a single resource is retried.
+	applyRetryTimeout = 5 * time.Minute
+	// crdEstablishedTimeout bounds how long to wait for a CRD to be established after creating it.
+	crdEstablishedTimeout = time.Minute
+	// webhookReadyTimeout bounds how long to wait for the service of a failing webhook to be ready.
+	webhookReadyTimeout = 2 * time.Minute
+)
+
+// transientApplyMessages are fragments of the messages of the errors returned while a webhook or
+// a CRD the resource depends on isn't ready yet.
+var transientApplyMessages = []string{
+	"failed calling webhook",
+	"failed calling admission webhook",
+	"no endpoints available for service",
+	"connection refused",
+	"the server could not find the requested resource",
+	"the server is currently unable to handle the request",
+}
+
+// webhookURLPattern matches the address of the service of a webhook in the error returned when
+// calling it fails e.g. Post https://cert-manager-webhook.cert-manager.svc:443/apis/...
+var webhookURLPattern = regexp.MustCompile(`https://([a-z0-9-]+)\.([a-z0-9-]+)\.svc[.:/]`)
+
+// isTransientApplyError returns true if applying a resource failed with err because something it
+// depends on isn't ready yet so applying it again later is expected to succeed.
+func isTransientApplyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if meta.IsNoMatchError(err) || k8serrors.IsServiceUnavailable(err) || k8serrors.IsTooManyRequests(err) ||
+		k8serrors.IsServerTimeout(err) || k8serrors.IsTimeout(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range transientApplyMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyBackOff returns the backoff used to retry applying a single resource.
+func (kustomize *kustomize) applyBackOff() backoff.BackOff {
+	if kustomize.newApplyBackOff != nil {
+		return kustomize.newApplyBackOff()
+	}
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 2 * time.Second
+	b.MaxInterval = 30 * time.Second
+	b.MaxElapsedTime = applyRetryTimeout
+	return b
+}
+
+// retryApply calls apply until it succeeds, fails with an error which isn't transient or b stops.
+// waitBeforeRetry is called with the transient error before each retry so its cause can be waited for.
+func retryApply(name string, b backoff.BackOff, apply func() error, waitBeforeRetry func(error)) error {
+	var permanent error
+	err := backoff.RetryNotify(func() error {
+		err := apply()
+		if err != nil && !isTransientApplyError(err) {
+			permanent = err
+			return nil
+		}
+		return err
+	}, b, func(err error, next time.Duration) {
+		log.Warnf("Applying %v failed with a transient error; retrying in %v; error %v", name, next, err)
+		if waitBeforeRetry != nil {
+			waitBeforeRetry(err)
+		}
+	})
+	if permanent != nil {
+		return permanent
+	}
+	return err
+}
+
+// waitBeforeRetry waits for the cause of the transient error err to be resolved. The mapper is
+// reset if the kind wasn't found so newly established CRDs are discovered; if a webhook couldn't
+// be called its service is probed until it has a ready endpoint.
+func (kustomize *kustomize) waitBeforeRetry(config *rest.Config, mapper *restmapper.DeferredDiscoveryRESTMapper, err error) {
+	if meta.IsNoMatchError(err) {
+		mapper.Reset()
+		return
+	}
+	namespace, name, ok := webhookService(err)
+	if !ok {
+		return
+	}
+	core, clientErr := corev1.NewForConfig(config)
+	if clientErr != nil {
+		log.Warnf("Couldn't create a client to probe webhook service %v/%v; error %v", namespace, name, clientErr)
+		return
+	}
+	if err := waitForEndpoints(core, namespace, name); err != nil {
+		log.Warnf("Webhook service %v/%v isn't ready; error %v", namespace, name, err)
+	}
+}
+
+// webhookService returns the namespace and name of the service of the webhook whose call failed with err.
+func webhookService(err error) (string, string, bool) {
+	m := webhookURLPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", "", false
+	}
+	return m[2], m[1], true
+}
+
+// endpointsReady returns true if the endpoints have a ready address.
+func endpointsReady(e *v1.Endpoints) bool {
+	for _, s := range e.Subsets {
+		if len(s.Addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForEndpoints waits for the service to have a ready endpoint.
+func waitForEndpoints(core corev1.CoreV1Interface, namespace string, name string) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 2 * time.Second
+	b.MaxInterval = 15 * time.Second
+	b.MaxElapsedTime = webhookReadyTimeout
+	return backoff.Retry(func() error {
+		e, err := core.Endpoints(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !endpointsReady(e) {
+			return fmt.Errorf("service %v/%v has no ready endpoints", namespace, name)
+		}
+		return nil
+	}, b)
+}
+
+// isCRD returns true if o is a CustomResourceDefinition.
+func isCRD(o map[string]interface{}) bool {
+	apiVersion, _ := o["apiVersion"].(string)
+	return o["kind"] == "CustomResourceDefinition" && strings.HasPrefix(apiVersion, crdv1beta1.GroupName+"/")
+}
+
+// crdEstablished returns true if the CRD is established i.e. its custom resources can be created.
+func crdEstablished(crd *crdv1beta1.CustomResourceDefinition) bool {
+	for _, c := range crd.Status.Conditions {
+		if c.Type == crdv1beta1.Established {
+			return c.Status == crdv1beta1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// waitForCRDEstablished waits for the named CRD to be established.
+func waitForCRDEstablished(config *rest.Config, name string) error {
+	client, err := crdclientset.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.MaxInterval = 10 * time.Second
+	b.MaxElapsedTime = crdEstablishedTimeout
+	return backoff.Retry(func() error {
+		crd, err := client.CustomResourceDefinitions().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !crdEstablished(crd) {
+			return fmt.Errorf("CRD %v isn't established yet", name)
+		}
+		return nil
+	}, b)
+}
@@ -0,0 +1,127 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"k8s.io/api/core/v1"
+	crdv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"testing"
+)
+
+const webhookError = `Internal error occurred: failed calling webhook "webhook.cert-manager.io": ` +
+	`Post https://cert-manager-webhook.cert-manager.svc:443/apis/webhook.cert-manager.io/v1beta1/mutations?timeout=30s: ` +
+	`no endpoints available for service "cert-manager-webhook"`
+
+func TestIsTransientApplyError(t *testing.T) {
+	type testCase struct {
+		err      error
+		expected bool
+	}
+	testCases := []testCase{
+		{err: nil, expected: false},
+		{err: k8serrors.NewInternalError(fmt.Errorf(webhookError)), expected: true},
+		{err: &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "kubeflow.org", Kind: "Profile"}}, expected: true},
+		{err: k8serrors.NewServiceUnavailable("etcd is down"), expected: true},
+		{err: k8serrors.NewInvalid(schema.GroupKind{Kind: "Deployment"}, "centraldashboard", nil), expected: false},
+		{err: &ResourceConflictError{Kind: "Deployment", Namespace: "kubeflow", Name: "centraldashboard"}, expected: false},
+	}
+	for _, c := range testCases {
+		if actual := isTransientApplyError(c.err); actual != c.expected {
+			t.Errorf("isTransientApplyError(%v): got %v; want %v", c.err, actual, c.expected)
+		}
+	}
+}
+
+func TestRetryApply(t *testing.T) {
+	b := func() backoff.BackOff { return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3) }
+
+	// A transient error is retried until the resource is applied.
+	attempts := 0
+	waited := []error{}
+	err := retryApply("Profile/kubeflow-admin", b(), func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf(webhookError)
+		}
+		return nil
+	}, func(err error) {
+		waited = append(waited, err)
+	})
+	if err != nil || attempts != 3 || len(waited) != 2 {
+		t.Errorf("retryApply: got %v after %v attempts with %v waits; want success after 3 attempts", err, attempts, len(waited))
+	}
+
+	// Other errors aren't retried.
+	attempts = 0
+	conflict := &ResourceConflictError{Kind: "Deployment", Namespace: "kubeflow", Name: "centraldashboard"}
+	err = retryApply("Deployment/centraldashboard", b(), func() error {
+		attempts++
+		return conflict
+	}, nil)
+	if err != conflict || attempts != 1 {
+		t.Errorf("retryApply: got %v after %v attempts; want the conflict after 1 attempt", err, attempts)
+	}
+
+	// The last transient error is returned once the backoff stops.
+	attempts = 0
+	err = retryApply("Profile/kubeflow-admin", b(), func() error {
+		attempts++
+		return fmt.Errorf(webhookError)
+	}, nil)
+	if err == nil || attempts != 4 {
+		t.Errorf("retryApply: got %v after %v attempts; want an error after 4 attempts", err, attempts)
+	}
+}
+
+func TestWebhookService(t *testing.T) {
+	namespace, name, ok := webhookService(fmt.Errorf(webhookError))
+	if !ok || namespace != "cert-manager" || name != "cert-manager-webhook" {
+		t.Errorf("webhookService: got %v, %v, %v; want cert-manager, cert-manager-webhook", namespace, name, ok)
+	}
+	if _, _, ok := webhookService(fmt.Errorf("connection refused")); ok {
+		t.Errorf("webhookService of an error without a webhook: want false")
+	}
+}
+
+func TestEndpointsReady(t *testing.T) {
+	notReady := &v1.Endpoints{Subsets: []v1.EndpointSubset{{
+		NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.1"}},
+	}}}
+	if endpointsReady(notReady) {
+		t.Errorf("endpointsReady with only addresses which aren't ready: want false")
+	}
+	ready := &v1.Endpoints{Subsets: []v1.EndpointSubset{{
+		Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}},
+	}}}
+	if !endpointsReady(ready) {
+		t.Errorf("endpointsReady with a ready address: want true")
+	}
+}
+
+func TestCRDEstablished(t *testing.T) {
+	o := map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1beta1",
+		"kind":       "CustomResourceDefinition",
+	}
+	if !isCRD(o) {
+		t.Errorf("isCRD(%v): want true", o)
+	}
+	if isCRD(map[string]interface{}{"apiVersion": "kubeflow.org/v1", "kind": "CustomResourceDefinition"}) {
+		t.Errorf("isCRD of another group: want false")
+	}
+
+	crd := &crdv1beta1.CustomResourceDefinition{}
+	if crdEstablished(crd) {
+		t.Errorf("crdEstablished without conditions: want false")
+	}
+	crd.Status.Conditions = []crdv1beta1.CustomResourceDefinitionCondition{
+		{Type: crdv1beta1.NamesAccepted, Status: crdv1beta1.ConditionTrue},
+		{Type: crdv1beta1.Established, Status: crdv1beta1.ConditionTrue},
+	}
+	if !crdEstablished(crd) {
+		t.Errorf("crdEstablished: want true")
+	}
+}
@@ -0,0 +1,373 @@
+package kustomize
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"math/big"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// signedManifestsDir is the directory of the app dir holding the signed manifest of each
+// application. It is separate from the kustomize directory since Generate recreates that.
+const signedManifestsDir = "signed-manifests"
+
+// SignatureSuffix is appended to the name of a manifest to get the name of its signature.
+const SignatureSuffix = ".sig"
+
+// ManifestVerifier checks the objects in the cluster against the signed manifests they were applied from.
+type ManifestVerifier interface {
+	// VerifyManifests checks the signature of the manifest each application was last applied
+	// with and compares the objects in the cluster with it.
+	VerifyManifests() (*ManifestVerification, error)
+}
+
+// ManifestVerification is the outcome of verifying the cluster against the signed manifests.
+type ManifestVerification struct {
+	// Verified is true if every signature is valid and every object matches its manifest.
+	Verified     bool                      `json:"verified"`
+	Applications []ApplicationVerification `json:"applications"`
+}
+
+// ApplicationVerification is the outcome of verifying the objects of an application.
+type ApplicationVerification struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+	// SignatureValid is true if the stored manifest matches its digest and signature.
+	SignatureValid bool `json:"signatureValid"`
+	// Missing are the objects of the manifest which don't exist in the cluster e.g. Deployment/centraldashboard.
+	Missing []string `json:"missing,omitempty"`
+	// Drifted are the objects whose fields don't match the manifest.
+	Drifted []ObjectDrift `json:"drifted,omitempty"`
+	// Message is why the application couldn't be verified.
+	Message string `json:"message,omitempty"`
+}
+
+// verified returns true if nothing differs from the signed manifest.
+func (a ApplicationVerification) verified() bool {
+	return a.SignatureValid && a.Message == "" && len(a.Missing) == 0 && len(a.Drifted) == 0
+}
+
+// ObjectDrift lists the fields of an object which don't match its manifest.
+type ObjectDrift struct {
+	Object string `json:"object"`
+	// Fields are the paths of the fields e.g. spec.replicas.
+	Fields []string `json:"fields"`
+}
+
+// ecdsaSignature is the ASN.1 encoding of an ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// signingKey returns the private key the manifests of the KfDef are signed with.
+func signingKey(d *kfdefsv3.KfDef) (*ecdsa.PrivateKey, error) {
+	value, err := d.GetSecret(d.Spec.ManifestSigning.KeySecret)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, fmt.Errorf("secret %v isn't a PEM encoded key", d.Spec.ManifestSigning.KeySecret)
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("secret %v holds a %v; want an EC PRIVATE KEY or PRIVATE KEY", d.Spec.ManifestSigning.KeySecret, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the key in secret %v: %v", d.Spec.ManifestSigning.KeySecret, err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("the key in secret %v must be an ECDSA P-256 key", d.Spec.ManifestSigning.KeySecret)
+	}
+	return ecKey, nil
+}
+
+// signManifest returns the digest of the manifest and its base64 encoded signature.
+func signManifest(key *ecdsa.PrivateKey, manifest []byte) (string, string, error) {
+	digest := sha256.Sum256(manifest)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", "", err
+	}
+	sig, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		return "", "", err
+	}
+	return "sha256:" + hex.EncodeToString(digest[:]), base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// verifyManifest returns an error unless the manifest matches the digest and signature.
+func verifyManifest(key *ecdsa.PublicKey, manifest []byte, signature kfdefsv3.ManifestSignature) error {
+	digest := sha256.Sum256(manifest)
+	if "sha256:"+hex.EncodeToString(digest[:]) != signature.Digest {
+		return fmt.Errorf("the manifest doesn't match digest %v", signature.Digest)
+	}
+	buf, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return fmt.Errorf("the signature isn't base64 encoded: %v", err)
+	}
+	sig := ecdsaSignature{}
+	if rest, err := asn1.Unmarshal(buf, &sig); err != nil || len(rest) > 0 {
+		return fmt.Errorf("the signature isn't an ASN.1 encoded ECDSA signature")
+	}
+	if !ecdsa.Verify(key, digest[:], sig.R, sig.S) {
+		return fmt.Errorf("the signature isn't valid for the signing key")
+	}
+	return nil
+}
+
+// signedManifestPath returns where the signed manifest of the application is stored.
+func (kustomize *kustomize) signedManifestPath(app string) string {
+	return path.Join(kustomize.kfDef.Spec.AppDir, signedManifestsDir, app+".yaml")
+}
+
+// manifestSignature returns the signature of the manifest of the application.
+func (kustomize *kustomize) manifestSignature(app string) (kfdefsv3.ManifestSignature, bool) {
+	for _, s := range kustomize.kfDef.Status.ManifestSignatures {
+		if s.Application == app {
+			return s, true
+		}
+	}
+	return kfdefsv3.ManifestSignature{}, false
+}
+
+// signManifests signs the evaluated manifest of each application, stores it in the app dir and
+// records the signature in the status of the KfDef. Nothing is signed unless ManifestSigning is set.
+func (kustomize *kustomize) signManifests(apps []kfdefsv3.Application, manifests [][]byte) error {
+	if kustomize.kfDef.Spec.ManifestSigning == nil {
+		kustomize.kfDef.Status.ManifestSignatures = nil
+		return nil
+	}
+	key, err := signingKey(kustomize.kfDef)
+	if err != nil {
+		return fmt.Errorf("couldn't load the manifest signing key: %v", err)
+	}
+	if err := os.MkdirAll(path.Join(kustomize.kfDef.Spec.AppDir, signedManifestsDir), os.ModePerm); err != nil {
+		return fmt.Errorf("couldn't create the directory of the signed manifests: %v", err)
+	}
+	for i, app := range apps {
+		if manifests[i] == nil {
+			continue
+		}
+		digest, sig, err := signManifest(key, manifests[i])
+		if err != nil {
+			return fmt.Errorf("couldn't sign the manifest of %v: %v", app.Name, err)
+		}
+		if err := ioutil.WriteFile(kustomize.signedManifestPath(app.Name), manifests[i], 0644); err != nil {
+			return fmt.Errorf("couldn't store the signed manifest of %v: %v", app.Name, err)
+		}
+		kustomize.kfDef.SetManifestSignature(kfdefsv3.ManifestSignature{
+			Application: app.Name,
+			Digest:      digest,
+			Signature:   sig,
+			SignedTime:  metav1.Now(),
+		})
+		log.Infof("Signed the manifest of %v; digest %v", app.Name, digest)
+	}
+	return nil
+}
+
+// VerifyManifests checks the signature of the manifest each application was last applied with and
+// compares the objects in the cluster with it. Fields set by the cluster e.g. defaults and the
+// status aren't compared.
+func (kustomize *kustomize) VerifyManifests() (*ManifestVerification, error) {
+	if kustomize.kfDef.Spec.ManifestSigning == nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("deployment %v doesn't sign its manifests; set manifestSigning", kustomize.kfDef.Name),
+		}
+	}
+	key, err := signingKey(kustomize.kfDef)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't load the manifest signing key: %v", err),
+		}
+	}
+	if err := kustomize.initK8sClients(); err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("Error: kustomize plugin couldn't initialize a K8s client %v", err),
+		}
+	}
+	mapper, err := newRESTMapper(kustomize.restConfig)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't discover the resources of the cluster: %v", err),
+		}
+	}
+
+	v := &ManifestVerification{
+		Verified:     true,
+		Applications: []ApplicationVerification{},
+	}
+	for _, s := range kustomize.kfDef.Status.ManifestSignatures {
+		a := kustomize.verifyApplication(&key.PublicKey, mapper, s)
+		v.Verified = v.Verified && a.verified()
+		v.Applications = append(v.Applications, a)
+	}
+	return v, nil
+}
+
+// verifyApplication checks the signature of the stored manifest of an application and compares
+// its objects with the cluster.
+func (kustomize *kustomize) verifyApplication(key *ecdsa.PublicKey, mapper meta.RESTMapper, s kfdefsv3.ManifestSignature) ApplicationVerification {
+	a := ApplicationVerification{
+		Name:   s.Application,
+		Digest: s.Digest,
+	}
+	manifest, err := ioutil.ReadFile(kustomize.signedManifestPath(s.Application))
+	if err != nil {
+		a.Message = fmt.Sprintf("couldn't read the signed manifest: %v", err)
+		return a
+	}
+	if err := verifyManifest(key, manifest, s); err != nil {
+		a.Message = err.Error()
+		return a
+	}
+	a.SignatureValid = true
+
+	splitter := regexp.MustCompile(kftypesv3.YamlSeparator)
+	for _, object := range splitter.Split(string(manifest), -1) {
+		var o map[string]interface{}
+		if err := yaml.Unmarshal([]byte(object), &o); err != nil {
+			a.Message = fmt.Sprintf("couldn't parse the signed manifest: %v", err)
+			return a
+		}
+		metadata, _ := o["metadata"].(map[string]interface{})
+		if o["apiVersion"] == nil || metadata == nil || metadata["name"] == nil {
+			continue
+		}
+		// The objects were changed the same way when they were applied.
+		kustomize.relocateNamespaces(o)
+		kustomize.setOwnershipLabels(o)
+		name := objectName(o)
+
+		live, err := kustomize.getObject(mapper, o)
+		if k8serrors.IsNotFound(err) {
+			a.Missing = append(a.Missing, name)
+			continue
+		}
+		if err != nil {
+			a.Message = fmt.Sprintf("couldn't get %v: %v", name, err)
+			return a
+		}
+		fields := []string{}
+		diffFields(o, live, "", &fields)
+		if len(fields) > 0 {
+			a.Drifted = append(a.Drifted, ObjectDrift{Object: name, Fields: fields})
+		}
+	}
+	return a
+}
+
+// getObject returns the object in the cluster with the kind, namespace and name of o.
+func (kustomize *kustomize) getObject(mapper meta.RESTMapper, o map[string]interface{}) (map[string]interface{}, error) {
+	restClient, mapping, err := restClientFor(kustomize.restConfig, mapper, o)
+	if err != nil {
+		return nil, err
+	}
+	metadata := o["metadata"].(map[string]interface{})
+	name := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+
+	request := restClient.Get().Resource(mapping.Resource.Resource).Name(name)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		request = request.Namespace(namespace)
+	}
+	raw, err := request.Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]interface{}{}
+	if err := yaml.Unmarshal(raw, &live); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// diffFields appends the paths of the fields of expected which aren't set to the same value in
+// actual. Fields of actual which aren't in expected are ignored since the cluster sets defaults.
+func diffFields(expected interface{}, actual interface{}, fieldPath string, fields *[]string) {
+	switch e := expected.(type) {
+	case nil:
+		return
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			*fields = append(*fields, fieldPath)
+			return
+		}
+		keys := []string{}
+		for k := range e {
+			// The status is set by the cluster and secrets only return stringData as data.
+			if fieldPath == "" && (k == "status" || k == "stringData") {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if fieldPath != "" {
+				p = fieldPath + "." + k
+			}
+			diffFields(e[k], a[k], p, fields)
+		}
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			*fields = append(*fields, fieldPath)
+			return
+		}
+		for i := range e {
+			diffFields(e[i], a[i], fmt.Sprintf("%v[%v]", fieldPath, i), fields)
+		}
+	default:
+		// Compare the printed values so e.g. a port given as a string matches the number.
+		if actual == nil || fmt.Sprint(e) != fmt.Sprint(actual) {
+			*fields = append(*fields, fieldPath)
+		}
+	}
+}
+
+// signatureFile returns the base64 encoded signature of the manifest of the application to store
+// next to it, or nil if the manifest isn't signed.
+func (kustomize *kustomize) signatureFile(app string) []byte {
+	if kustomize.kfDef.Spec.ManifestSigning == nil {
+		return nil
+	}
+	s, ok := kustomize.manifestSignature(app)
+	if !ok {
+		return nil
+	}
+	return []byte(strings.TrimSpace(s.Signature) + "\n")
+}
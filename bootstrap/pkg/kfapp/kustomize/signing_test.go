@@ -0,0 +1,185 @@
+package kustomize
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// newSigningKfDef returns a KfDef signing its manifests with a new key.
+func newSigningKfDef(t *testing.T, appDir string) *kfdefsv3.KfDef {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate a key; %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not marshal the key; %v", err)
+	}
+	return &kfdefsv3.KfDef{
+		ObjectMeta: metav1.ObjectMeta{Name: "kf-app"},
+		Spec: kfdefsv3.KfDefSpec{
+			AppDir:          appDir,
+			ManifestSigning: &kfdefsv3.ManifestSigning{KeySecret: "signing-key"},
+			Secrets: []kfdefsv3.Secret{{
+				Name: "signing-key",
+				SecretSource: &kfdefsv3.SecretSource{
+					LiteralSource: &kfdefsv3.LiteralSource{
+						Value: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestKustomize_signManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &fakeSink{written: map[string]string{}}
+	k := &kustomize{
+		kfDef: newSigningKfDef(t, dir),
+		openManifestSink: func(string) (manifestSink, error) {
+			return sink, nil
+		},
+	}
+	k.kfDef.Spec.ManifestSinks = []string{"/var/lib/manifests"}
+
+	apps := []kfdefsv3.Application{{Name: "jupyter"}, {Name: "broken"}}
+	manifests := [][]byte{[]byte("kind: Deployment\n"), nil}
+	if err := k.signManifests(apps, manifests); err != nil {
+		t.Fatalf("signManifests: %v", err)
+	}
+	if len(k.kfDef.Status.ManifestSignatures) != 1 {
+		t.Fatalf("Signatures: got %v; want the signature of jupyter", k.kfDef.Status.ManifestSignatures)
+	}
+	sig := k.kfDef.Status.ManifestSignatures[0]
+	if sig.Application != "jupyter" {
+		t.Errorf("Signed application: got %v; want jupyter", sig.Application)
+	}
+
+	key, err := signingKey(k.kfDef)
+	if err != nil {
+		t.Fatalf("signingKey: %v", err)
+	}
+	stored, err := ioutil.ReadFile(k.signedManifestPath("jupyter"))
+	if err != nil {
+		t.Fatalf("The signed manifest wasn't stored; %v", err)
+	}
+	if err := verifyManifest(&key.PublicKey, stored, sig); err != nil {
+		t.Errorf("verifyManifest of the signed manifest: %v", err)
+	}
+	if err := verifyManifest(&key.PublicKey, []byte("kind: Deployment\nspec: {}\n"), sig); err == nil {
+		t.Errorf("verifyManifest of a changed manifest should fail")
+	}
+	other := newSigningKfDef(t, dir)
+	otherKey, err := signingKey(other)
+	if err != nil {
+		t.Fatalf("signingKey: %v", err)
+	}
+	if err := verifyManifest(&otherKey.PublicKey, stored, sig); err == nil {
+		t.Errorf("verifyManifest with another key should fail")
+	}
+
+	if err := k.writeManifests(apps, manifests); err != nil {
+		t.Fatalf("writeManifests: %v", err)
+	}
+	if got := sink.written["kf-app/jupyter.yaml"+SignatureSuffix]; got != sig.Signature+"\n" {
+		t.Errorf("Signature written to the sink: got %q; want %q", got, sig.Signature+"\n")
+	}
+
+	k.kfDef.Spec.ManifestSigning = nil
+	if err := k.signManifests(apps, manifests); err != nil || k.kfDef.Status.ManifestSignatures != nil {
+		t.Errorf("signManifests without signing: got %v, %v; want no signatures", k.kfDef.Status.ManifestSignatures, err)
+	}
+}
+
+func TestSigningKey_Invalid(t *testing.T) {
+	d := newSigningKfDef(t, "")
+	d.Spec.Secrets[0].SecretSource.LiteralSource.Value = "not a key"
+	if _, err := signingKey(d); err == nil {
+		t.Errorf("signingKey of an invalid key should fail")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate a key; %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not marshal the key; %v", err)
+	}
+	d.Spec.Secrets[0].SecretSource.LiteralSource.Value = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if _, err := signingKey(d); err == nil {
+		t.Errorf("signingKey of a P-384 key should fail")
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	expected := map[string]interface{}{
+		"kind": "Deployment",
+		"metadata": map[string]interface{}{
+			"name":   "centraldashboard",
+			"labels": map[string]interface{}{"app": "centraldashboard"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": float64(1),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "dashboard", "image": "dashboard:v1", "ports": []interface{}{
+							map[string]interface{}{"containerPort": "8082"},
+						}},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{},
+	}
+	live := map[string]interface{}{
+		"kind": "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "centraldashboard",
+			"labels":          map[string]interface{}{"app": "centraldashboard"},
+			"resourceVersion": "42",
+		},
+		"spec": map[string]interface{}{
+			"replicas": float64(3),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "dashboard", "image": "dashboard:v2", "ports": []interface{}{
+							map[string]interface{}{"containerPort": float64(8082), "protocol": "TCP"},
+						}},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{"replicas": float64(3)},
+	}
+
+	fields := []string{}
+	diffFields(expected, live, "", &fields)
+	want := []string{"spec.replicas", "spec.template.spec.containers[0].image"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("diffFields: got %v; want %v", fields, want)
+	}
+
+	fields = []string{}
+	diffFields(expected, expected, "", &fields)
+	if len(fields) != 0 {
+		t.Errorf("diffFields of identical objects: got %v; want none", fields)
+	}
+}
@@ -0,0 +1,131 @@
+package kustomize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/storage/v1"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// manifestContentType is the content type of the manifests written to buckets.
+const manifestContentType = "application/x-yaml"
+
+// manifestSink stores the rendered manifest of an application.
+type manifestSink interface {
+	// write stores manifest under name, replacing the manifest stored under name before.
+	write(name string, manifest []byte) error
+}
+
+// dirSink writes the manifests to files in a directory e.g. a mounted volume.
+type dirSink struct {
+	dir string
+}
+
+func (s *dirSink) write(name string, manifest []byte) error {
+	p := path.Join(s.dir, name)
+	if err := os.MkdirAll(path.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, manifest, 0644)
+}
+
+// gcsSink writes the manifests to objects in a GCS bucket.
+type gcsSink struct {
+	service *storage.Service
+	bucket  string
+	prefix  string
+}
+
+func (s *gcsSink) write(name string, manifest []byte) error {
+	o := &storage.Object{Name: path.Join(s.prefix, name), ContentType: manifestContentType}
+	_, err := s.service.Objects.Insert(s.bucket, o).Media(bytes.NewReader(manifest)).Do()
+	return err
+}
+
+// s3Sink writes the manifests to objects in an S3 bucket.
+type s3Sink struct {
+	client s3iface.S3API
+	bucket string
+	prefix string
+}
+
+func (s *s3Sink) write(name string, manifest []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(path.Join(s.prefix, name)),
+		Body:        bytes.NewReader(manifest),
+		ContentType: aws.String(manifestContentType),
+	})
+	return err
+}
+
+// openManifestSink returns the sink of a KfDef manifest sink. The buckets are accessed with the
+// application default credentials of GCP and the default credential chain of AWS.
+func openManifestSink(sink string) (manifestSink, error) {
+	scheme, bucket, prefix, err := kfdefsv3.ParseManifestSink(sink)
+	if err != nil {
+		return nil, err
+	}
+	switch scheme {
+	case kfdefsv3.ManifestSinkGCS:
+		client, err := google.DefaultClient(context.Background(), storage.DevstorageReadWriteScope)
+		if err != nil {
+			return nil, err
+		}
+		service, err := storage.New(client)
+		if err != nil {
+			return nil, err
+		}
+		return &gcsSink{service: service, bucket: bucket, prefix: prefix}, nil
+	case kfdefsv3.ManifestSinkS3:
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		return &s3Sink{client: s3.New(sess), bucket: bucket, prefix: prefix}, nil
+	default:
+		return &dirSink{dir: prefix}, nil
+	}
+}
+
+// writeManifests writes the evaluated manifest of each application to every manifest sink of the
+// KfDef as <name of the KfDef>/<application>.yaml so deployments can share a sink. The signature of
+// a signed manifest is written next to it as <application>.yaml.sig.
+func (kustomize *kustomize) writeManifests(apps []kfdefsv3.Application, manifests [][]byte) error {
+	open := kustomize.openManifestSink
+	if open == nil {
+		open = openManifestSink
+	}
+	for _, sink := range kustomize.kfDef.Spec.ManifestSinks {
+		s, err := open(sink)
+		if err != nil {
+			return fmt.Errorf("couldn't open manifest sink %v: %v", sink, err)
+		}
+		for i, app := range apps {
+			if manifests[i] == nil {
+				continue
+			}
+			name := path.Join(kustomize.kfDef.Name, app.Name+".yaml")
+			if err := s.write(name, manifests[i]); err != nil {
+				return fmt.Errorf("couldn't write the manifest of %v to %v: %v", app.Name, sink, err)
+			}
+			if sig := kustomize.signatureFile(app.Name); sig != nil {
+				if err := s.write(name+SignatureSuffix, sig); err != nil {
+					return fmt.Errorf("couldn't write the signature of %v to %v: %v", app.Name, sink, err)
+				}
+			}
+		}
+		log.Infof("Wrote the manifests to %v", sink)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// fakeSink records the manifests written to it.
+type fakeSink struct {
+	written map[string]string
+	err     error
+}
+
+func (s *fakeSink) write(name string, manifest []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.written[name] = string(manifest)
+	return nil
+}
+
+// fakeS3 records the objects put in it.
+type fakeS3 struct {
+	s3iface.S3API
+	keys []string
+}
+
+func (f *fakeS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	f.keys = append(f.keys, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestKustomize_writeManifests(t *testing.T) {
+	sinks := map[string]*fakeSink{
+		"gs://kf-archive/manifests": {written: map[string]string{}},
+		"/var/lib/manifests":        {written: map[string]string{}},
+	}
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{Name: "kf-app"},
+			Spec: kfdefsv3.KfDefSpec{
+				ManifestSinks: []string{"gs://kf-archive/manifests", "/var/lib/manifests"},
+			},
+		},
+		openManifestSink: func(sink string) (manifestSink, error) {
+			return sinks[sink], nil
+		},
+	}
+	apps := []kfdefsv3.Application{{Name: "jupyter"}, {Name: "broken"}, {Name: "katib"}}
+	manifests := [][]byte{[]byte("kind: Deployment"), nil, []byte("kind: Service")}
+	if err := k.writeManifests(apps, manifests); err != nil {
+		t.Fatalf("writeManifests failed; %v", err)
+	}
+	expected := map[string]string{
+		"kf-app/jupyter.yaml": "kind: Deployment",
+		"kf-app/katib.yaml":   "kind: Service",
+	}
+	for name, s := range sinks {
+		if !reflect.DeepEqual(s.written, expected) {
+			t.Errorf("writeManifests to %v: got %v; want %v", name, s.written, expected)
+		}
+	}
+
+	sinks["/var/lib/manifests"].err = fmt.Errorf("read-only file system")
+	if err := k.writeManifests(apps, manifests); err == nil {
+		t.Errorf("writeManifests to a failing sink: want an error")
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatalf("TempDir failed; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &dirSink{dir: dir}
+	if err := s.write("kf-app/jupyter.yaml", []byte("kind: Deployment")); err != nil {
+		t.Fatalf("write failed; %v", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, "kf-app", "jupyter.yaml"))
+	if err != nil || string(b) != "kind: Deployment" {
+		t.Errorf("dirSink wrote %q; error %v", string(b), err)
+	}
+}
+
+func TestS3Sink(t *testing.T) {
+	client := &fakeS3{}
+	s := &s3Sink{client: client, bucket: "kf-archive", prefix: "manifests"}
+	if err := s.write("kf-app/jupyter.yaml", []byte("kind: Deployment")); err != nil {
+		t.Fatalf("write failed; %v", err)
+	}
+	if !reflect.DeepEqual(client.keys, []string{"kf-archive/manifests/kf-app/jupyter.yaml"}) {
+		t.Errorf("s3Sink put %v", client.keys)
+	}
+}
@@ -0,0 +1,199 @@
+package kustomize
+
+import (
+	"fmt"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"strconv"
+)
+
+const (
+	// mysqlApplication and minioApplication are the in-cluster storage of pipelines and metadata.
+	mysqlApplication = "mysql"
+	minioApplication = "minio"
+	// cloudSQLProxyOverlay replaces the in-cluster MySQL with the Cloud SQL proxy; the platform sets
+	// the instance it connects to.
+	cloudSQLProxyOverlay = "cloudsql-proxy"
+	// externalMySQLOverlay and externalObjectStoreOverlay point an application at external storage.
+	externalMySQLOverlay       = "external-mysql"
+	externalObjectStoreOverlay = "external-object-store"
+
+	// The secrets in the Kubeflow namespace holding the credentials of the external storage.
+	mysqlSecret       = "mysql-credentials"
+	objectStoreSecret = "object-store-credentials"
+)
+
+// databaseApplications and objectStoreApplications are the applications using the database and
+// the object store.
+var (
+	databaseApplications    = []string{"api-service", "metadata"}
+	objectStoreApplications = []string{"api-service", "argo", "pipelines-ui"}
+)
+
+// applyExternalStorage points the applications using the database and object store at the
+// external storage of the KfDef with overlays and parameters and drops the in-cluster storage it
+// replaces; MySQL is kept as the Cloud SQL proxy if the database is a Cloud SQL instance. apps is
+// changed in place and the applications to deploy are returned.
+func applyExternalStorage(apps []kfdefsv3.Application, storage *kfdefsv3.ExternalStorage) []kfdefsv3.Application {
+	if storage == nil {
+		return apps
+	}
+
+	overlays := map[string][]string{}
+	params := map[string][]config.NameValue{}
+	dropped := map[string]bool{}
+	if db := storage.Database; db != nil {
+		host, port := db.Host, db.Port
+		if host == "" {
+			host = mysqlApplication
+		}
+		if port == 0 {
+			port = kfdefsv3.DefaultMySQLPort
+		}
+		for _, name := range databaseApplications {
+			overlays[name] = append(overlays[name], externalMySQLOverlay)
+			params[name] = append(params[name],
+				config.NameValue{Name: "mysqlHost", Value: host},
+				config.NameValue{Name: "mysqlPort", Value: strconv.Itoa(int(port))},
+				config.NameValue{Name: "mysqlSecret", Value: mysqlSecret})
+		}
+		if db.CloudSQL != nil {
+			overlays[mysqlApplication] = append(overlays[mysqlApplication], cloudSQLProxyOverlay)
+		} else {
+			dropped[mysqlApplication] = true
+		}
+	}
+	if store := storage.ObjectStore; store != nil {
+		endpoint := store.Endpoint
+		if endpoint == "" {
+			endpoint = kfdefsv3.DefaultObjectStoreEndpoint
+		}
+		for _, name := range objectStoreApplications {
+			overlays[name] = append(overlays[name], externalObjectStoreOverlay)
+			params[name] = append(params[name],
+				config.NameValue{Name: "objectStoreEndpoint", Value: endpoint},
+				config.NameValue{Name: "objectStoreBucket", Value: store.Bucket},
+				config.NameValue{Name: "objectStoreSecure", Value: strconv.FormatBool(!store.Insecure)},
+				config.NameValue{Name: "objectStoreSecret", Value: objectStoreSecret})
+		}
+		dropped[minioApplication] = true
+	}
+
+	result := []kfdefsv3.Application{}
+	for _, app := range apps {
+		if dropped[app.Name] {
+			log.Infof("Skipping application %v; it is replaced by the external storage", app.Name)
+			continue
+		}
+		if k := app.KustomizeConfig; k != nil {
+			for _, o := range overlays[app.Name] {
+				if !hasOverlay(k.Overlays, o) {
+					k.Overlays = append(k.Overlays, o)
+				}
+			}
+			for _, p := range params[app.Name] {
+				k.Parameters = setParameter(k.Parameters, p)
+			}
+		}
+		result = append(result, app)
+	}
+	return result
+}
+
+// setParameter returns params with p added or replacing the parameter of the same name.
+func setParameter(params []config.NameValue, p config.NameValue) []config.NameValue {
+	for i := range params {
+		if params[i].Name == p.Name {
+			params[i].Value = p.Value
+			return params
+		}
+	}
+	return append(params, p)
+}
+
+// externalStorageSecrets returns the secrets holding the credentials of the external storage of
+// the KfDef read from the secrets of the KfDef.
+func (kustomize *kustomize) externalStorageSecrets() ([]*v1.Secret, error) {
+	storage := kustomize.kfDef.Spec.ExternalStorage
+	if storage == nil {
+		return nil, nil
+	}
+	secrets := []*v1.Secret{}
+	newSecret := func(name string, data map[string]string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: kustomize.kfDef.Namespace,
+				Labels:    kustomize.ownershipLabels(),
+			},
+			StringData: data,
+		}
+	}
+	if db := storage.Database; db != nil {
+		password, err := kustomize.kfDef.GetSecret(db.PasswordSecret)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, newSecret(mysqlSecret, map[string]string{
+			"username": db.User,
+			"password": password,
+		}))
+	}
+	if store := storage.ObjectStore; store != nil {
+		accessKey, err := kustomize.kfDef.GetSecret(store.AccessKeySecret)
+		if err != nil {
+			return nil, err
+		}
+		secretKey, err := kustomize.kfDef.GetSecret(store.SecretKeySecret)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, newSecret(objectStoreSecret, map[string]string{
+			"accesskey": accessKey,
+			"secretkey": secretKey,
+		}))
+	}
+	return secrets, nil
+}
+
+// applyExternalStorageSecrets creates or updates the secrets holding the credentials of the
+// external storage in the Kubeflow namespace. They are created by the deployment rather than
+// rendered into the manifests so the credentials aren't written to the manifest sinks.
+func (kustomize *kustomize) applyExternalStorageSecrets(client corev1.CoreV1Interface) error {
+	secrets, err := kustomize.externalStorageSecrets()
+	if err != nil {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't read the credentials of the external storage Error: %v", err),
+		}
+	}
+	for _, secret := range secrets {
+		existing, err := client.Secrets(secret.Namespace).Get(secret.Name, metav1.GetOptions{})
+		switch {
+		case err != nil && !k8serrors.IsNotFound(err):
+		case err != nil:
+			log.Infof("Creating secret %v", secret.Name)
+			_, err = client.Secrets(secret.Namespace).Create(secret)
+		default:
+			log.Infof("Updating secret %v", secret.Name)
+			existing.Labels = secret.Labels
+			existing.Data = nil
+			existing.StringData = secret.StringData
+			_, err = client.Secrets(secret.Namespace).Update(existing)
+		}
+		if err != nil {
+			return &kfapisv3.KfError{
+				Code:    int(kfapisv3.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't apply secret %v Error: %v", secret.Name, err),
+			}
+		}
+		kustomize.recordResource(storageSource, "v1", "Secret", secret.Namespace, secret.Name)
+	}
+	return nil
+}
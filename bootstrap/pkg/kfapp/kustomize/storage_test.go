@@ -0,0 +1,144 @@
+package kustomize
+
+import (
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func storageTestApps() []kfdefsv3.Application {
+	apps := []kfdefsv3.Application{}
+	for _, name := range []string{"api-service", "metadata", "mysql", "minio", "argo", "pipelines-ui"} {
+		apps = append(apps, kfdefsv3.Application{
+			Name: name,
+			KustomizeConfig: &kfdefsv3.KustomizeConfig{
+				RepoRef:    &kfdefsv3.RepoRef{Name: "manifests", Path: name},
+				Overlays:   []string{"application"},
+				Parameters: []config.NameValue{{Name: "mysqlHost", Value: "mysql"}},
+			},
+		})
+	}
+	return apps
+}
+
+func TestApplyExternalStorage(t *testing.T) {
+	storage := &kfdefsv3.ExternalStorage{
+		Database: &kfdefsv3.ExternalDatabase{
+			Host:           "10.0.0.3",
+			User:           "kubeflow",
+			PasswordSecret: "mysql-password",
+		},
+		ObjectStore: &kfdefsv3.ExternalObjectStore{
+			Bucket:          "kf-app-artifacts",
+			AccessKeySecret: "access-key",
+			SecretKeySecret: "secret-key",
+		},
+	}
+
+	apps := applyExternalStorage(storageTestApps(), storage)
+	names := []string{}
+	byName := map[string]*kfdefsv3.KustomizeConfig{}
+	for _, app := range apps {
+		names = append(names, app.Name)
+		byName[app.Name] = app.KustomizeConfig
+	}
+	if expected := []string{"api-service", "metadata", "argo", "pipelines-ui"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Applications: got %v; want %v", names, expected)
+	}
+
+	api := byName["api-service"]
+	if expected := []string{"application", externalMySQLOverlay, externalObjectStoreOverlay}; !reflect.DeepEqual(api.Overlays, expected) {
+		t.Errorf("Overlays of api-service: got %v; want %v", api.Overlays, expected)
+	}
+	expected := []config.NameValue{
+		{Name: "mysqlHost", Value: "10.0.0.3"},
+		{Name: "mysqlPort", Value: "3306"},
+		{Name: "mysqlSecret", Value: mysqlSecret},
+		{Name: "objectStoreEndpoint", Value: kfdefsv3.DefaultObjectStoreEndpoint},
+		{Name: "objectStoreBucket", Value: "kf-app-artifacts"},
+		{Name: "objectStoreSecure", Value: "true"},
+		{Name: "objectStoreSecret", Value: objectStoreSecret},
+	}
+	if !reflect.DeepEqual(api.Parameters, expected) {
+		t.Errorf("Parameters of api-service: got %v; want %v", api.Parameters, expected)
+	}
+	if expected := []string{"application", externalObjectStoreOverlay}; !reflect.DeepEqual(byName["argo"].Overlays, expected) {
+		t.Errorf("Overlays of argo: got %v; want %v", byName["argo"].Overlays, expected)
+	}
+
+	// A Cloud SQL instance is reached through the proxy replacing the in-cluster MySQL.
+	storage = &kfdefsv3.ExternalStorage{
+		Database: &kfdefsv3.ExternalDatabase{
+			User:           "kubeflow",
+			PasswordSecret: "mysql-password",
+			CloudSQL:       &kfdefsv3.CloudSQLInstance{},
+		},
+	}
+	apps = applyExternalStorage(storageTestApps(), storage)
+	if len(apps) != 6 {
+		t.Fatalf("Applications with Cloud SQL: got %v; want all 6", len(apps))
+	}
+	if expected := []string{"application", cloudSQLProxyOverlay}; !reflect.DeepEqual(apps[2].KustomizeConfig.Overlays, expected) {
+		t.Errorf("Overlays of mysql: got %v; want %v", apps[2].KustomizeConfig.Overlays, expected)
+	}
+	if host := apps[0].KustomizeConfig.Parameters[0]; host.Value != mysqlApplication {
+		t.Errorf("mysqlHost with Cloud SQL: got %v; want %v", host.Value, mysqlApplication)
+	}
+
+	if apps := applyExternalStorage(storageTestApps(), nil); !reflect.DeepEqual(apps, storageTestApps()) {
+		t.Errorf("applyExternalStorage without external storage changed the applications")
+	}
+}
+
+func TestKustomize_externalStorageSecrets(t *testing.T) {
+	literal := func(name string, value string) kfdefsv3.Secret {
+		return kfdefsv3.Secret{
+			Name:         name,
+			SecretSource: &kfdefsv3.SecretSource{LiteralSource: &kfdefsv3.LiteralSource{Value: value}},
+		}
+	}
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kf-app",
+				Namespace: "kubeflow",
+			},
+			Spec: kfdefsv3.KfDefSpec{
+				Secrets: []kfdefsv3.Secret{literal("mysql-password", "pw"), literal("access-key", "ak"), literal("secret-key", "sk")},
+				ExternalStorage: &kfdefsv3.ExternalStorage{
+					Database: &kfdefsv3.ExternalDatabase{Host: "10.0.0.3", User: "kubeflow", PasswordSecret: "mysql-password"},
+					ObjectStore: &kfdefsv3.ExternalObjectStore{
+						Bucket:          "kf-app-artifacts",
+						AccessKeySecret: "access-key",
+						SecretKeySecret: "secret-key",
+					},
+				},
+			},
+		},
+	}
+
+	secrets, err := k.externalStorageSecrets()
+	if err != nil {
+		t.Fatalf("externalStorageSecrets: %v", err)
+	}
+	if len(secrets) != 2 {
+		t.Fatalf("externalStorageSecrets: got %v secrets; want 2", len(secrets))
+	}
+	db, store := secrets[0], secrets[1]
+	if db.Name != mysqlSecret || db.Namespace != "kubeflow" || !reflect.DeepEqual(db.StringData, map[string]string{"username": "kubeflow", "password": "pw"}) {
+		t.Errorf("Database secret: got %+v", db)
+	}
+	if store.Name != objectStoreSecret || !reflect.DeepEqual(store.StringData, map[string]string{"accesskey": "ak", "secretkey": "sk"}) {
+		t.Errorf("Object store secret: got %+v", store)
+	}
+	if db.Labels[DeploymentLabel] != toLabelValue("kf-app") {
+		t.Errorf("Database secret isn't labeled with the deployment; got %v", db.Labels)
+	}
+
+	k.kfDef.Spec.ExternalStorage.ObjectStore.SecretKeySecret = "missing"
+	if _, err := k.externalStorageSecrets(); err == nil {
+		t.Errorf("externalStorageSecrets with a missing secret: got nil; want error")
+	}
+}
@@ -0,0 +1,81 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ghodss/yaml"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/pkg/patch"
+)
+
+// transformerPatchPrefix prefixes the files of the JSON patches written for the replacements of
+// the transformers.
+const transformerPatchPrefix = "kfdef-transformer-"
+
+// replaceOp is a JSON patch operation replacing the value of a field.
+type replaceOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyTransformers adds the transformers of the KfDef for an application to the kustomization
+// generated in appDir. The name prefixes are joined in the order of the transformers and later
+// labels override earlier ones. Only the kustomization and the patch files kfctl names are
+// written so a transformer can't make kustomize read other files or run programs.
+func applyTransformers(kfDef *kfdefsv3.KfDef, appDir string, appName string) error {
+	transformers := kfDef.TransformersFor(appName)
+	if len(transformers) == 0 {
+		return nil
+	}
+	kustomization := GetKustomization(appDir)
+	if kustomization == nil {
+		return fmt.Errorf("couldn't read the kustomization of application %v", appName)
+	}
+
+	prefix := ""
+	for i, t := range transformers {
+		log.Infof("Applying transformer %v to application %v", t.Name, appName)
+		prefix += t.NamePrefix
+		if len(t.CommonLabels) > 0 && kustomization.CommonLabels == nil {
+			kustomization.CommonLabels = map[string]string{}
+		}
+		for k, v := range t.CommonLabels {
+			kustomization.CommonLabels[k] = v
+		}
+		for j, r := range t.Replacements {
+			if !json.Valid(r.Value.Raw) {
+				return fmt.Errorf("replacement %v of transformer %v doesn't have a JSON value", j, t.Name)
+			}
+			buf, err := json.Marshal([]replaceOp{{Op: "replace", Path: r.Path, Value: r.Value.Raw}})
+			if err != nil {
+				return err
+			}
+			patchFile := fmt.Sprintf("%v%v-%v.json", transformerPatchPrefix, i, j)
+			if err := ioutil.WriteFile(filepath.Join(appDir, patchFile), buf, 0644); err != nil {
+				return err
+			}
+			target := new(patch.Target)
+			target.Group = r.Group
+			target.Version = r.Version
+			target.Kind = r.Kind
+			target.Name = r.Name
+			target.Namespace = r.Namespace
+			kustomization.PatchesJson6902 = append(kustomization.PatchesJson6902, patch.Json6902{
+				Target: target,
+				Path:   patchFile,
+			})
+		}
+	}
+	kustomization.NamePrefix = prefix + kustomization.NamePrefix
+
+	buf, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(appDir, kftypesv3.KustomizationFile), buf, 0644)
+}
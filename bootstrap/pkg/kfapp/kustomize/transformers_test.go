@@ -0,0 +1,104 @@
+package kustomize
+
+import (
+	"github.com/ghodss/yaml"
+	kftypesv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const transformerTestDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: centraldashboard
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: centraldashboard
+  template:
+    metadata:
+      labels:
+        app: centraldashboard
+    spec:
+      containers:
+      - name: centraldashboard
+        image: gcr.io/kubeflow-images-public/centraldashboard:v0.5.0
+`
+
+func TestApplyTransformers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		kftypesv3.KustomizationFile: "resources:\n- deployment.yaml\n",
+		"deployment.yaml":           transformerTestDeployment,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Could not write %v; %v", name, err)
+		}
+	}
+
+	d := &kfdefsv3.KfDef{}
+	d.Spec.Transformers = []kfdefsv3.KustomizeTransformer{
+		{
+			Name:         "team",
+			NamePrefix:   "ml-",
+			CommonLabels: map[string]string{"team": "ml"},
+			Replacements: []kfdefsv3.FieldReplacement{{
+				Group:   "apps",
+				Version: "v1",
+				Kind:    "Deployment",
+				Name:    "centraldashboard",
+				Path:    "/spec/replicas",
+				Value:   runtime.RawExtension{Raw: []byte("3")},
+			}},
+		},
+		{
+			Name:         "other-app",
+			Applications: []string{"jupyter-web-app"},
+			NamePrefix:   "jupyter-",
+		},
+	}
+	if err := applyTransformers(d, dir, "centraldashboard"); err != nil {
+		t.Fatalf("applyTransformers: %v", err)
+	}
+
+	resMap, err := EvaluateKustomizeManifest(dir)
+	if err != nil {
+		t.Fatalf("EvaluateKustomizeManifest: %v", err)
+	}
+	data, err := resMap.EncodeAsYaml()
+	if err != nil {
+		t.Fatalf("EncodeAsYaml: %v", err)
+	}
+	u := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, u); err != nil {
+		t.Fatalf("Could not unmarshal the manifest; %v", err)
+	}
+	if u.GetName() != "ml-centraldashboard" {
+		t.Errorf("Name: got %v; want ml-centraldashboard", u.GetName())
+	}
+	if !reflect.DeepEqual(u.GetLabels(), map[string]string{"team": "ml"}) {
+		t.Errorf("Labels: got %v; want team=ml", u.GetLabels())
+	}
+	if replicas := u.Object["spec"].(map[string]interface{})["replicas"]; replicas != int64(3) {
+		t.Errorf("Replicas: got %v; want 3", replicas)
+	}
+
+	// A replacement without a JSON value isn't written.
+	d.Spec.Transformers[0].Replacements[0].Value = runtime.RawExtension{Raw: []byte("{")}
+	if err := applyTransformers(d, dir, "centraldashboard"); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("applyTransformers with an invalid value: got %v; want error", err)
+	}
+}
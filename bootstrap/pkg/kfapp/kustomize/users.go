@@ -0,0 +1,223 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	kfapisv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	profilev2 "github.com/kubeflow/kubeflow/components/profile-controller/pkg/apis/kubeflow/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	rbacv2 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Cluster roles of the Kubeflow manifests granted to the admins and the contributors of profiles.
+const (
+	kubeflowAdminRole = "kubeflow-admin"
+	kubeflowEditRole  = "kubeflow-edit"
+	kubeflowViewRole  = "kubeflow-view"
+)
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// userBindingName returns the name of the binding of a cluster role to a user; it matches the
+// names of the bindings created by the access management API so they aren't duplicated.
+func userBindingName(user string, role string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(user), "-")
+	return "user-" + strings.Trim(name, "-") + "-clusterrole-" + role
+}
+
+// userSubject returns the RBAC subject of a user identified by email.
+func userSubject(user string) rbacv2.Subject {
+	return rbacv2.Subject{
+		APIGroup: rbacv2.GroupName,
+		Kind:     rbacv2.UserKind,
+		Name:     user,
+	}
+}
+
+// adminBindings returns the ClusterRoleBindings granting the admins of the KfDef the
+// kubeflow-admin cluster role.
+func (kustomize *kustomize) adminBindings() []*rbacv2.ClusterRoleBinding {
+	bindings := []*rbacv2.ClusterRoleBinding{}
+	for _, admin := range kustomize.kfDef.Spec.Admins {
+		bindings = append(bindings, &rbacv2.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   kustomize.scopedName(userBindingName(admin, kubeflowAdminRole)),
+				Labels: kustomize.ownershipLabels(),
+			},
+			RoleRef: rbacv2.RoleRef{
+				APIGroup: rbacv2.GroupName,
+				Kind:     "ClusterRole",
+				Name:     kustomize.scopedName(kubeflowAdminRole),
+			},
+			Subjects: []rbacv2.Subject{userSubject(admin)},
+		})
+	}
+	return bindings
+}
+
+// teamProfile returns the Profile of a team; the profile controller creates its namespace and
+// grants the owner access to it.
+func teamProfile(p kfdefsv3.TeamProfile) *profilev2.Profile {
+	return &profilev2.Profile{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Profile",
+			APIVersion: "kubeflow.org/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: p.Name,
+		},
+		Spec: profilev2.ProfileSpec{
+			Owner: rbacv2.Subject{
+				Kind: "User",
+				Name: p.Owner,
+			},
+		},
+	}
+}
+
+// contributorBindings returns the RoleBindings granting the contributors of a profile access to
+// its namespace. They are annotated like the bindings of the access management API so the
+// central dashboard lists the contributors.
+func (kustomize *kustomize) contributorBindings(p kfdefsv3.TeamProfile) []*rbacv2.RoleBinding {
+	bindings := []*rbacv2.RoleBinding{}
+	for _, c := range p.Contributors {
+		role := c.Role
+		if role == "" {
+			role = kfdefsv3.ContributorRoleEdit
+		}
+		clusterRole := kubeflowEditRole
+		if role == kfdefsv3.ContributorRoleView {
+			clusterRole = kubeflowViewRole
+		}
+		bindings = append(bindings, &rbacv2.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      userBindingName(c.User, clusterRole),
+				Namespace: p.Name,
+				Labels:    kustomize.ownershipLabels(),
+				Annotations: map[string]string{
+					"user": c.User,
+					"role": string(role),
+				},
+			},
+			RoleRef: rbacv2.RoleRef{
+				APIGroup: rbacv2.GroupName,
+				Kind:     "ClusterRole",
+				Name:     kustomize.scopedName(clusterRole),
+			},
+			Subjects: []rbacv2.Subject{userSubject(c.User)},
+		})
+	}
+	return bindings
+}
+
+// bootstrapUsers grants the admins of the KfDef their cluster role and creates the profiles of
+// the teams and the bindings of their contributors so the deployment is usable right away.
+// Existing bindings are updated; existing profiles are left alone.
+func (kustomize *kustomize) bootstrapUsers(core corev1.CoreV1Interface, rbac rbacv1.RbacV1Interface) error {
+	for _, b := range kustomize.adminBindings() {
+		if err := applyClusterRoleBinding(rbac, b); err != nil {
+			return usersError("clusterrolebinding", b.Name, err)
+		}
+		kustomize.recordResource(usersSource, "rbac.authorization.k8s.io/v1", "ClusterRoleBinding", "", b.Name)
+	}
+
+	for _, p := range kustomize.kfDef.Spec.Profiles {
+		if _, err := core.Namespaces().Get(p.Name, metav1.GetOptions{}); err == nil {
+			log.Infof("Profile namespace already exists: %v", p.Name)
+		} else {
+			body, err := json.Marshal(teamProfile(p))
+			if err != nil {
+				return err
+			}
+			log.Infof("Creating profile %v owned by %v", p.Name, p.Owner)
+			if err := kustomize.deployResources(kustomize.restConfig, profilesSource, body); err != nil {
+				return usersError("profile", p.Name, err)
+			}
+		}
+	}
+
+	for _, p := range kustomize.kfDef.Spec.Profiles {
+		if len(p.Contributors) == 0 {
+			continue
+		}
+		// The profile controller creates the namespace asynchronously.
+		if err := waitForNamespace(core, p.Name); err != nil {
+			return err
+		}
+		for _, b := range kustomize.contributorBindings(p) {
+			if err := applyRoleBinding(rbac, b); err != nil {
+				return usersError("rolebinding", b.Namespace+"/"+b.Name, err)
+			}
+			kustomize.recordResource(usersSource, "rbac.authorization.k8s.io/v1", "RoleBinding", b.Namespace, b.Name)
+		}
+	}
+	return nil
+}
+
+// applyClusterRoleBinding creates the binding or updates its subjects if it exists.
+func applyClusterRoleBinding(rbac rbacv1.RbacV1Interface, b *rbacv2.ClusterRoleBinding) error {
+	existing, err := rbac.ClusterRoleBindings().Get(b.Name, metav1.GetOptions{})
+	switch {
+	case k8serrors.IsNotFound(err):
+		log.Infof("Creating clusterrolebinding %v", b.Name)
+		_, err = rbac.ClusterRoleBindings().Create(b)
+	case err == nil:
+		existing.Labels = b.Labels
+		existing.Subjects = b.Subjects
+		_, err = rbac.ClusterRoleBindings().Update(existing)
+	}
+	return err
+}
+
+// applyRoleBinding creates the binding or updates its subjects if it exists.
+func applyRoleBinding(rbac rbacv1.RbacV1Interface, b *rbacv2.RoleBinding) error {
+	bindings := rbac.RoleBindings(b.Namespace)
+	existing, err := bindings.Get(b.Name, metav1.GetOptions{})
+	switch {
+	case k8serrors.IsNotFound(err):
+		log.Infof("Creating rolebinding %v/%v", b.Namespace, b.Name)
+		_, err = bindings.Create(b)
+	case err == nil:
+		existing.Labels = b.Labels
+		existing.Annotations = b.Annotations
+		existing.Subjects = b.Subjects
+		_, err = bindings.Update(existing)
+	}
+	return err
+}
+
+// waitForNamespace waits for the namespace of a profile to be created by the profile controller.
+func waitForNamespace(core corev1.CoreV1Interface, namespace string) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 3 * time.Second
+	b.MaxInterval = 30 * time.Second
+	b.MaxElapsedTime = 15 * time.Minute
+	return backoff.Retry(func() error {
+		_, nsErr := core.Namespaces().Get(namespace, metav1.GetOptions{})
+		if nsErr != nil {
+			msg := fmt.Sprintf("Could not find namespace %v, wait and retry: %v", namespace, nsErr)
+			log.Warnf(msg)
+			return &kfapisv3.KfError{
+				Code:    int(kfapisv3.INVALID_ARGUMENT),
+				Message: msg,
+			}
+		}
+		return nil
+	}, b)
+}
+
+func usersError(kind string, name string, err error) error {
+	return &kfapisv3.KfError{
+		Code:    int(kfapisv3.INTERNAL_ERROR),
+		Message: fmt.Sprintf("couldn't apply %v %v Error: %v", kind, name, err),
+	}
+}
@@ -0,0 +1,98 @@
+package kustomize
+
+import (
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+func TestUserBindingName(t *testing.T) {
+	cases := map[string]string{
+		"dev@acme.com":         "user-dev-acme-com-clusterrole-kubeflow-edit",
+		"Jane.Doe+ml@acme.com": "user-jane-doe-ml-acme-com-clusterrole-kubeflow-edit",
+	}
+	for user, expected := range cases {
+		if actual := userBindingName(user, kubeflowEditRole); actual != expected {
+			t.Errorf("userBindingName(%v): got %v; want %v", user, actual, expected)
+		}
+	}
+}
+
+func TestKustomize_adminBindings(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kf-app",
+			},
+			Spec: kfdefsv3.KfDefSpec{
+				Admins: []string{"admin@acme.com", "ops@acme.com"},
+			},
+		},
+	}
+
+	bindings := k.adminBindings()
+	if len(bindings) != 2 {
+		t.Fatalf("Got %v bindings; want 2", len(bindings))
+	}
+	for i, b := range bindings {
+		admin := k.kfDef.Spec.Admins[i]
+		if b.RoleRef.Name != kubeflowAdminRole || b.RoleRef.Kind != "ClusterRole" {
+			t.Errorf("Binding %v: got role %v; want cluster role %v", b.Name, b.RoleRef, kubeflowAdminRole)
+		}
+		if len(b.Subjects) != 1 || b.Subjects[0].Name != admin || b.Subjects[0].Kind != "User" {
+			t.Errorf("Binding %v: got subjects %v; want user %v", b.Name, b.Subjects, admin)
+		}
+		if b.Labels[DeploymentLabel] != "kf-app" {
+			t.Errorf("Binding %v: got labels %v; want it owned by kf-app", b.Name, b.Labels)
+		}
+	}
+}
+
+func TestKustomize_contributorBindings(t *testing.T) {
+	k := &kustomize{
+		kfDef: &kfdefsv3.KfDef{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kf-app",
+			},
+		},
+	}
+	p := kfdefsv3.TeamProfile{
+		Name:  "team-a",
+		Owner: "lead@acme.com",
+		Contributors: []kfdefsv3.ProfileContributor{
+			{User: "dev@acme.com"},
+			{User: "analyst@acme.com", Role: kfdefsv3.ContributorRoleView},
+		},
+	}
+
+	bindings := k.contributorBindings(p)
+	if len(bindings) != 2 {
+		t.Fatalf("Got %v bindings; want 2", len(bindings))
+	}
+	expected := []struct {
+		name        string
+		clusterRole string
+		annotations map[string]string
+	}{
+		{"user-dev-acme-com-clusterrole-kubeflow-edit", kubeflowEditRole, map[string]string{"user": "dev@acme.com", "role": "edit"}},
+		{"user-analyst-acme-com-clusterrole-kubeflow-view", kubeflowViewRole, map[string]string{"user": "analyst@acme.com", "role": "view"}},
+	}
+	for i, b := range bindings {
+		e := expected[i]
+		if b.Name != e.name || b.Namespace != "team-a" {
+			t.Errorf("Binding %v: got %v/%v; want team-a/%v", i, b.Namespace, b.Name, e.name)
+		}
+		if b.RoleRef.Name != e.clusterRole {
+			t.Errorf("Binding %v: got role %v; want %v", b.Name, b.RoleRef.Name, e.clusterRole)
+		}
+		if !reflect.DeepEqual(b.Annotations, e.annotations) {
+			t.Errorf("Binding %v: got annotations %v; want %v", b.Name, b.Annotations, e.annotations)
+		}
+	}
+
+	profile := teamProfile(p)
+	if profile.Name != "team-a" || profile.Spec.Owner.Name != "lead@acme.com" {
+		t.Errorf("teamProfile: got %v owned by %v; want team-a owned by lead@acme.com", profile.Name, profile.Spec.Owner.Name)
+	}
+}
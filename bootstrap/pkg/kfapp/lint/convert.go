@@ -0,0 +1,27 @@
+package lint
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+)
+
+// ConversionResult is the result of converting the app.yaml of the ksonnet based kfctl.
+type ConversionResult struct {
+	// KfDef is the converted KfDef using kustomize.
+	KfDef *kfdefs.KfDef `json:"kfDef"`
+	// Unconverted are the options which were dropped because they couldn't be converted.
+	Unconverted []kustomize.ConversionIssue `json:"unconverted,omitempty"`
+	// Errors are validation failures of the converted KfDef; it will be rejected by
+	// CreateDeployment until they are fixed.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Convert converts the ksonnet KfDef d and lints the result.
+func Convert(d *kfdefs.KfDef) *ConversionResult {
+	converted, issues := kustomize.ConvertKsonnetKfDef(d)
+	return &ConversionResult{
+		KfDef:       converted,
+		Unconverted: issues,
+		Errors:      Lint(converted).Errors,
+	}
+}
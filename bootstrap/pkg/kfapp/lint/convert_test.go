@@ -0,0 +1,26 @@
+package lint
+
+import (
+	"github.com/kubeflow/kubeflow/bootstrap/v3/config"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	d := &kfdefs.KfDef{}
+	d.Name = "kf-app"
+	d.Spec.ComponentConfig = config.ComponentConfig{
+		Components: []string{"centraldashboard", "openvino"},
+		Packages:   []string{"common"},
+	}
+
+	r := Convert(d)
+	if r.KfDef.Spec.PackageManager != "kustomize" || len(r.KfDef.Spec.Applications) != 1 ||
+		r.KfDef.Spec.Applications[0].Name != "centraldashboard" {
+		t.Errorf("Convert: got %v", utils.PrettyPrint(r.KfDef.Spec))
+	}
+	if len(r.Unconverted) != 2 || r.Unconverted[0].Field != "spec.components[openvino]" || r.Unconverted[1].Field != "spec.packages" {
+		t.Errorf("Convert unconverted: got %+v", r.Unconverted)
+	}
+}
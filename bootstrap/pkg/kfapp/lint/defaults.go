@@ -0,0 +1,22 @@
+package lint
+
+import (
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/pkg/errors"
+)
+
+// SetDefaults sets the defaults of the plugin of the platform of d. Only the gcp plugin has
+// defaults; it is added to d if it is missing.
+func SetDefaults(d *kfdefs.KfDef) error {
+	if d.Spec.Platform != kftypes.GCP {
+		return nil
+	}
+	pluginSpec := &gcp.GcpPluginSpec{}
+	if err := d.GetPluginSpec(gcp.GcpPluginName, pluginSpec); err != nil && !kfdefs.IsPluginNotFound(err) {
+		return errors.Wrapf(err, "the %v plugin is invalid", gcp.GcpPluginName)
+	}
+	pluginSpec.SetDefaults()
+	return errors.WithStack(d.SetPluginSpec(gcp.GcpPluginName, pluginSpec))
+}
@@ -0,0 +1,269 @@
+// Package lint validates, defaults, converts and lints KfDefs without a kfctl server. The kfctl
+// servers, the router and kfctl all use it so a KfDef is judged the same way whether or not a
+// server is involved.
+package lint
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// Codes identifying the lint warnings.
+const (
+	BasicAuth              = "BasicAuthInsteadOfIAP"
+	DefaultPassword        = "DefaultPassword"
+	SingleZone             = "NoZoneRedundancy"
+	DeprecatedVersion      = "DeprecatedVersion"
+	OversizedNodePool      = "OversizedNodePool"
+	UnpinnedVersion        = "UnpinnedVersion"
+	DuplicateGpuSetup      = "DuplicateGpuSetup"
+	maxRecommendedCpuNodes = 50
+	maxRecommendedGpuNodes = 16
+)
+
+// Warning flags a risky but valid configuration.
+type Warning struct {
+	// Code is a stable identifier for the kind of warning.
+	Code string `json:"code"`
+	// Field is the path of the offending field in the KfDef.
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Result is the result of linting a KfDef.
+type Result struct {
+	// Errors are validation failures; a KfDef with errors will be rejected by CreateDeployment.
+	Errors []string `json:"errors,omitempty"`
+	// Warnings are best practice violations; they don't prevent deploying.
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// check inspects a KfDef and returns any warnings.
+type check func(d *kfdefs.KfDef) []Warning
+
+// checks is the list of checks run by Lint.
+var checks = []check{
+	lintAuth,
+	lintZoneRedundancy,
+	lintVersions,
+	lintGpu,
+}
+
+// defaultPasswords are passwords commonly copied from docs and examples.
+var defaultPasswords = map[string]bool{
+	"password": true,
+	"admin":    true,
+	"kubeflow": true,
+	"12341234": true,
+	"changeme": true,
+}
+
+// deprecatedVersions are Kubeflow version prefixes that are no longer supported.
+var deprecatedVersions = []string{"v0.1", "v0.2", "v0.3", "v0.4", "v0.5"}
+
+// IsDeprecatedVersion returns true if the Kubeflow version v is no longer supported.
+func IsDeprecatedVersion(v string) bool {
+	for _, p := range deprecatedVersions {
+		if strings.HasPrefix(v, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint validates d and runs all lint checks against it.
+//
+// clusterConfig is the DM cluster config generated for d, if any. The library doesn't read it
+// from spec.appDir since callers serving requests must only read files from directories they control.
+func Lint(d *kfdefs.KfDef, clusterConfig []byte) *Result {
+	r := &Result{}
+
+	if isValid, msg := d.IsValid(); !isValid {
+		r.Errors = append(r.Errors, msg)
+	}
+
+	if err := kustomize.ValidateFeatures(d.Spec.Features); err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+
+	if d.Spec.Platform == gcp.GcpPluginName {
+		if isValid, msg := gcp.IsValid(*d); !isValid {
+			r.Errors = append(r.Errors, msg)
+		}
+	} else if isValid, msg := d.ValidatePluginSpecs(); !isValid {
+		r.Errors = append(r.Errors, msg)
+	}
+
+	for _, c := range checks {
+		r.Warnings = append(r.Warnings, c(d)...)
+	}
+	r.Warnings = append(r.Warnings, lintNodePools(clusterConfig)...)
+	return r
+}
+
+func lintAuth(d *kfdefs.KfDef) []Warning {
+	warnings := []Warning{}
+	pluginSpec := &gcp.GcpPluginSpec{}
+	if err := d.GetPluginSpec(gcp.GcpPluginName, pluginSpec); err != nil {
+		if d.Spec.UseBasicAuth {
+			warnings = append(warnings, Warning{
+				Code:    BasicAuth,
+				Field:   "spec.useBasicAuth",
+				Message: "Basic auth is less secure than IAP; consider using IAP to protect your endpoint.",
+			})
+		}
+		return warnings
+	}
+
+	if pluginSpec.Auth == nil || pluginSpec.Auth.BasicAuth == nil {
+		return warnings
+	}
+
+	warnings = append(warnings, Warning{
+		Code:    BasicAuth,
+		Field:   "spec.plugins[gcp].spec.auth.basicAuth",
+		Message: "Basic auth is less secure than IAP; consider using IAP to protect your endpoint.",
+	})
+
+	if pluginSpec.Auth.BasicAuth.Password == nil {
+		return warnings
+	}
+
+	for _, s := range d.Spec.Secrets {
+		if s.Name != pluginSpec.Auth.BasicAuth.Password.Name || s.SecretSource == nil || s.SecretSource.LiteralSource == nil {
+			continue
+		}
+		if defaultPasswords[strings.ToLower(s.SecretSource.LiteralSource.Value)] {
+			warnings = append(warnings, Warning{
+				Code:    DefaultPassword,
+				Field:   fmt.Sprintf("spec.secrets[%v]", s.Name),
+				Message: "The basic auth password is a well known default; choose a strong password.",
+			})
+		}
+	}
+	return warnings
+}
+
+func lintZoneRedundancy(d *kfdefs.KfDef) []Warning {
+	if d.Spec.Platform != gcp.GcpPluginName || d.Spec.Zone == "" || d.Spec.Region != "" {
+		return nil
+	}
+	return []Warning{
+		{
+			Code:    SingleZone,
+			Field:   "spec.zone",
+			Message: fmt.Sprintf("The cluster runs in the single zone %v; a zone outage will take down Kubeflow; set spec.region to create a regional cluster.", d.Spec.Zone),
+		},
+	}
+}
+
+func lintVersions(d *kfdefs.KfDef) []Warning {
+	warnings := []Warning{}
+
+	if IsDeprecatedVersion(d.Spec.Version) {
+		warnings = append(warnings, Warning{
+			Code:    DeprecatedVersion,
+			Field:   "spec.version",
+			Message: fmt.Sprintf("Kubeflow version %v is deprecated; please upgrade to a supported release.", d.Spec.Version),
+		})
+	}
+
+	if d.Spec.Version == "master" {
+		warnings = append(warnings, Warning{
+			Code:    UnpinnedVersion,
+			Field:   "spec.version",
+			Message: "Version master is not pinned; deployments aren't reproducible.",
+		})
+	}
+
+	for _, r := range d.Spec.Repos {
+		for _, p := range deprecatedVersions {
+			if strings.Contains(r.Uri, "/"+p) {
+				warnings = append(warnings, Warning{
+					Code:    DeprecatedVersion,
+					Field:   fmt.Sprintf("spec.repos[%v].uri", r.Name),
+					Message: fmt.Sprintf("Repo %v refers to deprecated version %v.", r.Uri, p),
+				})
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// lintNodePools checks the node pool sizes in the generated DM cluster config if there is one.
+func lintNodePools(clusterConfig []byte) []Warning {
+	if len(clusterConfig) == 0 {
+		return nil
+	}
+
+	config := struct {
+		Resources []struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"resources"`
+	}{}
+
+	if err := yaml.Unmarshal(clusterConfig, &config); err != nil {
+		log.Warnf("Could not parse %v; skipping node pool checks; error %v", gcp.CONFIG_FILE, err)
+		return nil
+	}
+
+	warnings := []Warning{}
+	limits := []struct {
+		property string
+		max      int
+	}{
+		{"cpu-pool-max-nodes", maxRecommendedCpuNodes},
+		{"gpu-pool-max-nodes", maxRecommendedGpuNodes},
+	}
+	for _, r := range config.Resources {
+		for _, l := range limits {
+			k, limit := l.property, l.max
+			// YAML numbers are unmarshaled as float64.
+			v, ok := r.Properties[k].(float64)
+			if !ok || int(v) <= limit {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				Code:    OversizedNodePool,
+				Field:   fmt.Sprintf("%v:%v", gcp.CONFIG_FILE, k),
+				Message: fmt.Sprintf("%v is %v; more than %v nodes is rarely needed and risks large bills.", k, int(v), limit),
+			})
+		}
+	}
+	return warnings
+}
+
+// lintGpu flags GPU components set up twice; by the gpu-driver application and spec.gpu.driver
+// or by GKE and spec.gpu.devicePlugin.
+func lintGpu(d *kfdefs.KfDef) []Warning {
+	warnings := []Warning{}
+	if d.Spec.Gpu == nil {
+		return warnings
+	}
+	if d.Spec.Gpu.Driver != nil {
+		for _, a := range d.Spec.Applications {
+			if a.Name == "gpu-driver" {
+				warnings = append(warnings, Warning{
+					Code:    DuplicateGpuSetup,
+					Field:   "spec.gpu.driver",
+					Message: "The gpu-driver application also installs the NVIDIA driver; remove it or spec.gpu.driver.",
+				})
+				break
+			}
+		}
+	}
+	if d.Spec.Gpu.DevicePlugin != nil && d.Spec.Platform == gcp.GcpPluginName {
+		warnings = append(warnings, Warning{
+			Code:    DuplicateGpuSetup,
+			Field:   "spec.gpu.devicePlugin",
+			Message: "GKE runs the NVIDIA device plugin on GPU nodes; remove spec.gpu.devicePlugin.",
+		})
+	}
+	return warnings
+}
@@ -0,0 +1,250 @@
+package lint
+
+import (
+	"flag"
+	"github.com/ghodss/yaml"
+	kfdefsv3 "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/utils"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestLint(t *testing.T) {
+	type testCase struct {
+		name          string
+		kfDef         *kfdefsv3.KfDef
+		gcpSpec       *gcp.GcpPluginSpec
+		clusterConfig string
+		expectCodes   []string
+		expectErrors  int
+	}
+
+	testCases := []testCase{
+		{
+			name: "iap",
+			kfDef: &kfdefsv3.KfDef{
+				Spec: kfdefsv3.KfDefSpec{
+					Version: "v0.6.1",
+				},
+			},
+			gcpSpec: &gcp.GcpPluginSpec{
+				Auth: &gcp.Auth{
+					IAP: &gcp.IAP{
+						OAuthClientId:     "someclient",
+						OAuthClientSecret: &kfdefsv3.SecretRef{Name: "someSecret"},
+					},
+				},
+			},
+			expectCodes:  []string{SingleZone},
+			expectErrors: 1,
+		},
+		{
+			name: "regional",
+			kfDef: &kfdefsv3.KfDef{
+				Spec: kfdefsv3.KfDefSpec{
+					Version: "v0.6.1",
+					Region:  "us-east1",
+				},
+			},
+			gcpSpec: &gcp.GcpPluginSpec{
+				Auth: &gcp.Auth{
+					IAP: &gcp.IAP{
+						OAuthClientId:     "someclient",
+						OAuthClientSecret: &kfdefsv3.SecretRef{Name: "someSecret"},
+					},
+				},
+			},
+			expectCodes:  []string{},
+			expectErrors: 1,
+		},
+		{
+			name: "duplicate-gpu-setup",
+			kfDef: &kfdefsv3.KfDef{
+				Spec: kfdefsv3.KfDefSpec{
+					Version:      "v0.6.1",
+					Region:       "us-east1",
+					Applications: []kfdefsv3.Application{{Name: "gpu-driver"}},
+					Gpu: &kfdefsv3.GpuConfig{
+						Driver:       &kfdefsv3.GpuDriver{},
+						DevicePlugin: &kfdefsv3.GpuDevicePlugin{},
+					},
+				},
+			},
+			gcpSpec: &gcp.GcpPluginSpec{
+				Auth: &gcp.Auth{
+					IAP: &gcp.IAP{
+						OAuthClientId:     "someclient",
+						OAuthClientSecret: &kfdefsv3.SecretRef{Name: "someSecret"},
+					},
+				},
+			},
+			expectCodes:  []string{DuplicateGpuSetup, DuplicateGpuSetup},
+			expectErrors: 1,
+		},
+		{
+			name: "basic-auth-default-password",
+			kfDef: &kfdefsv3.KfDef{
+				Spec: kfdefsv3.KfDefSpec{
+					Version: "v0.5.1",
+					Secrets: []kfdefsv3.Secret{
+						{
+							Name: "password",
+							SecretSource: &kfdefsv3.SecretSource{
+								LiteralSource: &kfdefsv3.LiteralSource{
+									Value: "Password",
+								},
+							},
+						},
+					},
+				},
+			},
+			gcpSpec: &gcp.GcpPluginSpec{
+				Auth: &gcp.Auth{
+					BasicAuth: &gcp.BasicAuth{
+						Username: "admin",
+						Password: &kfdefsv3.SecretRef{Name: "password"},
+					},
+				},
+			},
+			expectCodes:  []string{BasicAuth, DefaultPassword, DeprecatedVersion, SingleZone},
+			expectErrors: 1,
+		},
+		{
+			name: "oversized-node-pool",
+			kfDef: &kfdefsv3.KfDef{
+				Spec: kfdefsv3.KfDefSpec{
+					Version: "master",
+				},
+			},
+			clusterConfig: `
+resources:
+- name: kubeflow
+  properties:
+    cpu-pool-max-nodes: 100
+    gpu-pool-max-nodes: 4
+`,
+			expectCodes: []string{SingleZone, OversizedNodePool, UnpinnedVersion},
+			// There is no GCP plugin.
+			expectErrors: 2,
+		},
+	}
+
+	for _, c := range testCases {
+		d := c.kfDef
+		d.Name = "kf-app"
+		d.Spec.Platform = gcp.GcpPluginName
+		d.Spec.Project = "someproject"
+		d.Spec.Zone = "us-east1-d"
+
+		if c.gcpSpec != nil {
+			if err := d.SetPluginSpec(gcp.GcpPluginName, c.gcpSpec); err != nil {
+				t.Fatalf("Case %v: could not set plugin spec; %v", c.name, err)
+			}
+		}
+
+		r := Lint(d, []byte(c.clusterConfig))
+
+		codes := []string{}
+		for _, w := range r.Warnings {
+			codes = append(codes, w.Code)
+		}
+		sort.Strings(codes)
+
+		if !reflect.DeepEqual(codes, c.expectCodes) {
+			t.Errorf("Case %v: got warnings %v; want %v", c.name, utils.PrettyPrint(r.Warnings), c.expectCodes)
+		}
+
+		// PackageManager isn't set so every case fails validation.
+		if len(r.Errors) != c.expectErrors {
+			t.Errorf("Case %v: got %v errors; want %v: %v", c.name, len(r.Errors), c.expectErrors, r.Errors)
+		}
+	}
+}
+
+// golden is the output of the library for a KfDef in testdata. The defaults are only set for
+// the gcp platform and the conversion for ksonnet KfDefs.
+type golden struct {
+	Validation []kfdefsv3.FieldError `json:"validation,omitempty"`
+	Lint       Result                `json:"lint"`
+	Defaults   *kfdefsv3.KfDef       `json:"defaults,omitempty"`
+	Conversion *ConversionResult     `json:"conversion,omitempty"`
+}
+
+// normalize returns v encoded as YAML and decoded without its types so the fields omitted from
+// a golden file compare equal to their zero values.
+func normalize(t *testing.T, v interface{}) interface{} {
+	buf, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatalf("Could not encode %v; %v", v, err)
+	}
+	var n interface{}
+	if err := yaml.Unmarshal(buf, &n); err != nil {
+		t.Fatalf("Could not decode %s; %v", buf, err)
+	}
+	return n
+}
+
+// TestGolden checks the output of the library for each KfDef testdata/<name>.yaml against
+// testdata/<name>.golden. Run the tests with -update to regenerate the golden files.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(path.Join("testdata", "*.yaml"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("Could not list the KfDefs in testdata; %v", err)
+	}
+	for _, input := range inputs {
+		buf, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatalf("Could not read %v; %v", input, err)
+		}
+		d := &kfdefsv3.KfDef{}
+		if err := yaml.Unmarshal(buf, d); err != nil {
+			t.Fatalf("Could not parse %v; %v", input, err)
+		}
+
+		actual := &golden{
+			Validation: Validate(d),
+			Lint:       *Lint(d, nil),
+		}
+		if d.Spec.Platform == gcp.GcpPluginName {
+			actual.Defaults = d.DeepCopy()
+			if err := SetDefaults(actual.Defaults); err != nil {
+				t.Errorf("%v: SetDefaults error %v", input, err)
+			}
+		}
+		if d.Spec.PackageManager == "ksonnet" {
+			actual.Conversion = Convert(d)
+		}
+
+		goldenFile := strings.TrimSuffix(input, ".yaml") + ".golden"
+		if *update {
+			out, err := yaml.Marshal(actual)
+			if err != nil {
+				t.Fatalf("Could not encode the output for %v; %v", input, err)
+			}
+			if err := ioutil.WriteFile(goldenFile, out, 0644); err != nil {
+				t.Fatalf("Could not write %v; %v", goldenFile, err)
+			}
+			continue
+		}
+
+		buf, err = ioutil.ReadFile(goldenFile)
+		if err != nil {
+			t.Fatalf("Could not read %v; %v", goldenFile, err)
+		}
+		expected := &golden{}
+		if err := yaml.Unmarshal(buf, expected); err != nil {
+			t.Fatalf("Could not parse %v; %v", goldenFile, err)
+		}
+		if !reflect.DeepEqual(normalize(t, actual), normalize(t, expected)) {
+			t.Errorf("%v: got\n%v\nwant the content of %v", input, utils.PrettyPrint(actual), goldenFile)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package lint
+
+import (
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+)
+
+// Validate returns the validation failures which make CreateDeployment reject d. The features
+// are mapped to overlays when the deployment is applied so unknown features are rejected up front.
+func Validate(d *kfdefs.KfDef) []kfdefs.FieldError {
+	failures := d.Validate()
+	if err := kustomize.ValidateFeatures(d.Spec.Features); err != nil {
+		failures = append(failures, kfdefs.FieldError{
+			Field:   "spec.features",
+			Message: err.Error(),
+		})
+	}
+	return failures
+}
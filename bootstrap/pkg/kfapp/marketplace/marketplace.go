@@ -0,0 +1,458 @@
+// Package marketplace generates the files needed to publish a Kubeflow configuration to GCP
+// Marketplace as a click to deploy application: the schema of the deployer and the Application
+// resource describing the installed Kubeflow. Both are derived from the KfDef so the KfDefs used
+// by kfctl and the Marketplace listing are maintained in one place.
+package marketplace
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The names of the files returned by Metadata.Files.
+const (
+	SchemaFile      = "schema.yaml"
+	ApplicationFile = "application.yaml"
+)
+
+const (
+	schemaVersion         = "v2"
+	applicationApiVersion = "v1beta1"
+	defaultNamespace      = "kubeflow"
+	minK8sVersion         = ">=1.14"
+	generatedPasswordLen  = 16
+	releaseNotesURL       = "https://github.com/kubeflow/kubeflow/releases/tag/"
+	docsURL               = "https://www.kubeflow.org/docs/"
+	deployInfoAnnotation  = "marketplace.cloud.google.com/deploy-info"
+	appNameLabel          = "app.kubernetes.io/name"
+)
+
+// selectorLabel selects the resources of the Application. kfctl sets it to the name of the
+// deployment on every resource it applies so it matches the resources of the deployment named
+// after the name property.
+const selectorLabel = kustomize.DeploymentLabel
+
+// The properties of the schema. The deployer substitutes them in the manifests as $name.
+const (
+	PropertyName              = "name"
+	PropertyNamespace         = "namespace"
+	PropertyUsername          = "username"
+	PropertyPassword          = "password"
+	PropertyOAuthClientId     = "oauthClientId"
+	PropertyOAuthClientSecret = "oauthClientSecret"
+)
+
+// componentKinds are the kinds of the resources of the Kubeflow applications the Application
+// resource groups.
+var componentKinds = []GroupKind{
+	{Group: "v1", Kind: "ConfigMap"},
+	{Group: "v1", Kind: "PersistentVolumeClaim"},
+	{Group: "v1", Kind: "Secret"},
+	{Group: "v1", Kind: "Service"},
+	{Group: "v1", Kind: "ServiceAccount"},
+	{Group: "apps/v1", Kind: "Deployment"},
+	{Group: "apps/v1", Kind: "StatefulSet"},
+	{Group: "batch/v1", Kind: "Job"},
+	{Group: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+	{Group: "networking.istio.io/v1alpha3", Kind: "VirtualService"},
+}
+
+// Options are the details of the Marketplace listing which aren't part of the KfDef.
+type Options struct {
+	// PartnerId and ProductId identify the listing; they are set in the deploy-info annotation of
+	// the Application if both are set.
+	PartnerId   string
+	ProductId   string
+	PartnerName string
+	// Manifests are the YAML manifests of the applications of the KfDef. The cluster must have
+	// the resources requested by their workloads available; no constraints are set if it is empty.
+	Manifests [][]byte
+}
+
+// Schema is the schema.yaml of a Marketplace deployer. It declares the properties users fill in
+// when deploying and the constraints on the cluster.
+type Schema struct {
+	Marketplace SchemaMetadata      `json:"x-google-marketplace"`
+	Properties  map[string]Property `json:"properties"`
+	Required    []string            `json:"required"`
+}
+
+// SchemaMetadata is the x-google-marketplace section of the schema.
+type SchemaMetadata struct {
+	SchemaVersion            string                   `json:"schemaVersion"`
+	ApplicationApiVersion    string                   `json:"applicationApiVersion"`
+	PublishedVersion         string                   `json:"publishedVersion"`
+	PublishedVersionMetadata PublishedVersionMetadata `json:"publishedVersionMetadata"`
+	ClusterConstraints       ClusterConstraints       `json:"clusterConstraints"`
+}
+
+// PublishedVersionMetadata describes the published version to users.
+type PublishedVersionMetadata struct {
+	ReleaseNote string `json:"releaseNote"`
+	Recommended bool   `json:"recommended"`
+}
+
+// ClusterConstraints are the requirements on the cluster Kubeflow is deployed to.
+type ClusterConstraints struct {
+	K8sVersion string `json:"k8sVersion"`
+	// Resources are the resources the cluster must have available; derived from the resource
+	// requests of the workloads of the manifests.
+	Resources []ResourceConstraint `json:"resources,omitempty"`
+}
+
+// ResourceConstraint requires Replicas times Requests to be available in the cluster.
+type ResourceConstraint struct {
+	Replicas int               `json:"replicas"`
+	Requests map[string]string `json:"requests"`
+}
+
+// Property is a value users provide or the deployer generates when deploying.
+type Property struct {
+	Type        string               `json:"type"`
+	Title       string               `json:"title,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Default     string               `json:"default,omitempty"`
+	Marketplace *PropertyMarketplace `json:"x-google-marketplace,omitempty"`
+}
+
+// PropertyMarketplace is the x-google-marketplace section of a property e.g. to generate it.
+type PropertyMarketplace struct {
+	Type              string             `json:"type"`
+	GeneratedPassword *GeneratedPassword `json:"generatedPassword,omitempty"`
+}
+
+// GeneratedPassword configures the passwords generated by the deployer.
+type GeneratedPassword struct {
+	Length int `json:"length"`
+}
+
+// Application is the app.k8s.io Application resource grouping the resources of the deployment
+// so the GKE console can show it.
+type Application struct {
+	ApiVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Metadata   ApplicationMetadata `json:"metadata"`
+	Spec       ApplicationSpec     `json:"spec"`
+}
+
+// ApplicationMetadata is the metadata of an Application.
+type ApplicationMetadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ApplicationSpec is the spec of an Application.
+type ApplicationSpec struct {
+	Descriptor     Descriptor    `json:"descriptor"`
+	Selector       LabelSelector `json:"selector"`
+	ComponentKinds []GroupKind   `json:"componentKinds"`
+	AddOwnerRef    bool          `json:"addOwnerRef"`
+}
+
+// Descriptor describes the deployed application to users.
+type Descriptor struct {
+	Type        string `json:"type"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Links       []Link `json:"links,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+}
+
+// Link is a link shown with the application.
+type Link struct {
+	Description string `json:"description"`
+	Url         string `json:"url"`
+}
+
+// LabelSelector selects the resources of the application.
+type LabelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
+}
+
+// GroupKind is a kind of the resources of the application.
+type GroupKind struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+}
+
+// Metadata is the Marketplace metadata of a KfDef.
+type Metadata struct {
+	Schema      *Schema
+	Application *Application
+}
+
+// Files returns the metadata as YAML keyed by the names of the files to write them to.
+func (m *Metadata) Files() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for name, v := range map[string]interface{}{SchemaFile: m.Schema, ApplicationFile: m.Application} {
+		buf, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		files[name] = buf
+	}
+	return files, nil
+}
+
+// Generate derives the Marketplace metadata of d. The KfDef must pin a released Kubeflow version
+// since Marketplace only accepts semantic versions.
+func Generate(d *kfdefs.KfDef, opts Options) (*Metadata, error) {
+	version := strings.TrimPrefix(d.Spec.Version, "v")
+	if !isSemanticVersion(version) {
+		return nil, fmt.Errorf("spec.version %q isn't a Kubeflow release; Marketplace listings must pin a version e.g. v0.7.0", d.Spec.Version)
+	}
+	if (opts.PartnerId == "") != (opts.ProductId == "") {
+		return nil, fmt.Errorf("partner and product ids must be set together")
+	}
+
+	namespace := d.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	resources, err := resourceConstraints(opts.Manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{
+		Marketplace: SchemaMetadata{
+			SchemaVersion:         schemaVersion,
+			ApplicationApiVersion: applicationApiVersion,
+			PublishedVersion:      version,
+			PublishedVersionMetadata: PublishedVersionMetadata{
+				ReleaseNote: fmt.Sprintf("Kubeflow %v; see %v%v", version, releaseNotesURL, d.Spec.Version),
+				Recommended: true,
+			},
+			ClusterConstraints: ClusterConstraints{
+				K8sVersion: minK8sVersion,
+				Resources:  resources,
+			},
+		},
+		Properties: map[string]Property{
+			PropertyName: {
+				Type:        "string",
+				Title:       "Deployment name",
+				Default:     d.Name,
+				Marketplace: &PropertyMarketplace{Type: "NAME"},
+			},
+			PropertyNamespace: {
+				Type:        "string",
+				Title:       "Namespace",
+				Default:     namespace,
+				Marketplace: &PropertyMarketplace{Type: "NAMESPACE"},
+			},
+		},
+		Required: []string{PropertyName, PropertyNamespace},
+	}
+
+	authProperties, err := authProperties(d)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name, p := range authProperties {
+		schema.Properties[name] = p
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	schema.Required = append(schema.Required, names...)
+
+	app := &Application{
+		ApiVersion: "app.k8s.io/" + applicationApiVersion,
+		Kind:       "Application",
+		Metadata: ApplicationMetadata{
+			Name:      "$" + PropertyName,
+			Namespace: "$" + PropertyNamespace,
+			Labels:    map[string]string{appNameLabel: "$" + PropertyName},
+		},
+		Spec: ApplicationSpec{
+			Descriptor: Descriptor{
+				Type:        "Kubeflow",
+				Version:     version,
+				Description: description(d),
+				Links: []Link{
+					{Description: "Kubeflow documentation", Url: docsURL},
+					{Description: "Release notes", Url: releaseNotesURL + d.Spec.Version},
+				},
+			},
+			Selector: LabelSelector{
+				MatchLabels: map[string]string{selectorLabel: "$" + PropertyName},
+			},
+			ComponentKinds: componentKinds,
+			AddOwnerRef:    true,
+		},
+	}
+	if opts.PartnerId != "" {
+		app.Metadata.Annotations = map[string]string{
+			deployInfoAnnotation: fmt.Sprintf(`{"partner_id": %q, "product_id": %q, "partner_name": %q}`,
+				opts.PartnerId, opts.ProductId, opts.PartnerName),
+		}
+	}
+	return &Metadata{Schema: schema, Application: app}, nil
+}
+
+// authProperties returns the properties needed to set up the authentication of the gcp plugin of
+// d. The secrets of the KfDef are never published; users provide them when deploying instead.
+func authProperties(d *kfdefs.KfDef) (map[string]Property, error) {
+	pluginSpec := &gcp.GcpPluginSpec{}
+	if err := d.GetPluginSpec(gcp.GcpPluginName, pluginSpec); err != nil {
+		if kfdefs.IsPluginNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	if pluginSpec.Auth == nil {
+		return nil, nil
+	}
+	properties := map[string]Property{}
+	if pluginSpec.Auth.BasicAuth != nil {
+		properties[PropertyUsername] = Property{
+			Type:    "string",
+			Title:   "Basic auth username",
+			Default: pluginSpec.Auth.BasicAuth.Username,
+		}
+		properties[PropertyPassword] = Property{
+			Type:  "string",
+			Title: "Basic auth password",
+			Marketplace: &PropertyMarketplace{
+				Type:              "GENERATED_PASSWORD",
+				GeneratedPassword: &GeneratedPassword{Length: generatedPasswordLen},
+			},
+		}
+	}
+	if pluginSpec.Auth.IAP != nil {
+		properties[PropertyOAuthClientId] = Property{
+			Type:        "string",
+			Title:       "OAuth client id",
+			Description: "The id of the OAuth client used by IAP to protect the Kubeflow endpoint.",
+		}
+		properties[PropertyOAuthClientSecret] = Property{
+			Type:        "string",
+			Title:       "OAuth client secret",
+			Description: "The secret of the OAuth client used by IAP.",
+		}
+	}
+	return properties, nil
+}
+
+// workload is the part of a Deployment or StatefulSet which determines the resources it requests.
+type workload struct {
+	Spec struct {
+		Replicas *int32 `json:"replicas"`
+		Template struct {
+			Spec v1.PodSpec `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+// resourceConstraints requires the cluster to have the cpu and memory requested by the pods of
+// the Deployments and StatefulSets of the manifests available. Workloads whose pods request the
+// same resources share a constraint.
+func resourceConstraints(manifests [][]byte) ([]ResourceConstraint, error) {
+	splitter := regexp.MustCompile(kftypes.YamlSeparator)
+	replicas := map[string]int{}
+	requests := map[string]map[string]string{}
+	for _, m := range manifests {
+		for _, object := range splitter.Split(string(m), -1) {
+			// Other kinds are skipped before decoding their spec since it can have any shape.
+			var meta struct {
+				Kind string `json:"kind"`
+			}
+			if err := yaml.Unmarshal([]byte(object), &meta); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if meta.Kind != "Deployment" && meta.Kind != "StatefulSet" {
+				continue
+			}
+			w := &workload{}
+			if err := yaml.Unmarshal([]byte(object), w); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			pod := podRequests(&w.Spec.Template.Spec)
+			if len(pod) == 0 {
+				continue
+			}
+			key := fmt.Sprintf("%v", pod)
+			requests[key] = pod
+			if w.Spec.Replicas == nil {
+				replicas[key]++
+			} else {
+				replicas[key] += int(*w.Spec.Replicas)
+			}
+		}
+	}
+
+	keys := []string{}
+	for k := range requests {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	constraints := []ResourceConstraint{}
+	for _, k := range keys {
+		if replicas[k] > 0 {
+			constraints = append(constraints, ResourceConstraint{Replicas: replicas[k], Requests: requests[k]})
+		}
+	}
+	if len(constraints) == 0 {
+		return nil, nil
+	}
+	return constraints, nil
+}
+
+// podRequests returns the cpu and memory requested by the containers of the pod.
+func podRequests(spec *v1.PodSpec) map[string]string {
+	requests := map[string]string{}
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		total := resource.Quantity{}
+		for _, c := range spec.Containers {
+			if q, ok := c.Resources.Requests[name]; ok {
+				total.Add(q)
+			}
+		}
+		if !total.IsZero() {
+			requests[string(name)] = total.String()
+		}
+	}
+	return requests
+}
+
+// description lists the applications of d.
+func description(d *kfdefs.KfDef) string {
+	names := []string{}
+	for _, a := range d.Spec.Applications {
+		names = append(names, a.Name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "Kubeflow makes deployments of machine learning workflows on Kubernetes simple, portable and scalable."
+	}
+	return fmt.Sprintf("Kubeflow makes deployments of machine learning workflows on Kubernetes simple, portable and scalable. Installs %v.",
+		strings.Join(names, ", "))
+}
+
+// isSemanticVersion returns true if v is of the form major.minor.patch.
+func isSemanticVersion(v string) bool {
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" || strings.Trim(p, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
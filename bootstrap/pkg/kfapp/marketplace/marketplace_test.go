@@ -0,0 +1,166 @@
+package marketplace
+
+import (
+	"github.com/ghodss/yaml"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/gcp"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testManifests are the manifests of the applications of the KfDef of TestGenerate.
+const testManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: jupyter-web-app
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        resources:
+          requests:
+            cpu: 100m
+            memory: 256Mi
+      - name: proxy
+        resources:
+          requests:
+            cpu: 400m
+            memory: 256Mi
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: metadata-db
+spec:
+  template:
+    spec:
+      containers:
+      - name: mysql
+        resources:
+          requests:
+            cpu: "1"
+            memory: 1Gi
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: centraldashboard
+spec:
+  template:
+    spec:
+      containers:
+      - name: dashboard
+        resources:
+          requests:
+            cpu: 500m
+            memory: 512Mi
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: centraldashboard
+spec:
+  ports:
+  - port: 80
+`
+
+func TestGenerate(t *testing.T) {
+	d := &kfdefs.KfDef{}
+	d.Name = "kf-app"
+	d.Spec.Version = "v0.7.0"
+	d.Spec.Applications = []kfdefs.Application{{Name: "jupyter-web-app"}, {Name: "centraldashboard"}}
+	// The quota caps the namespace; it isn't what the workloads need.
+	d.Spec.ResourceQuota = &v1.ResourceQuotaSpec{
+		Hard: v1.ResourceList{
+			v1.ResourceRequestsCPU: resource.MustParse("16"),
+			v1.ResourceMemory:      resource.MustParse("64Gi"),
+		},
+	}
+	if err := d.SetPluginSpec(gcp.GcpPluginName, &gcp.GcpPluginSpec{
+		Auth: &gcp.Auth{
+			BasicAuth: &gcp.BasicAuth{
+				Username: "admin",
+				Password: &kfdefs.SecretRef{Name: "password"},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("SetPluginSpec: %v", err)
+	}
+
+	m, err := Generate(d, Options{PartnerId: "kubeflow", ProductId: "kubeflow-gke", Manifests: [][]byte{[]byte(testManifests)}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	s := m.Schema
+	if s.Marketplace.PublishedVersion != "0.7.0" || s.Marketplace.ApplicationApiVersion != applicationApiVersion {
+		t.Errorf("Schema metadata: got %+v", s.Marketplace)
+	}
+	expectedRequired := []string{PropertyName, PropertyNamespace, PropertyPassword, PropertyUsername}
+	if !reflect.DeepEqual(s.Required, expectedRequired) {
+		t.Errorf("Required properties: got %v; want %v", s.Required, expectedRequired)
+	}
+	if s.Properties[PropertyName].Default != "kf-app" || s.Properties[PropertyNamespace].Default != defaultNamespace {
+		t.Errorf("Name and namespace properties: got %+v", s.Properties)
+	}
+	if p := s.Properties[PropertyPassword]; p.Default != "" || p.Marketplace == nil || p.Marketplace.Type != "GENERATED_PASSWORD" {
+		t.Errorf("Password property: got %+v; want a generated password", p)
+	}
+	expectedResources := []ResourceConstraint{
+		{Replicas: 1, Requests: map[string]string{"cpu": "1", "memory": "1Gi"}},
+		{Replicas: 3, Requests: map[string]string{"cpu": "500m", "memory": "512Mi"}},
+	}
+	if !reflect.DeepEqual(s.Marketplace.ClusterConstraints.Resources, expectedResources) {
+		t.Errorf("Resource constraints: got %+v; want %+v", s.Marketplace.ClusterConstraints.Resources, expectedResources)
+	}
+
+	a := m.Application
+	if a.Metadata.Name != "$name" || a.Spec.Selector.MatchLabels[kustomize.DeploymentLabel] != "$name" || a.Spec.Descriptor.Version != "0.7.0" {
+		t.Errorf("Application: got %+v", a)
+	}
+	if !strings.Contains(a.Spec.Descriptor.Description, "centraldashboard, jupyter-web-app") {
+		t.Errorf("Description: got %v; want the applications listed", a.Spec.Descriptor.Description)
+	}
+	if !strings.Contains(a.Metadata.Annotations[deployInfoAnnotation], `"product_id": "kubeflow-gke"`) {
+		t.Errorf("Deploy info: got %v", a.Metadata.Annotations)
+	}
+
+	files, err := m.Files()
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	decoded := &Schema{}
+	if err := yaml.Unmarshal(files[SchemaFile], decoded); err != nil || !reflect.DeepEqual(decoded, s) {
+		t.Errorf("%v doesn't round trip; error %v", SchemaFile, err)
+	}
+	if !strings.Contains(string(files[ApplicationFile]), "kind: Application") {
+		t.Errorf("%v: got %s", ApplicationFile, files[ApplicationFile])
+	}
+}
+
+func TestGenerate_invalid(t *testing.T) {
+	type testCase struct {
+		name    string
+		version string
+		opts    Options
+	}
+	cases := []testCase{
+		{name: "unpinned", version: "master"},
+		{name: "prerelease", version: "v0.7.0-rc.1"},
+		{name: "product-without-partner", version: "v0.7.0", opts: Options{ProductId: "kubeflow-gke"}},
+	}
+	for _, c := range cases {
+		d := &kfdefs.KfDef{}
+		d.Name = "kf-app"
+		d.Spec.Version = c.version
+		if _, err := Generate(d, c.opts); err == nil {
+			t.Errorf("Case %v: got nil; want error", c.name)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package simulate fakes deploying Kubeflow so the deploy UI, the client and the status
+// reporting can be exercised without a GCP project or a cluster e.g. for demos and tests.
+// It is both a platform, provisioning the cloud resources, and a package manager, applying
+// the applications. Every step waits about as long as it takes on GCP and can be made to fail
+// with the simulate plugin.
+package simulate
+
+import (
+	"fmt"
+	kfapis "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis"
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	// SimulatePluginName is the name of the plugin configuring the simulation.
+	SimulatePluginName = kftypes.SIMULATE
+
+	// applicationStepPrefix prefixes the name of an application to name the step applying it.
+	applicationStepPrefix = "application/"
+
+	// applicationDuration is how long applying an application takes.
+	applicationDuration = 8 * time.Second
+)
+
+// step is a simulated operation.
+type step struct {
+	name string
+	// duration is how long the step takes without a speedup.
+	duration time.Duration
+}
+
+var (
+	// platformApplySteps provision the cloud resources of a deployment.
+	platformApplySteps = []step{
+		{name: "network", duration: 30 * time.Second},
+		{name: "cluster", duration: 5 * time.Minute},
+		{name: "nodePools", duration: 2 * time.Minute},
+		{name: "iam", duration: 20 * time.Second},
+		{name: "endpoint", duration: 45 * time.Second},
+	}
+
+	// platformDeleteSteps delete the cloud resources of a deployment.
+	platformDeleteSteps = []step{
+		{name: "endpoint", duration: 15 * time.Second},
+		{name: "cluster", duration: 3 * time.Minute},
+		{name: "network", duration: 30 * time.Second},
+	}
+
+	// manifestsStep generates the manifests of the applications.
+	manifestsStep = step{name: "manifests", duration: 10 * time.Second}
+
+	// namespacesStep deletes the namespaces of the applications.
+	namespacesStep = step{name: "namespaces", duration: 30 * time.Second}
+)
+
+// stepNames returns the names of the steps other than the application steps.
+func stepNames() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	steps := append(append([]step{}, platformApplySteps...), platformDeleteSteps...)
+	for _, s := range append(steps, manifestsStep, namespacesStep) {
+		if !seen[s.name] {
+			seen[s.name] = true
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+// isStep returns true if name names a simulated step.
+func isStep(name string) bool {
+	if strings.HasPrefix(name, applicationStepPrefix) {
+		return len(name) > len(applicationStepPrefix)
+	}
+	for _, n := range stepNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterConfig returns the config of the simulated cluster. Nothing serves its host; it stands
+// in for the config of a real cluster where one is required.
+func ClusterConfig() *rest.Config {
+	return &rest.Config{Host: "https://simulated.kubeflow.invalid"}
+}
+
+// simulator runs the simulated steps of a plugin.
+type simulator struct {
+	kfDef *kfdefs.KfDef
+	// sleep waits while a step runs; tests replace it.
+	sleep func(time.Duration)
+	// rand decides which steps fail; it is seeded on first use.
+	rand *rand.Rand
+}
+
+func newSimulator(kfdef *kfdefs.KfDef) *simulator {
+	return &simulator{
+		kfDef: kfdef,
+		sleep: time.Sleep,
+	}
+}
+
+// getPluginSpec returns the spec of the simulate plugin or the default spec if the KfDef has none.
+func (s *simulator) getPluginSpec() (*SimulatePluginSpec, error) {
+	spec := &SimulatePluginSpec{}
+	if err := s.kfDef.GetPluginSpec(SimulatePluginName, spec); err != nil && !kfdefs.IsPluginNotFound(err) {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("could not read the spec of plugin %v; %v", SimulatePluginName, err),
+		}
+	}
+	if ok, msg := spec.IsValid(); !ok {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("the spec of plugin %v is invalid; %v", SimulatePluginName, msg),
+		}
+	}
+	return spec, nil
+}
+
+// run simulates a step; it returns an error if the spec fails the step.
+func (s *simulator) run(spec *SimulatePluginSpec, st step) error {
+	d := spec.duration(st.duration)
+	log.Infof("Simulating %v for deployment %v; it takes %v", st.name, s.kfDef.Name, d)
+	s.sleep(d)
+	if s.fails(spec, st.name) {
+		log.Errorf("Simulated failure of %v for deployment %v", st.name, s.kfDef.Name)
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("simulated failure of step %v", st.name),
+		}
+	}
+	return nil
+}
+
+// runSteps runs the steps in order and stops at the first failure.
+func (s *simulator) runSteps(steps []step) error {
+	spec, err := s.getPluginSpec()
+	if err != nil {
+		return err
+	}
+	for _, st := range steps {
+		if err := s.run(spec, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fails returns true if the step should fail.
+func (s *simulator) fails(spec *SimulatePluginSpec, name string) bool {
+	for _, f := range spec.FailSteps {
+		if f == name {
+			return true
+		}
+	}
+	if spec.FailureRate == 0 {
+		return false
+	}
+	if s.rand == nil {
+		seed := spec.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+	return s.rand.Float64() < spec.FailureRate
+}
+
+// Simulate implements the Platform interface by simulating the provisioning of the cloud resources.
+type Simulate struct {
+	*simulator
+}
+
+// GetPlatform returns the simulated platform.
+func GetPlatform(kfdef *kfdefs.KfDef) kftypes.Platform {
+	return &Simulate{
+		simulator: newSimulator(kfdef),
+	}
+}
+
+// GetK8sConfig return nil; the simulated cluster can't be connected to.
+func (simulate *Simulate) GetK8sConfig() (*rest.Config, *clientcmdapi.Config) {
+	return nil, nil
+}
+
+func (simulate *Simulate) Apply(resources kftypes.ResourceEnum) error {
+	if resources == kftypes.K8S {
+		return nil
+	}
+	return simulate.runSteps(platformApplySteps)
+}
+
+func (simulate *Simulate) Delete(resources kftypes.ResourceEnum) error {
+	if resources == kftypes.K8S {
+		return nil
+	}
+	return simulate.runSteps(platformDeleteSteps)
+}
+
+// Generate checks the spec of the simulate plugin so an invalid spec fails before anything is simulated.
+func (simulate *Simulate) Generate(resources kftypes.ResourceEnum) error {
+	_, err := simulate.getPluginSpec()
+	return err
+}
+
+func (simulate *Simulate) Init(kftypes.ResourceEnum) error {
+	return nil
+}
+
+// packageManager implements the KfApp interface of a package manager by simulating applying the
+// applications. It implements kustomize.Setter so it can be used in place of kustomize.
+type packageManager struct {
+	*simulator
+	// applications if non nil limits the next Apply to the named applications.
+	applications map[string]bool
+}
+
+// GetKfApp returns the simulated package manager.
+func GetKfApp(kfdef *kfdefs.KfDef) kftypes.KfApp {
+	return &packageManager{
+		simulator: newSimulator(kfdef),
+	}
+}
+
+// Apply simulates applying each application and records its status in the KfDef. Every
+// application is applied even if an earlier one fails, like kustomize.
+func (p *packageManager) Apply(resources kftypes.ResourceEnum) error {
+	// The filter only applies to this call.
+	defer p.SetApplicationFilter(nil)
+
+	spec, err := p.getPluginSpec()
+	if err != nil {
+		return err
+	}
+	failed := []string{}
+	for _, app := range p.kfDef.Spec.Applications {
+		if p.applications != nil && !p.applications[app.Name] {
+			continue
+		}
+		status := kfdefs.ApplicationStatus{
+			Name:           app.Name,
+			State:          kfdefs.ApplicationReady,
+			LastUpdateTime: metav1.Now(),
+		}
+		if err := p.run(spec, step{name: applicationStepPrefix + app.Name, duration: applicationDuration}); err != nil {
+			status.State = kfdefs.ApplicationFailed
+			status.Message = err.Error()
+			failed = append(failed, app.Name)
+		}
+		p.kfDef.SetApplicationStatus(status)
+	}
+	if len(failed) > 0 {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't apply applications %v; see the status of each application for the errors", strings.Join(failed, ", ")),
+		}
+	}
+	return nil
+}
+
+func (p *packageManager) Delete(resources kftypes.ResourceEnum) error {
+	return p.runSteps([]step{namespacesStep})
+}
+
+func (p *packageManager) Generate(resources kftypes.ResourceEnum) error {
+	return p.runSteps([]step{manifestsStep})
+}
+
+func (p *packageManager) Init(resources kftypes.ResourceEnum) error {
+	return nil
+}
+
+// SetK8sRestConfig is a no-op; the applications aren't applied to a cluster.
+func (p *packageManager) SetK8sRestConfig(r *rest.Config) {
+}
+
+func (p *packageManager) SetApplicationFilter(names []string) {
+	if names == nil {
+		p.applications = nil
+		return
+	}
+	p.applications = map[string]bool{}
+	for _, n := range names {
+		p.applications[n] = true
+	}
+}
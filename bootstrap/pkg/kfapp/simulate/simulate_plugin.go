@@ -0,0 +1,55 @@
+package simulate
+
+import (
+	"fmt"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"strings"
+	"time"
+)
+
+func init() {
+	kfdefs.RegisterPluginSpec(SimulatePluginName, func() kfdefs.PluginSpec { return &SimulatePluginSpec{} })
+}
+
+// SimulatePluginSpec configures the timing and the failures of a simulated deployment.
+// Without the plugin the steps take about as long as on GCP and never fail.
+type SimulatePluginSpec struct {
+	// Speedup divides how long each step takes e.g. 60 turns the minutes it takes to create
+	// the cluster into seconds. Defaults to 1.
+	Speedup float64 `json:"speedup,omitempty"`
+
+	// FailureRate is the probability between 0 and 1 that a step fails.
+	FailureRate float64 `json:"failureRate,omitempty"`
+
+	// FailSteps are the steps which always fail e.g. cluster, or application/jupyter-web-app
+	// to fail applying the application jupyter-web-app.
+	FailSteps []string `json:"failSteps,omitempty"`
+
+	// Seed if non zero seeds the random failures so a run can be reproduced.
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// IsValid returns true if the spec is a valid and complete spec.
+// If false it will also return a string providing a message about why its invalid.
+func (plugin *SimulatePluginSpec) IsValid() (bool, string) {
+	if plugin.Speedup < 0 {
+		return false, fmt.Sprintf("speedup %v must not be negative", plugin.Speedup)
+	}
+	if plugin.FailureRate < 0 || plugin.FailureRate > 1 {
+		return false, fmt.Sprintf("failureRate %v must be between 0 and 1", plugin.FailureRate)
+	}
+	for _, name := range plugin.FailSteps {
+		if !isStep(name) {
+			return false, fmt.Sprintf("failSteps has unknown step %v; the steps are %v and %v<name>", name, strings.Join(stepNames(), ", "), applicationStepPrefix)
+		}
+	}
+	return true, ""
+}
+
+// duration returns how long a step which takes d without a speedup is simulated for.
+func (plugin *SimulatePluginSpec) duration(d time.Duration) time.Duration {
+	if plugin.Speedup == 0 {
+		return d
+	}
+	return time.Duration(float64(d) / plugin.Speedup)
+}
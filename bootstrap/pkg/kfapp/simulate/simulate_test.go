@@ -0,0 +1,144 @@
+package simulate
+
+import (
+	kftypes "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps"
+	kfdefs "github.com/kubeflow/kubeflow/bootstrap/v3/pkg/apis/apps/kfdef/v1alpha1"
+	"github.com/kubeflow/kubeflow/bootstrap/v3/pkg/kfapp/kustomize"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The simulated package manager stands in for kustomize in the kfctl server.
+var _ kustomize.Setter = &packageManager{}
+
+func newTestKfDef(t *testing.T, spec *SimulatePluginSpec) *kfdefs.KfDef {
+	d := &kfdefs.KfDef{}
+	d.Name = "kf-app"
+	d.Spec.Applications = []kfdefs.Application{{Name: "istio"}, {Name: "jupyter-web-app"}, {Name: "pipelines"}}
+	if spec != nil {
+		if err := d.SetPluginSpec(SimulatePluginName, spec); err != nil {
+			t.Fatalf("SetPluginSpec: %v", err)
+		}
+	}
+	return d
+}
+
+// recordSleeps replaces the sleep of s and returns the durations it was called with.
+func recordSleeps(s *simulator) *[]time.Duration {
+	sleeps := &[]time.Duration{}
+	s.sleep = func(d time.Duration) {
+		*sleeps = append(*sleeps, d)
+	}
+	return sleeps
+}
+
+func TestSimulatePluginSpec_IsValid(t *testing.T) {
+	cases := []struct {
+		spec  SimulatePluginSpec
+		valid bool
+	}{
+		{spec: SimulatePluginSpec{}, valid: true},
+		{spec: SimulatePluginSpec{Speedup: 60, FailureRate: 0.2, FailSteps: []string{"cluster", "application/istio"}}, valid: true},
+		{spec: SimulatePluginSpec{Speedup: -1}, valid: false},
+		{spec: SimulatePluginSpec{FailureRate: 1.5}, valid: false},
+		{spec: SimulatePluginSpec{FailSteps: []string{"database"}}, valid: false},
+		{spec: SimulatePluginSpec{FailSteps: []string{"application/"}}, valid: false},
+	}
+	for _, c := range cases {
+		if valid, msg := c.spec.IsValid(); valid != c.valid {
+			t.Errorf("IsValid(%+v): got %v (%v); want %v", c.spec, valid, msg, c.valid)
+		}
+	}
+}
+
+func TestSimulate_Apply(t *testing.T) {
+	p := GetPlatform(newTestKfDef(t, &SimulatePluginSpec{Speedup: 60})).(*Simulate)
+	sleeps := recordSleeps(p.simulator)
+	if err := p.Apply(kftypes.PLATFORM); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	expected := []time.Duration{500 * time.Millisecond, 5 * time.Second, 2 * time.Second, 20 * time.Second / 60, 750 * time.Millisecond}
+	if !reflect.DeepEqual(*sleeps, expected) {
+		t.Errorf("Step durations: got %v; want %v", *sleeps, expected)
+	}
+
+	// The K8s resources are applied by the package manager.
+	*sleeps = nil
+	if err := p.Apply(kftypes.K8S); err != nil || len(*sleeps) != 0 {
+		t.Errorf("Apply K8S: got %v steps, %v; want none", len(*sleeps), err)
+	}
+
+	// The steps after a failed step aren't run.
+	p = GetPlatform(newTestKfDef(t, &SimulatePluginSpec{FailSteps: []string{"cluster"}})).(*Simulate)
+	sleeps = recordSleeps(p.simulator)
+	if err := p.Apply(kftypes.ALL); err == nil {
+		t.Errorf("Apply with a failing cluster: got nil; want error")
+	}
+	if len(*sleeps) != 2 {
+		t.Errorf("Apply with a failing cluster ran %v steps; want 2", len(*sleeps))
+	}
+}
+
+func TestPackageManager_Apply(t *testing.T) {
+	d := newTestKfDef(t, &SimulatePluginSpec{Speedup: 8, FailSteps: []string{"application/jupyter-web-app"}})
+	p := GetKfApp(d).(*packageManager)
+	sleeps := recordSleeps(p.simulator)
+	if err := p.Apply(kftypes.K8S); err == nil {
+		t.Errorf("Apply with a failing application: got nil; want error")
+	}
+	if len(*sleeps) != 3 || (*sleeps)[0] != time.Second {
+		t.Errorf("Step durations: got %v; want 3 steps of 1s", *sleeps)
+	}
+	states := map[string]kfdefs.ApplicationState{}
+	for _, s := range d.Status.Applications {
+		states[s.Name] = s.State
+	}
+	expected := map[string]kfdefs.ApplicationState{
+		"istio":           kfdefs.ApplicationReady,
+		"jupyter-web-app": kfdefs.ApplicationFailed,
+		"pipelines":       kfdefs.ApplicationReady,
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("Application states: got %v; want %v", states, expected)
+	}
+
+	// With a filter only the named applications are applied.
+	*sleeps = nil
+	p.SetApplicationFilter([]string{"pipelines"})
+	if err := p.Apply(kftypes.K8S); err != nil || len(*sleeps) != 1 {
+		t.Errorf("Apply with a filter: got %v steps, %v; want 1 step", len(*sleeps), err)
+	}
+	if p.applications != nil {
+		t.Errorf("Apply didn't reset the application filter")
+	}
+}
+
+func TestSimulator_fails(t *testing.T) {
+	spec := &SimulatePluginSpec{FailureRate: 0.5, Seed: 42}
+	outcomes := func() []bool {
+		s := newSimulator(newTestKfDef(t, nil))
+		o := []bool{}
+		for i := 0; i < 20; i++ {
+			o = append(o, s.fails(spec, "cluster"))
+		}
+		return o
+	}
+	first := outcomes()
+	if !reflect.DeepEqual(first, outcomes()) {
+		t.Errorf("Failures with the same seed differ")
+	}
+	failures := 0
+	for _, f := range first {
+		if f {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Errorf("Got %v failures of %v steps at a failure rate of 0.5", failures, len(first))
+	}
+
+	if newSimulator(newTestKfDef(t, nil)).fails(&SimulatePluginSpec{}, "cluster") {
+		t.Errorf("fails without failures configured: got true; want false")
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright The Kubeflow Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EmbedManifestsTag is the build tag of binaries with embedded snapshots of the repos.
+const EmbedManifestsTag = "embedmanifests"
+
+// embeddedRepos are the snapshots of the repos built into the binary keyed by URI; each is a
+// gzipped tarball of the directory GetAny fetched the URI to. They are registered by the file
+// cmd/embedManifests generates, which is only built with the embedmanifests build tag, so a
+// binary embedding the manifests can deploy without fetching them.
+var embeddedRepos = map[string][]byte{}
+
+// EmbeddedURIs returns the URIs of the repos built into the binary.
+func EmbeddedURIs() []string {
+	uris := []string{}
+	for u := range embeddedRepos {
+		uris = append(uris, u)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+// extractEmbedded writes the snapshot of src built into the binary to dst. It returns false if
+// the binary doesn't embed src.
+func extractEmbedded(dst string, src string) (bool, error) {
+	archive, ok := embeddedRepos[src]
+	if !ok {
+		return false, nil
+	}
+	log.Infof("Using the snapshot of %v built into the binary", src)
+	return true, ExtractArchive(archive, dst)
+}
+
+// ArchiveDir returns a gzipped tarball of the regular files and directories in dir with paths
+// relative to dir.
+func ArchiveDir(dir string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			log.Warnf("Skipping %v; only regular files are archived", p)
+			return nil
+		}
+		h, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		h.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ExtractArchive writes the files in the gzipped tarball archive to dir. Entries which would be
+// written outside of dir are rejected.
+func ExtractArchive(archive []byte, dir string) error {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tr := tar.NewReader(gr)
+	root := filepath.Clean(dir) + string(os.PathSeparator)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		p := filepath.Join(dir, filepath.FromSlash(h.Name))
+		if !strings.HasPrefix(p+string(os.PathSeparator), root) {
+			return fmt.Errorf("archive entry %v is outside of %v", h.Name, dir)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, os.ModePerm); err != nil {
+				return errors.WithStack(err)
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+				return errors.WithStack(err)
+			}
+			f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Mode).Perm())
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestGetAnyEmbedded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "embedded")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := path.Join(dir, "src")
+	if err := os.MkdirAll(path.Join(src, "manifests-master", "jupyter", "base"), os.ModePerm); err != nil {
+		t.Fatalf("Could not create the repo; %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(src, "manifests-master", "jupyter", "base", "kustomization.yaml"), []byte("kind: Kustomization\n"), 0644); err != nil {
+		t.Fatalf("Could not create the repo; %v", err)
+	}
+	archive, err := ArchiveDir(src)
+	if err != nil {
+		t.Fatalf("ArchiveDir: %v", err)
+	}
+
+	uri := "https://github.com/kubeflow/manifests/archive/master.tar.gz"
+	embeddedRepos[uri] = archive
+	defer delete(embeddedRepos, uri)
+
+	dst := path.Join(dir, "dst")
+	if err := GetAny(dst, uri); err != nil {
+		t.Fatalf("GetAny: %v", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(dst, "manifests-master", "jupyter", "base", "kustomization.yaml"))
+	if err != nil || string(b) != "kind: Kustomization\n" {
+		t.Errorf("GetAny didn't extract the embedded repo; got %q, %v", b, err)
+	}
+}
+
+func TestExtractArchiveOutsideDir(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0644})
+	tw.Close()
+	gw.Close()
+
+	dir, err := ioutil.TempDir("", "embedded")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ExtractArchive(buf.Bytes(), path.Join(dir, "dst")); err == nil {
+		t.Errorf("ExtractArchive wrote an entry outside of the directory")
+	}
+}
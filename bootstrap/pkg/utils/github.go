@@ -0,0 +1,438 @@
+/*
+Copyright The Kubeflow Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	gogetter "github.com/hashicorp/go-getter"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// GitHubTokenEnvVar names the env var holding a token used to fetch from GitHub.
+	GitHubTokenEnvVar = "GITHUB_TOKEN"
+	// GitHubAppIdEnvVar, GitHubAppInstallationEnvVar and GitHubAppKeyEnvVar configure a GitHub App
+	// whose installation tokens are used to fetch from GitHub. The key is the path of the PEM
+	// encoded private key of the App.
+	GitHubAppIdEnvVar           = "GITHUB_APP_ID"
+	GitHubAppInstallationEnvVar = "GITHUB_APP_INSTALLATION_ID"
+	GitHubAppKeyEnvVar          = "GITHUB_APP_PRIVATE_KEY_PATH"
+	// ArchiveCacheEnvVar overrides the directory GitHub archives are cached in.
+	ArchiveCacheEnvVar = "KFCTL_ARCHIVE_CACHE"
+
+	gitHubApiUrl = "https://api.github.com"
+	// defaultFetchRetries is how often a rate limited request is retried.
+	defaultFetchRetries = 5
+	// defaultMaxRateLimitWait bounds how long a single retry waits for a rate limit to reset.
+	defaultMaxRateLimitWait = 5 * time.Minute
+)
+
+// archiveMeta is stored next to a cached archive so it can be fetched conditionally.
+type archiveMeta struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// GitHubFetcher downloads GitHub archives with authentication and conditional requests and
+// retries requests which are rate limited.
+type GitHubFetcher struct {
+	Client *http.Client
+	// Token authenticates the requests; if nil requests are anonymous.
+	Token oauth2.TokenSource
+	// CacheDir holds the archives downloaded and their ETags.
+	CacheDir string
+	// Retries is how often a rate limited request is retried.
+	Retries int
+	// MaxWait bounds how long a single retry waits.
+	MaxWait time.Duration
+}
+
+// NewGitHubFetcher returns a fetcher authenticated with the GitHub App or the token configured
+// in the environment.
+func NewGitHubFetcher() (*GitHubFetcher, error) {
+	f := &GitHubFetcher{
+		Client:   http.DefaultClient,
+		CacheDir: os.Getenv(ArchiveCacheEnvVar),
+		Retries:  defaultFetchRetries,
+		MaxWait:  defaultMaxRateLimitWait,
+	}
+	if f.CacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			userCache = os.TempDir()
+		}
+		f.CacheDir = filepath.Join(userCache, "kfctl", "archives")
+	}
+
+	if appId := os.Getenv(GitHubAppIdEnvVar); appId != "" {
+		installation := os.Getenv(GitHubAppInstallationEnvVar)
+		keyPath := os.Getenv(GitHubAppKeyEnvVar)
+		if installation == "" || keyPath == "" {
+			return nil, fmt.Errorf("%v is set; %v and %v must be set too", GitHubAppIdEnvVar,
+				GitHubAppInstallationEnvVar, GitHubAppKeyEnvVar)
+		}
+		pemKey, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading the private key of GitHub App %v", appId)
+		}
+		key, err := parseRSAKey(pemKey)
+		if err != nil {
+			return nil, err
+		}
+		f.Token = oauth2.ReuseTokenSource(nil, &gitHubAppTokenSource{
+			client:       f.Client,
+			apiUrl:       gitHubApiUrl,
+			appId:        appId,
+			installation: installation,
+			key:          key,
+		})
+		log.Infof("Fetching from GitHub as installation %v of GitHub App %v", installation, appId)
+	} else if token := os.Getenv(GitHubTokenEnvVar); token != "" {
+		f.Token = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		log.Infof("Fetching from GitHub with the token in %v", GitHubTokenEnvVar)
+	}
+	return f, nil
+}
+
+// GetAny fetches src into dst. Snapshots built into the binary are used without fetching them.
+// GitHub archives are fetched by a GitHubFetcher configured from the environment; anything else
+// is fetched by go-getter.
+func GetAny(dst, src string) error {
+	if ok, err := extractEmbedded(dst, src); ok {
+		return err
+	}
+	if !isGitHubArchive(src) {
+		return gogetter.GetAny(dst, src)
+	}
+	f, err := NewGitHubFetcher()
+	if err != nil {
+		return err
+	}
+	return f.Fetch(dst, src)
+}
+
+// isGitHubArchive returns true if the URI is a tarball or archive of a GitHub repository.
+func isGitHubArchive(src string) bool {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if u.Host != "github.com" && u.Host != "codeload.github.com" {
+		return false
+	}
+	return strings.Contains(u.Path, "/tarball/") || strings.Contains(u.Path, "/archive/")
+}
+
+// archiveFormat splits the go-getter archive parameter from the URI and returns the format of
+// the archive.
+func archiveFormat(src string) (string, string, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	q := u.Query()
+	format := q.Get("archive")
+	q.Del("archive")
+	u.RawQuery = q.Encode()
+	if format == "" {
+		switch {
+		case strings.HasSuffix(u.Path, ".zip"):
+			format = "zip"
+		default:
+			format = "tar.gz"
+		}
+	}
+	return u.String(), format, nil
+}
+
+// Fetch downloads the archive at src, or reuses the cached copy if it didn't change, and
+// unpacks it into dst.
+func (f *GitHubFetcher) Fetch(dst, src string) error {
+	archiveUrl, format, err := archiveFormat(src)
+	if err != nil {
+		return err
+	}
+	decompressor, ok := gogetter.Decompressors[format]
+	if !ok {
+		return fmt.Errorf("archive format %v of %v isn't supported", format, src)
+	}
+	archive, err := f.download(archiveUrl)
+	if err != nil {
+		return err
+	}
+	if err := decompressor.Decompress(dst, archive, true); err != nil {
+		return errors.Wrapf(err, "unpacking %v into %v", archiveUrl, dst)
+	}
+	return nil
+}
+
+// cachePaths returns the paths of the cached archive and its metadata.
+func (f *GitHubFetcher) cachePaths(archiveUrl string) (string, string) {
+	sum := sha256.Sum256([]byte(archiveUrl))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(f.CacheDir, key+".archive"), filepath.Join(f.CacheDir, key+".json")
+}
+
+// download fetches the archive into the cache and returns its path. The request is conditional
+// on the ETag of the cached copy so an unchanged archive isn't downloaded again.
+func (f *GitHubFetcher) download(archiveUrl string) (string, error) {
+	archivePath, metaPath := f.cachePaths(archiveUrl)
+	if err := os.MkdirAll(f.CacheDir, os.ModePerm); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	meta := archiveMeta{Url: archiveUrl}
+	if data, err := ioutil.ReadFile(metaPath); err == nil {
+		if _, statErr := os.Stat(archivePath); statErr == nil {
+			if err := json.Unmarshal(data, &meta); err != nil {
+				log.Warnf("Ignoring the cache of %v; error %v", archiveUrl, err)
+				meta = archiveMeta{Url: archiveUrl}
+			}
+		}
+	}
+
+	res, err := f.get(archiveUrl, meta)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		log.Infof("%v didn't change; using the cached archive %v", archiveUrl, archivePath)
+		return archivePath, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return "", fmt.Errorf("fetching %v returned %v: %s", archiveUrl, res.Status, bytes.TrimSpace(msg))
+	}
+
+	// Write to a temporary file first so an interrupted download doesn't leave a partial archive.
+	tmp, err := ioutil.TempFile(f.CacheDir, "download-")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	_, err = io.Copy(tmp, res.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.Wrapf(err, "downloading %v", archiveUrl)
+	}
+	if err := os.Rename(tmp.Name(), archivePath); err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.WithStack(err)
+	}
+
+	meta = archiveMeta{
+		Url:          archiveUrl,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	data, err := json.Marshal(&meta)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := ioutil.WriteFile(metaPath, data, 0644); err != nil {
+		log.Warnf("Couldn't write the cache metadata of %v; error %v", archiveUrl, err)
+	}
+	return archivePath, nil
+}
+
+// get sends a conditional GET for the archive and retries it with jittered backoff while it's
+// rate limited.
+func (f *GitHubFetcher) get(archiveUrl string, meta archiveMeta) (*http.Response, error) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 2 * time.Second
+	b.MaxElapsedTime = 0
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, archiveUrl, nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+		if f.Token != nil {
+			token, err := f.Token.Token()
+			if err != nil {
+				return nil, errors.Wrap(err, "getting a GitHub token")
+			}
+			req.Header.Set("Authorization", "token "+token.AccessToken)
+		}
+
+		res, err := f.Client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching %v", archiveUrl)
+		}
+		wait, limited := rateLimitWait(res, time.Now())
+		if !limited {
+			return res, nil
+		}
+		res.Body.Close()
+		if attempt >= f.Retries {
+			return nil, fmt.Errorf("fetching %v is still rate limited after %v retries; set %v or "+
+				"configure a GitHub App to raise the limit", archiveUrl, attempt, GitHubTokenEnvVar)
+		}
+		// The backoff is randomized so concurrent deployments don't retry in lockstep.
+		if next := b.NextBackOff(); next > wait {
+			wait = next
+		}
+		if f.MaxWait > 0 && wait > f.MaxWait {
+			wait = f.MaxWait
+		}
+		log.Warnf("Fetching %v is rate limited (%v); retrying in %v", archiveUrl, res.Status, wait)
+		time.Sleep(wait)
+	}
+}
+
+// rateLimitWait returns true if the response is rate limited and how long GitHub asks to wait
+// before retrying.
+func rateLimitWait(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if after := res.Header.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(after); err == nil {
+			return at.Sub(now), true
+		}
+	}
+	if res.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0).Sub(now), true
+		}
+		return 0, true
+	}
+	// A 403 without rate limit headers is a permission error.
+	return 0, res.StatusCode == http.StatusTooManyRequests
+}
+
+// gitHubAppTokenSource exchanges a JWT signed by the key of a GitHub App for tokens of one of
+// its installations.
+type gitHubAppTokenSource struct {
+	client       *http.Client
+	apiUrl       string
+	appId        string
+	installation string
+	key          *rsa.PrivateKey
+}
+
+func (s *gitHubAppTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := appJWT(s.appId, s.key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	tokenUrl := fmt.Sprintf("%v/app/installations/%v/access_tokens", s.apiUrl, s.installation)
+	req, err := http.NewRequest(http.MethodPost, tokenUrl, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating a token for installation %v of GitHub App %v", s.installation, s.appId)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("creating a token for installation %v of GitHub App %v returned %v: %s",
+			s.installation, s.appId, res.Status, bytes.TrimSpace(msg))
+	}
+	token := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &oauth2.Token{AccessToken: token.Token, Expiry: token.ExpiresAt}, nil
+}
+
+// appJWT returns the JWT authenticating as the GitHub App. It's backdated a minute to allow for
+// clock drift and GitHub rejects JWTs valid for more than 10 minutes.
+func appJWT(appId string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appId,
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAKey parses a PEM encoded PKCS1 or PKCS8 RSA private key.
+func parseRSAKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("the private key of the GitHub App isn't PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the private key of the GitHub App")
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the private key of the GitHub App isn't an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsGitHubArchive(t *testing.T) {
+	cases := map[string]bool{
+		"https://github.com/kubeflow/manifests/archive/master.tar.gz":                true,
+		"https://github.com/kubeflow/manifests/tarball/pull/189/head?archive=tar.gz": true,
+		"https://codeload.github.com/kubeflow/manifests/tar.gz/master":               false,
+		"https://example.com/kubeflow/manifests/archive/master.tar.gz":               false,
+		"file:/tmp/manifests": false,
+		"/tmp/manifests":      false,
+	}
+	for src, expected := range cases {
+		if actual := isGitHubArchive(src); actual != expected {
+			t.Errorf("isGitHubArchive(%v): got %v; want %v", src, actual, expected)
+		}
+	}
+}
+
+func TestArchiveFormat(t *testing.T) {
+	type testCase struct {
+		src    string
+		url    string
+		format string
+	}
+	cases := []testCase{
+		{
+			src:    "https://github.com/kubeflow/manifests/tarball/master?archive=tar.gz",
+			url:    "https://github.com/kubeflow/manifests/tarball/master",
+			format: "tar.gz",
+		},
+		{
+			src:    "https://github.com/kubeflow/manifests/archive/v0.6.1.zip",
+			url:    "https://github.com/kubeflow/manifests/archive/v0.6.1.zip",
+			format: "zip",
+		},
+		{
+			src:    "https://github.com/kubeflow/manifests/archive/master.tar.gz",
+			url:    "https://github.com/kubeflow/manifests/archive/master.tar.gz",
+			format: "tar.gz",
+		},
+	}
+	for _, c := range cases {
+		u, format, err := archiveFormat(c.src)
+		if err != nil || u != c.url || format != c.format {
+			t.Errorf("archiveFormat(%v): got %v, %v, %v; want %v, %v", c.src, u, format, err, c.url, c.format)
+		}
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	type testCase struct {
+		code    int
+		headers map[string]string
+		wait    time.Duration
+		limited bool
+	}
+	cases := []testCase{
+		{code: http.StatusOK},
+		{code: http.StatusForbidden},
+		{
+			code:    http.StatusTooManyRequests,
+			headers: map[string]string{"Retry-After": "30"},
+			wait:    30 * time.Second,
+			limited: true,
+		},
+		{
+			code: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(now.Add(time.Minute).Unix(), 10),
+			},
+			wait:    time.Minute,
+			limited: true,
+		},
+		{
+			code:    http.StatusForbidden,
+			headers: map[string]string{"X-RateLimit-Remaining": "12"},
+		},
+	}
+	for i, c := range cases {
+		res := &http.Response{StatusCode: c.code, Header: http.Header{}}
+		for k, v := range c.headers {
+			res.Header.Set(k, v)
+		}
+		wait, limited := rateLimitWait(res, now)
+		if wait != c.wait || limited != c.limited {
+			t.Errorf("Case %v: rateLimitWait got %v, %v; want %v, %v", i, wait, limited, c.wait, c.limited)
+		}
+	}
+}
+
+func TestGitHubFetcherDownload(t *testing.T) {
+	requests := 0
+	rateLimited := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "token secret" {
+			t.Errorf("Got Authorization %q; want the token", r.Header.Get("Authorization"))
+		}
+		if rateLimited > 0 {
+			rateLimited--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "archives-")
+	if err != nil {
+		t.Fatalf("Could not create a temporary directory; %v", err)
+	}
+	f := &GitHubFetcher{
+		Client:   server.Client(),
+		Token:    oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "secret"}),
+		CacheDir: cacheDir,
+		Retries:  2,
+		MaxWait:  10 * time.Millisecond,
+	}
+
+	archiveUrl := server.URL + "/kubeflow/manifests/archive/master.tar.gz"
+	for i := 0; i < 2; i++ {
+		archive, err := f.download(archiveUrl)
+		if err != nil {
+			t.Fatalf("Download %v failed; %v", i, err)
+		}
+		data, err := ioutil.ReadFile(archive)
+		if err != nil || string(data) != "archive" {
+			t.Errorf("Download %v: got %q, %v; want the archive", i, data, err)
+		}
+	}
+	// The first download is retried once and the second one is answered with 304.
+	if requests != 3 {
+		t.Errorf("Got %v requests; want 3", requests)
+	}
+
+	rateLimited = 3
+	if _, err := f.download(archiveUrl); err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("Download while rate limited: got %v; want an error", err)
+	}
+}
+
+func TestAppJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate a key; %v", err)
+	}
+	now := time.Unix(1500000000, 0)
+	jwt, err := appJWT("1234", key, now)
+	if err != nil {
+		t.Fatalf("appJWT failed; %v", err)
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Got JWT %v; want 3 parts", jwt)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Could not decode the signature; %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("The signature of the JWT doesn't verify; %v", err)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("Could not decode the claims; %v", err)
+	}
+	claims := struct {
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+		Iss string `json:"iss"`
+	}{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatalf("Could not unmarshal the claims; %v", err)
+	}
+	if claims.Iss != "1234" || claims.Iat != now.Unix()-60 || claims.Exp != now.Unix()+540 {
+		t.Errorf("Got claims %+v; want the App as issuer and a 10 minute window", claims)
+	}
+}